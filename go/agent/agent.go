@@ -39,6 +39,16 @@ type Mount struct {
 	MySQLDiskUsage int64
 }
 
+// HostMetrics describes host level resource utilization, as reported by the agent
+type HostMetrics struct {
+	DiskFreeBytes         int64 // on MySQL datadir's file system
+	DiskTotalBytes        int64 // on MySQL datadir's file system
+	IOUtilizationPercent  float64
+	CPUUtilizationPercent float64
+	MemoryFreeBytes       int64
+	MemoryTotalBytes      int64
+}
+
 // Agent presents the data of an agent
 type Agent struct {
 	Hostname                string
@@ -54,6 +64,7 @@ type Agent struct {
 	MySQLPort               int64
 	MySQLDatadirDiskFree    int64
 	MySQLErrorLogTail       []string
+	HostMetrics             HostMetrics
 }
 
 // SeedOperation makes for the high level data & state of a seed operation
@@ -65,6 +76,7 @@ type SeedOperation struct {
 	EndTimestamp   string
 	IsComplete     bool
 	IsSuccessful   bool
+	DonorSelection string // Rationale of an automatically selected source
 }
 
 // SeedOperationState represents a single state (step) in a seed operation
@@ -76,6 +88,31 @@ type SeedOperationState struct {
 	ErrorMessage   string
 }
 
+// BackupPolicy describes the scheduled backups of a cluster, taken by an agent on one of the cluster's replicas
+type BackupPolicy struct {
+	ClusterName         string
+	FrequencyMinutes    uint
+	Method              string // xtrabackup|mysqldump
+	MaxLagSeconds       uint   // replicas lagging beyond this are not selected as backup source. 0 for no limit
+	PreferredDataCenter string // replicas in this data center are preferred as backup source
+	RetentionCount      uint   // number of successful backups to retain. 0 to retain all
+	LastUpdated         string
+}
+
+// BackupOperation makes for the data & state of a single backup taken by an agent
+type BackupOperation struct {
+	BackupId       int64
+	ClusterName    string
+	Hostname       string
+	Method         string
+	StartTimestamp string
+	EndTimestamp   string
+	IsComplete     bool
+	IsSuccessful   bool
+	IsExpired      bool
+	ErrorMessage   string
+}
+
 // Build an instance key for a given agent
 func (this *Agent) GetInstance() *inst.InstanceKey {
 	return &inst.InstanceKey{Hostname: this.Hostname, Port: int(this.MySQLPort)}
@@ -0,0 +1,215 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package agent
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/openark/golib/log"
+)
+
+const (
+	AgentCertificateEnrollment = "enrollment"
+	AgentCertificateRenewal    = "renewal"
+)
+
+// AgentCertificate is a certificate issued by orchestrator to an agent, upon enrollment or renewal
+type AgentCertificate struct {
+	SerialNumber     string
+	Hostname         string
+	IssueReason      string
+	IssuedTimestamp  string
+	ExpiresAt        string
+	IsRevoked        bool
+	RevokedBy        string
+	RevokeReason     string
+	RevokedTimestamp string
+}
+
+// IssuedAgentCertificate is returned to an agent enrolling or renewing its certificate. Certificates are PEM encoded.
+type IssuedAgentCertificate struct {
+	SerialNumber  string
+	Certificate   string
+	CACertificate string
+	NotAfter      time.Time
+}
+
+// IsAgentEnrollmentEnabled returns true when orchestrator issues certificates to agents
+func IsAgentEnrollmentEnabled() bool {
+	return config.Config.AgentEnrollmentCACertFile != ""
+}
+
+// agentCertificateSerialNumber is the serial number of a certificate, as recorded in the backend database
+func agentCertificateSerialNumber(certificate *x509.Certificate) string {
+	return certificate.SerialNumber.Text(16)
+}
+
+// readEnrollmentCA reads the Certificate Authority by which agent certificates are issued
+func readEnrollmentCA() (caCertificate *x509.Certificate, caKeyPair tls.Certificate, err error) {
+	caKeyPair, err = tls.LoadX509KeyPair(config.Config.AgentEnrollmentCACertFile, config.Config.AgentEnrollmentCAKeyFile)
+	if err != nil {
+		return nil, caKeyPair, err
+	}
+	caCertificate, err = x509.ParseCertificate(caKeyPair.Certificate[0])
+	if err != nil {
+		return nil, caKeyPair, err
+	}
+	if !caCertificate.IsCA {
+		return nil, caKeyPair, fmt.Errorf("%s is not a Certificate Authority certificate", config.Config.AgentEnrollmentCACertFile)
+	}
+	return caCertificate, caKeyPair, nil
+}
+
+// AppendEnrollmentCA adds the agent enrollment Certificate Authority to given pool, which is created if nil
+func AppendEnrollmentCA(pool *x509.CertPool) (*x509.CertPool, error) {
+	if pool == nil {
+		pool = x509.NewCertPool()
+	}
+	data, err := ioutil.ReadFile(config.Config.AgentEnrollmentCACertFile)
+	if err != nil {
+		return pool, err
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return pool, fmt.Errorf("No certificates parsed from %s", config.Config.AgentEnrollmentCACertFile)
+	}
+	return pool, nil
+}
+
+// parseCertificateRequest parses a PEM encoded certificate signing request, and checks its signature
+func parseCertificateRequest(csrPEM []byte) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, errors.New("Expected a PEM encoded CERTIFICATE REQUEST")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, err
+	}
+	return csr, nil
+}
+
+// newAgentCertificateTemplate returns the template of a certificate for given agent host. The certificate serves both
+// the agent's HTTPS server, and the agent as a client of orchestrator. Its subject is set by orchestrator, not the agent.
+func newAgentCertificateTemplate(hostname string) (*x509.Certificate, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: hostname},
+		// Allow for clock skew between orchestrator and the agent
+		NotBefore:   now.Add(-5 * time.Minute),
+		NotAfter:    now.Add(time.Duration(config.Config.AgentCertificateValidityHours) * time.Hour),
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if len(config.Config.AgentSSLValidOUs) > 0 {
+		template.Subject.OrganizationalUnit = []string{config.Config.AgentSSLValidOUs[0]}
+	}
+	if ip := net.ParseIP(hostname); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{hostname}
+	}
+	return template, nil
+}
+
+// signAgentCertificate issues a certificate for given agent host, signed by the enrollment Certificate Authority,
+// for the public key of given certificate signing request
+func signAgentCertificate(hostname string, csr *x509.CertificateRequest) (*IssuedAgentCertificate, error) {
+	caCertificate, caKeyPair, err := readEnrollmentCA()
+	if err != nil {
+		return nil, err
+	}
+	template, err := newAgentCertificateTemplate(hostname)
+	if err != nil {
+		return nil, err
+	}
+	certificateDER, err := x509.CreateCertificate(rand.Reader, template, caCertificate, csr.PublicKey, caKeyPair.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	issued := &IssuedAgentCertificate{
+		SerialNumber:  agentCertificateSerialNumber(template),
+		Certificate:   string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificateDER})),
+		CACertificate: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caCertificate.Raw})),
+		NotAfter:      template.NotAfter,
+	}
+	return issued, nil
+}
+
+// verifyAgentPeerCertificate rejects agents presenting a revoked certificate, as orchestrator connects to them
+func verifyAgentPeerCertificate(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return nil
+	}
+	certificate, err := x509.ParseCertificate(rawCerts[0])
+	if err != nil {
+		return err
+	}
+	return VerifyAgentCertificateNotRevoked(certificate)
+}
+
+// newAgentsClientTLSConfig returns the TLS configuration by which orchestrator connects to agents. With agent
+// enrollment enabled, orchestrator trusts the agent certificates it issued, presents its own agents certificate,
+// and rejects revoked agent certificates.
+func newAgentsClientTLSConfig() *tls.Config {
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.Config.AgentSSLSkipVerify}
+	if !IsAgentEnrollmentEnabled() {
+		return tlsConfig
+	}
+	rootCAs, err := x509.SystemCertPool()
+	if err != nil {
+		rootCAs = x509.NewCertPool()
+	}
+	if config.Config.AgentSSLCAFile != "" {
+		if data, err := ioutil.ReadFile(config.Config.AgentSSLCAFile); err != nil {
+			log.Errore(err)
+		} else {
+			rootCAs.AppendCertsFromPEM(data)
+		}
+	}
+	if rootCAs, err = AppendEnrollmentCA(rootCAs); err != nil {
+		log.Errore(err)
+	}
+	tlsConfig.RootCAs = rootCAs
+	if config.Config.AgentsUseMutualTLS && config.Config.AgentSSLCertFile != "" {
+		if certificate, err := tls.LoadX509KeyPair(config.Config.AgentSSLCertFile, config.Config.AgentSSLPrivateKeyFile); err != nil {
+			log.Errorf("Cannot load agents client certificate: %+v", err)
+		} else {
+			tlsConfig.Certificates = []tls.Certificate{certificate}
+		}
+	}
+	tlsConfig.VerifyPeerCertificate = verifyAgentPeerCertificate
+	return tlsConfig
+}
@@ -0,0 +1,320 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package agent
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+	"github.com/patrickmn/go-cache"
+)
+
+// revokedAgentCertificatesCacheKey is the key under which the serial numbers of revoked agent certificates are cached
+const revokedAgentCertificatesCacheKey = "revoked"
+
+// Revocations made on other orchestrator nodes apply within the cache's expiration
+var revokedAgentCertificatesCache = cache.New(10*time.Second, time.Minute)
+
+// lastReadRevokedAgentCertificates are the revoked agent certificates as last read from the backend. They apply while
+// the backend cannot be read, such that agents are neither locked out nor let in with revoked certificates.
+var lastReadRevokedAgentCertificates map[string]bool
+var lastReadRevokedAgentCertificatesMutex sync.Mutex
+
+// hashEnrollmentToken returns the hash of an enrollment token, as stored in the backend database.
+// Tokens themselves are never stored.
+func hashEnrollmentToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// CreateAgentEnrollmentToken creates a one-time token by which an agent on given host enrolls and obtains its
+// certificate. The token expires after AgentEnrollmentTokenExpiryMinutes.
+func CreateAgentEnrollmentToken(hostname string, createdBy string) (token string, err error) {
+	if !IsAgentEnrollmentEnabled() {
+		return "", errors.New("Agent enrollment is not enabled")
+	}
+	if hostname == "" {
+		return "", errors.New("CreateAgentEnrollmentToken: empty hostname")
+	}
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", err
+	}
+	token = hex.EncodeToString(tokenBytes)
+	_, err = db.ExecOrchestrator(`
+			insert
+				into agent_enrollment_token (
+					token_hash, hostname, created_by, created_timestamp, expires_at
+				) VALUES (
+					?, ?, ?, NOW(), NOW() + interval ? minute
+				)
+			`,
+		hashEnrollmentToken(token), hostname, createdBy, config.Config.AgentEnrollmentTokenExpiryMinutes,
+	)
+	if err != nil {
+		return "", log.Errore(err)
+	}
+	auditAgentOperation("agent-enrollment-token", &Agent{Hostname: hostname}, fmt.Sprintf("created by %s", createdBy))
+	return token, nil
+}
+
+// consumeAgentEnrollmentToken validates an enrollment token of given host, and removes it so that it cannot be reused
+func consumeAgentEnrollmentToken(hostname string, token string) error {
+	sqlResult, err := db.ExecOrchestrator(`
+			delete
+				from agent_enrollment_token
+			where
+				token_hash = ?
+				and hostname = ?
+				and expires_at > NOW()
+			`,
+		hashEnrollmentToken(token), hostname,
+	)
+	if err != nil {
+		return log.Errore(err)
+	}
+	rows, err := sqlResult.RowsAffected()
+	if err != nil {
+		return log.Errore(err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("Invalid or expired enrollment token for %s", hostname)
+	}
+	return nil
+}
+
+// issueAgentCertificate signs a certificate for given agent host and records it
+func issueAgentCertificate(hostname string, issueReason string, csr *x509.CertificateRequest) (*IssuedAgentCertificate, error) {
+	issued, err := signAgentCertificate(hostname, csr)
+	if err != nil {
+		return nil, log.Errore(err)
+	}
+	_, err = db.ExecOrchestrator(`
+			insert
+				into agent_certificate (
+					serial_number, hostname, issue_reason, issued_timestamp, expires_at
+				) VALUES (
+					?, ?, ?, NOW(), NOW() + interval ? hour
+				)
+			`,
+		issued.SerialNumber, hostname, issueReason, config.Config.AgentCertificateValidityHours,
+	)
+	if err != nil {
+		return nil, log.Errore(err)
+	}
+	auditAgentOperation("agent-certificate-issued", &Agent{Hostname: hostname}, fmt.Sprintf("%s: serial %s, expires %s", issueReason, issued.SerialNumber, issued.NotAfter.Format(time.RFC3339)))
+	return issued, nil
+}
+
+// EnrollAgent exchanges a one-time enrollment token for a certificate, issued for the public key of given PEM encoded
+// certificate signing request
+func EnrollAgent(hostname string, token string, csrPEM []byte) (*IssuedAgentCertificate, error) {
+	if !IsAgentEnrollmentEnabled() {
+		return nil, errors.New("Agent enrollment is not enabled")
+	}
+	// A malformed request does not consume the token
+	csr, err := parseCertificateRequest(csrPEM)
+	if err != nil {
+		return nil, err
+	}
+	if err := consumeAgentEnrollmentToken(hostname, token); err != nil {
+		auditAgentOperation("agent-enrollment-rejected", &Agent{Hostname: hostname}, err.Error())
+		return nil, err
+	}
+	return issueAgentCertificate(hostname, AgentCertificateEnrollment, csr)
+}
+
+// RenewAgentCertificate issues a new certificate to an agent authenticated by a valid certificate previously issued
+// to it. The presented certificate remains valid until it expires or is revoked.
+func RenewAgentCertificate(hostname string, presented *x509.Certificate, csrPEM []byte) (*IssuedAgentCertificate, error) {
+	if !IsAgentEnrollmentEnabled() {
+		return nil, errors.New("Agent enrollment is not enabled")
+	}
+	if presented == nil {
+		return nil, errors.New("Certificate renewal requires the agent to present its current certificate")
+	}
+	if presented.Subject.CommonName != hostname {
+		return nil, fmt.Errorf("Certificate of %s cannot renew a certificate of %s", presented.Subject.CommonName, hostname)
+	}
+	current, err := ReadAgentCertificate(agentCertificateSerialNumber(presented))
+	if err != nil {
+		return nil, err
+	}
+	if current == nil || current.Hostname != hostname {
+		return nil, fmt.Errorf("Presented certificate was not issued to %s by orchestrator", hostname)
+	}
+	if current.IsRevoked {
+		return nil, fmt.Errorf("Presented certificate %s is revoked", current.SerialNumber)
+	}
+	csr, err := parseCertificateRequest(csrPEM)
+	if err != nil {
+		return nil, err
+	}
+	return issueAgentCertificate(hostname, AgentCertificateRenewal, csr)
+}
+
+func readAgentCertificates(whereCondition string, args []interface{}) (certificates []AgentCertificate, err error) {
+	certificates = []AgentCertificate{}
+	query := fmt.Sprintf(`
+		select
+			serial_number,
+			hostname,
+			issue_reason,
+			issued_timestamp,
+			expires_at,
+			is_revoked,
+			revoked_by,
+			revoke_reason,
+			revoked_timestamp
+		from
+			agent_certificate
+		%s
+		order by
+			hostname, issued_timestamp desc
+		`, whereCondition)
+	err = db.QueryOrchestrator(query, args, func(m sqlutils.RowMap) error {
+		certificate := AgentCertificate{}
+		certificate.SerialNumber = m.GetString("serial_number")
+		certificate.Hostname = m.GetString("hostname")
+		certificate.IssueReason = m.GetString("issue_reason")
+		certificate.IssuedTimestamp = m.GetString("issued_timestamp")
+		certificate.ExpiresAt = m.GetString("expires_at")
+		certificate.IsRevoked = m.GetBool("is_revoked")
+		certificate.RevokedBy = m.GetString("revoked_by")
+		certificate.RevokeReason = m.GetString("revoke_reason")
+		certificate.RevokedTimestamp = m.GetString("revoked_timestamp")
+		certificates = append(certificates, certificate)
+		return nil
+	})
+	return certificates, log.Errore(err)
+}
+
+// ReadAgentCertificates returns the unexpired certificates issued to agents, potentially of a given host
+func ReadAgentCertificates(hostname string) ([]AgentCertificate, error) {
+	whereCondition := `where expires_at > NOW()`
+	if hostname == "" {
+		return readAgentCertificates(whereCondition, sqlutils.Args())
+	}
+	return readAgentCertificates(whereCondition+` and hostname = ?`, sqlutils.Args(hostname))
+}
+
+// ReadAgentCertificate returns an issued agent certificate by its serial number, or nil when not found
+func ReadAgentCertificate(serialNumber string) (*AgentCertificate, error) {
+	certificates, err := readAgentCertificates(`where serial_number = ?`, sqlutils.Args(serialNumber))
+	if err != nil || len(certificates) == 0 {
+		return nil, err
+	}
+	return &certificates[0], nil
+}
+
+// RevokeAgentCertificates revokes the certificates of an agent host; a specific certificate when serialNumber is
+// given, or else all of the host's certificates. Agents presenting a revoked certificate are rejected.
+func RevokeAgentCertificates(hostname string, serialNumber string, revokedBy string, reason string) (countRevoked int64, err error) {
+	sqlResult, err := db.ExecOrchestrator(`
+			update
+				agent_certificate
+			set
+				is_revoked = 1,
+				revoked_by = ?,
+				revoke_reason = ?,
+				revoked_timestamp = NOW()
+			where
+				hostname = ?
+				and (serial_number = ? or ? = '')
+				and is_revoked = 0
+			`,
+		revokedBy, reason, hostname, serialNumber, serialNumber,
+	)
+	if err != nil {
+		return 0, log.Errore(err)
+	}
+	revokedAgentCertificatesCache.Delete(revokedAgentCertificatesCacheKey)
+	countRevoked, err = sqlResult.RowsAffected()
+	if err != nil {
+		return 0, log.Errore(err)
+	}
+	auditAgentOperation("agent-certificate-revoked", &Agent{Hostname: hostname}, fmt.Sprintf("revoked %d certificates by %s; serial: %s; reason: %s", countRevoked, revokedBy, serialNumber, reason))
+	return countRevoked, nil
+}
+
+// readRevokedAgentCertificates returns the serial numbers of revoked, unexpired agent certificates. When the backend
+// cannot be read, the certificates last read are returned along with the error; these are nil if none were ever read.
+func readRevokedAgentCertificates() (revoked map[string]bool, err error) {
+	if cached, found := revokedAgentCertificatesCache.Get(revokedAgentCertificatesCacheKey); found {
+		return cached.(map[string]bool), nil
+	}
+	revoked = make(map[string]bool)
+	query := `
+		select
+			serial_number
+		from
+			agent_certificate
+		where
+			is_revoked = 1
+			and expires_at > NOW()
+		`
+	err = db.QueryOrchestrator(query, sqlutils.Args(), func(m sqlutils.RowMap) error {
+		revoked[m.GetString("serial_number")] = true
+		return nil
+	})
+	lastReadRevokedAgentCertificatesMutex.Lock()
+	defer lastReadRevokedAgentCertificatesMutex.Unlock()
+	if err != nil {
+		return lastReadRevokedAgentCertificates, log.Errore(err)
+	}
+	lastReadRevokedAgentCertificates = revoked
+	revokedAgentCertificatesCache.Set(revokedAgentCertificatesCacheKey, revoked, cache.DefaultExpiration)
+	return revoked, nil
+}
+
+// VerifyAgentCertificateNotRevoked returns an error when given agent certificate is revoked. While the backend cannot
+// be read, revocations are checked against the revoked certificates last read, and are not checked at all if none
+// were ever read; a briefly unavailable backend does not lock out agents.
+func VerifyAgentCertificateNotRevoked(certificate *x509.Certificate) error {
+	if !IsAgentEnrollmentEnabled() {
+		return nil
+	}
+	revoked, err := readRevokedAgentCertificates()
+	if err != nil {
+		log.Warningf("Cannot read revoked agent certificates; verifying revocation of %s against the revoked certificates last read: %+v", certificate.Subject.CommonName, err)
+	}
+	if serialNumber := agentCertificateSerialNumber(certificate); revoked[serialNumber] {
+		return fmt.Errorf("Agent certificate %s of %s is revoked", serialNumber, certificate.Subject.CommonName)
+	}
+	return nil
+}
+
+// ExpireAgentEnrollment removes expired enrollment tokens, and expired agent certificates
+func ExpireAgentEnrollment() error {
+	if _, err := db.ExecOrchestrator(`delete from agent_enrollment_token where expires_at < NOW()`); err != nil {
+		return log.Errore(err)
+	}
+	if _, err := db.ExecOrchestrator(`delete from agent_certificate where expires_at < NOW()`); err != nil {
+		return log.Errore(err)
+	}
+	return nil
+}
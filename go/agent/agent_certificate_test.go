@@ -0,0 +1,250 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	test "github.com/openark/golib/tests"
+)
+
+func init() {
+	config.Config.HostnameResolveMethod = "none"
+	config.MarkConfigurationLoaded()
+}
+
+// withAgentEnrollment points the backend at a fresh sqlite database, and enables agent enrollment with a newly
+// generated Certificate Authority, for the duration of given test
+func withAgentEnrollment(t *testing.T) *x509.Certificate {
+	previous := *config.Config
+	t.Cleanup(func() {
+		*config.Config = previous
+		revokedAgentCertificatesCache.Flush()
+		lastReadRevokedAgentCertificatesMutex.Lock()
+		lastReadRevokedAgentCertificates = nil
+		lastReadRevokedAgentCertificatesMutex.Unlock()
+	})
+	revokedAgentCertificatesCache.Flush()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.S(t).ExpectNil(err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "orchestrator agents CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	certificateDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	test.S(t).ExpectNil(err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	test.S(t).ExpectNil(err)
+
+	dir := t.TempDir()
+	config.Config.AgentEnrollmentCACertFile = filepath.Join(dir, "ca.pem")
+	config.Config.AgentEnrollmentCAKeyFile = filepath.Join(dir, "ca.key")
+	test.S(t).ExpectNil(ioutil.WriteFile(config.Config.AgentEnrollmentCACertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificateDER}), 0600))
+	test.S(t).ExpectNil(ioutil.WriteFile(config.Config.AgentEnrollmentCAKeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	config.Config.AgentSSLValidOUs = []string{"agents"}
+	config.Config.AgentCertificateValidityHours = 24
+	config.Config.AgentEnrollmentTokenExpiryMinutes = 10
+	config.Config.BackendDB = "sqlite"
+	config.Config.SQLite3DataFile = filepath.Join(dir, "orchestrator.sqlite3")
+
+	caCertificate, err := x509.ParseCertificate(certificateDER)
+	test.S(t).ExpectNil(err)
+	return caCertificate
+}
+
+// newTestCertificateRequest returns a PEM encoded certificate signing request, for a newly generated key
+func newTestCertificateRequest(t *testing.T, commonName string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.S(t).ExpectNil(err)
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: commonName}}, key)
+	test.S(t).ExpectNil(err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER})
+}
+
+// parseIssuedCertificate parses the PEM encoded certificate issued to an agent
+func parseIssuedCertificate(t *testing.T, issued *IssuedAgentCertificate) *x509.Certificate {
+	block, _ := pem.Decode([]byte(issued.Certificate))
+	test.S(t).ExpectNotNil(block)
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	test.S(t).ExpectNil(err)
+	return certificate
+}
+
+func TestParseCertificateRequest(t *testing.T) {
+	csrPEM := newTestCertificateRequest(t, "agent-host")
+	csr, err := parseCertificateRequest(csrPEM)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(csr.Subject.CommonName, "agent-host")
+
+	_, err = parseCertificateRequest([]byte("not a certificate request"))
+	test.S(t).ExpectNotNil(err)
+
+	block, _ := pem.Decode(csrPEM)
+	_, err = parseCertificateRequest(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: block.Bytes}))
+	test.S(t).ExpectNotNil(err)
+
+	// A tampered request fails its signature check
+	block.Bytes[len(block.Bytes)-1] ^= 0xff
+	_, err = parseCertificateRequest(pem.EncodeToMemory(block))
+	test.S(t).ExpectNotNil(err)
+}
+
+func TestSignAgentCertificate(t *testing.T) {
+	caCertificate := withAgentEnrollment(t)
+
+	// The subject is set by orchestrator, whatever the agent requests
+	csr, err := parseCertificateRequest(newTestCertificateRequest(t, "some-other-host"))
+	test.S(t).ExpectNil(err)
+	issued, err := signAgentCertificate("agent-host", csr)
+	test.S(t).ExpectNil(err)
+	certificate := parseIssuedCertificate(t, issued)
+
+	test.S(t).ExpectEquals(certificate.Subject.CommonName, "agent-host")
+	test.S(t).ExpectEquals(len(certificate.Subject.OrganizationalUnit), 1)
+	test.S(t).ExpectEquals(certificate.Subject.OrganizationalUnit[0], "agents")
+	test.S(t).ExpectEquals(len(certificate.DNSNames), 1)
+	test.S(t).ExpectEquals(certificate.DNSNames[0], "agent-host")
+	test.S(t).ExpectEquals(agentCertificateSerialNumber(certificate), issued.SerialNumber)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(caCertificate)
+	for _, usage := range []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth} {
+		_, err = certificate.Verify(x509.VerifyOptions{Roots: roots, DNSName: "agent-host", KeyUsages: []x509.ExtKeyUsage{usage}})
+		test.S(t).ExpectNil(err)
+	}
+
+	issued, err = signAgentCertificate("10.0.0.7", csr)
+	test.S(t).ExpectNil(err)
+	certificate = parseIssuedCertificate(t, issued)
+	test.S(t).ExpectEquals(len(certificate.DNSNames), 0)
+	test.S(t).ExpectEquals(len(certificate.IPAddresses), 1)
+	test.S(t).ExpectEquals(certificate.IPAddresses[0].String(), "10.0.0.7")
+}
+
+func TestEnrollAgent(t *testing.T) {
+	withAgentEnrollment(t)
+
+	token, err := CreateAgentEnrollmentToken("agent-host", "admin")
+	test.S(t).ExpectNil(err)
+
+	// A malformed request does not consume the token
+	_, err = EnrollAgent("agent-host", token, []byte("not a certificate request"))
+	test.S(t).ExpectNotNil(err)
+	// The token is only valid for the host it was created for
+	_, err = EnrollAgent("other-host", token, newTestCertificateRequest(t, "other-host"))
+	test.S(t).ExpectNotNil(err)
+	_, err = EnrollAgent("agent-host", "not-the-token", newTestCertificateRequest(t, "agent-host"))
+	test.S(t).ExpectNotNil(err)
+
+	issued, err := EnrollAgent("agent-host", token, newTestCertificateRequest(t, "agent-host"))
+	test.S(t).ExpectNil(err)
+	recorded, err := ReadAgentCertificate(issued.SerialNumber)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectNotNil(recorded)
+	test.S(t).ExpectEquals(recorded.Hostname, "agent-host")
+	test.S(t).ExpectEquals(recorded.IssueReason, AgentCertificateEnrollment)
+	test.S(t).ExpectFalse(recorded.IsRevoked)
+
+	// The token is consumed
+	_, err = EnrollAgent("agent-host", token, newTestCertificateRequest(t, "agent-host"))
+	test.S(t).ExpectNotNil(err)
+}
+
+func TestRenewAgentCertificate(t *testing.T) {
+	withAgentEnrollment(t)
+
+	token, err := CreateAgentEnrollmentToken("agent-host", "admin")
+	test.S(t).ExpectNil(err)
+	issued, err := EnrollAgent("agent-host", token, newTestCertificateRequest(t, "agent-host"))
+	test.S(t).ExpectNil(err)
+	presented := parseIssuedCertificate(t, issued)
+
+	_, err = RenewAgentCertificate("other-host", presented, newTestCertificateRequest(t, "other-host"))
+	test.S(t).ExpectNotNil(err)
+	renewed, err := RenewAgentCertificate("agent-host", presented, newTestCertificateRequest(t, "agent-host"))
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectNotEquals(renewed.SerialNumber, issued.SerialNumber)
+
+	_, err = RevokeAgentCertificates("agent-host", issued.SerialNumber, "admin", "test")
+	test.S(t).ExpectNil(err)
+	_, err = RenewAgentCertificate("agent-host", presented, newTestCertificateRequest(t, "agent-host"))
+	test.S(t).ExpectNotNil(err)
+}
+
+func TestVerifyAgentCertificateNotRevoked(t *testing.T) {
+	withAgentEnrollment(t)
+
+	var certificates []*x509.Certificate
+	for i := 0; i < 3; i++ {
+		token, err := CreateAgentEnrollmentToken("agent-host", "admin")
+		test.S(t).ExpectNil(err)
+		issued, err := EnrollAgent("agent-host", token, newTestCertificateRequest(t, "agent-host"))
+		test.S(t).ExpectNil(err)
+		certificates = append(certificates, parseIssuedCertificate(t, issued))
+	}
+	for _, certificate := range certificates {
+		test.S(t).ExpectNil(VerifyAgentCertificateNotRevoked(certificate))
+	}
+
+	countRevoked, err := RevokeAgentCertificates("agent-host", agentCertificateSerialNumber(certificates[0]), "admin", "test")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(countRevoked, int64(1))
+	test.S(t).ExpectNotNil(VerifyAgentCertificateNotRevoked(certificates[0]))
+	test.S(t).ExpectNil(VerifyAgentCertificateNotRevoked(certificates[1]))
+
+	// While the backend cannot be read, revocations last read apply, and other agents are not locked out
+	_, err = db.ExecOrchestrator(`drop table agent_certificate`)
+	test.S(t).ExpectNil(err)
+	revokedAgentCertificatesCache.Flush()
+	_, err = readRevokedAgentCertificates()
+	test.S(t).ExpectNotNil(err)
+	test.S(t).ExpectNotNil(VerifyAgentCertificateNotRevoked(certificates[0]))
+	test.S(t).ExpectNil(VerifyAgentCertificateNotRevoked(certificates[1]))
+	test.S(t).ExpectNil(VerifyAgentCertificateNotRevoked(certificates[2]))
+}
+
+func TestVerifyAgentCertificateNotRevokedBackendUnavailable(t *testing.T) {
+	withAgentEnrollment(t)
+
+	token, err := CreateAgentEnrollmentToken("agent-host", "admin")
+	test.S(t).ExpectNil(err)
+	issued, err := EnrollAgent("agent-host", token, newTestCertificateRequest(t, "agent-host"))
+	test.S(t).ExpectNil(err)
+
+	// Revocations were never read: agents are let in rather than locked out
+	_, err = db.ExecOrchestrator(`drop table agent_certificate`)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectNil(VerifyAgentCertificateNotRevoked(parseIssuedCertificate(t, issued)))
+}
@@ -17,17 +17,18 @@
 package agent
 
 import (
-	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/github/orchestrator/go/attributes"
 	"github.com/github/orchestrator/go/config"
 	"github.com/github/orchestrator/go/db"
 	"github.com/github/orchestrator/go/inst"
@@ -56,7 +57,7 @@ func InitHttpClient() {
 		return net.DialTimeout(network, addr, httpTimeout)
 	}
 	httpTransport := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: config.Config.AgentSSLSkipVerify},
+		TLSClientConfig: newAgentsClientTLSConfig(),
 		Dial:            dialTimeout,
 		ResponseHeaderTimeout: httpTimeout,
 	}
@@ -101,9 +102,17 @@ func readResponse(res *http.Response, err error) ([]byte, error) {
 	return body, nil
 }
 
-// SubmitAgent submits a new agent for listing
+// SubmitAgent submits a new agent for listing. An agent may rotate its token by submitting again with a new token.
 func SubmitAgent(hostname string, port int, token string) (string, error) {
-	_, err := db.ExecOrchestrator(`
+	previousToken := ""
+	err := db.QueryOrchestrator(`select token from host_agent where hostname = ?`, sqlutils.Args(hostname), func(m sqlutils.RowMap) error {
+		previousToken = m.GetString("token")
+		return nil
+	})
+	if err != nil {
+		return "", log.Errore(err)
+	}
+	_, err = db.ExecOrchestrator(`
 			replace
 				into host_agent (
 					hostname, port, token, last_submitted, count_mysql_snapshots
@@ -118,6 +127,9 @@ func SubmitAgent(hostname string, port int, token string) (string, error) {
 	if err != nil {
 		return "", log.Errore(err)
 	}
+	if previousToken != "" && previousToken != token {
+		auditAgentOperation("agent-token-rotated", &Agent{Hostname: hostname, Port: port}, "")
+	}
 
 	// Try to discover topology instances when an agent submits
 	go DiscoverAgentInstance(hostname, port)
@@ -289,6 +301,28 @@ func UpdateAgentInfo(hostname string, agent Agent) error {
 		return log.Errore(err)
 	}
 
+	return writeHostMetricsAttributes(hostname, agent.HostMetrics)
+}
+
+// writeHostMetricsAttributes stores agent reported host metrics as host attributes
+func writeHostMetricsAttributes(hostname string, hostMetrics HostMetrics) error {
+	if hostMetrics.DiskTotalBytes == 0 && hostMetrics.MemoryTotalBytes == 0 {
+		// No metrics reported
+		return nil
+	}
+	metricsAttributes := map[string]string{
+		attributes.HostDiskFreeBytesAttribute:         fmt.Sprintf("%d", hostMetrics.DiskFreeBytes),
+		attributes.HostDiskTotalBytesAttribute:        fmt.Sprintf("%d", hostMetrics.DiskTotalBytes),
+		attributes.HostIOUtilizationPercentAttribute:  fmt.Sprintf("%.2f", hostMetrics.IOUtilizationPercent),
+		attributes.HostCPUUtilizationPercentAttribute: fmt.Sprintf("%.2f", hostMetrics.CPUUtilizationPercent),
+		attributes.HostMemoryFreeBytesAttribute:       fmt.Sprintf("%d", hostMetrics.MemoryFreeBytes),
+		attributes.HostMemoryTotalBytesAttribute:      fmt.Sprintf("%d", hostMetrics.MemoryTotalBytes),
+	}
+	for attributeName, attributeValue := range metricsAttributes {
+		if err := attributes.SetHostAttributes(hostname, attributeName, attributeValue); err != nil {
+			return log.Errore(err)
+		}
+	}
 	return nil
 }
 
@@ -298,7 +332,7 @@ func baseAgentUri(agentHostname string, agentPort int) string {
 	if config.Config.AgentsUseSSL {
 		protocol = "https"
 	}
-	uri := fmt.Sprintf("%s://%s:%d/api", protocol, agentHostname, agentPort)
+	uri := fmt.Sprintf("%s://%s/api", protocol, net.JoinHostPort(agentHostname, strconv.Itoa(agentPort)))
 	log.Debugf("orchestrator-agent uri: %s", uri)
 	return uri
 }
@@ -393,6 +427,17 @@ func GetAgent(hostname string) (Agent, error) {
 				log.Errore(err)
 			}
 		}
+		{
+			hostMetricsUri := fmt.Sprintf("%s/host-metrics?token=%s", uri, token)
+			body, err := readResponse(httpGet(hostMetricsUri))
+			if err == nil {
+				err = json.Unmarshal(body, &agent.HostMetrics)
+			}
+			if err != nil {
+				// Older agents do not support host metrics; not an error
+				log.Debugf("orchestrator-agent %s: cannot read host metrics: %+v", hostname, err)
+			}
+		}
 		{
 			errorLogTailUri := fmt.Sprintf("%s/mysql-error-log-tail?token=%s", uri, token)
 			body, err := readResponse(httpGet(errorLogTailUri))
@@ -407,6 +452,21 @@ func GetAgent(hostname string) (Agent, error) {
 	return agent, err
 }
 
+// MySQLErrorLogTail reads the tail of the MySQL error log from the agent on given host
+func MySQLErrorLogTail(hostname string) (errorLogTail []string, err error) {
+	agent, token, err := readAgentBasicInfo(hostname)
+	if err != nil {
+		return errorLogTail, err
+	}
+	uri := baseAgentUri(agent.Hostname, agent.Port)
+	body, err := readResponse(httpGet(fmt.Sprintf("%s/mysql-error-log-tail?token=%s", uri, token)))
+	if err != nil {
+		return errorLogTail, err
+	}
+	err = json.Unmarshal(body, &errorLogTail)
+	return errorLogTail, err
+}
+
 // executeAgentCommandWithMethodFunc requests an agent to execute a command via HTTP api, either GET or POST,
 // with specific http method implementation by the caller
 func executeAgentCommandWithMethodFunc(hostname string, command string, methodFunc httpMethodFunc, onResponse *func([]byte)) (Agent, error) {
@@ -542,6 +602,7 @@ func AbortSeed(seedId int64) error {
 		return log.Errore(err)
 	}
 
+	setSeedPhase(seedId, SeedPhaseAborted)
 	for _, seedOperation := range seedOperations {
 		AbortSeedCommand(seedOperation.TargetHostname, seedId)
 		AbortSeedCommand(seedOperation.SourceHostname, seedId)
@@ -555,18 +616,20 @@ func PostCopy(hostname, sourceHostname string) (Agent, error) {
 	return executeAgentCommand(hostname, fmt.Sprintf("post-copy/?sourceHost=%s", sourceHostname), nil)
 }
 
-// SubmitSeedEntry submits a new seed operation entry, returning its unique ID
-func SubmitSeedEntry(targetHostname string, sourceHostname string) (int64, error) {
+// SubmitSeedEntry submits a new seed operation entry, returning its unique ID. donorSelection explains how
+// the source was selected, when selected automatically.
+func SubmitSeedEntry(targetHostname string, sourceHostname string, donorSelection string) (int64, error) {
 	res, err := db.ExecOrchestrator(`
 			insert
 				into agent_seed (
-					target_hostname, source_hostname, start_timestamp
+					target_hostname, source_hostname, start_timestamp, donor_selection
 				) VALUES (
-					?, ?, NOW()
+					?, ?, NOW(), ?
 				)
 			`,
 		targetHostname,
 		sourceHostname,
+		donorSelection,
 	)
 	if err != nil {
 		return 0, log.Errore(err)
@@ -723,6 +786,8 @@ func executeSeed(seedId int64, targetHostname string, sourceHostname string) err
 	}
 
 	// ...
+	setSeedPhase(seedId, SeedPhaseCopying)
+	recordSeedBytesCopied(seedId, 0, sourceAgent.MountPoint.MySQLDiskUsage)
 	seedStateId, _ = submitSeedStateEntry(seedId, fmt.Sprintf("%s will now receive data in background", targetHostname), "")
 	ReceiveMySQLSeedData(targetHostname, seedId)
 
@@ -737,6 +802,15 @@ func executeSeed(seedId int64, targetHostname string, sourceHostname string) err
 	var bytesCopied int64 = 0
 
 	for !copyComplete {
+		switch readSeedPhase(seedId) {
+		case SeedPhaseAborted:
+			Unmount(sourceHostname)
+			return updateSeedStateEntry(seedStateId, errors.New("Aborted"))
+		case SeedPhasePaused:
+			// A paused seed makes no progress, and is not considered stale
+			time.Sleep(30 * time.Second)
+			continue
+		}
 		targetAgentPoll, err := GetAgent(targetHostname)
 		if err != nil {
 			return log.Errore(err)
@@ -746,6 +820,7 @@ func executeSeed(seedId int64, targetHostname string, sourceHostname string) err
 			numStaleIterations++
 		}
 		bytesCopied = targetAgentPoll.MySQLDiskUsage
+		recordSeedBytesCopied(seedId, bytesCopied, sourceAgent.MountPoint.MySQLDiskUsage)
 
 		copyFailed := false
 		if _, commandCompleted, _ := seedCommandCompleted(targetHostname, seedId); commandCompleted {
@@ -777,6 +852,7 @@ func executeSeed(seedId int64, targetHostname string, sourceHostname string) err
 	}
 
 	// Cleanup:
+	setSeedPhase(seedId, SeedPhaseFinalizing)
 	seedStateId, _ = submitSeedStateEntry(seedId, fmt.Sprintf("Executing post-copy command on %s", targetHostname), "")
 	_, err = PostCopy(targetHostname, sourceHostname)
 	if err != nil {
@@ -805,16 +881,26 @@ func executeSeed(seedId int64, targetHostname string, sourceHostname string) err
 
 // Seed is the entry point for making a seed
 func Seed(targetHostname string, sourceHostname string) (int64, error) {
+	return seed(targetHostname, sourceHostname, "")
+}
+
+func seed(targetHostname string, sourceHostname string, donorSelection string) (int64, error) {
 	if targetHostname == sourceHostname {
 		return 0, log.Errorf("Cannot seed %s onto itself", targetHostname)
 	}
-	seedId, err := SubmitSeedEntry(targetHostname, sourceHostname)
+	seedId, err := SubmitSeedEntry(targetHostname, sourceHostname, donorSelection)
 	if err != nil {
 		return 0, log.Errore(err)
 	}
 
+	newSeedProgress(seedId, targetHostname, sourceHostname)
 	go func() {
 		err := executeSeed(seedId, targetHostname, sourceHostname)
+		if err == nil {
+			setSeedPhase(seedId, SeedPhaseDone)
+		} else {
+			setSeedPhase(seedId, SeedPhaseFailed)
+		}
 		updateSeedComplete(seedId, err)
 	}()
 
@@ -832,7 +918,8 @@ func readSeeds(whereCondition string, args []interface{}, limit string) ([]SeedO
 			start_timestamp,
 			end_timestamp,
 			is_complete,
-			is_successful
+			is_successful,
+			donor_selection
 		from
 			agent_seed
 		%s
@@ -849,6 +936,7 @@ func readSeeds(whereCondition string, args []interface{}, limit string) ([]SeedO
 		seedOperation.EndTimestamp = m.GetString("end_timestamp")
 		seedOperation.IsComplete = m.GetBool("is_complete")
 		seedOperation.IsSuccessful = m.GetBool("is_successful")
+		seedOperation.DonorSelection = m.GetString("donor_selection")
 
 		res = append(res, seedOperation)
 		return nil
@@ -0,0 +1,412 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+// IsValidBackupMethod checks whether given backup method is supported by agents
+func IsValidBackupMethod(method string) bool {
+	switch method {
+	case "xtrabackup", "mysqldump":
+		return true
+	}
+	return false
+}
+
+// WriteBackupPolicy creates or overwrites the backup policy of a cluster
+func WriteBackupPolicy(policy *BackupPolicy) error {
+	if !IsValidBackupMethod(policy.Method) {
+		return fmt.Errorf("Unsupported backup method: %s", policy.Method)
+	}
+	if policy.FrequencyMinutes == 0 {
+		return fmt.Errorf("Backup frequency must be positive")
+	}
+	_, err := db.ExecOrchestrator(`
+			replace
+				into agent_backup_policy (
+					cluster_name, frequency_minutes, backup_method, max_lag_seconds, preferred_data_center, retention_count, last_updated
+				) values (
+					?, ?, ?, ?, ?, ?, NOW()
+				)
+			`,
+		policy.ClusterName,
+		policy.FrequencyMinutes,
+		policy.Method,
+		policy.MaxLagSeconds,
+		policy.PreferredDataCenter,
+		policy.RetentionCount,
+	)
+	return log.Errore(err)
+}
+
+// DeleteBackupPolicy removes the backup policy of a cluster. Existing backups are unaffected.
+func DeleteBackupPolicy(clusterName string) error {
+	_, err := db.ExecOrchestrator(`
+			delete from agent_backup_policy where cluster_name = ?
+			`,
+		clusterName,
+	)
+	return log.Errore(err)
+}
+
+// ReadBackupPolicies reads backup policies, potentially of a given cluster
+func ReadBackupPolicies(clusterName string) ([]BackupPolicy, error) {
+	res := []BackupPolicy{}
+	query := `
+		select
+			cluster_name,
+			frequency_minutes,
+			backup_method,
+			max_lag_seconds,
+			preferred_data_center,
+			retention_count,
+			last_updated
+		from
+			agent_backup_policy
+		where
+			cluster_name = ? or ? = ''
+		order by
+			cluster_name
+		`
+	err := db.QueryOrchestrator(query, sqlutils.Args(clusterName, clusterName), func(m sqlutils.RowMap) error {
+		policy := BackupPolicy{}
+		policy.ClusterName = m.GetString("cluster_name")
+		policy.FrequencyMinutes = m.GetUint("frequency_minutes")
+		policy.Method = m.GetString("backup_method")
+		policy.MaxLagSeconds = m.GetUint("max_lag_seconds")
+		policy.PreferredDataCenter = m.GetString("preferred_data_center")
+		policy.RetentionCount = m.GetUint("retention_count")
+		policy.LastUpdated = m.GetString("last_updated")
+
+		res = append(res, policy)
+		return nil
+	})
+	return res, log.Errore(err)
+}
+
+// startBackupCommand requests an agent to start taking a backup using given method
+func startBackupCommand(hostname string, method string, backupId int64) (Agent, error) {
+	return executeAgentCommand(hostname, fmt.Sprintf("backup/%s/%d", method, backupId), nil)
+}
+
+// backupCommandCompleted checks an agent to see if it thinks a backup was completed.
+func backupCommandCompleted(hostname string, backupId int64) (Agent, bool, error) {
+	result := false
+	onResponse := func(body []byte) {
+		json.Unmarshal(body, &result)
+	}
+	agent, err := executeAgentCommand(hostname, fmt.Sprintf("backup-command-completed/%d", backupId), &onResponse)
+	return agent, result, err
+}
+
+// backupCommandSucceeded checks an agent to see if it thinks a backup was successful.
+func backupCommandSucceeded(hostname string, backupId int64) (Agent, bool, error) {
+	result := false
+	onResponse := func(body []byte) {
+		json.Unmarshal(body, &result)
+	}
+	agent, err := executeAgentCommand(hostname, fmt.Sprintf("backup-command-succeeded/%d", backupId), &onResponse)
+	return agent, result, err
+}
+
+// removeBackupCommand requests an agent to remove a backup it has taken
+func removeBackupCommand(hostname string, backupId int64) (Agent, error) {
+	return executeAgentCommand(hostname, fmt.Sprintf("remove-backup/%d", backupId), nil)
+}
+
+// submitBackupEntry submits a new backup operation entry, returning its unique ID. The entry is only submitted if
+// the cluster has no active backup: the check and the write are a single statement, so that two backups submitted
+// at the same time cannot both pass the check. A zero ID is returned when not submitted.
+func submitBackupEntry(clusterName string, hostname string, method string) (int64, error) {
+	res, err := db.ExecOrchestrator(`
+			insert
+				into agent_backup (
+					cluster_name, hostname, backup_method, start_timestamp, error_message
+				) select
+					?, ?, ?, NOW(), ''
+				from (select 1) as submission
+				where not exists (
+					select 1 from agent_backup where cluster_name = ? and is_complete = 0
+				)
+			`,
+		clusterName,
+		hostname,
+		method,
+		clusterName,
+	)
+	if err != nil {
+		return 0, log.Errore(err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil || rows == 0 {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// updateBackupComplete updates the backup entry, signing for completion
+func updateBackupComplete(backupId int64, backupError error) error {
+	errorMessage := ""
+	if backupError != nil {
+		errorMessage = backupError.Error()
+	}
+	_, err := db.ExecOrchestrator(`
+			update
+				agent_backup
+					set end_timestamp = NOW(),
+					is_complete = 1,
+					is_successful = ?,
+					error_message = ?
+				where
+					agent_backup_id = ?
+					and is_complete = 0
+			`,
+		(backupError == nil),
+		errorMessage,
+		backupId,
+	)
+	return log.Errore(err)
+}
+
+// Backup is the entry point for taking a backup of a cluster on a given host. It returns once the agent has
+// started the backup; FollowUpBackups then tracks the backup to completion.
+func Backup(clusterName string, hostname string, method string) (int64, error) {
+	if !IsValidBackupMethod(method) {
+		return 0, fmt.Errorf("Unsupported backup method: %s", method)
+	}
+	backupAgent, err := GetAgent(hostname)
+	if err != nil {
+		return 0, err
+	}
+	if !backupAgent.MySQLRunning {
+		return 0, fmt.Errorf("MySQL is not running on %s", hostname)
+	}
+	backupId, err := submitBackupEntry(clusterName, hostname, method)
+	if err != nil {
+		return 0, err
+	}
+	if backupId == 0 {
+		return 0, fmt.Errorf("A backup of cluster %s is still active", clusterName)
+	}
+	auditAgentOperation("agent-backup", &Agent{Hostname: hostname}, fmt.Sprintf("backup %d of cluster %s using %s", backupId, clusterName, method))
+
+	if _, err := startBackupCommand(hostname, method, backupId); err != nil {
+		updateBackupComplete(backupId, err)
+		return backupId, err
+	}
+	return backupId, nil
+}
+
+// followUpBackup checks with its agent whether an active backup has completed, and if so, records its outcome
+func followUpBackup(backup *BackupOperation) error {
+	_, completed, err := backupCommandCompleted(backup.Hostname, backup.BackupId)
+	if err != nil || !completed {
+		return err
+	}
+	_, succeeded, err := backupCommandSucceeded(backup.Hostname, backup.BackupId)
+	if err != nil {
+		return err
+	}
+	var backupError error
+	if !succeeded {
+		backupError = log.Errorf("Agent on %s reports backup %d has failed", backup.Hostname, backup.BackupId)
+	}
+	return updateBackupComplete(backup.BackupId, backupError)
+}
+
+// FollowUpBackups fails active backups which have not completed within BackupTimeoutMinutes, and records the
+// outcome of those which their agents report as completed
+func FollowUpBackups() error {
+	if err := FailStaleBackups(); err != nil {
+		return err
+	}
+	backups, err := ReadActiveBackups("")
+	if err != nil {
+		return err
+	}
+	for _, backup := range backups {
+		if err := followUpBackup(&backup); err != nil {
+			log.Errorf("FollowUpBackups: cannot follow up on backup %d on %s: %+v", backup.BackupId, backup.Hostname, err)
+		}
+	}
+	return nil
+}
+
+// readBackups reads backups from the backend table
+func readBackups(whereCondition string, args []interface{}, limit string) ([]BackupOperation, error) {
+	res := []BackupOperation{}
+	query := fmt.Sprintf(`
+		select
+			agent_backup_id,
+			cluster_name,
+			hostname,
+			backup_method,
+			start_timestamp,
+			end_timestamp,
+			is_complete,
+			is_successful,
+			is_expired,
+			error_message
+		from
+			agent_backup
+		%s
+		order by
+			agent_backup_id desc
+		%s
+		`, whereCondition, limit)
+	err := db.QueryOrchestrator(query, args, func(m sqlutils.RowMap) error {
+		backup := BackupOperation{}
+		backup.BackupId = m.GetInt64("agent_backup_id")
+		backup.ClusterName = m.GetString("cluster_name")
+		backup.Hostname = m.GetString("hostname")
+		backup.Method = m.GetString("backup_method")
+		backup.StartTimestamp = m.GetString("start_timestamp")
+		backup.EndTimestamp = m.GetString("end_timestamp")
+		backup.IsComplete = m.GetBool("is_complete")
+		backup.IsSuccessful = m.GetBool("is_successful")
+		backup.IsExpired = m.GetBool("is_expired")
+		backup.ErrorMessage = m.GetString("error_message")
+
+		res = append(res, backup)
+		return nil
+	})
+	return res, log.Errore(err)
+}
+
+// ReadActiveBackups reads backups which are still in progress, potentially of a given cluster
+func ReadActiveBackups(clusterName string) ([]BackupOperation, error) {
+	whereCondition := `
+		where
+			(cluster_name = ? or ? = '')
+			and is_complete = 0
+		`
+	return readBackups(whereCondition, sqlutils.Args(clusterName, clusterName), "")
+}
+
+// ReadRecentBackups reads recent backups, potentially of a given cluster
+func ReadRecentBackups(clusterName string) ([]BackupOperation, error) {
+	whereCondition := `
+		where
+			cluster_name = ? or ? = ''
+		`
+	return readBackups(whereCondition, sqlutils.Args(clusterName, clusterName), "limit 100")
+}
+
+// ReadLatestSuccessfulBackups reads the latest successful, unexpired backup of each cluster, or of a given cluster
+func ReadLatestSuccessfulBackups(clusterName string) ([]BackupOperation, error) {
+	whereCondition := `
+		where
+			agent_backup_id in (
+				select
+					max(agent_backup_id)
+				from
+					agent_backup
+				where
+					is_successful = 1
+					and is_expired = 0
+					and (cluster_name = ? or ? = '')
+				group by
+					cluster_name
+			)
+		`
+	return readBackups(whereCondition, sqlutils.Args(clusterName, clusterName), "")
+}
+
+// IsBackupDue checks whether a cluster's backup policy calls for a new backup: no backup of the cluster,
+// successful or not, has started within the policy's frequency.
+func IsBackupDue(policy *BackupPolicy) (isDue bool, err error) {
+	query := `
+		select
+			count(*) as count_backups
+		from
+			agent_backup
+		where
+			cluster_name = ?
+			and start_timestamp >= now() - interval ? minute
+		`
+	err = db.QueryOrchestrator(query, sqlutils.Args(policy.ClusterName, policy.FrequencyMinutes), func(m sqlutils.RowMap) error {
+		isDue = (m.GetInt("count_backups") == 0)
+		return nil
+	})
+	return isDue, log.Errore(err)
+}
+
+// readRetainedBackups reads the successful, unexpired backups of given cluster, latest first
+func readRetainedBackups(clusterName string) ([]BackupOperation, error) {
+	whereCondition := `
+		where
+			cluster_name = ?
+			and is_successful = 1
+			and is_expired = 0
+		`
+	return readBackups(whereCondition, sqlutils.Args(clusterName), "")
+}
+
+// ExpireBackups applies the retention of a backup policy: successful backups beyond the policy's retention
+// count are removed by their agents and marked as expired.
+func ExpireBackups(policy *BackupPolicy) error {
+	if policy.RetentionCount == 0 {
+		return nil
+	}
+	backups, err := readRetainedBackups(policy.ClusterName)
+	if err != nil {
+		return err
+	}
+	for i, backup := range backups {
+		if uint(i) < policy.RetentionCount {
+			continue
+		}
+		if _, err := removeBackupCommand(backup.Hostname, backup.BackupId); err != nil {
+			log.Errorf("ExpireBackups: cannot remove backup %d on %s: %+v", backup.BackupId, backup.Hostname, err)
+			continue
+		}
+		if _, err := db.ExecOrchestrator(`
+				update agent_backup set is_expired = 1 where agent_backup_id = ?
+				`, backup.BackupId,
+		); err != nil {
+			return log.Errore(err)
+		}
+	}
+	return nil
+}
+
+// FailStaleBackups marks as failed backups which have not completed within the backup timeout
+func FailStaleBackups() error {
+	_, err := db.ExecOrchestrator(`
+			update
+					agent_backup
+				set
+					end_timestamp = NOW(),
+					is_complete = 1,
+					is_successful = 0,
+					error_message = 'stale'
+				where
+					is_complete = 0
+					and start_timestamp < now() - interval ? minute
+			`,
+		config.Config.BackupTimeoutMinutes,
+	)
+	return log.Errore(err)
+}
@@ -0,0 +1,182 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package agent
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	test "github.com/openark/golib/tests"
+)
+
+// testBackupAgent serves the backup requests of an agent, reporting given backups as completed and successful
+type testBackupAgent struct {
+	sync.Mutex
+	completed map[int64]bool
+	succeeded map[int64]bool
+	removed   map[int64]bool
+}
+
+func (this *testBackupAgent) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	this.Lock()
+	defer this.Unlock()
+
+	tokens := strings.Split(strings.TrimPrefix(req.URL.Path, "/api/"), "/")
+	backupId, _ := strconv.ParseInt(tokens[len(tokens)-1], 10, 64)
+	switch tokens[0] {
+	case "backup-command-completed":
+		fmt.Fprintf(resp, "%t", this.completed[backupId])
+	case "backup-command-succeeded":
+		fmt.Fprintf(resp, "%t", this.succeeded[backupId])
+	case "remove-backup":
+		this.removed[backupId] = true
+		fmt.Fprintf(resp, "true")
+	default:
+		http.NotFound(resp, req)
+	}
+}
+
+// withTestBackupAgent points the backend at a fresh sqlite database, and registers an agent served by the
+// returned handler, for the duration of given test
+func withTestBackupAgent(t *testing.T) (*testBackupAgent, string) {
+	backendDB, dataFile := config.Config.BackendDB, config.Config.SQLite3DataFile
+	config.Config.BackendDB = "sqlite"
+	config.Config.SQLite3DataFile = filepath.Join(t.TempDir(), "orchestrator.sqlite3")
+	t.Cleanup(func() {
+		config.Config.BackendDB, config.Config.SQLite3DataFile = backendDB, dataFile
+	})
+	InitHttpClient()
+
+	backupAgent := &testBackupAgent{completed: map[int64]bool{}, succeeded: map[int64]bool{}, removed: map[int64]bool{}}
+	server := httptest.NewServer(backupAgent)
+	t.Cleanup(server.Close)
+	hostname, port, err := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	test.S(t).ExpectNil(err)
+	_, err = db.ExecOrchestrator(`
+			insert into host_agent (hostname, port, token, last_submitted, mysql_port, count_mysql_snapshots)
+			values (?, ?, 'test-token', now(), 3306, 0)
+		`, hostname, port,
+	)
+	test.S(t).ExpectNil(err)
+	return backupAgent, hostname
+}
+
+func TestSubmitBackupEntry(t *testing.T) {
+	_, hostname := withTestBackupAgent(t)
+
+	backupId, err := submitBackupEntry("shop", hostname, "xtrabackup")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(backupId > 0)
+
+	// A cluster runs one backup at a time
+	otherBackupId, err := submitBackupEntry("shop", hostname, "mysqldump")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(otherBackupId, int64(0))
+
+	booksBackupId, err := submitBackupEntry("books", hostname, "xtrabackup")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(booksBackupId > backupId)
+
+	activeBackups, err := ReadActiveBackups("")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(activeBackups), 2)
+
+	test.S(t).ExpectNil(updateBackupComplete(backupId, nil))
+	otherBackupId, err = submitBackupEntry("shop", hostname, "mysqldump")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(otherBackupId > booksBackupId)
+}
+
+func TestFollowUpBackups(t *testing.T) {
+	backupAgent, hostname := withTestBackupAgent(t)
+
+	succeededBackupId, err := submitBackupEntry("shop", hostname, "xtrabackup")
+	test.S(t).ExpectNil(err)
+	failedBackupId, err := submitBackupEntry("books", hostname, "xtrabackup")
+	test.S(t).ExpectNil(err)
+	runningBackupId, err := submitBackupEntry("music", hostname, "xtrabackup")
+	test.S(t).ExpectNil(err)
+	staleBackupId, err := submitBackupEntry("films", hostname, "xtrabackup")
+	test.S(t).ExpectNil(err)
+	_, err = db.ExecOrchestrator(`update agent_backup set start_timestamp = now() - interval 800 minute where agent_backup_id = ?`, staleBackupId)
+	test.S(t).ExpectNil(err)
+
+	backupAgent.completed[succeededBackupId] = true
+	backupAgent.succeeded[succeededBackupId] = true
+	backupAgent.completed[failedBackupId] = true
+
+	test.S(t).ExpectNil(FollowUpBackups())
+	backups, err := ReadRecentBackups("")
+	test.S(t).ExpectNil(err)
+	outcomes := map[int64]BackupOperation{}
+	for _, backup := range backups {
+		outcomes[backup.BackupId] = backup
+	}
+	test.S(t).ExpectTrue(outcomes[succeededBackupId].IsComplete)
+	test.S(t).ExpectTrue(outcomes[succeededBackupId].IsSuccessful)
+	test.S(t).ExpectTrue(outcomes[failedBackupId].IsComplete)
+	test.S(t).ExpectFalse(outcomes[failedBackupId].IsSuccessful)
+	test.S(t).ExpectFalse(outcomes[runningBackupId].IsComplete)
+	test.S(t).ExpectTrue(outcomes[staleBackupId].IsComplete)
+	test.S(t).ExpectEquals(outcomes[staleBackupId].ErrorMessage, "stale")
+
+	activeBackups, err := ReadActiveBackups("")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(activeBackups), 1)
+	test.S(t).ExpectEquals(activeBackups[0].BackupId, runningBackupId)
+}
+
+func TestExpireBackups(t *testing.T) {
+	backupAgent, hostname := withTestBackupAgent(t)
+	policy := &BackupPolicy{ClusterName: "shop", FrequencyMinutes: 60, Method: "xtrabackup", RetentionCount: 2}
+
+	isDue, err := IsBackupDue(policy)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(isDue)
+
+	backupIds := []int64{}
+	for i := 0; i < 3; i++ {
+		backupId, err := submitBackupEntry(policy.ClusterName, hostname, policy.Method)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectNil(updateBackupComplete(backupId, nil))
+		backupIds = append(backupIds, backupId)
+	}
+	isDue, err = IsBackupDue(policy)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectFalse(isDue)
+
+	test.S(t).ExpectNil(ExpireBackups(policy))
+	test.S(t).ExpectTrue(backupAgent.removed[backupIds[0]])
+	test.S(t).ExpectEquals(len(backupAgent.removed), 1)
+
+	latestBackups, err := ReadLatestSuccessfulBackups(policy.ClusterName)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(latestBackups), 1)
+	test.S(t).ExpectEquals(latestBackups[0].BackupId, backupIds[2])
+	retainedBackups, err := readRetainedBackups(policy.ClusterName)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(retainedBackups), 2)
+}
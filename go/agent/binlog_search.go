@@ -0,0 +1,86 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+)
+
+// binlogSearchResult is the response of the agent's AgentPseudoGTIDSearchCommand
+type binlogSearchResult struct {
+	Found   bool
+	LogFile string
+	LogPos  int64
+}
+
+func init() {
+	inst.RegisterLocalPseudoGTIDSearch(SearchPseudoGTIDEntry)
+}
+
+// parseBinlogSearchResult parses the response of the agent's AgentPseudoGTIDSearchCommand. A response which is not
+// a search result, e.g. as the agent does not serve the command, is an error.
+func parseBinlogSearchResult(body []byte) (*inst.BinlogCoordinates, bool, error) {
+	result := binlogSearchResult{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, false, err
+	}
+	if !result.Found {
+		return nil, false, nil
+	}
+	if result.LogFile == "" || result.LogPos <= 0 {
+		return nil, false, fmt.Errorf("invalid coordinates: %s:%d", result.LogFile, result.LogPos)
+	}
+	return &inst.BinlogCoordinates{LogFile: result.LogFile, LogPos: result.LogPos, Type: inst.BinaryLog}, true, nil
+}
+
+// SearchPseudoGTIDEntry requests the agent on an instance's host to search for a Pseudo-GTID entry in the instance's
+// binary logs, reading them locally, and to only return the coordinates of the entry. The agent serves the search
+// via AgentPseudoGTIDSearchCommand.
+func SearchPseudoGTIDEntry(instance *inst.Instance, entryText string, monotonicPseudoGTIDEntries bool, minBinlogCoordinates *inst.BinlogCoordinates) (*inst.BinlogCoordinates, bool, error) {
+	InitHttpClient()
+
+	params := url.Values{}
+	params.Set("entry", entryText)
+	params.Set("pattern", config.Config.PseudoGTIDPattern)
+	params.Set("pattern-is-fixed-substring", fmt.Sprintf("%t", config.Config.PseudoGTIDPatternIsFixedSubstring))
+	params.Set("monotonic", fmt.Sprintf("%t", monotonicPseudoGTIDEntries))
+	params.Set("latest-file", instance.SelfBinlogCoordinates.LogFile)
+	if minBinlogCoordinates != nil {
+		params.Set("min-file", minBinlogCoordinates.LogFile)
+		params.Set("min-pos", fmt.Sprintf("%d", minBinlogCoordinates.LogPos))
+	}
+
+	var body []byte
+	onResponse := func(responseBody []byte) {
+		body = responseBody
+	}
+	command := strings.TrimPrefix(config.Config.AgentPseudoGTIDSearchCommand, "/")
+	if _, err := executeAgentCommand(instance.Key.Hostname, fmt.Sprintf("%s?%s", command, params.Encode()), &onResponse); err != nil {
+		return nil, false, err
+	}
+	coordinates, found, err := parseBinlogSearchResult(body)
+	if err != nil {
+		return nil, false, fmt.Errorf("SearchPseudoGTIDEntry: cannot parse response of agent on %s to %s: %+v", instance.Key.Hostname, command, err)
+	}
+	return coordinates, found, nil
+}
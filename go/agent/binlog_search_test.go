@@ -0,0 +1,42 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package agent
+
+import (
+	"testing"
+
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+func TestParseBinlogSearchResult(t *testing.T) {
+	coordinates, found, err := parseBinlogSearchResult([]byte(`{"Found": true, "LogFile": "mysql-bin.000123", "LogPos": 4567}`))
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(found)
+	test.S(t).ExpectEquals(*coordinates, inst.BinlogCoordinates{LogFile: "mysql-bin.000123", LogPos: 4567, Type: inst.BinaryLog})
+
+	_, found, err = parseBinlogSearchResult([]byte(`{"Found": false}`))
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectFalse(found)
+
+	// An agent which does not serve the search responds with something other than a search result
+	_, _, err = parseBinlogSearchResult([]byte(`404 page not found`))
+	test.S(t).ExpectNotNil(err)
+
+	_, _, err = parseBinlogSearchResult([]byte(`{"Found": true, "LogFile": "", "LogPos": 0}`))
+	test.S(t).ExpectNotNil(err)
+}
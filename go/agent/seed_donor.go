@@ -0,0 +1,204 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package agent
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/openark/golib/log"
+)
+
+// SeedDonorCandidate is an instance considered as the source of a seed, along with the attributes by which
+// it is ranked, or the reason it was rejected
+type SeedDonorCandidate struct {
+	Key                 inst.InstanceKey
+	DataCenter          string
+	IsSameDataCenter    bool
+	LagSeconds          int64
+	IsMaster            bool
+	Pools               []string
+	IsPoolUnderPressure bool
+	RejectReason        string
+}
+
+// SeedDonorSelection is the outcome of automatically selecting the source of a seed onto a target host. Candidates
+// are listed ranked, best first, followed by rejected candidates.
+type SeedDonorSelection struct {
+	TargetHostname string
+	ClusterName    string
+	DonorHostname  string
+	Rationale      string
+	Candidates     []SeedDonorCandidate
+}
+
+// describe explains the ranking of a candidate
+func (this *SeedDonorCandidate) describe() string {
+	reasons := []string{}
+	if this.IsSameDataCenter {
+		reasons = append(reasons, fmt.Sprintf("same data center (%s)", this.DataCenter))
+	} else {
+		reasons = append(reasons, fmt.Sprintf("other data center (%s)", this.DataCenter))
+	}
+	if this.IsMaster {
+		reasons = append(reasons, "master, as no replica is eligible")
+	} else {
+		reasons = append(reasons, fmt.Sprintf("lag %ds", this.LagSeconds))
+	}
+	if this.IsPoolUnderPressure {
+		reasons = append(reasons, fmt.Sprintf("pool under pressure (%s)", strings.Join(this.Pools, ",")))
+	}
+	return strings.Join(reasons, ", ")
+}
+
+// isPoolUnderPressure checks whether taking a healthy instance out of any of given pools, for the duration
+// of a seed, leaves the pool with fewer than SeedDonorMinHealthyPoolInstances healthy instances
+func isPoolUnderPressure(pools []string, countHealthyPoolInstances map[string]int) bool {
+	for _, pool := range pools {
+		if countHealthyPoolInstances[pool]-1 < int(config.Config.SeedDonorMinHealthyPoolInstances) {
+			return true
+		}
+	}
+	return false
+}
+
+// rankSeedDonorCandidates sorts eligible candidates, best donor first: replicas before the master, then replicas
+// whose pools are not under pressure, then those in the target's data center, then the least lagging.
+// Rejected candidates are listed last.
+func rankSeedDonorCandidates(candidates []SeedDonorCandidate) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if (a.RejectReason == "") != (b.RejectReason == "") {
+			return a.RejectReason == ""
+		}
+		if a.IsMaster != b.IsMaster {
+			return !a.IsMaster
+		}
+		if a.IsPoolUnderPressure != b.IsPoolUnderPressure {
+			return !a.IsPoolUnderPressure
+		}
+		if a.IsSameDataCenter != b.IsSameDataCenter {
+			return a.IsSameDataCenter
+		}
+		if a.LagSeconds != b.LagSeconds {
+			return a.LagSeconds < b.LagSeconds
+		}
+		return a.Key.StringCode() < b.Key.StringCode()
+	})
+}
+
+// SelectSeedDonor selects the best source for seeding given target host, among the instances of the target's
+// cluster which have a registered agent
+func SelectSeedDonor(targetHostname string) (*SeedDonorSelection, error) {
+	agents, err := ReadAgents()
+	if err != nil {
+		return nil, err
+	}
+	agentsMap := make(map[string]Agent)
+	for _, agent := range agents {
+		agentsMap[agent.Hostname] = agent
+	}
+	targetAgent, found := agentsMap[targetHostname]
+	if !found {
+		return nil, fmt.Errorf("SelectSeedDonor: no agent found on %s", targetHostname)
+	}
+	target, found, err := inst.ReadInstance(targetAgent.GetInstance())
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("SelectSeedDonor: cannot determine the cluster of %s; please specify a source host", targetHostname)
+	}
+	instances, err := inst.ReadClusterInstances(target.ClusterName)
+	if err != nil {
+		return nil, err
+	}
+	instancesPools, _, err := inst.ReadInstancesPools(target.ClusterName)
+	if err != nil {
+		return nil, err
+	}
+	isHealthy := func(instance *inst.Instance) bool {
+		return instance.IsLastCheckValid && !instance.IsDowntimed && (instance.IsMaster() || instance.ReplicaRunning())
+	}
+	countHealthyPoolInstances := make(map[string]int)
+	for _, instance := range instances {
+		if !isHealthy(instance) {
+			continue
+		}
+		for _, pool := range instancesPools[instance.Key] {
+			countHealthyPoolInstances[pool]++
+		}
+	}
+
+	selection := &SeedDonorSelection{
+		TargetHostname: targetHostname,
+		ClusterName:    target.ClusterName,
+		Candidates:     []SeedDonorCandidate{},
+	}
+	for _, instance := range instances {
+		if instance.Key.Hostname == targetHostname {
+			continue
+		}
+		candidate := SeedDonorCandidate{
+			Key:              instance.Key,
+			DataCenter:       instance.DataCenter,
+			IsSameDataCenter: instance.DataCenter == target.DataCenter,
+			LagSeconds:       instance.SlaveLagSeconds.Int64,
+			IsMaster:         !instance.IsReplica() || instance.IsCoMaster,
+			Pools:            instancesPools[instance.Key],
+		}
+		candidate.IsPoolUnderPressure = isPoolUnderPressure(candidate.Pools, countHealthyPoolInstances)
+		if _, found := agentsMap[instance.Key.Hostname]; !found {
+			candidate.RejectReason = "no agent"
+		} else if !isHealthy(instance) {
+			candidate.RejectReason = "not healthy"
+		} else if !candidate.IsMaster && !instance.SlaveLagSeconds.Valid {
+			candidate.RejectReason = "unknown lag"
+		} else if activeSeeds, err := ReadActiveSeedsForHost(instance.Key.Hostname); err != nil || len(activeSeeds) > 0 {
+			candidate.RejectReason = "participating in an active seed"
+		}
+		selection.Candidates = append(selection.Candidates, candidate)
+	}
+	rankSeedDonorCandidates(selection.Candidates)
+	if len(selection.Candidates) == 0 || selection.Candidates[0].RejectReason != "" {
+		return selection, fmt.Errorf("SelectSeedDonor: no eligible donor found for %s in cluster %s", targetHostname, target.ClusterName)
+	}
+	donor := &selection.Candidates[0]
+	selection.DonorHostname = donor.Key.Hostname
+	countEligible := 0
+	for _, candidate := range selection.Candidates {
+		if candidate.RejectReason == "" {
+			countEligible++
+		}
+	}
+	selection.Rationale = fmt.Sprintf("selected %s: %s; best of %d eligible donors, %d rejected", donor.Key.Hostname, donor.describe(), countEligible, len(selection.Candidates)-countEligible)
+	return selection, nil
+}
+
+// SeedFromSelectedDonor seeds given target host from the automatically selected best donor. The selection's
+// rationale is recorded with the seed.
+func SeedFromSelectedDonor(targetHostname string) (seedId int64, selection *SeedDonorSelection, err error) {
+	selection, err = SelectSeedDonor(targetHostname)
+	if err != nil {
+		return 0, selection, log.Errore(err)
+	}
+	seedId, err = seed(targetHostname, selection.DonorHostname, selection.Rationale)
+	return seedId, selection, err
+}
@@ -0,0 +1,80 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+func TestIsPoolUnderPressure(t *testing.T) {
+	minHealthyPoolInstances := config.Config.SeedDonorMinHealthyPoolInstances
+	defer func() { config.Config.SeedDonorMinHealthyPoolInstances = minHealthyPoolInstances }()
+	config.Config.SeedDonorMinHealthyPoolInstances = 2
+
+	countHealthyPoolInstances := map[string]int{"web": 3, "batch": 2, "reporting": 1}
+	test.S(t).ExpectFalse(isPoolUnderPressure([]string{}, countHealthyPoolInstances))
+	test.S(t).ExpectFalse(isPoolUnderPressure([]string{"web"}, countHealthyPoolInstances))
+	test.S(t).ExpectTrue(isPoolUnderPressure([]string{"batch"}, countHealthyPoolInstances))
+	test.S(t).ExpectTrue(isPoolUnderPressure([]string{"reporting"}, countHealthyPoolInstances))
+	test.S(t).ExpectTrue(isPoolUnderPressure([]string{"web", "batch"}, countHealthyPoolInstances))
+	// A pool with no healthy instances at all, the candidate being unhealthy itself
+	test.S(t).ExpectTrue(isPoolUnderPressure([]string{"unknown"}, countHealthyPoolInstances))
+
+	config.Config.SeedDonorMinHealthyPoolInstances = 0
+	test.S(t).ExpectFalse(isPoolUnderPressure([]string{"reporting"}, countHealthyPoolInstances))
+}
+
+func TestRankSeedDonorCandidates(t *testing.T) {
+	candidate := func(hostname string) SeedDonorCandidate {
+		return SeedDonorCandidate{Key: inst.InstanceKey{Hostname: hostname, Port: 3306}, IsSameDataCenter: true}
+	}
+	rejected := candidate("rejected")
+	rejected.RejectReason = "no agent"
+	master := candidate("master")
+	master.IsMaster = true
+	pressured := candidate("pressured")
+	pressured.IsPoolUnderPressure = true
+	otherDataCenter := candidate("other-dc")
+	otherDataCenter.IsSameDataCenter = false
+	lagging := candidate("lagging")
+	lagging.LagSeconds = 30
+	best := candidate("best")
+	best.LagSeconds = 1
+	tied := candidate("tied")
+	tied.LagSeconds = 1
+
+	candidates := []SeedDonorCandidate{rejected, master, pressured, otherDataCenter, lagging, tied, best}
+	rankSeedDonorCandidates(candidates)
+	hostnames := []string{}
+	for _, candidate := range candidates {
+		hostnames = append(hostnames, candidate.Key.Hostname)
+	}
+	test.S(t).ExpectEquals(strings.Join(hostnames, ","), "best,tied,lagging,other-dc,pressured,master,rejected")
+}
+
+func TestSeedDonorCandidateDescribe(t *testing.T) {
+	replica := SeedDonorCandidate{DataCenter: "dc1", IsSameDataCenter: true, LagSeconds: 3}
+	test.S(t).ExpectEquals(replica.describe(), "same data center (dc1), lag 3s")
+
+	master := SeedDonorCandidate{DataCenter: "dc2", IsMaster: true, Pools: []string{"web", "batch"}, IsPoolUnderPressure: true}
+	test.S(t).ExpectEquals(master.describe(), "other data center (dc2), master, as no replica is eligible, pool under pressure (web,batch)")
+}
@@ -0,0 +1,193 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package agent
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// SeedPhase is the phase a seed operation is in
+type SeedPhase string
+
+const (
+	SeedPhasePreparing  SeedPhase = "preparing"
+	SeedPhaseCopying    SeedPhase = "copying"
+	SeedPhasePaused     SeedPhase = "paused"
+	SeedPhaseFinalizing SeedPhase = "finalizing"
+	SeedPhaseDone       SeedPhase = "done"
+	SeedPhaseFailed     SeedPhase = "failed"
+	SeedPhaseAborted    SeedPhase = "aborted"
+)
+
+// SeedProgress is the live progress of a seed operation run by this orchestrator node
+type SeedProgress struct {
+	SeedId                   int64
+	TargetHostname           string
+	SourceHostname           string
+	Phase                    SeedPhase
+	BytesCopied              int64
+	TotalBytes               int64
+	Percent                  float64
+	ThroughputBytesPerSecond float64
+	ETASeconds               int64 // -1 when unknown
+	StartedAt                time.Time
+	UpdatedAt                time.Time
+
+	lastSampleBytes int64
+	lastSampleTime  time.Time
+}
+
+// IsActive returns true while the seed has not completed
+func (this *SeedProgress) IsActive() bool {
+	switch this.Phase {
+	case SeedPhaseDone, SeedPhaseFailed, SeedPhaseAborted:
+		return false
+	}
+	return true
+}
+
+// seedsProgress keeps the progress of seeds; that of completed seeds is kept for an hour
+var seedsProgress = cache.New(time.Hour, time.Minute)
+var seedsProgressMutex sync.Mutex
+
+// newSeedProgress starts tracking the progress of a seed
+func newSeedProgress(seedId int64, targetHostname string, sourceHostname string) {
+	seedsProgressMutex.Lock()
+	defer seedsProgressMutex.Unlock()
+
+	now := time.Now()
+	seedsProgress.Set(fmt.Sprintf("%d", seedId), &SeedProgress{
+		SeedId:         seedId,
+		TargetHostname: targetHostname,
+		SourceHostname: sourceHostname,
+		Phase:          SeedPhasePreparing,
+		ETASeconds:     -1,
+		StartedAt:      now,
+		UpdatedAt:      now,
+	}, cache.DefaultExpiration)
+}
+
+// updateSeedProgress applies given change onto the progress of a seed, if tracked
+func updateSeedProgress(seedId int64, change func(progress *SeedProgress)) {
+	seedsProgressMutex.Lock()
+	defer seedsProgressMutex.Unlock()
+
+	value, found := seedsProgress.Get(fmt.Sprintf("%d", seedId))
+	if !found {
+		return
+	}
+	progress := value.(*SeedProgress)
+	change(progress)
+	progress.UpdatedAt = time.Now()
+	seedsProgress.Set(fmt.Sprintf("%d", seedId), progress, cache.DefaultExpiration)
+}
+
+// setSeedPhase sets the phase of a seed. A seed which completed, e.g. was aborted, does not change its phase.
+func setSeedPhase(seedId int64, phase SeedPhase) {
+	updateSeedProgress(seedId, func(progress *SeedProgress) {
+		if progress.IsActive() {
+			progress.Phase = phase
+		}
+	})
+}
+
+// recordSeedBytesCopied updates the bytes copied by a seed, and computes its throughput and ETA based on the bytes
+// copied since the previous sample
+func recordSeedBytesCopied(seedId int64, bytesCopied int64, totalBytes int64) {
+	updateSeedProgress(seedId, func(progress *SeedProgress) {
+		now := time.Now()
+		if !progress.lastSampleTime.IsZero() && progress.Phase == SeedPhaseCopying {
+			if elapsed := now.Sub(progress.lastSampleTime).Seconds(); elapsed > 0 {
+				progress.ThroughputBytesPerSecond = float64(bytesCopied-progress.lastSampleBytes) / elapsed
+			}
+		}
+		progress.BytesCopied = bytesCopied
+		progress.TotalBytes = totalBytes
+		progress.lastSampleBytes = bytesCopied
+		progress.lastSampleTime = now
+		if totalBytes > 0 {
+			progress.Percent = 100 * float64(bytesCopied) / float64(totalBytes)
+		}
+		progress.ETASeconds = -1
+		if progress.ThroughputBytesPerSecond > 0 && totalBytes >= bytesCopied {
+			progress.ETASeconds = int64(float64(totalBytes-bytesCopied) / progress.ThroughputBytesPerSecond)
+		}
+	})
+}
+
+// ReadSeedProgress returns the progress of a seed run by this orchestrator node
+func ReadSeedProgress(seedId int64) (progress SeedProgress, found bool) {
+	seedsProgressMutex.Lock()
+	defer seedsProgressMutex.Unlock()
+
+	value, found := seedsProgress.Get(fmt.Sprintf("%d", seedId))
+	if !found {
+		return progress, false
+	}
+	return *(value.(*SeedProgress)), true
+}
+
+// readSeedPhase returns the phase of a seed, or an empty phase when the seed is not tracked
+func readSeedPhase(seedId int64) SeedPhase {
+	progress, _ := ReadSeedProgress(seedId)
+	return progress.Phase
+}
+
+// PauseSeed requests the source agent of a seed to pause sending data. A paused seed is not failed as stale.
+func PauseSeed(seedId int64) error {
+	progress, found := ReadSeedProgress(seedId)
+	if !found {
+		return fmt.Errorf("PauseSeed: seed %d is not run by this node", seedId)
+	}
+	if progress.Phase != SeedPhaseCopying {
+		return fmt.Errorf("PauseSeed: seed %d is %s; only a copying seed can be paused", seedId, progress.Phase)
+	}
+	if _, err := executeAgentCommand(progress.SourceHostname, fmt.Sprintf("pause-seed/%d", seedId), nil); err != nil {
+		return err
+	}
+	updateSeedProgress(seedId, func(progress *SeedProgress) {
+		progress.Phase = SeedPhasePaused
+		progress.ThroughputBytesPerSecond = 0
+		progress.ETASeconds = -1
+	})
+	submitSeedStateEntry(seedId, fmt.Sprintf("Paused sending data from %s", progress.SourceHostname), "")
+	return nil
+}
+
+// ResumeSeed requests the source agent of a paused seed to resume sending data
+func ResumeSeed(seedId int64) error {
+	progress, found := ReadSeedProgress(seedId)
+	if !found {
+		return fmt.Errorf("ResumeSeed: seed %d is not run by this node", seedId)
+	}
+	if progress.Phase != SeedPhasePaused {
+		return fmt.Errorf("ResumeSeed: seed %d is %s, not paused", seedId, progress.Phase)
+	}
+	if _, err := executeAgentCommand(progress.SourceHostname, fmt.Sprintf("resume-seed/%d", seedId), nil); err != nil {
+		return err
+	}
+	updateSeedProgress(seedId, func(progress *SeedProgress) {
+		progress.Phase = SeedPhaseCopying
+		progress.lastSampleTime = time.Time{}
+	})
+	submitSeedStateEntry(seedId, fmt.Sprintf("Resumed sending data from %s", progress.SourceHostname), "")
+	return nil
+}
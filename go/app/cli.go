@@ -17,7 +17,9 @@
 package app
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"os"
 	"os/user"
@@ -28,6 +30,7 @@ import (
 
 	"github.com/github/orchestrator/go/agent"
 	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
 	"github.com/github/orchestrator/go/inst"
 	"github.com/github/orchestrator/go/kv"
 	"github.com/github/orchestrator/go/logic"
@@ -129,10 +132,86 @@ func validateInstanceIsFound(instanceKey *inst.InstanceKey) (instance *inst.Inst
 	return instance
 }
 
+// changeClusterReplicationThreadsCommand starts or stops the replication thread given by --thread on all replicas of
+// a cluster, and prints the replicas on which the action succeeded. It fails if the action failed on any replica.
+func changeClusterReplicationThreadsCommand(clusterName string, action inst.ReplicationThreadAction) {
+	thread, err := inst.ParseReplicationThread(*config.RuntimeCLIFlags.ReplicationThread)
+	if err != nil {
+		log.Fatale(err)
+	}
+	results, err := inst.ChangeClusterReplicationThreads(clusterName, action, thread, *config.RuntimeCLIFlags.ReplicationChannel)
+	if err != nil {
+		log.Fatale(err)
+	}
+	countFailed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			log.Errorf("%+v: %s", result.Key, result.Error)
+			countFailed++
+			continue
+		}
+		fmt.Println(result.Key.DisplayString())
+	}
+	if countFailed > 0 {
+		log.Fatalf("Replication %s: %s failed on %d out of %d replicas", thread, action, countFailed, len(results))
+	}
+}
+
+// fenceActiveRecoveryCommand checks a cluster for in-flight recoveries before a recovery command runs, and treats them
+// per --active-recovery. The command recovers given instance, or, lacking one, the master of given cluster. It returns
+// true when the command joined an in-flight recovery, whose successor is then printed, and is not to run itself.
+func fenceActiveRecoveryCommand(clusterName string, instanceKey *inst.InstanceKey) (joined bool) {
+	policy, err := logic.ParseActiveRecoveryPolicy(*config.RuntimeCLIFlags.ActiveRecovery)
+	if err != nil {
+		log.Fatale(err)
+	}
+	var joinedRecovery *logic.TopologyRecovery
+	if instanceKey != nil {
+		joinedRecovery, err = logic.FenceActiveInstanceRecovery(instanceKey, policy, inst.GetMaintenanceOwner())
+	} else {
+		joinedRecovery, err = logic.FenceActiveMasterRecovery(clusterName, policy, inst.GetMaintenanceOwner())
+	}
+	if err != nil {
+		log.Fatale(err)
+	}
+	if joinedRecovery == nil {
+		return false
+	}
+	if !joinedRecovery.IsSuccessful {
+		log.Fatalf("Joined recovery %s completed unsuccessfully", joinedRecovery.UID)
+	}
+	fmt.Println(joinedRecovery.SuccessorKey.DisplayString())
+	return true
+}
+
+// relocateCommand runs given relocation of a replica, in safe mode when --safe is given
+func relocateCommand(operation string, instanceKey *inst.InstanceKey, destinationKey *inst.InstanceKey, relocate func() (*inst.Instance, error)) (*inst.Instance, error) {
+	if *config.RuntimeCLIFlags.Safe {
+		return inst.SafeRelocation(operation, instanceKey, destinationKey, relocate)
+	}
+	return relocate()
+}
+
+// executeWithRevert executes given action on an instance, and schedules its revert after --revert-after
+func executeWithRevert(instanceKey *inst.InstanceKey, action string, owner string, reason string) {
+	revertAfterSeconds, err := util.SimpleTimeToSeconds(*config.RuntimeCLIFlags.RevertAfter)
+	if err != nil {
+		log.Fatale(err)
+	}
+	if revertAfterSeconds <= 0 {
+		log.Fatalf("--revert-after must be positive")
+	}
+	_, revert, err := logic.ExecuteWithRevert(instanceKey, action, uint(revertAfterSeconds), owner, reason)
+	if err != nil {
+		log.Fatale(err)
+	}
+	log.Infof("%s scheduled at %s (%s)", revert.RevertAction, revert.RevertAtString, revert.UID)
+}
+
 // CliWrapper is called from main and allows for the instance parameter
 // to take multiple instance names separated by a comma or whitespace.
 func CliWrapper(command string, strict bool, instances string, destination string, owner string, reason string, duration string, pattern string, clusterAlias string, pool string, hostnameFlag string) {
-	if config.Config.RaftEnabled && !*config.RuntimeCLIFlags.IgnoreRaftSetup {
+	if config.Config.RaftEnabled && !*config.RuntimeCLIFlags.IgnoreRaftSetup && command != "validate-config" && command != "encrypt-config-value" && command != "upgrade-backend" {
 		log.Fatalf(`Orchestrator configured to run raft ("RaftEnabled": true). All access must go through the web API of the active raft node. You may use the orchestrator-client script which has a similar interface to the command line invocation. You may override this with --ignore-raft-setup`)
 	}
 	r := regexp.MustCompile(`[ ,\r\n\t]+`)
@@ -161,14 +240,26 @@ func Cli(command string, strict bool, instance string, destination string, owner
 	switch command {
 	case "redeploy-internal-db":
 		skipDatabaseCommands = true
+	case "upgrade-backend":
+		skipDatabaseCommands = true
 	case "help":
 		skipDatabaseCommands = true
 	case "dump-config":
 		skipDatabaseCommands = true
+	case "validate-config":
+		skipDatabaseCommands = true
+	case "encrypt-config-value":
+		skipDatabaseCommands = true
+	case "recover-backend":
+		// The backend is expected to be unavailable
+		skipDatabaseCommands = true
 	}
 
-	if instance != "" && !strings.Contains(instance, ":") {
-		instance = fmt.Sprintf("%s:%d", instance, config.Config.DefaultInstancePort)
+	if instance != "" {
+		// Apply default port if none given
+		if looseKey, err := inst.ParseRawInstanceKeyLoose(instance); err == nil {
+			instance = looseKey.StringCode()
+		}
 	}
 
 	instanceKey, err := inst.ParseInstanceKey(instance)
@@ -181,8 +272,11 @@ func Cli(command string, strict bool, instance string, destination string, owner
 		rawInstanceKey = nil
 	}
 
-	if destination != "" && !strings.Contains(destination, ":") {
-		destination = fmt.Sprintf("%s:%d", destination, config.Config.DefaultInstancePort)
+	if destination != "" {
+		// Apply default port if none given
+		if looseKey, err := inst.ParseRawInstanceKeyLoose(destination); err == nil {
+			destination = looseKey.StringCode()
+		}
 	}
 	destinationKey, err := inst.ParseInstanceKey(destination)
 	if err != nil {
@@ -220,7 +314,9 @@ func Cli(command string, strict bool, instance string, destination string, owner
 			if destinationKey == nil {
 				log.Fatal("Cannot deduce destination:", destination)
 			}
-			_, err := inst.RelocateBelow(instanceKey, destinationKey)
+			_, err := relocateCommand(command, instanceKey, destinationKey, func() (*inst.Instance, error) {
+				return inst.RelocateBelow(instanceKey, destinationKey)
+			})
 			if err != nil {
 				log.Fatale(err)
 			}
@@ -270,7 +366,9 @@ func Cli(command string, strict bool, instance string, destination string, owner
 	case registerCliCommand("move-up", "Classic file:pos relocation", `Move a replica one level up the topology`):
 		{
 			instanceKey, _ = inst.FigureInstanceKey(instanceKey, thisInstanceKey)
-			instance, err := inst.MoveUp(instanceKey)
+			instance, err := relocateCommand(command, instanceKey, nil, func() (*inst.Instance, error) {
+				return inst.MoveUp(instanceKey)
+			})
 			if err != nil {
 				log.Fatale(err)
 			}
@@ -301,7 +399,9 @@ func Cli(command string, strict bool, instance string, destination string, owner
 			if destinationKey == nil {
 				log.Fatal("Cannot deduce destination/sibling:", destination)
 			}
-			_, err := inst.MoveBelow(instanceKey, destinationKey)
+			_, err := relocateCommand(command, instanceKey, destinationKey, func() (*inst.Instance, error) {
+				return inst.MoveBelow(instanceKey, destinationKey)
+			})
 			if err != nil {
 				log.Fatale(err)
 			}
@@ -313,7 +413,9 @@ func Cli(command string, strict bool, instance string, destination string, owner
 			if destinationKey == nil {
 				log.Fatal("Cannot deduce destination:", destination)
 			}
-			_, err := inst.MoveEquivalent(instanceKey, destinationKey)
+			_, err := relocateCommand(command, instanceKey, destinationKey, func() (*inst.Instance, error) {
+				return inst.MoveEquivalent(instanceKey, destinationKey)
+			})
 			if err != nil {
 				log.Fatale(err)
 			}
@@ -377,6 +479,15 @@ func Cli(command string, strict bool, instance string, destination string, owner
 			}
 			fmt.Println(instanceKey.DisplayString())
 		}
+	case registerCliCommand("break-co-master", "Classic file:pos relocation", `Break circular replication on its active (writable) co-master, which remains the single master`):
+		{
+			instanceKey, _ = inst.FigureInstanceKey(instanceKey, thisInstanceKey)
+			_, err := inst.BreakCoMaster(instanceKey)
+			if err != nil {
+				log.Fatale(err)
+			}
+			fmt.Println(instanceKey.DisplayString())
+		}
 	case registerCliCommand("get-candidate-replica", "Classic file:pos relocation", `Information command suggesting the most up-to-date replica of a given instance that is good for promotion`):
 		{
 			instanceKey, _ = inst.FigureInstanceKey(instanceKey, thisInstanceKey)
@@ -415,7 +526,9 @@ func Cli(command string, strict bool, instance string, destination string, owner
 			if destinationKey == nil {
 				log.Fatal("Cannot deduce destination:", destination)
 			}
-			_, err := inst.MoveBelowGTID(instanceKey, destinationKey)
+			_, err := relocateCommand(command, instanceKey, destinationKey, func() (*inst.Instance, error) {
+				return inst.MoveBelowGTID(instanceKey, destinationKey)
+			})
 			if err != nil {
 				log.Fatale(err)
 			}
@@ -590,24 +703,69 @@ func Cli(command string, strict bool, instance string, destination string, owner
 			}
 			fmt.Println(instanceKey.DisplayString())
 		}
-	case registerCliCommand("stop-slave", "Replication, general", `Issue a STOP SLAVE on an instance`):
+	case registerCliCommand("repair-replication-corruption", "Replication, general", `Remediate relay log corruption (purge and refetch relay logs) or master binary log corruption (relocate below a healthy sibling) on a replica`):
 		{
 			instanceKey, _ = inst.FigureInstanceKey(instanceKey, thisInstanceKey)
-			_, err := inst.StopSlave(instanceKey)
+			_, err := inst.RepairReplicationCorruption(instanceKey)
 			if err != nil {
 				log.Fatale(err)
 			}
 			fmt.Println(instanceKey.DisplayString())
 		}
+	case registerCliCommand("stop-slave", "Replication, general", `Issue a STOP SLAVE on an instance`):
+		{
+			instanceKey, _ = inst.FigureInstanceKey(instanceKey, thisInstanceKey)
+			if *config.RuntimeCLIFlags.RevertAfter != "" {
+				executeWithRevert(instanceKey, "stop-slave", owner, reason)
+			} else if _, err := inst.StopSlave(instanceKey); err != nil {
+				log.Fatale(err)
+			}
+			fmt.Println(instanceKey.DisplayString())
+		}
 	case registerCliCommand("start-slave", "Replication, general", `Issue a START SLAVE on an instance`):
 		{
 			instanceKey, _ = inst.FigureInstanceKey(instanceKey, thisInstanceKey)
-			_, err := inst.StartSlave(instanceKey)
+			if *config.RuntimeCLIFlags.RevertAfter != "" {
+				executeWithRevert(instanceKey, "start-slave", owner, reason)
+			} else if _, err := inst.StartSlave(instanceKey); err != nil {
+				log.Fatale(err)
+			}
+			fmt.Println(instanceKey.DisplayString())
+		}
+	case registerCliCommand("start-replica-thread", "Replication, general", `Start either replication thread on an instance; provide --thread (io|sql), optionally --channel`):
+		{
+			instanceKey, _ = inst.FigureInstanceKey(instanceKey, thisInstanceKey)
+			thread, err := inst.ParseReplicationThread(*config.RuntimeCLIFlags.ReplicationThread)
+			if err != nil {
+				log.Fatale(err)
+			}
+			_, err = inst.ChangeReplicationThread(instanceKey, inst.StartReplicationThreadAction, thread, *config.RuntimeCLIFlags.ReplicationChannel)
 			if err != nil {
 				log.Fatale(err)
 			}
 			fmt.Println(instanceKey.DisplayString())
 		}
+	case registerCliCommand("stop-replica-thread", "Replication, general", `Stop either replication thread on an instance; provide --thread (io|sql), optionally --channel`):
+		{
+			instanceKey, _ = inst.FigureInstanceKey(instanceKey, thisInstanceKey)
+			thread, err := inst.ParseReplicationThread(*config.RuntimeCLIFlags.ReplicationThread)
+			if err != nil {
+				log.Fatale(err)
+			}
+			_, err = inst.ChangeReplicationThread(instanceKey, inst.StopReplicationThreadAction, thread, *config.RuntimeCLIFlags.ReplicationChannel)
+			if err != nil {
+				log.Fatale(err)
+			}
+			fmt.Println(instanceKey.DisplayString())
+		}
+	case registerCliCommand("start-replicas-thread", "Replication, general", `Start either replication thread on all replicas of a cluster; provide --thread (io|sql), optionally --channel`):
+		{
+			changeClusterReplicationThreadsCommand(getClusterName(clusterAlias, instanceKey), inst.StartReplicationThreadAction)
+		}
+	case registerCliCommand("stop-replicas-thread", "Replication, general", `Stop either replication thread on all replicas of a cluster, e.g. --thread=sql to freeze apply while replicas keep pulling from masters; provide --thread (io|sql), optionally --channel`):
+		{
+			changeClusterReplicationThreadsCommand(getClusterName(clusterAlias, instanceKey), inst.StopReplicationThreadAction)
+		}
 	case registerCliCommand("restart-slave", "Replication, general", `STOP and START SLAVE on an instance`):
 		{
 			instanceKey, _ = inst.FigureInstanceKey(instanceKey, thisInstanceKey)
@@ -728,6 +886,44 @@ func Cli(command string, strict bool, instance string, destination string, owner
 			}
 			fmt.Println(instanceKey.DisplayString())
 		}
+	case registerCliCommand("set-sql-delay", "Replication, general", `Set SQL_Delay on a replica, given by --duration (e.g. 1h, 0s). On a tagged delayed replica, also sets its intended delay`):
+		{
+			instanceKey, _ = inst.FigureInstanceKey(instanceKey, thisInstanceKey)
+			sqlDelay, err := util.SimpleTimeToSeconds(duration)
+			if err != nil {
+				log.Fatale(err)
+			}
+			_, err = logic.SetSQLDelay(instanceKey, uint(sqlDelay))
+			if err != nil {
+				log.Fatale(err)
+			}
+			fmt.Println(instanceKey.DisplayString())
+		}
+	case registerCliCommand("suspend-sql-delay", "Replication, general", `Let a delayed replica catch up with its master for --duration, after which its intended SQL_Delay is restored`):
+		{
+			instanceKey, _ = inst.FigureInstanceKey(instanceKey, thisInstanceKey)
+			durationSeconds, err := util.SimpleTimeToSeconds(duration)
+			if err != nil {
+				log.Fatale(err)
+			}
+			if durationSeconds <= 0 {
+				log.Fatalf("Duration value must be positive. Given value: %d", durationSeconds)
+			}
+			_, err = logic.SuspendSQLDelay(instanceKey, uint(durationSeconds), inst.GetMaintenanceOwner(), reason)
+			if err != nil {
+				log.Fatale(err)
+			}
+			fmt.Println(instanceKey.DisplayString())
+		}
+	case registerCliCommand("resume-sql-delay", "Replication, general", `Restore the intended SQL_Delay of a delayed replica whose delay is suspended`):
+		{
+			instanceKey, _ = inst.FigureInstanceKey(instanceKey, thisInstanceKey)
+			_, err := logic.ResumeSQLDelay(instanceKey)
+			if err != nil {
+				log.Fatale(err)
+			}
+			fmt.Println(instanceKey.DisplayString())
+		}
 	case registerCliCommand("restart-slave-statements", "Replication, general", `Get a list of statements to execute to stop then restore replica to same execution state. Provide --statement for injected statement`):
 		{
 			instanceKey, _ = inst.FigureInstanceKey(instanceKey, thisInstanceKey)
@@ -774,8 +970,9 @@ func Cli(command string, strict bool, instance string, destination string, owner
 	case registerCliCommand("set-read-only", "Instance", `Turn an instance read-only, via SET GLOBAL read_only := 1`):
 		{
 			instanceKey, _ = inst.FigureInstanceKey(instanceKey, thisInstanceKey)
-			_, err := inst.SetReadOnly(instanceKey, true)
-			if err != nil {
+			if *config.RuntimeCLIFlags.RevertAfter != "" {
+				executeWithRevert(instanceKey, "set-read-only", owner, reason)
+			} else if _, err := inst.SetReadOnly(instanceKey, true); err != nil {
 				log.Fatale(err)
 			}
 			fmt.Println(instanceKey.DisplayString())
@@ -783,8 +980,9 @@ func Cli(command string, strict bool, instance string, destination string, owner
 	case registerCliCommand("set-writeable", "Instance", `Turn an instance writeable, via SET GLOBAL read_only := 0`):
 		{
 			instanceKey, _ = inst.FigureInstanceKey(instanceKey, thisInstanceKey)
-			_, err := inst.SetReadOnly(instanceKey, false)
-			if err != nil {
+			if *config.RuntimeCLIFlags.RevertAfter != "" {
+				executeWithRevert(instanceKey, "set-writeable", owner, reason)
+			} else if _, err := inst.SetReadOnly(instanceKey, false); err != nil {
 				log.Fatale(err)
 			}
 			fmt.Println(instanceKey.DisplayString())
@@ -1124,6 +1322,25 @@ func Cli(command string, strict bool, instance string, destination string, owner
 			}
 			fmt.Println(masters[0].Key.DisplayString())
 		}
+	case registerCliCommand("which-circular-replication", "Information", `Output the co-master pairs and replication rings in a given cluster, and their active co-master`):
+		{
+			clusterName := getClusterName(clusterAlias, instanceKey)
+			circularReplications, err := inst.ReadClusterCircularReplications(clusterName)
+			if err != nil {
+				log.Fatale(err)
+			}
+			for _, circularReplication := range circularReplications {
+				members := []string{}
+				for _, member := range circularReplication.Members {
+					members = append(members, member.DisplayString())
+				}
+				activeMaster := "-"
+				if circularReplication.ActiveMasterKey != nil {
+					activeMaster = circularReplication.ActiveMasterKey.DisplayString()
+				}
+				fmt.Println(fmt.Sprintf("%s\t%s", strings.Join(members, ","), activeMaster))
+			}
+		}
 	case registerCliCommand("which-cluster-instances", "Information", `Output the list of instances participating in same cluster as given instance`):
 		{
 			clusterName := getClusterName(clusterAlias, instanceKey)
@@ -1212,6 +1429,21 @@ func Cli(command string, strict bool, instance string, destination string, owner
 			instance := validateInstanceIsFound(instanceKey)
 			fmt.Println(instance.HumanReadableDescription())
 		}
+	case registerCliCommand("check-topology-privileges", "Information", `Check the topology user's privileges on a given instance, outputting GRANT statements for any missing privileges`):
+		{
+			instanceKey, _ = inst.FigureInstanceKey(instanceKey, thisInstanceKey)
+			if instanceKey == nil {
+				log.Fatalf("Unresolved instance")
+			}
+			instance := validateInstanceIsFound(instanceKey)
+			check, err := inst.CheckTopologyPrivileges(instance)
+			if err != nil {
+				log.Fatale(err)
+			}
+			for _, grantStatement := range check.GrantStatements {
+				fmt.Println(grantStatement)
+			}
+		}
 	case registerCliCommand("get-cluster-heuristic-lag", "Information", `For a given cluster (indicated by an instance or alias), output a heuristic "representative" lag of that cluster`):
 		{
 			clusterName := getClusterName(clusterAlias, instanceKey)
@@ -1227,7 +1459,7 @@ func Cli(command string, strict bool, instance string, destination string, owner
 			log.Debugf("cluster name is <%s>", clusterName)
 
 			kvPairs, err := inst.GetMastersKVPairs(clusterName)
-			if err != nil {
+			if err != nil && len(kvPairs) == 0 {
 				log.Fatale(err)
 			}
 			for _, kvPair := range kvPairs {
@@ -1238,6 +1470,9 @@ func Cli(command string, strict bool, instance string, destination string, owner
 			for _, kvPair := range kvPairs {
 				fmt.Println(fmt.Sprintf("%s:%s", kvPair.Key, kvPair.Value))
 			}
+			if err != nil {
+				log.Fatale(err)
+			}
 		}
 
 		// Instance management
@@ -1347,6 +1582,36 @@ func Cli(command string, strict bool, instance string, destination string, owner
 			}
 			fmt.Println(instanceKey.DisplayString())
 		}
+	case registerCliCommand("decommission-instance", "Instance management", `Take an instance out of service, to be forgotten after a confirmation period`):
+		{
+			instanceKey, _ = inst.FigureInstanceKey(instanceKey, thisInstanceKey)
+			if reason == "" {
+				log.Fatal("--reason option required")
+			}
+			decommission, err := logic.DecommissionInstance(instanceKey, inst.GetMaintenanceOwner(), reason, *config.RuntimeCLIFlags.Force)
+			if err != nil {
+				log.Fatale(err)
+			}
+			fmt.Println(decommission.String())
+		}
+	case registerCliCommand("cancel-decommission", "Instance management", `Cancel a pending decommission, such that the instance is not forgotten`):
+		{
+			instanceKey, _ = inst.FigureInstanceKey(instanceKey, thisInstanceKey)
+			if _, err := logic.CancelDecommission(instanceKey, inst.GetMaintenanceOwner()); err != nil {
+				log.Fatale(err)
+			}
+			fmt.Println(instanceKey.DisplayString())
+		}
+	case registerCliCommand("decommissions", "Instance management", `List pending decommissions, and those completed within the past day`):
+		{
+			decommissions, err := logic.ReadInstanceDecommissions()
+			if err != nil {
+				log.Fatale(err)
+			}
+			for _, decommission := range decommissions {
+				fmt.Println(decommission.String())
+			}
+		}
 		// Recovery & analysis
 	case registerCliCommand("recover", "Recovery", `Do auto-recovery given a dead instance`), registerCliCommand("recover-lite", "Recovery", `Do auto-recovery given a dead instance. Orchestrator chooses the best course of actionwithout executing external processes`):
 		{
@@ -1354,6 +1619,9 @@ func Cli(command string, strict bool, instance string, destination string, owner
 			if instanceKey == nil {
 				log.Fatal("Cannot deduce instance:", instance)
 			}
+			if fenceActiveRecoveryCommand(getClusterName(clusterAlias, instanceKey), instanceKey) {
+				return
+			}
 
 			recoveryAttempted, promotedInstanceKey, err := logic.CheckAndRecover(instanceKey, destinationKey, (command == "recover-lite"))
 			if err != nil {
@@ -1369,12 +1637,26 @@ func Cli(command string, strict bool, instance string, destination string, owner
 	case registerCliCommand("force-master-failover", "Recovery", `Forcibly discard master and initiate a failover, even if orchestrator doesn't see a problem. This command lets orchestrator choose the replacement master`):
 		{
 			clusterName := getClusterName(clusterAlias, instanceKey)
+			if fenceActiveRecoveryCommand(clusterName, nil) {
+				return
+			}
 			topologyRecovery, err := logic.ForceMasterFailover(clusterName)
 			if err != nil {
 				log.Fatale(err)
 			}
 			fmt.Println(topologyRecovery.SuccessorKey.DisplayString())
 		}
+	case registerCliCommand("recover-backend", "Recovery", `Recover orchestrator's own failed backend master, promoting a configured backend replica in its place. Use -d to designate the replica to promote. Use --force to promote even though the failed master could not be fenced`):
+		{
+			backendRecovery, err := logic.RecoverBackend(destinationKey, *config.RuntimeCLIFlags.Force)
+			if err != nil {
+				log.Fatale(err)
+			}
+			for _, replicaKey := range backendRecovery.LostReplicas {
+				log.Errorf("Lost backend replica: %+v", replicaKey)
+			}
+			fmt.Println(backendRecovery.PromotedBackend.String())
+		}
 	case registerCliCommand("force-master-takeover", "Recovery", `Forcibly discard master and promote another (direct child) instance instead, even if everything is running well`):
 		{
 			clusterName := getClusterName(clusterAlias, instanceKey)
@@ -1382,19 +1664,25 @@ func Cli(command string, strict bool, instance string, destination string, owner
 				log.Fatal("Cannot deduce destination, the instance to promote in place of the master. Please provide with -d")
 			}
 			destination := validateInstanceIsFound(destinationKey)
+			if fenceActiveRecoveryCommand(clusterName, nil) {
+				return
+			}
 			topologyRecovery, err := logic.ForceMasterTakeover(clusterName, destination)
 			if err != nil {
 				log.Fatale(err)
 			}
 			fmt.Println(topologyRecovery.SuccessorKey.DisplayString())
 		}
-	case registerCliCommand("graceful-master-takeover", "Recovery", `Gracefully promote a new master. Either indicate identity of new master via '-d designated.instance.com' or setup replication tree to have a single direct replica to the master.`):
+	case registerCliCommand("graceful-master-takeover", "Recovery", `Gracefully promote a new master. Either indicate identity of new master via '-d designated.instance.com' or setup replication tree to have a single direct replica to the master. Use --force to proceed despite an unmet replica quorum. Use --when-caught-up to wait for a lagging designated replica to catch up rather than fail`):
 		{
 			clusterName := getClusterName(clusterAlias, instanceKey)
 			if destinationKey != nil {
 				validateInstanceIsFound(destinationKey)
 			}
-			topologyRecovery, promotedMasterCoordinates, err := logic.GracefulMasterTakeover(clusterName, destinationKey)
+			if fenceActiveRecoveryCommand(clusterName, nil) {
+				return
+			}
+			topologyRecovery, promotedMasterCoordinates, err := logic.GracefulMasterTakeover(clusterName, destinationKey, *config.RuntimeCLIFlags.Force, *config.RuntimeCLIFlags.WhenCaughtUp)
 			if err != nil {
 				log.Fatale(err)
 			}
@@ -1456,12 +1744,114 @@ func Cli(command string, strict bool, instance string, destination string, owner
 			if err != nil {
 				log.Fatale(err)
 			}
-			err = inst.RegisterCandidateInstance(inst.NewCandidateDatabaseInstance(instanceKey, promotionRule).WithCurrentTime())
+			candidate := inst.NewCandidateDatabaseInstance(instanceKey, promotionRule).WithCurrentTime()
+			if duration != "" {
+				ttlSeconds, err := util.SimpleTimeToSeconds(duration)
+				if err != nil {
+					log.Fatale(err)
+				}
+				if ttlSeconds <= 0 {
+					log.Fatalf("Duration value must be positive. Given value: %d", ttlSeconds)
+				}
+				candidate = candidate.WithTTL(uint(ttlSeconds))
+			}
+			err = inst.RegisterCandidateInstance(candidate)
+			if err != nil {
+				log.Fatale(err)
+			}
+			fmt.Println(instanceKey.DisplayString())
+		}
+	case registerCliCommand("override-promotion-rule", "Instance, meta", `Temporarily override the promotion rule of an instance, reverting upon expiry`):
+		{
+			instanceKey, _ = inst.FigureInstanceKey(instanceKey, thisInstanceKey)
+			promotionRule, err := inst.ParseCandidatePromotionRule(*config.RuntimeCLIFlags.PromotionRule)
+			if err != nil {
+				log.Fatale(err)
+			}
+			if duration == "" {
+				log.Fatal("--duration option required")
+			}
+			durationSeconds, err := util.SimpleTimeToSeconds(duration)
+			if err != nil {
+				log.Fatale(err)
+			}
+			if durationSeconds <= 0 {
+				log.Fatalf("Duration value must be positive. Given value: %d", durationSeconds)
+			}
+			override := inst.NewCandidatePromotionRuleOverride(instanceKey, promotionRule, uint(durationSeconds), reason, owner)
+			if err := inst.WriteCandidatePromotionRuleOverride(override); err != nil {
+				log.Fatale(err)
+			}
+			fmt.Println(instanceKey.DisplayString())
+		}
+	case registerCliCommand("clear-promotion-rule-override", "Instance, meta", `Remove the promotion rule override of an instance`):
+		{
+			instanceKey, _ = inst.FigureInstanceKey(instanceKey, thisInstanceKey)
+			if err := inst.DeleteCandidatePromotionRuleOverride(instanceKey); err != nil {
+				log.Fatale(err)
+			}
+			fmt.Println(instanceKey.DisplayString())
+		}
+	case registerCliCommand("promotion-rule-overrides", "Instance, meta", `List active promotion rule overrides`):
+		{
+			overrides, err := inst.ReadCandidatePromotionRuleOverrides()
+			if err != nil {
+				log.Fatale(err)
+			}
+			for _, override := range overrides {
+				fmt.Println(override.String())
+			}
+		}
+	case registerCliCommand("set-instance-flag", "Instance, meta", `Set a persisted flag, given by --instance-flag, on an instance`):
+		{
+			instanceKey, _ = inst.FigureInstanceKey(instanceKey, thisInstanceKey)
+			flag, err := inst.ParseInstanceFlag(*config.RuntimeCLIFlags.InstanceFlag)
+			if err != nil {
+				log.Fatale(err)
+			}
+			if _, err := logic.SetInstanceFlag(instanceKey, flag, owner, reason); err != nil {
+				log.Fatale(err)
+			}
+			fmt.Println(instanceKey.DisplayString())
+		}
+	case registerCliCommand("clear-instance-flag", "Instance, meta", `Clear a persisted flag, given by --instance-flag, of an instance`):
+		{
+			instanceKey, _ = inst.FigureInstanceKey(instanceKey, thisInstanceKey)
+			flag, err := inst.ParseInstanceFlag(*config.RuntimeCLIFlags.InstanceFlag)
 			if err != nil {
 				log.Fatale(err)
 			}
+			if err := logic.ClearInstanceFlag(instanceKey, flag); err != nil {
+				log.Fatale(err)
+			}
 			fmt.Println(instanceKey.DisplayString())
 		}
+	case registerCliCommand("instance-flags", "Instance, meta", `List persisted instance flags; those of given instance, or of all instances`):
+		{
+			var entries []inst.InstanceFlagEntry
+			var err error
+			if instanceKey == nil {
+				entries, err = inst.ReadAllInstanceFlagEntries()
+			} else {
+				entries, err = inst.ReadInstanceFlagEntries(instanceKey)
+			}
+			if err != nil {
+				log.Fatale(err)
+			}
+			for _, entry := range entries {
+				fmt.Println(entry.String())
+			}
+		}
+	case registerCliCommand("scheduled-reverts", "Instance, meta", `List pending scheduled reverts, and those completed within the past day`):
+		{
+			reverts, err := logic.ReadScheduledReverts()
+			if err != nil {
+				log.Fatale(err)
+			}
+			for _, revert := range reverts {
+				fmt.Println(revert.String())
+			}
+		}
 	case registerCliCommand("register-hostname-unresolve", "Instance, meta", `Assigns the given instance a virtual (aka "unresolved") name`):
 		{
 			instanceKey, _ = inst.FigureInstanceKey(instanceKey, thisInstanceKey)
@@ -1498,6 +1888,29 @@ func Cli(command string, strict bool, instance string, destination string, owner
 				log.Fatale(err)
 			}
 		}
+	case registerCliCommand("export-state", "Meta", `Export operational metadata (instances, aliases, attributes, downtime, candidates, pools) as JSON`):
+		{
+			state, err := logic.ExportState()
+			if err != nil {
+				log.Fatale(err)
+			}
+			b, err := json.Marshal(state)
+			if err != nil {
+				log.Fatale(err)
+			}
+			fmt.Println(string(b))
+		}
+	case registerCliCommand("import-state", "Meta", `Import operational metadata, as exported by export-state, read from standard input`):
+		{
+			state := &logic.ExportedState{}
+			if err := json.NewDecoder(os.Stdin).Decode(state); err != nil {
+				log.Fatale(err)
+			}
+			if err := logic.ImportState(state); err != nil {
+				log.Fatale(err)
+			}
+			fmt.Println(len(state.MinimalInstances))
+		}
 	case registerCliCommand("continuous", "Meta", `Enter continuous mode, and actively poll for instances, diagnose problems, do maintenance`):
 		{
 			logic.ContinuousDiscovery()
@@ -1520,6 +1933,46 @@ func Cli(command string, strict bool, instance string, destination string, owner
 			}
 			fmt.Println(publicToken)
 		}
+	case registerCliCommand("create-api-token", "Meta", `Create a HTTP API bearer token, restricted to clusters given by --api-token-clusters and operation classes given by --api-token-operations`):
+		{
+			operationClasses := []string{}
+			if *config.RuntimeCLIFlags.APITokenOperations != "" {
+				operationClasses = strings.Split(*config.RuntimeCLIFlags.APITokenOperations, ",")
+			}
+			clusterFilters := []string{}
+			if *config.RuntimeCLIFlags.APITokenClusters != "" {
+				clusterFilters = strings.Split(*config.RuntimeCLIFlags.APITokenClusters, ",")
+			}
+			token, bearer, err := process.NewAPIToken(owner, reason, clusterFilters, operationClasses)
+			if err != nil {
+				log.Fatale(err)
+			}
+			if err := process.WriteAPIToken(token); err != nil {
+				log.Fatale(err)
+			}
+			fmt.Println(bearer)
+		}
+	case registerCliCommand("revoke-api-token", "Meta", `Revoke a HTTP API token given by --api-token-id`):
+		{
+			tokenId := *config.RuntimeCLIFlags.APITokenId
+			if tokenId == "" {
+				log.Fatal("--api-token-id option required")
+			}
+			if err := process.DeleteAPIToken(tokenId); err != nil {
+				log.Fatale(err)
+			}
+			fmt.Println(tokenId)
+		}
+	case registerCliCommand("api-tokens", "Meta", `List HTTP API tokens: id, owner, clusters, operation classes, description`):
+		{
+			tokens, err := process.ReadAPITokens()
+			if err != nil {
+				log.Fatale(err)
+			}
+			for _, token := range tokens {
+				fmt.Println(strings.Join([]string{token.TokenId, token.Owner, strings.Join(token.ClusterFilters, ","), strings.Join(token.OperationClasses, ","), token.Description}, "\t"))
+			}
+		}
 	case registerCliCommand("resolve", "Meta", `Resolve given hostname`):
 		{
 			if rawInstanceKey == nil {
@@ -1552,6 +2005,41 @@ func Cli(command string, strict bool, instance string, destination string, owner
 			jsonString := config.Config.ToJSONString()
 			fmt.Println(jsonString)
 		}
+	case registerCliCommand("validate-config", "Meta", `Validate configuration and print it out, with secrets redacted`):
+		{
+			jsonString, err := config.Config.ToRedactedJSONString()
+			if err != nil {
+				log.Fatale(err)
+			}
+			fmt.Println(jsonString)
+			errs, warnings := config.Config.Validate()
+			for _, warning := range warnings {
+				fmt.Println("WARNING:", warning)
+			}
+			for _, err := range errs {
+				fmt.Println("ERROR:", err)
+			}
+			if len(errs) > 0 {
+				log.Fatalf("Configuration is invalid: %d errors", len(errs))
+			}
+			fmt.Println("Configuration is valid")
+		}
+	case registerCliCommand("encrypt-config-value", "Meta", `Encrypt a value read from standard input, for use in configuration, with the configured ConfigEncryptionKey*`):
+		{
+			key, err := config.Config.ReadEncryptionKey()
+			if err != nil {
+				log.Fatale(err)
+			}
+			plaintext, err := ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				log.Fatale(err)
+			}
+			encrypted, err := config.EncryptValue(strings.TrimRight(string(plaintext), "\r\n"), key)
+			if err != nil {
+				log.Fatale(err)
+			}
+			fmt.Println(encrypted)
+		}
 	case registerCliCommand("show-resolve-hosts", "Meta", `Show the content of the hostname_resolve table. Generally used for debugging`):
 		{
 			resolves, err := inst.ReadAllHostnameResolves()
@@ -1574,10 +2062,34 @@ func Cli(command string, strict bool, instance string, destination string, owner
 		}
 	case registerCliCommand("redeploy-internal-db", "Meta, internal", `Force internal schema migration to current backend structure`):
 		{
-			config.RuntimeCLIFlags.ConfiguredVersion = ""
-			inst.ReadClusters()
+			if _, err := db.RedeployBackendSchema(); err != nil {
+				log.Fatale(err)
+			}
 			fmt.Println("Redeployed internal db")
 		}
+	case registerCliCommand("upgrade-backend", "Meta", `Deploy pending backend schema migrations. With --dry-run, list them along with their statements, without deploying`):
+		{
+			status, err := db.UpgradeBackendSchema(*config.RuntimeCLIFlags.DryRun)
+			if err != nil {
+				log.Fatale(err)
+			}
+			if status.IsUpToDate() {
+				fmt.Println(fmt.Sprintf("Backend schema is up to date at version %d", status.DeployedVersion))
+				return
+			}
+			if !*config.RuntimeCLIFlags.DryRun {
+				fmt.Println(fmt.Sprintf("Upgraded backend schema from version %d to %d", status.DeployedVersion, status.LatestVersion))
+				return
+			}
+			statements, err := db.PendingSchemaStatements(status.PendingMigrations)
+			if err != nil {
+				log.Fatale(err)
+			}
+			fmt.Println(fmt.Sprintf("-- Backend schema is at version %d; %d migrations pending up to version %d", status.DeployedVersion, len(status.PendingMigrations), status.LatestVersion))
+			for _, statement := range statements {
+				fmt.Println(statement)
+			}
+		}
 	case registerCliCommand("internal-suggest-promoted-replacement", "Internal", `Internal only, used to test promotion logic in CI`):
 		{
 			destination := validateInstanceIsFound(destinationKey)
@@ -134,6 +134,18 @@ func init() {
   orchestrator -c make-co-master -i replica.to.turn.into.co.master.com
 
   orchestrator -c make-co-master
+      -i not given, implicitly assumed local hostname
+	`
+	CommandHelp["break-co-master"] = `
+  Break circular replication (a co-master pair or a replication ring) on its active co-master. Given instance
+  must be a writable co-master, and all other members of the circle must be read-only. The instance stops
+  replicating from its own master and remains the single master of the topology; other members keep replicating
+  downstream of it. Replication is detached rather than reset, such that the circle can later be re-established
+  via reattach-replica-master-host on the same instance, or via make-co-master. Examples:
+
+  orchestrator -c break-co-master -i active.co.master.com
+
+  orchestrator -c break-co-master
       -i not given, implicitly assumed local hostname
 	`
 	CommandHelp["get-candidate-replica"] = `
@@ -289,11 +301,17 @@ func init() {
   Issues a STOP SLAVE; command. Example:
 
   orchestrator -c stop-slave -i replica.to.be.stopped.com
+
+  orchestrator -c stop-slave -i replica.to.be.stopped.com --revert-after=30m --reason="taking a backup"
+      replication is started again in 30 minutes, by the orchestrator service, even across leader changes
 	`
 	CommandHelp["start-slave"] = `
   Issues a START SLAVE; command. Example:
 
   orchestrator -c start-slave -i replica.to.be.started.com
+
+  orchestrator -c start-slave -i replica.to.be.started.com --revert-after=1h
+      replication is stopped again in an hour
 	`
 	CommandHelp["restart-slave"] = `
   Issues STOP SLAVE + START SLAVE; Example:
@@ -370,6 +388,9 @@ func init() {
 
   orchestrator -c set-writeable
       -i not given, implicitly assumed local hostname
+
+  orchestrator -c set-writeable -i instance.to.turn.writeable.com --revert-after=10m --reason="data fix"
+      the instance is made read-only again in 10 minutes, by the orchestrator service, even across leader changes
 	`
 
 	CommandHelp["flush-binary-logs"] = `
@@ -504,6 +525,17 @@ func init() {
 
   orchestrator -c which-cluster
       -i not given, implicitly assumed local hostname
+	`
+	CommandHelp["which-circular-replication"] = `
+  Output the co-master pairs and replication rings in a given cluster. Output is one line per circle: its
+  members, comma delimited, in replication order (each member replicates from the one preceding it, and the
+  first from the last), followed by the active co-master: the single writable member of the circle, or "-" if
+  there is no single writable member. Examples:
+
+  orchestrator -c which-circular-replication -i instance.in.cluster.com
+
+  orchestrator -c which-circular-replication -alias some_alias
+      assuming some_alias is a known cluster alias (see ClusterNameToAlias or DetectClusterAliasQuery configuration)
 	`
 	CommandHelp["which-cluster-instances"] = `
   Output the list of instances participating in same cluster as given instance; output is one line
@@ -628,6 +660,24 @@ func init() {
 
   orchestrator -c snapshot-topologies
 	`
+	CommandHelp["export-state"] = `
+  Export orchestrator's operational metadata as JSON onto standard output: known instances, cluster aliases
+  and domains, host attributes, downtime, promotion rules, pools and pool specs, desired topologies, KV entries
+  and global recovery mode. Use along with import-state to migrate between deployments, e.g. from a SQLite to a
+  MySQL backend, or from a standalone setup to a raft setup. Example:
+
+  orchestrator -c export-state > orchestrator-state.json
+	`
+	CommandHelp["import-state"] = `
+  Import operational metadata, as exported by export-state, read from standard input. Existing entries of same
+  identity are overwritten; other existing entries are kept. Imported instances are rediscovered by the running
+  orchestrator service. Outputs the number of imported instances. Example:
+
+  orchestrator -c import-state < orchestrator-state.json
+
+  Importing into a raft setup should be done via the API (import-state) on the leader, which applies the state
+  on all raft members.
+	`
 
 	CommandHelp["discover"] = `
   Request that orchestrator cotacts given instance, reads its status, and upsert it into
@@ -700,15 +750,39 @@ func init() {
 
   orchestrator -c end-downtime -i downtimed.instance.com
 	`
+	CommandHelp["decommission-instance"] = `
+  Take an instance out of service: its replicas are relocated below its master, it is removed from its
+  cluster's pools, set read-only and downtimed. The decommission is published to KVDecommissionPrefix
+  and to PostDecommissionProcesses, and the instance is forgotten once DecommissionForgetAfterMinutes
+  pass, given it still has no replicas by then. Only a replica which is not a co-master is decommissioned,
+  unless --force is given; a master with replicas must first be taken over. --reason is required. Example:
+
+  orchestrator -c decommission-instance -i retired.instance.com --reason="hardware refresh"
+	`
+	CommandHelp["cancel-decommission"] = `
+  Cancel a pending decommission, such that the instance is not forgotten, and end its downtime.
+  The instance remains read-only and out of its pools. Example:
+
+  orchestrator -c cancel-decommission -i retired.instance.com
+	`
+	CommandHelp["decommissions"] = `
+  List pending decommissions, and those completed or canceled within the past day. Example:
+
+  orchestrator -c decommissions
+	`
 
 	CommandHelp["recover"] = `
   Do auto-recovery given a dead instance. Orchestrator chooses the best course of action.
   The given instance must be acknowledged as dead and have replicas, or else there's nothing to do.
   See "replication-analysis" command.
   Orchestrator executes external processes as configured by *Processes variables.
+  The command is refused while another recovery is in flight on the cluster. Use --active-recovery join|abort|override
+  to wait for that recovery and take its outcome, abort it before it promotes a server, or run regardless.
   --debug is your friend. Example:
 
   orchestrator -c recover -i dead.instance.com --debug
+
+  orchestrator -c recover -i dead.instance.com --active-recovery join
 	`
 	CommandHelp["recover-lite"] = `
   Do auto-recovery given a dead instance. Orchestrator chooses the best course of action, exactly
@@ -723,6 +797,22 @@ func init() {
 	- Orchestrator just treats this command as a DeadMaster failover scenario
   - Orchestrator will issue all relevant pre-failover and post-failover external processes.
   - Orchestrator will not attempt to recover/reconnect the old master
+  - Refused while another recovery is in flight on the cluster; see --active-recovery in "recover"
+	`
+	CommandHelp["recover-backend"] = `
+  Recover orchestrator's own failed backend master, when the MySQL backend is a replicated cluster. As the
+  backend is unavailable, this does not run as a topology recovery. It:
+  - sets the failed backend master read-only, in case it is reachable. Unless --force is given, aborts unless the
+    failed master is confirmed read-only, or is unreachable from a majority of this node and the backend replicas
+  - probes the backend servers listed in MySQLOrchestratorHosts which replicate from the failed master, and
+    promotes the one which read furthest into its binary logs, or the one given via "-d". The promoted server must
+    have log_bin and log_slave_updates. It applies its relay logs, is detached and is set writable
+  - switches over to the promoted backend, then relocates the other backend replicas below it
+  Refused while the backend is writable. Other orchestrator nodes follow over to the promoted backend by their
+  backend health checks. Point MySQLOrchestratorHost at the promoted backend before restarting orchestrator.
+
+  orchestrator -c recover-backend
+  orchestrator -c recover-backend -d backend-replica.example.com
 	`
 	CommandHelp["force-master-takeover"] = `
 	Forcibly discard master and promote another (direct child) instance instead, even if everything is running well.
@@ -739,6 +829,7 @@ func init() {
 	- Orchestrator will issue all relevant pre-failover and post-failover external processes.
 	- In this command orchestrator will not issue 'SET GLOBAL read_only=1' on the existing master, nor will
 	  it issue a 'FLUSH TABLES WITH READ LOCK'. Please see the 'graceful-master-takeover' command.
+	- Refused while another recovery is in flight on the cluster; see --active-recovery in "recover"
 	Examples:
 
 	orchestrator -c force-master-takeover -alias mycluster -d immediate.child.of.master.com
@@ -759,11 +850,23 @@ func init() {
 	- There _could_ still be statements issued and executed on the existing master by SUPER users, but those are ignored.
 	- Orchestrator then proceeds to handle a DeadMaster failover scenario
 	- Orchestrator will issue all relevant pre-failover and post-failover external processes.
+	- With GracefulTakeoverReplicaQuorums, orchestrator first verifies enough healthy, non-lagging replicas would remain,
+	  and aborts with a report otherwise. --force overrides the check.
+	- A designated instance lagging more than ReasonableMaintenanceReplicationLagSeconds fails the takeover. With
+	  --when-caught-up, orchestrator instead waits up to GracefulTakeoverCatchUpTimeoutSeconds for it to catch up,
+	  and aborts early when its recent lag history predicts it will not catch up in time.
+	- Refused while another recovery is in flight on the cluster; see --active-recovery in "recover"
 	Examples:
 
 	orchestrator -c graceful-master-takeover -alias mycluster
 		Indicate cluster by alias. Orchestrator automatically figures out the master and verifies it has a single direct replica
 
+	orchestrator -c graceful-master-takeover -alias mycluster -d designated.instance.com --force
+		Promote given instance even if the cluster's replica quorum is not met
+
+	orchestrator -c graceful-master-takeover -alias mycluster -d designated.instance.com --when-caught-up
+		Promote given instance once it catches up, should it be lagging
+
 	orchestrator -c force-master-takeover -i instance.in.relevant.cluster.com
 		Indicate cluster by an instance. You don't structly need to specify the master, orchestrator
 		will infer the master's identify.
@@ -818,6 +921,57 @@ func init() {
 
   orchestrator -c register-candidate
       -i not given, implicitly assumed local hostname
+
+  orchestrator -c register-candidate -i candidate.instance.com --promotion-rule=prefer --duration=1d
+      Registered rule expires after given duration, rather than after CandidateInstanceExpireMinutes
+	`
+	CommandHelp["override-promotion-rule"] = `
+  Temporarily override the promotion rule of an instance. For the given duration, the override takes precedence
+  over the instance's registered promotion rule, including registrations made while the override is active. Upon
+  expiry, the registered promotion rule applies again. Useful during maintenance on the usual candidate. Example:
+
+  orchestrator -c override-promotion-rule -i other.candidate.com --promotion-rule=prefer --duration=4h --reason="maintenance on usual candidate"
+	`
+	CommandHelp["clear-promotion-rule-override"] = `
+  Remove the promotion rule override of an instance, before it expires. Example:
+
+  orchestrator -c clear-promotion-rule-override -i other.candidate.com
+	`
+	CommandHelp["promotion-rule-overrides"] = `
+  List active promotion rule overrides, along with their expiry. Example:
+
+  orchestrator -c promotion-rule-overrides
+	`
+	CommandHelp["set-instance-flag"] = `
+  Set a persisted flag on an instance. Flags survive restarts and are replicated via raft. Known flags:
+  - never-promote: the instance is never promoted, whatever its promotion rule
+  - prefer-not-to-poll-aggressively: the instance is probed no more often than every InstanceFlagRelaxedPollSeconds
+  - skip-lag-checks: the instance's replication lag is not reported as a problem, nor sampled for lag SLOs
+  Examples:
+
+  orchestrator -c set-instance-flag -i reporting.replica.com --instance-flag=never-promote --reason="reporting only"
+
+  orchestrator -c set-instance-flag -i backup.replica.com --instance-flag=skip-lag-checks --reason="nightly backups"
+	`
+	CommandHelp["clear-instance-flag"] = `
+  Clear a persisted flag of an instance. Example:
+
+  orchestrator -c clear-instance-flag -i reporting.replica.com --instance-flag=never-promote
+	`
+	CommandHelp["instance-flags"] = `
+  List persisted instance flags, along with who set them and why. Examples:
+
+  orchestrator -c instance-flags
+      -i not given: list flags of all instances
+
+  orchestrator -c instance-flags -i reporting.replica.com
+	`
+	CommandHelp["scheduled-reverts"] = `
+  List pending scheduled reverts of time-boxed actions (see --revert-after), and those completed within the past day.
+  A pending revert which failed is retried by the leader until it succeeds; cancel it via the
+  cancel-scheduled-revert API. Example:
+
+  orchestrator -c scheduled-reverts
 	`
 	CommandHelp["register-hostname-unresolve"] = `
   Assigns the given instance a virtual (aka "unresolved") name. When moving replicas under an instance with assigned
@@ -75,6 +75,8 @@ func promptForSSLPasswords() {
 func standardHttp(continuousDiscovery bool) {
 	m := martini.Classic()
 
+	// API tokens authenticate on their own, with any authentication method
+	m.Use(http.AuthenticateAPIToken)
 	switch strings.ToLower(config.Config.AuthenticationMethod) {
 	case "basic":
 		{
@@ -82,7 +84,7 @@ func standardHttp(continuousDiscovery bool) {
 				// Still allowed; may be disallowed in future versions
 				log.Warning("AuthenticationMethod is configured as 'basic' but HTTPAuthUser undefined. Running without authentication.")
 			}
-			m.Use(auth.Basic(config.Config.HTTPAuthUser, config.Config.HTTPAuthPassword))
+			m.Use(http.UnlessAPIToken(auth.Basic(config.Config.HTTPAuthUser, config.Config.HTTPAuthPassword)))
 		}
 	case "multi":
 		{
@@ -91,13 +93,13 @@ func standardHttp(continuousDiscovery bool) {
 				log.Fatal("AuthenticationMethod is configured as 'multi' but HTTPAuthUser undefined")
 			}
 
-			m.Use(auth.BasicFunc(func(username, password string) bool {
+			m.Use(http.UnlessAPIToken(auth.BasicFunc(func(username, password string) bool {
 				if username == "readonly" {
 					// Will be treated as "read-only"
 					return true
 				}
 				return auth.SecureCompare(username, config.Config.HTTPAuthUser) && auth.SecureCompare(password, config.Config.HTTPAuthPassword)
-			}))
+			})))
 		}
 	default:
 		{
@@ -107,6 +109,7 @@ func standardHttp(continuousDiscovery bool) {
 	}
 
 	m.Use(gzip.All())
+	m.Use(http.ConditionalResponseWriter)
 	// Render html templates from templates directory
 	m.Use(render.Renderer(render.Options{
 		Directory:       "resources",
@@ -174,7 +177,7 @@ func agentsHttp() {
 	m.Use(gzip.All())
 	m.Use(render.Renderer())
 	if config.Config.AgentsUseMutualTLS {
-		m.Use(ssl.VerifyOUs(config.Config.AgentSSLValidOUs))
+		m.Use(http.AgentsAPI.VerifyAgentCertificate)
 	}
 
 	log.Info("Starting agents listener")
@@ -193,6 +196,12 @@ func agentsHttp() {
 			log.Fatale(err)
 		}
 		tlsConfig.InsecureSkipVerify = config.Config.AgentSSLSkipVerify
+		if agent.IsAgentEnrollmentEnabled() {
+			// Agents authenticate with the certificates issued to them upon enrollment
+			if tlsConfig.ClientCAs, err = agent.AppendEnrollmentCA(tlsConfig.ClientCAs); err != nil {
+				log.Fatale(err)
+			}
+		}
 		if err = ssl.AppendKeyPairWithPassword(tlsConfig, config.Config.AgentSSLCertFile, config.Config.AgentSSLPrivateKeyFile, agentSSLPEMPassword); err != nil {
 			log.Fatale(err)
 		}
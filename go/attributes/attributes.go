@@ -16,6 +16,16 @@
 
 package attributes
 
+// Host resource metrics, as reported by orchestrator-agent and stored as host attributes
+const (
+	HostDiskFreeBytesAttribute         = "host.disk_free_bytes"
+	HostDiskTotalBytesAttribute        = "host.disk_total_bytes"
+	HostIOUtilizationPercentAttribute  = "host.io_utilization_percent"
+	HostCPUUtilizationPercentAttribute = "host.cpu_utilization_percent"
+	HostMemoryFreeBytesAttribute       = "host.memory_free_bytes"
+	HostMemoryTotalBytesAttribute      = "host.memory_total_bytes"
+)
+
 // HostAttributes presnts attributes submitted by a host
 type HostAttributes struct {
 	Hostname        string
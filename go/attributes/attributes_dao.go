@@ -134,12 +134,42 @@ func GetHostAttribute(hostname string, attributeName string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	if len(attributeName) == 0 {
+	if len(attributes) == 0 {
 		return "", log.Errorf("No attribute found for %+v, %+v", hostname, attributeName)
 	}
 	return attributes[0].AttributeValue, nil
 }
 
+// GetHostAttributesMap returns all attributes of a given hostname as a name->value map. An empty
+// map is returned for hosts with no attributes
+func GetHostAttributesMap(hostname string) (map[string]string, error) {
+	attributesMap := make(map[string]string)
+	whereClause := `where hostname=?`
+	attributes, err := getHostAttributesByClause(whereClause, sqlutils.Args(hostname))
+	if err != nil {
+		return attributesMap, err
+	}
+	for _, attribute := range attributes {
+		attributesMap[attribute.AttributeName] = attribute.AttributeValue
+	}
+	return attributesMap, nil
+}
+
+// GetRecentHostAttributesMap returns the attributes of a given hostname submitted within the last maxAgeSeconds,
+// as a name->value map. Attributes submitted earlier than that are stale, and are not returned.
+func GetRecentHostAttributesMap(hostname string, maxAgeSeconds uint) (map[string]string, error) {
+	attributesMap := make(map[string]string)
+	whereClause := `where hostname=? and submit_timestamp >= now() - interval ? second`
+	attributes, err := getHostAttributesByClause(whereClause, sqlutils.Args(hostname, maxAgeSeconds))
+	if err != nil {
+		return attributesMap, err
+	}
+	for _, attribute := range attributes {
+		attributesMap[attribute.AttributeName] = attribute.AttributeValue
+	}
+	return attributesMap, nil
+}
+
 // SetGeneralAttribute sets an attribute not associated with a host. Its a key-value thing
 func SetGeneralAttribute(attributeName string, attributeValue string) error {
 	if attributeName == "" {
@@ -57,10 +57,22 @@ func main() {
 	config.RuntimeCLIFlags.Statement = flag.String("statement", "", "Statement/hint")
 	config.RuntimeCLIFlags.GrabElection = flag.Bool("grab-election", false, "Grab leadership (only applies to continuous mode)")
 	config.RuntimeCLIFlags.PromotionRule = flag.String("promotion-rule", "prefer", "Promotion rule for register-andidate (prefer|neutral|prefer_not|must_not)")
+	config.RuntimeCLIFlags.InstanceFlag = flag.String("instance-flag", "", "Instance flag for set-instance-flag and clear-instance-flag (never-promote|prefer-not-to-poll-aggressively|skip-lag-checks)")
+	config.RuntimeCLIFlags.RevertAfter = flag.String("revert-after", "", "Time-box set-writeable, stop-slave and start-slave: schedule their revert after given duration (e.g. 10m, 1h); the revert is executed by the orchestrator service")
 	config.RuntimeCLIFlags.Version = flag.Bool("version", false, "Print version and exit")
 	config.RuntimeCLIFlags.SkipContinuousRegistration = flag.Bool("skip-continuous-registration", false, "Skip cli commands performaing continuous registration (to reduce orchestratrator backend db load")
 	config.RuntimeCLIFlags.EnableDatabaseUpdate = flag.Bool("enable-database-update", false, "Enable database update, overrides SkipOrchestratorDatabaseUpdate")
 	config.RuntimeCLIFlags.IgnoreRaftSetup = flag.Bool("ignore-raft-setup", false, "Override RaftEnabled for CLI invocation (CLI by default not allowed for raft setups). NOTE: operations by CLI invocation may not reflect in all raft nodes.")
+	config.RuntimeCLIFlags.APITokenClusters = flag.String("api-token-clusters", "", "Comma delimited cluster filters (cluster names, alias=, alias~=, regular expressions, or * for all clusters) an API token is restricted to (applies for create-api-token)")
+	config.RuntimeCLIFlags.APITokenOperations = flag.String("api-token-operations", "", "Comma delimited operation classes (write,recover) granted to an API token, in addition to read (applies for create-api-token)")
+	config.RuntimeCLIFlags.APITokenId = flag.String("api-token-id", "", "API token id (applies for revoke-api-token)")
+	config.RuntimeCLIFlags.ReplicationThread = flag.String("thread", "", "Replication thread: io|sql (applies for start-replica-thread, stop-replica-thread and their cluster-wide variants)")
+	config.RuntimeCLIFlags.ReplicationChannel = flag.String("channel", "", "Replication channel (MySQL) or connection name (MariaDB) on multi-source replicas; default channel when empty")
+	config.RuntimeCLIFlags.Safe = flag.Bool("safe", false, "Safe mode for relocate, move-up, move-below, move-gtid and move-equivalent: verify the replica replicates after the move, and roll back to its previous master otherwise")
+	config.RuntimeCLIFlags.Force = flag.Bool("force", false, "With graceful-master-takeover: proceed even though the cluster would be left without its configured quorum of healthy replicas. With decommission-instance: decommission a master or co-master which has no replicas")
+	config.RuntimeCLIFlags.WhenCaughtUp = flag.Bool("when-caught-up", false, "With graceful-master-takeover: wait, up to GracefulTakeoverCatchUpTimeoutSeconds, for a lagging designated replica to catch up, rather than fail")
+	config.RuntimeCLIFlags.ActiveRecovery = flag.String("active-recovery", "", "With recover, recover-lite, force-master-failover, force-master-takeover and graceful-master-takeover: how to treat a recovery already in flight on the cluster: join|abort|override. By default, the command is refused")
+	config.RuntimeCLIFlags.DryRun = flag.Bool("dry-run", false, "With upgrade-backend: list the pending backend schema migrations and their statements, without deploying them")
 	flag.Parse()
 
 	if *destination != "" && *sibling != "" {
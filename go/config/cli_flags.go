@@ -26,11 +26,23 @@ type CLIFlags struct {
 	Version                    *bool
 	Statement                  *string
 	PromotionRule              *string
+	InstanceFlag               *string
+	RevertAfter                *string
 	ConfiguredVersion          string
 	SkipBinlogSearch           *bool
 	SkipContinuousRegistration *bool
 	EnableDatabaseUpdate       *bool
 	IgnoreRaftSetup            *bool
+	APITokenClusters           *string
+	APITokenOperations         *string
+	APITokenId                 *string
+	ReplicationThread          *string
+	ReplicationChannel         *string
+	Safe                       *bool
+	Force                      *bool
+	WhenCaughtUp               *bool
+	ActiveRecovery             *string
+	DryRun                     *bool
 }
 
 var RuntimeCLIFlags CLIFlags
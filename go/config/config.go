@@ -17,12 +17,17 @@
 package config
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"net"
+	"net/mail"
 	"net/url"
 	"os"
+	"reflect"
 	"regexp"
 	"strings"
+	"text/template"
 
 	"gopkg.in/gcfg.v1"
 
@@ -30,7 +35,8 @@ import (
 )
 
 var (
-	envVariableRegexp = regexp.MustCompile("[$][{](.*)[}]")
+	envVariableRegexp           = regexp.MustCompile("[$][{](.*)[}]")
+	groupingDimensionNameRegexp = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
 )
 
 const (
@@ -82,6 +88,204 @@ var deprecatedConfigurationVariables = []string{
 	"MaxOutdatedKeysToShow",
 }
 
+// HookConfiguration makes for execution settings of recovery hooks (processes)
+type HookConfiguration struct {
+	TimeoutSeconds      int               // Kill hook if it runs for longer than given seconds. 0 for no timeout
+	Retries             int               // Number of additional attempts to make should the hook fail
+	RetryBackoffSeconds int               // Wait time before first retry. Wait time doubles with each further retry
+	WorkingDirectory    string            // Directory in which to execute the hook. Empty means orchestrator's own working directory
+	Environment         map[string]string // Additional environment variables passed to the hook
+	RunAsUser           string            // OS user by which to run the hook. Only applies when orchestrator runs as root
+	JSONPayload         bool              // When true, the hook gets the full recovery context as a JSON document on its stdin, and in a file named by ORC_HOOK_PAYLOAD_FILE
+}
+
+// Replication lag sources, as listed in ReplicationLagSources
+const (
+	ReplicationLagSourceHeartbeat           = "heartbeat"
+	ReplicationLagSourceApplier             = "applier"
+	ReplicationLagSourceSecondsBehindMaster = "seconds_behind_master"
+)
+
+// Recovery automation levels, per failure class, as listed in RecoveryAutomationLevels
+const (
+	RecoveryAutomationAuto    = "auto"
+	RecoveryAutomationApprove = "approve"
+	RecoveryAutomationNever   = "never"
+)
+
+// Discovery metrics storage, as given by DiscoveryMetricsStorage
+const (
+	DiscoveryMetricsBackendStorage = "backend"
+	DiscoveryMetricsFileStorage    = "file"
+)
+
+// read_only enforcement modes, as listed in ReadOnlyEnforcement
+const (
+	ReadOnlyEnforcementEnforce = "enforce"
+	ReadOnlyEnforcementAlert   = "alert"
+)
+
+// Failure classes, as listed in RecoveryAutomationLevels. Co-master failures are of the master class.
+const (
+	MasterFailureClass             = "master"
+	IntermediateMasterFailureClass = "intermediate-master"
+)
+
+// AnalysisHysteresis overrides, per analysis code, the number of consecutive analysis cycles required to report a
+// problem, or to report it cleared. Zero values inherit AnalysisRaiseCycles and AnalysisClearCycles.
+type AnalysisHysteresis struct {
+	RaiseCycles uint
+	ClearCycles uint
+}
+
+// HookActionPrefix marks an entry in a hooks list as a built-in hook action, e.g. "action:update-dns"
+const HookActionPrefix = "action:"
+
+// HostnameRewriteRule rewrites hostnames matching a regular expression before they are resolved, e.g. so that
+// split-horizon names of a host map onto a single canonical name. Replacement may refer to submatches as $1, $2 etc.
+type HostnameRewriteRule struct {
+	Pattern     string
+	Replacement string
+}
+
+// InstanceKeyNormalizationRule rewrites instance keys whose hostname matches either a regular expression or an IP
+// network, e.g. so that the private IPs instances report map onto the public names orchestrator connects with.
+type InstanceKeyNormalizationRule struct {
+	HostnamePattern string // Regexp matched against the hostname. Replacement may refer to submatches as $1, $2 etc.
+	CIDR            string // IP network, e.g. 10.0.0.0/8, matched against IP hostnames. Replacement may use {ip} and {ipDashed}
+	Port            int    // When non-zero, only keys of this port are rewritten
+	Replacement     string // Hostname the key is rewritten to. Empty keeps the hostname
+	ReplacementPort int    // When non-zero, port the key is rewritten to
+}
+
+// HookAction is a built-in recovery hook action, which orchestrator runs on its own, requiring no shell.
+// Hooks lists refer to an action as "action:<name>". String fields support the same {placeholders} as hooks do.
+type HookAction struct {
+	Type          string            // "http", "consul", "dns" or "mysql"
+	URL           string            // http: request URL
+	Method        string            // http: request method. Default: "POST"
+	Headers       map[string]string // http: request headers
+	Body          string            // http: request body
+	Key           string            // consul: key to write, via ConsulAddress
+	Value         string            // consul: value to write
+	DNSServer     string            // dns: "host[:port]" of an authoritative server accepting RFC 2136 dynamic updates from orchestrator
+	DNSNet        string            // dns: "udp" or "tcp". Default: "udp"
+	Zone          string            // dns: zone to update, e.g. "db.example.com"
+	RecordName    string            // dns: name whose records are replaced, e.g. "{failureClusterAlias}-master.db.example.com"
+	RecordType    string            // dns: "A" or "CNAME". Default: "A"
+	RecordTTL     uint              // dns: TTL of the new record, in seconds. Default: 60
+	RecordValue   string            // dns: host name or IPv4 address for an A record, host name for a CNAME record, e.g. "{successorHost}"
+	TSIGKeyName   string            // dns: optional; name of the TSIG key signing the update, e.g. "orchestrator-key"
+	TSIGAlgorithm string            // dns: TSIG algorithm: "hmac-md5", "hmac-sha1", "hmac-sha256" or "hmac-sha512". Default: "hmac-sha256"
+	TSIGSecret    string            // dns: base64 encoded TSIG secret
+	Host          string            // mysql: host on which to run the statement, e.g. "{successorHost}"
+	Port          string            // mysql: port on which to run the statement, e.g. "{successorPort}"
+	Query         string            // mysql: statement to run, using the topology credentials
+}
+
+// validate checks a hook action has the settings its type requires
+func (this *HookAction) validate() error {
+	switch this.Type {
+	case "http":
+		if _, err := url.Parse(this.URL); err != nil || this.URL == "" {
+			return fmt.Errorf("http action requires a valid URL")
+		}
+	case "consul":
+		if this.Key == "" {
+			return fmt.Errorf("consul action requires Key")
+		}
+	case "dns":
+		if this.DNSServer == "" || this.Zone == "" || this.RecordName == "" || this.RecordValue == "" {
+			return fmt.Errorf("dns action requires DNSServer, Zone, RecordName and RecordValue")
+		}
+		if this.DNSNet != "" && this.DNSNet != "udp" && this.DNSNet != "tcp" {
+			return fmt.Errorf("dns action DNSNet must be \"udp\" or \"tcp\". Got: %s", this.DNSNet)
+		}
+		if this.RecordType != "" && this.RecordType != "A" && this.RecordType != "CNAME" {
+			return fmt.Errorf("dns action RecordType must be \"A\" or \"CNAME\". Got: %s", this.RecordType)
+		}
+		if (this.TSIGKeyName == "") != (this.TSIGSecret == "") {
+			return fmt.Errorf("dns action requires both TSIGKeyName and TSIGSecret, or neither")
+		}
+		if _, err := base64.StdEncoding.DecodeString(this.TSIGSecret); err != nil {
+			return fmt.Errorf("dns action TSIGSecret must be base64 encoded")
+		}
+		switch this.TSIGAlgorithm {
+		case "", "hmac-md5", "hmac-sha1", "hmac-sha256", "hmac-sha512":
+		default:
+			return fmt.Errorf("dns action TSIGAlgorithm must be one of \"hmac-md5\", \"hmac-sha1\", \"hmac-sha256\", \"hmac-sha512\". Got: %s", this.TSIGAlgorithm)
+		}
+	case "mysql":
+		if this.Host == "" || this.Port == "" || this.Query == "" {
+			return fmt.Errorf("mysql action requires Host, Port and Query")
+		}
+	default:
+		return fmt.Errorf("unknown action type: %s. Expected one of \"http\", \"consul\", \"dns\", \"mysql\"", this.Type)
+	}
+	return nil
+}
+
+// GracefulTakeoverTransactionsConfiguration describes checks made on a master, prior to demoting it on graceful master takeover,
+// for long running transactions and metadata locks.
+type GracefulTakeoverTransactionsConfiguration struct {
+	LongTransactionSeconds uint   // Transactions running longer than this are considered blocking. 0 disables the check
+	CheckMetadataLocks     bool   // Sessions holding metadata locks other sessions wait on are considered blocking. Waiting sessions are reported, never killed
+	Action                 string // What to do on blocking sessions: "report" (log & audit, then proceed), "kill" (kill blocking sessions, then proceed), "abort" (fail the takeover with a report)
+}
+
+// GracefulTakeoverReplicaQuorumConfiguration is the quorum of healthy replicas a cluster is to have following a
+// graceful master takeover. The designated master and the demoted master do not count towards the quorum.
+type GracefulTakeoverReplicaQuorumConfiguration struct {
+	MinHealthyReplicas uint // Minimal number of healthy replicas. 0 disables the check
+	MaxLagSeconds      uint // Replicas lagging more than this are not healthy. Defaults ReasonableReplicationLagSeconds
+}
+
+// ErrorLogPatternConfiguration describes MySQL error log lines to alert on, such as InnoDB corruption, semi-sync
+// timeouts or replication breakage
+type ErrorLogPatternConfiguration struct {
+	Pattern   string // Regexp pattern, matched against each error log line
+	IsProblem bool   // When true, an instance whose error log recently matched is listed as a problem
+}
+
+// GroupingDimensionConfiguration describes how a custom grouping dimension of instances (e.g. rack, cell, shard)
+// is derived. Query, when given, overrides HostnamePattern.
+type GroupingDimensionConfiguration struct {
+	HostnamePattern string // Regexp pattern with one group, extracting the dimension's value from the hostname
+	Query           string // Query (executed on topology instance) that returns the dimension's value. Must return one row, one column
+}
+
+// NamespaceConfiguration describes a namespace (tenant): the clusters assigned to it, and the users who may access it
+type NamespaceConfiguration struct {
+	ClusterFilters []string // Clusters assigned to this namespace: cluster names, aliases or patterns, as with RecoverMasterClusterFilters
+	AuthUsers      []string // Authenticated users who are members of this namespace. "*" for all users
+	AuthGroups     []string // Unix groups whose members are members of this namespace (with "proxy" authentication method)
+}
+
+// PromotionPoolsConfiguration makes the choice of a replica to promote aware of the replica's pool membership
+type PromotionPoolsConfiguration struct {
+	FailoverPool string   // Members of this pool are preferred for promotion, e.g. replicas kept as spare capacity for failovers
+	AvoidPools   []string // Members of these pools, e.g. heavily used read pools, are not promoted where another replica will do, so as to not lose read capacity
+}
+
+// KVMasterEntryTemplate is a templated master entry in KV stores. Key and Value are Go templates over the cluster
+// and its master: {{.ClusterAlias}}, {{.ClusterDomain}}, {{.DataCenter}}, {{.Hostname}}, {{.Port}}, {{.MasterKey}}
+// (hostname:port) and {{.Attributes}}, the master's host attributes, e.g. {{index .Attributes "role"}}. The cluster
+// name is not available: it changes upon failover.
+type KVMasterEntryTemplate struct {
+	Key   string // e.g. "service/{{.ClusterAlias}}/writer"
+	Value string // Defaults "{{.Hostname}}:{{.Port}}"
+}
+
+// LagSLOConfiguration describes a replication lag service level objective of a cluster: the ratio of minutes
+// in which the cluster's replicas are to lag less than a threshold
+type LagSLOConfiguration struct {
+	ThresholdSeconds      float64   // A minute is compliant when all of the cluster's replicas lag less than this, as sampled in that minute
+	TargetRatio           float64   // Objective ratio of compliant minutes, e.g. 0.99
+	WindowHours           uint      // Compliance is computed over this rolling window. Defaults 720 (30 days)
+	BurnRateWindowMinutes uint      // The error budget burn rate is computed over this recent window. Defaults 60
+	BurnRateThresholds    []float64 // Burn rates upon crossing which LagSLOBurnProcesses are executed, e.g. [2, 10]. A burn rate of 1 exhausts the error budget exactly at the end of the window
+}
+
 // Configuration makes for orchestrator configuration input, which can be provided by user via JSON formatted file.
 // Some of the parameteres have reasonable default values, and some (like database credentials) are
 // strictly expected from user.
@@ -91,7 +295,11 @@ type Configuration struct {
 	ListenAddress                              string // Where orchestrator HTTP should listen for TCP
 	ListenSocket                               string // Where orchestrator HTTP should listen for unix socket (default: empty; when given, TCP is disabled)
 	HTTPAdvertise                              string // optional, for raft setups, what is the HTTP address this node will advertise to its peers (potentially use where behind NAT or when rerouting ports; example: "http://11.22.33.44:3030")
+	ShutdownDrainTimeoutSeconds                uint   // On SIGTERM, max time to wait for in-flight recoveries and API operations to complete before exiting
 	AgentsServerPort                           string // port orchestrator agents talk back to
+	ConfigEncryptionKeyEnvVariable             string // Name of environment variable holding the base64 encoded 256 bit key which decrypts ENC[AES256_GCM,...] configuration values
+	ConfigEncryptionKeyFile                    string // File holding the base64 encoded 256 bit key which decrypts ENC[AES256_GCM,...] configuration values. Used when ConfigEncryptionKeyEnvVariable is not set
+	ConfigEncryptionKeyCommand                 string // Command printing the base64 encoded 256 bit key which decrypts ENC[AES256_GCM,...] configuration values, e.g. by decrypting a data key via KMS. Used when neither of the above is set
 	MySQLTopologyUser                          string
 	MySQLTopologyPassword                      string // my.cnf style configuration file from where to pick credentials. Expecting `user`, `password` under `[client]` section
 	MySQLTopologyCredentialsConfigFile         string
@@ -104,14 +312,18 @@ type Configuration struct {
 	TLSCacheTTLFactor                          uint   // Factor of InstancePollSeconds that we set as TLS info cache expiry
 	BackendDB                                  string // EXPERIMENTAL: type of backend db; either "mysql" or "sqlite3"
 	SQLite3DataFile                            string // when BackendDB == "sqlite3", full path to sqlite3 datafile
-	SkipOrchestratorDatabaseUpdate             bool   // When true, do not check backend database schema nor attempt to update it. Useful when you may be running multiple versions of orchestrator, and you only wish certain boxes to dictate the db structure (or else any time a different orchestrator version runs it will rebuild database schema)
-	PanicIfDifferentDatabaseDeploy             bool   // When true, and this process finds the orchestrator backend DB was provisioned by a different version, panic
+	SkipOrchestratorDatabaseUpdate             bool   // When true, do not deploy pending backend schema migrations; refuse to start unless the backend schema is up to date. Migrations are then deployed via `orchestrator -c upgrade-backend`. Useful when you may be running multiple versions of orchestrator, and you only wish certain boxes to dictate the db structure
+	PanicIfDifferentDatabaseDeploy             bool   // When true, and this process finds the orchestrator backend DB schema at a different version than its own, panic
+	AllowIncompatibleBackendSchema             bool   // When true, start even though the backend schema is incompatible: migrated by a newer orchestrator, or behind this orchestrator while SkipOrchestratorDatabaseUpdate is set
 	RaftEnabled                                bool   // When true, setup orchestrator in a raft consensus layout. When false (default) all Raft* variables are ignored
 	RaftBind                                   string
 	RaftAdvertise                              string
 	RaftDataDir                                string
 	DefaultRaftPort                            int      // if a RaftNodes entry does not specify port, use this one
 	RaftNodes                                  []string // Raft nodes to make initial connection with
+	RaftFollowerMaxAppliedIndexLag             uint64   // A raft follower whose applied index is behind the leader's by more than this many log entries is reported as lagging. 0 disables
+	LeaderLeaseElection                        bool     // When true (raft must be disabled), the active node holds a lease in the backend database, renewed every HealthPollSeconds and carrying a fencing token which grows with each change of leadership. A node stops acting as leader once its lease expires, even if the backend is unreachable
+	LeaderLeaseSeconds                         uint     // With LeaderLeaseElection, duration of the leader lease. Another node takes over once the lease expires unrenewed. Default: 10
 	ExpectFailureAnalysisConcensus             bool
 	MySQLOrchestratorHost                      string
 	MySQLOrchestratorMaxPoolConnections        int // The maximum size of the connection pool to the Orchestrator backend.
@@ -119,141 +331,265 @@ type Configuration struct {
 	MySQLOrchestratorDatabase                  string
 	MySQLOrchestratorUser                      string
 	MySQLOrchestratorPassword                  string
-	MySQLOrchestratorCredentialsConfigFile     string   // my.cnf style configuration file from where to pick credentials. Expecting `user`, `password` under `[client]` section
-	MySQLOrchestratorSSLPrivateKeyFile         string   // Private key file used to authenticate with the Orchestrator mysql instance with TLS
-	MySQLOrchestratorSSLCertFile               string   // Certificate PEM file used to authenticate with the Orchestrator mysql instance with TLS
-	MySQLOrchestratorSSLCAFile                 string   // Certificate Authority PEM file used to authenticate with the Orchestrator mysql instance with TLS
-	MySQLOrchestratorSSLSkipVerify             bool     // If true, do not strictly validate mutual TLS certs for the Orchestrator mysql instances
-	MySQLOrchestratorUseMutualTLS              bool     // Turn on TLS authentication with the Orchestrator MySQL instance
-	MySQLConnectTimeoutSeconds                 int      // Number of seconds before connection is aborted (driver-side)
-	MySQLOrchestratorReadTimeoutSeconds        int      // Number of seconds before backend mysql read operation is aborted (driver-side)
-	MySQLDiscoveryReadTimeoutSeconds           int      // Number of seconds before topology mysql read operation is aborted (driver-side). Used for discovery queries.
-	MySQLTopologyReadTimeoutSeconds            int      // Number of seconds before topology mysql read operation is aborted (driver-side). Used for all but discovery queries.
-	DefaultInstancePort                        int      // In case port was not specified on command line
-	SlaveLagQuery                              string   // Synonym to ReplicationLagQuery
-	ReplicationLagQuery                        string   // custom query to check on replica lg (e.g. heartbeat table)
-	DiscoverByShowSlaveHosts                   bool     // Attempt SHOW SLAVE HOSTS before PROCESSLIST
-	UseSuperReadOnly                           bool     // Should orchestrator super_read_only any time it sets read_only
-	InstancePollSeconds                        uint     // Number of seconds between instance reads
-	InstanceWriteBufferSize                    int      // Instance write buffer size (max number of instances to flush in one INSERT ODKU)
-	BufferInstanceWrites                       bool     // Set to 'true' for write-optimization on backend table (compromise: writes can be stale and overwrite non stale data)
-	InstanceFlushIntervalMilliseconds          int      // Max interval between instance write buffer flushes
-	SkipMaxScaleCheck                          bool     // If you don't ever have MaxScale BinlogServer in your topology (and most people don't), set this to 'true' to save some pointless queries
-	UnseenInstanceForgetHours                  uint     // Number of hours after which an unseen instance is forgotten
-	SnapshotTopologiesIntervalHours            uint     // Interval in hour between snapshot-topologies invocation. Default: 0 (disabled)
-	DiscoveryMaxConcurrency                    uint     // Number of goroutines doing hosts discovery
-	DiscoveryQueueCapacity                     uint     // Buffer size of the discovery queue. Should be greater than the number of DB instances being discovered
-	DiscoveryQueueMaxStatisticsSize            int      // The maximum number of individual secondly statistics taken of the discovery queue
-	DiscoveryCollectionRetentionSeconds        uint     // Number of seconds to retain the discovery collection information
-	InstanceBulkOperationsWaitTimeoutSeconds   uint     // Time to wait on a single instance when doing bulk (many instances) operation
-	HostnameResolveMethod                      string   // Method by which to "normalize" hostname ("none"/"default"/"cname")
-	MySQLHostnameResolveMethod                 string   // Method by which to "normalize" hostname via MySQL server. ("none"/"@@hostname"/"@@report_host"; default "@@hostname")
-	SkipBinlogServerUnresolveCheck             bool     // Skip the double-check that an unresolved hostname resolves back to same hostname for binlog servers
-	ExpiryHostnameResolvesMinutes              int      // Number of minutes after which to expire hostname-resolves
-	RejectHostnameResolvePattern               string   // Regexp pattern for resolved hostname that will not be accepted (not cached, not written to db). This is done to avoid storing wrong resolves due to network glitches.
-	ReasonableReplicationLagSeconds            int      // Above this value is considered a problem
-	ProblemIgnoreHostnameFilters               []string // Will minimize problem visualization for hostnames matching given regexp filters
-	VerifyReplicationFilters                   bool     // Include replication filters check before approving topology refactoring
-	ReasonableMaintenanceReplicationLagSeconds int      // Above this value move-up and move-below are blocked
-	CandidateInstanceExpireMinutes             uint     // Minutes after which a suggestion to use an instance as a candidate replica (to be preferably promoted on master failover) is expired.
-	AuditLogFile                               string   // Name of log file for audit operations. Disabled when empty.
-	AuditToSyslog                              bool     // If true, audit messages are written to syslog
-	AuditToBackendDB                           bool     // If true, audit messages are written to the backend DB's `audit` table (default: true)
-	RemoveTextFromHostnameDisplay              string   // Text to strip off the hostname on cluster/clusters pages
+	MySQLOrchestratorCredentialsConfigFile     string                         // my.cnf style configuration file from where to pick credentials. Expecting `user`, `password` under `[client]` section
+	MySQLOrchestratorSSLPrivateKeyFile         string                         // Private key file used to authenticate with the Orchestrator mysql instance with TLS
+	MySQLOrchestratorSSLCertFile               string                         // Certificate PEM file used to authenticate with the Orchestrator mysql instance with TLS
+	MySQLOrchestratorSSLCAFile                 string                         // Certificate Authority PEM file used to authenticate with the Orchestrator mysql instance with TLS
+	MySQLOrchestratorSSLSkipVerify             bool                           // If true, do not strictly validate mutual TLS certs for the Orchestrator mysql instances
+	MySQLOrchestratorUseMutualTLS              bool                           // Turn on TLS authentication with the Orchestrator MySQL instance
+	MySQLConnectTimeoutSeconds                 int                            // Number of seconds before connection is aborted (driver-side)
+	MySQLOrchestratorReadTimeoutSeconds        int                            // Number of seconds before backend mysql read operation is aborted (driver-side)
+	MySQLOrchestratorHosts                     []string                       // Additional MySQL backend servers (hostname, or hostname:port) to fail over to when MySQLOrchestratorHost is unreachable or read-only
+	BackendHealthCheckIntervalSeconds          uint                           // Interval in seconds between checks of the MySQL backend. While no backend is writable, orchestrator runs in degraded mode. 0 disables the check. Default: 5
+	BackendSelfMonitoring                      bool                           // When true, orchestrator discovers and monitors the replicated cluster of its own MySQL backend (the "self" cluster). Failures on the self cluster are detected, but only recovered manually, via recover-backend, unless BackendSelfAutoRecovery is set
+	BackendSelfAutoRecovery                    bool                           // When true, failures on the self cluster (see BackendSelfMonitoring) other than the backend master's are recovered automatically, as on any cluster. Default: false
+	BackendRecoveryRelayLogTimeoutSeconds      uint                           // Max time recover-backend waits for the promoted backend replica to apply its relay logs
+	MySQLDiscoveryReadTimeoutSeconds           int                            // Number of seconds before topology mysql read operation is aborted (driver-side). Used for discovery queries.
+	MySQLTopologyReadTimeoutSeconds            int                            // Number of seconds before topology mysql read operation is aborted (driver-side). Used for all but discovery queries.
+	DefaultInstancePort                        int                            // In case port was not specified on command line
+	SlaveLagQuery                              string                         // Synonym to ReplicationLagQuery
+	ReplicationLagQuery                        string                         // custom query to check on replica lg (e.g. heartbeat table)
+	ReplicationLagSources                      map[string][]string            // Ordered replication lag sources per cluster: "heartbeat" (ReplicationLagQuery), "applier" (performance_schema applier timestamps, MySQL 8.0) and "seconds_behind_master". The first source producing a reading applies. Key is cluster name or cluster alias, or "*" to apply to all clusters
+	DiscoverByShowSlaveHosts                   bool                           // Attempt SHOW SLAVE HOSTS before PROCESSLIST
+	UnreconciledReplicasAutoDiscover           bool                           // When true, the leader re-discovers replicas which masters list as connected (via SHOW SLAVE HOSTS or processlist), yet are unknown to orchestrator or known to replicate elsewhere
+	LightweightProbes                          bool                           // When true, healthy leaf replicas running MySQL 8.0 or above with GTID auto-positioning are probed via performance_schema in two statements, in between full probes
+	LightweightProbesFullProbeSeconds          uint                           // With LightweightProbes, interval at which such replicas still get a full probe, bounding the age of data carried over from the full probe, such as binary log coordinates. Must not exceed 60. Default: 0, meaning 2 * InstancePollSeconds
+	ProcesslistSampling                        bool                           // When true, full probes sample the processlist: thread counts, the replication applier's longest running transaction, and the longest running active threads (listed as long queries)
+	ProcesslistSampleMaxRows                   uint                           // With ProcesslistSampling, max number of longest running active threads kept per instance. 0 keeps none. Default: 20
+	ProcesslistLongApplierTrxSeconds           uint                           // With ProcesslistSampling, a replica whose replication applier runs a transaction this long or longer is reported as a problem (possibly stalled). 0 disables. Default: 300
+	ProcesslistMasterActiveThreadsThreshold    uint                           // With ProcesslistSampling, a master with this many active threads or more is reported as a problem. 0 disables. Default: 200
+	UseSuperReadOnly                           bool                           // Should orchestrator super_read_only any time it sets read_only
+	InstancePollSeconds                        uint                           // Number of seconds between instance reads
+	InstanceCacheTTLSeconds                    uint                           // When > 0, cluster instances read from the backend are cached in memory for up to this many seconds. Must not exceed InstancePollSeconds
+	InstanceFlagRelaxedPollSeconds             uint                           // Instances flagged prefer-not-to-poll-aggressively are probed no more often than every this many seconds. Default: 60
+	InstanceWriteBufferSize                    int                            // Instance write buffer size (max number of instances to flush in one INSERT ODKU)
+	BufferInstanceWrites                       bool                           // Set to 'true' for write-optimization on backend table (compromise: writes can be stale and overwrite non stale data)
+	InstanceFlushIntervalMilliseconds          int                            // Max interval between instance write buffer flushes
+	SkipMaxScaleCheck                          bool                           // If you don't ever have MaxScale BinlogServer in your topology (and most people don't), set this to 'true' to save some pointless queries
+	UnseenInstanceForgetHours                  uint                           // Number of hours after which an unseen instance is forgotten
+	SnapshotTopologiesIntervalHours            uint                           // Interval in hour between snapshot-topologies invocation. Default: 0 (disabled)
+	BinlogCheckpointIntervalSeconds            uint                           // Interval in seconds between recording checkpoints of masters' binary log coordinates and GTID sets. Default: 0 (disabled)
+	AnalysisHistoryRetentionHours              uint                           // Hours for which changes in the analysis of clusters are archived, for review via /api/analysis-history. Default: 0 (disabled)
+	AnalysisHistoryMaxRows                     uint                           // Max number of archived analysis entries kept; older entries are purged even if within AnalysisHistoryRetentionHours. 0 for unlimited. Default: 100000
+	AnalysisRaiseCycles                        uint                           // Number of consecutive analysis cycles a problem must persist before it is reported in the analysis changelog and as analysis-raised state event. Default: 1
+	AnalysisClearCycles                        uint                           // Number of consecutive analysis cycles a reported problem must be gone before it is reported cleared. Default: 1
+	AnalysisHysteresisOverrides                map[string]AnalysisHysteresis  // Overrides of AnalysisRaiseCycles and AnalysisClearCycles, keyed by analysis code (e.g. "UnreachableMaster")
+	NotificationDeduplicationSeconds           uint                           // Window within which repeated identical notifications (state events, OnFailureDetectionProcesses and OnDualWritableMastersProcesses hooks) are only sent once. Default: 0 (disabled)
+	DiscoveryMaxConcurrency                    uint                           // Number of goroutines doing hosts discovery
+	DiscoveryQueueCapacity                     uint                           // Buffer size of the discovery queue. Should be greater than the number of DB instances being discovered
+	DiscoveryQueueMaxStatisticsSize            int                            // The maximum number of individual secondly statistics taken of the discovery queue
+	DiscoveryCollectionRetentionSeconds        uint                           // Number of seconds to retain the discovery collection information
+	DiscoveryMetricsStorage                    string                         // Where discovery metrics are persisted, so that they survive restarts and leader changes: "backend", "file" (a local SQLite file, see DiscoveryMetricsStorageFile), or empty, keeping them in memory for DiscoveryCollectionRetentionSeconds only
+	DiscoveryMetricsStorageFile                string                         // With DiscoveryMetricsStorage "file": full path to the local SQLite file persisting discovery metrics
+	DiscoveryMetricsStorageRetentionHours      uint                           // Number of hours persisted discovery metrics are retained. Default: 24
+	DiscoveryMetricsStorageMaxRows             uint                           // Max number of persisted discovery metrics, by all nodes; the oldest metrics beyond are expired ahead of DiscoveryMetricsStorageRetentionHours. Default: 1000000
+	DiscoveryMetricsReadLimit                  uint                           // Max number of discovery metrics, the most recent ones, served by the discovery metrics endpoints. Default: 100000
+	DiscoveryBackpressureQueueRatio            float64                        // When positive, discovery is saturated once the discovery queue fills up to this fraction of DiscoveryQueueCapacity. Default: 0 (disabled)
+	DiscoveryBackpressureBackendSeconds        float64                        // When positive, discovery is saturated once the mean backend latency of discoveries over the last InstancePollSeconds exceeds this many seconds. Default: 0 (disabled)
+	DiscoveryAutoTune                          bool                           // When true, the effective discovery concurrency (up to DiscoveryMaxConcurrency) and per-instance poll jitter are tuned every InstancePollSeconds, based on discovery latency percentiles and backend write latency, targeting DiscoveryMaxStalenessSeconds
+	DiscoveryMaxStalenessSeconds               uint                           // With DiscoveryAutoTune: the goal for the age of instances' data, from one poll to the next. Default: 2 * InstancePollSeconds
+	DiscoveryAutoTuneBackendWriteSeconds       float64                        // With DiscoveryAutoTune: discovery concurrency is reduced while the 95th percentile backend write latency of discoveries exceeds this many seconds. Default: 1
+	DiscoverySheddingPools                     []string                       // Pools whose leaf replicas are shed from discovery while discovery is saturated, lowest priority first: the first pool is shed first, the next pool is shed only if saturation persists, and so forth
+	DiscoverySheddingPollSeconds               uint                           // Leaf replicas shed from discovery are still probed, no more often than every this many seconds, lest their data go stale for as long as discovery is saturated. Default: 300
+	DiscoveryOutlierSigma                      float64                        // When positive, instances whose discovery probes over DiscoveryCollectionRetentionSeconds are consistently this many standard deviations slower than the fleet median are reported as slow discovery outliers. Default: 0 (disabled)
+	SlowAPIRequestThresholdMilliseconds        uint                           // API requests taking longer than this are logged along with their parameters. Default: 5000. 0 disables
+	SlowDiscoveryOutlierProcesses              []string                       // Processes to execute when an instance is newly reported as a slow discovery outlier. May use placeholders: {host}, {port}, {medianSeconds}, {fleetMedianSeconds}
+	TopologyPrivilegesCheckIntervalMinutes     uint                           // Interval in minutes between checks of the topology user's privileges on all instances. Instances where privileges are missing are reported as problems. Default: 0 (disabled)
+	ReducedPrivilegesMode                      bool                           // When true, SUPER is not required on MySQL 8.0+ instances: the dynamic privileges REPLICATION_SLAVE_ADMIN, SYSTEM_VARIABLES_ADMIN and CONNECTION_ADMIN are, and statements requiring privileges the topology user is not granted are refused before they run
+	InstanceBulkOperationsWaitTimeoutSeconds   uint                           // Time to wait on a single instance when doing bulk (many instances) operation
+	HostnameResolveMethod                      string                         // Method by which to "normalize" hostname ("none"/"default"/"cname")
+	MySQLHostnameResolveMethod                 string                         // Method by which to "normalize" hostname via MySQL server. ("none"/"@@hostname"/"@@report_host"; default "@@hostname")
+	PreferIPv6                                 bool                           // When true, connections to hosts resolving to both IPv6 (AAAA) and IPv4 (A) addresses attempt IPv6 addresses first
+	TopologyTunnels                            map[string]string              // Tunnels through which topology connections (including discovery) are routed, for hosts orchestrator cannot reach directly. Key is data center (as per DataCenterPattern), or "*" for all hosts. Value is socks5://[user:password@]host:port or ssh://[user@]host[:port]
+	SkipBinlogServerUnresolveCheck             bool                           // Skip the double-check that an unresolved hostname resolves back to same hostname for binlog servers
+	ExpiryHostnameResolvesMinutes              int                            // Number of minutes after which to expire hostname-resolves
+	RejectHostnameResolvePattern               string                         // Regexp pattern for resolved hostname that will not be accepted (not cached, not written to db). This is done to avoid storing wrong resolves due to network glitches.
+	HostnameRewriteRules                       []HostnameRewriteRule          // Rules rewriting hostnames before they are resolved. The first matching rule applies
+	HostnameResolveStaticMap                   map[string]string              // Static resolves of hostnames into canonical hostnames, taking precedence over HostnameResolveMethod
+	HostnameResolveHostsFile                   string                         // Path of a hosts file, in /etc/hosts format, whose aliases and addresses resolve to their canonical hostname, taking precedence over HostnameResolveMethod
+	HostnameResolveDNSServers                  []string                       // DNS servers (host:port) queried by the hostname resolve subsystem, instead of the system's resolver
+	InstanceKeyNormalizationRules              []InstanceKeyNormalizationRule // Rules rewriting instance keys wherever orchestrator reads them: discovery, SHOW SLAVE STATUS, SHOW SLAVE HOSTS, API and command line. The first matching rule applies
+	InstanceKeyNormalizer                      string                         // Name of an additional key normalizer, registered via inst.RegisterInstanceKeyNormalizer(), applied following InstanceKeyNormalizationRules
+	ReasonableReplicationLagSeconds            int                            // Above this value is considered a problem
+	ProblemIgnoreHostnameFilters               []string                       // Will minimize problem visualization for hostnames matching given regexp filters
+	VerifyReplicationFilters                   bool                           // Include replication filters check before approving topology refactoring
+	ReasonableMaintenanceReplicationLagSeconds int                            // Above this value move-up and move-below are blocked
+	CandidateInstanceExpireMinutes             uint                           // Minutes after which a suggestion to use an instance as a candidate replica (to be preferably promoted on master failover) is expired.
+	AuditLogFile                               string                         // Name of log file for audit operations. Disabled when empty.
+	AuditToSyslog                              bool                           // If true, audit messages are written to syslog
+	AuditToBackendDB                           bool                           // If true, audit messages are written to the backend DB's `audit` table (default: true)
+	RemoveTextFromHostnameDisplay              string                         // Text to strip off the hostname on cluster/clusters pages
 	ReadOnly                                   bool
 	AuthenticationMethod                       string // Type of autherntication to use, if any. "" for none, "basic" for BasicAuth, "multi" for advanced BasicAuth, "proxy" for forwarded credentials via reverse proxy, "token" for token based access
 	OAuthClientId                              string
 	OAuthClientSecret                          string
 	OAuthScopes                                []string
-	HTTPAuthUser                               string            // Username for HTTP Basic authentication (blank disables authentication)
-	HTTPAuthPassword                           string            // Password for HTTP Basic authentication
-	AuthUserHeader                             string            // HTTP header indicating auth user, when AuthenticationMethod is "proxy"
-	PowerAuthUsers                             []string          // On AuthenticationMethod == "proxy", list of users that can make changes. All others are read-only.
-	PowerAuthGroups                            []string          // list of unix groups the authenticated user must be a member of to make changes.
-	AccessTokenUseExpirySeconds                uint              // Time by which an issued token must be used
-	AccessTokenExpiryMinutes                   uint              // Time after which HTTP access token expires
-	ClusterNameToAlias                         map[string]string // map between regex matching cluster name to a human friendly alias
-	DetectClusterAliasQuery                    string            // Optional query (executed on topology instance) that returns the alias of a cluster. Query will only be executed on cluster master (though until the topology's master is resovled it may execute on other/all replicas). If provided, must return one row, one column
-	DetectClusterDomainQuery                   string            // Optional query (executed on topology instance) that returns the VIP/CNAME/Alias/whatever domain name for the master of this cluster. Query will only be executed on cluster master (though until the topology's master is resovled it may execute on other/all replicas). If provided, must return one row, one column
-	DetectInstanceAliasQuery                   string            // Optional query (executed on topology instance) that returns the alias of an instance. If provided, must return one row, one column
-	DetectPromotionRuleQuery                   string            // Optional query (executed on topology instance) that returns the promotion rule of an instance. If provided, must return one row, one column.
-	DataCenterPattern                          string            // Regexp pattern with one group, extracting the datacenter name from the hostname
-	PhysicalEnvironmentPattern                 string            // Regexp pattern with one group, extracting physical environment info from hostname (e.g. combination of datacenter & prod/dev env)
-	DetectDataCenterQuery                      string            // Optional query (executed on topology instance) that returns the data center of an instance. If provided, must return one row, one column. Overrides DataCenterPattern and useful for installments where DC cannot be inferred by hostname
-	DetectPhysicalEnvironmentQuery             string            // Optional query (executed on topology instance) that returns the physical environment of an instance. If provided, must return one row, one column. Overrides PhysicalEnvironmentPattern and useful for installments where env cannot be inferred by hostname
-	DetectSemiSyncEnforcedQuery                string            // Optional query (executed on topology instance) to determine whether semi-sync is fully enforced for master writes (async fallback is not allowed under any circumstance). If provided, must return one row, one column, value 0 or 1.
-	SupportFuzzyPoolHostnames                  bool              // Should "submit-pool-instances" command be able to pass list of fuzzy instances (fuzzy means non-fqdn, but unique enough to recognize). Defaults 'true', implies more queries on backend db
-	InstancePoolExpiryMinutes                  uint              // Time after which entries in database_instance_pool are expired (resubmit via `submit-pool-instances`)
-	PromotionIgnoreHostnameFilters             []string          // Orchestrator will not promote replicas with hostname matching pattern (via -c recovery; for example, avoid promoting dev-dedicated machines)
-	ServeAgentsHttp                            bool              // Spawn another HTTP interface dedicated for orchestrator-agent
-	AgentsUseSSL                               bool              // When "true" orchestrator will listen on agents port with SSL as well as connect to agents via SSL
-	AgentsUseMutualTLS                         bool              // When "true" Use mutual TLS for the server to agent communication
-	AgentSSLSkipVerify                         bool              // When using SSL for the Agent, should we ignore SSL certification error
-	AgentSSLPrivateKeyFile                     string            // Name of Agent SSL private key file, applies only when AgentsUseSSL = true
-	AgentSSLCertFile                           string            // Name of Agent SSL certification file, applies only when AgentsUseSSL = true
-	AgentSSLCAFile                             string            // Name of the Agent Certificate Authority file, applies only when AgentsUseSSL = true
-	AgentSSLValidOUs                           []string          // Valid organizational units when using mutual TLS to communicate with the agents
-	UseSSL                                     bool              // Use SSL on the server web port
-	UseMutualTLS                               bool              // When "true" Use mutual TLS for the server's web and API connections
-	SSLSkipVerify                              bool              // When using SSL, should we ignore SSL certification error
-	SSLPrivateKeyFile                          string            // Name of SSL private key file, applies only when UseSSL = true
-	SSLCertFile                                string            // Name of SSL certification file, applies only when UseSSL = true
-	SSLCAFile                                  string            // Name of the Certificate Authority file, applies only when UseSSL = true
-	SSLValidOUs                                []string          // Valid organizational units when using mutual TLS
-	StatusEndpoint                             string            // Override the status endpoint.  Defaults to '/api/status'
-	StatusOUVerify                             bool              // If true, try to verify OUs when Mutual TLS is on.  Defaults to false
-	AgentPollMinutes                           uint              // Minutes between agent polling
-	UnseenAgentForgetHours                     uint              // Number of hours after which an unseen agent is forgotten
-	StaleSeedFailMinutes                       uint              // Number of minutes after which a stale (no progress) seed is considered failed.
-	SeedAcceptableBytesDiff                    int64             // Difference in bytes between seed source & target data size that is still considered as successful copy
-	SeedWaitSecondsBeforeSend                  int64             // Number of seconds for waiting before start send data command on agent
-	AutoPseudoGTID                             bool              // Should orchestrator automatically inject Pseudo-GTID entries to the masters
-	PseudoGTIDPattern                          string            // Pattern to look for in binary logs that makes for a unique entry (pseudo GTID). When empty, Pseudo-GTID based refactoring is disabled.
-	PseudoGTIDPatternIsFixedSubstring          bool              // If true, then PseudoGTIDPattern is not treated as regular expression but as fixed substring, and can boost search time
-	PseudoGTIDMonotonicHint                    string            // subtring in Pseudo-GTID entry which indicates Pseudo-GTID entries are expected to be monotonically increasing
-	DetectPseudoGTIDQuery                      string            // Optional query which is used to authoritatively decide whether pseudo gtid is enabled on instance
-	BinlogEventsChunkSize                      int               // Chunk size (X) for SHOW BINLOG|RELAYLOG EVENTS LIMIT ?,X statements. Smaller means less locking and mroe work to be done
-	SkipBinlogEventsContaining                 []string          // When scanning/comparing binlogs for Pseudo-GTID, skip entries containing given texts. These are NOT regular expressions (would consume too much CPU while scanning binlogs), just substrings to find.
-	ReduceReplicationAnalysisCount             bool              // When true, replication analysis will only report instances where possibility of handled problems is possible in the first place (e.g. will not report most leaf nodes, that are mostly uninteresting). When false, provides an entry for every known instance
-	FailureDetectionPeriodBlockMinutes         int               // The time for which an instance's failure discovery is kept "active", so as to avoid concurrent "discoveries" of the instance's failure; this preceeds any recovery process, if any.
-	RecoveryPeriodBlockMinutes                 int               // (supported for backwards compatibility but please use newer `RecoveryPeriodBlockSeconds` instead) The time for which an instance's recovery is kept "active", so as to avoid concurrent recoveries on smae instance as well as flapping
-	RecoveryPeriodBlockSeconds                 int               // (overrides `RecoveryPeriodBlockMinutes`) The time for which an instance's recovery is kept "active", so as to avoid concurrent recoveries on smae instance as well as flapping
-	RecoveryIgnoreHostnameFilters              []string          // Recovery analysis will completely ignore hosts matching given patterns
-	RecoverMasterClusterFilters                []string          // Only do master recovery on clusters matching these regexp patterns (of course the ".*" pattern matches everything)
-	RecoverIntermediateMasterClusterFilters    []string          // Only do IM recovery on clusters matching these regexp patterns (of course the ".*" pattern matches everything)
-	ProcessesShellCommand                      string            // Shell that executes command scripts
-	OnFailureDetectionProcesses                []string          // Processes to execute when detecting a failover scenario (before making a decision whether to failover or not). May and should use some of these placeholders: {failureType}, {failureDescription}, {command}, {failedHost}, {failureCluster}, {failureClusterAlias}, {failureClusterDomain}, {failedPort}, {successorHost}, {successorPort}, {successorAlias}, {countReplicas}, {replicaHosts}, {isDowntimed}, {autoMasterRecovery}, {autoIntermediateMasterRecovery}
-	PreGracefulTakeoverProcesses               []string          // Processes to execute before doing a failover (aborting operation should any once of them exits with non-zero code; order of execution undefined). May and should use some of these placeholders: {failureType}, {failureDescription}, {command}, {failedHost}, {failureCluster}, {failureClusterAlias}, {failureClusterDomain}, {failedPort}, {successorHost}, {successorPort}, {successorAlias}, {countReplicas}, {replicaHosts}, {isDowntimed}
-	PreFailoverProcesses                       []string          // Processes to execute before doing a failover (aborting operation should any once of them exits with non-zero code; order of execution undefined). May and should use some of these placeholders: {failureType}, {failureDescription}, {command}, {failedHost}, {failureCluster}, {failureClusterAlias}, {failureClusterDomain}, {failedPort}, {successorHost}, {successorPort}, {successorAlias}, {countReplicas}, {replicaHosts}, {isDowntimed}
-	PostFailoverProcesses                      []string          // Processes to execute after doing a failover (order of execution undefined). May and should use some of these placeholders: {failureType}, {failureDescription}, {command}, {failedHost}, {failureCluster}, {failureClusterAlias}, {failureClusterDomain}, {failedPort}, {successorHost}, {successorPort}, {successorAlias}, {countReplicas}, {replicaHosts}, {isDowntimed}, {isSuccessful}, {lostReplicas}
-	PostUnsuccessfulFailoverProcesses          []string          // Processes to execute after a not-completely-successful failover (order of execution undefined). May and should use some of these placeholders: {failureType}, {failureDescription}, {command}, {failedHost}, {failureCluster}, {failureClusterAlias}, {failureClusterDomain}, {failedPort}, {successorHost}, {successorPort}, {successorAlias}, {countReplicas}, {replicaHosts}, {isDowntimed}, {isSuccessful}, {lostReplicas}
-	PostMasterFailoverProcesses                []string          // Processes to execute after doing a master failover (order of execution undefined). Uses same placeholders as PostFailoverProcesses
-	PostIntermediateMasterFailoverProcesses    []string          // Processes to execute after doing a master failover (order of execution undefined). Uses same placeholders as PostFailoverProcesses
-	PostGracefulTakeoverProcesses              []string          // Processes to execute after runnign a graceful master takeover. Uses same placeholders as PostFailoverProcesses
-	CoMasterRecoveryMustPromoteOtherCoMaster   bool              // When 'false', anything can get promoted (and candidates are prefered over others). When 'true', orchestrator will promote the other co-master or else fail
-	DetachLostSlavesAfterMasterFailover        bool              // synonym to DetachLostReplicasAfterMasterFailover
-	DetachLostReplicasAfterMasterFailover      bool              // Should replicas that are not to be lost in master recovery (i.e. were more up-to-date than promoted replica) be forcibly detached
-	ApplyMySQLPromotionAfterMasterFailover     bool              // Should orchestrator take upon itself to apply MySQL master promotion: set read_only=0, detach replication, etc.
-	MasterFailoverLostInstancesDowntimeMinutes uint              // Number of minutes to downtime any server that was lost after a master failover (including failed master & lost replicas). 0 to disable
-	MasterFailoverDetachSlaveMasterHost        bool              // synonym to MasterFailoverDetachReplicaMasterHost
-	MasterFailoverDetachReplicaMasterHost      bool              // Should orchestrator issue a detach-replica-master-host on newly promoted master (this makes sure the new master will not attempt to replicate old master if that comes back to life). Defaults 'false'. Meaningless if ApplyMySQLPromotionAfterMasterFailover is 'true'.
-	FailMasterPromotionIfSQLThreadNotUpToDate  bool              // when true, and a master failover takes place, if candidate master has not consumed all relay logs, promotion is aborted with error
-	PostponeSlaveRecoveryOnLagMinutes          uint              // Synonym to PostponeReplicaRecoveryOnLagMinutes
-	PostponeReplicaRecoveryOnLagMinutes        uint              // On crash recovery, replicas that are lagging more than given minutes are only resurrected late in the recovery process, after master/IM has been elected and processes executed. Value of 0 disables this feature
-	RemoteSSHForMasterFailover                 bool              // Should orchestrator attempt a remote-ssh relaylog-synching upon master failover? Requires RemoteSSHCommand
-	RemoteSSHCommand                           string            // A `ssh` command to be used by recovery process to read/apply relaylogs. If provided, this variable must contain the text "{hostname}". The remote SSH login must have the privileges to read/write relay logs. Example: "setuidgid remoteuser ssh {hostname}"
-	RemoteSSHCommandUseSudo                    bool              // Should orchestrator apply 'sudo' on the remote host upon SSH command
-	OSCIgnoreHostnameFilters                   []string          // OSC replicas recommendation will ignore replica hostnames matching given patterns
-	GraphiteAddr                               string            // Optional; address of graphite port. If supplied, metrics will be written here
-	GraphitePath                               string            // Prefix for graphite path. May include {hostname} magic placeholder
-	GraphiteConvertHostnameDotsToUnderscores   bool              // If true, then hostname's dots are converted to underscores before being used in graphite path
-	GraphitePollSeconds                        int               // Graphite writes interval. 0 disables.
-	URLPrefix                                  string            // URL prefix to run orchestrator on non-root web path, e.g. /orchestrator to put it behind nginx.
-	DiscoveryIgnoreReplicaHostnameFilters      []string          // Regexp filters to apply to prevent auto-discovering new replicas. Usage: unreachable servers due to firewalls, applications which trigger binlog dumps
-	ConsulAddress                              string            // Address where Consul HTTP api is found. Example: 127.0.0.1:8500
-	ConsulAclToken                             string            // ACL token used to write to Consul KV
-	ZkAddress                                  string            // UNSUPPERTED YET. Address where (single or multiple) ZooKeeper servers are found, in `srv1[:port1][,srv2[:port2]...]` format. Default port is 2181. Example: srv-a,srv-b:12181,srv-c
-	KVClusterMasterPrefix                      string            // Prefix to use for clusters' masters entries in KV stores (internal, consul, ZK), default: "mysql/master"
+	HTTPAuthUser                               string                                                // Username for HTTP Basic authentication (blank disables authentication)
+	HTTPAuthPassword                           string                                                // Password for HTTP Basic authentication
+	AuthUserHeader                             string                                                // HTTP header indicating auth user, when AuthenticationMethod is "proxy"
+	PowerAuthUsers                             []string                                              // On AuthenticationMethod == "proxy", list of users that can make changes. All others are read-only.
+	PowerAuthGroups                            []string                                              // list of unix groups the authenticated user must be a member of to make changes.
+	Namespaces                                 map[string]NamespaceConfiguration                     // Multi tenancy. Key is namespace name. When non-empty, users only get to see and operate clusters within namespaces they are members of
+	AccessTokenUseExpirySeconds                uint                                                  // Time by which an issued token must be used
+	AccessTokenExpiryMinutes                   uint                                                  // Time after which HTTP access token expires
+	ClusterNameToAlias                         map[string]string                                     // map between regex matching cluster name to a human friendly alias
+	DetectClusterAliasQuery                    string                                                // Optional query (executed on topology instance) that returns the alias of a cluster. Query will only be executed on cluster master (though until the topology's master is resovled it may execute on other/all replicas). If provided, must return one row, one column
+	DetectClusterDomainQuery                   string                                                // Optional query (executed on topology instance) that returns the VIP/CNAME/Alias/whatever domain name for the master of this cluster. Query will only be executed on cluster master (though until the topology's master is resovled it may execute on other/all replicas). If provided, must return one row, one column
+	DetectInstanceAliasQuery                   string                                                // Optional query (executed on topology instance) that returns the alias of an instance. If provided, must return one row, one column
+	DetectPromotionRuleQuery                   string                                                // Optional query (executed on topology instance) that returns the promotion rule of an instance. If provided, must return one row, one column.
+	DataCenterPattern                          string                                                // Regexp pattern with one group, extracting the datacenter name from the hostname
+	PhysicalEnvironmentPattern                 string                                                // Regexp pattern with one group, extracting physical environment info from hostname (e.g. combination of datacenter & prod/dev env)
+	DetectDataCenterQuery                      string                                                // Optional query (executed on topology instance) that returns the data center of an instance. If provided, must return one row, one column. Overrides DataCenterPattern and useful for installments where DC cannot be inferred by hostname
+	DetectPhysicalEnvironmentQuery             string                                                // Optional query (executed on topology instance) that returns the physical environment of an instance. If provided, must return one row, one column. Overrides PhysicalEnvironmentPattern and useful for installments where env cannot be inferred by hostname
+	GroupingDimensions                         map[string]GroupingDimensionConfiguration             // Custom grouping dimensions of instances, beyond data center and physical environment, e.g. "rack", "cell", "shard". Key is dimension name
+	PromotionAntiAffinityDimensions            []string                                              // Grouping dimensions (see GroupingDimensions) in which a promoted replica should differ from the failed master, e.g. ["rack"]: replicas sharing the failed master's rack are replaced as promotion candidates where possible
+	DetectSemiSyncEnforcedQuery                string                                                // Optional query (executed on topology instance) to determine whether semi-sync is fully enforced for master writes (async fallback is not allowed under any circumstance). If provided, must return one row, one column, value 0 or 1.
+	MasterWriteProbeTable                      string                                                // Optional table (e.g. "meta.orchestrator_write_probe") onto which orchestrator writes a probe row upon polling a writable master, verifying the master accepts writes and that these replicate. Table must have `server_id` (primary key) and `probe_value` (bigint) columns. Empty value disables write probes.
+	SupportFuzzyPoolHostnames                  bool                                                  // Should "submit-pool-instances" command be able to pass list of fuzzy instances (fuzzy means non-fqdn, but unique enough to recognize). Defaults 'true', implies more queries on backend db
+	InstancePoolExpiryMinutes                  uint                                                  // Time after which entries in database_instance_pool are expired (resubmit via `submit-pool-instances`)
+	PromotionIgnoreHostnameFilters             []string                                              // Orchestrator will not promote replicas with hostname matching pattern (via -c recovery; for example, avoid promoting dev-dedicated machines)
+	PromotionMinDiskFreePercent                uint                                                  // When > 0, orchestrator will not promote replicas whose host reports (via orchestrator-agent) less free disk space, in percent, on the MySQL datadir
+	PromotionVetoQuery                         string                                                // Optional query (executed on a promotion candidate, when about to regroup or promote) whose non-empty result vetoes promotion of the candidate. The first column of the first row is the veto reason. A failing query does not veto
+	PromotionStrategies                        map[string]string                                     // Promotion strategy per cluster, applied on dead master recovery: "classic", "gtid-first", "binlog-server-aware", or a custom registered strategy. Key is cluster name or cluster alias, or "*" to apply to all clusters. Default: "classic"
+	PromotionPools                             map[string]PromotionPoolsConfiguration                // Pool-aware promotion preference per cluster. Key is cluster name or cluster alias, or "*" to apply to all clusters. Most specific key applies.
+	ServeAgentsHttp                            bool                                                  // Spawn another HTTP interface dedicated for orchestrator-agent
+	AgentsUseSSL                               bool                                                  // When "true" orchestrator will listen on agents port with SSL as well as connect to agents via SSL
+	AgentsUseMutualTLS                         bool                                                  // When "true" Use mutual TLS for the server to agent communication
+	AgentSSLSkipVerify                         bool                                                  // When using SSL for the Agent, should we ignore SSL certification error
+	AgentSSLPrivateKeyFile                     string                                                // Name of Agent SSL private key file, applies only when AgentsUseSSL = true
+	AgentSSLCertFile                           string                                                // Name of Agent SSL certification file, applies only when AgentsUseSSL = true
+	AgentSSLCAFile                             string                                                // Name of the Agent Certificate Authority file, applies only when AgentsUseSSL = true
+	AgentSSLValidOUs                           []string                                              // Valid organizational units when using mutual TLS to communicate with the agents
+	AgentEnrollmentCACertFile                  string                                                // Certificate of the Certificate Authority by which orchestrator issues agent certificates upon enrollment. Enables agent enrollment
+	AgentEnrollmentCAKeyFile                   string                                                // Private key of the agent enrollment Certificate Authority
+	AgentEnrollmentTokenExpiryMinutes          uint                                                  // Minutes after which an unused agent enrollment token expires
+	AgentCertificateValidityHours              uint                                                  // Validity of agent certificates issued upon enrollment or renewal
+	UseSSL                                     bool                                                  // Use SSL on the server web port
+	UseMutualTLS                               bool                                                  // When "true" Use mutual TLS for the server's web and API connections
+	SSLSkipVerify                              bool                                                  // When using SSL, should we ignore SSL certification error
+	SSLPrivateKeyFile                          string                                                // Name of SSL private key file, applies only when UseSSL = true
+	SSLCertFile                                string                                                // Name of SSL certification file, applies only when UseSSL = true
+	SSLCAFile                                  string                                                // Name of the Certificate Authority file, applies only when UseSSL = true
+	SSLValidOUs                                []string                                              // Valid organizational units when using mutual TLS
+	StatusEndpoint                             string                                                // Override the status endpoint.  Defaults to '/api/status'
+	StatusOUVerify                             bool                                                  // If true, try to verify OUs when Mutual TLS is on.  Defaults to false
+	AgentPollMinutes                           uint                                                  // Minutes between agent polling
+	UnseenAgentForgetHours                     uint                                                  // Number of hours after which an unseen agent is forgotten
+	AgentPseudoGTIDSearchCommand               string                                                // orchestrator-agent API call, e.g. provided by an agent extension, which searches an instance's binary logs for a Pseudo-GTID entry locally on its host. When non-empty, Pseudo-GTID entries are searched via agents, where available, before being scanned over the MySQL protocol
+	ErrorLogPatterns                           map[string]ErrorLogPatternConfiguration               // MySQL error log lines to alert on, e.g. "innodb-corruption", "semisync-timeout". Error logs are tailed via orchestrator-agent. Key is pattern name
+	ErrorLogPollSeconds                        uint                                                  // Seconds between tailing the MySQL error logs of agents' hosts, when ErrorLogPatterns are configured
+	ErrorLogProblemSeconds                     uint                                                  // Seconds for which a line matching a problem pattern (see ErrorLogPatterns) keeps its instance listed as a problem
+	DecommissionForgetAfterMinutes             uint                                                  // Minutes after which a decommissioned instance is forgotten. Until then, a decommission may be canceled
+	StaleSeedFailMinutes                       uint                                                  // Number of minutes after which a stale (no progress) seed is considered failed.
+	SeedDonorMinHealthyPoolInstances           uint                                                  // When automatically selecting a seed donor, avoid replicas whose pool would be left with fewer healthy instances than this
+	SeedAcceptableBytesDiff                    int64                                                 // Difference in bytes between seed source & target data size that is still considered as successful copy
+	SeedWaitSecondsBeforeSend                  int64                                                 // Number of seconds for waiting before start send data command on agent
+	BackupTimeoutMinutes                       uint                                                  // Number of minutes after which an incomplete agent backup is considered failed
+	AutoPseudoGTID                             bool                                                  // Should orchestrator automatically inject Pseudo-GTID entries to the masters
+	PseudoGTIDPattern                          string                                                // Pattern to look for in binary logs that makes for a unique entry (pseudo GTID). When empty, Pseudo-GTID based refactoring is disabled.
+	PseudoGTIDPatternIsFixedSubstring          bool                                                  // If true, then PseudoGTIDPattern is not treated as regular expression but as fixed substring, and can boost search time
+	PseudoGTIDMonotonicHint                    string                                                // subtring in Pseudo-GTID entry which indicates Pseudo-GTID entries are expected to be monotonically increasing
+	DetectPseudoGTIDQuery                      string                                                // Optional query which is used to authoritatively decide whether pseudo gtid is enabled on instance
+	BinlogEventsChunkSize                      int                                                   // Chunk size (X) for SHOW BINLOG|RELAYLOG EVENTS LIMIT ?,X statements. Smaller means less locking and mroe work to be done
+	SkipBinlogEventsContaining                 []string                                              // When scanning/comparing binlogs for Pseudo-GTID, skip entries containing given texts. These are NOT regular expressions (would consume too much CPU while scanning binlogs), just substrings to find.
+	ReduceReplicationAnalysisCount             bool                                                  // When true, replication analysis will only report instances where possibility of handled problems is possible in the first place (e.g. will not report most leaf nodes, that are mostly uninteresting). When false, provides an entry for every known instance
+	FailureDetectionPeriodBlockMinutes         int                                                   // The time for which an instance's failure discovery is kept "active", so as to avoid concurrent "discoveries" of the instance's failure; this preceeds any recovery process, if any.
+	RecoveryPeriodBlockMinutes                 int                                                   // (supported for backwards compatibility but please use newer `RecoveryPeriodBlockSeconds` instead) The time for which an instance's recovery is kept "active", so as to avoid concurrent recoveries on smae instance as well as flapping
+	RecoveryPeriodBlockSeconds                 int                                                   // (overrides `RecoveryPeriodBlockMinutes`) The time for which an instance's recovery is kept "active", so as to avoid concurrent recoveries on smae instance as well as flapping
+	RecoveryThrottlePeriodSeconds              int                                                   // Period over which recoveries are counted towards RecoveryThrottleMaxRecoveries and RecoveryThrottleMaxRecoveriesPerDC
+	RecoveryThrottleMaxRecoveries              int                                                   // When positive, max number of recoveries (across all clusters) within RecoveryThrottlePeriodSeconds, beyond which automated recoveries are blocked and require manual recovery
+	RecoveryThrottleMaxRecoveriesPerDC         int                                                   // When positive, max number of recoveries of failed instances in same data center within RecoveryThrottlePeriodSeconds, beyond which automated recoveries in that data center are blocked and require manual recovery
+	ExternalHealthCheckURLs                    []string                                              // URLs of external health sources (e.g. host monitoring), consulted on suspected master failure. May use {host} and {port} placeholders. A 2xx response reports the host as healthy; any other response reports it as unhealthy
+	ExternalHealthCheckTimeoutSeconds          int                                                   // Timeout for querying an external health source. Recovery waits on the sources, hence this must be within [1, 30]
+	RequireExternalHealthConfirmation          bool                                                  // When true, automated master recovery only proceeds once external health sources confirm the failure: at least one reports the master unhealthy, and none reports it healthy
+	RecoveryIgnoreHostnameFilters              []string                                              // Recovery analysis will completely ignore hosts matching given patterns
+	RecoverMasterClusterFilters                []string                                              // Only do master recovery on clusters matching these regexp patterns (of course the ".*" pattern matches everything)
+	RecoverIntermediateMasterClusterFilters    []string                                              // Only do IM recovery on clusters matching these regexp patterns (of course the ".*" pattern matches everything)
+	RecoveryAutomationLevels                   map[string]map[string]string                          // Automation level per failure class ("master", "intermediate-master") per cluster: "auto", "approve" (recovery awaits approval via API) or "never". Key is cluster name or cluster alias, or "*" to apply to all clusters. Failure classes not listed follow RecoverMasterClusterFilters and RecoverIntermediateMasterClusterFilters
+	RecoveryApprovalTimeoutSeconds             uint                                                  // Time within which a recovery requiring approval must be approved, and for which an approval then remains valid
+	RecoveryStatsRetentionDays                 uint                                                  // Days for which recovery timings (detection, decision and promotion latencies) are kept for recovery statistics. Independent of AuditPurgeDays
+	DataLossSampleMaxEvents                    uint                                                  // Max number of binary log events of a failed master read to find the schemas and tables affected by estimated data loss in a master recovery. 0 disables sampling
+	PreElectPromotionCandidates                bool                                                  // When true, orchestrator continuously pre-elects a promotion candidate per cluster, by which a master failover decides on promotion faster
+	NoPromotionCandidateProcesses              []string                                              // Processes to execute when a cluster is found to have no viable promotion candidate (requires PreElectPromotionCandidates). May use placeholders: {clusterName}, {clusterAlias}, {masterHost}, {masterPort}, {reason}
+	ProcessesShellCommand                      string                                                // Shell that executes command scripts
+	OnDualWritableMastersProcesses             []string                                              // Processes to execute when a cluster is detected to have more than one writable server (once per detection). Uses same placeholders as OnFailureDetectionProcesses
+	OnFailureDetectionProcesses                []string                                              // Processes to execute when detecting a failover scenario (before making a decision whether to failover or not). May and should use some of these placeholders: {failureType}, {failureDescription}, {command}, {failedHost}, {failureCluster}, {failureClusterAlias}, {failureClusterDomain}, {failedPort}, {successorHost}, {successorPort}, {successorAlias}, {countReplicas}, {replicaHosts}, {isDowntimed}, {autoMasterRecovery}, {autoIntermediateMasterRecovery}
+	PreGracefulTakeoverProcesses               []string                                              // Processes to execute before doing a failover (aborting operation should any once of them exits with non-zero code; order of execution undefined). May and should use some of these placeholders: {failureType}, {failureDescription}, {command}, {failedHost}, {failureCluster}, {failureClusterAlias}, {failureClusterDomain}, {failedPort}, {successorHost}, {successorPort}, {successorAlias}, {countReplicas}, {replicaHosts}, {isDowntimed}
+	PreFailoverProcesses                       []string                                              // Processes to execute before doing a failover (aborting operation should any once of them exits with non-zero code; order of execution undefined). May and should use some of these placeholders: {failureType}, {failureDescription}, {command}, {failedHost}, {failureCluster}, {failureClusterAlias}, {failureClusterDomain}, {failedPort}, {successorHost}, {successorPort}, {successorAlias}, {countReplicas}, {replicaHosts}, {isDowntimed}
+	PostFailoverProcesses                      []string                                              // Processes to execute after doing a failover (order of execution undefined). May and should use some of these placeholders: {failureType}, {failureDescription}, {command}, {failedHost}, {failureCluster}, {failureClusterAlias}, {failureClusterDomain}, {failedPort}, {successorHost}, {successorPort}, {successorAlias}, {countReplicas}, {replicaHosts}, {isDowntimed}, {isSuccessful}, {lostReplicas}
+	PostUnsuccessfulFailoverProcesses          []string                                              // Processes to execute after a not-completely-successful failover (order of execution undefined). May and should use some of these placeholders: {failureType}, {failureDescription}, {command}, {failedHost}, {failureCluster}, {failureClusterAlias}, {failureClusterDomain}, {failedPort}, {successorHost}, {successorPort}, {successorAlias}, {countReplicas}, {replicaHosts}, {isDowntimed}, {isSuccessful}, {lostReplicas}
+	PostMasterFailoverProcesses                []string                                              // Processes to execute after doing a master failover (order of execution undefined). Uses same placeholders as PostFailoverProcesses
+	PostPoolMembershipChangeProcesses          []string                                              // Processes to execute when orchestrator changes membership of a managed pool. May and should use some of these placeholders: {clusterName}, {clusterAlias}, {pool}, {poolInstances}, {addedInstances}, {removedInstances}
+	PostDecommissionProcesses                  []string                                              // Processes to execute when an instance is decommissioned. May and should use some of these placeholders: {host}, {port}, {clusterName}, {clusterAlias}, {owner}, {reason}, {forgetAt}
+	PostIntermediateMasterFailoverProcesses    []string                                              // Processes to execute after doing a master failover (order of execution undefined). Uses same placeholders as PostFailoverProcesses
+	PostGracefulTakeoverProcesses              []string                                              // Processes to execute after runnign a graceful master takeover. Uses same placeholders as PostFailoverProcesses
+	PinnedMasterRecoveryProcesses              []string                                              // Processes to execute when an automated master recovery withholds promotion of a replica other than the cluster's pinned master, and human action is required. Uses same placeholders as PostFailoverProcesses
+	HookActions                                map[string]HookAction                                 // Built-in hook actions by name, which hooks lists refer to as "action:<name>". These run with no shell, e.g. in minimal container images
+	HooksConfiguration                         map[string]HookConfiguration                          // Per hook execution settings. Key is a hooks list name (e.g. "PostFailoverProcesses"), or list name followed by ":<n>" to address the n-th (1-based) hook in that list, or "*" to apply to all hooks. Most specific key applies.
+	GracefulTakeoverTransactionsChecks         map[string]GracefulTakeoverTransactionsConfiguration  // Per cluster checks for blocking transactions prior to demoting master on graceful takeover. Key is cluster name or cluster alias, or "*" to apply to all clusters. Most specific key applies.
+	GracefulTakeoverReplicaQuorums             map[string]GracefulTakeoverReplicaQuorumConfiguration // Per cluster quorum of healthy replicas verified prior to graceful takeover; the takeover aborts with a report when not met, unless forced. Key is cluster name or cluster alias, or "*" to apply to all clusters. Most specific key applies.
+	GracefulTakeoverCatchUpTimeoutSeconds      uint                                                  // With graceful-master-takeover --when-caught-up: max time to wait for a lagging designated replica to catch up before taking over
+	ActiveRecoveryWaitTimeoutSeconds           uint                                                  // Max time a manual recovery command waits for an in-flight recovery it joins or aborts (see --active-recovery)
+	DetectionProfiles                          map[string]string                                     // Failure detection sensitivity per cluster: "aggressive", "normal" or "conservative". Key is cluster name or cluster alias, or "*" to apply to all clusters. Clusters with no profile are "normal"
+	DesiredTopologies                          map[string]string                                     // Desired topology shape per cluster: "flat" (all replicas directly under master) or "intermediate-master-per-dc". Key is cluster name or cluster alias, or "*" to apply to all clusters. Shapes declared via API take precedence.
+	DesiredTopologyAutoConverge                bool                                                  // When true, orchestrator relocates replicas to converge drifting clusters onto their desired topology
+	MasterFanOutMaxReplicas                    uint                                                  // When positive, a master with more direct replicas exceeds its fan-out, which may be reduced by electing an intermediate master per data center and relocating its siblings below it. 0 disables
+	MasterFanOutAutoReduceClusterFilters       []string                                              // Clusters (by name, alias, "alias=...", "alias~=..." or "*") whose exceeding master fan-out orchestrator reduces automatically. Other clusters are reported, and may be reduced manually
+	ReadOnlyEnforcement                        map[string]string                                     // read_only enforcement per cluster: "enforce" has orchestrator keep all replicas read_only (and super_read_only, with UseSuperReadOnly), fixing their drift, while a read-only master is only reported; "alert" only reports drift. Key is cluster name or cluster alias, or "*" to apply to all clusters. Clusters with no entry are not checked
+	OnReadOnlyDriftProcesses                   []string                                              // Processes to execute when read_only drift is found on a cluster subject to ReadOnlyEnforcement (once per drift). May use placeholders: {clusterName}, {clusterAlias}, {driftHost}, {driftPort}, {driftType}, {driftFixed}, {enforcementMode}
+	SafeRelocationVerificationSeconds          uint                                                  // In safe mode, time within which a relocated replica must be replicating with lag decreasing (or below ReasonableReplicationLagSeconds), after which the relocation is rolled back
+	LagSLOs                                    map[string]LagSLOConfiguration                        // Replication lag SLO per cluster. Key is cluster name or cluster alias, or "*" to apply to all clusters. Most specific key applies.
+	LagSLOBurnProcesses                        []string                                              // Processes to execute when a cluster's lag SLO error budget burn rate crosses one of its BurnRateThresholds. May use placeholders: {clusterName}, {clusterAlias}, {burnRate}, {burnRateThreshold}, {compliance}, {targetRatio}
+	CoMasterRecoveryMustPromoteOtherCoMaster   bool                                                  // When 'false', anything can get promoted (and candidates are prefered over others). When 'true', orchestrator will promote the other co-master or else fail
+	DetachLostSlavesAfterMasterFailover        bool                                                  // synonym to DetachLostReplicasAfterMasterFailover
+	DetachLostReplicasAfterMasterFailover      bool                                                  // Should replicas that are not to be lost in master recovery (i.e. were more up-to-date than promoted replica) be forcibly detached
+	ApplyMySQLPromotionAfterMasterFailover     bool                                                  // Should orchestrator take upon itself to apply MySQL master promotion: set read_only=0, detach replication, etc.
+	MasterFailoverLostInstancesDowntimeMinutes uint                                                  // Number of minutes to downtime any server that was lost after a master failover (including failed master & lost replicas). 0 to disable
+	DowntimeInheritance                        bool                                                  // When true, downtiming an intermediate master also downtimes its replica subtree, and ending its downtime ends theirs. Default: false
+	MasterFailoverDetachSlaveMasterHost        bool                                                  // synonym to MasterFailoverDetachReplicaMasterHost
+	MasterFailoverDetachReplicaMasterHost      bool                                                  // Should orchestrator issue a detach-replica-master-host on newly promoted master (this makes sure the new master will not attempt to replicate old master if that comes back to life). Defaults 'false'. Meaningless if ApplyMySQLPromotionAfterMasterFailover is 'true'.
+	DeadMasterPostmortemWindowSeconds          uint                                                  // When a failed master is found reachable within this many seconds of its recovery, forensic data is captured from it onto the recovery's bundle. 0 to disable
+	FailMasterPromotionIfSQLThreadNotUpToDate  bool                                                  // when true, and a master failover takes place, if candidate master has not consumed all relay logs, promotion is aborted with error
+	PostponeSlaveRecoveryOnLagMinutes          uint                                                  // Synonym to PostponeReplicaRecoveryOnLagMinutes
+	PostponeReplicaRecoveryOnLagMinutes        uint                                                  // On crash recovery, replicas that are lagging more than given minutes are only resurrected late in the recovery process, after master/IM has been elected and processes executed. Value of 0 disables this feature
+	RemoteSSHForMasterFailover                 bool                                                  // Should orchestrator attempt a remote-ssh relaylog-synching upon master failover? Requires RemoteSSHCommand
+	RemoteSSHCommand                           string                                                // A `ssh` command to be used by recovery process to read/apply relaylogs. If provided, this variable must contain the text "{hostname}". The remote SSH login must have the privileges to read/write relay logs. Example: "setuidgid remoteuser ssh {hostname}"
+	RemoteSSHCommandUseSudo                    bool                                                  // Should orchestrator apply 'sudo' on the remote host upon SSH command
+	OSCIgnoreHostnameFilters                   []string                                              // OSC replicas recommendation will ignore replica hostnames matching given patterns
+	GraphiteAddr                               string                                                // Optional; address of graphite port. If supplied, metrics will be written here
+	GraphitePath                               string                                                // Prefix for graphite path. May include {hostname} magic placeholder
+	GraphiteConvertHostnameDotsToUnderscores   bool                                                  // If true, then hostname's dots are converted to underscores before being used in graphite path
+	GraphitePollSeconds                        int                                                   // Graphite writes interval. 0 disables.
+	URLPrefix                                  string                                                // URL prefix to run orchestrator on non-root web path, e.g. /orchestrator to put it behind nginx.
+	HTTPCacheControlMaxAgeSeconds              uint                                                  // max-age of Cache-Control header on ETag-tagged API responses (topologies, instance lists, audits). 0 means clients must revalidate on each request
+	DiscoveryIgnoreReplicaHostnameFilters      []string                                              // Regexp filters to apply to prevent auto-discovering new replicas. Usage: unreachable servers due to firewalls, applications which trigger binlog dumps
+	ConsulAddress                              string                                                // Address where Consul HTTP api is found. Example: 127.0.0.1:8500
+	ConsulAclToken                             string                                                // ACL token used to write to Consul KV
+	ZkAddress                                  string                                                // UNSUPPERTED YET. Address where (single or multiple) ZooKeeper servers are found, in `srv1[:port1][,srv2[:port2]...]` format. Default port is 2181. Example: srv-a,srv-b:12181,srv-c
+	KVClusterMasterPrefix                      string                                                // Prefix to use for clusters' masters entries in KV stores (internal, consul, ZK), default: "mysql/master"
+	KVClusterMasterTemplates                   map[string][]KVMasterEntryTemplate                    // Templated master entries per cluster, replacing the KVClusterMasterPrefix entries. All of a cluster's entries are written upon failover. Key is cluster alias, or "*" to apply to all clusters. Most specific key applies.
+	KVPoolPrefix                               string                                                // Prefix to use for managed pools' membership entries in KV stores (internal, consul, ZK), e.g. "mysql/pool". Empty value disables
+	KVDecommissionPrefix                       string                                                // Prefix to use for decommissioned instances' entries in KV stores (internal, consul, ZK), e.g. "mysql/decommission". Empty value disables
+	ReconcileMasterServiceRecords              bool                                                  // When true, the leader periodically compares the clusters' master entries in KV stores, and the record of ReconcileMasterDNSHookAction, against the clusters' actual masters
+	ReconcileMasterServiceRecordsSelfHeal      bool                                                  // When true, master entries found diverging from the cluster's actual master are rewritten
+	ReconcileMasterDNSHookAction               string                                                // Optional; name of a "dns" hook action (see HookActions) publishing clusters' masters in DNS, whose record is reconciled along with KV stores
+	KafkaRESTProxyURL                          string                                                // Optional; URL of a Kafka REST Proxy, e.g. http://kafka-rest:8082. If supplied, state change events (instance discovered/forgotten, lag threshold crossed, analysis raised/cleared, recovery lifecycle) are published to Kafka, keyed by cluster name
+	KafkaTopics                                map[string]string                                     // Kafka topic per state change event type (e.g. "analysis-raised"). Key "*" applies to all event types. Default: {"*": "orchestrator-events"}
+	KafkaRequestTimeoutSeconds                 uint                                                  // Timeout for publishing events to the Kafka REST Proxy
+	StateEventsRetentionHours                  uint                                                  // Hours for which state change events not yet published to Kafka are kept, after which they are purged
+	SMTPHost                                   string                                                // Optional; SMTP server through which email notifications are sent. If supplied, recipients per EmailRecipients are notified of recoveries and failure detections
+	SMTPPort                                   uint                                                  // Port of SMTP server. STARTTLS is used where the server supports it
+	SMTPUser                                   string                                                // Optional; user for SMTP (PLAIN) authentication
+	SMTPPassword                               string                                                // Password for SMTP authentication
+	EmailFromAddress                           string                                                // Sender address of email notifications, e.g. "orchestrator@example.com". Required with SMTPHost
+	EmailRecipients                            map[string][]string                                   // Email notification recipients per cluster, by cluster name or alias; "*" applies to all other clusters
+	EmailAnalysisCodes                         []string                                              // Analysis codes (e.g. "DeadMaster") whose failure detection is notified by email. Empty value notifies of all failure detections
+	EmailDigestHour                            int                                                   // Hour of day (0-23, local time) at which a daily digest of problems, expiring downtimes and unacknowledged recoveries is emailed. -1 (default) disables the digest
+	EmailTemplatesDirectory                    string                                                // Optional; directory with templates overriding the built-in email templates: recovery.tmpl, failure-detection.tmpl, digest.tmpl. Each defines "subject" and "body" templates
+	FederationDeploymentName                   string                                                // Name of this deployment in the federation view. Defaults to this host's name
+	FederationPeers                            map[string]string                                     // Peer orchestrator deployments presented in the federation view: deployment name to API base URL, e.g. {"eu": "https://orchestrator-eu.example.com"}
+	FederationAPIToken                         string                                                // Optional; API token presented to federation peers as "Authorization: Bearer". When empty, HTTPAuthUser and HTTPAuthPassword are presented under basic authentication
+	FederationRequestTimeoutSeconds            uint                                                  // Timeout for requests made to federation peers
 }
 
 // ToJSONString will marshal this configuration as JSON
@@ -273,18 +609,26 @@ func newConfiguration() *Configuration {
 		ListenAddress:                              ":3000",
 		ListenSocket:                               "",
 		HTTPAdvertise:                              "",
+		ShutdownDrainTimeoutSeconds:                60,
 		AgentsServerPort:                           ":3001",
+		ConfigEncryptionKeyEnvVariable:             "",
+		ConfigEncryptionKeyFile:                    "",
+		ConfigEncryptionKeyCommand:                 "",
 		StatusEndpoint:                             "/api/status",
 		StatusOUVerify:                             false,
 		BackendDB:                                  "mysql",
 		SQLite3DataFile:                            "",
 		SkipOrchestratorDatabaseUpdate:             false,
 		PanicIfDifferentDatabaseDeploy:             false,
+		AllowIncompatibleBackendSchema:             false,
 		RaftBind:                                   "127.0.0.1:10008",
 		RaftAdvertise:                              "",
 		RaftDataDir:                                "",
 		DefaultRaftPort:                            10008,
 		RaftNodes:                                  []string{},
+		RaftFollowerMaxAppliedIndexLag:             100,
+		LeaderLeaseElection:                        false,
+		LeaderLeaseSeconds:                         10,
 		ExpectFailureAnalysisConcensus:             true,
 		MySQLOrchestratorMaxPoolConnections:        128, // limit concurrent conns to backend DB
 		MySQLOrchestratorPort:                      3306,
@@ -293,29 +637,75 @@ func newConfiguration() *Configuration {
 		MySQLOrchestratorUseMutualTLS:              false,
 		MySQLConnectTimeoutSeconds:                 2,
 		MySQLOrchestratorReadTimeoutSeconds:        30,
+		MySQLOrchestratorHosts:                     []string{},
+		BackendHealthCheckIntervalSeconds:          5,
+		BackendSelfMonitoring:                      false,
+		BackendSelfAutoRecovery:                    false,
+		BackendRecoveryRelayLogTimeoutSeconds:      60,
 		MySQLDiscoveryReadTimeoutSeconds:           10,
 		MySQLTopologyReadTimeoutSeconds:            600,
 		DefaultInstancePort:                        3306,
 		TLSCacheTTLFactor:                          100,
 		InstancePollSeconds:                        5,
+		InstanceCacheTTLSeconds:                    0,
+		InstanceFlagRelaxedPollSeconds:             60,
 		InstanceWriteBufferSize:                    100,
 		BufferInstanceWrites:                       false,
 		InstanceFlushIntervalMilliseconds:          100,
 		SkipMaxScaleCheck:                          false,
 		UnseenInstanceForgetHours:                  240,
 		SnapshotTopologiesIntervalHours:            0,
+		BinlogCheckpointIntervalSeconds:            0,
+		AnalysisHistoryRetentionHours:              0,
+		AnalysisHistoryMaxRows:                     100000,
+		AnalysisRaiseCycles:                        1,
+		AnalysisClearCycles:                        1,
+		AnalysisHysteresisOverrides:                make(map[string]AnalysisHysteresis),
+		NotificationDeduplicationSeconds:           0,
 		DiscoverByShowSlaveHosts:                   false,
+		UnreconciledReplicasAutoDiscover:           false,
+		LightweightProbes:                          false,
+		LightweightProbesFullProbeSeconds:          0,
+		ProcesslistSampling:                        false,
+		ProcesslistSampleMaxRows:                   20,
+		ProcesslistLongApplierTrxSeconds:           300,
+		ProcesslistMasterActiveThreadsThreshold:    200,
 		UseSuperReadOnly:                           false,
 		DiscoveryMaxConcurrency:                    300,
 		DiscoveryQueueCapacity:                     100000,
 		DiscoveryQueueMaxStatisticsSize:            120,
 		DiscoveryCollectionRetentionSeconds:        120,
+		DiscoveryMetricsStorage:                    "",
+		DiscoveryMetricsStorageFile:                "",
+		DiscoveryMetricsStorageRetentionHours:      24,
+		DiscoveryMetricsStorageMaxRows:             1000000,
+		DiscoveryMetricsReadLimit:                  100000,
+		SlowAPIRequestThresholdMilliseconds:        5000,
+		DiscoveryBackpressureQueueRatio:            0,
+		DiscoveryBackpressureBackendSeconds:        0,
+		DiscoveryAutoTune:                          false,
+		DiscoveryMaxStalenessSeconds:               0,
+		DiscoveryAutoTuneBackendWriteSeconds:       1,
+		DiscoverySheddingPools:                     []string{},
+		DiscoverySheddingPollSeconds:               300,
+		DiscoveryOutlierSigma:                      0,
+		SlowDiscoveryOutlierProcesses:              []string{},
+		TopologyPrivilegesCheckIntervalMinutes:     0,
+		ReducedPrivilegesMode:                      false,
 		InstanceBulkOperationsWaitTimeoutSeconds:   10,
 		HostnameResolveMethod:                      "default",
 		MySQLHostnameResolveMethod:                 "@@hostname",
+		PreferIPv6:                                 false,
+		TopologyTunnels:                            make(map[string]string),
 		SkipBinlogServerUnresolveCheck:             true,
 		ExpiryHostnameResolvesMinutes:              60,
 		RejectHostnameResolvePattern:               "",
+		HostnameRewriteRules:                       []HostnameRewriteRule{},
+		HostnameResolveStaticMap:                   make(map[string]string),
+		HostnameResolveHostsFile:                   "",
+		HostnameResolveDNSServers:                  []string{},
+		InstanceKeyNormalizationRules:              []InstanceKeyNormalizationRule{},
+		InstanceKeyNormalizer:                      "",
 		ReasonableReplicationLagSeconds:            10,
 		ProblemIgnoreHostnameFilters:               []string{},
 		VerifyReplicationFilters:                   false,
@@ -332,6 +722,7 @@ func newConfiguration() *Configuration {
 		AuthUserHeader:                             "X-Forwarded-User",
 		PowerAuthUsers:                             []string{"*"},
 		PowerAuthGroups:                            []string{},
+		Namespaces:                                 make(map[string]NamespaceConfiguration),
 		AccessTokenUseExpirySeconds:                60,
 		AccessTokenExpiryMinutes:                   1440,
 		ClusterNameToAlias:                         make(map[string]string),
@@ -343,14 +734,25 @@ func newConfiguration() *Configuration {
 		PhysicalEnvironmentPattern:                 "",
 		DetectDataCenterQuery:                      "",
 		DetectPhysicalEnvironmentQuery:             "",
+		GroupingDimensions:                         make(map[string]GroupingDimensionConfiguration),
+		PromotionAntiAffinityDimensions:            []string{},
 		DetectSemiSyncEnforcedQuery:                "",
+		MasterWriteProbeTable:                      "",
 		SupportFuzzyPoolHostnames:                  true,
 		InstancePoolExpiryMinutes:                  60,
 		PromotionIgnoreHostnameFilters:             []string{},
+		PromotionMinDiskFreePercent:                0,
+		PromotionVetoQuery:                         "",
+		PromotionStrategies:                        make(map[string]string),
+		PromotionPools:                             make(map[string]PromotionPoolsConfiguration),
 		ServeAgentsHttp:                            false,
 		AgentsUseSSL:                               false,
 		AgentsUseMutualTLS:                         false,
 		AgentSSLValidOUs:                           []string{},
+		AgentEnrollmentCACertFile:                  "",
+		AgentEnrollmentCAKeyFile:                   "",
+		AgentEnrollmentTokenExpiryMinutes:          60,
+		AgentCertificateValidityHours:              24 * 30,
 		AgentSSLSkipVerify:                         false,
 		AgentSSLPrivateKeyFile:                     "",
 		AgentSSLCertFile:                           "",
@@ -364,9 +766,16 @@ func newConfiguration() *Configuration {
 		SSLCAFile:                                  "",
 		AgentPollMinutes:                           60,
 		UnseenAgentForgetHours:                     6,
+		AgentPseudoGTIDSearchCommand:               "",
+		ErrorLogPatterns:                           make(map[string]ErrorLogPatternConfiguration),
+		ErrorLogPollSeconds:                        60,
+		ErrorLogProblemSeconds:                     3600,
+		DecommissionForgetAfterMinutes:             1440,
 		StaleSeedFailMinutes:                       60,
+		SeedDonorMinHealthyPoolInstances:           2,
 		SeedAcceptableBytesDiff:                    8192,
 		SeedWaitSecondsBeforeSend:                  2,
+		BackupTimeoutMinutes:                       720,
 		AutoPseudoGTID:                             false,
 		PseudoGTIDPattern:                          "",
 		PseudoGTIDPatternIsFixedSubstring:          false,
@@ -378,22 +787,57 @@ func newConfiguration() *Configuration {
 		FailureDetectionPeriodBlockMinutes:         60,
 		RecoveryPeriodBlockMinutes:                 60,
 		RecoveryPeriodBlockSeconds:                 3600,
+		RecoveryThrottlePeriodSeconds:              600,
+		RecoveryThrottleMaxRecoveries:              0,
+		RecoveryThrottleMaxRecoveriesPerDC:         0,
+		ExternalHealthCheckURLs:                    []string{},
+		ExternalHealthCheckTimeoutSeconds:          5,
+		RequireExternalHealthConfirmation:          false,
 		RecoveryIgnoreHostnameFilters:              []string{},
 		RecoverMasterClusterFilters:                []string{},
 		RecoverIntermediateMasterClusterFilters:    []string{},
+		RecoveryAutomationLevels:                   make(map[string]map[string]string),
+		RecoveryApprovalTimeoutSeconds:             300,
+		RecoveryStatsRetentionDays:                 90,
+		DataLossSampleMaxEvents:                    10000,
+		PreElectPromotionCandidates:                false,
+		NoPromotionCandidateProcesses:              []string{},
 		ProcessesShellCommand:                      "bash",
+		OnDualWritableMastersProcesses:             []string{},
 		OnFailureDetectionProcesses:                []string{},
 		PreGracefulTakeoverProcesses:               []string{},
 		PreFailoverProcesses:                       []string{},
 		PostMasterFailoverProcesses:                []string{},
+		PostPoolMembershipChangeProcesses:          []string{},
+		PostDecommissionProcesses:                  []string{},
 		PostIntermediateMasterFailoverProcesses:    []string{},
 		PostFailoverProcesses:                      []string{},
 		PostUnsuccessfulFailoverProcesses:          []string{},
 		PostGracefulTakeoverProcesses:              []string{},
+		PinnedMasterRecoveryProcesses:              []string{},
+		HookActions:                                make(map[string]HookAction),
+		ReplicationLagSources:                      make(map[string][]string),
+		HooksConfiguration:                         make(map[string]HookConfiguration),
+		GracefulTakeoverTransactionsChecks:         make(map[string]GracefulTakeoverTransactionsConfiguration),
+		GracefulTakeoverReplicaQuorums:             make(map[string]GracefulTakeoverReplicaQuorumConfiguration),
+		GracefulTakeoverCatchUpTimeoutSeconds:      300,
+		ActiveRecoveryWaitTimeoutSeconds:           300,
+		DesiredTopologies:                          make(map[string]string),
+		DetectionProfiles:                          make(map[string]string),
+		DesiredTopologyAutoConverge:                false,
+		MasterFanOutMaxReplicas:                    0,
+		MasterFanOutAutoReduceClusterFilters:       []string{},
+		ReadOnlyEnforcement:                        make(map[string]string),
+		OnReadOnlyDriftProcesses:                   []string{},
+		SafeRelocationVerificationSeconds:          60,
+		LagSLOs:                                    make(map[string]LagSLOConfiguration),
+		LagSLOBurnProcesses:                        []string{},
 		CoMasterRecoveryMustPromoteOtherCoMaster:   true,
 		DetachLostSlavesAfterMasterFailover:        true,
 		ApplyMySQLPromotionAfterMasterFailover:     true,
+		DeadMasterPostmortemWindowSeconds:          600,
 		MasterFailoverLostInstancesDowntimeMinutes: 0,
+		DowntimeInheritance:                        false,
 		MasterFailoverDetachSlaveMasterHost:        false,
 		FailMasterPromotionIfSQLThreadNotUpToDate:  false,
 		PostponeSlaveRecoveryOnLagMinutes:          0,
@@ -406,11 +850,57 @@ func newConfiguration() *Configuration {
 		GraphiteConvertHostnameDotsToUnderscores:   true,
 		GraphitePollSeconds:                        60,
 		URLPrefix:                                  "",
-		DiscoveryIgnoreReplicaHostnameFilters: []string{},
-		ConsulAddress:                         "",
-		ConsulAclToken:                        "",
-		ZkAddress:                             "",
-		KVClusterMasterPrefix:                 "mysql/master",
+		HTTPCacheControlMaxAgeSeconds:              0,
+		DiscoveryIgnoreReplicaHostnameFilters:      []string{},
+		ConsulAddress:                              "",
+		ConsulAclToken:                             "",
+		ZkAddress:                                  "",
+		KVClusterMasterPrefix:                      "mysql/master",
+		KVClusterMasterTemplates:                   make(map[string][]KVMasterEntryTemplate),
+		KVPoolPrefix:                               "",
+		KVDecommissionPrefix:                       "",
+		ReconcileMasterServiceRecords:              false,
+		ReconcileMasterServiceRecordsSelfHeal:      false,
+		ReconcileMasterDNSHookAction:               "",
+		KafkaRESTProxyURL:                          "",
+		KafkaTopics:                                map[string]string{"*": "orchestrator-events"},
+		KafkaRequestTimeoutSeconds:                 5,
+		StateEventsRetentionHours:                  24,
+		SMTPHost:                                   "",
+		SMTPPort:                                   25,
+		SMTPUser:                                   "",
+		SMTPPassword:                               "",
+		EmailFromAddress:                           "",
+		EmailRecipients:                            make(map[string][]string),
+		EmailAnalysisCodes:                         []string{},
+		EmailDigestHour:                            -1,
+		EmailTemplatesDirectory:                    "",
+		FederationDeploymentName:                   "",
+		FederationPeers:                            make(map[string]string),
+		FederationAPIToken:                         "",
+		FederationRequestTimeoutSeconds:            5,
+	}
+}
+
+// hooksLists returns all hooks lists by name. Any of these may refer to built-in hook actions.
+func (this *Configuration) hooksLists() map[string][]string {
+	return map[string][]string{
+		"OnFailureDetectionProcesses":             this.OnFailureDetectionProcesses,
+		"OnDualWritableMastersProcesses":          this.OnDualWritableMastersProcesses,
+		"PreGracefulTakeoverProcesses":            this.PreGracefulTakeoverProcesses,
+		"PreFailoverProcesses":                    this.PreFailoverProcesses,
+		"PostFailoverProcesses":                   this.PostFailoverProcesses,
+		"PostUnsuccessfulFailoverProcesses":       this.PostUnsuccessfulFailoverProcesses,
+		"PostMasterFailoverProcesses":             this.PostMasterFailoverProcesses,
+		"PostIntermediateMasterFailoverProcesses": this.PostIntermediateMasterFailoverProcesses,
+		"PostGracefulTakeoverProcesses":           this.PostGracefulTakeoverProcesses,
+		"PinnedMasterRecoveryProcesses":           this.PinnedMasterRecoveryProcesses,
+		"PostPoolMembershipChangeProcesses":       this.PostPoolMembershipChangeProcesses,
+		"PostDecommissionProcesses":               this.PostDecommissionProcesses,
+		"NoPromotionCandidateProcesses":           this.NoPromotionCandidateProcesses,
+		"SlowDiscoveryOutlierProcesses":           this.SlowDiscoveryOutlierProcesses,
+		"OnReadOnlyDriftProcesses":                this.OnReadOnlyDriftProcesses,
+		"LagSLOBurnProcesses":                     this.LagSLOBurnProcesses,
 	}
 }
 
@@ -536,6 +1026,18 @@ func (this *Configuration) postReadAdjustments() error {
 	if this.RaftAdvertise == "" {
 		this.RaftAdvertise = this.RaftBind
 	}
+	if this.LeaderLeaseElection && this.RaftEnabled {
+		return fmt.Errorf("LeaderLeaseElection and RaftEnabled are mutually exclusive")
+	}
+	if this.LeaderLeaseElection && this.LeaderLeaseSeconds < 3*HealthPollSeconds {
+		return fmt.Errorf("LeaderLeaseSeconds must be at least %d", 3*HealthPollSeconds)
+	}
+	if this.KVPoolPrefix != "" && this.KVPoolPrefix != "/" {
+		this.KVPoolPrefix = fmt.Sprintf("%s/", strings.TrimRight(this.KVPoolPrefix, "/"))
+	}
+	if this.KVDecommissionPrefix != "" && this.KVDecommissionPrefix != "/" {
+		this.KVDecommissionPrefix = fmt.Sprintf("%s/", strings.TrimRight(this.KVDecommissionPrefix, "/"))
+	}
 	if this.KVClusterMasterPrefix != "/" {
 		// "/" remains "/"
 		// "prefix" turns to "prefix/"
@@ -543,12 +1045,330 @@ func (this *Configuration) postReadAdjustments() error {
 		this.KVClusterMasterPrefix = strings.TrimRight(this.KVClusterMasterPrefix, "/")
 		this.KVClusterMasterPrefix = fmt.Sprintf("%s/", this.KVClusterMasterPrefix)
 	}
+	for clusterKey, entryTemplates := range this.KVClusterMasterTemplates {
+		for i := range entryTemplates {
+			if entryTemplates[i].Key == "" {
+				return fmt.Errorf("KVClusterMasterTemplates[%s]: Key must not be empty", clusterKey)
+			}
+			if entryTemplates[i].Value == "" {
+				entryTemplates[i].Value = "{{.Hostname}}:{{.Port}}"
+			}
+			for _, text := range []string{entryTemplates[i].Key, entryTemplates[i].Value} {
+				if strings.Contains(text, ".ClusterName") {
+					return fmt.Errorf("KVClusterMasterTemplates[%s]: invalid template %q: cluster name changes upon failover; use .ClusterAlias", clusterKey, text)
+				}
+				if _, err := template.New(clusterKey).Parse(text); err != nil {
+					return fmt.Errorf("KVClusterMasterTemplates[%s]: invalid template %q: %+v", clusterKey, text, err)
+				}
+			}
+		}
+	}
 	if this.AutoPseudoGTID {
 		this.PseudoGTIDPattern = "drop view if exists `_pseudo_gtid_`"
 		this.PseudoGTIDPatternIsFixedSubstring = true
 		this.PseudoGTIDMonotonicHint = "asc:"
 		this.DetectPseudoGTIDQuery = SelectTrueQuery
 	}
+	for hookName, hookConfig := range this.HooksConfiguration {
+		if hookConfig.TimeoutSeconds < 0 || hookConfig.Retries < 0 || hookConfig.RetryBackoffSeconds < 0 {
+			return fmt.Errorf("HooksConfiguration[%s]: TimeoutSeconds, Retries and RetryBackoffSeconds must not be negative", hookName)
+		}
+	}
+	for clusterKey, lagSources := range this.ReplicationLagSources {
+		for _, lagSource := range lagSources {
+			switch lagSource {
+			case ReplicationLagSourceHeartbeat:
+				if this.ReplicationLagQuery == "" {
+					return fmt.Errorf("ReplicationLagSources[%s]: %s requires ReplicationLagQuery", clusterKey, lagSource)
+				}
+			case ReplicationLagSourceApplier, ReplicationLagSourceSecondsBehindMaster:
+			default:
+				return fmt.Errorf("ReplicationLagSources[%s]: unknown lag source: %s", clusterKey, lagSource)
+			}
+		}
+	}
+	for actionName, hookAction := range this.HookActions {
+		if err := hookAction.validate(); err != nil {
+			return fmt.Errorf("HookActions[%s]: %+v", actionName, err)
+		}
+	}
+	if this.ReconcileMasterDNSHookAction != "" {
+		if hookAction, ok := this.HookActions[this.ReconcileMasterDNSHookAction]; !ok || hookAction.Type != "dns" {
+			return fmt.Errorf("ReconcileMasterDNSHookAction: %s must name a \"dns\" hook action in HookActions", this.ReconcileMasterDNSHookAction)
+		}
+	}
+	for hooksName, hooks := range this.hooksLists() {
+		for _, hook := range hooks {
+			if !strings.HasPrefix(hook, HookActionPrefix) {
+				continue
+			}
+			if _, ok := this.HookActions[strings.TrimPrefix(hook, HookActionPrefix)]; !ok {
+				return fmt.Errorf("%s: unknown hook action: %s. Define it in HookActions", hooksName, hook)
+			}
+		}
+	}
+	for clusterKey, transactionsCheck := range this.GracefulTakeoverTransactionsChecks {
+		switch transactionsCheck.Action {
+		case "", "report", "kill", "abort":
+		default:
+			return fmt.Errorf("GracefulTakeoverTransactionsChecks[%s]: Action must be one of \"report\", \"kill\", \"abort\". Got: %s", clusterKey, transactionsCheck.Action)
+		}
+	}
+	for i, rule := range this.HostnameRewriteRules {
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			return fmt.Errorf("HostnameRewriteRules[%d]: invalid Pattern %s: %+v", i, rule.Pattern, err)
+		}
+	}
+	for i, rule := range this.InstanceKeyNormalizationRules {
+		if (rule.HostnamePattern == "") == (rule.CIDR == "") {
+			return fmt.Errorf("InstanceKeyNormalizationRules[%d]: exactly one of HostnamePattern and CIDR expected", i)
+		}
+		if _, err := regexp.Compile(rule.HostnamePattern); err != nil {
+			return fmt.Errorf("InstanceKeyNormalizationRules[%d]: invalid HostnamePattern %s: %+v", i, rule.HostnamePattern, err)
+		}
+		if rule.CIDR != "" {
+			if _, _, err := net.ParseCIDR(rule.CIDR); err != nil {
+				return fmt.Errorf("InstanceKeyNormalizationRules[%d]: invalid CIDR %s: %+v", i, rule.CIDR, err)
+			}
+		}
+		if rule.Replacement == "" && rule.ReplacementPort == 0 {
+			return fmt.Errorf("InstanceKeyNormalizationRules[%d]: Replacement or ReplacementPort expected", i)
+		}
+	}
+	for i, server := range this.HostnameResolveDNSServers {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			return fmt.Errorf("HostnameResolveDNSServers[%d]: expected host:port. Got: %s", i, server)
+		}
+	}
+	for clusterKey, automationLevels := range this.RecoveryAutomationLevels {
+		for failureClass, automationLevel := range automationLevels {
+			switch failureClass {
+			case MasterFailureClass, IntermediateMasterFailureClass:
+			default:
+				return fmt.Errorf("RecoveryAutomationLevels[%s]: unknown failure class: %s", clusterKey, failureClass)
+			}
+			switch automationLevel {
+			case RecoveryAutomationAuto, RecoveryAutomationApprove, RecoveryAutomationNever:
+			default:
+				return fmt.Errorf("RecoveryAutomationLevels[%s][%s]: unknown automation level: %s", clusterKey, failureClass, automationLevel)
+			}
+		}
+	}
+	for clusterKey, desiredTopology := range this.DesiredTopologies {
+		switch desiredTopology {
+		case "flat", "intermediate-master-per-dc":
+		default:
+			return fmt.Errorf("DesiredTopologies[%s]: unknown desired topology: %s", clusterKey, desiredTopology)
+		}
+	}
+	for clusterKey, promotionPools := range this.PromotionPools {
+		for _, pool := range promotionPools.AvoidPools {
+			if pool == promotionPools.FailoverPool {
+				return fmt.Errorf("PromotionPools[%s]: pool %s is both the failover pool and an avoided pool", clusterKey, pool)
+			}
+		}
+	}
+	for dimension, groupingDimension := range this.GroupingDimensions {
+		if !groupingDimensionNameRegexp.MatchString(dimension) {
+			return fmt.Errorf("GroupingDimensions: invalid dimension name %q; use letters, digits, '-' and '_'", dimension)
+		}
+		if groupingDimension.HostnamePattern == "" && groupingDimension.Query == "" {
+			return fmt.Errorf("GroupingDimensions[%s]: one of HostnamePattern, Query must be given", dimension)
+		}
+		if groupingDimension.HostnamePattern != "" {
+			pattern, err := regexp.Compile(groupingDimension.HostnamePattern)
+			if err != nil {
+				return fmt.Errorf("GroupingDimensions[%s]: invalid HostnamePattern: %+v", dimension, err)
+			}
+			if pattern.NumSubexp() < 1 {
+				return fmt.Errorf("GroupingDimensions[%s]: HostnamePattern must have a group", dimension)
+			}
+		}
+	}
+	for patternName, errorLogPattern := range this.ErrorLogPatterns {
+		if errorLogPattern.Pattern == "" {
+			return fmt.Errorf("ErrorLogPatterns[%s]: Pattern must be given", patternName)
+		}
+		if _, err := regexp.Compile(errorLogPattern.Pattern); err != nil {
+			return fmt.Errorf("ErrorLogPatterns[%s]: invalid Pattern: %+v", patternName, err)
+		}
+	}
+	if len(this.ErrorLogPatterns) > 0 && this.ErrorLogPollSeconds == 0 {
+		return fmt.Errorf("ErrorLogPollSeconds must be positive when ErrorLogPatterns are configured")
+	}
+	for _, dimension := range this.PromotionAntiAffinityDimensions {
+		if _, ok := this.GroupingDimensions[dimension]; !ok {
+			return fmt.Errorf("PromotionAntiAffinityDimensions: %s is not listed in GroupingDimensions", dimension)
+		}
+	}
+	for clusterKey, replicaQuorum := range this.GracefulTakeoverReplicaQuorums {
+		if replicaQuorum.MaxLagSeconds == 0 {
+			replicaQuorum.MaxLagSeconds = uint(this.ReasonableReplicationLagSeconds)
+		}
+		this.GracefulTakeoverReplicaQuorums[clusterKey] = replicaQuorum
+	}
+	for clusterKey, lagSLO := range this.LagSLOs {
+		if lagSLO.ThresholdSeconds <= 0 {
+			return fmt.Errorf("LagSLOs[%s]: ThresholdSeconds must be positive", clusterKey)
+		}
+		if lagSLO.TargetRatio <= 0 || lagSLO.TargetRatio >= 1 {
+			return fmt.Errorf("LagSLOs[%s]: TargetRatio must be greater than 0 and less than 1. Got: %f", clusterKey, lagSLO.TargetRatio)
+		}
+		for _, burnRateThreshold := range lagSLO.BurnRateThresholds {
+			if burnRateThreshold <= 0 {
+				return fmt.Errorf("LagSLOs[%s]: BurnRateThresholds must be positive", clusterKey)
+			}
+		}
+		if lagSLO.WindowHours == 0 {
+			lagSLO.WindowHours = 720
+		}
+		if lagSLO.BurnRateWindowMinutes == 0 {
+			lagSLO.BurnRateWindowMinutes = 60
+		}
+		if lagSLO.BurnRateWindowMinutes > lagSLO.WindowHours*60 {
+			return fmt.Errorf("LagSLOs[%s]: BurnRateWindowMinutes must not exceed WindowHours", clusterKey)
+		}
+		this.LagSLOs[clusterKey] = lagSLO
+	}
+	if this.DiscoveryBackpressureQueueRatio < 0 || this.DiscoveryBackpressureQueueRatio > 1 {
+		return fmt.Errorf("DiscoveryBackpressureQueueRatio must be within [0, 1]")
+	}
+	if this.DiscoveryBackpressureBackendSeconds < 0 {
+		return fmt.Errorf("DiscoveryBackpressureBackendSeconds must not be negative")
+	}
+	if len(this.DiscoverySheddingPools) > 0 && this.DiscoverySheddingPollSeconds == 0 {
+		return fmt.Errorf("DiscoverySheddingPollSeconds must be positive when DiscoverySheddingPools is set")
+	}
+	if this.DiscoveryMaxStalenessSeconds == 0 {
+		this.DiscoveryMaxStalenessSeconds = 2 * this.InstancePollSeconds
+	}
+	if this.LightweightProbesFullProbeSeconds == 0 {
+		this.LightweightProbesFullProbeSeconds = 2 * this.InstancePollSeconds
+	}
+	if this.LightweightProbesFullProbeSeconds > 60 {
+		return fmt.Errorf("LightweightProbesFullProbeSeconds must not exceed 60")
+	}
+	if this.BackupTimeoutMinutes == 0 {
+		return fmt.Errorf("BackupTimeoutMinutes must be positive")
+	}
+	if this.DiscoveryAutoTune && this.DiscoveryMaxStalenessSeconds <= this.InstancePollSeconds {
+		return fmt.Errorf("DiscoveryMaxStalenessSeconds (%d) must exceed InstancePollSeconds (%d)", this.DiscoveryMaxStalenessSeconds, this.InstancePollSeconds)
+	}
+	if this.DiscoveryAutoTuneBackendWriteSeconds <= 0 {
+		return fmt.Errorf("DiscoveryAutoTuneBackendWriteSeconds must be positive")
+	}
+	if this.DiscoveryOutlierSigma < 0 {
+		return fmt.Errorf("DiscoveryOutlierSigma must not be negative")
+	}
+	for dataCenter, tunnel := range this.TopologyTunnels {
+		tunnelURL, err := url.Parse(tunnel)
+		if err != nil {
+			return fmt.Errorf("TopologyTunnels[%s]: %+v", dataCenter, err)
+		}
+		if tunnelURL.Scheme != "socks5" && tunnelURL.Scheme != "ssh" {
+			return fmt.Errorf("TopologyTunnels[%s]: unsupported tunnel: %s. Expected socks5:// or ssh://", dataCenter, tunnel)
+		}
+		if tunnelURL.Hostname() == "" {
+			return fmt.Errorf("TopologyTunnels[%s]: no host in tunnel: %s", dataCenter, tunnel)
+		}
+	}
+	for clusterKey, enforcementMode := range this.ReadOnlyEnforcement {
+		switch enforcementMode {
+		case ReadOnlyEnforcementEnforce, ReadOnlyEnforcementAlert:
+		default:
+			return fmt.Errorf("ReadOnlyEnforcement[%s]: unknown enforcement mode: %s. Expected %s or %s", clusterKey, enforcementMode, ReadOnlyEnforcementEnforce, ReadOnlyEnforcementAlert)
+		}
+	}
+	switch this.DiscoveryMetricsStorage {
+	case "", DiscoveryMetricsBackendStorage:
+	case DiscoveryMetricsFileStorage:
+		if this.DiscoveryMetricsStorageFile == "" {
+			return fmt.Errorf("DiscoveryMetricsStorageFile must be set when DiscoveryMetricsStorage is %s", DiscoveryMetricsFileStorage)
+		}
+	default:
+		return fmt.Errorf("Unknown DiscoveryMetricsStorage: %s. Expected %s or %s", this.DiscoveryMetricsStorage, DiscoveryMetricsBackendStorage, DiscoveryMetricsFileStorage)
+	}
+	if this.DiscoveryMetricsStorage != "" && (this.DiscoveryMetricsStorageMaxRows == 0 || this.DiscoveryMetricsReadLimit == 0) {
+		return fmt.Errorf("DiscoveryMetricsStorageMaxRows and DiscoveryMetricsReadLimit must be positive when DiscoveryMetricsStorage is set")
+	}
+	for clusterKey, detectionProfile := range this.DetectionProfiles {
+		switch detectionProfile {
+		case "aggressive", "normal", "conservative":
+		default:
+			return fmt.Errorf("DetectionProfiles[%s]: unknown detection profile: %s", clusterKey, detectionProfile)
+		}
+	}
+	if this.RequireExternalHealthConfirmation && len(this.ExternalHealthCheckURLs) == 0 {
+		return fmt.Errorf("ExternalHealthCheckURLs must be defined when RequireExternalHealthConfirmation is set")
+	}
+	if len(this.ExternalHealthCheckURLs) > 0 && (this.ExternalHealthCheckTimeoutSeconds <= 0 || this.ExternalHealthCheckTimeoutSeconds > 30) {
+		return fmt.Errorf("ExternalHealthCheckTimeoutSeconds must be within [1, 30] when ExternalHealthCheckURLs are defined")
+	}
+	if (this.RecoveryThrottleMaxRecoveries > 0 || this.RecoveryThrottleMaxRecoveriesPerDC > 0) && this.RecoveryThrottlePeriodSeconds <= 0 {
+		return fmt.Errorf("RecoveryThrottlePeriodSeconds must be positive when RecoveryThrottleMaxRecoveries or RecoveryThrottleMaxRecoveriesPerDC are set")
+	}
+	if this.InstanceCacheTTLSeconds > this.InstancePollSeconds {
+		return fmt.Errorf("InstanceCacheTTLSeconds (%d) must not exceed InstancePollSeconds (%d)", this.InstanceCacheTTLSeconds, this.InstancePollSeconds)
+	}
+	if this.PromotionMinDiskFreePercent > 100 {
+		return fmt.Errorf("PromotionMinDiskFreePercent must be in range [0..100]")
+	}
+	if this.KafkaRESTProxyURL != "" {
+		u, err := url.Parse(this.KafkaRESTProxyURL)
+		if err != nil {
+			return fmt.Errorf("Failed parsing KafkaRESTProxyURL %s: %+v", this.KafkaRESTProxyURL, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("KafkaRESTProxyURL must use http:// or https:// scheme")
+		}
+		if this.GetKafkaTopic("*") == "" {
+			return fmt.Errorf("KafkaTopics must map \"*\" onto a topic when KafkaRESTProxyURL is set")
+		}
+	}
+	if this.SMTPHost != "" {
+		if this.EmailFromAddress == "" {
+			return fmt.Errorf("EmailFromAddress must be set when SMTPHost is set")
+		}
+		if _, err := mail.ParseAddress(this.EmailFromAddress); err != nil {
+			return fmt.Errorf("Invalid EmailFromAddress %s: %+v", this.EmailFromAddress, err)
+		}
+		if this.SMTPPort == 0 {
+			return fmt.Errorf("SMTPPort must be set when SMTPHost is set")
+		}
+	}
+	for clusterKey, recipients := range this.EmailRecipients {
+		for _, recipient := range recipients {
+			if _, err := mail.ParseAddress(recipient); err != nil {
+				return fmt.Errorf("EmailRecipients[%s]: invalid address %s: %+v", clusterKey, recipient, err)
+			}
+		}
+	}
+	if this.EmailDigestHour < -1 || this.EmailDigestHour > 23 {
+		return fmt.Errorf("EmailDigestHour must be in range [0..23], or -1 to disable the digest")
+	}
+	if (this.AgentEnrollmentCACertFile == "") != (this.AgentEnrollmentCAKeyFile == "") {
+		return fmt.Errorf("AgentEnrollmentCACertFile and AgentEnrollmentCAKeyFile must be specified together")
+	}
+	if this.AgentEnrollmentCACertFile != "" {
+		if !this.AgentsUseSSL || !this.AgentsUseMutualTLS {
+			return fmt.Errorf("Agent enrollment requires AgentsUseSSL and AgentsUseMutualTLS")
+		}
+		if this.AgentCertificateValidityHours == 0 {
+			return fmt.Errorf("AgentCertificateValidityHours must be positive when agent enrollment is enabled")
+		}
+	}
+	for deployment, peerURL := range this.FederationPeers {
+		if deployment == this.FederationDeploymentName {
+			return fmt.Errorf("FederationPeers: peer %s has the name of this deployment", deployment)
+		}
+		u, err := url.Parse(peerURL)
+		if err != nil {
+			return fmt.Errorf("Failed parsing FederationPeers URL %s: %+v", peerURL, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("FederationPeers URL %s must use http:// or https:// scheme", peerURL)
+		}
+	}
 	if this.HTTPAdvertise != "" {
 		u, err := url.Parse(this.HTTPAdvertise)
 		if err != nil {
@@ -590,6 +1410,10 @@ func read(fileName string) (*Configuration, error) {
 		} else {
 			log.Fatal("Cannot read config file:", fileName, err)
 		}
+		interpolateEnvReferences(reflect.ValueOf(Config))
+		if err := Config.decryptSecrets(); err != nil {
+			log.Fatale(err)
+		}
 		if err := Config.postReadAdjustments(); err != nil {
 			log.Fatale(err)
 		}
@@ -642,3 +1466,250 @@ func MarkConfigurationLoaded() {
 func WaitForConfigurationToBeLoaded() {
 	<-configurationLoaded
 }
+
+// GetHookConfiguration returns the execution settings for the n-th (1-based) hook in the given hooks list.
+// The most specific configuration applies: "<list>:<n>", then "<list>", then "*".
+func (this *Configuration) GetHookConfiguration(hooksListName string, hookIndex int) HookConfiguration {
+	for _, key := range []string{fmt.Sprintf("%s:%d", hooksListName, hookIndex), hooksListName, "*"} {
+		if hookConfig, ok := this.HooksConfiguration[key]; ok {
+			return hookConfig
+		}
+	}
+	return HookConfiguration{}
+}
+
+// GetGracefulTakeoverTransactionsCheck returns the blocking transactions checks configuration for given cluster.
+// The most specific configuration applies: cluster name, then cluster alias, then "*".
+func (this *Configuration) GetGracefulTakeoverTransactionsCheck(clusterName string, clusterAlias string) GracefulTakeoverTransactionsConfiguration {
+	for _, key := range []string{clusterName, clusterAlias, "*"} {
+		if key == "" {
+			continue
+		}
+		if transactionsCheck, ok := this.GracefulTakeoverTransactionsChecks[key]; ok {
+			return transactionsCheck
+		}
+	}
+	return GracefulTakeoverTransactionsConfiguration{}
+}
+
+// GetGracefulTakeoverReplicaQuorum returns the replica quorum to verify prior to a graceful takeover of given cluster.
+// The most specific configuration applies: cluster name, then cluster alias, then "*".
+func (this *Configuration) GetGracefulTakeoverReplicaQuorum(clusterName string, clusterAlias string) GracefulTakeoverReplicaQuorumConfiguration {
+	for _, key := range []string{clusterName, clusterAlias, "*"} {
+		if key == "" {
+			continue
+		}
+		if replicaQuorum, ok := this.GracefulTakeoverReplicaQuorums[key]; ok {
+			return replicaQuorum
+		}
+	}
+	return GracefulTakeoverReplicaQuorumConfiguration{}
+}
+
+// GetAnalysisHysteresis returns the number of consecutive analysis cycles required to report given analysis code as
+// raised, and to report it cleared. Both are at least 1.
+func (this *Configuration) GetAnalysisHysteresis(analysisCode string) (raiseCycles uint, clearCycles uint) {
+	raiseCycles, clearCycles = this.AnalysisRaiseCycles, this.AnalysisClearCycles
+	if override, ok := this.AnalysisHysteresisOverrides[analysisCode]; ok {
+		if override.RaiseCycles > 0 {
+			raiseCycles = override.RaiseCycles
+		}
+		if override.ClearCycles > 0 {
+			clearCycles = override.ClearCycles
+		}
+	}
+	if raiseCycles == 0 {
+		raiseCycles = 1
+	}
+	if clearCycles == 0 {
+		clearCycles = 1
+	}
+	return raiseCycles, clearCycles
+}
+
+// GetReplicationLagSources returns the ordered replication lag sources of given cluster.
+// The most specific configuration applies: cluster name, then cluster alias, then "*". Clusters with no
+// configuration use the heartbeat (when ReplicationLagQuery is set), then Seconds_Behind_Master.
+func (this *Configuration) GetReplicationLagSources(clusterName string, clusterAlias string) []string {
+	for _, key := range []string{clusterName, clusterAlias, "*"} {
+		if key == "" {
+			continue
+		}
+		if lagSources, ok := this.ReplicationLagSources[key]; ok && len(lagSources) > 0 {
+			return lagSources
+		}
+	}
+	if this.ReplicationLagQuery != "" {
+		return []string{ReplicationLagSourceHeartbeat, ReplicationLagSourceSecondsBehindMaster}
+	}
+	return []string{ReplicationLagSourceSecondsBehindMaster}
+}
+
+// GetDesiredTopology returns the configured desired topology shape for given cluster, or empty string if none configured.
+// The most specific configuration applies: cluster name, then cluster alias, then "*".
+func (this *Configuration) GetDesiredTopology(clusterName string, clusterAlias string) string {
+	for _, key := range []string{clusterName, clusterAlias, "*"} {
+		if key == "" {
+			continue
+		}
+		if desiredTopology, ok := this.DesiredTopologies[key]; ok {
+			return desiredTopology
+		}
+	}
+	return ""
+}
+
+// GetRecoveryAutomationLevel returns the automation level of recoveries of given failure class on given cluster, or empty
+// string if none configured. The most specific configuration listing the failure class applies: cluster name, then cluster
+// alias, then "*".
+func (this *Configuration) GetRecoveryAutomationLevel(clusterName string, clusterAlias string, failureClass string) string {
+	for _, key := range []string{clusterName, clusterAlias, "*"} {
+		if key == "" {
+			continue
+		}
+		if automationLevel, ok := this.RecoveryAutomationLevels[key][failureClass]; ok {
+			return automationLevel
+		}
+	}
+	return ""
+}
+
+// GetPromotionStrategy returns the name of the promotion strategy configured for given cluster, or empty string if
+// none configured. The most specific configuration applies: cluster name, then cluster alias, then "*".
+func (this *Configuration) GetPromotionStrategy(clusterName string, clusterAlias string) string {
+	for _, key := range []string{clusterName, clusterAlias, "*"} {
+		if key == "" {
+			continue
+		}
+		if promotionStrategy, ok := this.PromotionStrategies[key]; ok {
+			return promotionStrategy
+		}
+	}
+	return ""
+}
+
+// GetPromotionPools returns the pool-aware promotion preference of given cluster, if any.
+// The most specific configuration applies: cluster name, then cluster alias, then "*".
+func (this *Configuration) GetPromotionPools(clusterName string, clusterAlias string) (promotionPools PromotionPoolsConfiguration, found bool) {
+	for _, key := range []string{clusterName, clusterAlias, "*"} {
+		if key == "" {
+			continue
+		}
+		if promotionPools, ok := this.PromotionPools[key]; ok {
+			return promotionPools, true
+		}
+	}
+	return promotionPools, false
+}
+
+// GetLagSLO returns the replication lag SLO of given cluster, if any.
+// The most specific configuration applies: cluster name, then cluster alias, then "*".
+func (this *Configuration) GetLagSLO(clusterName string, clusterAlias string) (lagSLO LagSLOConfiguration, found bool) {
+	for _, key := range []string{clusterName, clusterAlias, "*"} {
+		if key == "" {
+			continue
+		}
+		if lagSLO, ok := this.LagSLOs[key]; ok {
+			return lagSLO, true
+		}
+	}
+	return lagSLO, false
+}
+
+// GetKVClusterMasterTemplates returns the templated KV master entries of given cluster, if any.
+// The most specific configuration applies: cluster alias, then "*". Entries are not configured by cluster
+// name, as it changes upon failover.
+func (this *Configuration) GetKVClusterMasterTemplates(clusterAlias string) (entryTemplates []KVMasterEntryTemplate, found bool) {
+	for _, key := range []string{clusterAlias, "*"} {
+		if key == "" {
+			continue
+		}
+		if entryTemplates, ok := this.KVClusterMasterTemplates[key]; ok {
+			return entryTemplates, true
+		}
+	}
+	return entryTemplates, false
+}
+
+// GetDetectionProfile returns the failure detection profile for given cluster, defaulting to "normal".
+// The most specific configuration applies: cluster name, then cluster alias, then "*".
+func (this *Configuration) GetDetectionProfile(clusterName string, clusterAlias string) string {
+	for _, key := range []string{clusterName, clusterAlias, "*"} {
+		if key == "" {
+			continue
+		}
+		if detectionProfile, ok := this.DetectionProfiles[key]; ok {
+			return detectionProfile
+		}
+	}
+	return "normal"
+}
+
+// GetReadOnlyEnforcement returns the read_only enforcement mode of given cluster, or an empty string when the
+// cluster is not subject to enforcement. The most specific configuration applies: cluster name, then cluster alias, then "*".
+func (this *Configuration) GetReadOnlyEnforcement(clusterName string, clusterAlias string) string {
+	for _, key := range []string{clusterName, clusterAlias, "*"} {
+		if key == "" {
+			continue
+		}
+		if enforcementMode, ok := this.ReadOnlyEnforcement[key]; ok {
+			return enforcementMode
+		}
+	}
+	return ""
+}
+
+// GetEmailRecipients returns the recipients of email notifications concerning given cluster.
+// The most specific configuration applies: cluster name, then cluster alias, then "*".
+func (this *Configuration) GetEmailRecipients(clusterName string, clusterAlias string) []string {
+	for _, key := range []string{clusterName, clusterAlias, "*"} {
+		if key == "" {
+			continue
+		}
+		if recipients, ok := this.EmailRecipients[key]; ok {
+			return recipients
+		}
+	}
+	return []string{}
+}
+
+// IsEmailAnalysisCode checks whether the failure detection of given analysis code is notified by email
+func (this *Configuration) IsEmailAnalysisCode(analysisCode string) bool {
+	if len(this.EmailAnalysisCodes) == 0 {
+		return true
+	}
+	for _, code := range this.EmailAnalysisCodes {
+		if code == analysisCode {
+			return true
+		}
+	}
+	return false
+}
+
+// GetKafkaTopic returns the Kafka topic to which state change events of given type are published.
+// The event type's topic applies, then that of "*".
+func (this *Configuration) GetKafkaTopic(eventType string) string {
+	for _, key := range []string{eventType, "*"} {
+		if key == "" {
+			continue
+		}
+		if topic, ok := this.KafkaTopics[key]; ok {
+			return topic
+		}
+	}
+	return ""
+}
+
+// GetTopologyTunnel returns the tunnel through which topology connections to hosts in given data center are routed,
+// or empty string if such connections are made directly. The data center's tunnel applies, then that of "*".
+func (this *Configuration) GetTopologyTunnel(dataCenter string) string {
+	for _, key := range []string{dataCenter, "*"} {
+		if key == "" {
+			continue
+		}
+		if tunnel, ok := this.TopologyTunnels[key]; ok {
+			return tunnel
+		}
+	}
+	return ""
+}
@@ -0,0 +1,191 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// encryptedValueRegexp matches an encrypted configuration value, in sops style:
+// ENC[AES256_GCM,data:<base64>,iv:<base64>,tag:<base64>,type:str]
+var encryptedValueRegexp = regexp.MustCompile(`^ENC\[AES256_GCM,data:([A-Za-z0-9+/=]*),iv:([A-Za-z0-9+/=]+),tag:([A-Za-z0-9+/=]+),type:str\]$`)
+
+const encryptedValuePrefix = "ENC["
+
+// IsEncryptedValue returns true when given configuration value is encrypted
+func IsEncryptedValue(s string) bool {
+	return strings.HasPrefix(s, encryptedValuePrefix)
+}
+
+// parseEncryptionKey decodes a base64 encoded 256 bit key
+func parseEncryptionKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot decode configuration encryption key: %+v", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("Configuration encryption key must be 256 bit; found %d bit", len(key)*8)
+	}
+	return key, nil
+}
+
+// ReadEncryptionKey reads the key which decrypts configuration values from the environment variable named by
+// ConfigEncryptionKeyEnvVariable, else from ConfigEncryptionKeyFile, else from the output of ConfigEncryptionKeyCommand
+func (this *Configuration) ReadEncryptionKey() ([]byte, error) {
+	if this.ConfigEncryptionKeyEnvVariable != "" {
+		if encoded, ok := os.LookupEnv(this.ConfigEncryptionKeyEnvVariable); ok {
+			return parseEncryptionKey(encoded)
+		}
+	}
+	if this.ConfigEncryptionKeyFile != "" {
+		encoded, err := ioutil.ReadFile(this.ConfigEncryptionKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("ConfigEncryptionKeyFile: %+v", err)
+		}
+		return parseEncryptionKey(string(encoded))
+	}
+	if this.ConfigEncryptionKeyCommand != "" {
+		encoded, err := exec.Command("bash", "-c", this.ConfigEncryptionKeyCommand).Output()
+		if err != nil {
+			return nil, fmt.Errorf("ConfigEncryptionKeyCommand: %+v", err)
+		}
+		return parseEncryptionKey(string(encoded))
+	}
+	return nil, fmt.Errorf("Configuration has encrypted values, but no encryption key is configured. Set ConfigEncryptionKeyEnvVariable, ConfigEncryptionKeyFile or ConfigEncryptionKeyCommand")
+}
+
+// EncryptValue encrypts given plaintext with given key, as an ENC[AES256_GCM,...] configuration value
+func EncryptValue(plaintext string, key []byte) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nil, iv, []byte(plaintext), nil)
+	data, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+	return fmt.Sprintf("ENC[AES256_GCM,data:%s,iv:%s,tag:%s,type:str]",
+		base64.StdEncoding.EncodeToString(data),
+		base64.StdEncoding.EncodeToString(iv),
+		base64.StdEncoding.EncodeToString(tag),
+	), nil
+}
+
+// DecryptValue decrypts an ENC[AES256_GCM,...] configuration value with given key
+func DecryptValue(encrypted string, key []byte) (string, error) {
+	submatch := encryptedValueRegexp.FindStringSubmatch(encrypted)
+	if len(submatch) == 0 {
+		return "", fmt.Errorf("Malformed encrypted value; expecting ENC[AES256_GCM,data:...,iv:...,tag:...,type:str]")
+	}
+	decoded := [][]byte{}
+	for _, encoded := range submatch[1:] {
+		b, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return "", fmt.Errorf("Malformed encrypted value: %+v", err)
+		}
+		decoded = append(decoded, b)
+	}
+	data, iv, tag := decoded[0], decoded[1], decoded[2]
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := gcm.Open(nil, iv, append(data, tag...), nil)
+	if err != nil {
+		return "", fmt.Errorf("Cannot decrypt value: wrong key or tampered value")
+	}
+	return string(plaintext), nil
+}
+
+// decryptValues decrypts all encrypted string values found in given value, including within lists, maps and
+// nested structs. The key is only read once the first encrypted value is found.
+func decryptValues(value reflect.Value, path string, getKey func() ([]byte, error)) error {
+	switch value.Kind() {
+	case reflect.Ptr:
+		if !value.IsNil() {
+			return decryptValues(value.Elem(), path, getKey)
+		}
+	case reflect.String:
+		if value.CanSet() && IsEncryptedValue(value.String()) {
+			key, err := getKey()
+			if err != nil {
+				return err
+			}
+			plaintext, err := DecryptValue(value.String(), key)
+			if err != nil {
+				return fmt.Errorf("%s: %+v", path, err)
+			}
+			value.SetString(plaintext)
+		}
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			if value.Field(i).CanSet() {
+				if err := decryptValues(value.Field(i), strings.TrimPrefix(path+"."+value.Type().Field(i).Name, "."), getKey); err != nil {
+					return err
+				}
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			if err := decryptValues(value.Index(i), fmt.Sprintf("%s[%d]", path, i), getKey); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, key := range value.MapKeys() {
+			elem := reflect.New(value.Type().Elem()).Elem()
+			elem.Set(value.MapIndex(key))
+			if err := decryptValues(elem, fmt.Sprintf("%s[%v]", path, key.Interface()), getKey); err != nil {
+				return err
+			}
+			value.SetMapIndex(key, elem)
+		}
+	}
+	return nil
+}
+
+// decryptSecrets decrypts the encrypted values of the configuration, in place
+func (this *Configuration) decryptSecrets() error {
+	var key []byte
+	getKey := func() (_ []byte, err error) {
+		if key == nil {
+			key, err = this.ReadEncryptionKey()
+		}
+		return key, err
+	}
+	return decryptValues(reflect.ValueOf(this), "", getKey)
+}
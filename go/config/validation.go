@@ -0,0 +1,306 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// envReferenceRegexp matches a ${ENV_VAR} reference within a string value
+var envReferenceRegexp = regexp.MustCompile(`[$][{]([A-Za-z_][A-Za-z0-9_]*)[}]`)
+
+// redactedValue replaces secrets in printed configuration
+const redactedValue = "REDACTED"
+
+// expandEnvReferences replaces ${ENV_VAR} references with the values of the environment variables.
+// References to undefined variables are left as they are: hooks, for example, may legitimately
+// reference variables which are only defined at execution time.
+func expandEnvReferences(s string) string {
+	return envReferenceRegexp.ReplaceAllStringFunc(s, func(reference string) string {
+		name := envReferenceRegexp.FindStringSubmatch(reference)[1]
+		if value, ok := os.LookupEnv(name); ok {
+			return value
+		}
+		return reference
+	})
+}
+
+// interpolateEnvReferences expands ${ENV_VAR} references in all string values found in given value,
+// including within lists, maps and nested structs
+func interpolateEnvReferences(value reflect.Value) {
+	switch value.Kind() {
+	case reflect.Ptr:
+		if !value.IsNil() {
+			interpolateEnvReferences(value.Elem())
+		}
+	case reflect.String:
+		if value.CanSet() {
+			value.SetString(expandEnvReferences(value.String()))
+		}
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			if value.Field(i).CanSet() {
+				interpolateEnvReferences(value.Field(i))
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			interpolateEnvReferences(value.Index(i))
+		}
+	case reflect.Map:
+		for _, key := range value.MapKeys() {
+			elem := reflect.New(value.Type().Elem()).Elem()
+			elem.Set(value.MapIndex(key))
+			interpolateEnvReferences(elem)
+			value.SetMapIndex(key, elem)
+		}
+	}
+}
+
+// unresolvedEnvReferences returns the names of environment variables referenced by given configuration's
+// string values, and which are undefined. ORC_* variables are provided to hooks at execution time and are
+// not reported.
+func unresolvedEnvReferences(value reflect.Value, names map[string]bool) {
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !value.IsNil() {
+			unresolvedEnvReferences(value.Elem(), names)
+		}
+	case reflect.String:
+		for _, submatch := range envReferenceRegexp.FindAllStringSubmatch(value.String(), -1) {
+			if strings.HasPrefix(submatch[1], "ORC_") {
+				continue
+			}
+			if _, ok := os.LookupEnv(submatch[1]); !ok {
+				names[submatch[1]] = true
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			if value.Type().Field(i).PkgPath == "" {
+				unresolvedEnvReferences(value.Field(i), names)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			unresolvedEnvReferences(value.Index(i), names)
+		}
+	case reflect.Map:
+		for _, key := range value.MapKeys() {
+			unresolvedEnvReferences(value.MapIndex(key), names)
+		}
+	}
+}
+
+// validateHookCommand checks that the executable of given hook command exists. An absolute path must
+// point to an executable file; other commands are looked up in PATH, and if not found a warning is
+// issued, since the hooks' shell may yet resolve them.
+func validateHookCommand(hooksListName string, command string) (warning string, err error) {
+	for _, token := range strings.Fields(command) {
+		if strings.Contains(token, "=") {
+			// environment variable assignment preceding the command
+			continue
+		}
+		executable := strings.Trim(token, `'"`)
+		if strings.Contains(executable, "{") || strings.Contains(executable, "$") {
+			// placeholder or variable; can only be resolved at execution time
+			return "", nil
+		}
+		if filepath.IsAbs(executable) {
+			fileInfo, err := os.Stat(executable)
+			if err != nil {
+				return "", fmt.Errorf("%s: %s: %+v", hooksListName, command, err)
+			}
+			if fileInfo.IsDir() || fileInfo.Mode()&0111 == 0 {
+				return "", fmt.Errorf("%s: %s: %s is not executable", hooksListName, command, executable)
+			}
+			return "", nil
+		}
+		if _, err := exec.LookPath(executable); err != nil {
+			return fmt.Sprintf("%s: %s: %s not found in PATH", hooksListName, command, executable), nil
+		}
+		return "", nil
+	}
+	return "", nil
+}
+
+// normalizeRaftNodeAddress returns given raft node address in host:port form, applying DefaultRaftPort
+// where no port is given
+func (this *Configuration) normalizeRaftNodeAddress(node string) string {
+	if _, _, err := net.SplitHostPort(node); err == nil {
+		return node
+	}
+	return net.JoinHostPort(node, fmt.Sprintf("%d", this.DefaultRaftPort))
+}
+
+// Validate checks cross-field constraints of a configuration which has been read and adjusted, as well as
+// the existence of referenced files. It returns errors, which are expected to fail orchestrator at some point,
+// and warnings, which are suspicious but may be intended.
+func (this *Configuration) Validate() (errs []error, warnings []string) {
+	if this.IsMySQL() {
+		if this.MySQLOrchestratorHost == "" {
+			errs = append(errs, fmt.Errorf("MySQLOrchestratorHost must be defined when BackendDB is mysql"))
+		}
+		if this.MySQLOrchestratorDatabase == "" {
+			errs = append(errs, fmt.Errorf("MySQLOrchestratorDatabase must be defined when BackendDB is mysql"))
+		}
+	} else if this.BackendSelfMonitoring {
+		errs = append(errs, fmt.Errorf("BackendSelfMonitoring only applies to a MySQL backend"))
+	}
+	if this.BackendSelfAutoRecovery && !this.BackendSelfMonitoring {
+		warnings = append(warnings, "BackendSelfAutoRecovery has no effect unless BackendSelfMonitoring is set")
+	}
+
+	if this.RaftEnabled {
+		if len(this.RaftNodes) == 0 {
+			errs = append(errs, fmt.Errorf("RaftNodes must be defined since raft is enabled (RaftEnabled)"))
+		}
+		raftNodes := map[string]bool{}
+		for _, node := range this.RaftNodes {
+			if _, _, err := net.SplitHostPort(node); err != nil && this.DefaultRaftPort == 0 {
+				errs = append(errs, fmt.Errorf("RaftNodes: %s has no port, and DefaultRaftPort is undefined", node))
+			}
+			node = this.normalizeRaftNodeAddress(node)
+			if raftNodes[node] {
+				errs = append(errs, fmt.Errorf("RaftNodes: %s is listed more than once", node))
+			}
+			raftNodes[node] = true
+		}
+		if len(this.RaftNodes) > 0 && len(this.RaftNodes)%2 == 0 {
+			warnings = append(warnings, fmt.Sprintf("RaftNodes: an even number of nodes (%d) tolerates no more failures than one node less", len(this.RaftNodes)))
+		}
+		if advertise := this.normalizeRaftNodeAddress(this.RaftAdvertise); len(raftNodes) > 0 && !raftNodes[advertise] {
+			warnings = append(warnings, fmt.Sprintf("RaftAdvertise (or RaftBind) %s is not listed in RaftNodes. It must resolve to one of them", advertise))
+		}
+	} else if len(this.RaftNodes) > 0 {
+		warnings = append(warnings, "RaftNodes is ignored since raft is disabled (RaftEnabled)")
+	}
+
+	switch strings.ToLower(this.AuthenticationMethod) {
+	case "basic":
+		if this.HTTPAuthUser == "" {
+			warnings = append(warnings, "AuthenticationMethod is basic but HTTPAuthUser is undefined: running without authentication")
+		}
+	case "multi":
+		if this.HTTPAuthUser == "" {
+			errs = append(errs, fmt.Errorf("HTTPAuthUser must be defined when AuthenticationMethod is multi"))
+		}
+	}
+
+	if this.UseSSL {
+		for _, fileName := range []string{this.SSLCertFile, this.SSLPrivateKeyFile} {
+			if _, err := os.Stat(fileName); err != nil {
+				errs = append(errs, fmt.Errorf("UseSSL: %+v", err))
+			}
+		}
+	}
+	if this.UseMutualTLS {
+		if _, err := os.Stat(this.SSLCAFile); err != nil {
+			errs = append(errs, fmt.Errorf("UseMutualTLS: %+v", err))
+		}
+	}
+
+	configValue := reflect.ValueOf(this).Elem()
+	for i := 0; i < configValue.NumField(); i++ {
+		field := configValue.Type().Field(i)
+		if !strings.HasSuffix(field.Name, "Processes") || field.Type != reflect.TypeOf([]string{}) {
+			continue
+		}
+		for _, command := range configValue.Field(i).Interface().([]string) {
+			warning, err := validateHookCommand(field.Name, command)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			if warning != "" {
+				warnings = append(warnings, warning)
+			}
+		}
+	}
+
+	unresolved := map[string]bool{}
+	unresolvedEnvReferences(configValue, unresolved)
+	for name := range unresolved {
+		warnings = append(warnings, fmt.Sprintf("environment variable %s is referenced but undefined", name))
+	}
+	return errs, warnings
+}
+
+// isSecretConfigKey returns true for configuration keys holding secrets
+func isSecretConfigKey(key string) bool {
+	for _, hint := range []string{"Password", "Secret", "Token"} {
+		if strings.Contains(key, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactSecrets replaces secrets in given JSON decoded value: the values of secret keys,
+// and passwords in URLs
+func redactSecrets(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, elem := range value {
+			if s, ok := elem.(string); ok && s != "" && isSecretConfigKey(key) {
+				value[key] = redactedValue
+			} else {
+				value[key] = redactSecrets(elem)
+			}
+		}
+		return value
+	case []interface{}:
+		for i, elem := range value {
+			value[i] = redactSecrets(elem)
+		}
+		return value
+	case string:
+		if u, err := url.Parse(value); err == nil && u.User != nil {
+			if _, hasPassword := u.User.Password(); hasPassword {
+				u.User = url.UserPassword(u.User.Username(), redactedValue)
+				return u.String()
+			}
+		}
+		return value
+	}
+	return value
+}
+
+// ToRedactedJSONString returns the configuration in indented JSON format, with secrets redacted
+func (this *Configuration) ToRedactedJSONString() (string, error) {
+	b, err := json.Marshal(this)
+	if err != nil {
+		return "", err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return "", err
+	}
+	b, err = json.MarshalIndent(redactSecrets(m), "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
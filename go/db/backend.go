@@ -0,0 +1,276 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+// BackendAddress is the address of a MySQL backend server
+type BackendAddress struct {
+	Hostname string
+	Port     int
+}
+
+func (this BackendAddress) String() string {
+	return net.JoinHostPort(this.Hostname, strconv.Itoa(this.Port))
+}
+
+// BackendStatus describes the MySQL backend orchestrator currently uses, and whether it is available
+type BackendStatus struct {
+	Address          BackendAddress
+	Addresses        []BackendAddress
+	Available        bool
+	UnavailableSince *time.Time
+	LastFailover     *time.Time
+	LastError        string
+}
+
+var backendStatus *BackendStatus
+var backendStatusMutex sync.Mutex
+
+// backendPool is a connection pool to a MySQL backend
+type backendPool struct {
+	address BackendAddress
+	db      *sql.DB
+}
+
+// backendPools are the connection pools to the MySQL backends, by uri. Unlike pools in the sqlutils cache,
+// they are closed once orchestrator fails over from their backend.
+var backendPools = make(map[string]*backendPool)
+var backendPoolsMutex sync.Mutex
+
+// getBackendDB returns a connection pool to given backend address by uri, and whether it was returned from cache
+func getBackendDB(address BackendAddress, uri string) (*sql.DB, bool, error) {
+	backendPoolsMutex.Lock()
+	defer backendPoolsMutex.Unlock()
+
+	if pool, ok := backendPools[uri]; ok {
+		return pool.db, true, nil
+	}
+	db, err := sql.Open("mysql", uri)
+	if err != nil {
+		return db, false, err
+	}
+	backendPools[uri] = &backendPool{address: address, db: db}
+	return db, false, nil
+}
+
+// closeBackendPools closes the connection pools to given backend address. Queries in flight on these pools
+// are allowed to complete.
+func closeBackendPools(address BackendAddress) {
+	backendPoolsMutex.Lock()
+	defer backendPoolsMutex.Unlock()
+
+	for uri, pool := range backendPools {
+		if pool.address != address {
+			continue
+		}
+		delete(backendPools, uri)
+		go pool.db.Close()
+	}
+}
+
+// backendAddresses returns the configured backend addresses: MySQLOrchestratorHost first, then MySQLOrchestratorHosts
+func backendAddresses() (addresses []BackendAddress) {
+	addresses = append(addresses, BackendAddress{Hostname: config.Config.MySQLOrchestratorHost, Port: int(config.Config.MySQLOrchestratorPort)})
+	for _, hostPort := range config.Config.MySQLOrchestratorHosts {
+		address := BackendAddress{Hostname: hostPort, Port: int(config.Config.MySQLOrchestratorPort)}
+		if host, port, err := net.SplitHostPort(hostPort); err == nil {
+			address.Hostname = host
+			address.Port, _ = strconv.Atoi(port)
+		}
+		if address != addresses[0] {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
+
+// getBackendStatus returns the backend status, initializing it as needed. Caller must hold backendStatusMutex.
+func getBackendStatus() *BackendStatus {
+	if backendStatus == nil {
+		addresses := backendAddresses()
+		backendStatus = &BackendStatus{
+			Address:   addresses[0],
+			Addresses: addresses,
+			Available: true,
+		}
+	}
+	return backendStatus
+}
+
+// CurrentBackendAddress returns the address of the MySQL backend orchestrator currently uses
+func CurrentBackendAddress() BackendAddress {
+	backendStatusMutex.Lock()
+	defer backendStatusMutex.Unlock()
+	return getBackendStatus().Address
+}
+
+// IsBackendAvailable returns false when no MySQL backend was found to be writable by the latest health check.
+// orchestrator then runs in degraded mode: it neither discovers nor recovers.
+func IsBackendAvailable() bool {
+	backendStatusMutex.Lock()
+	defer backendStatusMutex.Unlock()
+	return getBackendStatus().Available
+}
+
+// ReadBackendStatus returns a copy of the current backend status
+func ReadBackendStatus() BackendStatus {
+	backendStatusMutex.Lock()
+	defer backendStatusMutex.Unlock()
+	return *getBackendStatus()
+}
+
+// isWritableBackend checks whether the MySQL server at given address is reachable and writable
+func isWritableBackend(address BackendAddress) (bool, error) {
+	uri := fmt.Sprintf("%s:%s@%s(%s)/?timeout=%ds&readTimeout=%ds&interpolateParams=true",
+		config.Config.MySQLOrchestratorUser,
+		config.Config.MySQLOrchestratorPassword,
+		getMySQLNetwork(),
+		address.String(),
+		config.Config.MySQLConnectTimeoutSeconds,
+		config.Config.MySQLConnectTimeoutSeconds,
+	)
+	if config.Config.MySQLOrchestratorUseMutualTLS {
+		uri, _ = SetupMySQLOrchestratorTLS(uri)
+	}
+	db, _, err := sqlutils.GetDB(uri)
+	if err != nil {
+		return false, err
+	}
+	readOnly := false
+	if err := db.QueryRow(`select @@global.read_only`).Scan(&readOnly); err != nil {
+		return false, err
+	}
+	return !readOnly, nil
+}
+
+// CheckBackendHealth checks the current MySQL backend. When it is unreachable or read-only, the first
+// writable backend among the configured addresses becomes the current backend; connections then go
+// to the new backend. When no backend is writable, the backend is marked unavailable.
+func CheckBackendHealth() {
+	status := ReadBackendStatus()
+	writable, err := isWritableBackend(status.Address)
+	if err == nil && writable {
+		markBackendAvailable(status.Address)
+		return
+	}
+	if err == nil {
+		err = fmt.Errorf("backend %s is read-only", status.Address)
+	}
+	if status.Available {
+		log.Errorf("CheckBackendHealth: %+v", err)
+	}
+	for _, address := range status.Addresses {
+		if address == status.Address {
+			continue
+		}
+		if writable, _ := isWritableBackend(address); writable {
+			markBackendAvailable(address)
+			return
+		}
+	}
+	markBackendUnavailable(err)
+}
+
+// PromoteBackend makes given address the current MySQL backend, provided it is writable, adding it to the backend
+// addresses as needed. It is the final step of recovering a failed backend master; see BackendSelfMonitoring.
+func PromoteBackend(address BackendAddress) error {
+	writable, err := isWritableBackend(address)
+	if err != nil {
+		return err
+	}
+	if !writable {
+		return fmt.Errorf("backend %s is read-only", address)
+	}
+	func() {
+		backendStatusMutex.Lock()
+		defer backendStatusMutex.Unlock()
+
+		status := getBackendStatus()
+		for _, existingAddress := range status.Addresses {
+			if existingAddress == address {
+				return
+			}
+		}
+		status.Addresses = append(status.Addresses, address)
+	}()
+	markBackendAvailable(address)
+	return nil
+}
+
+func markBackendAvailable(address BackendAddress) {
+	previousAddress := func() BackendAddress {
+		backendStatusMutex.Lock()
+		defer backendStatusMutex.Unlock()
+
+		status := getBackendStatus()
+		previousAddress := status.Address
+		if status.Address != address {
+			log.Infof("Backend failover: %s -> %s", status.Address, address)
+			now := time.Now()
+			status.LastFailover = &now
+			status.Address = address
+		}
+		if !status.Available {
+			log.Infof("Backend %s is available; leaving degraded mode", address)
+		}
+		status.Available = true
+		status.UnavailableSince = nil
+		status.LastError = ""
+		return previousAddress
+	}()
+	if previousAddress != address {
+		closeBackendPools(previousAddress)
+	}
+}
+
+func markBackendUnavailable(err error) {
+	backendStatusMutex.Lock()
+	defer backendStatusMutex.Unlock()
+
+	status := getBackendStatus()
+	if status.Available {
+		log.Errorf("No writable backend found among %+v; entering degraded mode: not discovering nor recovering", status.Addresses)
+		now := time.Now()
+		status.UnavailableSince = &now
+	}
+	status.Available = false
+	status.LastError = err.Error()
+}
+
+// ContinuousBackendHealthCheck periodically checks the MySQL backend, failing over to another configured
+// backend as needed. It does not apply to a SQLite backend.
+func ContinuousBackendHealthCheck() {
+	if IsSQLite() || config.Config.BackendHealthCheckIntervalSeconds == 0 {
+		return
+	}
+	healthCheckTick := time.Tick(time.Duration(config.Config.BackendHealthCheckIntervalSeconds) * time.Second)
+	for range healthCheckTick {
+		CheckBackendHealth()
+	}
+}
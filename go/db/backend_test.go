@@ -0,0 +1,133 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	test "github.com/openark/golib/tests"
+)
+
+var errDegradedTest = fmt.Errorf("backend-1:3306 is read-only")
+
+// withBackendAddresses configures given MySQL backend addresses, and resets the backend status and pools,
+// for the duration of given test
+func withBackendAddresses(t *testing.T, host string, hosts []string) {
+	orchestratorHost, orchestratorPort, orchestratorHosts := config.Config.MySQLOrchestratorHost, config.Config.MySQLOrchestratorPort, config.Config.MySQLOrchestratorHosts
+	config.Config.MySQLOrchestratorHost, config.Config.MySQLOrchestratorPort, config.Config.MySQLOrchestratorHosts = host, 3306, hosts
+	reset := func() {
+		backendStatusMutex.Lock()
+		backendStatus = nil
+		backendStatusMutex.Unlock()
+		backendPoolsMutex.Lock()
+		backendPools = make(map[string]*backendPool)
+		backendPoolsMutex.Unlock()
+	}
+	reset()
+	t.Cleanup(func() {
+		config.Config.MySQLOrchestratorHost, config.Config.MySQLOrchestratorPort, config.Config.MySQLOrchestratorHosts = orchestratorHost, orchestratorPort, orchestratorHosts
+		reset()
+	})
+}
+
+func TestBackendAddresses(t *testing.T) {
+	withBackendAddresses(t, "backend-1", []string{"backend-1", "backend-2:3307", "backend-3"})
+
+	addresses := backendAddresses()
+	test.S(t).ExpectEquals(len(addresses), 3)
+	test.S(t).ExpectEquals(addresses[0], BackendAddress{Hostname: "backend-1", Port: 3306})
+	test.S(t).ExpectEquals(addresses[1], BackendAddress{Hostname: "backend-2", Port: 3307})
+	test.S(t).ExpectEquals(addresses[2], BackendAddress{Hostname: "backend-3", Port: 3306})
+	test.S(t).ExpectEquals(addresses[1].String(), "backend-2:3307")
+}
+
+func TestMarkBackendAvailability(t *testing.T) {
+	withBackendAddresses(t, "backend-1", []string{"backend-2"})
+	backend1 := BackendAddress{Hostname: "backend-1", Port: 3306}
+	backend2 := BackendAddress{Hostname: "backend-2", Port: 3306}
+
+	test.S(t).ExpectEquals(CurrentBackendAddress(), backend1)
+	test.S(t).ExpectTrue(IsBackendAvailable())
+
+	markBackendUnavailable(errDegradedTest)
+	status := ReadBackendStatus()
+	test.S(t).ExpectFalse(status.Available)
+	test.S(t).ExpectNotNil(status.UnavailableSince)
+	test.S(t).ExpectEquals(status.LastError, errDegradedTest.Error())
+	test.S(t).ExpectEquals(status.Address, backend1)
+
+	markBackendAvailable(backend2)
+	status = ReadBackendStatus()
+	test.S(t).ExpectTrue(status.Available)
+	test.S(t).ExpectTrue(status.UnavailableSince == nil)
+	test.S(t).ExpectEquals(status.LastError, "")
+	test.S(t).ExpectEquals(status.Address, backend2)
+	test.S(t).ExpectNotNil(status.LastFailover)
+}
+
+func TestBackendPoolsClosedOnFailover(t *testing.T) {
+	withBackendAddresses(t, "backend-1", []string{"backend-2"})
+	backend1 := BackendAddress{Hostname: "backend-1", Port: 3306}
+	backend2 := BackendAddress{Hostname: "backend-2", Port: 3306}
+
+	db1, fromCache, err := getBackendDB(backend1, "user:pass@tcp(127.0.0.1:1)/orchestrator?timeout=1s")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectFalse(fromCache)
+	cached, fromCache, err := getBackendDB(backend1, "user:pass@tcp(127.0.0.1:1)/orchestrator?timeout=1s")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(fromCache)
+	test.S(t).ExpectTrue(cached == db1)
+	db2, _, err := getBackendDB(backend2, "user:pass@tcp(127.0.0.1:2)/orchestrator?timeout=1s")
+	test.S(t).ExpectNil(err)
+
+	// Marking the current backend available again keeps its pools
+	markBackendAvailable(backend1)
+	test.S(t).ExpectEquals(len(backendPools), 2)
+
+	markBackendAvailable(backend2)
+	backendPoolsMutex.Lock()
+	_, backend1Pooled := backendPools["user:pass@tcp(127.0.0.1:1)/orchestrator?timeout=1s"]
+	_, backend2Pooled := backendPools["user:pass@tcp(127.0.0.1:2)/orchestrator?timeout=1s"]
+	backendPoolsMutex.Unlock()
+	test.S(t).ExpectFalse(backend1Pooled)
+	test.S(t).ExpectTrue(backend2Pooled)
+
+	// The pool of the previous backend is closed; the pool of the current backend is not
+	isClosed := func(db *sql.DB) bool {
+		err := db.Ping()
+		return err != nil && err.Error() == "sql: database is closed"
+	}
+	closed := false
+	for i := 0; i < 100 && !closed; i++ {
+		if closed = isClosed(db1); !closed {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	test.S(t).ExpectTrue(closed)
+	test.S(t).ExpectFalse(isClosed(db2))
+
+	// Failing back opens a new pool
+	markBackendAvailable(backend1)
+	reopened, fromCache, err := getBackendDB(backend1, "user:pass@tcp(127.0.0.1:1)/orchestrator?timeout=1s")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectFalse(fromCache)
+	test.S(t).ExpectTrue(reopened != db1)
+}
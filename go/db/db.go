@@ -19,8 +19,11 @@ package db
 import (
 	"database/sql"
 	"fmt"
+	"net"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/github/orchestrator/go/config"
 	"github.com/openark/golib/log"
@@ -45,17 +48,17 @@ func (this DummySqlResult) RowsAffected() (int64, error) {
 	return 1, nil
 }
 
-func getMySQLURI() string {
+func getMySQLURI(address BackendAddress) string {
 	dbMutex.Lock()
 	defer dbMutex.Unlock()
 	if mysqlURI != "" {
 		return mysqlURI
 	}
-	mysqlURI := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?timeout=%ds&readTimeout=%ds&interpolateParams=true",
+	mysqlURI := fmt.Sprintf("%s:%s@%s(%s)/%s?timeout=%ds&readTimeout=%ds&interpolateParams=true",
 		config.Config.MySQLOrchestratorUser,
 		config.Config.MySQLOrchestratorPassword,
-		config.Config.MySQLOrchestratorHost,
-		config.Config.MySQLOrchestratorPort,
+		getMySQLNetwork(),
+		address.String(),
 		config.Config.MySQLOrchestratorDatabase,
 		config.Config.MySQLConnectTimeoutSeconds,
 		config.Config.MySQLOrchestratorReadTimeoutSeconds,
@@ -79,10 +82,11 @@ func OpenTopology(host string, port int) (*sql.DB, error) {
 }
 
 func openTopology(host string, port int, readTimeout int) (db *sql.DB, err error) {
-	mysql_uri := fmt.Sprintf("%s:%s@tcp(%s:%d)/?timeout=%ds&readTimeout=%ds&interpolateParams=true",
+	mysql_uri := fmt.Sprintf("%s:%s@%s(%s)/?timeout=%ds&readTimeout=%ds&interpolateParams=true",
 		config.Config.MySQLTopologyUser,
 		config.Config.MySQLTopologyPassword,
-		host, port,
+		getTopologyMySQLNetwork(),
+		net.JoinHostPort(host, strconv.Itoa(port)),
 		config.Config.MySQLConnectTimeoutSeconds,
 		readTimeout,
 	)
@@ -101,19 +105,19 @@ func openTopology(host string, port int, readTimeout int) (db *sql.DB, err error
 	return db, err
 }
 
-func openOrchestratorMySQLGeneric() (db *sql.DB, fromCache bool, err error) {
-	uri := fmt.Sprintf("%s:%s@tcp(%s:%d)/?timeout=%ds&readTimeout=%ds&interpolateParams=true",
+func openOrchestratorMySQLGeneric(address BackendAddress) (db *sql.DB, fromCache bool, err error) {
+	uri := fmt.Sprintf("%s:%s@%s(%s)/?timeout=%ds&readTimeout=%ds&interpolateParams=true",
 		config.Config.MySQLOrchestratorUser,
 		config.Config.MySQLOrchestratorPassword,
-		config.Config.MySQLOrchestratorHost,
-		config.Config.MySQLOrchestratorPort,
+		getMySQLNetwork(),
+		address.String(),
 		config.Config.MySQLConnectTimeoutSeconds,
 		config.Config.MySQLOrchestratorReadTimeoutSeconds,
 	)
 	if config.Config.MySQLOrchestratorUseMutualTLS {
 		uri, _ = SetupMySQLOrchestratorTLS(uri)
 	}
-	return sqlutils.GetDB(uri)
+	return getBackendDB(address, uri)
 }
 
 func IsSQLite() bool {
@@ -135,7 +139,8 @@ func OpenOrchestrator() (db *sql.DB, err error) {
 		db.SetMaxOpenConns(1)
 		db.SetMaxIdleConns(1)
 	} else {
-		if db, fromCache, err := openOrchestratorMySQLGeneric(); err != nil {
+		address := CurrentBackendAddress()
+		if db, fromCache, err := openOrchestratorMySQLGeneric(address); err != nil {
 			return db, log.Errore(err)
 		} else if !fromCache {
 			// first time ever we talk to MySQL
@@ -144,11 +149,11 @@ func OpenOrchestrator() (db *sql.DB, err error) {
 				return db, log.Errore(err)
 			}
 		}
-		db, fromCache, err = sqlutils.GetDB(getMySQLURI())
+		db, fromCache, err = getBackendDB(address, getMySQLURI(address))
 		if err == nil && !fromCache {
 			// do not show the password but do show what we connect to.
-			safeMySQLURI := fmt.Sprintf("%s:?@tcp(%s:%d)/%s?timeout=%ds", config.Config.MySQLOrchestratorUser,
-				config.Config.MySQLOrchestratorHost, config.Config.MySQLOrchestratorPort, config.Config.MySQLOrchestratorDatabase, config.Config.MySQLConnectTimeoutSeconds)
+			safeMySQLURI := fmt.Sprintf("%s:?@%s(%s)/%s?timeout=%ds", config.Config.MySQLOrchestratorUser,
+				getMySQLNetwork(), address.String(), config.Config.MySQLOrchestratorDatabase, config.Config.MySQLConnectTimeoutSeconds)
 			log.Debugf("Connected to orchestrator backend: %v", safeMySQLURI)
 			if config.Config.MySQLOrchestratorMaxPoolConnections > 0 {
 				log.Debugf("Orchestrator pool SetMaxOpenConns: %d", config.Config.MySQLOrchestratorMaxPoolConnections)
@@ -157,8 +162,10 @@ func OpenOrchestrator() (db *sql.DB, err error) {
 		}
 	}
 	if err == nil && !fromCache {
-		if !config.Config.SkipOrchestratorDatabaseUpdate {
-			initOrchestratorDB(db)
+		if atomic.LoadInt64(&explicitSchemaUpgrade) == 0 {
+			if err := initOrchestratorDB(db); err != nil {
+				return db, err
+			}
 		}
 		// A low value here will trigger reconnects which could
 		// make the number of backend connections hit the tcp
@@ -173,9 +180,8 @@ func OpenOrchestrator() (db *sql.DB, err error) {
 		if maxIdleConns < 10 {
 			maxIdleConns = 10
 		}
-		log.Infof("Connecting to backend %s:%d: maxConnections: %d, maxIdleConns: %d",
-			config.Config.MySQLOrchestratorHost,
-			config.Config.MySQLOrchestratorPort,
+		log.Infof("Connecting to backend %s: maxConnections: %d, maxIdleConns: %d",
+			CurrentBackendAddress(),
 			config.Config.MySQLOrchestratorMaxPoolConnections,
 			maxIdleConns)
 		db.SetMaxIdleConns(maxIdleConns)
@@ -190,23 +196,6 @@ func translateStatement(statement string) (string, error) {
 	return statement, nil
 }
 
-// versionIsDeployed checks if given version has already been deployed
-func versionIsDeployed(db *sql.DB) (result bool, err error) {
-	query := `
-		select
-			count(*) as is_deployed
-		from
-			orchestrator_db_deployments
-		where
-			deployed_version = ?
-		`
-	err = db.QueryRow(query, config.RuntimeCLIFlags.ConfiguredVersion).Scan(&result)
-	// err means the table 'orchestrator_db_deployments' does not even exist, in which case we proceed
-	// to deploy.
-	// If there's another error to this, like DB gone bad, then we're about to find out anyway.
-	return result, err
-}
-
 // registerOrchestratorDeployment updates the orchestrator_metadata table upon successful deployment
 func registerOrchestratorDeployment(db *sql.DB) error {
 	query := `
@@ -219,7 +208,7 @@ func registerOrchestratorDeployment(db *sql.DB) error {
 	if _, err := execInternal(db, query, config.RuntimeCLIFlags.ConfiguredVersion); err != nil {
 		log.Fatalf("Unable to write to orchestrator_metadata: %+v", err)
 	}
-	log.Debugf("Migrated database schema to version [%+v]", config.RuntimeCLIFlags.ConfiguredVersion)
+	log.Debugf("Registered deployment of orchestrator version [%+v]", config.RuntimeCLIFlags.ConfiguredVersion)
 	return nil
 }
 
@@ -284,22 +273,32 @@ func deployStatements(db *sql.DB, queries []string) error {
 	return nil
 }
 
-// initOrchestratorDB attempts to create/upgrade the orchestrator backend database. It is created once in the
-// application's lifetime.
+// initOrchestratorDB checks the backend schema is compatible with this orchestrator, and deploys pending schema
+// migrations unless SkipOrchestratorDatabaseUpdate is set. It is called once in the application's lifetime.
 func initOrchestratorDB(db *sql.DB) error {
 	log.Debug("Initializing orchestrator")
 
-	versionAlreadyDeployed, err := versionIsDeployed(db)
-	if versionAlreadyDeployed && config.RuntimeCLIFlags.ConfiguredVersion != "" && err == nil {
-		// Already deployed with this version
+	status, err := readBackendSchemaStatus(db)
+	if err != nil {
+		return log.Fatale(err)
+	}
+	if err := checkBackendSchemaCompatibility(status); err != nil {
+		if !config.Config.AllowIncompatibleBackendSchema {
+			return log.Fatalf("%+v. Set AllowIncompatibleBackendSchema to run nonetheless", err)
+		}
+		log.Warningf("%+v. Running nonetheless, since AllowIncompatibleBackendSchema is set", err)
+		return nil
+	}
+	if status.IsUpToDate() {
 		return nil
 	}
-	if config.Config.PanicIfDifferentDatabaseDeploy && config.RuntimeCLIFlags.ConfiguredVersion != "" && !versionAlreadyDeployed {
-		log.Fatalf("PanicIfDifferentDatabaseDeploy is set. Configured version %s is not the version found in the database", config.RuntimeCLIFlags.ConfiguredVersion)
+	if config.Config.PanicIfDifferentDatabaseDeploy && config.RuntimeCLIFlags.ConfiguredVersion != "" {
+		log.Fatalf("PanicIfDifferentDatabaseDeploy is set. Backend schema version %d is not the version %d of orchestrator %s", status.DeployedVersion, status.LatestVersion, config.RuntimeCLIFlags.ConfiguredVersion)
+	}
+	log.Debugf("Migrating database schema from version %d to %d", status.DeployedVersion, status.LatestVersion)
+	if err := deploySchemaMigrations(db, status.PendingMigrations); err != nil {
+		return err
 	}
-	log.Debugf("Migrating database schema")
-	deployStatements(db, generateSQLBase)
-	deployStatements(db, generateSQLPatches)
 	registerOrchestratorDeployment(db)
 
 	if IsSQLite() {
@@ -0,0 +1,80 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package db
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/github/orchestrator/go/config"
+)
+
+// preferIPv6Network is a custom network registered with the MySQL driver, dialing IPv6 addresses ahead of IPv4 addresses
+const preferIPv6Network = "tcp-prefer-ipv6"
+
+func init() {
+	mysql.RegisterDial(preferIPv6Network, dialPreferIPv6)
+}
+
+// sortIPsPreferIPv6 returns given IPs with IPv6 addresses first, otherwise retaining order
+func sortIPsPreferIPv6(ips []net.IP) (sorted []net.IP) {
+	for _, ip := range ips {
+		if ip.To4() == nil {
+			sorted = append(sorted, ip)
+		}
+	}
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			sorted = append(sorted, ip)
+		}
+	}
+	return sorted
+}
+
+// dialPreferIPv6 resolves the host of given address and attempts its IPv6 addresses before its IPv4 addresses
+func dialPreferIPv6(addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	timeout := time.Duration(config.Config.MySQLConnectTimeoutSeconds) * time.Second
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("dialPreferIPv6: no addresses found for %s", host)
+	}
+	for _, ip := range sortIPsPreferIPv6(ips) {
+		var conn net.Conn
+		if conn, err = net.DialTimeout("tcp", net.JoinHostPort(ip.String(), port), timeout); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// getMySQLNetwork returns the network by which the MySQL driver connects to servers
+func getMySQLNetwork() string {
+	if config.Config.PreferIPv6 {
+		return preferIPv6Network
+	}
+	return "tcp"
+}
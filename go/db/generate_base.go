@@ -17,6 +17,7 @@
 package db
 
 // generateSQLBase & generateSQLPatches are lists of SQL statements required to build the orchestrator backend
+// baseline schema (see baselineSchemaVersion)
 var generateSQLBase = []string{
 	`
         CREATE TABLE IF NOT EXISTS database_instance (
@@ -825,4 +826,377 @@ var generateSQLBase = []string{
 			PRIMARY KEY (hostname)
 		) ENGINE=InnoDB DEFAULT CHARSET=ascii
 	`,
+	`
+		CREATE TABLE IF NOT EXISTS topology_recovery_bundle (
+			recovery_uid varchar(128) CHARACTER SET ascii NOT NULL,
+			bundle mediumtext CHARACTER SET utf8 NOT NULL,
+			last_updated timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (recovery_uid)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE INDEX last_updated_idx_topology_recovery_bundle ON topology_recovery_bundle (last_updated)
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS cluster_desired_topology (
+			cluster_name varchar(128) CHARACTER SET ascii NOT NULL,
+			desired_topology varchar(128) CHARACTER SET ascii NOT NULL,
+			last_updated timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (cluster_name)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS database_instance_pool_spec (
+			cluster_name varchar(128) CHARACTER SET ascii NOT NULL,
+			pool varchar(128) NOT NULL,
+			desired_size int unsigned NOT NULL,
+			max_lag_seconds int unsigned NOT NULL,
+			auto_backfill tinyint unsigned NOT NULL,
+			last_updated timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (cluster_name, pool)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS agent_backup_policy (
+			cluster_name varchar(128) CHARACTER SET ascii NOT NULL,
+			frequency_minutes int unsigned NOT NULL,
+			backup_method varchar(32) NOT NULL,
+			max_lag_seconds int unsigned NOT NULL,
+			preferred_data_center varchar(32) NOT NULL,
+			retention_count int unsigned NOT NULL,
+			last_updated timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (cluster_name)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS agent_backup (
+			agent_backup_id int unsigned NOT NULL AUTO_INCREMENT,
+			cluster_name varchar(128) CHARACTER SET ascii NOT NULL,
+			hostname varchar(128) NOT NULL,
+			backup_method varchar(32) NOT NULL,
+			start_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			end_timestamp timestamp NOT NULL DEFAULT '1971-01-01 00:00:00',
+			is_complete tinyint unsigned NOT NULL DEFAULT '0',
+			is_successful tinyint unsigned NOT NULL DEFAULT '0',
+			is_expired tinyint unsigned NOT NULL DEFAULT '0',
+			error_message text NOT NULL,
+			PRIMARY KEY (agent_backup_id)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE INDEX cluster_name_idx_agent_backup ON agent_backup (cluster_name, start_timestamp)
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS candidate_database_instance_override (
+			hostname varchar(128) CHARACTER SET ascii NOT NULL,
+			port smallint unsigned NOT NULL,
+			override_promotion_rule varchar(16) CHARACTER SET ascii NOT NULL,
+			override_reason varchar(128) CHARACTER SET utf8 NOT NULL,
+			override_owner varchar(128) CHARACTER SET utf8 NOT NULL,
+			override_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			override_expires_at timestamp NOT NULL DEFAULT '1971-01-01 00:00:00',
+			PRIMARY KEY (hostname, port)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS cluster_lock (
+			cluster_name varchar(128) CHARACTER SET ascii NOT NULL,
+			lock_owner varchar(128) CHARACTER SET utf8 NOT NULL,
+			lock_reason varchar(128) CHARACTER SET utf8 NOT NULL,
+			lock_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			lock_expires_at timestamp NOT NULL DEFAULT '1971-01-01 00:00:00',
+			PRIMARY KEY (cluster_name)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS external_health_check (
+			external_health_check_id bigint unsigned NOT NULL AUTO_INCREMENT,
+			hostname varchar(128) CHARACTER SET ascii NOT NULL,
+			port smallint unsigned NOT NULL,
+			analysis varchar(128) NOT NULL,
+			source varchar(512) CHARACTER SET utf8 NOT NULL,
+			check_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			is_reachable tinyint unsigned NOT NULL DEFAULT '0',
+			is_healthy tinyint unsigned NOT NULL DEFAULT '0',
+			response varchar(1024) CHARACTER SET utf8 NOT NULL,
+			PRIMARY KEY (external_health_check_id)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE INDEX hostname_port_idx_external_health_check ON external_health_check (hostname, port, check_timestamp)
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS database_instance_binlog_checkpoint (
+			hostname varchar(128) CHARACTER SET ascii NOT NULL,
+			port smallint unsigned NOT NULL,
+			checkpoint_unix_timestamp int unsigned NOT NULL,
+			binary_log_file varchar(128) CHARACTER SET ascii NOT NULL,
+			binary_log_pos bigint unsigned NOT NULL,
+			executed_gtid_set text CHARACTER SET ascii NOT NULL,
+			PRIMARY KEY (hostname, port, checkpoint_unix_timestamp)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE INDEX checkpoint_unix_timestamp_idx_database_instance_binlog_checkpoint ON database_instance_binlog_checkpoint (checkpoint_unix_timestamp)
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS cluster_discovery_pause (
+			cluster_name varchar(128) CHARACTER SET ascii NOT NULL,
+			pause_owner varchar(128) CHARACTER SET utf8 NOT NULL,
+			pause_reason varchar(128) CHARACTER SET utf8 NOT NULL,
+			pause_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			pause_expires_at timestamp NOT NULL DEFAULT '1971-01-01 00:00:00',
+			PRIMARY KEY (cluster_name)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS api_token (
+			token_id varchar(32) CHARACTER SET ascii NOT NULL,
+			token_hash varchar(128) CHARACTER SET ascii NOT NULL,
+			token_owner varchar(128) CHARACTER SET utf8 NOT NULL,
+			description varchar(1024) CHARACTER SET utf8 NOT NULL,
+			cluster_filters text CHARACTER SET utf8 NOT NULL,
+			operation_classes varchar(128) CHARACTER SET ascii NOT NULL,
+			created_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (token_id)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS cluster_lag_sample (
+			cluster_name varchar(128) CHARACTER SET ascii NOT NULL,
+			sample_unix_timestamp int unsigned NOT NULL,
+			max_lag_seconds bigint NOT NULL,
+			count_replicas int unsigned NOT NULL,
+			count_unknown_lag int unsigned NOT NULL,
+			PRIMARY KEY (cluster_name, sample_unix_timestamp)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE INDEX sample_unix_timestamp_idx_cluster_lag_sample ON cluster_lag_sample (sample_unix_timestamp)
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS state_event (
+			event_id bigint unsigned NOT NULL AUTO_INCREMENT,
+			event_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			event_type varchar(128) CHARACTER SET ascii NOT NULL,
+			cluster_name varchar(128) CHARACTER SET ascii NOT NULL,
+			hostname varchar(128) CHARACTER SET ascii NOT NULL,
+			port smallint unsigned NOT NULL,
+			event_data text CHARACTER SET utf8 NOT NULL,
+			PRIMARY KEY (event_id)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE INDEX event_timestamp_idx_state_event ON state_event (event_timestamp)
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS delayed_replica (
+			hostname varchar(128) CHARACTER SET ascii NOT NULL,
+			port smallint unsigned NOT NULL,
+			intended_delay_seconds int unsigned NOT NULL,
+			delay_owner varchar(128) CHARACTER SET utf8 NOT NULL,
+			delay_reason varchar(128) CHARACTER SET utf8 NOT NULL,
+			delay_suspended_until timestamp NOT NULL DEFAULT '1971-01-01 00:00:00',
+			tagged_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (hostname, port)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS hostname_resolve_seed (
+		  hostname varchar(128) NOT NULL,
+		  resolved_hostname varchar(128) NOT NULL,
+		  seeded_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		  PRIMARY KEY (hostname)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS analysis_history (
+			history_id bigint unsigned not null auto_increment,
+			analysis_unix_timestamp bigint unsigned NOT NULL,
+			cluster_name varchar(128) CHARACTER SET ascii NOT NULL,
+			cluster_alias varchar(128) CHARACTER SET ascii NOT NULL,
+			hostname varchar(128) CHARACTER SET ascii NOT NULL,
+			port smallint unsigned NOT NULL,
+			analysis varchar(128) CHARACTER SET ascii NOT NULL,
+			analysis_entry text CHARACTER SET utf8 NOT NULL,
+			PRIMARY KEY (history_id)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE INDEX cluster_timestamp_idx_analysis_history ON analysis_history (cluster_name, analysis_unix_timestamp)
+	`,
+	`
+		CREATE INDEX alias_timestamp_idx_analysis_history ON analysis_history (cluster_alias, analysis_unix_timestamp)
+	`,
+	`
+		CREATE INDEX timestamp_idx_analysis_history ON analysis_history (analysis_unix_timestamp)
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS cluster_pinned_master (
+			cluster_name varchar(128) CHARACTER SET ascii NOT NULL,
+			hostname varchar(128) CHARACTER SET ascii NOT NULL,
+			port smallint(5) unsigned NOT NULL,
+			pin_owner varchar(128) CHARACTER SET utf8 NOT NULL,
+			pin_reason varchar(128) CHARACTER SET utf8 NOT NULL,
+			pin_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (cluster_name)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS cluster_schema_migration (
+			cluster_name varchar(128) CHARACTER SET ascii NOT NULL,
+			migration_id varchar(128) CHARACTER SET utf8 NOT NULL,
+			migration_owner varchar(128) CHARACTER SET utf8 NOT NULL,
+			description varchar(1024) CHARACTER SET utf8 NOT NULL,
+			suppressed_actions varchar(512) CHARACTER SET ascii NOT NULL,
+			start_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at timestamp NOT NULL DEFAULT '1971-01-01 00:00:00',
+			PRIMARY KEY (cluster_name, migration_id)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS topology_recovery_approval (
+			approval_uid varchar(128) CHARACTER SET ascii NOT NULL,
+			hostname varchar(128) CHARACTER SET ascii NOT NULL,
+			port smallint(5) unsigned NOT NULL,
+			analysis varchar(128) CHARACTER SET ascii NOT NULL,
+			cluster_name varchar(128) CHARACTER SET ascii NOT NULL,
+			cluster_alias varchar(128) CHARACTER SET ascii NOT NULL,
+			failure_class varchar(32) CHARACTER SET ascii NOT NULL,
+			approval_status varchar(32) CHARACTER SET ascii NOT NULL,
+			request_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at timestamp NOT NULL DEFAULT '1971-01-01 00:00:00',
+			decided_by varchar(128) CHARACTER SET utf8 NOT NULL DEFAULT '',
+			decision_timestamp timestamp NOT NULL DEFAULT '1971-01-01 00:00:00',
+			PRIMARY KEY (approval_uid)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE INDEX hostname_port_idx_topology_recovery_approval ON topology_recovery_approval (hostname, port)
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS topology_recovery_timing (
+			recovery_uid varchar(128) CHARACTER SET ascii NOT NULL,
+			hostname varchar(128) CHARACTER SET ascii NOT NULL,
+			port smallint(5) unsigned NOT NULL,
+			analysis varchar(128) CHARACTER SET ascii NOT NULL,
+			cluster_name varchar(128) CHARACTER SET ascii NOT NULL,
+			cluster_alias varchar(128) CHARACTER SET ascii NOT NULL,
+			is_successful TINYINT UNSIGNED NOT NULL DEFAULT 0,
+			failure_onset timestamp NULL,
+			detected_at timestamp NULL,
+			recovery_started_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			promoted_at timestamp NULL,
+			PRIMARY KEY (recovery_uid)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE INDEX cluster_name_idx_topology_recovery_timing ON topology_recovery_timing (cluster_name, recovery_started_at)
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS agent_enrollment_token (
+			token_hash varchar(64) CHARACTER SET ascii NOT NULL,
+			hostname varchar(128) CHARACTER SET ascii NOT NULL,
+			created_by varchar(128) CHARACTER SET utf8 NOT NULL,
+			created_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at timestamp NOT NULL DEFAULT '1971-01-01 00:00:00',
+			PRIMARY KEY (token_hash)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS agent_certificate (
+			serial_number varchar(64) CHARACTER SET ascii NOT NULL,
+			hostname varchar(128) CHARACTER SET ascii NOT NULL,
+			issue_reason varchar(32) CHARACTER SET ascii NOT NULL,
+			issued_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at timestamp NOT NULL DEFAULT '1971-01-01 00:00:00',
+			is_revoked tinyint unsigned NOT NULL DEFAULT 0,
+			revoked_by varchar(128) CHARACTER SET utf8 NOT NULL DEFAULT '',
+			revoke_reason varchar(512) CHARACTER SET utf8 NOT NULL DEFAULT '',
+			revoked_timestamp timestamp NOT NULL DEFAULT '1971-01-01 00:00:00',
+			PRIMARY KEY (serial_number)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE INDEX hostname_idx_agent_certificate ON agent_certificate (hostname, issued_timestamp)
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS database_instance_flag (
+			hostname varchar(128) CHARACTER SET ascii NOT NULL,
+			port smallint(5) unsigned NOT NULL,
+			instance_flag varchar(64) CHARACTER SET ascii NOT NULL,
+			flag_owner varchar(128) CHARACTER SET utf8 NOT NULL,
+			flag_reason varchar(512) CHARACTER SET utf8 NOT NULL,
+			set_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (hostname, port, instance_flag)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS leader_lease (
+			anchor tinyint unsigned NOT NULL,
+			hostname varchar(128) CHARACTER SET ascii NOT NULL,
+			token varchar(128) NOT NULL,
+			fencing_token bigint unsigned NOT NULL,
+			acquired_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			renewed_at timestamp NOT NULL DEFAULT '1971-01-01 00:00:00',
+			expires_at timestamp NOT NULL DEFAULT '1971-01-01 00:00:00',
+			PRIMARY KEY (anchor)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS scheduled_revert (
+			revert_uid varchar(128) CHARACTER SET ascii NOT NULL,
+			hostname varchar(128) CHARACTER SET ascii NOT NULL,
+			port smallint(5) unsigned NOT NULL,
+			action varchar(64) CHARACTER SET ascii NOT NULL,
+			revert_action varchar(64) CHARACTER SET ascii NOT NULL,
+			owner varchar(128) CHARACTER SET utf8 NOT NULL,
+			reason varchar(512) CHARACTER SET utf8 NOT NULL,
+			revert_status varchar(32) CHARACTER SET ascii NOT NULL,
+			scheduled_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			revert_at timestamp NOT NULL DEFAULT '1971-01-01 00:00:00',
+			count_attempts int unsigned NOT NULL DEFAULT 0,
+			last_error varchar(1024) CHARACTER SET utf8 NOT NULL DEFAULT '',
+			completed_at timestamp NOT NULL DEFAULT '1971-01-01 00:00:00',
+			PRIMARY KEY (revert_uid)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE INDEX revert_status_idx_scheduled_revert ON scheduled_revert (revert_status, revert_at)
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS database_instance_note (
+			hostname varchar(128) CHARACTER SET ascii NOT NULL,
+			port smallint(5) unsigned NOT NULL,
+			note text CHARACTER SET utf8 NOT NULL,
+			runbook_url varchar(1024) CHARACTER SET utf8 NOT NULL,
+			note_owner varchar(128) CHARACTER SET utf8 NOT NULL,
+			updated_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (hostname, port)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS cluster_note (
+			cluster_alias varchar(128) NOT NULL,
+			note text CHARACTER SET utf8 NOT NULL,
+			runbook_url varchar(1024) CHARACTER SET utf8 NOT NULL,
+			note_owner varchar(128) CHARACTER SET utf8 NOT NULL,
+			updated_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (cluster_alias)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS database_instance_probe_outcome (
+			hostname varchar(128) CHARACTER SET ascii NOT NULL,
+			port smallint(5) unsigned NOT NULL,
+			orchestrator_node varchar(128) CHARACTER SET ascii NOT NULL,
+			is_reachable tinyint unsigned NOT NULL DEFAULT 0,
+			outcome_since_unixtime int unsigned NOT NULL DEFAULT 0,
+			reported_unixtime int unsigned NOT NULL DEFAULT 0,
+			PRIMARY KEY (hostname, port, orchestrator_node)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE INDEX reported_unixtime_idx_database_instance_probe_outcome ON database_instance_probe_outcome (reported_unixtime)
+	`,
 }
@@ -0,0 +1,397 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package db
+
+// generateSQLMigrations lists the versioned migrations of the backend schema which follow the baseline schema
+// (generateSQLBase & generateSQLPatches). Add new migrations at the end of the list, with consecutive versions.
+// A deployed migration must never change: a backend only ever deploys migrations newer than its schema_version.
+var generateSQLMigrations = []SchemaMigration{
+	{
+		Version:     2,
+		Description: "MySQL error log events",
+		Statements: []string{
+			`
+				CREATE TABLE IF NOT EXISTS database_instance_error_log_event (
+					event_id bigint unsigned NOT NULL AUTO_INCREMENT,
+					hostname varchar(128) CHARACTER SET ascii NOT NULL,
+					port smallint unsigned NOT NULL,
+					pattern_name varchar(128) CHARACTER SET ascii NOT NULL,
+					is_problem tinyint unsigned NOT NULL DEFAULT 0,
+					log_line text CHARACTER SET utf8 NOT NULL,
+					event_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					PRIMARY KEY (event_id)
+				) ENGINE=InnoDB DEFAULT CHARSET=ascii
+			`,
+			`
+				CREATE INDEX host_port_event_timestamp_idx_database_instance_error_log_event ON database_instance_error_log_event (hostname, port, event_timestamp)
+			`,
+			`
+				CREATE INDEX event_timestamp_idx_database_instance_error_log_event ON database_instance_error_log_event (event_timestamp)
+			`,
+		},
+	},
+	{
+		Version:     3,
+		Description: "instance decommissions",
+		Statements: []string{
+			`
+				CREATE TABLE IF NOT EXISTS instance_decommission (
+					hostname varchar(128) CHARACTER SET ascii NOT NULL,
+					port smallint unsigned NOT NULL,
+					cluster_name varchar(128) CHARACTER SET ascii NOT NULL,
+					owner varchar(128) CHARACTER SET utf8 NOT NULL,
+					reason varchar(512) CHARACTER SET utf8 NOT NULL,
+					decommission_status varchar(32) CHARACTER SET ascii NOT NULL,
+					decommissioned_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					forget_at timestamp NOT NULL DEFAULT '1971-01-01 00:00:00',
+					count_attempts int unsigned NOT NULL DEFAULT 0,
+					last_error varchar(1024) CHARACTER SET utf8 NOT NULL DEFAULT '',
+					completed_at timestamp NOT NULL DEFAULT '1971-01-01 00:00:00',
+					PRIMARY KEY (hostname, port)
+				) ENGINE=InnoDB DEFAULT CHARSET=ascii
+			`,
+			`
+				CREATE INDEX decommission_status_idx_instance_decommission ON instance_decommission (decommission_status, forget_at)
+			`,
+		},
+	},
+	{
+		Version:     4,
+		Description: "topology recovery abort requests",
+		Statements: []string{
+			`
+				CREATE TABLE IF NOT EXISTS topology_recovery_abort (
+					recovery_uid varchar(128) CHARACTER SET ascii NOT NULL,
+					requested_by varchar(128) CHARACTER SET utf8 NOT NULL,
+					reason varchar(1024) CHARACTER SET utf8 NOT NULL DEFAULT '',
+					requested_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					PRIMARY KEY (recovery_uid)
+				) ENGINE=InnoDB DEFAULT CHARSET=ascii
+			`,
+			`
+				CREATE INDEX requested_timestamp_idx_topology_recovery_abort ON topology_recovery_abort (requested_timestamp)
+			`,
+		},
+	},
+	{
+		Version:     5,
+		Description: "state event subscriptions",
+		Statements: []string{
+			`
+				CREATE TABLE IF NOT EXISTS state_event_subscription (
+					subscription_name varchar(128) CHARACTER SET ascii NOT NULL,
+					topic varchar(255) CHARACTER SET ascii NOT NULL,
+					cluster_pattern varchar(512) CHARACTER SET utf8 NOT NULL DEFAULT '',
+					event_types varchar(1024) CHARACTER SET ascii NOT NULL DEFAULT '',
+					min_severity varchar(32) CHARACTER SET ascii NOT NULL DEFAULT '',
+					owner varchar(128) CHARACTER SET utf8 NOT NULL DEFAULT '',
+					created_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					PRIMARY KEY (subscription_name)
+				) ENGINE=InnoDB DEFAULT CHARSET=ascii
+			`,
+		},
+	},
+	{
+		Version:     6,
+		Description: "semi-sync configuration and status counters",
+		Statements: []string{
+			`
+				ALTER TABLE database_instance ADD COLUMN semi_sync_master_configured tinyint unsigned NOT NULL DEFAULT 0
+			`,
+			`
+				ALTER TABLE database_instance ADD COLUMN semi_sync_master_timeout int unsigned NOT NULL DEFAULT 0
+			`,
+			`
+				ALTER TABLE database_instance ADD COLUMN semi_sync_master_wait_point varchar(32) CHARACTER SET ascii NOT NULL DEFAULT ''
+			`,
+			`
+				ALTER TABLE database_instance ADD COLUMN semi_sync_master_wait_for_slave_count int unsigned NOT NULL DEFAULT 0
+			`,
+			`
+				ALTER TABLE database_instance ADD COLUMN semi_sync_master_clients int unsigned NOT NULL DEFAULT 0
+			`,
+			`
+				ALTER TABLE database_instance ADD COLUMN semi_sync_master_yes_tx bigint unsigned NOT NULL DEFAULT 0
+			`,
+			`
+				ALTER TABLE database_instance ADD COLUMN semi_sync_master_no_tx bigint unsigned NOT NULL DEFAULT 0
+			`,
+			`
+				ALTER TABLE database_instance ADD COLUMN semi_sync_master_no_times bigint unsigned NOT NULL DEFAULT 0
+			`,
+		},
+	},
+	{
+		Version:     7,
+		Description: "persisted discovery metrics",
+		Statements: []string{
+			`
+				CREATE TABLE IF NOT EXISTS discovery_metric (
+					metric_id bigint unsigned NOT NULL AUTO_INCREMENT,
+					orchestrator_host varchar(128) CHARACTER SET ascii NOT NULL,
+					hostname varchar(128) CHARACTER SET ascii NOT NULL,
+					port smallint unsigned NOT NULL,
+					metric_unixtime_micros bigint unsigned NOT NULL,
+					queue_wait_latency_micros bigint unsigned NOT NULL DEFAULT 0,
+					backend_read_latency_micros bigint unsigned NOT NULL DEFAULT 0,
+					backend_write_latency_micros bigint unsigned NOT NULL DEFAULT 0,
+					instance_latency_micros bigint unsigned NOT NULL DEFAULT 0,
+					total_latency_micros bigint unsigned NOT NULL DEFAULT 0,
+					replica_rows_written int unsigned NOT NULL DEFAULT 0,
+					error varchar(1024) CHARACTER SET utf8 NOT NULL DEFAULT '',
+					PRIMARY KEY (metric_id)
+				) ENGINE=InnoDB DEFAULT CHARSET=ascii
+			`,
+			`
+				CREATE INDEX metric_unixtime_micros_idx_discovery_metric ON discovery_metric (metric_unixtime_micros)
+			`,
+		},
+	},
+	{
+		Version:     8,
+		Description: "scheduled revert topology",
+		Statements: []string{
+			`
+				ALTER TABLE scheduled_revert ADD COLUMN cluster_alias varchar(128) CHARACTER SET utf8 NOT NULL DEFAULT ''
+			`,
+			`
+				ALTER TABLE scheduled_revert ADD COLUMN is_master tinyint unsigned NOT NULL DEFAULT 0
+			`,
+			`
+				ALTER TABLE scheduled_revert ADD COLUMN master_host varchar(128) CHARACTER SET ascii NOT NULL DEFAULT ''
+			`,
+			`
+				ALTER TABLE scheduled_revert ADD COLUMN master_port smallint unsigned NOT NULL DEFAULT 0
+			`,
+		},
+	},
+	{
+		Version:     9,
+		Description: "recovery timings by cluster alias",
+		Statements: []string{
+			`
+				CREATE INDEX cluster_alias_idx_topology_recovery_timing ON topology_recovery_timing (cluster_alias, recovery_started_at)
+			`,
+		},
+	},
+	{
+		Version:     10,
+		Description: "master pins by cluster alias",
+		Statements: []string{
+			`
+				CREATE TABLE IF NOT EXISTS cluster_master_pin (
+					cluster_alias varchar(128) CHARACTER SET utf8 NOT NULL,
+					cluster_name varchar(128) CHARACTER SET ascii NOT NULL,
+					hostname varchar(128) CHARACTER SET ascii NOT NULL,
+					port smallint(5) unsigned NOT NULL,
+					pin_owner varchar(128) CHARACTER SET utf8 NOT NULL,
+					pin_reason varchar(128) CHARACTER SET utf8 NOT NULL,
+					pin_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					PRIMARY KEY (cluster_alias)
+				) ENGINE=InnoDB DEFAULT CHARSET=ascii
+			`,
+			`
+				REPLACE INTO cluster_master_pin (
+					cluster_alias, cluster_name, hostname, port, pin_owner, pin_reason, pin_timestamp
+				)
+				SELECT
+					IFNULL(cluster_alias.alias, cluster_pinned_master.cluster_name),
+					cluster_pinned_master.cluster_name,
+					cluster_pinned_master.hostname,
+					cluster_pinned_master.port,
+					cluster_pinned_master.pin_owner,
+					cluster_pinned_master.pin_reason,
+					cluster_pinned_master.pin_timestamp
+				FROM
+					cluster_pinned_master
+					LEFT JOIN cluster_alias ON (cluster_alias.cluster_name = cluster_pinned_master.cluster_name)
+			`,
+			`
+				DROP TABLE IF EXISTS cluster_pinned_master
+			`,
+		},
+	},
+	{
+		Version:     11,
+		Description: "dead master postmortem watches",
+		Statements: []string{
+			`
+				CREATE TABLE IF NOT EXISTS dead_master_postmortem_watch (
+					hostname varchar(128) CHARACTER SET ascii NOT NULL,
+					port smallint(5) unsigned NOT NULL,
+					recovery_uid varchar(128) CHARACTER SET ascii NOT NULL,
+					recovery_end_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					expires_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					PRIMARY KEY (hostname, port)
+				) ENGINE=InnoDB DEFAULT CHARSET=ascii
+			`,
+			`
+				CREATE INDEX expires_at_idx_dead_master_postmortem_watch ON dead_master_postmortem_watch (expires_at)
+			`,
+		},
+	},
+	{
+		Version:     12,
+		Description: "desired topologies by cluster alias",
+		Statements: []string{
+			`
+				CREATE TABLE IF NOT EXISTS desired_cluster_topology (
+					cluster_alias varchar(128) CHARACTER SET utf8 NOT NULL,
+					desired_topology varchar(128) CHARACTER SET ascii NOT NULL,
+					last_updated timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					PRIMARY KEY (cluster_alias)
+				) ENGINE=InnoDB DEFAULT CHARSET=ascii
+			`,
+			`
+				REPLACE INTO desired_cluster_topology (
+					cluster_alias, desired_topology, last_updated
+				)
+				SELECT
+					IFNULL(cluster_alias.alias, cluster_desired_topology.cluster_name),
+					cluster_desired_topology.desired_topology,
+					cluster_desired_topology.last_updated
+				FROM
+					cluster_desired_topology
+					LEFT JOIN cluster_alias ON (cluster_alias.cluster_name = cluster_desired_topology.cluster_name)
+			`,
+			`
+				DROP TABLE IF EXISTS cluster_desired_topology
+			`,
+		},
+	},
+	{
+		Version:     13,
+		Description: "cluster locks by cluster alias",
+		Statements: []string{
+			`
+				CREATE TABLE IF NOT EXISTS cluster_advisory_lock (
+					cluster_alias varchar(128) CHARACTER SET utf8 NOT NULL,
+					cluster_name varchar(128) CHARACTER SET ascii NOT NULL,
+					lock_owner varchar(128) CHARACTER SET utf8 NOT NULL,
+					lock_reason varchar(128) CHARACTER SET utf8 NOT NULL,
+					lock_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					lock_expires_at timestamp NOT NULL DEFAULT '1971-01-01 00:00:00',
+					PRIMARY KEY (cluster_alias)
+				) ENGINE=InnoDB DEFAULT CHARSET=ascii
+			`,
+			`
+				REPLACE INTO cluster_advisory_lock (
+					cluster_alias, cluster_name, lock_owner, lock_reason, lock_timestamp, lock_expires_at
+				)
+				SELECT
+					IFNULL(cluster_alias.alias, cluster_lock.cluster_name),
+					cluster_lock.cluster_name,
+					cluster_lock.lock_owner,
+					cluster_lock.lock_reason,
+					cluster_lock.lock_timestamp,
+					cluster_lock.lock_expires_at
+				FROM
+					cluster_lock
+					LEFT JOIN cluster_alias ON (cluster_alias.cluster_name = cluster_lock.cluster_name)
+			`,
+			`
+				DROP TABLE IF EXISTS cluster_lock
+			`,
+		},
+	},
+	{
+		Version:     14,
+		Description: "discovery pauses by cluster alias",
+		Statements: []string{
+			`
+				CREATE TABLE IF NOT EXISTS discovery_paused_cluster (
+					cluster_alias varchar(128) CHARACTER SET utf8 NOT NULL,
+					cluster_name varchar(128) CHARACTER SET ascii NOT NULL,
+					pause_owner varchar(128) CHARACTER SET utf8 NOT NULL,
+					pause_reason varchar(128) CHARACTER SET utf8 NOT NULL,
+					pause_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					pause_expires_at timestamp NOT NULL DEFAULT '1971-01-01 00:00:00',
+					PRIMARY KEY (cluster_alias)
+				) ENGINE=InnoDB DEFAULT CHARSET=ascii
+			`,
+			`
+				REPLACE INTO discovery_paused_cluster (
+					cluster_alias, cluster_name, pause_owner, pause_reason, pause_timestamp, pause_expires_at
+				)
+				SELECT
+					IFNULL(cluster_alias.alias, cluster_discovery_pause.cluster_name),
+					cluster_discovery_pause.cluster_name,
+					cluster_discovery_pause.pause_owner,
+					cluster_discovery_pause.pause_reason,
+					cluster_discovery_pause.pause_timestamp,
+					cluster_discovery_pause.pause_expires_at
+				FROM
+					cluster_discovery_pause
+					LEFT JOIN cluster_alias ON (cluster_alias.cluster_name = cluster_discovery_pause.cluster_name)
+			`,
+			`
+				DROP TABLE IF EXISTS cluster_discovery_pause
+			`,
+		},
+	},
+	{
+		Version:     15,
+		Description: "schema migrations by cluster alias",
+		Statements: []string{
+			`
+				CREATE TABLE IF NOT EXISTS online_schema_migration (
+					cluster_alias varchar(128) CHARACTER SET utf8 NOT NULL,
+					migration_id varchar(128) CHARACTER SET utf8 NOT NULL,
+					cluster_name varchar(128) CHARACTER SET ascii NOT NULL,
+					migration_owner varchar(128) CHARACTER SET utf8 NOT NULL,
+					description varchar(1024) CHARACTER SET utf8 NOT NULL,
+					suppressed_actions varchar(512) CHARACTER SET ascii NOT NULL,
+					start_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					expires_at timestamp NOT NULL DEFAULT '1971-01-01 00:00:00',
+					PRIMARY KEY (cluster_alias, migration_id)
+				) ENGINE=InnoDB DEFAULT CHARSET=ascii
+			`,
+			`
+				REPLACE INTO online_schema_migration (
+					cluster_alias, migration_id, cluster_name, migration_owner, description, suppressed_actions, start_timestamp, expires_at
+				)
+				SELECT
+					IFNULL(cluster_alias.alias, cluster_schema_migration.cluster_name),
+					cluster_schema_migration.migration_id,
+					cluster_schema_migration.cluster_name,
+					cluster_schema_migration.migration_owner,
+					cluster_schema_migration.description,
+					cluster_schema_migration.suppressed_actions,
+					cluster_schema_migration.start_timestamp,
+					cluster_schema_migration.expires_at
+				FROM
+					cluster_schema_migration
+					LEFT JOIN cluster_alias ON (cluster_alias.cluster_name = cluster_schema_migration.cluster_name)
+			`,
+			`
+				DROP TABLE IF EXISTS cluster_schema_migration
+			`,
+		},
+	},
+	{
+		Version:     16,
+		Description: "recovery approval consumption",
+		Statements: []string{
+			`
+				ALTER TABLE topology_recovery ADD COLUMN approval_uid varchar(128) CHARACTER SET ascii DEFAULT NULL
+			`,
+			`
+				CREATE UNIQUE INDEX approval_uid_uidx_topology_recovery ON topology_recovery (approval_uid)
+			`,
+		},
+	},
+}
@@ -16,8 +16,8 @@
 
 package db
 
-// generateSQLPatches contains DDLs for patching schema to the latest version.
-// Add new statements at the end of the list so they form a changelog.
+// generateSQLPatches contains DDLs for patching schema to the baseline version.
+// The baseline is complete: new schema changes are added as versioned migrations, in generateSQLMigrations.
 var generateSQLPatches = []string{
 	`
 		ALTER TABLE
@@ -510,4 +510,89 @@ var generateSQLPatches = []string{
 			database_instance
 			ADD COLUMN last_check_partial_success tinyint unsigned NOT NULL after last_attempted_check
 	`,
+	`
+		ALTER TABLE
+			database_instance
+			ADD COLUMN write_probe_failing TINYINT UNSIGNED NOT NULL DEFAULT 0
+	`,
+	`
+		ALTER TABLE
+			database_instance
+			ADD COLUMN write_probe_value BIGINT NOT NULL DEFAULT 0
+	`,
+	`
+		ALTER TABLE
+			database_instance
+			ADD COLUMN replicated_write_probe_value BIGINT NOT NULL DEFAULT 0
+	`,
+	`
+		ALTER TABLE
+			topology_recovery
+			ADD COLUMN data_center varchar(32) CHARACTER SET ascii NOT NULL DEFAULT ''
+	`,
+	`
+		ALTER TABLE
+			candidate_database_instance
+			ADD COLUMN expires_at timestamp NULL
+	`,
+	`
+		ALTER TABLE
+			database_instance
+			ADD COLUMN last_sql_errno INT UNSIGNED NOT NULL DEFAULT 0 AFTER last_io_error
+	`,
+	`
+		ALTER TABLE
+			database_instance
+			ADD COLUMN last_io_errno INT UNSIGNED NOT NULL DEFAULT 0 AFTER last_sql_errno
+	`,
+	`
+		ALTER TABLE
+			database_instance
+			ADD COLUMN replication_lag_source varchar(32) CHARACTER SET ascii NOT NULL DEFAULT ''
+	`,
+	`
+		ALTER TABLE
+			database_instance_downtime
+			ADD COLUMN inherited_from_hostname varchar(128) NOT NULL DEFAULT ''
+	`,
+	`
+		ALTER TABLE
+			database_instance_downtime
+			ADD COLUMN inherited_from_port smallint(5) unsigned NOT NULL DEFAULT 0
+	`,
+	`
+		ALTER TABLE
+			topology_failure_detection
+			ADD COLUMN analyzed_instance_last_seen timestamp NULL
+	`,
+	`
+		ALTER TABLE
+			database_instance
+			ADD COLUMN count_threads int unsigned NOT NULL DEFAULT 0
+	`,
+	`
+		ALTER TABLE
+			database_instance
+			ADD COLUMN count_active_threads int unsigned NOT NULL DEFAULT 0
+	`,
+	`
+		ALTER TABLE
+			database_instance
+			ADD COLUMN longest_applier_trx_seconds int unsigned NOT NULL DEFAULT 0
+	`,
+	`
+		ALTER TABLE
+			agent_seed
+			ADD COLUMN donor_selection varchar(1024) CHARACTER SET utf8 NOT NULL DEFAULT ''
+	`,
+	`
+		ALTER TABLE
+			database_instance
+			ADD COLUMN grouping_dimensions varchar(1024) CHARACTER SET utf8 NOT NULL DEFAULT ''
+	`,
+	`
+		ALTER TABLE
+			topology_recovery
+			ADD COLUMN block_until_unixtime int unsigned NOT NULL DEFAULT 0
+	`,
 }
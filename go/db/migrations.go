@@ -0,0 +1,232 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/openark/golib/log"
+)
+
+// baselineSchemaVersion is the version of the schema built by generateSQLBase & generateSQLPatches. The baseline is
+// deployed as a whole and is idempotent, so that backends deployed before schema versioning simply redeploy it.
+const baselineSchemaVersion = 1
+
+// explicitSchemaUpgrade is set when the backend schema is explicitly upgraded via upgrade-backend, in which case
+// opening the backend neither checks nor deploys the schema
+var explicitSchemaUpgrade int64
+
+// SchemaMigration is a versioned change of the backend schema
+type SchemaMigration struct {
+	Version     uint
+	Description string
+	Statements  []string
+}
+
+// BackendSchemaStatus compares the schema version deployed on the backend with the latest version known to
+// this orchestrator
+type BackendSchemaStatus struct {
+	DeployedVersion   uint
+	LatestVersion     uint
+	PendingMigrations []SchemaMigration
+}
+
+// IsUpToDate checks whether the backend has all known migrations deployed
+func (this *BackendSchemaStatus) IsUpToDate() bool {
+	return this.DeployedVersion == this.LatestVersion
+}
+
+// IsNewer checks whether the backend was migrated by a newer orchestrator, beyond the migrations known to this one
+func (this *BackendSchemaStatus) IsNewer() bool {
+	return this.DeployedVersion > this.LatestVersion
+}
+
+// schemaMigrations lists all migrations of the backend schema, in order, starting with the baseline
+func schemaMigrations() []SchemaMigration {
+	baseline := SchemaMigration{
+		Version:     baselineSchemaVersion,
+		Description: "baseline schema",
+		Statements:  append(append([]string{}, generateSQLBase...), generateSQLPatches...),
+	}
+	return append([]SchemaMigration{baseline}, generateSQLMigrations...)
+}
+
+// validateSchemaMigrations checks that migrations have consecutive versions
+func validateSchemaMigrations(migrations []SchemaMigration) error {
+	for i, migration := range migrations {
+		if migration.Version != uint(i+baselineSchemaVersion) {
+			return fmt.Errorf("Schema migration %q has version %d; expected %d", migration.Description, migration.Version, i+baselineSchemaVersion)
+		}
+	}
+	return nil
+}
+
+// isMissingTableError checks whether given error is that of querying a table which does not exist, on MySQL
+// ("Table '...' doesn't exist") or on SQLite ("no such table")
+func isMissingTableError(err error) bool {
+	return strings.Contains(err.Error(), "doesn't exist") || strings.Contains(err.Error(), "no such table")
+}
+
+// readDeployedSchemaVersion reads the latest migration version deployed on the backend. Backends deployed
+// before schema versioning, as well as empty backends, have no schema_version table, and are at version 0.
+// Any other error, e.g. a backend gone bad, fails the read rather than have the whole schema redeployed.
+func readDeployedSchemaVersion(db *sql.DB) (version uint, err error) {
+	var deployedVersion sql.NullInt64
+	if err := db.QueryRow(`select max(version) from schema_version`).Scan(&deployedVersion); err != nil {
+		if isMissingTableError(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("Cannot read backend schema version: %+v", err)
+	}
+	return uint(deployedVersion.Int64), nil
+}
+
+// registerSchemaMigration records a deployed migration in the schema_version table
+func registerSchemaMigration(db *sql.DB, migration *SchemaMigration) error {
+	if _, err := execInternal(db, `
+		CREATE TABLE IF NOT EXISTS schema_version (
+			version int unsigned NOT NULL,
+			description varchar(128) CHARACTER SET utf8 NOT NULL,
+			orchestrator_version varchar(128) CHARACTER SET ascii NOT NULL,
+			deployed_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (version)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+		`); err != nil {
+		return err
+	}
+	_, err := execInternal(db, `
+		replace into schema_version (
+			version, description, orchestrator_version, deployed_timestamp
+		) values (
+			?, ?, ?, NOW()
+		)
+		`, migration.Version, migration.Description, config.RuntimeCLIFlags.ConfiguredVersion)
+	return err
+}
+
+// readBackendSchemaStatus lists the migrations not yet deployed on the backend
+func readBackendSchemaStatus(db *sql.DB) (*BackendSchemaStatus, error) {
+	migrations := schemaMigrations()
+	if err := validateSchemaMigrations(migrations); err != nil {
+		return nil, err
+	}
+	deployedVersion, err := readDeployedSchemaVersion(db)
+	if err != nil {
+		return nil, err
+	}
+	status := &BackendSchemaStatus{
+		DeployedVersion:   deployedVersion,
+		LatestVersion:     migrations[len(migrations)-1].Version,
+		PendingMigrations: []SchemaMigration{},
+	}
+	for _, migration := range migrations {
+		if migration.Version > deployedVersion {
+			status.PendingMigrations = append(status.PendingMigrations, migration)
+		}
+	}
+	return status, nil
+}
+
+// checkBackendSchemaCompatibility checks whether this orchestrator may run on a backend of given schema status:
+// the backend must not have been migrated beyond this orchestrator's latest version, and must have all migrations
+// deployed when this orchestrator does not deploy them (SkipOrchestratorDatabaseUpdate).
+func checkBackendSchemaCompatibility(status *BackendSchemaStatus) error {
+	if status.IsNewer() {
+		return fmt.Errorf("Backend schema is at version %d, newer than version %d supported by this orchestrator", status.DeployedVersion, status.LatestVersion)
+	}
+	if !status.IsUpToDate() && config.Config.SkipOrchestratorDatabaseUpdate {
+		return fmt.Errorf("Backend schema is at version %d, behind version %d required by this orchestrator, and SkipOrchestratorDatabaseUpdate is set. Upgrade via: orchestrator -c upgrade-backend", status.DeployedVersion, status.LatestVersion)
+	}
+	return nil
+}
+
+// deploySchemaMigrations deploys given migrations in order, registering each as it completes
+func deploySchemaMigrations(db *sql.DB, migrations []SchemaMigration) error {
+	for _, migration := range migrations {
+		log.Infof("Deploying backend schema migration %d: %s", migration.Version, migration.Description)
+		if err := deployStatements(db, migration.Statements); err != nil {
+			return err
+		}
+		if err := registerSchemaMigration(db, &migration); err != nil {
+			return log.Errore(err)
+		}
+	}
+	return nil
+}
+
+// PendingSchemaStatements lists the statements of given migrations, as would be executed on the backend
+func PendingSchemaStatements(migrations []SchemaMigration) (statements []string, err error) {
+	for _, migration := range migrations {
+		statements = append(statements, fmt.Sprintf("-- migration %d: %s", migration.Version, migration.Description))
+		for _, statement := range migration.Statements {
+			statement, err := translateStatement(statement)
+			if err != nil {
+				return statements, err
+			}
+			statements = append(statements, fmt.Sprintf("%s;", statement))
+		}
+	}
+	return statements, nil
+}
+
+// UpgradeBackendSchema deploys the migrations pending on the backend. With dryRun, the backend is left untouched,
+// and the returned status lists the pending migrations.
+func UpgradeBackendSchema(dryRun bool) (*BackendSchemaStatus, error) {
+	atomic.StoreInt64(&explicitSchemaUpgrade, 1)
+	db, err := OpenOrchestrator()
+	if err != nil {
+		return nil, err
+	}
+	status, err := readBackendSchemaStatus(db)
+	if err != nil {
+		return nil, err
+	}
+	if status.IsNewer() {
+		return status, fmt.Errorf("Backend schema is at version %d, newer than version %d supported by this orchestrator; cannot downgrade", status.DeployedVersion, status.LatestVersion)
+	}
+	if dryRun || status.IsUpToDate() {
+		return status, nil
+	}
+	if err := deploySchemaMigrations(db, status.PendingMigrations); err != nil {
+		return status, err
+	}
+	return status, registerOrchestratorDeployment(db)
+}
+
+// RedeployBackendSchema deploys all migrations onto the backend, regardless of its schema version
+func RedeployBackendSchema() (*BackendSchemaStatus, error) {
+	atomic.StoreInt64(&explicitSchemaUpgrade, 1)
+	db, err := OpenOrchestrator()
+	if err != nil {
+		return nil, err
+	}
+	status, err := readBackendSchemaStatus(db)
+	if err != nil {
+		return nil, err
+	}
+	if status.IsNewer() {
+		return status, fmt.Errorf("Backend schema is at version %d, newer than version %d supported by this orchestrator; cannot redeploy", status.DeployedVersion, status.LatestVersion)
+	}
+	if err := deploySchemaMigrations(db, schemaMigrations()); err != nil {
+		return status, err
+	}
+	return status, registerOrchestratorDeployment(db)
+}
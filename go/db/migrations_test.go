@@ -0,0 +1,133 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package db
+
+import (
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/github/orchestrator/go/config"
+	test "github.com/openark/golib/tests"
+)
+
+// withSQLiteSchemaUpgrade points the backend at a fresh, empty, sqlite database, which is not deployed upon
+// opening, for the duration of given test
+func withSQLiteSchemaUpgrade(t *testing.T) {
+	backendDB, dataFile, skipUpdate := config.Config.BackendDB, config.Config.SQLite3DataFile, config.Config.SkipOrchestratorDatabaseUpdate
+	config.Config.BackendDB = "sqlite"
+	config.Config.SQLite3DataFile = filepath.Join(t.TempDir(), "orchestrator.sqlite3")
+	atomic.StoreInt64(&explicitSchemaUpgrade, 1)
+	t.Cleanup(func() {
+		config.Config.BackendDB, config.Config.SQLite3DataFile, config.Config.SkipOrchestratorDatabaseUpdate = backendDB, dataFile, skipUpdate
+		atomic.StoreInt64(&explicitSchemaUpgrade, 0)
+	})
+}
+
+func TestValidateSchemaMigrations(t *testing.T) {
+	migrations := schemaMigrations()
+	test.S(t).ExpectNil(validateSchemaMigrations(migrations))
+	test.S(t).ExpectEquals(migrations[0].Version, uint(baselineSchemaVersion))
+
+	test.S(t).ExpectNotNil(validateSchemaMigrations(migrations[1:]))
+	skipping := append(append([]SchemaMigration{}, migrations[:2]...), migrations[3:]...)
+	test.S(t).ExpectNotNil(validateSchemaMigrations(skipping))
+	duplicate := append(append([]SchemaMigration{}, migrations...), migrations[len(migrations)-1])
+	test.S(t).ExpectNotNil(validateSchemaMigrations(duplicate))
+}
+
+func TestCheckBackendSchemaCompatibility(t *testing.T) {
+	skipUpdate := config.Config.SkipOrchestratorDatabaseUpdate
+	defer func() { config.Config.SkipOrchestratorDatabaseUpdate = skipUpdate }()
+
+	config.Config.SkipOrchestratorDatabaseUpdate = false
+	test.S(t).ExpectNil(checkBackendSchemaCompatibility(&BackendSchemaStatus{DeployedVersion: 5, LatestVersion: 5}))
+	test.S(t).ExpectNil(checkBackendSchemaCompatibility(&BackendSchemaStatus{DeployedVersion: 0, LatestVersion: 5}))
+	test.S(t).ExpectNil(checkBackendSchemaCompatibility(&BackendSchemaStatus{DeployedVersion: 3, LatestVersion: 5}))
+	test.S(t).ExpectNotNil(checkBackendSchemaCompatibility(&BackendSchemaStatus{DeployedVersion: 6, LatestVersion: 5}))
+
+	config.Config.SkipOrchestratorDatabaseUpdate = true
+	test.S(t).ExpectNil(checkBackendSchemaCompatibility(&BackendSchemaStatus{DeployedVersion: 5, LatestVersion: 5}))
+	test.S(t).ExpectNotNil(checkBackendSchemaCompatibility(&BackendSchemaStatus{DeployedVersion: 3, LatestVersion: 5}))
+	test.S(t).ExpectNotNil(checkBackendSchemaCompatibility(&BackendSchemaStatus{DeployedVersion: 6, LatestVersion: 5}))
+}
+
+func TestReadBackendSchemaStatus(t *testing.T) {
+	withSQLiteSchemaUpgrade(t)
+	db, err := OpenOrchestrator()
+	test.S(t).ExpectNil(err)
+
+	// An empty backend has no schema_version table
+	status, err := readBackendSchemaStatus(db)
+	test.S(t).ExpectNil(err)
+	migrations := schemaMigrations()
+	test.S(t).ExpectEquals(status.DeployedVersion, uint(0))
+	test.S(t).ExpectEquals(status.LatestVersion, migrations[len(migrations)-1].Version)
+	test.S(t).ExpectEquals(len(status.PendingMigrations), len(migrations))
+	test.S(t).ExpectFalse(status.IsUpToDate())
+
+	test.S(t).ExpectNil(deploySchemaMigrations(db, migrations[:2]))
+	status, err = readBackendSchemaStatus(db)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(status.DeployedVersion, migrations[1].Version)
+	test.S(t).ExpectEquals(len(status.PendingMigrations), len(migrations)-2)
+	test.S(t).ExpectEquals(status.PendingMigrations[0].Version, migrations[2].Version)
+
+	// Errors other than a missing table are not taken for an empty backend
+	_, err = execInternal(db, `drop table schema_version`)
+	test.S(t).ExpectNil(err)
+	_, err = execInternal(db, `create table schema_version (other_column int)`)
+	test.S(t).ExpectNil(err)
+	_, err = readBackendSchemaStatus(db)
+	test.S(t).ExpectNotNil(err)
+}
+
+func TestUpgradeBackendSchema(t *testing.T) {
+	withSQLiteSchemaUpgrade(t)
+	migrations := schemaMigrations()
+	latestVersion := migrations[len(migrations)-1].Version
+
+	// A dry run leaves the backend untouched
+	status, err := UpgradeBackendSchema(true)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(status.PendingMigrations), len(migrations))
+	db, err := OpenOrchestrator()
+	test.S(t).ExpectNil(err)
+	deployedVersion, err := readDeployedSchemaVersion(db)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(deployedVersion, uint(0))
+
+	status, err = UpgradeBackendSchema(false)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(status.DeployedVersion, uint(0))
+	deployedVersion, err = readDeployedSchemaVersion(db)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(deployedVersion, latestVersion)
+
+	// Upgrading an up to date backend is a no-op
+	status, err = UpgradeBackendSchema(false)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(status.IsUpToDate())
+	test.S(t).ExpectEquals(len(status.PendingMigrations), 0)
+
+	// A backend migrated by a newer orchestrator is not downgraded
+	test.S(t).ExpectNil(registerSchemaMigration(db, &SchemaMigration{Version: latestVersion + 1, Description: "from the future"}))
+	status, err = UpgradeBackendSchema(false)
+	test.S(t).ExpectNotNil(err)
+	test.S(t).ExpectTrue(status.IsNewer())
+	test.S(t).ExpectNotNil(checkBackendSchemaCompatibility(status))
+}
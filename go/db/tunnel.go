@@ -0,0 +1,295 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package db
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/github/orchestrator/go/config"
+)
+
+// tunnelNetwork is a custom network registered with the MySQL driver, routing topology connections
+// through the tunnels configured for the hosts' data centers
+const tunnelNetwork = "tcp-tunnel"
+
+func init() {
+	mysql.RegisterDial(tunnelNetwork, dialTunnel)
+}
+
+// getTopologyMySQLNetwork returns the network by which the MySQL driver connects to topology servers
+func getTopologyMySQLNetwork() string {
+	if len(config.Config.TopologyTunnels) > 0 {
+		return tunnelNetwork
+	}
+	return getMySQLNetwork()
+}
+
+// dataCenterRegexps holds compiled DataCenterPattern, such that a pattern is compiled once rather than on each dial.
+// An invalid pattern maps to nil.
+var dataCenterRegexps = make(map[string]*regexp.Regexp)
+var dataCenterRegexpsMutex sync.Mutex
+
+// getDataCenter returns the data center of given host as per DataCenterPattern, or empty string if unknown
+func getDataCenter(host string) string {
+	if config.Config.DataCenterPattern == "" {
+		return ""
+	}
+	dataCenterRegexpsMutex.Lock()
+	pattern, found := dataCenterRegexps[config.Config.DataCenterPattern]
+	if !found {
+		pattern, _ = regexp.Compile(config.Config.DataCenterPattern)
+		dataCenterRegexps[config.Config.DataCenterPattern] = pattern
+	}
+	dataCenterRegexpsMutex.Unlock()
+	if pattern == nil {
+		return ""
+	}
+	if match := pattern.FindStringSubmatch(host); len(match) > 1 {
+		return match[1]
+	}
+	return ""
+}
+
+// dialTunnel connects to given address through the tunnel configured for its host's data center,
+// or directly if there is no such tunnel
+func dialTunnel(addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	timeout := time.Duration(config.Config.MySQLConnectTimeoutSeconds) * time.Second
+	tunnel := config.Config.GetTopologyTunnel(getDataCenter(host))
+	if tunnel == "" {
+		if config.Config.PreferIPv6 {
+			return dialPreferIPv6(addr)
+		}
+		return net.DialTimeout("tcp", addr, timeout)
+	}
+	tunnelURL, err := url.Parse(tunnel)
+	if err != nil {
+		return nil, err
+	}
+	switch tunnelURL.Scheme {
+	case "socks5":
+		return dialSOCKS5(tunnelURL, host, port, timeout)
+	case "ssh":
+		return dialSSH(tunnelURL, host, port, timeout)
+	}
+	return nil, fmt.Errorf("dialTunnel: unsupported tunnel: %s", tunnel)
+}
+
+// dialSOCKS5 connects to given host and port via a SOCKS5 proxy (RFC 1928), optionally authenticating
+// with username and password (RFC 1929). The host is resolved by the proxy.
+func dialSOCKS5(proxyURL *url.URL, host string, port string, timeout time.Duration) (conn net.Conn, err error) {
+	portNumber, err := strconv.Atoi(port)
+	if err != nil {
+		return nil, err
+	}
+	if len(host) > 255 {
+		return nil, fmt.Errorf("dialSOCKS5: host name too long: %s", host)
+	}
+	if conn, err = net.DialTimeout("tcp", proxyURL.Host, timeout); err != nil {
+		return nil, err
+	}
+	fail := func(err error) (net.Conn, error) {
+		conn.Close()
+		return nil, fmt.Errorf("dialSOCKS5: %s via %s: %+v", net.JoinHostPort(host, port), proxyURL.Host, err)
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	// Greeting: offer no authentication, and username/password authentication if we have credentials
+	greeting := []byte{5, 1, 0}
+	if proxyURL.User != nil {
+		greeting = []byte{5, 2, 0, 2}
+	}
+	if _, err := conn.Write(greeting); err != nil {
+		return fail(err)
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return fail(err)
+	}
+	if reply[0] != 5 {
+		return fail(fmt.Errorf("unexpected SOCKS version: %d", reply[0]))
+	}
+	switch reply[1] {
+	case 0:
+	case 2:
+		if proxyURL.User == nil {
+			return fail(fmt.Errorf("proxy requires authentication"))
+		}
+		username := proxyURL.User.Username()
+		password, _ := proxyURL.User.Password()
+		if len(username) > 255 || len(password) > 255 {
+			return fail(fmt.Errorf("username or password too long"))
+		}
+		request := []byte{1, byte(len(username))}
+		request = append(request, username...)
+		request = append(request, byte(len(password)))
+		request = append(request, password...)
+		if _, err := conn.Write(request); err != nil {
+			return fail(err)
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return fail(err)
+		}
+		if reply[1] != 0 {
+			return fail(fmt.Errorf("authentication failed"))
+		}
+	default:
+		return fail(fmt.Errorf("no acceptable authentication method"))
+	}
+
+	// Connect request, by domain name
+	request := []byte{5, 1, 0, 3, byte(len(host))}
+	request = append(request, host...)
+	request = append(request, byte(portNumber>>8), byte(portNumber))
+	if _, err := conn.Write(request); err != nil {
+		return fail(err)
+	}
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return fail(err)
+	}
+	if header[1] != 0 {
+		return fail(fmt.Errorf("connect request failed with reply code %d", header[1]))
+	}
+	// Skip the bound address and port
+	var boundAddressLength int
+	switch header[3] {
+	case 1:
+		boundAddressLength = net.IPv4len
+	case 4:
+		boundAddressLength = net.IPv6len
+	case 3:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return fail(err)
+		}
+		boundAddressLength = int(length[0])
+	default:
+		return fail(fmt.Errorf("unexpected address type %d", header[3]))
+	}
+	if _, err := io.ReadFull(conn, make([]byte, boundAddressLength+2)); err != nil {
+		return fail(err)
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// tunnelAddr is the address of an end of a tunneled connection
+type tunnelAddr struct {
+	address string
+}
+
+func (this tunnelAddr) Network() string { return tunnelNetwork }
+func (this tunnelAddr) String() string  { return this.address }
+
+// sshConn is a connection forwarded by an ssh jump host, over the standard input and output of an
+// `ssh -W` process. Pipes support deadlines, and so the driver's timeouts apply.
+type sshConn struct {
+	cmd        *exec.Cmd
+	reader     *os.File
+	writer     *os.File
+	localAddr  tunnelAddr
+	remoteAddr tunnelAddr
+}
+
+// dialSSH connects to given host and port via an ssh jump host, using the system's ssh client, and thus
+// its configuration and keys. ssh runs in batch mode: there is no prompting for passwords or host keys.
+func dialSSH(jumpURL *url.URL, host string, port string, timeout time.Duration) (net.Conn, error) {
+	args := []string{
+		"-W", net.JoinHostPort(host, port),
+		"-o", "BatchMode=yes",
+		"-o", fmt.Sprintf("ConnectTimeout=%d", int(timeout.Seconds())),
+		"-o", "ServerAliveInterval=10",
+	}
+	if jumpURL.Port() != "" {
+		args = append(args, "-p", jumpURL.Port())
+	}
+	destination := jumpURL.Hostname()
+	if jumpURL.User != nil && jumpURL.User.Username() != "" {
+		destination = fmt.Sprintf("%s@%s", jumpURL.User.Username(), destination)
+	}
+	args = append(args, destination)
+
+	stdinReader, stdinWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stdoutReader, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		stdinReader.Close()
+		stdinWriter.Close()
+		return nil, err
+	}
+	cmd := exec.Command("ssh", args...)
+	cmd.Stdin = stdinReader
+	cmd.Stdout = stdoutWriter
+	err = cmd.Start()
+	// The child process holds its own copies of these ends
+	stdinReader.Close()
+	stdoutWriter.Close()
+	if err != nil {
+		stdinWriter.Close()
+		stdoutReader.Close()
+		return nil, fmt.Errorf("dialSSH: %s via %s: %+v", net.JoinHostPort(host, port), destination, err)
+	}
+	return &sshConn{
+		cmd:        cmd,
+		reader:     stdoutReader,
+		writer:     stdinWriter,
+		localAddr:  tunnelAddr{address: destination},
+		remoteAddr: tunnelAddr{address: net.JoinHostPort(host, port)},
+	}, nil
+}
+
+func (this *sshConn) Read(b []byte) (int, error)  { return this.reader.Read(b) }
+func (this *sshConn) Write(b []byte) (int, error) { return this.writer.Write(b) }
+func (this *sshConn) LocalAddr() net.Addr         { return this.localAddr }
+func (this *sshConn) RemoteAddr() net.Addr        { return this.remoteAddr }
+
+func (this *sshConn) Close() error {
+	this.writer.Close()
+	this.reader.Close()
+	if this.cmd.Process != nil {
+		this.cmd.Process.Kill()
+	}
+	go this.cmd.Wait()
+	return nil
+}
+
+func (this *sshConn) SetDeadline(t time.Time) error {
+	if err := this.reader.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return this.writer.SetWriteDeadline(t)
+}
+
+func (this *sshConn) SetReadDeadline(t time.Time) error  { return this.reader.SetReadDeadline(t) }
+func (this *sshConn) SetWriteDeadline(t time.Time) error { return this.writer.SetWriteDeadline(t) }
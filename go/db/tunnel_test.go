@@ -0,0 +1,204 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package db
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	test "github.com/openark/golib/tests"
+)
+
+// testSOCKS5Proxy is a minimal SOCKS5 proxy, which answers connect requests with given reply code, and
+// echoes back data sent over connections it accepts
+type testSOCKS5Proxy struct {
+	listener  net.Listener
+	username  string
+	password  string
+	replyCode byte
+	targets   chan string
+}
+
+func newTestSOCKS5Proxy(t *testing.T, username string, password string, replyCode byte) *testSOCKS5Proxy {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	test.S(t).ExpectNil(err)
+	proxy := &testSOCKS5Proxy{listener: listener, username: username, password: password, replyCode: replyCode, targets: make(chan string, 10)}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go proxy.serve(conn)
+		}
+	}()
+	return proxy
+}
+
+func (this *testSOCKS5Proxy) serve(conn net.Conn) {
+	defer conn.Close()
+	greeting := make([]byte, 2)
+	if _, err := io.ReadFull(conn, greeting); err != nil {
+		return
+	}
+	methods := make([]byte, greeting[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return
+	}
+	method := byte(0)
+	if this.username != "" {
+		method = 0xff
+		for _, offered := range methods {
+			if offered == 2 {
+				method = 2
+			}
+		}
+	}
+	conn.Write([]byte{5, method})
+	switch method {
+	case 0xff:
+		return
+	case 2:
+		header := make([]byte, 2)
+		io.ReadFull(conn, header)
+		username := make([]byte, header[1])
+		io.ReadFull(conn, username)
+		length := make([]byte, 1)
+		io.ReadFull(conn, length)
+		password := make([]byte, length[0])
+		io.ReadFull(conn, password)
+		if string(username) != this.username || string(password) != this.password {
+			conn.Write([]byte{1, 1})
+			return
+		}
+		conn.Write([]byte{1, 0})
+	}
+	request := make([]byte, 5)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return
+	}
+	host := make([]byte, request[4])
+	io.ReadFull(conn, host)
+	port := make([]byte, 2)
+	io.ReadFull(conn, port)
+	this.targets <- net.JoinHostPort(string(host), strconv.Itoa(int(port[0])<<8|int(port[1])))
+
+	conn.Write([]byte{5, this.replyCode, 0, 1, 127, 0, 0, 1, 0x0c, 0xea})
+	if this.replyCode == 0 {
+		io.Copy(conn, conn)
+	}
+}
+
+func (this *testSOCKS5Proxy) url(userinfo string) *url.URL {
+	proxyURL, _ := url.Parse(fmt.Sprintf("socks5://%s%s", userinfo, this.listener.Addr().String()))
+	return proxyURL
+}
+
+// expectEcho checks that data sent over given connection is echoed back by the proxy
+func expectEcho(t *testing.T, conn net.Conn) {
+	_, err := conn.Write([]byte("select 1"))
+	test.S(t).ExpectNil(err)
+	echoed := make([]byte, 8)
+	_, err = io.ReadFull(conn, echoed)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(string(echoed), "select 1")
+}
+
+func TestDialSOCKS5(t *testing.T) {
+	timeout := 2 * time.Second
+	{
+		proxy := newTestSOCKS5Proxy(t, "", "", 0)
+		conn, err := dialSOCKS5(proxy.url(""), "db-1.east.example.com", "3306", timeout)
+		test.S(t).ExpectNil(err)
+		defer conn.Close()
+		test.S(t).ExpectEquals(<-proxy.targets, "db-1.east.example.com:3306")
+		expectEcho(t, conn)
+	}
+	{
+		proxy := newTestSOCKS5Proxy(t, "orchestrator", "secret", 0)
+		conn, err := dialSOCKS5(proxy.url("orchestrator:secret@"), "db-2", "3307", timeout)
+		test.S(t).ExpectNil(err)
+		defer conn.Close()
+		test.S(t).ExpectEquals(<-proxy.targets, "db-2:3307")
+		expectEcho(t, conn)
+	}
+	{
+		proxy := newTestSOCKS5Proxy(t, "orchestrator", "secret", 0)
+		_, err := dialSOCKS5(proxy.url("orchestrator:wrong@"), "db-2", "3306", timeout)
+		test.S(t).ExpectNotNil(err)
+
+		_, err = dialSOCKS5(proxy.url(""), "db-2", "3306", timeout)
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		// Connection refused by the proxy's target
+		proxy := newTestSOCKS5Proxy(t, "", "", 5)
+		_, err := dialSOCKS5(proxy.url(""), "db-3", "3306", timeout)
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		_, err := dialSOCKS5(newTestSOCKS5Proxy(t, "", "", 0).url(""), "db-3", "mysql", timeout)
+		test.S(t).ExpectNotNil(err)
+	}
+}
+
+func TestDialTunnel(t *testing.T) {
+	dataCenterPattern, topologyTunnels := config.Config.DataCenterPattern, config.Config.TopologyTunnels
+	defer func() {
+		config.Config.DataCenterPattern, config.Config.TopologyTunnels = dataCenterPattern, topologyTunnels
+	}()
+	eastProxy := newTestSOCKS5Proxy(t, "", "", 0)
+	defaultProxy := newTestSOCKS5Proxy(t, "", "", 0)
+	config.Config.DataCenterPattern = `[.]([^.]+)[.]example[.]com`
+	config.Config.TopologyTunnels = map[string]string{
+		"east": eastProxy.url("").String(),
+		"*":    defaultProxy.url("").String(),
+	}
+	test.S(t).ExpectEquals(getTopologyMySQLNetwork(), tunnelNetwork)
+	test.S(t).ExpectEquals(getDataCenter("db-1.east.example.com"), "east")
+	test.S(t).ExpectEquals(getDataCenter("db-1"), "")
+	{
+		conn, err := dialTunnel("db-1.east.example.com:3306")
+		test.S(t).ExpectNil(err)
+		defer conn.Close()
+		test.S(t).ExpectEquals(<-eastProxy.targets, "db-1.east.example.com:3306")
+	}
+	{
+		conn, err := dialTunnel("db-1.west.example.com:3306")
+		test.S(t).ExpectNil(err)
+		defer conn.Close()
+		test.S(t).ExpectEquals(<-defaultProxy.targets, "db-1.west.example.com:3306")
+	}
+	{
+		config.Config.TopologyTunnels = map[string]string{"*": "http://proxy:3128"}
+		_, err := dialTunnel("db-1:3306")
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		// An invalid pattern maps onto no data center
+		config.Config.DataCenterPattern = `(`
+		test.S(t).ExpectEquals(getDataCenter("db-1.east.example.com"), "")
+		test.S(t).ExpectEquals(getDataCenter("db-1.east.example.com"), "")
+	}
+}
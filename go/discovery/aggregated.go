@@ -58,10 +58,23 @@ type AggregatedDiscoveryMetrics struct {
 	FailedP95TotalSeconds           float64
 	FailedP95BackendSeconds         float64
 	FailedP95InstanceSeconds        float64
+	MeanQueueWaitSeconds            float64
+	MaxQueueWaitSeconds             float64
+	MedianQueueWaitSeconds          float64
+	P95QueueWaitSeconds             float64
+	MeanBackendReadSeconds          float64
+	MaxBackendReadSeconds           float64
+	MedianBackendReadSeconds        float64
+	P95BackendReadSeconds           float64
+	MeanBackendWriteSeconds         float64
+	MaxBackendWriteSeconds          float64
+	MedianBackendWriteSeconds       float64
+	P95BackendWriteSeconds          float64
+	ReplicaRowsWritten              uint64 // total number of backend rows written by discoveries
 }
 
-// aggregate returns the aggregate values of the given metrics (assumed to be Metric)
-func aggregate(results []collection.Metric) AggregatedDiscoveryMetrics {
+// Aggregate returns the aggregate values of the given metrics (assumed to be Metric)
+func Aggregate(results []collection.Metric) AggregatedDiscoveryMetrics {
 	if len(results) == 0 {
 		return AggregatedDiscoveryMetrics{}
 	}
@@ -77,6 +90,7 @@ func aggregate(results []collection.Metric) AggregatedDiscoveryMetrics {
 	const (
 		FailedDiscoveries     counterKey = "FailedDiscoveries"
 		Discoveries                      = "Discoveries"
+		ReplicaRowsWritten               = "ReplicaRowsWritten"
 		InstanceKeys          hostKey    = "InstanceKeys"
 		OkInstanceKeys                   = "OkInstanceKeys"
 		FailedInstanceKeys               = "FailedInstanceKeys"
@@ -86,6 +100,9 @@ func aggregate(results []collection.Metric) AggregatedDiscoveryMetrics {
 		FailedTotalSeconds               = "FailedTotalSeconds"
 		FailedBackendSeconds             = "FailedBackendSeconds"
 		FailedInstanceSeconds            = "FailedInstanceSeconds"
+		QueueWaitSeconds                 = "QueueWaitSeconds"
+		BackendReadSeconds               = "BackendReadSeconds"
+		BackendWriteSeconds              = "BackendWriteSeconds"
 	)
 
 	counters := make(map[counterKey]uint64)           // map of string based counters
@@ -93,7 +110,7 @@ func aggregate(results []collection.Metric) AggregatedDiscoveryMetrics {
 	timings := make(map[timerKey](stats.Float64Data)) // map of string based float64 values
 
 	// initialise counters
-	for _, v := range []counterKey{FailedDiscoveries, Discoveries} {
+	for _, v := range []counterKey{FailedDiscoveries, Discoveries, ReplicaRowsWritten} {
 		counters[v] = 0
 	}
 	// initialise names
@@ -101,7 +118,7 @@ func aggregate(results []collection.Metric) AggregatedDiscoveryMetrics {
 		names[v] = make(map[string]int)
 	}
 	// initialise timers
-	for _, v := range []timerKey{TotalSeconds, BackendSeconds, InstanceSeconds, FailedTotalSeconds, FailedBackendSeconds, FailedInstanceSeconds} {
+	for _, v := range []timerKey{TotalSeconds, BackendSeconds, InstanceSeconds, FailedTotalSeconds, FailedBackendSeconds, FailedInstanceSeconds, QueueWaitSeconds, BackendReadSeconds, BackendWriteSeconds} {
 		timings[v] = nil
 	}
 
@@ -139,11 +156,15 @@ func aggregate(results []collection.Metric) AggregatedDiscoveryMetrics {
 		if v.Err != nil {
 			counters[FailedDiscoveries]++
 		}
+		counters[ReplicaRowsWritten] += uint64(v.ReplicaRowsWritten)
 
 		// All timings
 		timings[TotalSeconds] = append(timings[TotalSeconds], v.TotalLatency.Seconds())
 		timings[BackendSeconds] = append(timings[BackendSeconds], v.BackendLatency.Seconds())
 		timings[InstanceSeconds] = append(timings[InstanceSeconds], v.InstanceLatency.Seconds())
+		timings[QueueWaitSeconds] = append(timings[QueueWaitSeconds], v.QueueWaitLatency.Seconds())
+		timings[BackendReadSeconds] = append(timings[BackendReadSeconds], v.BackendReadLatency.Seconds())
+		timings[BackendWriteSeconds] = append(timings[BackendWriteSeconds], v.BackendWriteLatency.Seconds())
 
 		// Failed timings
 		if v.Err != nil {
@@ -184,6 +205,19 @@ func aggregate(results []collection.Metric) AggregatedDiscoveryMetrics {
 		FailedP95TotalSeconds:           percentile(timings[FailedTotalSeconds], 95),
 		FailedP95BackendSeconds:         percentile(timings[FailedBackendSeconds], 95),
 		FailedP95InstanceSeconds:        percentile(timings[FailedInstanceSeconds], 95),
+		MeanQueueWaitSeconds:            mean(timings[QueueWaitSeconds]),
+		MaxQueueWaitSeconds:             max(timings[QueueWaitSeconds]),
+		MedianQueueWaitSeconds:          median(timings[QueueWaitSeconds]),
+		P95QueueWaitSeconds:             percentile(timings[QueueWaitSeconds], 95),
+		MeanBackendReadSeconds:          mean(timings[BackendReadSeconds]),
+		MaxBackendReadSeconds:           max(timings[BackendReadSeconds]),
+		MedianBackendReadSeconds:        median(timings[BackendReadSeconds]),
+		P95BackendReadSeconds:           percentile(timings[BackendReadSeconds], 95),
+		MeanBackendWriteSeconds:         mean(timings[BackendWriteSeconds]),
+		MaxBackendWriteSeconds:          max(timings[BackendWriteSeconds]),
+		MedianBackendWriteSeconds:       median(timings[BackendWriteSeconds]),
+		P95BackendWriteSeconds:          percentile(timings[BackendWriteSeconds], 95),
+		ReplicaRowsWritten:              counters[ReplicaRowsWritten],
 	}
 }
 
@@ -195,5 +229,5 @@ func AggregatedSince(c *collection.Collection, t time.Time) (AggregatedDiscovery
 		return AggregatedDiscoveryMetrics{}, err
 	}
 
-	return aggregate(results), nil
+	return Aggregate(results), nil
 }
@@ -26,12 +26,16 @@ import (
 
 // Metric holds a set of information of instance discovery metrics
 type Metric struct {
-	Timestamp       time.Time        // time the collection was taken
-	InstanceKey     inst.InstanceKey // instance being monitored
-	BackendLatency  time.Duration    // time taken talking to the backend
-	InstanceLatency time.Duration    // time taken talking to the instance
-	TotalLatency    time.Duration    // total time taken doing the discovery
-	Err             error            // error (if applicable) doing the discovery process
+	Timestamp           time.Time        // time the collection was taken
+	InstanceKey         inst.InstanceKey // instance being monitored
+	QueueWaitLatency    time.Duration    // time spent waiting in the discovery queue
+	BackendLatency      time.Duration    // time taken talking to the backend
+	BackendReadLatency  time.Duration    // time taken reading from the backend
+	BackendWriteLatency time.Duration    // time taken writing to the backend
+	InstanceLatency     time.Duration    // time taken talking to the instance
+	TotalLatency        time.Duration    // total time taken doing the discovery
+	ReplicaRowsWritten  int              // number of backend rows written for the instance: its own row and its long running processes
+	Err                 error            // error (if applicable) doing the discovery process
 }
 
 // When did the metric happen
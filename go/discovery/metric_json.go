@@ -35,13 +35,17 @@ func (m formattedFloat) String() string {
 
 // MetricJSON holds a structure which represents some discovery latency information
 type MetricJSON struct {
-	Timestamp              time.Time
-	Hostname               string
-	Port                   int
-	BackendLatencySeconds  formattedFloat
-	InstanceLatencySeconds formattedFloat
-	TotalLatencySeconds    formattedFloat
-	Err                    error
+	Timestamp                  time.Time
+	Hostname                   string
+	Port                       int
+	QueueWaitLatencySeconds    formattedFloat
+	BackendLatencySeconds      formattedFloat
+	BackendReadLatencySeconds  formattedFloat
+	BackendWriteLatencySeconds formattedFloat
+	InstanceLatencySeconds     formattedFloat
+	TotalLatencySeconds        formattedFloat
+	ReplicaRowsWritten         int
+	Err                        error
 }
 
 // JSONSince returns an API response of discovery metric collection information
@@ -54,21 +58,29 @@ func JSONSince(c *collection.Collection, t time.Time) ([](MetricJSON), error) {
 	if err != nil {
 		return nil, err
 	}
+	return MetricsJSON(raw), nil
+}
 
+// MetricsJSON returns given metrics (assumed to be Metric) in a printable JSON format
+func MetricsJSON(raw []collection.Metric) []MetricJSON {
 	// build up JSON response for each Metric we received
 	var s []MetricJSON
 	for i := range raw {
 		m := raw[i].(*Metric) // convert back to a real Metric rather than collection.Metric interface
 		mj := MetricJSON{
-			Timestamp: m.Timestamp,
-			Hostname:  m.InstanceKey.Hostname,
-			Port:      m.InstanceKey.Port,
-			BackendLatencySeconds:  formattedFloat(m.BackendLatency.Seconds()),
-			InstanceLatencySeconds: formattedFloat(m.InstanceLatency.Seconds()),
-			TotalLatencySeconds:    formattedFloat(m.TotalLatency.Seconds()),
-			Err:                    m.Err,
+			Timestamp:                  m.Timestamp,
+			Hostname:                   m.InstanceKey.Hostname,
+			Port:                       m.InstanceKey.Port,
+			QueueWaitLatencySeconds:    formattedFloat(m.QueueWaitLatency.Seconds()),
+			BackendLatencySeconds:      formattedFloat(m.BackendLatency.Seconds()),
+			BackendReadLatencySeconds:  formattedFloat(m.BackendReadLatency.Seconds()),
+			BackendWriteLatencySeconds: formattedFloat(m.BackendWriteLatency.Seconds()),
+			InstanceLatencySeconds:     formattedFloat(m.InstanceLatency.Seconds()),
+			TotalLatencySeconds:        formattedFloat(m.TotalLatency.Seconds()),
+			ReplicaRowsWritten:         m.ReplicaRowsWritten,
+			Err:                        m.Err,
 		}
 		s = append(s, mj)
 	}
-	return s, nil
+	return s
 }
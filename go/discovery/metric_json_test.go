@@ -0,0 +1,83 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package discovery
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/github/orchestrator/go/collection"
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+// breakdownMetrics returns a successful and a failed discovery, with distinct queue wait, backend read and
+// backend write latencies, and rows written
+func breakdownMetrics() []collection.Metric {
+	return []collection.Metric{
+		&Metric{
+			Timestamp:           time.Now(),
+			InstanceKey:         inst.InstanceKey{Hostname: "db-1", Port: 3306},
+			QueueWaitLatency:    2 * time.Second,
+			BackendLatency:      400 * time.Millisecond,
+			BackendReadLatency:  100 * time.Millisecond,
+			BackendWriteLatency: 300 * time.Millisecond,
+			TotalLatency:        time.Second,
+			ReplicaRowsWritten:  3,
+		},
+		&Metric{
+			Timestamp:           time.Now(),
+			InstanceKey:         inst.InstanceKey{Hostname: "db-2", Port: 3306},
+			QueueWaitLatency:    4 * time.Second,
+			BackendLatency:      100 * time.Millisecond,
+			BackendReadLatency:  100 * time.Millisecond,
+			BackendWriteLatency: 0,
+			TotalLatency:        time.Second,
+			Err:                 errors.New("connection refused"),
+		},
+	}
+}
+
+func TestMetricsJSON(t *testing.T) {
+	metrics := MetricsJSON(breakdownMetrics())
+	test.S(t).ExpectEquals(len(metrics), 2)
+	test.S(t).ExpectEquals(metrics[0].Hostname, "db-1")
+	test.S(t).ExpectEquals(metrics[0].QueueWaitLatencySeconds.String(), "2.000")
+	test.S(t).ExpectEquals(metrics[0].BackendReadLatencySeconds.String(), "0.100")
+	test.S(t).ExpectEquals(metrics[0].BackendWriteLatencySeconds.String(), "0.300")
+	test.S(t).ExpectEquals(metrics[0].ReplicaRowsWritten, 3)
+	test.S(t).ExpectEquals(metrics[1].ReplicaRowsWritten, 0)
+
+	encoded, err := json.Marshal(metrics[0])
+	test.S(t).ExpectNil(err)
+	for _, field := range []string{`"QueueWaitLatencySeconds":2`, `"BackendReadLatencySeconds":0.1`, `"BackendWriteLatencySeconds":0.3`, `"ReplicaRowsWritten":3`} {
+		test.S(t).ExpectTrue(strings.Contains(string(encoded), field))
+	}
+}
+
+func TestAggregateWriteBreakdown(t *testing.T) {
+	aggregated := Aggregate(breakdownMetrics())
+	test.S(t).ExpectEquals(aggregated.FailedDiscoveries, uint64(1))
+	test.S(t).ExpectEquals(aggregated.MeanQueueWaitSeconds, 3.0)
+	test.S(t).ExpectEquals(aggregated.MaxQueueWaitSeconds, 4.0)
+	test.S(t).ExpectEquals(aggregated.MaxBackendReadSeconds, 0.1)
+	test.S(t).ExpectEquals(aggregated.MaxBackendWriteSeconds, 0.3)
+	test.S(t).ExpectEquals(aggregated.ReplicaRowsWritten, uint64(3))
+}
@@ -0,0 +1,285 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package discovery
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/openark/golib/sqlutils"
+)
+
+// metricStoreWriteBatchSize is the max number of metrics written by a single statement. It keeps statements
+// within SQLite's limit of 999 bound variables.
+const metricStoreWriteBatchSize = 50
+
+// metricStoreExpireChunkSize is the max number of metrics removed by a single statement, such that expiring a
+// large backlog does not hold long running locks on the backend
+const metricStoreExpireChunkSize = 1000
+
+// MetricStore persists discovery metrics beyond the in-memory collection, which only retains them for
+// DiscoveryCollectionRetentionSeconds and loses them on restart. See DiscoveryMetricsStorage.
+type MetricStore interface {
+	// Write persists given metrics, as collected by given orchestrator node
+	Write(orchestratorHost string, metrics []*Metric) error
+	// ReadSince reads the most recent metrics collected on or after given time, by any node, up to given limit,
+	// in time based order
+	ReadSince(t time.Time, limit int) ([]*Metric, error)
+	// Expire removes the metrics collected before given time, as well as the oldest metrics in excess of maxRows
+	Expire(before time.Time, maxRows int) error
+}
+
+// sqlMetricStore stores discovery metrics in a discovery_metric table, via given exec and query functions
+type sqlMetricStore struct {
+	exec  func(query string, args ...interface{}) (sql.Result, error)
+	query func(query string, args []interface{}, onRow func(sqlutils.RowMap) error) error
+}
+
+// newBackendMetricStore returns a store persisting discovery metrics onto the backend database
+func newBackendMetricStore() *sqlMetricStore {
+	return &sqlMetricStore{
+		exec:  db.ExecOrchestrator,
+		query: db.QueryOrchestrator,
+	}
+}
+
+// newFileMetricStore returns a store persisting discovery metrics onto given local SQLite file, creating the
+// discovery_metric table as needed
+func newFileMetricStore(dataFile string) (*sqlMetricStore, error) {
+	sqliteDB, _, err := sqlutils.GetSQLiteDB(dataFile)
+	if err != nil {
+		return nil, err
+	}
+	sqliteDB.SetMaxOpenConns(1)
+	sqliteDB.SetMaxIdleConns(1)
+	statements := []string{
+		sqlutils.ToSqlite3Dialect(`
+			CREATE TABLE IF NOT EXISTS discovery_metric (
+				metric_id bigint unsigned NOT NULL AUTO_INCREMENT,
+				orchestrator_host varchar(128) CHARACTER SET ascii NOT NULL,
+				hostname varchar(128) CHARACTER SET ascii NOT NULL,
+				port smallint unsigned NOT NULL,
+				metric_unixtime_micros bigint unsigned NOT NULL,
+				queue_wait_latency_micros bigint unsigned NOT NULL DEFAULT 0,
+				backend_read_latency_micros bigint unsigned NOT NULL DEFAULT 0,
+				backend_write_latency_micros bigint unsigned NOT NULL DEFAULT 0,
+				instance_latency_micros bigint unsigned NOT NULL DEFAULT 0,
+				total_latency_micros bigint unsigned NOT NULL DEFAULT 0,
+				replica_rows_written int unsigned NOT NULL DEFAULT 0,
+				error varchar(1024) CHARACTER SET utf8 NOT NULL DEFAULT '',
+				PRIMARY KEY (metric_id)
+			) ENGINE=InnoDB DEFAULT CHARSET=ascii
+		`),
+		`create index if not exists metric_unixtime_micros_idx_discovery_metric on discovery_metric (metric_unixtime_micros)`,
+	}
+	for _, statement := range statements {
+		if _, err := sqlutils.ExecNoPrepare(sqliteDB, statement); err != nil {
+			return nil, err
+		}
+	}
+	return &sqlMetricStore{
+		exec: func(query string, args ...interface{}) (sql.Result, error) {
+			return sqlutils.ExecNoPrepare(sqliteDB, query, args...)
+		},
+		query: func(query string, args []interface{}, onRow func(sqlutils.RowMap) error) error {
+			return sqlutils.QueryRowsMap(sqliteDB, query, onRow, args...)
+		},
+	}, nil
+}
+
+// NewMetricStore returns the discovery metric store configured by DiscoveryMetricsStorage, or nil when discovery
+// metrics are not persisted
+func NewMetricStore() (MetricStore, error) {
+	switch config.Config.DiscoveryMetricsStorage {
+	case config.DiscoveryMetricsBackendStorage:
+		return newBackendMetricStore(), nil
+	case config.DiscoveryMetricsFileStorage:
+		return newFileMetricStore(config.Config.DiscoveryMetricsStorageFile)
+	}
+	return nil, nil
+}
+
+func unixMicros(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Microsecond)
+}
+
+func micros(d time.Duration) int64 {
+	return int64(d / time.Microsecond)
+}
+
+// Write persists given metrics, in batches
+func (this *sqlMetricStore) Write(orchestratorHost string, metrics []*Metric) error {
+	for len(metrics) > 0 {
+		batch := metrics
+		if len(batch) > metricStoreWriteBatchSize {
+			batch = batch[:metricStoreWriteBatchSize]
+		}
+		metrics = metrics[len(batch):]
+
+		values := []string{}
+		args := []interface{}{}
+		for _, metric := range batch {
+			errorMessage := ""
+			if metric.Err != nil {
+				errorMessage = metric.Err.Error()
+				if len(errorMessage) > 1024 {
+					errorMessage = errorMessage[:1024]
+				}
+			}
+			values = append(values, "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+			args = append(args,
+				orchestratorHost,
+				metric.InstanceKey.Hostname,
+				metric.InstanceKey.Port,
+				unixMicros(metric.Timestamp),
+				micros(metric.QueueWaitLatency),
+				micros(metric.BackendReadLatency),
+				micros(metric.BackendWriteLatency),
+				micros(metric.InstanceLatency),
+				micros(metric.TotalLatency),
+				metric.ReplicaRowsWritten,
+				errorMessage,
+			)
+		}
+		query := fmt.Sprintf(`
+			insert into discovery_metric (
+				orchestrator_host, hostname, port, metric_unixtime_micros,
+				queue_wait_latency_micros, backend_read_latency_micros, backend_write_latency_micros,
+				instance_latency_micros, total_latency_micros, replica_rows_written, error
+			) values %s
+			`, strings.Join(values, ", "))
+		if _, err := this.exec(query, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadSince reads the most recent metrics collected on or after given time, up to given limit, in time based order
+func (this *sqlMetricStore) ReadSince(t time.Time, limit int) (metrics []*Metric, err error) {
+	query := `
+		select
+			hostname,
+			port,
+			metric_unixtime_micros,
+			queue_wait_latency_micros,
+			backend_read_latency_micros,
+			backend_write_latency_micros,
+			instance_latency_micros,
+			total_latency_micros,
+			replica_rows_written,
+			error
+		from
+			discovery_metric
+		where
+			metric_unixtime_micros >= ?
+		order by
+			metric_unixtime_micros desc, metric_id desc
+		limit ?
+		`
+	err = this.query(query, sqlutils.Args(unixMicros(t), limit), func(m sqlutils.RowMap) error {
+		metric := &Metric{
+			Timestamp:           time.Unix(0, m.GetInt64("metric_unixtime_micros")*int64(time.Microsecond)),
+			InstanceKey:         inst.InstanceKey{Hostname: m.GetString("hostname"), Port: m.GetInt("port")},
+			QueueWaitLatency:    time.Duration(m.GetInt64("queue_wait_latency_micros")) * time.Microsecond,
+			BackendReadLatency:  time.Duration(m.GetInt64("backend_read_latency_micros")) * time.Microsecond,
+			BackendWriteLatency: time.Duration(m.GetInt64("backend_write_latency_micros")) * time.Microsecond,
+			InstanceLatency:     time.Duration(m.GetInt64("instance_latency_micros")) * time.Microsecond,
+			TotalLatency:        time.Duration(m.GetInt64("total_latency_micros")) * time.Microsecond,
+			ReplicaRowsWritten:  m.GetInt("replica_rows_written"),
+		}
+		metric.BackendLatency = metric.BackendReadLatency + metric.BackendWriteLatency
+		if errorMessage := m.GetString("error"); errorMessage != "" {
+			metric.Err = errors.New(errorMessage)
+		}
+		metrics = append(metrics, metric)
+		return nil
+	})
+	// Read most recent first, so as to apply the limit
+	for i, j := 0, len(metrics)-1; i < j; i, j = i+1, j-1 {
+		metrics[i], metrics[j] = metrics[j], metrics[i]
+	}
+	return metrics, err
+}
+
+// expireChunks removes the metrics matching given condition, oldest first, in chunks of metricStoreExpireChunkSize,
+// up to given count of metrics
+func (this *sqlMetricStore) expireChunks(whereCondition string, args []interface{}, count int64) error {
+	for count > 0 {
+		chunkSize := count
+		if chunkSize > metricStoreExpireChunkSize {
+			chunkSize = metricStoreExpireChunkSize
+		}
+		query := fmt.Sprintf(`
+			delete
+				from discovery_metric
+			where
+				metric_id in (
+					select metric_id from (
+						select
+							metric_id
+						from
+							discovery_metric
+						%s
+						order by
+							metric_unixtime_micros asc, metric_id asc
+						limit ?
+					) as expired_metric
+				)
+			`, whereCondition)
+		sqlResult, err := this.exec(query, append(args, chunkSize)...)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := sqlResult.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected < chunkSize {
+			return nil
+		}
+		count -= rowsAffected
+	}
+	return nil
+}
+
+// Expire removes the metrics collected before given time, as well as the oldest metrics in excess of maxRows
+func (this *sqlMetricStore) Expire(before time.Time, maxRows int) error {
+	// Expiring by time has no upper bound on the number of metrics; chunks continue until none remain
+	if err := this.expireChunks(`where metric_unixtime_micros < ?`, sqlutils.Args(unixMicros(before)), math.MaxInt64); err != nil {
+		return err
+	}
+	var countMetrics int64
+	err := this.query(`select count(*) as count_metrics from discovery_metric`, sqlutils.Args(), func(m sqlutils.RowMap) error {
+		countMetrics = m.GetInt64("count_metrics")
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if excess := countMetrics - int64(maxRows); excess > 0 {
+		return this.expireChunks(``, sqlutils.Args(), excess)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package discovery
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+// storeTestEpoch is the time of the first metric written by tests; any time within past retention will do
+var storeTestEpoch = time.Unix(time.Now().Add(-time.Hour).Unix(), 0)
+
+// secondlyMetrics returns given count of metrics, one per second, starting at given offset from storeTestEpoch
+func secondlyMetrics(fromSecond int, count int) (metrics []*Metric) {
+	for i := fromSecond; i < fromSecond+count; i++ {
+		metrics = append(metrics, &Metric{
+			Timestamp:       storeTestEpoch.Add(time.Duration(i) * time.Second),
+			InstanceKey:     inst.InstanceKey{Hostname: fmt.Sprintf("db-%d", i), Port: 3306},
+			InstanceLatency: time.Duration(i) * time.Millisecond,
+		})
+	}
+	return metrics
+}
+
+// storedSeconds returns the offsets from storeTestEpoch of given metrics
+func storedSeconds(metrics []*Metric) (seconds []int) {
+	for _, metric := range metrics {
+		seconds = append(seconds, int(metric.Timestamp.Sub(storeTestEpoch)/time.Second))
+	}
+	return seconds
+}
+
+// testMetricStore runs the same tests on any store, which is expected to be empty
+func testMetricStore(t *testing.T, store *sqlMetricStore) {
+	written := secondlyMetrics(0, 120)
+	written[7].Err = errors.New(strings.Repeat("x", 2000))
+	written[7].BackendReadLatency = 3 * time.Millisecond
+	written[7].BackendWriteLatency = 4 * time.Millisecond
+	written[7].ReplicaRowsWritten = 5
+	test.S(t).ExpectNil(store.Write("orchestrator-1", written))
+
+	metrics, err := store.ReadSince(storeTestEpoch, 1000)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(metrics), 120)
+	for i, metric := range metrics {
+		test.S(t).ExpectTrue(metric.Timestamp.Equal(written[i].Timestamp))
+		test.S(t).ExpectEquals(metric.InstanceKey, written[i].InstanceKey)
+		test.S(t).ExpectEquals(metric.InstanceLatency, written[i].InstanceLatency)
+	}
+	test.S(t).ExpectEquals(metrics[7].BackendLatency, 7*time.Millisecond)
+	test.S(t).ExpectEquals(metrics[7].ReplicaRowsWritten, 5)
+	test.S(t).ExpectEquals(len(metrics[7].Err.Error()), 1024)
+	test.S(t).ExpectNil(metrics[8].Err)
+
+	// The limit applies to the most recent metrics, still in time based order
+	metrics, err = store.ReadSince(storeTestEpoch.Add(100*time.Second), 5)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(fmt.Sprintf("%v", storedSeconds(metrics)), "[115 116 117 118 119]")
+	metrics, err = store.ReadSince(storeTestEpoch.Add(118*time.Second), 5)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(fmt.Sprintf("%v", storedSeconds(metrics)), "[118 119]")
+
+	// Expiring by time
+	test.S(t).ExpectNil(store.Expire(storeTestEpoch.Add(20*time.Second), 1000))
+	metrics, err = store.ReadSince(storeTestEpoch, 1000)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(metrics), 100)
+	test.S(t).ExpectEquals(storedSeconds(metrics)[0], 20)
+
+	// Expiring the oldest metrics in excess of the row cap
+	test.S(t).ExpectNil(store.Expire(storeTestEpoch, 30))
+	metrics, err = store.ReadSince(storeTestEpoch, 1000)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(metrics), 30)
+	test.S(t).ExpectEquals(storedSeconds(metrics)[0], 90)
+}
+
+func TestFileMetricStore(t *testing.T) {
+	store, err := newFileMetricStore(filepath.Join(t.TempDir(), "discovery-metrics.sqlite3"))
+	test.S(t).ExpectNil(err)
+	testMetricStore(t, store)
+}
+
+func TestBackendMetricStore(t *testing.T) {
+	backendDB, dataFile := config.Config.BackendDB, config.Config.SQLite3DataFile
+	config.Config.BackendDB = "sqlite"
+	config.Config.SQLite3DataFile = filepath.Join(t.TempDir(), "orchestrator.sqlite3")
+	defer func() {
+		config.Config.BackendDB, config.Config.SQLite3DataFile = backendDB, dataFile
+	}()
+
+	testMetricStore(t, newBackendMetricStore())
+}
+
+func TestMetricStoreExpireChunks(t *testing.T) {
+	store, err := newFileMetricStore(filepath.Join(t.TempDir(), "discovery-metrics.sqlite3"))
+	test.S(t).ExpectNil(err)
+
+	countMetrics := 2*metricStoreExpireChunkSize + 100
+	test.S(t).ExpectNil(store.Write("orchestrator-1", secondlyMetrics(0, countMetrics)))
+
+	// Expiring by time spans multiple chunks
+	test.S(t).ExpectNil(store.Expire(storeTestEpoch.Add(time.Duration(metricStoreExpireChunkSize+500)*time.Second), countMetrics))
+	metrics, err := store.ReadSince(storeTestEpoch, countMetrics)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(metrics), metricStoreExpireChunkSize-400)
+	test.S(t).ExpectEquals(storedSeconds(metrics)[0], metricStoreExpireChunkSize+500)
+
+	// So does the row cap
+	test.S(t).ExpectNil(store.Write("orchestrator-1", secondlyMetrics(countMetrics, countMetrics)))
+	test.S(t).ExpectNil(store.Expire(storeTestEpoch, 10))
+	metrics, err = store.ReadSince(storeTestEpoch, countMetrics)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(metrics), 10)
+	test.S(t).ExpectEquals(storedSeconds(metrics)[0], 2*countMetrics-10)
+}
@@ -0,0 +1,100 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package discovery
+
+import (
+	"sort"
+	"time"
+
+	"github.com/montanaflynn/stats"
+
+	"github.com/github/orchestrator/go/collection"
+	"github.com/github/orchestrator/go/inst"
+)
+
+const (
+	// minOutlierProbes is the number of successful probes an instance must have to be considered for being an outlier
+	minOutlierProbes = 3
+	// minOutlierFleetSize is the number of probed instances below which there is no meaningful fleet baseline
+	minOutlierFleetSize = 3
+)
+
+// SlowDiscoveryOutlier is an instance whose discovery probes are consistently slower than those of the fleet
+type SlowDiscoveryOutlier struct {
+	InstanceKey                inst.InstanceKey
+	CountProbes                int
+	MedianInstanceSeconds      float64
+	FleetMedianInstanceSeconds float64
+	FleetStdDevInstanceSeconds float64
+	ThresholdSeconds           float64
+}
+
+// slowOutliers returns the instances whose median probe latency exceeds the fleet median by more than sigma
+// standard deviations. The fleet is described by the median probe latencies of its instances. An instance whose
+// median exceeds the threshold is slow on at least half of its probes, and so consistently slow, as opposed to
+// having an occasional slow probe. Failed probes are of no interest here: they are reported as problems of their own.
+func slowOutliers(results []collection.Metric, sigma float64) (outliers []SlowDiscoveryOutlier) {
+	latencies := make(map[inst.InstanceKey]stats.Float64Data)
+	for _, result := range results {
+		metric := result.(*Metric)
+		if metric.Err != nil {
+			continue
+		}
+		latencies[metric.InstanceKey] = append(latencies[metric.InstanceKey], metric.InstanceLatency.Seconds())
+	}
+	instanceMedians := make(map[inst.InstanceKey]float64)
+	fleetMedians := stats.Float64Data{}
+	for instanceKey, instanceLatencies := range latencies {
+		if len(instanceLatencies) < minOutlierProbes {
+			continue
+		}
+		instanceMedians[instanceKey] = median(instanceLatencies)
+		fleetMedians = append(fleetMedians, instanceMedians[instanceKey])
+	}
+	if len(fleetMedians) < minOutlierFleetSize {
+		return outliers
+	}
+	fleetMedian := median(fleetMedians)
+	fleetStdDev, _ := stats.StandardDeviationPopulation(fleetMedians)
+	threshold := fleetMedian + sigma*fleetStdDev
+	for instanceKey, instanceMedian := range instanceMedians {
+		if instanceMedian <= threshold {
+			continue
+		}
+		outliers = append(outliers, SlowDiscoveryOutlier{
+			InstanceKey:                instanceKey,
+			CountProbes:                len(latencies[instanceKey]),
+			MedianInstanceSeconds:      instanceMedian,
+			FleetMedianInstanceSeconds: fleetMedian,
+			FleetStdDevInstanceSeconds: fleetStdDev,
+			ThresholdSeconds:           threshold,
+		})
+	}
+	sort.Slice(outliers, func(i, j int) bool {
+		return outliers[i].MedianInstanceSeconds > outliers[j].MedianInstanceSeconds
+	})
+	return outliers
+}
+
+// SlowOutliersSince returns the slow discovery outliers as per the discovery metrics collected since given time
+func SlowOutliersSince(c *collection.Collection, t time.Time, sigma float64) ([]SlowDiscoveryOutlier, error) {
+	results, err := c.Since(t)
+	if err != nil {
+		return nil, err
+	}
+	return slowOutliers(results, sigma), nil
+}
@@ -0,0 +1,101 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package discovery
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/github/orchestrator/go/collection"
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+// probes returns successful discovery metrics of given instance, one per latency in milliseconds
+func probes(hostname string, latenciesMillis ...int) (metrics []collection.Metric) {
+	for _, latencyMillis := range latenciesMillis {
+		metrics = append(metrics, &Metric{
+			InstanceKey:     inst.InstanceKey{Hostname: hostname, Port: 3306},
+			InstanceLatency: time.Duration(latencyMillis) * time.Millisecond,
+		})
+	}
+	return metrics
+}
+
+func TestSlowOutliers(t *testing.T) {
+	results := []collection.Metric{}
+	results = append(results, probes("db-1", 10, 11, 12)...)
+	results = append(results, probes("db-2", 10, 12, 11)...)
+	results = append(results, probes("db-3", 9, 10, 11)...)
+	results = append(results, probes("db-4", 12, 10, 10)...)
+	// Consistently slow
+	results = append(results, probes("db-5", 200, 210, 190)...)
+	// Occasionally slow
+	results = append(results, probes("db-6", 10, 500, 11)...)
+
+	outliers := slowOutliers(results, 1)
+	test.S(t).ExpectEquals(len(outliers), 1)
+	test.S(t).ExpectEquals(outliers[0].InstanceKey.Hostname, "db-5")
+	test.S(t).ExpectEquals(outliers[0].CountProbes, 3)
+	test.S(t).ExpectEquals(outliers[0].MedianInstanceSeconds, 0.2)
+	test.S(t).ExpectTrue(outliers[0].ThresholdSeconds > outliers[0].FleetMedianInstanceSeconds)
+	test.S(t).ExpectTrue(outliers[0].ThresholdSeconds < outliers[0].MedianInstanceSeconds)
+
+	// A higher sigma tolerates the slow instance
+	test.S(t).ExpectEquals(len(slowOutliers(results, 3)), 0)
+}
+
+func TestSlowOutliersOrder(t *testing.T) {
+	results := []collection.Metric{}
+	for _, hostname := range []string{"db-1", "db-2", "db-3", "db-4", "db-5", "db-6", "db-7", "db-8"} {
+		results = append(results, probes(hostname, 10, 10, 10)...)
+	}
+	results = append(results, probes("db-slow", 100, 100, 100)...)
+	results = append(results, probes("db-slowest", 300, 300, 300)...)
+
+	outliers := slowOutliers(results, 0.5)
+	test.S(t).ExpectEquals(len(outliers), 2)
+	test.S(t).ExpectEquals(outliers[0].InstanceKey.Hostname, "db-slowest")
+	test.S(t).ExpectEquals(outliers[1].InstanceKey.Hostname, "db-slow")
+}
+
+func TestSlowOutliersIgnored(t *testing.T) {
+	// Too few probes of the slow instance
+	results := []collection.Metric{}
+	results = append(results, probes("db-1", 10, 10, 10)...)
+	results = append(results, probes("db-2", 10, 10, 10)...)
+	results = append(results, probes("db-3", 10, 10, 10)...)
+	results = append(results, probes("db-4", 500, 500)...)
+	test.S(t).ExpectEquals(len(slowOutliers(results, 1)), 0)
+
+	// Failed probes do not count
+	for i := 0; i < 3; i++ {
+		results = append(results, &Metric{
+			InstanceKey:     inst.InstanceKey{Hostname: "db-4", Port: 3306},
+			InstanceLatency: 500 * time.Millisecond,
+			Err:             errors.New("connection refused"),
+		})
+	}
+	test.S(t).ExpectEquals(len(slowOutliers(results, 1)), 0)
+
+	// Too small a fleet
+	results = []collection.Metric{}
+	results = append(results, probes("db-1", 10, 10, 10)...)
+	results = append(results, probes("db-2", 500, 500, 500)...)
+	test.S(t).ExpectEquals(len(slowOutliers(results, 0)), 0)
+}
@@ -155,6 +155,13 @@ func (q *Queue) Push(key inst.InstanceKey) {
 // Consume fetches a key to process; blocks if queue is empty.
 // Release must be called once after Consume.
 func (q *Queue) Consume() inst.InstanceKey {
+	key, _ := q.ConsumeWithWaitTime()
+	return key
+}
+
+// ConsumeWithWaitTime fetches a key to process, along with the time it spent waiting
+// on the queue; blocks if queue is empty. Release must be called once after.
+func (q *Queue) ConsumeWithWaitTime() (inst.InstanceKey, time.Duration) {
 	q.Lock()
 	queue := q.queue
 	q.Unlock()
@@ -174,7 +181,7 @@ func (q *Queue) Consume() inst.InstanceKey {
 
 	delete(q.queuedKeys, key)
 
-	return key
+	return key, timeOnQueue
 }
 
 // Release removes a key from a list of being processed keys
@@ -17,7 +17,10 @@
 package http
 
 import (
+	"crypto/x509"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"strconv"
 	"strings"
@@ -27,21 +30,64 @@ import (
 
 	"github.com/github/orchestrator/go/agent"
 	"github.com/github/orchestrator/go/attributes"
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/ssl"
 )
 
+// maxCertificateRequestLength limits the size of a certificate signing request submitted by an agent
+const maxCertificateRequestLength = 64 * 1024
+
 type HttpAgentsAPI struct {
 	URLPrefix string
 }
 
 var AgentsAPI HttpAgentsAPI = HttpAgentsAPI{}
 
+// presentedAgentCertificate returns the verified certificate an agent presented, or nil when it presented none
+func presentedAgentCertificate(req *http.Request) *x509.Certificate {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return req.TLS.VerifiedChains[0][0]
+}
+
+// isEnrollmentRequest checks whether a request is that of an agent enrolling, which presents no certificate yet
+func (this *HttpAgentsAPI) isEnrollmentRequest(req *http.Request) bool {
+	return agent.IsAgentEnrollmentEnabled() && strings.HasPrefix(req.URL.Path, this.URLPrefix+"/api/agent-enroll/")
+}
+
+// VerifyAgentCertificate verifies the certificate presented by an agent: its OU must be one of AgentSSLValidOUs,
+// and it must not be revoked.
+func (this *HttpAgentsAPI) VerifyAgentCertificate(res http.ResponseWriter, req *http.Request) {
+	if this.isEnrollmentRequest(req) {
+		return
+	}
+	if err := ssl.Verify(req, config.Config.AgentSSLValidOUs); err != nil {
+		http.Error(res, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if certificate := presentedAgentCertificate(req); certificate != nil {
+		if err := agent.VerifyAgentCertificateNotRevoked(certificate); err != nil {
+			http.Error(res, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+}
+
 // SubmitAgent registeres an agent. It is initiated by an agent to register itself.
-func (this *HttpAgentsAPI) SubmitAgent(params martini.Params, r render.Render) {
+func (this *HttpAgentsAPI) SubmitAgent(params martini.Params, r render.Render, req *http.Request) {
 	port, err := strconv.Atoi(params["port"])
 	if err != nil {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
+	if certificate := presentedAgentCertificate(req); agent.IsAgentEnrollmentEnabled() && certificate != nil {
+		// An enrolled agent may only submit itself
+		if certificate.Subject.CommonName != params["host"] {
+			r.JSON(http.StatusUnauthorized, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Certificate of %s cannot submit agent %s", certificate.Subject.CommonName, params["host"])})
+			return
+		}
+	}
 
 	output, err := agent.SubmitAgent(params["host"], port, params["token"])
 	if err != nil {
@@ -118,6 +164,38 @@ func (this *HttpAgentsAPI) AgentsInstances(params martini.Params, r render.Rende
 	return ""
 }
 
+// EnrollAgent exchanges a one-time enrollment token for an agent certificate. The request body is a PEM encoded
+// certificate signing request.
+func (this *HttpAgentsAPI) EnrollAgent(params martini.Params, r render.Render, req *http.Request) {
+	csrPEM, err := ioutil.ReadAll(io.LimitReader(req.Body, maxCertificateRequestLength))
+	if err != nil {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	issued, err := agent.EnrollAgent(params["host"], params["token"], csrPEM)
+	if err != nil {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	r.JSON(200, issued)
+}
+
+// RenewAgentCertificate issues a new certificate to an agent presenting its current, valid certificate. The request
+// body is a PEM encoded certificate signing request.
+func (this *HttpAgentsAPI) RenewAgentCertificate(params martini.Params, r render.Render, req *http.Request) {
+	csrPEM, err := ioutil.ReadAll(io.LimitReader(req.Body, maxCertificateRequestLength))
+	if err != nil {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	issued, err := agent.RenewAgentCertificate(params["host"], presentedAgentCertificate(req), csrPEM)
+	if err != nil {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	r.JSON(200, issued)
+}
+
 func (this *HttpAgentsAPI) AgentPing(params martini.Params, r render.Render, req *http.Request) {
 	r.JSON(200, "OK")
 }
@@ -130,4 +208,6 @@ func (this *HttpAgentsAPI) RegisterRequests(m *martini.ClassicMartini) {
 	m.Get(this.URLPrefix+"/api/agents-hosts", this.AgentsHosts)
 	m.Get(this.URLPrefix+"/api/agents-instances", this.AgentsInstances)
 	m.Get(this.URLPrefix+"/api/agent-ping", this.AgentPing)
+	m.Post(this.URLPrefix+"/api/agent-enroll/:host/:token", this.EnrollAgent)
+	m.Post(this.URLPrefix+"/api/agent-renew-certificate/:host", this.RenewAgentCertificate)
 }
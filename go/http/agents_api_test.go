@@ -0,0 +1,79 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	test "github.com/openark/golib/tests"
+)
+
+// agentCertificateRequest returns an agents API request, as presented with a verified certificate of given OU
+// and serial number
+func agentCertificateRequest(path string, ou string, serialNumber int64) *http.Request {
+	req := httptest.NewRequest("GET", path, nil)
+	certificate := &x509.Certificate{
+		SerialNumber: big.NewInt(serialNumber),
+		Subject:      pkix.Name{CommonName: "agent-host", OrganizationalUnit: []string{ou}},
+	}
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{certificate}}}
+	return req
+}
+
+func TestVerifyAgentCertificate(t *testing.T) {
+	previous := *config.Config
+	t.Cleanup(func() { *config.Config = previous })
+	config.Config.BackendDB = "sqlite"
+	config.Config.SQLite3DataFile = filepath.Join(t.TempDir(), "orchestrator.sqlite3")
+	config.Config.AgentSSLValidOUs = []string{"agents"}
+	config.Config.AgentEnrollmentCACertFile = "/etc/orchestrator/agents-ca.pem"
+
+	// Serial numbers are recorded as hexadecimal
+	_, err := db.ExecOrchestrator(`
+			insert into agent_certificate (
+				serial_number, hostname, issue_reason, issued_timestamp, expires_at, is_revoked
+			) values (
+				'ff', 'agent-host', 'enrollment', now(), now() + interval 1 hour, 1
+			)
+		`)
+	test.S(t).ExpectNil(err)
+
+	verify := func(req *http.Request) int {
+		recorder := httptest.NewRecorder()
+		AgentsAPI.VerifyAgentCertificate(recorder, req)
+		return recorder.Code
+	}
+	test.S(t).ExpectEquals(verify(agentCertificateRequest("/api/submit-agent/agent-host/3002/token", "agents", 0xfe)), http.StatusOK)
+	test.S(t).ExpectEquals(verify(agentCertificateRequest("/api/submit-agent/agent-host/3002/token", "agents", 0xff)), http.StatusUnauthorized)
+	test.S(t).ExpectEquals(verify(agentCertificateRequest("/api/submit-agent/agent-host/3002/token", "dbas", 0xfe)), http.StatusUnauthorized)
+
+	req := httptest.NewRequest("GET", "/api/submit-agent/agent-host/3002/token", nil)
+	test.S(t).ExpectEquals(verify(req), http.StatusUnauthorized)
+
+	// Enrolling agents present no certificate yet
+	req = httptest.NewRequest("GET", "/api/agent-enroll/agent-host/token", nil)
+	test.S(t).ExpectEquals(verify(req), http.StatusOK)
+}
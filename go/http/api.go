@@ -35,10 +35,12 @@ import (
 	"github.com/github/orchestrator/go/agent"
 	"github.com/github/orchestrator/go/collection"
 	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
 	"github.com/github/orchestrator/go/discovery"
 	"github.com/github/orchestrator/go/inst"
 	"github.com/github/orchestrator/go/kv"
 	"github.com/github/orchestrator/go/logic"
+	apimetrics "github.com/github/orchestrator/go/metrics/api"
 	"github.com/github/orchestrator/go/metrics/query"
 	"github.com/github/orchestrator/go/process"
 	"github.com/github/orchestrator/go/raft"
@@ -76,6 +78,8 @@ var apiSynonyms = map[string]string{
 	"stop-slave-nice":            "stop-replica-nice",
 	"reset-slave":                "reset-replica",
 	"restart-slave-statements":   "restart-replica-statements",
+	"start-slave-thread":         "start-replica-thread",
+	"stop-slave-thread":          "stop-replica-thread",
 }
 
 var registeredPaths = []string{}
@@ -106,14 +110,22 @@ func (this *APIResponseCode) HttpStatus() int {
 	return http.StatusNotImplemented
 }
 
-// APIResponse is a response returned as JSON to various requests.
+// APIResponse is a response returned as JSON to various requests. An ERROR response carries an ErrorCode.
 type APIResponse struct {
-	Code    APIResponseCode
-	Message string
-	Details interface{}
+	Code      APIResponseCode
+	ErrorCode APIErrorCode `json:",omitempty"`
+	Message   string
+	Details   interface{}
 }
 
 func Respond(r render.Render, apiResponse *APIResponse) {
+	if apiResponse.Code == ERROR {
+		if apiResponse.ErrorCode == "" {
+			apiResponse.ErrorCode = ErrInternal
+		}
+		r.JSON(apiResponse.ErrorCode.HttpStatus(), apiResponse)
+		return
+	}
 	r.JSON(apiResponse.Code.HttpStatus(), apiResponse)
 }
 
@@ -122,9 +134,17 @@ type HttpAPI struct {
 }
 
 var API HttpAPI = HttpAPI{}
-var discoveryMetrics = collection.CreateOrReturnCollection("DISCOVERY_METRICS")
 var queryMetrics = collection.CreateOrReturnCollection("BACKEND_WRITES")
 
+// defaultDiscoveryPauseDurationSeconds applies to discovery pauses with no explicit duration
+const defaultDiscoveryPauseDurationSeconds = 3600
+
+// defaultSchemaMigrationDurationSeconds applies to schema migration registrations with no explicit duration
+const defaultSchemaMigrationDurationSeconds = 3600
+
+// defaultSQLDelaySuspensionSeconds applies to SQL_Delay suspensions with no explicit duration
+const defaultSQLDelaySuspensionSeconds = 3600
+
 func (this *HttpAPI) getInstanceKey(host string, port string) (inst.InstanceKey, error) {
 	instanceKey, err := inst.NewInstanceKeyFromStrings(host, port)
 	if err != nil {
@@ -152,13 +172,13 @@ func (this *HttpAPI) InstanceReplicas(params martini.Params, r render.Render, re
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 	replicas, err := inst.ReadReplicaInstances(&instanceKey)
 
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Cannot read instance: %+v", instanceKey)})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInstanceNotFound, Message: fmt.Sprintf("Cannot read instance: %+v", instanceKey)})
 		return
 	}
 	r.JSON(http.StatusOK, replicas)
@@ -169,14 +189,19 @@ func (this *HttpAPI) Instance(params martini.Params, r render.Render, req *http.
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 	instance, found, err := inst.ReadInstance(&instanceKey)
 	if (!found) || (err != nil) {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Cannot read instance: %+v", instanceKey)})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInstanceNotFound, Message: fmt.Sprintf("Cannot read instance: %+v", instanceKey)})
 		return
 	}
+	if orcraft.IsRaftEnabled() {
+		if outcomes, err := inst.ReadInstanceProbeOutcomes(&instanceKey); err == nil {
+			instance.ApplyProbeOutcomes(outcomes)
+		}
+	}
 	r.JSON(http.StatusOK, instance)
 }
 
@@ -185,12 +210,12 @@ func (this *HttpAPI) Instance(params martini.Params, r render.Render, req *http.
 // if the instance is slow to respond or not reachable.
 func (this *HttpAPI) AsyncDiscover(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 	go this.Discover(params, r, req, user)
@@ -201,12 +226,12 @@ func (this *HttpAPI) AsyncDiscover(params martini.Params, r render.Render, req *
 // Discover issues a synchronous read on an instance
 func (this *HttpAPI) Discover(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 	instance, err := inst.ReadTopologyInstance(&instanceKey)
@@ -224,16 +249,45 @@ func (this *HttpAPI) Discover(params martini.Params, r render.Render, req *http.
 	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Instance discovered: %+v", instance.Key), Details: instance})
 }
 
+// OnboardCluster discovers the cluster of given seed instance and reports its readiness for automated recovery,
+// listing the remediation of each problem found
+func (this *HttpAPI) OnboardCluster(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
+		return
+	}
+	report, err := inst.OnboardCluster(&instanceKey)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	if orcraft.IsRaftEnabled() {
+		for _, memberKey := range report.Members {
+			orcraft.PublishCommand("discover", memberKey)
+		}
+	}
+	message := fmt.Sprintf("Cluster %s is ready for automated recovery", report.ClusterName)
+	if !report.IsReady {
+		message = fmt.Sprintf("Cluster %s is not ready for automated recovery: %d remediation items", report.ClusterName, len(report.Remediations))
+	}
+	Respond(r, &APIResponse{Code: OK, Message: message, Details: report})
+}
+
 // Refresh synchronuously re-reads a topology instance
 func (this *HttpAPI) Refresh(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 
@@ -249,7 +303,7 @@ func (this *HttpAPI) Refresh(params martini.Params, r render.Render, req *http.R
 // Forget removes an instance entry fro backend database
 func (this *HttpAPI) Forget(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	// We ignore errors: we're looking to do a destructive operation anyhow.
@@ -266,12 +320,12 @@ func (this *HttpAPI) Forget(params martini.Params, r render.Render, req *http.Re
 // ForgetCluster forgets all instacnes of a cluster
 func (this *HttpAPI) ForgetCluster(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	clusterName, err := figureClusterName(getClusterHint(params))
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
 
@@ -288,7 +342,7 @@ func (this *HttpAPI) Resolve(params martini.Params, r render.Render, req *http.R
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 
@@ -305,13 +359,13 @@ func (this *HttpAPI) Resolve(params martini.Params, r render.Render, req *http.R
 // BeginMaintenance begins maintenance mode for given instance
 func (this *HttpAPI) BeginMaintenance(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 	key, err := inst.BeginBoundedMaintenance(&instanceKey, params["owner"], params["reason"], 0, true)
@@ -326,7 +380,7 @@ func (this *HttpAPI) BeginMaintenance(params martini.Params, r render.Render, re
 // EndMaintenance terminates maintenance mode
 func (this *HttpAPI) EndMaintenance(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	maintenanceKey, err := strconv.ParseInt(params["maintenanceKey"], 10, 0)
@@ -346,13 +400,13 @@ func (this *HttpAPI) EndMaintenance(params martini.Params, r render.Render, req
 // EndMaintenanceByInstanceKey terminates maintenance mode for given instance
 func (this *HttpAPI) EndMaintenanceByInstanceKey(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 	_, err = inst.EndMaintenanceByInstanceKey(&instanceKey)
@@ -368,7 +422,7 @@ func (this *HttpAPI) EndMaintenanceByInstanceKey(params martini.Params, r render
 func (this *HttpAPI) InMaintenance(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 	inMaintenance, err := inst.InMaintenance(&instanceKey)
@@ -398,13 +452,13 @@ func (this *HttpAPI) Maintenance(params martini.Params, r render.Render, req *ht
 // BeginDowntime sets a downtime flag with default duration
 func (this *HttpAPI) BeginDowntime(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 
@@ -438,13 +492,13 @@ func (this *HttpAPI) BeginDowntime(params martini.Params, r render.Render, req *
 // EndDowntime terminates downtime (removes downtime flag) for an instance
 func (this *HttpAPI) EndDowntime(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 	if orcraft.IsRaftEnabled() {
@@ -460,19 +514,29 @@ func (this *HttpAPI) EndDowntime(params martini.Params, r render.Render, req *ht
 	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Downtime ended: %+v", instanceKey), Details: instanceKey})
 }
 
+// relocateReplica runs given relocation of a replica, in safe mode when requested via `safe=true`
+func relocateReplica(req *http.Request, operation string, instanceKey *inst.InstanceKey, destinationKey *inst.InstanceKey, relocate func() (*inst.Instance, error)) (*inst.Instance, error) {
+	if req.URL.Query().Get("safe") == "true" {
+		return inst.SafeRelocation(operation, instanceKey, destinationKey, relocate)
+	}
+	return relocate()
+}
+
 // MoveUp attempts to move an instance up the topology
 func (this *HttpAPI) MoveUp(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
-	instance, err := inst.MoveUp(&instanceKey)
+	instance, err := relocateReplica(req, "move-up", &instanceKey, nil, func() (*inst.Instance, error) {
+		return inst.MoveUp(&instanceKey)
+	})
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
@@ -484,12 +548,12 @@ func (this *HttpAPI) MoveUp(params martini.Params, r render.Render, req *http.Re
 // MoveUpReplicas attempts to move up all replicas of an instance
 func (this *HttpAPI) MoveUpReplicas(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 
@@ -506,17 +570,17 @@ func (this *HttpAPI) MoveUpReplicas(params martini.Params, r render.Render, req
 // Useful for binlog servers
 func (this *HttpAPI) Repoint(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 	belowKey, err := this.getInstanceKey(params["belowHost"], params["belowPort"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 
@@ -532,12 +596,12 @@ func (this *HttpAPI) Repoint(params martini.Params, r render.Render, req *http.R
 // MoveUpReplicas attempts to move up all replicas of an instance
 func (this *HttpAPI) RepointReplicas(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 
@@ -553,13 +617,13 @@ func (this *HttpAPI) RepointReplicas(params martini.Params, r render.Render, req
 // MakeCoMaster attempts to make an instance co-master with its own master
 func (this *HttpAPI) MakeCoMaster(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 	instance, err := inst.MakeCoMaster(&instanceKey)
@@ -571,16 +635,37 @@ func (this *HttpAPI) MakeCoMaster(params martini.Params, r render.Render, req *h
 	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Instance made co-master: %+v", instance.Key), Details: instance})
 }
 
+// BreakCoMaster breaks circular replication on its active co-master
+func (this *HttpAPI) BreakCoMaster(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
+		return
+	}
+	instance, err := inst.BreakCoMaster(&instanceKey)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Circular replication broken on: %+v", instance.Key), Details: instance})
+}
+
 // ResetSlave makes a replica forget about its master, effectively breaking the replication
 func (this *HttpAPI) ResetSlave(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 	instance, err := inst.ResetSlaveOperation(&instanceKey)
@@ -596,13 +681,13 @@ func (this *HttpAPI) ResetSlave(params martini.Params, r render.Render, req *htt
 // that is reversible), effectively breaking replication
 func (this *HttpAPI) DetachReplica(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 	instance, err := inst.DetachReplicaOperation(&instanceKey)
@@ -618,13 +703,13 @@ func (this *HttpAPI) DetachReplica(params martini.Params, r render.Render, req *
 // binlog coordinates to an instance
 func (this *HttpAPI) ReattachReplica(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 	instance, err := inst.ReattachReplicaOperation(&instanceKey)
@@ -640,13 +725,13 @@ func (this *HttpAPI) ReattachReplica(params martini.Params, r render.Render, req
 // (yet revertible) host name
 func (this *HttpAPI) DetachReplicaMasterHost(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 	instance, err := inst.DetachReplicaMasterHost(&instanceKey)
@@ -662,13 +747,13 @@ func (this *HttpAPI) DetachReplicaMasterHost(params martini.Params, r render.Ren
 // by resoting the original master hostname in CHANGE MASTER TO
 func (this *HttpAPI) ReattachReplicaMasterHost(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 	instance, err := inst.ReattachReplicaMasterHost(&instanceKey)
@@ -683,13 +768,13 @@ func (this *HttpAPI) ReattachReplicaMasterHost(params martini.Params, r render.R
 // EnableGTID attempts to enable GTID on a replica
 func (this *HttpAPI) EnableGTID(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 	instance, err := inst.EnableGTID(&instanceKey)
@@ -704,13 +789,13 @@ func (this *HttpAPI) EnableGTID(params martini.Params, r render.Render, req *htt
 // DisableGTID attempts to disable GTID on a replica, and revert to binlog file:pos
 func (this *HttpAPI) DisableGTID(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 	instance, err := inst.DisableGTID(&instanceKey)
@@ -725,21 +810,23 @@ func (this *HttpAPI) DisableGTID(params martini.Params, r render.Render, req *ht
 // MoveBelow attempts to move an instance below its supposed sibling
 func (this *HttpAPI) MoveBelow(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 	siblingKey, err := this.getInstanceKey(params["siblingHost"], params["siblingPort"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 
-	instance, err := inst.MoveBelow(&instanceKey, &siblingKey)
+	instance, err := relocateReplica(req, "move-below", &instanceKey, &siblingKey, func() (*inst.Instance, error) {
+		return inst.MoveBelow(&instanceKey, &siblingKey)
+	})
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
@@ -751,21 +838,23 @@ func (this *HttpAPI) MoveBelow(params martini.Params, r render.Render, req *http
 // MoveBelowGTID attempts to move an instance below another, via GTID
 func (this *HttpAPI) MoveBelowGTID(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 	belowKey, err := this.getInstanceKey(params["belowHost"], params["belowPort"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 
-	instance, err := inst.MoveBelowGTID(&instanceKey, &belowKey)
+	instance, err := relocateReplica(req, "move-gtid", &instanceKey, &belowKey, func() (*inst.Instance, error) {
+		return inst.MoveBelowGTID(&instanceKey, &belowKey)
+	})
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
@@ -777,17 +866,17 @@ func (this *HttpAPI) MoveBelowGTID(params martini.Params, r render.Render, req *
 // MoveReplicasGTID attempts to move an instance below another, via GTID
 func (this *HttpAPI) MoveReplicasGTID(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 	belowKey, err := this.getInstanceKey(params["belowHost"], params["belowPort"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 
@@ -803,12 +892,12 @@ func (this *HttpAPI) MoveReplicasGTID(params martini.Params, r render.Render, re
 // TakeSiblings
 func (this *HttpAPI) TakeSiblings(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 
@@ -824,12 +913,12 @@ func (this *HttpAPI) TakeSiblings(params martini.Params, r render.Render, req *h
 // TakeMaster
 func (this *HttpAPI) TakeMaster(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 
@@ -846,21 +935,23 @@ func (this *HttpAPI) TakeMaster(params martini.Params, r render.Render, req *htt
 // relocation method
 func (this *HttpAPI) RelocateBelow(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 	belowKey, err := this.getInstanceKey(params["belowHost"], params["belowPort"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 
-	instance, err := inst.RelocateBelow(&instanceKey, &belowKey)
+	instance, err := relocateReplica(req, "relocate", &instanceKey, &belowKey, func() (*inst.Instance, error) {
+		return inst.RelocateBelow(&instanceKey, &belowKey)
+	})
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
@@ -869,23 +960,57 @@ func (this *HttpAPI) RelocateBelow(params martini.Params, r render.Render, req *
 	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Instance %+v relocated below %+v", instanceKey, belowKey), Details: instance})
 }
 
+// Batch executes an ordered list of topology operations, given as JSON request body, stopping on first error.
+// An optional rollback list of operations is executed in best-effort manner should any operation fail.
+func (this *HttpAPI) Batch(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	batch := &logic.BatchRequest{}
+	if err := json.NewDecoder(req.Body).Decode(batch); err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Cannot parse batch: %+v", err)})
+		return
+	}
+	batchResult, err := logic.ExecuteBatch(batch, getClusterLockActor(req, user))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	if !batchResult.Success {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Batch failed", Details: batchResult})
+		return
+	}
+
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Batch of %d operations executed", len(batch.Operations)), Details: batchResult})
+}
+
 // Relocates attempts to smartly relocate replicas of a given instance below another
 func (this *HttpAPI) RelocateReplicas(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 	belowKey, err := this.getInstanceKey(params["belowHost"], params["belowPort"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 
+	if req.URL.Query().Get("async") == "true" {
+		job, err := logic.StartRelocateReplicasJob(&instanceKey, &belowKey, req.URL.Query().Get("pattern"), getUserId(req, user))
+		if err != nil {
+			Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+			return
+		}
+		Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Started job %s, relocating %d replicas of %+v below %+v", job.Id, job.CountTotal, instanceKey, belowKey), Details: job})
+		return
+	}
 	replicas, _, err, errs := inst.RelocateReplicas(&instanceKey, &belowKey, req.URL.Query().Get("pattern"))
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
@@ -898,21 +1023,23 @@ func (this *HttpAPI) RelocateReplicas(params martini.Params, r render.Render, re
 // MoveEquivalent attempts to move an instance below another, baseed on known equivalence master coordinates
 func (this *HttpAPI) MoveEquivalent(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 	belowKey, err := this.getInstanceKey(params["belowHost"], params["belowPort"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 
-	instance, err := inst.MoveEquivalent(&instanceKey, &belowKey)
+	instance, err := relocateReplica(req, "move-equivalent", &instanceKey, &belowKey, func() (*inst.Instance, error) {
+		return inst.MoveEquivalent(&instanceKey, &belowKey)
+	})
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
@@ -924,12 +1051,12 @@ func (this *HttpAPI) MoveEquivalent(params martini.Params, r render.Render, req
 // LastPseudoGTID attempts to find the last pseugo-gtid entry in an instance
 func (this *HttpAPI) LastPseudoGTID(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 
@@ -959,17 +1086,17 @@ func (this *HttpAPI) LastPseudoGTID(params martini.Params, r render.Render, req
 // MatchBelow attempts to move an instance below another via pseudo GTID matching of binlog entries
 func (this *HttpAPI) MatchBelow(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 	belowKey, err := this.getInstanceKey(params["belowHost"], params["belowPort"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 
@@ -985,12 +1112,12 @@ func (this *HttpAPI) MatchBelow(params martini.Params, r render.Render, req *htt
 // MatchBelow attempts to move an instance below another via pseudo GTID matching of binlog entries
 func (this *HttpAPI) MatchUp(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 
@@ -1006,17 +1133,17 @@ func (this *HttpAPI) MatchUp(params martini.Params, r render.Render, req *http.R
 // MultiMatchReplicas attempts to match all replicas of a given instance below another, efficiently
 func (this *HttpAPI) MultiMatchReplicas(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 	belowKey, err := this.getInstanceKey(params["belowHost"], params["belowPort"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 
@@ -1032,15 +1159,24 @@ func (this *HttpAPI) MultiMatchReplicas(params martini.Params, r render.Render,
 // MatchUpReplicas attempts to match up all replicas of an instance
 func (this *HttpAPI) MatchUpReplicas(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 
+	if req.URL.Query().Get("async") == "true" {
+		job, err := logic.StartMatchUpReplicasJob(&instanceKey, req.URL.Query().Get("pattern"), getUserId(req, user))
+		if err != nil {
+			Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+			return
+		}
+		Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Started job %s, matching up %d replicas of %+v", job.Id, job.CountTotal, instanceKey), Details: job})
+		return
+	}
 	replicas, newMaster, err, errs := inst.MatchUpReplicas(&instanceKey, req.URL.Query().Get("pattern"))
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
@@ -1050,16 +1186,44 @@ func (this *HttpAPI) MatchUpReplicas(params martini.Params, r render.Render, req
 	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Matched up %d replicas of %+v below %+v; %d errors: %+v", len(replicas), instanceKey, newMaster.Key, len(errs), errs), Details: newMaster.Key})
 }
 
+// AsyncJob returns the status, progress and partial results of a job run by this node
+func (this *HttpAPI) AsyncJob(params martini.Params, r render.Render, req *http.Request) {
+	job, found := logic.ReadAsyncJob(params["jobId"])
+	if !found {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Job not found: %s", params["jobId"])})
+		return
+	}
+	r.JSON(http.StatusOK, job)
+}
+
+// AsyncJobs lists the jobs run by this node, most recent first
+func (this *HttpAPI) AsyncJobs(params martini.Params, r render.Render, req *http.Request) {
+	r.JSON(http.StatusOK, logic.ReadAsyncJobs())
+}
+
+// CancelAsyncJob requests a running job to stop
+func (this *HttpAPI) CancelAsyncJob(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	if err := logic.CancelAsyncJob(params["jobId"]); err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Requested job %s to cancel", params["jobId"]), Details: params["jobId"]})
+}
+
 // RegroupReplicas attempts to pick a replica of a given instance and make it take its siblings, using any
 // method possible (GTID, Pseudo-GTID, binlog servers)
 func (this *HttpAPI) RegroupReplicas(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 
@@ -1078,12 +1242,12 @@ func (this *HttpAPI) RegroupReplicas(params martini.Params, r render.Render, req
 // using pseudo-gtid if necessary
 func (this *HttpAPI) RegroupReplicasPseudoGTID(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 
@@ -1102,12 +1266,12 @@ func (this *HttpAPI) RegroupReplicasPseudoGTID(params martini.Params, r render.R
 // RegroupReplicasGTID attempts to pick a replica of a given instance and make it take its siblings, efficiently, using GTID
 func (this *HttpAPI) RegroupReplicasGTID(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 
@@ -1126,12 +1290,12 @@ func (this *HttpAPI) RegroupReplicasGTID(params martini.Params, r render.Render,
 // RegroupReplicasBinlogServers attempts to pick a replica of a given instance and make it take its siblings, efficiently, using GTID
 func (this *HttpAPI) RegroupReplicasBinlogServers(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 
@@ -1149,12 +1313,12 @@ func (this *HttpAPI) RegroupReplicasBinlogServers(params martini.Params, r rende
 // MakeMaster attempts to make the given instance a master, and match its siblings to be its replicas
 func (this *HttpAPI) MakeMaster(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 
@@ -1171,12 +1335,12 @@ func (this *HttpAPI) MakeMaster(params martini.Params, r render.Render, req *htt
 // enslaving its siblings and replicating from its grandparent.
 func (this *HttpAPI) MakeLocalMaster(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 
@@ -1192,13 +1356,13 @@ func (this *HttpAPI) MakeLocalMaster(params martini.Params, r render.Render, req
 // SkipQuery skips a single query on a failed replication instance
 func (this *HttpAPI) SkipQuery(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 	instance, err := inst.SkipQuery(&instanceKey)
@@ -1210,1663 +1374,4307 @@ func (this *HttpAPI) SkipQuery(params martini.Params, r render.Render, req *http
 	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Query skipped on %+v", instance.Key), Details: instance})
 }
 
-// StartSlave starts replication on given instance
-func (this *HttpAPI) StartSlave(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+// RepairReplicationCorruption remediates relay log or binary log corruption on given replica
+func (this *HttpAPI) RepairReplicationCorruption(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
-	instance, err := inst.StartSlave(&instanceKey)
+	instance, err := inst.RepairReplicationCorruption(&instanceKey)
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
 
-	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Replica started: %+v", instance.Key), Details: instance})
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Replication corruption repaired on %+v", instance.Key), Details: instance})
 }
 
-// RestartSlave stops & starts replication on given instance
-func (this *HttpAPI) RestartSlave(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+// SetSQLDelay changes the SQL_Delay of a replica. On a tagged delayed replica, this also sets its intended delay.
+func (this *HttpAPI) SetSQLDelay(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
-
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
-	instance, err := inst.RestartSlave(&instanceKey)
+	// The delay is given either in seconds, or as simple time, e.g. "1h"
+	sqlDelay, err := strconv.ParseUint(params["delay"], 10, 32)
+	if err != nil {
+		delaySeconds, simpleTimeErr := util.SimpleTimeToSeconds(params["delay"])
+		if simpleTimeErr != nil {
+			Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Invalid SQL delay: %s", params["delay"])})
+			return
+		}
+		sqlDelay = uint64(delaySeconds)
+	}
+	instance, err := logic.SetSQLDelay(&instanceKey, uint(sqlDelay))
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
 
-	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Replica restarted: %+v", instance.Key), Details: instance})
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("SQL_Delay set to %d seconds on %+v", instance.SQLDelay, instance.Key), Details: instance})
 }
 
-// StopSlave stops replication on given instance
-func (this *HttpAPI) StopSlave(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+// TagDelayedReplica tags a replica as intentionally delayed, by its current SQL_Delay
+func (this *HttpAPI) TagDelayedReplica(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
-
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
-	instance, err := inst.StopSlave(&instanceKey)
+	delayedReplica, err := logic.TagDelayedReplica(&instanceKey, getClusterLockActor(req, user), req.URL.Query().Get("reason"))
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
 
-	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Replica stopped: %+v", instance.Key), Details: instance})
+	Respond(r, &APIResponse{Code: OK, Message: delayedReplica.String(), Details: delayedReplica})
 }
 
-// StopSlaveNicely stops replication on given instance, such that sql thead is aligned with IO thread
-func (this *HttpAPI) StopSlaveNicely(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+// UntagDelayedReplica removes the delayed replica tag of a replica
+func (this *HttpAPI) UntagDelayedReplica(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
-
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
-	instance, err := inst.StopSlaveNicely(&instanceKey, 0)
-	if err != nil {
+	if err := logic.UntagDelayedReplica(&instanceKey); err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
 
-	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Replica stopped nicely: %+v", instance.Key), Details: instance})
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("%+v untagged as delayed replica", instanceKey), Details: instanceKey})
 }
 
-// FlushBinaryLogs runs a single FLUSH BINARY LOGS
-func (this *HttpAPI) FlushBinaryLogs(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+// SuspendSQLDelay lets a delayed replica catch up with its master for a while, after which its delay is restored
+func (this *HttpAPI) SuspendSQLDelay(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
-
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
-	instance, err := inst.FlushBinaryLogs(&instanceKey, 1)
+	durationSeconds := defaultSQLDelaySuspensionSeconds
+	if params["duration"] != "" {
+		durationSeconds, err = util.SimpleTimeToSeconds(params["duration"])
+		if err == nil && durationSeconds <= 0 {
+			err = fmt.Errorf("Duration value must be positive. Given value: %d", durationSeconds)
+		}
+		if err != nil {
+			Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+			return
+		}
+	}
+	delayedReplica, err := logic.SuspendSQLDelay(&instanceKey, uint(durationSeconds), getClusterLockActor(req, user), req.URL.Query().Get("reason"))
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
 
-	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Binary logs flushed on: %+v", instance.Key), Details: instance})
+	Respond(r, &APIResponse{Code: OK, Message: delayedReplica.String(), Details: delayedReplica})
 }
 
-// RestartSlaveStatements receives a query to execute that requires a replication restart to apply.
-// As an example, this may be `set global rpl_semi_sync_slave_enabled=1`. orchestrator will check
-// replication status on given host and will wrap with appropriate stop/start statements, if need be.
-func (this *HttpAPI) RestartSlaveStatements(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+// ResumeSQLDelay restores the intended SQL_Delay of a delayed replica whose delay is suspended
+func (this *HttpAPI) ResumeSQLDelay(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
-
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
-
-	query := req.URL.Query().Get("q")
-	statements, err := inst.GetSlaveRestartPreserveStatements(&instanceKey, query)
-
+	instance, err := logic.ResumeSQLDelay(&instanceKey)
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
 
-	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("statements for: %+v", instanceKey), Details: statements})
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("SQL_Delay restored to %d seconds on %+v", instance.SQLDelay, instance.Key), Details: instance})
 }
 
-// MasterEquivalent provides (possibly empty) list of master coordinates equivalent to the given ones
-func (this *HttpAPI) MasterEquivalent(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
-		return
-	}
-	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
-	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
-		return
-	}
-	coordinates, err := this.getBinlogCoordinates(params["logFile"], params["logPos"])
+// DelayedReplicas lists the delayed replicas of a cluster, along with their effective data age
+func (this *HttpAPI) DelayedReplicas(params martini.Params, r render.Render, req *http.Request) {
+	clusterName, err := figureClusterName(getClusterHint(params))
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-	instanceCoordinates := &inst.InstanceBinlogCoordinates{Key: instanceKey, Coordinates: coordinates}
-
-	equivalentCoordinates, err := inst.GetEquivalentMasterCoordinates(instanceCoordinates)
+	instances, err := inst.ReadClusterDelayedReplicas(clusterName)
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
 
-	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Found %+v equivalent coordinates", len(equivalentCoordinates)), Details: equivalentCoordinates})
+	r.JSON(http.StatusOK, instances)
 }
 
-// CanReplicateFrom attempts to move an instance below another via pseudo GTID matching of binlog entries
-func (this *HttpAPI) CanReplicateFrom(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+// executeWithRevert executes given action on given instance and schedules its revert, given the request has a
+// revert-after parameter (e.g. 10m, 1h). It returns false, having done nothing, when no such parameter is given.
+func (this *HttpAPI) executeWithRevert(r render.Render, req *http.Request, user auth.User, instanceKey *inst.InstanceKey, action string) (handled bool) {
+	revertAfter := req.URL.Query().Get("revert-after")
+	if revertAfter == "" {
+		return false
+	}
+	revertAfterSeconds, err := util.SimpleTimeToSeconds(revertAfter)
+	if err != nil || revertAfterSeconds <= 0 {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Invalid revert-after: %s", revertAfter)})
+		return true
+	}
+	_, revert, err := logic.ExecuteWithRevert(instanceKey, action, uint(revertAfterSeconds), getClusterLockActor(req, user), req.URL.Query().Get("reason"))
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
-		return
+		return true
 	}
-	instance, found, err := inst.ReadInstance(&instanceKey)
-	if (!found) || (err != nil) {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Cannot read instance: %+v", instanceKey)})
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("%s on %+v; %s scheduled at %s", action, *instanceKey, revert.RevertAction, revert.RevertAtString), Details: revert})
+	return true
+}
+
+// StartSlave starts replication on given instance
+func (this *HttpAPI) StartSlave(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
 		return
 	}
-	belowKey, err := this.getInstanceKey(params["belowHost"], params["belowPort"])
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
-	belowInstance, found, err := inst.ReadInstance(&belowKey)
-	if (!found) || (err != nil) {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Cannot read instance: %+v", belowKey)})
+	if this.executeWithRevert(r, req, user, &instanceKey, "start-slave") {
 		return
 	}
-
-	canReplicate, err := instance.CanReplicateFrom(belowInstance)
+	instance, err := inst.StartSlave(&instanceKey)
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
 
-	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("%t", canReplicate), Details: belowKey})
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Replica started: %+v", instance.Key), Details: instance})
 }
 
-// setSemiSyncMaster
-func (this *HttpAPI) setSemiSyncMaster(params martini.Params, r render.Render, req *http.Request, user auth.User, enable bool) {
+// RestartSlave stops & starts replication on given instance
+func (this *HttpAPI) RestartSlave(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
-	instance, err := inst.SetSemiSyncMaster(&instanceKey, enable)
+	instance, err := inst.RestartSlave(&instanceKey)
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
 
-	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("master semi-sync set to %t", enable), Details: instance})
-}
-
-func (this *HttpAPI) EnableSemiSyncMaster(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	this.setSemiSyncMaster(params, r, req, user, true)
-}
-func (this *HttpAPI) DisableSemiSyncMaster(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	this.setSemiSyncMaster(params, r, req, user, false)
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Replica restarted: %+v", instance.Key), Details: instance})
 }
 
-// setSemiSyncMaster
-func (this *HttpAPI) setSemiSyncReplica(params martini.Params, r render.Render, req *http.Request, user auth.User, enable bool) {
+// StopSlave stops replication on given instance
+func (this *HttpAPI) StopSlave(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
-	instance, err := inst.SetSemiSyncReplica(&instanceKey, enable)
+	if this.executeWithRevert(r, req, user, &instanceKey, "stop-slave") {
+		return
+	}
+	instance, err := inst.StopSlave(&instanceKey)
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
 
-	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("replica semi-sync set to %t", enable), Details: instance})
-}
-
-func (this *HttpAPI) EnableSemiSyncReplica(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	this.setSemiSyncReplica(params, r, req, user, true)
-}
-
-func (this *HttpAPI) DisableSemiSyncReplica(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	this.setSemiSyncReplica(params, r, req, user, false)
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Replica stopped: %+v", instance.Key), Details: instance})
 }
 
-// SetReadOnly sets the global read_only variable
-func (this *HttpAPI) SetReadOnly(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+// StopSlaveNicely stops replication on given instance, such that sql thead is aligned with IO thread
+func (this *HttpAPI) StopSlaveNicely(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
-	instance, err := inst.SetReadOnly(&instanceKey, true)
+	instance, err := inst.StopSlaveNicely(&instanceKey, 0)
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
 
-	Respond(r, &APIResponse{Code: OK, Message: "Server set as read-only", Details: instance})
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Replica stopped nicely: %+v", instance.Key), Details: instance})
 }
 
-// SetWriteable clear the global read_only variable
-func (this *HttpAPI) SetWriteable(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+// changeReplicationThread starts or stops a single replication thread on given instance, on an optional "channel"
+func (this *HttpAPI) changeReplicationThread(action inst.ReplicationThreadAction, params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
-
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
+		return
+	}
+	thread, err := inst.ParseReplicationThread(params["thread"])
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-	instance, err := inst.SetReadOnly(&instanceKey, false)
+	instance, err := inst.ChangeReplicationThread(&instanceKey, action, thread, req.URL.Query().Get("channel"))
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
 
-	Respond(r, &APIResponse{Code: OK, Message: "Server set as writeable", Details: instance})
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Replication %s: %s on %+v", thread, action, instance.Key), Details: instance})
 }
 
-// KillQuery kills a query running on a server
-func (this *HttpAPI) KillQuery(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+// StartSlaveThread starts either the IO thread or the SQL thread on given instance
+func (this *HttpAPI) StartSlaveThread(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	this.changeReplicationThread(inst.StartReplicationThreadAction, params, r, req, user)
+}
+
+// StopSlaveThread stops either the IO thread or the SQL thread on given instance
+func (this *HttpAPI) StopSlaveThread(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	this.changeReplicationThread(inst.StopReplicationThreadAction, params, r, req, user)
+}
+
+// changeClusterReplicationThreads starts or stops a single replication thread on all replicas of a cluster
+func (this *HttpAPI) changeClusterReplicationThreads(action inst.ReplicationThreadAction, params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
-	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
-	processId, err := strconv.ParseInt(params["process"], 10, 0)
+	clusterName, err := figureClusterName(getClusterHint(params))
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-
+	thread, err := inst.ParseReplicationThread(params["thread"])
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-	instance, err := inst.KillQuery(&instanceKey, processId)
+	results, err := inst.ChangeClusterReplicationThreads(clusterName, action, thread, req.URL.Query().Get("channel"))
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-
-	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Query killed on : %+v", instance.Key), Details: instance})
-}
-
-// AsciiTopology returns an ascii graph of cluster's instances
-func (this *HttpAPI) asciiTopology(params martini.Params, r render.Render, req *http.Request, tabulated bool) {
-	clusterName, err := figureClusterName(getClusterHint(params))
-	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
-		return
+	countFailed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			countFailed++
+		}
 	}
-
-	asciiOutput, err := inst.ASCIITopology(clusterName, "", tabulated)
-	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+	if countFailed > 0 {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Replication %s: %s failed on %d out of %d replicas of %s", thread, action, countFailed, len(results), clusterName), Details: results})
 		return
 	}
 
-	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Topology for cluster %s", clusterName), Details: asciiOutput})
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Replication %s: %s on %d replicas of %s", thread, action, len(results), clusterName), Details: results})
 }
 
-// AsciiTopology returns an ascii graph of cluster's instances
-func (this *HttpAPI) AsciiTopology(params martini.Params, r render.Render, req *http.Request) {
-	this.asciiTopology(params, r, req, false)
+// StartClusterReplicasThread starts either the IO thread or the SQL thread on all replicas of a cluster
+func (this *HttpAPI) StartClusterReplicasThread(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	this.changeClusterReplicationThreads(inst.StartReplicationThreadAction, params, r, req, user)
 }
 
-// AsciiTopology returns an ascii graph of cluster's instances
-func (this *HttpAPI) AsciiTopologyTabulated(params martini.Params, r render.Render, req *http.Request) {
-	this.asciiTopology(params, r, req, true)
+// StopClusterReplicasThread stops either the IO thread or the SQL thread on all replicas of a cluster, e.g.
+// freezing apply while replicas keep pulling from their masters
+func (this *HttpAPI) StopClusterReplicasThread(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	this.changeClusterReplicationThreads(inst.StopReplicationThreadAction, params, r, req, user)
 }
 
-// Cluster provides list of instances in given cluster
-func (this *HttpAPI) Cluster(params martini.Params, r render.Render, req *http.Request) {
-	clusterName, err := figureClusterName(getClusterHint(params))
-	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+// FlushBinaryLogs runs a single FLUSH BINARY LOGS
+func (this *HttpAPI) FlushBinaryLogs(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
 		return
 	}
-
-	instances, err := inst.ReadClusterInstances(clusterName)
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
-
-	r.JSON(http.StatusOK, instances)
-}
-
-// ClusterByAlias provides list of instances in given cluster
-func (this *HttpAPI) ClusterByAlias(params martini.Params, r render.Render, req *http.Request) {
-	clusterName, err := inst.GetClusterByAlias(params["clusterAlias"])
+	instance, err := inst.FlushBinaryLogs(&instanceKey, 1)
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
 
-	params["clusterName"] = clusterName
-	this.Cluster(params, r, req)
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Binary logs flushed on: %+v", instance.Key), Details: instance})
 }
 
-// ClusterByInstance provides list of instances in cluster an instance belongs to
-func (this *HttpAPI) ClusterByInstance(params martini.Params, r render.Render, req *http.Request) {
-	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
-	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
-		return
-	}
-	instance, found, err := inst.ReadInstance(&instanceKey)
-	if (!found) || (err != nil) {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Cannot read instance: %+v", instanceKey)})
+// RestartSlaveStatements receives a query to execute that requires a replication restart to apply.
+// As an example, this may be `set global rpl_semi_sync_slave_enabled=1`. orchestrator will check
+// replication status on given host and will wrap with appropriate stop/start statements, if need be.
+func (this *HttpAPI) RestartSlaveStatements(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
 		return
 	}
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
-	params["clusterName"] = instance.ClusterName
-	this.Cluster(params, r, req)
-}
-
-// ClusterInfo provides details of a given cluster
-func (this *HttpAPI) ClusterInfo(params martini.Params, r render.Render, req *http.Request) {
-	clusterName, err := figureClusterName(getClusterHint(params))
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
-	clusterInfo, err := inst.ReadClusterInfo(clusterName)
+
+	query := req.URL.Query().Get("q")
+	statements, err := inst.GetSlaveRestartPreserveStatements(&instanceKey, query)
 
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
 
-	r.JSON(http.StatusOK, clusterInfo)
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("statements for: %+v", instanceKey), Details: statements})
 }
 
-// Cluster provides list of instances in given cluster
-func (this *HttpAPI) ClusterInfoByAlias(params martini.Params, r render.Render, req *http.Request) {
-	clusterName, err := inst.GetClusterByAlias(params["clusterAlias"])
+// MasterEquivalent provides (possibly empty) list of master coordinates equivalent to the given ones
+func (this *HttpAPI) MasterEquivalent(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
-
-	params["clusterName"] = clusterName
-	this.ClusterInfo(params, r, req)
-}
-
-// ClusterOSCReplicas returns heuristic list of OSC replicas
-func (this *HttpAPI) ClusterOSCReplicas(params martini.Params, r render.Render, req *http.Request) {
-	clusterName, err := figureClusterName(getClusterHint(params))
+	coordinates, err := this.getBinlogCoordinates(params["logFile"], params["logPos"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
+	instanceCoordinates := &inst.InstanceBinlogCoordinates{Key: instanceKey, Coordinates: coordinates}
 
-	instances, err := inst.GetClusterOSCReplicas(clusterName)
+	equivalentCoordinates, err := inst.GetEquivalentMasterCoordinates(instanceCoordinates)
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
 
-	r.JSON(http.StatusOK, instances)
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Found %+v equivalent coordinates", len(equivalentCoordinates)), Details: equivalentCoordinates})
 }
 
-// SetClusterAlias will change an alias for a given clustername
-func (this *HttpAPI) SetClusterAliasManualOverride(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+// BinlogCoordinatesAt translates a point in time into a master's binary log coordinates, as bracketed by
+// the checkpoints recorded just before and just after that time
+func (this *HttpAPI) BinlogCoordinatesAt(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
-	clusterName := params["clusterName"]
-	alias := req.URL.Query().Get("alias")
-
-	err := inst.SetClusterAliasManualOverride(clusterName, alias)
+	t, err := inst.ParseCheckpointTime(params["time"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Cluster %s now has alias '%s'", clusterName, alias)})
-}
-
-// Clusters provides list of known clusters
-func (this *HttpAPI) Clusters(params martini.Params, r render.Render, req *http.Request) {
-	clusterNames, err := inst.ReadClusters()
-
+	checkpointRange, err := inst.ReadBinlogCheckpointRange(&instanceKey, t)
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-
-	r.JSON(http.StatusOK, clusterNames)
-}
-
-// ClustersInfo provides list of known clusters, along with some added metadata per cluster
-func (this *HttpAPI) ClustersInfo(params martini.Params, r render.Render, req *http.Request) {
-	clustersInfo, err := inst.ReadClustersInfo("")
-
-	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+	if checkpointRange.Preceding == nil && checkpointRange.Following == nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("No binlog checkpoints found for %+v", instanceKey)})
 		return
 	}
 
-	r.JSON(http.StatusOK, clustersInfo)
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Binlog checkpoints of %+v around %+v", instanceKey, t.UTC().Format(time.RFC3339)), Details: checkpointRange})
 }
 
-// Write a cluster's master (or all clusters masters) to kv stores.
-// This should generally only happen once in a lifetime of a cluster. Otherwise KV
-// stores are updated via failovers.
-func (this *HttpAPI) SubmitMastersToKvStores(params martini.Params, r render.Render, req *http.Request) {
-	clusterName, err := getClusterNameIfExists(params)
+// CanReplicateFrom attempts to move an instance below another via pseudo GTID matching of binlog entries
+func (this *HttpAPI) CanReplicateFrom(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
+		return
+	}
+	instance, found, err := inst.ReadInstance(&instanceKey)
+	if (!found) || (err != nil) {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInstanceNotFound, Message: fmt.Sprintf("Cannot read instance: %+v", instanceKey)})
 		return
 	}
-	kvPairs, err := inst.GetMastersKVPairs(clusterName)
+	belowKey, err := this.getInstanceKey(params["belowHost"], params["belowPort"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
-	for _, kvPair := range kvPairs {
-		if orcraft.IsRaftEnabled() {
-			_, err = orcraft.PublishCommand("put-key-value", kvPair)
-		} else {
-			err = kv.PutKVPair(kvPair)
-		}
-		if err != nil {
-			Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
-			return
-		}
+	belowInstance, found, err := inst.ReadInstance(&belowKey)
+	if (!found) || (err != nil) {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInstanceNotFound, Message: fmt.Sprintf("Cannot read instance: %+v", belowKey)})
+		return
 	}
-	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Submitted %d masters", len(kvPairs)), Details: kvPairs})
-}
-
-// Clusters provides list of known masters
-func (this *HttpAPI) Masters(params martini.Params, r render.Render, req *http.Request) {
-	instances, err := inst.ReadWriteableClustersMasters()
 
+	canReplicate, err := instance.CanReplicateFrom(belowInstance)
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
 
-	r.JSON(http.StatusOK, instances)
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("%t", canReplicate), Details: belowKey})
 }
 
-// ClusterMaster returns the writable master of a given cluster
-func (this *HttpAPI) ClusterMaster(params martini.Params, r render.Render, req *http.Request) {
-	clusterName, err := figureClusterName(getClusterHint(params))
-	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+// setSemiSyncMaster
+func (this *HttpAPI) setSemiSyncMaster(params martini.Params, r render.Render, req *http.Request, user auth.User, enable bool) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
 		return
 	}
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
-	masters, err := inst.ReadClusterMaster(clusterName)
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
-	if len(masters) == 0 {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("No masters found for %+v", clusterName)})
+	instance, err := inst.SetSemiSyncMaster(&instanceKey, enable)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
 
-	r.JSON(http.StatusOK, masters[0])
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("master semi-sync set to %t", enable), Details: instance})
 }
 
-// Downtimed lists downtimed instances, potentially filtered by cluster
-func (this *HttpAPI) Downtimed(params martini.Params, r render.Render, req *http.Request) {
-	clusterName, err := getClusterNameIfExists(params)
-	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+func (this *HttpAPI) EnableSemiSyncMaster(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	this.setSemiSyncMaster(params, r, req, user, true)
+}
+func (this *HttpAPI) DisableSemiSyncMaster(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	this.setSemiSyncMaster(params, r, req, user, false)
+}
+
+// setSemiSyncMaster
+func (this *HttpAPI) setSemiSyncReplica(params martini.Params, r render.Render, req *http.Request, user auth.User, enable bool) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
 		return
 	}
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
-	instances, err := inst.ReadDowntimedInstances(clusterName)
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
-
-	r.JSON(http.StatusOK, instances)
-}
-
-// AllInstances lists all known instances
-func (this *HttpAPI) AllInstances(params martini.Params, r render.Render, req *http.Request) {
-	instances, err := inst.SearchInstances("")
-
+	instance, err := inst.SetSemiSyncReplica(&instanceKey, enable)
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
 
-	r.JSON(http.StatusOK, instances)
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("replica semi-sync set to %t", enable), Details: instance})
 }
 
-// Search provides list of instances matching given search param via various criteria.
-func (this *HttpAPI) Search(params martini.Params, r render.Render, req *http.Request) {
-	searchString := params["searchString"]
-	if searchString == "" {
-		searchString = req.URL.Query().Get("s")
+func (this *HttpAPI) EnableSemiSyncReplica(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	this.setSemiSyncReplica(params, r, req, user, true)
+}
+
+func (this *HttpAPI) DisableSemiSyncReplica(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	this.setSemiSyncReplica(params, r, req, user, false)
+}
+
+// SetReadOnly sets the global read_only variable
+func (this *HttpAPI) SetReadOnly(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
 	}
-	instances, err := inst.SearchInstances(searchString)
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
+		return
+	}
+	if this.executeWithRevert(r, req, user, &instanceKey, "set-read-only") {
+		return
+	}
+	instance, err := inst.SetReadOnly(&instanceKey, true)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
 
-	r.JSON(http.StatusOK, instances)
+	Respond(r, &APIResponse{Code: OK, Message: "Server set as read-only", Details: instance})
 }
 
-// Problems provides list of instances with known problems
-func (this *HttpAPI) Problems(params martini.Params, r render.Render, req *http.Request) {
-	clusterName := params["clusterName"]
-	instances, err := inst.ReadProblemInstances(clusterName)
+// SetWriteable clear the global read_only variable
+func (this *HttpAPI) SetWriteable(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
-
-	r.JSON(http.StatusOK, instances)
-}
-
-// Audit provides list of audit entries by given page number
-func (this *HttpAPI) Audit(params martini.Params, r render.Render, req *http.Request) {
-	page, err := strconv.Atoi(params["page"])
-	if err != nil || page < 0 {
-		page = 0
+	if this.executeWithRevert(r, req, user, &instanceKey, "set-writeable") {
+		return
 	}
-	var auditedInstanceKey *inst.InstanceKey
-	if instanceKey, err := this.getInstanceKey(params["host"], params["port"]); err == nil {
-		auditedInstanceKey = &instanceKey
+	instance, err := inst.SetReadOnly(&instanceKey, false)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
 	}
 
-	audits, err := inst.ReadRecentAudit(auditedInstanceKey, page)
+	Respond(r, &APIResponse{Code: OK, Message: "Server set as writeable", Details: instance})
+}
 
+// WritableInstances lists the writable members of a cluster; a healthy cluster has at most one
+func (this *HttpAPI) WritableInstances(params martini.Params, r render.Render, req *http.Request) {
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	instances, err := inst.ReadClusterWritableInstances(clusterName)
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
 
-	r.JSON(http.StatusOK, audits)
+	r.JSON(http.StatusOK, instances)
 }
 
-// LongQueries lists queries running for a long time, on all instances, optionally filtered by
-// arbitrary text
-func (this *HttpAPI) LongQueries(params martini.Params, r render.Render, req *http.Request) {
-	longQueries, err := inst.ReadLongRunningProcesses(params["filter"])
-
+// ResolveDualWritable sets all writable members of the instance's cluster read-only, except for the instance itself
+func (this *HttpAPI) ResolveDualWritable(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
+		return
+	}
+	demoted, err := inst.ResolveDualWritableMasters(&instanceKey)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error(), Details: demoted})
 		return
 	}
 
-	r.JSON(http.StatusOK, longQueries)
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Set %d servers read-only; %+v remains writable", len(demoted), instanceKey), Details: demoted})
 }
 
-// HostnameResolveCache shows content of in-memory hostname cache
-func (this *HttpAPI) HostnameResolveCache(params martini.Params, r render.Render, req *http.Request) {
-	content, err := inst.HostnameResolveCache()
+// KillQuery kills a query running on a server
+func (this *HttpAPI) KillQuery(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+	processId, err := strconv.ParseInt(params["process"], 10, 0)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
 
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	instance, err := inst.KillQuery(&instanceKey, processId)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
 
-	Respond(r, &APIResponse{Code: OK, Message: "Cache retrieved", Details: content})
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Query killed on : %+v", instance.Key), Details: instance})
 }
 
-// ResetHostnameResolveCache clears in-memory hostname resovle cache
-func (this *HttpAPI) ResetHostnameResolveCache(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+// SetInstanceFlag sets a persisted flag on an instance, e.g. never-promote
+func (this *HttpAPI) SetInstanceFlag(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
-	err := inst.ResetHostnameResolveCache()
-
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
+		return
+	}
+	flag, err := inst.ParseInstanceFlag(params["flag"])
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	entry, err := logic.SetInstanceFlag(&instanceKey, flag, getClusterLockActor(req, user), req.URL.Query().Get("reason"))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
 
-	Respond(r, &APIResponse{Code: OK, Message: "Hostname cache cleared"})
+	Respond(r, &APIResponse{Code: OK, Message: entry.String(), Details: entry})
 }
 
-// DeregisterHostnameUnresolve deregisters the unresolve name used previously
-func (this *HttpAPI) DeregisterHostnameUnresolve(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+// ClearInstanceFlag clears a persisted flag of an instance
+func (this *HttpAPI) ClearInstanceFlag(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
-
-	var instanceKey *inst.InstanceKey
-	if instKey, err := this.getInstanceKey(params["host"], params["port"]); err == nil {
-		instanceKey = &instKey
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
+		return
 	}
+	flag, err := inst.ParseInstanceFlag(params["flag"])
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	if err := logic.ClearInstanceFlag(&instanceKey, flag); err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("%s cleared on %+v", flag, instanceKey), Details: instanceKey})
+}
 
+// InstanceFlags lists the persisted flags of an instance, or of all instances when none is given
+func (this *HttpAPI) InstanceFlags(params martini.Params, r render.Render, req *http.Request) {
+	var entries []inst.InstanceFlagEntry
 	var err error
-	registration := inst.NewHostnameDeregistration(instanceKey)
-	if orcraft.IsRaftEnabled() {
-		_, err = orcraft.PublishCommand("register-hostname-unresolve", registration)
+	if params["host"] == "" {
+		entries, err = inst.ReadAllInstanceFlagEntries()
 	} else {
-		err = inst.RegisterHostnameUnresolve(registration)
+		instanceKey, keyErr := this.getInstanceKey(params["host"], params["port"])
+		if keyErr != nil {
+			Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: keyErr.Error()})
+			return
+		}
+		entries, err = inst.ReadInstanceFlagEntries(&instanceKey)
 	}
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-	Respond(r, &APIResponse{Code: OK, Message: "Hostname deregister unresolve completed", Details: instanceKey})
+
+	r.JSON(http.StatusOK, entries)
 }
 
-// RegisterHostnameUnresolve registers the unresolve name to use
-func (this *HttpAPI) RegisterHostnameUnresolve(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+// SetInstanceNote attaches a note, given by the note query param, and optionally a runbook URL, given by the
+// runbook-url query param, to an instance
+func (this *HttpAPI) SetInstanceNote(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
-
-	var instanceKey *inst.InstanceKey
-	if instKey, err := this.getInstanceKey(params["host"], params["port"]); err == nil {
-		instanceKey = &instKey
-	}
-
-	hostname := params["virtualname"]
-	var err error
-	registration := inst.NewHostnameRegistration(instanceKey, hostname)
-	if orcraft.IsRaftEnabled() {
-		_, err = orcraft.PublishCommand("register-hostname-unresolve", registration)
-	} else {
-		err = inst.RegisterHostnameUnresolve(registration)
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
+		return
 	}
+	note, err := logic.SetInstanceNote(&instanceKey, req.URL.Query().Get("note"), req.URL.Query().Get("runbook-url"), getClusterLockActor(req, user))
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-	Respond(r, &APIResponse{Code: OK, Message: "Hostname register unresolve completed", Details: instanceKey})
+
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Note set on %+v", instanceKey), Details: note})
 }
 
-// SubmitPoolInstances (re-)applies the list of hostnames for a given pool
-func (this *HttpAPI) SubmitPoolInstances(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+// ClearInstanceNote removes the note of an instance
+func (this *HttpAPI) ClearInstanceNote(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
+		return
+	}
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
+		return
+	}
+	if err := logic.ClearInstanceNote(&instanceKey); err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-	pool := params["pool"]
-	instances := req.URL.Query().Get("instances")
 
-	var err error
-	submission := inst.NewPoolInstancesSubmission(pool, instances)
-	if orcraft.IsRaftEnabled() {
-		_, err = orcraft.PublishCommand("submit-pool-instances", submission)
-	} else {
-		err = inst.ApplyPoolInstances(submission)
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Note cleared on %+v", instanceKey), Details: instanceKey})
+}
+
+// InstanceNote returns the note of an instance, or null when it has none
+func (this *HttpAPI) InstanceNote(params martini.Params, r render.Render, req *http.Request) {
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
+		return
 	}
+	note, err := inst.ReadInstanceNote(&instanceKey)
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
 
-	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Applied %s pool instances", pool), Details: pool})
+	r.JSON(http.StatusOK, note)
 }
 
-// SubmitPoolHostnames (re-)applies the list of hostnames for a given pool
-func (this *HttpAPI) ReadClusterPoolInstancesMap(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+// InstanceNotes lists the notes of the members of a cluster
+func (this *HttpAPI) InstanceNotes(params martini.Params, r render.Render, req *http.Request) {
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-	clusterName := params["clusterName"]
-	pool := params["pool"]
-
-	poolInstancesMap, err := inst.ReadClusterPoolInstancesMap(clusterName, pool)
+	notes, err := inst.ReadClusterInstanceNotes(clusterName)
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
 
-	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Read pool instances for cluster %s", clusterName), Details: poolInstancesMap})
+	r.JSON(http.StatusOK, notes)
 }
 
-// GetHeuristicClusterPoolInstances returns instances belonging to a cluster's pool
-func (this *HttpAPI) GetHeuristicClusterPoolInstances(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+// SetClusterNote attaches a note, given by the note query param, and optionally a runbook URL, given by the
+// runbook-url query param, to a cluster
+func (this *HttpAPI) SetClusterNote(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	clusterName, err := figureClusterName(getClusterHint(params))
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-	pool := params["pool"]
-
-	instances, err := inst.GetHeuristicClusterPoolInstances(clusterName, pool)
+	clusterAlias, err := logic.GetClusterNoteAlias(clusterName)
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
+	note, err := logic.SetClusterNote(clusterAlias, req.URL.Query().Get("note"), req.URL.Query().Get("runbook-url"), getClusterLockActor(req, user))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
 
-	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Heuristic pool instances for cluster %s", clusterName), Details: instances})
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Note set on cluster %s", clusterAlias), Details: note})
 }
 
-// GetHeuristicClusterPoolInstances returns instances belonging to a cluster's pool
-func (this *HttpAPI) GetHeuristicClusterPoolInstancesLag(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+// ClearClusterNote removes the note of a cluster
+func (this *HttpAPI) ClearClusterNote(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
-	clusterName, err := inst.ReadClusterNameByAlias(params["clusterName"])
+	clusterName, err := figureClusterName(getClusterHint(params))
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-	pool := params["pool"]
-
-	lag, err := inst.GetHeuristicClusterPoolInstancesLag(clusterName, pool)
+	clusterAlias, err := logic.GetClusterNoteAlias(clusterName)
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
+	if err := logic.ClearClusterNote(clusterAlias); err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
 
-	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Heuristic pool lag for cluster %s", clusterName), Details: lag})
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Note cleared on cluster %s", clusterAlias), Details: clusterAlias})
 }
 
-// ReloadClusterAlias clears in-memory hostname resovle cache
-func (this *HttpAPI) ReloadClusterAlias(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+// ClusterNote returns the note of a cluster, or null when it has none
+func (this *HttpAPI) ClusterNote(params martini.Params, r render.Render, req *http.Request) {
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	clusterAlias, err := logic.GetClusterNoteAlias(clusterName)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	note, err := inst.ReadClusterNote(clusterAlias)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
 
-	Respond(r, &APIResponse{Code: ERROR, Message: "This API call has been retired"})
+	r.JSON(http.StatusOK, note)
 }
 
-// BulkPromotionRules returns a list of the known promotion rules for each instance
-func (this *HttpAPI) BulkPromotionRules(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+// SubscribeStateEvents creates or replaces a state event subscription, publishing the state events matching its
+// filters onto its own topic. Filters are given by the cluster-pattern (regular expression on cluster name), event-types
+// (comma delimited) and min-severity (info|warning|critical) query params.
+func (this *HttpAPI) SubscribeStateEvents(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
-
-	promotionRules, err := inst.BulkReadCandidateDatabaseInstance()
+	query := req.URL.Query()
+	subscription, err := inst.NewStateEventSubscription(params["name"], query.Get("topic"), query.Get("cluster-pattern"), query.Get("event-types"), query.Get("min-severity"), getUserId(req, user))
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	if err := logic.SubscribeStateEvents(subscription); err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
 
-	r.JSON(http.StatusOK, promotionRules)
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("State events subscription %s publishes onto %s", subscription.Name, subscription.Topic), Details: subscription})
 }
 
-// BulkInstances returns a list of all known instances
-func (this *HttpAPI) BulkInstances(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+// UnsubscribeStateEvents removes a state event subscription
+func (this *HttpAPI) UnsubscribeStateEvents(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
+		return
+	}
+	if err := logic.UnsubscribeStateEvents(params["name"]); err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
 
-	instances, err := inst.BulkReadInstance()
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("State events subscription %s removed", params["name"]), Details: params["name"]})
+}
+
+// StateEventSubscriptions lists the state event subscriptions
+func (this *HttpAPI) StateEventSubscriptions(params martini.Params, r render.Render, req *http.Request) {
+	subscriptions, err := inst.ReadStateEventSubscriptions()
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
 
-	r.JSON(http.StatusOK, instances)
+	r.JSON(http.StatusOK, subscriptions)
 }
 
-// DiscoveryMetricsRaw will return the last X seconds worth of discovery information in time based order as a JSON array
-func (this *HttpAPI) DiscoveryMetricsRaw(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	seconds, err := strconv.Atoi(params["seconds"])
-	if err != nil || seconds <= 0 {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Invalid value provided for seconds"})
+// ScheduledReverts lists the pending scheduled reverts, as well as those completed within the past day
+func (this *HttpAPI) ScheduledReverts(params martini.Params, r render.Render, req *http.Request) {
+	reverts, err := logic.ReadScheduledReverts()
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
 
-	refTime := time.Now().Add(-time.Duration(seconds) * time.Second)
-	json, err := discovery.JSONSince(discoveryMetrics, refTime)
+	r.JSON(http.StatusOK, reverts)
+}
+
+// CancelScheduledRevert cancels a pending scheduled revert, leaving the action it reverts in effect
+func (this *HttpAPI) CancelScheduledRevert(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	revert, err := logic.CancelScheduledRevert(params["uid"], getClusterLockActor(req, user))
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unable to determine start time. Perhaps seconds value is wrong?"})
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-	log.Debugf("DiscoveryMetricsRaw data: retrieved %d entries from discovery.MC", len(json))
 
-	r.JSON(http.StatusOK, json)
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Canceled scheduled revert %s", revert.UID), Details: revert})
 }
 
-// DiscoveryMetricsAggregated will return a single set of aggregated metrics for raw values collected since the
-// specified time.
-func (this *HttpAPI) DiscoveryMetricsAggregated(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	seconds, err := strconv.Atoi(params["seconds"])
-
-	refTime := time.Now().Add(-time.Duration(seconds) * time.Second)
-	aggregated, err := discovery.AggregatedSince(discoveryMetrics, refTime)
-	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unable to generate aggregated discovery metrics"})
+// DecommissionInstance takes an instance out of service, to be forgotten after DecommissionForgetAfterMinutes
+func (this *HttpAPI) DecommissionInstance(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
 		return
 	}
-	// log.Debugf("DiscoveryMetricsAggregated data: %+v", aggregated)
-	r.JSON(http.StatusOK, aggregated)
-}
-
-// DiscoveryQueueMetricsRaw returns the raw queue metrics (active and
-// queued values), data taken secondly for the last N seconds.
-func (this *HttpAPI) DiscoveryQueueMetricsRaw(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	seconds, err := strconv.Atoi(params["seconds"])
-	log.Debugf("DiscoveryQueueMetricsRaw: seconds: %d", seconds)
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unable to generate discovery queue  aggregated metrics"})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
-
-	queue := discovery.CreateOrReturnQueue("DEFAULT")
-	metrics := queue.DiscoveryQueueMetrics(seconds)
-	log.Debugf("DiscoveryQueueMetricsRaw data: %+v", metrics)
-
-	r.JSON(http.StatusOK, metrics)
-}
-
-// DiscoveryQueueMetricsAggregated returns a single value showing the metrics of the discovery queue over the last N seconds.
-// This is expected to be called every 60 seconds (?) and the config setting of the retention period is currently hard-coded.
-// See go/discovery/ for more information.
-func (this *HttpAPI) DiscoveryQueueMetricsAggregated(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	seconds, err := strconv.Atoi(params["seconds"])
-	log.Debugf("DiscoveryQueueMetricsAggregated: seconds: %d", seconds)
+	decommission, err := logic.DecommissionInstance(&instanceKey, getClusterLockActor(req, user), req.URL.Query().Get("reason"), req.URL.Query().Get("force") == "true")
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unable to generate discovery queue aggregated metrics"})
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
 
-	queue := discovery.CreateOrReturnQueue("DEFAULT")
-	aggregated := queue.AggregatedDiscoveryQueueMetrics(seconds)
-	log.Debugf("DiscoveryQueueMetricsAggregated data: %+v", aggregated)
-
-	r.JSON(http.StatusOK, aggregated)
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Decommissioned %+v; to be forgotten at %s", instanceKey, decommission.ForgetAtString), Details: decommission})
 }
 
-// BackendQueryMetricsRaw returns the raw backend query metrics
-func (this *HttpAPI) BackendQueryMetricsRaw(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	seconds, err := strconv.Atoi(params["seconds"])
-	log.Debugf("BackendQueryMetricsRaw: seconds: %d", seconds)
+// CancelDecommission cancels a pending decommission, such that the instance is not forgotten
+func (this *HttpAPI) CancelDecommission(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unable to generate raw backend query metrics"})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
-
-	refTime := time.Now().Add(-time.Duration(seconds) * time.Second)
-	m, err := queryMetrics.Since(refTime)
+	decommission, err := logic.CancelDecommission(&instanceKey, getClusterLockActor(req, user))
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unable to return backend query metrics"})
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
 
-	log.Debugf("BackendQueryMetricsRaw data: %+v", m)
-
-	r.JSON(http.StatusOK, m)
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Canceled decommission of %+v", instanceKey), Details: decommission})
 }
 
-func (this *HttpAPI) BackendQueryMetricsAggregated(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	seconds, err := strconv.Atoi(params["seconds"])
-	log.Debugf("BackendQueryMetricsAggregated: seconds: %d", seconds)
+// Decommissions lists the pending decommissions, as well as those completed within the past day
+func (this *HttpAPI) Decommissions(params martini.Params, r render.Render, req *http.Request) {
+	decommissions, err := logic.ReadInstanceDecommissions()
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unable to aggregated generate backend query metrics"})
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
 
-	refTime := time.Now().Add(-time.Duration(seconds) * time.Second)
-	aggregated := query.AggregatedSince(queryMetrics, refTime)
-	log.Debugf("BackendQueryMetricsAggregated data: %+v", aggregated)
-
-	r.JSON(http.StatusOK, aggregated)
+	r.JSON(http.StatusOK, decommissions)
 }
 
-// Agents provides complete list of registered agents (See https://github.com/github/orchestrator-agent)
-func (this *HttpAPI) Agents(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
-		return
-	}
-	if !config.Config.ServeAgentsHttp {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+// AsciiTopology returns an ascii graph of cluster's instances
+func (this *HttpAPI) asciiTopology(params martini.Params, r render.Render, req *http.Request, tabulated bool) {
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
 
-	agents, err := agent.ReadAgents()
-
+	asciiOutput, err := inst.ASCIITopology(clusterName, "", tabulated)
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
 
-	r.JSON(http.StatusOK, agents)
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Topology for cluster %s", clusterName), Details: asciiOutput})
 }
 
-// Agent returns complete information of a given agent
-func (this *HttpAPI) Agent(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+// AsciiTopology returns an ascii graph of cluster's instances
+func (this *HttpAPI) AsciiTopology(params martini.Params, r render.Render, req *http.Request) {
+	this.asciiTopology(params, r, req, false)
+}
+
+// AsciiTopology returns an ascii graph of cluster's instances
+func (this *HttpAPI) AsciiTopologyTabulated(params martini.Params, r render.Render, req *http.Request) {
+	this.asciiTopology(params, r, req, true)
+}
+
+// CircularReplication lists the co-master pairs and replication rings in a given cluster, along with their active members
+func (this *HttpAPI) CircularReplication(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-	if !config.Config.ServeAgentsHttp {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+	circularReplications, err := inst.ReadClusterCircularReplications(clusterName)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
+	r.JSON(http.StatusOK, circularReplications)
+}
 
-	agent, err := agent.GetAgent(params["host"])
-
+// DetectionThresholds shows the effective failure detection thresholds of a given cluster, or of all clusters,
+// as implied by their detection profiles
+func (this *HttpAPI) DetectionThresholds(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	clusterName := ""
+	if clusterHint := getClusterHint(params); clusterHint != "" {
+		var err error
+		if clusterName, err = figureClusterName(clusterHint); err != nil {
+			Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
+			return
+		}
+	}
+	clustersInfo, err := inst.ReadClustersInfo(clusterName)
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-
-	r.JSON(http.StatusOK, agent)
+	thresholds := [](*inst.DetectionThresholds){}
+	for _, clusterInfo := range clustersInfo {
+		thresholds = append(thresholds, inst.NewDetectionThresholds(clusterInfo.ClusterName, clusterInfo.ClusterAlias))
+	}
+	r.JSON(http.StatusOK, thresholds)
 }
 
-// AgentUnmount instructs an agent to unmount the designated mount point
-func (this *HttpAPI) AgentUnmount(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+// PromotionCandidate returns the pre-elected promotion candidate of a cluster
+func (this *HttpAPI) PromotionCandidate(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-	if !config.Config.ServeAgentsHttp {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+	if !isAuthorizedForCluster(req, user, clusterName) {
+		respondUnauthorized(r)
 		return
 	}
-
-	output, err := agent.Unmount(params["host"])
-
-	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+	if !config.Config.PreElectPromotionCandidates {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Promotion candidates are not pre-elected (PreElectPromotionCandidates)"})
 		return
 	}
-
-	r.JSON(http.StatusOK, output)
-}
-
-// AgentMountLV instructs an agent to mount a given volume on the designated mount point
-func (this *HttpAPI) AgentMountLV(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+	promotionCandidate, found := logic.ReadPromotionCandidate(clusterName)
+	if !found {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("No promotion candidate pre-elected for cluster %s", clusterName)})
 		return
 	}
-	if !config.Config.ServeAgentsHttp {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+	r.JSON(http.StatusOK, promotionCandidate)
+}
+
+// PromotionStrategy returns the promotion strategy applying to a cluster's master recovery
+func (this *HttpAPI) PromotionStrategy(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
+	clusterAlias, _ := inst.ReadAliasByClusterName(clusterName)
+	promotionStrategy := logic.GetClusterPromotionStrategy(clusterName, clusterAlias)
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Cluster %s uses promotion strategy %s", clusterName, promotionStrategy.Name()), Details: promotionStrategy.Name()})
+}
 
-	output, err := agent.MountLV(params["host"], req.URL.Query().Get("lv"))
+// PromotionStrategies lists the registered promotion strategies
+func (this *HttpAPI) PromotionStrategies(params martini.Params, r render.Render, req *http.Request) {
+	r.JSON(http.StatusOK, logic.RegisteredPromotionStrategies())
+}
 
+// PromotionCandidates returns the pre-elected promotion candidates of all clusters
+func (this *HttpAPI) PromotionCandidates(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	authorizedClusters, err := authorizedClusterNames(req, user)
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-
-	r.JSON(http.StatusOK, output)
+	promotionCandidates := []logic.PromotionCandidate{}
+	for _, promotionCandidate := range logic.ReadPromotionCandidates() {
+		if authorizedClusters == nil || authorizedClusters[promotionCandidate.ClusterName] {
+			promotionCandidates = append(promotionCandidates, promotionCandidate)
+		}
+	}
+	r.JSON(http.StatusOK, promotionCandidates)
 }
 
-// AgentCreateSnapshot instructs an agent to create a new snapshot. Agent's DIY implementation.
-func (this *HttpAPI) AgentCreateSnapshot(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+// LagSLO returns the compliance of a cluster with its replication lag SLO
+func (this *HttpAPI) LagSLO(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-	if !config.Config.ServeAgentsHttp {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+	if !isAuthorizedForCluster(req, user, clusterName) {
+		respondUnauthorized(r)
 		return
 	}
-
-	output, err := agent.CreateSnapshot(params["host"])
-
+	status, err := inst.ReadClusterLagSLOStatus(clusterName)
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-
-	r.JSON(http.StatusOK, output)
+	r.JSON(http.StatusOK, status)
 }
 
-// AgentRemoveLV instructs an agent to remove a logical volume
-func (this *HttpAPI) AgentRemoveLV(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+// LagSLOs returns the compliance of all clusters which have a replication lag SLO
+func (this *HttpAPI) LagSLOs(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	statuses, err := inst.ReadLagSLOStatuses()
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-	if !config.Config.ServeAgentsHttp {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+	authorizedClusters, err := authorizedClusterNames(req, user)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
+	authorizedStatuses := []inst.LagSLOStatus{}
+	for _, status := range statuses {
+		if authorizedClusters == nil || authorizedClusters[status.ClusterName] {
+			authorizedStatuses = append(authorizedStatuses, status)
+		}
+	}
+	r.JSON(http.StatusOK, authorizedStatuses)
+}
 
-	output, err := agent.RemoveLV(params["host"], req.URL.Query().Get("lv"))
-
+// AnalysisHistory returns the archived analysis cycles of a cluster within a time range, given as from/to
+// query params (default: the last 10 minutes). The cluster hint may be a cluster name or alias which no
+// longer exists, such as the name of a cluster before a failover.
+func (this *HttpAPI) AnalysisHistory(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	clusterHint := getClusterHint(params)
+	clusterName, clusterAlias := clusterHint, clusterHint
+	if name, err := figureClusterName(clusterHint); err == nil {
+		clusterName = name
+		if alias, err := inst.ReadAliasByClusterName(clusterName); err == nil {
+			clusterAlias = alias
+		}
+	}
+	if !isAuthorizedForCluster(req, user, clusterName) {
+		respondUnauthorized(r)
+		return
+	}
+	to := time.Now()
+	if value := req.URL.Query().Get("to"); value != "" {
+		t, err := inst.ParseCheckpointTime(value)
+		if err != nil {
+			Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+			return
+		}
+		to = t
+	}
+	from := to.Add(-10 * time.Minute)
+	if value := req.URL.Query().Get("from"); value != "" {
+		t, err := inst.ParseCheckpointTime(value)
+		if err != nil {
+			Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+			return
+		}
+		from = t
+	}
+	cycles, err := inst.ReadAnalysisHistory(clusterName, clusterAlias, from, to)
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-
-	r.JSON(http.StatusOK, output)
+	r.JSON(http.StatusOK, cycles)
 }
 
-// AgentMySQLStop stops MySQL service on agent
-func (this *HttpAPI) AgentMySQLStop(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+// Cluster provides list of instances in given cluster
+func (this *HttpAPI) Cluster(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-	if !config.Config.ServeAgentsHttp {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+	if !isAuthorizedForCluster(req, user, clusterName) {
+		respondUnauthorized(r)
 		return
 	}
 
-	output, err := agent.MySQLStop(params["host"])
+	instances, err := inst.ReadCachedClusterInstances(clusterName)
 
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
+	if dimension := req.URL.Query().Get("dimension"); dimension != "" {
+		instances = inst.FilterInstancesByDimension(instances, dimension, req.URL.Query().Get("value"))
+	}
 
-	r.JSON(http.StatusOK, output)
+	r.JSON(http.StatusOK, instances)
 }
 
-// AgentMySQLStart starts MySQL service on agent
-func (this *HttpAPI) AgentMySQLStart(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
-		return
-	}
-	if !config.Config.ServeAgentsHttp {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+// ClusterByAlias provides list of instances in given cluster
+func (this *HttpAPI) ClusterByAlias(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	clusterName, err := inst.GetClusterByAlias(params["clusterAlias"])
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
 
-	output, err := agent.MySQLStart(params["host"])
+	params["clusterName"] = clusterName
+	this.Cluster(params, r, req, user)
+}
 
+// ClusterByInstance provides list of instances in cluster an instance belongs to
+func (this *HttpAPI) ClusterByInstance(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
+		return
+	}
+	instance, found, err := inst.ReadInstance(&instanceKey)
+	if (!found) || (err != nil) {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInstanceNotFound, Message: fmt.Sprintf("Cannot read instance: %+v", instanceKey)})
 		return
 	}
 
-	r.JSON(http.StatusOK, output)
+	params["clusterName"] = instance.ClusterName
+	this.Cluster(params, r, req, user)
 }
 
-func (this *HttpAPI) AgentCustomCommand(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+// ClusterInfo provides details of a given cluster
+func (this *HttpAPI) ClusterInfo(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-	if !config.Config.ServeAgentsHttp {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+	if !isAuthorizedForCluster(req, user, clusterName) {
+		respondUnauthorized(r)
 		return
 	}
-
-	output, err := agent.CustomCommand(params["host"], params["command"])
+	clusterInfo, err := inst.ReadClusterInfo(clusterName)
 
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
 
-	r.JSON(http.StatusOK, output)
+	r.JSON(http.StatusOK, clusterInfo)
 }
 
-// AgentSeed completely seeds a host with another host's snapshots. This is a complex operation
-// governed by orchestrator and executed by the two agents involved.
-func (this *HttpAPI) AgentSeed(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+// GroupingDimensions groups the instances of a given cluster by each of the configured grouping dimensions
+func (this *HttpAPI) GroupingDimensions(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-	if !config.Config.ServeAgentsHttp {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+	if !isAuthorizedForCluster(req, user, clusterName) {
+		respondUnauthorized(r)
 		return
 	}
-
-	output, err := agent.Seed(params["targetHost"], params["sourceHost"])
-
+	instances, err := inst.ReadClusterInstances(clusterName)
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
 
-	r.JSON(http.StatusOK, output)
+	r.JSON(http.StatusOK, inst.GroupInstancesByDimensions(instances))
 }
 
-// AgentActiveSeeds lists active seeds and their state
-func (this *HttpAPI) AgentActiveSeeds(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+// CompareClusters compares a cluster with a new topology replicating from it, given by the new topology's master,
+// reporting executed GTID deltas, instance counts, version mix, and the health of replication between them
+func (this *HttpAPI) CompareClusters(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-	if !config.Config.ServeAgentsHttp {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-
-	output, err := agent.ReadActiveSeedsForHost(params["host"])
-
+	instanceClusterName, err := figureClusterName(instanceKey.StringCode())
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-
-	r.JSON(http.StatusOK, output)
-}
-
-// AgentRecentSeeds lists recent seeds of a given agent
-func (this *HttpAPI) AgentRecentSeeds(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+	if !isAuthorizedForCluster(req, user, clusterName) || !isAuthorizedForCluster(req, user, instanceClusterName) {
+		respondUnauthorized(r)
 		return
 	}
-	if !config.Config.ServeAgentsHttp {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+	comparison, err := inst.CompareClusters(clusterName, &instanceKey)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
+	r.JSON(http.StatusOK, comparison)
+}
 
-	output, err := agent.ReadRecentCompletedSeedsForHost(params["host"])
-
+// Cluster provides list of instances in given cluster
+func (this *HttpAPI) ClusterInfoByAlias(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	clusterName, err := inst.GetClusterByAlias(params["clusterAlias"])
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
 
-	r.JSON(http.StatusOK, output)
+	params["clusterName"] = clusterName
+	this.ClusterInfo(params, r, req, user)
 }
 
-// AgentSeedDetails provides details of a given seed
-func (this *HttpAPI) AgentSeedDetails(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
-		return
-	}
-	if !config.Config.ServeAgentsHttp {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+// ClusterOSCReplicas returns heuristic list of OSC replicas
+func (this *HttpAPI) ClusterOSCReplicas(params martini.Params, r render.Render, req *http.Request) {
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
 
-	seedId, err := strconv.ParseInt(params["seedId"], 10, 0)
-	output, err := agent.AgentSeedDetails(seedId)
-
+	instances, err := inst.GetClusterOSCReplicas(clusterName)
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
 
-	r.JSON(http.StatusOK, output)
+	r.JSON(http.StatusOK, instances)
 }
 
-// AgentSeedStates returns the breakdown of states (steps) of a given seed
-func (this *HttpAPI) AgentSeedStates(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+// SetClusterAlias will change an alias for a given clustername
+func (this *HttpAPI) SetClusterAliasManualOverride(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
-		return
-	}
-	if !config.Config.ServeAgentsHttp {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+		respondUnauthorized(r)
 		return
 	}
+	clusterName := params["clusterName"]
+	alias := req.URL.Query().Get("alias")
 
-	seedId, err := strconv.ParseInt(params["seedId"], 10, 0)
-	output, err := agent.ReadSeedStates(seedId)
-
+	err := inst.SetClusterAliasManualOverride(clusterName, alias)
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-
-	r.JSON(http.StatusOK, output)
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Cluster %s now has alias '%s'", clusterName, alias)})
 }
 
-// Seeds retruns all recent seeds
-func (this *HttpAPI) Seeds(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
-		return
-	}
-	if !config.Config.ServeAgentsHttp {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+// TopologyConformance evaluates a cluster against its desired topology, reporting drift
+func (this *HttpAPI) TopologyConformance(params martini.Params, r render.Render, req *http.Request) {
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-
-	output, err := agent.ReadRecentSeeds()
-
+	conformance, err := logic.EvaluateTopologyConformance(clusterName)
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-
-	r.JSON(http.StatusOK, output)
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Cluster %s conforms to desired topology: %+v", clusterName, conformance.Conforms), Details: conformance})
 }
 
-// AbortSeed instructs agents to abort an active seed
-func (this *HttpAPI) AbortSeed(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+// SetDesiredTopology declares a cluster's desired topology, overriding configuration
+func (this *HttpAPI) SetDesiredTopology(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
-	if !config.Config.ServeAgentsHttp {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-
-	seedId, err := strconv.ParseInt(params["seedId"], 10, 0)
-	err = agent.AbortSeed(seedId)
-
+	desiredTopology, err := logic.ParseDesiredTopology(params["desiredTopology"])
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-
-	r.JSON(http.StatusOK, err == nil)
-}
-
-// Headers is a self-test call which returns HTTP headers
-func (this *HttpAPI) Headers(params martini.Params, r render.Render, req *http.Request) {
-	r.JSON(http.StatusOK, req.Header)
-}
-
-// Health performs a self test
-func (this *HttpAPI) Health(params martini.Params, r render.Render, req *http.Request) {
-	health, err := process.HealthTest()
+	clusterAlias, err := inst.ReadAliasByClusterName(clusterName)
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Application node is unhealthy %+v", err), Details: health})
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-
-	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Application node is healthy"), Details: health})
-
-}
-
-// LBCheck returns a constant respnse, and this can be used by load balancers that expect a given string.
-func (this *HttpAPI) LBCheck(params martini.Params, r render.Render, req *http.Request) {
-	r.JSON(http.StatusOK, "OK")
+	if err := logic.SetClusterDesiredTopology(clusterAlias, desiredTopology); err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Cluster %s desired topology: %s", clusterAlias, desiredTopology)})
 }
 
-// LBCheck returns a constant respnse, and this can be used by load balancers that expect a given string.
-func (this *HttpAPI) LeaderCheck(params martini.Params, r render.Render, req *http.Request) {
-	respondStatus, err := strconv.Atoi(params["errorStatusCode"])
-	if err != nil || respondStatus < 0 {
-		respondStatus = http.StatusNotFound
+// ClearDesiredTopology removes an API-declared desired topology of a cluster, reverting to configuration
+func (this *HttpAPI) ClearDesiredTopology(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
 	}
-
-	if logic.IsLeader() {
-		r.JSON(http.StatusOK, "OK")
-	} else {
-		r.JSON(respondStatus, "Not leader")
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
+		return
 	}
-}
-
-// A configurable endpoint that can be for regular status checks or whatever.  While similar to
-// Health() this returns 500 on failure.  This will prevent issues for those that have come to
-// expect a 200
-// It might be a good idea to deprecate the current Health() behavior and roll this in at some
-// point
-func (this *HttpAPI) StatusCheck(params martini.Params, r render.Render, req *http.Request) {
-	health, err := process.HealthTest()
+	clusterAlias, err := inst.ReadAliasByClusterName(clusterName)
 	if err != nil {
-		r.JSON(500, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Application node is unhealthy %+v", err), Details: health})
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Application node is healthy"), Details: health})
+	if err := logic.SetClusterDesiredTopology(clusterAlias, logic.NoDesiredTopology); err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Cluster %s desired topology cleared", clusterAlias)})
 }
 
-// GrabElection forcibly grabs leadership. Use with care!!
-func (this *HttpAPI) GrabElection(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+// ConvergeTopology relocates drifting replicas of a cluster onto their desired positions
+func (this *HttpAPI) ConvergeTopology(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
-	err := process.GrabElection()
+	clusterName, err := figureClusterName(getClusterHint(params))
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Unable to grab election: %+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-
-	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Node elected as leader")})
+	relocated, _, err := logic.ConvergeTopology(clusterName)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err), Details: relocated})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Relocated %d instances in cluster %s", len(relocated), clusterName), Details: relocated})
 }
 
-// Reelect causes re-elections for an active node
-func (this *HttpAPI) Reelect(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+// MasterFanOut evaluates a cluster's master fan-out, listing the relocations which would reduce it
+func (this *HttpAPI) MasterFanOut(params martini.Params, r render.Render, req *http.Request) {
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-	err := process.Reelect()
+	fanOut, err := logic.EvaluateMasterFanOut(clusterName)
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Unable to re-elect: %+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-
-	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Set re-elections")})
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Master of cluster %s has %d direct replicas; exceeds fan-out: %+v", clusterName, fanOut.CountDirectReplicas, fanOut.ExceedsFanOut), Details: fanOut})
 }
 
-// RaftYield yields to a specified host
-func (this *HttpAPI) RaftYield(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+// ReadOnlyDrift lists the members of a cluster whose read_only setting deviates from their role
+func (this *HttpAPI) ReadOnlyDrift(params martini.Params, r render.Render, req *http.Request) {
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-	if !orcraft.IsRaftEnabled() {
-		Respond(r, &APIResponse{Code: ERROR, Message: "raft-yield: not running with raft setup"})
+	drifts, err := logic.EvaluateReadOnlyDrift(clusterName)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-	orcraft.PublishYield(params["node"])
-	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Asynchronously yielded")})
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Cluster %s: %d members drift from their expected read_only setting", clusterName, len(drifts)), Details: drifts})
 }
 
-// RaftYieldHint yields to a host whose name contains given hint (e.g. DC)
-func (this *HttpAPI) RaftYieldHint(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+// EnforceReadOnly fixes the read_only drift of a cluster: replicas are made read_only. A read-only master is reported, not fixed.
+func (this *HttpAPI) EnforceReadOnly(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
-	if !orcraft.IsRaftEnabled() {
-		Respond(r, &APIResponse{Code: ERROR, Message: "raft-yield-hint: not running with raft setup"})
-		return
-	}
-	hint := params["hint"]
-	orcraft.PublishYieldHostnameHint(hint)
-	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Asynchronously yielded by hint %s", hint), Details: hint})
-}
-
-// RaftPeers returns the list of peers in a raft setup
-func (this *HttpAPI) RaftPeers(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !orcraft.IsRaftEnabled() {
-		Respond(r, &APIResponse{Code: ERROR, Message: "raft-nodes: not running with raft setup"})
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-
-	peers, err := orcraft.GetPeers()
+	drifts, err := logic.EnforceReadOnly(clusterName)
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Cannot get raft peers: %+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err), Details: drifts})
 		return
 	}
-
-	r.JSON(http.StatusOK, peers)
+	countFixed := 0
+	for _, drift := range drifts {
+		if drift.IsFixed {
+			countFixed++
+		}
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Cluster %s: fixed %d out of %d read_only drifts", clusterName, countFixed, len(drifts)), Details: drifts})
 }
 
-// RaftState returns the state of this raft node
-func (this *HttpAPI) RaftState(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !orcraft.IsRaftEnabled() {
-		Respond(r, &APIResponse{Code: ERROR, Message: "raft-state: not running with raft setup"})
+// UnreconciledReplicas lists replicas which masters list as connected, yet are unknown to orchestrator or known to
+// replicate from elsewhere; those of given cluster, or of all clusters
+func (this *HttpAPI) UnreconciledReplicas(params martini.Params, r render.Render, req *http.Request) {
+	var unreconciled []inst.UnreconciledReplica
+	var err error
+	if getClusterHint(params) == "" {
+		unreconciled, err = inst.ReadAllUnreconciledReplicas()
+	} else {
+		clusterName, clusterErr := figureClusterName(getClusterHint(params))
+		if clusterErr != nil {
+			Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", clusterErr)})
+			return
+		}
+		unreconciled, err = inst.ReadUnreconciledReplicas(clusterName)
+	}
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-
-	state := orcraft.GetState().String()
-	r.JSON(http.StatusOK, state)
+	r.JSON(http.StatusOK, unreconciled)
 }
 
-// RaftLeader returns the identify of the leader, if possible
-func (this *HttpAPI) RaftLeader(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !orcraft.IsRaftEnabled() {
-		Respond(r, &APIResponse{Code: ERROR, Message: "raft-leader: not running with raft setup"})
+// DiscoverUnreconciledReplicas re-discovers the unreconciled replicas of a cluster, along with the masters listing them
+func (this *HttpAPI) DiscoverUnreconciledReplicas(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
 		return
 	}
-
-	leader := orcraft.GetLeader()
-	r.JSON(http.StatusOK, leader)
-}
-
-// RaftHealth indicates whether this node is part of a healthy raft group
-func (this *HttpAPI) RaftHealth(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !orcraft.IsRaftEnabled() {
-		Respond(r, &APIResponse{Code: ERROR, Message: "raft-state: not running with raft setup"})
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-	if !orcraft.IsHealthy() {
-		Respond(r, &APIResponse{Code: ERROR, Message: "unhealthy"})
+	remaining, err := logic.DiscoverUnreconciledReplicas(clusterName)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-	r.JSON(http.StatusOK, "healthy")
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Cluster %s: %d replicas remain unreconciled", clusterName, len(remaining)), Details: remaining})
 }
 
-// RaftFollowerHealthReport is initiated by followers to report their identity and health to the raft leader.
-func (this *HttpAPI) RaftFollowerHealthReport(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !orcraft.IsRaftEnabled() {
-		Respond(r, &APIResponse{Code: ERROR, Message: "raft-state: not running with raft setup"})
+// GTIDMigration evaluates a cluster's readiness to take the next step of its migration onto GTID
+func (this *HttpAPI) GTIDMigration(params martini.Params, r render.Render, req *http.Request) {
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-	err := orcraft.OnHealthReport(params["authenticationToken"], params["raftBind"], params["raftAdvertise"])
+	migration, err := inst.EvaluateClusterGTIDMigration(clusterName)
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Cannot create snapshot: %+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-	r.JSON(http.StatusOK, "health reported")
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Cluster %s: next GTID migration step: %s; ready: %+v", clusterName, migration.NextStep, migration.IsReady), Details: migration})
 }
 
-// RaftSnapshot instructs raft to take a snapshot
-func (this *HttpAPI) RaftSnapshot(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !orcraft.IsRaftEnabled() {
-		Respond(r, &APIResponse{Code: ERROR, Message: "raft-leader: not running with raft setup"})
+// AdvanceGTIDMigration takes the next step of a cluster's migration onto GTID, on all members of the cluster
+func (this *HttpAPI) AdvanceGTIDMigration(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
 		return
 	}
-	err := orcraft.Snapshot()
+	clusterName, err := figureClusterName(getClusterHint(params))
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Cannot create snapshot: %+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-	r.JSON(http.StatusOK, "snapshot created")
+	migration, err := inst.AdvanceClusterGTIDMigration(clusterName)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err), Details: migration})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Cluster %s: next GTID migration step: %s", clusterName, migration.NextStep), Details: migration})
 }
 
-// ReloadConfiguration reloads confiug settings (not all of which will apply after change)
-func (this *HttpAPI) ReloadConfiguration(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+// ReduceMasterFanOut relocates direct replicas of a cluster's master below per data center intermediate masters
+func (this *HttpAPI) ReduceMasterFanOut(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
+		return
+	}
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	relocated, _, err := logic.ReduceMasterFanOut(clusterName)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err), Details: relocated})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Relocated %d instances in cluster %s", len(relocated), clusterName), Details: relocated})
+}
+
+// Clusters provides list of known clusters
+func (this *HttpAPI) Clusters(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	clusterNames, err := inst.ReadClusters()
+
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	authorizedClusters, err := authorizedClusterNames(req, user)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	if authorizedClusters != nil {
+		filteredClusterNames := []string{}
+		for _, clusterName := range clusterNames {
+			if authorizedClusters[clusterName] {
+				filteredClusterNames = append(filteredClusterNames, clusterName)
+			}
+		}
+		clusterNames = filteredClusterNames
+	}
+
+	r.JSON(http.StatusOK, clusterNames)
+}
+
+// ClustersInfo provides list of known clusters, along with some added metadata per cluster
+func (this *HttpAPI) ClustersInfo(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	clustersInfo, err := inst.ReadClustersInfo("")
+
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	clustersInfo = filterClustersInfoByNamespaces(req, user, clustersInfo)
+
+	r.JSON(http.StatusOK, clustersInfo)
+}
+
+// Write a cluster's master (or all clusters masters) to kv stores.
+// This should generally only happen once in a lifetime of a cluster. Otherwise KV
+// stores are updated via failovers.
+func (this *HttpAPI) SubmitMastersToKvStores(params martini.Params, r render.Render, req *http.Request) {
+	clusterName, err := getClusterNameIfExists(params)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	kvPairs, renderErr := inst.GetMastersKVPairs(clusterName)
+	if renderErr != nil && len(kvPairs) == 0 {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", renderErr)})
+		return
+	}
+	// Entries which did render are written even if others failed rendering
+	for _, kvPair := range kvPairs {
+		if orcraft.IsRaftEnabled() {
+			_, err = orcraft.PublishCommand("put-key-value", kvPair)
+		} else {
+			err = kv.PutKVPair(kvPair)
+		}
+		if err != nil {
+			Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+			return
+		}
+	}
+	if renderErr != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Submitted %d entries; %+v", len(kvPairs), renderErr), Details: kvPairs})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Submitted %d masters", len(kvPairs)), Details: kvPairs})
+}
+
+// ServiceRecords returns the outcome of the latest reconciliation of clusters' master entries in KV stores and DNS
+// with the actual masters. With "mismatches=true", only mismatching entries are listed.
+func (this *HttpAPI) ServiceRecords(params martini.Params, r render.Render, req *http.Request) {
+	r.JSON(http.StatusOK, logic.ReadServiceRecordChecks(req.URL.Query().Get("mismatches") == "true"))
+}
+
+// ReconcileServiceRecords reconciles clusters' master entries in KV stores and DNS with the actual masters, now
+func (this *HttpAPI) ReconcileServiceRecords(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	if !logic.IsLeader() {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Service records are reconciled by the leader"})
+		return
+	}
+	logic.ReconcileMasterServiceRecords(true)
+	checks := logic.ReadServiceRecordChecks(true)
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Reconciled service records; %d mismatches", len(checks)), Details: checks})
+}
+
+// CutoverToken returns a cluster's cutover token, as written to KV stores upon master failover
+func (this *HttpAPI) CutoverToken(params martini.Params, r render.Render, req *http.Request) {
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	clusterInfo, err := inst.ReadClusterInfo(clusterName)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	token, err := inst.ReadCutoverToken(clusterInfo.ClusterAlias)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	if token == nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("No cutover token found for cluster %+v", clusterName)})
+		return
+	}
+
+	r.JSON(http.StatusOK, token)
+}
+
+// Clusters provides list of known masters
+func (this *HttpAPI) Masters(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	instances, err := inst.ReadWriteableClustersMasters()
+
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	if instances, err = filterInstancesByNamespaces(req, user, instances); err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	r.JSON(http.StatusOK, instances)
+}
+
+// ClusterMaster returns the writable master of a given cluster
+func (this *HttpAPI) ClusterMaster(params martini.Params, r render.Render, req *http.Request) {
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	masters, err := inst.ReadClusterMaster(clusterName)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	if len(masters) == 0 {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("No masters found for %+v", clusterName)})
+		return
+	}
+
+	r.JSON(http.StatusOK, masters[0])
+}
+
+// Downtimed lists downtimed instances, potentially filtered by cluster
+func (this *HttpAPI) Downtimed(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	clusterName, err := getClusterNameIfExists(params)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	instances, err := inst.ReadDowntimedInstances(clusterName)
+	if err == nil {
+		instances, err = filterInstancesByNamespaces(req, user, instances)
+	}
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	r.JSON(http.StatusOK, instances)
+}
+
+// AllInstances lists all known instances
+func (this *HttpAPI) AllInstances(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	instances, err := inst.SearchInstances("")
+	if err == nil {
+		instances, err = filterInstancesByNamespaces(req, user, instances)
+	}
+
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	r.JSON(http.StatusOK, instances)
+}
+
+// Search provides list of instances matching given search param via various criteria.
+func (this *HttpAPI) Search(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	searchString := params["searchString"]
+	if searchString == "" {
+		searchString = req.URL.Query().Get("s")
+	}
+	instances, err := inst.SearchInstances(searchString)
+	if err == nil {
+		instances, err = filterInstancesByNamespaces(req, user, instances)
+	}
+
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	r.JSON(http.StatusOK, instances)
+}
+
+// Problems provides list of instances with known problems
+func (this *HttpAPI) Problems(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	instances, err := readProblems(req, user, params["clusterName"])
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	r.JSON(http.StatusOK, instances)
+}
+
+// readProblems reads the problem instances, optionally of a given cluster, which the user is authorized to see
+func readProblems(req *http.Request, user auth.User, clusterName string) ([](*inst.Instance), error) {
+	instances, err := inst.ReadProblemInstances(clusterName)
+	if err != nil {
+		return instances, err
+	}
+	if instances, err = logic.AddSlowDiscoveryOutlierProblems(instances, clusterName); err != nil {
+		return instances, err
+	}
+	if instances, err = logic.AddTopologyPrivilegesProblems(instances, clusterName); err != nil {
+		return instances, err
+	}
+	if instances, err = logic.AddBlockedRecoveryProblems(instances, clusterName); err != nil {
+		return instances, err
+	}
+	if instances, err = logic.AddErrorLogProblems(instances, clusterName); err != nil {
+		return instances, err
+	}
+	if instances, err = logic.AddUnreconciledReplicaProblems(instances, clusterName); err != nil {
+		return instances, err
+	}
+	return filterInstancesByNamespaces(req, user, instances)
+}
+
+// FederationClustersInfo provides the clusters of this deployment and of its federation peers
+func (this *HttpAPI) FederationClustersInfo(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	clustersInfo, err := inst.ReadClustersInfo("")
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	clustersInfo = filterClustersInfoByNamespaces(req, user, clustersInfo)
+	view, err := logic.ReadFederatedView("clusters-info", clustersInfo)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	filterFederatedViewByNamespaces(req, user, view)
+
+	r.JSON(http.StatusOK, view)
+}
+
+// FederationProblems provides the problem instances of this deployment and of its federation peers
+func (this *HttpAPI) FederationProblems(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	instances, err := readProblems(req, user, "")
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	view, err := logic.ReadFederatedView("problems", instances)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	filterFederatedViewByNamespaces(req, user, view)
+
+	r.JSON(http.StatusOK, view)
+}
+
+// FederationCluster provides list of instances in given cluster, whichever federated deployment owns it
+func (this *HttpAPI) FederationCluster(params martini.Params, r render.Render, req *http.Request, user auth.User, w http.ResponseWriter) {
+	clusterHint := getClusterHint(params)
+	if _, err := figureClusterName(clusterHint); err == nil {
+		this.Cluster(params, r, req, user)
+		return
+	}
+	clustersView, err := logic.ReadFederatedView("clusters-info", []inst.ClusterInfo{})
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	deployment, found := logic.FindFederatedClusterDeployment(clustersView, clusterHint)
+	if !found {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("Cluster not found in any federated deployment: %s", clusterHint)})
+		return
+	}
+	route, err := logic.ParseFederationProxyPath(fmt.Sprintf("cluster/%s", clusterHint))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	this.proxyFederationRequest(r, req, user, w, deployment, route)
+}
+
+// FederationProxy proxies a read-only API call to a federation peer
+func (this *HttpAPI) FederationProxy(params martini.Params, r render.Render, req *http.Request, user auth.User, w http.ResponseWriter) {
+	apiPath := params["_1"]
+	if req.URL.RawQuery != "" {
+		apiPath = fmt.Sprintf("%s?%s", apiPath, req.URL.RawQuery)
+	}
+	route, err := logic.ParseFederationProxyPath(apiPath)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	this.proxyFederationRequest(r, req, user, w, params["deployment"], route)
+}
+
+// isAuthorizedForFederationRoute checks whether a proxied API call is within the authenticated user's namespaces,
+// and within the clusters of the request's API token, if any. A restricted user may only proxy calls which are
+// scoped to a cluster, as the peer does not filter its responses by this deployment's namespaces.
+func isAuthorizedForFederationRoute(req *http.Request, user auth.User, deployment string, route *logic.FederationProxyRoute) bool {
+	if !isRestrictedToClusters(req, user) {
+		return true
+	}
+	clusterInfo, err := logic.ReadFederationRouteCluster(deployment, route)
+	if err != nil || clusterInfo == nil {
+		return false
+	}
+	return len(filterClustersInfoByNamespaces(req, user, []inst.ClusterInfo{*clusterInfo})) > 0
+}
+
+func (this *HttpAPI) proxyFederationRequest(r render.Render, req *http.Request, user auth.User, w http.ResponseWriter, deployment string, route *logic.FederationProxyRoute) {
+	if !isAuthorizedForFederationRoute(req, user, deployment, route) {
+		respondUnauthorized(r)
+		return
+	}
+	statusCode, contentType, body, err := logic.ProxyFederationRequest(deployment, route)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.WriteHeader(statusCode)
+	if _, err := w.Write(body); err != nil {
+		log.Errore(err)
+	}
+}
+
+// Audit provides list of audit entries by given page number
+func (this *HttpAPI) Audit(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	page, err := strconv.Atoi(params["page"])
+	if err != nil || page < 0 {
+		page = 0
+	}
+	var auditedInstanceKey *inst.InstanceKey
+	if instanceKey, err := this.getInstanceKey(params["host"], params["port"]); err == nil {
+		auditedInstanceKey = &instanceKey
+	}
+
+	audits, err := inst.ReadRecentAudit(auditedInstanceKey, page)
+
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	isAuthorizedInstance, err := instanceKeyAuthorizer(req, user)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	authorizedAudits := []inst.Audit{}
+	for _, audit := range audits {
+		if isAuthorizedInstance(&audit.AuditInstanceKey) {
+			authorizedAudits = append(authorizedAudits, audit)
+		}
+	}
+
+	r.JSON(http.StatusOK, authorizedAudits)
+}
+
+// LongQueries lists queries running for a long time, on all instances, optionally filtered by
+// arbitrary text
+func (this *HttpAPI) LongQueries(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	longQueries, err := inst.ReadLongRunningProcesses(params["filter"])
+
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	isAuthorizedInstance, err := instanceKeyAuthorizer(req, user)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	authorizedLongQueries := []inst.Process{}
+	for _, longQuery := range longQueries {
+		if isAuthorizedInstance(&inst.InstanceKey{Hostname: longQuery.InstanceHostname, Port: longQuery.InstancePort}) {
+			authorizedLongQueries = append(authorizedLongQueries, longQuery)
+		}
+	}
+
+	r.JSON(http.StatusOK, authorizedLongQueries)
+}
+
+// HostnameResolveCache shows content of in-memory hostname cache
+func (this *HttpAPI) HostnameResolveCache(params martini.Params, r render.Render, req *http.Request) {
+	content, err := inst.HostnameResolveCache()
+
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	Respond(r, &APIResponse{Code: OK, Message: "Cache retrieved", Details: content})
+}
+
+// ResetHostnameResolveCache clears in-memory hostname resovle cache
+func (this *HttpAPI) ResetHostnameResolveCache(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	err := inst.ResetHostnameResolveCache()
+
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	Respond(r, &APIResponse{Code: OK, Message: "Hostname cache cleared"})
+}
+
+// HostnameResolveCacheStats shows the size of this node's hostname resolve cache, its hit rate and resolution failures
+func (this *HttpAPI) HostnameResolveCacheStats(params martini.Params, r render.Render, req *http.Request) {
+	Respond(r, &APIResponse{Code: OK, Message: "Cache stats retrieved", Details: inst.ReadHostnameResolveCacheStats()})
+}
+
+// InvalidateHostnameResolveCache removes cached resolves where either hostname or resolved hostname match a regular expression
+func (this *HttpAPI) InvalidateHostnameResolveCache(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	invalidated, err := logic.InvalidateHostnameResolves(params["pattern"])
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Invalidated %d hostname resolves", len(invalidated)), Details: invalidated})
+}
+
+// HostnameResolveSeeds lists seeded hostname resolves
+func (this *HttpAPI) HostnameResolveSeeds(params martini.Params, r render.Render, req *http.Request) {
+	seeds, err := inst.ReadHostnameResolveSeeds()
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	r.JSON(http.StatusOK, seeds)
+}
+
+// SeedHostnameResolve sets the resolve of a hostname, taking precedence over resolving it
+func (this *HttpAPI) SeedHostnameResolve(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	seed := &inst.HostnameResolveSeed{Hostname: params["hostname"], ResolvedHostname: params["resolvedHostname"]}
+	if err := logic.SeedHostnameResolve(seed); err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Seeded resolve of %s as %s", seed.Hostname, seed.ResolvedHostname), Details: seed})
+}
+
+// UnseedHostnameResolve removes the seeded resolve of a hostname
+func (this *HttpAPI) UnseedHostnameResolve(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	if err := logic.UnseedHostnameResolve(params["hostname"]); err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Removed seeded resolve of %s", params["hostname"])})
+}
+
+// DeregisterHostnameUnresolve deregisters the unresolve name used previously
+func (this *HttpAPI) DeregisterHostnameUnresolve(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+
+	var instanceKey *inst.InstanceKey
+	if instKey, err := this.getInstanceKey(params["host"], params["port"]); err == nil {
+		instanceKey = &instKey
+	}
+
+	var err error
+	registration := inst.NewHostnameDeregistration(instanceKey)
+	if orcraft.IsRaftEnabled() {
+		_, err = orcraft.PublishCommand("register-hostname-unresolve", registration)
+	} else {
+		err = inst.RegisterHostnameUnresolve(registration)
+	}
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: "Hostname deregister unresolve completed", Details: instanceKey})
+}
+
+// RegisterHostnameUnresolve registers the unresolve name to use
+func (this *HttpAPI) RegisterHostnameUnresolve(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+
+	var instanceKey *inst.InstanceKey
+	if instKey, err := this.getInstanceKey(params["host"], params["port"]); err == nil {
+		instanceKey = &instKey
+	}
+
+	hostname := params["virtualname"]
+	var err error
+	registration := inst.NewHostnameRegistration(instanceKey, hostname)
+	if orcraft.IsRaftEnabled() {
+		_, err = orcraft.PublishCommand("register-hostname-unresolve", registration)
+	} else {
+		err = inst.RegisterHostnameUnresolve(registration)
+	}
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: "Hostname register unresolve completed", Details: instanceKey})
+}
+
+// SubmitPoolInstances (re-)applies the list of hostnames for a given pool
+func (this *HttpAPI) SubmitPoolInstances(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	pool := params["pool"]
+	instances := req.URL.Query().Get("instances")
+
+	var err error
+	submission := inst.NewPoolInstancesSubmission(pool, instances)
+	if orcraft.IsRaftEnabled() {
+		_, err = orcraft.PublishCommand("submit-pool-instances", submission)
+	} else {
+		err = inst.ApplyPoolInstances(submission)
+	}
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Applied %s pool instances", pool), Details: pool})
+}
+
+// SubmitPoolHostnames (re-)applies the list of hostnames for a given pool
+func (this *HttpAPI) ReadClusterPoolInstancesMap(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	clusterName := params["clusterName"]
+	pool := params["pool"]
+
+	poolInstancesMap, err := inst.ReadClusterPoolInstancesMap(clusterName, pool)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Read pool instances for cluster %s", clusterName), Details: poolInstancesMap})
+}
+
+// GetHeuristicClusterPoolInstances returns instances belonging to a cluster's pool
+func (this *HttpAPI) GetHeuristicClusterPoolInstances(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	pool := params["pool"]
+
+	instances, err := inst.GetHeuristicClusterPoolInstances(clusterName, pool)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Heuristic pool instances for cluster %s", clusterName), Details: instances})
+}
+
+// GetHeuristicClusterPoolInstances returns instances belonging to a cluster's pool
+func (this *HttpAPI) GetHeuristicClusterPoolInstancesLag(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	clusterName, err := inst.ReadClusterNameByAlias(params["clusterName"])
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	pool := params["pool"]
+
+	lag, err := inst.GetHeuristicClusterPoolInstancesLag(clusterName, pool)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Heuristic pool lag for cluster %s", clusterName), Details: lag})
+}
+
+// PoolSpecs lists managed pools, potentially for a given cluster
+func (this *HttpAPI) PoolSpecs(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	clusterName := ""
+	if getClusterHint(params) != "" {
+		var err error
+		if clusterName, err = figureClusterName(getClusterHint(params)); err != nil {
+			Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
+			return
+		}
+	}
+	specs, err := inst.ReadPoolSpecs(clusterName)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	r.JSON(http.StatusOK, specs)
+}
+
+// SetPoolSpec declares a managed pool in a cluster, with a desired size. Optional query params:
+// max-lag-seconds (members lagging beyond are evicted), auto-backfill (true/false, default true)
+func (this *HttpAPI) SetPoolSpec(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	spec := &inst.PoolSpec{ClusterName: clusterName, Pool: params["pool"], AutoBackfill: true}
+	desiredSize, err := strconv.ParseUint(params["desiredSize"], 10, 32)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Invalid desired size: %s", params["desiredSize"])})
+		return
+	}
+	spec.DesiredSize = uint(desiredSize)
+	if maxLag := req.URL.Query().Get("max-lag-seconds"); maxLag != "" {
+		maxLagSeconds, err := strconv.ParseUint(maxLag, 10, 32)
+		if err != nil {
+			Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Invalid max-lag-seconds: %s", maxLag)})
+			return
+		}
+		spec.MaxLagSeconds = uint(maxLagSeconds)
+	}
+	if autoBackfill := req.URL.Query().Get("auto-backfill"); autoBackfill != "" {
+		if spec.AutoBackfill, err = strconv.ParseBool(autoBackfill); err != nil {
+			Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Invalid auto-backfill: %s", autoBackfill)})
+			return
+		}
+	}
+	if err := logic.SetPoolSpec(spec); err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Pool %s in cluster %s set with desired size %d", spec.Pool, clusterName, spec.DesiredSize), Details: spec})
+}
+
+// ClearPoolSpec removes a managed pool declaration. Pool membership is unaffected.
+func (this *HttpAPI) ClearPoolSpec(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	if err := logic.ClearPoolSpec(clusterName, params["pool"]); err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Pool %s in cluster %s is no longer managed", params["pool"], clusterName)})
+}
+
+// ManagePool evaluates a managed pool and applies its membership right away
+func (this *HttpAPI) ManagePool(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	specs, err := inst.ReadPoolSpecs(clusterName)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	for _, spec := range specs {
+		if spec.Pool != params["pool"] {
+			continue
+		}
+		change, err := logic.ManagePool(&spec)
+		if err != nil {
+			Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+			return
+		}
+		Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Pool %s in cluster %s has %d members; added %d, removed %d", spec.Pool, clusterName, len(change.Members), len(change.Added), len(change.Removed)), Details: change})
+		return
+	}
+	Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Pool %s is not managed in cluster %s", params["pool"], clusterName)})
+}
+
+// ReloadClusterAlias clears in-memory hostname resovle cache
+func (this *HttpAPI) ReloadClusterAlias(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+
+	Respond(r, &APIResponse{Code: ERROR, Message: "This API call has been retired"})
+}
+
+// BulkPromotionRules returns a list of the known promotion rules for each instance
+func (this *HttpAPI) BulkPromotionRules(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+
+	promotionRules, err := inst.BulkReadCandidateDatabaseInstance()
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	r.JSON(http.StatusOK, promotionRules)
+}
+
+// BulkInstances returns a list of all known instances
+func (this *HttpAPI) BulkInstances(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+
+	instances, err := inst.BulkReadInstance()
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	r.JSON(http.StatusOK, instances)
+}
+
+// DiscoveryMetricsRaw will return the last X seconds worth of discovery information in time based order as a JSON array
+func (this *HttpAPI) DiscoveryMetricsRaw(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	seconds, err := strconv.Atoi(params["seconds"])
+	if err != nil || seconds <= 0 {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Invalid value provided for seconds"})
+		return
+	}
+
+	refTime := time.Now().Add(-time.Duration(seconds) * time.Second)
+	metrics, err := logic.DiscoveryMetricsSince(refTime)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Unable to determine start time. Perhaps seconds value is wrong?"})
+		return
+	}
+	json := discovery.MetricsJSON(metrics)
+	log.Debugf("DiscoveryMetricsRaw data: retrieved %d entries from discovery.MC", len(json))
+
+	r.JSON(http.StatusOK, json)
+}
+
+// DiscoveryMetricsAggregated will return a single set of aggregated metrics for raw values collected since the
+// specified time.
+func (this *HttpAPI) DiscoveryMetricsAggregated(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	seconds, err := strconv.Atoi(params["seconds"])
+
+	refTime := time.Now().Add(-time.Duration(seconds) * time.Second)
+	metrics, err := logic.DiscoveryMetricsSince(refTime)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Unable to generate aggregated discovery metrics"})
+		return
+	}
+	aggregated := discovery.Aggregate(metrics)
+	// log.Debugf("DiscoveryMetricsAggregated data: %+v", aggregated)
+	r.JSON(http.StatusOK, aggregated)
+}
+
+// DiscoveryOutliers lists the instances whose discovery probes are consistently slow compared with the fleet
+func (this *HttpAPI) DiscoveryOutliers(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	r.JSON(http.StatusOK, logic.ReadSlowDiscoveryOutliers())
+}
+
+// DiscoveryAutoTuning returns this node's latest tuning of discovery concurrency and poll jitter
+func (this *HttpAPI) DiscoveryAutoTuning(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	r.JSON(http.StatusOK, logic.ReadDiscoveryAutoTuning())
+}
+
+// DiscoveryBackpressure returns this node's latest evaluation of discovery saturation, and the pools it sheds from discovery
+func (this *HttpAPI) DiscoveryBackpressure(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	r.JSON(http.StatusOK, logic.ReadDiscoveryBackpressure())
+}
+
+// TopologyPrivileges lists the instances on which the topology user was found, by the latest periodic check, to be missing privileges
+func (this *HttpAPI) TopologyPrivileges(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	authorizedClusters, err := authorizedClusterNames(req, user)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	deficiencies := []*inst.TopologyPrivilegesCheck{}
+	for _, check := range logic.ReadTopologyPrivilegesDeficiencies() {
+		if authorizedClusters == nil || authorizedClusters[check.ClusterName] {
+			deficiencies = append(deficiencies, check)
+		}
+	}
+	r.JSON(http.StatusOK, deficiencies)
+}
+
+// CheckTopologyPrivileges checks the topology user's privileges on given instance, listing any missing privileges
+// along with the GRANT statements which grant them
+func (this *HttpAPI) CheckTopologyPrivileges(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
+		return
+	}
+	instance, found, err := inst.ReadInstance(&instanceKey)
+	if (!found) || (err != nil) {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInstanceNotFound, Message: fmt.Sprintf("Cannot read instance: %+v", instanceKey)})
+		return
+	}
+	if !isAuthorizedForCluster(req, user, instance.ClusterName) {
+		respondUnauthorized(r)
+		return
+	}
+	check, err := inst.CheckTopologyPrivileges(instance)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	r.JSON(http.StatusOK, check)
+}
+
+// DiscoveryQueueMetricsRaw returns the raw queue metrics (active and
+// queued values), data taken secondly for the last N seconds.
+func (this *HttpAPI) DiscoveryQueueMetricsRaw(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	seconds, err := strconv.Atoi(params["seconds"])
+	log.Debugf("DiscoveryQueueMetricsRaw: seconds: %d", seconds)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Unable to generate discovery queue  aggregated metrics"})
+		return
+	}
+
+	queue := discovery.CreateOrReturnQueue("DEFAULT")
+	metrics := queue.DiscoveryQueueMetrics(seconds)
+	log.Debugf("DiscoveryQueueMetricsRaw data: %+v", metrics)
+
+	r.JSON(http.StatusOK, metrics)
+}
+
+// DiscoveryQueueMetricsAggregated returns a single value showing the metrics of the discovery queue over the last N seconds.
+// This is expected to be called every 60 seconds (?) and the config setting of the retention period is currently hard-coded.
+// See go/discovery/ for more information.
+func (this *HttpAPI) DiscoveryQueueMetricsAggregated(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	seconds, err := strconv.Atoi(params["seconds"])
+	log.Debugf("DiscoveryQueueMetricsAggregated: seconds: %d", seconds)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Unable to generate discovery queue aggregated metrics"})
+		return
+	}
+
+	queue := discovery.CreateOrReturnQueue("DEFAULT")
+	aggregated := queue.AggregatedDiscoveryQueueMetrics(seconds)
+	log.Debugf("DiscoveryQueueMetricsAggregated data: %+v", aggregated)
+
+	r.JSON(http.StatusOK, aggregated)
+}
+
+// BackendQueryMetricsRaw returns the raw backend query metrics
+func (this *HttpAPI) BackendQueryMetricsRaw(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	seconds, err := strconv.Atoi(params["seconds"])
+	log.Debugf("BackendQueryMetricsRaw: seconds: %d", seconds)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Unable to generate raw backend query metrics"})
+		return
+	}
+
+	refTime := time.Now().Add(-time.Duration(seconds) * time.Second)
+	m, err := queryMetrics.Since(refTime)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Unable to return backend query metrics"})
+		return
+	}
+
+	log.Debugf("BackendQueryMetricsRaw data: %+v", m)
+
+	r.JSON(http.StatusOK, m)
+}
+
+func (this *HttpAPI) BackendQueryMetricsAggregated(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	seconds, err := strconv.Atoi(params["seconds"])
+	log.Debugf("BackendQueryMetricsAggregated: seconds: %d", seconds)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Unable to aggregated generate backend query metrics"})
+		return
+	}
+
+	refTime := time.Now().Add(-time.Duration(seconds) * time.Second)
+	aggregated := query.AggregatedSince(queryMetrics, refTime)
+	log.Debugf("BackendQueryMetricsAggregated data: %+v", aggregated)
+
+	r.JSON(http.StatusOK, aggregated)
+}
+
+// APIMetrics returns the request count, error rate and latency distribution of each API route, for requests served
+// by this node over the last N seconds (by default, over the entire retention period)
+func (this *HttpAPI) APIMetrics(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	seconds := int(config.Config.DiscoveryCollectionRetentionSeconds)
+	if params["seconds"] != "" {
+		var err error
+		if seconds, err = strconv.Atoi(params["seconds"]); err != nil || seconds <= 0 {
+			Respond(r, &APIResponse{Code: ERROR, Message: "Invalid value provided for seconds"})
+			return
+		}
+	}
+	refTime := time.Now().Add(-time.Duration(seconds) * time.Second)
+	aggregated, err := apimetrics.AggregatedSince(apiMetrics, refTime)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Unable to generate aggregated API metrics"})
+		return
+	}
+	r.JSON(http.StatusOK, aggregated)
+}
+
+// APIMetricsPrometheus returns the cumulative API metrics of this node, in the Prometheus text exposition format
+func (this *HttpAPI) APIMetricsPrometheus(resp http.ResponseWriter, req *http.Request) {
+	writeAPIMetricsPrometheus(resp)
+}
+
+// Agents provides complete list of registered agents (See https://github.com/github/orchestrator-agent)
+func (this *HttpAPI) Agents(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	if !config.Config.ServeAgentsHttp {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+		return
+	}
+
+	agents, err := agent.ReadAgents()
+
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	r.JSON(http.StatusOK, agents)
+}
+
+// Agent returns complete information of a given agent
+func (this *HttpAPI) Agent(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	if !config.Config.ServeAgentsHttp {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+		return
+	}
+
+	agent, err := agent.GetAgent(params["host"])
+
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	r.JSON(http.StatusOK, agent)
+}
+
+// AgentUnmount instructs an agent to unmount the designated mount point
+func (this *HttpAPI) AgentUnmount(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	if !config.Config.ServeAgentsHttp {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+		return
+	}
+
+	output, err := agent.Unmount(params["host"])
+
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	r.JSON(http.StatusOK, output)
+}
+
+// AgentMountLV instructs an agent to mount a given volume on the designated mount point
+func (this *HttpAPI) AgentMountLV(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	if !config.Config.ServeAgentsHttp {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+		return
+	}
+
+	output, err := agent.MountLV(params["host"], req.URL.Query().Get("lv"))
+
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	r.JSON(http.StatusOK, output)
+}
+
+// AgentCreateSnapshot instructs an agent to create a new snapshot. Agent's DIY implementation.
+func (this *HttpAPI) AgentCreateSnapshot(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	if !config.Config.ServeAgentsHttp {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+		return
+	}
+
+	output, err := agent.CreateSnapshot(params["host"])
+
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	r.JSON(http.StatusOK, output)
+}
+
+// AgentRemoveLV instructs an agent to remove a logical volume
+func (this *HttpAPI) AgentRemoveLV(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	if !config.Config.ServeAgentsHttp {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+		return
+	}
+
+	output, err := agent.RemoveLV(params["host"], req.URL.Query().Get("lv"))
+
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	r.JSON(http.StatusOK, output)
+}
+
+// AgentMySQLStop stops MySQL service on agent
+func (this *HttpAPI) AgentMySQLStop(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	if !config.Config.ServeAgentsHttp {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+		return
+	}
+
+	output, err := agent.MySQLStop(params["host"])
+
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	r.JSON(http.StatusOK, output)
+}
+
+// AgentMySQLStart starts MySQL service on agent
+func (this *HttpAPI) AgentMySQLStart(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	if !config.Config.ServeAgentsHttp {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+		return
+	}
+
+	output, err := agent.MySQLStart(params["host"])
+
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	r.JSON(http.StatusOK, output)
+}
+
+func (this *HttpAPI) AgentCustomCommand(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	if !config.Config.ServeAgentsHttp {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+		return
+	}
+
+	output, err := agent.CustomCommand(params["host"], params["command"])
+
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	r.JSON(http.StatusOK, output)
+}
+
+// ErrorLogEvents lists the latest lines of an instance's MySQL error log which matched ErrorLogPatterns, newest first
+func (this *HttpAPI) ErrorLogEvents(params martini.Params, r render.Render, req *http.Request) {
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
+		return
+	}
+	events, err := inst.ReadErrorLogEvents(&instanceKey)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	if events == nil {
+		events = []inst.ErrorLogEvent{}
+	}
+	r.JSON(http.StatusOK, events)
+}
+
+// AgentEnrollmentToken creates a one-time token by which an agent on given host enrolls and obtains its certificate
+func (this *HttpAPI) AgentEnrollmentToken(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	if !config.Config.ServeAgentsHttp {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+		return
+	}
+
+	token, err := agent.CreateAgentEnrollmentToken(params["host"], getUserId(req, user))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Enrollment token created for %s; expires in %d minutes", params["host"], config.Config.AgentEnrollmentTokenExpiryMinutes), Details: token})
+}
+
+// AgentCertificates lists unexpired certificates issued to agents, potentially of a given host
+func (this *HttpAPI) AgentCertificates(params martini.Params, r render.Render, req *http.Request) {
+	if !config.Config.ServeAgentsHttp {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+		return
+	}
+
+	certificates, err := agent.ReadAgentCertificates(params["host"])
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	r.JSON(http.StatusOK, certificates)
+}
+
+// RevokeAgentCertificate revokes a certificate issued to an agent, or all of the agent's certificates when no
+// serial number is given
+func (this *HttpAPI) RevokeAgentCertificate(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	if !config.Config.ServeAgentsHttp {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+		return
+	}
+
+	countRevoked, err := agent.RevokeAgentCertificates(params["host"], params["serialNumber"], getUserId(req, user), req.URL.Query().Get("reason"))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Revoked %d certificates of %s", countRevoked, params["host"]), Details: countRevoked})
+}
+
+// AgentSeed completely seeds a host with another host's snapshots. This is a complex operation
+// governed by orchestrator and executed by the two agents involved. When no source host is given,
+// the best donor is selected automatically.
+func (this *HttpAPI) AgentSeed(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	if !config.Config.ServeAgentsHttp {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+		return
+	}
+
+	if params["sourceHost"] == "" {
+		seedId, selection, err := agent.SeedFromSelectedDonor(params["targetHost"])
+		if err != nil {
+			Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err), Details: selection})
+			return
+		}
+		Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Seed %d: %s", seedId, selection.Rationale), Details: seedId})
+		return
+	}
+	output, err := agent.Seed(params["targetHost"], params["sourceHost"])
+
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	r.JSON(http.StatusOK, output)
+}
+
+// AgentSeedDonor selects the best donor for seeding given target host, without seeding it
+func (this *HttpAPI) AgentSeedDonor(params martini.Params, r render.Render, req *http.Request) {
+	if !config.Config.ServeAgentsHttp {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+		return
+	}
+
+	selection, err := agent.SelectSeedDonor(params["targetHost"])
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err), Details: selection})
+		return
+	}
+
+	r.JSON(http.StatusOK, selection)
+}
+
+// AgentActiveSeeds lists active seeds and their state
+func (this *HttpAPI) AgentActiveSeeds(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	if !config.Config.ServeAgentsHttp {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+		return
+	}
+
+	output, err := agent.ReadActiveSeedsForHost(params["host"])
+
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	r.JSON(http.StatusOK, output)
+}
+
+// AgentRecentSeeds lists recent seeds of a given agent
+func (this *HttpAPI) AgentRecentSeeds(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	if !config.Config.ServeAgentsHttp {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+		return
+	}
+
+	output, err := agent.ReadRecentCompletedSeedsForHost(params["host"])
+
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	r.JSON(http.StatusOK, output)
+}
+
+// AgentSeedDetails provides details of a given seed
+func (this *HttpAPI) AgentSeedDetails(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	if !config.Config.ServeAgentsHttp {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+		return
+	}
+
+	seedId, err := strconv.ParseInt(params["seedId"], 10, 0)
+	output, err := agent.AgentSeedDetails(seedId)
+
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	r.JSON(http.StatusOK, output)
+}
+
+// AgentSeedStates returns the breakdown of states (steps) of a given seed
+func (this *HttpAPI) AgentSeedStates(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	if !config.Config.ServeAgentsHttp {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+		return
+	}
+
+	seedId, err := strconv.ParseInt(params["seedId"], 10, 0)
+	output, err := agent.ReadSeedStates(seedId)
+
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	r.JSON(http.StatusOK, output)
+}
+
+// Seeds retruns all recent seeds
+func (this *HttpAPI) Seeds(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	if !config.Config.ServeAgentsHttp {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+		return
+	}
+
+	output, err := agent.ReadRecentSeeds()
+
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	r.JSON(http.StatusOK, output)
+}
+
+// AbortSeed instructs agents to abort an active seed
+func (this *HttpAPI) AbortSeed(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	if !config.Config.ServeAgentsHttp {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+		return
+	}
+
+	seedId, err := strconv.ParseInt(params["seedId"], 10, 0)
+	err = agent.AbortSeed(seedId)
+
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	r.JSON(http.StatusOK, err == nil)
+}
+
+// AgentSeedProgress returns the live progress of a seed: phase, bytes copied, throughput and ETA
+func (this *HttpAPI) AgentSeedProgress(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	if !config.Config.ServeAgentsHttp {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+		return
+	}
+	seedId, err := strconv.ParseInt(params["seedId"], 10, 0)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Invalid seed id: %s", params["seedId"])})
+		return
+	}
+	progress, found := agent.ReadSeedProgress(seedId)
+	if !found {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("No progress known for seed %d", seedId)})
+		return
+	}
+	r.JSON(http.StatusOK, progress)
+}
+
+// AgentSeedProgressStream streams the progress of a seed over a WebSocket, as a JSON message per change of progress,
+// until the seed completes
+func (this *HttpAPI) AgentSeedProgressStream(params martini.Params, r render.Render, resp http.ResponseWriter, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	if !config.Config.ServeAgentsHttp {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+		return
+	}
+	seedId, err := strconv.ParseInt(params["seedId"], 10, 0)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Invalid seed id: %s", params["seedId"])})
+		return
+	}
+	if _, found := agent.ReadSeedProgress(seedId); !found {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("No progress known for seed %d", seedId)})
+		return
+	}
+	ws, err := upgradeWebsocket(resp, req)
+	if err == errWebsocketOriginNotAllowed {
+		r.JSON(http.StatusForbidden, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v: %s", err, req.Header.Get("Origin"))})
+		return
+	}
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	defer ws.Close()
+
+	var lastUpdate time.Time
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		progress, found := agent.ReadSeedProgress(seedId)
+		if !found {
+			return
+		}
+		if progress.UpdatedAt.After(lastUpdate) {
+			message, _ := json.Marshal(progress)
+			if err := ws.WriteText(message); err != nil {
+				return
+			}
+			lastUpdate = progress.UpdatedAt
+		}
+		if !progress.IsActive() {
+			return
+		}
+		if process.IsShuttingDown() {
+			// Streams do not hold back the drain of in-flight operations
+			return
+		}
+		select {
+		case <-ws.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// AgentPauseSeed pauses the data transfer of a seed
+func (this *HttpAPI) AgentPauseSeed(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	if !config.Config.ServeAgentsHttp {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+		return
+	}
+	seedId, err := strconv.ParseInt(params["seedId"], 10, 0)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Invalid seed id: %s", params["seedId"])})
+		return
+	}
+	if err := agent.PauseSeed(seedId); err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Seed %d paused", seedId), Details: seedId})
+}
+
+// AgentResumeSeed resumes the data transfer of a paused seed
+func (this *HttpAPI) AgentResumeSeed(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	if !config.Config.ServeAgentsHttp {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+		return
+	}
+	seedId, err := strconv.ParseInt(params["seedId"], 10, 0)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Invalid seed id: %s", params["seedId"])})
+		return
+	}
+	if err := agent.ResumeSeed(seedId); err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Seed %d resumed", seedId), Details: seedId})
+}
+
+// BackupPolicies lists agent backup policies, potentially of a given cluster
+func (this *HttpAPI) BackupPolicies(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !config.Config.ServeAgentsHttp {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+		return
+	}
+	clusterName := ""
+	if getClusterHint(params) != "" {
+		var err error
+		if clusterName, err = figureClusterName(getClusterHint(params)); err != nil {
+			Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
+			return
+		}
+	}
+	policies, err := agent.ReadBackupPolicies(clusterName)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	r.JSON(http.StatusOK, policies)
+}
+
+// SetBackupPolicy sets the scheduled backups of a cluster, using given method (xtrabackup|mysqldump) and frequency.
+// Optional query params: max-lag-seconds (lagging replicas are not selected as backup source),
+// data-center (preferred data center of backup source), retention-count (number of successful backups to retain)
+func (this *HttpAPI) SetBackupPolicy(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	if !config.Config.ServeAgentsHttp {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+		return
+	}
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	policy := &agent.BackupPolicy{ClusterName: clusterName, Method: params["method"]}
+	frequencyMinutes, err := strconv.ParseUint(params["frequencyMinutes"], 10, 32)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Invalid frequency minutes: %s", params["frequencyMinutes"])})
+		return
+	}
+	policy.FrequencyMinutes = uint(frequencyMinutes)
+	if maxLag := req.URL.Query().Get("max-lag-seconds"); maxLag != "" {
+		maxLagSeconds, err := strconv.ParseUint(maxLag, 10, 32)
+		if err != nil {
+			Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Invalid max-lag-seconds: %s", maxLag)})
+			return
+		}
+		policy.MaxLagSeconds = uint(maxLagSeconds)
+	}
+	if retention := req.URL.Query().Get("retention-count"); retention != "" {
+		retentionCount, err := strconv.ParseUint(retention, 10, 32)
+		if err != nil {
+			Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Invalid retention-count: %s", retention)})
+			return
+		}
+		policy.RetentionCount = uint(retentionCount)
+	}
+	policy.PreferredDataCenter = req.URL.Query().Get("data-center")
+	if err := agent.WriteBackupPolicy(policy); err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Backup policy set for cluster %s", clusterName), Details: policy})
+}
+
+// ClearBackupPolicy removes the backup policy of a cluster. Existing backups are unaffected.
+func (this *HttpAPI) ClearBackupPolicy(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	if !config.Config.ServeAgentsHttp {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+		return
+	}
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	if err := agent.DeleteBackupPolicy(clusterName); err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Backup policy cleared for cluster %s", clusterName), Details: clusterName})
+}
+
+// BackupCluster takes an immediate backup of a cluster, as per its backup policy
+func (this *HttpAPI) BackupCluster(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	if !config.Config.ServeAgentsHttp {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+		return
+	}
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	policies, err := agent.ReadBackupPolicies(clusterName)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	if len(policies) == 0 {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("No backup policy found for cluster %s", clusterName)})
+		return
+	}
+	backupId, err := logic.BackupCluster(&policies[0])
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Backup %d of cluster %s submitted", backupId, clusterName), Details: backupId})
+}
+
+// Backups lists recent agent backups, potentially of a given cluster
+func (this *HttpAPI) Backups(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !config.Config.ServeAgentsHttp {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+		return
+	}
+	clusterName := ""
+	if getClusterHint(params) != "" {
+		var err error
+		if clusterName, err = figureClusterName(getClusterHint(params)); err != nil {
+			Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
+			return
+		}
+	}
+	backups, err := agent.ReadRecentBackups(clusterName)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	r.JSON(http.StatusOK, backups)
+}
+
+// LatestBackups lists the latest successful, unexpired backup per cluster, potentially of a given cluster
+func (this *HttpAPI) LatestBackups(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !config.Config.ServeAgentsHttp {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Agents not served"})
+		return
+	}
+	clusterName := ""
+	if getClusterHint(params) != "" {
+		var err error
+		if clusterName, err = figureClusterName(getClusterHint(params)); err != nil {
+			Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
+			return
+		}
+	}
+	backups, err := agent.ReadLatestSuccessfulBackups(clusterName)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	r.JSON(http.StatusOK, backups)
+}
+
+// Headers is a self-test call which returns HTTP headers
+func (this *HttpAPI) Headers(params martini.Params, r render.Render, req *http.Request) {
+	r.JSON(http.StatusOK, req.Header)
+}
+
+// Health performs a self test
+func (this *HttpAPI) Health(params martini.Params, r render.Render, req *http.Request) {
+	if process.IsShuttingDown() {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Application node is shutting down", Details: process.ReadShutdownStatus()})
+		return
+	}
+	if !db.IsBackendAvailable() {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Application node is in degraded mode: no writable backend", Details: db.ReadBackendStatus()})
+		return
+	}
+	health, err := process.HealthTest()
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Application node is unhealthy %+v", err), Details: health})
+		return
+	}
+
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Application node is healthy"), Details: health})
+
+}
+
+// LBCheck returns a constant respnse, and this can be used by load balancers that expect a given string.
+func (this *HttpAPI) LBCheck(params martini.Params, r render.Render, req *http.Request) {
+	r.JSON(http.StatusOK, "OK")
+}
+
+// LBCheck returns a constant respnse, and this can be used by load balancers that expect a given string.
+func (this *HttpAPI) LeaderCheck(params martini.Params, r render.Render, req *http.Request) {
+	respondStatus, err := strconv.Atoi(params["errorStatusCode"])
+	if err != nil || respondStatus < 0 {
+		respondStatus = http.StatusNotFound
+	}
+
+	if logic.IsLeader() {
+		r.JSON(http.StatusOK, "OK")
+	} else {
+		r.JSON(respondStatus, "Not leader")
+	}
+}
+
+// LeaderLease returns the leader lease held by the active node, with LeaderLeaseElection
+func (this *HttpAPI) LeaderLease(params martini.Params, r render.Render, req *http.Request) {
+	if !config.Config.LeaderLeaseElection {
+		Respond(r, &APIResponse{Code: ERROR, Message: "LeaderLeaseElection is not enabled"})
+		return
+	}
+	lease, found, err := process.ReadLeaderLease()
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	if !found {
+		Respond(r, &APIResponse{Code: ERROR, Message: "No leader lease found"})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Leader lease held by %s; fencing token: %d; expired: %t", lease.Hostname, lease.FencingToken, lease.IsExpired), Details: lease})
+}
+
+// A configurable endpoint that can be for regular status checks or whatever.  While similar to
+// Health() this returns 500 on failure.  This will prevent issues for those that have come to
+// expect a 200
+// It might be a good idea to deprecate the current Health() behavior and roll this in at some
+// point
+func (this *HttpAPI) StatusCheck(params martini.Params, r render.Render, req *http.Request) {
+	if process.IsShuttingDown() {
+		r.JSON(500, &APIResponse{Code: ERROR, Message: "Application node is shutting down", Details: process.ReadShutdownStatus()})
+		return
+	}
+	health, err := process.HealthTest()
+	if err != nil {
+		r.JSON(500, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Application node is unhealthy %+v", err), Details: health})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Application node is healthy"), Details: health})
+}
+
+// GrabElection forcibly grabs leadership. Use with care!!
+func (this *HttpAPI) GrabElection(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	err := process.GrabElection()
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Unable to grab election: %+v", err)})
+		return
+	}
+
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Node elected as leader")})
+}
+
+// Reelect causes re-elections for an active node
+func (this *HttpAPI) Reelect(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	err := process.Reelect()
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Unable to re-elect: %+v", err)})
+		return
+	}
+
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Set re-elections")})
+}
+
+// RaftYield yields to a specified host
+func (this *HttpAPI) RaftYield(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	if !orcraft.IsRaftEnabled() {
+		Respond(r, &APIResponse{Code: ERROR, Message: "raft-yield: not running with raft setup"})
+		return
+	}
+	orcraft.PublishYield(params["node"])
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Asynchronously yielded")})
+}
+
+// RaftYieldHint yields to a host whose name contains given hint (e.g. DC)
+func (this *HttpAPI) RaftYieldHint(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	if !orcraft.IsRaftEnabled() {
+		Respond(r, &APIResponse{Code: ERROR, Message: "raft-yield-hint: not running with raft setup"})
+		return
+	}
+	hint := params["hint"]
+	orcraft.PublishYieldHostnameHint(hint)
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Asynchronously yielded by hint %s", hint), Details: hint})
+}
+
+// RaftPeers returns the list of peers in a raft setup
+func (this *HttpAPI) RaftPeers(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !orcraft.IsRaftEnabled() {
+		Respond(r, &APIResponse{Code: ERROR, Message: "raft-nodes: not running with raft setup"})
+		return
+	}
+
+	peers, err := orcraft.GetPeers()
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Cannot get raft peers: %+v", err)})
+		return
+	}
+
+	r.JSON(http.StatusOK, peers)
+}
+
+// RaftState returns the state of this raft node
+func (this *HttpAPI) RaftState(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !orcraft.IsRaftEnabled() {
+		Respond(r, &APIResponse{Code: ERROR, Message: "raft-state: not running with raft setup"})
+		return
+	}
+
+	state := orcraft.GetState().String()
+	r.JSON(http.StatusOK, state)
+}
+
+// RaftLeader returns the identify of the leader, if possible
+func (this *HttpAPI) RaftLeader(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !orcraft.IsRaftEnabled() {
+		Respond(r, &APIResponse{Code: ERROR, Message: "raft-leader: not running with raft setup"})
+		return
+	}
+
+	leader := orcraft.GetLeader()
+	r.JSON(http.StatusOK, leader)
+}
+
+// RaftHealth indicates whether this node is part of a healthy raft group
+func (this *HttpAPI) RaftHealth(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !orcraft.IsRaftEnabled() {
+		Respond(r, &APIResponse{Code: ERROR, Message: "raft-state: not running with raft setup"})
+		return
+	}
+	if !orcraft.IsHealthy() {
+		Respond(r, &APIResponse{Code: ERROR, Message: "unhealthy"})
+		return
+	}
+	r.JSON(http.StatusOK, "healthy")
+}
+
+// RaftFollowerHealthReport is initiated by followers to report their identity and health to the raft leader.
+func (this *HttpAPI) RaftFollowerHealthReport(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !orcraft.IsRaftEnabled() {
+		Respond(r, &APIResponse{Code: ERROR, Message: "raft-state: not running with raft setup"})
+		return
+	}
+	appliedIndex, err := strconv.ParseInt(req.URL.Query().Get("appliedIndex"), 10, 64)
+	if err != nil {
+		// Reported by a follower which does not report its applied index
+		appliedIndex = -1
+	}
+	err = orcraft.OnHealthReport(params["authenticationToken"], params["raftBind"], params["raftAdvertise"], appliedIndex)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Cannot create snapshot: %+v", err)})
+		return
+	}
+	r.JSON(http.StatusOK, "health reported")
+}
+
+// RaftProbeOutcomes is initiated by followers to report their probe outcomes to the raft leader, which replicates them.
+func (this *HttpAPI) RaftProbeOutcomes(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !orcraft.IsRaftEnabled() {
+		Respond(r, &APIResponse{Code: ERROR, Message: "raft-probe-outcomes: not running with raft setup"})
+		return
+	}
+	if err := orcraft.AuthenticateRaftMember(params["authenticationToken"]); err != nil {
+		respondUnauthorized(r)
+		return
+	}
+	outcomes := []inst.InstanceProbeOutcome{}
+	if err := json.NewDecoder(req.Body).Decode(&outcomes); err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Cannot parse probe outcomes: %+v", err)})
+		return
+	}
+	if err := logic.PublishProbeOutcomes(outcomes); err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: "Probe outcomes reported", Details: len(outcomes)})
+}
+
+// RaftMetrics returns this node's raft log, snapshot and FSM metrics, and on the leader, the followers' applied index lag
+func (this *HttpAPI) RaftMetrics(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !orcraft.IsRaftEnabled() {
+		Respond(r, &APIResponse{Code: ERROR, Message: "raft-metrics: not running with raft setup"})
+		return
+	}
+	raftMetrics, err := orcraft.ReadRaftMetrics()
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	r.JSON(http.StatusOK, raftMetrics)
+}
+
+// RaftSnapshot instructs raft to take a snapshot
+func (this *HttpAPI) RaftSnapshot(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !orcraft.IsRaftEnabled() {
+		Respond(r, &APIResponse{Code: ERROR, Message: "raft-leader: not running with raft setup"})
+		return
+	}
+	err := orcraft.Snapshot()
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Cannot create snapshot: %+v", err)})
+		return
+	}
+	r.JSON(http.StatusOK, "snapshot created")
+}
+
+// ReloadConfiguration reloads confiug settings (not all of which will apply after change)
+func (this *HttpAPI) ReloadConfiguration(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
 		return
 	}
 	config.Reload()
 	inst.AuditOperation("reload-configuration", nil, "Triggered via API")
 
-	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Config reloaded")})
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Config reloaded")})
+}
+
+// ReplicationAnalysis retuens list of issues
+func (this *HttpAPI) replicationAnalysis(clusterName string, instanceKey *inst.InstanceKey, params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	analysis, err := inst.GetReplicationAnalysis(clusterName, &inst.ReplicationAnalysisHints{IncludeDowntimed: true})
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Cannot get analysis: %+v", err)})
+		return
+	}
+	// Possibly filter single instance
+	if instanceKey != nil {
+		filtered := analysis[:0]
+		for _, analysisEntry := range analysis {
+			if instanceKey.Equals(&analysisEntry.AnalyzedInstanceKey) {
+				filtered = append(filtered, analysisEntry)
+			}
+		}
+		analysis = filtered
+	}
+	analysis = filterAnalysisByNamespaces(req, user, analysis)
+	for i := range analysis {
+		if err := logic.EstimateFailoverImpact(&analysis[i]); err != nil {
+			log.Errore(err)
+		}
+	}
+
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Analysis"), Details: analysis})
+}
+
+// ReplicationAnalysis retuens list of issues
+func (this *HttpAPI) ReplicationAnalysis(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	this.replicationAnalysis("", nil, params, r, req, user)
+}
+
+// ReplicationAnalysis retuens list of issues
+func (this *HttpAPI) ReplicationAnalysisForCluster(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	clusterName := params["clusterName"]
+
+	var err error
+	if clusterName, err = inst.DeduceClusterName(params["clusterName"]); err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Cannot get analysis: %+v", err)})
+		return
+	}
+	if clusterName == "" {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Cannot get cluster name: %+v", params["clusterName"])})
+		return
+	}
+	this.replicationAnalysis(clusterName, nil, params, r, req, user)
+}
+
+// ReplicationAnalysis retuens list of issues
+func (this *HttpAPI) ReplicationAnalysisForKey(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: fmt.Sprintf("Cannot get analysis: %+v", err)})
+		return
+	}
+	if !instanceKey.IsValid() {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Cannot get analysis: invalid key %+v", instanceKey)})
+		return
+	}
+	this.replicationAnalysis("", &instanceKey, params, r, req, user)
+}
+
+// fenceActiveRecovery treats recoveries in flight on given cluster per the active-recovery query param: join|abort|override.
+// The request recovers given instance, or, lacking one, the master of given cluster.
+// The request is only to proceed when proceed is true. Otherwise, either it was refused and a response is made, or it
+// successfully joined an in-flight recovery, which is returned for the caller to respond with.
+func (this *HttpAPI) fenceActiveRecovery(clusterName string, instanceKey *inst.InstanceKey, r render.Render, req *http.Request, user auth.User) (joinedRecovery *logic.TopologyRecovery, proceed bool) {
+	policy, err := logic.ParseActiveRecoveryPolicy(req.URL.Query().Get("active-recovery"))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return nil, false
+	}
+	if instanceKey != nil {
+		joinedRecovery, err = logic.FenceActiveInstanceRecovery(instanceKey, policy, getUserId(req, user))
+	} else {
+		joinedRecovery, err = logic.FenceActiveMasterRecovery(clusterName, policy, getUserId(req, user))
+	}
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrRecoveryInFlight, Message: err.Error()})
+		return nil, false
+	}
+	if joinedRecovery == nil {
+		return nil, true
+	}
+	if !joinedRecovery.IsSuccessful {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Joined recovery %s completed unsuccessfully", joinedRecovery.UID), Details: joinedRecovery})
+		return nil, false
+	}
+	return joinedRecovery, false
+}
+
+// RecoverLite attempts recovery on a given instance, without executing external processes
+func (this *HttpAPI) RecoverLite(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	params["skipProcesses"] = "true"
+	this.Recover(params, r, req, user)
+}
+
+// Recover attempts recovery on a given instance
+func (this *HttpAPI) Recover(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
+		return
+	}
+	var candidateKey *inst.InstanceKey
+	if key, err := this.getInstanceKey(params["candidateHost"], params["candidatePort"]); err == nil {
+		candidateKey = &key
+	}
+
+	if joinedRecovery, proceed := this.fenceActiveRecovery("", &instanceKey, r, req, user); !proceed {
+		if joinedRecovery != nil {
+			Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Joined recovery %s", joinedRecovery.UID), Details: *joinedRecovery.SuccessorKey})
+		}
+		return
+	}
+
+	skipProcesses := (req.URL.Query().Get("skipProcesses") == "true") || (params["skipProcesses"] == "true")
+	recoveryAttempted, promotedInstanceKey, err := logic.CheckAndRecover(&instanceKey, candidateKey, skipProcesses)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error(), Details: instanceKey})
+		return
+	}
+	if !recoveryAttempted {
+		clusterName, _ := inst.GetClusterName(&instanceKey)
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: recoveryNotAttemptedErrorCode(clusterName), Message: "Recovery not attempted", Details: instanceKey})
+		return
+	}
+	if promotedInstanceKey == nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Recovery attempted but no instance promoted", Details: instanceKey})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Recovery executed on %+v", instanceKey), Details: *promotedInstanceKey})
+}
+
+// GracefulMasterTakeover gracefully fails over a master onto its single replica. force=true overrides an unmet replica quorum.
+// when-caught-up=true waits for a lagging designated replica to catch up.
+func (this *HttpAPI) GracefulMasterTakeover(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: err.Error()})
+		return
+	}
+	if joinedRecovery, proceed := this.fenceActiveRecovery(clusterName, nil, r, req, user); !proceed {
+		if joinedRecovery != nil {
+			Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Joined recovery %s", joinedRecovery.UID), Details: joinedRecovery})
+		}
+		return
+	}
+	designatedKey, _ := this.getInstanceKey(params["designatedHost"], params["designatedPort"])
+	// designatedKey may be empty/invalid
+	topologyRecovery, _, err := logic.GracefulMasterTakeover(clusterName, &designatedKey, req.URL.Query().Get("force") == "true", req.URL.Query().Get("when-caught-up") == "true")
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error(), Details: topologyRecovery})
+		return
+	}
+	if topologyRecovery.SuccessorKey == nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: "graceful-master-takeover: no successor promoted", Details: topologyRecovery})
+		return
+	}
+
+	Respond(r, &APIResponse{Code: OK, Message: "graceful-master-takeover: successor promoted", Details: topologyRecovery})
+}
+
+// ForceMasterFailover fails over a master (even if there's no particular problem with the master)
+func (this *HttpAPI) ForceMasterFailover(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: err.Error()})
+		return
+	}
+	if joinedRecovery, proceed := this.fenceActiveRecovery(clusterName, nil, r, req, user); !proceed {
+		if joinedRecovery != nil {
+			Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Joined recovery %s", joinedRecovery.UID), Details: joinedRecovery})
+		}
+		return
+	}
+	topologyRecovery, err := logic.ForceMasterFailover(clusterName)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	if topologyRecovery.SuccessorKey != nil {
+		Respond(r, &APIResponse{Code: OK, Message: "Master failed over", Details: topologyRecovery})
+	} else {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Master not failed over", Details: topologyRecovery})
+	}
+}
+
+// RecoverBackend recovers orchestrator's own failed backend master, promoting a backend replica in its place.
+// force=true promotes even though the failed master could not be fenced.
+func (this *HttpAPI) RecoverBackend(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	var candidateKey *inst.InstanceKey
+	if params["candidateHost"] != "" {
+		key, err := inst.NewInstanceKeyFromStrings(params["candidateHost"], params["candidatePort"])
+		if err != nil {
+			Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
+			return
+		}
+		candidateKey = key
+	}
+	backendRecovery, err := logic.RecoverBackend(candidateKey, req.URL.Query().Get("force") == "true")
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error(), Details: backendRecovery})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Backend recovered: %s", backendRecovery.PromotedBackend), Details: backendRecovery})
 }
 
-// ReplicationAnalysis retuens list of issues
-func (this *HttpAPI) replicationAnalysis(clusterName string, instanceKey *inst.InstanceKey, params martini.Params, r render.Render, req *http.Request) {
-	analysis, err := inst.GetReplicationAnalysis(clusterName, &inst.ReplicationAnalysisHints{IncludeDowntimed: true})
+// SelfCluster returns orchestrator's own backend cluster, along with the state of the backend
+func (this *HttpAPI) SelfCluster(params martini.Params, r render.Render, req *http.Request) {
+	selfCluster, err := logic.ReadSelfCluster()
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Cannot get analysis: %+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-	// Possibly filter single instance
-	if instanceKey != nil {
-		filtered := analysis[:0]
-		for _, analysisEntry := range analysis {
-			if instanceKey.Equals(&analysisEntry.AnalyzedInstanceKey) {
-				filtered = append(filtered, analysisEntry)
-			}
+	r.JSON(http.StatusOK, selfCluster)
+}
+
+// Registers promotion preference for given instance
+func (this *HttpAPI) RegisterCandidate(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
+		return
+	}
+	promotionRule, err := inst.ParseCandidatePromotionRule(params["promotionRule"])
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+
+	candidate := inst.NewCandidateDatabaseInstance(&instanceKey, promotionRule).WithCurrentTime()
+	if ttl := req.URL.Query().Get("ttl"); ttl != "" {
+		ttlSeconds, err := util.SimpleTimeToSeconds(ttl)
+		if err == nil && ttlSeconds <= 0 {
+			err = fmt.Errorf("ttl must be positive. Given value: %s", ttl)
 		}
-		analysis = filtered
+		if err != nil {
+			Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+			return
+		}
+		candidate = candidate.WithTTL(uint(ttlSeconds))
 	}
 
-	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Analysis"), Details: analysis})
+	if orcraft.IsRaftEnabled() {
+		_, err = orcraft.PublishCommand("register-candidate", candidate)
+	} else {
+		err = inst.RegisterCandidateInstance(candidate)
+	}
+
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+
+	Respond(r, &APIResponse{Code: OK, Message: "Registered candidate", Details: instanceKey})
 }
 
-// ReplicationAnalysis retuens list of issues
-func (this *HttpAPI) ReplicationAnalysis(params martini.Params, r render.Render, req *http.Request) {
-	this.replicationAnalysis("", nil, params, r, req)
+// OverridePromotionRule temporarily overrides the promotion rule of an instance. The instance's registered
+// promotion rule applies again once the override expires.
+func (this *HttpAPI) OverridePromotionRule(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
+		return
+	}
+	promotionRule, err := inst.ParseCandidatePromotionRule(params["promotionRule"])
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	durationSeconds, err := util.SimpleTimeToSeconds(params["duration"])
+	if err == nil && durationSeconds <= 0 {
+		err = fmt.Errorf("Duration value must be positive. Given value: %d", durationSeconds)
+	}
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	override := inst.NewCandidatePromotionRuleOverride(&instanceKey, promotionRule, uint(durationSeconds), params["reason"], params["owner"])
+
+	if orcraft.IsRaftEnabled() {
+		_, err = orcraft.PublishCommand("override-promotion-rule", override)
+	} else {
+		err = inst.WriteCandidatePromotionRuleOverride(override)
+	}
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Promotion rule overridden: %s", override.String()), Details: override})
 }
 
-// ReplicationAnalysis retuens list of issues
-func (this *HttpAPI) ReplicationAnalysisForCluster(params martini.Params, r render.Render, req *http.Request) {
-	clusterName := params["clusterName"]
+// ClearPromotionRuleOverride removes the promotion rule override of an instance
+func (this *HttpAPI) ClearPromotionRuleOverride(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
+		return
+	}
+	if orcraft.IsRaftEnabled() {
+		_, err = orcraft.PublishCommand("clear-promotion-rule-override", instanceKey)
+	} else {
+		err = inst.DeleteCandidatePromotionRuleOverride(&instanceKey)
+	}
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Promotion rule override cleared: %+v", instanceKey), Details: instanceKey})
+}
 
-	var err error
-	if clusterName, err = inst.DeduceClusterName(params["clusterName"]); err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Cannot get analysis: %+v", err)})
+// PromotionRuleOverrides lists active promotion rule overrides
+func (this *HttpAPI) PromotionRuleOverrides(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	overrides, err := inst.ReadCandidatePromotionRuleOverrides()
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-	if clusterName == "" {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Cannot get cluster name: %+v", params["clusterName"])})
+	r.JSON(http.StatusOK, overrides)
+}
+
+// LockCluster takes an advisory lock on a cluster. While locked, topology changing operations on the
+// cluster by other actors are rejected.
+func (this *HttpAPI) LockCluster(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-	this.replicationAnalysis(clusterName, nil, params, r, req)
+	durationSeconds := defaultClusterLockDurationSeconds
+	if params["duration"] != "" {
+		durationSeconds, err = util.SimpleTimeToSeconds(params["duration"])
+		if err == nil && durationSeconds <= 0 {
+			err = fmt.Errorf("Duration value must be positive. Given value: %d", durationSeconds)
+		}
+		if err != nil {
+			Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+			return
+		}
+	}
+	clusterAlias, err := inst.ReadAliasByClusterName(clusterName)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	actor := getClusterLockActor(req, user)
+	if err := inst.CheckClusterLock(clusterAlias, actor); err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	clusterLock := inst.NewClusterLock(clusterName, clusterAlias, actor, params["reason"], uint(durationSeconds))
+	if orcraft.IsRaftEnabled() {
+		_, err = orcraft.PublishCommand("lock-cluster", clusterLock)
+	} else {
+		err = inst.WriteClusterLock(clusterLock)
+	}
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: clusterLock.String(), Details: clusterLock})
 }
 
-// ReplicationAnalysis retuens list of issues
-func (this *HttpAPI) ReplicationAnalysisForKey(params martini.Params, r render.Render, req *http.Request) {
-	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+// UnlockCluster releases the lock on a cluster. Only the lock owner may unlock, unless force=true is given.
+func (this *HttpAPI) UnlockCluster(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	clusterName, err := figureClusterName(getClusterHint(params))
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Cannot get analysis: %+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-	if !instanceKey.IsValid() {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Cannot get analysis: invalid key %+v", instanceKey)})
+	clusterAlias, err := inst.ReadAliasByClusterName(clusterName)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	if req.URL.Query().Get("force") != "true" {
+		if err := inst.CheckClusterLock(clusterAlias, getClusterLockActor(req, user)); err != nil {
+			Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+			return
+		}
+	}
+	if orcraft.IsRaftEnabled() {
+		_, err = orcraft.PublishCommand("unlock-cluster", clusterAlias)
+	} else {
+		err = inst.DeleteClusterLock(clusterAlias)
+	}
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-	this.replicationAnalysis("", &instanceKey, params, r, req)
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Cluster %s unlocked", clusterAlias), Details: clusterAlias})
 }
 
-// RecoverLite attempts recovery on a given instance, without executing external processes
-func (this *HttpAPI) RecoverLite(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	params["skipProcesses"] = "true"
-	this.Recover(params, r, req, user)
+// PauseDiscovery stops polling a cluster's instances for a while. The cluster's last known state remains
+// visible, marked as stale.
+func (this *HttpAPI) PauseDiscovery(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	durationSeconds := defaultDiscoveryPauseDurationSeconds
+	if params["duration"] != "" {
+		durationSeconds, err = util.SimpleTimeToSeconds(params["duration"])
+		if err == nil && durationSeconds <= 0 {
+			err = fmt.Errorf("Duration value must be positive. Given value: %d", durationSeconds)
+		}
+		if err != nil {
+			Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+			return
+		}
+	}
+	clusterAlias, err := inst.ReadAliasByClusterName(clusterName)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	discoveryPause := inst.NewClusterDiscoveryPause(clusterName, clusterAlias, getClusterLockActor(req, user), req.URL.Query().Get("reason"), uint(durationSeconds))
+	if orcraft.IsRaftEnabled() {
+		_, err = orcraft.PublishCommand("pause-discovery", discoveryPause)
+	} else {
+		err = inst.WriteClusterDiscoveryPause(discoveryPause)
+	}
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: discoveryPause.String(), Details: discoveryPause})
 }
 
-// Recover attempts recovery on a given instance
-func (this *HttpAPI) Recover(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+// ResumeDiscovery resumes polling of a cluster's instances
+func (this *HttpAPI) ResumeDiscovery(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
-	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	clusterAlias, err := inst.ReadAliasByClusterName(clusterName)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	if orcraft.IsRaftEnabled() {
+		_, err = orcraft.PublishCommand("resume-discovery", clusterAlias)
+	} else {
+		err = inst.DeleteClusterDiscoveryPause(clusterAlias)
+	}
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-	var candidateKey *inst.InstanceKey
-	if key, err := this.getInstanceKey(params["candidateHost"], params["candidatePort"]); err == nil {
-		candidateKey = &key
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Discovery of cluster %s resumed", clusterAlias), Details: clusterAlias})
+}
+
+// DiscoveryPauses lists clusters whose discovery is paused
+func (this *HttpAPI) DiscoveryPauses(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	discoveryPauses, err := inst.ReadClusterDiscoveryPauses()
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
 	}
+	r.JSON(http.StatusOK, discoveryPauses)
+}
 
-	skipProcesses := (req.URL.Query().Get("skipProcesses") == "true") || (params["skipProcesses"] == "true")
-	recoveryAttempted, promotedInstanceKey, err := logic.CheckAndRecover(&instanceKey, candidateKey, skipProcesses)
+// PinMaster pins an instance as the only master allowed for its cluster. Automated recoveries which would promote any
+// other instance regroup replicas below it as intermediate master instead, and alert for human action.
+func (this *HttpAPI) PinMaster(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error(), Details: instanceKey})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
+		return
+	}
+	instance, found, err := inst.ReadInstance(&instanceKey)
+	if (!found) || (err != nil) {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInstanceNotFound, Message: fmt.Sprintf("Cannot read instance: %+v", instanceKey)})
+		return
+	}
+	clusterAlias, err := inst.ReadAliasByClusterName(instance.ClusterName)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	pinnedMaster := inst.NewClusterPinnedMaster(instance.ClusterName, clusterAlias, &instance.Key, getClusterLockActor(req, user), req.URL.Query().Get("reason"))
+	if err := logic.PinClusterMaster(pinnedMaster); err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: pinnedMaster.String(), Details: pinnedMaster})
+}
+
+// UnpinMaster lets automated recoveries promote any eligible instance of a cluster
+func (this *HttpAPI) UnpinMaster(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	clusterAlias, err := inst.ReadAliasByClusterName(clusterName)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-	if !recoveryAttempted {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Recovery not attempted", Details: instanceKey})
+	if err := logic.UnpinClusterMaster(clusterAlias); err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-	if promotedInstanceKey == nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Recovery attempted but no instance promoted", Details: instanceKey})
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Master of cluster %s unpinned", clusterAlias), Details: clusterAlias})
+}
+
+// PinnedMasters lists clusters whose master is pinned
+func (this *HttpAPI) PinnedMasters(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	pinnedMasters, err := inst.ReadClusterPinnedMasters()
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Recovery executed on %+v", instanceKey), Details: *promotedInstanceKey})
+	r.JSON(http.StatusOK, pinnedMasters)
 }
 
-// GracefulMasterTakeover gracefully fails over a master onto its single replica.
-func (this *HttpAPI) GracefulMasterTakeover(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+// RegisterSchemaMigration registers an in-progress schema migration on a cluster, suppressing automated actions
+// which would break it. Suppressed actions are given as comma delimited "suppress" query param. The registration
+// expires after given duration (default: 1 hour), unless registered again.
+func (this *HttpAPI) RegisterSchemaMigration(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	durationSeconds := defaultSchemaMigrationDurationSeconds
+	if params["duration"] != "" {
+		durationSeconds, err = util.SimpleTimeToSeconds(params["duration"])
+		if err == nil && durationSeconds <= 0 {
+			err = fmt.Errorf("Duration value must be positive. Given value: %d", durationSeconds)
+		}
+		if err != nil {
+			Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+			return
+		}
+	}
+	suppressedActions, err := inst.ParseSchemaMigrationSuppressedActions(req.URL.Query().Get("suppress"))
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-	designatedKey, _ := this.getInstanceKey(params["designatedHost"], params["designatedPort"])
-	// designatedKey may be empty/invalid
-	topologyRecovery, _, err := logic.GracefulMasterTakeover(clusterName, &designatedKey)
+	clusterAlias, err := inst.ReadAliasByClusterName(clusterName)
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error(), Details: topologyRecovery})
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-	if topologyRecovery.SuccessorKey == nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: "graceful-master-takeover: no successor promoted", Details: topologyRecovery})
+	migration := inst.NewClusterSchemaMigration(clusterName, clusterAlias, params["migrationId"], getClusterLockActor(req, user), req.URL.Query().Get("description"), suppressedActions, uint(durationSeconds))
+	if err := logic.RegisterSchemaMigration(migration); err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-
-	Respond(r, &APIResponse{Code: OK, Message: "graceful-master-takeover: successor promoted", Details: topologyRecovery})
+	Respond(r, &APIResponse{Code: OK, Message: migration.String(), Details: migration})
 }
 
-// ForceMasterFailover fails over a master (even if there's no particular problem with the master)
-func (this *HttpAPI) ForceMasterFailover(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+// UnregisterSchemaMigration unregisters a schema migration once complete, lifting its suppressed actions
+func (this *HttpAPI) UnregisterSchemaMigration(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	clusterName, err := figureClusterName(getClusterHint(params))
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
-	topologyRecovery, err := logic.ForceMasterFailover(clusterName)
+	clusterAlias, err := inst.ReadAliasByClusterName(clusterName)
 	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	if err := logic.UnregisterSchemaMigration(clusterAlias, params["migrationId"]); err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-	if topologyRecovery.SuccessorKey != nil {
-		Respond(r, &APIResponse{Code: OK, Message: "Master failed over", Details: topologyRecovery})
-	} else {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Master not failed over", Details: topologyRecovery})
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Schema migration %s on cluster %s unregistered", params["migrationId"], clusterAlias), Details: params["migrationId"]})
+}
+
+// SchemaMigrations lists in-progress schema migrations, of all clusters or of a given cluster
+func (this *HttpAPI) SchemaMigrations(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	var clusterAlias string
+	if clusterHint := getClusterHint(params); clusterHint != "" {
+		clusterName, err := figureClusterName(clusterHint)
+		if err != nil {
+			Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
+			return
+		}
+		if clusterAlias, err = inst.ReadAliasByClusterName(clusterName); err != nil {
+			Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+			return
+		}
+	}
+	migrations, err := inst.ReadClusterSchemaMigrations(clusterAlias)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
 	}
+	r.JSON(http.StatusOK, migrations)
 }
 
-// Registers promotion preference for given instance
-func (this *HttpAPI) RegisterCandidate(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+// CreateAPIToken generates a bearer token for limited automation, restricted to the clusters given in "cluster"
+// query params, and to the operation classes given in the comma delimited "operations" query param.
+// The bearer is only ever returned by this call.
+func (this *HttpAPI) CreateAPIToken(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) || getAPITokenRequest(req) != nil {
+		respondUnauthorized(r)
 		return
 	}
-	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+	operationClasses := []string{}
+	if operations := req.URL.Query().Get("operations"); operations != "" {
+		operationClasses = strings.Split(operations, ",")
+	}
+	token, bearer, err := process.NewAPIToken(getClusterLockActor(req, user), req.URL.Query().Get("description"), req.URL.Query()["cluster"], operationClasses)
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-	promotionRule, err := inst.ParseCandidatePromotionRule(params["promotionRule"])
+	if orcraft.IsRaftEnabled() {
+		_, err = orcraft.PublishCommand("write-api-token", token)
+	} else {
+		err = process.WriteAPIToken(token)
+	}
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Created API token %s", token.TokenId), Details: bearer})
+}
 
-	candidate := inst.NewCandidateDatabaseInstance(&instanceKey, promotionRule).WithCurrentTime()
-
+// RevokeAPIToken revokes an API token
+func (this *HttpAPI) RevokeAPIToken(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) || getAPITokenRequest(req) != nil {
+		respondUnauthorized(r)
+		return
+	}
+	var err error
 	if orcraft.IsRaftEnabled() {
-		_, err = orcraft.PublishCommand("register-candidate", candidate)
+		_, err = orcraft.PublishCommand("delete-api-token", params["tokenId"])
 	} else {
-		err = inst.RegisterCandidateInstance(candidate)
+		err = process.DeleteAPIToken(params["tokenId"])
 	}
-
 	if err != nil {
 		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Revoked API token %s", params["tokenId"]), Details: params["tokenId"]})
+}
 
-	Respond(r, &APIResponse{Code: OK, Message: "Registered candidate", Details: instanceKey})
+// APITokens lists API tokens to users with write privileges. Their secrets are not included.
+func (this *HttpAPI) APITokens(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if getAPITokenRequest(req) != nil || !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	tokens, err := process.ReadAPITokens()
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	redacted := []process.APIToken{}
+	for _, token := range tokens {
+		redacted = append(redacted, token.Redacted())
+	}
+	r.JSON(http.StatusOK, redacted)
+}
+
+// ClusterLocks lists active cluster locks
+func (this *HttpAPI) ClusterLocks(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	clusterLocks, err := inst.ReadClusterLocks()
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	r.JSON(http.StatusOK, clusterLocks)
 }
 
 // AutomatedRecoveryFilters retuens list of clusters which are configured with automated recovery
@@ -2880,7 +5688,7 @@ func (this *HttpAPI) AutomatedRecoveryFilters(params martini.Params, r render.Re
 }
 
 // AuditFailureDetection provides list of topology_failure_detection entries
-func (this *HttpAPI) AuditFailureDetection(params martini.Params, r render.Render, req *http.Request) {
+func (this *HttpAPI) AuditFailureDetection(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 
 	var audits []logic.TopologyRecovery
 	var err error
@@ -2902,12 +5710,23 @@ func (this *HttpAPI) AuditFailureDetection(params martini.Params, r render.Rende
 		return
 	}
 
-	r.JSON(http.StatusOK, audits)
+	r.JSON(http.StatusOK, filterRecoveriesByNamespaces(req, user, audits))
 }
 
 // AuditRecoverySteps returns audited steps of a given recovery
-func (this *HttpAPI) AuditRecoverySteps(params martini.Params, r render.Render, req *http.Request) {
+func (this *HttpAPI) AuditRecoverySteps(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	recoveryUID := params["uid"]
+	if isRestrictedToClusters(req, user) {
+		recoveries, err := logic.ReadRecoveryByUID(recoveryUID)
+		if err != nil {
+			Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+			return
+		}
+		if len(filterRecoveriesByNamespaces(req, user, recoveries)) == 0 {
+			respondUnauthorized(r)
+			return
+		}
+	}
 	audits, err := logic.ReadTopologyRecoverySteps(recoveryUID)
 
 	if err != nil {
@@ -2931,7 +5750,7 @@ func (this *HttpAPI) ReadReplicationAnalysisChangelog(params martini.Params, r r
 }
 
 // AuditRecovery provides list of topology-recovery entries
-func (this *HttpAPI) AuditRecovery(params martini.Params, r render.Render, req *http.Request) {
+func (this *HttpAPI) AuditRecovery(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	var audits []logic.TopologyRecovery
 	var err error
 
@@ -2955,7 +5774,37 @@ func (this *HttpAPI) AuditRecovery(params martini.Params, r render.Render, req *
 		return
 	}
 
-	r.JSON(http.StatusOK, audits)
+	r.JSON(http.StatusOK, filterRecoveriesByNamespaces(req, user, audits))
+}
+
+// RecoveryBundle serves the artifacts bundle of a given recovery as a downloadable archive
+func (this *HttpAPI) RecoveryBundle(params martini.Params, r render.Render, req *http.Request, w http.ResponseWriter) {
+	recoveryId, err := strconv.ParseInt(params["id"], 10, 0)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	recoveries, err := logic.ReadRecovery(recoveryId)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	if len(recoveries) == 0 {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Recovery not found: %+v", recoveryId)})
+		return
+	}
+	bundle, err := logic.ReadTopologyRecoveryBundle(recoveries[0].UID)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=recovery-bundle-%d.tar.gz", recoveryId))
+	w.WriteHeader(http.StatusOK)
+	if err := bundle.WriteArchive(w); err != nil {
+		log.Errore(err)
+	}
 }
 
 // ActiveClusterRecovery returns recoveries in-progress for a given cluster
@@ -2986,7 +5835,7 @@ func (this *HttpAPI) RecentlyActiveClusterRecovery(params martini.Params, r rend
 func (this *HttpAPI) RecentlyActiveInstanceRecovery(params martini.Params, r render.Render, req *http.Request) {
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 
@@ -3003,7 +5852,7 @@ func (this *HttpAPI) RecentlyActiveInstanceRecovery(params martini.Params, r ren
 // ClusterInfo provides details of a given cluster
 func (this *HttpAPI) AcknowledgeClusterRecoveries(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 
@@ -3016,7 +5865,7 @@ func (this *HttpAPI) AcknowledgeClusterRecoveries(params martini.Params, r rende
 	}
 
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
 		return
 	}
 
@@ -3047,13 +5896,13 @@ func (this *HttpAPI) AcknowledgeClusterRecoveries(params martini.Params, r rende
 // ClusterInfo provides details of a given cluster
 func (this *HttpAPI) AcknowledgeInstanceRecoveries(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
-		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
 		return
 	}
 
@@ -3084,7 +5933,7 @@ func (this *HttpAPI) AcknowledgeInstanceRecoveries(params martini.Params, r rend
 // ClusterInfo provides details of a given cluster
 func (this *HttpAPI) AcknowledgeRecovery(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 	var err error
@@ -3136,7 +5985,7 @@ func (this *HttpAPI) AcknowledgeRecovery(params martini.Params, r render.Render,
 // ClusterInfo provides details of a given cluster
 func (this *HttpAPI) AcknowledgeAllRecoveries(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
-		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		respondUnauthorized(r)
 		return
 	}
 
@@ -3177,6 +6026,178 @@ func (this *HttpAPI) BlockedRecoveries(params martini.Params, r render.Render, r
 	r.JSON(http.StatusOK, blockedRecoveries)
 }
 
+// RecoveryBlocks lists the recent recoveries blocking further recoveries, optionally only those of a given cluster,
+// along with the failures detected since, whose recoveries are blocked
+func (this *HttpAPI) RecoveryBlocks(params martini.Params, r render.Render, req *http.Request) {
+	clusterName := ""
+	if getClusterHint(params) != "" {
+		var err error
+		if clusterName, err = figureClusterName(getClusterHint(params)); err != nil {
+			Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
+			return
+		}
+	}
+	recoveryBlocks, err := logic.ReadClusterRecoveryBlocks(clusterName)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	r.JSON(http.StatusOK, recoveryBlocks)
+}
+
+// changeRecoveryBlock clears or extends the recovery block of a cluster. A reason must be given, as "reason" query param.
+func (this *HttpAPI) changeRecoveryBlock(params martini.Params, r render.Render, req *http.Request, user auth.User, extend bool) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	reason := strings.TrimSpace(req.URL.Query().Get("reason"))
+	if reason == "" {
+		Respond(r, &APIResponse{Code: ERROR, Message: "No reason given"})
+		return
+	}
+	userId := getUserId(req, user)
+	if userId == "" {
+		userId = inst.GetMaintenanceOwner()
+	}
+	var recoveryBlocks []*logic.RecoveryBlock
+	if extend {
+		durationSeconds, err := util.SimpleTimeToSeconds(params["duration"])
+		if err == nil && durationSeconds <= 0 {
+			err = fmt.Errorf("Duration value must be positive. Given value: %d", durationSeconds)
+		}
+		if err != nil {
+			Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+			return
+		}
+		recoveryBlocks, err = logic.ExtendRecoveryBlock(clusterName, int64(durationSeconds), userId, reason)
+		if err != nil {
+			Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+			return
+		}
+		Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Recovery block of cluster %s extended by %ds", clusterName, durationSeconds), Details: recoveryBlocks})
+		return
+	}
+	recoveryBlocks, err = logic.ClearRecoveryBlock(clusterName, userId, reason)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Recovery block of cluster %s cleared", clusterName), Details: recoveryBlocks})
+}
+
+// ClearRecoveryBlock lifts the recovery block of a cluster, allowing further recoveries on it
+func (this *HttpAPI) ClearRecoveryBlock(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	this.changeRecoveryBlock(params, r, req, user, false)
+}
+
+// ExtendRecoveryBlock keeps blocking recoveries on a cluster for given duration (e.g. "30m", "2h") from now
+func (this *HttpAPI) ExtendRecoveryBlock(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	this.changeRecoveryBlock(params, r, req, user, true)
+}
+
+// RecoveryApprovals lists recovery approval requests of the past day, optionally only those of a given cluster
+func (this *HttpAPI) RecoveryApprovals(params martini.Params, r render.Render, req *http.Request) {
+	clusterName := ""
+	if getClusterHint(params) != "" {
+		var err error
+		if clusterName, err = figureClusterName(getClusterHint(params)); err != nil {
+			Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
+			return
+		}
+	}
+	approvals, err := logic.ReadRecoveryApprovals(clusterName)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	r.JSON(http.StatusOK, approvals)
+}
+
+// decideRecoveryApproval approves or rejects the pending recovery of an instance
+func (this *HttpAPI) decideRecoveryApproval(params martini.Params, r render.Render, req *http.Request, user auth.User, approve bool) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
+		return
+	}
+	userId := getUserId(req, user)
+	if userId == "" {
+		userId = inst.GetMaintenanceOwner()
+	}
+	var approval *logic.RecoveryApproval
+	if approve {
+		approval, err = logic.ApproveRecovery(&instanceKey, userId)
+	} else {
+		approval, err = logic.RejectRecovery(&instanceKey, userId)
+	}
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Recovery %s: %+v", approval.Status, instanceKey), Details: approval})
+}
+
+// ApproveRecovery approves the pending recovery of an instance, which then runs on the next failure detection
+func (this *HttpAPI) ApproveRecovery(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	this.decideRecoveryApproval(params, r, req, user, true)
+}
+
+// RejectRecovery rejects the pending recovery of an instance
+func (this *HttpAPI) RejectRecovery(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	this.decideRecoveryApproval(params, r, req, user, false)
+}
+
+// RecoveryStats returns a cluster's recovery statistics: detection, decision and promotion latencies and total RTO
+// over the last 30 and 90 days, along with a weekly trend
+func (this *HttpAPI) RecoveryStats(params martini.Params, r render.Render, req *http.Request) {
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterNotFound, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	stats, err := logic.ReadClusterRecoveryStats(clusterName)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	r.JSON(http.StatusOK, stats)
+}
+
+// ExternalHealthChecks returns recent opinions of external health sources on suspect masters,
+// optionally only those on a given instance
+func (this *HttpAPI) ExternalHealthChecks(params martini.Params, r render.Render, req *http.Request) {
+	var instanceKey *inst.InstanceKey
+	if params["host"] != "" {
+		key, err := this.getInstanceKey(params["host"], params["port"])
+		if err != nil {
+			Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrInvalidInstanceKey, Message: err.Error()})
+			return
+		}
+		instanceKey = &key
+	}
+	checks, err := logic.ReadExternalHealthChecks(instanceKey, 100)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	r.JSON(http.StatusOK, checks)
+}
+
 // DisableGlobalRecoveries globally disables recoveries
 func (this *HttpAPI) DisableGlobalRecoveries(params martini.Params, r render.Render, req *http.Request) {
 	var err error
@@ -3225,6 +6246,38 @@ func (this *HttpAPI) CheckGlobalRecoveries(params martini.Params, r render.Rende
 	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Global recoveries %+v", details), Details: details})
 }
 
+// ExportState returns a portable dump of orchestrator's operational metadata
+func (this *HttpAPI) ExportState(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	state, err := logic.ExportState()
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	r.JSON(http.StatusOK, state)
+}
+
+// ImportState applies a dump, as provided by ExportState, onto orchestrator's backend
+func (this *HttpAPI) ImportState(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		respondUnauthorized(r)
+		return
+	}
+	state := &logic.ExportedState{}
+	if err := json.NewDecoder(req.Body).Decode(state); err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Cannot parse state: %+v", err)})
+		return
+	}
+	if err := logic.ImportState(state); err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Imported state exported at %s", state.ExportedAt), Details: len(state.MinimalInstances)})
+}
+
 func (this *HttpAPI) getSynonymPath(path string) (synonymPath string) {
 	pathBase := strings.Split(path, "/")[0]
 	if synonym, ok := apiSynonyms[pathBase]; ok {
@@ -3233,15 +6286,57 @@ func (this *HttpAPI) getSynonymPath(path string) (synonymPath string) {
 	return synonymPath
 }
 
+// isOperationPath checks whether an API path, or the path it is a synonym of, is one of given operations
+func isOperationPath(path string, operations map[string]bool) bool {
+	pathBase := strings.Split(path, "/")[0]
+	if operations[pathBase] {
+		return true
+	}
+	for original, synonym := range apiSynonyms {
+		if synonym == pathBase && operations[original] {
+			return true
+		}
+	}
+	return false
+}
+
 func (this *HttpAPI) registerSingleAPIRequest(m *martini.ClassicMartini, path string, handler martini.Handler, allowProxy bool) {
 	registeredPaths = append(registeredPaths, path)
 	fullPath := fmt.Sprintf("%s/api/%s", this.URLPrefix, path)
 
+	handlers := []martini.Handler{apiMetricsRecorder(path)}
 	if allowProxy && config.Config.RaftEnabled {
-		m.Get(fullPath, raftReverseProxy, handler)
-	} else {
-		m.Get(fullPath, handler)
+		handlers = append(handlers, raftReverseProxy)
+	}
+	handlers = append(handlers, apiTokenCheck(path), namespaceCheck)
+	if isDrainedPath(path) {
+		handlers = append(handlers, trackInFlightOperation)
+	}
+	if isClusterLockedPath(path) {
+		handlers = append(handlers, clusterLockCheck)
+	}
+	if isCacheablePath(path) {
+		handlers = append(handlers, conditionalGet)
+	}
+	handlers = append(handlers, handler)
+	m.Get(fullPath, handlers...)
+}
+
+// registerSinglePostAPIRequest registers a POST request, for API calls that require a request body
+func (this *HttpAPI) registerSinglePostAPIRequest(m *martini.ClassicMartini, path string, handler martini.Handler) {
+	registeredPaths = append(registeredPaths, path)
+	fullPath := fmt.Sprintf("%s/api/%s", this.URLPrefix, path)
+
+	handlers := []martini.Handler{apiMetricsRecorder(path)}
+	if config.Config.RaftEnabled {
+		handlers = append(handlers, raftReverseProxy)
+	}
+	handlers = append(handlers, apiTokenCheck(path), namespaceCheck)
+	if isDrainedPath(path) {
+		handlers = append(handlers, trackInFlightOperation)
 	}
+	handlers = append(handlers, handler)
+	m.Post(fullPath, handlers...)
 }
 
 func (this *HttpAPI) registerAPIRequestInternal(m *martini.ClassicMartini, path string, handler martini.Handler, allowProxy bool) {
@@ -3276,13 +6371,18 @@ func (this *HttpAPI) RegisterRequests(m *martini.ClassicMartini) {
 	this.registerAPIRequest(m, "repoint/:host/:port/:belowHost/:belowPort", this.Repoint)
 	this.registerAPIRequest(m, "repoint-slaves/:host/:port", this.RepointReplicas)
 	this.registerAPIRequest(m, "make-co-master/:host/:port", this.MakeCoMaster)
+	this.registerAPIRequest(m, "break-co-master/:host/:port", this.BreakCoMaster)
 	this.registerAPIRequest(m, "enslave-siblings/:host/:port", this.TakeSiblings)
 	this.registerAPIRequest(m, "enslave-master/:host/:port", this.TakeMaster)
 	this.registerAPIRequest(m, "master-equivalent/:host/:port/:logFile/:logPos", this.MasterEquivalent)
+	this.registerAPIRequest(m, "binlog-coordinates-at/:host/:port/:time", this.BinlogCoordinatesAt)
 
 	// Binlog server relocation:
 	this.registerAPIRequest(m, "regroup-slaves-bls/:host/:port", this.RegroupReplicasBinlogServers)
 
+	// Batch operations:
+	this.registerSinglePostAPIRequest(m, "batch", this.Batch)
+
 	// GTID relocation:
 	this.registerAPIRequest(m, "move-below-gtid/:host/:port/:belowHost/:belowPort", this.MoveBelowGTID)
 	this.registerAPIRequest(m, "move-slaves-gtid/:host/:port/:belowHost/:belowPort", this.MoveReplicasGTID)
@@ -3294,6 +6394,9 @@ func (this *HttpAPI) RegisterRequests(m *martini.ClassicMartini) {
 	this.registerAPIRequest(m, "match-up/:host/:port", this.MatchUp)
 	this.registerAPIRequest(m, "match-slaves/:host/:port/:belowHost/:belowPort", this.MultiMatchReplicas)
 	this.registerAPIRequest(m, "match-up-slaves/:host/:port", this.MatchUpReplicas)
+	this.registerAPIRequest(m, "job/:jobId", this.AsyncJob)
+	this.registerAPIRequest(m, "jobs", this.AsyncJobs)
+	this.registerAPIRequest(m, "cancel-job/:jobId", this.CancelAsyncJob)
 	this.registerAPIRequest(m, "regroup-slaves-pgtid/:host/:port", this.RegroupReplicasPseudoGTID)
 	// Legacy, need to revisit:
 	this.registerAPIRequest(m, "make-master/:host/:port", this.MakeMaster)
@@ -3303,10 +6406,15 @@ func (this *HttpAPI) RegisterRequests(m *martini.ClassicMartini) {
 	this.registerAPIRequest(m, "enable-gtid/:host/:port", this.EnableGTID)
 	this.registerAPIRequest(m, "disable-gtid/:host/:port", this.DisableGTID)
 	this.registerAPIRequest(m, "skip-query/:host/:port", this.SkipQuery)
+	this.registerAPIRequest(m, "repair-replication-corruption/:host/:port", this.RepairReplicationCorruption)
 	this.registerAPIRequest(m, "start-slave/:host/:port", this.StartSlave)
 	this.registerAPIRequest(m, "restart-slave/:host/:port", this.RestartSlave)
 	this.registerAPIRequest(m, "stop-slave/:host/:port", this.StopSlave)
 	this.registerAPIRequest(m, "stop-slave-nice/:host/:port", this.StopSlaveNicely)
+	this.registerAPIRequest(m, "start-slave-thread/:host/:port/:thread", this.StartSlaveThread)
+	this.registerAPIRequest(m, "stop-slave-thread/:host/:port/:thread", this.StopSlaveThread)
+	this.registerAPIRequest(m, "start-replicas-thread/:clusterHint/:thread", this.StartClusterReplicasThread)
+	this.registerAPIRequest(m, "stop-replicas-thread/:clusterHint/:thread", this.StopClusterReplicasThread)
 	this.registerAPIRequest(m, "reset-slave/:host/:port", this.ResetSlave)
 	this.registerAPIRequest(m, "detach-slave/:host/:port", this.DetachReplica)
 	this.registerAPIRequest(m, "reattach-slave/:host/:port", this.ReattachReplica)
@@ -3318,6 +6426,13 @@ func (this *HttpAPI) RegisterRequests(m *martini.ClassicMartini) {
 	this.registerAPIRequest(m, "disable-semi-sync-master/:host/:port", this.DisableSemiSyncMaster)
 	this.registerAPIRequest(m, "enable-semi-sync-replica/:host/:port", this.EnableSemiSyncReplica)
 	this.registerAPIRequest(m, "disable-semi-sync-replica/:host/:port", this.DisableSemiSyncReplica)
+	this.registerAPIRequest(m, "set-sql-delay/:host/:port/:delay", this.SetSQLDelay)
+	this.registerAPIRequest(m, "tag-delayed-replica/:host/:port", this.TagDelayedReplica)
+	this.registerAPIRequest(m, "untag-delayed-replica/:host/:port", this.UntagDelayedReplica)
+	this.registerAPIRequest(m, "suspend-sql-delay/:host/:port", this.SuspendSQLDelay)
+	this.registerAPIRequest(m, "suspend-sql-delay/:host/:port/:duration", this.SuspendSQLDelay)
+	this.registerAPIRequest(m, "resume-sql-delay/:host/:port", this.ResumeSQLDelay)
+	this.registerAPIRequest(m, "delayed-replicas/:clusterHint", this.DelayedReplicas)
 
 	// Replication information:
 	this.registerAPIRequest(m, "can-replicate-from/:host/:port/:belowHost/:belowPort", this.CanReplicateFrom)
@@ -3325,7 +6440,25 @@ func (this *HttpAPI) RegisterRequests(m *martini.ClassicMartini) {
 	// Instance:
 	this.registerAPIRequest(m, "set-read-only/:host/:port", this.SetReadOnly)
 	this.registerAPIRequest(m, "set-writeable/:host/:port", this.SetWriteable)
+	this.registerAPIRequest(m, "writable-instances/:clusterHint", this.WritableInstances)
+	this.registerAPIRequest(m, "resolve-dual-writable/:host/:port", this.ResolveDualWritable)
 	this.registerAPIRequest(m, "kill-query/:host/:port/:process", this.KillQuery)
+	this.registerAPIRequest(m, "set-instance-flag/:host/:port/:flag", this.SetInstanceFlag)
+	this.registerAPIRequest(m, "clear-instance-flag/:host/:port/:flag", this.ClearInstanceFlag)
+	this.registerAPIRequest(m, "instance-flags", this.InstanceFlags)
+	this.registerAPIRequest(m, "instance-flags/:host/:port", this.InstanceFlags)
+	this.registerAPIRequest(m, "set-instance-note/:host/:port", this.SetInstanceNote)
+	this.registerAPIRequest(m, "clear-instance-note/:host/:port", this.ClearInstanceNote)
+	this.registerAPIRequest(m, "instance-note/:host/:port", this.InstanceNote)
+	this.registerAPIRequest(m, "instance-notes/:clusterHint", this.InstanceNotes)
+	this.registerAPIRequest(m, "set-cluster-note/:clusterHint", this.SetClusterNote)
+	this.registerAPIRequest(m, "clear-cluster-note/:clusterHint", this.ClearClusterNote)
+	this.registerAPIRequest(m, "cluster-note/:clusterHint", this.ClusterNote)
+	this.registerAPIRequest(m, "scheduled-reverts", this.ScheduledReverts)
+	this.registerAPIRequest(m, "cancel-scheduled-revert/:uid", this.CancelScheduledRevert)
+	this.registerAPIRequest(m, "decommission-instance/:host/:port", this.DecommissionInstance)
+	this.registerAPIRequest(m, "cancel-decommission/:host/:port", this.CancelDecommission)
+	this.registerAPIRequest(m, "decommissions", this.Decommissions)
 
 	// Binary logs:
 	this.registerAPIRequest(m, "last-pseudo-gtid/:host/:port", this.LastPseudoGTID)
@@ -3338,6 +6471,11 @@ func (this *HttpAPI) RegisterRequests(m *martini.ClassicMartini) {
 	this.registerAPIRequest(m, "heuristic-cluster-pool-instances/:clusterName/:pool", this.GetHeuristicClusterPoolInstances)
 	this.registerAPIRequest(m, "heuristic-cluster-pool-lag/:clusterName", this.GetHeuristicClusterPoolInstancesLag)
 	this.registerAPIRequest(m, "heuristic-cluster-pool-lag/:clusterName/:pool", this.GetHeuristicClusterPoolInstancesLag)
+	this.registerAPIRequest(m, "pool-specs", this.PoolSpecs)
+	this.registerAPIRequest(m, "pool-specs/:clusterHint", this.PoolSpecs)
+	this.registerAPIRequest(m, "set-pool-spec/:clusterHint/:pool/:desiredSize", this.SetPoolSpec)
+	this.registerAPIRequest(m, "clear-pool-spec/:clusterHint/:pool", this.ClearPoolSpec)
+	this.registerAPIRequest(m, "manage-pool/:clusterHint/:pool", this.ManagePool)
 
 	// Information:
 	this.registerAPIRequest(m, "search/:searchString", this.Search)
@@ -3347,10 +6485,54 @@ func (this *HttpAPI) RegisterRequests(m *martini.ClassicMartini) {
 	this.registerAPIRequest(m, "cluster/:clusterHint", this.Cluster)
 	this.registerAPIRequest(m, "cluster/alias/:clusterAlias", this.ClusterByAlias)
 	this.registerAPIRequest(m, "cluster/instance/:host/:port", this.ClusterByInstance)
+	this.registerAPIRequest(m, "grouping-dimensions/:clusterHint", this.GroupingDimensions)
 	this.registerAPIRequest(m, "cluster-info/:clusterHint", this.ClusterInfo)
 	this.registerAPIRequest(m, "cluster-info/alias/:clusterAlias", this.ClusterInfoByAlias)
+	this.registerAPIRequest(m, "compare-clusters/:clusterHint/:host/:port", this.CompareClusters)
 	this.registerAPIRequest(m, "cluster-osc-slaves/:clusterHint", this.ClusterOSCReplicas)
 	this.registerAPIRequest(m, "set-cluster-alias/:clusterName", this.SetClusterAliasManualOverride)
+	this.registerAPIRequest(m, "topology-conformance/:clusterHint", this.TopologyConformance)
+	this.registerAPIRequest(m, "set-desired-topology/:clusterHint/:desiredTopology", this.SetDesiredTopology)
+	this.registerAPIRequest(m, "clear-desired-topology/:clusterHint", this.ClearDesiredTopology)
+	this.registerAPIRequest(m, "converge-topology/:clusterHint", this.ConvergeTopology)
+	this.registerAPIRequest(m, "master-fan-out/:clusterHint", this.MasterFanOut)
+	this.registerAPIRequest(m, "reduce-master-fan-out/:clusterHint", this.ReduceMasterFanOut)
+	this.registerAPIRequest(m, "read-only-drift/:clusterHint", this.ReadOnlyDrift)
+	this.registerAPIRequest(m, "enforce-read-only/:clusterHint", this.EnforceReadOnly)
+	this.registerAPIRequest(m, "unreconciled-replicas", this.UnreconciledReplicas)
+	this.registerAPIRequest(m, "unreconciled-replicas/:clusterHint", this.UnreconciledReplicas)
+	this.registerAPIRequest(m, "discover-unreconciled-replicas/:clusterHint", this.DiscoverUnreconciledReplicas)
+	this.registerAPIRequest(m, "gtid-migration/:clusterHint", this.GTIDMigration)
+	this.registerAPIRequest(m, "advance-gtid-migration/:clusterHint", this.AdvanceGTIDMigration)
+	this.registerAPIRequest(m, "circular-replication/:clusterHint", this.CircularReplication)
+	this.registerAPIRequest(m, "detection-thresholds", this.DetectionThresholds)
+	this.registerAPIRequest(m, "detection-thresholds/:clusterHint", this.DetectionThresholds)
+	this.registerAPIRequest(m, "lag-slo/:clusterHint", this.LagSLO)
+	this.registerAPIRequest(m, "lag-slos", this.LagSLOs)
+	this.registerAPIRequest(m, "analysis-history/:clusterHint", this.AnalysisHistory)
+	this.registerAPIRequest(m, "promotion-candidate/:clusterHint", this.PromotionCandidate)
+	this.registerAPIRequest(m, "promotion-candidates", this.PromotionCandidates)
+	this.registerAPIRequest(m, "promotion-strategy/:clusterHint", this.PromotionStrategy)
+	this.registerAPIRequest(m, "promotion-strategies", this.PromotionStrategies)
+	this.registerAPIRequest(m, "lock-cluster/:clusterHint/:reason", this.LockCluster)
+	this.registerAPIRequest(m, "lock-cluster/:clusterHint/:reason/:duration", this.LockCluster)
+	this.registerAPIRequest(m, "unlock-cluster/:clusterHint", this.UnlockCluster)
+	this.registerAPIRequest(m, "cluster-locks", this.ClusterLocks)
+	this.registerAPIRequest(m, "pause-discovery/:clusterHint", this.PauseDiscovery)
+	this.registerAPIRequest(m, "pause-discovery/:clusterHint/:duration", this.PauseDiscovery)
+	this.registerAPIRequest(m, "resume-discovery/:clusterHint", this.ResumeDiscovery)
+	this.registerAPIRequest(m, "discovery-pauses", this.DiscoveryPauses)
+	this.registerAPIRequest(m, "pin-master/:host/:port", this.PinMaster)
+	this.registerAPIRequest(m, "unpin-master/:clusterHint", this.UnpinMaster)
+	this.registerAPIRequest(m, "pinned-masters", this.PinnedMasters)
+	this.registerAPIRequest(m, "register-schema-migration/:clusterHint/:migrationId", this.RegisterSchemaMigration)
+	this.registerAPIRequest(m, "register-schema-migration/:clusterHint/:migrationId/:duration", this.RegisterSchemaMigration)
+	this.registerAPIRequest(m, "unregister-schema-migration/:clusterHint/:migrationId", this.UnregisterSchemaMigration)
+	this.registerAPIRequest(m, "schema-migrations", this.SchemaMigrations)
+	this.registerAPIRequest(m, "schema-migrations/:clusterHint", this.SchemaMigrations)
+	this.registerAPIRequest(m, "create-api-token", this.CreateAPIToken)
+	this.registerAPIRequest(m, "revoke-api-token/:tokenId", this.RevokeAPIToken)
+	this.registerAPIRequest(m, "api-tokens", this.APITokens)
 	this.registerAPIRequest(m, "clusters", this.Clusters)
 	this.registerAPIRequest(m, "clusters-info", this.ClustersInfo)
 
@@ -3367,7 +6549,10 @@ func (this *HttpAPI) RegisterRequests(m *martini.ClassicMartini) {
 
 	// Key-value:
 	this.registerAPIRequest(m, "submit-masters-to-kv-stores", this.SubmitMastersToKvStores)
+	this.registerAPIRequest(m, "service-records", this.ServiceRecords)
+	this.registerAPIRequest(m, "reconcile-service-records", this.ReconcileServiceRecords)
 	this.registerAPIRequest(m, "submit-masters-to-kv-stores/:clusterHint", this.SubmitMastersToKvStores)
+	this.registerAPIRequest(m, "cutover-token/:clusterHint", this.CutoverToken)
 
 	// Instance management:
 	this.registerAPIRequest(m, "instance/:host/:port", this.Instance)
@@ -3399,7 +6584,13 @@ func (this *HttpAPI) RegisterRequests(m *martini.ClassicMartini) {
 	this.registerAPIRequest(m, "graceful-master-takeover/:clusterHint/:designatedHost/:designatedPort", this.GracefulMasterTakeover)
 	this.registerAPIRequest(m, "force-master-failover/:host/:port", this.ForceMasterFailover)
 	this.registerAPIRequest(m, "force-master-failover/:clusterHint", this.ForceMasterFailover)
+	this.registerAPIRequest(m, "recover-backend", this.RecoverBackend)
+	this.registerAPIRequest(m, "recover-backend/:candidateHost/:candidatePort", this.RecoverBackend)
+	this.registerAPIRequest(m, "self-cluster", this.SelfCluster)
 	this.registerAPIRequest(m, "register-candidate/:host/:port/:promotionRule", this.RegisterCandidate)
+	this.registerAPIRequest(m, "override-promotion-rule/:host/:port/:promotionRule/:owner/:reason/:duration", this.OverridePromotionRule)
+	this.registerAPIRequest(m, "clear-promotion-rule-override/:host/:port", this.ClearPromotionRuleOverride)
+	this.registerAPIRequest(m, "promotion-rule-overrides", this.PromotionRuleOverrides)
 	this.registerAPIRequest(m, "automated-recovery-filters", this.AutomatedRecoveryFilters)
 	this.registerAPIRequest(m, "audit-failure-detection", this.AuditFailureDetection)
 	this.registerAPIRequest(m, "audit-failure-detection/:page", this.AuditFailureDetection)
@@ -3414,6 +6605,7 @@ func (this *HttpAPI) RegisterRequests(m *martini.ClassicMartini) {
 	this.registerAPIRequest(m, "audit-recovery/cluster/:clusterName/:page", this.AuditRecovery)
 	this.registerAPIRequest(m, "audit-recovery/alias/:clusterAlias", this.AuditRecovery)
 	this.registerAPIRequest(m, "audit-recovery-steps/:uid", this.AuditRecoverySteps)
+	this.registerAPIRequest(m, "recovery-bundle/:id", this.RecoveryBundle)
 	this.registerAPIRequest(m, "active-cluster-recovery/:clusterName", this.ActiveClusterRecovery)
 	this.registerAPIRequest(m, "recently-active-cluster-recovery/:clusterName", this.RecentlyActiveClusterRecovery)
 	this.registerAPIRequest(m, "recently-active-instance-recovery/:host/:port", this.RecentlyActiveInstanceRecovery)
@@ -3425,13 +6617,30 @@ func (this *HttpAPI) RegisterRequests(m *martini.ClassicMartini) {
 	this.registerAPIRequest(m, "ack-all-recoveries", this.AcknowledgeAllRecoveries)
 	this.registerAPIRequest(m, "blocked-recoveries", this.BlockedRecoveries)
 	this.registerAPIRequest(m, "blocked-recoveries/cluster/:clusterName", this.BlockedRecoveries)
+	this.registerAPIRequest(m, "recovery-blocks", this.RecoveryBlocks)
+	this.registerAPIRequest(m, "recovery-blocks/:clusterHint", this.RecoveryBlocks)
+	this.registerAPIRequest(m, "clear-recovery-block/:clusterHint", this.ClearRecoveryBlock)
+	this.registerAPIRequest(m, "extend-recovery-block/:clusterHint/:duration", this.ExtendRecoveryBlock)
+	this.registerAPIRequest(m, "recovery-approvals", this.RecoveryApprovals)
+	this.registerAPIRequest(m, "recovery-approvals/:clusterHint", this.RecoveryApprovals)
+	this.registerAPIRequest(m, "approve-recovery/:host/:port", this.ApproveRecovery)
+	this.registerAPIRequest(m, "reject-recovery/:host/:port", this.RejectRecovery)
+	this.registerAPIRequest(m, "recovery-stats/:clusterHint", this.RecoveryStats)
+	this.registerAPIRequest(m, "external-health-checks", this.ExternalHealthChecks)
+	this.registerAPIRequest(m, "external-health-checks/:host/:port", this.ExternalHealthChecks)
 	this.registerAPIRequest(m, "disable-global-recoveries", this.DisableGlobalRecoveries)
 	this.registerAPIRequest(m, "enable-global-recoveries", this.EnableGlobalRecoveries)
 	this.registerAPIRequest(m, "check-global-recoveries", this.CheckGlobalRecoveries)
+	this.registerAPIRequest(m, "export-state", this.ExportState)
+	this.registerSinglePostAPIRequest(m, "import-state", this.ImportState)
 
 	// General
 	this.registerAPIRequest(m, "problems", this.Problems)
 	this.registerAPIRequest(m, "problems/:clusterName", this.Problems)
+	this.registerAPIRequestNoProxy(m, "federation/clusters-info", this.FederationClustersInfo)
+	this.registerAPIRequestNoProxy(m, "federation/problems", this.FederationProblems)
+	this.registerAPIRequestNoProxy(m, "federation/cluster/:clusterHint", this.FederationCluster)
+	this.registerAPIRequestNoProxy(m, "federation/proxy/:deployment/**", this.FederationProxy)
 	this.registerAPIRequest(m, "long-queries", this.LongQueries)
 	this.registerAPIRequest(m, "long-queries/:filter", this.LongQueries)
 	this.registerAPIRequest(m, "audit", this.Audit)
@@ -3447,6 +6656,7 @@ func (this *HttpAPI) RegisterRequests(m *martini.ClassicMartini) {
 	this.registerAPIRequestNoProxy(m, "_ping", this.LBCheck)
 	this.registerAPIRequestNoProxy(m, "leader-check", this.LeaderCheck)
 	this.registerAPIRequestNoProxy(m, "leader-check/:errorStatusCode", this.LeaderCheck)
+	this.registerAPIRequestNoProxy(m, "leader-lease", this.LeaderLease)
 	this.registerAPIRequestNoProxy(m, "grab-election", this.GrabElection)
 	this.registerAPIRequestNoProxy(m, "raft-yield/:node", this.RaftYield)
 	this.registerAPIRequestNoProxy(m, "raft-yield-hint/:hint", this.RaftYieldHint)
@@ -3455,10 +6665,17 @@ func (this *HttpAPI) RegisterRequests(m *martini.ClassicMartini) {
 	this.registerAPIRequestNoProxy(m, "raft-leader", this.RaftLeader)
 	this.registerAPIRequestNoProxy(m, "raft-health", this.RaftHealth)
 	this.registerAPIRequestNoProxy(m, "raft-snapshot", this.RaftSnapshot)
+	this.registerAPIRequestNoProxy(m, "raft-metrics", this.RaftMetrics)
 	this.registerAPIRequestNoProxy(m, "raft-follower-health-report/:authenticationToken/:raftBind/:raftAdvertise", this.RaftFollowerHealthReport)
+	this.registerSinglePostAPIRequest(m, "raft-probe-outcomes/:authenticationToken", this.RaftProbeOutcomes)
 	this.registerAPIRequestNoProxy(m, "reload-configuration", this.ReloadConfiguration)
 	this.registerAPIRequestNoProxy(m, "hostname-resolve-cache", this.HostnameResolveCache)
 	this.registerAPIRequestNoProxy(m, "reset-hostname-resolve-cache", this.ResetHostnameResolveCache)
+	this.registerAPIRequestNoProxy(m, "hostname-resolve-cache-stats", this.HostnameResolveCacheStats)
+	this.registerAPIRequest(m, "invalidate-hostname-resolve-cache/:pattern", this.InvalidateHostnameResolveCache)
+	this.registerAPIRequest(m, "hostname-resolve-seeds", this.HostnameResolveSeeds)
+	this.registerAPIRequest(m, "seed-hostname-resolve/:hostname/:resolvedHostname", this.SeedHostnameResolve)
+	this.registerAPIRequest(m, "unseed-hostname-resolve/:hostname", this.UnseedHostnameResolve)
 	// Meta
 	this.registerAPIRequest(m, "reelect", this.Reelect)
 	this.registerAPIRequest(m, "reload-cluster-alias", this.ReloadClusterAlias)
@@ -3469,13 +6686,27 @@ func (this *HttpAPI) RegisterRequests(m *martini.ClassicMartini) {
 	this.registerAPIRequest(m, "bulk-instances", this.BulkInstances)
 	this.registerAPIRequest(m, "bulk-promotion-rules", this.BulkPromotionRules)
 
+	// State events
+	this.registerAPIRequest(m, "subscribe-state-events/:name", this.SubscribeStateEvents)
+	this.registerAPIRequest(m, "unsubscribe-state-events/:name", this.UnsubscribeStateEvents)
+	this.registerAPIRequest(m, "state-event-subscriptions", this.StateEventSubscriptions)
+
 	// Monitoring
 	this.registerAPIRequest(m, "discovery-metrics-raw/:seconds", this.DiscoveryMetricsRaw)
 	this.registerAPIRequest(m, "discovery-metrics-aggregated/:seconds", this.DiscoveryMetricsAggregated)
+	this.registerAPIRequest(m, "discovery-outliers", this.DiscoveryOutliers)
+	this.registerAPIRequestNoProxy(m, "discovery-backpressure", this.DiscoveryBackpressure)
+	this.registerAPIRequestNoProxy(m, "discovery-auto-tuning", this.DiscoveryAutoTuning)
+	this.registerAPIRequest(m, "topology-privileges", this.TopologyPrivileges)
+	this.registerAPIRequest(m, "check-topology-privileges/:host/:port", this.CheckTopologyPrivileges)
+	this.registerAPIRequest(m, "onboard-cluster/:host/:port", this.OnboardCluster)
 	this.registerAPIRequest(m, "discovery-queue-metrics-raw/:seconds", this.DiscoveryQueueMetricsRaw)
 	this.registerAPIRequest(m, "discovery-queue-metrics-aggregated/:seconds", this.DiscoveryQueueMetricsAggregated)
 	this.registerAPIRequest(m, "backend-query-metrics-raw/:seconds", this.BackendQueryMetricsRaw)
 	this.registerAPIRequest(m, "backend-query-metrics-aggregated/:seconds", this.BackendQueryMetricsAggregated)
+	this.registerAPIRequestNoProxy(m, "api-metrics", this.APIMetrics)
+	this.registerAPIRequestNoProxy(m, "api-metrics/:seconds", this.APIMetrics)
+	this.registerAPIRequestNoProxy(m, "api-metrics-prometheus", this.APIMetricsPrometheus)
 
 	// Agents
 	this.registerAPIRequest(m, "agents", this.Agents)
@@ -3487,13 +6718,34 @@ func (this *HttpAPI) RegisterRequests(m *martini.ClassicMartini) {
 	this.registerAPIRequest(m, "agent-mysql-stop/:host", this.AgentMySQLStop)
 	this.registerAPIRequest(m, "agent-mysql-start/:host", this.AgentMySQLStart)
 	this.registerAPIRequest(m, "agent-seed/:targetHost/:sourceHost", this.AgentSeed)
+	this.registerAPIRequest(m, "agent-seed/:targetHost", this.AgentSeed)
+	this.registerAPIRequest(m, "agent-seed-donor/:targetHost", this.AgentSeedDonor)
 	this.registerAPIRequest(m, "agent-active-seeds/:host", this.AgentActiveSeeds)
 	this.registerAPIRequest(m, "agent-recent-seeds/:host", this.AgentRecentSeeds)
 	this.registerAPIRequest(m, "agent-seed-details/:seedId", this.AgentSeedDetails)
 	this.registerAPIRequest(m, "agent-seed-states/:seedId", this.AgentSeedStates)
 	this.registerAPIRequest(m, "agent-abort-seed/:seedId", this.AbortSeed)
+	this.registerAPIRequest(m, "agent-seed-progress/:seedId", this.AgentSeedProgress)
+	this.registerAPIRequest(m, "agent-seed-progress-stream/:seedId", this.AgentSeedProgressStream)
+	this.registerAPIRequest(m, "agent-pause-seed/:seedId", this.AgentPauseSeed)
+	this.registerAPIRequest(m, "agent-resume-seed/:seedId", this.AgentResumeSeed)
 	this.registerAPIRequest(m, "agent-custom-command/:host/:command", this.AgentCustomCommand)
+	this.registerAPIRequest(m, "error-log-events/:host/:port", this.ErrorLogEvents)
+	this.registerAPIRequest(m, "agent-enrollment-token/:host", this.AgentEnrollmentToken)
+	this.registerAPIRequest(m, "agent-certificates", this.AgentCertificates)
+	this.registerAPIRequest(m, "agent-certificates/:host", this.AgentCertificates)
+	this.registerAPIRequest(m, "agent-revoke-certificate/:host", this.RevokeAgentCertificate)
+	this.registerAPIRequest(m, "agent-revoke-certificate/:host/:serialNumber", this.RevokeAgentCertificate)
 	this.registerAPIRequest(m, "seeds", this.Seeds)
+	this.registerAPIRequest(m, "backup-policies", this.BackupPolicies)
+	this.registerAPIRequest(m, "backup-policies/:clusterHint", this.BackupPolicies)
+	this.registerAPIRequest(m, "set-backup-policy/:clusterHint/:method/:frequencyMinutes", this.SetBackupPolicy)
+	this.registerAPIRequest(m, "clear-backup-policy/:clusterHint", this.ClearBackupPolicy)
+	this.registerAPIRequest(m, "backup-cluster/:clusterHint", this.BackupCluster)
+	this.registerAPIRequest(m, "backups", this.Backups)
+	this.registerAPIRequest(m, "backups/:clusterHint", this.Backups)
+	this.registerAPIRequest(m, "latest-backups", this.LatestBackups)
+	this.registerAPIRequest(m, "latest-backups/:clusterHint", this.LatestBackups)
 
 	// Configurable status check endpoint
 	m.Get(config.Config.StatusEndpoint, this.StatusCheck)
@@ -0,0 +1,108 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package http
+
+import (
+	"net/http"
+
+	"github.com/martini-contrib/render"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/logic"
+	"github.com/github/orchestrator/go/process"
+	"github.com/github/orchestrator/go/raft"
+)
+
+// APIErrorCode is a stable, machine readable reason for an API error. Clients may branch on it,
+// whereas the accompanying message is meant for humans and may change.
+type APIErrorCode string
+
+const (
+	ErrInternal             APIErrorCode = "ERR_INTERNAL"
+	ErrUnauthorized         APIErrorCode = "ERR_UNAUTHORIZED"
+	ErrReadOnly             APIErrorCode = "ERR_READ_ONLY"
+	ErrNotLeader            APIErrorCode = "ERR_NOT_LEADER"
+	ErrShuttingDown         APIErrorCode = "ERR_SHUTTING_DOWN"
+	ErrInvalidInstanceKey   APIErrorCode = "ERR_INVALID_INSTANCE_KEY"
+	ErrInstanceNotFound     APIErrorCode = "ERR_INSTANCE_NOT_FOUND"
+	ErrClusterNotFound      APIErrorCode = "ERR_CLUSTER_NOT_FOUND"
+	ErrClusterLocked        APIErrorCode = "ERR_CLUSTER_LOCKED"
+	ErrRecoveryDisabled     APIErrorCode = "ERR_RECOVERY_DISABLED"
+	ErrRecoveryBlocked      APIErrorCode = "ERR_RECOVERY_BLOCKED"
+	ErrNoRecoverableProblem APIErrorCode = "ERR_NO_RECOVERABLE_PROBLEM"
+	ErrRecoveryInFlight     APIErrorCode = "ERR_RECOVERY_IN_FLIGHT"
+)
+
+// apiErrorHttpStatus aligns error codes with HTTP statuses
+var apiErrorHttpStatus = map[APIErrorCode]int{
+	ErrInternal:             http.StatusInternalServerError,
+	ErrUnauthorized:         http.StatusForbidden,
+	ErrReadOnly:             http.StatusForbidden,
+	ErrNotLeader:            http.StatusServiceUnavailable,
+	ErrShuttingDown:         http.StatusServiceUnavailable,
+	ErrInvalidInstanceKey:   http.StatusBadRequest,
+	ErrInstanceNotFound:     http.StatusNotFound,
+	ErrClusterNotFound:      http.StatusNotFound,
+	ErrClusterLocked:        http.StatusLocked,
+	ErrRecoveryDisabled:     http.StatusConflict,
+	ErrRecoveryBlocked:      http.StatusConflict,
+	ErrNoRecoverableProblem: http.StatusConflict,
+	ErrRecoveryInFlight:     http.StatusConflict,
+}
+
+// HttpStatus returns the respective HTTP status for this error code
+func (this APIErrorCode) HttpStatus() int {
+	if status, ok := apiErrorHttpStatus[this]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// unauthorizedErrorCode tells why a write action is not authorized, following the checks
+// made by isAuthorizedForAction
+func unauthorizedErrorCode() APIErrorCode {
+	switch {
+	case config.Config.ReadOnly:
+		return ErrReadOnly
+	case orcraft.IsRaftEnabled() && !orcraft.IsLeader():
+		return ErrNotLeader
+	case process.IsShuttingDown():
+		return ErrShuttingDown
+	}
+	return ErrUnauthorized
+}
+
+// respondUnauthorized responds to a write action which isAuthorizedForAction rejected
+func respondUnauthorized(r render.Render) {
+	errorCode := unauthorizedErrorCode()
+	message := "Unauthorized"
+	if errorCode == ErrShuttingDown {
+		message = "Application node is shutting down, and takes on no new operations"
+	}
+	Respond(r, &APIResponse{Code: ERROR, ErrorCode: errorCode, Message: message})
+}
+
+// recoveryNotAttemptedErrorCode tells why an explicitly requested recovery was not attempted
+func recoveryNotAttemptedErrorCode(clusterName string) APIErrorCode {
+	if disabled, err := logic.IsRecoveryDisabled(); err == nil && disabled {
+		return ErrRecoveryDisabled
+	}
+	if recoveries, err := logic.ReadRecentlyActiveClusterRecovery(clusterName); err == nil && len(recoveries) > 0 {
+		return ErrRecoveryBlocked
+	}
+	return ErrNoRecoverableProblem
+}
@@ -0,0 +1,141 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-martini/martini"
+	"github.com/openark/golib/log"
+	"github.com/rcrowley/go-metrics"
+
+	"github.com/github/orchestrator/go/collection"
+	"github.com/github/orchestrator/go/config"
+	apimetrics "github.com/github/orchestrator/go/metrics/api"
+)
+
+var apiMetrics = collection.CreateOrReturnCollection("API_METRICS")
+
+// apiRouteCounters are the cumulative metrics of a single API route, since startup
+type apiRouteCounters struct {
+	requests metrics.Counter
+	errors   metrics.Counter
+	latency  metrics.Timer
+}
+
+var apiRoutesCounters = make(map[string]*apiRouteCounters)
+var apiRoutesCountersMutex sync.Mutex
+
+// getAPIRouteCounters returns the cumulative metrics of given route, creating them as needed
+func getAPIRouteCounters(route string) *apiRouteCounters {
+	apiRoutesCountersMutex.Lock()
+	defer apiRoutesCountersMutex.Unlock()
+
+	counters, found := apiRoutesCounters[route]
+	if !found {
+		counters = &apiRouteCounters{
+			requests: metrics.NewCounter(),
+			errors:   metrics.NewCounter(),
+			latency:  metrics.NewTimer(),
+		}
+		apiRoutesCounters[route] = counters
+	}
+	return counters
+}
+
+// apiMetricsRecorder records the count, latency and status of requests to given API path, and logs requests
+// slower than SlowAPIRequestThresholdMilliseconds
+func apiMetricsRecorder(path string) martini.Handler {
+	return func(c martini.Context, params martini.Params, resp http.ResponseWriter, req *http.Request) {
+		startTime := time.Now()
+		c.Next()
+
+		metric := &apimetrics.Metric{
+			Timestamp:  startTime,
+			Route:      path,
+			Method:     req.Method,
+			StatusCode: http.StatusOK,
+			Latency:    time.Since(startTime),
+		}
+		if rw, ok := resp.(martini.ResponseWriter); ok && rw.Status() != 0 {
+			metric.StatusCode = rw.Status()
+		}
+		apiMetrics.Append(metric)
+
+		counters := getAPIRouteCounters(path)
+		counters.requests.Inc(1)
+		if metric.IsError() {
+			counters.errors.Inc(1)
+		}
+		counters.latency.Update(metric.Latency)
+
+		threshold := time.Duration(config.Config.SlowAPIRequestThresholdMilliseconds) * time.Millisecond
+		if threshold > 0 && metric.Latency > threshold {
+			log.Warningf("Slow API request: %s %s took %+v (status %d); params: %+v; query: %s", req.Method, path, metric.Latency, metric.StatusCode, params, req.URL.RawQuery)
+		}
+	}
+}
+
+// prometheusEscape escapes a label value in the Prometheus text exposition format
+func prometheusEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// writeAPIMetricsPrometheus writes the cumulative API metrics, per route, in the Prometheus text exposition format
+func writeAPIMetricsPrometheus(resp http.ResponseWriter) {
+	apiRoutesCountersMutex.Lock()
+	routes := []string{}
+	for route := range apiRoutesCounters {
+		routes = append(routes, route)
+	}
+	apiRoutesCountersMutex.Unlock()
+	sort.Strings(routes)
+
+	quantiles := []float64{0.5, 0.95, 0.99}
+	requests := []string{}
+	errors := []string{}
+	latencies := []string{}
+	for _, route := range routes {
+		counters := getAPIRouteCounters(route)
+		label := prometheusEscape(route)
+		requests = append(requests, fmt.Sprintf(`orchestrator_api_requests_total{route="%s"} %d`, label, counters.requests.Count()))
+		errors = append(errors, fmt.Sprintf(`orchestrator_api_request_errors_total{route="%s"} %d`, label, counters.errors.Count()))
+
+		latency := counters.latency.Snapshot()
+		for i, value := range latency.Percentiles(quantiles) {
+			latencies = append(latencies, fmt.Sprintf(`orchestrator_api_request_duration_seconds{route="%s",quantile="%g"} %g`, label, quantiles[i], time.Duration(value).Seconds()))
+		}
+		latencies = append(latencies, fmt.Sprintf(`orchestrator_api_request_duration_seconds_sum{route="%s"} %g`, label, time.Duration(latency.Sum()).Seconds()))
+		latencies = append(latencies, fmt.Sprintf(`orchestrator_api_request_duration_seconds_count{route="%s"} %d`, label, latency.Count()))
+	}
+
+	resp.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(resp, "# HELP orchestrator_api_requests_total Number of HTTP API requests, per route.")
+	fmt.Fprintln(resp, "# TYPE orchestrator_api_requests_total counter")
+	fmt.Fprint(resp, strings.Join(append(requests, ""), "\n"))
+	fmt.Fprintln(resp, "# HELP orchestrator_api_request_errors_total Number of HTTP API requests which failed, per route.")
+	fmt.Fprintln(resp, "# TYPE orchestrator_api_request_errors_total counter")
+	fmt.Fprint(resp, strings.Join(append(errors, ""), "\n"))
+	fmt.Fprintln(resp, "# HELP orchestrator_api_request_duration_seconds Latency of HTTP API requests, per route.")
+	fmt.Fprintln(resp, "# TYPE orchestrator_api_request_duration_seconds summary")
+	fmt.Fprint(resp, strings.Join(append(latencies, ""), "\n"))
+}
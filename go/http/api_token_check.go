@@ -0,0 +1,237 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/auth"
+
+	"github.com/github/orchestrator/go/inst"
+	"github.com/github/orchestrator/go/process"
+)
+
+// recoveryOperations are API calls which require the "recover" operation class of an API token.
+// Any other API call which requires write privileges requires the "write" operation class.
+var recoveryOperations = map[string]bool{
+	"recover":                   true,
+	"recover-lite":              true,
+	"graceful-master-takeover":  true,
+	"force-master-failover":     true,
+	"recover-backend":           true,
+	"ack-recovery":              true,
+	"ack-all-recoveries":        true,
+	"approve-recovery":          true,
+	"reject-recovery":           true,
+	"disable-global-recoveries": true,
+	"enable-global-recoveries":  true,
+}
+
+// clusterFilteredPaths are API calls which are not scoped to a cluster, but which filter their response by
+// the clusters the request is authorized for. Any other API call which is not scoped to a cluster is refused
+// to a token restricted to specific clusters.
+var clusterFilteredPaths = map[string]bool{
+	"clusters":                        true,
+	"clusters-info":                   true,
+	"masters":                         true,
+	"all-instances":                   true,
+	"downtimed":                       true,
+	"search":                          true,
+	"search/:searchString":            true,
+	"problems":                        true,
+	"promotion-candidates":            true,
+	"lag-slos":                        true,
+	"topology-privileges":             true,
+	"federation/clusters-info":        true,
+	"federation/problems":             true,
+	"federation/proxy/:deployment/**": true,
+	"replication-analysis":            true,
+	"audit":                           true,
+	"audit/:page":                     true,
+	"long-queries":                    true,
+	"long-queries/:filter":            true,
+	"audit-recovery":                  true,
+	"audit-recovery/:page":            true,
+	"audit-recovery/id/:id":           true,
+	"audit-recovery/uid/:uid":         true,
+	"audit-failure-detection":         true,
+	"audit-failure-detection/:page":   true,
+	"audit-failure-detection/id/:id":  true,
+	"audit-recovery-steps/:uid":       true,
+}
+
+// apiTokenRequest is the state of a request authenticated by an API token
+type apiTokenRequest struct {
+	token          *process.APIToken
+	operationClass string
+	clusterScoped  bool // all clusters the request operates on are known, and within the token's clusters
+}
+
+// apiTokenRequests maps requests authenticated by an API token onto their state, for the lifetime of the request
+var apiTokenRequests sync.Map
+
+// getAPITokenRequest returns the API token state of a request, or nil if the request is not authenticated by an API token
+func getAPITokenRequest(req *http.Request) *apiTokenRequest {
+	if tokenRequest, ok := apiTokenRequests.Load(req); ok {
+		return tokenRequest.(*apiTokenRequest)
+	}
+	return nil
+}
+
+// getBearer returns the bearer of an "Authorization: Bearer" header, if any
+func getBearer(req *http.Request) string {
+	authorization := req.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer "))
+}
+
+func apiTokenUser(token *process.APIToken) auth.User {
+	return auth.User(fmt.Sprintf("token:%s", token.TokenId))
+}
+
+// AuthenticateAPIToken is a middleware authenticating requests which present an API token in an
+// "Authorization: Bearer" header. API tokens are only valid for API calls.
+func AuthenticateAPIToken(req *http.Request, resp http.ResponseWriter, c martini.Context) {
+	bearer := getBearer(req)
+	if bearer == "" {
+		return
+	}
+	if !strings.Contains(req.URL.Path, "/api/") {
+		http.Error(resp, "API tokens are only valid for API calls", http.StatusUnauthorized)
+		return
+	}
+	token, err := process.AuthenticateAPIToken(bearer)
+	if err != nil {
+		resp.Header().Set("WWW-Authenticate", `Bearer realm="orchestrator"`)
+		http.Error(resp, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	apiTokenRequests.Store(req, &apiTokenRequest{token: token, operationClass: process.APITokenOperationWrite})
+	defer apiTokenRequests.Delete(req)
+
+	c.Map(apiTokenUser(token))
+	c.Next()
+}
+
+// UnlessAPIToken wraps an authentication handler such that it does not apply to requests which are
+// authenticated by an API token
+func UnlessAPIToken(handler martini.Handler) martini.Handler {
+	return func(req *http.Request, c martini.Context) {
+		if getAPITokenRequest(req) != nil {
+			return
+		}
+		if _, err := c.Invoke(handler); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// requestClusterNames returns the names of the clusters a request operates on, as identified by its params.
+// known is false when any of the params does not resolve into a cluster.
+func requestClusterNames(params martini.Params) (clusterNames []string, known bool) {
+	known = true
+	addClusterHint := func(clusterHint string) {
+		clusterName, err := figureClusterName(clusterHint)
+		if err != nil || clusterName == "" {
+			known = false
+			return
+		}
+		clusterNames = append(clusterNames, clusterName)
+	}
+	for name, value := range params {
+		switch {
+		case name == "clusterHint", name == "clusterName":
+			addClusterHint(value)
+		case name == "clusterAlias":
+			clusterName, err := inst.GetClusterByAlias(value)
+			if err != nil || clusterName == "" {
+				known = false
+			} else {
+				clusterNames = append(clusterNames, clusterName)
+			}
+		case name == "host":
+			addClusterHint(fmt.Sprintf("%s:%s", value, params["port"]))
+		case strings.HasSuffix(name, "Host"):
+			port, ok := params[strings.TrimSuffix(name, "Host")+"Port"]
+			if !ok {
+				// Not an instance, e.g. an agent host
+				known = false
+				continue
+			}
+			addClusterHint(fmt.Sprintf("%s:%s", value, port))
+		}
+	}
+	return clusterNames, known
+}
+
+// apiTokenCheck returns a handler which rejects requests, authenticated by an API token, that operate
+// on clusters outside the token's clusters. A token restricted to specific clusters may only make calls
+// which are scoped to its clusters, or which filter their response by its clusters.
+func apiTokenCheck(path string) martini.Handler {
+	operationClass := process.APITokenOperationWrite
+	if isOperationPath(path, recoveryOperations) {
+		operationClass = process.APITokenOperationRecover
+	}
+	return func(params martini.Params, req *http.Request, resp http.ResponseWriter) {
+		tokenRequest := getAPITokenRequest(req)
+		if tokenRequest == nil {
+			return
+		}
+		tokenRequest.operationClass = operationClass
+		if tokenRequest.token.AllowsAllClusters() {
+			tokenRequest.clusterScoped = true
+			return
+		}
+		clusterNames, known := requestClusterNames(params)
+		for _, clusterName := range clusterNames {
+			if !isAPITokenAuthorizedForCluster(tokenRequest.token, clusterName) {
+				http.Error(resp, fmt.Sprintf("API token %s is not authorized for cluster %s", tokenRequest.token.TokenId, clusterName), http.StatusForbidden)
+				return
+			}
+		}
+		tokenRequest.clusterScoped = known && len(clusterNames) > 0
+		if !tokenRequest.clusterScoped && !clusterFilteredPaths[path] {
+			http.Error(resp, fmt.Sprintf("API token %s is restricted to specific clusters, and %s is not scoped to a cluster", tokenRequest.token.TokenId, path), http.StatusForbidden)
+			return
+		}
+	}
+}
+
+// isAPITokenAuthorizedForCluster checks whether given cluster is within the token's clusters
+func isAPITokenAuthorizedForCluster(token *process.APIToken, clusterName string) bool {
+	if token.AllowsAllClusters() {
+		return true
+	}
+	clusterInfo, err := inst.ReadClusterInfo(clusterName)
+	if err != nil || clusterInfo == nil {
+		return false
+	}
+	return clusterInfo.MatchesClusterFilters(token.ClusterFilters)
+}
+
+// isAPITokenAuthorizedForAction checks whether a request authenticated by an API token may run a
+// write operation: the token must be granted the operation's class, and the request must be scoped
+// to the token's clusters
+func isAPITokenAuthorizedForAction(tokenRequest *apiTokenRequest) bool {
+	return tokenRequest.token.AllowsOperationClass(tokenRequest.operationClass) && tokenRequest.clusterScoped
+}
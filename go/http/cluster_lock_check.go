@@ -0,0 +1,150 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package http
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/auth"
+	"github.com/martini-contrib/render"
+
+	"github.com/github/orchestrator/go/inst"
+)
+
+// defaultClusterLockDurationSeconds applies to cluster locks taken with no explicit duration
+const defaultClusterLockDurationSeconds = 3600
+
+// clusterLockedOperations are API calls which mutate a topology, and which are rejected on a cluster
+// locked by a different actor
+var clusterLockedOperations = map[string]bool{
+	"relocate":                   true,
+	"relocate-below":             true,
+	"relocate-slaves":            true,
+	"regroup-slaves":             true,
+	"move-up":                    true,
+	"move-up-slaves":             true,
+	"move-below":                 true,
+	"move-equivalent":            true,
+	"repoint":                    true,
+	"repoint-slaves":             true,
+	"make-co-master":             true,
+	"break-co-master":            true,
+	"enslave-siblings":           true,
+	"enslave-master":             true,
+	"master-equivalent":          true,
+	"regroup-slaves-bls":         true,
+	"move-below-gtid":            true,
+	"move-slaves-gtid":           true,
+	"regroup-slaves-gtid":        true,
+	"match":                      true,
+	"match-below":                true,
+	"match-up":                   true,
+	"match-slaves":               true,
+	"match-up-slaves":            true,
+	"regroup-slaves-pgtid":       true,
+	"make-master":                true,
+	"make-local-master":          true,
+	"enable-gtid":                true,
+	"disable-gtid":               true,
+	"skip-query":                 true,
+	"start-slave":                true,
+	"restart-slave":              true,
+	"stop-slave":                 true,
+	"stop-slave-nice":            true,
+	"start-slave-thread":         true,
+	"stop-slave-thread":          true,
+	"start-replicas-thread":      true,
+	"stop-replicas-thread":       true,
+	"reset-slave":                true,
+	"detach-slave":               true,
+	"reattach-slave":             true,
+	"detach-slave-master-host":   true,
+	"reattach-slave-master-host": true,
+	"flush-binary-logs":          true,
+	"restart-slave-statements":   true,
+	"enable-semi-sync-master":    true,
+	"disable-semi-sync-master":   true,
+	"enable-semi-sync-replica":   true,
+	"disable-semi-sync-replica":  true,
+	"set-sql-delay":              true,
+	"tag-delayed-replica":        true,
+	"untag-delayed-replica":      true,
+	"suspend-sql-delay":          true,
+	"resume-sql-delay":           true,
+	"set-read-only":              true,
+	"set-writeable":              true,
+	"resolve-dual-writable":      true,
+	"kill-query":                 true,
+	"set-cluster-alias":          true,
+	"set-desired-topology":       true,
+	"clear-desired-topology":     true,
+	"converge-topology":          true,
+	"reduce-master-fan-out":      true,
+	"advance-gtid-migration":     true,
+	"forget":                     true,
+	"forget-cluster":             true,
+	"recover":                    true,
+	"recover-lite":               true,
+	"graceful-master-takeover":   true,
+	"force-master-failover":      true,
+	"set-pool-spec":              true,
+	"clear-pool-spec":            true,
+	"manage-pool":                true,
+	"enforce-read-only":          true,
+	"decommission-instance":      true,
+}
+
+// isClusterLockedPath checks whether an API path, or the path it is a synonym of, is a cluster locked operation
+func isClusterLockedPath(path string) bool {
+	return isOperationPath(path, clusterLockedOperations)
+}
+
+// getClusterLockActor identifies the actor of a request: the authenticated user or API token, if any, or else
+// the requesting host. The actor is never taken from request headers or params, which any caller may set.
+func getClusterLockActor(req *http.Request, user auth.User) string {
+	if userId := getUserId(req, user); userId != "" {
+		return userId
+	}
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+	return req.RemoteAddr
+}
+
+// clusterLockCheck rejects a request operating on a cluster which is locked by a different actor
+func clusterLockCheck(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	clusterHint := getClusterHint(params)
+	if clusterHint == "" {
+		return
+	}
+	clusterName, err := figureClusterName(clusterHint)
+	if err != nil {
+		// Unknown cluster; let the handler deal with it
+		return
+	}
+	clusterAlias, err := inst.ReadAliasByClusterName(clusterName)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	if err := inst.CheckClusterLock(clusterAlias, getClusterLockActor(req, user)); err != nil {
+		Respond(r, &APIResponse{Code: ERROR, ErrorCode: ErrClusterLocked, Message: err.Error()})
+	}
+}
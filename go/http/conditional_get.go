@@ -0,0 +1,160 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/go-martini/martini"
+
+	"github.com/github/orchestrator/go/config"
+)
+
+// cacheableOperations are API GET calls with potentially large responses, which UI and automation
+// tend to poll: topologies, instance listings and audits. Their responses are tagged with an ETag,
+// and a request whose If-None-Match matches the ETag gets a body-less 304 Not Modified response.
+var cacheableOperations = map[string]bool{
+	"cluster":                        true,
+	"cluster-info":                   true,
+	"clusters":                       true,
+	"clusters-info":                  true,
+	"topology":                       true,
+	"topology-tabulated":             true,
+	"instance":                       true,
+	"instance-replicas":              true,
+	"all-instances":                  true,
+	"masters":                        true,
+	"master":                         true,
+	"search":                         true,
+	"problems":                       true,
+	"downtimed":                      true,
+	"maintenance":                    true,
+	"audit":                          true,
+	"audit-recovery":                 true,
+	"audit-recovery-steps":           true,
+	"audit-failure-detection":        true,
+	"replication-analysis":           true,
+	"replication-analysis-changelog": true,
+	"blocked-recoveries":             true,
+}
+
+// isCacheablePath checks whether an API path, or the path it is a synonym of, is a cacheable operation
+func isCacheablePath(path string) bool {
+	return isOperationPath(path, cacheableOperations)
+}
+
+// conditionalResponseWriter passes writes through to the underlying writer, unless told to buffer them,
+// in which case the response is held back until its ETag is known
+type conditionalResponseWriter struct {
+	martini.ResponseWriter
+	buffering  bool
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (this *conditionalResponseWriter) WriteHeader(statusCode int) {
+	if !this.buffering {
+		this.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	this.statusCode = statusCode
+}
+
+func (this *conditionalResponseWriter) Write(b []byte) (int, error) {
+	if !this.buffering {
+		return this.ResponseWriter.Write(b)
+	}
+	return this.body.Write(b)
+}
+
+// Hijack lets handlers take over the connection, as WebSocket streams do
+func (this *conditionalResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := this.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("the ResponseWriter doesn't support the Hijacker interface")
+	}
+	return hijacker.Hijack()
+}
+
+// ConditionalResponseWriter is a middleware which maps the response writer used by API handlers and renderers,
+// such that conditional GET requests can be served. It must precede the renderer.
+func ConditionalResponseWriter(w http.ResponseWriter, c martini.Context) {
+	if responseWriter, ok := w.(martini.ResponseWriter); ok {
+		c.MapTo(&conditionalResponseWriter{ResponseWriter: responseWriter}, (*http.ResponseWriter)(nil))
+	}
+}
+
+// getETag returns a weak entity tag for given response body. The tag is weak since the body may be
+// served compressed or uncompressed.
+func getETag(body []byte) string {
+	hash := sha1.Sum(body)
+	return fmt.Sprintf(`W/"%s"`, hex.EncodeToString(hash[:]))
+}
+
+// isETagMatch checks whether an If-None-Match header value lists given entity tag
+func isETagMatch(ifNoneMatch string, etag string) bool {
+	for _, token := range strings.Split(ifNoneMatch, ",") {
+		token = strings.TrimSpace(token)
+		if token == "*" || strings.TrimPrefix(token, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// getCacheControl returns the Cache-Control header of cacheable API responses. Unless configured otherwise,
+// clients are expected to revalidate on each request, which is cheap given the ETag.
+func getCacheControl() string {
+	if config.Config.HTTPCacheControlMaxAgeSeconds > 0 {
+		return fmt.Sprintf("private, max-age=%d", config.Config.HTTPCacheControlMaxAgeSeconds)
+	}
+	return "private, no-cache"
+}
+
+// conditionalGet buffers the response of a cacheable API call and tags it with an ETag. If the client
+// already holds the same response, as indicated by If-None-Match, a 304 Not Modified is returned instead.
+func conditionalGet(w http.ResponseWriter, req *http.Request, c martini.Context) {
+	responseWriter, ok := w.(*conditionalResponseWriter)
+	if !ok {
+		return
+	}
+	responseWriter.buffering = true
+	responseWriter.statusCode = http.StatusOK
+	responseWriter.body.Reset()
+	c.Next()
+	responseWriter.buffering = false
+
+	responseWriter.Header().Set("Cache-Control", getCacheControl())
+	if responseWriter.statusCode == http.StatusOK {
+		etag := getETag(responseWriter.body.Bytes())
+		responseWriter.Header().Set("ETag", etag)
+		if isETagMatch(req.Header.Get("If-None-Match"), etag) {
+			responseWriter.Header().Del("Content-Type")
+			responseWriter.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	responseWriter.WriteHeader(responseWriter.statusCode)
+	responseWriter.Write(responseWriter.body.Bytes())
+}
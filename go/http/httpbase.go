@@ -21,10 +21,12 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/go-martini/martini"
 	"github.com/martini-contrib/auth"
 
 	"github.com/github/orchestrator/go/config"
 	"github.com/github/orchestrator/go/inst"
+	"github.com/github/orchestrator/go/logic"
 	"github.com/github/orchestrator/go/os"
 	"github.com/github/orchestrator/go/process"
 	"github.com/github/orchestrator/go/raft"
@@ -49,6 +51,20 @@ func isAuthorizedForAction(req *http.Request, user auth.User) bool {
 		return false
 	}
 
+	if process.IsShuttingDown() {
+		// No new operations while draining in-flight ones
+		return false
+	}
+
+	if !isNamespaceScopedRequest(req) {
+		// A user restricted to namespaces only operates on known clusters within those namespaces
+		return false
+	}
+
+	if tokenRequest := getAPITokenRequest(req); tokenRequest != nil {
+		return isAPITokenAuthorizedForAction(tokenRequest)
+	}
+
 	switch strings.ToLower(config.Config.AuthenticationMethod) {
 	case "basic":
 		{
@@ -102,6 +118,181 @@ func isAuthorizedForAction(req *http.Request, user auth.User) bool {
 	}
 }
 
+// getUserNamespaces returns the namespaces the authenticated user is a member of. A nil result means
+// namespaces are not configured, and no restriction applies. A request authenticated by an API token is
+// scoped to the namespaces of the token's owner.
+func getUserNamespaces(req *http.Request, user auth.User) []string {
+	if len(config.Config.Namespaces) == 0 {
+		return nil
+	}
+	authUser := string(user)
+	if tokenRequest := getAPITokenRequest(req); tokenRequest != nil {
+		authUser = tokenRequest.token.Owner
+	} else if strings.ToLower(config.Config.AuthenticationMethod) == "proxy" {
+		authUser = getProxyAuthUser(req)
+	}
+	namespaces := []string{}
+	for namespace, namespaceConfig := range config.Config.Namespaces {
+		isMember := false
+		for _, namespaceAuthUser := range namespaceConfig.AuthUsers {
+			if namespaceAuthUser == "*" || (authUser != "" && namespaceAuthUser == authUser) {
+				isMember = true
+			}
+		}
+		if !isMember && authUser != "" && len(namespaceConfig.AuthGroups) > 0 && os.UserInGroups(authUser, namespaceConfig.AuthGroups) {
+			isMember = true
+		}
+		if isMember {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return namespaces
+}
+
+// isAuthorizedForCluster checks whether the given cluster is within the authenticated user's namespaces
+func isAuthorizedForCluster(req *http.Request, user auth.User, clusterName string) bool {
+	if tokenRequest := getAPITokenRequest(req); tokenRequest != nil && !isAPITokenAuthorizedForCluster(tokenRequest.token, clusterName) {
+		return false
+	}
+	namespaces := getUserNamespaces(req, user)
+	if namespaces == nil {
+		return true
+	}
+	clusterInfo, err := inst.ReadClusterInfo(clusterName)
+	if err != nil {
+		return false
+	}
+	return clusterInfo.IsInNamespaces(namespaces)
+}
+
+// filterClustersInfoByNamespaces returns those clusters which are within the authenticated user's namespaces,
+// and within the clusters of the request's API token, if any
+func filterClustersInfoByNamespaces(req *http.Request, user auth.User, clustersInfo []inst.ClusterInfo) []inst.ClusterInfo {
+	if tokenRequest := getAPITokenRequest(req); tokenRequest != nil && !tokenRequest.token.AllowsAllClusters() {
+		filtered := []inst.ClusterInfo{}
+		for _, clusterInfo := range clustersInfo {
+			if clusterInfo.MatchesClusterFilters(tokenRequest.token.ClusterFilters) {
+				filtered = append(filtered, clusterInfo)
+			}
+		}
+		clustersInfo = filtered
+	}
+	namespaces := getUserNamespaces(req, user)
+	if namespaces == nil {
+		return clustersInfo
+	}
+	filtered := []inst.ClusterInfo{}
+	for _, clusterInfo := range clustersInfo {
+		if clusterInfo.IsInNamespaces(namespaces) {
+			filtered = append(filtered, clusterInfo)
+		}
+	}
+	return filtered
+}
+
+// isRestrictedToClusters checks whether the authenticated user, or the request's API token, is restricted to
+// a subset of the clusters
+func isRestrictedToClusters(req *http.Request, user auth.User) bool {
+	if tokenRequest := getAPITokenRequest(req); tokenRequest != nil && !tokenRequest.token.AllowsAllClusters() {
+		return true
+	}
+	return getUserNamespaces(req, user) != nil
+}
+
+// filterFederatedViewByNamespaces removes those entries of a federated view whose clusters are not within the
+// authenticated user's namespaces, or not within the clusters of the request's API token
+func filterFederatedViewByNamespaces(req *http.Request, user auth.User, view *logic.FederatedView) {
+	if !isRestrictedToClusters(req, user) {
+		return
+	}
+	entries := []map[string]interface{}{}
+	for _, entry := range view.Entries {
+		if len(filterClustersInfoByNamespaces(req, user, []inst.ClusterInfo{logic.FederatedEntryClusterInfo(entry)})) > 0 {
+			entries = append(entries, entry)
+		}
+	}
+	view.Entries = entries
+}
+
+// authorizedClusterNames returns the names of clusters which are within the authenticated user's namespaces,
+// and within the clusters of the request's API token, if any. A nil result means no restriction applies.
+func authorizedClusterNames(req *http.Request, user auth.User) (map[string]bool, error) {
+	tokenRequest := getAPITokenRequest(req)
+	if getUserNamespaces(req, user) == nil && (tokenRequest == nil || tokenRequest.token.AllowsAllClusters()) {
+		return nil, nil
+	}
+	clustersInfo, err := inst.ReadClustersInfo("")
+	if err != nil {
+		return nil, err
+	}
+	clusterNames := make(map[string]bool)
+	for _, clusterInfo := range filterClustersInfoByNamespaces(req, user, clustersInfo) {
+		clusterNames[clusterInfo.ClusterName] = true
+	}
+	return clusterNames, nil
+}
+
+// filterInstancesByNamespaces returns those instances whose clusters are within the authenticated user's namespaces
+func filterInstancesByNamespaces(req *http.Request, user auth.User, instances [](*inst.Instance)) ([](*inst.Instance), error) {
+	authorizedClusters, err := authorizedClusterNames(req, user)
+	if err != nil || authorizedClusters == nil {
+		return instances, err
+	}
+	filtered := [](*inst.Instance){}
+	for _, instance := range instances {
+		if authorizedClusters[instance.ClusterName] {
+			filtered = append(filtered, instance)
+		}
+	}
+	return filtered, nil
+}
+
+// filterRecoveriesByNamespaces returns those recoveries (or failure detections) whose clusters are within the
+// authenticated user's namespaces, and within the clusters of the request's API token, if any. Clusters are
+// matched as recorded by the recovery, as the cluster may since have been renamed by a failover.
+func filterRecoveriesByNamespaces(req *http.Request, user auth.User, recoveries []logic.TopologyRecovery) [](*logic.TopologyRecovery) {
+	filtered := [](*logic.TopologyRecovery){}
+	isRestricted := isRestrictedToClusters(req, user)
+	for i := range recoveries {
+		if !isRestricted || len(filterClustersInfoByNamespaces(req, user, []inst.ClusterInfo{recoveries[i].AnalysisEntry.ClusterDetails})) > 0 {
+			filtered = append(filtered, &recoveries[i])
+		}
+	}
+	return filtered
+}
+
+// filterAnalysisByNamespaces returns those replication analysis entries whose clusters are within the authenticated
+// user's namespaces, and within the clusters of the request's API token, if any
+func filterAnalysisByNamespaces(req *http.Request, user auth.User, analysis []inst.ReplicationAnalysis) []inst.ReplicationAnalysis {
+	if !isRestrictedToClusters(req, user) {
+		return analysis
+	}
+	filtered := []inst.ReplicationAnalysis{}
+	for _, analysisEntry := range analysis {
+		if len(filterClustersInfoByNamespaces(req, user, []inst.ClusterInfo{analysisEntry.ClusterDetails})) > 0 {
+			filtered = append(filtered, analysisEntry)
+		}
+	}
+	return filtered
+}
+
+// instanceKeyAuthorizer returns a function checking whether the cluster of an instance is within the authenticated
+// user's namespaces, and within the clusters of the request's API token, if any. Instances of unknown clusters are
+// not authorized, unless no restriction applies.
+func instanceKeyAuthorizer(req *http.Request, user auth.User) (func(instanceKey *inst.InstanceKey) bool, error) {
+	authorizedClusters, err := authorizedClusterNames(req, user)
+	if err != nil {
+		return nil, err
+	}
+	return func(instanceKey *inst.InstanceKey) bool {
+		if authorizedClusters == nil {
+			return true
+		}
+		clusterName, err := inst.GetClusterName(instanceKey)
+		return err == nil && authorizedClusters[clusterName]
+	}, nil
+}
+
 func authenticateToken(publicToken string, resp http.ResponseWriter) error {
 	secretToken, err := process.AcquireAccessToken(publicToken)
 	if err != nil {
@@ -118,6 +309,9 @@ func getUserId(req *http.Request, user auth.User) string {
 	if config.Config.ReadOnly {
 		return ""
 	}
+	if tokenRequest := getAPITokenRequest(req); tokenRequest != nil {
+		return string(apiTokenUser(tokenRequest.token))
+	}
 
 	switch strings.ToLower(config.Config.AuthenticationMethod) {
 	case "basic":
@@ -174,3 +368,22 @@ func getClusterNameIfExists(params map[string]string) (clusterName string, err e
 		return figureClusterName(clusterHint)
 	}
 }
+
+// drainedOperations are API calls which a shutdown waits on, along with cluster locked operations and recoveries
+var drainedOperations = map[string]bool{
+	"batch": true,
+}
+
+// isDrainedPath checks whether an API path runs topology changes or recoveries, which a shutdown waits on to complete
+func isDrainedPath(path string) bool {
+	return isOperationPath(path, drainedOperations) || isClusterLockedPath(path) || isOperationPath(path, recoveryOperations)
+}
+
+// trackInFlightOperation registers a request as an in-flight operation, such that a shutdown waits for the
+// relocation, or other operation it runs, to complete. The request is registered before it is authorized,
+// hence a request either is waited on, or is rejected as the node is shutting down.
+func trackInFlightOperation(req *http.Request, c martini.Context) {
+	id := process.BeginInFlightOperation(fmt.Sprintf("API request %s", req.URL.Path))
+	defer process.EndInFlightOperation(id)
+	c.Next()
+}
@@ -0,0 +1,61 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/auth"
+
+	"github.com/github/orchestrator/go/inst"
+)
+
+// namespaceRequests maps API requests of users restricted to namespaces onto whether all clusters the request
+// operates on are known, and within the user's namespaces, for the lifetime of the request
+var namespaceRequests sync.Map
+
+// namespaceCheck is a handler which rejects API requests that operate on clusters, or instances of clusters,
+// outside the authenticated user's namespaces
+func namespaceCheck(params martini.Params, req *http.Request, user auth.User, resp http.ResponseWriter, c martini.Context) {
+	namespaces := getUserNamespaces(req, user)
+	if namespaces == nil {
+		return
+	}
+	clusterNames, known := requestClusterNames(params)
+	for _, clusterName := range clusterNames {
+		clusterInfo, err := inst.ReadClusterInfo(clusterName)
+		if err != nil || clusterInfo == nil || !clusterInfo.IsInNamespaces(namespaces) {
+			http.Error(resp, fmt.Sprintf("Cluster %s is not within your namespaces", clusterName), http.StatusForbidden)
+			return
+		}
+	}
+	namespaceRequests.Store(req, known && len(clusterNames) > 0)
+	defer namespaceRequests.Delete(req)
+
+	c.Next()
+}
+
+// isNamespaceScopedRequest checks whether an API request of a user restricted to namespaces operates only on
+// known clusters within the user's namespaces. Write operations which are not scoped, e.g. global operations, or
+// operations on instances not yet known, are refused to such users.
+func isNamespaceScopedRequest(req *http.Request) bool {
+	scoped, ok := namespaceRequests.Load(req)
+	return !ok || scoped.(bool)
+}
@@ -0,0 +1,245 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/auth"
+	"github.com/martini-contrib/render"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/github/orchestrator/go/logic"
+	"github.com/github/orchestrator/go/process"
+	test "github.com/openark/golib/tests"
+)
+
+// withNamespaces points the backend at a fresh sqlite database, holding two clusters, and configures a
+// namespace for one of them, for the duration of given test
+func withNamespaces(t *testing.T) {
+	backendDB, dataFile, namespaces := config.Config.BackendDB, config.Config.SQLite3DataFile, config.Config.Namespaces
+	config.Config.BackendDB = "sqlite"
+	config.Config.SQLite3DataFile = filepath.Join(t.TempDir(), "orchestrator.sqlite3")
+	config.Config.Namespaces = map[string]config.NamespaceConfiguration{
+		"shop-team": {ClusterFilters: []string{"alias=shop"}, AuthUsers: []string{"alice"}},
+	}
+	t.Cleanup(func() {
+		config.Config.BackendDB, config.Config.SQLite3DataFile, config.Config.Namespaces = backendDB, dataFile, namespaces
+	})
+
+	for _, instanceKey := range []inst.InstanceKey{{Hostname: "db-shop", Port: 3306}, {Hostname: "db-books", Port: 3306}} {
+		_, err := db.ExecOrchestrator(`
+				insert into database_instance (
+					hostname, port, last_checked, last_seen, last_check_partial_success, server_id, version, binlog_format,
+					log_bin, log_slave_updates, binary_log_file, binary_log_pos, master_host, master_port,
+					slave_sql_running, slave_io_running, master_log_file, read_master_log_pos, relay_master_log_file,
+					exec_master_log_pos, num_slave_hosts, slave_hosts, cluster_name
+				) values (
+					?, ?, now(), now(), 1, 1, '5.7.26', 'ROW',
+					1, 1, 'mysql-bin.000001', 4, '', 0,
+					0, 0, '', 0, '',
+					0, 0, '[]', ?
+				)
+			`, instanceKey.Hostname, instanceKey.Port, instanceKey.StringCode(),
+		)
+		test.S(t).ExpectNil(err)
+	}
+	test.S(t).ExpectNil(inst.SetClusterAlias("db-shop:3306", "shop"))
+	test.S(t).ExpectNil(inst.SetClusterAlias("db-books:3306", "books"))
+}
+
+// namespaceCheckRequest runs an API request through namespaceCheck, returning the response code, and
+// whether the request is authorized for action
+func namespaceCheckRequest(t *testing.T, route string, path string, user string, token *process.APIToken) (code int, authorizedForAction bool) {
+	m := martini.New()
+	m.Map(auth.User(user))
+	router := martini.NewRouter()
+	router.Get(route, namespaceCheck, func(req *http.Request, user auth.User) string {
+		authorizedForAction = isAuthorizedForAction(req, user)
+		return "ok"
+	})
+	m.Action(router.Handle)
+
+	request := httptest.NewRequest("GET", path, nil)
+	if token != nil {
+		apiTokenRequests.Store(request, &apiTokenRequest{token: token, clusterScoped: true, operationClass: process.APITokenOperationWrite})
+		defer apiTokenRequests.Delete(request)
+	}
+	recorder := httptest.NewRecorder()
+	m.ServeHTTP(recorder, request)
+	return recorder.Code, authorizedForAction
+}
+
+func TestGetUserNamespaces(t *testing.T) {
+	withNamespaces(t)
+
+	request := httptest.NewRequest("GET", "/api/clusters", nil)
+	test.S(t).ExpectEquals(len(getUserNamespaces(request, auth.User("alice"))), 1)
+	test.S(t).ExpectEquals(len(getUserNamespaces(request, auth.User("bob"))), 0)
+	test.S(t).ExpectNotNil(getUserNamespaces(request, auth.User("bob")))
+
+	// A request authenticated by an API token is scoped to the namespaces of the token's owner
+	token := &process.APIToken{TokenId: "0123456789abcdef", Owner: "alice", ClusterFilters: []string{process.APITokenAllClusters}}
+	apiTokenRequests.Store(request, &apiTokenRequest{token: token})
+	defer apiTokenRequests.Delete(request)
+	test.S(t).ExpectEquals(len(getUserNamespaces(request, apiTokenUser(token))), 1)
+
+	config.Config.Namespaces = map[string]config.NamespaceConfiguration{}
+	test.S(t).ExpectTrue(getUserNamespaces(request, auth.User("bob")) == nil)
+}
+
+func TestNamespaceCheck(t *testing.T) {
+	withNamespaces(t)
+
+	// Clusters and instances within the user's namespaces
+	code, authorized := namespaceCheckRequest(t, "/api/cluster/:clusterHint", "/api/cluster/shop", "alice", nil)
+	test.S(t).ExpectEquals(code, http.StatusOK)
+	test.S(t).ExpectTrue(authorized)
+	code, authorized = namespaceCheckRequest(t, "/api/instance/:host/:port", "/api/instance/db-shop/3306", "alice", nil)
+	test.S(t).ExpectEquals(code, http.StatusOK)
+	test.S(t).ExpectTrue(authorized)
+
+	// Clusters and instances outside the user's namespaces
+	code, _ = namespaceCheckRequest(t, "/api/cluster/:clusterHint", "/api/cluster/books", "alice", nil)
+	test.S(t).ExpectEquals(code, http.StatusForbidden)
+	code, _ = namespaceCheckRequest(t, "/api/instance/:host/:port", "/api/instance/db-books/3306", "alice", nil)
+	test.S(t).ExpectEquals(code, http.StatusForbidden)
+	code, _ = namespaceCheckRequest(t, "/api/relocate/:host/:port/:belowHost/:belowPort", "/api/relocate/db-shop/3306/db-books/3306", "alice", nil)
+	test.S(t).ExpectEquals(code, http.StatusForbidden)
+	code, _ = namespaceCheckRequest(t, "/api/instance/:host/:port", "/api/instance/db-shop/3306", "bob", nil)
+	test.S(t).ExpectEquals(code, http.StatusForbidden)
+
+	// Operations which are not scoped to a known cluster are refused
+	code, authorized = namespaceCheckRequest(t, "/api/disable-global-recoveries", "/api/disable-global-recoveries", "alice", nil)
+	test.S(t).ExpectEquals(code, http.StatusOK)
+	test.S(t).ExpectFalse(authorized)
+	code, authorized = namespaceCheckRequest(t, "/api/discover/:host/:port", "/api/discover/db-new/3306", "alice", nil)
+	test.S(t).ExpectEquals(code, http.StatusOK)
+	test.S(t).ExpectFalse(authorized)
+
+	// API tokens are scoped to the namespaces of their owner
+	token := &process.APIToken{TokenId: "0123456789abcdef", Owner: "alice", ClusterFilters: []string{process.APITokenAllClusters}, OperationClasses: []string{process.APITokenOperationWrite}}
+	code, authorized = namespaceCheckRequest(t, "/api/instance/:host/:port", "/api/instance/db-shop/3306", "token:0123456789abcdef", token)
+	test.S(t).ExpectEquals(code, http.StatusOK)
+	test.S(t).ExpectTrue(authorized)
+	code, _ = namespaceCheckRequest(t, "/api/instance/:host/:port", "/api/instance/db-books/3306", "token:0123456789abcdef", token)
+	test.S(t).ExpectEquals(code, http.StatusForbidden)
+
+	// No restriction applies when namespaces are not configured
+	config.Config.Namespaces = map[string]config.NamespaceConfiguration{}
+	code, authorized = namespaceCheckRequest(t, "/api/disable-global-recoveries", "/api/disable-global-recoveries", "bob", nil)
+	test.S(t).ExpectEquals(code, http.StatusOK)
+	test.S(t).ExpectTrue(authorized)
+}
+
+func TestFilterInstancesByNamespaces(t *testing.T) {
+	withNamespaces(t)
+
+	instances := [](*inst.Instance){
+		{Key: inst.InstanceKey{Hostname: "db-shop", Port: 3306}, ClusterName: "db-shop:3306"},
+		{Key: inst.InstanceKey{Hostname: "db-books", Port: 3306}, ClusterName: "db-books:3306"},
+	}
+	request := httptest.NewRequest("GET", "/api/search", nil)
+	filtered, err := filterInstancesByNamespaces(request, auth.User("alice"), instances)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(filtered), 1)
+	test.S(t).ExpectEquals(filtered[0].ClusterName, "db-shop:3306")
+
+	filtered, err = filterInstancesByNamespaces(request, auth.User("bob"), instances)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(filtered), 0)
+}
+
+func TestFilterClusterListingsByNamespaces(t *testing.T) {
+	withNamespaces(t)
+
+	request := httptest.NewRequest("GET", "/api/audit-recovery", nil)
+	shopCluster := inst.ClusterInfo{ClusterName: "db-old-shop:3306", ClusterAlias: "shop"}
+	booksCluster := inst.ClusterInfo{ClusterName: "db-books:3306", ClusterAlias: "books"}
+
+	recoveries := []logic.TopologyRecovery{{UID: "shop-recovery"}, {UID: "books-recovery"}}
+	recoveries[0].AnalysisEntry.ClusterDetails = shopCluster
+	recoveries[1].AnalysisEntry.ClusterDetails = booksCluster
+	filteredRecoveries := filterRecoveriesByNamespaces(request, auth.User("alice"), recoveries)
+	test.S(t).ExpectEquals(len(filteredRecoveries), 1)
+	test.S(t).ExpectEquals(filteredRecoveries[0].UID, "shop-recovery")
+	test.S(t).ExpectEquals(len(filterRecoveriesByNamespaces(request, auth.User("bob"), recoveries)), 0)
+
+	analysis := []inst.ReplicationAnalysis{{ClusterDetails: booksCluster}, {ClusterDetails: shopCluster}}
+	filteredAnalysis := filterAnalysisByNamespaces(request, auth.User("alice"), analysis)
+	test.S(t).ExpectEquals(len(filteredAnalysis), 1)
+	test.S(t).ExpectEquals(filteredAnalysis[0].ClusterDetails.ClusterAlias, "shop")
+
+	isAuthorizedInstance, err := instanceKeyAuthorizer(request, auth.User("alice"))
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(isAuthorizedInstance(&inst.InstanceKey{Hostname: "db-shop", Port: 3306}))
+	test.S(t).ExpectFalse(isAuthorizedInstance(&inst.InstanceKey{Hostname: "db-books", Port: 3306}))
+	test.S(t).ExpectFalse(isAuthorizedInstance(&inst.InstanceKey{Hostname: "db-unknown", Port: 3306}))
+
+	// An API token restricted to specific clusters filters listings even when namespaces are not configured
+	config.Config.Namespaces = map[string]config.NamespaceConfiguration{}
+	token := &process.APIToken{TokenId: "0123456789abcdef", ClusterFilters: []string{"alias=books"}}
+	apiTokenRequests.Store(request, &apiTokenRequest{token: token})
+	defer apiTokenRequests.Delete(request)
+	filteredRecoveries = filterRecoveriesByNamespaces(request, apiTokenUser(token), recoveries)
+	test.S(t).ExpectEquals(len(filteredRecoveries), 1)
+	test.S(t).ExpectEquals(filteredRecoveries[0].UID, "books-recovery")
+	isAuthorizedInstance, err = instanceKeyAuthorizer(request, apiTokenUser(token))
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectFalse(isAuthorizedInstance(&inst.InstanceKey{Hostname: "db-shop", Port: 3306}))
+	test.S(t).ExpectTrue(isAuthorizedInstance(&inst.InstanceKey{Hostname: "db-books", Port: 3306}))
+}
+
+func TestAuditFilteredByNamespaces(t *testing.T) {
+	withNamespaces(t)
+
+	for _, hostname := range []string{"db-shop", "db-books", ""} {
+		_, err := db.ExecOrchestrator(`
+				insert into audit (audit_timestamp, audit_type, hostname, port, message) values (now(), 'test', ?, 3306, 'audited')
+			`, hostname,
+		)
+		test.S(t).ExpectNil(err)
+	}
+	readAudit := func(user string) []inst.Audit {
+		m := martini.New()
+		m.Use(render.Renderer())
+		m.Map(auth.User(user))
+		router := martini.NewRouter()
+		router.Get("/api/audit", (&HttpAPI{}).Audit)
+		m.Action(router.Handle)
+
+		recorder := httptest.NewRecorder()
+		m.ServeHTTP(recorder, httptest.NewRequest("GET", "/api/audit", nil))
+		audits := []inst.Audit{}
+		test.S(t).ExpectNil(json.Unmarshal(recorder.Body.Bytes(), &audits))
+		return audits
+	}
+	audits := readAudit("alice")
+	test.S(t).ExpectEquals(len(audits), 1)
+	test.S(t).ExpectEquals(audits[0].AuditInstanceKey.Hostname, "db-shop")
+	test.S(t).ExpectEquals(len(readAudit("bob")), 0)
+
+	config.Config.Namespaces = map[string]config.NamespaceConfiguration{}
+	test.S(t).ExpectEquals(len(readAudit("bob")), 3)
+}
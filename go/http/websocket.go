@@ -0,0 +1,188 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package http
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// websocketGUID is the globally unique identifier by which a WebSocket handshake is accepted (RFC 6455)
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	websocketOpText  = 0x1
+	websocketOpClose = 0x8
+)
+
+// websocketConn is a server side WebSocket connection which pushes text messages to the client. Messages
+// sent by the client are discarded; the connection is closed once the client closes it.
+type websocketConn struct {
+	conn      net.Conn
+	writer    *bufio.Writer
+	writeLock sync.Mutex
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// isWebsocketRequest checks whether a request asks to upgrade to a WebSocket
+func isWebsocketRequest(req *http.Request) bool {
+	return strings.EqualFold(req.Header.Get("Upgrade"), "websocket") &&
+		strings.Contains(strings.ToLower(req.Header.Get("Connection")), "upgrade")
+}
+
+// errWebsocketOriginNotAllowed rejects a handshake initiated by a page of another origin
+var errWebsocketOriginNotAllowed = fmt.Errorf("WebSocket origin not allowed")
+
+// isWebsocketOriginAllowed checks that a browser initiated handshake comes from a page served by this host, such that
+// other sites cannot open streams with the user's credentials. Non-browser clients send no Origin, and are allowed.
+func isWebsocketOriginAllowed(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	originURL, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(originURL.Host, req.Host)
+}
+
+// websocketAccept computes the Sec-WebSocket-Accept header for given Sec-WebSocket-Key
+func websocketAccept(key string) string {
+	hash := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// upgradeWebsocket takes over a request's connection, completing the WebSocket handshake
+func upgradeWebsocket(resp http.ResponseWriter, req *http.Request) (*websocketConn, error) {
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if !isWebsocketRequest(req) || key == "" {
+		return nil, fmt.Errorf("Not a WebSocket handshake request")
+	}
+	if !isWebsocketOriginAllowed(req) {
+		return nil, errWebsocketOriginNotAllowed
+	}
+	hijacker, ok := resp.(http.Hijacker)
+	if !ok {
+		return nil, fmt.Errorf("Cannot take over connection for WebSocket")
+	}
+	conn, bufrw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	ws := &websocketConn{conn: conn, writer: bufrw.Writer, closed: make(chan struct{})}
+	fmt.Fprintf(ws.writer, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", websocketAccept(key))
+	if err := ws.writer.Flush(); err != nil {
+		ws.Close()
+		return nil, err
+	}
+	go ws.discardIncoming(bufrw.Reader)
+	return ws, nil
+}
+
+// discardIncoming reads and discards client frames, and closes the connection when the client closes it or goes away
+func (this *websocketConn) discardIncoming(reader *bufio.Reader) {
+	defer this.Close()
+	for {
+		header := make([]byte, 2)
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return
+		}
+		opcode := header[0] & 0x0f
+		length := uint64(header[1] & 0x7f)
+		switch length {
+		case 126:
+			extended := make([]byte, 2)
+			if _, err := io.ReadFull(reader, extended); err != nil {
+				return
+			}
+			length = uint64(binary.BigEndian.Uint16(extended))
+		case 127:
+			extended := make([]byte, 8)
+			if _, err := io.ReadFull(reader, extended); err != nil {
+				return
+			}
+			length = binary.BigEndian.Uint64(extended)
+		}
+		if header[1]&0x80 != 0 {
+			// masking key
+			length += 4
+		}
+		if _, err := io.CopyN(io.Discard, reader, int64(length)); err != nil {
+			return
+		}
+		if opcode == websocketOpClose {
+			return
+		}
+	}
+}
+
+// writeFrame writes a single, unmasked, final frame
+func (this *websocketConn) writeFrame(opcode byte, payload []byte) error {
+	this.writeLock.Lock()
+	defer this.writeLock.Unlock()
+
+	header := []byte{0x80 | opcode}
+	switch length := len(payload); {
+	case length < 126:
+		header = append(header, byte(length))
+	case length <= 0xffff:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(length))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(length))
+	}
+	if _, err := this.writer.Write(header); err != nil {
+		return err
+	}
+	if _, err := this.writer.Write(payload); err != nil {
+		return err
+	}
+	return this.writer.Flush()
+}
+
+// WriteText sends a text message to the client
+func (this *websocketConn) WriteText(message []byte) error {
+	return this.writeFrame(websocketOpText, message)
+}
+
+// Done is closed once the connection is closed
+func (this *websocketConn) Done() <-chan struct{} {
+	return this.closed
+}
+
+// Close sends a close frame, and closes the connection
+func (this *websocketConn) Close() error {
+	var err error
+	this.closeOnce.Do(func() {
+		this.writeFrame(websocketOpClose, nil)
+		err = this.conn.Close()
+		close(this.closed)
+	})
+	return err
+}
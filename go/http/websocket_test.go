@@ -0,0 +1,104 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package http
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	test "github.com/openark/golib/tests"
+)
+
+func TestIsWebsocketOriginAllowed(t *testing.T) {
+	newRequest := func(origin string) *http.Request {
+		req := httptest.NewRequest("GET", "http://orchestrator.example.com:3000/api/agent-seed-progress-stream/1", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		return req
+	}
+	test.S(t).ExpectTrue(isWebsocketOriginAllowed(newRequest("")))
+	test.S(t).ExpectTrue(isWebsocketOriginAllowed(newRequest("http://orchestrator.example.com:3000")))
+	test.S(t).ExpectTrue(isWebsocketOriginAllowed(newRequest("https://Orchestrator.example.com:3000")))
+	test.S(t).ExpectFalse(isWebsocketOriginAllowed(newRequest("http://orchestrator.example.com")))
+	test.S(t).ExpectFalse(isWebsocketOriginAllowed(newRequest("http://evil.example.com:3000")))
+	test.S(t).ExpectFalse(isWebsocketOriginAllowed(newRequest("null")))
+	test.S(t).ExpectFalse(isWebsocketOriginAllowed(newRequest("http://[::1")))
+}
+
+func TestUpgradeWebsocket(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		ws, err := upgradeWebsocket(resp, req)
+		if err == errWebsocketOriginNotAllowed {
+			http.Error(resp, err.Error(), http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(resp, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer ws.Close()
+		ws.WriteText([]byte("hello"))
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	handshake := func(origin string) (*bufio.Reader, *http.Response) {
+		conn, err := net.Dial("tcp", host)
+		test.S(t).ExpectNil(err)
+		t.Cleanup(func() { conn.Close() })
+		request := fmt.Sprintf("GET /stream HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n", host)
+		if origin != "" {
+			request += fmt.Sprintf("Origin: %s\r\n", origin)
+		}
+		_, err = conn.Write([]byte(request + "\r\n"))
+		test.S(t).ExpectNil(err)
+		reader := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(reader, nil)
+		test.S(t).ExpectNil(err)
+		return reader, resp
+	}
+	{
+		reader, resp := handshake("http://" + host)
+		test.S(t).ExpectEquals(resp.StatusCode, http.StatusSwitchingProtocols)
+		// The RFC 6455 sample key and accept value
+		test.S(t).ExpectEquals(resp.Header.Get("Sec-WebSocket-Accept"), "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=")
+		frame := make([]byte, 7)
+		_, err := io.ReadFull(reader, frame)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(frame[0], byte(0x80|websocketOpText))
+		test.S(t).ExpectEquals(frame[1], byte(5))
+		test.S(t).ExpectEquals(string(frame[2:]), "hello")
+		_, err = io.ReadFull(reader, frame[:2])
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(frame[0], byte(0x80|websocketOpClose))
+	}
+	{
+		_, resp := handshake("")
+		test.S(t).ExpectEquals(resp.StatusCode, http.StatusSwitchingProtocols)
+	}
+	{
+		_, resp := handshake("http://evil.example.com")
+		test.S(t).ExpectEquals(resp.StatusCode, http.StatusForbidden)
+	}
+}
@@ -38,6 +38,8 @@ const (
 	MasterSingleSlaveDead                                              = "MasterSingleSlaveDead"
 	AllMasterSlavesNotReplicating                                      = "AllMasterSlavesNotReplicating"
 	AllMasterSlavesNotReplicatingOrDead                                = "AllMasterSlavesNotReplicatingOrDead"
+	MasterNotWritable                                                  = "MasterNotWritable"
+	MasterWritesNotReplicating                                         = "MasterWritesNotReplicating"
 	MasterWithoutSlaves                                                = "MasterWithoutSlaves"
 	DeadCoMaster                                                       = "DeadCoMaster"
 	DeadCoMasterAndSomeSlaves                                          = "DeadCoMasterAndSomeSlaves"
@@ -53,6 +55,9 @@ const (
 	AllIntermediateMasterSlavesNotReplicating                          = "AllIntermediateMasterSlavesNotReplicating"
 	FirstTierSlaveFailingToConnectToMaster                             = "FirstTierSlaveFailingToConnectToMaster"
 	BinlogServerFailingToConnectToMaster                               = "BinlogServerFailingToConnectToMaster"
+	ReplicaRelayLogCorruption                                          = "ReplicaRelayLogCorruption"
+	ReplicaMasterBinlogCorruption                                      = "ReplicaMasterBinlogCorruption"
+	DualWritableMasters                                                = "DualWritableMasters"
 )
 
 const (
@@ -106,6 +111,7 @@ type ReplicationAnalysis struct {
 	IsCoMaster                                bool
 	LastCheckValid                            bool
 	LastCheckPartialSuccess                   bool
+	LastSeenTimestamp                         string // Last time the analyzed instance was successfully polled
 	CountReplicas                             uint
 	CountValidReplicas                        uint
 	CountValidReplicatingReplicas             uint
@@ -114,6 +120,7 @@ type ReplicationAnalysis struct {
 	ReplicationDepth                          uint
 	SlaveHosts                                InstanceKeyMap
 	IsFailingToConnectToMaster                bool
+	ReplicationCorruption                     ReplicationCorruption
 	Analysis                                  AnalysisCode
 	Description                               string
 	StructureAnalysis                         []StructureAnalysisCode
@@ -132,6 +139,10 @@ type ReplicationAnalysis struct {
 	CountDistinctMajorVersionsLoggingReplicas uint
 	CountDelayedReplicas                      uint
 	CountLaggingReplicas                      uint
+	IsWriteProbeFailing                       bool
+	CountReplicasMissingWriteProbe            uint
+	IsReadOnly                                bool
+	CountWritableClusterMembers               uint
 	IsActionableRecovery                      bool
 	ProcessingNodeHostname                    string
 	ProcessingNodeToken                       string
@@ -142,6 +153,7 @@ type ReplicationAnalysis struct {
 	MinReplicaGTIDMode                        string
 	MaxReplicaGTIDMode                        string
 	CommandHint                               string
+	FailoverImpact                            *FailoverImpactEstimate
 }
 
 type AnalysisMap map[string](*ReplicationAnalysis)
@@ -55,7 +55,7 @@ func initializeAnalysisDaoPostConfiguration() {
 func GetReplicationAnalysis(clusterName string, hints *ReplicationAnalysisHints) ([]ReplicationAnalysis, error) {
 	result := []ReplicationAnalysis{}
 
-	args := sqlutils.Args(ValidSecondsFromSeenToLastAttemptedCheck(), config.Config.ReasonableReplicationLagSeconds, clusterName)
+	args := sqlutils.Args(ValidSecondsFromSeenToLastAttemptedCheck(), config.Config.ReasonableReplicationLagSeconds, writeProbeReplicationThresholdSeconds(), config.Config.ReasonableReplicationLagSeconds, clusterName)
 	analysisQueryReductionClause := ``
 	if config.Config.ReduceReplicationAnalysisCount {
 		analysisQueryReductionClause = `
@@ -81,6 +81,9 @@ func GetReplicationAnalysis(clusterName string, hints *ReplicationAnalysisHints)
 		            AND master_instance.last_io_error like '%error %connecting to master%'
 		          ) /* AS is_failing_to_connect_to_master */)
 				OR (COUNT(replica_instance.server_id) /* AS count_slaves */ > 0)
+				OR (MIN(master_instance.write_probe_failing) /* AS is_write_probe_failing */ = 1)
+				OR (MIN(master_instance.last_io_errno) > 0 OR MIN(master_instance.last_sql_errno) > 0)
+				OR (MIN(master_instance.read_only) = 0 AND MIN(IFNULL(cluster_writable.count_writable, 0)) > 1)
 			`
 		args = append(args, ValidSecondsFromSeenToLastAttemptedCheck())
 	}
@@ -100,7 +103,10 @@ func GetReplicationAnalysis(clusterName string, hints *ReplicationAnalysisHints)
 							master_instance.last_checked <= master_instance.last_seen
 							and master_instance.last_attempted_check <= master_instance.last_seen + interval ? second
 		        	) = 1 AS is_last_check_valid,
+						MIN(unix_timestamp(master_instance.last_checked) - unix_timestamp(master_instance.last_seen)) AS seconds_from_seen_to_last_check,
+						MIN(unix_timestamp(master_instance.last_attempted_check) - unix_timestamp(master_instance.last_seen)) AS seconds_from_seen_to_last_attempted_check,
 						MIN(master_instance.last_check_partial_success) as last_check_partial_success,
+						MIN(master_instance.last_seen) as last_seen,
 		        MIN(master_instance.master_host IN ('' , '_')
 		            OR master_instance.master_port = 0
 								OR substr(master_instance.master_host, 1, 2) = '//') AS is_master,
@@ -128,6 +134,9 @@ func GetReplicationAnalysis(clusterName string, hints *ReplicationAnalysisHints)
 		            AND master_instance.slave_io_running = 0
 		            AND master_instance.last_io_error like '%%error %%connecting to master%%'
 		          ) AS is_failing_to_connect_to_master,
+		        MIN(master_instance.last_io_errno) AS last_io_errno,
+		        MIN(master_instance.last_sql_errno) AS last_sql_errno,
+		        MIN(master_instance.last_io_error) AS last_io_error,
 						MIN(
 								master_downtime.downtime_active is not null
 								and ifnull(master_downtime.end_timestamp, now()) > now()
@@ -184,6 +193,16 @@ func GetReplicationAnalysis(clusterName string, hints *ReplicationAnalysisHints)
               0) AS count_delayed_replicas,
 						IFNULL(SUM(replica_instance.slave_lag_seconds > ?),
               0) AS count_lagging_replicas,
+						MIN(master_instance.write_probe_failing) AS is_write_probe_failing,
+						MIN(master_instance.read_only) AS read_only,
+						MIN(IFNULL(cluster_writable.count_writable, 0)) AS count_writable_cluster_members,
+						IFNULL(SUM(replica_instance.last_checked <= replica_instance.last_seen
+								AND replica_instance.slave_io_running != 0
+								AND replica_instance.slave_sql_running != 0
+								AND master_instance.write_probe_value > 0
+								AND replica_instance.replicated_write_probe_value < master_instance.write_probe_value - ? * 1000000000
+								AND replica_instance.slave_lag_seconds <= ?),
+              0) AS count_replicas_missing_write_probe,
 						IFNULL(MIN(replica_instance.gtid_mode), '')
               AS min_replica_gtid_mode,
 						IFNULL(MAX(replica_instance.gtid_mode), '')
@@ -220,6 +239,19 @@ func GetReplicationAnalysis(clusterName string, hints *ReplicationAnalysisHints)
 		        		AND replica_downtime.downtime_active = 1)
         	LEFT JOIN
 		        cluster_alias ON (cluster_alias.cluster_name = master_instance.cluster_name)
+					LEFT JOIN (
+							SELECT
+								cluster_name,
+								COUNT(*) AS count_writable
+							FROM
+								database_instance
+							WHERE
+								read_only = 0
+								AND binlog_server = 0
+								AND last_checked <= last_seen
+							GROUP BY
+								cluster_name
+						) AS cluster_writable ON (cluster_writable.cluster_name = master_instance.cluster_name)
 		    WHERE
 		    	database_instance_maintenance.database_instance_maintenance_id IS NULL
 		    	AND ? IN ('', master_instance.cluster_name)
@@ -250,6 +282,7 @@ func GetReplicationAnalysis(clusterName string, hints *ReplicationAnalysisHints)
 		a.GTIDMode = m.GetString("gtid_mode")
 		a.LastCheckValid = m.GetBool("is_last_check_valid")
 		a.LastCheckPartialSuccess = m.GetBool("last_check_partial_success")
+		a.LastSeenTimestamp = m.GetString("last_seen")
 		a.CountReplicas = m.GetUint("count_slaves")
 		a.CountValidReplicas = m.GetUint("count_valid_slaves")
 		a.CountValidReplicatingReplicas = m.GetUint("count_valid_replicating_slaves")
@@ -257,6 +290,7 @@ func GetReplicationAnalysis(clusterName string, hints *ReplicationAnalysisHints)
 		a.CountDowntimedReplicas = m.GetUint("count_downtimed_replicas")
 		a.ReplicationDepth = m.GetUint("replication_depth")
 		a.IsFailingToConnectToMaster = m.GetBool("is_failing_to_connect_to_master")
+		a.ReplicationCorruption = GetReplicationCorruption(m.GetUint("last_io_errno"), m.GetUint("last_sql_errno"), m.GetString("last_io_error"))
 		a.IsDowntimed = m.GetBool("is_downtimed")
 		a.DowntimeEndTimestamp = m.GetString("downtime_end_timestamp")
 		a.DowntimeRemainingSeconds = m.GetInt("downtime_remaining_seconds")
@@ -284,6 +318,20 @@ func GetReplicationAnalysis(clusterName string, hints *ReplicationAnalysisHints)
 
 		a.CountDelayedReplicas = m.GetUint("count_delayed_replicas")
 		a.CountLaggingReplicas = m.GetUint("count_lagging_replicas")
+		a.IsWriteProbeFailing = m.GetBool("is_write_probe_failing")
+		a.CountReplicasMissingWriteProbe = m.GetUint("count_replicas_missing_write_probe")
+		a.IsReadOnly = m.GetBool("read_only")
+		a.CountWritableClusterMembers = m.GetUint("count_writable_cluster_members")
+
+		thresholds := NewDetectionThresholds(a.ClusterDetails.ClusterName, a.ClusterDetails.ClusterAlias)
+		if !a.LastCheckValid && thresholds.FailedPolls > 1 {
+			// The detection profile tolerates more than a single failed poll
+			secondsFromSeenToLastCheck := m.GetNullInt64("seconds_from_seen_to_last_check")
+			secondsFromSeenToLastAttemptedCheck := m.GetNullInt64("seconds_from_seen_to_last_attempted_check")
+			if secondsFromSeenToLastCheck.Valid && secondsFromSeenToLastAttemptedCheck.Valid {
+				a.LastCheckValid = thresholds.isLastCheckValid(secondsFromSeenToLastCheck.Int64, secondsFromSeenToLastAttemptedCheck.Int64)
+			}
+		}
 
 		if !a.LastCheckValid {
 			analysisMessage := fmt.Sprintf("analysis: IsMaster: %+v, LastCheckValid: %+v, LastCheckPartialSuccess: %+v, CountReplicas: %+v, CountValidReplicatingReplicas: %+v, CountLaggingReplicas: %+v, CountDelayedReplicas: %+v, ",
@@ -317,6 +365,10 @@ func GetReplicationAnalysis(clusterName string, hints *ReplicationAnalysisHints)
 			a.Analysis = UnreachableMaster
 			a.Description = "Master cannot be reached by orchestrator but it has replicating replicas; possibly a network/host issue"
 			//
+		} else if a.IsMaster && a.LastCheckValid && a.IsWriteProbeFailing {
+			a.Analysis = MasterNotWritable
+			a.Description = "Master is reachable but its write probe fails"
+			//
 		} else if a.IsMaster && a.LastCheckValid && a.CountReplicas == 1 && a.CountValidReplicas == a.CountReplicas && a.CountValidReplicatingReplicas == 0 {
 			a.Analysis = MasterSingleSlaveNotReplicating
 			a.Description = "Master is reachable but its single slave is not replicating"
@@ -333,6 +385,10 @@ func GetReplicationAnalysis(clusterName string, hints *ReplicationAnalysisHints)
 			a.Analysis = AllMasterSlavesNotReplicatingOrDead
 			a.Description = "Master is reachable but none of its replicas is replicating"
 			//
+		} else if a.IsMaster && a.LastCheckValid && a.CountValidReplicatingReplicas > 0 && a.CountReplicasMissingWriteProbe == a.CountValidReplicatingReplicas {
+			a.Analysis = MasterWritesNotReplicating
+			a.Description = "Master is writable but its write probe does not reach any of its replicating replicas"
+			//
 		} else /* co-master */ if a.IsCoMaster && !a.LastCheckValid && a.CountReplicas > 0 && a.CountValidReplicas == a.CountReplicas && a.CountValidReplicatingReplicas == 0 {
 			a.Analysis = DeadCoMaster
 			a.Description = "Co-master cannot be reached by orchestrator and none of its replicas is replicating"
@@ -394,11 +450,24 @@ func GetReplicationAnalysis(clusterName string, hints *ReplicationAnalysisHints)
 			a.Analysis = FirstTierSlaveFailingToConnectToMaster
 			a.Description = "1st tier slave (directly replicating from topology master) is unable to connect to the master"
 			//
+		} else if !a.IsMaster && a.LastCheckValid && a.ReplicationCorruption == RelayLogCorruption {
+			a.Analysis = ReplicaRelayLogCorruption
+			a.Description = "Replica's relay log is corrupted; purging its relay logs and fetching anew from its master is expected to fix replication"
+			//
+		} else if !a.IsMaster && a.LastCheckValid && a.ReplicationCorruption == BinlogCorruption {
+			a.Analysis = ReplicaMasterBinlogCorruption
+			a.Description = "Replica cannot read its master's binary log, which seems to be corrupted; replica needs to replicate from elsewhere"
+			//
+		} else if !a.IsMaster && !a.IsCoMaster && a.LastCheckValid && !a.IsReadOnly && !a.IsBinlogServer && a.CountWritableClusterMembers > 1 {
+			a.Analysis = DualWritableMasters
+			a.Description = fmt.Sprintf("Cluster has %d writable servers; this server is writable while replicating, possibly following an incomplete failover", a.CountWritableClusterMembers)
+			//
 		}
 		//		 else if a.IsMaster && a.CountReplicas == 0 {
 		//			a.Analysis = MasterWithoutSlaves
 		//			a.Description = "Master has no replicas"
 		//		}
+		thresholds.applyReplicaCorroboration(&a)
 
 		appendAnalysis := func(analysis *ReplicationAnalysis) {
 			if a.Analysis == NoProblem && len(a.StructureAnalysis) == 0 && !hints.IncludeNoProblem {
@@ -458,7 +527,7 @@ func GetReplicationAnalysis(clusterName string, hints *ReplicationAnalysisHints)
 
 		if a.CountReplicas > 0 && hints.AuditAnalysis {
 			// Interesting enough for analysis
-			go auditInstanceAnalysisInChangelog(&a.AnalyzedInstanceKey, a.Analysis)
+			go auditInstanceAnalysisInChangelog(&a.AnalyzedInstanceKey, a.ClusterDetails.ClusterName, a.Analysis)
 		}
 		return nil
 	})
@@ -502,9 +571,13 @@ func getConcensusReplicationAnalysis(analysisEntries []ReplicationAnalysis) ([]R
 
 // auditInstanceAnalysisInChangelog will write down an instance's analysis in the database_instance_analysis_changelog table.
 // To not repeat recurring analysis code, the database_instance_last_analysis table is used, so that only changes to
-// analysis codes are written.
-func auditInstanceAnalysisInChangelog(instanceKey *InstanceKey, analysisCode AnalysisCode) error {
+// analysis codes are written. Changes are also recorded as analysis raised/cleared state events. Changes are subject to
+// hysteresis: a flapping analysis is not recorded until it persists.
+func auditInstanceAnalysisInChangelog(instanceKey *InstanceKey, clusterName string, analysisCode AnalysisCode) error {
+	analysisCode = applyAnalysisHysteresis(instanceKey, analysisCode)
+	var previousAnalysis interface{}
 	if lastWrittenAnalysis, found := recentInstantAnalysis.Get(instanceKey.DisplayString()); found {
+		previousAnalysis = lastWrittenAnalysis
 		if lastWrittenAnalysis == analysisCode {
 			// Surely nothing new.
 			// And let's expand the timeout
@@ -539,8 +612,9 @@ func auditInstanceAnalysisInChangelog(instanceKey *InstanceKey, analysisCode Ana
 		}
 		lastAnalysisChanged = (rows > 0)
 	}
+	lastAnalysisInserted := false
 	if !lastAnalysisChanged {
-		_, err := db.ExecOrchestrator(`
+		sqlResult, err := db.ExecOrchestrator(`
 			insert ignore into database_instance_last_analysis (
 					hostname, port, analysis_timestamp, analysis
 				) values (
@@ -552,8 +626,19 @@ func auditInstanceAnalysisInChangelog(instanceKey *InstanceKey, analysisCode Ana
 		if err != nil {
 			return log.Errore(err)
 		}
+		if rows, err := sqlResult.RowsAffected(); err == nil {
+			lastAnalysisInserted = (rows > 0)
+		}
 	}
 	recentInstantAnalysis.Set(instanceKey.DisplayString(), analysisCode, cache.DefaultExpiration)
+	if lastAnalysisChanged || (lastAnalysisInserted && analysisCode != NoProblem) {
+		data := map[string]interface{}{"analysis": analysisCode, "previousAnalysis": previousAnalysis}
+		if analysisCode == NoProblem {
+			RecordStateEvent(AnalysisClearedEvent, clusterName, instanceKey, data)
+		} else {
+			RecordStateEvent(AnalysisRaisedEvent, clusterName, instanceKey, data)
+		}
+	}
 	if !lastAnalysisChanged {
 		return nil
 	}
@@ -0,0 +1,257 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+// analysisHistoryReadMaxRows is the max number of archived analysis entries read at once
+const analysisHistoryReadMaxRows = 10000
+
+// AnalysisHistoryCycle is the set of analysis entries of a cluster, as archived by an analysis cycle which found
+// them changed. A cycle with no entries found nothing wrong with the cluster.
+type AnalysisHistoryCycle struct {
+	Timestamp time.Time
+	Entries   []ReplicationAnalysis
+}
+
+// analysisHistoryCluster is the latest archived analysis of a cluster
+type analysisHistoryCluster struct {
+	clusterName  string
+	clusterAlias string
+	signature    string
+}
+
+// archivedAnalysisHistoryClusters are the latest archived analysis of clusters with analysis entries, keyed by alias
+var archivedAnalysisHistoryClusters = make(map[string]*analysisHistoryCluster)
+var archivedAnalysisHistoryClustersMutex sync.Mutex
+
+// analysisHistorySignature identifies the analysis entries of a cluster, as far as archiving is concerned
+func analysisHistorySignature(analysisEntries []ReplicationAnalysis) string {
+	tokens := []string{}
+	for _, analysisEntry := range analysisEntries {
+		structureAnalysis := []string{}
+		for _, code := range analysisEntry.StructureAnalysis {
+			structureAnalysis = append(structureAnalysis, string(code))
+		}
+		sort.Strings(structureAnalysis)
+		tokens = append(tokens, fmt.Sprintf("%s/%s/%s", analysisEntry.AnalyzedInstanceKey.StringCode(), analysisEntry.Analysis, strings.Join(structureAnalysis, ",")))
+	}
+	sort.Strings(tokens)
+	return strings.Join(tokens, ";")
+}
+
+// analysisHistoryClusterKey is the key by which the archived analysis of an entry's cluster is tracked. The alias
+// outlives changes of the cluster's master.
+func analysisHistoryClusterKey(analysisEntry *ReplicationAnalysis) string {
+	if analysisEntry.ClusterDetails.ClusterAlias != "" {
+		return analysisEntry.ClusterDetails.ClusterAlias
+	}
+	return analysisEntry.ClusterDetails.ClusterName
+}
+
+// ArchiveReplicationAnalysis archives the entries of an analysis cycle, given AnalysisHistoryRetentionHours is set.
+// Only clusters whose entries changed since last archived are archived. A cluster whose entries are all gone is
+// archived with no entries.
+func ArchiveReplicationAnalysis(analysisEntries []ReplicationAnalysis) error {
+	if config.Config.AnalysisHistoryRetentionHours == 0 {
+		return nil
+	}
+	return archiveReplicationAnalysis(analysisEntries, time.Now())
+}
+
+func archiveReplicationAnalysis(analysisEntries []ReplicationAnalysis, timestamp time.Time) error {
+	entriesByCluster := make(map[string][]ReplicationAnalysis)
+	clusters := make(map[string]*analysisHistoryCluster)
+	for _, analysisEntry := range analysisEntries {
+		clusterKey := analysisHistoryClusterKey(&analysisEntry)
+		entriesByCluster[clusterKey] = append(entriesByCluster[clusterKey], analysisEntry)
+		clusters[clusterKey] = &analysisHistoryCluster{
+			clusterName:  analysisEntry.ClusterDetails.ClusterName,
+			clusterAlias: analysisEntry.ClusterDetails.ClusterAlias,
+		}
+	}
+
+	values := []string{}
+	args := sqlutils.Args()
+	addValues := func(cluster *analysisHistoryCluster, hostname string, port int, analysis AnalysisCode, entryJSON string) {
+		values = append(values, "(?, ?, ?, ?, ?, ?, ?)")
+		args = append(args, timestamp.Unix(), cluster.clusterName, cluster.clusterAlias, hostname, port, string(analysis), entryJSON)
+	}
+	// previousClusters are the archived clusters which change, so as to restore them should archiving fail
+	previousClusters := make(map[string]*analysisHistoryCluster)
+
+	archivedAnalysisHistoryClustersMutex.Lock()
+	for clusterKey, cluster := range clusters {
+		cluster.signature = analysisHistorySignature(entriesByCluster[clusterKey])
+		previousCluster := archivedAnalysisHistoryClusters[clusterKey]
+		if previousCluster != nil && previousCluster.signature == cluster.signature {
+			continue
+		}
+		for _, analysisEntry := range entriesByCluster[clusterKey] {
+			entryJSON, err := json.Marshal(analysisEntry)
+			if err != nil {
+				archivedAnalysisHistoryClustersMutex.Unlock()
+				return log.Errore(err)
+			}
+			addValues(cluster, analysisEntry.AnalyzedInstanceKey.Hostname, analysisEntry.AnalyzedInstanceKey.Port, analysisEntry.Analysis, string(entryJSON))
+		}
+		previousClusters[clusterKey] = previousCluster
+		archivedAnalysisHistoryClusters[clusterKey] = cluster
+	}
+	for clusterKey, previousCluster := range archivedAnalysisHistoryClusters {
+		if _, found := clusters[clusterKey]; !found {
+			// All clear
+			addValues(previousCluster, "", 0, NoProblem, "")
+			previousClusters[clusterKey] = previousCluster
+			delete(archivedAnalysisHistoryClusters, clusterKey)
+		}
+	}
+	archivedAnalysisHistoryClustersMutex.Unlock()
+
+	if len(values) == 0 {
+		return nil
+	}
+	writeFunc := func() error {
+		_, err := db.ExecOrchestrator(`
+			insert into analysis_history (
+					analysis_unix_timestamp, cluster_name, cluster_alias, hostname, port, analysis, analysis_entry
+				) values
+			`+strings.Join(values, ", "), args...,
+		)
+		return log.Errore(err)
+	}
+	err := ExecDBWriteFunc(writeFunc)
+	if err != nil {
+		// Have the next cycle archive these clusters anew
+		archivedAnalysisHistoryClustersMutex.Lock()
+		for clusterKey, previousCluster := range previousClusters {
+			if previousCluster == nil {
+				delete(archivedAnalysisHistoryClusters, clusterKey)
+			} else {
+				archivedAnalysisHistoryClusters[clusterKey] = previousCluster
+			}
+		}
+		archivedAnalysisHistoryClustersMutex.Unlock()
+	}
+	return err
+}
+
+// ReadAnalysisHistory returns the archived analysis cycles of a cluster, by cluster name or alias, between
+// two points in time, oldest first. The alias matches the cluster's history across changes of its master,
+// and hence of its name. Since only changes are archived, the first cycle listed is the one in effect as of
+// the start of the period, which may precede it. At most analysisHistoryReadMaxRows entries are read.
+func ReadAnalysisHistory(clusterName string, clusterAlias string, from time.Time, to time.Time) (cycles []AnalysisHistoryCycle, err error) {
+	cycles = []AnalysisHistoryCycle{}
+	clusterCondition := `(cluster_name = ? or (cluster_alias != '' and cluster_alias = ?))`
+	since := from.Unix()
+	query := `
+		select
+				ifnull(max(analysis_unix_timestamp), ?) as since
+			from
+				analysis_history
+			where
+				` + clusterCondition + `
+				and analysis_unix_timestamp <= ?
+		`
+	err = db.QueryOrchestrator(query, sqlutils.Args(since, clusterName, clusterAlias, since), func(m sqlutils.RowMap) error {
+		since = m.GetInt64("since")
+		return nil
+	})
+	if err != nil {
+		return cycles, log.Errore(err)
+	}
+	query = `
+		select
+				analysis_unix_timestamp, analysis_entry
+			from
+				analysis_history
+			where
+				` + clusterCondition + `
+				and analysis_unix_timestamp >= ?
+				and analysis_unix_timestamp <= ?
+			order by
+				analysis_unix_timestamp asc, history_id asc
+			limit ?
+		`
+	args := sqlutils.Args(clusterName, clusterAlias, since, to.Unix(), analysisHistoryReadMaxRows)
+	err = db.QueryOrchestrator(query, args, func(m sqlutils.RowMap) error {
+		timestamp := time.Unix(m.GetInt64("analysis_unix_timestamp"), 0)
+		if len(cycles) == 0 || !cycles[len(cycles)-1].Timestamp.Equal(timestamp) {
+			cycles = append(cycles, AnalysisHistoryCycle{Timestamp: timestamp, Entries: []ReplicationAnalysis{}})
+		}
+		if m.GetString("analysis_entry") == "" {
+			return nil
+		}
+		analysisEntry := ReplicationAnalysis{}
+		if err := json.Unmarshal([]byte(m.GetString("analysis_entry")), &analysisEntry); err != nil {
+			return log.Errore(err)
+		}
+		cycles[len(cycles)-1].Entries = append(cycles[len(cycles)-1].Entries, analysisEntry)
+		return nil
+	})
+	return cycles, log.Errore(err)
+}
+
+// ExpireAnalysisHistory removes archived analysis entries older than AnalysisHistoryRetentionHours, as well as
+// the oldest entries beyond AnalysisHistoryMaxRows
+func ExpireAnalysisHistory() error {
+	if config.Config.AnalysisHistoryRetentionHours == 0 {
+		return nil
+	}
+	writeFunc := func() error {
+		_, err := db.ExecOrchestrator(`
+				delete from analysis_history
+				where analysis_unix_timestamp < ?
+				`, time.Now().Add(-time.Duration(config.Config.AnalysisHistoryRetentionHours)*time.Hour).Unix(),
+		)
+		if err != nil || config.Config.AnalysisHistoryMaxRows == 0 {
+			return log.Errore(err)
+		}
+		var newestExcessHistoryId int64
+		err = db.QueryOrchestrator(`
+				select history_id
+				from analysis_history
+				order by history_id desc
+				limit 1 offset ?
+				`, sqlutils.Args(config.Config.AnalysisHistoryMaxRows), func(m sqlutils.RowMap) error {
+			newestExcessHistoryId = m.GetInt64("history_id")
+			return nil
+		})
+		if err != nil || newestExcessHistoryId == 0 {
+			return log.Errore(err)
+		}
+		_, err = db.ExecOrchestrator(`
+				delete from analysis_history
+				where history_id <= ?
+				`, newestExcessHistoryId,
+		)
+		return log.Errore(err)
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
@@ -0,0 +1,143 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/openark/golib/sqlutils"
+	test "github.com/openark/golib/tests"
+)
+
+// withSQLiteBackend points the orchestrator backend at a fresh sqlite database for the duration of given test
+func withSQLiteBackend(t *testing.T) {
+	backendDB, dataFile := config.Config.BackendDB, config.Config.SQLite3DataFile
+	config.Config.BackendDB = "sqlite"
+	config.Config.SQLite3DataFile = filepath.Join(t.TempDir(), "orchestrator.sqlite3")
+	t.Cleanup(func() {
+		config.Config.BackendDB, config.Config.SQLite3DataFile = backendDB, dataFile
+	})
+}
+
+// withoutArchivedAnalysisHistory starts given test with no analysis archived so far
+func withoutArchivedAnalysisHistory(t *testing.T) {
+	resetArchivedClusters := func() {
+		archivedAnalysisHistoryClustersMutex.Lock()
+		defer archivedAnalysisHistoryClustersMutex.Unlock()
+		archivedAnalysisHistoryClusters = make(map[string]*analysisHistoryCluster)
+	}
+	resetArchivedClusters()
+	t.Cleanup(resetArchivedClusters)
+}
+
+func newHistoryAnalysisEntry(hostname string, clusterName string, clusterAlias string, analysis AnalysisCode) ReplicationAnalysis {
+	analysisEntry := ReplicationAnalysis{
+		AnalyzedInstanceKey: InstanceKey{Hostname: hostname, Port: 3306},
+		Analysis:            analysis,
+	}
+	analysisEntry.ClusterDetails.ClusterName = clusterName
+	analysisEntry.ClusterDetails.ClusterAlias = clusterAlias
+	return analysisEntry
+}
+
+func countAnalysisHistoryRows(t *testing.T) (count int) {
+	err := db.QueryOrchestrator(`select count(*) as count_rows from analysis_history`, nil, func(m sqlutils.RowMap) error {
+		count = m.GetInt("count_rows")
+		return nil
+	})
+	test.S(t).ExpectNil(err)
+	return count
+}
+
+func TestArchiveReplicationAnalysis(t *testing.T) {
+	withSQLiteBackend(t)
+	withoutArchivedAnalysisHistory(t)
+	start := time.Now().Add(-time.Hour)
+	deadMaster := newHistoryAnalysisEntry("history-master-1", "history-master-1:3306", "history", DeadMaster)
+	otherCluster := newHistoryAnalysisEntry("other-master", "other-master:3306", "other", UnreachableMaster)
+
+	test.S(t).ExpectNil(archiveReplicationAnalysis([]ReplicationAnalysis{deadMaster, otherCluster}, start))
+	test.S(t).ExpectEquals(countAnalysisHistoryRows(t), 2)
+	// Unchanged entries are not archived again
+	test.S(t).ExpectNil(archiveReplicationAnalysis([]ReplicationAnalysis{deadMaster, otherCluster}, start.Add(time.Minute)))
+	test.S(t).ExpectEquals(countAnalysisHistoryRows(t), 2)
+
+	// Following the failover, the cluster is renamed
+	lostReplica := newHistoryAnalysisEntry("history-replica", "history-master-2:3306", "history", AllMasterSlavesNotReplicating)
+	test.S(t).ExpectNil(archiveReplicationAnalysis([]ReplicationAnalysis{lostReplica, otherCluster}, start.Add(2*time.Minute)))
+	test.S(t).ExpectEquals(countAnalysisHistoryRows(t), 3)
+	// All clear
+	test.S(t).ExpectNil(archiveReplicationAnalysis([]ReplicationAnalysis{otherCluster}, start.Add(3*time.Minute)))
+	test.S(t).ExpectEquals(countAnalysisHistoryRows(t), 4)
+
+	{
+		cycles, err := ReadAnalysisHistory("history-master-2:3306", "history", start, start.Add(time.Hour))
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(len(cycles), 3)
+		test.S(t).ExpectEquals(cycles[0].Timestamp.Unix(), start.Unix())
+		test.S(t).ExpectEquals(len(cycles[0].Entries), 1)
+		test.S(t).ExpectEquals(cycles[0].Entries[0].Analysis, AnalysisCode(DeadMaster))
+		test.S(t).ExpectEquals(cycles[1].Entries[0].AnalyzedInstanceKey.Hostname, "history-replica")
+		test.S(t).ExpectEquals(len(cycles[2].Entries), 0)
+	}
+	{
+		// The cycle in effect at the start of the period is listed
+		cycles, err := ReadAnalysisHistory("history-master-2:3306", "history", start.Add(90*time.Second), start.Add(150*time.Second))
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(len(cycles), 2)
+		test.S(t).ExpectEquals(cycles[0].Timestamp.Unix(), start.Unix())
+		test.S(t).ExpectEquals(cycles[1].Timestamp.Unix(), start.Add(2*time.Minute).Unix())
+	}
+	{
+		cycles, err := ReadAnalysisHistory("other-master:3306", "", start.Add(time.Minute), start.Add(time.Hour))
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(len(cycles), 1)
+		test.S(t).ExpectEquals(cycles[0].Entries[0].Analysis, AnalysisCode(UnreachableMaster))
+	}
+}
+
+func TestExpireAnalysisHistory(t *testing.T) {
+	withSQLiteBackend(t)
+	withoutArchivedAnalysisHistory(t)
+	retentionHours, maxRows := config.Config.AnalysisHistoryRetentionHours, config.Config.AnalysisHistoryMaxRows
+	config.Config.AnalysisHistoryRetentionHours, config.Config.AnalysisHistoryMaxRows = 1, 3
+	defer func() {
+		config.Config.AnalysisHistoryRetentionHours, config.Config.AnalysisHistoryMaxRows = retentionHours, maxRows
+	}()
+
+	now := time.Now()
+	// Beyond retention
+	analysisEntry := newHistoryAnalysisEntry("expired-master", "expired-master:3306", "expired", DeadMaster)
+	test.S(t).ExpectNil(archiveReplicationAnalysis([]ReplicationAnalysis{analysisEntry}, now.Add(-2*time.Hour)))
+	for i, analysis := range []AnalysisCode{DeadMaster, UnreachableMaster, DeadMaster, UnreachableMaster, DeadMaster} {
+		analysisEntry := newHistoryAnalysisEntry("expiry-master", "expiry-master:3306", "expiry", analysis)
+		test.S(t).ExpectNil(archiveReplicationAnalysis([]ReplicationAnalysis{analysisEntry}, now.Add(time.Duration(i-4)*time.Minute)))
+	}
+	// The expired cluster's problem clears
+	test.S(t).ExpectEquals(countAnalysisHistoryRows(t), 7)
+
+	test.S(t).ExpectNil(ExpireAnalysisHistory())
+	test.S(t).ExpectEquals(countAnalysisHistoryRows(t), 3)
+	cycles, err := ReadAnalysisHistory("expiry-master:3306", "expiry", now.Add(-time.Hour), now)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(cycles), 3)
+	test.S(t).ExpectEquals(cycles[0].Timestamp.Unix(), now.Add(-2*time.Minute).Unix())
+}
@@ -0,0 +1,86 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"sync"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/patrickmn/go-cache"
+)
+
+// analysisHysteresisState is the analysis reported for an instance, along with a different analysis pending to replace it
+type analysisHysteresisState struct {
+	reportedAnalysis AnalysisCode
+	pendingAnalysis  AnalysisCode
+	pendingCycles    uint
+}
+
+// analysisHysteresisStates are kept per instance; an instance which is no longer analyzed is forgotten
+var analysisHysteresisStates = cache.New(time.Hour, time.Minute)
+var analysisHysteresisMutex sync.Mutex
+
+// recentNotifications are notifications sent within NotificationDeduplicationSeconds
+var recentNotifications = cache.New(cache.NoExpiration, time.Minute)
+
+// applyAnalysisHysteresis returns the analysis to report for an instance, given its analysis in the current cycle. A change
+// of analysis is only reported once it persists for consecutive cycles: as many as the new analysis's raise cycles, or,
+// when the change is into NoProblem, as many as the reported analysis's clear cycles. With no history of an instance,
+// e.g. on startup, its current analysis is reported as is.
+func applyAnalysisHysteresis(instanceKey *InstanceKey, analysisCode AnalysisCode) AnalysisCode {
+	analysisHysteresisMutex.Lock()
+	defer analysisHysteresisMutex.Unlock()
+
+	key := instanceKey.StringCode()
+	value, found := analysisHysteresisStates.Get(key)
+	if !found {
+		analysisHysteresisStates.Set(key, &analysisHysteresisState{reportedAnalysis: analysisCode}, cache.DefaultExpiration)
+		return analysisCode
+	}
+	state := value.(*analysisHysteresisState)
+	analysisHysteresisStates.Set(key, state, cache.DefaultExpiration)
+	if analysisCode == state.reportedAnalysis {
+		state.pendingAnalysis, state.pendingCycles = "", 0
+		return state.reportedAnalysis
+	}
+	if analysisCode == state.pendingAnalysis {
+		state.pendingCycles++
+	} else {
+		state.pendingAnalysis, state.pendingCycles = analysisCode, 1
+	}
+	requiredCycles, _ := config.Config.GetAnalysisHysteresis(string(analysisCode))
+	if analysisCode == NoProblem {
+		_, requiredCycles = config.Config.GetAnalysisHysteresis(string(state.reportedAnalysis))
+	}
+	if state.pendingCycles >= requiredCycles {
+		state.reportedAnalysis = analysisCode
+		state.pendingAnalysis, state.pendingCycles = "", 0
+	}
+	return state.reportedAnalysis
+}
+
+// IsDuplicateNotification checks whether an identical notification was sent within NotificationDeduplicationSeconds.
+// Otherwise, the notification is remembered as sent.
+func IsDuplicateNotification(notification string) bool {
+	if config.Config.NotificationDeduplicationSeconds == 0 {
+		return false
+	}
+	// Add fails when the notification is already remembered, and has not expired
+	err := recentNotifications.Add(notification, true, time.Duration(config.Config.NotificationDeduplicationSeconds)*time.Second)
+	return err != nil
+}
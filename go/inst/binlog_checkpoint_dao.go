@@ -0,0 +1,166 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+// BinlogCheckpoint is a master's binary log coordinates and executed GTID set, as recorded at a point in time
+type BinlogCheckpoint struct {
+	Key             InstanceKey
+	Timestamp       time.Time
+	Coordinates     BinlogCoordinates
+	ExecutedGtidSet string
+}
+
+// BinlogCheckpointRange brackets a point in time by the checkpoints recorded just before and just after it.
+// The master's coordinates at that time lie between those of the two checkpoints.
+type BinlogCheckpointRange struct {
+	Key       InstanceKey
+	Time      time.Time
+	Preceding *BinlogCheckpoint
+	Following *BinlogCheckpoint
+}
+
+// ParseCheckpointTime parses a point in time given as RFC3339 (e.g. 2017-03-01T14:32:00Z), as
+// "2006-01-02 15:04:05" in UTC, or as unix timestamp
+func ParseCheckpointTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02 15:04:05", value); err == nil {
+		return t, nil
+	}
+	if unixTimestamp, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(unixTimestamp, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("Cannot parse time: %s. Expected RFC3339, \"YYYY-MM-DD hh:mm:ss\" (UTC) or unix timestamp", value)
+}
+
+// WriteBinlogCheckpoints records the binary log coordinates and executed GTID set of all reachable masters,
+// as of the time they were last seen. Masters are top level instances, whether or not they have replicas, and
+// intermediate masters.
+func WriteBinlogCheckpoints() error {
+	writeFunc := func() error {
+		_, err := db.ExecOrchestrator(`
+			insert ignore into
+				database_instance_binlog_checkpoint (hostname, port, checkpoint_unix_timestamp,
+					binary_log_file, binary_log_pos, executed_gtid_set)
+			select
+				master_instance.hostname,
+				master_instance.port,
+				unix_timestamp(master_instance.last_seen),
+				master_instance.binary_log_file,
+				master_instance.binary_log_pos,
+				master_instance.executed_gtid_set
+			from
+				database_instance master_instance
+			where
+				master_instance.log_bin = 1
+				and master_instance.binary_log_file != ''
+				and master_instance.last_seen >= master_instance.last_checked
+				and (
+					master_instance.master_host = ''
+					or exists (
+						select 1
+						from database_instance replica_instance
+						where
+							replica_instance.master_host = master_instance.hostname
+							and replica_instance.master_port = master_instance.port
+					)
+				)
+			`,
+		)
+		return log.Errore(err)
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
+
+func readBinlogCheckpoint(query string, args []interface{}) (checkpoint *BinlogCheckpoint, err error) {
+	err = db.QueryOrchestrator(query, args, func(m sqlutils.RowMap) error {
+		checkpoint = &BinlogCheckpoint{}
+		checkpoint.Key.Hostname = m.GetString("hostname")
+		checkpoint.Key.Port = m.GetInt("port")
+		checkpoint.Timestamp = time.Unix(m.GetInt64("checkpoint_unix_timestamp"), 0)
+		checkpoint.Coordinates.LogFile = m.GetString("binary_log_file")
+		checkpoint.Coordinates.LogPos = m.GetInt64("binary_log_pos")
+		checkpoint.Coordinates.Type = BinaryLog
+		checkpoint.ExecutedGtidSet = m.GetString("executed_gtid_set")
+		return nil
+	})
+	return checkpoint, log.Errore(err)
+}
+
+// ReadBinlogCheckpointRange returns the checkpoints of given master recorded just before (or at) and just after
+// given time. Either may be nil if no such checkpoint was recorded.
+func ReadBinlogCheckpointRange(instanceKey *InstanceKey, t time.Time) (checkpointRange *BinlogCheckpointRange, err error) {
+	checkpointRange = &BinlogCheckpointRange{Key: *instanceKey, Time: t}
+	query := `
+		select
+				hostname, port, checkpoint_unix_timestamp, binary_log_file, binary_log_pos, executed_gtid_set
+			from
+				database_instance_binlog_checkpoint
+			where
+				hostname = ?
+				and port = ?
+				and checkpoint_unix_timestamp <= ?
+			order by
+				checkpoint_unix_timestamp desc
+			limit 1
+		`
+	if checkpointRange.Preceding, err = readBinlogCheckpoint(query, sqlutils.Args(instanceKey.Hostname, instanceKey.Port, t.Unix())); err != nil {
+		return checkpointRange, err
+	}
+	query = `
+		select
+				hostname, port, checkpoint_unix_timestamp, binary_log_file, binary_log_pos, executed_gtid_set
+			from
+				database_instance_binlog_checkpoint
+			where
+				hostname = ?
+				and port = ?
+				and checkpoint_unix_timestamp > ?
+			order by
+				checkpoint_unix_timestamp asc
+			limit 1
+		`
+	if checkpointRange.Following, err = readBinlogCheckpoint(query, sqlutils.Args(instanceKey.Hostname, instanceKey.Port, t.Unix())); err != nil {
+		return checkpointRange, err
+	}
+	return checkpointRange, nil
+}
+
+// ExpireBinlogCheckpoints removes checkpoints older than AuditPurgeDays
+func ExpireBinlogCheckpoints() error {
+	writeFunc := func() error {
+		_, err := db.ExecOrchestrator(`
+				delete from database_instance_binlog_checkpoint
+				where checkpoint_unix_timestamp < ?
+				`, time.Now().Add(-time.Duration(config.AuditPurgeDays)*24*time.Hour).Unix(),
+		)
+		return log.Errore(err)
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
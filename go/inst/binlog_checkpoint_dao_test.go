@@ -0,0 +1,89 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"testing"
+	"time"
+
+	"github.com/github/orchestrator/go/db"
+	"github.com/openark/golib/sqlutils"
+	test "github.com/openark/golib/tests"
+)
+
+// writeCheckpointTestInstance writes an instance with given master, last seen at given time
+func writeCheckpointTestInstance(t *testing.T, hostname string, masterHost string, binaryLogFile string, lastSeen time.Time) {
+	masterPort := 0
+	if masterHost != "" {
+		masterPort = 3306
+	}
+	_, err := db.ExecOrchestrator(`
+			insert into database_instance (
+				hostname, port, last_checked, last_seen, server_id, version, binlog_format,
+				log_bin, log_slave_updates, binary_log_file, binary_log_pos, executed_gtid_set, master_host, master_port,
+				slave_sql_running, slave_io_running, master_log_file, read_master_log_pos, relay_master_log_file,
+				exec_master_log_pos, num_slave_hosts, slave_hosts, cluster_name
+			) values (
+				?, 3306, ?, ?, 1, '5.7.26', 'ROW',
+				1, 1, ?, 4, '', ?, ?,
+				1, 1, '', 4, '',
+				4, 0, '[]', 'db-1:3306'
+			)
+		`, hostname, lastSeen.UTC().Format("2006-01-02 15:04:05"), lastSeen.UTC().Format("2006-01-02 15:04:05"), binaryLogFile, masterHost, masterPort,
+	)
+	test.S(t).ExpectNil(err)
+}
+
+func TestWriteBinlogCheckpoints(t *testing.T) {
+	withSQLiteBackend(t)
+
+	lastSeen := time.Now().Add(-10 * time.Minute).Truncate(time.Second)
+	// a master with no replicas, an intermediate master, and a replica
+	writeCheckpointTestInstance(t, "db-1", "", "mysql-bin.000007", lastSeen)
+	writeCheckpointTestInstance(t, "db-2", "db-1", "mysql-bin.000003", lastSeen)
+	writeCheckpointTestInstance(t, "db-3", "db-2", "mysql-bin.000005", lastSeen)
+	// a replica of an unknown master
+	writeCheckpointTestInstance(t, "db-4", "db-9", "mysql-bin.000002", lastSeen)
+
+	test.S(t).ExpectNil(WriteBinlogCheckpoints())
+	// unchanged instances are not checkpointed twice
+	test.S(t).ExpectNil(WriteBinlogCheckpoints())
+
+	for _, hostname := range []string{"db-1", "db-2"} {
+		checkpointRange, err := ReadBinlogCheckpointRange(&InstanceKey{Hostname: hostname, Port: 3306}, time.Now())
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectNotNil(checkpointRange.Preceding)
+		test.S(t).ExpectTrue(checkpointRange.Following == nil)
+		test.S(t).ExpectEquals(checkpointRange.Preceding.Timestamp.Unix(), lastSeen.Unix())
+	}
+	checkpointRange, err := ReadBinlogCheckpointRange(&InstanceKey{Hostname: "db-1", Port: 3306}, time.Now())
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(checkpointRange.Preceding.Coordinates.LogFile, "mysql-bin.000007")
+	for _, hostname := range []string{"db-3", "db-4"} {
+		checkpointRange, err := ReadBinlogCheckpointRange(&InstanceKey{Hostname: hostname, Port: 3306}, time.Now())
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectTrue(checkpointRange.Preceding == nil)
+	}
+
+	var countCheckpoints int
+	err = db.QueryOrchestrator(`select count(*) as count_checkpoints from database_instance_binlog_checkpoint`, nil, func(m sqlutils.RowMap) error {
+		countCheckpoints = m.GetInt("count_checkpoints")
+		return nil
+	})
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(countCheckpoints, 2)
+}
@@ -0,0 +1,79 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/openark/golib/log"
+	"github.com/patrickmn/go-cache"
+)
+
+// LocalPseudoGTIDSearchFunc searches for a Pseudo-GTID entry in the binary logs of an instance locally on the instance's
+// host, such that only the resulting coordinates travel over the network. Like SearchEntryInInstanceBinlogs, the search
+// goes backwards from the instance's latest binary log, starting with minBinlogCoordinates if given.
+type LocalPseudoGTIDSearchFunc func(instance *Instance, entryText string, monotonicPseudoGTIDEntries bool, minBinlogCoordinates *BinlogCoordinates) (coordinates *BinlogCoordinates, found bool, err error)
+
+var localPseudoGTIDSearchFunc LocalPseudoGTIDSearchFunc
+var localPseudoGTIDSearchMutex sync.RWMutex
+
+// localPseudoGTIDSearchFailedHosts are hosts on which a local search recently failed, e.g. as their agent does
+// not serve AgentPseudoGTIDSearchCommand. They are not searched locally until the entry expires.
+var localPseudoGTIDSearchFailedHosts = cache.New(localPseudoGTIDSearchFailedHostsExpiration, time.Minute)
+
+const localPseudoGTIDSearchFailedHostsExpiration = 10 * time.Minute
+
+// RegisterLocalPseudoGTIDSearch registers the service searching binary logs locally on instances' hosts
+func RegisterLocalPseudoGTIDSearch(searchFunc LocalPseudoGTIDSearchFunc) {
+	localPseudoGTIDSearchMutex.Lock()
+	defer localPseudoGTIDSearchMutex.Unlock()
+	localPseudoGTIDSearchFunc = searchFunc
+}
+
+// searchEntryViaLocalPseudoGTIDSearch searches for a Pseudo-GTID entry via the local search service, given
+// AgentPseudoGTIDSearchCommand. found is false when the search did not take place, failed, or did not find the entry;
+// the caller then scans the binary logs over the MySQL protocol. A local search which does not find the entry is
+// not trusted, as the service may not see all binary logs the MySQL protocol does.
+func searchEntryViaLocalPseudoGTIDSearch(instance *Instance, entryText string, monotonicPseudoGTIDEntries bool, minBinlogCoordinates *BinlogCoordinates) (coordinates *BinlogCoordinates, found bool) {
+	if config.Config.AgentPseudoGTIDSearchCommand == "" {
+		return nil, false
+	}
+	localPseudoGTIDSearchMutex.RLock()
+	searchFunc := localPseudoGTIDSearchFunc
+	localPseudoGTIDSearchMutex.RUnlock()
+	if searchFunc == nil {
+		return nil, false
+	}
+	if _, failed := localPseudoGTIDSearchFailedHosts.Get(instance.Key.Hostname); failed {
+		return nil, false
+	}
+	startTime := time.Now()
+	coordinates, found, err := searchFunc(instance, entryText, monotonicPseudoGTIDEntries, minBinlogCoordinates)
+	if err == nil && found && (coordinates == nil || coordinates.LogFile == "") {
+		err = fmt.Errorf("no coordinates returned")
+	}
+	if err != nil {
+		log.Warningf("Local Pseudo-GTID search on %+v failed; will scan binary logs over MySQL protocol, and not search locally on %s for %+v. err: %+v", instance.Key, instance.Key.Hostname, localPseudoGTIDSearchFailedHostsExpiration, err)
+		localPseudoGTIDSearchFailedHosts.Set(instance.Key.Hostname, true, cache.DefaultExpiration)
+		return nil, false
+	}
+	log.Debugf("Local Pseudo-GTID search on %+v: found=%+v in %+v", instance.Key, found, time.Since(startTime))
+	return coordinates, found
+}
@@ -0,0 +1,88 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/github/orchestrator/go/config"
+	test "github.com/openark/golib/tests"
+)
+
+// withLocalPseudoGTIDSearch configures and registers given local search, for the duration of given test
+func withLocalPseudoGTIDSearch(t *testing.T, searchFunc LocalPseudoGTIDSearchFunc) {
+	command, registered := config.Config.AgentPseudoGTIDSearchCommand, localPseudoGTIDSearchFunc
+	config.Config.AgentPseudoGTIDSearchCommand = "mysql-binlog-search"
+	RegisterLocalPseudoGTIDSearch(searchFunc)
+	localPseudoGTIDSearchFailedHosts.Flush()
+	t.Cleanup(func() {
+		config.Config.AgentPseudoGTIDSearchCommand = command
+		RegisterLocalPseudoGTIDSearch(registered)
+		localPseudoGTIDSearchFailedHosts.Flush()
+	})
+}
+
+func TestSearchEntryViaLocalPseudoGTIDSearch(t *testing.T) {
+	instance := &Instance{Key: InstanceKey{Hostname: "db-1", Port: 3306}}
+	results := map[string]*BinlogCoordinates{"found": {LogFile: "mysql-bin.000123", LogPos: 4567}}
+	searches := 0
+	withLocalPseudoGTIDSearch(t, func(instance *Instance, entryText string, monotonicPseudoGTIDEntries bool, minBinlogCoordinates *BinlogCoordinates) (*BinlogCoordinates, bool, error) {
+		searches++
+		if entryText == "failed" {
+			return nil, false, fmt.Errorf("unexpected response")
+		}
+		coordinates, found := results[entryText]
+		return coordinates, found, nil
+	})
+
+	coordinates, found := searchEntryViaLocalPseudoGTIDSearch(instance, "found", false, nil)
+	test.S(t).ExpectTrue(found)
+	test.S(t).ExpectEquals(*coordinates, *results["found"])
+
+	// The agent not finding the entry is not authoritative: the caller scans the binary logs
+	_, found = searchEntryViaLocalPseudoGTIDSearch(instance, "missing", false, nil)
+	test.S(t).ExpectFalse(found)
+	test.S(t).ExpectEquals(searches, 2)
+
+	// After a failed search, the host is not searched locally for a while
+	_, found = searchEntryViaLocalPseudoGTIDSearch(instance, "failed", false, nil)
+	test.S(t).ExpectFalse(found)
+	_, found = searchEntryViaLocalPseudoGTIDSearch(instance, "found", false, nil)
+	test.S(t).ExpectFalse(found)
+	test.S(t).ExpectEquals(searches, 3)
+
+	other := &Instance{Key: InstanceKey{Hostname: "db-2", Port: 3306}}
+	_, found = searchEntryViaLocalPseudoGTIDSearch(other, "found", false, nil)
+	test.S(t).ExpectTrue(found)
+
+	config.Config.AgentPseudoGTIDSearchCommand = ""
+	_, found = searchEntryViaLocalPseudoGTIDSearch(other, "found", false, nil)
+	test.S(t).ExpectFalse(found)
+	test.S(t).ExpectEquals(searches, 4)
+}
+
+func TestSearchEntryViaLocalPseudoGTIDSearchNoCoordinates(t *testing.T) {
+	instance := &Instance{Key: InstanceKey{Hostname: "db-1", Port: 3306}}
+	withLocalPseudoGTIDSearch(t, func(instance *Instance, entryText string, monotonicPseudoGTIDEntries bool, minBinlogCoordinates *BinlogCoordinates) (*BinlogCoordinates, bool, error) {
+		return &BinlogCoordinates{}, true, nil
+	})
+	_, found := searchEntryViaLocalPseudoGTIDSearch(instance, "found", false, nil)
+	test.S(t).ExpectFalse(found)
+	_, failed := localPseudoGTIDSearchFailedHosts.Get("db-1")
+	test.S(t).ExpectTrue(failed)
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/openark/golib/log"
 	test "github.com/openark/golib/tests"
 	"testing"
+	"time"
 )
 
 var testCoordinates = BinlogCoordinates{LogFile: "mysql-bin.000010", LogPos: 108}
@@ -135,3 +136,14 @@ func TestFileNumber(t *testing.T) {
 	test.S(t).ExpectEquals(fileNum, 17)
 	test.S(t).ExpectEquals(numLen, 5)
 }
+
+func TestParseCheckpointTime(t *testing.T) {
+	expected := time.Date(2017, 3, 1, 14, 32, 0, 0, time.UTC)
+	for _, value := range []string{"2017-03-01T14:32:00Z", "2017-03-01T16:32:00+02:00", "2017-03-01 14:32:00", "1488378720"} {
+		parsed, err := ParseCheckpointTime(value)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectTrue(parsed.Equal(expected))
+	}
+	_, err := ParseCheckpointTime("14:32")
+	test.S(t).ExpectNotNil(err)
+}
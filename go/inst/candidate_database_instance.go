@@ -18,6 +18,7 @@ package inst
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/github/orchestrator/go/db"
 )
@@ -28,6 +29,7 @@ type CandidateDatabaseInstance struct {
 	Port                int
 	PromotionRule       CandidatePromotionRule
 	LastSuggestedString string
+	ExpiresAtString     string // empty for the default expiry, CandidateInstanceExpireMinutes past last suggestion
 }
 
 func NewCandidateDatabaseInstance(instanceKey *InstanceKey, promotionRule CandidatePromotionRule) *CandidateDatabaseInstance {
@@ -43,6 +45,12 @@ func (cdi *CandidateDatabaseInstance) WithCurrentTime() *CandidateDatabaseInstan
 	return cdi
 }
 
+// WithTTL sets the promotion rule to expire given number of seconds past its suggestion time
+func (cdi *CandidateDatabaseInstance) WithTTL(ttlSeconds uint) *CandidateDatabaseInstance {
+	cdi.ExpiresAtString = AddSecondsToTimeString(cdi.LastSuggestedString, ttlSeconds)
+	return cdi
+}
+
 // String returns a string representation of the CandidateDatabaseInstance struct
 func (cdi *CandidateDatabaseInstance) String() string {
 	return fmt.Sprintf("%s:%d %s", cdi.Hostname, cdi.Port, cdi.PromotionRule)
@@ -52,3 +60,44 @@ func (cdi *CandidateDatabaseInstance) String() string {
 func (cdi *CandidateDatabaseInstance) Key() *InstanceKey {
 	return &InstanceKey{Hostname: cdi.Hostname, Port: cdi.Port}
 }
+
+// CandidatePromotionRuleOverride is a temporary promotion rule for an instance, which takes precedence over
+// the instance's registered promotion rule until it expires
+type CandidatePromotionRuleOverride struct {
+	Key             InstanceKey
+	PromotionRule   CandidatePromotionRule
+	Reason          string
+	Owner           string
+	OverrideString  string
+	ExpiresAtString string
+}
+
+// NewCandidatePromotionRuleOverride returns an override of given instance's promotion rule, expiring
+// given number of seconds from now
+func NewCandidatePromotionRuleOverride(instanceKey *InstanceKey, promotionRule CandidatePromotionRule, durationSeconds uint, reason string, owner string) *CandidatePromotionRuleOverride {
+	override := &CandidatePromotionRuleOverride{
+		Key:           *instanceKey,
+		PromotionRule: promotionRule,
+		Reason:        reason,
+		Owner:         owner,
+	}
+	override.OverrideString, _ = db.ReadTimeNow()
+	override.ExpiresAtString = AddSecondsToTimeString(override.OverrideString, durationSeconds)
+	return override
+}
+
+// String returns a string representation of the override
+func (override *CandidatePromotionRuleOverride) String() string {
+	return fmt.Sprintf("%s %s until %s", override.Key.DisplayString(), override.PromotionRule, override.ExpiresAtString)
+}
+
+// AddSecondsToTimeString adds seconds to a backend time string, as returned by db.ReadTimeNow().
+// It returns an empty string if given string cannot be parsed.
+func AddSecondsToTimeString(timeString string, seconds uint) string {
+	const layout = "2006-01-02 15:04:05"
+	t, err := time.Parse(layout, timeString)
+	if err != nil {
+		return ""
+	}
+	return t.Add(time.Duration(seconds) * time.Second).Format(layout)
+}
@@ -31,22 +31,29 @@ func RegisterCandidateInstance(candidate *CandidateDatabaseInstance) error {
 	if candidate.LastSuggestedString == "" {
 		candidate = candidate.WithCurrentTime()
 	}
-	args := sqlutils.Args(candidate.Hostname, candidate.Port, string(candidate.PromotionRule), candidate.LastSuggestedString)
+	var expiresAt interface{}
+	if candidate.ExpiresAtString != "" {
+		expiresAt = candidate.ExpiresAtString
+	}
+	args := sqlutils.Args(candidate.Hostname, candidate.Port, string(candidate.PromotionRule), candidate.LastSuggestedString, expiresAt)
 
 	query := fmt.Sprintf(`
 			insert into candidate_database_instance (
 					hostname,
 					port,
 					promotion_rule,
-					last_suggested
+					last_suggested,
+					expires_at
 				) values (
-					?, ?, ?, ?
+					?, ?, ?, ?, ?
 				) on duplicate key update
 					last_suggested=values(last_suggested),
-					promotion_rule=values(promotion_rule)
+					promotion_rule=values(promotion_rule),
+					expires_at=values(expires_at)
 			`)
 	writeFunc := func() error {
 		_, err := db.ExecOrchestrator(query, args...)
+		clusterInstancesCache.invalidateInstance(candidate.Key())
 		AuditOperation("register-candidate", candidate.Key(), string(candidate.PromotionRule))
 		return log.Errore(err)
 	}
@@ -56,12 +63,20 @@ func RegisterCandidateInstance(candidate *CandidateDatabaseInstance) error {
 // ExpireCandidateInstances removes stale master candidate suggestions.
 func ExpireCandidateInstances() error {
 	writeFunc := func() error {
-		_, err := db.ExecOrchestrator(`
+		res, err := db.ExecOrchestrator(`
 				delete from candidate_database_instance
-				where last_suggested < NOW() - INTERVAL ? MINUTE
+				where
+					(expires_at is null and last_suggested < NOW() - INTERVAL ? MINUTE)
+					or expires_at < NOW()
 				`, config.Config.CandidateInstanceExpireMinutes,
 		)
-		return log.Errore(err)
+		if err != nil {
+			return log.Errore(err)
+		}
+		if rowsAffected, _ := res.RowsAffected(); rowsAffected > 0 {
+			clusterInstancesCache.invalidateAll()
+		}
+		return nil
 	}
 	return ExecDBWriteFunc(writeFunc)
 }
@@ -87,7 +102,8 @@ func BulkReadCandidateDatabaseInstance() ([]CandidateDatabaseInstance, error) {
 			hostname,
 			port,
 			promotion_rule,
-			last_suggested
+			last_suggested,
+			ifnull(expires_at, '') as expires_at
 		FROM
 			candidate_database_instance
 	`
@@ -97,6 +113,10 @@ func BulkReadCandidateDatabaseInstance() ([]CandidateDatabaseInstance, error) {
 			Port:                m.GetInt("port"),
 			PromotionRule:       CandidatePromotionRule(m.GetString("promotion_rule")),
 			LastSuggestedString: m.GetString("last_suggested"),
+			ExpiresAtString:     m.GetString("expires_at"),
+		}
+		if cdi.ExpiresAtString == "" {
+			cdi.ExpiresAtString = AddSecondsToTimeString(cdi.LastSuggestedString, config.Config.CandidateInstanceExpireMinutes*60)
 		}
 		// add to end of candidateDatabaseInstances
 		candidateDatabaseInstances = append(candidateDatabaseInstances, cdi)
@@ -105,3 +125,94 @@ func BulkReadCandidateDatabaseInstance() ([]CandidateDatabaseInstance, error) {
 	})
 	return candidateDatabaseInstances, err
 }
+
+// WriteCandidatePromotionRuleOverride temporarily overrides the promotion rule of an instance. The override
+// takes precedence over the instance's registered promotion rule, and reverts upon expiry.
+func WriteCandidatePromotionRuleOverride(override *CandidatePromotionRuleOverride) error {
+	if override.ExpiresAtString == "" {
+		return fmt.Errorf("WriteCandidatePromotionRuleOverride: no expiry given for %+v", override.Key)
+	}
+	writeFunc := func() error {
+		_, err := db.ExecOrchestrator(`
+				replace into candidate_database_instance_override (
+						hostname, port, override_promotion_rule, override_reason, override_owner, override_timestamp, override_expires_at
+					) values (
+						?, ?, ?, ?, ?, ?, ?
+					)
+				`, override.Key.Hostname, override.Key.Port, string(override.PromotionRule), override.Reason, override.Owner, override.OverrideString, override.ExpiresAtString,
+		)
+		clusterInstancesCache.invalidateInstance(&override.Key)
+		AuditOperation("override-promotion-rule", &override.Key, fmt.Sprintf("%s until %s; reason: %s", override.PromotionRule, override.ExpiresAtString, override.Reason))
+		return log.Errore(err)
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
+
+// DeleteCandidatePromotionRuleOverride removes the promotion rule override of an instance, reverting to its
+// registered promotion rule
+func DeleteCandidatePromotionRuleOverride(instanceKey *InstanceKey) error {
+	writeFunc := func() error {
+		_, err := db.ExecOrchestrator(`
+				delete from candidate_database_instance_override
+				where hostname = ? and port = ?
+				`, instanceKey.Hostname, instanceKey.Port,
+		)
+		clusterInstancesCache.invalidateInstance(instanceKey)
+		AuditOperation("clear-promotion-rule-override", instanceKey, "")
+		return log.Errore(err)
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
+
+// ExpireCandidatePromotionRuleOverrides removes expired promotion rule overrides
+func ExpireCandidatePromotionRuleOverrides() error {
+	writeFunc := func() error {
+		res, err := db.ExecOrchestrator(`
+				delete from candidate_database_instance_override
+				where override_expires_at < NOW()
+				`,
+		)
+		if err != nil {
+			return log.Errore(err)
+		}
+		if rowsAffected, _ := res.RowsAffected(); rowsAffected > 0 {
+			clusterInstancesCache.invalidateAll()
+		}
+		return nil
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
+
+// ReadCandidatePromotionRuleOverrides reads active promotion rule overrides
+func ReadCandidatePromotionRuleOverrides() ([]CandidatePromotionRuleOverride, error) {
+	overrides := []CandidatePromotionRuleOverride{}
+	query := `
+		select
+			hostname,
+			port,
+			override_promotion_rule,
+			override_reason,
+			override_owner,
+			override_timestamp,
+			override_expires_at
+		from
+			candidate_database_instance_override
+		where
+			override_expires_at > NOW()
+		order by
+			hostname, port
+	`
+	err := db.QueryOrchestrator(query, nil, func(m sqlutils.RowMap) error {
+		override := CandidatePromotionRuleOverride{
+			Key:             InstanceKey{Hostname: m.GetString("hostname"), Port: m.GetInt("port")},
+			PromotionRule:   CandidatePromotionRule(m.GetString("override_promotion_rule")),
+			Reason:          m.GetString("override_reason"),
+			Owner:           m.GetString("override_owner"),
+			OverrideString:  m.GetString("override_timestamp"),
+			ExpiresAtString: m.GetString("override_expires_at"),
+		}
+		overrides = append(overrides, override)
+		return nil
+	})
+	return overrides, log.Errore(err)
+}
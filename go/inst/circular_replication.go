@@ -0,0 +1,160 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"sort"
+)
+
+// maxReplicationCircleSize limits the walk up a replication chain when looking for circular replication
+const maxReplicationCircleSize = 16
+
+// CircularReplication describes instances replicating from each other in a circle: a co-master pair, or
+// a larger replication ring. The active member is the single writable member of the circle.
+type CircularReplication struct {
+	ClusterName     string
+	Members         []InstanceKey
+	WritableMembers []InstanceKey
+	ActiveMasterKey *InstanceKey
+}
+
+// IsRing returns true when the circle is made of more than two members
+func (this *CircularReplication) IsRing() bool {
+	return len(this.Members) > 2
+}
+
+// HasMultipleWritableMembers returns true when more than a single member of the circle is writable,
+// in which case no member can be identified as active, and writes may conflict
+func (this *CircularReplication) HasMultipleWritableMembers() bool {
+	return len(this.WritableMembers) > 1
+}
+
+// HasMember checks whether given instance participates in the circle
+func (this *CircularReplication) HasMember(instanceKey *InstanceKey) bool {
+	for _, member := range this.Members {
+		if member.Equals(instanceKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// getReplicationCircle walks up the replication chain of given instance, and returns the members of the
+// circle the instance participates in, or an empty list if the chain does not return to the instance.
+// Members are listed in replication order: each member replicates from the one preceding it, and the
+// first member replicates from the last.
+func getReplicationCircle(instanceKey InstanceKey, getMasterKey func(instanceKey InstanceKey) (masterKey InstanceKey, found bool)) (members []InstanceKey) {
+	chain := []InstanceKey{instanceKey}
+	currentKey := instanceKey
+	for len(chain) <= maxReplicationCircleSize {
+		masterKey, found := getMasterKey(currentKey)
+		if !found || !masterKey.IsValid() {
+			return members
+		}
+		if masterKey.Equals(&instanceKey) {
+			// Back where we started. chain is listed bottom-up; reverse into replication order
+			for i := len(chain) - 1; i >= 0; i-- {
+				members = append(members, chain[i])
+			}
+			return members
+		}
+		for _, key := range chain {
+			if masterKey.Equals(&key) {
+				// A circle upstream of our instance, which our instance does not participate in
+				return members
+			}
+		}
+		chain = append(chain, masterKey)
+		currentKey = masterKey
+	}
+	return members
+}
+
+// findCircularReplications identifies the replication circles among given instances
+func findCircularReplications(instances [](*Instance)) (circularReplications [](*CircularReplication)) {
+	instancesMap := make(map[InstanceKey]*Instance)
+	for _, instance := range instances {
+		instancesMap[instance.Key] = instance
+	}
+	getMasterKey := func(instanceKey InstanceKey) (InstanceKey, bool) {
+		instance, found := instancesMap[instanceKey]
+		if !found {
+			return InstanceKey{}, false
+		}
+		return instance.MasterKey, true
+	}
+
+	inCircle := make(map[InstanceKey]bool)
+	sortedInstances := [](*Instance){}
+	sortedInstances = append(sortedInstances, instances...)
+	sort.SliceStable(sortedInstances, func(i, j int) bool {
+		return sortedInstances[i].Key.SmallerThan(&sortedInstances[j].Key)
+	})
+	for _, instance := range sortedInstances {
+		if inCircle[instance.Key] {
+			continue
+		}
+		members := getReplicationCircle(instance.Key, getMasterKey)
+		if len(members) == 0 {
+			continue
+		}
+		circularReplication := &CircularReplication{
+			ClusterName:     instance.ClusterName,
+			Members:         members,
+			WritableMembers: []InstanceKey{},
+		}
+		for _, member := range members {
+			inCircle[member] = true
+			if !instancesMap[member].ReadOnly {
+				circularReplication.WritableMembers = append(circularReplication.WritableMembers, member)
+			}
+		}
+		if len(circularReplication.WritableMembers) == 1 {
+			circularReplication.ActiveMasterKey = &circularReplication.WritableMembers[0]
+		}
+		circularReplications = append(circularReplications, circularReplication)
+	}
+	return circularReplications
+}
+
+// ReadClusterCircularReplications returns the co-master pairs and replication rings in given cluster
+func ReadClusterCircularReplications(clusterName string) ([](*CircularReplication), error) {
+	instances, err := ReadClusterInstances(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	circularReplications := findCircularReplications(instances)
+	if circularReplications == nil {
+		circularReplications = [](*CircularReplication){}
+	}
+	return circularReplications, nil
+}
+
+// ReadInstanceCircularReplication returns the replication circle given instance participates in, or nil
+// if the instance is not part of circular replication
+func ReadInstanceCircularReplication(instance *Instance) (*CircularReplication, error) {
+	circularReplications, err := ReadClusterCircularReplications(instance.ClusterName)
+	if err != nil {
+		return nil, err
+	}
+	for _, circularReplication := range circularReplications {
+		if circularReplication.HasMember(&instance.Key) {
+			return circularReplication, nil
+		}
+	}
+	return nil, nil
+}
@@ -17,12 +17,19 @@
 package inst
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"regexp"
 	"strings"
+	"text/template"
+	"time"
 
+	"github.com/github/orchestrator/go/attributes"
 	"github.com/github/orchestrator/go/config"
 	"github.com/github/orchestrator/go/kv"
+	"github.com/openark/golib/log"
 )
 
 func GetClusterMasterKVKey(clusterAlias string) string {
@@ -62,6 +69,232 @@ func GetClusterMasterKVPairs(clusterAlias string, masterKey *InstanceKey) (kvPai
 	return kvPairs
 }
 
+// KVMasterEntryData is what KVClusterMasterTemplates are rendered with
+type KVMasterEntryData struct {
+	ClusterAlias  string
+	ClusterDomain string
+	DataCenter    string
+	Hostname      string
+	Port          int
+	MasterKey     string
+	Attributes    map[string]string
+}
+
+// NewKVMasterEntryData returns the template data of given cluster's master. The master's host attributes
+// are read off the backend; failing that, templates see no attributes.
+func NewKVMasterEntryData(clusterInfo *ClusterInfo, master *Instance) *KVMasterEntryData {
+	hostAttributes, err := attributes.GetHostAttributesMap(master.Key.Hostname)
+	if err != nil {
+		log.Errore(err)
+		hostAttributes = make(map[string]string)
+	}
+	return &KVMasterEntryData{
+		ClusterAlias:  clusterInfo.ClusterAlias,
+		ClusterDomain: clusterInfo.ClusterDomain,
+		DataCenter:    master.DataCenter,
+		Hostname:      master.Key.Hostname,
+		Port:          master.Key.Port,
+		MasterKey:     master.Key.StringCode(),
+		Attributes:    hostAttributes,
+	}
+}
+
+// renderKVMasterEntryTemplate renders a single key or value template. Missing attributes render as empty strings.
+func renderKVMasterEntryTemplate(text string, data *KVMasterEntryData) (string, error) {
+	tmpl, err := template.New("kv").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return "", err
+	}
+	return rendered.String(), nil
+}
+
+// renderKVMasterEntry renders a single master entry template into a KV pair
+func renderKVMasterEntry(entryTemplate config.KVMasterEntryTemplate, data *KVMasterEntryData) (*kv.KVPair, error) {
+	key, err := renderKVMasterEntryTemplate(entryTemplate.Key, data)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		return nil, fmt.Errorf("KV key template %q renders empty for cluster %s", entryTemplate.Key, data.ClusterAlias)
+	}
+	value, err := renderKVMasterEntryTemplate(entryTemplate.Value, data)
+	if err != nil {
+		return nil, err
+	}
+	return kv.NewKVPair(key, value), nil
+}
+
+// getTemplatedMasterKVPairs renders given master entry templates into KV pairs. An entry failing to render
+// does not stop the others: the rendered pairs are returned along with an error listing the failures.
+func getTemplatedMasterKVPairs(entryTemplates []config.KVMasterEntryTemplate, data *KVMasterEntryData) (kvPairs [](*kv.KVPair), err error) {
+	renderErrors := []string{}
+	for _, entryTemplate := range entryTemplates {
+		kvPair, err := renderKVMasterEntry(entryTemplate, data)
+		if err != nil {
+			renderErrors = append(renderErrors, err.Error())
+			continue
+		}
+		kvPairs = append(kvPairs, kvPair)
+	}
+	if len(renderErrors) > 0 {
+		return kvPairs, fmt.Errorf("failed rendering %d of %d KV master entries: %s", len(renderErrors), len(entryTemplates), strings.Join(renderErrors, "; "))
+	}
+	return kvPairs, nil
+}
+
+// GetClusterMasterEntriesKVPairs returns the KV pairs to write for given cluster's master: the cluster's
+// KVClusterMasterTemplates entries, or, lacking those, the KVClusterMasterPrefix entries. On error, the pairs
+// which did render are still returned, and should still be written.
+func GetClusterMasterEntriesKVPairs(clusterInfo *ClusterInfo, master *Instance) (kvPairs [](*kv.KVPair), err error) {
+	entryTemplates, found := config.Config.GetKVClusterMasterTemplates(clusterInfo.ClusterAlias)
+	if !found {
+		return GetClusterMasterKVPairs(clusterInfo.ClusterAlias, &master.Key), nil
+	}
+	return getTemplatedMasterKVPairs(entryTemplates, NewKVMasterEntryData(clusterInfo, master))
+}
+
+// CutoverToken coordinates write traffic cutover upon master failover. Its epoch increases with each failover
+// of the cluster, such that proxies and applications can detect stale master information, and fence writes
+// to the previous master.
+type CutoverToken struct {
+	ClusterAlias      string
+	Epoch             int64
+	MasterKey         InstanceKey
+	PreviousMasterKey InstanceKey
+	Timestamp         string
+}
+
+// GetClusterCutoverKVKey returns the KV key of a cluster's cutover token
+func GetClusterCutoverKVKey(clusterAlias string) string {
+	return fmt.Sprintf("%s/cutover", GetClusterMasterKVKey(clusterAlias))
+}
+
+// NextCutoverToken returns the token succeeding given token (or the first token, if nil), upon failover
+// from given previous master to given master at given time
+func NextCutoverToken(token *CutoverToken, clusterAlias string, masterKey *InstanceKey, previousMasterKey *InstanceKey, timestamp string) *CutoverToken {
+	nextToken := &CutoverToken{
+		ClusterAlias:      clusterAlias,
+		Epoch:             1,
+		MasterKey:         *masterKey,
+		PreviousMasterKey: *previousMasterKey,
+		Timestamp:         timestamp,
+	}
+	if token != nil {
+		nextToken.Epoch = token.Epoch + 1
+	}
+	return nextToken
+}
+
+// ReadCutoverToken reads a cluster's cutover token off the internal KV store. It returns nil if the cluster
+// never failed over.
+func ReadCutoverToken(clusterAlias string) (*CutoverToken, error) {
+	value, err := kv.GetValue(GetClusterCutoverKVKey(clusterAlias))
+	if err != nil || value == "" {
+		return nil, err
+	}
+	token := &CutoverToken{}
+	if err := json.Unmarshal([]byte(value), token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// ClusterMasterEntries are the KV entries written upon master failover of a cluster: the cluster's master entries
+// and, given the cluster's alias, the cluster's next cutover token. The token is either given, as computed by
+// the raft leader, or computed upon write.
+type ClusterMasterEntries struct {
+	ClusterAlias      string
+	KVPairs           [](*kv.KVPair)
+	MasterKey         InstanceKey
+	PreviousMasterKey InstanceKey
+	Timestamp         string
+	Token             *CutoverToken
+}
+
+// NewClusterMasterEntries returns the KV entries to write upon failover of given cluster from given previous master
+// to given master
+func NewClusterMasterEntries(clusterAlias string, kvPairs [](*kv.KVPair), masterKey *InstanceKey, previousMasterKey *InstanceKey) *ClusterMasterEntries {
+	return &ClusterMasterEntries{
+		ClusterAlias:      clusterAlias,
+		KVPairs:           kvPairs,
+		MasterKey:         *masterKey,
+		PreviousMasterKey: *previousMasterKey,
+		Timestamp:         time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+// AssignCutoverToken computes the cutover token succeeding the one currently in the internal KV store, and assigns
+// it to the entries. With raft, the leader assigns the token before publishing the entries, such that all nodes
+// apply the very same token.
+func (this *ClusterMasterEntries) AssignCutoverToken() error {
+	if this.ClusterAlias == "" {
+		return nil
+	}
+	token, err := ReadCutoverToken(this.ClusterAlias)
+	if err != nil {
+		return err
+	}
+	this.Token = NextCutoverToken(token, this.ClusterAlias, &this.MasterKey, &this.PreviousMasterKey, this.Timestamp)
+	return nil
+}
+
+// errCutoverTokenSuperseded is returned when the current cutover token is at or past the epoch of the entries' token
+var errCutoverTokenSuperseded = errors.New("cutover token superseded")
+
+// WriteClusterMasterEntries writes a cluster's master entries along with its cutover token. Entries and token are
+// written to the internal store in a single transaction, in which the current token is read under lock.
+// Given the entries' token, the write is idempotent: nothing is written when the current token is already at or
+// past the given token's epoch. Otherwise, the written token succeeds the current one, such that epochs never
+// repeat. Should the token fail, the master entries are still written, without it.
+func WriteClusterMasterEntries(entries *ClusterMasterEntries) (token *CutoverToken, err error) {
+	if entries.ClusterAlias == "" {
+		for _, kvPair := range entries.KVPairs {
+			if err := kv.PutKVPair(kvPair); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	}
+	nextToken := func(value string) (string, error) {
+		token = nil
+		if value != "" {
+			token = &CutoverToken{}
+			if err := json.Unmarshal([]byte(value), token); err != nil {
+				return "", fmt.Errorf("cannot parse cutover token of %s: %+v", entries.ClusterAlias, err)
+			}
+		}
+		if entries.Token != nil {
+			if token != nil && token.Epoch >= entries.Token.Epoch {
+				return "", errCutoverTokenSuperseded
+			}
+			token = entries.Token
+		} else {
+			token = NextCutoverToken(token, entries.ClusterAlias, &entries.MasterKey, &entries.PreviousMasterKey, entries.Timestamp)
+		}
+		tokenValue, err := json.Marshal(token)
+		return string(tokenValue), err
+	}
+	updatedPair, err := kv.PutKVPairsUpdating(entries.KVPairs, GetClusterCutoverKVKey(entries.ClusterAlias), nextToken)
+	if err == errCutoverTokenSuperseded {
+		// Already applied, or superseded by a later failover
+		return nil, nil
+	}
+	if err != nil && updatedPair == nil {
+		// Nothing was written
+		for _, kvPair := range entries.KVPairs {
+			if putErr := kv.PutKVPair(kvPair); putErr != nil {
+				return nil, putErr
+			}
+		}
+		return nil, err
+	}
+	return token, err
+}
+
 // mappedClusterNameToAlias attempts to match a cluster with an alias based on
 // configured ClusterNameToAlias map
 func mappedClusterNameToAlias(clusterName string) string {
@@ -86,12 +319,32 @@ type ClusterInfo struct {
 	HeuristicLag                           int64
 	HasAutomatedMasterRecovery             bool
 	HasAutomatedIntermediateMasterRecovery bool
+	HasAutomatedFanOutReduction            bool
+	ReadOnlyEnforcement                    string // "enforce", "alert", or empty when not subject to read_only enforcement
+	MasterRecoveryAutomation               string // "auto", "approve" or "never"
+	IntermediateMasterRecoveryAutomation   string // "auto", "approve" or "never"
 }
 
 // ReadRecoveryInfo
 func (this *ClusterInfo) ReadRecoveryInfo() {
-	this.HasAutomatedMasterRecovery = this.filtersMatchCluster(config.Config.RecoverMasterClusterFilters)
-	this.HasAutomatedIntermediateMasterRecovery = this.filtersMatchCluster(config.Config.RecoverIntermediateMasterClusterFilters)
+	this.MasterRecoveryAutomation = this.recoveryAutomation(config.MasterFailureClass, config.Config.RecoverMasterClusterFilters)
+	this.IntermediateMasterRecoveryAutomation = this.recoveryAutomation(config.IntermediateMasterFailureClass, config.Config.RecoverIntermediateMasterClusterFilters)
+	this.HasAutomatedMasterRecovery = (this.MasterRecoveryAutomation == config.RecoveryAutomationAuto)
+	this.HasAutomatedIntermediateMasterRecovery = (this.IntermediateMasterRecoveryAutomation == config.RecoveryAutomationAuto)
+	this.HasAutomatedFanOutReduction = this.filtersMatchCluster(config.Config.MasterFanOutAutoReduceClusterFilters)
+	this.ReadOnlyEnforcement = config.Config.GetReadOnlyEnforcement(this.ClusterName, this.ClusterAlias)
+}
+
+// recoveryAutomation returns the automation level of recoveries of given failure class on this cluster. Lacking
+// a configured level, recoveries are automated on clusters matching given filters.
+func (this *ClusterInfo) recoveryAutomation(failureClass string, filters []string) string {
+	if automationLevel := config.Config.GetRecoveryAutomationLevel(this.ClusterName, this.ClusterAlias, failureClass); automationLevel != "" {
+		return automationLevel
+	}
+	if this.filtersMatchCluster(filters) {
+		return config.RecoveryAutomationAuto
+	}
+	return config.RecoveryAutomationNever
 }
 
 // filtersMatchCluster will see whether the given filters match the given cluster details
@@ -124,6 +377,22 @@ func (this *ClusterInfo) filtersMatchCluster(filters []string) bool {
 	return false
 }
 
+// MatchesClusterFilters checks whether any of given filters matches this cluster. Filters are cluster names,
+// "alias=" or "alias~=" prefixed aliases, regular expressions, or "*" for all clusters.
+func (this *ClusterInfo) MatchesClusterFilters(filters []string) bool {
+	return this.filtersMatchCluster(filters)
+}
+
+// IsInNamespaces checks whether the cluster is assigned to any of the given namespaces
+func (this *ClusterInfo) IsInNamespaces(namespaces []string) bool {
+	for _, namespace := range namespaces {
+		if namespaceConfig, ok := config.Config.Namespaces[namespace]; ok && this.filtersMatchCluster(namespaceConfig.ClusterFilters) {
+			return true
+		}
+	}
+	return false
+}
+
 // ApplyClusterAlias updates the given clusterInfo's ClusterAlias property
 func (this *ClusterInfo) ApplyClusterAlias() {
 	if this.ClusterAlias != "" && this.ClusterAlias != this.ClusterName {
@@ -0,0 +1,243 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/github/orchestrator/go/config"
+)
+
+// ClusterComparisonSide summarizes one of two compared topologies
+type ClusterComparisonSide struct {
+	Name                      string // cluster name, or description of a compared subtree
+	MasterKey                 *InstanceKey
+	CountInstances            int
+	CountValidInstances       int
+	CountReplicatingInstances int
+	Versions                  map[string]int // count of instances per MySQL version
+	ExecutedGtidSet           string         // of the cluster's master
+	GtidsMissingFromOther     string         // transactions executed on this cluster's master, but not on the other's
+}
+
+// ClusterReplicationLink is a replica in one of two compared topologies, replicating from an instance in the other
+type ClusterReplicationLink struct {
+	Key              InstanceKey
+	MasterKey        InstanceKey
+	IsHealthy        bool
+	ReplicaRunning   bool
+	LagSeconds       int64 // -1 when unknown
+	LastIOError      string
+	LastSQLError     string
+	IsLastCheckValid bool
+}
+
+// ClusterComparison compares two parallel topologies, e.g. a current (blue) cluster and a new (green) cluster
+// which replicates from it, for validating readiness for a cutover from the former to the latter
+type ClusterComparison struct {
+	A                ClusterComparisonSide
+	B                ClusterComparisonSide
+	ReplicationLinks []ClusterReplicationLink
+	IsCutoverReady   bool
+	Problems         []string
+}
+
+// getComparedClusterMaster returns the master of a compared topology: the one instance which does not replicate from
+// another instance of the topology. A replica of another topology may thus be the master.
+func getComparedClusterMaster(instances [](*Instance)) *Instance {
+	keys := make(map[InstanceKey]bool)
+	for _, instance := range instances {
+		keys[instance.Key] = true
+	}
+	var master *Instance
+	for _, instance := range instances {
+		if !keys[instance.MasterKey] {
+			if master != nil {
+				return nil
+			}
+			master = instance
+		}
+	}
+	return master
+}
+
+// newClusterComparisonSide summarizes the instances of a compared topology
+func newClusterComparisonSide(name string, instances [](*Instance)) ClusterComparisonSide {
+	side := ClusterComparisonSide{
+		Name:           name,
+		CountInstances: len(instances),
+		Versions:       make(map[string]int),
+	}
+	for _, instance := range instances {
+		if instance.IsLastCheckValid {
+			side.CountValidInstances++
+		}
+		if instance.ReplicaRunning() {
+			side.CountReplicatingInstances++
+		}
+		side.Versions[instance.Version]++
+	}
+	if master := getComparedClusterMaster(instances); master != nil {
+		side.MasterKey = &master.Key
+		side.ExecutedGtidSet = master.ExecutedGtidSet
+	}
+	return side
+}
+
+// readClusterReplicationLinks lists replicas among given instances, which replicate from an instance in the other topology
+func readClusterReplicationLinks(instances [](*Instance), otherInstances [](*Instance)) (links []ClusterReplicationLink) {
+	otherKeys := make(map[InstanceKey]bool)
+	for _, instance := range otherInstances {
+		otherKeys[instance.Key] = true
+	}
+	for _, instance := range instances {
+		if !otherKeys[instance.MasterKey] {
+			continue
+		}
+		link := ClusterReplicationLink{
+			Key:              instance.Key,
+			MasterKey:        instance.MasterKey,
+			ReplicaRunning:   instance.ReplicaRunning(),
+			LagSeconds:       -1,
+			LastIOError:      instance.LastIOError,
+			LastSQLError:     instance.LastSQLError,
+			IsLastCheckValid: instance.IsLastCheckValid,
+		}
+		if instance.SlaveLagSeconds.Valid {
+			link.LagSeconds = instance.SlaveLagSeconds.Int64
+		}
+		link.IsHealthy = link.IsLastCheckValid && link.ReplicaRunning && link.LagSeconds >= 0 && link.LagSeconds <= int64(config.Config.ReasonableReplicationLagSeconds)
+		links = append(links, link)
+	}
+	return links
+}
+
+// compareClusters compares the instances of two topologies. Topology b is expected to replicate from topology a.
+func compareClusters(nameA string, instancesA [](*Instance), nameB string, instancesB [](*Instance)) *ClusterComparison {
+	comparison := &ClusterComparison{
+		A:                newClusterComparisonSide(nameA, instancesA),
+		B:                newClusterComparisonSide(nameB, instancesB),
+		ReplicationLinks: []ClusterReplicationLink{},
+		Problems:         []string{},
+	}
+	comparison.ReplicationLinks = append(comparison.ReplicationLinks, readClusterReplicationLinks(instancesB, instancesA)...)
+	comparison.ReplicationLinks = append(comparison.ReplicationLinks, readClusterReplicationLinks(instancesA, instancesB)...)
+	sort.Slice(comparison.ReplicationLinks, func(i, j int) bool {
+		return comparison.ReplicationLinks[i].Key.StringCode() < comparison.ReplicationLinks[j].Key.StringCode()
+	})
+
+	for _, side := range []ClusterComparisonSide{comparison.A, comparison.B} {
+		if side.MasterKey == nil {
+			comparison.Problems = append(comparison.Problems, fmt.Sprintf("cannot determine a single master of %s", side.Name))
+		}
+		if side.CountValidInstances < side.CountInstances {
+			comparison.Problems = append(comparison.Problems, fmt.Sprintf("%d instances of %s are not reachable", side.CountInstances-side.CountValidInstances, side.Name))
+		}
+	}
+	var upstreamLink *ClusterReplicationLink
+	for i, link := range comparison.ReplicationLinks {
+		if comparison.B.MasterKey != nil && link.Key.Equals(comparison.B.MasterKey) {
+			upstreamLink = &comparison.ReplicationLinks[i]
+		}
+	}
+	if upstreamLink == nil {
+		comparison.Problems = append(comparison.Problems, fmt.Sprintf("master of %s does not replicate from %s", nameB, nameA))
+	} else if !upstreamLink.IsHealthy {
+		comparison.Problems = append(comparison.Problems, fmt.Sprintf("replication of %+v from %+v is unhealthy", upstreamLink.Key, upstreamLink.MasterKey))
+	}
+
+	if comparison.A.ExecutedGtidSet != "" || comparison.B.ExecutedGtidSet != "" {
+		executedA, errA := ParseGtidSet(comparison.A.ExecutedGtidSet)
+		executedB, errB := ParseGtidSet(comparison.B.ExecutedGtidSet)
+		if errA != nil || errB != nil {
+			comparison.Problems = append(comparison.Problems, "cannot parse executed GTID sets")
+		} else {
+			if missingFromB, err := executedA.Subtract(executedB); err == nil {
+				comparison.A.GtidsMissingFromOther = missingFromB.String()
+			}
+			if missingFromA, err := executedB.Subtract(executedA); err == nil {
+				comparison.B.GtidsMissingFromOther = missingFromA.String()
+				if !missingFromA.IsEmpty() {
+					comparison.Problems = append(comparison.Problems, fmt.Sprintf("master of %s executed transactions not executed on master of %s", nameB, nameA))
+				}
+			}
+		}
+	}
+	comparison.IsCutoverReady = len(comparison.Problems) == 0
+	return comparison
+}
+
+// splitComparedSubtree splits given instances into the subtree rooted at given instance, and all others
+func splitComparedSubtree(instances [](*Instance), rootKey *InstanceKey) (others [](*Instance), subtree [](*Instance)) {
+	replicasByMaster := make(map[InstanceKey][](*Instance))
+	for _, instance := range instances {
+		replicasByMaster[instance.MasterKey] = append(replicasByMaster[instance.MasterKey], instance)
+	}
+	subtreeKeys := map[InstanceKey]bool{*rootKey: true}
+	pendingKeys := []InstanceKey{*rootKey}
+	for len(pendingKeys) > 0 {
+		masterKey := pendingKeys[0]
+		pendingKeys = pendingKeys[1:]
+		for _, replica := range replicasByMaster[masterKey] {
+			if !subtreeKeys[replica.Key] {
+				subtreeKeys[replica.Key] = true
+				pendingKeys = append(pendingKeys, replica.Key)
+			}
+		}
+	}
+	for _, instance := range instances {
+		if subtreeKeys[instance.Key] {
+			subtree = append(subtree, instance)
+		} else {
+			others = append(others, instance)
+		}
+	}
+	return others, subtree
+}
+
+// CompareClusters compares a cluster with a new topology replicating from it in preparation for a migration: the
+// subtree rooted at given instance. Having a master in the cluster, the new topology is normally part of the
+// cluster, in which case the cluster is compared without the subtree. It reports instance counts, version mix, the
+// executed GTID deltas of the two masters, and the health of replication links between the two. The subtree is
+// considered ready for cutover when its root replicates from the cluster with reasonable lag, and has not executed
+// transactions of its own.
+func CompareClusters(clusterName string, subtreeRootKey *InstanceKey) (*ClusterComparison, error) {
+	subtreeRoot, found, err := ReadInstance(subtreeRootKey)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("CompareClusters: instance not found: %+v", *subtreeRootKey)
+	}
+	instances, err := ReadClusterInstances(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	subtreeInstances := instances
+	if subtreeRoot.ClusterName != clusterName {
+		if subtreeInstances, err = ReadClusterInstances(subtreeRoot.ClusterName); err != nil {
+			return nil, err
+		}
+	}
+	_, subtree := splitComparedSubtree(subtreeInstances, &subtreeRoot.Key)
+	others, _ := splitComparedSubtree(instances, &subtreeRoot.Key)
+	if len(others) == 0 {
+		return nil, fmt.Errorf("CompareClusters: %+v is the master of %s; cannot compare the cluster with itself", subtreeRoot.Key, clusterName)
+	}
+	return compareClusters(clusterName, others, fmt.Sprintf("subtree of %s", subtreeRoot.Key.StringCode()), subtree), nil
+}
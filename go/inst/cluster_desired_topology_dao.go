@@ -0,0 +1,67 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"github.com/github/orchestrator/go/db"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+// WriteClusterDesiredTopology declares the desired topology shape of a cluster, given its alias. The declaration is kept
+// by alias, so that it survives a failover which renames the cluster. An empty desired topology removes the declaration.
+func WriteClusterDesiredTopology(clusterAlias string, desiredTopology string) error {
+	if clusterAlias == "" {
+		return log.Errorf("WriteClusterDesiredTopology: no cluster alias given")
+	}
+	writeFunc := func() error {
+		if desiredTopology == "" {
+			_, err := db.ExecOrchestrator(`
+				delete from desired_cluster_topology where cluster_alias = ?
+				`,
+				clusterAlias)
+			return log.Errore(err)
+		}
+		_, err := db.ExecOrchestrator(`
+			replace into
+					desired_cluster_topology (cluster_alias, desired_topology, last_updated)
+				values
+					(?, ?, now())
+			`,
+			clusterAlias, desiredTopology)
+		return log.Errore(err)
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
+
+// ReadClusterDesiredTopology returns the desired topology shape of a cluster as declared via API, given its alias,
+// or empty string if none declared
+func ReadClusterDesiredTopology(clusterAlias string) (desiredTopology string, err error) {
+	query := `
+		select
+			desired_topology
+		from
+			desired_cluster_topology
+		where
+			cluster_alias = ?
+		`
+	err = db.QueryOrchestrator(query, sqlutils.Args(clusterAlias), func(m sqlutils.RowMap) error {
+		desiredTopology = m.GetString("desired_topology")
+		return nil
+	})
+	return desiredTopology, log.Errore(err)
+}
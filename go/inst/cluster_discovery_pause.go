@@ -0,0 +1,54 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+
+	"github.com/github/orchestrator/go/db"
+)
+
+// ClusterDiscoveryPause stops the polling of a cluster's instances for a while, e.g. during host migrations,
+// where probes cause noise. The cluster's last known state remains visible, and is marked as stale. A pause is
+// kept by cluster alias, which outlives changes of the cluster's master; ClusterName is the cluster's name as of
+// pausing.
+type ClusterDiscoveryPause struct {
+	ClusterAlias    string
+	ClusterName     string
+	Owner           string
+	Reason          string
+	PausedAtString  string
+	ExpiresAtString string
+}
+
+// NewClusterDiscoveryPause returns a discovery pause of given cluster, expiring given number of seconds from now
+func NewClusterDiscoveryPause(clusterName string, clusterAlias string, owner string, reason string, durationSeconds uint) *ClusterDiscoveryPause {
+	discoveryPause := &ClusterDiscoveryPause{
+		ClusterAlias: clusterAlias,
+		ClusterName:  clusterName,
+		Owner:        owner,
+		Reason:       reason,
+	}
+	discoveryPause.PausedAtString, _ = db.ReadTimeNow()
+	discoveryPause.ExpiresAtString = AddSecondsToTimeString(discoveryPause.PausedAtString, durationSeconds)
+	return discoveryPause
+}
+
+// String returns a string representation of the pause
+func (discoveryPause *ClusterDiscoveryPause) String() string {
+	return fmt.Sprintf("discovery of cluster %s paused by %s until %s: %s", discoveryPause.ClusterAlias, discoveryPause.Owner, discoveryPause.ExpiresAtString, discoveryPause.Reason)
+}
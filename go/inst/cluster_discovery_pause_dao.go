@@ -0,0 +1,116 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+
+	"github.com/github/orchestrator/go/db"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+// WriteClusterDiscoveryPause pauses discovery of a cluster, or updates an existing pause
+func WriteClusterDiscoveryPause(discoveryPause *ClusterDiscoveryPause) error {
+	if discoveryPause.ClusterAlias == "" {
+		return log.Errorf("WriteClusterDiscoveryPause: no cluster alias given for discovery pause of %s", discoveryPause.ClusterName)
+	}
+	if discoveryPause.ExpiresAtString == "" {
+		return fmt.Errorf("WriteClusterDiscoveryPause: no expiry given for discovery pause of %s", discoveryPause.ClusterAlias)
+	}
+	_, err := db.ExecOrchestrator(`
+			replace into discovery_paused_cluster (
+					cluster_alias, cluster_name, pause_owner, pause_reason, pause_timestamp, pause_expires_at
+				) values (
+					?, ?, ?, ?, ?, ?
+				)
+			`, discoveryPause.ClusterAlias, discoveryPause.ClusterName, discoveryPause.Owner, discoveryPause.Reason, discoveryPause.PausedAtString, discoveryPause.ExpiresAtString,
+	)
+	if err != nil {
+		return log.Errore(err)
+	}
+	// The cluster may have been renamed since the pause's cluster name was read
+	clusterInstancesCache.invalidateAll()
+	AuditOperation("pause-discovery", nil, discoveryPause.String())
+	return nil
+}
+
+// DeleteClusterDiscoveryPause resumes discovery of a cluster, given its alias
+func DeleteClusterDiscoveryPause(clusterAlias string) error {
+	_, err := db.ExecOrchestrator(`
+			delete from discovery_paused_cluster where cluster_alias = ?
+			`, clusterAlias,
+	)
+	if err != nil {
+		return log.Errore(err)
+	}
+	clusterInstancesCache.invalidateAll()
+	AuditOperation("resume-discovery", nil, fmt.Sprintf("discovery of cluster %s resumed", clusterAlias))
+	return nil
+}
+
+// ExpireClusterDiscoveryPauses removes expired discovery pauses
+func ExpireClusterDiscoveryPauses() error {
+	_, err := db.ExecOrchestrator(`
+			delete from discovery_paused_cluster where pause_expires_at < NOW()
+			`,
+	)
+	return log.Errore(err)
+}
+
+// ReadClusterDiscoveryPauses reads active discovery pauses
+func ReadClusterDiscoveryPauses() ([]ClusterDiscoveryPause, error) {
+	discoveryPauses := []ClusterDiscoveryPause{}
+	query := `
+		select
+			cluster_alias,
+			cluster_name,
+			pause_owner,
+			pause_reason,
+			pause_timestamp,
+			pause_expires_at
+		from
+			discovery_paused_cluster
+		where
+			pause_expires_at > NOW()
+		order by
+			cluster_alias
+	`
+	err := db.QueryOrchestrator(query, sqlutils.Args(), func(m sqlutils.RowMap) error {
+		discoveryPause := ClusterDiscoveryPause{
+			ClusterAlias:    m.GetString("cluster_alias"),
+			ClusterName:     m.GetString("cluster_name"),
+			Owner:           m.GetString("pause_owner"),
+			Reason:          m.GetString("pause_reason"),
+			PausedAtString:  m.GetString("pause_timestamp"),
+			ExpiresAtString: m.GetString("pause_expires_at"),
+		}
+		discoveryPauses = append(discoveryPauses, discoveryPause)
+		return nil
+	})
+	return discoveryPauses, log.Errore(err)
+}
+
+// ReadDiscoveryPausedClusterAliases returns the aliases of clusters whose discovery is actively paused
+func ReadDiscoveryPausedClusterAliases() (map[string]bool, error) {
+	clusterAliases := make(map[string]bool)
+	discoveryPauses, err := ReadClusterDiscoveryPauses()
+	for _, discoveryPause := range discoveryPauses {
+		clusterAliases[discoveryPause.ClusterAlias] = true
+	}
+	return clusterAliases, err
+}
@@ -0,0 +1,74 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"testing"
+	"time"
+
+	test "github.com/openark/golib/tests"
+)
+
+func TestClusterDiscoveryPauseByAlias(t *testing.T) {
+	withSQLiteBackend(t)
+	writeCheckpointTestInstance(t, "db-1", "", "mysql-bin.000001", time.Now())
+	test.S(t).ExpectNil(SetClusterAlias("db-1:3306", "orders"))
+	instanceKey := InstanceKey{Hostname: "db-1", Port: 3306}
+
+	// the pause is kept by alias, and holds once the cluster is renamed after its new master
+	err := WriteClusterDiscoveryPause(NewClusterDiscoveryPause("db-0:3306", "orders", "alice", "migrating", 600))
+	test.S(t).ExpectNil(err)
+	discoveryPauses, err := ReadClusterDiscoveryPauses()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(discoveryPauses), 1)
+	test.S(t).ExpectEquals(discoveryPauses[0].ClusterAlias, "orders")
+	test.S(t).ExpectEquals(discoveryPauses[0].ClusterName, "db-0:3306")
+	pausedClusterAliases, err := ReadDiscoveryPausedClusterAliases()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(pausedClusterAliases["orders"])
+	test.S(t).ExpectFalse(pausedClusterAliases["db-1:3306"])
+
+	instance, found, err := ReadInstance(&instanceKey)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(found)
+	test.S(t).ExpectTrue(instance.IsDiscoveryPaused)
+
+	err = DeleteClusterDiscoveryPause("orders")
+	test.S(t).ExpectNil(err)
+	instance, _, err = ReadInstance(&instanceKey)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectFalse(instance.IsDiscoveryPaused)
+}
+
+func TestClusterDiscoveryPauseOfUnaliasedCluster(t *testing.T) {
+	withSQLiteBackend(t)
+	writeCheckpointTestInstance(t, "db-1", "", "mysql-bin.000001", time.Now())
+
+	// a cluster with no alias is known by its name
+	err := WriteClusterDiscoveryPause(NewClusterDiscoveryPause("db-1:3306", "db-1:3306", "alice", "", 600))
+	test.S(t).ExpectNil(err)
+	instance, _, err := ReadInstance(&InstanceKey{Hostname: "db-1", Port: 3306})
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(instance.IsDiscoveryPaused)
+}
+
+func TestWriteClusterDiscoveryPauseRequiresAlias(t *testing.T) {
+	withSQLiteBackend(t)
+
+	err := WriteClusterDiscoveryPause(NewClusterDiscoveryPause("db-0:3306", "", "alice", "", 600))
+	test.S(t).ExpectNotNil(err)
+}
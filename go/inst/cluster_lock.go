@@ -0,0 +1,53 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+
+	"github.com/github/orchestrator/go/db"
+)
+
+// ClusterLock is an advisory lock an operator or automation takes on a cluster, so as to not have
+// other actors simultaneously operate on the same topology. A lock is kept by cluster alias, which outlives
+// changes of the cluster's master; ClusterName is the cluster's name as of locking.
+type ClusterLock struct {
+	ClusterAlias    string
+	ClusterName     string
+	Owner           string
+	Reason          string
+	LockedAtString  string
+	ExpiresAtString string
+}
+
+// NewClusterLock returns a lock on given cluster, expiring given number of seconds from now
+func NewClusterLock(clusterName string, clusterAlias string, owner string, reason string, durationSeconds uint) *ClusterLock {
+	clusterLock := &ClusterLock{
+		ClusterAlias: clusterAlias,
+		ClusterName:  clusterName,
+		Owner:        owner,
+		Reason:       reason,
+	}
+	clusterLock.LockedAtString, _ = db.ReadTimeNow()
+	clusterLock.ExpiresAtString = AddSecondsToTimeString(clusterLock.LockedAtString, durationSeconds)
+	return clusterLock
+}
+
+// String returns a string representation of the lock
+func (clusterLock *ClusterLock) String() string {
+	return fmt.Sprintf("cluster %s locked by %s until %s: %s", clusterLock.ClusterAlias, clusterLock.Owner, clusterLock.ExpiresAtString, clusterLock.Reason)
+}
@@ -0,0 +1,138 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+
+	"github.com/github/orchestrator/go/db"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+// WriteClusterLock locks a cluster. A cluster actively locked by a different owner cannot be locked.
+func WriteClusterLock(clusterLock *ClusterLock) error {
+	if clusterLock.ClusterAlias == "" {
+		return log.Errorf("WriteClusterLock: no cluster alias given for lock on %s", clusterLock.ClusterName)
+	}
+	if clusterLock.ExpiresAtString == "" {
+		return fmt.Errorf("WriteClusterLock: no expiry given for lock on %s", clusterLock.ClusterAlias)
+	}
+	existingLock, err := ReadClusterLock(clusterLock.ClusterAlias)
+	if err != nil {
+		return err
+	}
+	if existingLock != nil && existingLock.Owner != clusterLock.Owner {
+		return fmt.Errorf("Cannot lock: %s", existingLock.String())
+	}
+	_, err = db.ExecOrchestrator(`
+			replace into cluster_advisory_lock (
+					cluster_alias, cluster_name, lock_owner, lock_reason, lock_timestamp, lock_expires_at
+				) values (
+					?, ?, ?, ?, ?, ?
+				)
+			`, clusterLock.ClusterAlias, clusterLock.ClusterName, clusterLock.Owner, clusterLock.Reason, clusterLock.LockedAtString, clusterLock.ExpiresAtString,
+	)
+	if err != nil {
+		return log.Errore(err)
+	}
+	AuditOperation("lock-cluster", nil, clusterLock.String())
+	return nil
+}
+
+// DeleteClusterLock unlocks a cluster, given its alias
+func DeleteClusterLock(clusterAlias string) error {
+	_, err := db.ExecOrchestrator(`
+			delete from cluster_advisory_lock where cluster_alias = ?
+			`, clusterAlias,
+	)
+	if err != nil {
+		return log.Errore(err)
+	}
+	AuditOperation("unlock-cluster", nil, fmt.Sprintf("cluster %s unlocked", clusterAlias))
+	return nil
+}
+
+// ExpireClusterLocks removes expired cluster locks
+func ExpireClusterLocks() error {
+	_, err := db.ExecOrchestrator(`
+			delete from cluster_advisory_lock where lock_expires_at < NOW()
+			`,
+	)
+	return log.Errore(err)
+}
+
+// readClusterLocks reads active cluster locks, potentially of a given cluster alias
+func readClusterLocks(clusterAlias string) ([]ClusterLock, error) {
+	clusterLocks := []ClusterLock{}
+	query := `
+		select
+			cluster_alias,
+			cluster_name,
+			lock_owner,
+			lock_reason,
+			lock_timestamp,
+			lock_expires_at
+		from
+			cluster_advisory_lock
+		where
+			lock_expires_at > NOW()
+			and (cluster_alias = ? or ? = '')
+		order by
+			cluster_alias
+	`
+	err := db.QueryOrchestrator(query, sqlutils.Args(clusterAlias, clusterAlias), func(m sqlutils.RowMap) error {
+		clusterLock := ClusterLock{
+			ClusterAlias:    m.GetString("cluster_alias"),
+			ClusterName:     m.GetString("cluster_name"),
+			Owner:           m.GetString("lock_owner"),
+			Reason:          m.GetString("lock_reason"),
+			LockedAtString:  m.GetString("lock_timestamp"),
+			ExpiresAtString: m.GetString("lock_expires_at"),
+		}
+		clusterLocks = append(clusterLocks, clusterLock)
+		return nil
+	})
+	return clusterLocks, log.Errore(err)
+}
+
+// ReadClusterLocks reads all active cluster locks
+func ReadClusterLocks() ([]ClusterLock, error) {
+	return readClusterLocks("")
+}
+
+// ReadClusterLock reads the active lock of a cluster, given its alias, or nil when the cluster is not locked
+func ReadClusterLock(clusterAlias string) (*ClusterLock, error) {
+	clusterLocks, err := readClusterLocks(clusterAlias)
+	if err != nil || len(clusterLocks) == 0 {
+		return nil, err
+	}
+	return &clusterLocks[0], nil
+}
+
+// CheckClusterLock returns an error when a cluster, given its alias, is actively locked by an owner other than
+// given actor
+func CheckClusterLock(clusterAlias string, actor string) error {
+	clusterLock, err := ReadClusterLock(clusterAlias)
+	if err != nil {
+		return err
+	}
+	if clusterLock != nil && clusterLock.Owner != actor {
+		return fmt.Errorf("Operation rejected: %s", clusterLock.String())
+	}
+	return nil
+}
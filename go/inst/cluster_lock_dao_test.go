@@ -0,0 +1,62 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"testing"
+
+	test "github.com/openark/golib/tests"
+)
+
+func TestClusterLockByAlias(t *testing.T) {
+	withSQLiteBackend(t)
+
+	err := WriteClusterLock(NewClusterLock("db-0:3306", "orders", "alice", "reorganizing", 600))
+	test.S(t).ExpectNil(err)
+
+	// the lock is kept by alias, and holds once the cluster is renamed after its new master
+	clusterLock, err := ReadClusterLock("orders")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectNotNil(clusterLock)
+	test.S(t).ExpectEquals(clusterLock.ClusterAlias, "orders")
+	test.S(t).ExpectEquals(clusterLock.ClusterName, "db-0:3306")
+	test.S(t).ExpectEquals(clusterLock.Owner, "alice")
+	test.S(t).ExpectNil(CheckClusterLock("orders", "alice"))
+	test.S(t).ExpectNotNil(CheckClusterLock("orders", "bob"))
+	test.S(t).ExpectNil(CheckClusterLock("db-0:3306", "bob"))
+
+	// only the holder may lock again
+	err = WriteClusterLock(NewClusterLock("db-1:3306", "orders", "bob", "", 600))
+	test.S(t).ExpectNotNil(err)
+	err = WriteClusterLock(NewClusterLock("db-1:3306", "orders", "alice", "extending", 1200))
+	test.S(t).ExpectNil(err)
+	clusterLocks, err := ReadClusterLocks()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(clusterLocks), 1)
+	test.S(t).ExpectEquals(clusterLocks[0].Reason, "extending")
+
+	err = DeleteClusterLock("orders")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectNil(CheckClusterLock("orders", "bob"))
+}
+
+func TestWriteClusterLockRequiresAlias(t *testing.T) {
+	withSQLiteBackend(t)
+
+	err := WriteClusterLock(NewClusterLock("db-0:3306", "", "alice", "", 600))
+	test.S(t).ExpectNotNil(err)
+}
@@ -0,0 +1,193 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+)
+
+// OnboardingCheck is the area of a cluster onboarding remediation item
+type OnboardingCheck string
+
+const (
+	OnboardingDiscovery   OnboardingCheck = "discovery"
+	OnboardingPrivileges  OnboardingCheck = "privileges"
+	OnboardingReplication OnboardingCheck = "replication"
+	OnboardingBinlog      OnboardingCheck = "binlog"
+	OnboardingGTID        OnboardingCheck = "gtid"
+	OnboardingPromotion   OnboardingCheck = "promotion"
+	OnboardingRecovery    OnboardingCheck = "recovery"
+)
+
+// OnboardingRemediation is a specific problem found while onboarding a cluster, along with how to fix it.
+// Blocking problems prevent orchestrator from automatically recovering the cluster's master.
+type OnboardingRemediation struct {
+	Check       OnboardingCheck
+	Key         InstanceKey // empty for cluster-wide problems
+	Problem     string
+	Remediation string
+	IsBlocking  bool
+}
+
+// ClusterOnboardingReport is the readiness of a newly discovered cluster for orchestrator's automated recovery
+type ClusterOnboardingReport struct {
+	SeedKey                 InstanceKey
+	ClusterName             string
+	MasterKey               InstanceKey
+	Members                 []InstanceKey
+	UnreachableKeys         []InstanceKey
+	CountPromotableReplicas int
+	IsReady                 bool
+	Remediations            []OnboardingRemediation
+	EvaluatedAt             time.Time
+}
+
+func (this *ClusterOnboardingReport) addRemediation(check OnboardingCheck, key InstanceKey, isBlocking bool, problem string, remediation string) {
+	this.Remediations = append(this.Remediations, OnboardingRemediation{
+		Check:       check,
+		Key:         key,
+		Problem:     problem,
+		Remediation: remediation,
+		IsBlocking:  isBlocking,
+	})
+}
+
+// onboardingMasters figures out the masters among the members of a cluster. A cluster with no plain master,
+// but with co-masters, has its writable co-master returned.
+func onboardingMasters(instances [](*Instance)) (masters [](*Instance)) {
+	instancesMap := make(map[InstanceKey](*Instance))
+	for _, instance := range instances {
+		instancesMap[instance.Key] = instance
+	}
+	for _, instance := range instances {
+		if instance.IsLastCheckValid && !instance.IsReplica() {
+			masters = append(masters, instance)
+		}
+	}
+	if len(masters) > 0 {
+		return masters
+	}
+	for _, instance := range instances {
+		if master, found := instancesMap[instance.MasterKey]; found && master.MasterKey.Equals(&instance.Key) && !instance.ReadOnly {
+			masters = append(masters, instance)
+		}
+	}
+	return masters
+}
+
+// evaluateClusterOnboarding checks the members of a newly discovered cluster for the prerequisites of automated
+// recovery: reachability, the topology user's privileges, healthy replication, binary logs on replicas which may
+// be promoted, and GTID or Pseudo-GTID, and lists the remediation of each problem found.
+func evaluateClusterOnboarding(
+	seedKey InstanceKey,
+	instances [](*Instance),
+	unreachableKeys []InstanceKey,
+	privilegesChecks map[InstanceKey]*TopologyPrivilegesCheck,
+	hasAutomatedMasterRecovery bool,
+) *ClusterOnboardingReport {
+	report := &ClusterOnboardingReport{
+		SeedKey:         seedKey,
+		Members:         []InstanceKey{},
+		UnreachableKeys: unreachableKeys,
+		Remediations:    []OnboardingRemediation{},
+		EvaluatedAt:     time.Now(),
+	}
+	for _, instance := range instances {
+		report.Members = append(report.Members, instance.Key)
+	}
+	for _, key := range unreachableKeys {
+		report.addRemediation(OnboardingDiscovery, key, false, "server is unreachable",
+			"verify connectivity from orchestrator, and that the topology user may connect from orchestrator's hosts")
+	}
+
+	masters := onboardingMasters(instances)
+	if len(masters) != 1 {
+		report.addRemediation(OnboardingDiscovery, InstanceKey{}, true, fmt.Sprintf("expected a single master; found %d", len(masters)),
+			"verify the replication topology, and that the master is reachable")
+		return report
+	}
+	master := masters[0]
+	report.ClusterName = master.ClusterName
+	report.MasterKey = master.Key
+
+	for _, instance := range instances {
+		if check, found := privilegesChecks[instance.Key]; found && check.IsDeficient() {
+			report.addRemediation(OnboardingPrivileges, instance.Key, true, fmt.Sprintf("%s is missing %d privileges", check.User, len(check.MissingPrivileges)),
+				strings.Join(check.GrantStatements, " "))
+		}
+	}
+
+	countGTIDReplicas := 0
+	for _, instance := range instances {
+		if instance.Key.Equals(&master.Key) || !instance.IsReplica() {
+			continue
+		}
+		if !instance.ReplicaRunning() {
+			report.addRemediation(OnboardingReplication, instance.Key, false, "replication is not running",
+				"fix and start replication, or downtime the replica")
+		}
+		if !instance.ReadOnly {
+			report.addRemediation(OnboardingReplication, instance.Key, false, "replica is writable",
+				"set global read_only=1")
+		}
+		if instance.UsingGTID() {
+			countGTIDReplicas++
+		}
+		if !instance.MasterKey.Equals(&master.Key) {
+			continue
+		}
+		// A direct replica of the master
+		if !instance.LogBinEnabled || !instance.LogSlaveUpdatesEnabled {
+			report.addRemediation(OnboardingBinlog, instance.Key, false, "binary logs or log_slave_updates are disabled; the replica cannot be promoted",
+				"enable log_bin and log_slave_updates")
+			continue
+		}
+		if instance.IsLastCheckValid && !IsBannedFromBeingCandidateReplica(instance) {
+			report.CountPromotableReplicas++
+		}
+	}
+	countReplicas := len(instances) - 1
+	if countReplicas > 0 && report.CountPromotableReplicas == 0 {
+		report.addRemediation(OnboardingPromotion, master.Key, true, "no replica of the master may be promoted",
+			"enable log_bin and log_slave_updates on at least one direct replica of the master, and make sure it is not marked must_not promote")
+	}
+	if countReplicas > 0 && countGTIDReplicas < countReplicas {
+		if config.Config.PseudoGTIDPattern == "" && !config.Config.AutoPseudoGTID {
+			report.addRemediation(OnboardingGTID, InstanceKey{}, true, fmt.Sprintf("%d out of %d replicas do not replicate via GTID, and Pseudo-GTID is not configured", countReplicas-countGTIDReplicas, countReplicas),
+				fmt.Sprintf("migrate the cluster onto GTID via /api/gtid-migration/%s, or enable AutoPseudoGTID", master.ClusterName))
+		} else if countGTIDReplicas > 0 {
+			report.addRemediation(OnboardingGTID, InstanceKey{}, false, fmt.Sprintf("%d out of %d replicas replicate via GTID", countGTIDReplicas, countReplicas),
+				"enable GTID auto positioning on all replicas, or on none")
+		}
+	}
+	if !hasAutomatedMasterRecovery {
+		report.addRemediation(OnboardingRecovery, InstanceKey{}, true, "cluster is not matched by RecoverMasterClusterFilters",
+			fmt.Sprintf("add the cluster name or alias to RecoverMasterClusterFilters; cluster name is %s", master.ClusterName))
+	}
+
+	report.IsReady = true
+	for _, remediation := range report.Remediations {
+		if remediation.IsBlocking {
+			report.IsReady = false
+		}
+	}
+	return report
+}
@@ -0,0 +1,81 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+
+	"github.com/openark/golib/log"
+)
+
+// discoverClusterMembers synchronously reads the topology of given seed instance, following masters and
+// replicas alike, and returns the members found along with the servers which could not be read
+func discoverClusterMembers(seedKey *InstanceKey) (instances [](*Instance), unreachableKeys []InstanceKey) {
+	unreachableKeys = []InstanceKey{}
+	visited := NewInstanceKeyMap()
+	pendingKeys := []InstanceKey{*seedKey}
+	for len(pendingKeys) > 0 {
+		instanceKey := pendingKeys[0]
+		pendingKeys = pendingKeys[1:]
+		if visited.HasKey(instanceKey) {
+			continue
+		}
+		visited.AddKey(instanceKey)
+
+		instance, err := ReadTopologyInstance(&instanceKey)
+		if err != nil || instance == nil {
+			unreachableKeys = append(unreachableKeys, instanceKey)
+			continue
+		}
+		instances = append(instances, instance)
+		if instance.IsReplica() {
+			pendingKeys = append(pendingKeys, instance.MasterKey)
+		}
+		pendingKeys = append(pendingKeys, instance.SlaveHosts.GetInstanceKeys()...)
+	}
+	return instances, unreachableKeys
+}
+
+// OnboardCluster discovers the cluster of given seed instance, checks the topology user's privileges on all
+// of its members, and reports the cluster's readiness for automated recovery along with remediation items
+func OnboardCluster(seedKey *InstanceKey) (*ClusterOnboardingReport, error) {
+	instances, unreachableKeys := discoverClusterMembers(seedKey)
+
+	privilegesChecks := make(map[InstanceKey]*TopologyPrivilegesCheck)
+	for _, instance := range instances {
+		if !instance.IsLastCheckValid {
+			continue
+		}
+		check, err := CheckTopologyPrivileges(instance)
+		if err != nil {
+			log.Errorf("OnboardCluster: cannot check privileges on %+v: %+v", instance.Key, err)
+			continue
+		}
+		privilegesChecks[instance.Key] = check
+	}
+	hasAutomatedMasterRecovery := false
+	if masters := onboardingMasters(instances); len(masters) == 1 {
+		clusterInfo, err := ReadClusterInfo(masters[0].ClusterName)
+		if err != nil {
+			return nil, log.Errore(err)
+		}
+		hasAutomatedMasterRecovery = clusterInfo.HasAutomatedMasterRecovery
+	}
+	report := evaluateClusterOnboarding(*seedKey, instances, unreachableKeys, privilegesChecks, hasAutomatedMasterRecovery)
+	AuditOperation("onboard-cluster", seedKey, fmt.Sprintf("cluster %s: %d members, %d unreachable; ready: %t; %d remediation items", report.ClusterName, len(report.Members), len(report.UnreachableKeys), report.IsReady, len(report.Remediations)))
+	return report, nil
+}
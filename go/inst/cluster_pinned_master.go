@@ -0,0 +1,53 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+
+	"github.com/github/orchestrator/go/db"
+)
+
+// ClusterPinnedMaster declares the only instance allowed to be a cluster's master, e.g. due to licensing or
+// hardware constraints on the writer. Automated recoveries will not promote any other instance. A pin is kept by
+// cluster alias, which outlives changes of the cluster's master; ClusterName is the cluster's name as of pinning.
+type ClusterPinnedMaster struct {
+	ClusterAlias   string
+	ClusterName    string
+	Key            InstanceKey
+	Owner          string
+	Reason         string
+	PinnedAtString string
+}
+
+// NewClusterPinnedMaster returns a pin of given instance as the master of given cluster
+func NewClusterPinnedMaster(clusterName string, clusterAlias string, instanceKey *InstanceKey, owner string, reason string) *ClusterPinnedMaster {
+	pinnedMaster := &ClusterPinnedMaster{
+		ClusterAlias: clusterAlias,
+		ClusterName:  clusterName,
+		Key:          *instanceKey,
+		Owner:        owner,
+		Reason:       reason,
+	}
+	pinnedMaster.PinnedAtString, _ = db.ReadTimeNow()
+	return pinnedMaster
+}
+
+// String returns a string representation of the pin
+func (pinnedMaster *ClusterPinnedMaster) String() string {
+	return fmt.Sprintf("master of cluster %s pinned to %+v by %s: %s", pinnedMaster.ClusterAlias, pinnedMaster.Key, pinnedMaster.Owner, pinnedMaster.Reason)
+}
@@ -0,0 +1,105 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+
+	"github.com/github/orchestrator/go/db"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+// WriteClusterPinnedMaster pins the master of a cluster, or replaces an existing pin
+func WriteClusterPinnedMaster(pinnedMaster *ClusterPinnedMaster) error {
+	if pinnedMaster.ClusterAlias == "" {
+		return log.Errorf("WriteClusterPinnedMaster: no cluster alias given for %+v", pinnedMaster.Key)
+	}
+	_, err := db.ExecOrchestrator(`
+			replace into cluster_master_pin (
+					cluster_alias, cluster_name, hostname, port, pin_owner, pin_reason, pin_timestamp
+				) values (
+					?, ?, ?, ?, ?, ?, ?
+				)
+			`, pinnedMaster.ClusterAlias, pinnedMaster.ClusterName, pinnedMaster.Key.Hostname, pinnedMaster.Key.Port, pinnedMaster.Owner, pinnedMaster.Reason, pinnedMaster.PinnedAtString,
+	)
+	if err != nil {
+		return log.Errore(err)
+	}
+	AuditOperation("pin-master", &pinnedMaster.Key, pinnedMaster.String())
+	return nil
+}
+
+// DeleteClusterPinnedMaster unpins the master of a cluster, given its alias
+func DeleteClusterPinnedMaster(clusterAlias string) error {
+	_, err := db.ExecOrchestrator(`
+			delete from cluster_master_pin where cluster_alias = ?
+			`, clusterAlias,
+	)
+	if err != nil {
+		return log.Errore(err)
+	}
+	AuditOperation("unpin-master", nil, fmt.Sprintf("master of cluster %s unpinned", clusterAlias))
+	return nil
+}
+
+func readClusterPinnedMasters(whereCondition string, args []interface{}) ([]ClusterPinnedMaster, error) {
+	pinnedMasters := []ClusterPinnedMaster{}
+	query := fmt.Sprintf(`
+		select
+			cluster_alias,
+			cluster_name,
+			hostname,
+			port,
+			pin_owner,
+			pin_reason,
+			pin_timestamp
+		from
+			cluster_master_pin
+		%s
+		order by
+			cluster_alias
+	`, whereCondition)
+	err := db.QueryOrchestrator(query, args, func(m sqlutils.RowMap) error {
+		pinnedMaster := ClusterPinnedMaster{
+			ClusterAlias:   m.GetString("cluster_alias"),
+			ClusterName:    m.GetString("cluster_name"),
+			Key:            InstanceKey{Hostname: m.GetString("hostname"), Port: m.GetInt("port")},
+			Owner:          m.GetString("pin_owner"),
+			Reason:         m.GetString("pin_reason"),
+			PinnedAtString: m.GetString("pin_timestamp"),
+		}
+		pinnedMasters = append(pinnedMasters, pinnedMaster)
+		return nil
+	})
+	return pinnedMasters, log.Errore(err)
+}
+
+// ReadClusterPinnedMasters reads the pinned masters of all clusters
+func ReadClusterPinnedMasters() ([]ClusterPinnedMaster, error) {
+	return readClusterPinnedMasters("", sqlutils.Args())
+}
+
+// ReadClusterPinnedMaster reads the pinned master of a cluster, given its alias, or nil if the cluster's master is
+// not pinned
+func ReadClusterPinnedMaster(clusterAlias string) (*ClusterPinnedMaster, error) {
+	pinnedMasters, err := readClusterPinnedMasters("where cluster_alias = ?", sqlutils.Args(clusterAlias))
+	if err != nil || len(pinnedMasters) == 0 {
+		return nil, err
+	}
+	return &pinnedMasters[0], nil
+}
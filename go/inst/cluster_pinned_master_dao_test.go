@@ -0,0 +1,75 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"testing"
+
+	test "github.com/openark/golib/tests"
+)
+
+func TestClusterPinnedMasterByAlias(t *testing.T) {
+	withSQLiteBackend(t)
+
+	pinnedKey := InstanceKey{Hostname: "db-1", Port: 3306}
+	err := WriteClusterPinnedMaster(NewClusterPinnedMaster("db-0:3306", "orders", &pinnedKey, "ops", "licensed writer"))
+	test.S(t).ExpectNil(err)
+
+	// the pin is kept by alias, and is read as such once the cluster is renamed after its new master
+	pinnedMaster, err := ReadClusterPinnedMaster("orders")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectNotNil(pinnedMaster)
+	test.S(t).ExpectEquals(pinnedMaster.ClusterAlias, "orders")
+	test.S(t).ExpectEquals(pinnedMaster.ClusterName, "db-0:3306")
+	test.S(t).ExpectTrue(pinnedMaster.Key.Equals(&pinnedKey))
+	test.S(t).ExpectEquals(pinnedMaster.Owner, "ops")
+
+	pinnedMaster, err = ReadClusterPinnedMaster("db-0:3306")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(pinnedMaster == nil)
+
+	// a new pin replaces the cluster's previous pin
+	repinnedKey := InstanceKey{Hostname: "db-2", Port: 3306}
+	err = WriteClusterPinnedMaster(NewClusterPinnedMaster("db-1:3306", "orders", &repinnedKey, "ops", "moved license"))
+	test.S(t).ExpectNil(err)
+	err = WriteClusterPinnedMaster(NewClusterPinnedMaster("db-7:3306", "billing", &InstanceKey{Hostname: "db-7", Port: 3306}, "ops", ""))
+	test.S(t).ExpectNil(err)
+
+	pinnedMasters, err := ReadClusterPinnedMasters()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(pinnedMasters), 2)
+	test.S(t).ExpectEquals(pinnedMasters[0].ClusterAlias, "billing")
+	test.S(t).ExpectEquals(pinnedMasters[1].ClusterAlias, "orders")
+	test.S(t).ExpectTrue(pinnedMasters[1].Key.Equals(&repinnedKey))
+	test.S(t).ExpectEquals(pinnedMasters[1].ClusterName, "db-1:3306")
+
+	err = DeleteClusterPinnedMaster("orders")
+	test.S(t).ExpectNil(err)
+	pinnedMaster, err = ReadClusterPinnedMaster("orders")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(pinnedMaster == nil)
+	pinnedMasters, err = ReadClusterPinnedMasters()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(pinnedMasters), 1)
+}
+
+func TestWriteClusterPinnedMasterRequiresAlias(t *testing.T) {
+	withSQLiteBackend(t)
+
+	err := WriteClusterPinnedMaster(NewClusterPinnedMaster("db-0:3306", "", &InstanceKey{Hostname: "db-0", Port: 3306}, "ops", ""))
+	test.S(t).ExpectNotNil(err)
+}
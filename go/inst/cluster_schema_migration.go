@@ -0,0 +1,101 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/github/orchestrator/go/db"
+)
+
+// SchemaMigrationSuppressedAction is an automated action which an in-progress schema migration may suppress
+type SchemaMigrationSuppressedAction string
+
+const (
+	SuppressMasterRecovery             SchemaMigrationSuppressedAction = "master-recovery"
+	SuppressIntermediateMasterRecovery SchemaMigrationSuppressedAction = "intermediate-master-recovery"
+	SuppressCoMasterRecovery           SchemaMigrationSuppressedAction = "co-master-recovery"
+	SuppressTopologyRelocations        SchemaMigrationSuppressedAction = "topology-relocations"
+)
+
+// defaultSchemaMigrationSuppressedActions are suppressed by migrations which do not list their suppressed actions:
+// those which relocate replicas, and so may pull the replica a migration tool works against from under it
+var defaultSchemaMigrationSuppressedActions = []SchemaMigrationSuppressedAction{SuppressIntermediateMasterRecovery, SuppressTopologyRelocations}
+
+// ParseSchemaMigrationSuppressedActions parses a comma delimited list of suppressed actions. An empty list
+// returns the default actions.
+func ParseSchemaMigrationSuppressedActions(actionsList string) (actions []SchemaMigrationSuppressedAction, err error) {
+	if strings.TrimSpace(actionsList) == "" {
+		return defaultSchemaMigrationSuppressedActions, nil
+	}
+	for _, token := range strings.Split(actionsList, ",") {
+		switch action := SchemaMigrationSuppressedAction(strings.TrimSpace(token)); action {
+		case SuppressMasterRecovery, SuppressIntermediateMasterRecovery, SuppressCoMasterRecovery, SuppressTopologyRelocations:
+			actions = append(actions, action)
+		default:
+			return nil, fmt.Errorf("Unknown suppressed action: %s", token)
+		}
+	}
+	return actions, nil
+}
+
+// ClusterSchemaMigration is an in-progress schema migration on a cluster, as registered by a migration tool
+// (e.g. gh-ost or pt-online-schema-change). While in progress, it suppresses automated actions which would
+// break it. A migration expires unless re-registered, so that a crashed tool does not suppress actions forever.
+// A migration is kept by cluster alias, which outlives changes of the cluster's master; ClusterName is the cluster's
+// name as of registration.
+type ClusterSchemaMigration struct {
+	ClusterAlias      string
+	ClusterName       string
+	MigrationId       string
+	Owner             string
+	Description       string
+	SuppressedActions []SchemaMigrationSuppressedAction
+	StartedAtString   string
+	ExpiresAtString   string
+}
+
+// NewClusterSchemaMigration returns a schema migration registration, expiring given number of seconds from now
+func NewClusterSchemaMigration(clusterName string, clusterAlias string, migrationId string, owner string, description string, suppressedActions []SchemaMigrationSuppressedAction, durationSeconds uint) *ClusterSchemaMigration {
+	migration := &ClusterSchemaMigration{
+		ClusterAlias:      clusterAlias,
+		ClusterName:       clusterName,
+		MigrationId:       migrationId,
+		Owner:             owner,
+		Description:       description,
+		SuppressedActions: suppressedActions,
+	}
+	migration.StartedAtString, _ = db.ReadTimeNow()
+	migration.ExpiresAtString = AddSecondsToTimeString(migration.StartedAtString, durationSeconds)
+	return migration
+}
+
+// Suppresses checks whether this migration suppresses given action
+func (migration *ClusterSchemaMigration) Suppresses(action SchemaMigrationSuppressedAction) bool {
+	for _, suppressedAction := range migration.SuppressedActions {
+		if suppressedAction == action {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns a string representation of the migration
+func (migration *ClusterSchemaMigration) String() string {
+	return fmt.Sprintf("schema migration %s on cluster %s by %s until %s, suppressing %+v: %s", migration.MigrationId, migration.ClusterAlias, migration.Owner, migration.ExpiresAtString, migration.SuppressedActions, migration.Description)
+}
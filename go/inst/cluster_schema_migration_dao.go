@@ -0,0 +1,141 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/github/orchestrator/go/db"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+// WriteClusterSchemaMigration registers an in-progress schema migration, or extends an existing registration.
+// The original start time of a re-registered migration is kept.
+func WriteClusterSchemaMigration(migration *ClusterSchemaMigration) error {
+	if migration.ClusterAlias == "" {
+		return log.Errorf("WriteClusterSchemaMigration: no cluster alias given for schema migration %s of %s", migration.MigrationId, migration.ClusterName)
+	}
+	if migration.ExpiresAtString == "" {
+		return fmt.Errorf("WriteClusterSchemaMigration: no expiry given for schema migration %s of %s", migration.MigrationId, migration.ClusterAlias)
+	}
+	suppressedActions := []string{}
+	for _, action := range migration.SuppressedActions {
+		suppressedActions = append(suppressedActions, string(action))
+	}
+	_, err := db.ExecOrchestrator(`
+			insert into online_schema_migration (
+					cluster_alias, migration_id, cluster_name, migration_owner, description, suppressed_actions, start_timestamp, expires_at
+				) values (
+					?, ?, ?, ?, ?, ?, ?, ?
+				)
+				on duplicate key update
+					cluster_name=values(cluster_name),
+					migration_owner=values(migration_owner),
+					description=values(description),
+					suppressed_actions=values(suppressed_actions),
+					expires_at=values(expires_at)
+			`, migration.ClusterAlias, migration.MigrationId, migration.ClusterName, migration.Owner, migration.Description, strings.Join(suppressedActions, ","), migration.StartedAtString, migration.ExpiresAtString,
+	)
+	if err != nil {
+		return log.Errore(err)
+	}
+	AuditOperation("register-schema-migration", nil, migration.String())
+	return nil
+}
+
+// DeleteClusterSchemaMigration unregisters a schema migration of a cluster, given its alias, once complete
+func DeleteClusterSchemaMigration(clusterAlias string, migrationId string) error {
+	_, err := db.ExecOrchestrator(`
+			delete from online_schema_migration where cluster_alias = ? and migration_id = ?
+			`, clusterAlias, migrationId,
+	)
+	if err != nil {
+		return log.Errore(err)
+	}
+	AuditOperation("unregister-schema-migration", nil, fmt.Sprintf("schema migration %s on cluster %s unregistered", migrationId, clusterAlias))
+	return nil
+}
+
+// ExpireClusterSchemaMigrations removes schema migrations which were not re-registered in time
+func ExpireClusterSchemaMigrations() error {
+	_, err := db.ExecOrchestrator(`
+			delete from online_schema_migration where expires_at < NOW()
+			`,
+	)
+	return log.Errore(err)
+}
+
+// ReadClusterSchemaMigrations reads in-progress schema migrations of a cluster, given its alias, or of all clusters
+// given an empty alias
+func ReadClusterSchemaMigrations(clusterAlias string) ([]ClusterSchemaMigration, error) {
+	migrations := []ClusterSchemaMigration{}
+	query := `
+		select
+			cluster_alias,
+			cluster_name,
+			migration_id,
+			migration_owner,
+			description,
+			suppressed_actions,
+			start_timestamp,
+			expires_at
+		from
+			online_schema_migration
+		where
+			expires_at > NOW()
+			and (cluster_alias = ? or ? = '')
+		order by
+			cluster_alias, start_timestamp
+	`
+	err := db.QueryOrchestrator(query, sqlutils.Args(clusterAlias, clusterAlias), func(m sqlutils.RowMap) error {
+		migration := ClusterSchemaMigration{
+			ClusterAlias:      m.GetString("cluster_alias"),
+			ClusterName:       m.GetString("cluster_name"),
+			MigrationId:       m.GetString("migration_id"),
+			Owner:             m.GetString("migration_owner"),
+			Description:       m.GetString("description"),
+			SuppressedActions: []SchemaMigrationSuppressedAction{},
+			StartedAtString:   m.GetString("start_timestamp"),
+			ExpiresAtString:   m.GetString("expires_at"),
+		}
+		for _, action := range strings.Split(m.GetString("suppressed_actions"), ",") {
+			if action != "" {
+				migration.SuppressedActions = append(migration.SuppressedActions, SchemaMigrationSuppressedAction(action))
+			}
+		}
+		migrations = append(migrations, migration)
+		return nil
+	})
+	return migrations, log.Errore(err)
+}
+
+// ReadSuppressingSchemaMigration returns an in-progress schema migration of a cluster, given its alias, which
+// suppresses given action, or nil if there is none
+func ReadSuppressingSchemaMigration(clusterAlias string, action SchemaMigrationSuppressedAction) (*ClusterSchemaMigration, error) {
+	migrations, err := ReadClusterSchemaMigrations(clusterAlias)
+	if err != nil {
+		return nil, err
+	}
+	for _, migration := range migrations {
+		if migration.Suppresses(action) {
+			return &migration, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,66 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"testing"
+
+	test "github.com/openark/golib/tests"
+)
+
+func TestClusterSchemaMigrationByAlias(t *testing.T) {
+	withSQLiteBackend(t)
+
+	migration := NewClusterSchemaMigration("db-0:3306", "orders", "gh-ost-orders.items", "alice", "add column", []SchemaMigrationSuppressedAction{SuppressMasterRecovery}, 600)
+	err := WriteClusterSchemaMigration(migration)
+	test.S(t).ExpectNil(err)
+
+	// the migration is kept by alias, and suppresses actions once the cluster is renamed after its new master
+	migrations, err := ReadClusterSchemaMigrations("orders")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(migrations), 1)
+	test.S(t).ExpectEquals(migrations[0].ClusterAlias, "orders")
+	test.S(t).ExpectEquals(migrations[0].ClusterName, "db-0:3306")
+	suppressing, err := ReadSuppressingSchemaMigration("orders", SuppressMasterRecovery)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectNotNil(suppressing)
+	suppressing, err = ReadSuppressingSchemaMigration("db-0:3306", SuppressMasterRecovery)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(suppressing == nil)
+
+	// registering again, as of the cluster's new name, extends the same migration
+	migration = NewClusterSchemaMigration("db-1:3306", "orders", "gh-ost-orders.items", "alice", "add column", []SchemaMigrationSuppressedAction{SuppressMasterRecovery}, 1200)
+	err = WriteClusterSchemaMigration(migration)
+	test.S(t).ExpectNil(err)
+	migrations, err = ReadClusterSchemaMigrations("")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(migrations), 1)
+	test.S(t).ExpectEquals(migrations[0].ClusterName, "db-1:3306")
+
+	err = DeleteClusterSchemaMigration("orders", "gh-ost-orders.items")
+	test.S(t).ExpectNil(err)
+	suppressing, err = ReadSuppressingSchemaMigration("orders", SuppressMasterRecovery)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(suppressing == nil)
+}
+
+func TestWriteClusterSchemaMigrationRequiresAlias(t *testing.T) {
+	withSQLiteBackend(t)
+
+	err := WriteClusterSchemaMigration(NewClusterSchemaMigration("db-0:3306", "", "gh-ost-orders.items", "alice", "", nil, 600))
+	test.S(t).ExpectNotNil(err)
+}
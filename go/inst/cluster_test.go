@@ -18,8 +18,11 @@ package inst
 
 import (
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/kv"
 	"github.com/openark/golib/log"
 	test "github.com/openark/golib/tests"
 	"testing"
@@ -81,3 +84,383 @@ func TestGetClusterMasterKVPairs2(t *testing.T) {
 	kvPairs := GetClusterMasterKVPairs("", &masterKey)
 	test.S(t).ExpectEquals(len(kvPairs), 0)
 }
+
+func TestNextCutoverToken(t *testing.T) {
+	previousMasterKey := InstanceKey{Hostname: "host0", Port: 3306}
+	token := NextCutoverToken(nil, "myalias", &masterKey, &previousMasterKey, "2017-03-01T14:32:00Z")
+	test.S(t).ExpectEquals(token.Epoch, int64(1))
+	test.S(t).ExpectEquals(token.ClusterAlias, "myalias")
+	test.S(t).ExpectTrue(token.MasterKey.Equals(&masterKey))
+	test.S(t).ExpectTrue(token.PreviousMasterKey.Equals(&previousMasterKey))
+	test.S(t).ExpectEquals(token.Timestamp, "2017-03-01T14:32:00Z")
+
+	token = NextCutoverToken(token, "myalias", &previousMasterKey, &masterKey, "2017-03-02T14:32:00Z")
+	test.S(t).ExpectEquals(token.Epoch, int64(2))
+	test.S(t).ExpectTrue(token.MasterKey.Equals(&previousMasterKey))
+	test.S(t).ExpectEquals(GetClusterCutoverKVKey("myalias"), "test/master/myalias/cutover")
+}
+
+func TestWriteClusterMasterEntries(t *testing.T) {
+	withSQLiteBackend(t)
+	kv.InitKVStores()
+
+	previousMasterKey := InstanceKey{Hostname: "host0", Port: 3306}
+	token, err := WriteClusterMasterEntries(NewClusterMasterEntries("myalias", GetClusterMasterKVPairs("myalias", &masterKey), &masterKey, &previousMasterKey))
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(token.Epoch, int64(1))
+	token, err = WriteClusterMasterEntries(NewClusterMasterEntries("myalias", GetClusterMasterKVPairs("myalias", &previousMasterKey), &previousMasterKey, &masterKey))
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(token.Epoch, int64(2))
+
+	// master entries and token are written together
+	value, err := kv.GetValue("test/master/myalias")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(value, "host0:3306")
+	token, err = ReadCutoverToken("myalias")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(token.Epoch, int64(2))
+	test.S(t).ExpectTrue(token.MasterKey.Equals(&previousMasterKey))
+	test.S(t).ExpectTrue(token.PreviousMasterKey.Equals(&masterKey))
+
+	// concurrent failovers never share an epoch
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			WriteClusterMasterEntries(NewClusterMasterEntries("myalias", nil, &masterKey, &previousMasterKey))
+		}()
+	}
+	wg.Wait()
+	token, err = ReadCutoverToken("myalias")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(token.Epoch, int64(10))
+
+	// a cluster with no alias has no token
+	token, err = WriteClusterMasterEntries(NewClusterMasterEntries("", nil, &masterKey, &previousMasterKey))
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(token == nil)
+}
+
+func TestWriteClusterMasterEntriesGivenToken(t *testing.T) {
+	withSQLiteBackend(t)
+	kv.InitKVStores()
+
+	previousMasterKey := InstanceKey{Hostname: "host0", Port: 3306}
+	entries := NewClusterMasterEntries("myalias", GetClusterMasterKVPairs("myalias", &masterKey), &masterKey, &previousMasterKey)
+	err := entries.AssignCutoverToken()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(entries.Token.Epoch, int64(1))
+
+	// the given token is written as is, however many times the entries are applied
+	for i := 0; i < 3; i++ {
+		_, err = WriteClusterMasterEntries(entries)
+		test.S(t).ExpectNil(err)
+		token, err := ReadCutoverToken("myalias")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(token.Epoch, int64(1))
+		test.S(t).ExpectEquals(token.Timestamp, entries.Timestamp)
+	}
+
+	// entries of a later failover are applied; re-applying earlier entries changes nothing
+	laterEntries := NewClusterMasterEntries("myalias", GetClusterMasterKVPairs("myalias", &previousMasterKey), &previousMasterKey, &masterKey)
+	err = laterEntries.AssignCutoverToken()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(laterEntries.Token.Epoch, int64(2))
+	token, err := WriteClusterMasterEntries(laterEntries)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(token.Epoch, int64(2))
+
+	token, err = WriteClusterMasterEntries(entries)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(token == nil)
+	token, err = ReadCutoverToken("myalias")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(token.Epoch, int64(2))
+	test.S(t).ExpectTrue(token.MasterKey.Equals(&previousMasterKey))
+	value, err := kv.GetValue("test/master/myalias")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(value, "host0:3306")
+}
+
+func TestWriteClusterMasterEntriesUnparsableToken(t *testing.T) {
+	withSQLiteBackend(t)
+	kv.InitKVStores()
+
+	err := kv.PutValue(GetClusterCutoverKVKey("myalias"), "not-a-token")
+	test.S(t).ExpectNil(err)
+	previousMasterKey := InstanceKey{Hostname: "host0", Port: 3306}
+	token, err := WriteClusterMasterEntries(NewClusterMasterEntries("myalias", GetClusterMasterKVPairs("myalias", &masterKey), &masterKey, &previousMasterKey))
+	test.S(t).ExpectNotNil(err)
+	test.S(t).ExpectTrue(token == nil)
+
+	// the master entries are written regardless; the token is left as is
+	value, err := kv.GetValue("test/master/myalias")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(value, "host1:3306")
+	value, err = kv.GetValue(GetClusterCutoverKVKey("myalias"))
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(value, "not-a-token")
+}
+
+func TestDetectionThresholds(t *testing.T) {
+	defer func() { config.Config.DetectionProfiles = map[string]string{} }()
+	config.Config.DetectionProfiles = map[string]string{
+		"aggressive-cluster":   AggressiveDetectionProfile,
+		"conservative-cluster": ConservativeDetectionProfile,
+	}
+	{
+		thresholds := NewDetectionThresholds("db-1:3306", "normal-cluster")
+		test.S(t).ExpectEquals(thresholds.Profile, NormalDetectionProfile)
+		test.S(t).ExpectEquals(thresholds.FailedPolls, uint(1))
+		test.S(t).ExpectTrue(thresholds.isLastCheckValid(0, int64(config.Config.InstancePollSeconds)))
+		test.S(t).ExpectFalse(thresholds.isLastCheckValid(int64(config.Config.InstancePollSeconds), int64(config.Config.InstancePollSeconds)))
+
+		a := &ReplicationAnalysis{Analysis: DeadMaster, CountReplicas: 2, CountValidReplicas: 2}
+		thresholds.applyReplicaCorroboration(a)
+		test.S(t).ExpectEquals(a.Analysis, AnalysisCode(DeadMaster))
+	}
+	{
+		thresholds := NewDetectionThresholds("db-2:3306", "conservative-cluster")
+		test.S(t).ExpectEquals(thresholds.FailedPolls, uint(3))
+		test.S(t).ExpectTrue(thresholds.isLastCheckValid(int64(config.Config.InstancePollSeconds), int64(config.Config.InstancePollSeconds)))
+		test.S(t).ExpectFalse(thresholds.isLastCheckValid(int64(3*config.Config.InstancePollSeconds), int64(3*config.Config.InstancePollSeconds)))
+
+		a := &ReplicationAnalysis{Analysis: DeadMaster, CountReplicas: 2, CountValidReplicas: 2, CountReplicasFailingToConnectToMaster: 1}
+		thresholds.applyReplicaCorroboration(a)
+		test.S(t).ExpectEquals(a.Analysis, AnalysisCode(UnreachableMaster))
+
+		a = &ReplicationAnalysis{Analysis: DeadMaster, CountReplicas: 2, CountValidReplicas: 2, CountReplicasFailingToConnectToMaster: 2}
+		thresholds.applyReplicaCorroboration(a)
+		test.S(t).ExpectEquals(a.Analysis, AnalysisCode(DeadMaster))
+	}
+	{
+		thresholds := NewDetectionThresholds("db-3:3306", "aggressive-cluster")
+		test.S(t).ExpectEquals(thresholds.ReplicaCorroborationPercent, uint(50))
+
+		a := &ReplicationAnalysis{Analysis: UnreachableMaster, CountReplicas: 4, CountValidReplicas: 4, CountValidReplicatingReplicas: 2, CountReplicasFailingToConnectToMaster: 2}
+		thresholds.applyReplicaCorroboration(a)
+		test.S(t).ExpectEquals(a.Analysis, AnalysisCode(DeadMaster))
+
+		a = &ReplicationAnalysis{Analysis: UnreachableMaster, CountReplicas: 4, CountValidReplicas: 4, CountValidReplicatingReplicas: 3, CountReplicasFailingToConnectToMaster: 1}
+		thresholds.applyReplicaCorroboration(a)
+		test.S(t).ExpectEquals(a.Analysis, AnalysisCode(UnreachableMaster))
+	}
+}
+
+func TestNewLagSLOStatus(t *testing.T) {
+	lagSLO := config.LagSLOConfiguration{ThresholdSeconds: 5, TargetRatio: 0.8, WindowHours: 1, BurnRateWindowMinutes: 10}
+	now := time.Now().Truncate(time.Minute)
+	{
+		status := NewLagSLOStatus("db-1:3306", "mycluster", lagSLO, []LagSample{}, now)
+		test.S(t).ExpectEquals(status.CountSampledMinutes, uint(0))
+		test.S(t).ExpectEquals(status.Compliance, float64(1))
+		test.S(t).ExpectTrue(status.IsMet)
+		test.S(t).ExpectEquals(status.ErrorBudgetRemaining, float64(1))
+		test.S(t).ExpectEquals(status.BurnRate, float64(0))
+	}
+	{
+		samples := []LagSample{{SampleUnixTimestamp: now.Add(-2 * time.Hour).Unix(), MaxLagSeconds: 100}}
+		for i := 59; i >= 0; i-- {
+			sample := LagSample{SampleUnixTimestamp: now.Add(-time.Duration(i) * time.Minute).Unix(), MaxLagSeconds: 1, CountReplicas: 2}
+			if i < 5 {
+				sample.MaxLagSeconds = 10
+			}
+			if i == 30 {
+				sample.CountUnknownLag = 1
+			}
+			samples = append(samples, sample)
+		}
+		status := NewLagSLOStatus("db-1:3306", "mycluster", lagSLO, samples, now)
+		test.S(t).ExpectEquals(status.CountSampledMinutes, uint(60))
+		test.S(t).ExpectEquals(status.CountCompliantMinutes, uint(54))
+		test.S(t).ExpectTrue(status.IsMet)
+		// 6 out of 12 minutes of error budget are spent
+		test.S(t).ExpectTrue(status.ErrorBudgetRemaining > 0.49 && status.ErrorBudgetRemaining < 0.51)
+		// 5 out of 11 minutes in the burn rate window are non compliant
+		test.S(t).ExpectTrue(status.BurnRate > 2.2 && status.BurnRate < 2.3)
+	}
+}
+
+func TestParseSchemaMigrationSuppressedActions(t *testing.T) {
+	{
+		actions, err := ParseSchemaMigrationSuppressedActions("")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(len(actions), 2)
+		migration := ClusterSchemaMigration{SuppressedActions: actions}
+		test.S(t).ExpectTrue(migration.Suppresses(SuppressIntermediateMasterRecovery))
+		test.S(t).ExpectTrue(migration.Suppresses(SuppressTopologyRelocations))
+		test.S(t).ExpectFalse(migration.Suppresses(SuppressMasterRecovery))
+	}
+	{
+		actions, err := ParseSchemaMigrationSuppressedActions("master-recovery, co-master-recovery")
+		test.S(t).ExpectNil(err)
+		migration := ClusterSchemaMigration{SuppressedActions: actions}
+		test.S(t).ExpectTrue(migration.Suppresses(SuppressMasterRecovery))
+		test.S(t).ExpectTrue(migration.Suppresses(SuppressCoMasterRecovery))
+		test.S(t).ExpectFalse(migration.Suppresses(SuppressIntermediateMasterRecovery))
+	}
+	{
+		_, err := ParseSchemaMigrationSuppressedActions("master-recovery,relocate-everything")
+		test.S(t).ExpectNotNil(err)
+	}
+}
+
+func TestApplyAnalysisHysteresis(t *testing.T) {
+	defer func() {
+		config.Config.AnalysisRaiseCycles = 1
+		config.Config.AnalysisClearCycles = 1
+	}()
+	config.Config.AnalysisRaiseCycles = 3
+	config.Config.AnalysisClearCycles = 2
+	instanceKey := &InstanceKey{Hostname: "hysteresis-host", Port: 3306}
+
+	test.S(t).ExpectEquals(applyAnalysisHysteresis(instanceKey, NoProblem), AnalysisCode(NoProblem))
+	test.S(t).ExpectEquals(applyAnalysisHysteresis(instanceKey, DeadMaster), AnalysisCode(NoProblem))
+	test.S(t).ExpectEquals(applyAnalysisHysteresis(instanceKey, DeadMaster), AnalysisCode(NoProblem))
+	// flapping resets the count
+	test.S(t).ExpectEquals(applyAnalysisHysteresis(instanceKey, NoProblem), AnalysisCode(NoProblem))
+	test.S(t).ExpectEquals(applyAnalysisHysteresis(instanceKey, DeadMaster), AnalysisCode(NoProblem))
+	test.S(t).ExpectEquals(applyAnalysisHysteresis(instanceKey, DeadMaster), AnalysisCode(NoProblem))
+	test.S(t).ExpectEquals(applyAnalysisHysteresis(instanceKey, DeadMaster), AnalysisCode(DeadMaster))
+
+	test.S(t).ExpectEquals(applyAnalysisHysteresis(instanceKey, NoProblem), AnalysisCode(DeadMaster))
+	test.S(t).ExpectEquals(applyAnalysisHysteresis(instanceKey, NoProblem), AnalysisCode(NoProblem))
+}
+
+func TestCompareClusters(t *testing.T) {
+	newComparedInstance := func(hostname string, masterHostname string, gtidSet string) *Instance {
+		instance := NewInstance()
+		instance.Key = InstanceKey{Hostname: hostname, Port: 3306}
+		if masterHostname != "" {
+			instance.MasterKey = InstanceKey{Hostname: masterHostname, Port: 3306}
+			instance.UsingOracleGTID = true
+			instance.Slave_IO_Running = true
+			instance.Slave_SQL_Running = true
+			instance.SlaveLagSeconds.Valid = true
+		}
+		instance.IsLastCheckValid = true
+		instance.Version = "5.7.26"
+		instance.ExecutedGtidSet = gtidSet
+		return instance
+	}
+	blue := [](*Instance){
+		newComparedInstance("blue-1", "", "230ea8ea-81e3-11e4-972a-e25ec4bd140a:1-100"),
+		newComparedInstance("blue-2", "blue-1", "230ea8ea-81e3-11e4-972a-e25ec4bd140a:1-100"),
+	}
+	green := [](*Instance){
+		newComparedInstance("green-1", "blue-1", "230ea8ea-81e3-11e4-972a-e25ec4bd140a:1-90"),
+		newComparedInstance("green-2", "green-1", "230ea8ea-81e3-11e4-972a-e25ec4bd140a:1-90"),
+	}
+	green[1].Version = "8.0.18"
+	{
+		comparison := compareClusters("blue", blue, "green", green)
+		test.S(t).ExpectEquals(comparison.A.MasterKey.Hostname, "blue-1")
+		test.S(t).ExpectEquals(comparison.B.MasterKey.Hostname, "green-1")
+		test.S(t).ExpectEquals(comparison.B.Versions["8.0.18"], 1)
+		test.S(t).ExpectEquals(len(comparison.ReplicationLinks), 1)
+		test.S(t).ExpectTrue(comparison.ReplicationLinks[0].IsHealthy)
+		test.S(t).ExpectEquals(comparison.A.GtidsMissingFromOther, "230ea8ea-81e3-11e4-972a-e25ec4bd140a:91-100")
+		test.S(t).ExpectEquals(comparison.B.GtidsMissingFromOther, "")
+		test.S(t).ExpectTrue(comparison.IsCutoverReady)
+	}
+	{
+		green[0].ExecutedGtidSet = "230ea8ea-81e3-11e4-972a-e25ec4bd140a:1-90,\n321f5c0d-70e5-11e5-adb2-ecf4bb2262ff:1-3"
+		green[0].Slave_IO_Running = false
+		comparison := compareClusters("blue", blue, "green", green)
+		test.S(t).ExpectEquals(comparison.B.GtidsMissingFromOther, "321f5c0d-70e5-11e5-adb2-ecf4bb2262ff:1-3")
+		test.S(t).ExpectFalse(comparison.ReplicationLinks[0].IsHealthy)
+		test.S(t).ExpectEquals(len(comparison.Problems), 2)
+		test.S(t).ExpectFalse(comparison.IsCutoverReady)
+	}
+}
+
+func TestSplitComparedSubtree(t *testing.T) {
+	newSubtreeInstance := func(hostname string, masterHostname string) *Instance {
+		instance := NewInstance()
+		instance.Key = InstanceKey{Hostname: hostname, Port: 3306}
+		if masterHostname != "" {
+			instance.MasterKey = InstanceKey{Hostname: masterHostname, Port: 3306}
+		}
+		return instance
+	}
+	// green replicates from blue, and so shares its cluster
+	instances := [](*Instance){
+		newSubtreeInstance("blue-1", ""),
+		newSubtreeInstance("blue-2", "blue-1"),
+		newSubtreeInstance("green-1", "blue-1"),
+		newSubtreeInstance("green-2", "green-1"),
+		newSubtreeInstance("green-3", "green-2"),
+	}
+	{
+		others, subtree := splitComparedSubtree(instances, &InstanceKey{Hostname: "green-1", Port: 3306})
+		test.S(t).ExpectEquals(len(others), 2)
+		test.S(t).ExpectEquals(len(subtree), 3)
+		comparison := compareClusters("blue", others, "green", subtree)
+		test.S(t).ExpectEquals(comparison.A.MasterKey.Hostname, "blue-1")
+		test.S(t).ExpectEquals(comparison.B.MasterKey.Hostname, "green-1")
+		test.S(t).ExpectEquals(len(comparison.ReplicationLinks), 1)
+		test.S(t).ExpectEquals(comparison.ReplicationLinks[0].Key.Hostname, "green-1")
+	}
+	{
+		others, subtree := splitComparedSubtree(instances, &InstanceKey{Hostname: "blue-1", Port: 3306})
+		test.S(t).ExpectEquals(len(others), 0)
+		test.S(t).ExpectEquals(len(subtree), 5)
+	}
+	{
+		// co-masters replicate from each other
+		instances[0].MasterKey = InstanceKey{Hostname: "blue-2", Port: 3306}
+		others, subtree := splitComparedSubtree(instances, &InstanceKey{Hostname: "green-2", Port: 3306})
+		test.S(t).ExpectEquals(len(others), 3)
+		test.S(t).ExpectEquals(len(subtree), 2)
+		others, subtree = splitComparedSubtree(instances, &InstanceKey{Hostname: "blue-2", Port: 3306})
+		test.S(t).ExpectEquals(len(others), 0)
+		test.S(t).ExpectEquals(len(subtree), 5)
+	}
+}
+
+func TestGetTemplatedMasterKVPairs(t *testing.T) {
+	data := &KVMasterEntryData{
+		ClusterAlias: "myalias",
+		DataCenter:   "dc1",
+		Hostname:     masterKey.Hostname,
+		Port:         masterKey.Port,
+		MasterKey:    masterKey.StringCode(),
+		Attributes:   map[string]string{"role": "writer"},
+	}
+	{
+		entryTemplates := []config.KVMasterEntryTemplate{
+			{Key: "mysql/master/{{.ClusterAlias}}", Value: "{{.Hostname}}:{{.Port}}"},
+			{Key: "service/{{.ClusterAlias}}/{{.DataCenter}}/{{index .Attributes \"role\"}}", Value: "{{.MasterKey}}"},
+			{Key: "service/{{.ClusterAlias}}/owner", Value: "{{index .Attributes \"owner\"}}"},
+		}
+		kvPairs, err := getTemplatedMasterKVPairs(entryTemplates, data)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(len(kvPairs), 3)
+		test.S(t).ExpectEquals(kvPairs[0].Key, "mysql/master/myalias")
+		test.S(t).ExpectEquals(kvPairs[0].Value, masterKey.StringCode())
+		test.S(t).ExpectEquals(kvPairs[1].Key, "service/myalias/dc1/writer")
+		test.S(t).ExpectEquals(kvPairs[1].Value, masterKey.StringCode())
+		test.S(t).ExpectEquals(kvPairs[2].Value, "")
+	}
+	{
+		entryTemplates := []config.KVMasterEntryTemplate{
+			{Key: "{{.ClusterDomain}}", Value: "{{.Hostname}}"},
+		}
+		_, err := getTemplatedMasterKVPairs(entryTemplates, data)
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		// An entry failing to render does not stop the others
+		entryTemplates := []config.KVMasterEntryTemplate{
+			{Key: "{{.ClusterDomain}}", Value: "{{.Hostname}}"},
+			{Key: "service/{{.ClusterAlias}}/writer", Value: "{{.NoSuchField}}"},
+			{Key: "mysql/master/{{.ClusterAlias}}", Value: "{{.MasterKey}}"},
+		}
+		kvPairs, err := getTemplatedMasterKVPairs(entryTemplates, data)
+		test.S(t).ExpectNotNil(err)
+		test.S(t).ExpectEquals(len(kvPairs), 1)
+		test.S(t).ExpectEquals(kvPairs[0].Key, "mysql/master/myalias")
+		test.S(t).ExpectEquals(kvPairs[0].Value, masterKey.StringCode())
+	}
+}
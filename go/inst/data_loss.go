@@ -0,0 +1,182 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// tableMapEventInfoRegexp extracts the table of a Table_map binlog event, as in "table_id: 108 (shop.orders)"
+var tableMapEventInfoRegexp = regexp.MustCompile(`table_id: [0-9]+ [(](.+)[)]`)
+
+// DataLossSourceRole is the role in a recovery of a server having transactions not on the promoted server
+type DataLossSourceRole string
+
+const (
+	DataLossFailedMaster DataLossSourceRole = "failed-master"
+	DataLossLostReplica  DataLossSourceRole = "lost-replica"
+)
+
+// DataLossSpan describes the transactions a server executed or received which are not on the promoted server.
+// Binlog coordinates refer to the failed master's binary logs; SpanBytes is -1 when the span crosses binary logs.
+type DataLossSpan struct {
+	Key                   InstanceKey
+	Role                  DataLossSourceRole
+	LostGtidSet           string
+	CountLostTransactions int64
+	FromCoordinates       BinlogCoordinates
+	ToCoordinates         BinlogCoordinates
+	SpanBytes             int64
+	CountBinaryLogs       int
+	AffectedSchemas       []string
+	AffectedTables        []string
+	IsSampled             bool
+	SampleError           string
+}
+
+// IsEmpty returns true when the span has neither lost transactions nor a binlog span
+func (this *DataLossSpan) IsEmpty() bool {
+	return this.LostGtidSet == "" && this.CountBinaryLogs == 0
+}
+
+// DataLossReport estimates the data lost in a recovery: transactions on the failed master, or on replicas lost in
+// the recovery, which are not on the promoted server. The estimate is based on the servers' last seen state: the
+// failed master may have committed further transactions after it was last seen.
+type DataLossReport struct {
+	FailedMasterKey     InstanceKey
+	PromotedKey         InstanceKey
+	IsDataLossEstimated bool
+	Spans               []DataLossSpan
+	Notes               []string
+}
+
+// setBinlogSpan notes the span of binary logs between given coordinates, if any
+func (this *DataLossSpan) setBinlogSpan(from BinlogCoordinates, to BinlogCoordinates) {
+	if from.IsEmpty() || to.IsEmpty() || to.SmallerThanOrEquals(&from) {
+		return
+	}
+	this.FromCoordinates = from
+	this.ToCoordinates = to
+	this.CountBinaryLogs = from.FileNumberDistance(&to) + 1
+	this.SpanBytes = -1
+	if from.LogFile == to.LogFile {
+		this.SpanBytes = to.LogPos - from.LogPos
+	}
+}
+
+// lostGtidSet returns the GTIDs executed on a source server and not on the promoted server
+func lostGtidSet(source *Instance, promoted *Instance) (lost *OracleGtidSet, err error) {
+	sourceGtidSet, err := ParseGtidSet(source.ExecutedGtidSet)
+	if err != nil {
+		return nil, err
+	}
+	promotedGtidSet, err := ParseGtidSet(promoted.ExecutedGtidSet)
+	if err != nil {
+		return nil, err
+	}
+	return sourceGtidSet.Subtract(promotedGtidSet)
+}
+
+// EstimateDataLoss estimates the data lost in a recovery, given the failed master and the promoted server as last
+// seen before the recovery, the promoted server as seen after the recovery, and the replicas lost in the recovery.
+// With Oracle GTID, lost transactions are given as GTID sets. Otherwise, and in addition, lost transactions are given
+// as the span of the failed master's binary logs beyond the position read by the promoted server.
+func EstimateDataLoss(failedMaster *Instance, promotedBefore *Instance, promotedAfter *Instance, lostReplicas [](*Instance)) *DataLossReport {
+	report := &DataLossReport{
+		FailedMasterKey: failedMaster.Key,
+		Spans:           []DataLossSpan{},
+		Notes:           []string{},
+	}
+	if promotedAfter == nil {
+		report.Notes = append(report.Notes, "no server was promoted; data loss cannot be estimated")
+		return report
+	}
+	report.PromotedKey = promotedAfter.Key
+	useGTID := failedMaster.ExecutedGtidSet != "" && !failedMaster.IsMariaDB()
+	if failedMaster.UsingMariaDBGTID {
+		report.Notes = append(report.Notes, "MariaDB GTID is not analyzed; data loss is estimated by binlog coordinates")
+	}
+	var promotedReadCoordinates BinlogCoordinates
+	if promotedBefore != nil && promotedBefore.MasterKey.Equals(&failedMaster.Key) {
+		promotedReadCoordinates = promotedBefore.ReadBinlogCoordinates
+	} else {
+		report.Notes = append(report.Notes, fmt.Sprintf("%+v did not directly replicate from the failed master; binlog span is not estimated", promotedAfter.Key))
+	}
+
+	addSpan := func(source *Instance, role DataLossSourceRole, toCoordinates BinlogCoordinates) {
+		span := DataLossSpan{Key: source.Key, Role: role, AffectedSchemas: []string{}, AffectedTables: []string{}}
+		if useGTID && source.ExecutedGtidSet != "" {
+			if lost, err := lostGtidSet(source, promotedAfter); err != nil {
+				report.Notes = append(report.Notes, fmt.Sprintf("%+v: %+v", source.Key, err))
+			} else if !lost.IsEmpty() {
+				span.LostGtidSet = strings.Replace(lost.String(), "\n", "", -1)
+				span.CountLostTransactions, _ = lost.CountTransactions()
+			}
+		}
+		span.setBinlogSpan(promotedReadCoordinates, toCoordinates)
+		if !span.IsEmpty() {
+			report.Spans = append(report.Spans, span)
+		}
+	}
+	addSpan(failedMaster, DataLossFailedMaster, failedMaster.SelfBinlogCoordinates)
+	for _, replica := range lostReplicas {
+		var toCoordinates BinlogCoordinates
+		if replica.MasterKey.Equals(&failedMaster.Key) {
+			toCoordinates = replica.ExecBinlogCoordinates
+		}
+		addSpan(replica, DataLossLostReplica, toCoordinates)
+	}
+	report.IsDataLossEstimated = len(report.Spans) > 0
+	return report
+}
+
+// addAffectedTables notes the tables of given Table_map events onto the span
+func (this *DataLossSpan) addAffectedTables(events []BinlogEvent) {
+	schemas := make(map[string]bool)
+	tables := make(map[string]bool)
+	for _, schema := range this.AffectedSchemas {
+		schemas[schema] = true
+	}
+	for _, table := range this.AffectedTables {
+		tables[table] = true
+	}
+	for _, event := range events {
+		if event.EventType != "Table_map" {
+			continue
+		}
+		submatch := tableMapEventInfoRegexp.FindStringSubmatch(event.Info)
+		if len(submatch) < 2 {
+			continue
+		}
+		table := submatch[1]
+		tables[table] = true
+		schemas[strings.SplitN(table, ".", 2)[0]] = true
+	}
+	this.AffectedSchemas = this.AffectedSchemas[:0]
+	for schema := range schemas {
+		this.AffectedSchemas = append(this.AffectedSchemas, schema)
+	}
+	this.AffectedTables = this.AffectedTables[:0]
+	for table := range tables {
+		this.AffectedTables = append(this.AffectedTables, table)
+	}
+	sort.Strings(this.AffectedSchemas)
+	sort.Strings(this.AffectedTables)
+}
@@ -0,0 +1,70 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"github.com/github/orchestrator/go/config"
+	"github.com/openark/golib/log"
+)
+
+// SampleDataLossSpan reads the binary log events of a data loss span, up to DataLossSampleMaxEvents events, and notes
+// the schemas and tables of ROW events onto the span. It requires the failed master to be reachable; statement based
+// events are not analyzed.
+func SampleDataLossSpan(instanceKey *InstanceKey, span *DataLossSpan) error {
+	if span.CountBinaryLogs == 0 || config.Config.DataLossSampleMaxEvents == 0 {
+		return nil
+	}
+	coordinates := span.FromCoordinates
+	coordinates.Type = BinaryLog
+	countEvents := 0
+	for countEvents < int(config.Config.DataLossSampleMaxEvents) {
+		events, err := readBinlogEventsChunk(instanceKey, coordinates)
+		if err != nil {
+			span.SampleError = err.Error()
+			return log.Errore(err)
+		}
+		spanEvents := []BinlogEvent{}
+		reachedEnd := false
+		for _, event := range events {
+			if !event.Coordinates.SmallerThan(&span.ToCoordinates) || countEvents+len(spanEvents) >= int(config.Config.DataLossSampleMaxEvents) {
+				reachedEnd = true
+				break
+			}
+			spanEvents = append(spanEvents, event)
+		}
+		span.addAffectedTables(spanEvents)
+		countEvents += len(spanEvents)
+		if reachedEnd {
+			break
+		}
+		if len(events) > 0 && events[len(events)-1].EventType != "Rotate" {
+			coordinates = events[len(events)-1].NextBinlogCoordinates()
+			continue
+		}
+		// Binary log exhausted
+		if coordinates.LogFile == span.ToCoordinates.LogFile {
+			break
+		}
+		if coordinates, err = coordinates.NextFileCoordinates(); err != nil {
+			span.SampleError = err.Error()
+			return log.Errore(err)
+		}
+		coordinates.LogPos = 4
+	}
+	span.IsSampled = true
+	return nil
+}
@@ -0,0 +1,70 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+
+	"github.com/github/orchestrator/go/db"
+)
+
+// DelayedReplica tags a replica as intentionally delayed, along with the SQL_Delay it is meant to have.
+// The delay may be temporarily suspended, letting the replica catch up with its master, e.g. for maintenance.
+type DelayedReplica struct {
+	Key                   InstanceKey
+	IntendedSQLDelay      uint
+	Owner                 string
+	Reason                string
+	SuspendedUntilString  string
+	IsSQLDelaySuspended   bool
+	TaggedTimestampString string
+}
+
+// NewDelayedReplica returns a delayed replica tag of given instance, with given intended delay
+func NewDelayedReplica(instanceKey *InstanceKey, intendedSQLDelay uint, owner string, reason string) *DelayedReplica {
+	return &DelayedReplica{
+		Key:              *instanceKey,
+		IntendedSQLDelay: intendedSQLDelay,
+		Owner:            owner,
+		Reason:           reason,
+	}
+}
+
+// SuspendFor marks the delay as suspended for given number of seconds from now
+func (delayedReplica *DelayedReplica) SuspendFor(durationSeconds uint) {
+	now, _ := db.ReadTimeNow()
+	delayedReplica.SuspendedUntilString = AddSecondsToTimeString(now, durationSeconds)
+	delayedReplica.IsSQLDelaySuspended = true
+}
+
+// String returns a string representation of the delayed replica tag
+func (delayedReplica *DelayedReplica) String() string {
+	description := fmt.Sprintf("%+v is delayed by %d seconds, tagged by %s: %s", delayedReplica.Key, delayedReplica.IntendedSQLDelay, delayedReplica.Owner, delayedReplica.Reason)
+	if delayedReplica.IsSQLDelaySuspended {
+		description = fmt.Sprintf("%s; delay suspended until %s", description, delayedReplica.SuspendedUntilString)
+	}
+	return description
+}
+
+// SupportsSQLDelay checks whether this instance supports CHANGE MASTER TO MASTER_DELAY, introduced
+// in MySQL 5.6 and MariaDB 10.2
+func (this *Instance) SupportsSQLDelay() bool {
+	if this.IsMariaDB() {
+		return !this.IsSmallerMajorVersionByString("10.2")
+	}
+	return !this.IsSmallerMajorVersionByString("5.6")
+}
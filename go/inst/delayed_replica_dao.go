@@ -0,0 +1,173 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+// noSQLDelaySuspension is the suspension time of a delayed replica whose delay is in effect
+const noSQLDelaySuspension = "1971-01-01 00:00:00"
+
+// SetSQLDelay issues CHANGE MASTER TO MASTER_DELAY on a replica. A running replica is stopped, and then
+// started again, as MASTER_DELAY cannot be changed while the SQL thread is running.
+func SetSQLDelay(instanceKey *InstanceKey, sqlDelay uint) (*Instance, error) {
+	instance, err := ReadTopologyInstance(instanceKey)
+	if err != nil {
+		return instance, log.Errore(err)
+	}
+	if !instance.IsReplica() {
+		return instance, fmt.Errorf("SetSQLDelay: %+v is not a replica", *instanceKey)
+	}
+	if !instance.SupportsSQLDelay() {
+		return instance, fmt.Errorf("SetSQLDelay: %+v (version %s) does not support MASTER_DELAY", *instanceKey, instance.Version)
+	}
+	if instance.SQLDelay == sqlDelay {
+		return instance, nil
+	}
+	if *config.RuntimeCLIFlags.Noop {
+		return instance, fmt.Errorf("noop: aborting set-sql-delay operation on %+v; signalling error but nothing went wrong.", *instanceKey)
+	}
+	wasReplicationRunning := instance.ReplicaRunning()
+	if wasReplicationRunning {
+		if instance, err = StopSlave(instanceKey); err != nil {
+			return instance, log.Errore(err)
+		}
+	}
+	_, err = ExecInstance(instanceKey, "change master to master_delay=?", sqlDelay)
+	if wasReplicationRunning {
+		// Replication is restarted even if changing the delay failed
+		if _, startErr := StartSlave(instanceKey); startErr != nil && err == nil {
+			err = startErr
+		}
+	}
+	if err != nil {
+		return instance, log.Errore(err)
+	}
+	AuditOperation("set-sql-delay", instanceKey, fmt.Sprintf("SQL_Delay changed from %d to %d seconds", instance.SQLDelay, sqlDelay))
+
+	instance, err = ReadTopologyInstance(instanceKey)
+	return instance, err
+}
+
+// WriteDelayedReplica tags a replica as intentionally delayed, or updates an existing tag
+func WriteDelayedReplica(delayedReplica *DelayedReplica) error {
+	suspendedUntil := delayedReplica.SuspendedUntilString
+	if !delayedReplica.IsSQLDelaySuspended || suspendedUntil == "" {
+		suspendedUntil = noSQLDelaySuspension
+	}
+	_, err := db.ExecOrchestrator(`
+			insert into delayed_replica (
+					hostname, port, intended_delay_seconds, delay_owner, delay_reason, delay_suspended_until, tagged_timestamp
+				) values (
+					?, ?, ?, ?, ?, ?, now()
+				)
+				on duplicate key update
+					intended_delay_seconds=values(intended_delay_seconds),
+					delay_owner=values(delay_owner),
+					delay_reason=values(delay_reason),
+					delay_suspended_until=values(delay_suspended_until)
+			`, delayedReplica.Key.Hostname, delayedReplica.Key.Port, delayedReplica.IntendedSQLDelay, delayedReplica.Owner, delayedReplica.Reason, suspendedUntil,
+	)
+	if err != nil {
+		return log.Errore(err)
+	}
+	clusterInstancesCache.invalidateInstance(&delayedReplica.Key)
+	AuditOperation("tag-delayed-replica", &delayedReplica.Key, delayedReplica.String())
+	return nil
+}
+
+// DeleteDelayedReplica untags a delayed replica
+func DeleteDelayedReplica(instanceKey *InstanceKey) error {
+	_, err := db.ExecOrchestrator(`
+			delete from delayed_replica where hostname = ? and port = ?
+			`, instanceKey.Hostname, instanceKey.Port,
+	)
+	if err != nil {
+		return log.Errore(err)
+	}
+	clusterInstancesCache.invalidateInstance(instanceKey)
+	AuditOperation("untag-delayed-replica", instanceKey, "")
+	return nil
+}
+
+func readDelayedReplicas(condition string, args []interface{}) ([]DelayedReplica, error) {
+	delayedReplicas := []DelayedReplica{}
+	query := fmt.Sprintf(`
+		select
+			hostname,
+			port,
+			intended_delay_seconds,
+			delay_owner,
+			delay_reason,
+			delay_suspended_until,
+			delay_suspended_until > now() as is_sql_delay_suspended,
+			tagged_timestamp
+		from
+			delayed_replica
+		where
+			%s
+		order by
+			hostname, port
+	`, condition)
+	err := db.QueryOrchestrator(query, args, func(m sqlutils.RowMap) error {
+		delayedReplica := DelayedReplica{
+			IntendedSQLDelay:      m.GetUint("intended_delay_seconds"),
+			Owner:                 m.GetString("delay_owner"),
+			Reason:                m.GetString("delay_reason"),
+			IsSQLDelaySuspended:   m.GetBool("is_sql_delay_suspended"),
+			TaggedTimestampString: m.GetString("tagged_timestamp"),
+		}
+		delayedReplica.Key.Hostname = m.GetString("hostname")
+		delayedReplica.Key.Port = m.GetInt("port")
+		if delayedReplica.IsSQLDelaySuspended {
+			delayedReplica.SuspendedUntilString = m.GetString("delay_suspended_until")
+		}
+		delayedReplicas = append(delayedReplicas, delayedReplica)
+		return nil
+	})
+	return delayedReplicas, log.Errore(err)
+}
+
+// ReadDelayedReplica reads the delayed replica tag of given instance, if any
+func ReadDelayedReplica(instanceKey *InstanceKey) (delayedReplica *DelayedReplica, found bool, err error) {
+	delayedReplicas, err := readDelayedReplicas("hostname = ? and port = ?", sqlutils.Args(instanceKey.Hostname, instanceKey.Port))
+	if err != nil || len(delayedReplicas) == 0 {
+		return nil, false, err
+	}
+	return &delayedReplicas[0], true, nil
+}
+
+// ReadExpiredSQLDelaySuspensions reads delayed replicas whose delay suspension has expired, and whose
+// intended delay is to be restored
+func ReadExpiredSQLDelaySuspensions() ([]DelayedReplica, error) {
+	return readDelayedReplicas("delay_suspended_until > ? and delay_suspended_until <= now()", sqlutils.Args(noSQLDelaySuspension))
+}
+
+// ReadClusterDelayedReplicas reads the replicas of a cluster which have a SQL_Delay or are tagged as delayed
+func ReadClusterDelayedReplicas(clusterName string) ([](*Instance), error) {
+	condition := `
+			cluster_name = ?
+			and (sql_delay > 0 or delayed_replica.hostname is not null)
+		`
+	return readInstancesByCondition(condition, sqlutils.Args(clusterName), "")
+}
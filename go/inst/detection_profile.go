@@ -0,0 +1,116 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"github.com/github/orchestrator/go/config"
+)
+
+const (
+	AggressiveDetectionProfile   = "aggressive"
+	NormalDetectionProfile       = "normal"
+	ConservativeDetectionProfile = "conservative"
+)
+
+// DetectionThresholds are the effective failure detection thresholds of a cluster, as implied by
+// the cluster's detection profile (see DetectionProfiles configuration)
+type DetectionThresholds struct {
+	ClusterName  string
+	ClusterAlias string
+	Profile      string
+	// FailedPolls is the number of consecutive failed polls after which an instance is considered unreachable
+	FailedPolls uint
+	// ReplicaCorroborationPercent is the percentage of reachable replicas which must corroborate a master's failure.
+	// At 100, all replicas must have stopped replicating. Below 100, a master with replicating replicas is
+	// considered dead if at least this percentage of its replicas is failing to connect to it.
+	ReplicaCorroborationPercent uint
+	// RequireReplicasFailingToConnect, when true, requires replicas to explicitly fail connecting to a master
+	// before the master is considered dead; replicas merely not replicating do not corroborate its failure.
+	RequireReplicasFailingToConnect bool
+	// AnalysisDebounceSeconds is the time a failure analysis must persist before it is acted upon
+	AnalysisDebounceSeconds uint
+}
+
+// NewDetectionThresholds returns the effective detection thresholds of given cluster
+func NewDetectionThresholds(clusterName string, clusterAlias string) *DetectionThresholds {
+	thresholds := &DetectionThresholds{
+		ClusterName:                 clusterName,
+		ClusterAlias:                clusterAlias,
+		Profile:                     config.Config.GetDetectionProfile(clusterName, clusterAlias),
+		FailedPolls:                 1,
+		ReplicaCorroborationPercent: 100,
+	}
+	switch thresholds.Profile {
+	case AggressiveDetectionProfile:
+		thresholds.ReplicaCorroborationPercent = 50
+	case ConservativeDetectionProfile:
+		thresholds.FailedPolls = 3
+		thresholds.RequireReplicasFailingToConnect = true
+		thresholds.AnalysisDebounceSeconds = 2 * config.Config.InstancePollSeconds
+	}
+	return thresholds
+}
+
+// isLastCheckValid checks whether an instance is still considered reachable, given the time between its last
+// successful poll and its last poll, and the time between its last successful poll and its last poll attempt
+func (this *DetectionThresholds) isLastCheckValid(secondsFromSeenToLastCheck int64, secondsFromSeenToLastAttemptedCheck int64) bool {
+	if secondsFromSeenToLastCheck > int64((this.FailedPolls-1)*config.Config.InstancePollSeconds) {
+		return false
+	}
+	return secondsFromSeenToLastAttemptedCheck <= int64(this.FailedPolls*config.Config.InstancePollSeconds+1)
+}
+
+// isFailureCorroborated checks whether enough of a master's replicas corroborate its failure,
+// by failing to connect to it
+func (this *DetectionThresholds) isFailureCorroborated(countValidReplicas uint, countReplicasFailingToConnect uint) bool {
+	if countValidReplicas == 0 {
+		return false
+	}
+	return countReplicasFailingToConnect*100 >= this.ReplicaCorroborationPercent*countValidReplicas
+}
+
+// applyReplicaCorroboration adjusts an analysis of an unreachable master as per the corroboration requirements:
+// a master with enough replicas failing to connect to it is considered dead even if some replicas are still
+// replicating, and a master is not considered dead unless its replicas are failing to connect to it, if so required.
+func (this *DetectionThresholds) applyReplicaCorroboration(a *ReplicationAnalysis) {
+	if this.ReplicaCorroborationPercent < 100 && a.CountValidReplicas == a.CountReplicas && this.isFailureCorroborated(a.CountValidReplicas, a.CountReplicasFailingToConnectToMaster) {
+		switch a.Analysis {
+		case UnreachableMaster:
+			a.Analysis = DeadMaster
+			a.Description = "Master cannot be reached by orchestrator and enough of its replicas are failing to connect to it, as per detection profile"
+		case UnreachableCoMaster:
+			a.Analysis = DeadCoMaster
+			a.Description = "Co-master cannot be reached by orchestrator and enough of its replicas are failing to connect to it, as per detection profile"
+		case UnreachableIntermediateMaster:
+			a.Analysis = DeadIntermediateMaster
+			a.Description = "Intermediate master cannot be reached by orchestrator and enough of its replicas are failing to connect to it, as per detection profile"
+		}
+	}
+	if this.RequireReplicasFailingToConnect && a.CountReplicasFailingToConnectToMaster < a.CountValidReplicas {
+		switch a.Analysis {
+		case DeadMaster:
+			a.Analysis = UnreachableMaster
+			a.Description = "Master cannot be reached by orchestrator but not all of its replicas are failing to connect to it, as required by detection profile"
+		case DeadCoMaster:
+			a.Analysis = UnreachableCoMaster
+			a.Description = "Co-master cannot be reached by orchestrator but not all of its replicas are failing to connect to it, as required by detection profile"
+		case DeadIntermediateMaster, DeadIntermediateMasterWithSingleSlave:
+			a.Analysis = UnreachableIntermediateMaster
+			a.Description = "Intermediate master cannot be reached by orchestrator but not all of its replicas are failing to connect to it, as required by detection profile"
+		}
+	}
+}
@@ -0,0 +1,63 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"sync"
+
+	"github.com/github/orchestrator/go/config"
+)
+
+// discoveryShedKeys are the instances currently shed from discovery, by pool, due to discovery backpressure
+var discoveryShedKeys = make(map[InstanceKey]string)
+var discoveryShedKeysMutex sync.RWMutex
+
+// SetDiscoveryShedKeys replaces the set of instances shed from discovery. Only leaf replicas among these are shed.
+func SetDiscoveryShedKeys(shedKeys map[InstanceKey]string) {
+	discoveryShedKeysMutex.Lock()
+	defer discoveryShedKeysMutex.Unlock()
+	discoveryShedKeys = shedKeys
+}
+
+// CountDiscoveryShedKeys returns the number of instances listed as shed from discovery
+func CountDiscoveryShedKeys() int {
+	discoveryShedKeysMutex.RLock()
+	defer discoveryShedKeysMutex.RUnlock()
+	return len(discoveryShedKeys)
+}
+
+// IsDiscoveryShed checks whether given instance is shed from discovery. Only leaf replicas are ever shed: masters and
+// intermediate masters are always discovered, lest their failures go undetected.
+func IsDiscoveryShed(instance *Instance) bool {
+	if !instance.MasterKey.IsValid() || len(instance.SlaveHosts) > 0 {
+		return false
+	}
+	discoveryShedKeysMutex.RLock()
+	defer discoveryShedKeysMutex.RUnlock()
+	_, found := discoveryShedKeys[instance.Key]
+	return found
+}
+
+// IsDiscoveryShedPollDue checks whether an instance shed from discovery was last seen long enough ago, per
+// DiscoverySheddingPollSeconds, that it should be probed nonetheless: shed instances are probed at a relaxed pace,
+// lest their data go stale for as long as discovery is saturated, and a leaf which gained replicas remain shed.
+func IsDiscoveryShedPollDue(instance *Instance) bool {
+	if !instance.IsLastCheckValid || !instance.SecondsSinceLastSeen.Valid {
+		return true
+	}
+	return instance.SecondsSinceLastSeen.Int64 >= int64(config.Config.DiscoverySheddingPollSeconds)
+}
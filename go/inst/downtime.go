@@ -29,6 +29,8 @@ type Downtime struct {
 	EndsAt         time.Time
 	BeginsAtString string
 	EndsAtString   string
+	// InheritedFromKey is the intermediate master whose downtime this downtime is inherited from; nil for an explicit downtime
+	InheritedFromKey *InstanceKey
 }
 
 func NewDowntime(instanceKey *InstanceKey, owner string, reason string, duration time.Duration) *Downtime {
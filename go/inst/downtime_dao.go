@@ -31,20 +31,26 @@ func BeginDowntime(downtime *Downtime) (err error) {
 	if downtime.Duration == 0 {
 		downtime.Duration = config.MaintenanceExpireMinutes * time.Minute
 	}
+	inheritedFromKey := &InstanceKey{}
+	if downtime.InheritedFromKey != nil {
+		inheritedFromKey = downtime.InheritedFromKey
+	}
 	if downtime.EndsAtString != "" {
 		_, err = db.ExecOrchestrator(`
 				insert
 					into database_instance_downtime (
-						hostname, port, downtime_active, begin_timestamp, end_timestamp, owner, reason
+						hostname, port, downtime_active, begin_timestamp, end_timestamp, owner, reason, inherited_from_hostname, inherited_from_port
 					) VALUES (
-						?, ?, 1, ?, ?, ?, ?
+						?, ?, 1, ?, ?, ?, ?, ?, ?
 					)
 					on duplicate key update
 						downtime_active=values(downtime_active),
 						begin_timestamp=values(begin_timestamp),
 						end_timestamp=values(end_timestamp),
 						owner=values(owner),
-						reason=values(reason)
+						reason=values(reason),
+						inherited_from_hostname=values(inherited_from_hostname),
+						inherited_from_port=values(inherited_from_port)
 				`,
 			downtime.Key.Hostname,
 			downtime.Key.Port,
@@ -52,6 +58,8 @@ func BeginDowntime(downtime *Downtime) (err error) {
 			downtime.EndsAtString,
 			downtime.Owner,
 			downtime.Reason,
+			inheritedFromKey.Hostname,
+			inheritedFromKey.Port,
 		)
 	} else {
 		if downtime.Ended() {
@@ -62,29 +70,125 @@ func BeginDowntime(downtime *Downtime) (err error) {
 		_, err = db.ExecOrchestrator(`
 			insert
 				into database_instance_downtime (
-					hostname, port, downtime_active, begin_timestamp, end_timestamp, owner, reason
+					hostname, port, downtime_active, begin_timestamp, end_timestamp, owner, reason, inherited_from_hostname, inherited_from_port
 				) VALUES (
-					?, ?, 1, NOW(), NOW() + INTERVAL ? SECOND, ?, ?
+					?, ?, 1, NOW(), NOW() + INTERVAL ? SECOND, ?, ?, ?, ?
 				)
 				on duplicate key update
 					downtime_active=values(downtime_active),
 					begin_timestamp=values(begin_timestamp),
 					end_timestamp=values(end_timestamp),
 					owner=values(owner),
-					reason=values(reason)
+					reason=values(reason),
+					inherited_from_hostname=values(inherited_from_hostname),
+					inherited_from_port=values(inherited_from_port)
 			`,
 			downtime.Key.Hostname,
 			downtime.Key.Port,
 			int(downtime.EndsIn().Seconds()),
 			downtime.Owner,
 			downtime.Reason,
+			inheritedFromKey.Hostname,
+			inheritedFromKey.Port,
 		)
 	}
 	if err != nil {
 		return log.Errore(err)
 	}
+	clusterInstancesCache.invalidateInstance(downtime.Key)
 	AuditOperation("begin-downtime", downtime.Key, fmt.Sprintf("owner: %s, reason: %s", downtime.Owner, downtime.Reason))
 
+	if downtime.InheritedFromKey == nil {
+		return beginInheritedDowntime(downtime)
+	}
+	return nil
+}
+
+// readReplicaSubtree reads the replicas of given instance, their replicas, and so forth
+func readReplicaSubtree(instanceKey *InstanceKey) (subtree [](*Instance), err error) {
+	visited := map[InstanceKey]bool{*instanceKey: true}
+	masterKeys := []InstanceKey{*instanceKey}
+	for len(masterKeys) > 0 {
+		masterKey := masterKeys[0]
+		masterKeys = masterKeys[1:]
+		replicas, err := ReadReplicaInstances(&masterKey)
+		if err != nil {
+			return subtree, err
+		}
+		for _, replica := range replicas {
+			if visited[replica.Key] {
+				continue
+			}
+			visited[replica.Key] = true
+			subtree = append(subtree, replica)
+			masterKeys = append(masterKeys, replica.Key)
+		}
+	}
+	return subtree, nil
+}
+
+// beginInheritedDowntime downtimes the current replica subtree of a downtimed intermediate master, given
+// DowntimeInheritance. Replicas keep any downtime of their own. Downtime of lost-in-recovery instances is not inherited.
+func beginInheritedDowntime(downtime *Downtime) error {
+	if !config.Config.DowntimeInheritance || downtime.Reason == DowntimeLostInRecoveryMessage {
+		return nil
+	}
+	instance, found, err := ReadInstance(downtime.Key)
+	if err != nil || !found {
+		return err
+	}
+	if !instance.IsReplica() {
+		// Not an intermediate master
+		return nil
+	}
+	subtree, err := readReplicaSubtree(downtime.Key)
+	if err != nil || len(subtree) == 0 {
+		return err
+	}
+	downtimes, err := ReadDowntime()
+	if err != nil {
+		return err
+	}
+	explicitlyDowntimed := make(map[InstanceKey]bool)
+	for _, existing := range downtimes {
+		if existing.InheritedFromKey == nil {
+			explicitlyDowntimed[*existing.Key] = true
+		}
+	}
+	for _, replica := range subtree {
+		if explicitlyDowntimed[replica.Key] {
+			continue
+		}
+		inheritedDowntime := *downtime
+		inheritedDowntime.Key = &replica.Key
+		inheritedDowntime.Reason = fmt.Sprintf("inherited from %s: %s", downtime.Key.StringCode(), downtime.Reason)
+		inheritedDowntime.InheritedFromKey = downtime.Key
+		if err := BeginDowntime(&inheritedDowntime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// endInheritedDowntime ends downtime inherited from given intermediate master
+func endInheritedDowntime(instanceKey *InstanceKey) error {
+	res, err := db.ExecOrchestrator(`
+			delete from
+				database_instance_downtime
+			where
+				inherited_from_hostname = ?
+				and inherited_from_port = ?
+			`,
+		instanceKey.Hostname,
+		instanceKey.Port,
+	)
+	if err != nil {
+		return log.Errore(err)
+	}
+	if affected, _ := res.RowsAffected(); affected > 0 {
+		clusterInstancesCache.invalidateAll()
+		AuditOperation("end-downtime", instanceKey, fmt.Sprintf("Ended downtime inherited by %d replicas", affected))
+	}
 	return nil
 }
 
@@ -106,8 +210,12 @@ func EndDowntime(instanceKey *InstanceKey) (wasDowntimed bool, err error) {
 
 	if affected, _ := res.RowsAffected(); affected > 0 {
 		wasDowntimed = true
+		clusterInstancesCache.invalidateInstance(instanceKey)
 		AuditOperation("end-downtime", instanceKey, "")
 	}
+	if err := endInheritedDowntime(instanceKey); err != nil {
+		return wasDowntimed, err
+	}
 	return wasDowntimed, err
 }
 
@@ -197,6 +305,7 @@ func ExpireDowntime() error {
 			return log.Errore(err)
 		}
 		if rowsAffected, _ := res.RowsAffected(); rowsAffected > 0 {
+			clusterInstancesCache.invalidateAll()
 			AuditOperation("expire-downtime", nil, fmt.Sprintf("Expired %d entries", rowsAffected))
 		}
 	}
@@ -212,7 +321,9 @@ func ReadDowntime() (result []Downtime, err error) {
 			begin_timestamp,
 			end_timestamp,
 			owner,
-			reason
+			reason,
+			inherited_from_hostname,
+			inherited_from_port
 		from
 			database_instance_downtime
 		where
@@ -230,6 +341,9 @@ func ReadDowntime() (result []Downtime, err error) {
 		downtime.EndsAtString = m.GetString("end_timestamp")
 		downtime.Owner = m.GetString("owner")
 		downtime.Reason = m.GetString("reason")
+		if inheritedFromHostname := m.GetString("inherited_from_hostname"); inheritedFromHostname != "" {
+			downtime.InheritedFromKey = &InstanceKey{Hostname: inheritedFromHostname, Port: m.GetInt("inherited_from_port")}
+		}
 
 		downtime.Duration = downtime.EndsAt.Sub(downtime.BeginsAt)
 
@@ -0,0 +1,133 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	test "github.com/openark/golib/tests"
+)
+
+// writeDowntimeTestInstance writes a freshly checked instance, replicating from given master if any
+func writeDowntimeTestInstance(t *testing.T, hostname string, masterHost string) {
+	masterPort, masterLogFile := 0, ""
+	if masterHost != "" {
+		masterPort, masterLogFile = 3306, "mysql-bin.000001"
+	}
+	_, err := db.ExecOrchestrator(`
+			insert into database_instance (
+				hostname, port, last_checked, last_seen, server_id, version, binlog_format,
+				log_bin, log_slave_updates, binary_log_file, binary_log_pos, master_host, master_port,
+				slave_sql_running, slave_io_running, master_log_file, read_master_log_pos, relay_master_log_file,
+				exec_master_log_pos, num_slave_hosts, slave_hosts, cluster_name
+			) values (
+				?, 3306, now(), now(), 1, '5.7.26', 'ROW',
+				1, 1, 'mysql-bin.000001', 4, ?, ?,
+				1, 1, ?, 4, ?,
+				4, 0, '[]', 'db-1:3306'
+			)
+		`, hostname, masterHost, masterPort, masterLogFile, masterLogFile,
+	)
+	test.S(t).ExpectNil(err)
+}
+
+// readDowntimedHostnames lists the currently downtimed hosts, noting the host each downtime is inherited from
+func readDowntimedHostnames(t *testing.T) string {
+	downtimes, err := ReadDowntime()
+	test.S(t).ExpectNil(err)
+	hostnames := []string{}
+	for _, downtime := range downtimes {
+		hostname := downtime.Key.Hostname
+		if downtime.InheritedFromKey != nil {
+			hostname = hostname + "<" + downtime.InheritedFromKey.Hostname
+		}
+		hostnames = append(hostnames, hostname)
+	}
+	sort.Strings(hostnames)
+	return strings.Join(hostnames, ",")
+}
+
+func TestDowntimeInheritance(t *testing.T) {
+	withSQLiteBackend(t)
+	downtimeInheritance := config.Config.DowntimeInheritance
+	defer func() { config.Config.DowntimeInheritance = downtimeInheritance }()
+
+	// db-1 -> db-2 -> (db-3 -> db-4), db-5
+	writeDowntimeTestInstance(t, "db-1", "")
+	writeDowntimeTestInstance(t, "db-2", "db-1")
+	writeDowntimeTestInstance(t, "db-3", "db-2")
+	writeDowntimeTestInstance(t, "db-4", "db-3")
+	writeDowntimeTestInstance(t, "db-5", "db-2")
+	key := func(hostname string) *InstanceKey {
+		return &InstanceKey{Hostname: hostname, Port: 3306}
+	}
+	beginDowntime := func(hostname string, reason string) {
+		test.S(t).ExpectNil(BeginDowntime(NewDowntime(key(hostname), "test", reason, time.Hour)))
+	}
+	endDowntime := func(hostname string) {
+		_, err := EndDowntime(key(hostname))
+		test.S(t).ExpectNil(err)
+	}
+	{
+		config.Config.DowntimeInheritance = false
+		beginDowntime("db-2", "maintenance")
+		test.S(t).ExpectEquals(readDowntimedHostnames(t), "db-2")
+		endDowntime("db-2")
+		test.S(t).ExpectEquals(readDowntimedHostnames(t), "")
+	}
+	config.Config.DowntimeInheritance = true
+	{
+		// The whole subtree inherits the downtime, except for replicas downtimed on their own
+		beginDowntime("db-5", "disk replacement")
+		beginDowntime("db-2", "maintenance")
+		test.S(t).ExpectEquals(readDowntimedHostnames(t), "db-2,db-3<db-2,db-4<db-2,db-5")
+
+		downtimes, err := ReadDowntime()
+		test.S(t).ExpectNil(err)
+		for _, downtime := range downtimes {
+			switch downtime.Key.Hostname {
+			case "db-4":
+				test.S(t).ExpectEquals(downtime.Reason, "inherited from db-2:3306: maintenance")
+			case "db-5":
+				test.S(t).ExpectEquals(downtime.Reason, "disk replacement")
+			}
+		}
+
+		// Ending the intermediate master's downtime ends the inherited downtimes, and only those
+		endDowntime("db-2")
+		test.S(t).ExpectEquals(readDowntimedHostnames(t), "db-5")
+		endDowntime("db-5")
+	}
+	{
+		// Downtime of masters is not inherited
+		beginDowntime("db-1", "maintenance")
+		test.S(t).ExpectEquals(readDowntimedHostnames(t), "db-1")
+		endDowntime("db-1")
+	}
+	{
+		// Downtime of instances lost in recovery is not inherited
+		beginDowntime("db-3", DowntimeLostInRecoveryMessage)
+		test.S(t).ExpectEquals(readDowntimedHostnames(t), "db-3")
+		endDowntime("db-3")
+		test.S(t).ExpectEquals(readDowntimedHostnames(t), "")
+	}
+}
@@ -0,0 +1,70 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+// ReadClusterWritableInstances reads the reachable, writable (read_only=0) members of a cluster. A healthy
+// cluster has at most one.
+func ReadClusterWritableInstances(clusterName string) ([](*Instance), error) {
+	condition := `
+			cluster_name = ?
+			and read_only = 0
+			and binlog_server = 0
+			and last_checked <= last_seen
+		`
+	return readInstancesByCondition(condition, sqlutils.Args(clusterName), "replication_depth asc, hostname, port")
+}
+
+// ResolveDualWritableMasters sets all writable members of a cluster read-only, except for given instance,
+// which is the one expected to take writes. It is an error to keep a read-only instance as the writable one.
+func ResolveDualWritableMasters(writableKey *InstanceKey) (demoted [](*Instance), err error) {
+	demoted = [](*Instance){}
+	writable, err := ReadTopologyInstance(writableKey)
+	if err != nil {
+		return demoted, log.Errore(err)
+	}
+	if writable.ReadOnly {
+		return demoted, fmt.Errorf("ResolveDualWritableMasters: %+v is read-only; expected the instance to remain writable", *writableKey)
+	}
+	instances, err := ReadClusterWritableInstances(writable.ClusterName)
+	if err != nil {
+		return demoted, log.Errore(err)
+	}
+	errs := []error{}
+	for _, instance := range instances {
+		if instance.Key.Equals(writableKey) {
+			continue
+		}
+		instance, err := SetReadOnly(&instance.Key, true)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		demoted = append(demoted, instance)
+	}
+	AuditOperation("resolve-dual-writable", writableKey, fmt.Sprintf("set %d writable members of cluster %s read-only; %+v remains writable", len(demoted), writable.ClusterName, *writableKey))
+	if len(errs) > 0 {
+		return demoted, fmt.Errorf("ResolveDualWritableMasters: failed setting %d instances read-only; first error: %+v", len(errs), errs[0])
+	}
+	return demoted, nil
+}
@@ -0,0 +1,102 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/openark/golib/log"
+)
+
+// errorLogPatternRegexps caches compiled Pattern of ErrorLogPatterns, by pattern. Invalid patterns map to nil.
+var errorLogPatternRegexps = make(map[string]*regexp.Regexp)
+var errorLogPatternRegexpsMutex sync.Mutex
+
+// ErrorLogEvent is a line of an instance's MySQL error log which matched one of ErrorLogPatterns
+type ErrorLogEvent struct {
+	EventId        int64
+	Key            InstanceKey
+	PatternName    string
+	IsProblem      bool
+	LogLine        string
+	EventTimestamp string
+}
+
+// NewErrorLogLines returns the lines of an error log tail which follow a previous tail of the same log. When the
+// last line of the previous tail is not found, e.g. as the log was rotated, all lines are new.
+func NewErrorLogLines(previousTail []string, tail []string) []string {
+	if len(previousTail) == 0 {
+		return tail
+	}
+	lastLine := previousTail[len(previousTail)-1]
+	for i := len(tail) - 1; i >= 0; i-- {
+		if tail[i] == lastLine {
+			return tail[i+1:]
+		}
+	}
+	return tail
+}
+
+// getErrorLogPatternRegexp returns the compiled form of given pattern, or nil if the pattern is invalid
+func getErrorLogPatternRegexp(pattern string) *regexp.Regexp {
+	errorLogPatternRegexpsMutex.Lock()
+	defer errorLogPatternRegexpsMutex.Unlock()
+
+	re, found := errorLogPatternRegexps[pattern]
+	if !found {
+		var err error
+		if re, err = regexp.Compile(pattern); err != nil {
+			log.Errorf("ErrorLogPatterns: invalid Pattern %s: %+v", pattern, err)
+			re = nil
+		}
+		errorLogPatternRegexps[pattern] = re
+	}
+	return re
+}
+
+// MatchErrorLogLine returns the names of the ErrorLogPatterns matching given error log line, sorted
+func MatchErrorLogLine(line string) (patternNames []string) {
+	if strings.TrimSpace(line) == "" {
+		return patternNames
+	}
+	for patternName, errorLogPattern := range config.Config.ErrorLogPatterns {
+		if re := getErrorLogPatternRegexp(errorLogPattern.Pattern); re != nil && re.MatchString(line) {
+			patternNames = append(patternNames, patternName)
+		}
+	}
+	sort.Strings(patternNames)
+	return patternNames
+}
+
+// NewErrorLogEvents lists the events of the lines of an instance's error log matching ErrorLogPatterns
+func NewErrorLogEvents(instanceKey *InstanceKey, lines []string) (events []ErrorLogEvent) {
+	for _, line := range lines {
+		for _, patternName := range MatchErrorLogLine(line) {
+			events = append(events, ErrorLogEvent{
+				Key:         *instanceKey,
+				PatternName: patternName,
+				IsProblem:   config.Config.ErrorLogPatterns[patternName].IsProblem,
+				LogLine:     line,
+			})
+		}
+	}
+	return events
+}
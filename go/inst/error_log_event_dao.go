@@ -0,0 +1,120 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+// errorLogEventsReadLimit is the max number of error log events read for an instance
+const errorLogEventsReadLimit = 100
+
+// WriteErrorLogEvents records error log lines matching ErrorLogPatterns as instance events
+func WriteErrorLogEvents(events []ErrorLogEvent) error {
+	writeFunc := func() error {
+		for _, event := range events {
+			_, err := db.ExecOrchestrator(`
+				insert into database_instance_error_log_event (
+					hostname, port, pattern_name, is_problem, log_line, event_timestamp
+				) values (
+					?, ?, ?, ?, ?, now()
+				)
+				`, event.Key.Hostname, event.Key.Port, event.PatternName, event.IsProblem, event.LogLine,
+			)
+			if err != nil {
+				return log.Errore(err)
+			}
+		}
+		return nil
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
+
+// ReadErrorLogEvents reads the latest error log events of an instance, newest first
+func ReadErrorLogEvents(instanceKey *InstanceKey) (events []ErrorLogEvent, err error) {
+	query := `
+		select
+			event_id,
+			hostname,
+			port,
+			pattern_name,
+			is_problem,
+			log_line,
+			event_timestamp
+		from
+			database_instance_error_log_event
+		where
+			hostname = ?
+			and port = ?
+		order by
+			event_id desc
+		limit ?
+		`
+	err = db.QueryOrchestrator(query, sqlutils.Args(instanceKey.Hostname, instanceKey.Port, errorLogEventsReadLimit), func(m sqlutils.RowMap) error {
+		event := ErrorLogEvent{}
+		event.EventId = m.GetInt64("event_id")
+		event.Key.Hostname = m.GetString("hostname")
+		event.Key.Port = m.GetInt("port")
+		event.PatternName = m.GetString("pattern_name")
+		event.IsProblem = m.GetBool("is_problem")
+		event.LogLine = m.GetString("log_line")
+		event.EventTimestamp = m.GetString("event_timestamp")
+		events = append(events, event)
+		return nil
+	})
+	return events, log.Errore(err)
+}
+
+// ReadErrorLogProblems reads the instances whose error log matched a problem pattern within ErrorLogProblemSeconds,
+// along with the names of the patterns matched
+func ReadErrorLogProblems() (problems map[InstanceKey][]string, err error) {
+	problems = make(map[InstanceKey][]string)
+	query := `
+		select distinct
+			hostname,
+			port,
+			pattern_name
+		from
+			database_instance_error_log_event
+		where
+			is_problem = 1
+			and event_timestamp >= now() - interval ? second
+		order by
+			hostname, port, pattern_name
+		`
+	err = db.QueryOrchestrator(query, sqlutils.Args(config.Config.ErrorLogProblemSeconds), func(m sqlutils.RowMap) error {
+		instanceKey := InstanceKey{Hostname: m.GetString("hostname"), Port: m.GetInt("port")}
+		problems[instanceKey] = append(problems[instanceKey], m.GetString("pattern_name"))
+		return nil
+	})
+	return problems, log.Errore(err)
+}
+
+// ExpireErrorLogEvents removes error log events older than AuditPurgeDays
+func ExpireErrorLogEvents() error {
+	_, err := db.ExecOrchestrator(`
+			delete
+				from database_instance_error_log_event
+			where
+				event_timestamp < now() - interval ? day
+			`, config.AuditPurgeDays,
+	)
+	return log.Errore(err)
+}
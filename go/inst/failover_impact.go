@@ -0,0 +1,118 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FailoverImpactEstimate estimates the impact of failing over a dead master: the replicas which will
+// need to be repointed to the promoted replica, those of them which are unlikely to be reattached,
+// and how long the promotion is likely to take
+type FailoverImpactEstimate struct {
+	CandidateKey                      InstanceKey
+	CountReplicasToRepoint            uint
+	CountReplicasUnlikelyReattachable uint
+	UnlikelyReattachableReplicas      map[string]string // replica => reason
+	EstimatedPromotionSeconds         float64           // 0 when there is no history of recoveries to base the estimate on
+	CountRecoveriesInEstimate         int
+}
+
+// errantGtidUUIDs returns the UUIDs found in the replica's executed GTID set, and which are not found in the
+// master's last known executed GTID set. Transactions of such UUIDs were never applied on the master.
+func errantGtidUUIDs(replica *Instance, master *Instance) (uuids []string) {
+	if master == nil || !replica.UsingGTID() || master.ExecutedGtidSet == "" {
+		return uuids
+	}
+	masterGtidSet, err := ParseGtidSet(master.ExecutedGtidSet)
+	if err != nil {
+		return uuids
+	}
+	replicaGtidSet, err := ParseGtidSet(replica.ExecutedGtidSet)
+	if err != nil {
+		return uuids
+	}
+	for _, entry := range replicaGtidSet.GtidEntries {
+		found := false
+		for _, masterEntry := range masterGtidSet.GtidEntries {
+			if masterEntry.UUID == entry.UUID {
+				found = true
+			}
+		}
+		if !found {
+			uuids = append(uuids, entry.UUID)
+		}
+	}
+	return uuids
+}
+
+// newFailoverImpactEstimate estimates the impact of a failover given the candidate replica chosen for
+// promotion and the classification of the other replicas in relation to it
+func newFailoverImpactEstimate(master *Instance, candidate *Instance, aheadReplicas, equalReplicas, laterReplicas, cannotReplicateReplicas [](*Instance)) *FailoverImpactEstimate {
+	estimate := &FailoverImpactEstimate{
+		CandidateKey:                 candidate.Key,
+		UnlikelyReattachableReplicas: make(map[string]string),
+	}
+	unlikelyReattachable := func(replica *Instance, reason string) {
+		if _, found := estimate.UnlikelyReattachableReplicas[replica.Key.StringCode()]; !found {
+			estimate.UnlikelyReattachableReplicas[replica.Key.StringCode()] = reason
+		}
+	}
+	for _, replica := range cannotReplicateReplicas {
+		if _, err := replica.CanReplicateFrom(candidate); err != nil {
+			unlikelyReattachable(replica, err.Error())
+		} else {
+			unlikelyReattachable(replica, "cannot replicate from candidate")
+		}
+	}
+	for _, replica := range aheadReplicas {
+		unlikelyReattachable(replica, fmt.Sprintf("ahead of candidate %+v", candidate.Key))
+	}
+	for _, replicas := range [][](*Instance){aheadReplicas, equalReplicas, laterReplicas, cannotReplicateReplicas} {
+		for _, replica := range replicas {
+			estimate.CountReplicasToRepoint++
+			if uuids := errantGtidUUIDs(replica, master); len(uuids) > 0 {
+				unlikelyReattachable(replica, fmt.Sprintf("errant GTID: %s", strings.Join(uuids, ",")))
+			}
+		}
+	}
+	estimate.CountReplicasUnlikelyReattachable = uint(len(estimate.UnlikelyReattachableReplicas))
+	return estimate
+}
+
+// EstimateFailoverImpact estimates the impact of failing over given master, based on the last known state
+// of it and its replicas. It does not access the replicas themselves. The promotion time is not estimated.
+func EstimateFailoverImpact(masterKey *InstanceKey) (*FailoverImpactEstimate, error) {
+	master, _, err := ReadInstance(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	candidate, aheadReplicas, equalReplicas, laterReplicas, cannotReplicateReplicas, err := GetCandidateReplica(masterKey, false)
+	if candidate == nil {
+		if err == nil {
+			err = fmt.Errorf("EstimateFailoverImpact: no candidate replica found for %+v", *masterKey)
+		}
+		return nil, err
+	}
+	if err != nil {
+		// A candidate is chosen, but is unable to master the other replicas, which are all returned as "ahead"
+		cannotReplicateReplicas = append(cannotReplicateReplicas, aheadReplicas...)
+		aheadReplicas = [](*Instance){}
+	}
+	return newFailoverImpactEstimate(master, candidate, aheadReplicas, equalReplicas, laterReplicas, cannotReplicateReplicas), nil
+}
@@ -0,0 +1,140 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/openark/golib/log"
+)
+
+// groupingDimensionRegexps caches compiled HostnamePattern of GroupingDimensions, by pattern. Invalid patterns map to nil.
+var groupingDimensionRegexps = make(map[string]*regexp.Regexp)
+var groupingDimensionRegexpsMutex sync.Mutex
+
+// getGroupingDimensionRegexp returns the compiled form of given pattern, or nil if the pattern is invalid
+func getGroupingDimensionRegexp(hostnamePattern string) *regexp.Regexp {
+	groupingDimensionRegexpsMutex.Lock()
+	defer groupingDimensionRegexpsMutex.Unlock()
+
+	re, found := groupingDimensionRegexps[hostnamePattern]
+	if !found {
+		var err error
+		if re, err = regexp.Compile(hostnamePattern); err != nil {
+			log.Errorf("GroupingDimensions: invalid HostnamePattern %s: %+v", hostnamePattern, err)
+			re = nil
+		}
+		groupingDimensionRegexps[hostnamePattern] = re
+	}
+	return re
+}
+
+// readHostnameDimensions extracts the values of GroupingDimensions which are derived from the hostname
+func readHostnameDimensions(hostname string) map[string]string {
+	dimensions := make(map[string]string)
+	for dimension, groupingDimension := range config.Config.GroupingDimensions {
+		if groupingDimension.HostnamePattern == "" {
+			continue
+		}
+		pattern := getGroupingDimensionRegexp(groupingDimension.HostnamePattern)
+		if pattern == nil {
+			continue
+		}
+		if match := pattern.FindStringSubmatch(hostname); len(match) > 1 {
+			dimensions[dimension] = match[1]
+		}
+	}
+	return dimensions
+}
+
+// dimensionsToJSON serializes grouping dimensions as stored in the backend
+func dimensionsToJSON(dimensions map[string]string) string {
+	if len(dimensions) == 0 {
+		return ""
+	}
+	dimensionsJSON, _ := json.Marshal(dimensions)
+	return string(dimensionsJSON)
+}
+
+// dimensionsFromJSON parses grouping dimensions as stored in the backend
+func dimensionsFromJSON(dimensionsJSON string) map[string]string {
+	dimensions := make(map[string]string)
+	if dimensionsJSON != "" {
+		json.Unmarshal([]byte(dimensionsJSON), &dimensions)
+	}
+	return dimensions
+}
+
+// SharedDimensions returns those of given dimensions in which this instance and another instance have the same
+// (known) value
+func (this *Instance) SharedDimensions(other *Instance, dimensions []string) (shared []string) {
+	for _, dimension := range dimensions {
+		value := this.Dimensions[dimension]
+		if value != "" && value == other.Dimensions[dimension] {
+			shared = append(shared, dimension)
+		}
+	}
+	return shared
+}
+
+// FilterInstancesByDimension returns the instances whose given grouping dimension has given value
+func FilterInstancesByDimension(instances [](*Instance), dimension string, value string) [](*Instance) {
+	filtered := [](*Instance){}
+	for _, instance := range instances {
+		if instance.Dimensions[dimension] == value {
+			filtered = append(filtered, instance)
+		}
+	}
+	return filtered
+}
+
+// DimensionGroup is a group of instances sharing the value of a grouping dimension
+type DimensionGroup struct {
+	Dimension    string
+	Value        string
+	InstanceKeys []InstanceKey
+}
+
+// GroupInstancesByDimensions groups given instances by each of the configured GroupingDimensions. Instances with
+// no known value of a dimension are grouped under an empty value.
+func GroupInstancesByDimensions(instances [](*Instance)) (groups []DimensionGroup) {
+	dimensions := []string{}
+	for dimension := range config.Config.GroupingDimensions {
+		dimensions = append(dimensions, dimension)
+	}
+	sort.Strings(dimensions)
+	for _, dimension := range dimensions {
+		values := []string{}
+		groupKeys := make(map[string][]InstanceKey)
+		for _, instance := range instances {
+			value := instance.Dimensions[dimension]
+			if _, found := groupKeys[value]; !found {
+				values = append(values, value)
+			}
+			groupKeys[value] = append(groupKeys[value], instance.Key)
+		}
+		sort.Strings(values)
+		for _, value := range values {
+			groups = append(groups, DimensionGroup{Dimension: dimension, Value: value, InstanceKeys: groupKeys[value]})
+		}
+	}
+	return groups
+}
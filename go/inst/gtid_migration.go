@@ -0,0 +1,166 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+)
+
+// GTIDMigrationStep is a step in the online migration of a cluster from binlog file:pos (and Pseudo-GTID)
+// onto GTID. Each step applies to all members of the cluster before the next step may begin.
+type GTIDMigrationStep string
+
+const (
+	GTIDMigrationEnforceConsistency GTIDMigrationStep = "enforce-gtid-consistency"
+	GTIDMigrationOffPermissive      GTIDMigrationStep = "gtid-mode-off-permissive"
+	GTIDMigrationOnPermissive       GTIDMigrationStep = "gtid-mode-on-permissive"
+	GTIDMigrationOn                 GTIDMigrationStep = "gtid-mode-on"
+	GTIDMigrationAutoPosition       GTIDMigrationStep = "auto-position"
+	GTIDMigrationComplete           GTIDMigrationStep = "complete"
+)
+
+// minGTIDMigrationVersion is the first MySQL version where gtid_mode may change online
+const minGTIDMigrationVersion = "5.7.6"
+
+// gtidModes are the values of gtid_mode, in the order in which a migration goes through them
+var gtidModes = []string{"OFF", "OFF_PERMISSIVE", "ON_PERMISSIVE", "ON"}
+
+// gtidModeSteps maps a gtid_mode onto the migration step which sets it
+var gtidModeSteps = map[string]GTIDMigrationStep{
+	"OFF_PERMISSIVE": GTIDMigrationOffPermissive,
+	"ON_PERMISSIVE":  GTIDMigrationOnPermissive,
+	"ON":             GTIDMigrationOn,
+}
+
+func gtidModeIndex(gtidMode string) int {
+	for i, mode := range gtidModes {
+		if mode == gtidMode {
+			return i
+		}
+	}
+	return -1
+}
+
+// GTIDMigrationMember is the GTID related state of a cluster member, as read live from the server
+type GTIDMigrationMember struct {
+	Key                          InstanceKey
+	Version                      string
+	IsReachable                  bool
+	IsMariaDB                    bool
+	IsBinlogServer               bool
+	IsReplica                    bool
+	GTIDMode                     string
+	EnforceGTIDConsistency       string
+	OngoingAnonymousTransactions int64
+	UsingGTIDAutoPosition        bool
+}
+
+// GTIDMigration is the readiness and progress of a cluster's migration onto GTID
+type GTIDMigration struct {
+	ClusterName    string
+	Members        []GTIDMigrationMember
+	CurrentMode    string // the least advanced gtid_mode among the members
+	NextStep       GTIDMigrationStep
+	CountPending   int // members yet to take the next step
+	IsReady        bool
+	IsComplete     bool
+	Problems       []string
+	UsesPseudoGTID bool
+}
+
+// evaluateGTIDMigration figures out the next step of a cluster's migration onto GTID, and whether it may be taken
+func evaluateGTIDMigration(clusterName string, members []GTIDMigrationMember) *GTIDMigration {
+	migration := &GTIDMigration{
+		ClusterName: clusterName,
+		Members:     members,
+		Problems:    []string{},
+	}
+	minModeIndex, maxModeIndex := len(gtidModes), -1
+	for _, member := range members {
+		switch {
+		case !member.IsReachable:
+			migration.Problems = append(migration.Problems, fmt.Sprintf("%+v is unreachable", member.Key))
+			continue
+		case member.IsBinlogServer:
+			migration.Problems = append(migration.Problems, fmt.Sprintf("%+v is a binlog server", member.Key))
+			continue
+		case member.IsMariaDB:
+			migration.Problems = append(migration.Problems, fmt.Sprintf("%+v is MariaDB, whose GTID is not controlled by gtid_mode", member.Key))
+			continue
+		case IsSmallerVersion(member.Version, minGTIDMigrationVersion):
+			migration.Problems = append(migration.Problems, fmt.Sprintf("%+v runs %s; online gtid_mode changes require %s or above", member.Key, member.Version, minGTIDMigrationVersion))
+			continue
+		}
+		modeIndex := gtidModeIndex(member.GTIDMode)
+		if modeIndex < 0 {
+			migration.Problems = append(migration.Problems, fmt.Sprintf("%+v has unknown gtid_mode: %s", member.Key, member.GTIDMode))
+			continue
+		}
+		if modeIndex < minModeIndex {
+			minModeIndex = modeIndex
+		}
+		if modeIndex > maxModeIndex {
+			maxModeIndex = modeIndex
+		}
+	}
+	if len(migration.Problems) > 0 || maxModeIndex < 0 {
+		if len(members) == 0 {
+			migration.Problems = append(migration.Problems, fmt.Sprintf("no members found for cluster %s", clusterName))
+		}
+		return migration
+	}
+	if maxModeIndex-minModeIndex > 1 {
+		migration.Problems = append(migration.Problems, fmt.Sprintf("members' gtid_mode ranges from %s to %s; gtid_mode may only differ by a single step", gtidModes[minModeIndex], gtidModes[maxModeIndex]))
+		return migration
+	}
+	migration.CurrentMode = gtidModes[minModeIndex]
+
+	countInconsistent := 0
+	for _, member := range members {
+		if member.EnforceGTIDConsistency != "ON" {
+			countInconsistent++
+		}
+	}
+	if countInconsistent > 0 && minModeIndex < len(gtidModes)-1 {
+		migration.NextStep = GTIDMigrationEnforceConsistency
+		migration.CountPending = countInconsistent
+	} else if minModeIndex < len(gtidModes)-1 {
+		nextMode := gtidModes[minModeIndex+1]
+		migration.NextStep = gtidModeSteps[nextMode]
+		for _, member := range members {
+			if gtidModeIndex(member.GTIDMode) < minModeIndex+1 {
+				migration.CountPending++
+			}
+			if nextMode == "ON" && member.OngoingAnonymousTransactions > 0 {
+				migration.Problems = append(migration.Problems, fmt.Sprintf("%+v has %d ongoing anonymous transactions; wait for replication to catch up", member.Key, member.OngoingAnonymousTransactions))
+			}
+		}
+	} else {
+		migration.NextStep = GTIDMigrationAutoPosition
+		for _, member := range members {
+			if member.IsReplica && !member.UsingGTIDAutoPosition {
+				migration.CountPending++
+			}
+		}
+		if migration.CountPending == 0 {
+			migration.NextStep = GTIDMigrationComplete
+			migration.IsComplete = true
+		}
+	}
+	migration.IsReady = len(migration.Problems) == 0 && !migration.IsComplete
+	return migration
+}
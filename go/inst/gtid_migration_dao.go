@@ -0,0 +1,133 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+// readGTIDMigrationMember reads the GTID related state of an instance directly from the server
+func readGTIDMigrationMember(instance *Instance) (member GTIDMigrationMember) {
+	member = GTIDMigrationMember{
+		Key:                   instance.Key,
+		Version:               instance.Version,
+		IsMariaDB:             instance.IsMariaDB(),
+		IsBinlogServer:        instance.IsBinlogServer(),
+		IsReplica:             instance.IsReplica(),
+		UsingGTIDAutoPosition: instance.UsingOracleGTID,
+	}
+	if member.IsMariaDB || member.IsBinlogServer {
+		member.IsReachable = instance.IsLastCheckValid
+		return member
+	}
+	db, err := db.OpenTopology(instance.Key.Hostname, instance.Key.Port)
+	if err != nil {
+		log.Errore(err)
+		return member
+	}
+	if err := db.QueryRow(`select @@global.gtid_mode, @@global.enforce_gtid_consistency`).Scan(&member.GTIDMode, &member.EnforceGTIDConsistency); err != nil {
+		log.Errore(err)
+		return member
+	}
+	err = sqlutils.QueryRowsMap(db, "show global status like 'Ongoing_anonymous_transaction_count'", func(m sqlutils.RowMap) error {
+		member.OngoingAnonymousTransactions = m.GetInt64("Value")
+		return nil
+	})
+	if err != nil {
+		log.Errore(err)
+		return member
+	}
+	member.IsReachable = true
+	return member
+}
+
+// EvaluateClusterGTIDMigration reads the GTID state of all members of a cluster, and evaluates the cluster's
+// readiness to take the next step in its migration onto GTID
+func EvaluateClusterGTIDMigration(clusterName string) (*GTIDMigration, error) {
+	instances, err := ReadClusterInstances(clusterName)
+	if err != nil {
+		return nil, log.Errore(err)
+	}
+	members := []GTIDMigrationMember{}
+	usesPseudoGTID := false
+	for _, instance := range instances {
+		members = append(members, readGTIDMigrationMember(instance))
+		usesPseudoGTID = usesPseudoGTID || instance.UsingPseudoGTID
+	}
+	migration := evaluateGTIDMigration(clusterName, members)
+	migration.UsesPseudoGTID = usesPseudoGTID
+	return migration, nil
+}
+
+// AdvanceClusterGTIDMigration takes the next step in a cluster's migration onto GTID, on all members which
+// have yet to take it. enforce_gtid_consistency and gtid_mode are set online; the final step points replicas
+// at their masters using GTID auto positioning. The step is only taken when the cluster is ready for it.
+func AdvanceClusterGTIDMigration(clusterName string) (*GTIDMigration, error) {
+	migration, err := EvaluateClusterGTIDMigration(clusterName)
+	if err != nil {
+		return migration, err
+	}
+	if migration.IsComplete {
+		return migration, nil
+	}
+	if !migration.IsReady {
+		return migration, fmt.Errorf("AdvanceClusterGTIDMigration: cluster %s is not ready for %s: %+v", clusterName, migration.NextStep, migration.Problems)
+	}
+	if *config.RuntimeCLIFlags.Noop {
+		return migration, fmt.Errorf("noop: aborting gtid-migration operation on %s; signalling error but nothing went wrong.", clusterName)
+	}
+	step := migration.NextStep
+	countAdvanced := 0
+	for _, member := range migration.Members {
+		switch step {
+		case GTIDMigrationEnforceConsistency:
+			if member.EnforceGTIDConsistency == "ON" {
+				continue
+			}
+			_, err = ExecInstance(&member.Key, "set global enforce_gtid_consistency = ON")
+		case GTIDMigrationAutoPosition:
+			if !member.IsReplica || member.UsingGTIDAutoPosition {
+				continue
+			}
+			_, err = EnableGTID(&member.Key)
+		default:
+			nextMode := gtidModes[gtidModeIndex(migration.CurrentMode)+1]
+			if member.GTIDMode == nextMode {
+				continue
+			}
+			_, err = ExecInstance(&member.Key, "set global gtid_mode = ?", nextMode)
+		}
+		if err != nil {
+			return migration, log.Errore(err)
+		}
+		countAdvanced++
+	}
+	var auditKey *InstanceKey
+	for i := range migration.Members {
+		if !migration.Members[i].IsReplica {
+			auditKey = &migration.Members[i].Key
+		}
+	}
+	AuditOperation("gtid-migration", auditKey, fmt.Sprintf("cluster %s: applied %s on %d members", clusterName, step, countAdvanced))
+
+	return EvaluateClusterGTIDMigration(clusterName)
+}
@@ -62,24 +62,40 @@ type Instance struct {
 	RelaylogCoordinates    BinlogCoordinates
 	LastSQLError           string
 	LastIOError            string
+	LastSQLErrno           uint
+	LastIOErrno            uint
 	SecondsBehindMaster    sql.NullInt64
 	SQLDelay               uint
 	ExecutedGtidSet        string
 	GtidPurged             string
 
 	SlaveLagSeconds                 sql.NullInt64
+	ReplicationLagSource            string // the lag source which produced SlaveLagSeconds
 	SlaveHosts                      InstanceKeyMap
 	ClusterName                     string
 	SuggestedClusterAlias           string
 	DataCenter                      string
 	PhysicalEnvironment             string
+	Dimensions                      map[string]string // custom grouping dimensions, as per GroupingDimensions
 	ReplicationDepth                uint
 	IsCoMaster                      bool
 	HasReplicationCredentials       bool
 	ReplicationCredentialsAvailable bool
 	SemiSyncEnforced                bool
-	SemiSyncMasterEnabled           bool
+	SemiSyncMasterEnabled           bool // Rpl_semi_sync_master_status: semi-sync is in effect
 	SemiSyncReplicaEnabled          bool
+	SemiSyncMasterConfigured        bool   // rpl_semi_sync_master_enabled
+	SemiSyncMasterTimeout           uint   // rpl_semi_sync_master_timeout, milliseconds
+	SemiSyncMasterWaitPoint         string // rpl_semi_sync_master_wait_point: AFTER_SYNC or AFTER_COMMIT
+	SemiSyncMasterWaitForSlaveCount uint   // rpl_semi_sync_master_wait_for_slave_count
+	SemiSyncMasterClients           uint   // Rpl_semi_sync_master_clients: connected semi-sync replicas
+	SemiSyncMasterYesTx             int64  // Rpl_semi_sync_master_yes_tx: commits acknowledged by a replica
+	SemiSyncMasterNoTx              int64  // Rpl_semi_sync_master_no_tx: commits not acknowledged by any replica
+	SemiSyncMasterNoTimes           int64  // Rpl_semi_sync_master_no_times: times the master fell back to asynchronous replication
+	SemiSyncAsyncFallback           bool   // see IsSemiSyncAsyncFallback()
+	WriteProbeFailing               bool   // writable instance failed its latest write probe
+	WriteProbeValue                 int64  // value written by latest successful write probe on this instance
+	ReplicatedWriteProbeValue       int64  // latest write probe value of this instance's master, as replicated onto this instance
 
 	LastSeenTimestamp    string
 	IsLastCheckValid     bool
@@ -102,13 +118,39 @@ type Instance struct {
 	UnresolvedHostname   string
 	AllowTLS             bool
 
-	LastDiscoveryLatency time.Duration
+	LastDiscoveryLatency   time.Duration
+	IsSlowDiscoveryOutlier bool
+	IsDiscoveryPaused      bool
+	IsDiscoveryShed        bool // shed from discovery due to discovery backpressure; data may be stale
+	RequiredGrants         []string
+	IsRecoveryBlocked      bool     // a failure was detected, but its recovery is blocked by a recent recovery
+	ErrorLogProblems       []string // problem ErrorLogPatterns recently matched by the MySQL error log
+	UnreconciledReplicas   []string // replicas listed as connected, yet unknown to orchestrator or known to replicate elsewhere
+
+	ProbeOutcomes          []InstanceProbeOutcome // raft deployments: latest probe outcome as seen by each orchestrator node
+	LastSeenBy             string                 // raft deployments: orchestrator node which most recently reported the instance reachable
+	LastFailedProbeBy      string                 // raft deployments: orchestrator node which most recently reported the instance unreachable
+	IsPartiallyUnreachable bool                   // raft deployments: reachable from some orchestrator nodes, but not from others
+
+	CountThreads             int   // as sampled from the processlist, with ProcesslistSampling
+	CountActiveThreads       int   // as sampled from the processlist: threads not sleeping, other than replication threads
+	LongestApplierTrxSeconds int64 // as sampled from the processlist: age of the longest running transaction of the replication applier
+	ProcesslistProblems      []ProcesslistProblemType
+
+	IsDelayedReplica        bool   // tagged as intentionally delayed
+	IntendedSQLDelay        uint   // the SQL_Delay a tagged delayed replica is meant to have
+	IsSQLDelaySuspended     bool   // delay temporarily suspended, letting the replica catch up
+	SQLDelaySuspendedUntil  string // time at which a suspended delay is restored
+	EffectiveDataAgeSeconds sql.NullInt64
+
+	Flags []InstanceFlag // persisted flags, set via set-instance-flag
 }
 
 // NewInstance creates a new, empty instance
 func NewInstance() *Instance {
 	return &Instance{
 		SlaveHosts: make(map[InstanceKey]bool),
+		Dimensions: make(map[string]string),
 	}
 }
 
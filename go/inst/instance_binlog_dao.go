@@ -496,6 +496,11 @@ func SearchEntryInInstanceBinlogs(instance *Instance, entryText string, monotoni
 		log.Debugf("Found instance Pseudo GTID entry coordinates in cache: %+v, %+v, %+v", instance.Key, entryText, coords)
 		return coords.(*BinlogCoordinates), nil
 	}
+	if coordinates, found := searchEntryViaLocalPseudoGTIDSearch(instance, entryText, monotonicPseudoGTIDEntries, minBinlogCoordinates); found {
+		log.Debugf("Matched entry in %+v via local search: %+v", instance.Key, *coordinates)
+		instanceBinlogEntryCache.Set(cacheKey, coordinates, 0)
+		return coordinates, nil
+	}
 
 	// Look for GTID entry in given instance:
 	log.Debugf("Searching for given pseudo gtid entry in %+v. monotonicPseudoGTIDEntries=%+v", instance.Key, monotonicPseudoGTIDEntries)
@@ -0,0 +1,189 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"sync"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+)
+
+// clusterInstancesCacheEntry is a cached read of a cluster's instances
+type clusterInstancesCacheEntry struct {
+	instances [](*Instance)
+	readTime  time.Time
+}
+
+// instancesCache is an in-memory cache of cluster instances, as read from the backend.
+// Instance writes made by this process go through to the cache, such that the cache does not
+// need to be invalidated on every discovery. Forgetting instances, downtime and candidacy changes
+// invalidate affected clusters. Entries expire after InstanceCacheTTLSeconds, bounding staleness
+// of changes made by other means.
+type instancesCache struct {
+	sync.Mutex
+
+	clusters         map[string]*clusterInstancesCacheEntry
+	instanceClusters map[InstanceKey]string
+}
+
+var clusterInstancesCache = newInstancesCache()
+
+func newInstancesCache() *instancesCache {
+	return &instancesCache{
+		clusters:         make(map[string]*clusterInstancesCacheEntry),
+		instanceClusters: make(map[InstanceKey]string),
+	}
+}
+
+func instanceCacheTTL() time.Duration {
+	return time.Duration(config.Config.InstanceCacheTTLSeconds) * time.Second
+}
+
+// copyInstances returns shallow copies of given instances, such that callers may not modify cached data
+func copyInstances(instances [](*Instance)) [](*Instance) {
+	copies := [](*Instance){}
+	for _, instance := range instances {
+		instanceCopy := *instance
+		copies = append(copies, &instanceCopy)
+	}
+	return copies
+}
+
+// get returns the cached instances of a cluster, if any and not expired
+func (this *instancesCache) get(clusterName string) (instances [](*Instance), found bool) {
+	this.Lock()
+	defer this.Unlock()
+
+	entry, found := this.clusters[clusterName]
+	if !found {
+		return instances, false
+	}
+	if time.Since(entry.readTime) > instanceCacheTTL() {
+		this.invalidateClusterUnlocked(clusterName)
+		return instances, false
+	}
+	return copyInstances(entry.instances), true
+}
+
+// set caches the instances of a cluster
+func (this *instancesCache) set(clusterName string, instances [](*Instance)) {
+	this.Lock()
+	defer this.Unlock()
+
+	this.invalidateClusterUnlocked(clusterName)
+	this.clusters[clusterName] = &clusterInstancesCacheEntry{instances: copyInstances(instances), readTime: time.Now()}
+	for _, instance := range instances {
+		this.instanceClusters[instance.Key] = clusterName
+	}
+}
+
+func (this *instancesCache) invalidateClusterUnlocked(clusterName string) {
+	entry, found := this.clusters[clusterName]
+	if !found {
+		return
+	}
+	for _, instance := range entry.instances {
+		delete(this.instanceClusters, instance.Key)
+	}
+	delete(this.clusters, clusterName)
+}
+
+// invalidateCluster removes a cluster from the cache
+func (this *instancesCache) invalidateCluster(clusterName string) {
+	this.Lock()
+	defer this.Unlock()
+
+	this.invalidateClusterUnlocked(clusterName)
+}
+
+// invalidateInstance removes the cluster of given instance from the cache
+func (this *instancesCache) invalidateInstance(instanceKey *InstanceKey) {
+	this.Lock()
+	defer this.Unlock()
+
+	if clusterName, found := this.instanceClusters[*instanceKey]; found {
+		this.invalidateClusterUnlocked(clusterName)
+	}
+}
+
+// invalidateAll empties the cache
+func (this *instancesCache) invalidateAll() {
+	this.Lock()
+	defer this.Unlock()
+
+	this.clusters = make(map[string]*clusterInstancesCacheEntry)
+	this.instanceClusters = make(map[InstanceKey]string)
+}
+
+// writeThrough applies a written instance onto the cache. Attributes which are not part of the
+// written instance data, but joined from other tables (downtime, candidacy, flags, delayed replica
+// tagging, discovery pause, agents) are retained from the cached copy.
+// Should the instance be new to its cluster, or have moved between clusters, affected clusters are invalidated.
+func (this *instancesCache) writeThrough(instance *Instance, instanceWasActuallyFound bool, updateLastSeen bool) {
+	this.Lock()
+	defer this.Unlock()
+
+	cachedClusterName, found := this.instanceClusters[instance.Key]
+	if !found {
+		this.invalidateClusterUnlocked(instance.ClusterName)
+		return
+	}
+	if cachedClusterName != instance.ClusterName {
+		this.invalidateClusterUnlocked(cachedClusterName)
+		this.invalidateClusterUnlocked(instance.ClusterName)
+		return
+	}
+	entry := this.clusters[cachedClusterName]
+	for i, cachedInstance := range entry.instances {
+		if !cachedInstance.Key.Equals(&instance.Key) {
+			continue
+		}
+		written := *instance
+		written.IsCandidate = cachedInstance.IsCandidate
+		written.PromotionRule = cachedInstance.PromotionRule
+		written.IsDowntimed = cachedInstance.IsDowntimed
+		written.DowntimeReason = cachedInstance.DowntimeReason
+		written.DowntimeOwner = cachedInstance.DowntimeOwner
+		written.DowntimeEndTimestamp = cachedInstance.DowntimeEndTimestamp
+		written.ElapsedDowntime = cachedInstance.ElapsedDowntime
+		written.UnresolvedHostname = cachedInstance.UnresolvedHostname
+		written.CountMySQLSnapshots = cachedInstance.CountMySQLSnapshots
+		written.Flags = cachedInstance.Flags
+		written.IsDiscoveryPaused = cachedInstance.IsDiscoveryPaused
+		written.IsDelayedReplica = cachedInstance.IsDelayedReplica
+		written.IntendedSQLDelay = cachedInstance.IntendedSQLDelay
+		written.IsSQLDelaySuspended = cachedInstance.IsSQLDelaySuspended
+		written.SQLDelaySuspendedUntil = cachedInstance.SQLDelaySuspendedUntil
+		written.EffectiveDataAgeSeconds = cachedInstance.EffectiveDataAgeSeconds
+		if written.SQLDelay > 0 || written.IsDelayedReplica {
+			written.EffectiveDataAgeSeconds = written.SlaveLagSeconds
+		}
+		written.IsUpToDate = true
+		written.IsRecentlyChecked = true
+		written.IsLastCheckValid = instanceWasActuallyFound && updateLastSeen
+		if !written.IsLastCheckValid {
+			written.LastSeenTimestamp = cachedInstance.LastSeenTimestamp
+			written.SecondsSinceLastSeen = cachedInstance.SecondsSinceLastSeen
+		} else {
+			written.SecondsSinceLastSeen.Int64 = 0
+			written.SecondsSinceLastSeen.Valid = true
+		}
+		entry.instances[i] = &written
+		return
+	}
+}
@@ -0,0 +1,143 @@
+package inst
+
+import (
+	"testing"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	test "github.com/openark/golib/tests"
+)
+
+func TestInstancesCacheWriteThrough(t *testing.T) {
+	config.Config.InstanceCacheTTLSeconds = 5
+	defer func() { config.Config.InstanceCacheTTLSeconds = 0 }()
+
+	c := newInstancesCache()
+	c.set("cluster1", [](*Instance){
+		{Key: key1, ClusterName: "cluster1", IsDowntimed: true},
+		{Key: key2, ClusterName: "cluster1"},
+	})
+	{
+		instances, found := c.get("cluster1")
+		test.S(t).ExpectTrue(found)
+		test.S(t).ExpectEquals(len(instances), 2)
+	}
+	{
+		c.writeThrough(&Instance{Key: key1, ClusterName: "cluster1", Version: "5.7.20"}, true, true)
+		instances, found := c.get("cluster1")
+		test.S(t).ExpectTrue(found)
+		test.S(t).ExpectEquals(instances[0].Version, "5.7.20")
+		test.S(t).ExpectTrue(instances[0].IsDowntimed)
+		test.S(t).ExpectTrue(instances[0].IsLastCheckValid)
+	}
+	{
+		// new instance in cluster invalidates the cluster
+		c.writeThrough(&Instance{Key: key3, ClusterName: "cluster1"}, true, true)
+		_, found := c.get("cluster1")
+		test.S(t).ExpectFalse(found)
+	}
+}
+
+func TestInstancesCacheWriteThroughRetainsJoinedAttributes(t *testing.T) {
+	config.Config.InstanceCacheTTLSeconds = 5
+	defer func() { config.Config.InstanceCacheTTLSeconds = 0 }()
+
+	c := newInstancesCache()
+	c.set("cluster1", [](*Instance){
+		{Key: key1, ClusterName: "cluster1", Flags: []InstanceFlag{NeverPromoteFlag}, IsDelayedReplica: true, IntendedSQLDelay: 3600, IsDiscoveryPaused: true, PromotionRule: MustNotPromoteRule},
+	})
+	written := &Instance{Key: key1, ClusterName: "cluster1", Version: "5.7.20"}
+	written.SlaveLagSeconds.Int64, written.SlaveLagSeconds.Valid = 3605, true
+	c.writeThrough(written, true, true)
+
+	instances, found := c.get("cluster1")
+	test.S(t).ExpectTrue(found)
+	test.S(t).ExpectEquals(instances[0].Version, "5.7.20")
+	test.S(t).ExpectTrue(instances[0].HasFlag(NeverPromoteFlag))
+	test.S(t).ExpectTrue(instances[0].IsDelayedReplica)
+	test.S(t).ExpectEquals(instances[0].IntendedSQLDelay, uint(3600))
+	test.S(t).ExpectEquals(instances[0].EffectiveDataAgeSeconds.Int64, int64(3605))
+	test.S(t).ExpectTrue(instances[0].IsDiscoveryPaused)
+	test.S(t).ExpectEquals(instances[0].PromotionRule, CandidatePromotionRule(MustNotPromoteRule))
+}
+
+func TestInstancesCacheInvalidate(t *testing.T) {
+	config.Config.InstanceCacheTTLSeconds = 5
+	defer func() { config.Config.InstanceCacheTTLSeconds = 0 }()
+
+	c := newInstancesCache()
+	c.set("cluster1", [](*Instance){{Key: key1, ClusterName: "cluster1"}})
+	c.set("cluster2", [](*Instance){{Key: key2, ClusterName: "cluster2"}})
+
+	c.invalidateInstance(&key1)
+	_, found := c.get("cluster1")
+	test.S(t).ExpectFalse(found)
+	_, found = c.get("cluster2")
+	test.S(t).ExpectTrue(found)
+}
+
+func TestReadClusterInstancesBypassesCache(t *testing.T) {
+	withSQLiteBackend(t)
+	config.Config.InstanceCacheTTLSeconds = 5
+	defer func() { config.Config.InstanceCacheTTLSeconds = 0 }()
+	clusterInstancesCache.invalidateAll()
+	defer clusterInstancesCache.invalidateAll()
+
+	writeCheckpointTestInstance(t, "db-1", "", "mysql-bin.000001", time.Now())
+	instances, err := ReadCachedClusterInstances("db-1:3306")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(instances), 1)
+
+	// a change not written through this process is seen by reads off the backend, while cached reads lag behind
+	writeCheckpointTestInstance(t, "db-2", "db-1", "mysql-bin.000001", time.Now())
+	instances, err = ReadCachedClusterInstances("db-1:3306")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(instances), 1)
+	instances, err = ReadClusterInstances("db-1:3306")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(instances), 2)
+	// reading off the backend refreshes the cache
+	instances, err = ReadCachedClusterInstances("db-1:3306")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(instances), 2)
+
+	// a failed check invalidates the instance's cluster
+	err = UpdateInstanceLastChecked(&InstanceKey{Hostname: "db-2", Port: 3306}, false)
+	test.S(t).ExpectNil(err)
+	_, found := clusterInstancesCache.get("db-1:3306")
+	test.S(t).ExpectFalse(found)
+}
+
+func TestInstanceFlagReadThroughCache(t *testing.T) {
+	withSQLiteBackend(t)
+	config.Config.InstanceCacheTTLSeconds = 5
+	defer func() { config.Config.InstanceCacheTTLSeconds = 0 }()
+	clusterInstancesCache.invalidateAll()
+	defer clusterInstancesCache.invalidateAll()
+
+	writeCheckpointTestInstance(t, "db-1", "", "mysql-bin.000001", time.Now())
+	instances, err := ReadCachedClusterInstances("db-1:3306")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectFalse(instances[0].HasFlag(NeverPromoteFlag))
+
+	// setting a flag invalidates the cached cluster
+	err = WriteInstanceFlag(NewInstanceFlagEntry(&instances[0].Key, NeverPromoteFlag, "test", "testing"))
+	test.S(t).ExpectNil(err)
+	instances, err = ReadCachedClusterInstances("db-1:3306")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(instances[0].HasFlag(NeverPromoteFlag))
+
+	// a discovery write, which knows nothing of flags, retains the cached flag
+	discovered := *instances[0]
+	discovered.Flags = nil
+	test.S(t).ExpectNil(WriteInstance(&discovered, true, nil))
+	instances, found := clusterInstancesCache.get("db-1:3306")
+	test.S(t).ExpectTrue(found)
+	test.S(t).ExpectTrue(instances[0].HasFlag(NeverPromoteFlag))
+
+	err = DeleteInstanceFlag(NewInstanceFlagEntry(&instances[0].Key, NeverPromoteFlag, "test", ""))
+	test.S(t).ExpectNil(err)
+	instances, err = ReadCachedClusterInstances("db-1:3306")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectFalse(instances[0].HasFlag(NeverPromoteFlag))
+}
@@ -169,7 +169,8 @@ func logReadTopologyInstanceError(instanceKey *InstanceKey, hint string, err err
 // server and writes the result synchronously to the orchestrator
 // backend.
 func ReadTopologyInstance(instanceKey *InstanceKey) (*Instance, error) {
-	return ReadTopologyInstanceBufferable(instanceKey, false, nil)
+	instance, _, err := ReadTopologyInstanceBufferable(instanceKey, false, nil)
+	return instance, err
 }
 
 // Is this an error which means that we shouldn't try going more queries for this discovery attempt?
@@ -214,9 +215,9 @@ func (instance *Instance) checkMaxScale(db *sql.DB, latency *stopwatch.NamedStop
 			instance.LogBinEnabled = true
 			instance.LogSlaveUpdatesEnabled = true
 			resolvedHostname = instance.Key.Hostname
-			latency.Start("backend")
+			latency.Start("backend_write")
 			UpdateResolvedHostname(resolvedHostname, resolvedHostname)
-			latency.Stop("backend")
+			latency.Stop("backend_write")
 			isMaxScale = true
 		}
 		return nil
@@ -259,7 +260,9 @@ func areReplicationThreadsRunning(instanceKey *InstanceKey) (replicationThreadsR
 // It writes the information retrieved into orchestrator's backend.
 // - writes are optionally buffered.
 // - timing information can be collected for the stages performed.
-func ReadTopologyInstanceBufferable(instanceKey *InstanceKey, bufferWrites bool, latency *stopwatch.NamedStopwatch) (*Instance, error) {
+// - the number of rows written (or buffered for writing) to the backend for the instance is returned: its own
+//   database_instance row and its long running processes.
+func ReadTopologyInstanceBufferable(instanceKey *InstanceKey, bufferWrites bool, latency *stopwatch.NamedStopwatch) (*Instance, int, error) {
 	defer func() {
 		if err := recover(); err != nil {
 			logReadTopologyInstanceError(instanceKey, "Unexpected, aborting", fmt.Errorf("%+v", err))
@@ -278,15 +281,16 @@ func ReadTopologyInstanceBufferable(instanceKey *InstanceKey, bufferWrites bool,
 	isMaxScale := false
 	isMaxScale110 := false
 	slaveStatusFound := false
+	masterServerID := uint(0)
 	var resolveErr error
 
 	if !instanceKey.IsValid() {
-		latency.Start("backend")
+		latency.Start("backend_write")
 		if err := UpdateInstanceLastAttemptedCheck(instanceKey); err != nil {
 			log.Errorf("ReadTopologyInstanceBufferable: %+v: %v", instanceKey, err)
 		}
-		latency.Stop("backend")
-		return instance, fmt.Errorf("ReadTopologyInstance will not act on invalid instance key: %+v", *instanceKey)
+		latency.Stop("backend_write")
+		return instance, 0, fmt.Errorf("ReadTopologyInstance will not act on invalid instance key: %+v", *instanceKey)
 	}
 
 	lastAttemptedCheckTimer := time.AfterFunc(time.Second, func() {
@@ -399,14 +403,8 @@ func ReadTopologyInstanceBufferable(instanceKey *InstanceKey, bufferWrites bool,
 			waitGroup.Add(1)
 			go func() {
 				defer waitGroup.Done()
-				err = sqlutils.QueryRowsMap(db, "show global status like 'rpl_semi_sync_%_status'", func(m sqlutils.RowMap) error {
-					if m.GetString("Variable_name") == "Rpl_semi_sync_master_status" {
-						instance.SemiSyncMasterEnabled = (m.GetString("Value") == "ON")
-					} else if m.GetString("Variable_name") == "Rpl_semi_sync_slave_status" {
-						instance.SemiSyncReplicaEnabled = (m.GetString("Value") == "ON")
-					}
-					return nil
-				})
+				err := readSemiSyncState(db, instance)
+				logReadTopologyInstanceError(instanceKey, "readSemiSyncState", err)
 			}()
 		}
 		if (instance.IsOracleMySQL() || instance.IsPercona()) && !instance.IsSmallerMajorVersionByString("5.6") {
@@ -429,9 +427,9 @@ func ReadTopologyInstanceBufferable(instanceKey *InstanceKey, bufferWrites bool,
 		}
 	}
 	if resolvedHostname != instance.Key.Hostname {
-		latency.Start("backend")
+		latency.Start("backend_write")
 		UpdateResolvedHostname(instance.Key.Hostname, resolvedHostname)
-		latency.Stop("backend")
+		latency.Stop("backend_write")
 		instance.Key.Hostname = resolvedHostname
 	}
 	if instance.Key.Hostname == "" {
@@ -457,6 +455,8 @@ func ReadTopologyInstanceBufferable(instanceKey *InstanceKey, bufferWrites bool,
 		}
 		// This can be overriden by later invocation of DetectPhysicalEnvironmentQuery
 	}
+	// Grouping dimensions with a Query override these by later invocation
+	instance.Dimensions = readHostnameDimensions(instance.Key.Hostname)
 
 	err = sqlutils.QueryRowsMap(db, "show slave status", func(m sqlutils.RowMap) error {
 		instance.HasReplicationCredentials = (m.GetString("Master_User") != "")
@@ -476,6 +476,8 @@ func ReadTopologyInstanceBufferable(instanceKey *InstanceKey, bufferWrites bool,
 		instance.RelaylogCoordinates.Type = RelayLog
 		instance.LastSQLError = strconv.QuoteToASCII(m.GetString("Last_SQL_Error"))
 		instance.LastIOError = strconv.QuoteToASCII(m.GetString("Last_IO_Error"))
+		instance.LastSQLErrno = m.GetUintD("Last_SQL_Errno", 0)
+		instance.LastIOErrno = m.GetUintD("Last_IO_Errno", 0)
 		instance.SQLDelay = m.GetUintD("SQL_Delay", 0)
 		instance.UsingOracleGTID = (m.GetIntD("Auto_Position", 0) == 1)
 		instance.ExecutedGtidSet = m.GetStringD("Executed_Gtid_Set", "")
@@ -507,6 +509,7 @@ func ReadTopologyInstanceBufferable(instanceKey *InstanceKey, bufferWrites bool,
 		instance.SlaveLagSeconds = instance.SecondsBehindMaster
 
 		instance.AllowTLS = (m.GetString("Master_SSL_Allowed") == "Yes")
+		masterServerID = m.GetUintD("Master_Server_Id", 0)
 		// Not breaking the flow even on error
 		slaveStatusFound = true
 		return nil
@@ -519,19 +522,11 @@ func ReadTopologyInstanceBufferable(instanceKey *InstanceKey, bufferWrites bool,
 		goto Cleanup
 	}
 
-	if config.Config.ReplicationLagQuery != "" && !isMaxScale {
+	if !isMaxScale {
 		waitGroup.Add(1)
 		go func() {
 			defer waitGroup.Done()
-			if err := db.QueryRow(config.Config.ReplicationLagQuery).Scan(&instance.SlaveLagSeconds); err == nil {
-				if instance.SlaveLagSeconds.Valid && instance.SlaveLagSeconds.Int64 < 0 {
-					log.Warningf("Host: %+v, instance.SlaveLagSeconds < 0 [%+v], correcting to 0", instanceKey, instance.SlaveLagSeconds.Int64)
-					instance.SlaveLagSeconds.Int64 = 0
-				}
-			} else {
-				instance.SlaveLagSeconds = instance.SecondsBehindMaster
-				logReadTopologyInstanceError(instanceKey, "ReplicationLagQuery", err)
-			}
+			readReplicationLag(db, instance)
 		}()
 	}
 
@@ -589,12 +584,11 @@ func ReadTopologyInstanceBufferable(instanceKey *InstanceKey, bufferWrites bool,
           command IN ('Binlog Dump', 'Binlog Dump GTID')
   		`,
 				func(m sqlutils.RowMap) error {
-					cname, resolveErr := ResolveHostname(m.GetString("slave_hostname"))
+					replicaKey, resolveErr := newDiscoveredReplicaKey(m.GetString("slave_hostname"), instance.Key.Port)
 					if resolveErr != nil {
 						logReadTopologyInstanceError(instanceKey, "ResolveHostname: processlist", resolveErr)
 					}
-					replicaKey := InstanceKey{Hostname: cname, Port: instance.Key.Port}
-					instance.AddReplicaKey(&replicaKey)
+					instance.AddReplicaKey(replicaKey)
 					return err
 				})
 
@@ -616,12 +610,11 @@ func ReadTopologyInstanceBufferable(instanceKey *InstanceKey, bufferWrites bool,
           process_name='mysqld'
   		`,
 				func(m sqlutils.RowMap) error {
-					cname, resolveErr := ResolveHostname(m.GetString("mysql_host"))
+					replicaKey, resolveErr := newDiscoveredReplicaKey(m.GetString("mysql_host"), instance.Key.Port)
 					if resolveErr != nil {
 						logReadTopologyInstanceError(instanceKey, "ResolveHostname: ndbinfo", resolveErr)
 					}
-					replicaKey := InstanceKey{Hostname: cname, Port: instance.Key.Port}
-					instance.AddReplicaKey(&replicaKey)
+					instance.AddReplicaKey(replicaKey)
 					return err
 				})
 
@@ -656,6 +649,24 @@ func ReadTopologyInstanceBufferable(instanceKey *InstanceKey, bufferWrites bool,
 		}()
 	}
 
+	if len(config.Config.GroupingDimensions) > 0 && !isMaxScale {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for dimension, groupingDimension := range config.Config.GroupingDimensions {
+				if groupingDimension.Query == "" {
+					continue
+				}
+				var value string
+				err := db.QueryRow(groupingDimension.Query).Scan(&value)
+				logReadTopologyInstanceError(instanceKey, fmt.Sprintf("GroupingDimensions[%s]", dimension), err)
+				if err == nil && value != "" {
+					instance.Dimensions[dimension] = value
+				}
+			}
+		}()
+	}
+
 	if config.Config.DetectSemiSyncEnforcedQuery != "" && !isMaxScale {
 		waitGroup.Add(1)
 		go func() {
@@ -665,10 +676,28 @@ func ReadTopologyInstanceBufferable(instanceKey *InstanceKey, bufferWrites bool,
 		}()
 	}
 
+	if config.Config.ProcesslistSampling && !isMaxScale {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			var err error
+			longRunningProcesses, err = sampleProcesslist(db, instance)
+			logReadTopologyInstanceError(instanceKey, "sampleProcesslist", err)
+		}()
+	}
+
+	if config.Config.MasterWriteProbeTable != "" && !isMaxScale {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			probeInstanceWrites(db, instance, masterServerID)
+		}()
+	}
+
 	{
-		latency.Start("backend")
+		latency.Start("backend_read")
 		err = ReadInstanceClusterAttributes(instance)
-		latency.Stop("backend")
+		latency.Stop("backend_read")
 		logReadTopologyInstanceError(instanceKey, "ReadInstanceClusterAttributes", err)
 	}
 
@@ -701,9 +730,9 @@ func ReadTopologyInstanceBufferable(instanceKey *InstanceKey, bufferWrites bool,
 
 	// First read the current PromotionRule from candidate_database_instance.
 	{
-		latency.Start("backend")
+		latency.Start("backend_read")
 		err = ReadInstancePromotionRule(instance)
-		latency.Stop("backend")
+		latency.Stop("backend_read")
 		logReadTopologyInstanceError(instanceKey, "ReadInstancePromotionRule", err)
 	}
 	// Then check if the instance wants to set a different PromotionRule.
@@ -758,9 +787,9 @@ func ReadTopologyInstanceBufferable(instanceKey *InstanceKey, bufferWrites bool,
 			logReadTopologyInstanceError(instanceKey, "DetectClusterDomainQuery", err)
 		}
 		if domainName != "" {
-			latency.Start("backend")
+			latency.Start("backend_write")
 			err := WriteClusterDomainName(instance.ClusterName, domainName)
-			latency.Stop("backend")
+			latency.Stop("backend_write")
 			logReadTopologyInstanceError(instanceKey, "WriteClusterDomainName", err)
 		}
 	}
@@ -775,25 +804,33 @@ Cleanup:
 		instance.IsLastCheckValid = true
 		instance.IsRecentlyChecked = true
 		instance.IsUpToDate = true
-		latency.Start("backend")
+		registerFullProbe(&instance.Key)
+		rowsWritten := 0
+		latency.Start("backend_write")
 		if bufferWrites {
+			enqueueLongRunningProcessesWrite(&instance.Key, longRunningProcesses)
 			enqueueInstanceWrite(instance, instanceFound, err)
+			rowsWritten = 1 + len(longRunningProcesses)
 		} else {
-			WriteInstance(instance, instanceFound, err)
+			if err == nil && WriteInstance(instance, instanceFound, err) == nil {
+				rowsWritten++
+			}
+			if WriteLongRunningProcesses(&instance.Key, longRunningProcesses) == nil {
+				rowsWritten += len(longRunningProcesses)
+			}
 		}
-		WriteLongRunningProcesses(&instance.Key, longRunningProcesses)
 		lastAttemptedCheckTimer.Stop()
-		latency.Stop("backend")
-		return instance, nil
+		latency.Stop("backend_write")
+		return instance, rowsWritten, nil
 	}
 
 	// Something is wrong, could be network-wise. Record that we
 	// tried to check the instance. last_attempted_check is also
 	// updated on success by writeInstance.
-	latency.Start("backend")
+	latency.Start("backend_write")
 	_ = UpdateInstanceLastChecked(&instance.Key, partialSuccess)
-	latency.Stop("backend")
-	return nil, err
+	latency.Stop("backend_write")
+	return nil, 0, err
 }
 
 // ReadClusterAliasOverride reads and applies SuggestedClusterAlias based on cluster_alias_override
@@ -881,6 +918,30 @@ func ReadInstanceClusterAttributes(instance *Instance) (err error) {
 			// circular replication. Avoid infinite ++ on replicationDepth
 			replicationDepth = 0
 		} // While the other stays "1"
+	} else if masterDataFound && masterMasterKey.IsValid() {
+		// Possibly a replication ring of more than two members, which is just as infinite a loop
+		if ringMembers := readReplicationCircle(&instance.Key, &instance.MasterKey, &masterMasterKey); len(ringMembers) > 0 {
+			isCoMaster = true
+			isNamedAfterRingMember := false
+			smallestMember := ringMembers[0]
+			for _, member := range ringMembers {
+				member := member
+				if member.StringCode() == clusterName {
+					isNamedAfterRingMember = true
+				}
+				if member.SmallerThan(&smallestMember) {
+					smallestMember = member
+				}
+			}
+			if !isNamedAfterRingMember {
+				log.Errorf("ReadInstanceClusterAttributes: in replication ring %s is not named after any ring member. Forcing it to %s", clusterName, smallestMember.StringCode())
+				clusterName = smallestMember.StringCode()
+			}
+			if clusterName == clusterNameByInstanceKey {
+				// The ring member the cluster is named after anchors replicationDepth; the others follow it
+				replicationDepth = 0
+			}
+		}
 	}
 	instance.ClusterName = clusterName
 	instance.SuggestedClusterAlias = masterSuggestedClusterAlias
@@ -889,6 +950,40 @@ func ReadInstanceClusterAttributes(instance *Instance) (err error) {
 	return nil
 }
 
+// readReplicationCircle walks up the replication chain of given instance as known to the backend, given its
+// master and grand-master, and returns the members of the replication circle the instance participates in, if any.
+func readReplicationCircle(instanceKey *InstanceKey, masterKey *InstanceKey, masterMasterKey *InstanceKey) (members []InstanceKey) {
+	getMasterKey := func(key InstanceKey) (InstanceKey, bool) {
+		if key.Equals(instanceKey) {
+			return *masterKey, true
+		}
+		if key.Equals(masterKey) {
+			return *masterMasterKey, true
+		}
+		var upstreamKey InstanceKey
+		found := false
+		query := `
+			select
+					master_host,
+					master_port
+				from database_instance
+				where hostname=? and port=?
+		`
+		err := db.QueryOrchestrator(query, sqlutils.Args(key.Hostname, key.Port), func(m sqlutils.RowMap) error {
+			upstreamKey.Hostname = m.GetString("master_host")
+			upstreamKey.Port = m.GetInt("master_port")
+			found = true
+			return nil
+		})
+		if err != nil {
+			log.Errore(err)
+			return upstreamKey, false
+		}
+		return upstreamKey, found
+	}
+	return getReplicationCircle(*instanceKey, getMasterKey)
+}
+
 type byNamePort [](*InstanceKey)
 
 func (this byNamePort) Len() int      { return len(this) }
@@ -943,6 +1038,20 @@ func ReadInstancePromotionRule(instance *Instance) (err error) {
 		promotionRule = CandidatePromotionRule(m.GetString("promotion_rule"))
 		return nil
 	})
+	if err != nil {
+		return log.Errore(err)
+	}
+	// An active override takes precedence
+	query = `
+			select
+				override_promotion_rule
+				from candidate_database_instance_override
+				where hostname=? and port=? and override_expires_at > now()
+	`
+	err = db.QueryOrchestrator(query, args, func(m sqlutils.RowMap) error {
+		promotionRule = CandidatePromotionRule(m.GetString("override_promotion_rule"))
+		return nil
+	})
 	instance.PromotionRule = promotionRule
 	return log.Errore(err)
 }
@@ -988,17 +1097,24 @@ func readInstanceRow(m sqlutils.RowMap) *Instance {
 	instance.RelaylogCoordinates.Type = RelayLog
 	instance.LastSQLError = m.GetString("last_sql_error")
 	instance.LastIOError = m.GetString("last_io_error")
+	instance.LastSQLErrno = m.GetUint("last_sql_errno")
+	instance.LastIOErrno = m.GetUint("last_io_errno")
 	instance.SecondsBehindMaster = m.GetNullInt64("seconds_behind_master")
 	instance.SlaveLagSeconds = m.GetNullInt64("slave_lag_seconds")
+	instance.ReplicationLagSource = m.GetString("replication_lag_source")
 	instance.SQLDelay = m.GetUint("sql_delay")
 	slaveHostsJSON := m.GetString("slave_hosts")
 	instance.ClusterName = m.GetString("cluster_name")
 	instance.SuggestedClusterAlias = m.GetString("suggested_cluster_alias")
 	instance.DataCenter = m.GetString("data_center")
 	instance.PhysicalEnvironment = m.GetString("physical_environment")
+	instance.Dimensions = dimensionsFromJSON(m.GetString("grouping_dimensions"))
 	instance.SemiSyncEnforced = m.GetBool("semi_sync_enforced")
 	instance.SemiSyncMasterEnabled = m.GetBool("semi_sync_master_enabled")
 	instance.SemiSyncReplicaEnabled = m.GetBool("semi_sync_replica_enabled")
+	instance.WriteProbeFailing = m.GetBool("write_probe_failing")
+	instance.WriteProbeValue = m.GetInt64("write_probe_value")
+	instance.ReplicatedWriteProbeValue = m.GetInt64("replicated_write_probe_value")
 	instance.ReplicationDepth = m.GetUint("replication_depth")
 	instance.IsCoMaster = m.GetBool("is_co_master")
 	instance.ReplicationCredentialsAvailable = m.GetBool("replication_credentials_available")
@@ -1019,8 +1135,35 @@ func readInstanceRow(m sqlutils.RowMap) *Instance {
 	instance.AllowTLS = m.GetBool("allow_tls")
 	instance.InstanceAlias = m.GetString("instance_alias")
 	instance.LastDiscoveryLatency = time.Duration(m.GetInt64("last_discovery_latency")) * time.Nanosecond
+	instance.IsDiscoveryPaused = m.GetBool("is_discovery_paused")
+	instance.IsDelayedReplica = m.GetBool("is_delayed_replica")
+	instance.IntendedSQLDelay = m.GetUint("intended_sql_delay")
+	instance.IsSQLDelaySuspended = m.GetBool("is_sql_delay_suspended")
+	if instance.IsSQLDelaySuspended {
+		instance.SQLDelaySuspendedUntil = m.GetString("sql_delay_suspended_until")
+	}
+	if instance.SQLDelay > 0 || instance.IsDelayedReplica {
+		// A delayed replica's lag includes its delay: this is how old its data is
+		instance.EffectiveDataAgeSeconds = instance.SlaveLagSeconds
+	}
+
+	instance.CountThreads = m.GetInt("count_threads")
+	instance.CountActiveThreads = m.GetInt("count_active_threads")
+	instance.LongestApplierTrxSeconds = m.GetInt64("longest_applier_trx_seconds")
+	instance.ProcesslistProblems = instance.getProcesslistProblems()
+	instance.Flags = parseInstanceFlags(m.GetString("instance_flags"))
+	instance.SemiSyncMasterConfigured = m.GetBool("semi_sync_master_configured")
+	instance.SemiSyncMasterTimeout = m.GetUint("semi_sync_master_timeout")
+	instance.SemiSyncMasterWaitPoint = m.GetString("semi_sync_master_wait_point")
+	instance.SemiSyncMasterWaitForSlaveCount = m.GetUint("semi_sync_master_wait_for_slave_count")
+	instance.SemiSyncMasterClients = m.GetUint("semi_sync_master_clients")
+	instance.SemiSyncMasterYesTx = m.GetInt64("semi_sync_master_yes_tx")
+	instance.SemiSyncMasterNoTx = m.GetInt64("semi_sync_master_no_tx")
+	instance.SemiSyncMasterNoTimes = m.GetInt64("semi_sync_master_no_times")
+	instance.SemiSyncAsyncFallback = instance.IsSemiSyncAsyncFallback()
 
 	instance.SlaveHosts.ReadJson(slaveHostsJSON)
+	instance.IsDiscoveryShed = IsDiscoveryShed(instance)
 	instance.applyFlavorName()
 	return instance
 }
@@ -1039,20 +1182,42 @@ func readInstancesByCondition(condition string, args []interface{}, sort string)
 			unix_timestamp() - unix_timestamp(last_checked) as seconds_since_last_checked,
 			ifnull(last_checked <= last_seen, 0) as is_last_check_valid,
 			unix_timestamp() - unix_timestamp(last_seen) as seconds_since_last_seen,
-			candidate_database_instance.last_suggested is not null
-				 and candidate_database_instance.promotion_rule in ('must', 'prefer') as is_candidate,
-			ifnull(nullif(candidate_database_instance.promotion_rule, ''), 'neutral') as promotion_rule,
+			case
+				when candidate_database_instance_override.override_expires_at > now() then candidate_database_instance_override.override_promotion_rule in ('must', 'prefer')
+				else candidate_database_instance.last_suggested is not null and candidate_database_instance.promotion_rule in ('must', 'prefer')
+			end as is_candidate,
+			case
+				when candidate_database_instance_override.override_expires_at > now() then candidate_database_instance_override.override_promotion_rule
+				else ifnull(nullif(candidate_database_instance.promotion_rule, ''), 'neutral')
+			end as promotion_rule,
 			ifnull(unresolved_hostname, '') as unresolved_hostname,
 			(database_instance_downtime.downtime_active is not null and ifnull(database_instance_downtime.end_timestamp, now()) > now()) as is_downtimed,
     	ifnull(database_instance_downtime.reason, '') as downtime_reason,
 			ifnull(database_instance_downtime.owner, '') as downtime_owner,
 			ifnull(unix_timestamp() - unix_timestamp(begin_timestamp), 0) as elapsed_downtime_seconds,
-    	ifnull(database_instance_downtime.end_timestamp, '') as downtime_end_timestamp
+    	ifnull(database_instance_downtime.end_timestamp, '') as downtime_end_timestamp,
+			exists (
+				select 1 from discovery_paused_cluster
+				where discovery_paused_cluster.cluster_alias = ifnull((
+						select alias from cluster_alias where cluster_alias.cluster_name = database_instance.cluster_name
+					), database_instance.cluster_name)
+					and discovery_paused_cluster.pause_expires_at > now()
+			) as is_discovery_paused,
+			(delayed_replica.hostname is not null) as is_delayed_replica,
+			ifnull(delayed_replica.intended_delay_seconds, 0) as intended_sql_delay,
+			ifnull(delayed_replica.delay_suspended_until > now(), 0) as is_sql_delay_suspended,
+			ifnull(delayed_replica.delay_suspended_until, '') as sql_delay_suspended_until,
+			ifnull((
+				select group_concat(instance_flag) from database_instance_flag
+				where database_instance_flag.hostname = database_instance.hostname and database_instance_flag.port = database_instance.port
+			), '') as instance_flags
 		from
 			database_instance
 			left join candidate_database_instance using (hostname, port)
+			left join candidate_database_instance_override using (hostname, port)
 			left join hostname_unresolve using (hostname)
 			left join database_instance_downtime using (hostname, port)
+			left join delayed_replica using (hostname, port)
 		where
 			%s
 		order by
@@ -1098,13 +1263,30 @@ func ReadInstance(instanceKey *InstanceKey) (*Instance, bool, error) {
 	return instances[0], true, nil
 }
 
-// ReadClusterInstances reads all instances of a given cluster
+// ReadClusterInstances reads all instances of a given cluster off the backend database. Reads made for
+// topology operations and recoveries must use this function rather than ReadCachedClusterInstances.
 func ReadClusterInstances(clusterName string) ([](*Instance), error) {
 	if strings.Index(clusterName, "'") >= 0 {
 		return [](*Instance){}, log.Errorf("Invalid cluster name: %s", clusterName)
 	}
 	condition := `cluster_name = ?`
-	return readInstancesByCondition(condition, sqlutils.Args(clusterName), "")
+	instances, err := readInstancesByCondition(condition, sqlutils.Args(clusterName), "")
+	if err == nil && config.Config.InstanceCacheTTLSeconds > 0 {
+		clusterInstancesCache.set(clusterName, instances)
+	}
+	return instances, err
+}
+
+// ReadCachedClusterInstances reads all instances of a given cluster, served off the in-memory cache when
+// InstanceCacheTTLSeconds is set. Cached instances may be stale by up to InstanceCacheTTLSeconds, and so only
+// serve display purposes, such as topology views.
+func ReadCachedClusterInstances(clusterName string) ([](*Instance), error) {
+	if config.Config.InstanceCacheTTLSeconds > 0 {
+		if instances, found := clusterInstancesCache.get(clusterName); found {
+			return instances, nil
+		}
+	}
+	return ReadClusterInstances(clusterName)
 }
 
 // ReadClusterWriteableMaster returns the/a writeable master of this cluster
@@ -1208,10 +1390,16 @@ func ReadProblemInstances(clusterName string) ([](*Instance), error) {
 				or (not slave_io_running)
 				or (abs(cast(seconds_behind_master as signed) - cast(sql_delay as signed)) > ?)
 				or (abs(cast(slave_lag_seconds as signed) - cast(sql_delay as signed)) > ?)
+				or (? > 0 and longest_applier_trx_seconds >= ?)
+				or (? > 0 and count_active_threads >= ? and (is_co_master or master_host in ('', '_')))
+				or (semi_sync_master_configured and not semi_sync_master_enabled and (is_co_master or master_host in ('', '_')))
 			)
 		`
 
-	args := sqlutils.Args(clusterName, clusterName, config.Config.InstancePollSeconds, config.Config.ReasonableReplicationLagSeconds, config.Config.ReasonableReplicationLagSeconds)
+	args := sqlutils.Args(clusterName, clusterName, config.Config.InstancePollSeconds, config.Config.ReasonableReplicationLagSeconds, config.Config.ReasonableReplicationLagSeconds,
+		config.Config.ProcesslistLongApplierTrxSeconds, config.Config.ProcesslistLongApplierTrxSeconds,
+		config.Config.ProcesslistMasterActiveThreadsThreshold, config.Config.ProcesslistMasterActiveThreadsThreshold,
+	)
 	instances, err := readInstancesByCondition(condition, args, "")
 	if err != nil {
 		return instances, err
@@ -1225,6 +1413,9 @@ func ReadProblemInstances(clusterName string) ([](*Instance), error) {
 		if RegexpMatchPatterns(instance.Key.Hostname, config.Config.ProblemIgnoreHostnameFilters) {
 			skip = true
 		}
+		if instance.HasFlag(SkipLagChecksFlag) && isLagOnlyProblem(instance) {
+			skip = true
+		}
 		if !skip {
 			reportedInstances = append(reportedInstances, instance)
 		}
@@ -1346,10 +1537,22 @@ func ReadDowntimedInstances(clusterName string) ([](*Instance), error) {
 func ReadClusterCandidateInstances(clusterName string) ([](*Instance), error) {
 	condition := `
 			cluster_name = ?
-			and concat(hostname, ':', port) in (
+			and (
+				concat(hostname, ':', port) in (
+					select concat(hostname, ':', port)
+						from candidate_database_instance
+						where promotion_rule in ('must', 'prefer')
+				)
+				or concat(hostname, ':', port) in (
+					select concat(hostname, ':', port)
+						from candidate_database_instance_override
+						where override_promotion_rule in ('must', 'prefer') and override_expires_at > now()
+				)
+			)
+			and concat(hostname, ':', port) not in (
 				select concat(hostname, ':', port)
-					from candidate_database_instance
-					where promotion_rule in ('must', 'prefer')
+					from candidate_database_instance_override
+					where override_promotion_rule not in ('must', 'prefer') and override_expires_at > now()
 			)
 			`
 	return readInstancesByCondition(condition, sqlutils.Args(clusterName), "")
@@ -1734,6 +1937,9 @@ func ForgetUnseenInstancesDifferentlyResolved() error {
 		}
 		rowsAffected = rowsAffected + rows
 	}
+	if rowsAffected > 0 {
+		clusterInstancesCache.invalidateAll()
+	}
 	AuditOperation("forget-unseen-differently-resolved", nil, fmt.Sprintf("Forgotten instances: %d", rowsAffected))
 	return err
 }
@@ -1931,12 +2137,12 @@ func ReadClustersInfo(clusterName string) ([]ClusterInfo, error) {
 // Get a listing of KVPair for clusters masters, for all clusters or for a specific cluster.
 func GetMastersKVPairs(clusterName string) (kvPairs [](*kv.KVPair), err error) {
 
-	clusterAliasMap := make(map[string]string)
+	clustersInfoMap := make(map[string]ClusterInfo)
 	if clustersInfo, err := ReadClustersInfo(clusterName); err != nil {
 		return kvPairs, err
 	} else {
 		for _, clusterInfo := range clustersInfo {
-			clusterAliasMap[clusterInfo.ClusterName] = clusterInfo.ClusterAlias
+			clustersInfoMap[clusterInfo.ClusterName] = clusterInfo
 		}
 	}
 
@@ -1945,7 +2151,15 @@ func GetMastersKVPairs(clusterName string) (kvPairs [](*kv.KVPair), err error) {
 		return kvPairs, err
 	}
 	for _, master := range masters {
-		clusterPairs := GetClusterMasterKVPairs(clusterAliasMap[master.ClusterName], &master.Key)
+		clusterInfo, found := clustersInfoMap[master.ClusterName]
+		if !found {
+			continue
+		}
+		clusterPairs, renderErr := GetClusterMasterEntriesKVPairs(&clusterInfo, master)
+		if renderErr != nil {
+			// Other entries of this cluster, and entries of other clusters, are still returned
+			err = log.Errorf("cluster %s: %+v", clusterInfo.ClusterAlias, renderErr)
+		}
 		kvPairs = append(kvPairs, clusterPairs...)
 	}
 
@@ -1994,6 +2208,21 @@ func GetHeuristicClusterDomainInstanceAttribute(clusterName string) (instanceKey
 	return NewRawInstanceKey(writerInstanceName)
 }
 
+// ReadCountInstances returns the number of known instances
+func ReadCountInstances() (count int, err error) {
+	query := `
+		select
+			count(*) as count_instances
+		from
+			database_instance
+			`
+	err = db.QueryOrchestrator(query, sqlutils.Args(), func(m sqlutils.RowMap) error {
+		count = m.GetInt("count_instances")
+		return nil
+	})
+	return count, log.Errore(err)
+}
+
 // ReadAllInstanceKeys
 func ReadAllInstanceKeys() ([]InstanceKey, error) {
 	res := []InstanceKey{}
@@ -2180,6 +2409,8 @@ func mkInsertOdkuForInstances(instances []*Instance, instanceWasActuallyFound bo
 		"relay_log_pos",
 		"last_sql_error",
 		"last_io_error",
+		"last_sql_errno",
+		"last_io_errno",
 		"seconds_behind_master",
 		"slave_lag_seconds",
 		"sql_delay",
@@ -2197,8 +2428,24 @@ func mkInsertOdkuForInstances(instances []*Instance, instanceWasActuallyFound bo
 		"semi_sync_enforced",
 		"semi_sync_master_enabled",
 		"semi_sync_replica_enabled",
+		"write_probe_failing",
+		"write_probe_value",
+		"replicated_write_probe_value",
 		"instance_alias",
 		"last_discovery_latency",
+		"replication_lag_source",
+		"count_threads",
+		"count_active_threads",
+		"longest_applier_trx_seconds",
+		"grouping_dimensions",
+		"semi_sync_master_configured",
+		"semi_sync_master_timeout",
+		"semi_sync_master_wait_point",
+		"semi_sync_master_wait_for_slave_count",
+		"semi_sync_master_clients",
+		"semi_sync_master_yes_tx",
+		"semi_sync_master_no_tx",
+		"semi_sync_master_no_times",
 	}
 
 	var values []string = make([]string, len(columns), len(columns))
@@ -2254,6 +2501,8 @@ func mkInsertOdkuForInstances(instances []*Instance, instanceWasActuallyFound bo
 		args = append(args, instance.RelaylogCoordinates.LogPos)
 		args = append(args, instance.LastSQLError)
 		args = append(args, instance.LastIOError)
+		args = append(args, instance.LastSQLErrno)
+		args = append(args, instance.LastIOErrno)
 		args = append(args, instance.SecondsBehindMaster)
 		args = append(args, instance.SlaveLagSeconds)
 		args = append(args, instance.SQLDelay)
@@ -2271,8 +2520,24 @@ func mkInsertOdkuForInstances(instances []*Instance, instanceWasActuallyFound bo
 		args = append(args, instance.SemiSyncEnforced)
 		args = append(args, instance.SemiSyncMasterEnabled)
 		args = append(args, instance.SemiSyncReplicaEnabled)
+		args = append(args, instance.WriteProbeFailing)
+		args = append(args, instance.WriteProbeValue)
+		args = append(args, instance.ReplicatedWriteProbeValue)
 		args = append(args, instance.InstanceAlias)
 		args = append(args, instance.LastDiscoveryLatency.Nanoseconds())
+		args = append(args, instance.ReplicationLagSource)
+		args = append(args, instance.CountThreads)
+		args = append(args, instance.CountActiveThreads)
+		args = append(args, instance.LongestApplierTrxSeconds)
+		args = append(args, dimensionsToJSON(instance.Dimensions))
+		args = append(args, instance.SemiSyncMasterConfigured)
+		args = append(args, instance.SemiSyncMasterTimeout)
+		args = append(args, instance.SemiSyncMasterWaitPoint)
+		args = append(args, instance.SemiSyncMasterWaitForSlaveCount)
+		args = append(args, instance.SemiSyncMasterClients)
+		args = append(args, instance.SemiSyncMasterYesTx)
+		args = append(args, instance.SemiSyncMasterNoTx)
+		args = append(args, instance.SemiSyncMasterNoTimes)
 	}
 
 	sql, err := mkInsertOdku("database_instance", columns, values, len(instances), insertIgnore)
@@ -2303,6 +2568,9 @@ func writeManyInstances(instances []*Instance, instanceWasActuallyFound bool, up
 	if _, err := db.ExecOrchestrator(sql, args...); err != nil {
 		return err
 	}
+	for _, instance := range writeInstances {
+		clusterInstancesCache.writeThrough(instance, instanceWasActuallyFound, updateLastSeen)
+	}
 	return nil
 }
 
@@ -2331,6 +2599,14 @@ func enqueueInstanceWrite(instance *Instance, instanceWasActuallyFound bool, las
 	instanceWriteBuffer <- instanceUpdateObject{instance, instanceWasActuallyFound, lastError}
 }
 
+// FlushInstanceWriteBuffer saves enqueued instances to Orchestrator Db without waiting for the next flush interval
+func FlushInstanceWriteBuffer() {
+	if instanceWriteBuffer == nil {
+		return
+	}
+	flushInstanceWriteBuffer()
+}
+
 // flushInstanceWriteBuffer saves enqueued instances to Orchestrator Db
 func flushInstanceWriteBuffer() {
 	var instances []*Instance
@@ -2362,6 +2638,10 @@ func flushInstanceWriteBuffer() {
 		if err != nil {
 			return log.Errorf("flushInstanceWriteBuffer last_seen: %v", err)
 		}
+		err = flushLongRunningProcessesBuffer()
+		if err != nil {
+			return log.Errorf("flushInstanceWriteBuffer long running processes: %v", err)
+		}
 
 		writeInstanceCounter.Inc(int64(len(instances) + len(lastseen)))
 		return nil
@@ -2398,6 +2678,7 @@ func UpdateInstanceLastChecked(instanceKey *InstanceKey, partialSuccess bool) er
 			instanceKey.Hostname,
 			instanceKey.Port,
 		)
+		clusterInstancesCache.invalidateInstance(instanceKey)
 		return log.Errore(err)
 	}
 	return ExecDBWriteFunc(writeFunc)
@@ -2438,6 +2719,12 @@ func InstanceIsForgotten(instanceKey *InstanceKey) bool {
 // It may be auto-rediscovered through topology or requested for discovery by multiple means.
 func ForgetInstance(instanceKey *InstanceKey) error {
 	forgetInstanceKeys.Set(instanceKey.StringCode(), true, cache.DefaultExpiration)
+	if StateEventsEnabled() {
+		if clusterName, err := GetClusterName(instanceKey); err == nil && clusterName != "" {
+			defer RecordStateEvent(InstanceForgottenEvent, clusterName, instanceKey, nil)
+		}
+	}
+	defer clusterInstancesCache.invalidateInstance(instanceKey)
 	_, err := db.ExecOrchestrator(`
 			delete
 				from database_instance
@@ -2463,7 +2750,9 @@ func ForgetCluster(clusterName string) error {
 	for _, instance := range clusterInstances {
 		forgetInstanceKeys.Set(instance.Key.StringCode(), true, cache.DefaultExpiration)
 		AuditOperation("forget", &instance.Key, "")
+		RecordStateEvent(InstanceForgottenEvent, clusterName, &instance.Key, nil)
 	}
+	defer clusterInstancesCache.invalidateCluster(clusterName)
 	_, err = db.ExecOrchestrator(`
 			delete
 				from database_instance
@@ -2476,6 +2765,21 @@ func ForgetCluster(clusterName string) error {
 
 // ForgetLongUnseenInstances will remove entries of all instacnes that have long since been last seen.
 func ForgetLongUnseenInstances() error {
+	if StateEventsEnabled() {
+		err := db.QueryOrchestrator(`
+			select
+				hostname, port, cluster_name
+			from
+				database_instance
+			where
+				last_seen < NOW() - interval ? hour`, sqlutils.Args(config.Config.UnseenInstanceForgetHours), func(m sqlutils.RowMap) error {
+			instanceKey := InstanceKey{Hostname: m.GetString("hostname"), Port: m.GetInt("port")}
+			return RecordStateEvent(InstanceForgottenEvent, m.GetString("cluster_name"), &instanceKey, map[string]interface{}{"reason": "unseen"})
+		})
+		if err != nil {
+			log.Errore(err)
+		}
+	}
 	sqlResult, err := db.ExecOrchestrator(`
 			delete
 				from database_instance
@@ -2490,6 +2794,9 @@ func ForgetLongUnseenInstances() error {
 	if err != nil {
 		return log.Errore(err)
 	}
+	if rows > 0 {
+		clusterInstancesCache.invalidateAll()
+	}
 	AuditOperation("forget-unseen", nil, fmt.Sprintf("Forgotten instances: %d", rows))
 	return err
 }
@@ -0,0 +1,109 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/github/orchestrator/go/config"
+)
+
+// InstanceFlag is a persisted, per-instance flag, consulted by discovery and recovery
+type InstanceFlag string
+
+const (
+	// NeverPromoteFlag bans an instance from being promoted, regardless of its promotion rule
+	NeverPromoteFlag InstanceFlag = "never-promote"
+	// RelaxedPollingFlag has an instance probed no more often than every InstanceFlagRelaxedPollSeconds
+	RelaxedPollingFlag InstanceFlag = "prefer-not-to-poll-aggressively"
+	// SkipLagChecksFlag excludes an instance's replication lag from problems, lag events and lag SLO samples
+	SkipLagChecksFlag InstanceFlag = "skip-lag-checks"
+)
+
+// knownInstanceFlags lists the flags which may be set on instances
+var knownInstanceFlags = []InstanceFlag{NeverPromoteFlag, RelaxedPollingFlag, SkipLagChecksFlag}
+
+// ParseInstanceFlag returns the instance flag of given name, or an error when no such flag is known
+func ParseInstanceFlag(flagName string) (InstanceFlag, error) {
+	for _, flag := range knownInstanceFlags {
+		if string(flag) == flagName {
+			return flag, nil
+		}
+	}
+	return "", fmt.Errorf("Unknown instance flag: %s. Known flags: %+v", flagName, knownInstanceFlags)
+}
+
+// parseInstanceFlags parses a comma delimited list of flags, as read from the backend database. Unknown flags are ignored.
+func parseInstanceFlags(flagNames string) (flags []InstanceFlag) {
+	flags = []InstanceFlag{}
+	for _, flagName := range strings.Split(flagNames, ",") {
+		if flag, err := ParseInstanceFlag(strings.TrimSpace(flagName)); err == nil {
+			flags = append(flags, flag)
+		}
+	}
+	return flags
+}
+
+// InstanceFlagEntry is a flag set on an instance, along with who set it and why
+type InstanceFlagEntry struct {
+	Key          InstanceKey
+	Flag         InstanceFlag
+	Owner        string
+	Reason       string
+	SetTimestamp string
+}
+
+// NewInstanceFlagEntry returns an entry of given flag set on given instance
+func NewInstanceFlagEntry(instanceKey *InstanceKey, flag InstanceFlag, owner string, reason string) *InstanceFlagEntry {
+	return &InstanceFlagEntry{
+		Key:    *instanceKey,
+		Flag:   flag,
+		Owner:  owner,
+		Reason: reason,
+	}
+}
+
+// String returns a string representation of the flag entry
+func (this *InstanceFlagEntry) String() string {
+	return fmt.Sprintf("%+v: %s, set by %s: %s", this.Key, this.Flag, this.Owner, this.Reason)
+}
+
+// HasFlag checks whether given flag is set on this instance
+func (this *Instance) HasFlag(flag InstanceFlag) bool {
+	for _, instanceFlag := range this.Flags {
+		if instanceFlag == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPollingRelaxed checks whether an instance flagged with RelaxedPollingFlag was seen recently enough,
+// per InstanceFlagRelaxedPollSeconds, that it need not be probed just yet
+func IsPollingRelaxed(instance *Instance) bool {
+	if !instance.HasFlag(RelaxedPollingFlag) || !instance.IsLastCheckValid || !instance.SecondsSinceLastSeen.Valid {
+		return false
+	}
+	return instance.SecondsSinceLastSeen.Int64 < int64(config.Config.InstanceFlagRelaxedPollSeconds)
+}
+
+// isLagOnlyProblem checks whether replication lag is the only problem an instance may have: it is up to date, and
+// its replication is running
+func isLagOnlyProblem(instance *Instance) bool {
+	return instance.IsLastCheckValid && instance.IsUpToDate && instance.ReplicaRunning() && len(instance.ProcesslistProblems) == 0
+}
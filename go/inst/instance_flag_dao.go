@@ -0,0 +1,106 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+
+	"github.com/github/orchestrator/go/db"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+// WriteInstanceFlag sets a flag on an instance, or updates the owner and reason of an existing flag
+func WriteInstanceFlag(entry *InstanceFlagEntry) error {
+	if _, err := ParseInstanceFlag(string(entry.Flag)); err != nil {
+		return err
+	}
+	_, err := db.ExecOrchestrator(`
+			insert into database_instance_flag (
+					hostname, port, instance_flag, flag_owner, flag_reason, set_timestamp
+				) values (
+					?, ?, ?, ?, ?, now()
+				)
+				on duplicate key update
+					flag_owner=values(flag_owner),
+					flag_reason=values(flag_reason),
+					set_timestamp=values(set_timestamp)
+			`, entry.Key.Hostname, entry.Key.Port, string(entry.Flag), entry.Owner, entry.Reason,
+	)
+	if err != nil {
+		return log.Errore(err)
+	}
+	clusterInstancesCache.invalidateInstance(&entry.Key)
+	AuditOperation("set-instance-flag", &entry.Key, entry.String())
+	return nil
+}
+
+// DeleteInstanceFlag clears a flag of an instance
+func DeleteInstanceFlag(entry *InstanceFlagEntry) error {
+	_, err := db.ExecOrchestrator(`
+			delete from database_instance_flag where hostname = ? and port = ? and instance_flag = ?
+			`, entry.Key.Hostname, entry.Key.Port, string(entry.Flag),
+	)
+	if err != nil {
+		return log.Errore(err)
+	}
+	clusterInstancesCache.invalidateInstance(&entry.Key)
+	AuditOperation("clear-instance-flag", &entry.Key, string(entry.Flag))
+	return nil
+}
+
+func readInstanceFlagEntries(condition string, args []interface{}) ([]InstanceFlagEntry, error) {
+	entries := []InstanceFlagEntry{}
+	query := fmt.Sprintf(`
+		select
+			hostname,
+			port,
+			instance_flag,
+			flag_owner,
+			flag_reason,
+			set_timestamp
+		from
+			database_instance_flag
+		where
+			%s
+		order by
+			hostname, port, instance_flag
+	`, condition)
+	err := db.QueryOrchestrator(query, args, func(m sqlutils.RowMap) error {
+		entry := InstanceFlagEntry{
+			Flag:         InstanceFlag(m.GetString("instance_flag")),
+			Owner:        m.GetString("flag_owner"),
+			Reason:       m.GetString("flag_reason"),
+			SetTimestamp: m.GetString("set_timestamp"),
+		}
+		entry.Key.Hostname = m.GetString("hostname")
+		entry.Key.Port = m.GetInt("port")
+		entries = append(entries, entry)
+		return nil
+	})
+	return entries, log.Errore(err)
+}
+
+// ReadInstanceFlagEntries reads the flags set on given instance
+func ReadInstanceFlagEntries(instanceKey *InstanceKey) ([]InstanceFlagEntry, error) {
+	return readInstanceFlagEntries("hostname = ? and port = ?", sqlutils.Args(instanceKey.Hostname, instanceKey.Port))
+}
+
+// ReadAllInstanceFlagEntries reads the flags set on all instances
+func ReadAllInstanceFlagEntries() ([]InstanceFlagEntry, error) {
+	return readInstanceFlagEntries("1 = 1", sqlutils.Args())
+}
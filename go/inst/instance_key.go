@@ -31,16 +31,40 @@ type InstanceKey struct {
 
 const detachHint = "//"
 
+// splitHostPort splits a host:port string representation. IPv6 literals are expected in brackets
+// when followed by port, as in [2001:db8::1]:3306. hasPort is false when no port is given, as in
+// myhost, [2001:db8::1] or a bare 2001:db8::1
+func splitHostPort(hostPort string) (host string, port string, hasPort bool) {
+	if strings.HasPrefix(hostPort, "[") {
+		if closing := strings.Index(hostPort, "]"); closing > 0 {
+			host = hostPort[1:closing]
+			if rest := hostPort[closing+1:]; strings.HasPrefix(rest, ":") {
+				return host, rest[1:], true
+			}
+			return host, "", false
+		}
+	}
+	if strings.Count(hostPort, ":") > 1 {
+		// Bare IPv6 literal
+		return hostPort, "", false
+	}
+	tokens := strings.SplitN(hostPort, ":", 2)
+	if len(tokens) == 2 {
+		return tokens[0], tokens[1], true
+	}
+	return hostPort, "", false
+}
+
 // ParseInstanceKey will parse an InstanceKey from a string representation such as 127.0.0.1:3306
 func NewRawInstanceKey(hostPort string) (*InstanceKey, error) {
-	tokens := strings.SplitN(hostPort, ":", 2)
-	if len(tokens) != 2 {
-		return nil, fmt.Errorf("Cannot parse InstanceKey from %s. Expected format is host:port", hostPort)
+	hostname, port, hasPort := splitHostPort(hostPort)
+	if !hasPort {
+		return nil, fmt.Errorf("Cannot parse InstanceKey from %s. Expected format is host:port or [ipv6]:port", hostPort)
 	}
-	instanceKey := &InstanceKey{Hostname: tokens[0]}
+	instanceKey := &InstanceKey{Hostname: hostname}
 	var err error
-	if instanceKey.Port, err = strconv.Atoi(tokens[1]); err != nil {
-		return instanceKey, fmt.Errorf("Invalid port: %s", tokens[1])
+	if instanceKey.Port, err = strconv.Atoi(port); err != nil {
+		return instanceKey, fmt.Errorf("Invalid port: %s", port)
 	}
 
 	return instanceKey, nil
@@ -49,14 +73,14 @@ func NewRawInstanceKey(hostPort string) (*InstanceKey, error) {
 // ParseRawInstanceKeyLoose will parse an InstanceKey from a string representation such as 127.0.0.1:3306.
 // The port part is optional; there will be no name resolve
 func ParseRawInstanceKeyLoose(hostPort string) (*InstanceKey, error) {
-	if !strings.Contains(hostPort, ":") {
-		return &InstanceKey{Hostname: hostPort, Port: config.Config.DefaultInstancePort}, nil
+	if hostname, _, hasPort := splitHostPort(hostPort); !hasPort {
+		return &InstanceKey{Hostname: hostname, Port: config.Config.DefaultInstancePort}, nil
 	}
 	return NewRawInstanceKey(hostPort)
 }
 
 // NewInstanceKeyFromStrings creates a new InstanceKey by resolving hostname and port.
-// hostname is normalized via ResolveHostname. port is tested to be valid integer.
+// The key is normalized via NormalizeInstanceKey, and hostname via ResolveHostname. port is tested to be valid integer.
 func NewInstanceKeyFromStrings(hostname string, port string) (*InstanceKey, error) {
 	instanceKey := &InstanceKey{}
 	var err error
@@ -67,38 +91,51 @@ func NewInstanceKeyFromStrings(hostname string, port string) (*InstanceKey, erro
 	if instanceKey.Port, err = strconv.Atoi(port); err != nil {
 		return instanceKey, fmt.Errorf("NewInstanceKeyFromString: Invalid port: %s", port)
 	}
+	instanceKey.Hostname = hostname
+	*instanceKey = NormalizeInstanceKey(*instanceKey)
 
-	if instanceKey.Hostname, err = ResolveHostname(hostname); err != nil {
+	if instanceKey.Hostname, err = ResolveHostname(instanceKey.Hostname); err != nil {
 		return instanceKey, err
 	}
 
 	return instanceKey, nil
 }
 
+// newDiscoveredReplicaKey creates the key of a replica discovered by hostname alone, e.g. via processlist, and
+// assumed to listen on given port. The key is normalized via NormalizeInstanceKey, and hostname via ResolveHostname.
+// On resolve error the unresolved key is returned along with the error.
+func newDiscoveredReplicaKey(hostname string, port int) (*InstanceKey, error) {
+	instanceKey := NormalizeInstanceKey(InstanceKey{Hostname: hostname, Port: port})
+	resolvedHostname, err := ResolveHostname(instanceKey.Hostname)
+	instanceKey.Hostname = resolvedHostname
+	return &instanceKey, err
+}
+
 // ParseInstanceKey will parse an InstanceKey from a string representation such as 127.0.0.1:3306
 func ParseInstanceKey(hostPort string) (*InstanceKey, error) {
-	tokens := strings.SplitN(hostPort, ":", 2)
-	if len(tokens) != 2 {
-		return nil, fmt.Errorf("Cannot parse InstanceKey from %s. Expected format is host:port", hostPort)
+	hostname, port, hasPort := splitHostPort(hostPort)
+	if !hasPort {
+		return nil, fmt.Errorf("Cannot parse InstanceKey from %s. Expected format is host:port or [ipv6]:port", hostPort)
 	}
-	return NewInstanceKeyFromStrings(tokens[0], tokens[1])
+	return NewInstanceKeyFromStrings(hostname, port)
 }
 
 // ParseInstanceKeyLoose will parse an InstanceKey from a string representation such as 127.0.0.1:3306.
 // The port part is optional
 func ParseInstanceKeyLoose(hostPort string) (*InstanceKey, error) {
-	if !strings.Contains(hostPort, ":") {
-		return &InstanceKey{Hostname: hostPort, Port: config.Config.DefaultInstancePort}, nil
+	if hostname, _, hasPort := splitHostPort(hostPort); !hasPort {
+		return &InstanceKey{Hostname: hostname, Port: config.Config.DefaultInstancePort}, nil
 	}
 	return ParseInstanceKey(hostPort)
 }
 
-// Formalize this key by getting CNAME for hostname
+// Formalize this key by normalizing it, and getting CNAME for hostname
 func (this *InstanceKey) Formalize() *InstanceKey {
 	if this == nil || this.Hostname == "" {
 		return nil
 	}
 
+	*this = NormalizeInstanceKey(*this)
 	this.Hostname, _ = ResolveHostname(this.Hostname)
 	return this
 }
@@ -157,6 +194,10 @@ func (this *InstanceKey) ReattachedKey() *InstanceKey {
 
 // StringCode returns an official string representation of this key
 func (this *InstanceKey) StringCode() string {
+	if strings.Contains(this.Hostname, ":") {
+		// IPv6 literal
+		return fmt.Sprintf("[%s]:%d", this.Hostname, this.Port)
+	}
 	return fmt.Sprintf("%s:%d", this.Hostname, this.Port)
 }
 
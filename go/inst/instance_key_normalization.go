@@ -0,0 +1,148 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/util"
+	"github.com/openark/golib/log"
+)
+
+// InstanceKeyNormalizer rewrites an instance key into its normalized form, returning false when the key is not rewritten
+type InstanceKeyNormalizer func(instanceKey InstanceKey) (normalizedKey InstanceKey, normalized bool)
+
+var instanceKeyNormalizers = make(map[string]InstanceKeyNormalizer)
+var instanceKeyNormalizersMutex sync.Mutex
+
+// RegisterInstanceKeyNormalizer registers a normalizer, applied when InstanceKeyNormalizer is given name
+func RegisterInstanceKeyNormalizer(name string, normalizer InstanceKeyNormalizer) {
+	instanceKeyNormalizersMutex.Lock()
+	defer instanceKeyNormalizersMutex.Unlock()
+	instanceKeyNormalizers[strings.ToLower(name)] = normalizer
+}
+
+func getInstanceKeyNormalizer(name string) (normalizer InstanceKeyNormalizer, found bool) {
+	instanceKeyNormalizersMutex.Lock()
+	defer instanceKeyNormalizersMutex.Unlock()
+	normalizer, found = instanceKeyNormalizers[strings.ToLower(name)]
+	return normalizer, found
+}
+
+var instanceKeyNormalizationRegexps = make(map[string]*regexp.Regexp)
+var instanceKeyNormalizationNetworks = make(map[string]*net.IPNet)
+var instanceKeyNormalizationMutex sync.Mutex
+
+// getInstanceKeyNormalizationRegexp compiles a rule's HostnamePattern, caching the result
+func getInstanceKeyNormalizationRegexp(pattern string) (*regexp.Regexp, error) {
+	instanceKeyNormalizationMutex.Lock()
+	defer instanceKeyNormalizationMutex.Unlock()
+	if re, found := instanceKeyNormalizationRegexps[pattern]; found {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	instanceKeyNormalizationRegexps[pattern] = re
+	return re, nil
+}
+
+// getInstanceKeyNormalizationNetwork parses a rule's CIDR, caching the result
+func getInstanceKeyNormalizationNetwork(cidr string) (*net.IPNet, error) {
+	instanceKeyNormalizationMutex.Lock()
+	defer instanceKeyNormalizationMutex.Unlock()
+	if network, found := instanceKeyNormalizationNetworks[cidr]; found {
+		return network, nil
+	}
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	instanceKeyNormalizationNetworks[cidr] = network
+	return network, nil
+}
+
+// applyInstanceKeyNormalizationRule rewrites given key by given rule, returning false when the rule does not match the key
+func applyInstanceKeyNormalizationRule(rule config.InstanceKeyNormalizationRule, instanceKey InstanceKey) (InstanceKey, bool) {
+	if rule.Port != 0 && rule.Port != instanceKey.Port {
+		return instanceKey, false
+	}
+	hostname := instanceKey.Hostname
+	if rule.HostnamePattern != "" {
+		re, err := getInstanceKeyNormalizationRegexp(rule.HostnamePattern)
+		if err != nil {
+			log.Errorf("NormalizeInstanceKey: invalid HostnamePattern %s: %+v", rule.HostnamePattern, err)
+			return instanceKey, false
+		}
+		if !re.MatchString(hostname) {
+			return instanceKey, false
+		}
+		if rule.Replacement != "" {
+			hostname = re.ReplaceAllString(hostname, rule.Replacement)
+		}
+	} else {
+		network, err := getInstanceKeyNormalizationNetwork(rule.CIDR)
+		if err != nil {
+			log.Errorf("NormalizeInstanceKey: invalid CIDR %s: %+v", rule.CIDR, err)
+			return instanceKey, false
+		}
+		ip := net.ParseIP(hostname)
+		if ip == nil || !network.Contains(ip) {
+			return instanceKey, false
+		}
+		if rule.Replacement != "" {
+			ipDashed := strings.NewReplacer(".", "-", ":", "-").Replace(ip.String())
+			hostname = strings.NewReplacer("{ip}", ip.String(), "{ipDashed}", ipDashed).Replace(rule.Replacement)
+		}
+	}
+	normalizedKey := InstanceKey{Hostname: hostname, Port: instanceKey.Port}
+	if rule.ReplacementPort != 0 {
+		normalizedKey.Port = rule.ReplacementPort
+	}
+	return normalizedKey, true
+}
+
+// NormalizeInstanceKey rewrites given key by the first of InstanceKeyNormalizationRules which matches it, and then
+// by InstanceKeyNormalizer, if configured. Normalization is expected to be idempotent: a normalized key should match
+// no rule. Keys are normalized before their hostname is resolved.
+func NormalizeInstanceKey(instanceKey InstanceKey) InstanceKey {
+	if instanceKey.IsDetached() {
+		return instanceKey
+	}
+	for _, rule := range config.Config.InstanceKeyNormalizationRules {
+		if normalizedKey, normalized := applyInstanceKeyNormalizationRule(rule, instanceKey); normalized {
+			instanceKey = normalizedKey
+			break
+		}
+	}
+	if config.Config.InstanceKeyNormalizer != "" {
+		normalizer, found := getInstanceKeyNormalizer(config.Config.InstanceKeyNormalizer)
+		if !found {
+			if util.ClearToLog("NormalizeInstanceKey", config.Config.InstanceKeyNormalizer) {
+				log.Errorf("NormalizeInstanceKey: unknown InstanceKeyNormalizer %s", config.Config.InstanceKeyNormalizer)
+			}
+		} else if normalizedKey, normalized := normalizer(instanceKey); normalized {
+			instanceKey = normalizedKey
+		}
+	}
+	return instanceKey
+}
@@ -0,0 +1,246 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+	"github.com/patrickmn/go-cache"
+	"github.com/rcrowley/go-metrics"
+	"github.com/sjmudd/stopwatch"
+)
+
+// lightweightProbeGlobalsQuery reads, in a single statement, the global state of an instance which may change
+// between full probes, along with the number of replicas connected to it
+const lightweightProbeGlobalsQuery = `
+	select
+		@@global.server_id as server_id,
+		@@global.version as version,
+		@@global.read_only as read_only,
+		@@global.gtid_executed as gtid_executed,
+		@@global.gtid_purged as gtid_purged,
+		ifnull(max(if(variable_name = 'Uptime', variable_value, null)), 0) as uptime,
+		ifnull(max(if(variable_name in ('Rpl_semi_sync_master_status', 'Rpl_semi_sync_source_status'), variable_value, null)), '') as semi_sync_master_status,
+		ifnull(max(if(variable_name in ('Rpl_semi_sync_slave_status', 'Rpl_semi_sync_replica_status'), variable_value, null)), '') as semi_sync_replica_status,
+		(
+			select count(*)
+			from performance_schema.threads
+			where processlist_command in ('Binlog Dump', 'Binlog Dump GTID')
+		) as count_replicas
+	from
+		performance_schema.global_status
+	where
+		variable_name in ('Uptime', 'Rpl_semi_sync_master_status', 'Rpl_semi_sync_source_status', 'Rpl_semi_sync_slave_status', 'Rpl_semi_sync_replica_status')
+	`
+
+// lightweightProbeReplicationQuery reads, in a single statement, the replication status of an instance from
+// performance_schema, as of MySQL 8.0. There is a row per replication channel.
+const lightweightProbeReplicationQuery = `
+	select
+		connection_configuration.host as master_host,
+		connection_configuration.port as master_port,
+		connection_configuration.auto_position as auto_position,
+		connection_status.service_state as io_state,
+		connection_status.last_error_number as io_errno,
+		applier_status.service_state as sql_state,
+		applier_configuration.desired_delay as sql_delay,
+		(
+			select ifnull(max(last_error_number), 0)
+			from performance_schema.replication_applier_status_by_worker as worker
+			where worker.channel_name = connection_configuration.channel_name
+		) as sql_errno,
+		(
+			select max(if(applying_transaction = '', 0, timestampdiff(second, nullif(applying_transaction_original_commit_timestamp, 0), now(6))))
+			from performance_schema.replication_applier_status_by_worker as worker
+			where worker.channel_name = connection_configuration.channel_name
+		) as lag_seconds
+	from
+		performance_schema.replication_connection_configuration as connection_configuration
+		join performance_schema.replication_connection_status as connection_status using (channel_name)
+		join performance_schema.replication_applier_status as applier_status using (channel_name)
+		join performance_schema.replication_applier_configuration as applier_configuration using (channel_name)
+	`
+
+// recentFullProbes lists instances which had a full probe within LightweightProbesFullProbeSeconds
+var recentFullProbes = cache.New(time.Minute, time.Minute)
+
+var lightweightProbesCounter = metrics.NewCounter()
+var lightweightProbesFallbackCounter = metrics.NewCounter()
+
+func init() {
+	metrics.Register("instance.read_topology_lightweight", lightweightProbesCounter)
+	metrics.Register("instance.read_topology_lightweight_fallback", lightweightProbesFallbackCounter)
+}
+
+// registerFullProbe notes that given instance has just had a full probe
+func registerFullProbe(instanceKey *InstanceKey) {
+	if !config.Config.LightweightProbes {
+		return
+	}
+	recentFullProbes.Set(instanceKey.StringCode(), true, time.Duration(config.Config.LightweightProbesFullProbeSeconds)*time.Second)
+}
+
+// IsLightweightProbeEligible checks whether an instance, as last read, may be probed by a lightweight probe: a leaf
+// replica running MySQL 8.0 or above, healthily replicating with GTID auto-positioning, and which had a recent full probe.
+// Masters and intermediate masters always get full probes, as do replicas with broken replication.
+func IsLightweightProbeEligible(instance *Instance) bool {
+	if !config.Config.LightweightProbes {
+		return false
+	}
+	if !instance.IsLastCheckValid || !(instance.IsOracleMySQL() || instance.IsPercona()) || instance.IsSmallerMajorVersionByString("8.0") {
+		return false
+	}
+	if !instance.ReplicaRunning() || !instance.UsingOracleGTID || len(instance.SlaveHosts) > 0 {
+		return false
+	}
+	if instance.LastSQLErrno != 0 || instance.LastIOErrno != 0 {
+		return false
+	}
+	_, found := recentFullProbes.Get(instance.Key.StringCode())
+	return found
+}
+
+// lightweightProbeReplicationLag applies an instance's lag sources, as does readReplicationLag, using the applier
+// lag read by the lightweight probe for both the applier and Seconds_Behind_Master sources
+func lightweightProbeReplicationLag(db *sql.DB, instance *Instance, applierLag sql.NullInt64) {
+	instance.SecondsBehindMaster = applierLag
+	instance.SlaveLagSeconds = sql.NullInt64{}
+	instance.ReplicationLagSource = ""
+	for _, lagSource := range replicationLagSources(&instance.Key) {
+		lagSeconds := applierLag
+		if lagSource == config.ReplicationLagSourceHeartbeat {
+			if config.Config.ReplicationLagQuery == "" {
+				continue
+			}
+			if err := db.QueryRow(config.Config.ReplicationLagQuery).Scan(&lagSeconds); err != nil {
+				logReadTopologyInstanceError(&instance.Key, lagSource, err)
+				continue
+			}
+		}
+		if !lagSeconds.Valid {
+			continue
+		}
+		if lagSeconds.Int64 < 0 {
+			lagSeconds.Int64 = 0
+		}
+		instance.SlaveLagSeconds = lagSeconds
+		instance.ReplicationLagSource = lagSource
+		return
+	}
+}
+
+// ReadTopologyInstanceLightweight probes an instance, as last read, via two performance_schema statements: one
+// for global state and status, one for replication status. Anything else is carried over from the last read, which
+// is at most LightweightProbesFullProbeSeconds old. Should the probe fail, or find the instance restarted, with
+// replicas, its replication changed or broken, it falls back to a full probe via ReadTopologyInstanceBufferable.
+// Like the latter, it returns the number of rows written to the backend for the instance.
+func ReadTopologyInstanceLightweight(previous *Instance, bufferWrites bool, latency *stopwatch.NamedStopwatch) (*Instance, int, error) {
+	instanceKey := previous.Key
+	fullProbe := func(reason string) (*Instance, int, error) {
+		log.Debugf("ReadTopologyInstanceLightweight: %+v: %s; falling back to full probe", instanceKey, reason)
+		lightweightProbesFallbackCounter.Inc(1)
+		return ReadTopologyInstanceBufferable(&instanceKey, bufferWrites, latency)
+	}
+
+	readingStartTime := time.Now()
+	latency.Start("instance")
+	sqlDB, err := db.OpenDiscovery(instanceKey.Hostname, instanceKey.Port)
+	if err != nil {
+		latency.Stop("instance")
+		return fullProbe(err.Error())
+	}
+	instance := *previous
+
+	var serverID, uptime, countReplicas uint
+	var version, semiSyncMasterStatus, semiSyncReplicaStatus string
+	err = sqlDB.QueryRow(lightweightProbeGlobalsQuery).Scan(
+		&serverID, &version, &instance.ReadOnly, &instance.ExecutedGtidSet, &instance.GtidPurged, &uptime, &semiSyncMasterStatus, &semiSyncReplicaStatus, &countReplicas)
+	if err != nil {
+		latency.Stop("instance")
+		return fullProbe(err.Error())
+	}
+	instance.SemiSyncMasterEnabled = (semiSyncMasterStatus == "ON")
+	instance.SemiSyncReplicaEnabled = (semiSyncReplicaStatus == "ON")
+
+	countChannels := 0
+	var masterHostname, masterPort, ioState, sqlState string
+	var autoPosition bool
+	var ioErrno, sqlErrno uint
+	var applierLag sql.NullInt64
+	err = sqlutils.QueryRowsMap(sqlDB, lightweightProbeReplicationQuery, func(m sqlutils.RowMap) error {
+		countChannels++
+		masterHostname = m.GetString("master_host")
+		masterPort = m.GetString("master_port")
+		autoPosition = (m.GetString("auto_position") == "1")
+		ioState = m.GetString("io_state")
+		ioErrno = m.GetUint("io_errno")
+		sqlState = m.GetString("sql_state")
+		sqlErrno = m.GetUint("sql_errno")
+		instance.SQLDelay = m.GetUint("sql_delay")
+		applierLag = m.GetNullInt64("lag_seconds")
+		return nil
+	})
+	latency.Stop("instance")
+	if err != nil {
+		return fullProbe(err.Error())
+	}
+	switch {
+	case serverID != previous.ServerID || version != previous.Version:
+		return fullProbe("server_id or version changed")
+	case uptime < previous.Uptime:
+		return fullProbe("instance restarted")
+	case countReplicas > 0:
+		// No longer a leaf: SlaveHosts, as carried over, is stale
+		return fullProbe(fmt.Sprintf("found %d replicas", countReplicas))
+	case countChannels != 1:
+		return fullProbe(fmt.Sprintf("found %d replication channels", countChannels))
+	case ioState != "ON" || sqlState != "ON" || ioErrno != 0 || sqlErrno != 0:
+		return fullProbe("replication is not running healthily")
+	case !autoPosition:
+		return fullProbe("GTID auto-positioning disabled")
+	}
+	masterKey, err := NewInstanceKeyFromStrings(masterHostname, masterPort)
+	if err != nil {
+		return fullProbe(err.Error())
+	}
+	if masterKey.Hostname, err = ResolveHostname(masterKey.Hostname); err != nil || !masterKey.Equals(&previous.MasterKey) {
+		return fullProbe("master changed")
+	}
+	instance.Uptime = uptime
+	lightweightProbeReplicationLag(sqlDB, &instance, applierLag)
+
+	lightweightProbesCounter.Inc(1)
+	instance.LastDiscoveryLatency = time.Since(readingStartTime)
+	instance.IsLastCheckValid = true
+	instance.IsRecentlyChecked = true
+	instance.IsUpToDate = true
+	rowsWritten := 1
+	latency.Start("backend_write")
+	if bufferWrites {
+		enqueueInstanceWrite(&instance, true, nil)
+	} else if WriteInstance(&instance, true, nil) != nil {
+		rowsWritten = 0
+	}
+	latency.Stop("backend_write")
+	return &instance, rowsWritten, nil
+}
@@ -0,0 +1,315 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+)
+
+const globalPrivilegesObject = "*.*"
+
+// superDynamicPrivileges are the MySQL 8.0 dynamic privileges which together replace SUPER for orchestrator's needs
+var superDynamicPrivileges = []string{"SYSTEM_VARIABLES_ADMIN", "REPLICATION_SLAVE_ADMIN", "CONNECTION_ADMIN"}
+
+var (
+	grantPrivilegesRegexp     = regexp.MustCompile(`(?i)^GRANT\s+(.+?)\s+ON\s+(?:TABLE\s+)?(\S+)\s+TO\s+`)
+	queryReferencedTableRegex = regexp.MustCompile("(?i)\\b(?:from|join)\\s+([`\"]?\\w+[`\"]?)\\s*\\.\\s*([`\"]?\\w+[`\"]?)")
+)
+
+// statementPrivilegeRule lists the privileges, any one of which suffices, which a statement orchestrator issues on
+// topology instances requires on MySQL 8.0+
+type statementPrivilegeRule struct {
+	statementRegexp *regexp.Regexp
+	privileges      []string
+}
+
+// statementPrivilegeRules audits the statements orchestrator issues on topology instances. Statements not listed,
+// such as reads, require none of the privileges SUPER used to imply.
+var statementPrivilegeRules = []statementPrivilegeRule{
+	{regexp.MustCompile(`(?i)^(start|stop)\s+(slave|replica)\b`), []string{"REPLICATION_SLAVE_ADMIN", "SUPER"}},
+	{regexp.MustCompile(`(?i)^change\s+(master|replication\s+source)\b`), []string{"REPLICATION_SLAVE_ADMIN", "SUPER"}},
+	{regexp.MustCompile(`(?i)^reset\s+(slave|replica|master)\b`), []string{"RELOAD"}},
+	{regexp.MustCompile(`(?i)^flush\s+\w+(\s+\w+)?`), []string{"RELOAD"}},
+	{regexp.MustCompile(`(?i)^purge\s+(binary|master)\s+logs\b`), []string{"BINLOG_ADMIN", "SUPER"}},
+	{regexp.MustCompile(`(?i)^set\s+(global\s+|@@global\.)[\w.]+`), []string{"SYSTEM_VARIABLES_ADMIN", "SUPER"}},
+	{regexp.MustCompile(`(?i)^set\s+(@@session\.)?gtid_next\b`), []string{"SYSTEM_VARIABLES_ADMIN", "REPLICATION_APPLIER", "SUPER"}},
+	{regexp.MustCompile(`(?i)^kill\b(\s+query\b)?`), []string{"CONNECTION_ADMIN", "SUPER"}},
+}
+
+// TopologyPrivilege is a privilege, on a given object, which orchestrator's topology user requires on an instance
+type TopologyPrivilege struct {
+	Privilege string
+	Object    string // "*.*", "schema.*" or "schema.table"
+}
+
+// TopologyPrivilegesCheck is the result of checking orchestrator's topology user privileges on an instance
+type TopologyPrivilegesCheck struct {
+	InstanceKey       InstanceKey
+	ClusterName       string
+	User              string // as returned by current_user(), e.g. orchestrator@%
+	MissingPrivileges []TopologyPrivilege
+	GrantStatements   []string
+	CheckedTimestamp  time.Time
+}
+
+// IsDeficient returns true when the topology user is missing any required privilege
+func (this *TopologyPrivilegesCheck) IsDeficient() bool {
+	return len(this.MissingPrivileges) > 0
+}
+
+// grantedPrivileges maps objects ("*.*", "schema.*", "schema.table") onto the privileges granted on them
+type grantedPrivileges map[string]map[string]bool
+
+// unquoteGrantObject normalizes an object as listed by SHOW GRANTS, e.g. `mysql`.`slave_master_info`, into mysql.slave_master_info
+func unquoteGrantObject(object string) string {
+	object = strings.Replace(object, "`", "", -1)
+	object = strings.Replace(object, `"`, "", -1)
+	object = strings.Replace(object, `\_`, "_", -1)
+	object = strings.Replace(object, `\%`, "%", -1)
+	return object
+}
+
+// quoteGrantObject quotes an object such as mysql.slave_master_info into `mysql`.`slave_master_info`, for use in a GRANT statement
+func quoteGrantObject(object string) string {
+	tokens := strings.Split(object, ".")
+	for i, token := range tokens {
+		if token != "*" {
+			tokens[i] = fmt.Sprintf("`%s`", token)
+		}
+	}
+	return strings.Join(tokens, ".")
+}
+
+// splitGrantPrivileges splits the privileges list of a GRANT statement, e.g. "SELECT (a, b), INSERT", on commas
+// outside of column lists
+func splitGrantPrivileges(privileges string) (split []string) {
+	depth := 0
+	start := 0
+	for i, c := range privileges {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				split = append(split, privileges[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(split, privileges[start:])
+}
+
+// parseGrants parses the output of SHOW GRANTS. Role grants and proxy grants are ignored, and so are column
+// privileges, e.g. SELECT (a, b), which do not grant the privilege on the table as a whole.
+func parseGrants(grants []string) grantedPrivileges {
+	granted := make(grantedPrivileges)
+	for _, grant := range grants {
+		submatch := grantPrivilegesRegexp.FindStringSubmatch(strings.TrimSpace(grant))
+		if len(submatch) == 0 {
+			continue
+		}
+		object := unquoteGrantObject(submatch[2])
+		if _, found := granted[object]; !found {
+			granted[object] = make(map[string]bool)
+		}
+		for _, privilege := range splitGrantPrivileges(submatch[1]) {
+			if strings.Contains(privilege, "(") {
+				continue
+			}
+			privilege = strings.ToUpper(strings.Join(strings.Fields(privilege), " "))
+			if privilege == "ALL" {
+				privilege = "ALL PRIVILEGES"
+			}
+			granted[object][privilege] = true
+		}
+	}
+	return granted
+}
+
+// hasPrivilege checks whether given privilege is granted on given object, either directly, or via the
+// object's schema, or globally
+func (this grantedPrivileges) hasPrivilege(privilege string, object string) bool {
+	objects := []string{globalPrivilegesObject}
+	if tokens := strings.SplitN(object, ".", 2); len(tokens) == 2 && tokens[0] != "*" {
+		objects = append(objects, fmt.Sprintf("%s.*", tokens[0]))
+		if tokens[1] != "*" {
+			objects = append(objects, object)
+		}
+	}
+	for _, grantedObject := range objects {
+		if this[grantedObject][privilege] {
+			return true
+		}
+		if this[grantedObject]["ALL PRIVILEGES"] && !(grantedObject == globalPrivilegesObject && isDynamicPrivilege(privilege)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isDynamicPrivilege checks whether given privilege is a MySQL 8.0 dynamic privilege. Those are listed
+// separately by SHOW GRANTS, and are not implied by a listed ALL PRIVILEGES.
+func isDynamicPrivilege(privilege string) bool {
+	return strings.Contains(privilege, "_")
+}
+
+// supportsDynamicPrivileges checks whether given version is of MySQL 8.0 or above, where dynamic privileges replace SUPER
+func supportsDynamicPrivileges(version string) bool {
+	return !strings.Contains(version, "MariaDB") && !IsSmallerMajorVersion(version, "8.0")
+}
+
+// statementPrivilegeRequirement returns the privileges, any one of which suffices, which given statement requires on
+// MySQL 8.0+, along with the statement's leading keywords. No privileges are returned for statements not audited.
+func statementPrivilegeRequirement(statement string) (privileges []string, keywords string) {
+	statement = strings.TrimSpace(statement)
+	for _, rule := range statementPrivilegeRules {
+		if keywords := rule.statementRegexp.FindString(statement); keywords != "" {
+			return rule.privileges, strings.Join(strings.Fields(keywords), " ")
+		}
+	}
+	return privileges, keywords
+}
+
+// checkStatementPrivileges checks, in reduced privileges mode, whether given grants permit given statement on a MySQL 8.0+
+// instance. The error names the missing privilege and the GRANT statement which grants it. Statement arguments, such as
+// replication credentials, are never included.
+func checkStatementPrivileges(instanceKey *InstanceKey, version string, user string, granted grantedPrivileges, statement string) error {
+	if !supportsDynamicPrivileges(version) {
+		return nil
+	}
+	privileges, keywords := statementPrivilegeRequirement(statement)
+	if len(privileges) == 0 {
+		return nil
+	}
+	for _, privilege := range privileges {
+		if granted.hasPrivilege(privilege, globalPrivilegesObject) {
+			return nil
+		}
+	}
+	missing := []TopologyPrivilege{{Privilege: privileges[0], Object: globalPrivilegesObject}}
+	return fmt.Errorf("ReducedPrivilegesMode: refusing to run %s on %+v: %s is not granted %s. Grant with: %s",
+		strings.ToUpper(keywords), *instanceKey, user, strings.Join(privileges, " or "), strings.Join(grantStatements(user, missing), " "))
+}
+
+// configuredQueriesTables returns the tables which configured queries, executed on topology instances, select from
+func configuredQueriesTables() (tables []string) {
+	queries := []string{
+		config.Config.ReplicationLagQuery,
+		config.Config.DetectClusterAliasQuery,
+		config.Config.DetectClusterDomainQuery,
+		config.Config.DetectInstanceAliasQuery,
+		config.Config.DetectPromotionRuleQuery,
+		config.Config.DetectDataCenterQuery,
+		config.Config.DetectPhysicalEnvironmentQuery,
+		config.Config.DetectSemiSyncEnforcedQuery,
+		config.Config.DetectPseudoGTIDQuery,
+	}
+	listed := make(map[string]bool)
+	for _, query := range queries {
+		for _, submatch := range queryReferencedTableRegex.FindAllStringSubmatch(query, -1) {
+			schema := unquoteGrantObject(submatch[1])
+			if strings.ToLower(schema) == "information_schema" {
+				// Always readable
+				continue
+			}
+			table := fmt.Sprintf("%s.%s", schema, unquoteGrantObject(submatch[2]))
+			if !listed[table] {
+				listed[table] = true
+				tables = append(tables, table)
+			}
+		}
+	}
+	return tables
+}
+
+// requiredTopologyPrivileges returns the privileges orchestrator requires on given instance, considering
+// the privileges already granted: SUPER may be substituted on MySQL 8.0+ by a set of dynamic privileges.
+// In reduced privileges mode, the dynamic privileges are required on MySQL 8.0+ even where SUPER is granted,
+// so that SUPER may then be revoked.
+func requiredTopologyPrivileges(instance *Instance, granted grantedPrivileges) (required []TopologyPrivilege) {
+	for _, privilege := range []string{"PROCESS", "REPLICATION SLAVE", "REPLICATION CLIENT", "RELOAD"} {
+		required = append(required, TopologyPrivilege{Privilege: privilege, Object: globalPrivilegesObject})
+	}
+	requireDynamicPrivileges := config.Config.ReducedPrivilegesMode || !granted.hasPrivilege("SUPER", globalPrivilegesObject)
+	if supportsDynamicPrivileges(instance.Version) && requireDynamicPrivileges {
+		for _, privilege := range superDynamicPrivileges {
+			required = append(required, TopologyPrivilege{Privilege: privilege, Object: globalPrivilegesObject})
+		}
+	} else {
+		required = append(required, TopologyPrivilege{Privilege: "SUPER", Object: globalPrivilegesObject})
+	}
+	if !instance.IsMariaDB() && !instance.IsMySQL55() {
+		required = append(required, TopologyPrivilege{Privilege: "SELECT", Object: "mysql.slave_master_info"})
+	}
+	for _, table := range configuredQueriesTables() {
+		required = append(required, TopologyPrivilege{Privilege: "SELECT", Object: table})
+	}
+	if config.Config.AutoPseudoGTID {
+		required = append(required, TopologyPrivilege{Privilege: "DROP", Object: fmt.Sprintf("%s.*", config.PseudoGTIDSchema)})
+	}
+	return required
+}
+
+// grantStatements returns the GRANT statements which grant given privileges to given user
+func grantStatements(user string, privileges []TopologyPrivilege) (statements []string) {
+	grantee := user
+	if at := strings.LastIndex(user, "@"); at >= 0 {
+		grantee = fmt.Sprintf("'%s'@'%s'", user[:at], user[at+1:])
+	}
+	objects := []string{}
+	objectPrivileges := make(map[string][]string)
+	for _, privilege := range privileges {
+		if _, found := objectPrivileges[privilege.Object]; !found {
+			objects = append(objects, privilege.Object)
+		}
+		objectPrivileges[privilege.Object] = append(objectPrivileges[privilege.Object], privilege.Privilege)
+	}
+	for _, object := range objects {
+		statements = append(statements, fmt.Sprintf("GRANT %s ON %s TO %s;", strings.Join(objectPrivileges[object], ", "), quoteGrantObject(object), grantee))
+	}
+	return statements
+}
+
+// NewTopologyPrivilegesCheck checks given grants, as listed by SHOW GRANTS for given user, against the privileges
+// orchestrator requires on given instance
+func NewTopologyPrivilegesCheck(instance *Instance, user string, grants []string) *TopologyPrivilegesCheck {
+	check := &TopologyPrivilegesCheck{
+		InstanceKey:       instance.Key,
+		ClusterName:       instance.ClusterName,
+		User:              user,
+		MissingPrivileges: []TopologyPrivilege{},
+		GrantStatements:   []string{},
+		CheckedTimestamp:  time.Now(),
+	}
+	granted := parseGrants(grants)
+	for _, privilege := range requiredTopologyPrivileges(instance, granted) {
+		if !granted.hasPrivilege(privilege.Privilege, privilege.Object) {
+			check.MissingPrivileges = append(check.MissingPrivileges, privilege)
+		}
+	}
+	if check.IsDeficient() {
+		check.GrantStatements = grantStatements(user, check.MissingPrivileges)
+	}
+	return check
+}
@@ -0,0 +1,96 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+	"github.com/patrickmn/go-cache"
+)
+
+// topologyGrantsCache caches, per instance, the topology user's grants, against which statements are checked
+// in reduced privileges mode
+var topologyGrantsCache = cache.New(5*time.Minute, time.Minute)
+
+// topologyGrants are the grants of orchestrator's topology user on an instance
+type topologyGrants struct {
+	User    string
+	Version string
+	Grants  []string
+	granted grantedPrivileges
+}
+
+// readTopologyGrants reads the grants of orchestrator's topology user on given instance, and caches them
+func readTopologyGrants(instanceKey *InstanceKey) (*topologyGrants, error) {
+	db, err := db.OpenTopology(instanceKey.Hostname, instanceKey.Port)
+	if err != nil {
+		return nil, err
+	}
+	grants := &topologyGrants{Grants: []string{}}
+	if err := db.QueryRow(`select current_user(), @@global.version`).Scan(&grants.User, &grants.Version); err != nil {
+		return nil, err
+	}
+	err = sqlutils.QueryRowsMap(db, `show grants for current_user()`, func(m sqlutils.RowMap) error {
+		for _, grantData := range m {
+			grants.Grants = append(grants.Grants, grantData.String)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	grants.granted = parseGrants(grants.Grants)
+	topologyGrantsCache.Set(instanceKey.StringCode(), grants, cache.DefaultExpiration)
+	return grants, nil
+}
+
+// CheckTopologyPrivileges reads the grants of orchestrator's topology user on given instance, and checks them
+// against the privileges orchestrator requires
+func CheckTopologyPrivileges(instance *Instance) (*TopologyPrivilegesCheck, error) {
+	grants, err := readTopologyGrants(&instance.Key)
+	if err != nil {
+		return nil, log.Errore(err)
+	}
+	return NewTopologyPrivilegesCheck(instance, grants.User, grants.Grants), nil
+}
+
+// CheckTopologyStatementPrivileges checks, in reduced privileges mode, that the topology user is granted the
+// privileges given statement requires on given instance, so that operations fail early and clearly rather
+// than midway. Grants which cannot be read do not block the statement.
+func CheckTopologyStatementPrivileges(instanceKey *InstanceKey, statement string) error {
+	if !config.Config.ReducedPrivilegesMode {
+		return nil
+	}
+	if privileges, _ := statementPrivilegeRequirement(statement); len(privileges) == 0 {
+		return nil
+	}
+	var grants *topologyGrants
+	if cached, found := topologyGrantsCache.Get(instanceKey.StringCode()); found {
+		grants = cached.(*topologyGrants)
+	} else {
+		var err error
+		if grants, err = readTopologyGrants(instanceKey); err != nil {
+			log.Warningf("CheckTopologyStatementPrivileges: cannot read grants on %+v; not checking statement: %+v", *instanceKey, err)
+			return nil
+		}
+	}
+	return checkStatementPrivileges(instanceKey, grants.Version, grants.User, grants.granted, statement)
+}
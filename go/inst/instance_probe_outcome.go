@@ -0,0 +1,56 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"sort"
+	"time"
+)
+
+// InstanceProbeOutcome is the outcome of the latest probes of an instance by one orchestrator node. In raft
+// deployments, each node probes all instances; outcomes of all nodes are replicated, so that an instance unreachable
+// only from some nodes can be told apart from a dead instance.
+type InstanceProbeOutcome struct {
+	Key              InstanceKey
+	OrchestratorNode string
+	IsReachable      bool
+	Since            time.Time // time of the latest probe whose outcome differed from that of the previous probe
+	ReportedAt       time.Time // time at which the node last reported this outcome
+}
+
+// ApplyProbeOutcomes sets the probe outcomes of the instance, as reported by all orchestrator nodes
+func (this *Instance) ApplyProbeOutcomes(outcomes []InstanceProbeOutcome) {
+	sort.Slice(outcomes, func(i, j int) bool { return outcomes[i].OrchestratorNode < outcomes[j].OrchestratorNode })
+	this.ProbeOutcomes = outcomes
+	this.LastSeenBy = ""
+	this.LastFailedProbeBy = ""
+	countReachable := 0
+	var lastSeen, lastFailed time.Time
+	for _, outcome := range outcomes {
+		if outcome.IsReachable {
+			countReachable++
+			if outcome.ReportedAt.After(lastSeen) {
+				lastSeen = outcome.ReportedAt
+				this.LastSeenBy = outcome.OrchestratorNode
+			}
+		} else if outcome.ReportedAt.After(lastFailed) {
+			lastFailed = outcome.ReportedAt
+			this.LastFailedProbeBy = outcome.OrchestratorNode
+		}
+	}
+	this.IsPartiallyUnreachable = countReachable > 0 && countReachable < len(outcomes)
+}
@@ -0,0 +1,91 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"time"
+
+	"github.com/github/orchestrator/go/db"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+// WriteInstanceProbeOutcomes writes the probe outcomes reported by an orchestrator node
+func WriteInstanceProbeOutcomes(outcomes []InstanceProbeOutcome) error {
+	writeFunc := func() error {
+		for _, outcome := range outcomes {
+			_, err := db.ExecOrchestrator(`
+				replace into database_instance_probe_outcome (
+						hostname, port, orchestrator_node, is_reachable, outcome_since_unixtime, reported_unixtime
+					) values (
+						?, ?, ?, ?, ?, ?
+					)
+				`, outcome.Key.Hostname, outcome.Key.Port, outcome.OrchestratorNode, outcome.IsReachable, outcome.Since.Unix(), outcome.ReportedAt.Unix(),
+			)
+			if err != nil {
+				return log.Errore(err)
+			}
+		}
+		return nil
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
+
+// ReadInstanceProbeOutcomes reads the probe outcomes of an instance, as reported by all orchestrator nodes
+func ReadInstanceProbeOutcomes(instanceKey *InstanceKey) (outcomes []InstanceProbeOutcome, err error) {
+	outcomes = []InstanceProbeOutcome{}
+	query := `
+		select
+			hostname,
+			port,
+			orchestrator_node,
+			is_reachable,
+			outcome_since_unixtime,
+			reported_unixtime
+		from
+			database_instance_probe_outcome
+		where
+			hostname = ?
+			and port = ?
+		`
+	err = db.QueryOrchestrator(query, sqlutils.Args(instanceKey.Hostname, instanceKey.Port), func(m sqlutils.RowMap) error {
+		outcome := InstanceProbeOutcome{
+			OrchestratorNode: m.GetString("orchestrator_node"),
+			IsReachable:      m.GetBool("is_reachable"),
+			Since:            time.Unix(m.GetInt64("outcome_since_unixtime"), 0),
+			ReportedAt:       time.Unix(m.GetInt64("reported_unixtime"), 0),
+		}
+		outcome.Key.Hostname = m.GetString("hostname")
+		outcome.Key.Port = m.GetInt("port")
+		outcomes = append(outcomes, outcome)
+		return nil
+	})
+	return outcomes, log.Errore(err)
+}
+
+// ExpireInstanceProbeOutcomes removes probe outcomes not reported for given number of seconds, e.g. those of
+// forgotten instances or of nodes no longer in the raft group
+func ExpireInstanceProbeOutcomes(expirySeconds int64) error {
+	_, err := db.ExecOrchestrator(`
+			delete
+				from database_instance_probe_outcome
+			where
+				reported_unixtime < ?
+			`, time.Now().Unix()-expirySeconds,
+	)
+	return log.Errore(err)
+}
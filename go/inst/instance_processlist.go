@@ -0,0 +1,132 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"database/sql"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/openark/golib/sqlutils"
+)
+
+// ProcesslistProblemType is a problem of an instance, as found by sampling its processlist
+type ProcesslistProblemType string
+
+const (
+	LongApplierTrxProblem         ProcesslistProblemType = "long-applier-transaction"
+	ExcessiveMasterThreadsProblem ProcesslistProblemType = "excessive-master-threads"
+)
+
+// processlistIdleCommands are processlist commands of threads which are not active
+const processlistIdleCommands = `'Sleep', 'Daemon', 'Binlog Dump', 'Binlog Dump GTID'`
+
+// getProcesslistProblems lists the problems implied by this instance's latest processlist sample: a replication
+// applier running a transaction for ProcesslistLongApplierTrxSeconds or more, suggesting the replica is stalled, or
+// a master with ProcesslistMasterActiveThreadsThreshold active threads or more.
+func (this *Instance) getProcesslistProblems() (problems []ProcesslistProblemType) {
+	problems = []ProcesslistProblemType{}
+	if config.Config.ProcesslistLongApplierTrxSeconds > 0 && this.LongestApplierTrxSeconds >= int64(config.Config.ProcesslistLongApplierTrxSeconds) {
+		problems = append(problems, LongApplierTrxProblem)
+	}
+	if config.Config.ProcesslistMasterActiveThreadsThreshold > 0 && this.CountActiveThreads >= int(config.Config.ProcesslistMasterActiveThreadsThreshold) {
+		if this.IsMaster() || this.IsCoMaster {
+			problems = append(problems, ExcessiveMasterThreadsProblem)
+		}
+	}
+	return problems
+}
+
+// sampleProcesslist samples the processlist of an instance being probed: its thread counts, and the age of the
+// replication applier's longest running transaction are set onto the instance. The longest running active threads,
+// up to ProcesslistSampleMaxRows, are returned.
+func sampleProcesslist(db *sql.DB, instance *Instance) (processes []Process, err error) {
+	processes = []Process{}
+	query := `
+		select
+			count(*) as count_threads,
+			ifnull(sum(command not in (` + processlistIdleCommands + `) and user != 'system user'), 0) as count_active_threads
+		from
+			information_schema.processlist
+		`
+	err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+		instance.CountThreads = m.GetInt("count_threads")
+		instance.CountActiveThreads = m.GetInt("count_active_threads")
+		return nil
+	})
+	if err != nil {
+		return processes, err
+	}
+	// The applier's (SQL thread's, or workers') transactions are write transactions
+	query = `
+		select
+			ifnull(max(timestampdiff(second, trx.trx_started, now())), 0) as longest_applier_trx_seconds
+		from
+			information_schema.innodb_trx as trx
+			join information_schema.processlist as processlist on (processlist.id = trx.trx_mysql_thread_id)
+		where
+			processlist.user = 'system user'
+		`
+	err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+		instance.LongestApplierTrxSeconds = m.GetInt64("longest_applier_trx_seconds")
+		return nil
+	})
+	if err != nil {
+		return processes, err
+	}
+	if config.Config.ProcesslistSampleMaxRows == 0 {
+		return processes, nil
+	}
+	query = `
+		select
+			id,
+			user,
+			host,
+			ifnull(db, '') as db,
+			command,
+			time,
+			ifnull(state, '') as state,
+			left(ifnull(info, ''), 1024) as info,
+			now() - interval time second as started_at
+		from
+			information_schema.processlist
+		where
+			command not in (` + processlistIdleCommands + `)
+			and user != 'system user'
+			and id != connection_id()
+		order by
+			time desc
+		limit ?
+		`
+	err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+		process := Process{
+			InstanceHostname: instance.Key.Hostname,
+			InstancePort:     instance.Key.Port,
+			Id:               m.GetInt64("id"),
+			User:             m.GetString("user"),
+			Host:             m.GetString("host"),
+			Db:               m.GetString("db"),
+			Command:          m.GetString("command"),
+			Time:             m.GetInt64("time"),
+			State:            m.GetString("state"),
+			Info:             m.GetString("info"),
+			StartedAt:        m.GetString("started_at"),
+		}
+		processes = append(processes, process)
+		return nil
+	}, config.Config.ProcesslistSampleMaxRows)
+	return processes, err
+}
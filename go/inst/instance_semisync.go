@@ -0,0 +1,93 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/openark/golib/sqlutils"
+)
+
+// normalizeSemiSyncVariableName maps semi-sync variable and status names onto their classic spelling: as of MySQL
+// 8.0.26, e.g. rpl_semi_sync_source_timeout replaces rpl_semi_sync_master_timeout
+func normalizeSemiSyncVariableName(name string) string {
+	name = strings.ToLower(name)
+	name = strings.Replace(name, "_source_", "_master_", -1)
+	name = strings.Replace(name, "_replica_", "_slave_", -1)
+	return name
+}
+
+// readSemiSyncState reads the semi-sync configuration and status counters of an instance being probed
+func readSemiSyncState(db *sql.DB, instance *Instance) error {
+	err := sqlutils.QueryRowsMap(db, "show global status like 'rpl_semi_sync_%'", func(m sqlutils.RowMap) error {
+		value := m.GetString("Value")
+		switch normalizeSemiSyncVariableName(m.GetString("Variable_name")) {
+		case "rpl_semi_sync_master_status":
+			instance.SemiSyncMasterEnabled = (value == "ON")
+		case "rpl_semi_sync_slave_status":
+			instance.SemiSyncReplicaEnabled = (value == "ON")
+		case "rpl_semi_sync_master_clients":
+			instance.SemiSyncMasterClients = m.GetUint("Value")
+		case "rpl_semi_sync_master_yes_tx":
+			instance.SemiSyncMasterYesTx = m.GetInt64("Value")
+		case "rpl_semi_sync_master_no_tx":
+			instance.SemiSyncMasterNoTx = m.GetInt64("Value")
+		case "rpl_semi_sync_master_no_times":
+			instance.SemiSyncMasterNoTimes = m.GetInt64("Value")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return sqlutils.QueryRowsMap(db, "show global variables like 'rpl_semi_sync_%'", func(m sqlutils.RowMap) error {
+		value := m.GetString("Value")
+		switch normalizeSemiSyncVariableName(m.GetString("Variable_name")) {
+		case "rpl_semi_sync_master_enabled":
+			instance.SemiSyncMasterConfigured = (value == "ON")
+		case "rpl_semi_sync_master_timeout":
+			instance.SemiSyncMasterTimeout = m.GetUint("Value")
+		case "rpl_semi_sync_master_wait_point":
+			instance.SemiSyncMasterWaitPoint = value
+		case "rpl_semi_sync_master_wait_for_slave_count":
+			instance.SemiSyncMasterWaitForSlaveCount = m.GetUint("Value")
+		}
+		return nil
+	})
+}
+
+// IsSemiSyncAsyncFallback checks whether this is a master configured for semi-sync replication which fell back to
+// asynchronous replication: rpl_semi_sync_master_enabled is ON, yet Rpl_semi_sync_master_status is OFF. This happens
+// silently when no replica acknowledges a transaction within rpl_semi_sync_master_timeout, after which transactions
+// commit without being received by any replica, and may be lost upon failover.
+func (this *Instance) IsSemiSyncAsyncFallback() bool {
+	if !this.IsMaster() && !this.IsCoMaster {
+		return false
+	}
+	return this.SemiSyncMasterConfigured && !this.SemiSyncMasterEnabled
+}
+
+// IsSemiSyncAsyncFallbackChanged checks whether a master fell back to asynchronous replication, or recovered from
+// such fallback, between two consecutive reads. Reads of an instance which is not valid change nothing.
+func IsSemiSyncAsyncFallbackChanged(previous *Instance, current *Instance) (changed bool, fallenBack bool) {
+	if previous == nil || current == nil || !previous.IsLastCheckValid || !current.IsLastCheckValid {
+		return false, false
+	}
+	fallenBack = current.IsSemiSyncAsyncFallback()
+	return fallenBack != previous.IsSemiSyncAsyncFallback(), fallenBack
+}
@@ -17,10 +17,17 @@
 package inst
 
 import (
+	"database/sql"
 	"github.com/github/orchestrator/go/config"
 	"github.com/openark/golib/log"
 	test "github.com/openark/golib/tests"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func init() {
@@ -69,6 +76,15 @@ func TestIsSmallerMajorVersion(t *testing.T) {
 	test.S(t).ExpectTrue(i55.IsSmallerMajorVersion(&i56))
 }
 
+func TestIsSmallerVersion(t *testing.T) {
+	test.S(t).ExpectTrue(IsSmallerVersion("5.7.5-log", "5.7.6"))
+	test.S(t).ExpectTrue(IsSmallerVersion("5.6.40", "5.7.6"))
+	test.S(t).ExpectFalse(IsSmallerVersion("5.7.6", "5.7.6"))
+	test.S(t).ExpectFalse(IsSmallerVersion("5.7.21-log", "5.7.6"))
+	test.S(t).ExpectFalse(IsSmallerVersion("8.0.11", "5.7.6"))
+	test.S(t).ExpectFalse(IsSmallerVersion("5.7.6", "5.7"))
+}
+
 func TestIsVersion(t *testing.T) {
 	i51 := Instance{Version: "5.1.19"}
 	i55 := Instance{Version: "5.5.17-debug"}
@@ -149,6 +165,27 @@ func TestParseInstanceKey(t *testing.T) {
 	test.S(t).ExpectEquals(i.Port, 3306)
 }
 
+func TestParseInstanceKeyIPv6(t *testing.T) {
+	i, err := ParseRawInstanceKeyLoose("[2001:db8::1]:3307")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(i.Hostname, "2001:db8::1")
+	test.S(t).ExpectEquals(i.Port, 3307)
+	test.S(t).ExpectEquals(i.StringCode(), "[2001:db8::1]:3307")
+
+	i, err = ParseRawInstanceKeyLoose("[2001:db8::1]")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(i.Hostname, "2001:db8::1")
+	test.S(t).ExpectEquals(i.Port, config.Config.DefaultInstancePort)
+
+	i, err = ParseRawInstanceKeyLoose("::1")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(i.Hostname, "::1")
+	test.S(t).ExpectEquals(i.Port, config.Config.DefaultInstancePort)
+
+	_, err = NewRawInstanceKey("2001:db8::1")
+	test.S(t).ExpectNotNil(err)
+}
+
 func TestInstanceKeyValid(t *testing.T) {
 	test.S(t).ExpectTrue(key1.IsValid())
 	i, err := ParseInstanceKey("_:3306")
@@ -287,6 +324,39 @@ func TestOracleGTIDSet(t *testing.T) {
 	}
 }
 
+func TestOracleGTIDSetSubtract(t *testing.T) {
+	executed, err := ParseGtidSet(`230ea8ea-81e3-11e4-972a-e25ec4bd140a:1-10539,
+316d193c-70e5-11e5-adb2-ecf4bb2262ff:1-8935:8984-6124596`)
+	test.S(t).ExpectNil(err)
+	{
+		other, _ := ParseGtidSet(`230ea8ea-81e3-11e4-972a-e25ec4bd140a:1-10539,
+316d193c-70e5-11e5-adb2-ecf4bb2262ff:1-8935:8984-6124596`)
+		diff, err := executed.Subtract(other)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectTrue(diff.IsEmpty())
+	}
+	{
+		other, _ := ParseGtidSet(`230ea8ea-81e3-11e4-972a-e25ec4bd140a:1-10000,
+316d193c-70e5-11e5-adb2-ecf4bb2262ff:1-100:200-6124000`)
+		diff, err := executed.Subtract(other)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(diff.String(), `230ea8ea-81e3-11e4-972a-e25ec4bd140a:10001-10539,
+316d193c-70e5-11e5-adb2-ecf4bb2262ff:101-199:6124001-6124596`)
+	}
+	{
+		other, _ := ParseGtidSet(`321f5c0d-70e5-11e5-adb2-ecf4bb2262ff:1-56`)
+		diff, err := other.Subtract(executed)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(diff.String(), `321f5c0d-70e5-11e5-adb2-ecf4bb2262ff:1-56`)
+	}
+	{
+		other, _ := ParseGtidSet(`230ea8ea-81e3-11e4-972a-e25ec4bd140a:5`)
+		diff, err := other.Subtract(executed)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectTrue(diff.IsEmpty())
+	}
+}
+
 func TestRemoveInstance(t *testing.T) {
 	{
 		instances := [](*Instance){&instance1, &instance2}
@@ -345,3 +415,866 @@ func TestTabulatedDescription(t *testing.T) {
 		test.S(t).ExpectEquals(desc, "unknown|invalid|5.7.8-log|rw|ROW|>>,P-GTID")
 	}
 }
+
+func TestCandidateWithTTL(t *testing.T) {
+	candidate := NewCandidateDatabaseInstance(&key1, PreferPromoteRule)
+	candidate.LastSuggestedString = "2017-05-01 23:30:00"
+	candidate.WithTTL(3600)
+	test.S(t).ExpectEquals(candidate.ExpiresAtString, "2017-05-02 00:30:00")
+
+	candidate.LastSuggestedString = ""
+	candidate.WithTTL(3600)
+	test.S(t).ExpectEquals(candidate.ExpiresAtString, "")
+}
+
+func TestNewTopologyPrivilegesCheck(t *testing.T) {
+	config.Config.ReplicationLagQuery = "select absolute_lag from meta.heartbeat_view"
+	defer func() { config.Config.ReplicationLagQuery = "" }()
+	{
+		i57 := Instance{Key: key1, Version: "5.7.8-log"}
+		check := NewTopologyPrivilegesCheck(&i57, "orchestrator@%", []string{
+			"GRANT SUPER, PROCESS, REPLICATION SLAVE, REPLICATION CLIENT, RELOAD ON *.* TO 'orchestrator'@'%'",
+			"GRANT SELECT ON `meta`.* TO 'orchestrator'@'%'",
+			"GRANT SELECT ON `mysql`.`slave_master_info` TO 'orchestrator'@'%'",
+		})
+		test.S(t).ExpectFalse(check.IsDeficient())
+		test.S(t).ExpectEquals(len(check.GrantStatements), 0)
+	}
+	{
+		i57 := Instance{Key: key1, Version: "5.7.8-log"}
+		check := NewTopologyPrivilegesCheck(&i57, "orchestrator@%", []string{
+			"GRANT ALL PRIVILEGES ON *.* TO 'orchestrator'@'%'",
+		})
+		test.S(t).ExpectFalse(check.IsDeficient())
+	}
+	{
+		i57 := Instance{Key: key1, Version: "5.7.8-log"}
+		check := NewTopologyPrivilegesCheck(&i57, "orchestrator@10.0.0.%", []string{
+			"GRANT PROCESS, REPLICATION SLAVE ON *.* TO 'orchestrator'@'10.0.0.%'",
+			"GRANT SELECT (User_name) ON `mysql`.`slave_master_info` TO 'orchestrator'@'10.0.0.%'",
+		})
+		test.S(t).ExpectTrue(check.IsDeficient())
+		test.S(t).ExpectEquals(len(check.MissingPrivileges), 5)
+		test.S(t).ExpectEquals(len(check.GrantStatements), 3)
+		test.S(t).ExpectEquals(check.GrantStatements[0], "GRANT REPLICATION CLIENT, RELOAD, SUPER ON *.* TO 'orchestrator'@'10.0.0.%';")
+		// A column privilege does not grant the privilege on the table
+		test.S(t).ExpectEquals(check.GrantStatements[1], "GRANT SELECT ON `mysql`.`slave_master_info` TO 'orchestrator'@'10.0.0.%';")
+		test.S(t).ExpectEquals(check.GrantStatements[2], "GRANT SELECT ON `meta`.`heartbeat_view` TO 'orchestrator'@'10.0.0.%';")
+	}
+	{
+		i57 := Instance{Key: key1, Version: "5.7.8-log"}
+		check := NewTopologyPrivilegesCheck(&i57, "orchestrator@%", []string{
+			"GRANT SUPER, PROCESS, REPLICATION SLAVE, REPLICATION CLIENT, RELOAD ON *.* TO 'orchestrator'@'%'",
+			"GRANT SELECT (User_name, Host), SELECT, UPDATE (Port) ON `mysql`.`slave_master_info` TO 'orchestrator'@'%'",
+			"GRANT INSERT (ts), SELECT ON `meta`.`heartbeat_view` TO 'orchestrator'@'%'",
+		})
+		test.S(t).ExpectFalse(check.IsDeficient())
+	}
+	{
+		i80 := Instance{Key: key1, Version: "8.0.21"}
+		check := NewTopologyPrivilegesCheck(&i80, "orchestrator@%", []string{
+			"GRANT PROCESS, RELOAD, REPLICATION SLAVE, REPLICATION CLIENT ON *.* TO `orchestrator`@`%`",
+			"GRANT REPLICATION_SLAVE_ADMIN,SYSTEM_VARIABLES_ADMIN ON *.* TO `orchestrator`@`%`",
+			"GRANT SELECT ON `meta`.`heartbeat_view` TO `orchestrator`@`%`",
+			"GRANT SELECT ON `mysql`.`slave_master_info` TO `orchestrator`@`%`",
+		})
+		test.S(t).ExpectTrue(check.IsDeficient())
+		test.S(t).ExpectEquals(len(check.GrantStatements), 1)
+		test.S(t).ExpectEquals(check.GrantStatements[0], "GRANT CONNECTION_ADMIN ON *.* TO 'orchestrator'@'%';")
+	}
+	{
+		mariadb := Instance{Key: key1, Version: "10.3.8-MariaDB-log"}
+		check := NewTopologyPrivilegesCheck(&mariadb, "orchestrator@%", []string{
+			"GRANT SUPER, PROCESS, REPLICATION SLAVE, REPLICATION CLIENT, RELOAD ON *.* TO 'orchestrator'@'%'",
+			"GRANT SELECT ON `meta`.* TO 'orchestrator'@'%'",
+		})
+		test.S(t).ExpectFalse(check.IsDeficient())
+	}
+}
+
+func TestNewTopologyPrivilegesCheckReducedPrivilegesMode(t *testing.T) {
+	config.Config.ReducedPrivilegesMode = true
+	defer func() { config.Config.ReducedPrivilegesMode = false }()
+	grants := []string{
+		"GRANT SUPER, PROCESS, REPLICATION SLAVE, REPLICATION CLIENT, RELOAD ON *.* TO `orchestrator`@`%`",
+		"GRANT SELECT ON `mysql`.`slave_master_info` TO `orchestrator`@`%`",
+	}
+	{
+		i80 := Instance{Key: key1, Version: "8.0.21"}
+		check := NewTopologyPrivilegesCheck(&i80, "orchestrator@%", grants)
+		test.S(t).ExpectTrue(check.IsDeficient())
+		test.S(t).ExpectEquals(len(check.GrantStatements), 1)
+		test.S(t).ExpectEquals(check.GrantStatements[0], "GRANT SYSTEM_VARIABLES_ADMIN, REPLICATION_SLAVE_ADMIN, CONNECTION_ADMIN ON *.* TO 'orchestrator'@'%';")
+	}
+	{
+		i57 := Instance{Key: key1, Version: "5.7.8-log"}
+		check := NewTopologyPrivilegesCheck(&i57, "orchestrator@%", grants)
+		test.S(t).ExpectFalse(check.IsDeficient())
+	}
+}
+
+func TestStatementPrivilegeRequirement(t *testing.T) {
+	{
+		privileges, keywords := statementPrivilegeRequirement("\n\t\tstop slave io_thread")
+		test.S(t).ExpectEquals(strings.Join(privileges, ","), "REPLICATION_SLAVE_ADMIN,SUPER")
+		test.S(t).ExpectEquals(keywords, "stop slave")
+	}
+	{
+		privileges, keywords := statementPrivilegeRequirement("change master to master_user='repl', master_password='secret'")
+		test.S(t).ExpectEquals(privileges[0], "REPLICATION_SLAVE_ADMIN")
+		test.S(t).ExpectEquals(keywords, "change master")
+	}
+	{
+		privileges, keywords := statementPrivilegeRequirement("set global read_only = ?")
+		test.S(t).ExpectEquals(privileges[0], "SYSTEM_VARIABLES_ADMIN")
+		test.S(t).ExpectEquals(keywords, "set global read_only")
+	}
+	{
+		privileges, _ := statementPrivilegeRequirement("set @@global.rpl_semi_sync_master_enabled=1")
+		test.S(t).ExpectEquals(privileges[0], "SYSTEM_VARIABLES_ADMIN")
+	}
+	{
+		privileges, _ := statementPrivilegeRequirement("SET GTID_NEXT='00020192-1111-1111-1111-111111111111:37'")
+		test.S(t).ExpectEquals(privileges[0], "SYSTEM_VARIABLES_ADMIN")
+	}
+	{
+		privileges, keywords := statementPrivilegeRequirement("kill query 17")
+		test.S(t).ExpectEquals(privileges[0], "CONNECTION_ADMIN")
+		test.S(t).ExpectEquals(keywords, "kill query")
+	}
+	{
+		privileges, _ := statementPrivilegeRequirement("purge binary logs to 'mysql-bin.000012'")
+		test.S(t).ExpectEquals(privileges[0], "BINLOG_ADMIN")
+	}
+	{
+		privileges, _ := statementPrivilegeRequirement("flush error logs")
+		test.S(t).ExpectEquals(strings.Join(privileges, ","), "RELOAD")
+	}
+	{
+		privileges, _ := statementPrivilegeRequirement("select master_pos_wait(?, ?)")
+		test.S(t).ExpectEquals(len(privileges), 0)
+	}
+}
+
+func TestParseGrants(t *testing.T) {
+	granted := parseGrants([]string{
+		"GRANT PROCESS, REPLICATION SLAVE ON *.* TO `orchestrator`@`%`",
+		"GRANT SELECT (`User_name`, `Host`), INSERT ON `mysql`.`slave_master_info` TO `orchestrator`@`%`",
+		"GRANT UPDATE (ts) ON `meta`.`heartbeat` TO `orchestrator`@`%`",
+		"GRANT ALL ON `meta`.* TO `orchestrator`@`%`",
+	})
+	test.S(t).ExpectTrue(granted.hasPrivilege("PROCESS", globalPrivilegesObject))
+	test.S(t).ExpectTrue(granted.hasPrivilege("REPLICATION SLAVE", globalPrivilegesObject))
+	test.S(t).ExpectFalse(granted.hasPrivilege("SELECT", "mysql.slave_master_info"))
+	test.S(t).ExpectTrue(granted.hasPrivilege("INSERT", "mysql.slave_master_info"))
+	test.S(t).ExpectTrue(granted.hasPrivilege("UPDATE", "meta.heartbeat"))
+	test.S(t).ExpectFalse(granted.hasPrivilege("UPDATE", "other.heartbeat"))
+	test.S(t).ExpectEquals(strings.Join(splitGrantPrivileges("SELECT (a, b), INSERT (c),UPDATE"), "|"), "SELECT (a, b)| INSERT (c)|UPDATE")
+}
+
+func TestCheckStatementPrivileges(t *testing.T) {
+	granted := parseGrants([]string{
+		"GRANT PROCESS, RELOAD, REPLICATION SLAVE, REPLICATION CLIENT ON *.* TO `orchestrator`@`%`",
+		"GRANT REPLICATION_SLAVE_ADMIN,SYSTEM_VARIABLES_ADMIN ON *.* TO `orchestrator`@`%`",
+	})
+	test.S(t).ExpectNil(checkStatementPrivileges(&key1, "8.0.21", "orchestrator@%", granted, "stop slave"))
+	test.S(t).ExpectNil(checkStatementPrivileges(&key1, "8.0.21", "orchestrator@%", granted, "set global read_only = 1"))
+	test.S(t).ExpectNil(checkStatementPrivileges(&key1, "8.0.21", "orchestrator@%", granted, "flush binary logs"))
+	test.S(t).ExpectNil(checkStatementPrivileges(&key1, "5.7.8-log", "orchestrator@%", granted, "kill 17"))
+	test.S(t).ExpectNil(checkStatementPrivileges(&key1, "10.3.8-MariaDB-log", "orchestrator@%", granted, "kill 17"))
+
+	err := checkStatementPrivileges(&key1, "8.0.21", "orchestrator@%", granted, "kill 17")
+	test.S(t).ExpectNotNil(err)
+	test.S(t).ExpectTrue(strings.Contains(err.Error(), "refusing to run KILL"))
+	test.S(t).ExpectTrue(strings.Contains(err.Error(), "GRANT CONNECTION_ADMIN ON *.* TO 'orchestrator'@'%';"))
+
+	err = checkStatementPrivileges(&key1, "8.0.21", "orchestrator@%", granted, "purge binary logs to 'mysql-bin.000012'")
+	test.S(t).ExpectNotNil(err)
+	test.S(t).ExpectTrue(strings.Contains(err.Error(), "BINLOG_ADMIN or SUPER"))
+
+	granted = parseGrants([]string{"GRANT SUPER ON *.* TO `orchestrator`@`%`"})
+	test.S(t).ExpectNil(checkStatementPrivileges(&key1, "8.0.21", "orchestrator@%", granted, "kill 17"))
+}
+
+func TestGetReplicationCorruption(t *testing.T) {
+	test.S(t).ExpectEquals(GetReplicationCorruption(0, 0, ""), NoReplicationCorruption)
+	test.S(t).ExpectEquals(GetReplicationCorruption(0, 1594, ""), RelayLogCorruption)
+	test.S(t).ExpectEquals(GetReplicationCorruption(1595, 0, ""), RelayLogCorruption)
+	test.S(t).ExpectEquals(GetReplicationCorruption(1743, 0, ""), RelayLogCorruption)
+	test.S(t).ExpectEquals(GetReplicationCorruption(0, 1062, ""), NoReplicationCorruption)
+	test.S(t).ExpectEquals(GetReplicationCorruption(1236, 0, "Got fatal error 1236 from master when reading data from binary log: 'binlog truncated in the middle of event; consider out of disk space on master'"), BinlogCorruption)
+	test.S(t).ExpectEquals(GetReplicationCorruption(13114, 0, "Got fatal error 1236 from master when reading data from binary log: 'event read from binlog did not pass crc check'"), BinlogCorruption)
+	test.S(t).ExpectEquals(GetReplicationCorruption(1236, 0, "Got fatal error 1236 from master when reading data from binary log: 'Could not find first log file name in binary log index file'"), NoReplicationCorruption)
+	test.S(t).ExpectEquals(GetReplicationCorruption(1236, 0, "Got fatal error 1236 from master when reading data from binary log: 'Binary log is not open; the first event 'mysql-bin.000012' at 4, the last event read from './mysql-bin.000012' at 126, the last byte read from './mysql-bin.000012' at 4. Event checksum failure'"), BinlogCorruption)
+}
+
+func TestIsLagThresholdCrossed(t *testing.T) {
+	threshold := int64(config.Config.ReasonableReplicationLagSeconds)
+	lagging := func(lagSeconds int64) *Instance {
+		return &Instance{Key: key1, SlaveLagSeconds: sql.NullInt64{Int64: lagSeconds, Valid: true}}
+	}
+	{
+		crossed, _ := IsLagThresholdCrossed(lagging(0), lagging(threshold))
+		test.S(t).ExpectFalse(crossed)
+	}
+	{
+		crossed, aboveThreshold := IsLagThresholdCrossed(lagging(threshold), lagging(threshold+1))
+		test.S(t).ExpectTrue(crossed)
+		test.S(t).ExpectTrue(aboveThreshold)
+	}
+	{
+		crossed, aboveThreshold := IsLagThresholdCrossed(lagging(threshold+100), lagging(1))
+		test.S(t).ExpectTrue(crossed)
+		test.S(t).ExpectFalse(aboveThreshold)
+	}
+	{
+		crossed, _ := IsLagThresholdCrossed(lagging(threshold+100), &Instance{Key: key1})
+		test.S(t).ExpectFalse(crossed)
+	}
+	{
+		crossed, _ := IsLagThresholdCrossed(nil, lagging(threshold+100))
+		test.S(t).ExpectFalse(crossed)
+	}
+}
+
+func TestGetStateEventSeverity(t *testing.T) {
+	test.S(t).ExpectEquals(GetStateEventSeverity(InstanceDiscoveredEvent, nil), InfoSeverity)
+	test.S(t).ExpectEquals(GetStateEventSeverity(AnalysisRaisedEvent, nil), CriticalSeverity)
+	test.S(t).ExpectEquals(GetStateEventSeverity(LagThresholdCrossedEvent, map[string]interface{}{"aboveThreshold": true}), WarningSeverity)
+	test.S(t).ExpectEquals(GetStateEventSeverity(LagThresholdCrossedEvent, map[string]interface{}{"aboveThreshold": false}), InfoSeverity)
+	test.S(t).ExpectEquals(GetStateEventSeverity(RecoveryResolvedEvent, map[string]interface{}{"isSuccessful": true}), WarningSeverity)
+	test.S(t).ExpectEquals(GetStateEventSeverity(RecoveryResolvedEvent, map[string]interface{}{}), CriticalSeverity)
+
+	test.S(t).ExpectTrue(CriticalSeverity.AtLeast(WarningSeverity))
+	test.S(t).ExpectFalse(InfoSeverity.AtLeast(WarningSeverity))
+	test.S(t).ExpectTrue(InfoSeverity.AtLeast(StateEventSeverity("")))
+	_, err := ParseStateEventSeverity("urgent")
+	test.S(t).ExpectNotNil(err)
+}
+
+func TestStateEventSubscriptionMatches(t *testing.T) {
+	event := func(clusterName string, eventType StateEventType, severity StateEventSeverity) *StateEvent {
+		return &StateEvent{ClusterName: clusterName, EventType: eventType, Severity: severity}
+	}
+	{
+		subscription, err := NewStateEventSubscription("all", "all-events", "", "", "", "")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectTrue(subscription.Matches(event("db-1:3306", InstanceDiscoveredEvent, InfoSeverity)))
+	}
+	{
+		subscription, err := NewStateEventSubscription("payments", "payments-events", "^payments-", "analysis-raised, recovery-resolved", "warning", "")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(len(subscription.EventTypes), 2)
+		test.S(t).ExpectTrue(subscription.Matches(event("payments-1:3306", AnalysisRaisedEvent, CriticalSeverity)))
+		test.S(t).ExpectFalse(subscription.Matches(event("orders-1:3306", AnalysisRaisedEvent, CriticalSeverity)))
+		test.S(t).ExpectFalse(subscription.Matches(event("payments-1:3306", AnalysisClearedEvent, InfoSeverity)))
+		test.S(t).ExpectFalse(subscription.Matches(event("payments-1:3306", RecoveryResolvedEvent, InfoSeverity)))
+	}
+	{
+		_, err := NewStateEventSubscription("bad", "bad-events", "", "analysis-raised,no-such-event", "", "")
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		_, err := NewStateEventSubscription("bad", "bad-events", "(", "", "", "")
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		_, err := NewStateEventSubscription("bad", "", "", "", "", "")
+		test.S(t).ExpectNotNil(err)
+	}
+}
+
+func TestIsSemiSyncAsyncFallback(t *testing.T) {
+	test.S(t).ExpectEquals(normalizeSemiSyncVariableName("Rpl_semi_sync_source_status"), "rpl_semi_sync_master_status")
+	test.S(t).ExpectEquals(normalizeSemiSyncVariableName("rpl_semi_sync_source_wait_for_replica_count"), "rpl_semi_sync_master_wait_for_slave_count")
+
+	master := func(configured bool, enabled bool) *Instance {
+		return &Instance{Key: key1, IsLastCheckValid: true, SemiSyncMasterConfigured: configured, SemiSyncMasterEnabled: enabled}
+	}
+	test.S(t).ExpectFalse(master(true, true).IsSemiSyncAsyncFallback())
+	test.S(t).ExpectFalse(master(false, false).IsSemiSyncAsyncFallback())
+	test.S(t).ExpectTrue(master(true, false).IsSemiSyncAsyncFallback())
+	{
+		replica := master(true, false)
+		replica.MasterKey = key2
+		replica.ReadBinlogCoordinates = BinlogCoordinates{LogFile: "mysql-bin.000001", LogPos: 4}
+		test.S(t).ExpectFalse(replica.IsSemiSyncAsyncFallback())
+	}
+	{
+		changed, fallenBack := IsSemiSyncAsyncFallbackChanged(master(true, true), master(true, false))
+		test.S(t).ExpectTrue(changed)
+		test.S(t).ExpectTrue(fallenBack)
+	}
+	{
+		changed, fallenBack := IsSemiSyncAsyncFallbackChanged(master(true, false), master(true, true))
+		test.S(t).ExpectTrue(changed)
+		test.S(t).ExpectFalse(fallenBack)
+	}
+	{
+		changed, _ := IsSemiSyncAsyncFallbackChanged(master(true, false), master(true, false))
+		test.S(t).ExpectFalse(changed)
+	}
+	{
+		changed, _ := IsSemiSyncAsyncFallbackChanged(nil, master(true, false))
+		test.S(t).ExpectFalse(changed)
+	}
+}
+
+func TestSupportsSQLDelay(t *testing.T) {
+	test.S(t).ExpectFalse((&Instance{Version: "5.5.40-log"}).SupportsSQLDelay())
+	test.S(t).ExpectTrue((&Instance{Version: "5.6.31-log"}).SupportsSQLDelay())
+	test.S(t).ExpectTrue((&Instance{Version: "8.0.11"}).SupportsSQLDelay())
+	test.S(t).ExpectFalse((&Instance{Version: "10.1.26-MariaDB"}).SupportsSQLDelay())
+	test.S(t).ExpectTrue((&Instance{Version: "10.2.8-MariaDB-log"}).SupportsSQLDelay())
+}
+
+func TestResolveHostnameSeeds(t *testing.T) {
+	hostnameResolveSeedsCache.Set("seeded-host", "resolved-host", 0)
+	defer hostnameResolveSeedsCache.Delete("seeded-host")
+
+	statsBefore := ReadHostnameResolveCacheStats()
+	resolvedHostname, err := ResolveHostname("seeded-host")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(resolvedHostname, "resolved-host")
+
+	resolvedHostname, err = ResolveHostname("unseeded-host")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(resolvedHostname, "unseeded-host")
+
+	stats := ReadHostnameResolveCacheStats()
+	test.S(t).ExpectEquals(stats.CountSeeds, statsBefore.CountSeeds)
+	test.S(t).ExpectEquals(stats.Hits, statsBefore.Hits+1)
+	test.S(t).ExpectEquals(stats.Misses, statsBefore.Misses+1)
+}
+
+func TestRewriteHostname(t *testing.T) {
+	config.Config.HostnameRewriteRules = []config.HostnameRewriteRule{
+		{Pattern: `^(db[0-9]+)\.internal\.example\.com$`, Replacement: "$1.example.com"},
+		{Pattern: `^db`, Replacement: "never-applied"},
+	}
+	defer func() { config.Config.HostnameRewriteRules = nil }()
+
+	test.S(t).ExpectEquals(rewriteHostname("db1.internal.example.com"), "db1.example.com")
+	test.S(t).ExpectEquals(rewriteHostname("db2"), "never-applied2")
+	test.S(t).ExpectEquals(rewriteHostname("other.example.com"), "other.example.com")
+}
+
+func TestNormalizeInstanceKey(t *testing.T) {
+	config.Config.InstanceKeyNormalizationRules = []config.InstanceKeyNormalizationRule{
+		{CIDR: "10.0.0.0/16", Replacement: "ip-{ipDashed}.public.example.com"},
+		{CIDR: "10.1.0.0/16", Port: 3307, ReplacementPort: 3306},
+		{HostnamePattern: `^(db[0-9]+)\.internal$`, Replacement: "$1.example.com"},
+		{HostnamePattern: `^db`, Replacement: "never-applied"},
+	}
+	defer func() { config.Config.InstanceKeyNormalizationRules = nil }()
+
+	test.S(t).ExpectEquals(NormalizeInstanceKey(InstanceKey{Hostname: "10.0.1.5", Port: 3306}), InstanceKey{Hostname: "ip-10-0-1-5.public.example.com", Port: 3306})
+	test.S(t).ExpectEquals(NormalizeInstanceKey(InstanceKey{Hostname: "10.1.1.5", Port: 3307}), InstanceKey{Hostname: "10.1.1.5", Port: 3306})
+	test.S(t).ExpectEquals(NormalizeInstanceKey(InstanceKey{Hostname: "10.1.1.5", Port: 3306}), InstanceKey{Hostname: "10.1.1.5", Port: 3306})
+	test.S(t).ExpectEquals(NormalizeInstanceKey(InstanceKey{Hostname: "10.2.1.5", Port: 3306}), InstanceKey{Hostname: "10.2.1.5", Port: 3306})
+	test.S(t).ExpectEquals(NormalizeInstanceKey(InstanceKey{Hostname: "db1.internal", Port: 3306}), InstanceKey{Hostname: "db1.example.com", Port: 3306})
+	test.S(t).ExpectEquals(NormalizeInstanceKey(InstanceKey{Hostname: "ip-10-0-1-5.public.example.com", Port: 3306}), InstanceKey{Hostname: "ip-10-0-1-5.public.example.com", Port: 3306})
+	test.S(t).ExpectEquals(NormalizeInstanceKey(InstanceKey{Hostname: "//10.0.1.5", Port: 3306}), InstanceKey{Hostname: "//10.0.1.5", Port: 3306})
+
+	RegisterInstanceKeyNormalizer("test-normalizer", func(instanceKey InstanceKey) (InstanceKey, bool) {
+		return InstanceKey{Hostname: strings.ToLower(instanceKey.Hostname), Port: instanceKey.Port}, true
+	})
+	config.Config.InstanceKeyNormalizer = "test-normalizer"
+	defer func() { config.Config.InstanceKeyNormalizer = "" }()
+	test.S(t).ExpectEquals(NormalizeInstanceKey(InstanceKey{Hostname: "DB1.internal", Port: 3306}), InstanceKey{Hostname: "db1.internal", Port: 3306})
+	test.S(t).ExpectEquals(NormalizeInstanceKey(InstanceKey{Hostname: "db1.internal", Port: 3306}), InstanceKey{Hostname: "db1.example.com", Port: 3306})
+}
+
+func TestNewDiscoveredReplicaKey(t *testing.T) {
+	config.Config.InstanceKeyNormalizationRules = []config.InstanceKeyNormalizationRule{
+		{CIDR: "10.0.0.0/16", Replacement: "ip-{ipDashed}.public.example.com"},
+		{CIDR: "10.1.0.0/16", Port: 3307, ReplacementPort: 3306},
+	}
+	defer func() { config.Config.InstanceKeyNormalizationRules = nil }()
+
+	replicaKey, err := newDiscoveredReplicaKey("10.0.1.5", 3306)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(*replicaKey, InstanceKey{Hostname: "ip-10-0-1-5.public.example.com", Port: 3306})
+
+	replicaKey, err = newDiscoveredReplicaKey("10.1.1.5", 3307)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(*replicaKey, InstanceKey{Hostname: "10.1.1.5", Port: 3306})
+
+	replicaKey, err = newDiscoveredReplicaKey("10.2.1.5", 3306)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(*replicaKey, InstanceKey{Hostname: "10.2.1.5", Port: 3306})
+
+	_, err = newDiscoveredReplicaKey("", 3306)
+	test.S(t).ExpectNotNil(err)
+}
+
+func TestParseHostsFile(t *testing.T) {
+	resolves := parseHostsFile(`
+# comment
+10.0.0.1   db1.example.com db1 db1-vip # trailing comment
+10.0.0.2   db2.example.com
+invalid-line
+`)
+	test.S(t).ExpectEquals(len(resolves), 4)
+	test.S(t).ExpectEquals(resolves["10.0.0.1"], "db1.example.com")
+	test.S(t).ExpectEquals(resolves["db1"], "db1.example.com")
+	test.S(t).ExpectEquals(resolves["db1-vip"], "db1.example.com")
+	test.S(t).ExpectEquals(resolves["10.0.0.2"], "db2.example.com")
+	_, found := resolves["db2.example.com"]
+	test.S(t).ExpectFalse(found)
+}
+
+func TestResolveHostnameHostsFileChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+	config.Config.HostnameResolveHostsFile = path
+	defer func() { config.Config.HostnameResolveHostsFile = "" }()
+
+	modTime := time.Now()
+	writeHostsFile := func(content string) {
+		test.S(t).ExpectNil(ioutil.WriteFile(path, []byte(content), 0644))
+		modTime = modTime.Add(time.Second)
+		test.S(t).ExpectNil(os.Chtimes(path, modTime, modTime))
+	}
+	expireHostsFileCheck := func() {
+		hostsFile.Lock()
+		defer hostsFile.Unlock()
+		hostsFile.checkedAt = time.Time{}
+	}
+	expectResolved := func(hostname string, expected string) {
+		resolvedHostname, err := ResolveHostname(hostname)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(resolvedHostname, expected)
+	}
+
+	writeHostsFile("10.0.0.1 db1.example.com hosts-file-db")
+	expectResolved("hosts-file-db", "db1.example.com")
+	expectResolved("hosts-file-db", "db1.example.com")
+
+	// Changes apply at once, regardless of earlier resolves
+	writeHostsFile("10.0.0.2 db2.example.com hosts-file-db")
+	expireHostsFileCheck()
+	expectResolved("hosts-file-db", "db2.example.com")
+
+	// The file is checked for changes once per hostsFileCheckInterval
+	writeHostsFile("10.0.0.3 db3.example.com hosts-file-db")
+	expectResolved("hosts-file-db", "db2.example.com")
+	expireHostsFileCheck()
+	expectResolved("hosts-file-db", "db3.example.com")
+
+	writeHostsFile("10.0.0.3 db3.example.com")
+	expireHostsFileCheck()
+	expectResolved("hosts-file-db", "hosts-file-db")
+}
+
+func TestIsDiscoveryShed(t *testing.T) {
+	defer SetDiscoveryShedKeys(make(map[InstanceKey]string))
+	SetDiscoveryShedKeys(map[InstanceKey]string{key1: "batch", key2: "batch"})
+
+	leafReplica := &Instance{Key: key1, MasterKey: key3, SlaveHosts: make(InstanceKeyMap)}
+	test.S(t).ExpectTrue(IsDiscoveryShed(leafReplica))
+
+	intermediateMaster := &Instance{Key: key2, MasterKey: key3, SlaveHosts: make(InstanceKeyMap)}
+	intermediateMaster.SlaveHosts.AddKey(key1)
+	test.S(t).ExpectFalse(IsDiscoveryShed(intermediateMaster))
+
+	master := &Instance{Key: key1, SlaveHosts: make(InstanceKeyMap)}
+	test.S(t).ExpectFalse(IsDiscoveryShed(master))
+
+	notShed := &Instance{Key: key3, MasterKey: key1, SlaveHosts: make(InstanceKeyMap)}
+	test.S(t).ExpectFalse(IsDiscoveryShed(notShed))
+}
+
+func TestIsDiscoveryShedPollDue(t *testing.T) {
+	instance := &Instance{Key: key1, MasterKey: key3, IsLastCheckValid: true}
+	instance.SecondsSinceLastSeen.Valid = true
+
+	instance.SecondsSinceLastSeen.Int64 = int64(config.Config.DiscoverySheddingPollSeconds) - 1
+	test.S(t).ExpectFalse(IsDiscoveryShedPollDue(instance))
+
+	instance.SecondsSinceLastSeen.Int64 = int64(config.Config.DiscoverySheddingPollSeconds)
+	test.S(t).ExpectTrue(IsDiscoveryShedPollDue(instance))
+
+	instance.SecondsSinceLastSeen.Int64 = 0
+	instance.IsLastCheckValid = false
+	test.S(t).ExpectTrue(IsDiscoveryShedPollDue(instance))
+
+	instance.IsLastCheckValid = true
+	instance.SecondsSinceLastSeen.Valid = false
+	test.S(t).ExpectTrue(IsDiscoveryShedPollDue(instance))
+}
+
+func TestIsLightweightProbeEligible(t *testing.T) {
+	config.Config.LightweightProbes = true
+	defer func() { config.Config.LightweightProbes = false }()
+
+	newReplica := func() *Instance {
+		return &Instance{
+			Key:                   key1,
+			MasterKey:             key2,
+			Version:               "8.0.32",
+			IsLastCheckValid:      true,
+			Slave_IO_Running:      true,
+			Slave_SQL_Running:     true,
+			UsingOracleGTID:       true,
+			ReadBinlogCoordinates: BinlogCoordinates{LogFile: "mysql-bin.000001", LogPos: 4},
+			SlaveHosts:            make(InstanceKeyMap),
+		}
+	}
+	replica := newReplica()
+	test.S(t).ExpectFalse(IsLightweightProbeEligible(replica))
+
+	registerFullProbe(&replica.Key)
+	defer recentFullProbes.Flush()
+	test.S(t).ExpectTrue(IsLightweightProbeEligible(replica))
+	{
+		replica := newReplica()
+		replica.Version = "5.7.40"
+		test.S(t).ExpectFalse(IsLightweightProbeEligible(replica))
+	}
+	{
+		replica := newReplica()
+		replica.Slave_SQL_Running = false
+		test.S(t).ExpectFalse(IsLightweightProbeEligible(replica))
+	}
+	{
+		replica := newReplica()
+		replica.UsingOracleGTID = false
+		test.S(t).ExpectFalse(IsLightweightProbeEligible(replica))
+	}
+	{
+		replica := newReplica()
+		replica.SlaveHosts.AddKey(key3)
+		test.S(t).ExpectFalse(IsLightweightProbeEligible(replica))
+	}
+}
+
+func TestIsLightweightProbeEligibleFullProbeSeconds(t *testing.T) {
+	config.Config.LightweightProbes = true
+	config.Config.LightweightProbesFullProbeSeconds = 1
+	defer func() {
+		config.Config.LightweightProbes = false
+		config.Config.LightweightProbesFullProbeSeconds = 0
+	}()
+
+	replica := &Instance{
+		Key:               key1,
+		MasterKey:         key2,
+		Version:           "8.0.32",
+		IsLastCheckValid:  true,
+		Slave_IO_Running:  true,
+		Slave_SQL_Running: true,
+		UsingOracleGTID:   true,
+		SlaveHosts:        make(InstanceKeyMap),
+	}
+	registerFullProbe(&replica.Key)
+	defer recentFullProbes.Flush()
+	test.S(t).ExpectTrue(IsLightweightProbeEligible(replica))
+
+	// Data carried over from the full probe is no older than LightweightProbesFullProbeSeconds
+	time.Sleep(1100 * time.Millisecond)
+	test.S(t).ExpectFalse(IsLightweightProbeEligible(replica))
+}
+
+func TestEstimateDataLoss(t *testing.T) {
+	failedMaster := &Instance{
+		Key:                   key1,
+		ExecutedGtidSet:       "230ea8ea-81e3-11e4-972a-e25ec4bd140a:1-100",
+		SelfBinlogCoordinates: BinlogCoordinates{LogFile: "mysql-bin.000010", LogPos: 5000},
+	}
+	promotedBefore := &Instance{
+		Key:                   key2,
+		MasterKey:             key1,
+		ReadBinlogCoordinates: BinlogCoordinates{LogFile: "mysql-bin.000010", LogPos: 3000},
+	}
+	promotedAfter := &Instance{
+		Key:             key2,
+		ExecutedGtidSet: "230ea8ea-81e3-11e4-972a-e25ec4bd140a:1-90",
+	}
+	{
+		report := EstimateDataLoss(failedMaster, promotedBefore, promotedAfter, [](*Instance){})
+		test.S(t).ExpectTrue(report.IsDataLossEstimated)
+		test.S(t).ExpectEquals(len(report.Spans), 1)
+		span := report.Spans[0]
+		test.S(t).ExpectEquals(span.Role, DataLossFailedMaster)
+		test.S(t).ExpectEquals(span.LostGtidSet, "230ea8ea-81e3-11e4-972a-e25ec4bd140a:91-100")
+		test.S(t).ExpectEquals(span.CountLostTransactions, int64(10))
+		test.S(t).ExpectEquals(span.SpanBytes, int64(2000))
+		test.S(t).ExpectEquals(span.CountBinaryLogs, 1)
+	}
+	{
+		lostReplica := &Instance{
+			Key:                   key3,
+			MasterKey:             key1,
+			ExecutedGtidSet:       "230ea8ea-81e3-11e4-972a-e25ec4bd140a:1-80",
+			ExecBinlogCoordinates: BinlogCoordinates{LogFile: "mysql-bin.000009", LogPos: 800},
+		}
+		caughtUpMaster := *failedMaster
+		caughtUpMaster.ExecutedGtidSet = promotedAfter.ExecutedGtidSet
+		caughtUpMaster.SelfBinlogCoordinates = promotedBefore.ReadBinlogCoordinates
+		report := EstimateDataLoss(&caughtUpMaster, promotedBefore, promotedAfter, [](*Instance){lostReplica})
+		test.S(t).ExpectFalse(report.IsDataLossEstimated)
+		test.S(t).ExpectEquals(len(report.Spans), 0)
+	}
+	{
+		report := EstimateDataLoss(failedMaster, promotedBefore, nil, [](*Instance){})
+		test.S(t).ExpectFalse(report.IsDataLossEstimated)
+		test.S(t).ExpectEquals(len(report.Notes), 1)
+	}
+	{
+		span := DataLossSpan{}
+		span.addAffectedTables([]BinlogEvent{
+			{EventType: "Table_map", Info: "table_id: 108 (shop.orders)"},
+			{EventType: "Write_rows", Info: "table_id: 108 flags: STMT_END_F"},
+			{EventType: "Table_map", Info: "table_id: 109 (shop.items)"},
+			{EventType: "Table_map", Info: "table_id: 110 (billing.invoices)"},
+		})
+		test.S(t).ExpectEquals(strings.Join(span.AffectedSchemas, ","), "billing,shop")
+		test.S(t).ExpectEquals(strings.Join(span.AffectedTables, ","), "billing.invoices,shop.items,shop.orders")
+	}
+}
+
+func TestGetProcesslistProblems(t *testing.T) {
+	longApplierTrxSeconds, masterActiveThreadsThreshold := config.Config.ProcesslistLongApplierTrxSeconds, config.Config.ProcesslistMasterActiveThreadsThreshold
+	defer func() {
+		config.Config.ProcesslistLongApplierTrxSeconds, config.Config.ProcesslistMasterActiveThreadsThreshold = longApplierTrxSeconds, masterActiveThreadsThreshold
+	}()
+	config.Config.ProcesslistLongApplierTrxSeconds = 300
+	config.Config.ProcesslistMasterActiveThreadsThreshold = 200
+	{
+		replica := &Instance{Key: key2, MasterKey: key1, UsingOracleGTID: true, LongestApplierTrxSeconds: 299, CountActiveThreads: 500}
+		test.S(t).ExpectEquals(len(replica.getProcesslistProblems()), 0)
+		replica.LongestApplierTrxSeconds = 300
+		problems := replica.getProcesslistProblems()
+		test.S(t).ExpectEquals(len(problems), 1)
+		test.S(t).ExpectEquals(problems[0], LongApplierTrxProblem)
+	}
+	{
+		master := &Instance{Key: key1, CountActiveThreads: 199}
+		test.S(t).ExpectEquals(len(master.getProcesslistProblems()), 0)
+		master.CountActiveThreads = 200
+		problems := master.getProcesslistProblems()
+		test.S(t).ExpectEquals(len(problems), 1)
+		test.S(t).ExpectEquals(problems[0], ExcessiveMasterThreadsProblem)
+	}
+	{
+		config.Config.ProcesslistMasterActiveThreadsThreshold = 0
+		master := &Instance{Key: key1, CountActiveThreads: 5000}
+		test.S(t).ExpectEquals(len(master.getProcesslistProblems()), 0)
+	}
+}
+
+func TestParseInstanceFlags(t *testing.T) {
+	{
+		flag, err := ParseInstanceFlag("never-promote")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(flag, NeverPromoteFlag)
+	}
+	{
+		_, err := ParseInstanceFlag("never-ever")
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		flags := parseInstanceFlags("")
+		test.S(t).ExpectEquals(len(flags), 0)
+	}
+	{
+		flags := parseInstanceFlags("skip-lag-checks,no-such-flag,never-promote")
+		test.S(t).ExpectEquals(len(flags), 2)
+		instance := &Instance{Key: key1, Flags: flags}
+		test.S(t).ExpectTrue(instance.HasFlag(SkipLagChecksFlag))
+		test.S(t).ExpectTrue(instance.HasFlag(NeverPromoteFlag))
+		test.S(t).ExpectFalse(instance.HasFlag(RelaxedPollingFlag))
+	}
+}
+
+func TestIsPollingRelaxed(t *testing.T) {
+	config.Config.InstanceFlagRelaxedPollSeconds = 60
+	instance := &Instance{Key: key1, IsLastCheckValid: true, SecondsSinceLastSeen: sql.NullInt64{Int64: 30, Valid: true}}
+	test.S(t).ExpectFalse(IsPollingRelaxed(instance))
+	instance.Flags = []InstanceFlag{RelaxedPollingFlag}
+	test.S(t).ExpectTrue(IsPollingRelaxed(instance))
+	instance.SecondsSinceLastSeen.Int64 = 60
+	test.S(t).ExpectFalse(IsPollingRelaxed(instance))
+	instance.SecondsSinceLastSeen.Int64 = 30
+	instance.IsLastCheckValid = false
+	test.S(t).ExpectFalse(IsPollingRelaxed(instance))
+}
+
+func TestReconcileReplicas(t *testing.T) {
+	master := &Instance{Key: key1, IsLastCheckValid: true, SlaveHosts: InstanceKeyMap{}}
+	master.SlaveHosts.AddKey(key2)
+	master.SlaveHosts.AddKey(key3)
+	master.SlaveHosts.AddKey(InstanceKey{Hostname: "host4", Port: 3306})
+	master.SlaveHosts.AddKey(InstanceKey{Hostname: "host5", Port: 3306})
+
+	replica2 := &Instance{Key: key2, MasterKey: key1, IsLastCheckValid: true}
+	replica3 := &Instance{Key: key3, MasterKey: InstanceKey{Hostname: "host9", Port: 3306}, IsLastCheckValid: true}
+	// Discovered via processlist with a guessed port; known on another port
+	replica5 := &Instance{Key: InstanceKey{Hostname: "host5", Port: 3307}, MasterKey: key1, IsLastCheckValid: true}
+	known := map[InstanceKey]*Instance{key2: replica2, key3: replica3, replica5.Key: replica5}
+	lookup := func(key *InstanceKey) *Instance { return known[*key] }
+
+	unreconciled := reconcileReplicas(master, [](*Instance){replica2, replica5}, lookup)
+	test.S(t).ExpectEquals(len(unreconciled), 2)
+	problems := make(map[InstanceKey]UnreconciledReplicaProblem)
+	for _, entry := range unreconciled {
+		problems[entry.Key] = entry.Problem
+	}
+	test.S(t).ExpectEquals(problems[key3], ReplicatingElsewhereProblem)
+	test.S(t).ExpectEquals(problems[InstanceKey{Hostname: "host4", Port: 3306}], UnregisteredReplicaProblem)
+
+	master.IsLastCheckValid = false
+	test.S(t).ExpectEquals(len(reconcileReplicas(master, [](*Instance){replica2, replica5}, lookup)), 0)
+}
+
+func TestValidateRunbookURL(t *testing.T) {
+	test.S(t).ExpectNil(ValidateRunbookURL(""))
+	test.S(t).ExpectNil(ValidateRunbookURL("https://wiki.example.com/runbooks/cluster-dns"))
+	test.S(t).ExpectNil(ValidateRunbookURL("http://wiki/runbook?id=7"))
+	test.S(t).ExpectNotNil(ValidateRunbookURL("wiki.example.com/runbooks"))
+	test.S(t).ExpectNotNil(ValidateRunbookURL("javascript:alert(1)"))
+	test.S(t).ExpectNotNil(ValidateRunbookURL("https://"))
+}
+
+func TestGroupingDimensions(t *testing.T) {
+	config.Config.GroupingDimensions = map[string]config.GroupingDimensionConfiguration{
+		"rack": {HostnamePattern: "-(r[0-9]+)-"},
+		"cell": {Query: "select cell from meta.cell"},
+	}
+	defer func() { config.Config.GroupingDimensions = make(map[string]config.GroupingDimensionConfiguration) }()
+
+	dimensions := readHostnameDimensions("db-r12-0001.dc1")
+	test.S(t).ExpectEquals(len(dimensions), 1)
+	test.S(t).ExpectEquals(dimensions["rack"], "r12")
+	test.S(t).ExpectEquals(len(readHostnameDimensions("db-0001.dc1")), 0)
+	// Patterns are compiled once
+	test.S(t).ExpectTrue(getGroupingDimensionRegexp("-(r[0-9]+)-") == getGroupingDimensionRegexp("-(r[0-9]+)-"))
+	test.S(t).ExpectTrue(getGroupingDimensionRegexp("-(r[0-9]+") == nil)
+
+	test.S(t).ExpectEquals(dimensionsToJSON(map[string]string{}), "")
+	test.S(t).ExpectEquals(dimensionsFromJSON(dimensionsToJSON(dimensions))["rack"], "r12")
+	test.S(t).ExpectEquals(len(dimensionsFromJSON("")), 0)
+
+	i710 := NewInstance()
+	i710.Key = key1
+	i710.Dimensions = map[string]string{"rack": "r12", "cell": "c1"}
+	i720 := NewInstance()
+	i720.Key = key2
+	i720.Dimensions = map[string]string{"rack": "r12", "cell": "c2"}
+	i730 := NewInstance()
+	i730.Key = key3
+	i730.Dimensions = map[string]string{"cell": "c1"}
+
+	test.S(t).ExpectTrue(reflect.DeepEqual(i710.SharedDimensions(i720, []string{"rack", "cell"}), []string{"rack"}))
+	test.S(t).ExpectEquals(len(i720.SharedDimensions(i730, []string{"rack", "cell"})), 0)
+
+	filtered := FilterInstancesByDimension([](*Instance){i710, i720, i730}, "cell", "c1")
+	test.S(t).ExpectEquals(len(filtered), 2)
+
+	groups := GroupInstancesByDimensions([](*Instance){i710, i720, i730})
+	test.S(t).ExpectEquals(len(groups), 4)
+	test.S(t).ExpectEquals(groups[0].Dimension, "cell")
+	test.S(t).ExpectEquals(groups[0].Value, "c1")
+	test.S(t).ExpectEquals(len(groups[0].InstanceKeys), 2)
+	test.S(t).ExpectEquals(groups[2].Dimension, "rack")
+	test.S(t).ExpectEquals(groups[2].Value, "")
+}
+
+func TestApplyProbeOutcomes(t *testing.T) {
+	now := time.Now()
+	instance := NewInstance()
+	instance.Key = key1
+	instance.ApplyProbeOutcomes([]InstanceProbeOutcome{
+		{Key: key1, OrchestratorNode: "orc3", IsReachable: true, ReportedAt: now.Add(-time.Minute)},
+		{Key: key1, OrchestratorNode: "orc1", IsReachable: true, ReportedAt: now},
+		{Key: key1, OrchestratorNode: "orc2", IsReachable: false, ReportedAt: now.Add(-2 * time.Minute)},
+	})
+	test.S(t).ExpectEquals(len(instance.ProbeOutcomes), 3)
+	test.S(t).ExpectEquals(instance.ProbeOutcomes[0].OrchestratorNode, "orc1")
+	test.S(t).ExpectEquals(instance.LastSeenBy, "orc1")
+	test.S(t).ExpectEquals(instance.LastFailedProbeBy, "orc2")
+	test.S(t).ExpectTrue(instance.IsPartiallyUnreachable)
+
+	instance.ApplyProbeOutcomes([]InstanceProbeOutcome{
+		{Key: key1, OrchestratorNode: "orc1", IsReachable: false, ReportedAt: now},
+		{Key: key1, OrchestratorNode: "orc2", IsReachable: false, ReportedAt: now},
+	})
+	test.S(t).ExpectEquals(instance.LastSeenBy, "")
+	test.S(t).ExpectEquals(instance.LastFailedProbeBy, "orc1")
+	test.S(t).ExpectFalse(instance.IsPartiallyUnreachable)
+}
+
+func TestErrorLogEvents(t *testing.T) {
+	config.Config.ErrorLogPatterns = map[string]config.ErrorLogPatternConfiguration{
+		"innodb-corruption": {Pattern: "InnoDB: Database page corruption", IsProblem: true},
+		"semisync-timeout":  {Pattern: "Timeout waiting for reply of binlog"},
+	}
+	defer func() { config.Config.ErrorLogPatterns = make(map[string]config.ErrorLogPatternConfiguration) }()
+
+	previousTail := []string{"line 1", "line 2", "line 3"}
+	test.S(t).ExpectTrue(reflect.DeepEqual(NewErrorLogLines(previousTail, []string{"line 2", "line 3", "line 4"}), []string{"line 4"}))
+	test.S(t).ExpectEquals(len(NewErrorLogLines(previousTail, []string{"line 1", "line 2", "line 3"})), 0)
+	test.S(t).ExpectEquals(len(NewErrorLogLines(previousTail, []string{"line 5", "line 6"})), 2)
+	test.S(t).ExpectEquals(len(NewErrorLogLines(nil, []string{"line 1"})), 1)
+
+	events := NewErrorLogEvents(&key1, []string{
+		"2019-05-01T10:00:00.000000Z 0 [ERROR] InnoDB: Database page corruption on disk or a failed file read of page [page id: space=31, page number=3]",
+		"2019-05-01T10:00:01.000000Z 0 [Note] Start binlog_dump to master_thread_id(7)",
+		"2019-05-01T10:00:02.000000Z 0 [Warning] Timeout waiting for reply of binlog (file: mysql-bin.000012, pos: 1234), semi-sync up to file , position 0.",
+		"",
+	})
+	test.S(t).ExpectEquals(len(events), 2)
+	test.S(t).ExpectEquals(events[0].PatternName, "innodb-corruption")
+	test.S(t).ExpectTrue(events[0].IsProblem)
+	test.S(t).ExpectTrue(events[0].Key.Equals(&key1))
+	test.S(t).ExpectEquals(events[1].PatternName, "semisync-timeout")
+	test.S(t).ExpectFalse(events[1].IsProblem)
+
+	config.Config.ErrorLogPatterns["invalid"] = config.ErrorLogPatternConfiguration{Pattern: "InnoDB: ("}
+	test.S(t).ExpectTrue(reflect.DeepEqual(MatchErrorLogLine("InnoDB: Database page corruption"), []string{"innodb-corruption"}))
+	test.S(t).ExpectTrue(getErrorLogPatternRegexp("InnoDB: (") == nil)
+	test.S(t).ExpectTrue(getErrorLogPatternRegexp("InnoDB: Database page corruption") == getErrorLogPatternRegexp("InnoDB: Database page corruption"))
+}
+
+func TestPredictLagConvergence(t *testing.T) {
+	now := time.Now()
+	samples := func(lags ...int64) []LagHistorySample {
+		history := []LagHistorySample{}
+		for i, lag := range lags {
+			history = append(history, LagHistorySample{Timestamp: now.Add(time.Duration(i-len(lags)+1) * 10 * time.Second), LagSeconds: lag})
+		}
+		return history
+	}
+	{
+		prediction := PredictLagConvergence(&key1, samples(), 20, now)
+		test.S(t).ExpectFalse(prediction.IsCaughtUp)
+		test.S(t).ExpectFalse(prediction.IsConverging)
+		test.S(t).ExpectEquals(prediction.SecondsToCatchUp, float64(-1))
+	}
+	{
+		prediction := PredictLagConvergence(&key1, samples(100, 15), 20, now)
+		test.S(t).ExpectTrue(prediction.IsCaughtUp)
+		test.S(t).ExpectEquals(prediction.SecondsToCatchUp, float64(0))
+	}
+	{
+		prediction := PredictLagConvergence(&key1, samples(100, 90, 80, 70), 20, now)
+		test.S(t).ExpectFalse(prediction.IsCaughtUp)
+		test.S(t).ExpectTrue(prediction.IsConfident)
+		test.S(t).ExpectTrue(prediction.IsConverging)
+		test.S(t).ExpectEquals(prediction.CatchUpRate, float64(1))
+		test.S(t).ExpectEquals(prediction.SecondsToCatchUp, float64(50))
+		test.S(t).ExpectTrue(prediction.PredictedTime.Equal(now.Add(50 * time.Second)))
+	}
+	{
+		prediction := PredictLagConvergence(&key1, samples(70, 80), 20, now)
+		test.S(t).ExpectFalse(prediction.IsConfident)
+		test.S(t).ExpectFalse(prediction.IsConverging)
+		test.S(t).ExpectTrue(prediction.CatchUpRate < 0)
+		test.S(t).ExpectTrue(prediction.PredictedTime == nil)
+	}
+	{
+		prediction := PredictLagConvergence(&key1, samples(60, 60, 60, 60), 20, now)
+		test.S(t).ExpectTrue(prediction.IsConfident)
+		test.S(t).ExpectFalse(prediction.IsConverging)
+	}
+}
@@ -20,10 +20,12 @@ import (
 	"fmt"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/github/orchestrator/go/attributes"
 	"github.com/github/orchestrator/go/config"
 	"github.com/openark/golib/log"
 	"github.com/openark/golib/math"
@@ -82,7 +84,7 @@ func ASCIITopology(clusterName string, historyTimestampPattern string, tabulated
 	fillerCharacter := asciiFillerCharacter
 	var instances [](*Instance)
 	if historyTimestampPattern == "" {
-		instances, err = ReadClusterInstances(clusterName)
+		instances, err = ReadCachedClusterInstances(clusterName)
 	} else {
 		instances, err = ReadHistoryClusterInstances(clusterName, historyTimestampPattern)
 	}
@@ -347,7 +349,7 @@ func MoveUpReplicas(instanceKey *InstanceKey, pattern string) ([](*Instance), *I
 	if err != nil {
 		return res, instance, err, errs
 	}
-	replicas = filterInstancesByPattern(replicas, pattern)
+	replicas = FilterInstancesByPattern(replicas, pattern)
 	if len(replicas) == 0 {
 		return res, instance, nil, errs
 	}
@@ -670,7 +672,7 @@ func MoveReplicasGTID(masterKey *InstanceKey, belowKey *InstanceKey, pattern str
 	if err != nil {
 		return movedReplicas, unmovedReplicas, err, errs
 	}
-	replicas = filterInstancesByPattern(replicas, pattern)
+	replicas = FilterInstancesByPattern(replicas, pattern)
 	movedReplicas, unmovedReplicas, err, errs = moveReplicasViaGTID(replicas, belowInstance)
 	if err != nil {
 		log.Errore(err)
@@ -824,7 +826,7 @@ func RepointReplicasTo(instanceKey *InstanceKey, pattern string, belowKey *Insta
 		return res, err, errs
 	}
 	replicas = RemoveInstance(replicas, belowKey)
-	replicas = filterInstancesByPattern(replicas, pattern)
+	replicas = FilterInstancesByPattern(replicas, pattern)
 	if len(replicas) == 0 {
 		// Nothing to do
 		return res, nil, errs
@@ -954,6 +956,41 @@ Cleanup:
 	return instance, err
 }
 
+// BreakCoMaster breaks circular replication (a co-master pair or a replication ring) on its active member:
+// the writable co-master stops replicating from its own master, and remains the single master of the topology,
+// with the other members replicating downstream of it. Replication on the active co-master is detached rather
+// than reset, such that the circle can be re-established with reattach-replica-master-host or make-co-master.
+func BreakCoMaster(instanceKey *InstanceKey) (*Instance, error) {
+	instance, err := ReadTopologyInstance(instanceKey)
+	if err != nil {
+		return instance, err
+	}
+	if !instance.IsCoMaster {
+		return instance, fmt.Errorf("%+v is not a co-master", *instanceKey)
+	}
+	if instance.ReadOnly {
+		return instance, fmt.Errorf("%+v is read-only. Circular replication is broken on the active (writable) co-master", *instanceKey)
+	}
+	circularReplication, err := ReadInstanceCircularReplication(instance)
+	if err != nil {
+		return instance, err
+	}
+	if circularReplication == nil {
+		return instance, fmt.Errorf("Cannot find the replication circle of %+v", *instanceKey)
+	}
+	if circularReplication.HasMultipleWritableMembers() {
+		return instance, fmt.Errorf("%+v are all writable; cowardly refusing to break circular replication. Please set all but the active co-master as read-only beforehand", circularReplication.WritableMembers)
+	}
+	log.Infof("Will break circular replication %+v on %+v", circularReplication.Members, *instanceKey)
+
+	instance, err = DetachReplicaMasterHost(instanceKey)
+	if err != nil {
+		return instance, err
+	}
+	AuditOperation("break-co-master", instanceKey, fmt.Sprintf("circular replication %+v broken; %+v is single master", circularReplication.Members, *instanceKey))
+	return instance, nil
+}
+
 // ResetSlaveOperation will reset a replica
 func ResetSlaveOperation(instanceKey *InstanceKey) (*Instance, error) {
 	instance, err := ReadTopologyInstance(instanceKey)
@@ -1692,7 +1729,15 @@ Cleanup:
 
 // sortInstances shuffles given list of instances according to some logic
 func sortInstancesDataCenterHint(instances [](*Instance), dataCenterHint string) {
-	sort.Sort(sort.Reverse(NewInstancesSorterByExec(instances, dataCenterHint)))
+	sortInstancesForPromotion(instances, dataCenterHint, nil)
+}
+
+// sortInstancesForPromotion sorts given instances, most up-to-date first, and among equally up-to-date instances,
+// by preference for promotion, which takes data center and pool membership into account
+func sortInstancesForPromotion(instances [](*Instance), dataCenterHint string, poolPreferences PromotionPoolPreferences) {
+	sorter := NewInstancesSorterByExec(instances, dataCenterHint)
+	sorter.poolPreferences = poolPreferences
+	sort.Sort(sort.Reverse(sorter))
 }
 
 // sortInstances shuffles given list of instances according to some logic
@@ -1711,21 +1756,21 @@ func getReplicasForSorting(masterKey *InstanceKey, includeBinlogServerSubReplica
 }
 
 func sortedReplicas(replicas [](*Instance), stopReplicationMethod StopReplicationMethod) [](*Instance) {
-	return sortedReplicasDataCenterHint(replicas, stopReplicationMethod, "")
+	return sortedReplicasDataCenterHint(replicas, stopReplicationMethod, "", nil)
 }
 
 // sortedReplicas returns the list of replicas of some master, sorted by exec coordinates
 // (most up-to-date replica first).
 // This function assumes given `replicas` argument is indeed a list of instances all replicating
 // from the same master (the result of `getReplicasForSorting()` is appropriate)
-func sortedReplicasDataCenterHint(replicas [](*Instance), stopReplicationMethod StopReplicationMethod, dataCenterHint string) [](*Instance) {
+func sortedReplicasDataCenterHint(replicas [](*Instance), stopReplicationMethod StopReplicationMethod, dataCenterHint string, poolPreferences PromotionPoolPreferences) [](*Instance) {
 	if len(replicas) == 0 {
 		return replicas
 	}
 	replicas = StopSlaves(replicas, stopReplicationMethod, time.Duration(config.Config.InstanceBulkOperationsWaitTimeoutSeconds)*time.Second)
 	replicas = RemoveNilInstances(replicas)
 
-	sortInstancesDataCenterHint(replicas, dataCenterHint)
+	sortInstancesForPromotion(replicas, dataCenterHint, poolPreferences)
 	for _, replica := range replicas {
 		log.Debugf("- sorted replica: %+v %+v", replica.Key, replica.ExecBinlogCoordinates)
 	}
@@ -1860,7 +1905,7 @@ func MultiMatchReplicas(masterKey *InstanceKey, belowKey *InstanceKey, pattern s
 	if err != nil {
 		return res, belowInstance, err, errs
 	}
-	replicas = filterInstancesByPattern(replicas, pattern)
+	replicas = FilterInstancesByPattern(replicas, pattern)
 	matchedReplicas, belowInstance, err, errs := MultiMatchBelow(replicas, &belowInstance.Key, nil)
 
 	if len(matchedReplicas) != len(replicas) {
@@ -1961,14 +2006,43 @@ func IsBannedFromBeingCandidateReplica(replica *Instance) bool {
 		log.Debugf("instance %+v is banned because of promotion rule", replica.Key)
 		return true
 	}
+	if replica.HasFlag(NeverPromoteFlag) {
+		log.Debugf("instance %+v is banned because it is flagged %s", replica.Key, NeverPromoteFlag)
+		return true
+	}
 	for _, filter := range config.Config.PromotionIgnoreHostnameFilters {
 		if matched, _ := regexp.MatchString(filter, replica.Key.Hostname); matched {
 			return true
 		}
 	}
+	if isLowOnDiskForPromotion(replica) {
+		log.Debugf("instance %+v is banned because it is low on disk space", replica.Key)
+		return true
+	}
 	return false
 }
 
+// isLowOnDiskForPromotion checks the agent-reported disk metrics of the replica's host against PromotionMinDiskFreePercent.
+// Metrics not reported within the last two agent polls are stale. Hosts with no fresh metrics are never considered low on disk.
+func isLowOnDiskForPromotion(replica *Instance) bool {
+	if config.Config.PromotionMinDiskFreePercent == 0 {
+		return false
+	}
+	hostAttributes, err := attributes.GetRecentHostAttributesMap(replica.Key.Hostname, 2*60*config.Config.AgentPollMinutes)
+	if err != nil {
+		return false
+	}
+	diskFreeBytes, err := strconv.ParseInt(hostAttributes[attributes.HostDiskFreeBytesAttribute], 10, 64)
+	if err != nil {
+		return false
+	}
+	diskTotalBytes, err := strconv.ParseInt(hostAttributes[attributes.HostDiskTotalBytesAttribute], 10, 64)
+	if err != nil || diskTotalBytes <= 0 {
+		return false
+	}
+	return diskFreeBytes*100 < diskTotalBytes*int64(config.Config.PromotionMinDiskFreePercent)
+}
+
 // getPriorityMajorVersionForCandidate returns the primary (most common) major version found
 // among given instances. This will be used for choosing best candidate for promotion.
 func getPriorityMajorVersionForCandidate(replicas [](*Instance)) (priorityMajorVersion string, err error) {
@@ -2021,6 +2095,15 @@ func getPriorityBinlogFormatForCandidate(replicas [](*Instance)) (priorityBinlog
 
 // chooseCandidateReplica
 func chooseCandidateReplica(replicas [](*Instance)) (candidateReplica *Instance, aheadReplicas, equalReplicas, laterReplicas, cannotReplicateReplicas [](*Instance), err error) {
+	return chooseUnvetoedCandidateReplica(replicas, nil)
+}
+
+// chooseUnvetoedCandidateReplica chooses a candidate as chooseCandidateReplica does, skipping replicas vetoed by
+// given function. A nil function vetoes nothing.
+func chooseUnvetoedCandidateReplica(replicas [](*Instance), isVetoed func(*Instance) bool) (candidateReplica *Instance, aheadReplicas, equalReplicas, laterReplicas, cannotReplicateReplicas [](*Instance), err error) {
+	if isVetoed == nil {
+		isVetoed = func(*Instance) bool { return false }
+	}
 	if len(replicas) == 0 {
 		return candidateReplica, aheadReplicas, equalReplicas, laterReplicas, cannotReplicateReplicas, fmt.Errorf("No replicas found given in chooseCandidateReplica")
 	}
@@ -2032,7 +2115,8 @@ func chooseCandidateReplica(replicas [](*Instance)) (candidateReplica *Instance,
 		if isGenerallyValidAsCandidateReplica(replica) &&
 			!IsBannedFromBeingCandidateReplica(replica) &&
 			!IsSmallerMajorVersion(priorityMajorVersion, replica.MajorVersionString()) &&
-			!IsSmallerBinlogFormat(priorityBinlogFormat, replica.Binlog_format) {
+			!IsSmallerBinlogFormat(priorityBinlogFormat, replica.Binlog_format) &&
+			!isVetoed(replica) {
 			// this is the one
 			candidateReplica = replica
 			break
@@ -2043,7 +2127,7 @@ func chooseCandidateReplica(replicas [](*Instance)) (candidateReplica *Instance,
 		// Instead, pick a (single) replica which is not banned.
 		for _, replica := range replicas {
 			replica := replica
-			if !IsBannedFromBeingCandidateReplica(replica) {
+			if !IsBannedFromBeingCandidateReplica(replica) && !isVetoed(replica) {
 				// this is the one
 				candidateReplica = replica
 				break
@@ -2081,8 +2165,10 @@ func GetCandidateReplica(masterKey *InstanceKey, forRematchPurposes bool) (*Inst
 	cannotReplicateReplicas := [](*Instance){}
 
 	dataCenterHint := ""
+	var poolPreferences PromotionPoolPreferences
 	if master, _, _ := ReadInstance(masterKey); master != nil {
 		dataCenterHint = master.DataCenter
+		poolPreferences, _ = ReadPromotionPoolPreferences(master.ClusterName)
 	}
 	replicas, err := getReplicasForSorting(masterKey, false)
 	if err != nil {
@@ -2092,14 +2178,19 @@ func GetCandidateReplica(masterKey *InstanceKey, forRematchPurposes bool) (*Inst
 	if forRematchPurposes {
 		stopReplicationMethod = StopReplicationNicely
 	}
-	replicas = sortedReplicasDataCenterHint(replicas, stopReplicationMethod, dataCenterHint)
+	replicas = sortedReplicasDataCenterHint(replicas, stopReplicationMethod, dataCenterHint, poolPreferences)
 	if err != nil {
 		return candidateReplica, aheadReplicas, equalReplicas, laterReplicas, cannotReplicateReplicas, err
 	}
 	if len(replicas) == 0 {
 		return candidateReplica, aheadReplicas, equalReplicas, laterReplicas, cannotReplicateReplicas, fmt.Errorf("No replicas found for %+v", *masterKey)
 	}
-	candidateReplica, aheadReplicas, equalReplicas, laterReplicas, cannotReplicateReplicas, err = chooseCandidateReplica(replicas)
+	var isVetoed func(*Instance) bool
+	if forRematchPurposes {
+		// Promotion is imminent: consult PromotionVetoQuery
+		isVetoed = newPromotionVetoCheck()
+	}
+	candidateReplica, aheadReplicas, equalReplicas, laterReplicas, cannotReplicateReplicas, err = chooseUnvetoedCandidateReplica(replicas, isVetoed)
 	if err != nil {
 		return candidateReplica, aheadReplicas, equalReplicas, laterReplicas, cannotReplicateReplicas, err
 	}
@@ -2662,7 +2753,7 @@ func RelocateReplicas(instanceKey, otherKey *InstanceKey, pattern string) (repli
 		return replicas, other, err, errs
 	}
 	replicas = RemoveInstance(replicas, otherKey)
-	replicas = filterInstancesByPattern(replicas, pattern)
+	replicas = FilterInstancesByPattern(replicas, pattern)
 	if len(replicas) == 0 {
 		// Nothing to do
 		return replicas, other, nil, errs
@@ -2674,3 +2765,21 @@ func RelocateReplicas(instanceKey, otherKey *InstanceKey, pattern string) (repli
 	}
 	return replicas, other, err, errs
 }
+
+// RelocateGivenReplicas relocates given replicas of an instance below another instance. Like RelocateReplicas,
+// it moves the replicas together where the topology allows for it, e.g. via GTID or Pseudo-GTID.
+func RelocateGivenReplicas(replicas [](*Instance), instanceKey, otherKey *InstanceKey) ([](*Instance), error, []error) {
+	instance, found, err := ReadInstance(instanceKey)
+	if err != nil || !found {
+		return nil, log.Errorf("Error reading %+v", *instanceKey), nil
+	}
+	other, found, err := ReadInstance(otherKey)
+	if err != nil || !found {
+		return nil, log.Errorf("Error reading %+v", *otherKey), nil
+	}
+	replicas = RemoveInstance(replicas, otherKey)
+	if len(replicas) == 0 {
+		return replicas, nil, nil
+	}
+	return relocateReplicasInternal(replicas, instance, other)
+}
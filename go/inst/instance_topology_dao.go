@@ -48,6 +48,9 @@ const sqlThreadPollDuration = 400 * time.Millisecond
 
 // ExecInstance executes a given query on the given MySQL topology instance
 func ExecInstance(instanceKey *InstanceKey, query string, args ...interface{}) (sql.Result, error) {
+	if err := CheckTopologyStatementPrivileges(instanceKey, query); err != nil {
+		return nil, log.Errore(err)
+	}
 	db, err := db.OpenTopology(instanceKey.Hostname, instanceKey.Port)
 	if err != nil {
 		return nil, err
@@ -997,6 +1000,13 @@ func SetReadOnly(instanceKey *InstanceKey, readOnly bool) (*Instance, error) {
 	return instance, err
 }
 
+// ReadSuperReadOnly reads the super_read_only setting of an instance. Servers which do not support super_read_only
+// (e.g. MySQL prior to 5.7.8, MariaDB) return an error.
+func ReadSuperReadOnly(instanceKey *InstanceKey) (superReadOnly bool, err error) {
+	err = ScanInstanceRow(instanceKey, "select @@global.super_read_only", &superReadOnly)
+	return superReadOnly, err
+}
+
 // KillQuery stops replication on a given instance
 func KillQuery(instanceKey *InstanceKey, process int64) (*Instance, error) {
 	instance, err := ReadTopologyInstance(instanceKey)
@@ -1023,6 +1033,110 @@ func KillQuery(instanceKey *InstanceKey, process int64) (*Instance, error) {
 	return instance, err
 }
 
+// ReadBlockingProcesses returns processes on given instance which may block or be harmed by a demotion:
+// - processes running a transaction for longer than longTransactionSeconds (when greater than 0)
+// - processes holding metadata locks which other processes wait on (when checkMetadataLocks is true)
+// It also returns the processes waiting on metadata locks (when checkMetadataLocks is true). Those are victims rather
+// than culprits: killing them does not release any lock. Metadata lock holders are only identified when
+// performance_schema metadata lock instrumentation is enabled.
+func ReadBlockingProcesses(instanceKey *InstanceKey, longTransactionSeconds uint, checkMetadataLocks bool) (blocking []Process, waiting []Process, err error) {
+	blocking = []Process{}
+	waiting = []Process{}
+	db, err := db.OpenTopology(instanceKey.Hostname, instanceKey.Port)
+	if err != nil {
+		return blocking, waiting, log.Errore(err)
+	}
+	processesMap := make(map[int64]bool)
+	readProcessInto := func(processes *[]Process) func(m sqlutils.RowMap) error {
+		return func(m sqlutils.RowMap) error {
+			process := Process{
+				InstanceHostname: instanceKey.Hostname,
+				InstancePort:     instanceKey.Port,
+				Id:               m.GetInt64("id"),
+				User:             m.GetString("user"),
+				Host:             m.GetString("host"),
+				Db:               m.GetString("db"),
+				Command:          m.GetString("command"),
+				Time:             m.GetInt64("time"),
+				State:            m.GetString("state"),
+				Info:             m.GetString("info"),
+				StartedAt:        m.GetString("started_at"),
+			}
+			if !processesMap[process.Id] {
+				processesMap[process.Id] = true
+				*processes = append(*processes, process)
+			}
+			return nil
+		}
+	}
+	if longTransactionSeconds > 0 {
+		query := `
+			select
+				p.id, p.user, p.host, ifnull(p.db, '') as db, p.command, p.time,
+				ifnull(p.state, '') as state, ifnull(p.info, '') as info, trx.trx_started as started_at
+			from
+				information_schema.innodb_trx trx
+				join information_schema.processlist p on (trx.trx_mysql_thread_id = p.id)
+			where
+				trx.trx_started < now() - interval ? second
+			`
+		if err := sqlutils.QueryRowsMap(db, query, readProcessInto(&blocking), longTransactionSeconds); err != nil {
+			return blocking, waiting, log.Errore(err)
+		}
+	}
+	if checkMetadataLocks {
+		// Holders are read ahead of waiters, so that a process both holding and waiting on metadata locks is a holder
+		query := `
+			select distinct
+				p.id, p.user, p.host, ifnull(p.db, '') as db, p.command, p.time,
+				ifnull(p.state, '') as state, ifnull(p.info, '') as info, now() - interval p.time second as started_at
+			from
+				performance_schema.metadata_locks pending
+				join performance_schema.metadata_locks granted on (
+					granted.object_type = pending.object_type
+					and granted.object_schema <=> pending.object_schema
+					and granted.object_name <=> pending.object_name
+					and granted.owner_thread_id != pending.owner_thread_id
+				)
+				join performance_schema.threads t on (granted.owner_thread_id = t.thread_id)
+				join information_schema.processlist p on (t.processlist_id = p.id)
+			where
+				pending.lock_status = 'PENDING'
+				and granted.lock_status = 'GRANTED'
+			`
+		if err := sqlutils.QueryRowsMap(db, query, readProcessInto(&blocking)); err != nil {
+			// performance_schema may be disabled or lack the metadata_locks table (pre 5.7)
+			log.Debugf("ReadBlockingProcesses: unable to read metadata lock holders on %+v: %+v", *instanceKey, err)
+		}
+		query = `
+			select
+				p.id, p.user, p.host, ifnull(p.db, '') as db, p.command, p.time,
+				ifnull(p.state, '') as state, ifnull(p.info, '') as info, now() - interval p.time second as started_at
+			from
+				information_schema.processlist p
+			where
+				p.state like 'Waiting for %metadata lock'
+			`
+		if err := sqlutils.QueryRowsMap(db, query, readProcessInto(&waiting)); err != nil {
+			return blocking, waiting, log.Errore(err)
+		}
+	}
+	return blocking, waiting, nil
+}
+
+// KillProcess kills the connection of given process on given instance, rolling back any transaction it may hold
+func KillProcess(instanceKey *InstanceKey, process int64) error {
+	if *config.RuntimeCLIFlags.Noop {
+		return fmt.Errorf("noop: aborting kill-process operation on %+v; signalling error but nothing went wrong.", *instanceKey)
+	}
+	if _, err := ExecInstance(instanceKey, `kill ?`, process); err != nil {
+		return log.Errore(err)
+	}
+	log.Infof("Killed process %d on %+v", process, *instanceKey)
+	AuditOperation("kill-process", instanceKey, fmt.Sprintf("Killed process %d", process))
+	return nil
+}
+
 // injectPseudoGTID injects a Pseudo-GTID statement on a writable instance
 func injectPseudoGTID(instance *Instance) (hint string, err error) {
 	if *config.RuntimeCLIFlags.Noop {
@@ -0,0 +1,178 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/openark/golib/log"
+)
+
+// ReplicationSnapshot is the replication setup of a replica, taken before a safe relocation, and based on which
+// a failed relocation is rolled back
+type ReplicationSnapshot struct {
+	Key                   InstanceKey
+	MasterKey             InstanceKey
+	ExecBinlogCoordinates BinlogCoordinates
+	UsingOracleGTID       bool
+	UsingMariaDBGTID      bool
+	ExecutedGtidSet       string
+	SnapshotTime          time.Time
+}
+
+// NewReplicationSnapshot snapshots the replication setup of given replica
+func NewReplicationSnapshot(instance *Instance) *ReplicationSnapshot {
+	return &ReplicationSnapshot{
+		Key:                   instance.Key,
+		MasterKey:             instance.MasterKey,
+		ExecBinlogCoordinates: instance.ExecBinlogCoordinates,
+		UsingOracleGTID:       instance.UsingOracleGTID,
+		UsingMariaDBGTID:      instance.UsingMariaDBGTID,
+		ExecutedGtidSet:       instance.ExecutedGtidSet,
+		SnapshotTime:          time.Now(),
+	}
+}
+
+// isReplicationLagConverging checks whether a relocated replica's lag is acceptable: either within
+// ReasonableReplicationLagSeconds, or lower than when first observed after the relocation
+func isReplicationLagConverging(initialLagSeconds int64, lagSeconds int64) bool {
+	if lagSeconds <= int64(config.Config.ReasonableReplicationLagSeconds) {
+		return true
+	}
+	return lagSeconds < initialLagSeconds
+}
+
+// safeRelocationPreChecks verifies a replica, and the destination it is relocated below, are in a state
+// from which a relocation can be verified and rolled back
+func safeRelocationPreChecks(instance *Instance, destinationKey *InstanceKey) error {
+	if !instance.IsLastCheckValid {
+		return fmt.Errorf("%+v: last check is invalid", instance.Key)
+	}
+	if !instance.IsReplica() {
+		return fmt.Errorf("%+v is not a replica", instance.Key)
+	}
+	if !instance.ReplicaRunning() {
+		return fmt.Errorf("%+v is not replicating; safe mode requires a replicating replica", instance.Key)
+	}
+	if instance.LastSQLError != "" || instance.LastIOError != "" {
+		return fmt.Errorf("%+v has replication errors", instance.Key)
+	}
+	if destinationKey == nil {
+		return nil
+	}
+	destination, err := ReadTopologyInstance(destinationKey)
+	if err != nil {
+		return err
+	}
+	if destination == nil || !destination.IsLastCheckValid {
+		return fmt.Errorf("%+v: last check is invalid", *destinationKey)
+	}
+	return nil
+}
+
+// verifyRelocatedReplica waits for a relocated replica to be replicating without errors, with its lag converging,
+// within given timeout
+func verifyRelocatedReplica(instanceKey *InstanceKey, timeout time.Duration) error {
+	var initialLagSeconds int64 = -1
+	deadline := time.Now().Add(timeout)
+	for {
+		instance, err := ReadTopologyInstance(instanceKey)
+		if err == nil && instance.ReplicaRunning() && instance.LastSQLError == "" && instance.LastIOError == "" && instance.SlaveLagSeconds.Valid {
+			if initialLagSeconds < 0 {
+				initialLagSeconds = instance.SlaveLagSeconds.Int64
+			}
+			if isReplicationLagConverging(initialLagSeconds, instance.SlaveLagSeconds.Int64) {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			if err != nil {
+				return fmt.Errorf("%+v could not be verified within %+v: %+v", *instanceKey, timeout, err)
+			}
+			return fmt.Errorf("%+v is not replicating with decreasing lag within %+v. IO running: %+v, SQL running: %+v, lag: %+v, IO error: %s, SQL error: %s",
+				*instanceKey, timeout, instance.Slave_IO_Running, instance.Slave_SQL_Running, instance.SlaveLagSeconds.Int64, instance.LastIOError, instance.LastSQLError)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// rollbackRelocation restores a replica's previous master, as of given snapshot. A GTID replica is pointed back at
+// its previous master; other replicas are relocated back below it, as its current coordinates may well have moved on.
+func rollbackRelocation(snapshot *ReplicationSnapshot) (*Instance, error) {
+	instance, err := StopSlave(&snapshot.Key)
+	if err != nil {
+		return instance, err
+	}
+	if instance.MasterKey.Equals(&snapshot.MasterKey) {
+		return StartSlave(&snapshot.Key)
+	}
+	if snapshot.UsingOracleGTID || snapshot.UsingMariaDBGTID {
+		instance, err = ChangeMasterTo(&snapshot.Key, &snapshot.MasterKey, &instance.ExecBinlogCoordinates, false, GTIDHintForce)
+	} else {
+		instance, err = RelocateBelow(&snapshot.Key, &snapshot.MasterKey)
+	}
+	if err != nil {
+		return instance, err
+	}
+	return StartSlave(&snapshot.Key)
+}
+
+// SafeRelocation runs given relocation of a replica in safe mode: it checks the replica is healthy and snapshots its
+// replication setup; following the relocation it verifies the replica is replicating with lag decreasing within
+// SafeRelocationVerificationSeconds, and otherwise rolls back to the replica's previous master.
+// destinationKey may be nil when not known in advance (e.g. move-up).
+func SafeRelocation(operation string, instanceKey *InstanceKey, destinationKey *InstanceKey, relocate func() (*Instance, error)) (*Instance, error) {
+	instance, err := ReadTopologyInstance(instanceKey)
+	if err != nil {
+		return instance, err
+	}
+	if err := safeRelocationPreChecks(instance, destinationKey); err != nil {
+		return instance, fmt.Errorf("%s: safe mode pre-check failed: %+v", operation, err)
+	}
+	snapshot := NewReplicationSnapshot(instance)
+	log.Infof("%s: safe mode: %+v replicates from %+v at %+v (executed GTID set: %s)", operation, snapshot.Key, snapshot.MasterKey, snapshot.ExecBinlogCoordinates, snapshot.ExecutedGtidSet)
+
+	relocatedInstance, relocationErr := relocate()
+	if relocationErr == nil {
+		relocationErr = verifyRelocatedReplica(instanceKey, time.Duration(config.Config.SafeRelocationVerificationSeconds)*time.Second)
+		if relocationErr == nil {
+			return relocatedInstance, nil
+		}
+	} else if instance, err := ReadTopologyInstance(instanceKey); err == nil && instance.MasterKey.Equals(&snapshot.MasterKey) {
+		// Relocation failed without changing master; nothing to roll back. The replica was replicating before the
+		// relocation, and the relocation may have left it stopped.
+		if !instance.ReplicaRunning() {
+			log.Warningf("%s: safe mode: restarting replication on %+v: %+v", operation, snapshot.Key, relocationErr)
+			if instance, err := StartSlave(instanceKey); err != nil {
+				return instance, fmt.Errorf("%s: %+v; failed restarting replication: %+v", operation, relocationErr, err)
+			}
+		}
+		return relocatedInstance, relocationErr
+	}
+
+	log.Warningf("%s: safe mode: rolling back %+v to %+v: %+v", operation, snapshot.Key, snapshot.MasterKey, relocationErr)
+	instance, err = rollbackRelocation(snapshot)
+	if err != nil {
+		AuditOperation("safe-relocation-rollback", instanceKey, fmt.Sprintf("%s: failed rolling back to %+v at %+v: %+v", operation, snapshot.MasterKey, snapshot.ExecBinlogCoordinates, err))
+		return instance, fmt.Errorf("%s: %+v; rollback to %+v failed: %+v. Replica requires manual intervention; replication setup before relocation: master %+v, coordinates %+v, executed GTID set: %s",
+			operation, relocationErr, snapshot.MasterKey, err, snapshot.MasterKey, snapshot.ExecBinlogCoordinates, snapshot.ExecutedGtidSet)
+	}
+	AuditOperation("safe-relocation-rollback", instanceKey, fmt.Sprintf("%s: rolled back to %+v: %+v", operation, snapshot.MasterKey, relocationErr))
+	return instance, fmt.Errorf("%s: %+v; rolled back to %+v", operation, relocationErr, snapshot.MasterKey)
+}
@@ -1,7 +1,9 @@
 package inst
 
 import (
+	"github.com/github/orchestrator/go/attributes"
 	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
 	"github.com/openark/golib/log"
 	test "github.com/openark/golib/tests"
 	"testing"
@@ -100,6 +102,30 @@ func TestSortInstancesDataCenterHint(t *testing.T) {
 	test.S(t).ExpectEquals(instances[0].Key, i810Key)
 }
 
+func TestSortInstancesPoolPreferences(t *testing.T) {
+	instances, _ := generateTestInstances()
+	for _, instance := range instances {
+		instance.ExecBinlogCoordinates = instances[0].ExecBinlogCoordinates
+	}
+	poolPreferences := PromotionPoolPreferences{
+		i710Key: AvoidPoolPreference,
+		i810Key: FailoverPoolPreference,
+	}
+	sortInstancesForPromotion(instances, "", poolPreferences)
+	test.S(t).ExpectEquals(instances[0].Key, i810Key)
+	test.S(t).ExpectEquals(instances[len(instances)-1].Key, i710Key)
+}
+
+func TestGetPromotionPoolPreference(t *testing.T) {
+	promotionPools := config.PromotionPoolsConfiguration{FailoverPool: "spare", AvoidPools: []string{"reads", "reports"}}
+	test.S(t).ExpectEquals(getPromotionPoolPreference([]string{}, promotionPools), NeutralPoolPreference)
+	test.S(t).ExpectEquals(getPromotionPoolPreference([]string{"batch"}, promotionPools), NeutralPoolPreference)
+	test.S(t).ExpectEquals(getPromotionPoolPreference([]string{"batch", "reports"}, promotionPools), AvoidPoolPreference)
+	test.S(t).ExpectEquals(getPromotionPoolPreference([]string{"reads", "spare"}, promotionPools), FailoverPoolPreference)
+	test.S(t).ExpectTrue(FailoverPoolPreference.BetterThan(NeutralPoolPreference))
+	test.S(t).ExpectFalse(AvoidPoolPreference.BetterThan(NeutralPoolPreference))
+}
+
 func TestGetPriorityMajorVersionForCandidate(t *testing.T) {
 	instances, instancesMap := generateTestInstances()
 
@@ -190,6 +216,15 @@ func TestIsBannedFromBeingCandidateReplica(t *testing.T) {
 			test.S(t).ExpectTrue(IsBannedFromBeingCandidateReplica(instance))
 		}
 	}
+	{
+		instances, _ := generateTestInstances()
+		for _, instance := range instances {
+			instance.Flags = []InstanceFlag{NeverPromoteFlag}
+		}
+		for _, instance := range instances {
+			test.S(t).ExpectTrue(IsBannedFromBeingCandidateReplica(instance))
+		}
+	}
 }
 
 func TestChooseCandidateReplicaNoCandidateReplica(t *testing.T) {
@@ -216,6 +251,27 @@ func TestChooseCandidateReplica(t *testing.T) {
 	test.S(t).ExpectEquals(len(cannotReplicateReplicas), 0)
 }
 
+func TestChooseUnvetoedCandidateReplica(t *testing.T) {
+	instances, _ := generateTestInstances()
+	applyGeneralGoodToGoReplicationParams(instances)
+	instances = sortedReplicas(instances, NoStopReplication)
+	isVetoed := func(instance *Instance) bool {
+		return instance.Key.Equals(&i830Key)
+	}
+	candidate, aheadReplicas, equalReplicas, laterReplicas, cannotReplicateReplicas, err := chooseUnvetoedCandidateReplica(instances, isVetoed)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(candidate.Key, i820Key)
+	test.S(t).ExpectEquals(len(aheadReplicas), 1)
+	test.S(t).ExpectEquals(len(equalReplicas), 0)
+	test.S(t).ExpectEquals(len(laterReplicas), 4)
+	test.S(t).ExpectEquals(len(cannotReplicateReplicas), 0)
+
+	isVetoed = func(instance *Instance) bool { return true }
+	candidate, _, _, _, _, err = chooseUnvetoedCandidateReplica(instances, isVetoed)
+	test.S(t).ExpectNotNil(err)
+	test.S(t).ExpectTrue(candidate == nil)
+}
+
 func TestChooseCandidateReplica2(t *testing.T) {
 	instances, instancesMap := generateTestInstances()
 	applyGeneralGoodToGoReplicationParams(instances)
@@ -491,3 +547,317 @@ func TestChooseCandidateReplicaPromoteRuleOrdering3(t *testing.T) {
 	test.S(t).ExpectEquals(len(laterReplicas), 0)
 	test.S(t).ExpectEquals(len(cannotReplicateReplicas), 0)
 }
+
+func TestFindCircularReplicationsCoMasters(t *testing.T) {
+	instances, instancesMap := generateTestInstances()
+	for _, instance := range instances {
+		instance.ReadOnly = true
+		instance.MasterKey = i710Key
+	}
+	instancesMap[i710Key.StringCode()].MasterKey = i720Key
+	instancesMap[i710Key.StringCode()].ReadOnly = false
+
+	circularReplications := findCircularReplications(instances)
+	test.S(t).ExpectEquals(len(circularReplications), 1)
+	test.S(t).ExpectEquals(len(circularReplications[0].Members), 2)
+	test.S(t).ExpectFalse(circularReplications[0].IsRing())
+	test.S(t).ExpectTrue(circularReplications[0].HasMember(&i710Key))
+	test.S(t).ExpectTrue(circularReplications[0].HasMember(&i720Key))
+	test.S(t).ExpectFalse(circularReplications[0].HasMember(&i730Key))
+	test.S(t).ExpectEquals(*circularReplications[0].ActiveMasterKey, i710Key)
+}
+
+func TestFindCircularReplicationsRing(t *testing.T) {
+	instances, instancesMap := generateTestInstances()
+	for _, instance := range instances {
+		instance.ReadOnly = true
+		instance.MasterKey = i830Key
+	}
+	instancesMap[i710Key.StringCode()].MasterKey = i730Key
+	instancesMap[i720Key.StringCode()].MasterKey = i710Key
+	instancesMap[i730Key.StringCode()].MasterKey = i720Key
+	instancesMap[i830Key.StringCode()].MasterKey = InstanceKey{}
+
+	circularReplications := findCircularReplications(instances)
+	test.S(t).ExpectEquals(len(circularReplications), 1)
+	test.S(t).ExpectTrue(circularReplications[0].IsRing())
+	test.S(t).ExpectEquals(len(circularReplications[0].Members), 3)
+	// replication order: each member replicates from the preceding one
+	test.S(t).ExpectEquals(circularReplications[0].Members[0], i720Key)
+	test.S(t).ExpectEquals(circularReplications[0].Members[1], i730Key)
+	test.S(t).ExpectEquals(circularReplications[0].Members[2], i710Key)
+	test.S(t).ExpectTrue(circularReplications[0].ActiveMasterKey == nil)
+
+	instancesMap[i720Key.StringCode()].ReadOnly = false
+	instancesMap[i730Key.StringCode()].ReadOnly = false
+	circularReplications = findCircularReplications(instances)
+	test.S(t).ExpectTrue(circularReplications[0].HasMultipleWritableMembers())
+	test.S(t).ExpectTrue(circularReplications[0].ActiveMasterKey == nil)
+}
+
+func TestFindCircularReplicationsNone(t *testing.T) {
+	instances, instancesMap := generateTestInstances()
+	for _, instance := range instances {
+		instance.MasterKey = i710Key
+	}
+	instancesMap[i710Key.StringCode()].MasterKey = InstanceKey{}
+	instancesMap[i810Key.StringCode()].MasterKey = i820Key
+	instancesMap[i820Key.StringCode()].MasterKey = i830Key
+
+	circularReplications := findCircularReplications(instances)
+	test.S(t).ExpectEquals(len(circularReplications), 0)
+}
+
+func TestNewFailoverImpactEstimate(t *testing.T) {
+	instances, instancesMap := generateTestInstances()
+	applyGeneralGoodToGoReplicationParams(instances)
+	instancesMap[i830Key.StringCode()].LogSlaveUpdatesEnabled = false
+	instancesMap[i820Key.StringCode()].LogBinEnabled = false
+	master := &Instance{Key: InstanceKey{Hostname: "master", Port: 3306}, ExecutedGtidSet: "00020192-1111-1111-1111-111111111111:1-100"}
+	instancesMap[i710Key.StringCode()].UsingOracleGTID = true
+	instancesMap[i710Key.StringCode()].ExecutedGtidSet = "00020192-1111-1111-1111-111111111111:1-90,00020194-3333-3333-3333-333333333333:1-2"
+	instancesMap[i720Key.StringCode()].UsingOracleGTID = true
+	instancesMap[i720Key.StringCode()].ExecutedGtidSet = "00020192-1111-1111-1111-111111111111:1-95"
+	instances = sortedReplicas(instances, NoStopReplication)
+	candidate, aheadReplicas, equalReplicas, laterReplicas, cannotReplicateReplicas, err := chooseCandidateReplica(instances)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(candidate.Key, i810Key)
+
+	estimate := newFailoverImpactEstimate(master, candidate, aheadReplicas, equalReplicas, laterReplicas, cannotReplicateReplicas)
+	test.S(t).ExpectEquals(estimate.CandidateKey, i810Key)
+	test.S(t).ExpectEquals(estimate.CountReplicasToRepoint, uint(5))
+	test.S(t).ExpectEquals(estimate.CountReplicasUnlikelyReattachable, uint(3))
+	_, found := estimate.UnlikelyReattachableReplicas[i830Key.StringCode()]
+	test.S(t).ExpectTrue(found)
+	_, found = estimate.UnlikelyReattachableReplicas[i820Key.StringCode()]
+	test.S(t).ExpectTrue(found)
+	test.S(t).ExpectEquals(estimate.UnlikelyReattachableReplicas[i710Key.StringCode()], "errant GTID: 00020194-3333-3333-3333-333333333333")
+	_, found = estimate.UnlikelyReattachableReplicas[i720Key.StringCode()]
+	test.S(t).ExpectFalse(found)
+}
+
+func TestParseReplicationThread(t *testing.T) {
+	{
+		thread, err := ParseReplicationThread("io")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(thread, IOThread)
+	}
+	{
+		thread, err := ParseReplicationThread("SQL_THREAD")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(thread, SQLThread)
+	}
+	{
+		_, err := ParseReplicationThread("both")
+		test.S(t).ExpectNotNil(err)
+	}
+}
+
+func TestReplicationThreadStatement(t *testing.T) {
+	mysql56 := &Instance{Key: i710Key, Version: "5.6.7"}
+	mysql57 := &Instance{Key: i710Key, Version: "5.7.21-log"}
+	mariadb := &Instance{Key: i710Key, Version: "10.1.26-MariaDB"}
+	{
+		statement, err := replicationThreadStatement(mysql56, StopReplicationThreadAction, SQLThread, "")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(statement, "stop slave sql_thread")
+	}
+	{
+		_, err := replicationThreadStatement(mysql56, StopReplicationThreadAction, SQLThread, "ch1")
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		statement, err := replicationThreadStatement(mysql57, StartReplicationThreadAction, IOThread, "ch1")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(statement, "start slave io_thread for channel 'ch1'")
+	}
+	{
+		statement, err := replicationThreadStatement(mariadb, StopReplicationThreadAction, IOThread, "ch1")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(statement, "stop slave 'ch1' io_thread")
+	}
+	{
+		_, err := replicationThreadStatement(mysql57, StopReplicationThreadAction, IOThread, "ch1'; drop table t")
+		test.S(t).ExpectNotNil(err)
+	}
+}
+
+func TestEvaluateGTIDMigration(t *testing.T) {
+	newMembers := func(gtidMode string) []GTIDMigrationMember {
+		return []GTIDMigrationMember{
+			{Key: i710Key, Version: "5.7.21-log", IsReachable: true, GTIDMode: gtidMode, EnforceGTIDConsistency: "ON"},
+			{Key: i720Key, Version: "5.7.21-log", IsReachable: true, GTIDMode: gtidMode, EnforceGTIDConsistency: "ON", IsReplica: true},
+		}
+	}
+	{
+		members := newMembers("OFF")
+		members[1].EnforceGTIDConsistency = "OFF"
+		migration := evaluateGTIDMigration("c1", members)
+		test.S(t).ExpectTrue(migration.IsReady)
+		test.S(t).ExpectEquals(migration.NextStep, GTIDMigrationEnforceConsistency)
+		test.S(t).ExpectEquals(migration.CountPending, 1)
+	}
+	{
+		migration := evaluateGTIDMigration("c1", newMembers("OFF"))
+		test.S(t).ExpectTrue(migration.IsReady)
+		test.S(t).ExpectEquals(migration.CurrentMode, "OFF")
+		test.S(t).ExpectEquals(migration.NextStep, GTIDMigrationOffPermissive)
+		test.S(t).ExpectEquals(migration.CountPending, 2)
+	}
+	{
+		members := newMembers("ON_PERMISSIVE")
+		members[0].GTIDMode = "OFF_PERMISSIVE"
+		migration := evaluateGTIDMigration("c1", members)
+		test.S(t).ExpectTrue(migration.IsReady)
+		test.S(t).ExpectEquals(migration.CurrentMode, "OFF_PERMISSIVE")
+		test.S(t).ExpectEquals(migration.NextStep, GTIDMigrationOnPermissive)
+		test.S(t).ExpectEquals(migration.CountPending, 1)
+	}
+	{
+		members := newMembers("ON_PERMISSIVE")
+		members[1].OngoingAnonymousTransactions = 3
+		migration := evaluateGTIDMigration("c1", members)
+		test.S(t).ExpectFalse(migration.IsReady)
+		test.S(t).ExpectEquals(migration.NextStep, GTIDMigrationOn)
+		test.S(t).ExpectEquals(len(migration.Problems), 1)
+	}
+	{
+		migration := evaluateGTIDMigration("c1", newMembers("ON"))
+		test.S(t).ExpectTrue(migration.IsReady)
+		test.S(t).ExpectEquals(migration.NextStep, GTIDMigrationAutoPosition)
+		test.S(t).ExpectEquals(migration.CountPending, 1)
+	}
+	{
+		members := newMembers("ON")
+		members[1].UsingGTIDAutoPosition = true
+		migration := evaluateGTIDMigration("c1", members)
+		test.S(t).ExpectFalse(migration.IsReady)
+		test.S(t).ExpectTrue(migration.IsComplete)
+		test.S(t).ExpectEquals(migration.NextStep, GTIDMigrationComplete)
+	}
+	{
+		members := newMembers("ON")
+		members[0].GTIDMode = "OFF_PERMISSIVE"
+		migration := evaluateGTIDMigration("c1", members)
+		test.S(t).ExpectFalse(migration.IsReady)
+		test.S(t).ExpectEquals(len(migration.Problems), 1)
+	}
+	{
+		members := newMembers("OFF")
+		members[0].Version = "5.6.30"
+		members[1].IsReachable = false
+		migration := evaluateGTIDMigration("c1", members)
+		test.S(t).ExpectFalse(migration.IsReady)
+		test.S(t).ExpectEquals(len(migration.Problems), 2)
+	}
+}
+
+func TestEvaluateClusterOnboarding(t *testing.T) {
+	newInstances := func() [](*Instance) {
+		instances, instancesMap := generateTestInstances()
+		applyGeneralGoodToGoReplicationParams(instances)
+		for _, instance := range instances {
+			instance.ClusterName = "c1"
+			instance.UsingOracleGTID = true
+			instance.ReadOnly = true
+			instance.Slave_IO_Running = true
+			instance.Slave_SQL_Running = true
+			instance.MasterKey = i710Key
+			instance.ReadBinlogCoordinates = instance.ExecBinlogCoordinates
+		}
+		master := instancesMap[i710Key.StringCode()]
+		master.MasterKey = InstanceKey{}
+		master.UsingOracleGTID = false
+		master.Slave_IO_Running = false
+		master.Slave_SQL_Running = false
+		master.ReadOnly = false
+		return instances
+	}
+	{
+		report := evaluateClusterOnboarding(i720Key, newInstances(), []InstanceKey{}, nil, true)
+		test.S(t).ExpectTrue(report.IsReady)
+		test.S(t).ExpectEquals(report.MasterKey, i710Key)
+		test.S(t).ExpectEquals(len(report.Members), 6)
+		test.S(t).ExpectEquals(report.CountPromotableReplicas, 5)
+		test.S(t).ExpectEquals(len(report.Remediations), 0)
+	}
+	{
+		report := evaluateClusterOnboarding(i720Key, newInstances(), []InstanceKey{}, nil, false)
+		test.S(t).ExpectFalse(report.IsReady)
+		test.S(t).ExpectEquals(len(report.Remediations), 1)
+		test.S(t).ExpectEquals(report.Remediations[0].Check, OnboardingRecovery)
+	}
+	{
+		instances := newInstances()
+		for _, instance := range instances {
+			instance.UsingOracleGTID = false
+			instance.LogSlaveUpdatesEnabled = false
+		}
+		instances[1].ReadOnly = false
+		report := evaluateClusterOnboarding(i720Key, instances, []InstanceKey{i830Key}, nil, true)
+		test.S(t).ExpectFalse(report.IsReady)
+		test.S(t).ExpectEquals(report.CountPromotableReplicas, 0)
+		blocking := []OnboardingCheck{}
+		for _, remediation := range report.Remediations {
+			if remediation.IsBlocking {
+				blocking = append(blocking, remediation.Check)
+			}
+		}
+		test.S(t).ExpectEquals(len(blocking), 2)
+		test.S(t).ExpectEquals(blocking[0], OnboardingPromotion)
+		test.S(t).ExpectEquals(blocking[1], OnboardingGTID)
+	}
+	{
+		instances := newInstances()
+		instances[1].MasterKey = InstanceKey{}
+		report := evaluateClusterOnboarding(i720Key, instances, []InstanceKey{}, nil, true)
+		test.S(t).ExpectFalse(report.IsReady)
+		test.S(t).ExpectEquals(report.Remediations[0].Check, OnboardingDiscovery)
+	}
+}
+
+func TestIsReplicationLagConverging(t *testing.T) {
+	config.Config.ReasonableReplicationLagSeconds = 10
+	test.S(t).ExpectTrue(isReplicationLagConverging(0, 0))
+	test.S(t).ExpectTrue(isReplicationLagConverging(100, 10))
+	test.S(t).ExpectTrue(isReplicationLagConverging(100, 99))
+	test.S(t).ExpectFalse(isReplicationLagConverging(100, 100))
+	test.S(t).ExpectFalse(isReplicationLagConverging(100, 120))
+}
+
+func TestIsLowOnDiskForPromotion(t *testing.T) {
+	withSQLiteBackend(t)
+	minDiskFreePercent, agentPollMinutes := config.Config.PromotionMinDiskFreePercent, config.Config.AgentPollMinutes
+	defer func() {
+		config.Config.PromotionMinDiskFreePercent, config.Config.AgentPollMinutes = minDiskFreePercent, agentPollMinutes
+	}()
+	config.Config.PromotionMinDiskFreePercent = 20
+	config.Config.AgentPollMinutes = 1
+
+	setDiskMetrics := func(hostname string, diskFreeBytes string, diskTotalBytes string) {
+		test.S(t).ExpectNil(attributes.SetHostAttributes(hostname, attributes.HostDiskFreeBytesAttribute, diskFreeBytes))
+		test.S(t).ExpectNil(attributes.SetHostAttributes(hostname, attributes.HostDiskTotalBytesAttribute, diskTotalBytes))
+	}
+	replica := func(hostname string) *Instance {
+		return &Instance{Key: InstanceKey{Hostname: hostname, Port: 3306}}
+	}
+	setDiskMetrics("disk-full", "10", "100")
+	setDiskMetrics("disk-spacious", "50", "100")
+
+	test.S(t).ExpectTrue(isLowOnDiskForPromotion(replica("disk-full")))
+	test.S(t).ExpectFalse(isLowOnDiskForPromotion(replica("disk-spacious")))
+	test.S(t).ExpectFalse(isLowOnDiskForPromotion(replica("disk-unreported")))
+	{
+		// Metrics not reported within the last two agent polls are stale, and are ignored
+		_, err := db.ExecOrchestrator(`update host_attributes set submit_timestamp = now() - interval 3 minute where hostname = ?`, "disk-full")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectFalse(isLowOnDiskForPromotion(replica("disk-full")))
+
+		setDiskMetrics("disk-full", "10", "100")
+		test.S(t).ExpectTrue(isLowOnDiskForPromotion(replica("disk-full")))
+	}
+	{
+		config.Config.PromotionMinDiskFreePercent = 0
+		test.S(t).ExpectFalse(isLowOnDiskForPromotion(replica("disk-full")))
+	}
+}
@@ -27,8 +27,9 @@ var (
 )
 
 type InstancesSorterByExec struct {
-	instances  [](*Instance)
-	dataCenter string
+	instances       [](*Instance)
+	dataCenter      string
+	poolPreferences PromotionPoolPreferences
 }
 
 func NewInstancesSorterByExec(instances [](*Instance), dataCenter string) *InstancesSorterByExec {
@@ -74,6 +75,10 @@ func (this *InstancesSorterByExec) Less(i, j int) bool {
 		if this.instances[j].DataCenter == this.dataCenter && this.instances[i].DataCenter != this.dataCenter {
 			return true
 		}
+		// Prefer failover pool members, and avoid members of avoided pools:
+		if this.poolPreferences.Get(&this.instances[j].Key).BetterThan(this.poolPreferences.Get(&this.instances[i].Key)) {
+			return true
+		}
 		// Prefer candidates:
 		if this.instances[j].PromotionRule.SmallerThan(this.instances[i].PromotionRule) {
 			return true
@@ -82,8 +87,8 @@ func (this *InstancesSorterByExec) Less(i, j int) bool {
 	return this.instances[i].ExecBinlogCoordinates.SmallerThan(&this.instances[j].ExecBinlogCoordinates)
 }
 
-// filterInstancesByPattern will filter given array of instances according to regular expression pattern
-func filterInstancesByPattern(instances [](*Instance), pattern string) [](*Instance) {
+// FilterInstancesByPattern will filter given array of instances according to regular expression pattern
+func FilterInstancesByPattern(instances [](*Instance), pattern string) [](*Instance) {
 	if pattern == "" {
 		return instances
 	}
@@ -166,6 +171,29 @@ func IsSmallerMajorVersion(version string, otherVersion string) bool {
 	return false
 }
 
+// IsSmallerVersion tests two versions against another, up to their minor (patch) level, and returns true if
+// the former is smaller than the latter. e.g. 5.7.5-log is smaller than 5.7.6, and 5.7.6 is not smaller than 5.7
+func IsSmallerVersion(version string, otherVersion string) bool {
+	versionTokens := func(version string) []string {
+		return strings.Split(strings.SplitN(version, "-", 2)[0], ".")
+	}
+	thisVersion := versionTokens(version)
+	for i, otherToken := range versionTokens(otherVersion) {
+		if i >= len(thisVersion) {
+			return false
+		}
+		thisValue, _ := strconv.Atoi(thisVersion[i])
+		otherValue, _ := strconv.Atoi(otherToken)
+		if thisValue < otherValue {
+			return true
+		}
+		if thisValue > otherValue {
+			return false
+		}
+	}
+	return false
+}
+
 // IsSmallerBinlogFormat tests two binlog formats and sees if one is "smaller" than the other.
 // "smaller" binlog format means you can replicate from the smaller to the larger.
 func IsSmallerBinlogFormat(binlogFormat string, otherBinlogFormat string) bool {
@@ -0,0 +1,174 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/openark/golib/math"
+	"github.com/patrickmn/go-cache"
+)
+
+// lagHistoryWindow is how far back a replica's lag history is kept, and used to predict its convergence
+const lagHistoryWindow = 5 * time.Minute
+
+// minLagPredictionSpan is the time span lag samples must cover for a prediction to be trusted
+const minLagPredictionSpan = 30 * time.Second
+
+// instanceLagHistory holds the recent lag samples of replicas, by instance key. Replicas no longer sampled expire.
+var instanceLagHistory = cache.New(lagHistoryWindow, time.Minute)
+var instanceLagHistoryMutex sync.Mutex
+
+// LagHistorySample is a replica's replication lag as observed at a given time
+type LagHistorySample struct {
+	Timestamp  time.Time
+	LagSeconds int64
+}
+
+// LagPrediction predicts when a replica catches up to a target lag, based on its recent lag history
+type LagPrediction struct {
+	InstanceKey      InstanceKey
+	LagSeconds       int64 // as of the latest sample
+	TargetLagSeconds int64
+	CountSamples     int
+	SpanSeconds      float64
+	CatchUpRate      float64 // seconds of lag recovered per second; negative when lag grows
+	IsCaughtUp       bool
+	IsConfident      bool // samples span at least minLagPredictionSpan
+	IsConverging     bool
+	SecondsToCatchUp float64 // -1 when not converging
+	PredictedTime    *time.Time
+}
+
+// String returns a human readable summary of this prediction
+func (this *LagPrediction) String() string {
+	switch {
+	case this.IsCaughtUp:
+		return fmt.Sprintf("%+v is caught up: lag %ds is within %ds", this.InstanceKey, this.LagSeconds, this.TargetLagSeconds)
+	case this.CountSamples == 0:
+		return fmt.Sprintf("%+v has no lag history", this.InstanceKey)
+	case this.CountSamples < 2:
+		return fmt.Sprintf("%+v lags %ds; not enough lag history to predict catching up", this.InstanceKey, this.LagSeconds)
+	case !this.IsConverging:
+		return fmt.Sprintf("%+v lags %ds and is not catching up (rate %.2f over %.0fs)", this.InstanceKey, this.LagSeconds, this.CatchUpRate, this.SpanSeconds)
+	}
+	return fmt.Sprintf("%+v lags %ds; predicted to be within %ds in %.0fs (rate %.2f over %.0fs)", this.InstanceKey, this.LagSeconds, this.TargetLagSeconds, this.SecondsToCatchUp, this.CatchUpRate, this.SpanSeconds)
+}
+
+// maintenanceLagSeconds returns a replica's lag as considered by HasReasonableMaintenanceReplicationLag
+func maintenanceLagSeconds(instance *Instance) (lagSeconds int64, ok bool) {
+	if !instance.IsLastCheckValid || !instance.SecondsBehindMaster.Valid {
+		return 0, false
+	}
+	lagSeconds = instance.SecondsBehindMaster.Int64
+	if instance.SQLDelay > 0 {
+		lagSeconds = math.AbsInt64(lagSeconds - int64(instance.SQLDelay))
+	}
+	return lagSeconds, true
+}
+
+// RecordInstanceLag appends a replica's current lag to its lag history. Samples older than lagHistoryWindow are dropped.
+func RecordInstanceLag(instance *Instance) {
+	if instance == nil || !instance.IsReplica() {
+		return
+	}
+	lagSeconds, ok := maintenanceLagSeconds(instance)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	instanceLagHistoryMutex.Lock()
+	defer instanceLagHistoryMutex.Unlock()
+
+	history := []LagHistorySample{}
+	if cached, found := instanceLagHistory.Get(instance.Key.StringCode()); found {
+		for _, sample := range cached.([]LagHistorySample) {
+			if now.Sub(sample.Timestamp) <= lagHistoryWindow {
+				history = append(history, sample)
+			}
+		}
+	}
+	history = append(history, LagHistorySample{Timestamp: now, LagSeconds: lagSeconds})
+	instanceLagHistory.Set(instance.Key.StringCode(), history, cache.DefaultExpiration)
+}
+
+// ReadInstanceLagHistory returns the recent lag samples of a replica, oldest first
+func ReadInstanceLagHistory(instanceKey *InstanceKey) []LagHistorySample {
+	instanceLagHistoryMutex.Lock()
+	defer instanceLagHistoryMutex.Unlock()
+
+	history := []LagHistorySample{}
+	if cached, found := instanceLagHistory.Get(instanceKey.StringCode()); found {
+		history = append(history, cached.([]LagHistorySample)...)
+	}
+	return history
+}
+
+// PredictLagConvergence predicts when a replica catches up to given target lag. The catch-up rate is the
+// least squares slope of the lag history; the latest sample is the replica's current lag.
+func PredictLagConvergence(instanceKey *InstanceKey, history []LagHistorySample, targetLagSeconds int64, now time.Time) *LagPrediction {
+	prediction := &LagPrediction{
+		InstanceKey:      *instanceKey,
+		TargetLagSeconds: targetLagSeconds,
+		CountSamples:     len(history),
+		SecondsToCatchUp: -1,
+	}
+	if len(history) == 0 {
+		return prediction
+	}
+	latest := history[len(history)-1]
+	prediction.LagSeconds = latest.LagSeconds
+	if latest.LagSeconds <= targetLagSeconds {
+		prediction.IsCaughtUp = true
+		prediction.IsConverging = true
+		prediction.SecondsToCatchUp = 0
+		prediction.PredictedTime = &now
+		return prediction
+	}
+	if len(history) < 2 {
+		return prediction
+	}
+	first := history[0].Timestamp
+	prediction.SpanSeconds = latest.Timestamp.Sub(first).Seconds()
+	prediction.IsConfident = latest.Timestamp.Sub(first) >= minLagPredictionSpan
+
+	var sumT, sumLag, sumTT, sumTLag float64
+	for _, sample := range history {
+		t := sample.Timestamp.Sub(first).Seconds()
+		lag := float64(sample.LagSeconds)
+		sumT += t
+		sumLag += lag
+		sumTT += t * t
+		sumTLag += t * lag
+	}
+	n := float64(len(history))
+	denominator := n*sumTT - sumT*sumT
+	if denominator == 0 {
+		return prediction
+	}
+	prediction.CatchUpRate = -(n*sumTLag - sumT*sumLag) / denominator
+	if prediction.CatchUpRate <= 0 {
+		return prediction
+	}
+	prediction.IsConverging = true
+	prediction.SecondsToCatchUp = float64(latest.LagSeconds-targetLagSeconds) / prediction.CatchUpRate
+	predictedTime := latest.Timestamp.Add(time.Duration(prediction.SecondsToCatchUp * float64(time.Second)))
+	prediction.PredictedTime = &predictedTime
+	return prediction
+}
@@ -0,0 +1,98 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+)
+
+// LagSample is the replication lag of a cluster's replicas, as sampled in a given minute
+type LagSample struct {
+	ClusterName         string
+	SampleUnixTimestamp int64
+	MaxLagSeconds       int64
+	CountReplicas       uint
+	CountUnknownLag     uint // replicas whose lag is unknown, e.g. since replication is broken
+}
+
+// IsCompliant returns true when all replicas lagged less than given threshold
+func (this *LagSample) IsCompliant(thresholdSeconds float64) bool {
+	return this.CountUnknownLag == 0 && float64(this.MaxLagSeconds) < thresholdSeconds
+}
+
+// LagSLOStatus is the compliance of a cluster with its replication lag SLO
+type LagSLOStatus struct {
+	ClusterName           string
+	ClusterAlias          string
+	ThresholdSeconds      float64
+	TargetRatio           float64
+	WindowHours           uint
+	CountSampledMinutes   uint
+	CountCompliantMinutes uint
+	Compliance            float64 // ratio of compliant minutes among sampled minutes; 1 when nothing is sampled
+	IsMet                 bool
+	ErrorBudgetRemaining  float64 // ratio of the window's error budget not yet spent; negative when the SLO is breached
+	BurnRateWindowMinutes uint
+	BurnRate              float64 // ratio of non compliant minutes within the burn rate window, relative to the error budget ratio
+}
+
+// NewLagSLOStatus computes the compliance of a cluster with given SLO, based on given lag samples
+func NewLagSLOStatus(clusterName string, clusterAlias string, lagSLO config.LagSLOConfiguration, samples []LagSample, now time.Time) *LagSLOStatus {
+	status := &LagSLOStatus{
+		ClusterName:           clusterName,
+		ClusterAlias:          clusterAlias,
+		ThresholdSeconds:      lagSLO.ThresholdSeconds,
+		TargetRatio:           lagSLO.TargetRatio,
+		WindowHours:           lagSLO.WindowHours,
+		BurnRateWindowMinutes: lagSLO.BurnRateWindowMinutes,
+		Compliance:            1,
+	}
+	windowStart := now.Add(-time.Duration(lagSLO.WindowHours) * time.Hour).Unix()
+	burnRateWindowStart := now.Add(-time.Duration(lagSLO.BurnRateWindowMinutes) * time.Minute).Unix()
+	countBurnRateWindowMinutes := 0
+	countBurnRateWindowNonCompliantMinutes := 0
+	for _, sample := range samples {
+		if sample.SampleUnixTimestamp < windowStart {
+			continue
+		}
+		status.CountSampledMinutes++
+		compliant := sample.IsCompliant(lagSLO.ThresholdSeconds)
+		if compliant {
+			status.CountCompliantMinutes++
+		}
+		if sample.SampleUnixTimestamp >= burnRateWindowStart {
+			countBurnRateWindowMinutes++
+			if !compliant {
+				countBurnRateWindowNonCompliantMinutes++
+			}
+		}
+	}
+	if status.CountSampledMinutes > 0 {
+		status.Compliance = float64(status.CountCompliantMinutes) / float64(status.CountSampledMinutes)
+	}
+	status.IsMet = status.Compliance >= lagSLO.TargetRatio
+
+	errorBudgetRatio := 1 - lagSLO.TargetRatio
+	errorBudgetMinutes := errorBudgetRatio * float64(lagSLO.WindowHours*60)
+	status.ErrorBudgetRemaining = 1 - float64(status.CountSampledMinutes-status.CountCompliantMinutes)/errorBudgetMinutes
+	if countBurnRateWindowMinutes > 0 {
+		status.BurnRate = float64(countBurnRateWindowNonCompliantMinutes) / float64(countBurnRateWindowMinutes) / errorBudgetRatio
+	}
+	return status
+}
@@ -0,0 +1,155 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+// RecordClusterLagSamples samples the current replication lag of all clusters' replicas. Downtimed replicas,
+// replicas which are not seen, replicas flagged skip-lag-checks, and the intended delay of delayed replicas
+// are not accounted for.
+// Samples are only recorded when lag SLOs are configured.
+func RecordClusterLagSamples() error {
+	if len(config.Config.LagSLOs) == 0 {
+		return nil
+	}
+	writeFunc := func() error {
+		_, err := db.ExecOrchestrator(`
+			insert ignore into
+				cluster_lag_sample (cluster_name, sample_unix_timestamp, max_lag_seconds, count_replicas, count_unknown_lag)
+			select
+				database_instance.cluster_name,
+				?,
+				ifnull(max(cast(database_instance.slave_lag_seconds as signed) - cast(database_instance.sql_delay as signed)), 0),
+				count(*),
+				sum(database_instance.slave_lag_seconds is null)
+			from
+				database_instance
+				left join database_instance_downtime on (
+					database_instance.hostname = database_instance_downtime.hostname
+					and database_instance.port = database_instance_downtime.port
+					and database_instance_downtime.downtime_active = 1
+					and database_instance_downtime.end_timestamp > now()
+				)
+			where
+				database_instance.master_host != ''
+				and database_instance.last_seen >= database_instance.last_checked
+				and database_instance_downtime.hostname is null
+				and not exists (
+					select 1 from database_instance_flag
+					where
+						database_instance_flag.hostname = database_instance.hostname
+						and database_instance_flag.port = database_instance.port
+						and database_instance_flag.instance_flag = ?
+				)
+			group by
+				database_instance.cluster_name
+			`, time.Now().Truncate(time.Minute).Unix(), string(SkipLagChecksFlag),
+		)
+		return log.Errore(err)
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
+
+// ReadClusterLagSamples returns the lag samples of a cluster since given time, oldest first
+func ReadClusterLagSamples(clusterName string, since time.Time) (samples []LagSample, err error) {
+	query := `
+		select
+			cluster_name, sample_unix_timestamp, max_lag_seconds, count_replicas, count_unknown_lag
+		from
+			cluster_lag_sample
+		where
+			cluster_name = ?
+			and sample_unix_timestamp >= ?
+		order by
+			sample_unix_timestamp
+		`
+	err = db.QueryOrchestrator(query, sqlutils.Args(clusterName, since.Unix()), func(m sqlutils.RowMap) error {
+		samples = append(samples, LagSample{
+			ClusterName:         m.GetString("cluster_name"),
+			SampleUnixTimestamp: m.GetInt64("sample_unix_timestamp"),
+			MaxLagSeconds:       m.GetInt64("max_lag_seconds"),
+			CountReplicas:       m.GetUint("count_replicas"),
+			CountUnknownLag:     m.GetUint("count_unknown_lag"),
+		})
+		return nil
+	})
+	return samples, log.Errore(err)
+}
+
+// ReadClusterLagSLOStatus computes the compliance of a cluster with its lag SLO
+func ReadClusterLagSLOStatus(clusterName string) (*LagSLOStatus, error) {
+	clusterInfo, err := ReadClusterInfo(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	lagSLO, found := config.Config.GetLagSLO(clusterInfo.ClusterName, clusterInfo.ClusterAlias)
+	if !found {
+		return nil, fmt.Errorf("No lag SLO configured for cluster %s", clusterName)
+	}
+	now := time.Now()
+	samples, err := ReadClusterLagSamples(clusterInfo.ClusterName, now.Add(-time.Duration(lagSLO.WindowHours)*time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	return NewLagSLOStatus(clusterInfo.ClusterName, clusterInfo.ClusterAlias, lagSLO, samples, now), nil
+}
+
+// ReadLagSLOStatuses computes the compliance of all clusters which have a lag SLO
+func ReadLagSLOStatuses() (statuses []LagSLOStatus, err error) {
+	clustersInfo, err := ReadClustersInfo("")
+	if err != nil {
+		return statuses, err
+	}
+	for _, clusterInfo := range clustersInfo {
+		if _, found := config.Config.GetLagSLO(clusterInfo.ClusterName, clusterInfo.ClusterAlias); !found {
+			continue
+		}
+		status, err := ReadClusterLagSLOStatus(clusterInfo.ClusterName)
+		if err != nil {
+			return statuses, err
+		}
+		statuses = append(statuses, *status)
+	}
+	return statuses, nil
+}
+
+// ExpireClusterLagSamples removes samples which are older than the longest SLO window
+func ExpireClusterLagSamples() error {
+	windowHours := uint(720)
+	for _, lagSLO := range config.Config.LagSLOs {
+		if lagSLO.WindowHours > windowHours {
+			windowHours = lagSLO.WindowHours
+		}
+	}
+	writeFunc := func() error {
+		_, err := db.ExecOrchestrator(`
+				delete from cluster_lag_sample
+				where sample_unix_timestamp < ?
+				`, time.Now().Add(-time.Duration(windowHours)*time.Hour).Unix(),
+		)
+		return log.Errore(err)
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
@@ -64,6 +64,50 @@ func (this *OracleGtidSet) RemoveUUID(uuid string) (removed bool) {
 	return removed
 }
 
+// IsEmpty returns true when the set has no transactions
+func (this *OracleGtidSet) IsEmpty() bool {
+	return len(this.GtidEntries) == 0
+}
+
+// Subtract returns the transactions in this set which are not in given set, as does MySQL's GTID_SUBTRACT()
+func (this *OracleGtidSet) Subtract(other *OracleGtidSet) (*OracleGtidSet, error) {
+	otherIntervals := make(map[string][]gtidInterval)
+	for _, entry := range other.GtidEntries {
+		intervals, err := entry.intervals()
+		if err != nil {
+			return nil, err
+		}
+		uuid := strings.ToLower(entry.UUID)
+		otherIntervals[uuid] = mergeGtidIntervals(append(otherIntervals[uuid], intervals...))
+	}
+	res := &OracleGtidSet{}
+	for _, entry := range this.GtidEntries {
+		intervals, err := entry.intervals()
+		if err != nil {
+			return nil, err
+		}
+		intervals = subtractGtidIntervals(intervals, otherIntervals[strings.ToLower(entry.UUID)])
+		if len(intervals) > 0 {
+			res.GtidEntries = append(res.GtidEntries, &OracleGtidSetEntry{UUID: entry.UUID, Ranges: formatGtidIntervals(intervals)})
+		}
+	}
+	return res, nil
+}
+
+// CountTransactions returns the number of transactions in this set
+func (this *OracleGtidSet) CountTransactions() (count int64, err error) {
+	for _, entry := range this.GtidEntries {
+		intervals, err := entry.intervals()
+		if err != nil {
+			return 0, err
+		}
+		for _, interval := range intervals {
+			count += interval.end - interval.start + 1
+		}
+	}
+	return count, nil
+}
+
 func (this OracleGtidSet) String() string {
 	tokens := []string{}
 	for _, entry := range this.GtidEntries {
@@ -18,6 +18,8 @@ package inst
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -49,3 +51,77 @@ func NewOracleGtidSetEntry(gtidRangeString string) (*OracleGtidSetEntry, error)
 func (this OracleGtidSetEntry) String() string {
 	return fmt.Sprintf("%s:%s", this.UUID, this.Ranges)
 }
+
+// gtidInterval is an inclusive range of transaction numbers, e.g. "8984-6124596"
+type gtidInterval struct {
+	start int64
+	end   int64
+}
+
+// intervals parses the ranges of this entry into sorted, merged intervals
+func (this OracleGtidSetEntry) intervals() (intervals []gtidInterval, err error) {
+	for _, token := range strings.Split(this.Ranges, ":") {
+		bounds := strings.SplitN(strings.TrimSpace(token), "-", 2)
+		interval := gtidInterval{}
+		if interval.start, err = strconv.ParseInt(bounds[0], 10, 64); err != nil {
+			return nil, fmt.Errorf("Cannot parse GTID range %s of %s", token, this.UUID)
+		}
+		interval.end = interval.start
+		if len(bounds) == 2 {
+			if interval.end, err = strconv.ParseInt(bounds[1], 10, 64); err != nil {
+				return nil, fmt.Errorf("Cannot parse GTID range %s of %s", token, this.UUID)
+			}
+		}
+		intervals = append(intervals, interval)
+	}
+	return mergeGtidIntervals(intervals), nil
+}
+
+// mergeGtidIntervals sorts intervals and merges overlapping or adjacent ones
+func mergeGtidIntervals(intervals []gtidInterval) (merged []gtidInterval) {
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i].start < intervals[j].start })
+	for _, interval := range intervals {
+		if len(merged) > 0 && interval.start <= merged[len(merged)-1].end+1 {
+			if interval.end > merged[len(merged)-1].end {
+				merged[len(merged)-1].end = interval.end
+			}
+			continue
+		}
+		merged = append(merged, interval)
+	}
+	return merged
+}
+
+// subtractGtidIntervals returns the transactions in intervals which are not in subtracted
+func subtractGtidIntervals(intervals []gtidInterval, subtracted []gtidInterval) []gtidInterval {
+	for _, s := range subtracted {
+		remaining := []gtidInterval{}
+		for _, interval := range intervals {
+			if s.end < interval.start || s.start > interval.end {
+				remaining = append(remaining, interval)
+				continue
+			}
+			if s.start > interval.start {
+				remaining = append(remaining, gtidInterval{start: interval.start, end: s.start - 1})
+			}
+			if s.end < interval.end {
+				remaining = append(remaining, gtidInterval{start: s.end + 1, end: interval.end})
+			}
+		}
+		intervals = remaining
+	}
+	return intervals
+}
+
+// formatGtidIntervals formats intervals as GTID ranges, e.g. "1-8935:8984-6124596"
+func formatGtidIntervals(intervals []gtidInterval) string {
+	tokens := []string{}
+	for _, interval := range intervals {
+		if interval.start == interval.end {
+			tokens = append(tokens, fmt.Sprintf("%d", interval.start))
+		} else {
+			tokens = append(tokens, fmt.Sprintf("%d-%d", interval.start, interval.end))
+		}
+	}
+	return strings.Join(tokens, ":")
+}
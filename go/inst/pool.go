@@ -52,6 +52,32 @@ type ClusterPoolInstance struct {
 	Port         int
 }
 
+// PoolSpec is a declaration of a managed pool within a cluster: its desired size, eviction
+// of lagging members, and whether orchestrator should backfill the pool with healthy replicas
+type PoolSpec struct {
+	ClusterName   string
+	Pool          string
+	DesiredSize   uint
+	MaxLagSeconds uint // 0 for no lag based eviction
+	AutoBackfill  bool
+}
+
+// PoolMembershipChange describes the membership of a managed pool, as set by orchestrator.
+// Members are (re-)registered onto the pool, Removed are unregistered.
+type PoolMembershipChange struct {
+	ClusterName  string
+	ClusterAlias string
+	Pool         string
+	Members      []InstanceKey
+	Added        []InstanceKey
+	Removed      []InstanceKey
+}
+
+// HasChanges returns true when this change adds or removes pool members
+func (this *PoolMembershipChange) HasChanges() bool {
+	return len(this.Added) > 0 || len(this.Removed) > 0
+}
+
 func ApplyPoolInstances(submission *PoolInstancesSubmission) error {
 	if submission.CreatedAt.Add(time.Duration(config.Config.InstancePoolExpiryMinutes) * time.Minute).Before(time.Now()) {
 		// already expired; no need to persist
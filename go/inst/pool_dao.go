@@ -154,3 +154,90 @@ func ExpirePoolInstances() error {
 	)
 	return log.Errore(err)
 }
+
+// ApplyPoolMembershipChange registers (or refreshes registration of) a pool's members, and unregisters removed instances
+func ApplyPoolMembershipChange(change *PoolMembershipChange) error {
+	writeFunc := func() error {
+		for _, instanceKey := range change.Members {
+			_, err := db.ExecOrchestrator(`
+				insert into database_instance_pool
+						(hostname, port, pool, registered_at)
+					values
+						(?, ?, ?, now())
+					on duplicate key update
+						registered_at=values(registered_at)
+				`, instanceKey.Hostname, instanceKey.Port, change.Pool)
+			if err != nil {
+				return log.Errore(err)
+			}
+		}
+		for _, instanceKey := range change.Removed {
+			_, err := db.ExecOrchestrator(`
+				delete from database_instance_pool where hostname = ? and port = ? and pool = ?
+				`, instanceKey.Hostname, instanceKey.Port, change.Pool)
+			if err != nil {
+				return log.Errore(err)
+			}
+		}
+		return nil
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
+
+// WritePoolSpec declares a managed pool
+func WritePoolSpec(spec *PoolSpec) error {
+	writeFunc := func() error {
+		_, err := db.ExecOrchestrator(`
+			replace into
+					database_instance_pool_spec (cluster_name, pool, desired_size, max_lag_seconds, auto_backfill, last_updated)
+				values
+					(?, ?, ?, ?, ?, now())
+			`,
+			spec.ClusterName, spec.Pool, spec.DesiredSize, spec.MaxLagSeconds, spec.AutoBackfill)
+		return log.Errore(err)
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
+
+// DeletePoolSpec removes a managed pool declaration. Pool membership is unaffected.
+func DeletePoolSpec(clusterName string, pool string) error {
+	writeFunc := func() error {
+		_, err := db.ExecOrchestrator(`
+			delete from database_instance_pool_spec where cluster_name = ? and pool = ?
+			`,
+			clusterName, pool)
+		return log.Errore(err)
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
+
+// ReadPoolSpecs reads managed pool declarations, potentially filtered by cluster name (empty to unfilter)
+func ReadPoolSpecs(clusterName string) (specs []PoolSpec, err error) {
+	specs = []PoolSpec{}
+	query := `
+		select
+			cluster_name,
+			pool,
+			desired_size,
+			max_lag_seconds,
+			auto_backfill
+		from
+			database_instance_pool_spec
+		where
+			? in ('', cluster_name)
+		order by
+			cluster_name, pool
+		`
+	err = db.QueryOrchestrator(query, sqlutils.Args(clusterName), func(m sqlutils.RowMap) error {
+		spec := PoolSpec{
+			ClusterName:   m.GetString("cluster_name"),
+			Pool:          m.GetString("pool"),
+			DesiredSize:   m.GetUint("desired_size"),
+			MaxLagSeconds: m.GetUint("max_lag_seconds"),
+			AutoBackfill:  m.GetBool("auto_backfill"),
+		}
+		specs = append(specs, spec)
+		return nil
+	})
+	return specs, log.Errore(err)
+}
@@ -17,67 +17,119 @@
 package inst
 
 import (
+	"fmt"
+	"strings"
+	"sync"
+
 	"github.com/github/orchestrator/go/db"
 	"github.com/openark/golib/log"
 	"github.com/openark/golib/sqlutils"
 )
 
-// WriteLongRunningProcesses rewrites current state of long running processes for given instance
-func WriteLongRunningProcesses(instanceKey *InstanceKey, processes []Process) error {
-	writeFunc := func() error {
-		_, err := db.ExecOrchestrator(`
+// longRunningProcessesWriteChunkSize is the number of processes written in a single multi-row insert, keeping the
+// number of placeholders within sqlite's limit
+const longRunningProcessesWriteChunkSize = 50
+
+// longRunningProcessesBuffer holds the latest sampled long running processes of instances whose writes are buffered,
+// to be written along with the instance write buffer
+var longRunningProcessesBuffer = make(map[InstanceKey][]Process)
+var longRunningProcessesBufferMutex sync.Mutex
+
+// writeManyLongRunningProcesses rewrites current state of long running processes for given instances, via
+// multi-instance deletes followed by multi-row inserts
+func writeManyLongRunningProcesses(processesByInstance map[InstanceKey][]Process) error {
+	instanceKeys := []InstanceKey{}
+	rows := [][]interface{}{}
+	for instanceKey, processes := range processesByInstance {
+		instanceKeys = append(instanceKeys, instanceKey)
+		for _, process := range processes {
+			rows = append(rows, sqlutils.Args(instanceKey.Hostname, instanceKey.Port, process.Id, process.StartedAt, process.User, process.Host, process.Db, process.Command, process.Time, process.State, process.Info))
+		}
+	}
+	for len(instanceKeys) > 0 {
+		chunk := instanceKeys
+		if len(chunk) > longRunningProcessesWriteChunkSize {
+			chunk = instanceKeys[0:longRunningProcessesWriteChunkSize]
+		}
+		instanceKeys = instanceKeys[len(chunk):]
+
+		instanceConditions := []string{}
+		args := sqlutils.Args()
+		for _, instanceKey := range chunk {
+			instanceConditions = append(instanceConditions, `(hostname = ? and port = ?)`)
+			args = append(args, instanceKey.Hostname, instanceKey.Port)
+		}
+		query := fmt.Sprintf(`
 			delete from
 					database_instance_long_running_queries
 				where
-					hostname = ?
-					and port = ?
-			`,
-			instanceKey.Hostname,
-			instanceKey.Port)
-		if err != nil {
+					%s
+			`, strings.Join(instanceConditions, " or "))
+		if _, err := db.ExecOrchestrator(query, args...); err != nil {
 			return log.Errore(err)
 		}
+	}
+	for len(rows) > 0 {
+		chunk := rows
+		if len(chunk) > longRunningProcessesWriteChunkSize {
+			chunk = rows[0:longRunningProcessesWriteChunkSize]
+		}
+		rows = rows[len(chunk):]
 
-		for _, process := range processes {
-			_, merr := db.ExecOrchestrator(`
-      	insert ignore into database_instance_long_running_queries (
-      		hostname,
-      		port,
-      		process_id,
-      		process_started_at,
-					process_user,
-					process_host,
-					process_db,
-					process_command,
-					process_time_seconds,
-					process_state,
-					process_info
-				) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-				instanceKey.Hostname,
-				instanceKey.Port,
-				process.Id,
-				process.StartedAt,
-				process.User,
-				process.Host,
-				process.Db,
-				process.Command,
-				process.Time,
-				process.State,
-				process.Info,
-			)
-			if merr != nil {
-				err = merr
-			}
+		values := []string{}
+		args := sqlutils.Args()
+		for _, row := range chunk {
+			values = append(values, `(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+			args = append(args, row...)
 		}
-		if err != nil {
+		query := fmt.Sprintf(`
+			insert ignore into database_instance_long_running_queries (
+				hostname,
+				port,
+				process_id,
+				process_started_at,
+				process_user,
+				process_host,
+				process_db,
+				process_command,
+				process_time_seconds,
+				process_state,
+				process_info
+			) values %s
+			`, strings.Join(values, ", "))
+		if _, err := db.ExecOrchestrator(query, args...); err != nil {
 			return log.Errore(err)
 		}
+	}
+	return nil
+}
 
-		return nil
+// WriteLongRunningProcesses rewrites current state of long running processes for given instance
+func WriteLongRunningProcesses(instanceKey *InstanceKey, processes []Process) error {
+	writeFunc := func() error {
+		return writeManyLongRunningProcesses(map[InstanceKey][]Process{*instanceKey: processes})
 	}
 	return ExecDBWriteFunc(writeFunc)
 }
 
+// enqueueLongRunningProcessesWrite buffers the write of given instance's long running processes, to be flushed
+// along with the instance write buffer. A later sample of the same instance replaces a buffered one.
+func enqueueLongRunningProcessesWrite(instanceKey *InstanceKey, processes []Process) {
+	longRunningProcessesBufferMutex.Lock()
+	defer longRunningProcessesBufferMutex.Unlock()
+	longRunningProcessesBuffer[*instanceKey] = processes
+}
+
+// flushLongRunningProcessesBuffer writes the buffered long running processes
+func flushLongRunningProcessesBuffer() error {
+	longRunningProcessesBufferMutex.Lock()
+	processesByInstance := longRunningProcessesBuffer
+	longRunningProcessesBuffer = make(map[InstanceKey][]Process)
+	longRunningProcessesBufferMutex.Unlock()
+
+	return writeManyLongRunningProcesses(processesByInstance)
+}
+
 // ReadLongRunningProcesses returns the list of current known long running processes of all instances
 func ReadLongRunningProcesses(filter string) ([]Process, error) {
 	longRunningProcesses := []Process{}
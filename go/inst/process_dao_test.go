@@ -0,0 +1,93 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+	"testing"
+
+	test "github.com/openark/golib/tests"
+)
+
+func newTestProcesses(count int) []Process {
+	processes := []Process{}
+	for i := 0; i < count; i++ {
+		processes = append(processes, Process{Id: int64(i + 1), User: "app", Host: "app-host:51234", Db: "shop", Command: "Query", Time: int64(100 - i), State: "executing", Info: fmt.Sprintf("select %d", i), StartedAt: "2017-01-02 03:04:05"})
+	}
+	return processes
+}
+
+func TestWriteLongRunningProcesses(t *testing.T) {
+	withSQLiteBackend(t)
+
+	instanceKey := InstanceKey{Hostname: "processes-host", Port: 3306}
+	otherKey := InstanceKey{Hostname: "processes-other", Port: 3306}
+	test.S(t).ExpectNil(WriteLongRunningProcesses(&instanceKey, newTestProcesses(3)))
+	test.S(t).ExpectNil(WriteLongRunningProcesses(&otherKey, newTestProcesses(2)))
+
+	processes, err := ReadLongRunningProcesses("processes-host")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(processes), 3)
+	test.S(t).ExpectEquals(processes[0].Id, int64(1))
+	test.S(t).ExpectEquals(processes[0].Info, "select 0")
+	test.S(t).ExpectEquals(processes[0].Time, int64(100))
+
+	// A later sample replaces the former
+	test.S(t).ExpectNil(WriteLongRunningProcesses(&instanceKey, newTestProcesses(1)))
+	processes, err = ReadLongRunningProcesses("processes-host")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(processes), 1)
+
+	test.S(t).ExpectNil(WriteLongRunningProcesses(&instanceKey, []Process{}))
+	processes, err = ReadLongRunningProcesses("processes-host")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(processes), 0)
+
+	processes, err = ReadLongRunningProcesses("processes-other")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(processes), 2)
+}
+
+func TestFlushLongRunningProcessesBuffer(t *testing.T) {
+	withSQLiteBackend(t)
+
+	instanceKey := InstanceKey{Hostname: "processes-host", Port: 3306}
+	otherKey := InstanceKey{Hostname: "processes-other", Port: 3306}
+	test.S(t).ExpectNil(WriteLongRunningProcesses(&otherKey, newTestProcesses(2)))
+
+	// Spans more than a single insert
+	enqueueLongRunningProcessesWrite(&instanceKey, newTestProcesses(3))
+	enqueueLongRunningProcessesWrite(&instanceKey, newTestProcesses(longRunningProcessesWriteChunkSize+1))
+	enqueueLongRunningProcessesWrite(&otherKey, []Process{})
+	for i := 0; i < longRunningProcessesWriteChunkSize; i++ {
+		enqueueLongRunningProcessesWrite(&InstanceKey{Hostname: fmt.Sprintf("processes-idle-%d", i), Port: 3306}, []Process{})
+	}
+	test.S(t).ExpectNil(flushLongRunningProcessesBuffer())
+
+	processes, err := ReadLongRunningProcesses("processes-host")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(processes), longRunningProcessesWriteChunkSize+1)
+	processes, err = ReadLongRunningProcesses("processes-other")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(processes), 0)
+
+	// Nothing buffered
+	test.S(t).ExpectNil(flushLongRunningProcessesBuffer())
+	processes, err = ReadLongRunningProcesses("processes-host")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(processes), longRunningProcessesWriteChunkSize+1)
+}
@@ -0,0 +1,108 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"github.com/github/orchestrator/go/config"
+)
+
+// PromotionPoolPreference is the preference for promoting an instance, as implied by its pool membership
+// and PromotionPools configuration
+type PromotionPoolPreference string
+
+const (
+	FailoverPoolPreference PromotionPoolPreference = "failover-pool"
+	NeutralPoolPreference  PromotionPoolPreference = "neutral"
+	AvoidPoolPreference    PromotionPoolPreference = "avoid"
+)
+
+var promotionPoolPreferenceOrderMap = map[PromotionPoolPreference]int{
+	FailoverPoolPreference: 0,
+	NeutralPoolPreference:  1,
+	AvoidPoolPreference:    2,
+}
+
+// BetterThan returns true when this preference favors promotion more than the other
+func (this PromotionPoolPreference) BetterThan(other PromotionPoolPreference) bool {
+	return promotionPoolPreferenceOrderMap[this] < promotionPoolPreferenceOrderMap[other]
+}
+
+// PromotionPoolPreferences maps instances onto their pool-aware promotion preference
+type PromotionPoolPreferences map[InstanceKey]PromotionPoolPreference
+
+// Get returns the preference of given instance. Instances with no preference are neutral.
+func (this PromotionPoolPreferences) Get(instanceKey *InstanceKey) PromotionPoolPreference {
+	if preference, ok := this[*instanceKey]; ok {
+		return preference
+	}
+	return NeutralPoolPreference
+}
+
+// getPromotionPoolPreference evaluates the preference of an instance given the pools it is a member of.
+// Membership in the failover pool overrides membership in avoided pools.
+func getPromotionPoolPreference(pools []string, promotionPools config.PromotionPoolsConfiguration) PromotionPoolPreference {
+	preference := NeutralPoolPreference
+	for _, pool := range pools {
+		if promotionPools.FailoverPool != "" && pool == promotionPools.FailoverPool {
+			return FailoverPoolPreference
+		}
+		for _, avoidPool := range promotionPools.AvoidPools {
+			if pool == avoidPool {
+				preference = AvoidPoolPreference
+			}
+		}
+	}
+	return preference
+}
+
+// ReadInstancesPools reads the pools which the instances of given cluster are members of
+func ReadInstancesPools(clusterName string) (instancesPools map[InstanceKey][]string, clusterAlias string, err error) {
+	instancesPools = make(map[InstanceKey][]string)
+	clusterPoolInstances, err := ReadClusterPoolInstances(clusterName, "")
+	if err != nil {
+		return instancesPools, clusterAlias, err
+	}
+	for _, clusterPoolInstance := range clusterPoolInstances {
+		instanceKey := InstanceKey{Hostname: clusterPoolInstance.Hostname, Port: clusterPoolInstance.Port}
+		instancesPools[instanceKey] = append(instancesPools[instanceKey], clusterPoolInstance.Pool)
+		clusterAlias = clusterPoolInstance.ClusterAlias
+	}
+	return instancesPools, clusterAlias, nil
+}
+
+// ReadPromotionPoolPreferences evaluates the pool-aware promotion preference of the pool members of given cluster,
+// as configured by PromotionPools. Instances which are not listed are neutral.
+func ReadPromotionPoolPreferences(clusterName string) (preferences PromotionPoolPreferences, err error) {
+	preferences = make(PromotionPoolPreferences)
+	if len(config.Config.PromotionPools) == 0 {
+		return preferences, nil
+	}
+	instancesPools, clusterAlias, err := ReadInstancesPools(clusterName)
+	if err != nil {
+		return preferences, err
+	}
+	promotionPools, found := config.Config.GetPromotionPools(clusterName, clusterAlias)
+	if !found {
+		return preferences, nil
+	}
+	for instanceKey, pools := range instancesPools {
+		if preference := getPromotionPoolPreference(pools, promotionPools); preference != NeutralPoolPreference {
+			preferences[instanceKey] = preference
+		}
+	}
+	return preferences, nil
+}
@@ -0,0 +1,93 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"database/sql"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/openark/golib/log"
+)
+
+// defaultPromotionVetoReason is the reason of a veto whose result row has no reason
+const defaultPromotionVetoReason = "vetoed by PromotionVetoQuery"
+
+// CheckPromotionVeto runs PromotionVetoQuery on given promotion candidate. A non-empty result vetoes the promotion
+// of the candidate; the first column of the first row is the reason.
+func CheckPromotionVeto(instanceKey *InstanceKey) (vetoed bool, reason string, err error) {
+	if config.Config.PromotionVetoQuery == "" {
+		return false, "", nil
+	}
+	sqlDB, err := db.OpenTopology(instanceKey.Hostname, instanceKey.Port)
+	if err != nil {
+		return false, "", err
+	}
+	rows, err := sqlDB.Query(config.Config.PromotionVetoQuery)
+	if err != nil {
+		return false, "", err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return false, "", rows.Err()
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		return false, "", err
+	}
+	values := make([]sql.NullString, len(columns))
+	scanArgs := make([]interface{}, len(columns))
+	for i := range values {
+		scanArgs[i] = &values[i]
+	}
+	if err := rows.Scan(scanArgs...); err != nil {
+		return false, "", err
+	}
+	reason = defaultPromotionVetoReason
+	if len(values) > 0 && values[0].String != "" {
+		reason = values[0].String
+	}
+	return true, reason, nil
+}
+
+// IsVetoedFromPromotion checks whether PromotionVetoQuery vetoes promotion of given instance, and audits the veto.
+// A failing query does not veto: an organization's ops database being unavailable must not prevent a failover.
+func IsVetoedFromPromotion(instance *Instance) bool {
+	vetoed, reason, err := CheckPromotionVeto(&instance.Key)
+	if err != nil {
+		log.Errorf("PromotionVetoQuery failed on %+v; not vetoing its promotion: %+v", instance.Key, err)
+		return false
+	}
+	if vetoed {
+		log.Infof("Promotion of %+v is vetoed: %s", instance.Key, reason)
+		AuditOperation("promotion-veto", &instance.Key, reason)
+	}
+	return vetoed
+}
+
+// newPromotionVetoCheck returns a function checking for promotion vetoes, running PromotionVetoQuery at most
+// once per instance
+func newPromotionVetoCheck() func(*Instance) bool {
+	vetoes := make(map[InstanceKey]bool)
+	return func(instance *Instance) bool {
+		if vetoed, ok := vetoes[instance.Key]; ok {
+			return vetoed
+		}
+		vetoes[instance.Key] = IsVetoedFromPromotion(instance)
+		return vetoes[instance.Key]
+	}
+}
@@ -0,0 +1,88 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+
+	"github.com/github/orchestrator/go/config"
+)
+
+// UnreconciledReplicaProblem describes how a replica connected to a master disagrees with orchestrator's view
+type UnreconciledReplicaProblem string
+
+const (
+	// UnregisteredReplicaProblem is a replica connected to a master, yet unknown to orchestrator (aka ghost replica)
+	UnregisteredReplicaProblem UnreconciledReplicaProblem = "unregistered"
+	// ReplicatingElsewhereProblem is a replica connected to a master, while orchestrator has it replicating from another
+	ReplicatingElsewhereProblem UnreconciledReplicaProblem = "replicating-elsewhere"
+)
+
+// UnreconciledReplica is a replica listed as connected by a master (via SHOW SLAVE HOSTS or the processlist),
+// which does not match the replicas orchestrator knows of that master
+type UnreconciledReplica struct {
+	Key               InstanceKey
+	MasterKey         InstanceKey
+	ClusterName       string
+	Problem           UnreconciledReplicaProblem
+	ReportedMasterKey InstanceKey // For a replica replicating elsewhere: its master, as known to orchestrator
+}
+
+// String returns a string representation of the unreconciled replica
+func (this *UnreconciledReplica) String() string {
+	if this.Problem == ReplicatingElsewhereProblem {
+		return fmt.Sprintf("%+v: connected to %+v, known to replicate from %+v", this.Key, this.MasterKey, this.ReportedMasterKey)
+	}
+	return fmt.Sprintf("%+v: connected to %+v, %s", this.Key, this.MasterKey, this.Problem)
+}
+
+// reconcileReplicas compares the replicas a master lists as connected with orchestrator's view of them. lookup
+// returns the known instance of a given key, if any. A connected replica is reconciled when it is known to
+// replicate from the master; when discovered via the processlist, a replica's port is guessed, hence a known
+// replica of the master sharing its hostname reconciles it as well. Replicas ignored via
+// DiscoveryIgnoreReplicaHostnameFilters are never reported.
+func reconcileReplicas(master *Instance, knownReplicas [](*Instance), lookup func(key *InstanceKey) *Instance) (unreconciled []UnreconciledReplica) {
+	unreconciled = []UnreconciledReplica{}
+	if !master.IsLastCheckValid {
+		return unreconciled
+	}
+	knownReplicaHostnames := make(map[string]bool)
+	for _, replica := range knownReplicas {
+		knownReplicaHostnames[replica.Key.Hostname] = true
+	}
+	for _, replicaKey := range master.SlaveHosts.GetInstanceKeys() {
+		replicaKey := replicaKey
+		if RegexpMatchPatterns(replicaKey.Hostname, config.Config.DiscoveryIgnoreReplicaHostnameFilters) {
+			continue
+		}
+		entry := UnreconciledReplica{Key: replicaKey, MasterKey: master.Key, ClusterName: master.ClusterName}
+		if replica := lookup(&replicaKey); replica != nil {
+			if replica.MasterKey.Equals(&master.Key) || !replica.IsLastCheckValid {
+				continue
+			}
+			entry.Problem = ReplicatingElsewhereProblem
+			entry.ReportedMasterKey = replica.MasterKey
+		} else {
+			if knownReplicaHostnames[replicaKey.Hostname] {
+				continue
+			}
+			entry.Problem = UnregisteredReplicaProblem
+		}
+		unreconciled = append(unreconciled, entry)
+	}
+	return unreconciled
+}
@@ -0,0 +1,74 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"github.com/openark/golib/log"
+)
+
+// ReadUnreconciledReplicas reconciles the replicas each master of given cluster lists as connected with the
+// replicas known to orchestrator, and returns those which do not match. A master here is any instance with
+// connected replicas, including intermediate masters.
+func ReadUnreconciledReplicas(clusterName string) (unreconciled []UnreconciledReplica, err error) {
+	unreconciled = []UnreconciledReplica{}
+	instances, err := ReadClusterInstances(clusterName)
+	if err != nil {
+		return unreconciled, err
+	}
+	instancesMap := make(map[InstanceKey]*Instance)
+	replicasMap := make(map[InstanceKey][](*Instance))
+	for _, instance := range instances {
+		instancesMap[instance.Key] = instance
+		replicasMap[instance.MasterKey] = append(replicasMap[instance.MasterKey], instance)
+	}
+	lookup := func(key *InstanceKey) *Instance {
+		if instance, ok := instancesMap[*key]; ok {
+			return instance
+		}
+		// The replica may be known as a member of another cluster
+		instance, found, err := ReadInstance(key)
+		if err != nil || !found {
+			return nil
+		}
+		return instance
+	}
+	for _, instance := range instances {
+		if len(instance.SlaveHosts) == 0 {
+			continue
+		}
+		unreconciled = append(unreconciled, reconcileReplicas(instance, replicasMap[instance.Key], lookup)...)
+	}
+	return unreconciled, nil
+}
+
+// ReadAllUnreconciledReplicas returns the unreconciled replicas of all clusters
+func ReadAllUnreconciledReplicas() (unreconciled []UnreconciledReplica, err error) {
+	unreconciled = []UnreconciledReplica{}
+	clusterNames, err := ReadClusters()
+	if err != nil {
+		return unreconciled, err
+	}
+	for _, clusterName := range clusterNames {
+		clusterUnreconciled, err := ReadUnreconciledReplicas(clusterName)
+		if err != nil {
+			log.Errore(err)
+			continue
+		}
+		unreconciled = append(unreconciled, clusterUnreconciled...)
+	}
+	return unreconciled, nil
+}
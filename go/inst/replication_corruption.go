@@ -0,0 +1,156 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/openark/golib/log"
+)
+
+// Replication errors (Last_IO_Errno, Last_SQL_Errno) which indicate corrupted relay logs or binary logs
+const (
+	errnoMasterFatalErrorReadingBinlog       = 1236
+	errnoSlaveRelayLogReadFailure            = 1594
+	errnoSlaveRelayLogWriteFailure           = 1595
+	errnoNetworkReadEventChecksumFailure     = 1743
+	errnoBinlogReadEventChecksumFailure      = 1744
+	errnoServerMasterFatalErrorReadingBinlog = 13114
+)
+
+// binlogCorruptionErrorRegexp tells a corrupted master binary log apart from other reasons the master fails
+// serving its binary log, e.g. purged binary logs
+var binlogCorruptionErrorRegexp = regexp.MustCompile(`(?i)corrupt|checksum|crc check|bogus data|binlog truncated|event entry exceeded max_allowed_packet|could not parse`)
+
+type ReplicationCorruption string
+
+const (
+	NoReplicationCorruption ReplicationCorruption = ""
+	RelayLogCorruption      ReplicationCorruption = "relay-log"
+	BinlogCorruption        ReplicationCorruption = "binlog"
+)
+
+// GetReplicationCorruption classifies a replica's replication errors. RelayLogCorruption means the replica's relay
+// log cannot be read or written, or an event got corrupted in transit: the master's binary log is intact, and the
+// replica may fetch it anew. BinlogCorruption means the master fails serving its binary log, which is corrupted:
+// the replica must replicate from elsewhere.
+func GetReplicationCorruption(lastIOErrno uint, lastSQLErrno uint, lastIOError string) ReplicationCorruption {
+	switch lastIOErrno {
+	case errnoMasterFatalErrorReadingBinlog, errnoServerMasterFatalErrorReadingBinlog:
+		if binlogCorruptionErrorRegexp.MatchString(lastIOError) {
+			return BinlogCorruption
+		}
+	case errnoSlaveRelayLogWriteFailure, errnoNetworkReadEventChecksumFailure:
+		return RelayLogCorruption
+	}
+	switch lastSQLErrno {
+	case errnoSlaveRelayLogReadFailure, errnoBinlogReadEventChecksumFailure:
+		return RelayLogCorruption
+	}
+	return NoReplicationCorruption
+}
+
+// ReplicationCorruption classifies this instance's replication errors
+func (this *Instance) ReplicationCorruption() ReplicationCorruption {
+	return GetReplicationCorruption(this.LastIOErrno, this.LastSQLErrno, this.LastIOError)
+}
+
+// RepairReplicationCorruption remediates a replica's relay log or binary log corruption. On relay log corruption,
+// relay logs are purged, and the replica fetches anew from its master, starting at its executed coordinates (or
+// GTID set). On binary log corruption, the replica is relocated below a healthy sibling which has already
+// replicated past the replica's position, using GTID, Pseudo-GTID or binlog servers as available.
+func RepairReplicationCorruption(instanceKey *InstanceKey) (*Instance, error) {
+	instance, err := ReadTopologyInstance(instanceKey)
+	if err != nil {
+		return instance, err
+	}
+	if !instance.IsReplica() {
+		return instance, fmt.Errorf("instance is not a replica: %+v", *instanceKey)
+	}
+	switch instance.ReplicationCorruption() {
+	case RelayLogCorruption:
+		return repairRelayLogCorruption(instance)
+	case BinlogCorruption:
+		return repairBinlogCorruption(instance)
+	}
+	return instance, fmt.Errorf("No relay log or binary log corruption found on %+v", *instanceKey)
+}
+
+func repairRelayLogCorruption(instance *Instance) (*Instance, error) {
+	instanceKey := &instance.Key
+	log.Infof("Will purge relay logs on %+v and refetch from %+v, %+v", *instanceKey, instance.MasterKey, instance.ExecBinlogCoordinates)
+
+	var err error
+	if maintenanceToken, merr := BeginMaintenance(instanceKey, GetMaintenanceOwner(), "repair relay log corruption"); merr != nil {
+		return instance, fmt.Errorf("Cannot begin maintenance on %+v: %v", *instanceKey, merr)
+	} else {
+		defer EndMaintenance(maintenanceToken)
+	}
+
+	instance, err = StopSlave(instanceKey)
+	if err != nil {
+		return instance, log.Errore(err)
+	}
+	// CHANGE MASTER TO purges the relay logs. The master and executed coordinates are unchanged, so this is safe
+	// whether or not the replica uses GTID.
+	instance, err = ChangeMasterTo(instanceKey, &instance.MasterKey, &instance.ExecBinlogCoordinates, false, GTIDHintNeutral)
+	if err != nil {
+		StartSlave(instanceKey)
+		return instance, log.Errore(err)
+	}
+	instance, err = StartSlave(instanceKey)
+	if err != nil {
+		return instance, log.Errore(err)
+	}
+	AuditOperation("repair-relay-log-corruption", instanceKey, fmt.Sprintf("purged relay logs; replicating from %+v at %+v", instance.MasterKey, instance.ExecBinlogCoordinates))
+	return instance, nil
+}
+
+func repairBinlogCorruption(instance *Instance) (*Instance, error) {
+	siblings, err := ReadReplicaInstances(&instance.MasterKey)
+	if err != nil {
+		return instance, err
+	}
+	var healthySibling *Instance
+	for _, sibling := range siblings {
+		if sibling.Key.Equals(&instance.Key) {
+			continue
+		}
+		if !sibling.IsLastCheckValid || !sibling.ReplicaRunning() || !sibling.LogBinEnabled || !sibling.LogSlaveUpdatesEnabled {
+			continue
+		}
+		if !instance.ExecBinlogCoordinates.SmallerThan(&sibling.ExecBinlogCoordinates) {
+			// Sibling has not replicated past the corrupted position
+			continue
+		}
+		if healthySibling == nil || healthySibling.ExecBinlogCoordinates.SmallerThan(&sibling.ExecBinlogCoordinates) {
+			healthySibling = sibling
+		}
+	}
+	if healthySibling == nil {
+		return instance, fmt.Errorf("Binary log of %+v seems corrupted, but found no healthy sibling of %+v, replicating past %+v, to relocate it below", instance.MasterKey, instance.Key, instance.ExecBinlogCoordinates)
+	}
+	log.Infof("Binary log of %+v seems corrupted; will relocate %+v below %+v", instance.MasterKey, instance.Key, healthySibling.Key)
+
+	instance, err = RelocateBelow(&instance.Key, &healthySibling.Key)
+	if err != nil {
+		return instance, log.Errore(err)
+	}
+	AuditOperation("repair-binlog-corruption", &instance.Key, fmt.Sprintf("relocated below %+v", healthySibling.Key))
+	return instance, nil
+}
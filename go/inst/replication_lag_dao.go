@@ -0,0 +1,105 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"database/sql"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/openark/golib/log"
+)
+
+// applierLagQuery computes replication lag from the original commit timestamps of the transactions replication
+// applier workers are applying, as of MySQL 8.0. Idle appliers have no lag. No rows (not a replica), or no running
+// applier, means no reading.
+const applierLagQuery = `
+	select
+		if(sum(service_state = 'ON') > 0,
+			max(
+				if(applying_transaction = '',
+					0,
+					timestampdiff(second, nullif(applying_transaction_original_commit_timestamp, 0), now(6))
+				)
+			),
+			null
+		) as lag_seconds
+	from
+		performance_schema.replication_applier_status_by_worker
+	`
+
+// isApplierLagReadable checks whether an instance's lag can be read off its appliers. This requires MySQL 8.0
+// or above. Appliers of a replica whose replication threads are stopped are idle, and so only a replicating
+// replica has a meaningful applier lag.
+func isApplierLagReadable(instance *Instance) bool {
+	if instance.IsMariaDB() || instance.IsSmallerMajorVersionByString("8.0") {
+		return false
+	}
+	return instance.ReplicaRunning()
+}
+
+// replicationLagSources returns the ordered lag sources of the cluster an instance belonged to as of its last
+// read. Instances not yet known use the "*" configuration.
+func replicationLagSources(instanceKey *InstanceKey) []string {
+	if len(config.Config.ReplicationLagSources) == 0 {
+		return config.Config.GetReplicationLagSources("", "")
+	}
+	clusterName, _ := GetClusterName(instanceKey)
+	clusterAlias := ""
+	if clusterName != "" {
+		clusterAlias, _ = ReadAliasByClusterName(clusterName)
+	}
+	return config.Config.GetReplicationLagSources(clusterName, clusterAlias)
+}
+
+// readReplicationLag reads an instance's replication lag off the first of its lag sources which produces a reading,
+// noting which source that is. Seconds_Behind_Master is expected to be read beforehand.
+func readReplicationLag(db *sql.DB, instance *Instance) {
+	instance.SlaveLagSeconds = sql.NullInt64{}
+	instance.ReplicationLagSource = ""
+	for _, lagSource := range replicationLagSources(&instance.Key) {
+		var lagSeconds sql.NullInt64
+		var err error
+		switch lagSource {
+		case config.ReplicationLagSourceHeartbeat:
+			if config.Config.ReplicationLagQuery == "" {
+				continue
+			}
+			err = db.QueryRow(config.Config.ReplicationLagQuery).Scan(&lagSeconds)
+		case config.ReplicationLagSourceApplier:
+			if !isApplierLagReadable(instance) {
+				continue
+			}
+			err = db.QueryRow(applierLagQuery).Scan(&lagSeconds)
+		case config.ReplicationLagSourceSecondsBehindMaster:
+			lagSeconds = instance.SecondsBehindMaster
+		}
+		if err != nil {
+			logReadTopologyInstanceError(&instance.Key, lagSource, err)
+			continue
+		}
+		if !lagSeconds.Valid {
+			continue
+		}
+		if lagSeconds.Int64 < 0 {
+			log.Warningf("Host: %+v, %s lag < 0 [%+v], correcting to 0", instance.Key, lagSource, lagSeconds.Int64)
+			lagSeconds.Int64 = 0
+		}
+		instance.SlaveLagSeconds = lagSeconds
+		instance.ReplicationLagSource = lagSource
+		return
+	}
+}
@@ -0,0 +1,160 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/openark/golib/log"
+)
+
+// ReplicationThread is either of a replica's IO thread or SQL thread
+type ReplicationThread string
+
+const (
+	IOThread  ReplicationThread = "io_thread"
+	SQLThread ReplicationThread = "sql_thread"
+)
+
+// ReplicationThreadAction is the action taken on a replication thread
+type ReplicationThreadAction string
+
+const (
+	StartReplicationThreadAction ReplicationThreadAction = "start"
+	StopReplicationThreadAction  ReplicationThreadAction = "stop"
+)
+
+var replicationChannelNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,64}$`)
+
+// ReplicationThreadResult is the outcome of a replication thread action on a single replica, as part of a bulk action
+type ReplicationThreadResult struct {
+	Key      InstanceKey
+	Instance *Instance
+	Error    string
+}
+
+// ParseReplicationThread parses "io", "io_thread", "sql" or "sql_thread" (case insensitive)
+func ParseReplicationThread(thread string) (ReplicationThread, error) {
+	switch strings.Replace(strings.ToLower(thread), "-", "_", -1) {
+	case "io", "io_thread":
+		return IOThread, nil
+	case "sql", "sql_thread":
+		return SQLThread, nil
+	}
+	return "", fmt.Errorf("Unknown replication thread: %s. Expected io or sql", thread)
+}
+
+// replicationThreadStatement returns the statement starting or stopping a replication thread on given instance,
+// optionally on a named replication channel (MySQL 5.7 multi-source) or connection (MariaDB multi-source)
+func replicationThreadStatement(instance *Instance, action ReplicationThreadAction, thread ReplicationThread, channel string) (string, error) {
+	if action != StartReplicationThreadAction && action != StopReplicationThreadAction {
+		return "", fmt.Errorf("Unknown replication thread action: %s", action)
+	}
+	if thread != IOThread && thread != SQLThread {
+		return "", fmt.Errorf("Unknown replication thread: %s", thread)
+	}
+	if channel == "" {
+		return fmt.Sprintf("%s slave %s", action, thread), nil
+	}
+	if !replicationChannelNameRegexp.MatchString(channel) {
+		return "", fmt.Errorf("Invalid replication channel name: %s", channel)
+	}
+	if instance.IsMariaDB() {
+		if instance.IsSmallerMajorVersionByString("10.0") {
+			return "", fmt.Errorf("%+v does not support multi-source replication", instance.Key)
+		}
+		return fmt.Sprintf("%s slave '%s' %s", action, channel, thread), nil
+	}
+	if instance.IsSmallerMajorVersionByString("5.7") {
+		return "", fmt.Errorf("%+v does not support replication channels", instance.Key)
+	}
+	return fmt.Sprintf("%s slave %s for channel '%s'", action, thread, channel), nil
+}
+
+// ChangeReplicationThread starts or stops a single replication thread on given replica, leaving the other
+// thread as is. Stopping the SQL thread freezes apply, while the IO thread keeps pulling from the master.
+func ChangeReplicationThread(instanceKey *InstanceKey, action ReplicationThreadAction, thread ReplicationThread, channel string) (*Instance, error) {
+	instance, err := ReadTopologyInstance(instanceKey)
+	if err != nil {
+		return instance, log.Errore(err)
+	}
+	if !instance.IsReplica() {
+		return instance, fmt.Errorf("instance is not a replica: %+v", instanceKey)
+	}
+	statement, err := replicationThreadStatement(instance, action, thread, channel)
+	if err != nil {
+		return instance, log.Errore(err)
+	}
+	if action == StartReplicationThreadAction && thread == IOThread && instance.SemiSyncEnforced {
+		// As with START SLAVE: only promotable replicas send semi-sync ACKs
+		sendACK := instance.PromotionRule != MustNotPromoteRule
+		if err := EnableSemiSync(instanceKey, false, sendACK); err != nil {
+			return instance, log.Errore(err)
+		}
+	}
+	if _, err := ExecInstance(instanceKey, statement); err != nil {
+		return instance, log.Errore(err)
+	}
+	log.Infof("Issued %s on %+v", statement, *instanceKey)
+
+	instance, err = ReadTopologyInstance(instanceKey)
+	return instance, err
+}
+
+// ChangeClusterReplicationThreads starts or stops a single replication thread on all replicas of a cluster,
+// concurrently. Failure on one replica does not affect others; results are listed per replica.
+func ChangeClusterReplicationThreads(clusterName string, action ReplicationThreadAction, thread ReplicationThread, channel string) (results []ReplicationThreadResult, err error) {
+	instances, err := ReadClusterInstances(clusterName)
+	if err != nil {
+		return results, err
+	}
+	replicas := [](*Instance){}
+	for _, instance := range instances {
+		if instance.IsReplica() {
+			replicas = append(replicas, instance)
+		}
+	}
+	barrier := make(chan ReplicationThreadResult)
+	for _, replica := range replicas {
+		replicaKey := replica.Key
+		go func() {
+			result := ReplicationThreadResult{Key: replicaKey}
+			defer func() { barrier <- result }()
+			ExecuteOnTopology(func() {
+				instance, err := ChangeReplicationThread(&replicaKey, action, thread, channel)
+				result.Instance = instance
+				if err != nil {
+					result.Error = err.Error()
+				}
+			})
+		}()
+	}
+	countFailed := 0
+	for range replicas {
+		result := <-barrier
+		if result.Error != "" {
+			countFailed++
+		}
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Key.StringCode() < results[j].Key.StringCode() })
+	AuditOperation(fmt.Sprintf("%s-cluster-%s", action, strings.Replace(string(thread), "_", "-", -1)), nil, fmt.Sprintf("cluster %s, channel '%s': %d replicas, %d failed", clusterName, channel, len(replicas), countFailed))
+	return results, nil
+}
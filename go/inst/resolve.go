@@ -22,8 +22,9 @@ import (
 	"github.com/github/orchestrator/go/config"
 	"github.com/openark/golib/log"
 	"github.com/patrickmn/go-cache"
-	"net"
+	"github.com/rcrowley/go-metrics"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -38,6 +39,24 @@ func (this HostnameResolve) String() string {
 	return fmt.Sprintf("%s %s", this.hostname, this.resolvedHostname)
 }
 
+// HostnameResolveSeed is an explicitly provided resolve of a hostname. Seeds take precedence over
+// resolving the hostname, and do not expire.
+type HostnameResolveSeed struct {
+	Hostname         string
+	ResolvedHostname string
+	SeededTimestamp  string
+}
+
+// HostnameResolveCacheStats summarizes the use of the hostname resolve cache since startup
+type HostnameResolveCacheStats struct {
+	CountEntries int
+	CountSeeds   int
+	Hits         int64
+	Misses       int64
+	Failures     int64
+	HitRate      float64
+}
+
 type HostnameUnresolve struct {
 	hostname           string
 	unresolvedHostname string
@@ -73,8 +92,16 @@ var hostnameResolvesLightweightCache *cache.Cache
 var hostnameResolvesLightweightCacheInit = &sync.Mutex{}
 var hostnameResolvesLightweightCacheLoadedOnceFromDB bool = false
 var hostnameIPsCache = cache.New(10*time.Minute, time.Minute)
+var hostnameResolveSeedsCache = cache.New(cache.NoExpiration, time.Minute)
+
+var resolveCacheHitsCounter = metrics.NewCounter()
+var resolveCacheMissesCounter = metrics.NewCounter()
+var resolveFailuresCounter = metrics.NewCounter()
 
 func init() {
+	metrics.Register("resolve.cache_hits", resolveCacheHitsCounter)
+	metrics.Register("resolve.cache_misses", resolveCacheMissesCounter)
+	metrics.Register("resolve.failures", resolveFailuresCounter)
 	if config.Config.ExpiryHostnameResolvesMinutes < 1 {
 		config.Config.ExpiryHostnameResolvesMinutes = 1
 	}
@@ -95,7 +122,7 @@ func HostnameResolveMethodIsNone() bool {
 
 // GetCNAME resolves an IP or hostname into a normalized valid CNAME
 func GetCNAME(hostname string) (string, error) {
-	res, err := net.LookupCNAME(hostname)
+	res, err := lookupCNAME(hostname)
 	if err != nil {
 		return hostname, err
 	}
@@ -104,6 +131,7 @@ func GetCNAME(hostname string) (string, error) {
 }
 
 func resolveHostname(hostname string) (string, error) {
+	hostname = rewriteHostname(hostname)
 	switch strings.ToLower(config.Config.HostnameResolveMethod) {
 	case "none":
 		return hostname, nil
@@ -112,6 +140,9 @@ func resolveHostname(hostname string) (string, error) {
 	case "cname":
 		return GetCNAME(hostname)
 	}
+	if resolver, found := getHostnameResolver(config.Config.HostnameResolveMethod); found {
+		return resolver(hostname)
+	}
 	return hostname, nil
 }
 
@@ -131,10 +162,22 @@ func ResolveHostname(hostname string) (string, error) {
 		return hostname, nil
 	}
 
+	// Seeds take precedence over anything else
+	if resolvedHostname, found := hostnameResolveSeedsCache.Get(hostname); found {
+		resolveCacheHitsCounter.Inc(1)
+		return resolvedHostname.(string), nil
+	}
+	// Static resolves apply ahead of cached resolves, and are not cached themselves, such that changes to
+	// HostnameResolveStaticMap or to HostnameResolveHostsFile apply at once
+	if resolvedHostname, found := staticResolveHostname(rewriteHostname(hostname)); found {
+		return resolvedHostname, nil
+	}
 	// First go to lightweight cache
 	if resolvedHostname, found := getHostnameResolvesLightweightCache().Get(hostname); found {
+		resolveCacheHitsCounter.Inc(1)
 		return resolvedHostname.(string), nil
 	}
+	resolveCacheMissesCounter.Inc(1)
 
 	if !hostnameResolvesLightweightCacheLoadedOnceFromDB {
 		// A continuous-discovery will first make sure to load all resolves from DB.
@@ -162,6 +205,7 @@ func ResolveHostname(hostname string) (string, error) {
 	}
 
 	if err != nil {
+		resolveFailuresCounter.Inc(1)
 		// Problem. What we'll do is cache the hostname for just one minute, so as to avoid flooding requests
 		// on one hand, yet make it refresh shortly on the other hand. Anyway do not write to database.
 		getHostnameResolvesLightweightCache().Set(hostname, resolvedHostname, time.Minute)
@@ -191,6 +235,9 @@ func UpdateResolvedHostname(hostname string, resolvedHostname string) bool {
 }
 
 func LoadHostnameResolveCache() error {
+	if err := loadHostnameResolveSeeds(); err != nil {
+		return err
+	}
 	if !HostnameResolveMethodIsNone() {
 		return loadHostnameResolveCacheFromDatabase()
 	}
@@ -209,6 +256,25 @@ func loadHostnameResolveCacheFromDatabase() error {
 	return nil
 }
 
+// loadHostnameResolveSeeds reads the seeds from the backend database, replacing those in memory
+func loadHostnameResolveSeeds() error {
+	seeds, err := ReadHostnameResolveSeeds()
+	if err != nil {
+		return err
+	}
+	seedsMap := make(map[string]bool)
+	for _, seed := range seeds {
+		hostnameResolveSeedsCache.Set(seed.Hostname, seed.ResolvedHostname, cache.NoExpiration)
+		seedsMap[seed.Hostname] = true
+	}
+	for hostname := range hostnameResolveSeedsCache.Items() {
+		if !seedsMap[hostname] {
+			hostnameResolveSeedsCache.Delete(hostname)
+		}
+	}
+	return nil
+}
+
 func FlushNontrivialResolveCacheToDatabase() error {
 	if HostnameResolveMethodIsNone() {
 		return log.Errorf("FlushNontrivialResolveCacheToDatabase() called, but HostnameResolveMethod is %+v", config.Config.HostnameResolveMethod)
@@ -234,6 +300,81 @@ func HostnameResolveCache() (map[string]cache.Item, error) {
 	return getHostnameResolvesLightweightCache().Items(), nil
 }
 
+// ReadHostnameResolveCacheStats returns the size of the hostname resolve cache, along with its hits, misses
+// and resolution failures since startup
+func ReadHostnameResolveCacheStats() HostnameResolveCacheStats {
+	stats := HostnameResolveCacheStats{
+		CountEntries: getHostnameResolvesLightweightCache().ItemCount(),
+		CountSeeds:   hostnameResolveSeedsCache.ItemCount(),
+		Hits:         resolveCacheHitsCounter.Count(),
+		Misses:       resolveCacheMissesCounter.Count(),
+		Failures:     resolveFailuresCounter.Count(),
+	}
+	if stats.Hits+stats.Misses > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(stats.Hits+stats.Misses)
+	}
+	return stats
+}
+
+// InvalidateHostnameResolves removes from cache and from the backend database all resolves where either the
+// hostname or the resolved hostname match given regular expression. These hostnames are resolved anew upon
+// next use. Seeds are unaffected.
+func InvalidateHostnameResolves(pattern string) (invalidated []string, err error) {
+	invalidated = []string{}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return invalidated, err
+	}
+	hostnames := make(map[string]bool)
+	for hostname, item := range getHostnameResolvesLightweightCache().Items() {
+		if re.MatchString(hostname) || re.MatchString(item.Object.(string)) {
+			hostnames[hostname] = true
+		}
+	}
+	resolves, err := ReadAllHostnameResolves()
+	if err != nil {
+		return invalidated, err
+	}
+	for _, resolve := range resolves {
+		if re.MatchString(resolve.hostname) || re.MatchString(resolve.resolvedHostname) {
+			hostnames[resolve.hostname] = true
+		}
+	}
+	for hostname := range hostnames {
+		getHostnameResolvesLightweightCache().Delete(hostname)
+		if err := deleteHostnameResolve(hostname); err != nil {
+			return invalidated, err
+		}
+		invalidated = append(invalidated, hostname)
+	}
+	sort.Strings(invalidated)
+	return invalidated, nil
+}
+
+// SeedHostnameResolve sets the resolve of a hostname, taking precedence over resolving it
+func SeedHostnameResolve(seed *HostnameResolveSeed) error {
+	seed.Hostname = strings.TrimSpace(seed.Hostname)
+	seed.ResolvedHostname = strings.TrimSpace(seed.ResolvedHostname)
+	if seed.Hostname == "" || seed.ResolvedHostname == "" {
+		return fmt.Errorf("SeedHostnameResolve: hostname and resolved hostname must not be empty")
+	}
+	if err := writeHostnameResolveSeed(seed); err != nil {
+		return err
+	}
+	hostnameResolveSeedsCache.Set(seed.Hostname, seed.ResolvedHostname, cache.NoExpiration)
+	return nil
+}
+
+// UnseedHostnameResolve removes the seeded resolve of a hostname. The hostname is resolved upon next use.
+func UnseedHostnameResolve(hostname string) error {
+	if err := deleteHostnameResolveSeed(hostname); err != nil {
+		return err
+	}
+	hostnameResolveSeedsCache.Delete(hostname)
+	getHostnameResolvesLightweightCache().Delete(hostname)
+	return nil
+}
+
 func UnresolveHostname(instanceKey *InstanceKey) (InstanceKey, bool, error) {
 	if *config.RuntimeCLIFlags.SkipUnresolve {
 		return *instanceKey, false, nil
@@ -280,7 +421,7 @@ func ResolveHostnameIPs(hostname string) error {
 	if _, found := hostnameIPsCache.Get(hostname); found {
 		return nil
 	}
-	ips, err := net.LookupIP(hostname)
+	ips, err := lookupIP(hostname)
 	if err != nil {
 		return log.Errore(err)
 	}
@@ -326,6 +326,71 @@ func deleteHostnameResolves() error {
 	return err
 }
 
+// deleteHostnameResolve removes the resolve of a single hostname from the database cache
+func deleteHostnameResolve(hostname string) error {
+	_, err := db.ExecOrchestrator(`
+			delete
+				from hostname_resolve
+			where
+				hostname = ?`,
+		hostname,
+	)
+	return log.Errore(err)
+}
+
+// writeHostnameResolveSeed stores a seeded resolve of a hostname
+func writeHostnameResolveSeed(seed *HostnameResolveSeed) error {
+	_, err := db.ExecOrchestrator(`
+			insert into
+					hostname_resolve_seed (hostname, resolved_hostname, seeded_timestamp)
+				values
+					(?, ?, NOW())
+				on duplicate key update
+					resolved_hostname = VALUES(resolved_hostname),
+					seeded_timestamp = VALUES(seeded_timestamp)
+			`,
+		seed.Hostname,
+		seed.ResolvedHostname,
+	)
+	return log.Errore(err)
+}
+
+// deleteHostnameResolveSeed removes the seeded resolve of a hostname
+func deleteHostnameResolveSeed(hostname string) error {
+	_, err := db.ExecOrchestrator(`
+			delete
+				from hostname_resolve_seed
+			where
+				hostname = ?`,
+		hostname,
+	)
+	return log.Errore(err)
+}
+
+// ReadHostnameResolveSeeds returns all seeded hostname resolves
+func ReadHostnameResolveSeeds() (seeds []HostnameResolveSeed, err error) {
+	seeds = []HostnameResolveSeed{}
+	query := `
+		select
+			hostname,
+			resolved_hostname,
+			seeded_timestamp
+		from
+			hostname_resolve_seed
+		order by
+			hostname
+		`
+	err = db.QueryOrchestratorRowsMap(query, func(m sqlutils.RowMap) error {
+		seeds = append(seeds, HostnameResolveSeed{
+			Hostname:         m.GetString("hostname"),
+			ResolvedHostname: m.GetString("resolved_hostname"),
+			SeededTimestamp:  m.GetString("seeded_timestamp"),
+		})
+		return nil
+	})
+	return seeds, log.Errore(err)
+}
+
 // writeHostnameIPs stroes an ipv4 and ipv6 associated witha hostname, if available
 func writeHostnameIPs(hostname string, ips []net.IP) error {
 	ipv4String := ""
@@ -0,0 +1,196 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/openark/golib/log"
+)
+
+// dnsServerDialTimeout limits connecting to a HostnameResolveDNSServers server
+const dnsServerDialTimeout = 5 * time.Second
+
+// hostsFileCheckInterval is the interval at which HostnameResolveHostsFile is checked for changes
+const hostsFileCheckInterval = time.Second
+
+// HostnameResolver resolves a hostname into its canonical hostname
+type HostnameResolver func(hostname string) (resolvedHostname string, err error)
+
+var hostnameResolvers = make(map[string]HostnameResolver)
+var hostnameResolversMutex sync.Mutex
+
+// RegisterHostnameResolver registers a resolver, applied when HostnameResolveMethod is given method
+func RegisterHostnameResolver(method string, resolver HostnameResolver) {
+	hostnameResolversMutex.Lock()
+	defer hostnameResolversMutex.Unlock()
+	hostnameResolvers[strings.ToLower(method)] = resolver
+}
+
+func getHostnameResolver(method string) (resolver HostnameResolver, found bool) {
+	hostnameResolversMutex.Lock()
+	defer hostnameResolversMutex.Unlock()
+	resolver, found = hostnameResolvers[strings.ToLower(method)]
+	return resolver, found
+}
+
+var hostnameRewriteRegexps = make(map[string]*regexp.Regexp)
+var hostnameRewriteRegexpsMutex sync.Mutex
+
+// rewriteHostname applies the first of HostnameRewriteRules which matches given hostname
+func rewriteHostname(hostname string) string {
+	hostnameRewriteRegexpsMutex.Lock()
+	defer hostnameRewriteRegexpsMutex.Unlock()
+
+	for _, rule := range config.Config.HostnameRewriteRules {
+		re, found := hostnameRewriteRegexps[rule.Pattern]
+		if !found {
+			var err error
+			if re, err = regexp.Compile(rule.Pattern); err != nil {
+				log.Errorf("rewriteHostname: invalid pattern %s: %+v", rule.Pattern, err)
+				continue
+			}
+			hostnameRewriteRegexps[rule.Pattern] = re
+		}
+		if re.MatchString(hostname) {
+			return re.ReplaceAllString(hostname, rule.Replacement)
+		}
+	}
+	return hostname
+}
+
+// parseHostsFile parses hosts file content, in /etc/hosts format: an address, a canonical hostname, and optional
+// aliases per line. Both the address and the aliases map onto the canonical hostname.
+func parseHostsFile(content string) map[string]string {
+	resolves := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		tokens := strings.Fields(line)
+		if len(tokens) < 2 {
+			continue
+		}
+		canonicalHostname := tokens[1]
+		for _, token := range append([]string{tokens[0]}, tokens[2:]...) {
+			resolves[token] = canonicalHostname
+		}
+	}
+	return resolves
+}
+
+// hostsFile is the parsed content of HostnameResolveHostsFile, re-read whenever the file changes
+var hostsFile = struct {
+	sync.Mutex
+	path      string
+	modTime   time.Time
+	checkedAt time.Time
+	resolves  map[string]string
+}{}
+
+// readHostsFileResolves returns the resolves listed in HostnameResolveHostsFile
+func readHostsFileResolves() map[string]string {
+	path := config.Config.HostnameResolveHostsFile
+	if path == "" {
+		return nil
+	}
+	hostsFile.Lock()
+	defer hostsFile.Unlock()
+
+	if path != hostsFile.path {
+		hostsFile.path = path
+		hostsFile.modTime = time.Time{}
+		hostsFile.resolves = nil
+	} else if time.Since(hostsFile.checkedAt) < hostsFileCheckInterval {
+		return hostsFile.resolves
+	}
+	hostsFile.checkedAt = time.Now()
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		log.Errorf("readHostsFileResolves: %+v", err)
+		return hostsFile.resolves
+	}
+	if fileInfo.ModTime().Equal(hostsFile.modTime) {
+		return hostsFile.resolves
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Errorf("readHostsFileResolves: %+v", err)
+		return hostsFile.resolves
+	}
+	hostsFile.modTime = fileInfo.ModTime()
+	hostsFile.resolves = parseHostsFile(string(content))
+	log.Debugf("readHostsFileResolves: read %d resolves from %s", len(hostsFile.resolves), path)
+	return hostsFile.resolves
+}
+
+// staticResolveHostname resolves a hostname via HostnameResolveStaticMap, or else via HostnameResolveHostsFile
+func staticResolveHostname(hostname string) (resolvedHostname string, found bool) {
+	if resolvedHostname, found = config.Config.HostnameResolveStaticMap[hostname]; found {
+		return resolvedHostname, found
+	}
+	resolvedHostname, found = readHostsFileResolves()[hostname]
+	return resolvedHostname, found
+}
+
+var dnsServerIndex uint64
+
+// getNetResolver returns the resolver by which hostnames are looked up: one querying HostnameResolveDNSServers
+// in turn, when configured, or else the system's resolver
+func getNetResolver() *net.Resolver {
+	servers := config.Config.HostnameResolveDNSServers
+	if len(servers) == 0 {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			server := servers[atomic.AddUint64(&dnsServerIndex, 1)%uint64(len(servers))]
+			dialer := net.Dialer{Timeout: dnsServerDialTimeout}
+			return dialer.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// lookupCNAME looks up the canonical name of given hostname via getNetResolver()
+func lookupCNAME(hostname string) (string, error) {
+	return getNetResolver().LookupCNAME(context.Background(), hostname)
+}
+
+// lookupIP looks up the IP addresses of given hostname via getNetResolver()
+func lookupIP(hostname string) (ips []net.IP, err error) {
+	addrs, err := getNetResolver().LookupIPAddr(context.Background(), hostname)
+	if err != nil {
+		return ips, err
+	}
+	for _, addr := range addrs {
+		ips = append(ips, addr.IP)
+	}
+	return ips, nil
+}
@@ -0,0 +1,243 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/github/orchestrator/go/config"
+)
+
+// StateEventType is the type of a state change event published to external consumers
+type StateEventType string
+
+const (
+	InstanceDiscoveredEvent        StateEventType = "instance-discovered"
+	InstanceForgottenEvent         StateEventType = "instance-forgotten"
+	LagThresholdCrossedEvent       StateEventType = "lag-threshold-crossed"
+	AnalysisRaisedEvent            StateEventType = "analysis-raised"
+	AnalysisClearedEvent           StateEventType = "analysis-cleared"
+	RecoveryStartedEvent           StateEventType = "recovery-started"
+	RecoveryResolvedEvent          StateEventType = "recovery-resolved"
+	ServiceRecordMismatchEvent     StateEventType = "service-record-mismatch"
+	RecoveryApprovalRequestedEvent StateEventType = "recovery-approval-requested"
+	ErrorLogMatchEvent             StateEventType = "error-log-match"
+	InstanceDecommissionedEvent    StateEventType = "instance-decommissioned"
+	SemiSyncAsyncFallbackEvent     StateEventType = "semi-sync-async-fallback"
+)
+
+var stateEventTypes = []StateEventType{
+	InstanceDiscoveredEvent,
+	InstanceForgottenEvent,
+	LagThresholdCrossedEvent,
+	AnalysisRaisedEvent,
+	AnalysisClearedEvent,
+	RecoveryStartedEvent,
+	RecoveryResolvedEvent,
+	ServiceRecordMismatchEvent,
+	RecoveryApprovalRequestedEvent,
+	ErrorLogMatchEvent,
+	InstanceDecommissionedEvent,
+	SemiSyncAsyncFallbackEvent,
+}
+
+// StateEventSeverity tells how urgently a state event calls for attention
+type StateEventSeverity string
+
+const (
+	InfoSeverity     StateEventSeverity = "info"
+	WarningSeverity  StateEventSeverity = "warning"
+	CriticalSeverity StateEventSeverity = "critical"
+)
+
+var stateEventSeverityRanks = map[StateEventSeverity]int{
+	InfoSeverity:     0,
+	WarningSeverity:  1,
+	CriticalSeverity: 2,
+}
+
+// ParseStateEventSeverity parses a severity; empty input means no severity
+func ParseStateEventSeverity(severity string) (StateEventSeverity, error) {
+	if severity == "" {
+		return StateEventSeverity(""), nil
+	}
+	if _, ok := stateEventSeverityRanks[StateEventSeverity(severity)]; !ok {
+		return StateEventSeverity(""), fmt.Errorf("Unknown state event severity: %s. Expected one of: info, warning, critical", severity)
+	}
+	return StateEventSeverity(severity), nil
+}
+
+// AtLeast checks whether this severity is as urgent as given severity, or more. Any severity is at least no severity.
+func (this StateEventSeverity) AtLeast(severity StateEventSeverity) bool {
+	return stateEventSeverityRanks[this] >= stateEventSeverityRanks[severity]
+}
+
+// StateEvent is a change in orchestrator's view of the topologies. State events are recorded in the backend
+// database, and are published to Kafka, keyed by cluster name, in the order in which they were recorded.
+type StateEvent struct {
+	EventId     int64
+	EventType   StateEventType
+	Timestamp   string
+	ClusterName string
+	Key         InstanceKey
+	Severity    StateEventSeverity
+	Data        map[string]interface{}
+}
+
+// GetStateEventSeverity returns the severity of a state event of given type and data. Problems raised, and
+// recoveries, and masters falling back to asynchronous replication, are critical; lag crossing the threshold upwards, and inconsistencies, are warnings.
+func GetStateEventSeverity(eventType StateEventType, data map[string]interface{}) StateEventSeverity {
+	switch eventType {
+	case AnalysisRaisedEvent, RecoveryStartedEvent, RecoveryApprovalRequestedEvent:
+		return CriticalSeverity
+	case RecoveryResolvedEvent:
+		if isSuccessful, _ := data["isSuccessful"].(bool); isSuccessful {
+			return WarningSeverity
+		}
+		return CriticalSeverity
+	case LagThresholdCrossedEvent:
+		if aboveThreshold, _ := data["aboveThreshold"].(bool); aboveThreshold {
+			return WarningSeverity
+		}
+		return InfoSeverity
+	case SemiSyncAsyncFallbackEvent:
+		if fallenBack, _ := data["fallenBack"].(bool); fallenBack {
+			return CriticalSeverity
+		}
+		return InfoSeverity
+	case ServiceRecordMismatchEvent, ErrorLogMatchEvent:
+		return WarningSeverity
+	}
+	return InfoSeverity
+}
+
+// StateEventSubscription subscribes a consumer to the state events matching its filters, which are published
+// onto the subscription's own topic, in addition to the topics given by KafkaTopics. Empty filters match all events.
+type StateEventSubscription struct {
+	Name             string
+	Topic            string
+	ClusterPattern   string
+	EventTypes       []StateEventType
+	MinSeverity      StateEventSeverity
+	Owner            string
+	CreatedTimestamp string
+
+	clusterRegexp *regexp.Regexp
+}
+
+// NewStateEventSubscription returns a validated subscription. eventTypes is a comma delimited list of event types.
+func NewStateEventSubscription(name string, topic string, clusterPattern string, eventTypes string, minSeverity string, owner string) (*StateEventSubscription, error) {
+	subscription := &StateEventSubscription{
+		Name:           name,
+		Topic:          topic,
+		ClusterPattern: clusterPattern,
+		EventTypes:     []StateEventType{},
+		Owner:          owner,
+	}
+	if name == "" {
+		return nil, fmt.Errorf("State event subscription name must not be empty")
+	}
+	if topic == "" {
+		return nil, fmt.Errorf("State event subscription %s: topic must not be empty", name)
+	}
+	for _, token := range strings.Split(eventTypes, ",") {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			continue
+		}
+		if !isStateEventType(StateEventType(token)) {
+			return nil, fmt.Errorf("State event subscription %s: unknown event type: %s", name, token)
+		}
+		subscription.EventTypes = append(subscription.EventTypes, StateEventType(token))
+	}
+	severity, err := ParseStateEventSeverity(minSeverity)
+	if err != nil {
+		return nil, err
+	}
+	subscription.MinSeverity = severity
+	if err := subscription.compile(); err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+func isStateEventType(eventType StateEventType) bool {
+	for _, knownEventType := range stateEventTypes {
+		if eventType == knownEventType {
+			return true
+		}
+	}
+	return false
+}
+
+// compile compiles the subscription's cluster pattern
+func (this *StateEventSubscription) compile() (err error) {
+	this.clusterRegexp = nil
+	if this.ClusterPattern == "" {
+		return nil
+	}
+	if this.clusterRegexp, err = regexp.Compile(this.ClusterPattern); err != nil {
+		return fmt.Errorf("State event subscription %s: invalid cluster pattern %s: %+v", this.Name, this.ClusterPattern, err)
+	}
+	return nil
+}
+
+// Matches checks whether given event passes the subscription's filters: its cluster name matches the cluster
+// pattern, its type is one of the event types, and its severity is at least the min severity
+func (this *StateEventSubscription) Matches(event *StateEvent) bool {
+	if this.clusterRegexp != nil && !this.clusterRegexp.MatchString(event.ClusterName) {
+		return false
+	}
+	if len(this.EventTypes) > 0 {
+		matchesEventType := false
+		for _, eventType := range this.EventTypes {
+			if eventType == event.EventType {
+				matchesEventType = true
+			}
+		}
+		if !matchesEventType {
+			return false
+		}
+	}
+	return event.Severity.AtLeast(this.MinSeverity)
+}
+
+// StateEventsEnabled returns true when state change events are published to external consumers
+func StateEventsEnabled() bool {
+	return config.Config.KafkaRESTProxyURL != ""
+}
+
+// IsLagThresholdCrossed checks whether a replica's lag crossed ReasonableReplicationLagSeconds between two
+// consecutive reads of the replica, and if so, whether it is now above the threshold. Unknown lag crosses nothing,
+// and neither does the lag of a replica flagged skip-lag-checks.
+func IsLagThresholdCrossed(previous *Instance, current *Instance) (crossed bool, aboveThreshold bool) {
+	if previous == nil || current == nil {
+		return false, false
+	}
+	if current.HasFlag(SkipLagChecksFlag) {
+		return false, false
+	}
+	if !previous.SlaveLagSeconds.Valid || !current.SlaveLagSeconds.Valid {
+		return false, false
+	}
+	threshold := int64(config.Config.ReasonableReplicationLagSeconds)
+	wasAboveThreshold := previous.SlaveLagSeconds.Int64 > threshold
+	aboveThreshold = current.SlaveLagSeconds.Int64 > threshold
+	return aboveThreshold != wasAboveThreshold, aboveThreshold
+}
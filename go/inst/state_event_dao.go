@@ -0,0 +1,206 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+// RecordStateEvent records a state change event, to be published to external consumers. Events are
+// only recorded when publishing is configured. instanceKey may be nil for cluster-wide events.
+func RecordStateEvent(eventType StateEventType, clusterName string, instanceKey *InstanceKey, data map[string]interface{}) error {
+	if !StateEventsEnabled() {
+		return nil
+	}
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	eventData, err := json.Marshal(data)
+	if err != nil {
+		return log.Errore(err)
+	}
+	if instanceKey == nil {
+		instanceKey = &InstanceKey{}
+	}
+	if IsDuplicateNotification(fmt.Sprintf("state-event/%s/%s/%s/%s", eventType, clusterName, instanceKey.StringCode(), eventData)) {
+		return nil
+	}
+	writeFunc := func() error {
+		_, err := db.ExecOrchestrator(`
+			insert into state_event (
+				event_timestamp, event_type, cluster_name, hostname, port, event_data
+			) values (
+				now(), ?, ?, ?, ?, ?
+			)
+			`, string(eventType), clusterName, instanceKey.Hostname, instanceKey.Port, string(eventData),
+		)
+		return log.Errore(err)
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
+
+// ReadPendingStateEvents reads up to given number of state events not yet published, oldest first
+func ReadPendingStateEvents(limit int) (events []StateEvent, err error) {
+	query := `
+		select
+			event_id,
+			event_timestamp,
+			event_type,
+			cluster_name,
+			hostname,
+			port,
+			event_data
+		from
+			state_event
+		order by
+			event_id asc
+		limit ?
+		`
+	err = db.QueryOrchestrator(query, sqlutils.Args(limit), func(m sqlutils.RowMap) error {
+		event := StateEvent{}
+		event.EventId = m.GetInt64("event_id")
+		event.Timestamp = m.GetString("event_timestamp")
+		event.EventType = StateEventType(m.GetString("event_type"))
+		event.ClusterName = m.GetString("cluster_name")
+		event.Key.Hostname = m.GetString("hostname")
+		event.Key.Port = m.GetInt("port")
+		if err := json.Unmarshal([]byte(m.GetString("event_data")), &event.Data); err != nil {
+			log.Errorf("ReadPendingStateEvents: cannot parse data of event %d: %+v", event.EventId, err)
+		}
+		event.Severity = GetStateEventSeverity(event.EventType, event.Data)
+		events = append(events, event)
+		return nil
+	})
+	return events, log.Errore(err)
+}
+
+// DeletePublishedStateEvents removes given state events, once they are published. Events are deleted by their
+// exact ids: an event committed with a lower id after the published events were read is yet to be published.
+func DeletePublishedStateEvents(eventIds []int64) error {
+	if len(eventIds) == 0 {
+		return nil
+	}
+	args := sqlutils.Args()
+	for _, eventId := range eventIds {
+		args = append(args, eventId)
+	}
+	query := fmt.Sprintf(`
+			delete
+				from state_event
+			where
+				event_id in (%s)
+			`, strings.TrimSuffix(strings.Repeat("?, ", len(eventIds)), ", "),
+	)
+	_, err := db.ExecOrchestrator(query, args...)
+	return log.Errore(err)
+}
+
+// ExpireStateEvents removes state events which could not be published within StateEventsRetentionHours
+func ExpireStateEvents() error {
+	sqlResult, err := db.ExecOrchestrator(`
+			delete
+				from state_event
+			where
+				event_timestamp < now() - interval ? hour
+			`, config.Config.StateEventsRetentionHours,
+	)
+	if err != nil {
+		return log.Errore(err)
+	}
+	if rows, err := sqlResult.RowsAffected(); err == nil && rows > 0 {
+		log.Warningf("ExpireStateEvents: purged %d state events which were never published", rows)
+	}
+	return nil
+}
+
+// WriteStateEventSubscription writes a state event subscription, replacing any subscription of the same name
+func WriteStateEventSubscription(subscription *StateEventSubscription) error {
+	eventTypes := []string{}
+	for _, eventType := range subscription.EventTypes {
+		eventTypes = append(eventTypes, string(eventType))
+	}
+	_, err := db.ExecOrchestrator(`
+			replace into state_event_subscription (
+				subscription_name, topic, cluster_pattern, event_types, min_severity, owner, created_timestamp
+			) values (
+				?, ?, ?, ?, ?, ?, now()
+			)
+			`, subscription.Name, subscription.Topic, subscription.ClusterPattern, strings.Join(eventTypes, ","), string(subscription.MinSeverity), subscription.Owner,
+	)
+	return log.Errore(err)
+}
+
+// DeleteStateEventSubscription removes the state event subscription of given name
+func DeleteStateEventSubscription(name string) error {
+	_, err := db.ExecOrchestrator(`
+			delete
+				from state_event_subscription
+			where
+				subscription_name = ?
+			`, name,
+	)
+	return log.Errore(err)
+}
+
+// ReadStateEventSubscriptions reads all state event subscriptions, by name
+func ReadStateEventSubscriptions() (subscriptions [](*StateEventSubscription), err error) {
+	subscriptions = [](*StateEventSubscription){}
+	query := `
+		select
+			subscription_name,
+			topic,
+			cluster_pattern,
+			event_types,
+			min_severity,
+			owner,
+			created_timestamp
+		from
+			state_event_subscription
+		order by
+			subscription_name asc
+		`
+	err = db.QueryOrchestratorRowsMap(query, func(m sqlutils.RowMap) error {
+		subscription := &StateEventSubscription{
+			Name:             m.GetString("subscription_name"),
+			Topic:            m.GetString("topic"),
+			ClusterPattern:   m.GetString("cluster_pattern"),
+			EventTypes:       []StateEventType{},
+			MinSeverity:      StateEventSeverity(m.GetString("min_severity")),
+			Owner:            m.GetString("owner"),
+			CreatedTimestamp: m.GetString("created_timestamp"),
+		}
+		for _, eventType := range strings.Split(m.GetString("event_types"), ",") {
+			if eventType != "" {
+				subscription.EventTypes = append(subscription.EventTypes, StateEventType(eventType))
+			}
+		}
+		if err := subscription.compile(); err != nil {
+			log.Errore(err)
+			return nil
+		}
+		subscriptions = append(subscriptions, subscription)
+		return nil
+	})
+	return subscriptions, log.Errore(err)
+}
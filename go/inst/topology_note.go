@@ -0,0 +1,76 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// InstanceNote is a free-form note attached to an instance, optionally pointing at a runbook
+type InstanceNote struct {
+	Key              InstanceKey
+	Note             string
+	RunbookURL       string
+	Owner            string
+	UpdatedTimestamp string
+}
+
+// ClusterNote is a free-form note attached to a cluster, optionally pointing at a runbook. Cluster notes are
+// associated with the cluster's alias, which, unlike its name, survives master failovers.
+type ClusterNote struct {
+	ClusterAlias     string
+	Note             string
+	RunbookURL       string
+	Owner            string
+	UpdatedTimestamp string
+}
+
+// ValidateRunbookURL makes sure a runbook URL, if given, is an absolute http(s) URL
+func ValidateRunbookURL(runbookURL string) error {
+	if runbookURL == "" {
+		return nil
+	}
+	u, err := url.Parse(runbookURL)
+	if err != nil {
+		return fmt.Errorf("Invalid runbook URL: %s: %+v", runbookURL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("Invalid runbook URL: %s: expecting an http or https URL", runbookURL)
+	}
+	return nil
+}
+
+// NewInstanceNote returns a note attached to given instance
+func NewInstanceNote(instanceKey *InstanceKey, note string, runbookURL string, owner string) *InstanceNote {
+	return &InstanceNote{
+		Key:        *instanceKey,
+		Note:       note,
+		RunbookURL: runbookURL,
+		Owner:      owner,
+	}
+}
+
+// NewClusterNote returns a note attached to cluster of given alias
+func NewClusterNote(clusterAlias string, note string, runbookURL string, owner string) *ClusterNote {
+	return &ClusterNote{
+		ClusterAlias: clusterAlias,
+		Note:         note,
+		RunbookURL:   runbookURL,
+		Owner:        owner,
+	}
+}
@@ -0,0 +1,182 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+
+	"github.com/github/orchestrator/go/db"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+// WriteInstanceNote attaches a note to an instance, replacing its existing note, if any
+func WriteInstanceNote(note *InstanceNote) error {
+	if err := ValidateRunbookURL(note.RunbookURL); err != nil {
+		return err
+	}
+	_, err := db.ExecOrchestrator(`
+			replace into database_instance_note (
+					hostname, port, note, runbook_url, note_owner, updated_timestamp
+				) values (
+					?, ?, ?, ?, ?, now()
+				)
+			`, note.Key.Hostname, note.Key.Port, note.Note, note.RunbookURL, note.Owner,
+	)
+	if err != nil {
+		return log.Errore(err)
+	}
+	AuditOperation("set-instance-note", &note.Key, fmt.Sprintf("by %s: %s %s", note.Owner, note.Note, note.RunbookURL))
+	return nil
+}
+
+// DeleteInstanceNote removes the note of an instance
+func DeleteInstanceNote(instanceKey *InstanceKey) error {
+	_, err := db.ExecOrchestrator(`
+			delete from database_instance_note where hostname = ? and port = ?
+			`, instanceKey.Hostname, instanceKey.Port,
+	)
+	if err != nil {
+		return log.Errore(err)
+	}
+	AuditOperation("clear-instance-note", instanceKey, "")
+	return nil
+}
+
+// ReadInstanceNote reads the note of an instance, or nil when it has none
+func ReadInstanceNote(instanceKey *InstanceKey) (note *InstanceNote, err error) {
+	query := `
+		select
+			hostname,
+			port,
+			note,
+			runbook_url,
+			note_owner,
+			updated_timestamp
+		from
+			database_instance_note
+		where
+			hostname = ?
+			and port = ?
+		`
+	err = db.QueryOrchestrator(query, sqlutils.Args(instanceKey.Hostname, instanceKey.Port), func(m sqlutils.RowMap) error {
+		note = &InstanceNote{
+			Note:             m.GetString("note"),
+			RunbookURL:       m.GetString("runbook_url"),
+			Owner:            m.GetString("note_owner"),
+			UpdatedTimestamp: m.GetString("updated_timestamp"),
+		}
+		note.Key.Hostname = m.GetString("hostname")
+		note.Key.Port = m.GetInt("port")
+		return nil
+	})
+	return note, log.Errore(err)
+}
+
+// ReadClusterInstanceNotes reads the notes of all members of given cluster
+func ReadClusterInstanceNotes(clusterName string) (notes []InstanceNote, err error) {
+	notes = []InstanceNote{}
+	query := `
+		select
+			database_instance_note.hostname,
+			database_instance_note.port,
+			database_instance_note.note,
+			database_instance_note.runbook_url,
+			database_instance_note.note_owner,
+			database_instance_note.updated_timestamp
+		from
+			database_instance_note
+			join database_instance using (hostname, port)
+		where
+			database_instance.cluster_name = ?
+		order by
+			database_instance_note.hostname, database_instance_note.port
+		`
+	err = db.QueryOrchestrator(query, sqlutils.Args(clusterName), func(m sqlutils.RowMap) error {
+		note := InstanceNote{
+			Note:             m.GetString("note"),
+			RunbookURL:       m.GetString("runbook_url"),
+			Owner:            m.GetString("note_owner"),
+			UpdatedTimestamp: m.GetString("updated_timestamp"),
+		}
+		note.Key.Hostname = m.GetString("hostname")
+		note.Key.Port = m.GetInt("port")
+		notes = append(notes, note)
+		return nil
+	})
+	return notes, log.Errore(err)
+}
+
+// WriteClusterNote attaches a note to a cluster, replacing its existing note, if any
+func WriteClusterNote(note *ClusterNote) error {
+	if err := ValidateRunbookURL(note.RunbookURL); err != nil {
+		return err
+	}
+	_, err := db.ExecOrchestrator(`
+			replace into cluster_note (
+					cluster_alias, note, runbook_url, note_owner, updated_timestamp
+				) values (
+					?, ?, ?, ?, now()
+				)
+			`, note.ClusterAlias, note.Note, note.RunbookURL, note.Owner,
+	)
+	if err != nil {
+		return log.Errore(err)
+	}
+	AuditOperation("set-cluster-note", nil, fmt.Sprintf("%s: by %s: %s %s", note.ClusterAlias, note.Owner, note.Note, note.RunbookURL))
+	return nil
+}
+
+// DeleteClusterNote removes the note of cluster of given alias
+func DeleteClusterNote(clusterAlias string) error {
+	_, err := db.ExecOrchestrator(`
+			delete from cluster_note where cluster_alias = ?
+			`, clusterAlias,
+	)
+	if err != nil {
+		return log.Errore(err)
+	}
+	AuditOperation("clear-cluster-note", nil, clusterAlias)
+	return nil
+}
+
+// ReadClusterNote reads the note of cluster of given alias, or nil when it has none
+func ReadClusterNote(clusterAlias string) (note *ClusterNote, err error) {
+	query := `
+		select
+			cluster_alias,
+			note,
+			runbook_url,
+			note_owner,
+			updated_timestamp
+		from
+			cluster_note
+		where
+			cluster_alias = ?
+		`
+	err = db.QueryOrchestrator(query, sqlutils.Args(clusterAlias), func(m sqlutils.RowMap) error {
+		note = &ClusterNote{
+			ClusterAlias:     m.GetString("cluster_alias"),
+			Note:             m.GetString("note"),
+			RunbookURL:       m.GetString("runbook_url"),
+			Owner:            m.GetString("note_owner"),
+			UpdatedTimestamp: m.GetString("updated_timestamp"),
+		}
+		return nil
+	})
+	return note, log.Errore(err)
+}
@@ -0,0 +1,57 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+)
+
+// writeProbeReplicationThresholdSeconds is the age, in seconds, by which a replica's copy of its master's write probe
+// may fall behind the master's latest probe, before the replica is considered to be missing the probe.
+// It allows for both master and replica to be polled at different times, and for reasonable replication lag.
+func writeProbeReplicationThresholdSeconds() int {
+	return 2*int(config.Config.InstancePollSeconds) + config.Config.ReasonableReplicationLagSeconds
+}
+
+// probeInstanceWrites writes a probe row onto a writable master, and, on a replica, reads its master's probe row
+// as replicated. Replicas are never written to, so as to not introduce errant transactions.
+func probeInstanceWrites(db *sql.DB, instance *Instance, masterServerID uint) {
+	if !instance.IsReplica() && !instance.ReadOnly {
+		probeValue := time.Now().UnixNano()
+		query := fmt.Sprintf(`
+			insert into %s (server_id, probe_value) values (?, ?)
+				on duplicate key update probe_value=values(probe_value)
+			`, config.Config.MasterWriteProbeTable)
+		if _, err := db.Exec(query, instance.ServerID, probeValue); err != nil {
+			instance.WriteProbeFailing = true
+			logReadTopologyInstanceError(&instance.Key, "MasterWriteProbeTable: write", err)
+		} else {
+			instance.WriteProbeValue = probeValue
+		}
+	}
+	if instance.IsReplica() && masterServerID > 0 {
+		query := fmt.Sprintf(`select probe_value from %s where server_id = ?`, config.Config.MasterWriteProbeTable)
+		err := db.QueryRow(query, masterServerID).Scan(&instance.ReplicatedWriteProbeValue)
+		if err != nil && err != sql.ErrNoRows {
+			logReadTopologyInstanceError(&instance.Key, "MasterWriteProbeTable: read", err)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/openark/golib/sqlutils"
+	test "github.com/openark/golib/tests"
+)
+
+// writeProbeTestDB returns a database standing in for a probed instance, with a write probe table holding
+// a probe of given master server_id
+func writeProbeTestDB(t *testing.T, masterServerID uint, probeValue int64) *sql.DB {
+	config.Config.MasterWriteProbeTable = "orchestrator_write_probe"
+	t.Cleanup(func() { config.Config.MasterWriteProbeTable = "" })
+
+	sqliteDB, _, err := sqlutils.GetSQLiteDB(filepath.Join(t.TempDir(), "instance.sqlite3"))
+	test.S(t).ExpectNil(err)
+	_, err = sqliteDB.Exec(`create table orchestrator_write_probe (server_id int unsigned not null primary key, probe_value bigint not null)`)
+	test.S(t).ExpectNil(err)
+	_, err = sqliteDB.Exec(`insert into orchestrator_write_probe (server_id, probe_value) values (?, ?)`, masterServerID, probeValue)
+	test.S(t).ExpectNil(err)
+	return sqliteDB
+}
+
+func writeProbeTestReplica() *Instance {
+	replica := NewInstance()
+	replica.Key = InstanceKey{Hostname: "probe-replica", Port: 3306}
+	replica.ServerID = 2
+	replica.MasterKey = InstanceKey{Hostname: "probe-master", Port: 3306}
+	replica.ReadBinlogCoordinates = BinlogCoordinates{LogFile: "mysql-bin.000001", LogPos: 4}
+	replica.ReadOnly = true
+	return replica
+}
+
+func TestProbeInstanceWritesFailing(t *testing.T) {
+	sqliteDB := writeProbeTestDB(t, 1, 42)
+	_, err := sqliteDB.Exec(`drop table orchestrator_write_probe`)
+	test.S(t).ExpectNil(err)
+
+	master := NewInstance()
+	master.Key = InstanceKey{Hostname: "probe-master", Port: 3306}
+	master.ServerID = 1
+	probeInstanceWrites(sqliteDB, master, 0)
+	test.S(t).ExpectTrue(master.WriteProbeFailing)
+	test.S(t).ExpectEquals(master.WriteProbeValue, int64(0))
+}
+
+func TestProbeInstanceWritesReadOnlyMaster(t *testing.T) {
+	sqliteDB := writeProbeTestDB(t, 1, 42)
+	_, err := sqliteDB.Exec(`drop table orchestrator_write_probe`)
+	test.S(t).ExpectNil(err)
+
+	// a read-only master is not written to, and so its probe does not fail
+	master := NewInstance()
+	master.Key = InstanceKey{Hostname: "probe-master", Port: 3306}
+	master.ServerID = 1
+	master.ReadOnly = true
+	probeInstanceWrites(sqliteDB, master, 0)
+	test.S(t).ExpectFalse(master.WriteProbeFailing)
+}
+
+func TestProbeInstanceWritesReplica(t *testing.T) {
+	sqliteDB := writeProbeTestDB(t, 1, 42)
+
+	replica := writeProbeTestReplica()
+	replica.ReadOnly = false
+	probeInstanceWrites(sqliteDB, replica, 1)
+	test.S(t).ExpectEquals(replica.ReplicatedWriteProbeValue, int64(42))
+	test.S(t).ExpectFalse(replica.WriteProbeFailing)
+	test.S(t).ExpectEquals(replica.WriteProbeValue, int64(0))
+
+	// a replica, even if writable, is never written to
+	var countProbes int
+	test.S(t).ExpectNil(sqliteDB.QueryRow(`select count(*) from orchestrator_write_probe`).Scan(&countProbes))
+	test.S(t).ExpectEquals(countProbes, 1)
+}
+
+func TestProbeInstanceWritesReplicaMissingProbe(t *testing.T) {
+	sqliteDB := writeProbeTestDB(t, 1, 42)
+
+	replica := writeProbeTestReplica()
+	probeInstanceWrites(sqliteDB, replica, 7)
+	test.S(t).ExpectEquals(replica.ReplicatedWriteProbeValue, int64(0))
+	test.S(t).ExpectFalse(replica.WriteProbeFailing)
+}
@@ -17,6 +17,8 @@
 package kv
 
 import (
+	"fmt"
+
 	consulapi "github.com/armon/consul-api"
 	"github.com/github/orchestrator/go/config"
 	"github.com/openark/golib/log"
@@ -46,6 +48,14 @@ func NewConsulStore() KVStore {
 	return store
 }
 
+func (this *consulStore) Name() string {
+	return "consul"
+}
+
+func (this *consulStore) IsConfigured() bool {
+	return this.client != nil
+}
+
 func (this *consulStore) PutKeyValue(key string, value string) (err error) {
 	if this.client == nil {
 		return nil
@@ -63,5 +73,16 @@ func (this *consulStore) GetKeyValue(key string) (value string, err error) {
 	if err != nil {
 		return value, err
 	}
+	if pair == nil {
+		return value, nil
+	}
 	return string(pair.Value), nil
 }
+
+// PutConsulKeyValue writes a key directly onto Consul, as opposed to PutValue, which writes onto all KV stores
+func PutConsulKeyValue(key string, value string) error {
+	if config.Config.ConsulAddress == "" {
+		return fmt.Errorf("PutConsulKeyValue: ConsulAddress is not configured")
+	}
+	return NewConsulStore().PutKeyValue(key, value)
+}
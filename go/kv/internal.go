@@ -17,6 +17,8 @@
 package kv
 
 import (
+	"database/sql"
+
 	"github.com/github/orchestrator/go/db"
 	"github.com/openark/golib/log"
 	"github.com/openark/golib/sqlutils"
@@ -30,6 +32,14 @@ func NewInternalKVStore() KVStore {
 	return &internalKVStore{}
 }
 
+func (this *internalKVStore) Name() string {
+	return "internal"
+}
+
+func (this *internalKVStore) IsConfigured() bool {
+	return true
+}
+
 func (this *internalKVStore) PutKeyValue(key string, value string) (err error) {
 	_, err = db.ExecOrchestrator(`
 		replace
@@ -50,7 +60,7 @@ func (this *internalKVStore) GetKeyValue(key string) (value string, err error) {
 		from
 			kv_store
 		where
-      key = ?
+      store_key = ?
 		`
 
 	err = db.QueryOrchestrator(query, sqlutils.Args(key), func(m sqlutils.RowMap) error {
@@ -60,3 +70,45 @@ func (this *internalKVStore) GetKeyValue(key string) (value string, err error) {
 
 	return value, log.Errore(err)
 }
+
+// putInternalKVPairsUpdating writes given pairs, along with the pair of given key whose value is computed by given
+// function off the key's current value, in a single transaction. The current value is read under lock, such that
+// concurrent updates of the key are serialized.
+func putInternalKVPairsUpdating(kvPairs [](*KVPair), updateKey string, update func(value string) (string, error)) (updatedPair *KVPair, err error) {
+	dbh, err := db.OpenOrchestrator()
+	if err != nil {
+		return nil, log.Errore(err)
+	}
+	tx, err := dbh.Begin()
+	if err != nil {
+		return nil, log.Errore(err)
+	}
+	query := `select store_value from kv_store where store_key = ? for update`
+	replaceQuery := `replace into kv_store (store_key, store_value, last_updated) values (?, ?, now())`
+	if db.IsSQLite() {
+		// sqlite serializes write transactions, and has no locking reads
+		query = `select store_value from kv_store where store_key = ?`
+		replaceQuery = sqlutils.ToSqlite3Dialect(replaceQuery)
+	}
+	var value string
+	if err := tx.QueryRow(query, updateKey).Scan(&value); err != nil && err != sql.ErrNoRows {
+		tx.Rollback()
+		return nil, log.Errore(err)
+	}
+	if value, err = update(value); err != nil {
+		// The caller's error, for the caller to log
+		tx.Rollback()
+		return nil, err
+	}
+	updatedPair = NewKVPair(updateKey, value)
+	for _, kvPair := range append(append([](*KVPair){}, kvPairs...), updatedPair) {
+		if _, err := tx.Exec(replaceQuery, kvPair.Key, kvPair.Value); err != nil {
+			tx.Rollback()
+			return nil, log.Errore(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, log.Errore(err)
+	}
+	return updatedPair, nil
+}
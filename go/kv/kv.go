@@ -37,6 +37,15 @@ func (this *KVPair) String() string {
 type KVStore interface {
 	PutKeyValue(key string, value string) (err error)
 	GetKeyValue(key string) (value string, err error)
+	Name() string
+	IsConfigured() bool
+}
+
+// KVStoreValue is the value of a key as read from a specific KV store
+type KVStoreValue struct {
+	Store string
+	Value string
+	Error string
 }
 
 var kvMutex sync.Mutex
@@ -89,3 +98,42 @@ func PutKVPair(kvPair *KVPair) (err error) {
 	}
 	return PutValue(kvPair.Key, kvPair.Value)
 }
+
+// PutKVPairsUpdating writes given pairs, along with the pair of given key whose value is computed by given function
+// off the key's current value. The internal store, which holds the current value, is written in a single transaction,
+// such that the pairs are written together and concurrent updates of the key are serialized. The other stores are
+// then written the same pairs. The updated pair is returned.
+func PutKVPairsUpdating(kvPairs [](*KVPair), updateKey string, update func(value string) (string, error)) (updatedPair *KVPair, err error) {
+	if updatedPair, err = putInternalKVPairsUpdating(kvPairs, updateKey, update); err != nil {
+		return nil, err
+	}
+	kvPairs = append(append([](*KVPair){}, kvPairs...), updatedPair)
+	for _, store := range getKVStores() {
+		if store.Name() == NewInternalKVStore().Name() {
+			continue
+		}
+		for _, kvPair := range kvPairs {
+			if err := store.PutKeyValue(kvPair.Key, kvPair.Value); err != nil {
+				return updatedPair, err
+			}
+		}
+	}
+	return updatedPair, nil
+}
+
+// GetStoresValues reads a key from each configured KV store
+func GetStoresValues(key string) (values []KVStoreValue) {
+	for _, store := range getKVStores() {
+		if !store.IsConfigured() {
+			continue
+		}
+		storeValue := KVStoreValue{Store: store.Name()}
+		if value, err := store.GetKeyValue(key); err != nil {
+			storeValue.Error = err.Error()
+		} else {
+			storeValue.Value = value
+		}
+		values = append(values, storeValue)
+	}
+	return values
+}
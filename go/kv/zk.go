@@ -51,6 +51,14 @@ func NewZkStore() KVStore {
 	return store
 }
 
+func (this *zkStore) Name() string {
+	return "zk"
+}
+
+func (this *zkStore) IsConfigured() bool {
+	return this.zook != nil
+}
+
 func (this *zkStore) PutKeyValue(key string, value string) (err error) {
 	if this.zook == nil {
 		return nil
@@ -0,0 +1,292 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/github/orchestrator/go/inst"
+	"github.com/github/orchestrator/go/process"
+	"github.com/github/orchestrator/go/util"
+	"github.com/openark/golib/log"
+	"github.com/patrickmn/go-cache"
+)
+
+// AsyncJobStatus is the status of an asynchronous job
+type AsyncJobStatus string
+
+const (
+	AsyncJobRunning   AsyncJobStatus = "running"
+	AsyncJobCompleted AsyncJobStatus = "completed"
+	AsyncJobFailed    AsyncJobStatus = "failed"
+	AsyncJobCanceled  AsyncJobStatus = "canceled"
+)
+
+// AsyncJob is a long running operation, executed in the background by this orchestrator node. The job
+// operates on replicas a batch at a time, and lists the outcome of each, so that its progress can be followed
+// and it can be canceled between batches.
+type AsyncJob struct {
+	Id              string
+	Operation       string
+	Key             inst.InstanceKey
+	DestinationKey  inst.InstanceKey
+	Owner           string
+	Status          AsyncJobStatus
+	CountTotal      int
+	CountCompleted  int
+	Results         []inst.InstanceKey
+	Errors          []string
+	CancelRequested bool
+	StartedAt       time.Time
+	EndedAt         *time.Time
+}
+
+// IsRunning returns true when the job did not complete yet
+func (this *AsyncJob) IsRunning() bool {
+	return this.Status == AsyncJobRunning
+}
+
+// asyncJobs keeps the jobs run by this node; completed jobs are kept for an hour
+var asyncJobs = cache.New(time.Hour, time.Minute)
+var asyncJobsMutex sync.Mutex
+
+// newAsyncJob starts tracking a job. Running jobs do not expire.
+func newAsyncJob(operation string, key *inst.InstanceKey, destinationKey *inst.InstanceKey, owner string, countTotal int) *AsyncJob {
+	asyncJobsMutex.Lock()
+	defer asyncJobsMutex.Unlock()
+
+	job := &AsyncJob{
+		Id:         util.PrettyUniqueToken(),
+		Operation:  operation,
+		Key:        *key,
+		Owner:      owner,
+		Status:     AsyncJobRunning,
+		CountTotal: countTotal,
+		Results:    []inst.InstanceKey{},
+		Errors:     []string{},
+		StartedAt:  time.Now(),
+	}
+	if destinationKey != nil {
+		job.DestinationKey = *destinationKey
+	}
+	asyncJobs.Set(job.Id, job, cache.NoExpiration)
+	return job
+}
+
+// updateAsyncJob applies given change onto a job. A job which completed starts expiring.
+func updateAsyncJob(jobId string, change func(job *AsyncJob)) {
+	asyncJobsMutex.Lock()
+	defer asyncJobsMutex.Unlock()
+
+	value, found := asyncJobs.Get(jobId)
+	if !found {
+		return
+	}
+	job := value.(*AsyncJob)
+	change(job)
+	expiration := cache.NoExpiration
+	if !job.IsRunning() {
+		expiration = cache.DefaultExpiration
+	}
+	asyncJobs.Set(jobId, job, expiration)
+}
+
+// copyAsyncJob returns a copy of a job, safe to read while the job makes progress
+func copyAsyncJob(job *AsyncJob) AsyncJob {
+	jobCopy := *job
+	jobCopy.Results = append([]inst.InstanceKey{}, job.Results...)
+	jobCopy.Errors = append([]string{}, job.Errors...)
+	return jobCopy
+}
+
+// ReadAsyncJob returns a job run by this orchestrator node
+func ReadAsyncJob(jobId string) (job AsyncJob, found bool) {
+	asyncJobsMutex.Lock()
+	defer asyncJobsMutex.Unlock()
+
+	value, found := asyncJobs.Get(jobId)
+	if !found {
+		return job, false
+	}
+	return copyAsyncJob(value.(*AsyncJob)), true
+}
+
+// ReadAsyncJobs returns the jobs run by this orchestrator node, most recent first
+func ReadAsyncJobs() (jobs []AsyncJob) {
+	asyncJobsMutex.Lock()
+	defer asyncJobsMutex.Unlock()
+
+	jobs = []AsyncJob{}
+	for _, item := range asyncJobs.Items() {
+		jobs = append(jobs, copyAsyncJob(item.Object.(*AsyncJob)))
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].StartedAt.After(jobs[j].StartedAt) })
+	return jobs
+}
+
+// CancelAsyncJob requests a running job to stop. The job stops once it is done with the batch of replicas it
+// currently operates on.
+func CancelAsyncJob(jobId string) (err error) {
+	found := false
+	updateAsyncJob(jobId, func(job *AsyncJob) {
+		found = true
+		if !job.IsRunning() {
+			err = fmt.Errorf("Job %s is not running; status: %s", jobId, job.Status)
+			return
+		}
+		job.CancelRequested = true
+	})
+	if !found {
+		return fmt.Errorf("Job not found: %s", jobId)
+	}
+	return err
+}
+
+// asyncJobBatchSize is the number of replicas a relocation job moves at once. The replicas of a batch are moved
+// together, e.g. via GTID or Pseudo-GTID, as a synchronous relocation would; the job can be canceled between batches.
+const asyncJobBatchSize = 10
+
+// startReplicasJob starts a job operating on given replicas in the background, in batches of given size
+func startReplicasJob(operation string, key *inst.InstanceKey, destinationKey *inst.InstanceKey, owner string, replicas [](*inst.Instance), batchSize int, operate func(replicas [](*inst.Instance)) ([](*inst.Instance), []error)) (*AsyncJob, error) {
+	if process.IsShuttingDown() {
+		return nil, fmt.Errorf("Shutting down; not starting %s job on %+v", operation, *key)
+	}
+	job := newAsyncJob(operation, key, destinationKey, owner, len(replicas))
+	jobCopy := copyAsyncJob(job)
+	go runReplicasJob(job, replicas, batchSize, operate)
+	return &jobCopy, nil
+}
+
+// runReplicasJob operates on given replicas in batches of given size, recording the outcome of each batch onto
+// the job. It stops early when the job is canceled, or when this node, which was the leader as the job started,
+// is no longer the leader. The job is an in-flight operation, which a shutdown waits on to complete.
+func runReplicasJob(job *AsyncJob, replicas [](*inst.Instance), batchSize int, operate func(replicas [](*inst.Instance)) ([](*inst.Instance), []error)) {
+	inFlightOperationId := process.BeginInFlightOperation(fmt.Sprintf("job %s: %s %+v", job.Id, job.Operation, job.Key))
+	defer process.EndInFlightOperation(inFlightOperationId)
+
+	panicked := false
+	defer func() {
+		if r := recover(); r != nil {
+			panicked = true
+			log.Errorf("runReplicasJob: job %s panicked: %+v", job.Id, r)
+			updateAsyncJob(job.Id, func(job *AsyncJob) { job.Errors = append(job.Errors, fmt.Sprintf("panic: %+v", r)) })
+		}
+		endReplicasJob(job, panicked)
+	}()
+
+	wasLeader := IsLeader()
+	for len(replicas) > 0 {
+		if wasLeader && !IsLeader() {
+			updateAsyncJob(job.Id, func(job *AsyncJob) {
+				job.CancelRequested = true
+				job.Errors = append(job.Errors, "stopped: this node is no longer the leader")
+			})
+		}
+		canceled := false
+		updateAsyncJob(job.Id, func(job *AsyncJob) { canceled = job.CancelRequested })
+		if canceled {
+			break
+		}
+		batch := replicas
+		if len(batch) > batchSize {
+			batch = batch[:batchSize]
+		}
+		replicas = replicas[len(batch):]
+
+		operated, errs := operate(batch)
+		updateAsyncJob(job.Id, func(job *AsyncJob) {
+			job.CountCompleted += len(batch)
+			for _, err := range errs {
+				job.Errors = append(job.Errors, err.Error())
+			}
+			for _, instance := range operated {
+				if instance != nil {
+					job.Results = append(job.Results, instance.Key)
+				}
+			}
+		})
+	}
+}
+
+// endReplicasJob sets the final status of a job, and audits its outcome
+func endReplicasJob(job *AsyncJob, failed bool) {
+	var summary string
+	updateAsyncJob(job.Id, func(job *AsyncJob) {
+		now := time.Now()
+		job.EndedAt = &now
+		switch {
+		case failed:
+			job.Status = AsyncJobFailed
+		case job.CancelRequested:
+			job.Status = AsyncJobCanceled
+		case len(job.Results) == 0 && len(job.Errors) > 0:
+			job.Status = AsyncJobFailed
+		default:
+			job.Status = AsyncJobCompleted
+		}
+		summary = fmt.Sprintf("job %s: %s %s; %d replicas out of %d succeeded; %d errors", job.Id, job.Operation, job.Status, len(job.Results), job.CountTotal, len(job.Errors))
+	})
+	log.Infof("runReplicasJob: %s", summary)
+	inst.AuditOperation("async-job", &job.Key, summary)
+}
+
+// StartRelocateReplicasJob relocates replicas of an instance below another instance, in the background,
+// a batch of replicas at a time. Replicas are optionally filtered by pattern.
+func StartRelocateReplicasJob(instanceKey, belowKey *inst.InstanceKey, pattern string, owner string) (*AsyncJob, error) {
+	if _, found, err := inst.ReadInstance(belowKey); err != nil || !found {
+		return nil, fmt.Errorf("Error reading %+v: %+v", *belowKey, err)
+	}
+	replicas, err := inst.ReadReplicaInstances(instanceKey)
+	if err != nil {
+		return nil, err
+	}
+	replicas = inst.RemoveInstance(replicas, belowKey)
+	replicas = inst.FilterInstancesByPattern(replicas, pattern)
+
+	return startReplicasJob("relocate-replicas", instanceKey, belowKey, owner, replicas, asyncJobBatchSize, func(replicas [](*inst.Instance)) ([](*inst.Instance), []error) {
+		relocated, err, errs := inst.RelocateGivenReplicas(replicas, instanceKey, belowKey)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		return relocated, errs
+	})
+}
+
+// StartMatchUpReplicasJob matches replicas of an instance up the topology, making them its siblings, in the
+// background, one replica at a time. Replicas are optionally filtered by pattern.
+func StartMatchUpReplicasJob(instanceKey *inst.InstanceKey, pattern string, owner string) (*AsyncJob, error) {
+	instance, found, err := inst.ReadInstance(instanceKey)
+	if err != nil || !found {
+		return nil, fmt.Errorf("Error reading %+v: %+v", *instanceKey, err)
+	}
+	replicas, err := inst.ReadReplicaInstances(instanceKey)
+	if err != nil {
+		return nil, err
+	}
+	replicas = inst.FilterInstancesByPattern(replicas, pattern)
+
+	return startReplicasJob("match-up-replicas", instanceKey, &instance.MasterKey, owner, replicas, 1, func(replicas [](*inst.Instance)) ([](*inst.Instance), []error) {
+		matched, _, err := inst.MatchUp(&replicas[0].Key, true)
+		if err != nil {
+			return nil, []error{fmt.Errorf("%+v: %+v", replicas[0].Key, err)}
+		}
+		return [](*inst.Instance){matched}, nil
+	})
+}
@@ -0,0 +1,126 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/github/orchestrator/go/inst"
+	"github.com/github/orchestrator/go/process"
+	test "github.com/openark/golib/tests"
+)
+
+func newAsyncJobReplicas(count int) (replicas [](*inst.Instance)) {
+	for i := 0; i < count; i++ {
+		replicas = append(replicas, &inst.Instance{Key: inst.InstanceKey{Hostname: fmt.Sprintf("replica-%d", i), Port: 3306}})
+	}
+	return replicas
+}
+
+// newTestAsyncJob tracks a job for given replicas. The job's instance key is left empty, such that auditing the
+// job does not look up the cluster of its instance.
+func newTestAsyncJob(replicas [](*inst.Instance)) *AsyncJob {
+	return newAsyncJob("relocate-replicas", &inst.InstanceKey{}, &inst.InstanceKey{Hostname: "im", Port: 3306}, "test", len(replicas))
+}
+
+func isInFlightAsyncJob(jobId string) bool {
+	for _, operation := range process.ReadInFlightOperations() {
+		if strings.HasPrefix(operation.Description, fmt.Sprintf("job %s:", jobId)) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRunReplicasJobBatches(t *testing.T) {
+	withSQLiteBackend(t)
+
+	replicas := newAsyncJobReplicas(25)
+	job := newTestAsyncJob(replicas)
+	batchSizes := []int{}
+	inFlight := true
+	runReplicasJob(job, replicas, 10, func(batch [](*inst.Instance)) ([](*inst.Instance), []error) {
+		batchSizes = append(batchSizes, len(batch))
+		inFlight = inFlight && isInFlightAsyncJob(job.Id)
+		if batch[0].Key.Hostname == "replica-10" {
+			return batch[1:], []error{fmt.Errorf("%+v: cannot relocate", batch[0].Key)}
+		}
+		return batch, nil
+	})
+	test.S(t).ExpectEquals(fmt.Sprintf("%+v", batchSizes), "[10 10 5]")
+	test.S(t).ExpectTrue(inFlight)
+	test.S(t).ExpectFalse(isInFlightAsyncJob(job.Id))
+
+	result, found := ReadAsyncJob(job.Id)
+	test.S(t).ExpectTrue(found)
+	test.S(t).ExpectEquals(result.Status, AsyncJobCompleted)
+	test.S(t).ExpectEquals(result.CountCompleted, 25)
+	test.S(t).ExpectEquals(len(result.Results), 24)
+	test.S(t).ExpectEquals(len(result.Errors), 1)
+	test.S(t).ExpectNotNil(result.EndedAt)
+}
+
+func TestRunReplicasJobCanceled(t *testing.T) {
+	withSQLiteBackend(t)
+
+	replicas := newAsyncJobReplicas(25)
+	job := newTestAsyncJob(replicas)
+	runReplicasJob(job, replicas, 10, func(batch [](*inst.Instance)) ([](*inst.Instance), []error) {
+		test.S(t).ExpectNil(CancelAsyncJob(job.Id))
+		return batch, nil
+	})
+	result, _ := ReadAsyncJob(job.Id)
+	test.S(t).ExpectEquals(result.Status, AsyncJobCanceled)
+	test.S(t).ExpectEquals(result.CountCompleted, 10)
+	test.S(t).ExpectNotNil(CancelAsyncJob(job.Id))
+}
+
+func TestRunReplicasJobPanic(t *testing.T) {
+	withSQLiteBackend(t)
+
+	replicas := newAsyncJobReplicas(5)
+	job := newTestAsyncJob(replicas)
+	runReplicasJob(job, replicas, 10, func(batch [](*inst.Instance)) ([](*inst.Instance), []error) {
+		panic("unexpected")
+	})
+	result, _ := ReadAsyncJob(job.Id)
+	test.S(t).ExpectEquals(result.Status, AsyncJobFailed)
+	test.S(t).ExpectEquals(len(result.Errors), 1)
+	test.S(t).ExpectTrue(strings.Contains(result.Errors[0], "panic: unexpected"))
+	test.S(t).ExpectFalse(isInFlightAsyncJob(job.Id))
+}
+
+func TestRunReplicasJobStopsOnDemotion(t *testing.T) {
+	withSQLiteBackend(t)
+	atomic.StoreInt64(&isElectedNode, 1)
+	defer atomic.StoreInt64(&isElectedNode, 0)
+
+	replicas := newAsyncJobReplicas(25)
+	job := newTestAsyncJob(replicas)
+	runReplicasJob(job, replicas, 10, func(batch [](*inst.Instance)) ([](*inst.Instance), []error) {
+		atomic.StoreInt64(&isElectedNode, 0)
+		return batch, nil
+	})
+	result, _ := ReadAsyncJob(job.Id)
+	test.S(t).ExpectEquals(result.Status, AsyncJobCanceled)
+	test.S(t).ExpectEquals(result.CountCompleted, 10)
+	test.S(t).ExpectEquals(len(result.Errors), 1)
+	test.S(t).ExpectTrue(strings.Contains(result.Errors[0], "no longer the leader"))
+}
@@ -0,0 +1,115 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+
+	"github.com/github/orchestrator/go/agent"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/openark/golib/log"
+)
+
+// selectBackupSource picks the replica on which a cluster's backup is taken: a healthy replica with an agent,
+// within the policy's lag limit. Replicas in the policy's preferred data center are preferred, then least lagging.
+func selectBackupSource(policy *agent.BackupPolicy, clusterInstances [](*inst.Instance), agentHosts map[string]bool) *inst.Instance {
+	candidates := [](*inst.Instance){}
+	for _, instance := range clusterInstances {
+		if !agentHosts[instance.Key.Hostname] {
+			continue
+		}
+		if !instance.IsLastCheckValid || instance.IsDowntimed {
+			continue
+		}
+		if !instance.IsReplica() || !instance.ReplicaRunning() || !instance.SlaveLagSeconds.Valid {
+			continue
+		}
+		if policy.MaxLagSeconds > 0 && instance.SlaveLagSeconds.Int64 > int64(policy.MaxLagSeconds) {
+			continue
+		}
+		candidates = append(candidates, instance)
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		iPreferred := policy.PreferredDataCenter != "" && candidates[i].DataCenter == policy.PreferredDataCenter
+		jPreferred := policy.PreferredDataCenter != "" && candidates[j].DataCenter == policy.PreferredDataCenter
+		if iPreferred != jPreferred {
+			return iPreferred
+		}
+		return candidates[i].SlaveLagSeconds.Int64 < candidates[j].SlaveLagSeconds.Int64
+	})
+	return candidates[0]
+}
+
+// BackupCluster takes a backup of a cluster as per its backup policy, on a replica selected by the policy
+func BackupCluster(policy *agent.BackupPolicy) (backupId int64, err error) {
+	agents, err := agent.ReadAgents()
+	if err != nil {
+		return backupId, err
+	}
+	agentHosts := make(map[string]bool)
+	for _, registeredAgent := range agents {
+		agentHosts[registeredAgent.Hostname] = true
+	}
+	clusterInstances, err := inst.ReadClusterInstances(policy.ClusterName)
+	if err != nil {
+		return backupId, err
+	}
+	source := selectBackupSource(policy, clusterInstances, agentHosts)
+	if source == nil {
+		return backupId, fmt.Errorf("BackupCluster: no eligible backup source found in cluster %s", policy.ClusterName)
+	}
+	return agent.Backup(policy.ClusterName, source.Key.Hostname, policy.Method)
+}
+
+// scheduleBackupsRunning is set while ScheduleBackups runs, such that a slow run is not overlapped by the next one
+var scheduleBackupsRunning int64
+
+// ScheduleBackups follows up on active backups, takes backups of clusters whose backup policy calls for a new
+// backup, and expires backups beyond policies' retention
+func ScheduleBackups() {
+	if !atomic.CompareAndSwapInt64(&scheduleBackupsRunning, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt64(&scheduleBackupsRunning, 0)
+
+	if err := agent.FollowUpBackups(); err != nil {
+		log.Errore(err)
+	}
+	policies, err := agent.ReadBackupPolicies("")
+	if err != nil {
+		log.Errore(err)
+		return
+	}
+	for _, policy := range policies {
+		policy := policy
+		if err := agent.ExpireBackups(&policy); err != nil {
+			log.Errore(err)
+		}
+		isDue, err := agent.IsBackupDue(&policy)
+		if err != nil || !isDue {
+			continue
+		}
+		if _, err := BackupCluster(&policy); err != nil {
+			log.Errore(err)
+		}
+	}
+}
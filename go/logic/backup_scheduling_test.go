@@ -0,0 +1,76 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/github/orchestrator/go/agent"
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+func TestSelectBackupSource(t *testing.T) {
+	masterKey := inst.InstanceKey{Hostname: "db-1", Port: 3306}
+	newInstance := func(hostname string, dataCenter string, lagSeconds int64) *inst.Instance {
+		instance := inst.NewInstance()
+		instance.Key = inst.InstanceKey{Hostname: hostname, Port: 3306}
+		instance.MasterKey = masterKey
+		instance.ReadBinlogCoordinates = inst.BinlogCoordinates{LogFile: "mysql-bin.000001", LogPos: 4}
+		instance.Slave_SQL_Running = true
+		instance.Slave_IO_Running = true
+		instance.SlaveLagSeconds = sql.NullInt64{Int64: lagSeconds, Valid: true}
+		instance.IsLastCheckValid = true
+		instance.DataCenter = dataCenter
+		return instance
+	}
+	master := newInstance("db-1", "east", 0)
+	master.MasterKey = inst.InstanceKey{}
+	lagging := newInstance("db-2", "east", 600)
+	west := newInstance("db-3", "west", 5)
+	east := newInstance("db-4", "east", 10)
+	downtimed := newInstance("db-5", "east", 0)
+	downtimed.IsDowntimed = true
+	stopped := newInstance("db-6", "east", 0)
+	stopped.Slave_SQL_Running = false
+	noAgent := newInstance("db-7", "east", 0)
+	unknownLag := newInstance("db-8", "east", 0)
+	unknownLag.SlaveLagSeconds = sql.NullInt64{}
+
+	clusterInstances := [](*inst.Instance){master, lagging, west, east, downtimed, stopped, noAgent, unknownLag}
+	agentHosts := map[string]bool{}
+	for _, instance := range clusterInstances {
+		agentHosts[instance.Key.Hostname] = instance != noAgent
+	}
+	sourceHostname := func(policy *agent.BackupPolicy) string {
+		if source := selectBackupSource(policy, clusterInstances, agentHosts); source != nil {
+			return source.Key.Hostname
+		}
+		return ""
+	}
+	test.S(t).ExpectEquals(sourceHostname(&agent.BackupPolicy{}), "db-3")
+	test.S(t).ExpectEquals(sourceHostname(&agent.BackupPolicy{PreferredDataCenter: "east"}), "db-4")
+	test.S(t).ExpectEquals(sourceHostname(&agent.BackupPolicy{PreferredDataCenter: "north"}), "db-3")
+	test.S(t).ExpectEquals(sourceHostname(&agent.BackupPolicy{PreferredDataCenter: "east", MaxLagSeconds: 5}), "db-3")
+	test.S(t).ExpectEquals(sourceHostname(&agent.BackupPolicy{MaxLagSeconds: 1}), "")
+
+	// Only the lagging replica is left
+	clusterInstances = [](*inst.Instance){master, lagging, downtimed, stopped, noAgent}
+	test.S(t).ExpectEquals(sourceHostname(&agent.BackupPolicy{PreferredDataCenter: "west"}), "db-2")
+	test.S(t).ExpectEquals(sourceHostname(&agent.BackupPolicy{MaxLagSeconds: 60}), "")
+}
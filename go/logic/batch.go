@@ -0,0 +1,219 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/github/orchestrator/go/inst"
+	"github.com/github/orchestrator/go/raft"
+	"github.com/openark/golib/log"
+)
+
+// BatchOperation is a single topology operation within a batch
+type BatchOperation struct {
+	Command         string // e.g. "relocate", "set-read-only", "begin-downtime"
+	Key             inst.InstanceKey
+	DestinationKey  inst.InstanceKey // for relocation commands
+	Pattern         string           // for relocate-replicas
+	Owner           string           // for downtime/maintenance
+	Reason          string           // for downtime/maintenance
+	DurationSeconds int              // for downtime
+}
+
+// BatchRequest is an ordered list of operations, executed sequentially with stop-on-error.
+// Should any operation fail, the Rollback operations are executed in order, in best-effort manner.
+type BatchRequest struct {
+	Operations []BatchOperation
+	Rollback   []BatchOperation
+}
+
+// BatchOperationResult is the outcome of a single batch operation
+type BatchOperationResult struct {
+	Operation BatchOperation
+	Executed  bool
+	Success   bool
+	Error     string
+	Details   interface{}
+}
+
+// BatchResult is the outcome of a batch execution
+type BatchResult struct {
+	Success         bool
+	Results         []BatchOperationResult
+	RolledBack      bool
+	RollbackResults []BatchOperationResult
+}
+
+// batchOperationFunctions maps a batch command onto its implementation
+var batchOperationFunctions = map[string]func(operation *BatchOperation) (interface{}, error){
+	"relocate": func(operation *BatchOperation) (interface{}, error) {
+		return inst.RelocateBelow(&operation.Key, &operation.DestinationKey)
+	},
+	"relocate-replicas": func(operation *BatchOperation) (interface{}, error) {
+		replicas, _, err, _ := inst.RelocateReplicas(&operation.Key, &operation.DestinationKey, operation.Pattern)
+		return replicas, err
+	},
+	"move-up": func(operation *BatchOperation) (interface{}, error) {
+		return inst.MoveUp(&operation.Key)
+	},
+	"move-below": func(operation *BatchOperation) (interface{}, error) {
+		return inst.MoveBelow(&operation.Key, &operation.DestinationKey)
+	},
+	"set-read-only": func(operation *BatchOperation) (interface{}, error) {
+		return inst.SetReadOnly(&operation.Key, true)
+	},
+	"set-writeable": func(operation *BatchOperation) (interface{}, error) {
+		return inst.SetReadOnly(&operation.Key, false)
+	},
+	"start-slave": func(operation *BatchOperation) (interface{}, error) {
+		return inst.StartSlave(&operation.Key)
+	},
+	"stop-slave": func(operation *BatchOperation) (interface{}, error) {
+		return inst.StopSlave(&operation.Key)
+	},
+	"begin-downtime": func(operation *BatchOperation) (interface{}, error) {
+		if operation.DurationSeconds < 0 {
+			return nil, fmt.Errorf("Duration value must be non-negative. Given value: %d", operation.DurationSeconds)
+		}
+		downtime := inst.NewDowntime(&operation.Key, operation.Owner, operation.Reason, time.Duration(operation.DurationSeconds)*time.Second)
+		if orcraft.IsRaftEnabled() {
+			_, err := orcraft.PublishCommand("begin-downtime", downtime)
+			return operation.Key, err
+		}
+		return operation.Key, inst.BeginDowntime(downtime)
+	},
+	"end-downtime": func(operation *BatchOperation) (interface{}, error) {
+		if orcraft.IsRaftEnabled() {
+			_, err := orcraft.PublishCommand("end-downtime", operation.Key)
+			return operation.Key, err
+		}
+		_, err := inst.EndDowntime(&operation.Key)
+		return operation.Key, err
+	},
+	"begin-maintenance": func(operation *BatchOperation) (interface{}, error) {
+		return inst.BeginMaintenance(&operation.Key, operation.Owner, operation.Reason)
+	},
+	"end-maintenance": func(operation *BatchOperation) (interface{}, error) {
+		return inst.EndMaintenanceByInstanceKey(&operation.Key)
+	},
+}
+
+func init() {
+	batchOperationFunctions["start-replica"] = batchOperationFunctions["start-slave"]
+	batchOperationFunctions["stop-replica"] = batchOperationFunctions["stop-slave"]
+}
+
+// ValidateBatchRequest makes sure all commands in the batch are known, before anything gets executed
+func ValidateBatchRequest(batch *BatchRequest) error {
+	if len(batch.Operations) == 0 {
+		return fmt.Errorf("Batch has no operations")
+	}
+	for _, operations := range [][]BatchOperation{batch.Operations, batch.Rollback} {
+		for i, operation := range operations {
+			if _, ok := batchOperationFunctions[operation.Command]; !ok {
+				return fmt.Errorf("Unknown batch command in operation %d: %s", i+1, operation.Command)
+			}
+			if !operation.Key.IsValid() {
+				return fmt.Errorf("Invalid instance key in operation %d: %+v", i+1, operation.Key)
+			}
+		}
+	}
+	return nil
+}
+
+// checkBatchOperationClusterLock returns an error when the cluster of the operation's instance, or of its
+// destination, is locked by an owner other than given actor
+func checkBatchOperationClusterLock(operation *BatchOperation, actor string) error {
+	for _, instanceKey := range []inst.InstanceKey{operation.Key, operation.DestinationKey} {
+		if !instanceKey.IsValid() {
+			continue
+		}
+		clusterName, err := inst.GetClusterName(&instanceKey)
+		if err != nil {
+			return err
+		}
+		if clusterName == "" {
+			// Unknown instance; the operation itself fails
+			continue
+		}
+		clusterAlias, err := inst.ReadAliasByClusterName(clusterName)
+		if err != nil {
+			return err
+		}
+		if err := inst.CheckClusterLock(clusterAlias, actor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// executeBatchOperations executes operations in order, on behalf of given actor. With stopOnError, execution stops
+// on first failure and remaining operations are reported as not executed. An operation on a cluster locked by other
+// than the actor fails.
+func executeBatchOperations(operations []BatchOperation, actor string, stopOnError bool) (results []BatchOperationResult, success bool) {
+	results = []BatchOperationResult{}
+	success = true
+	for _, operation := range operations {
+		operation := operation
+		result := BatchOperationResult{Operation: operation}
+		if success || !stopOnError {
+			var details interface{}
+			err := checkBatchOperationClusterLock(&operation, actor)
+			if err == nil {
+				result.Executed = true
+				details, err = batchOperationFunctions[operation.Command](&operation)
+			}
+			result.Details = details
+			if err == nil {
+				result.Success = true
+			} else {
+				result.Error = err.Error()
+				success = false
+				log.Errorf("batch: %s on %+v failed: %+v", operation.Command, operation.Key, err)
+			}
+		}
+		results = append(results, result)
+	}
+	return results, success
+}
+
+// ExecuteBatch executes the batch's operations sequentially on behalf of given actor, stopping on first error.
+// Upon error, the batch's rollback operations are executed in best-effort manner.
+// A batch touching a cluster locked by other than the actor is rejected up front. Each operation checks the lock
+// again as it executes, such that a lock taken while the batch runs stops it.
+func ExecuteBatch(batch *BatchRequest, actor string) (*BatchResult, error) {
+	if err := ValidateBatchRequest(batch); err != nil {
+		return nil, err
+	}
+	for _, operations := range [][]BatchOperation{batch.Operations, batch.Rollback} {
+		for i := range operations {
+			if err := checkBatchOperationClusterLock(&operations[i], actor); err != nil {
+				return nil, err
+			}
+		}
+	}
+	batchResult := &BatchResult{}
+	batchResult.Results, batchResult.Success = executeBatchOperations(batch.Operations, actor, true)
+	if !batchResult.Success && len(batch.Rollback) > 0 {
+		batchResult.RollbackResults, _ = executeBatchOperations(batch.Rollback, actor, false)
+		batchResult.RolledBack = true
+	}
+	inst.AuditOperation("batch", nil, fmt.Sprintf("executed batch of %d operations; success: %+v; rolled back: %+v", len(batch.Operations), batchResult.Success, batchResult.RolledBack))
+	return batchResult, nil
+}
@@ -0,0 +1,74 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"testing"
+
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+func TestExecuteBatchChecksClusterLocks(t *testing.T) {
+	withSQLiteBackend(t)
+	masterKey := inst.InstanceKey{Hostname: "batch-master", Port: 3306}
+	replicaKey := inst.InstanceKey{Hostname: "batch-replica", Port: 3306}
+	otherKey := inst.InstanceKey{Hostname: "batch-other", Port: 3306}
+	writeTestInstance(t, masterKey, inst.InstanceKey{}, "batch-master:3306")
+	writeTestInstance(t, replicaKey, masterKey, "batch-master:3306")
+	writeTestInstance(t, otherKey, inst.InstanceKey{}, "batch-other:3306")
+	test.S(t).ExpectNil(inst.SetClusterAlias("batch-master:3306", "orders"))
+	test.S(t).ExpectNil(inst.WriteClusterLock(inst.NewClusterLock("batch-master:3306", "orders", "alice", "reorganizing", 600)))
+
+	batch := &BatchRequest{
+		Operations: []BatchOperation{
+			{Command: "begin-maintenance", Key: otherKey, Owner: "bob", Reason: "batch"},
+			{Command: "begin-maintenance", Key: replicaKey, Owner: "bob", Reason: "batch"},
+		},
+	}
+	{
+		// Rejected up front: nothing is executed
+		_, err := ExecuteBatch(batch, "bob")
+		test.S(t).ExpectNotNil(err)
+		inMaintenance, err := inst.InMaintenance(&otherKey)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectFalse(inMaintenance)
+	}
+	{
+		// A rollback operation on a locked cluster rejects the batch just the same
+		rollbackBatch := &BatchRequest{
+			Operations: batch.Operations[0:1],
+			Rollback:   []BatchOperation{{Command: "end-maintenance", Key: replicaKey}},
+		}
+		_, err := ExecuteBatch(rollbackBatch, "bob")
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		// A lock taken as the batch runs stops it
+		results, success := executeBatchOperations(batch.Operations, "bob", true)
+		test.S(t).ExpectFalse(success)
+		test.S(t).ExpectTrue(results[0].Success)
+		test.S(t).ExpectFalse(results[1].Executed)
+		test.S(t).ExpectTrue(results[1].Error != "")
+	}
+	{
+		// The lock holder may operate
+		batchResult, err := ExecuteBatch(&BatchRequest{Operations: batch.Operations[1:]}, "alice")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectTrue(batchResult.Success)
+	}
+}
@@ -21,6 +21,7 @@ import (
 
 	"github.com/github/orchestrator/go/inst"
 	"github.com/github/orchestrator/go/kv"
+	"github.com/github/orchestrator/go/process"
 	"github.com/github/orchestrator/go/raft"
 
 	"github.com/openark/golib/log"
@@ -63,6 +64,12 @@ func (applier *CommandApplier) ApplyCommand(op string, value []byte) interface{}
 		return applier.registerHostnameUnresolve(value)
 	case "submit-pool-instances":
 		return applier.submitPoolInstances(value)
+	case "apply-pool-membership-change":
+		return applier.applyPoolMembershipChange(value)
+	case "write-pool-spec":
+		return applier.writePoolSpec(value)
+	case "delete-pool-spec":
+		return applier.deletePoolSpec(value)
 	case "register-failure-detection":
 		return applier.registerFailureDetection(value)
 	case "write-recovery":
@@ -71,16 +78,90 @@ func (applier *CommandApplier) ApplyCommand(op string, value []byte) interface{}
 		return applier.writeRecoveryStep(value)
 	case "resolve-recovery":
 		return applier.resolveRecovery(value)
+	case "write-recovery-bundle":
+		return applier.writeRecoveryBundle(value)
+	case "write-dead-master-postmortem-watch":
+		return applier.writeDeadMasterPostmortemWatch(value)
+	case "delete-dead-master-postmortem-watch":
+		return applier.deleteDeadMasterPostmortemWatch(value)
+	case "write-recovery-approval":
+		return applier.writeRecoveryApproval(value)
+	case "set-desired-topology":
+		return applier.setDesiredTopology(value)
 	case "disable-global-recoveries":
 		return applier.disableGlobalRecoveries(value)
 	case "enable-global-recoveries":
 		return applier.enableGlobalRecoveries(value)
 	case "put-key-value":
 		return applier.putKeyValue(value)
+	case "write-cluster-master-entries":
+		return applier.writeClusterMasterEntries(value)
 	case "leader-uri":
 		return applier.leaderURI(value)
 	case "request-health-report":
 		return applier.healthReport(value)
+	case "write-instance-probe-outcomes":
+		return applier.writeInstanceProbeOutcomes(value)
+	case "import-state":
+		return applier.importState(value)
+	case "override-promotion-rule":
+		return applier.overridePromotionRule(value)
+	case "clear-promotion-rule-override":
+		return applier.clearPromotionRuleOverride(value)
+	case "lock-cluster":
+		return applier.lockCluster(value)
+	case "unlock-cluster":
+		return applier.unlockCluster(value)
+	case "pause-discovery":
+		return applier.pauseDiscovery(value)
+	case "resume-discovery":
+		return applier.resumeDiscovery(value)
+	case "pin-master":
+		return applier.pinMaster(value)
+	case "unpin-master":
+		return applier.unpinMaster(value)
+	case "register-schema-migration":
+		return applier.registerSchemaMigration(value)
+	case "unregister-schema-migration":
+		return applier.unregisterSchemaMigration(value)
+	case "write-api-token":
+		return applier.writeAPIToken(value)
+	case "delete-api-token":
+		return applier.deleteAPIToken(value)
+	case "write-delayed-replica":
+		return applier.writeDelayedReplica(value)
+	case "delete-delayed-replica":
+		return applier.deleteDelayedReplica(value)
+	case "set-instance-flag":
+		return applier.setInstanceFlag(value)
+	case "clear-instance-flag":
+		return applier.clearInstanceFlag(value)
+	case "write-scheduled-revert":
+		return applier.writeScheduledRevert(value)
+	case "write-instance-decommission":
+		return applier.writeInstanceDecommission(value)
+	case "set-instance-note":
+		return applier.setInstanceNote(value)
+	case "clear-instance-note":
+		return applier.clearInstanceNote(value)
+	case "set-cluster-note":
+		return applier.setClusterNote(value)
+	case "clear-cluster-note":
+		return applier.clearClusterNote(value)
+	case "seed-hostname-resolve":
+		return applier.seedHostnameResolve(value)
+	case "unseed-hostname-resolve":
+		return applier.unseedHostnameResolve(value)
+	case "invalidate-hostname-resolves":
+		return applier.invalidateHostnameResolves(value)
+	case "change-recovery-block":
+		return applier.changeRecoveryBlock(value)
+	case "request-recovery-abort":
+		return applier.requestRecoveryAbort(value)
+	case "write-state-event-subscription":
+		return applier.writeStateEventSubscription(value)
+	case "delete-state-event-subscription":
+		return applier.deleteStateEventSubscription(value)
 	}
 	return log.Errorf("Unknown command op: %s", op)
 }
@@ -239,6 +320,78 @@ func (applier *CommandApplier) resolveRecovery(value []byte) interface{} {
 	return nil
 }
 
+func (applier *CommandApplier) writeRecoveryBundle(value []byte) interface{} {
+	bundle := NewTopologyRecoveryBundle("", inst.ReplicationAnalysis{})
+	if err := json.Unmarshal(value, bundle); err != nil {
+		return log.Errore(err)
+	}
+	err := writeTopologyRecoveryBundle(bundle)
+	return err
+}
+
+func (applier *CommandApplier) writeDeadMasterPostmortemWatch(value []byte) interface{} {
+	watch := DeadMasterPostmortemWatch{}
+	if err := json.Unmarshal(value, &watch); err != nil {
+		return log.Errore(err)
+	}
+	err := writeDeadMasterPostmortemWatch(&watch)
+	return err
+}
+
+func (applier *CommandApplier) deleteDeadMasterPostmortemWatch(value []byte) interface{} {
+	watch := DeadMasterPostmortemWatch{}
+	if err := json.Unmarshal(value, &watch); err != nil {
+		return log.Errore(err)
+	}
+	_, err := deleteDeadMasterPostmortemWatch(&watch)
+	return err
+}
+
+func (applier *CommandApplier) writeRecoveryApproval(value []byte) interface{} {
+	approval := RecoveryApproval{}
+	if err := json.Unmarshal(value, &approval); err != nil {
+		return log.Errore(err)
+	}
+	err := writeRecoveryApproval(&approval)
+	return err
+}
+
+func (applier *CommandApplier) applyPoolMembershipChange(value []byte) interface{} {
+	change := inst.PoolMembershipChange{}
+	if err := json.Unmarshal(value, &change); err != nil {
+		return log.Errore(err)
+	}
+	err := inst.ApplyPoolMembershipChange(&change)
+	return err
+}
+
+func (applier *CommandApplier) writePoolSpec(value []byte) interface{} {
+	spec := inst.PoolSpec{}
+	if err := json.Unmarshal(value, &spec); err != nil {
+		return log.Errore(err)
+	}
+	err := inst.WritePoolSpec(&spec)
+	return err
+}
+
+func (applier *CommandApplier) deletePoolSpec(value []byte) interface{} {
+	spec := inst.PoolSpec{}
+	if err := json.Unmarshal(value, &spec); err != nil {
+		return log.Errore(err)
+	}
+	err := inst.DeletePoolSpec(spec.ClusterName, spec.Pool)
+	return err
+}
+
+func (applier *CommandApplier) setDesiredTopology(value []byte) interface{} {
+	clusterDesiredTopology := ClusterDesiredTopology{}
+	if err := json.Unmarshal(value, &clusterDesiredTopology); err != nil {
+		return log.Errore(err)
+	}
+	err := inst.WriteClusterDesiredTopology(clusterDesiredTopology.ClusterAlias, string(clusterDesiredTopology.DesiredTopology))
+	return err
+}
+
 func (applier *CommandApplier) disableGlobalRecoveries(value []byte) interface{} {
 	err := DisableRecovery()
 	return err
@@ -258,6 +411,15 @@ func (applier *CommandApplier) putKeyValue(value []byte) interface{} {
 	return err
 }
 
+func (applier *CommandApplier) writeClusterMasterEntries(value []byte) interface{} {
+	entries := inst.ClusterMasterEntries{}
+	if err := json.Unmarshal(value, &entries); err != nil {
+		return log.Errore(err)
+	}
+	_, err := inst.WriteClusterMasterEntries(&entries)
+	return err
+}
+
 func (applier *CommandApplier) leaderURI(value []byte) interface{} {
 	var uri string
 	if err := json.Unmarshal(value, &uri); err != nil {
@@ -275,3 +437,277 @@ func (applier *CommandApplier) healthReport(value []byte) interface{} {
 	orcraft.ReportToRaftLeader(authenticationToken)
 	return nil
 }
+
+func (applier *CommandApplier) importState(value []byte) interface{} {
+	state := ExportedState{}
+	if err := json.Unmarshal(value, &state); err != nil {
+		return log.Errore(err)
+	}
+	err := applyImportedState(&state)
+	return err
+}
+
+func (applier *CommandApplier) overridePromotionRule(value []byte) interface{} {
+	override := inst.CandidatePromotionRuleOverride{}
+	if err := json.Unmarshal(value, &override); err != nil {
+		return log.Errore(err)
+	}
+	err := inst.WriteCandidatePromotionRuleOverride(&override)
+	return err
+}
+
+func (applier *CommandApplier) clearPromotionRuleOverride(value []byte) interface{} {
+	instanceKey := inst.InstanceKey{}
+	if err := json.Unmarshal(value, &instanceKey); err != nil {
+		return log.Errore(err)
+	}
+	err := inst.DeleteCandidatePromotionRuleOverride(&instanceKey)
+	return err
+}
+
+func (applier *CommandApplier) lockCluster(value []byte) interface{} {
+	clusterLock := inst.ClusterLock{}
+	if err := json.Unmarshal(value, &clusterLock); err != nil {
+		return log.Errore(err)
+	}
+	err := inst.WriteClusterLock(&clusterLock)
+	return err
+}
+
+func (applier *CommandApplier) unlockCluster(value []byte) interface{} {
+	var clusterAlias string
+	if err := json.Unmarshal(value, &clusterAlias); err != nil {
+		return log.Errore(err)
+	}
+	err := inst.DeleteClusterLock(clusterAlias)
+	return err
+}
+
+func (applier *CommandApplier) pauseDiscovery(value []byte) interface{} {
+	discoveryPause := inst.ClusterDiscoveryPause{}
+	if err := json.Unmarshal(value, &discoveryPause); err != nil {
+		return log.Errore(err)
+	}
+	err := inst.WriteClusterDiscoveryPause(&discoveryPause)
+	return err
+}
+
+func (applier *CommandApplier) resumeDiscovery(value []byte) interface{} {
+	var clusterAlias string
+	if err := json.Unmarshal(value, &clusterAlias); err != nil {
+		return log.Errore(err)
+	}
+	err := inst.DeleteClusterDiscoveryPause(clusterAlias)
+	return err
+}
+
+func (applier *CommandApplier) pinMaster(value []byte) interface{} {
+	pinnedMaster := inst.ClusterPinnedMaster{}
+	if err := json.Unmarshal(value, &pinnedMaster); err != nil {
+		return log.Errore(err)
+	}
+	err := inst.WriteClusterPinnedMaster(&pinnedMaster)
+	return err
+}
+
+func (applier *CommandApplier) unpinMaster(value []byte) interface{} {
+	var clusterAlias string
+	if err := json.Unmarshal(value, &clusterAlias); err != nil {
+		return log.Errore(err)
+	}
+	err := inst.DeleteClusterPinnedMaster(clusterAlias)
+	return err
+}
+
+func (applier *CommandApplier) registerSchemaMigration(value []byte) interface{} {
+	migration := inst.ClusterSchemaMigration{}
+	if err := json.Unmarshal(value, &migration); err != nil {
+		return log.Errore(err)
+	}
+	err := inst.WriteClusterSchemaMigration(&migration)
+	return err
+}
+
+func (applier *CommandApplier) unregisterSchemaMigration(value []byte) interface{} {
+	migration := inst.ClusterSchemaMigration{}
+	if err := json.Unmarshal(value, &migration); err != nil {
+		return log.Errore(err)
+	}
+	err := inst.DeleteClusterSchemaMigration(migration.ClusterAlias, migration.MigrationId)
+	return err
+}
+
+func (applier *CommandApplier) writeAPIToken(value []byte) interface{} {
+	token := process.APIToken{}
+	if err := json.Unmarshal(value, &token); err != nil {
+		return log.Errore(err)
+	}
+	err := process.WriteAPIToken(&token)
+	return err
+}
+
+func (applier *CommandApplier) deleteAPIToken(value []byte) interface{} {
+	var tokenId string
+	if err := json.Unmarshal(value, &tokenId); err != nil {
+		return log.Errore(err)
+	}
+	err := process.DeleteAPIToken(tokenId)
+	return err
+}
+
+func (applier *CommandApplier) writeDelayedReplica(value []byte) interface{} {
+	delayedReplica := inst.DelayedReplica{}
+	if err := json.Unmarshal(value, &delayedReplica); err != nil {
+		return log.Errore(err)
+	}
+	err := inst.WriteDelayedReplica(&delayedReplica)
+	return err
+}
+
+func (applier *CommandApplier) deleteDelayedReplica(value []byte) interface{} {
+	instanceKey := inst.InstanceKey{}
+	if err := json.Unmarshal(value, &instanceKey); err != nil {
+		return log.Errore(err)
+	}
+	err := inst.DeleteDelayedReplica(&instanceKey)
+	return err
+}
+
+func (applier *CommandApplier) setInstanceFlag(value []byte) interface{} {
+	entry := inst.InstanceFlagEntry{}
+	if err := json.Unmarshal(value, &entry); err != nil {
+		return log.Errore(err)
+	}
+	err := inst.WriteInstanceFlag(&entry)
+	return err
+}
+
+func (applier *CommandApplier) clearInstanceFlag(value []byte) interface{} {
+	entry := inst.InstanceFlagEntry{}
+	if err := json.Unmarshal(value, &entry); err != nil {
+		return log.Errore(err)
+	}
+	err := inst.DeleteInstanceFlag(&entry)
+	return err
+}
+
+func (applier *CommandApplier) writeScheduledRevert(value []byte) interface{} {
+	revert := ScheduledRevert{}
+	if err := json.Unmarshal(value, &revert); err != nil {
+		return log.Errore(err)
+	}
+	err := writeScheduledRevert(&revert)
+	return err
+}
+
+func (applier *CommandApplier) writeInstanceDecommission(value []byte) interface{} {
+	decommission := InstanceDecommission{}
+	if err := json.Unmarshal(value, &decommission); err != nil {
+		return log.Errore(err)
+	}
+	err := writeInstanceDecommission(&decommission)
+	return err
+}
+
+func (applier *CommandApplier) setInstanceNote(value []byte) interface{} {
+	note := inst.InstanceNote{}
+	if err := json.Unmarshal(value, &note); err != nil {
+		return log.Errore(err)
+	}
+	err := inst.WriteInstanceNote(&note)
+	return err
+}
+
+func (applier *CommandApplier) clearInstanceNote(value []byte) interface{} {
+	instanceKey := inst.InstanceKey{}
+	if err := json.Unmarshal(value, &instanceKey); err != nil {
+		return log.Errore(err)
+	}
+	err := inst.DeleteInstanceNote(&instanceKey)
+	return err
+}
+
+func (applier *CommandApplier) setClusterNote(value []byte) interface{} {
+	note := inst.ClusterNote{}
+	if err := json.Unmarshal(value, &note); err != nil {
+		return log.Errore(err)
+	}
+	err := inst.WriteClusterNote(&note)
+	return err
+}
+
+func (applier *CommandApplier) clearClusterNote(value []byte) interface{} {
+	var clusterAlias string
+	if err := json.Unmarshal(value, &clusterAlias); err != nil {
+		return log.Errore(err)
+	}
+	err := inst.DeleteClusterNote(clusterAlias)
+	return err
+}
+
+func (applier *CommandApplier) seedHostnameResolve(value []byte) interface{} {
+	seed := inst.HostnameResolveSeed{}
+	if err := json.Unmarshal(value, &seed); err != nil {
+		return log.Errore(err)
+	}
+	err := inst.SeedHostnameResolve(&seed)
+	return err
+}
+
+func (applier *CommandApplier) unseedHostnameResolve(value []byte) interface{} {
+	var hostname string
+	if err := json.Unmarshal(value, &hostname); err != nil {
+		return log.Errore(err)
+	}
+	err := inst.UnseedHostnameResolve(hostname)
+	return err
+}
+
+func (applier *CommandApplier) invalidateHostnameResolves(value []byte) interface{} {
+	var pattern string
+	if err := json.Unmarshal(value, &pattern); err != nil {
+		return log.Errore(err)
+	}
+	_, err := inst.InvalidateHostnameResolves(pattern)
+	return err
+}
+
+func (applier *CommandApplier) changeRecoveryBlock(value []byte) interface{} {
+	change := RecoveryBlockChange{}
+	if err := json.Unmarshal(value, &change); err != nil {
+		return log.Errore(err)
+	}
+	return applyRecoveryBlockChange(&change)
+}
+
+func (applier *CommandApplier) writeInstanceProbeOutcomes(value []byte) interface{} {
+	outcomes := []inst.InstanceProbeOutcome{}
+	if err := json.Unmarshal(value, &outcomes); err != nil {
+		return log.Errore(err)
+	}
+	return inst.WriteInstanceProbeOutcomes(outcomes)
+}
+
+func (applier *CommandApplier) requestRecoveryAbort(value []byte) interface{} {
+	abortRequest := RecoveryAbortRequest{}
+	if err := json.Unmarshal(value, &abortRequest); err != nil {
+		return log.Errore(err)
+	}
+	return writeRecoveryAbortRequest(&abortRequest)
+}
+
+func (applier *CommandApplier) writeStateEventSubscription(value []byte) interface{} {
+	subscription := inst.StateEventSubscription{}
+	if err := json.Unmarshal(value, &subscription); err != nil {
+		return log.Errore(err)
+	}
+	return inst.WriteStateEventSubscription(&subscription)
+}
+
+func (applier *CommandApplier) deleteStateEventSubscription(value []byte) interface{} {
+	var name string
+	if err := json.Unmarshal(value, &name); err != nil {
+		return log.Errore(err)
+	}
+	return inst.DeleteStateEventSubscription(name)
+}
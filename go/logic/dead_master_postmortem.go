@@ -0,0 +1,128 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/github/orchestrator/go/agent"
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/openark/golib/log"
+)
+
+// DeadMasterPostmortemWatch is the failed master of a recent recovery, awaited to become reachable again for
+// postmortem data capture. Watches are persisted, such that a newly elected leader carries on awaiting.
+type DeadMasterPostmortemWatch struct {
+	Key             inst.InstanceKey
+	RecoveryUID     string
+	RecoveryEndTime time.Time
+	WindowSeconds   uint
+}
+
+// DeadMasterPostmortem is forensic data captured from a failed master found reachable shortly after its recovery,
+// before it is reset or rejoined to the topology
+type DeadMasterPostmortem struct {
+	Key                   inst.InstanceKey
+	CapturedAt            time.Time
+	SecondsSinceRecovery  float64
+	Uptime                uint
+	ServerUUID            string
+	Version               string
+	ReadOnly              bool
+	SelfBinlogCoordinates inst.BinlogCoordinates
+	ExecutedGtidSet       string
+	ErrorLogTail          []string
+	Notes                 []string
+}
+
+// watchDeadMasterForPostmortem registers the failed master of a recovery that has just completed, so that forensic
+// data is captured from it should it become reachable within DeadMasterPostmortemWindowSeconds
+func watchDeadMasterForPostmortem(topologyRecovery *TopologyRecovery) {
+	if config.Config.DeadMasterPostmortemWindowSeconds == 0 || topologyRecovery.bundle == nil {
+		return
+	}
+	analysisEntry := &topologyRecovery.AnalysisEntry
+	if !analysisEntry.IsMaster && !analysisEntry.IsCoMaster {
+		return
+	}
+	if analysisEntry.CommandHint == inst.GracefulMasterTakeoverCommandHint || topologyRecovery.SuccessorKey == nil {
+		return
+	}
+	watch := &DeadMasterPostmortemWatch{
+		Key:             analysisEntry.AnalyzedInstanceKey,
+		RecoveryUID:     topologyRecovery.UID,
+		RecoveryEndTime: time.Now(),
+		WindowSeconds:   config.Config.DeadMasterPostmortemWindowSeconds,
+	}
+	persistDeadMasterPostmortemWatch(watch)
+}
+
+// captureDeadMasterPostmortem captures forensic data from a freshly probed instance, given it is the failed master
+// of a recent recovery. Data is captured once, by the leader, onto the recovery's bundle.
+func captureDeadMasterPostmortem(instance *inst.Instance) {
+	if instance == nil || !instance.IsLastCheckValid || !IsLeader() {
+		return
+	}
+	watches, err := readDeadMasterPostmortemWatches()
+	if err != nil {
+		return
+	}
+	watch, found := watches[instance.Key]
+	if !found {
+		return
+	}
+	if claimed, err := claimDeadMasterPostmortemWatch(&watch); err != nil || !claimed {
+		return
+	}
+
+	postmortem := &DeadMasterPostmortem{
+		Key:                   instance.Key,
+		CapturedAt:            time.Now(),
+		SecondsSinceRecovery:  time.Since(watch.RecoveryEndTime).Seconds(),
+		Uptime:                instance.Uptime,
+		ServerUUID:            instance.ServerUUID,
+		Version:               instance.Version,
+		ReadOnly:              instance.ReadOnly,
+		SelfBinlogCoordinates: instance.SelfBinlogCoordinates,
+		ExecutedGtidSet:       instance.ExecutedGtidSet,
+		ErrorLogTail:          []string{},
+		Notes:                 []string{},
+	}
+	if int64(instance.Uptime) < int64(postmortem.SecondsSinceRecovery) {
+		postmortem.Notes = append(postmortem.Notes, fmt.Sprintf("MySQL restarted %d seconds ago, after the recovery", instance.Uptime))
+	}
+	if errorLogTail, err := agent.MySQLErrorLogTail(instance.Key.Hostname); err == nil {
+		postmortem.ErrorLogTail = errorLogTail
+	} else {
+		postmortem.Notes = append(postmortem.Notes, fmt.Sprintf("error log tail not available via agent: %+v", err))
+	}
+
+	bundle, err := ReadTopologyRecoveryBundle(watch.RecoveryUID)
+	if err != nil {
+		log.Errorf("captureDeadMasterPostmortem: %+v", err)
+		return
+	}
+	bundle.mutex.Lock()
+	bundle.DeadMasterPostmortem = postmortem
+	bundle.mutex.Unlock()
+	if err := writeTopologyRecoveryBundleOrPublish(bundle); err != nil {
+		return
+	}
+	inst.AuditOperation("dead-master-postmortem", &instance.Key, fmt.Sprintf("recovery %s: captured %.0fs after recovery; self coordinates: %+v; executed GTID set: %s", watch.RecoveryUID, postmortem.SecondsSinceRecovery, postmortem.SelfBinlogCoordinates, postmortem.ExecutedGtidSet))
+}
@@ -0,0 +1,133 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"time"
+
+	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/inst"
+	orcraft "github.com/github/orchestrator/go/raft"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+	"github.com/patrickmn/go-cache"
+)
+
+const deadMasterPostmortemWatchesCacheKey = "watches"
+
+// deadMasterPostmortemWatchesCache saves reading the watches from the backend upon each and every probe
+var deadMasterPostmortemWatchesCache = cache.New(5*time.Second, time.Minute)
+
+// writeDeadMasterPostmortemWatch writes down given watch, which expires WindowSeconds from now
+func writeDeadMasterPostmortemWatch(watch *DeadMasterPostmortemWatch) error {
+	_, err := db.ExecOrchestrator(`
+			replace into dead_master_postmortem_watch (
+					hostname, port, recovery_uid, recovery_end_timestamp, expires_at
+				) values (
+					?, ?, ?, NOW(), NOW() + interval ? second
+				)
+			`, watch.Key.Hostname, watch.Key.Port, watch.RecoveryUID, watch.WindowSeconds,
+	)
+	deadMasterPostmortemWatchesCache.Flush()
+	return log.Errore(err)
+}
+
+// persistDeadMasterPostmortemWatch writes down given watch, either directly or via raft
+func persistDeadMasterPostmortemWatch(watch *DeadMasterPostmortemWatch) error {
+	if orcraft.IsRaftEnabled() {
+		_, err := orcraft.PublishCommand("write-dead-master-postmortem-watch", watch)
+		return log.Errore(err)
+	}
+	return writeDeadMasterPostmortemWatch(watch)
+}
+
+// deleteDeadMasterPostmortemWatch removes the watch of given recovery over given instance, and returns the number
+// of watches removed
+func deleteDeadMasterPostmortemWatch(watch *DeadMasterPostmortemWatch) (int64, error) {
+	sqlResult, err := db.ExecOrchestrator(`
+			delete
+				from dead_master_postmortem_watch
+			where
+				hostname = ?
+				and port = ?
+				and recovery_uid = ?
+			`, watch.Key.Hostname, watch.Key.Port, watch.RecoveryUID,
+	)
+	deadMasterPostmortemWatchesCache.Flush()
+	if err != nil {
+		return 0, log.Errore(err)
+	}
+	return sqlResult.RowsAffected()
+}
+
+// claimDeadMasterPostmortemWatch removes given watch, such that its postmortem is captured once. It returns false
+// when the watch was already claimed.
+func claimDeadMasterPostmortemWatch(watch *DeadMasterPostmortemWatch) (bool, error) {
+	if orcraft.IsRaftEnabled() {
+		// Only the leader captures postmortems
+		_, err := orcraft.PublishCommand("delete-dead-master-postmortem-watch", watch)
+		return err == nil, log.Errore(err)
+	}
+	countDeleted, err := deleteDeadMasterPostmortemWatch(watch)
+	return countDeleted > 0, err
+}
+
+// readDeadMasterPostmortemWatches reads the unexpired watches, mapped by instance key
+func readDeadMasterPostmortemWatches() (map[inst.InstanceKey]DeadMasterPostmortemWatch, error) {
+	if watches, found := deadMasterPostmortemWatchesCache.Get(deadMasterPostmortemWatchesCacheKey); found {
+		return watches.(map[inst.InstanceKey]DeadMasterPostmortemWatch), nil
+	}
+	watches := make(map[inst.InstanceKey]DeadMasterPostmortemWatch)
+	query := `
+		select
+			hostname,
+			port,
+			recovery_uid,
+			unix_timestamp() - unix_timestamp(recovery_end_timestamp) as seconds_since_recovery
+		from
+			dead_master_postmortem_watch
+		where
+			expires_at > now()
+		`
+	err := db.QueryOrchestrator(query, sqlutils.Args(), func(m sqlutils.RowMap) error {
+		watch := DeadMasterPostmortemWatch{
+			Key:         inst.InstanceKey{Hostname: m.GetString("hostname"), Port: m.GetInt("port")},
+			RecoveryUID: m.GetString("recovery_uid"),
+		}
+		watch.RecoveryEndTime = time.Now().Add(-time.Duration(m.GetInt64("seconds_since_recovery")) * time.Second)
+		watches[watch.Key] = watch
+		return nil
+	})
+	if err != nil {
+		return watches, log.Errore(err)
+	}
+	deadMasterPostmortemWatchesCache.Set(deadMasterPostmortemWatchesCacheKey, watches, cache.DefaultExpiration)
+	return watches, nil
+}
+
+// ExpireDeadMasterPostmortemWatches removes the watches past their window
+func ExpireDeadMasterPostmortemWatches() error {
+	_, err := db.ExecOrchestrator(`
+			delete
+				from dead_master_postmortem_watch
+			where
+				expires_at < now()
+			`,
+	)
+	deadMasterPostmortemWatchesCache.Flush()
+	return log.Errore(err)
+}
@@ -0,0 +1,156 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+// newDeadMasterRecovery returns a completed recovery of given failed master, which promoted a replica
+func newDeadMasterRecovery(failedMasterKey inst.InstanceKey) *TopologyRecovery {
+	topologyRecovery := NewTopologyRecovery(inst.ReplicationAnalysis{AnalyzedInstanceKey: failedMasterKey, IsMaster: true})
+	topologyRecovery.SuccessorKey = &inst.InstanceKey{Hostname: "postmortem-replica", Port: 3306}
+	return topologyRecovery
+}
+
+func TestWatchDeadMasterForPostmortem(t *testing.T) {
+	withSQLiteBackend(t)
+	deadMasterPostmortemWatchesCache.Flush()
+	failedMasterKey := inst.InstanceKey{Hostname: "postmortem-master", Port: 3306}
+
+	{
+		topologyRecovery := newDeadMasterRecovery(failedMasterKey)
+		topologyRecovery.AnalysisEntry.CommandHint = inst.GracefulMasterTakeoverCommandHint
+		watchDeadMasterForPostmortem(topologyRecovery)
+	}
+	{
+		topologyRecovery := newDeadMasterRecovery(failedMasterKey)
+		topologyRecovery.SuccessorKey = nil
+		watchDeadMasterForPostmortem(topologyRecovery)
+	}
+	{
+		topologyRecovery := newDeadMasterRecovery(failedMasterKey)
+		topologyRecovery.AnalysisEntry.IsMaster = false
+		watchDeadMasterForPostmortem(topologyRecovery)
+	}
+	watches, err := readDeadMasterPostmortemWatches()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(watches), 0)
+
+	topologyRecovery := newDeadMasterRecovery(failedMasterKey)
+	watchDeadMasterForPostmortem(topologyRecovery)
+	// As read by a newly elected leader
+	deadMasterPostmortemWatchesCache.Flush()
+	watches, err = readDeadMasterPostmortemWatches()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(watches), 1)
+	test.S(t).ExpectEquals(watches[failedMasterKey].RecoveryUID, topologyRecovery.UID)
+	test.S(t).ExpectTrue(watches[failedMasterKey].RecoveryEndTime.Unix() > 0)
+
+	// Past their window, watches are ignored, then expired
+	_, err = db.ExecOrchestrator(`update dead_master_postmortem_watch set expires_at = now() - interval 1 second`)
+	test.S(t).ExpectNil(err)
+	deadMasterPostmortemWatchesCache.Flush()
+	watches, err = readDeadMasterPostmortemWatches()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(watches), 0)
+	test.S(t).ExpectNil(ExpireDeadMasterPostmortemWatches())
+	countDeleted, err := deleteDeadMasterPostmortemWatch(&DeadMasterPostmortemWatch{Key: failedMasterKey, RecoveryUID: topologyRecovery.UID})
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(countDeleted, int64(0))
+}
+
+func TestWatchDeadMasterForPostmortemDisabled(t *testing.T) {
+	withSQLiteBackend(t)
+	deadMasterPostmortemWatchesCache.Flush()
+	windowSeconds := config.Config.DeadMasterPostmortemWindowSeconds
+	config.Config.DeadMasterPostmortemWindowSeconds = 0
+	defer func() { config.Config.DeadMasterPostmortemWindowSeconds = windowSeconds }()
+
+	watchDeadMasterForPostmortem(newDeadMasterRecovery(inst.InstanceKey{Hostname: "postmortem-master", Port: 3306}))
+	watches, err := readDeadMasterPostmortemWatches()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(watches), 0)
+}
+
+func TestCaptureDeadMasterPostmortem(t *testing.T) {
+	withSQLiteBackend(t)
+	deadMasterPostmortemWatchesCache.Flush()
+	failedMasterKey := inst.InstanceKey{Hostname: "postmortem-master", Port: 3306}
+
+	topologyRecovery := newDeadMasterRecovery(failedMasterKey)
+	test.S(t).ExpectNil(writeTopologyRecoveryBundle(topologyRecovery.bundle))
+	watchDeadMasterForPostmortem(topologyRecovery)
+
+	failedMaster := inst.NewInstance()
+	failedMaster.Key = failedMasterKey
+	failedMaster.IsLastCheckValid = true
+	failedMaster.Uptime = 0
+	failedMaster.ExecutedGtidSet = "00020194-3333-3333-3333-333333333333:1-7"
+	failedMaster.SelfBinlogCoordinates = inst.BinlogCoordinates{LogFile: "mysql-bin.000007", LogPos: 1234}
+
+	// Only the leader captures postmortems
+	captureDeadMasterPostmortem(failedMaster)
+	bundle, err := ReadTopologyRecoveryBundle(topologyRecovery.UID)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(bundle.DeadMasterPostmortem == nil)
+
+	atomic.StoreInt64(&isElectedNode, 1)
+	defer atomic.StoreInt64(&isElectedNode, 0)
+
+	// Other instances are of no interest
+	otherInstance := inst.NewInstance()
+	otherInstance.Key = inst.InstanceKey{Hostname: "postmortem-other", Port: 3306}
+	otherInstance.IsLastCheckValid = true
+	captureDeadMasterPostmortem(otherInstance)
+
+	// Unreachable, the failed master is still awaited
+	failedMaster.IsLastCheckValid = false
+	captureDeadMasterPostmortem(failedMaster)
+	bundle, err = ReadTopologyRecoveryBundle(topologyRecovery.UID)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(bundle.DeadMasterPostmortem == nil)
+
+	// Captured by a newly elected leader
+	deadMasterPostmortemWatchesCache.Flush()
+	failedMaster.IsLastCheckValid = true
+	captureDeadMasterPostmortem(failedMaster)
+	bundle, err = ReadTopologyRecoveryBundle(topologyRecovery.UID)
+	test.S(t).ExpectNil(err)
+	postmortem := bundle.DeadMasterPostmortem
+	test.S(t).ExpectNotNil(postmortem)
+	test.S(t).ExpectEquals(postmortem.Key, failedMasterKey)
+	test.S(t).ExpectEquals(postmortem.ExecutedGtidSet, failedMaster.ExecutedGtidSet)
+	test.S(t).ExpectEquals(postmortem.SelfBinlogCoordinates, failedMaster.SelfBinlogCoordinates)
+	// No agent runs on the failed master
+	test.S(t).ExpectEquals(len(postmortem.ErrorLogTail), 0)
+	test.S(t).ExpectTrue(len(postmortem.Notes) > 0)
+
+	// Captured once
+	watches, err := readDeadMasterPostmortemWatches()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(watches), 0)
+	claimed, err := claimDeadMasterPostmortemWatch(&DeadMasterPostmortemWatch{Key: failedMasterKey, RecoveryUID: topologyRecovery.UID})
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectFalse(claimed)
+}
@@ -0,0 +1,140 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+
+	"github.com/github/orchestrator/go/inst"
+	orcraft "github.com/github/orchestrator/go/raft"
+	"github.com/openark/golib/log"
+)
+
+func writeDelayedReplica(delayedReplica *inst.DelayedReplica) error {
+	if orcraft.IsRaftEnabled() {
+		_, err := orcraft.PublishCommand("write-delayed-replica", delayedReplica)
+		return err
+	}
+	return inst.WriteDelayedReplica(delayedReplica)
+}
+
+// TagDelayedReplica tags a replica as intentionally delayed, by its current SQL_Delay
+func TagDelayedReplica(instanceKey *inst.InstanceKey, owner string, reason string) (*inst.DelayedReplica, error) {
+	instance, err := inst.ReadTopologyInstance(instanceKey)
+	if err != nil {
+		return nil, err
+	}
+	if instance.SQLDelay == 0 {
+		return nil, fmt.Errorf("TagDelayedReplica: %+v has no SQL_Delay; use set-sql-delay first", *instanceKey)
+	}
+	delayedReplica := inst.NewDelayedReplica(instanceKey, instance.SQLDelay, owner, reason)
+	if err := writeDelayedReplica(delayedReplica); err != nil {
+		return nil, err
+	}
+	return delayedReplica, nil
+}
+
+// UntagDelayedReplica removes the delayed replica tag of a replica. Its SQL_Delay is unaffected.
+func UntagDelayedReplica(instanceKey *inst.InstanceKey) error {
+	if orcraft.IsRaftEnabled() {
+		_, err := orcraft.PublishCommand("delete-delayed-replica", instanceKey)
+		return err
+	}
+	return inst.DeleteDelayedReplica(instanceKey)
+}
+
+// SetSQLDelay changes the SQL_Delay of a replica. On a tagged delayed replica, this also becomes its intended
+// delay, and any suspension of the delay is lifted.
+func SetSQLDelay(instanceKey *inst.InstanceKey, sqlDelay uint) (*inst.Instance, error) {
+	instance, err := inst.SetSQLDelay(instanceKey, sqlDelay)
+	if err != nil {
+		return instance, err
+	}
+	delayedReplica, found, err := inst.ReadDelayedReplica(instanceKey)
+	if err != nil || !found {
+		return instance, err
+	}
+	delayedReplica.IntendedSQLDelay = sqlDelay
+	delayedReplica.IsSQLDelaySuspended = false
+	delayedReplica.SuspendedUntilString = ""
+	return instance, writeDelayedReplica(delayedReplica)
+}
+
+// SuspendSQLDelay lets a delayed replica catch up with its master for given number of seconds, by setting
+// its SQL_Delay to zero. The intended delay is restored by ResumeSQLDelay, or once the suspension expires.
+// A replica not yet tagged as delayed is tagged by its current SQL_Delay.
+func SuspendSQLDelay(instanceKey *inst.InstanceKey, durationSeconds uint, owner string, reason string) (*inst.DelayedReplica, error) {
+	delayedReplica, found, err := inst.ReadDelayedReplica(instanceKey)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		if delayedReplica, err = TagDelayedReplica(instanceKey, owner, reason); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := inst.SetSQLDelay(instanceKey, 0); err != nil {
+		return delayedReplica, err
+	}
+	delayedReplica.Owner = owner
+	delayedReplica.Reason = reason
+	delayedReplica.SuspendFor(durationSeconds)
+	if err := writeDelayedReplica(delayedReplica); err != nil {
+		return delayedReplica, err
+	}
+	inst.AuditOperation("suspend-sql-delay", instanceKey, delayedReplica.String())
+	return delayedReplica, nil
+}
+
+// ResumeSQLDelay restores the intended SQL_Delay of a delayed replica whose delay is suspended
+func ResumeSQLDelay(instanceKey *inst.InstanceKey) (*inst.Instance, error) {
+	delayedReplica, found, err := inst.ReadDelayedReplica(instanceKey)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("ResumeSQLDelay: %+v is not tagged as a delayed replica", *instanceKey)
+	}
+	instance, err := inst.SetSQLDelay(instanceKey, delayedReplica.IntendedSQLDelay)
+	if err != nil {
+		return instance, err
+	}
+	delayedReplica.IsSQLDelaySuspended = false
+	delayedReplica.SuspendedUntilString = ""
+	if err := writeDelayedReplica(delayedReplica); err != nil {
+		return instance, err
+	}
+	inst.AuditOperation("resume-sql-delay", instanceKey, fmt.Sprintf("SQL_Delay restored to %d seconds", delayedReplica.IntendedSQLDelay))
+	return instance, nil
+}
+
+// ResumeExpiredSQLDelaySuspensions restores the intended SQL_Delay of delayed replicas whose suspension expired.
+// A replica which cannot be reached is retried on the next run.
+func ResumeExpiredSQLDelaySuspensions() {
+	if !IsLeader() {
+		return
+	}
+	delayedReplicas, err := inst.ReadExpiredSQLDelaySuspensions()
+	if err != nil {
+		return
+	}
+	for _, delayedReplica := range delayedReplicas {
+		if _, err := ResumeSQLDelay(&delayedReplica.Key); err != nil {
+			log.Errorf("ResumeExpiredSQLDelaySuspensions: cannot restore SQL_Delay on %+v: %+v", delayedReplica.Key, err)
+		}
+	}
+}
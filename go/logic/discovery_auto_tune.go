@@ -0,0 +1,199 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/discovery"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/openark/golib/log"
+	"github.com/patrickmn/go-cache"
+	"github.com/rcrowley/go-metrics"
+)
+
+// discoveryAutoTuneHeadroom is the factor by which the tuned concurrency exceeds the bare concurrency needed to poll
+// the fleet within InstancePollSeconds
+const discoveryAutoTuneHeadroom = 1.5
+
+// DiscoveryAutoTuning is the latest tuning of discovery on this node: the effective poll concurrency and per-instance
+// poll jitter, along with the observations they were chosen by
+type DiscoveryAutoTuning struct {
+	IsEnabled                 bool
+	FleetSize                 int
+	MaxStalenessSeconds       uint
+	EstimatedStalenessSeconds float64
+	IsGoalMet                 bool
+	EffectiveConcurrency      int64
+	MaxConcurrency            int64
+	PollJitterSeconds         float64
+	MeanDiscoverySeconds      float64
+	P95DiscoverySeconds       float64
+	P95QueueWaitSeconds       float64
+	P95BackendWriteSeconds    float64
+	Reasons                   []string
+	EvaluatedAt               time.Time
+}
+
+var discoveryAutoTuning = DiscoveryAutoTuning{Reasons: []string{}}
+var discoveryAutoTuningMutex sync.Mutex
+
+// discoveryWorkers is the number of discovery workers started; effectiveDiscoveryConcurrency of them consume the queue
+var discoveryWorkers int64
+var effectiveDiscoveryConcurrency int64
+
+// discoveryPollJitterNanos is the duration over which pushes of outdated instances onto the discovery queue are spread
+var discoveryPollJitterNanos int64
+
+// jitteredDiscoveryKeys are outdated instances already scheduled for a jittered push onto the discovery queue
+var jitteredDiscoveryKeys = cache.New(time.Minute, time.Minute)
+
+var discoveryEffectiveConcurrencyGauge = metrics.NewGauge()
+
+func init() {
+	metrics.Register("discoveries.effective_concurrency", discoveryEffectiveConcurrencyGauge)
+}
+
+// ReadDiscoveryAutoTuning returns the latest tuning of discovery
+func ReadDiscoveryAutoTuning() DiscoveryAutoTuning {
+	discoveryAutoTuningMutex.Lock()
+	defer discoveryAutoTuningMutex.Unlock()
+	return discoveryAutoTuning
+}
+
+// isDiscoveryWorkerActive checks whether the discovery worker of given index is within the effective concurrency
+func isDiscoveryWorkerActive(workerIndex int64) bool {
+	return workerIndex < atomic.LoadInt64(&effectiveDiscoveryConcurrency)
+}
+
+// pushOutdatedInstanceKey pushes an outdated instance onto the discovery queue; with poll jitter, the push is
+// delayed by a random duration within the jitter, such that polls spread over time rather than burst on each tick
+func pushOutdatedInstanceKey(instanceKey inst.InstanceKey) {
+	jitter := time.Duration(atomic.LoadInt64(&discoveryPollJitterNanos))
+	if jitter <= 0 {
+		discoveryQueue.Push(instanceKey)
+		return
+	}
+	if err := jitteredDiscoveryKeys.Add(instanceKey.StringCode(), true, jitter); err != nil {
+		// Already scheduled
+		return
+	}
+	time.AfterFunc(time.Duration(rand.Int63n(int64(jitter))), func() {
+		discoveryQueue.Push(instanceKey)
+	})
+}
+
+// tuneDiscoveryConcurrency computes the concurrency at which given fleet is polled within InstancePollSeconds, with
+// some headroom. Concurrency grows while queue wait exceeds the staleness budget, and is reduced while the backend
+// is slow on writes, as more concurrency would only add to its load.
+func tuneDiscoveryConcurrency(tuning *DiscoveryAutoTuning, currentConcurrency int64, queueWaitBudgetSeconds float64) int64 {
+	pollSeconds := float64(config.Config.InstancePollSeconds)
+	concurrency := int64(math.Ceil(float64(tuning.FleetSize) * tuning.MeanDiscoverySeconds / pollSeconds * discoveryAutoTuneHeadroom))
+	if tuning.P95QueueWaitSeconds > queueWaitBudgetSeconds {
+		tuning.Reasons = append(tuning.Reasons, fmt.Sprintf("queue wait %.3fs exceeds its %.3fs budget", tuning.P95QueueWaitSeconds, queueWaitBudgetSeconds))
+		if grown := currentConcurrency + currentConcurrency/4 + 1; grown > concurrency {
+			concurrency = grown
+		}
+	}
+	if tuning.P95BackendWriteSeconds > config.Config.DiscoveryAutoTuneBackendWriteSeconds {
+		tuning.Reasons = append(tuning.Reasons, fmt.Sprintf("backend write latency %.3fs exceeds DiscoveryAutoTuneBackendWriteSeconds %.3fs", tuning.P95BackendWriteSeconds, config.Config.DiscoveryAutoTuneBackendWriteSeconds))
+		if reduced := currentConcurrency - currentConcurrency/4; reduced < concurrency {
+			concurrency = reduced
+		}
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if concurrency > tuning.MaxConcurrency {
+		concurrency = tuning.MaxConcurrency
+	}
+	return concurrency
+}
+
+// AutoTuneDiscovery adjusts the effective discovery concurrency and per-instance poll jitter so as to keep the age of
+// instances' data within DiscoveryMaxStalenessSeconds. Staleness is estimated as InstancePollSeconds, plus the time an
+// outdated instance takes to be noticed, plus the 95th percentiles of queue wait and discovery latency over the last
+// InstancePollSeconds. Spare staleness budget is spent on jitter, spreading polls over time.
+func AutoTuneDiscovery() {
+	maxConcurrency := atomic.LoadInt64(&discoveryWorkers)
+	if !config.Config.DiscoveryAutoTune {
+		atomic.StoreInt64(&effectiveDiscoveryConcurrency, maxConcurrency)
+		atomic.StoreInt64(&discoveryPollJitterNanos, 0)
+		return
+	}
+	fleetSize, err := inst.ReadCountInstances()
+	if err != nil {
+		return
+	}
+	aggregated, err := discovery.AggregatedSince(discoveryMetrics, time.Now().Add(-instancePollSecondsDuration()))
+	if err != nil {
+		log.Errore(err)
+		return
+	}
+	currentConcurrency := atomic.LoadInt64(&effectiveDiscoveryConcurrency)
+	tuning := DiscoveryAutoTuning{
+		IsEnabled:              true,
+		FleetSize:              fleetSize,
+		MaxStalenessSeconds:    config.Config.DiscoveryMaxStalenessSeconds,
+		MaxConcurrency:         maxConcurrency,
+		MeanDiscoverySeconds:   aggregated.MeanTotalSeconds,
+		P95DiscoverySeconds:    aggregated.P95TotalSeconds,
+		P95QueueWaitSeconds:    aggregated.P95QueueWaitSeconds,
+		P95BackendWriteSeconds: aggregated.P95BackendWriteSeconds,
+		Reasons:                []string{},
+		EvaluatedAt:            time.Now(),
+	}
+	pollSeconds := float64(config.Config.InstancePollSeconds)
+	tuning.EstimatedStalenessSeconds = pollSeconds + config.HealthPollSeconds + tuning.P95QueueWaitSeconds + tuning.P95DiscoverySeconds
+	tuning.IsGoalMet = tuning.EstimatedStalenessSeconds <= float64(tuning.MaxStalenessSeconds)
+
+	// The staleness budget left once an instance is due, noticed and polled, is what queue wait and jitter may take
+	budgetSeconds := float64(tuning.MaxStalenessSeconds) - pollSeconds - config.HealthPollSeconds - tuning.P95DiscoverySeconds
+	if aggregated.SuccessfulDiscoveries+aggregated.FailedDiscoveries == 0 {
+		// Nothing observed; polling at full concurrency is the safe choice
+		tuning.EffectiveConcurrency = maxConcurrency
+		tuning.Reasons = append(tuning.Reasons, "no discoveries observed")
+	} else {
+		tuning.EffectiveConcurrency = tuneDiscoveryConcurrency(&tuning, currentConcurrency, budgetSeconds/2)
+	}
+	// Half of the spare budget goes to jitter, and jitter never exceeds half the poll interval
+	jitterSeconds := (budgetSeconds - tuning.P95QueueWaitSeconds) / 2
+	jitterSeconds = math.Max(0, math.Min(jitterSeconds, pollSeconds/2))
+	tuning.PollJitterSeconds = jitterSeconds
+
+	atomic.StoreInt64(&effectiveDiscoveryConcurrency, tuning.EffectiveConcurrency)
+	atomic.StoreInt64(&discoveryPollJitterNanos, int64(jitterSeconds*float64(time.Second)))
+	discoveryEffectiveConcurrencyGauge.Update(tuning.EffectiveConcurrency)
+
+	discoveryAutoTuningMutex.Lock()
+	previous := discoveryAutoTuning
+	discoveryAutoTuning = tuning
+	discoveryAutoTuningMutex.Unlock()
+
+	if tuning.EffectiveConcurrency != previous.EffectiveConcurrency {
+		log.Infof("AutoTuneDiscovery: effective concurrency %d -> %d (fleet: %d, mean discovery: %.3fs, estimated staleness: %.3fs)", previous.EffectiveConcurrency, tuning.EffectiveConcurrency, tuning.FleetSize, tuning.MeanDiscoverySeconds, tuning.EstimatedStalenessSeconds)
+	}
+	if !tuning.IsGoalMet && (previous.IsGoalMet || !previous.IsEnabled) {
+		log.Warningf("AutoTuneDiscovery: estimated staleness %.3fs exceeds DiscoveryMaxStalenessSeconds %d", tuning.EstimatedStalenessSeconds, tuning.MaxStalenessSeconds)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"testing"
+
+	"github.com/github/orchestrator/go/config"
+	test "github.com/openark/golib/tests"
+)
+
+func TestTuneDiscoveryConcurrency(t *testing.T) {
+	instancePollSeconds, backendWriteSeconds := config.Config.InstancePollSeconds, config.Config.DiscoveryAutoTuneBackendWriteSeconds
+	defer func() {
+		config.Config.InstancePollSeconds, config.Config.DiscoveryAutoTuneBackendWriteSeconds = instancePollSeconds, backendWriteSeconds
+	}()
+	config.Config.InstancePollSeconds = 5
+	config.Config.DiscoveryAutoTuneBackendWriteSeconds = 1
+
+	newTuning := func(fleetSize int, meanDiscoverySeconds float64) *DiscoveryAutoTuning {
+		return &DiscoveryAutoTuning{
+			FleetSize:            fleetSize,
+			MaxConcurrency:       100,
+			MeanDiscoverySeconds: meanDiscoverySeconds,
+			Reasons:              []string{},
+		}
+	}
+	{
+		// 100 instances * 0.2s / 5s, with 1.5 headroom
+		tuning := newTuning(100, 0.2)
+		test.S(t).ExpectEquals(tuneDiscoveryConcurrency(tuning, 20, 1), int64(6))
+		test.S(t).ExpectEquals(len(tuning.Reasons), 0)
+	}
+	{
+		// Queue wait over budget grows concurrency by a quarter
+		tuning := newTuning(100, 0.2)
+		tuning.P95QueueWaitSeconds = 3
+		test.S(t).ExpectEquals(tuneDiscoveryConcurrency(tuning, 20, 1), int64(26))
+		test.S(t).ExpectEquals(len(tuning.Reasons), 1)
+	}
+	{
+		// Queue wait over budget never shrinks concurrency below the computed one
+		tuning := newTuning(1000, 0.2)
+		tuning.P95QueueWaitSeconds = 3
+		test.S(t).ExpectEquals(tuneDiscoveryConcurrency(tuning, 20, 1), int64(60))
+	}
+	{
+		// A slow backend reduces concurrency by a quarter
+		tuning := newTuning(1000, 0.2)
+		tuning.P95BackendWriteSeconds = 2
+		test.S(t).ExpectEquals(tuneDiscoveryConcurrency(tuning, 20, 1), int64(15))
+		test.S(t).ExpectEquals(len(tuning.Reasons), 1)
+	}
+	{
+		// A slow backend is not loaded further, even while queue wait is over budget
+		tuning := newTuning(100, 0.2)
+		tuning.P95QueueWaitSeconds = 3
+		tuning.P95BackendWriteSeconds = 2
+		test.S(t).ExpectEquals(tuneDiscoveryConcurrency(tuning, 20, 1), int64(15))
+		test.S(t).ExpectEquals(len(tuning.Reasons), 2)
+	}
+	{
+		// At least one worker
+		tuning := newTuning(0, 0)
+		test.S(t).ExpectEquals(tuneDiscoveryConcurrency(tuning, 20, 1), int64(1))
+		tuning.P95BackendWriteSeconds = 2
+		test.S(t).ExpectEquals(tuneDiscoveryConcurrency(tuning, 1, 1), int64(1))
+	}
+	{
+		// At most the started workers
+		tuning := newTuning(10000, 0.2)
+		test.S(t).ExpectEquals(tuneDiscoveryConcurrency(tuning, 20, 1), int64(100))
+		tuning.P95QueueWaitSeconds = 3
+		test.S(t).ExpectEquals(tuneDiscoveryConcurrency(tuning, 100, 1), int64(100))
+	}
+}
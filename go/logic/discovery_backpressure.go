@@ -0,0 +1,179 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/discovery"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/github/orchestrator/go/process"
+	"github.com/openark/golib/log"
+	"github.com/rcrowley/go-metrics"
+)
+
+const discoveryBackpressureHealthProblem = "discovery-backpressure"
+
+// DiscoveryBackpressure is the latest evaluation of discovery saturation on this node, along with the pools
+// shed from discovery as result
+type DiscoveryBackpressure struct {
+	IsSaturated        bool
+	Causes             []string
+	QueueLength        int
+	QueueThreshold     int
+	MeanBackendSeconds float64
+	SheddingLevel      int
+	ShedPools          []string
+	CountShedInstances int
+	EvaluatedAt        time.Time
+}
+
+var discoveryBackpressure = DiscoveryBackpressure{Causes: []string{}, ShedPools: []string{}}
+var discoveryBackpressureMutex sync.Mutex
+
+var discoverySheddingLevelGauge = metrics.NewGauge()
+
+func init() {
+	metrics.Register("discoveries.shedding_level", discoverySheddingLevelGauge)
+}
+
+// ReadDiscoveryBackpressure returns the latest evaluation of discovery saturation
+func ReadDiscoveryBackpressure() DiscoveryBackpressure {
+	discoveryBackpressureMutex.Lock()
+	defer discoveryBackpressureMutex.Unlock()
+	return discoveryBackpressure
+}
+
+// readDiscoveryShedKeys lists the members of given pools
+func readDiscoveryShedKeys(pools []string) (map[inst.InstanceKey]string, error) {
+	shedKeys := make(map[inst.InstanceKey]string)
+	if len(pools) == 0 {
+		return shedKeys, nil
+	}
+	poolInstances, err := inst.ReadAllClusterPoolInstances()
+	if err != nil {
+		return shedKeys, err
+	}
+	for _, poolInstance := range poolInstances {
+		for _, pool := range pools {
+			if poolInstance.Pool == pool {
+				shedKeys[inst.InstanceKey{Hostname: poolInstance.Hostname, Port: poolInstance.Port}] = pool
+			}
+		}
+	}
+	return shedKeys, nil
+}
+
+// CheckDiscoveryBackpressure evaluates whether discovery is saturated, either by a filling discovery queue or by a
+// slow backend. While saturated, pools listed in DiscoverySheddingPools are shed from discovery one at a time, lowest
+// priority first, on each evaluation. Once saturation is well relieved, pools are restored one at a time, in reverse
+// order. Shed instances are flagged in the API as such, and saturation is reported as a health problem of this node.
+func CheckDiscoveryBackpressure() {
+	queueRatio := config.Config.DiscoveryBackpressureQueueRatio
+	backendSeconds := config.Config.DiscoveryBackpressureBackendSeconds
+	if queueRatio == 0 && backendSeconds == 0 {
+		return
+	}
+	if discoveryQueue == nil {
+		return
+	}
+	evaluation := DiscoveryBackpressure{
+		Causes:      []string{},
+		ShedPools:   []string{},
+		QueueLength: discoveryQueue.QueueLen(),
+		EvaluatedAt: time.Now(),
+	}
+	if aggregated, err := discovery.AggregatedSince(discoveryMetrics, time.Now().Add(-instancePollSecondsDuration())); err == nil {
+		evaluation.MeanBackendSeconds = aggregated.MeanBackendSeconds
+	}
+	isRelieved := true
+	if queueRatio > 0 {
+		evaluation.QueueThreshold = int(queueRatio * float64(config.Config.DiscoveryQueueCapacity))
+		if evaluation.QueueLength >= evaluation.QueueThreshold {
+			evaluation.Causes = append(evaluation.Causes, fmt.Sprintf("discovery queue length %d reached %d (DiscoveryBackpressureQueueRatio %.2f of DiscoveryQueueCapacity %d); consider increasing DiscoveryMaxConcurrency", evaluation.QueueLength, evaluation.QueueThreshold, queueRatio, config.Config.DiscoveryQueueCapacity))
+		}
+		isRelieved = isRelieved && evaluation.QueueLength < evaluation.QueueThreshold/2
+	}
+	if backendSeconds > 0 {
+		if evaluation.MeanBackendSeconds > backendSeconds {
+			evaluation.Causes = append(evaluation.Causes, fmt.Sprintf("mean backend latency of discoveries %.3fs exceeds DiscoveryBackpressureBackendSeconds %.3fs; backend database is overloaded", evaluation.MeanBackendSeconds, backendSeconds))
+		}
+		isRelieved = isRelieved && evaluation.MeanBackendSeconds < backendSeconds/2
+	}
+	evaluation.IsSaturated = len(evaluation.Causes) > 0
+
+	discoveryBackpressureMutex.Lock()
+	previous := discoveryBackpressure
+	discoveryBackpressureMutex.Unlock()
+
+	pools := config.Config.DiscoverySheddingPools
+	evaluation.SheddingLevel = previous.SheddingLevel
+	if evaluation.IsSaturated && evaluation.SheddingLevel < len(pools) {
+		evaluation.SheddingLevel++
+	}
+	if isRelieved && evaluation.SheddingLevel > 0 {
+		evaluation.SheddingLevel--
+	}
+	if evaluation.SheddingLevel > len(pools) {
+		// DiscoverySheddingPools shrunk upon config reload
+		evaluation.SheddingLevel = len(pools)
+	}
+	evaluation.ShedPools = append(evaluation.ShedPools, pools[0:evaluation.SheddingLevel]...)
+	shedKeys, err := readDiscoveryShedKeys(evaluation.ShedPools)
+	if err != nil {
+		log.Errore(err)
+		return
+	}
+	inst.SetDiscoveryShedKeys(shedKeys)
+	evaluation.CountShedInstances = len(shedKeys)
+	discoverySheddingLevelGauge.Update(int64(evaluation.SheddingLevel))
+
+	discoveryBackpressureMutex.Lock()
+	discoveryBackpressure = evaluation
+	discoveryBackpressureMutex.Unlock()
+
+	if evaluation.IsSaturated != previous.IsSaturated {
+		if evaluation.IsSaturated {
+			log.Warningf("Discovery is saturated: %s", strings.Join(evaluation.Causes, "; "))
+			inst.AuditOperation("discovery-saturated", nil, strings.Join(evaluation.Causes, "; "))
+		} else {
+			log.Infof("Discovery is no longer saturated")
+			inst.AuditOperation("discovery-saturation-cleared", nil, "")
+		}
+	}
+	if evaluation.SheddingLevel != previous.SheddingLevel {
+		message := fmt.Sprintf("shed pools: %+v; %d instances", evaluation.ShedPools, evaluation.CountShedInstances)
+		log.Warningf("Discovery shedding changed: %s", message)
+		inst.AuditOperation("discovery-shedding", nil, message)
+	}
+	if evaluation.IsSaturated || evaluation.SheddingLevel > 0 {
+		problem := "Discovery is recovering from saturation"
+		if evaluation.IsSaturated {
+			problem = fmt.Sprintf("Discovery is saturated: %s", strings.Join(evaluation.Causes, "; "))
+		}
+		if evaluation.SheddingLevel > 0 {
+			problem = fmt.Sprintf("%s. Shedding pools %+v (%d instances) from discovery", problem, evaluation.ShedPools, evaluation.CountShedInstances)
+		}
+		process.SetHealthProblem(discoveryBackpressureHealthProblem, problem)
+	} else {
+		process.ClearHealthProblem(discoveryBackpressureHealthProblem)
+	}
+}
@@ -0,0 +1,141 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/discovery"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/github/orchestrator/go/process"
+	test "github.com/openark/golib/tests"
+)
+
+// withDiscoveryBackpressureQueue evaluates backpressure on a dedicated discovery queue of capacity 10, saturated at
+// half its capacity, shedding the "batch" pool and then the "reporting" pool
+func withDiscoveryBackpressureQueue(t *testing.T) *discovery.Queue {
+	queueCapacity, queueRatio, backendSeconds, sheddingPools := config.Config.DiscoveryQueueCapacity, config.Config.DiscoveryBackpressureQueueRatio, config.Config.DiscoveryBackpressureBackendSeconds, config.Config.DiscoverySheddingPools
+	config.Config.DiscoveryQueueCapacity = 10
+	config.Config.DiscoveryBackpressureQueueRatio = 0.5
+	config.Config.DiscoveryBackpressureBackendSeconds = 0
+	config.Config.DiscoverySheddingPools = []string{"batch", "reporting"}
+	previousQueue := discoveryQueue
+	discoveryQueue = discovery.CreateOrReturnQueue(fmt.Sprintf("TEST_%s", t.Name()))
+	t.Cleanup(func() {
+		config.Config.DiscoveryQueueCapacity, config.Config.DiscoveryBackpressureQueueRatio, config.Config.DiscoveryBackpressureBackendSeconds, config.Config.DiscoverySheddingPools = queueCapacity, queueRatio, backendSeconds, sheddingPools
+		discoveryQueue = previousQueue
+		discoveryBackpressureMutex.Lock()
+		discoveryBackpressure = DiscoveryBackpressure{Causes: []string{}, ShedPools: []string{}}
+		discoveryBackpressureMutex.Unlock()
+		inst.SetDiscoveryShedKeys(make(map[inst.InstanceKey]string))
+		process.ClearHealthProblem(discoveryBackpressureHealthProblem)
+	})
+	return discoveryQueue
+}
+
+func TestCheckDiscoveryBackpressure(t *testing.T) {
+	withSQLiteBackend(t)
+	queue := withDiscoveryBackpressureQueue(t)
+
+	masterKey := inst.InstanceKey{Hostname: "backpressure-master", Port: 3306}
+	batchKey := inst.InstanceKey{Hostname: "backpressure-batch", Port: 3306}
+	reportingKey := inst.InstanceKey{Hostname: "backpressure-reporting", Port: 3306}
+	writeTestInstance(t, masterKey, inst.InstanceKey{}, "backpressure-master:3306")
+	writeTestInstance(t, batchKey, masterKey, "backpressure-master:3306")
+	writeTestInstance(t, reportingKey, masterKey, "backpressure-master:3306")
+	for pool, instanceKey := range map[string]inst.InstanceKey{"batch": batchKey, "reporting": reportingKey} {
+		_, err := db.ExecOrchestrator(`insert into database_instance_pool (hostname, port, pool, registered_at) values (?, ?, ?, now())`, instanceKey.Hostname, instanceKey.Port, pool)
+		test.S(t).ExpectNil(err)
+	}
+
+	// Not saturated
+	CheckDiscoveryBackpressure()
+	backpressure := ReadDiscoveryBackpressure()
+	test.S(t).ExpectFalse(backpressure.IsSaturated)
+	test.S(t).ExpectEquals(backpressure.QueueThreshold, 5)
+	test.S(t).ExpectEquals(backpressure.SheddingLevel, 0)
+	test.S(t).ExpectEquals(len(process.ReadHealthProblems()), 0)
+
+	// Saturated: pools are shed one at a time, lowest priority first
+	for i := 0; i < 3; i++ {
+		queue.Push(inst.InstanceKey{Hostname: fmt.Sprintf("backpressure-queued-%d", i), Port: 3306})
+	}
+	CheckDiscoveryBackpressure()
+	backpressure = ReadDiscoveryBackpressure()
+	test.S(t).ExpectTrue(backpressure.IsSaturated)
+	// Queued keys count both as channel entries and as queued keys
+	test.S(t).ExpectEquals(backpressure.QueueLength, 6)
+	test.S(t).ExpectEquals(backpressure.SheddingLevel, 1)
+	test.S(t).ExpectEquals(strings.Join(backpressure.ShedPools, ","), "batch")
+	test.S(t).ExpectEquals(backpressure.CountShedInstances, 1)
+	test.S(t).ExpectEquals(inst.CountDiscoveryShedKeys(), 1)
+	test.S(t).ExpectEquals(len(process.ReadHealthProblems()), 1)
+
+	CheckDiscoveryBackpressure()
+	CheckDiscoveryBackpressure()
+	backpressure = ReadDiscoveryBackpressure()
+	test.S(t).ExpectEquals(backpressure.SheddingLevel, 2)
+	test.S(t).ExpectEquals(strings.Join(backpressure.ShedPools, ","), "batch,reporting")
+	test.S(t).ExpectEquals(backpressure.CountShedInstances, 2)
+
+	// Below the threshold, yet not well relieved: shedding holds
+	queue.Release(queue.Consume())
+	CheckDiscoveryBackpressure()
+	backpressure = ReadDiscoveryBackpressure()
+	test.S(t).ExpectFalse(backpressure.IsSaturated)
+	test.S(t).ExpectEquals(backpressure.SheddingLevel, 2)
+	test.S(t).ExpectEquals(len(process.ReadHealthProblems()), 1)
+
+	// Relieved: pools are restored one at a time, in reverse order
+	for queue.QueueLen() > 0 {
+		queue.Release(queue.Consume())
+	}
+	CheckDiscoveryBackpressure()
+	backpressure = ReadDiscoveryBackpressure()
+	test.S(t).ExpectEquals(backpressure.SheddingLevel, 1)
+	test.S(t).ExpectEquals(strings.Join(backpressure.ShedPools, ","), "batch")
+
+	CheckDiscoveryBackpressure()
+	backpressure = ReadDiscoveryBackpressure()
+	test.S(t).ExpectEquals(backpressure.SheddingLevel, 0)
+	test.S(t).ExpectEquals(len(backpressure.ShedPools), 0)
+	test.S(t).ExpectEquals(inst.CountDiscoveryShedKeys(), 0)
+	test.S(t).ExpectEquals(len(process.ReadHealthProblems()), 0)
+}
+
+func TestCheckDiscoveryBackpressureShrunkPools(t *testing.T) {
+	withSQLiteBackend(t)
+	queue := withDiscoveryBackpressureQueue(t)
+
+	for i := 0; i < 3; i++ {
+		queue.Push(inst.InstanceKey{Hostname: fmt.Sprintf("backpressure-queued-%d", i), Port: 3306})
+	}
+	CheckDiscoveryBackpressure()
+	CheckDiscoveryBackpressure()
+	test.S(t).ExpectEquals(ReadDiscoveryBackpressure().SheddingLevel, 2)
+
+	// DiscoverySheddingPools shrunk upon config reload
+	config.Config.DiscoverySheddingPools = []string{"batch"}
+	CheckDiscoveryBackpressure()
+	backpressure := ReadDiscoveryBackpressure()
+	test.S(t).ExpectEquals(backpressure.SheddingLevel, 1)
+	test.S(t).ExpectEquals(strings.Join(backpressure.ShedPools, ","), "batch")
+}
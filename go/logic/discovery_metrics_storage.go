@@ -0,0 +1,144 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/github/orchestrator/go/collection"
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/discovery"
+	"github.com/github/orchestrator/go/process"
+	"github.com/openark/golib/log"
+)
+
+// discoveryMetricsPersistInterval is the interval at which this node persists the discovery metrics it collected.
+// It should be well below DiscoveryCollectionRetentionSeconds, past which metrics are gone from memory.
+const discoveryMetricsPersistInterval = 10 * time.Second
+
+var discoveryMetricStore discovery.MetricStore
+
+// discoveryMetricsPersistedUntil is the time up to which the discovery metrics collected by this node are persisted.
+// Metrics collected since are only found in memory.
+var discoveryMetricsPersistedUntil = time.Now()
+var discoveryMetricsStorageMutex sync.Mutex
+
+// PersistDiscoveryMetrics persists the discovery metrics collected by this node since last persisted
+func PersistDiscoveryMetrics() error {
+	discoveryMetricsStorageMutex.Lock()
+	defer discoveryMetricsStorageMutex.Unlock()
+
+	if discoveryMetricStore == nil {
+		return nil
+	}
+	raw, err := discoveryMetrics.Since(discoveryMetricsPersistedUntil)
+	if err != nil || len(raw) == 0 {
+		return err
+	}
+	metrics := [](*discovery.Metric){}
+	for _, metric := range raw {
+		metrics = append(metrics, metric.(*discovery.Metric))
+	}
+	if err := discoveryMetricStore.Write(process.ThisHostname, metrics); err != nil {
+		return log.Errore(err)
+	}
+	discoveryMetricsPersistedUntil = raw[len(raw)-1].When().Add(time.Nanosecond)
+	return nil
+}
+
+// ExpireDiscoveryMetrics removes persisted discovery metrics older than DiscoveryMetricsStorageRetentionHours, as well as
+// the oldest ones in excess of DiscoveryMetricsStorageMaxRows
+func ExpireDiscoveryMetrics() error {
+	discoveryMetricsStorageMutex.Lock()
+	defer discoveryMetricsStorageMutex.Unlock()
+
+	if discoveryMetricStore == nil {
+		return nil
+	}
+	retention := time.Duration(config.Config.DiscoveryMetricsStorageRetentionHours) * time.Hour
+	return log.Errore(discoveryMetricStore.Expire(time.Now().Add(-retention), int(config.Config.DiscoveryMetricsStorageMaxRows)))
+}
+
+// DiscoveryMetricsSince returns the discovery metrics collected since given time, in time based order. With
+// DiscoveryMetricsStorage, these are the persisted metrics, collected by any node (or, with a local file, by
+// this node over its past runs), along with the metrics this node collected and has yet to persist; only the most
+// recent DiscoveryMetricsReadLimit of them are returned.
+func DiscoveryMetricsSince(t time.Time) ([]collection.Metric, error) {
+	discoveryMetricsStorageMutex.Lock()
+	defer discoveryMetricsStorageMutex.Unlock()
+
+	if discoveryMetricStore == nil {
+		return discoveryMetrics.Since(t)
+	}
+	limit := int(config.Config.DiscoveryMetricsReadLimit)
+	persisted, err := discoveryMetricStore.ReadSince(t, limit)
+	if err != nil {
+		return nil, err
+	}
+	pendingSince := discoveryMetricsPersistedUntil
+	if pendingSince.Before(t) {
+		pendingSince = t
+	}
+	pending, err := discoveryMetrics.Since(pendingSince)
+	if err != nil {
+		return nil, err
+	}
+	metrics := []collection.Metric{}
+	for _, metric := range persisted {
+		metrics = append(metrics, metric)
+	}
+	metrics = append(metrics, pending...)
+	sort.SliceStable(metrics, func(i, j int) bool {
+		return metrics[i].When().Before(metrics[j].When())
+	})
+	if len(metrics) > limit {
+		metrics = metrics[len(metrics)-limit:]
+	}
+	return metrics, nil
+}
+
+// ContinuousDiscoveryMetricsPersistence persists the discovery metrics collected by this node onto the store
+// configured by DiscoveryMetricsStorage, and expires persisted metrics past their retention
+func ContinuousDiscoveryMetricsPersistence() {
+	store, err := discovery.NewMetricStore()
+	if err != nil {
+		log.Errorf("ContinuousDiscoveryMetricsPersistence: cannot set up %s storage; discovery metrics will not be persisted: %+v", config.Config.DiscoveryMetricsStorage, err)
+		return
+	}
+	if store == nil {
+		return
+	}
+	func() {
+		discoveryMetricsStorageMutex.Lock()
+		defer discoveryMetricsStorageMutex.Unlock()
+		discoveryMetricStore = store
+	}()
+	log.Infof("Persisting discovery metrics onto %s storage", config.Config.DiscoveryMetricsStorage)
+
+	persistTick := time.Tick(discoveryMetricsPersistInterval)
+	expireTick := time.Tick(time.Minute)
+	for {
+		select {
+		case <-persistTick:
+			PersistDiscoveryMetrics()
+		case <-expireTick:
+			ExpireDiscoveryMetrics()
+		}
+	}
+}
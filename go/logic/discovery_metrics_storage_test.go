@@ -0,0 +1,120 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/github/orchestrator/go/collection"
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/discovery"
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+// withDiscoveryMetricsFileStorage persists discovery metrics onto a fresh local file, collecting them into a fresh
+// collection, for the duration of given test
+func withDiscoveryMetricsFileStorage(t *testing.T) discovery.MetricStore {
+	storage, storageFile, readLimit := config.Config.DiscoveryMetricsStorage, config.Config.DiscoveryMetricsStorageFile, config.Config.DiscoveryMetricsReadLimit
+	metrics, store, persistedUntil := discoveryMetrics, discoveryMetricStore, discoveryMetricsPersistedUntil
+	t.Cleanup(func() {
+		config.Config.DiscoveryMetricsStorage, config.Config.DiscoveryMetricsStorageFile, config.Config.DiscoveryMetricsReadLimit = storage, storageFile, readLimit
+		discoveryMetrics, discoveryMetricStore, discoveryMetricsPersistedUntil = metrics, store, persistedUntil
+	})
+	config.Config.DiscoveryMetricsStorage = config.DiscoveryMetricsFileStorage
+	config.Config.DiscoveryMetricsStorageFile = filepath.Join(t.TempDir(), "discovery-metrics.sqlite3")
+
+	var err error
+	discoveryMetricStore, err = discovery.NewMetricStore()
+	test.S(t).ExpectNil(err)
+	discoveryMetrics = collection.CreateOrReturnCollection(fmt.Sprintf("TEST_%s", t.Name()))
+	discoveryMetricsPersistedUntil = time.Now().Add(-time.Hour)
+	return discoveryMetricStore
+}
+
+// discoveryMetricsAt returns discovery metrics of given host, one per given offset in seconds from given time
+func discoveryMetricsAt(hostname string, at time.Time, offsetsSeconds ...int) (metrics []*discovery.Metric) {
+	for _, offset := range offsetsSeconds {
+		metrics = append(metrics, &discovery.Metric{
+			Timestamp:   at.Add(time.Duration(offset) * time.Second),
+			InstanceKey: inst.InstanceKey{Hostname: hostname, Port: 3306},
+		})
+	}
+	return metrics
+}
+
+// describeDiscoveryMetrics lists given metrics as host@offset, offsets in seconds from given time
+func describeDiscoveryMetrics(metrics []collection.Metric, at time.Time) (descriptions []string) {
+	for _, metric := range metrics {
+		discoveryMetric := metric.(*discovery.Metric)
+		descriptions = append(descriptions, fmt.Sprintf("%s@%d", discoveryMetric.InstanceKey.Hostname, int(discoveryMetric.Timestamp.Sub(at)/time.Second)))
+	}
+	return descriptions
+}
+
+func TestDiscoveryMetricsSince(t *testing.T) {
+	store := withDiscoveryMetricsFileStorage(t)
+	at := time.Unix(time.Now().Add(-10*time.Minute).Unix(), 0)
+
+	for _, metric := range discoveryMetricsAt("db-1", at, 0, 2, 4) {
+		discoveryMetrics.Append(metric)
+	}
+	test.S(t).ExpectNil(PersistDiscoveryMetrics())
+	test.S(t).ExpectTrue(discoveryMetricsPersistedUntil.After(at.Add(4 * time.Second)))
+	// Collected by another node
+	test.S(t).ExpectNil(store.Write("orchestrator-2", discoveryMetricsAt("db-2", at, 1, 3, 5, 7)))
+	// Collected by this node, yet to be persisted
+	for _, metric := range discoveryMetricsAt("db-1", at, 6, 8) {
+		discoveryMetrics.Append(metric)
+	}
+
+	metrics, err := DiscoveryMetricsSince(at)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(fmt.Sprintf("%v", describeDiscoveryMetrics(metrics, at)), "[db-1@0 db-2@1 db-1@2 db-2@3 db-1@4 db-2@5 db-1@6 db-2@7 db-1@8]")
+
+	metrics, err = DiscoveryMetricsSince(at.Add(5 * time.Second))
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(fmt.Sprintf("%v", describeDiscoveryMetrics(metrics, at)), "[db-2@5 db-1@6 db-2@7 db-1@8]")
+
+	// Persisting again does not duplicate metrics
+	test.S(t).ExpectNil(PersistDiscoveryMetrics())
+	metrics, err = DiscoveryMetricsSince(at)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(metrics), 9)
+
+	// The read limit applies to the most recent metrics
+	config.Config.DiscoveryMetricsReadLimit = 3
+	metrics, err = DiscoveryMetricsSince(at)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(fmt.Sprintf("%v", describeDiscoveryMetrics(metrics, at)), "[db-1@6 db-2@7 db-1@8]")
+}
+
+func TestDiscoveryMetricsSincePendingOnly(t *testing.T) {
+	withDiscoveryMetricsFileStorage(t)
+	at := time.Unix(time.Now().Add(-10*time.Minute).Unix(), 0)
+
+	for _, metric := range discoveryMetricsAt("db-1", at, 0, 1) {
+		discoveryMetrics.Append(metric)
+	}
+	config.Config.DiscoveryMetricsReadLimit = 1
+	metrics, err := DiscoveryMetricsSince(at)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(fmt.Sprintf("%v", describeDiscoveryMetrics(metrics, at)), "[db-1@1]")
+}
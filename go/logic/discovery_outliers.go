@@ -0,0 +1,121 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/discovery"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/openark/golib/log"
+)
+
+var slowDiscoveryOutliers = make(map[inst.InstanceKey]discovery.SlowDiscoveryOutlier)
+var slowDiscoveryOutliersMutex sync.Mutex
+
+// CheckSlowDiscoveryOutliers identifies the instances whose discovery probes are consistently slow compared with
+// the fleet, as per recently collected discovery metrics. Newly identified outliers are audited, and the leader
+// runs SlowDiscoveryOutlierProcesses for them.
+func CheckSlowDiscoveryOutliers() {
+	if config.Config.DiscoveryOutlierSigma <= 0 {
+		return
+	}
+	since := time.Now().Add(-time.Duration(config.Config.DiscoveryCollectionRetentionSeconds) * time.Second)
+	outliers, err := discovery.SlowOutliersSince(discoveryMetrics, since, config.Config.DiscoveryOutlierSigma)
+	if err != nil {
+		log.Errore(err)
+		return
+	}
+	outliersMap := make(map[inst.InstanceKey]discovery.SlowDiscoveryOutlier)
+	for _, outlier := range outliers {
+		outliersMap[outlier.InstanceKey] = outlier
+	}
+
+	slowDiscoveryOutliersMutex.Lock()
+	previousOutliersMap := slowDiscoveryOutliers
+	slowDiscoveryOutliers = outliersMap
+	slowDiscoveryOutliersMutex.Unlock()
+
+	for instanceKey, outlier := range outliersMap {
+		if _, found := previousOutliersMap[instanceKey]; found {
+			continue
+		}
+		inst.AuditOperation("slow-discovery-outlier", &outlier.InstanceKey, fmt.Sprintf("median probe: %.3fs; fleet median: %.3fs; threshold: %.3fs", outlier.MedianInstanceSeconds, outlier.FleetMedianInstanceSeconds, outlier.ThresholdSeconds))
+		if IsLeader() {
+			go executeSlowDiscoveryOutlierProcesses(outlier)
+		}
+	}
+}
+
+func executeSlowDiscoveryOutlierProcesses(outlier discovery.SlowDiscoveryOutlier) {
+	executeEventProcesses(config.Config.SlowDiscoveryOutlierProcesses, "SlowDiscoveryOutlierProcesses", []hookVariable{
+		{"host", "ORC_HOST", outlier.InstanceKey.Hostname},
+		{"port", "ORC_PORT", fmt.Sprintf("%d", outlier.InstanceKey.Port)},
+		{"medianSeconds", "ORC_MEDIAN_SECONDS", fmt.Sprintf("%.3f", outlier.MedianInstanceSeconds)},
+		{"fleetMedianSeconds", "ORC_FLEET_MEDIAN_SECONDS", fmt.Sprintf("%.3f", outlier.FleetMedianInstanceSeconds)},
+	})
+}
+
+// ReadSlowDiscoveryOutliers returns the current slow discovery outliers
+func ReadSlowDiscoveryOutliers() []discovery.SlowDiscoveryOutlier {
+	slowDiscoveryOutliersMutex.Lock()
+	defer slowDiscoveryOutliersMutex.Unlock()
+
+	outliers := []discovery.SlowDiscoveryOutlier{}
+	for _, outlier := range slowDiscoveryOutliers {
+		outliers = append(outliers, outlier)
+	}
+	return outliers
+}
+
+// AddSlowDiscoveryOutlierProblems flags the slow discovery outliers among given problem instances, and adds those
+// outliers which are not already listed. Downtimed and ignored instances are not added.
+func AddSlowDiscoveryOutlierProblems(instances [](*inst.Instance), clusterName string) ([](*inst.Instance), error) {
+	outliers := ReadSlowDiscoveryOutliers()
+	if len(outliers) == 0 {
+		return instances, nil
+	}
+	listed := inst.NewInstanceKeyMap()
+	for _, instance := range instances {
+		listed.AddKey(instance.Key)
+	}
+	outlierKeys := inst.NewInstanceKeyMap()
+	for _, outlier := range outliers {
+		outlierKeys.AddKey(outlier.InstanceKey)
+		if listed.HasKey(outlier.InstanceKey) {
+			continue
+		}
+		instance, found, err := inst.ReadInstance(&outlier.InstanceKey)
+		if err != nil {
+			return instances, err
+		}
+		if !found || instance.IsDowntimed || inst.RegexpMatchPatterns(instance.Key.Hostname, config.Config.ProblemIgnoreHostnameFilters) {
+			continue
+		}
+		if clusterName != "" && instance.ClusterName != clusterName {
+			continue
+		}
+		instances = append(instances, instance)
+	}
+	for _, instance := range instances {
+		instance.IsSlowDiscoveryOutlier = outlierKeys.HasKey(instance.Key)
+	}
+	return instances, nil
+}
@@ -0,0 +1,260 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/github/orchestrator/go/process"
+	"github.com/openark/golib/log"
+)
+
+// emailDigestExpiringDowntimeHours is the look-ahead of downtimes listed as expiring in the daily digest
+const emailDigestExpiringDowntimeHours = 24
+
+// lastEmailDigestDate is the date on which this node last sent the daily digest
+var lastEmailDigestDate string
+var lastEmailDigestDateMutex sync.Mutex
+
+// DigestProblem is a problem instance, as listed in the daily digest
+type DigestProblem struct {
+	Key          inst.InstanceKey
+	ClusterName  string
+	ClusterAlias string
+	Description  string
+}
+
+// DigestDowntime is a downtime expiring soon, as listed in the daily digest
+type DigestDowntime struct {
+	Key          inst.InstanceKey
+	ClusterName  string
+	ClusterAlias string
+	EndsAt       string
+	Owner        string
+	Reason       string
+}
+
+// DigestRecovery is an unacknowledged recovery, as listed in the daily digest
+type DigestRecovery struct {
+	RecoveryUID       string
+	ClusterName       string
+	ClusterAlias      string
+	FailedInstanceKey inst.InstanceKey
+	Analysis          inst.AnalysisCode
+	StartedAt         string
+}
+
+// DigestEmailData is the data given to the daily digest email template; it lists the items of those clusters routed
+// to the digest's recipients
+type DigestEmailData struct {
+	Date                     string
+	Problems                 []DigestProblem
+	ExpiringDowntimes        []DigestDowntime
+	UnacknowledgedRecoveries []DigestRecovery
+	OrchestratorHost         string
+}
+
+// describeDigestProblem summarizes why an instance is listed as a problem
+func describeDigestProblem(instance *inst.Instance) string {
+	descriptions := []string{}
+	if !instance.IsLastCheckValid {
+		descriptions = append(descriptions, "last check invalid")
+	}
+	if instance.IsReplica() && !instance.ReplicaRunning() {
+		descriptions = append(descriptions, "replication not running")
+	}
+	if instance.SlaveLagSeconds.Valid && instance.SlaveLagSeconds.Int64 > int64(config.Config.ReasonableReplicationLagSeconds) {
+		descriptions = append(descriptions, fmt.Sprintf("lagging %ds", instance.SlaveLagSeconds.Int64))
+	}
+	if instance.IsRecoveryBlocked {
+		descriptions = append(descriptions, "recovery blocked")
+	}
+	if len(descriptions) == 0 {
+		return "see problems"
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+// emailDigestRouter groups digest items by their clusters' recipients
+type emailDigestRouter struct {
+	aliases map[string]string
+	digests map[string]*DigestEmailData
+}
+
+func newEmailDigestRouter() *emailDigestRouter {
+	return &emailDigestRouter{
+		aliases: make(map[string]string),
+		digests: make(map[string]*DigestEmailData),
+	}
+}
+
+// clusterAlias returns the alias of given cluster, reading it once per digest
+func (this *emailDigestRouter) clusterAlias(clusterName string) string {
+	if alias, ok := this.aliases[clusterName]; ok {
+		return alias
+	}
+	alias, _ := inst.ReadAliasByClusterName(clusterName)
+	this.aliases[clusterName] = alias
+	return alias
+}
+
+// digest returns the digest sent to the recipients of given cluster, or nil if the cluster has no recipients
+func (this *emailDigestRouter) digest(clusterName string, clusterAlias string) *DigestEmailData {
+	recipients := config.Config.GetEmailRecipients(clusterName, clusterAlias)
+	if len(recipients) == 0 {
+		return nil
+	}
+	recipientsKey := strings.Join(recipients, ",")
+	if _, ok := this.digests[recipientsKey]; !ok {
+		this.digests[recipientsKey] = &DigestEmailData{
+			Date:                     time.Now().Format("2006-01-02"),
+			Problems:                 []DigestProblem{},
+			ExpiringDowntimes:        []DigestDowntime{},
+			UnacknowledgedRecoveries: []DigestRecovery{},
+			OrchestratorHost:         process.ThisHostname,
+		}
+	}
+	return this.digests[recipientsKey]
+}
+
+// readUnacknowledgedRecoveries reads all unacknowledged recoveries, page by page. A recovery shifting across
+// pages while these are read is only listed once.
+func readUnacknowledgedRecoveries() ([]*TopologyRecovery, error) {
+	recoveries := []*TopologyRecovery{}
+	recoveryUIDs := make(map[string]bool)
+	for page := 0; ; page++ {
+		pageRecoveries, err := ReadRecentRecoveries("", true, page)
+		if err != nil {
+			return recoveries, err
+		}
+		for i := range pageRecoveries {
+			recovery := &pageRecoveries[i]
+			if recoveryUIDs[recovery.UID] {
+				continue
+			}
+			recoveryUIDs[recovery.UID] = true
+			recoveries = append(recoveries, recovery)
+		}
+		if len(pageRecoveries) < config.AuditPageSize {
+			return recoveries, nil
+		}
+	}
+}
+
+// readEmailDigests reads the daily digests of problems, downtimes expiring within the next day, and unacknowledged
+// recoveries, by comma delimited recipients. Each recipient list gets a single digest, listing the items of the
+// clusters routed to it.
+func readEmailDigests() (map[string]*DigestEmailData, error) {
+	router := newEmailDigestRouter()
+
+	problems, err := inst.ReadProblemInstances("")
+	if err != nil {
+		return nil, err
+	}
+	if problems, err = AddBlockedRecoveryProblems(problems, ""); err != nil {
+		return nil, err
+	}
+	for _, instance := range problems {
+		alias := router.clusterAlias(instance.ClusterName)
+		if digest := router.digest(instance.ClusterName, alias); digest != nil {
+			digest.Problems = append(digest.Problems, DigestProblem{Key: instance.Key, ClusterName: instance.ClusterName, ClusterAlias: alias, Description: describeDigestProblem(instance)})
+		}
+	}
+
+	downtimes, err := inst.ReadDowntime()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(downtimes, func(i, j int) bool { return downtimes[i].EndsAt.Before(downtimes[j].EndsAt) })
+	for _, downtime := range downtimes {
+		if time.Until(downtime.EndsAt) > emailDigestExpiringDowntimeHours*time.Hour {
+			continue
+		}
+		clusterName := ""
+		if instance, found, _ := inst.ReadInstance(downtime.Key); found {
+			clusterName = instance.ClusterName
+		}
+		alias := router.clusterAlias(clusterName)
+		if digest := router.digest(clusterName, alias); digest != nil {
+			digest.ExpiringDowntimes = append(digest.ExpiringDowntimes, DigestDowntime{Key: *downtime.Key, ClusterName: clusterName, ClusterAlias: alias, EndsAt: downtime.EndsAtString, Owner: downtime.Owner, Reason: downtime.Reason})
+		}
+	}
+
+	recoveries, err := readUnacknowledgedRecoveries()
+	if err != nil {
+		return nil, err
+	}
+	for _, recovery := range recoveries {
+		clusterDetails := recovery.AnalysisEntry.ClusterDetails
+		if digest := router.digest(clusterDetails.ClusterName, clusterDetails.ClusterAlias); digest != nil {
+			digest.UnacknowledgedRecoveries = append(digest.UnacknowledgedRecoveries, DigestRecovery{
+				RecoveryUID:       recovery.UID,
+				ClusterName:       clusterDetails.ClusterName,
+				ClusterAlias:      clusterDetails.ClusterAlias,
+				FailedInstanceKey: recovery.AnalysisEntry.AnalyzedInstanceKey,
+				Analysis:          recovery.AnalysisEntry.Analysis,
+				StartedAt:         recovery.RecoveryStartTimestamp,
+			})
+		}
+	}
+
+	return router.digests, nil
+}
+
+// SendEmailDigest emails the daily digest of problems, downtimes expiring within the next day, and unacknowledged
+// recoveries to each of the recipient lists.
+func SendEmailDigest() error {
+	digests, err := readEmailDigests()
+	if err != nil {
+		return err
+	}
+	for recipientsKey, digest := range digests {
+		if err := emailNotification(strings.Split(recipientsKey, ","), digestEmailTemplateName, digest); err != nil {
+			log.Errore(err)
+		}
+	}
+	return nil
+}
+
+// CheckEmailDigest sends the daily digest on the leader, once a day, at EmailDigestHour
+func CheckEmailDigest() {
+	if !EmailNotificationsEnabled() || config.Config.EmailDigestHour < 0 || !IsLeader() {
+		return
+	}
+	now := time.Now()
+	if now.Hour() != config.Config.EmailDigestHour {
+		return
+	}
+	today := now.Format("2006-01-02")
+
+	lastEmailDigestDateMutex.Lock()
+	defer lastEmailDigestDateMutex.Unlock()
+	if lastEmailDigestDate == today {
+		return
+	}
+	if err := SendEmailDigest(); err != nil {
+		log.Errorf("CheckEmailDigest: %+v", err)
+		return
+	}
+	lastEmailDigestDate = today
+}
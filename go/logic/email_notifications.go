@@ -0,0 +1,274 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/smtp"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/github/orchestrator/go/process"
+	"github.com/openark/golib/log"
+)
+
+// smtpTimeout limits the time spent on connecting to the SMTP server
+const smtpTimeout = 10 * time.Second
+
+// smtpSessionTimeout limits the time spent on an SMTP session, from greeting to quit, so that an unresponsive
+// server cannot hold on to the sending goroutine
+const smtpSessionTimeout = time.Minute
+
+const (
+	recoveryEmailTemplateName         = "recovery.tmpl"
+	failureDetectionEmailTemplateName = "failure-detection.tmpl"
+	digestEmailTemplateName           = "digest.tmpl"
+)
+
+// builtinEmailTemplates are used where EmailTemplatesDirectory does not override them
+var builtinEmailTemplates = map[string]string{
+	recoveryEmailTemplateName: `{{define "subject"}}[orchestrator] {{if .IsResolved}}{{if .IsSuccessful}}Recovered{{else}}Failed recovering{{end}}{{else}}Recovering{{end}} {{.Analysis}} on {{.FailedInstanceKey}} ({{.ClusterAlias}}){{end}}
+{{define "body"}}{{if .IsResolved}}Recovery of {{.Analysis}} on {{.FailedInstanceKey}} {{if .IsSuccessful}}succeeded{{else}}failed{{end}}.{{else}}Recovery of {{.Analysis}} on {{.FailedInstanceKey}} has started.{{end}}
+
+Cluster: {{.ClusterName}} (alias: {{.ClusterAlias}})
+Recovery: {{.RecoveryUID}}
+{{if .SuccessorKey}}Promoted: {{.SuccessorKey}}
+{{end}}{{if .LostReplicas}}Lost replicas: {{.LostReplicas}}
+{{end}}
+Sent by orchestrator on {{.OrchestratorHost}}
+{{end}}`,
+	failureDetectionEmailTemplateName: `{{define "subject"}}[orchestrator] Detected {{.Analysis}} on {{.FailedInstanceKey}} ({{.ClusterAlias}}){{end}}
+{{define "body"}}orchestrator detected {{.Analysis}} on {{.FailedInstanceKey}}.
+{{if .Description}}
+{{.Description}}
+{{end}}
+Cluster: {{.ClusterName}} (alias: {{.ClusterAlias}})
+Replicas: {{.CountReplicas}}
+
+Sent by orchestrator on {{.OrchestratorHost}}
+{{end}}`,
+	digestEmailTemplateName: `{{define "subject"}}[orchestrator] Daily digest {{.Date}}: {{len .Problems}} problems, {{len .ExpiringDowntimes}} expiring downtimes, {{len .UnacknowledgedRecoveries}} unacknowledged recoveries{{end}}
+{{define "body"}}Problems ({{len .Problems}}):
+{{range .Problems}}- {{.Key}} ({{.ClusterAlias}}): {{.Description}}
+{{else}}- none
+{{end}}
+Downtimes expiring within 24 hours ({{len .ExpiringDowntimes}}):
+{{range .ExpiringDowntimes}}- {{.Key}} ({{.ClusterAlias}}): ends {{.EndsAt}}, by {{.Owner}}: {{.Reason}}
+{{else}}- none
+{{end}}
+Unacknowledged recoveries ({{len .UnacknowledgedRecoveries}}):
+{{range .UnacknowledgedRecoveries}}- {{.RecoveryUID}}: {{.Analysis}} on {{.FailedInstanceKey}} ({{.ClusterAlias}}), started {{.StartedAt}}
+{{else}}- none
+{{end}}
+Sent by orchestrator on {{.OrchestratorHost}}
+{{end}}`,
+}
+
+// RecoveryEmailData is the data given to the recovery email template, as a recovery starts or is resolved
+type RecoveryEmailData struct {
+	IsResolved        bool
+	IsSuccessful      bool
+	ClusterName       string
+	ClusterAlias      string
+	FailedInstanceKey inst.InstanceKey
+	Analysis          inst.AnalysisCode
+	RecoveryUID       string
+	SuccessorKey      string
+	LostReplicas      string
+	OrchestratorHost  string
+}
+
+// FailureDetectionEmailData is the data given to the failure detection email template
+type FailureDetectionEmailData struct {
+	ClusterName       string
+	ClusterAlias      string
+	FailedInstanceKey inst.InstanceKey
+	Analysis          inst.AnalysisCode
+	Description       string
+	CountReplicas     uint
+	OrchestratorHost  string
+}
+
+// EmailNotificationsEnabled returns true when email notifications are configured
+func EmailNotificationsEnabled() bool {
+	return config.Config.SMTPHost != ""
+}
+
+// readEmailTemplate parses the email template of given name: that in EmailTemplatesDirectory if found, else the built-in one
+func readEmailTemplate(name string) (*template.Template, error) {
+	text := builtinEmailTemplates[name]
+	if config.Config.EmailTemplatesDirectory != "" {
+		content, err := ioutil.ReadFile(path.Join(config.Config.EmailTemplatesDirectory, name))
+		if err == nil {
+			text = string(content)
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return template.New(name).Parse(text)
+}
+
+// renderEmail renders the subject and body of an email, given the name of its template and the data
+func renderEmail(templateName string, data interface{}) (subject string, body string, err error) {
+	tmpl, err := readEmailTemplate(templateName)
+	if err != nil {
+		return subject, body, err
+	}
+	var subjectBuffer, bodyBuffer bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&subjectBuffer, "subject", data); err != nil {
+		return subject, body, err
+	}
+	if err := tmpl.ExecuteTemplate(&bodyBuffer, "body", data); err != nil {
+		return subject, body, err
+	}
+	subject = strings.Join(strings.Fields(subjectBuffer.String()), " ")
+	return subject, bodyBuffer.String(), nil
+}
+
+// composeEmail composes a plain text email message
+func composeEmail(from string, recipients []string, subject string, body string) []byte {
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", from)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(recipients, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: text/plain; charset=UTF-8\r\n")
+	fmt.Fprintf(&message, "\r\n")
+	message.WriteString(strings.Replace(body, "\n", "\r\n", -1))
+	return message.Bytes()
+}
+
+// sendEmail sends an email via the configured SMTP server, upgrading to TLS where the server supports it
+func sendEmail(recipients []string, subject string, body string) error {
+	address := net.JoinHostPort(config.Config.SMTPHost, fmt.Sprintf("%d", config.Config.SMTPPort))
+	conn, err := net.DialTimeout("tcp", address, smtpTimeout)
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Now().Add(smtpSessionTimeout)); err != nil {
+		conn.Close()
+		return err
+	}
+	client, err := smtp.NewClient(conn, config.Config.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: config.Config.SMTPHost}); err != nil {
+			return err
+		}
+	}
+	if config.Config.SMTPUser != "" {
+		if err := client.Auth(smtp.PlainAuth("", config.Config.SMTPUser, config.Config.SMTPPassword, config.Config.SMTPHost)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(config.Config.EmailFromAddress); err != nil {
+		return err
+	}
+	for _, recipient := range recipients {
+		if err := client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(composeEmail(config.Config.EmailFromAddress, recipients, subject, body)); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// emailNotification renders and sends an email to given recipients. Identical notifications are subject
+// to NotificationDeduplicationSeconds.
+func emailNotification(recipients []string, templateName string, data interface{}) error {
+	if !EmailNotificationsEnabled() || len(recipients) == 0 {
+		return nil
+	}
+	subject, body, err := renderEmail(templateName, data)
+	if err != nil {
+		return log.Errorf("emailNotification: cannot render %s: %+v", templateName, err)
+	}
+	if inst.IsDuplicateNotification(fmt.Sprintf("email/%s/%s", strings.Join(recipients, ","), subject)) {
+		return nil
+	}
+	if err := sendEmail(recipients, subject, body); err != nil {
+		return log.Errorf("emailNotification: failed sending \"%s\" to %+v: %+v", subject, recipients, err)
+	}
+	log.Infof("emailNotification: sent \"%s\" to %+v", subject, recipients)
+	return nil
+}
+
+// emailRecoveryNotification asynchronously notifies the cluster's email recipients as a recovery starts or is resolved
+func emailRecoveryNotification(topologyRecovery *TopologyRecovery, isResolved bool) {
+	if !EmailNotificationsEnabled() {
+		return
+	}
+	analysisEntry := topologyRecovery.AnalysisEntry
+	recipients := config.Config.GetEmailRecipients(analysisEntry.ClusterDetails.ClusterName, analysisEntry.ClusterDetails.ClusterAlias)
+	data := RecoveryEmailData{
+		IsResolved:        isResolved,
+		IsSuccessful:      topologyRecovery.IsSuccessful,
+		ClusterName:       analysisEntry.ClusterDetails.ClusterName,
+		ClusterAlias:      analysisEntry.ClusterDetails.ClusterAlias,
+		FailedInstanceKey: analysisEntry.AnalyzedInstanceKey,
+		Analysis:          analysisEntry.Analysis,
+		RecoveryUID:       topologyRecovery.UID,
+		LostReplicas:      topologyRecovery.LostReplicas.ToCommaDelimitedList(),
+		OrchestratorHost:  process.ThisHostname,
+	}
+	if topologyRecovery.SuccessorKey != nil && topologyRecovery.SuccessorKey.IsValid() {
+		data.SuccessorKey = topologyRecovery.SuccessorKey.DisplayString()
+	}
+	go emailNotification(recipients, recoveryEmailTemplateName, data)
+}
+
+// emailFailureDetectionNotification asynchronously notifies the cluster's email recipients of a detected failure,
+// given its analysis code is listed in EmailAnalysisCodes
+func emailFailureDetectionNotification(analysisEntry *inst.ReplicationAnalysis) {
+	if !EmailNotificationsEnabled() || !config.Config.IsEmailAnalysisCode(string(analysisEntry.Analysis)) {
+		return
+	}
+	recipients := config.Config.GetEmailRecipients(analysisEntry.ClusterDetails.ClusterName, analysisEntry.ClusterDetails.ClusterAlias)
+	data := FailureDetectionEmailData{
+		ClusterName:       analysisEntry.ClusterDetails.ClusterName,
+		ClusterAlias:      analysisEntry.ClusterDetails.ClusterAlias,
+		FailedInstanceKey: analysisEntry.AnalyzedInstanceKey,
+		Analysis:          analysisEntry.Analysis,
+		Description:       analysisEntry.Description,
+		CountReplicas:     analysisEntry.CountReplicas,
+		OrchestratorHost:  process.ThisHostname,
+	}
+	go emailNotification(recipients, failureDetectionEmailTemplateName, data)
+}
@@ -0,0 +1,196 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+// withEmailTemplatesDirectory points EmailTemplatesDirectory at a temporary directory holding given templates
+func withEmailTemplatesDirectory(t *testing.T, templates map[string]string) {
+	directory := t.TempDir()
+	for name, text := range templates {
+		test.S(t).ExpectNil(ioutil.WriteFile(filepath.Join(directory, name), []byte(text), 0644))
+	}
+	templatesDirectory := config.Config.EmailTemplatesDirectory
+	config.Config.EmailTemplatesDirectory = directory
+	t.Cleanup(func() {
+		config.Config.EmailTemplatesDirectory = templatesDirectory
+	})
+}
+
+func TestBuiltinEmailTemplates(t *testing.T) {
+	for _, name := range []string{recoveryEmailTemplateName, failureDetectionEmailTemplateName, digestEmailTemplateName} {
+		tmpl, err := readEmailTemplate(name)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectNotNil(tmpl.Lookup("subject"))
+		test.S(t).ExpectNotNil(tmpl.Lookup("body"))
+	}
+	test.S(t).ExpectEquals(len(builtinEmailTemplates), 3)
+}
+
+func TestRenderRecoveryEmail(t *testing.T) {
+	data := RecoveryEmailData{
+		ClusterName:       "db-master:3306",
+		ClusterAlias:      "main",
+		FailedInstanceKey: inst.InstanceKey{Hostname: "db-master", Port: 3306},
+		Analysis:          inst.DeadMaster,
+		RecoveryUID:       "recovery-uid",
+		OrchestratorHost:  "orchestrator-node",
+	}
+	{
+		subject, body, err := renderEmail(recoveryEmailTemplateName, data)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(subject, "[orchestrator] Recovering DeadMaster on db-master:3306 (main)")
+		test.S(t).ExpectTrue(strings.Contains(body, "Recovery of DeadMaster on db-master:3306 has started."))
+		test.S(t).ExpectTrue(strings.Contains(body, "Cluster: db-master:3306 (alias: main)"))
+		test.S(t).ExpectTrue(strings.Contains(body, "Recovery: recovery-uid"))
+		test.S(t).ExpectTrue(strings.Contains(body, "Sent by orchestrator on orchestrator-node"))
+		test.S(t).ExpectFalse(strings.Contains(body, "Promoted:"))
+		test.S(t).ExpectFalse(strings.Contains(body, "Lost replicas:"))
+	}
+	{
+		data.IsResolved = true
+		data.IsSuccessful = true
+		data.SuccessorKey = "db-replica:3306"
+		data.LostReplicas = "db-lost:3306"
+		subject, body, err := renderEmail(recoveryEmailTemplateName, data)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(subject, "[orchestrator] Recovered DeadMaster on db-master:3306 (main)")
+		test.S(t).ExpectTrue(strings.Contains(body, "Recovery of DeadMaster on db-master:3306 succeeded."))
+		test.S(t).ExpectTrue(strings.Contains(body, "Promoted: db-replica:3306"))
+		test.S(t).ExpectTrue(strings.Contains(body, "Lost replicas: db-lost:3306"))
+	}
+	{
+		data.IsSuccessful = false
+		subject, body, err := renderEmail(recoveryEmailTemplateName, data)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(subject, "[orchestrator] Failed recovering DeadMaster on db-master:3306 (main)")
+		test.S(t).ExpectTrue(strings.Contains(body, "Recovery of DeadMaster on db-master:3306 failed."))
+	}
+}
+
+func TestRenderFailureDetectionEmail(t *testing.T) {
+	data := FailureDetectionEmailData{
+		ClusterName:       "db-master:3306",
+		ClusterAlias:      "main",
+		FailedInstanceKey: inst.InstanceKey{Hostname: "db-master", Port: 3306},
+		Analysis:          inst.DeadMaster,
+		Description:       "Master cannot be reached by orchestrator and none of its replicas is replicating",
+		CountReplicas:     2,
+		OrchestratorHost:  "orchestrator-node",
+	}
+	subject, body, err := renderEmail(failureDetectionEmailTemplateName, data)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(subject, "[orchestrator] Detected DeadMaster on db-master:3306 (main)")
+	test.S(t).ExpectTrue(strings.Contains(body, "orchestrator detected DeadMaster on db-master:3306."))
+	test.S(t).ExpectTrue(strings.Contains(body, data.Description))
+	test.S(t).ExpectTrue(strings.Contains(body, "Replicas: 2"))
+}
+
+func TestRenderDigestEmail(t *testing.T) {
+	data := DigestEmailData{
+		Date:                     "2017-01-02",
+		Problems:                 []DigestProblem{},
+		ExpiringDowntimes:        []DigestDowntime{},
+		UnacknowledgedRecoveries: []DigestRecovery{},
+		OrchestratorHost:         "orchestrator-node",
+	}
+	{
+		subject, body, err := renderEmail(digestEmailTemplateName, data)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(subject, "[orchestrator] Daily digest 2017-01-02: 0 problems, 0 expiring downtimes, 0 unacknowledged recoveries")
+		test.S(t).ExpectEquals(strings.Count(body, "- none"), 3)
+	}
+	{
+		data.Problems = append(data.Problems, DigestProblem{Key: inst.InstanceKey{Hostname: "db-replica", Port: 3306}, ClusterAlias: "main", Description: "replication not running"})
+		data.ExpiringDowntimes = append(data.ExpiringDowntimes, DigestDowntime{Key: inst.InstanceKey{Hostname: "db-backup", Port: 3306}, ClusterAlias: "main", EndsAt: "2017-01-02 12:00:00", Owner: "dba", Reason: "backup"})
+		data.UnacknowledgedRecoveries = append(data.UnacknowledgedRecoveries, DigestRecovery{RecoveryUID: "recovery-uid", ClusterAlias: "main", FailedInstanceKey: inst.InstanceKey{Hostname: "db-master", Port: 3306}, Analysis: inst.DeadMaster, StartedAt: "2017-01-01 23:00:00"})
+		subject, body, err := renderEmail(digestEmailTemplateName, data)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(subject, "[orchestrator] Daily digest 2017-01-02: 1 problems, 1 expiring downtimes, 1 unacknowledged recoveries")
+		test.S(t).ExpectEquals(strings.Count(body, "- none"), 0)
+		test.S(t).ExpectTrue(strings.Contains(body, "- db-replica:3306 (main): replication not running"))
+		test.S(t).ExpectTrue(strings.Contains(body, "- db-backup:3306 (main): ends 2017-01-02 12:00:00, by dba: backup"))
+		test.S(t).ExpectTrue(strings.Contains(body, "- recovery-uid: DeadMaster on db-master:3306 (main), started 2017-01-01 23:00:00"))
+	}
+}
+
+func TestRenderEmailTemplatesDirectory(t *testing.T) {
+	withEmailTemplatesDirectory(t, map[string]string{
+		recoveryEmailTemplateName: `{{define "subject"}}Custom {{.Analysis}}
+	on {{.FailedInstanceKey}}{{end}}{{define "body"}}custom body{{end}}`,
+		failureDetectionEmailTemplateName: `{{define "subject"}}{{.Analysis}`,
+	})
+	data := RecoveryEmailData{FailedInstanceKey: inst.InstanceKey{Hostname: "db-master", Port: 3306}, Analysis: inst.DeadMaster}
+	{
+		subject, body, err := renderEmail(recoveryEmailTemplateName, data)
+		test.S(t).ExpectNil(err)
+		// Subjects are kept to a single line
+		test.S(t).ExpectEquals(subject, "Custom DeadMaster on db-master:3306")
+		test.S(t).ExpectEquals(body, "custom body")
+	}
+	{
+		_, _, err := renderEmail(failureDetectionEmailTemplateName, FailureDetectionEmailData{})
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		// Not overridden; falls back to the built-in template
+		subject, _, err := renderEmail(digestEmailTemplateName, DigestEmailData{Date: "2017-01-02"})
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectTrue(strings.HasPrefix(subject, "[orchestrator] Daily digest 2017-01-02:"))
+	}
+}
+
+func TestReadEmailDigestsAllUnacknowledgedRecoveries(t *testing.T) {
+	withSQLiteBackend(t)
+	recipients := config.Config.EmailRecipients
+	config.Config.EmailRecipients = map[string][]string{"main": {"dba@example.com"}, "*": {"ops@example.com"}}
+	defer func() { config.Config.EmailRecipients = recipients }()
+
+	countRecoveries := 2*config.AuditPageSize + 1
+	for i := 0; i < countRecoveries; i++ {
+		analysisEntry := inst.ReplicationAnalysis{
+			AnalyzedInstanceKey: inst.InstanceKey{Hostname: fmt.Sprintf("db-master-%d", i), Port: 3306},
+			Analysis:            inst.DeadMaster,
+		}
+		analysisEntry.ClusterDetails.ClusterName = analysisEntry.AnalyzedInstanceKey.StringCode()
+		if i%2 == 0 {
+			analysisEntry.ClusterDetails.ClusterAlias = "main"
+		}
+		_, err := writeTopologyRecovery(NewTopologyRecovery(analysisEntry))
+		test.S(t).ExpectNil(err)
+	}
+
+	recoveries, err := readUnacknowledgedRecoveries()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(recoveries), countRecoveries)
+
+	digests, err := readEmailDigests()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(digests), 2)
+	test.S(t).ExpectEquals(len(digests["dba@example.com"].UnacknowledgedRecoveries), config.AuditPageSize+1)
+	test.S(t).ExpectEquals(len(digests["ops@example.com"].UnacknowledgedRecoveries), config.AuditPageSize)
+}
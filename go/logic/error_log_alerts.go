@@ -0,0 +1,174 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/github/orchestrator/go/agent"
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/openark/golib/log"
+)
+
+var errorLogsCheckEntrance int64
+
+// errorLogTails are the latest MySQL error log tails read from agents, by agent hostname
+var errorLogTails = make(map[string][]string)
+var errorLogTailsMutex sync.Mutex
+
+// errorLogAlertsEnabled returns true when ErrorLogPatterns are configured
+func errorLogAlertsEnabled() bool {
+	return len(config.Config.ErrorLogPatterns) > 0
+}
+
+// checkAgentErrorLog tails the MySQL error log on an agent's host, and records the lines added since the previous
+// tail which match ErrorLogPatterns. The first tail read from a host is only a baseline, so that lines are not
+// alerted on again as orchestrator restarts or leadership changes.
+func checkAgentErrorLog(hostAgent *agent.Agent) error {
+	tail, err := agent.MySQLErrorLogTail(hostAgent.Hostname)
+	if err != nil {
+		return err
+	}
+	errorLogTailsMutex.Lock()
+	previousTail, found := errorLogTails[hostAgent.Hostname]
+	errorLogTails[hostAgent.Hostname] = tail
+	errorLogTailsMutex.Unlock()
+	if !found {
+		return nil
+	}
+
+	instanceKey := hostAgent.GetInstance()
+	events := inst.NewErrorLogEvents(instanceKey, inst.NewErrorLogLines(previousTail, tail))
+	if len(events) == 0 {
+		return nil
+	}
+	if err := inst.WriteErrorLogEvents(events); err != nil {
+		return err
+	}
+	clusterName := ""
+	if instance, found, _ := inst.ReadInstance(instanceKey); found {
+		clusterName = instance.ClusterName
+	}
+	for _, event := range events {
+		log.Warningf("Error log of %+v matches %s: %s", *instanceKey, event.PatternName, strings.TrimSpace(event.LogLine))
+		inst.RecordStateEvent(inst.ErrorLogMatchEvent, clusterName, instanceKey, map[string]interface{}{
+			"patternName": event.PatternName,
+			"isProblem":   event.IsProblem,
+			"logLine":     event.LogLine,
+		})
+	}
+	return nil
+}
+
+// forgetRemovedErrorLogTails drops the error log tails of hosts which no longer have an agent
+func forgetRemovedErrorLogTails(agents []agent.Agent) {
+	hostnames := make(map[string]bool)
+	for _, hostAgent := range agents {
+		hostnames[hostAgent.Hostname] = true
+	}
+	errorLogTailsMutex.Lock()
+	defer errorLogTailsMutex.Unlock()
+	for hostname := range errorLogTails {
+		if !hostnames[hostname] {
+			delete(errorLogTails, hostname)
+		}
+	}
+}
+
+// CheckErrorLogs tails the MySQL error logs on the hosts of all agents, and records lines matching ErrorLogPatterns
+// as instance events. It only runs on the leader.
+func CheckErrorLogs() {
+	if !errorLogAlertsEnabled() || !IsLeader() {
+		return
+	}
+	// This function is non re-entrant (it can only be running once at any point in time)
+	if !atomic.CompareAndSwapInt64(&errorLogsCheckEntrance, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt64(&errorLogsCheckEntrance, 0)
+
+	agents, err := agent.ReadAgents()
+	if err != nil {
+		return
+	}
+	forgetRemovedErrorLogTails(agents)
+	var wg sync.WaitGroup
+	for i := range agents {
+		hostAgent := &agents[i]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := checkAgentErrorLog(hostAgent); err != nil {
+				log.Debugf("CheckErrorLogs: %s: %+v", hostAgent.Hostname, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// ContinuousErrorLogChecks tails the MySQL error logs of agents' hosts every ErrorLogPollSeconds
+func ContinuousErrorLogChecks() {
+	for {
+		if errorLogAlertsEnabled() && config.Config.ErrorLogPollSeconds > 0 {
+			CheckErrorLogs()
+			time.Sleep(time.Duration(config.Config.ErrorLogPollSeconds) * time.Second)
+		} else {
+			time.Sleep(time.Minute)
+		}
+	}
+}
+
+// AddErrorLogProblems flags given problem instances whose MySQL error log recently matched a problem pattern, and adds
+// those which are not already listed. Downtimed and ignored instances are not added.
+func AddErrorLogProblems(instances [](*inst.Instance), clusterName string) ([](*inst.Instance), error) {
+	if !errorLogAlertsEnabled() {
+		return instances, nil
+	}
+	errorLogProblems, err := inst.ReadErrorLogProblems()
+	if err != nil || len(errorLogProblems) == 0 {
+		return instances, err
+	}
+	listed := inst.NewInstanceKeyMap()
+	for _, instance := range instances {
+		listed.AddKey(instance.Key)
+	}
+	for instanceKey := range errorLogProblems {
+		if listed.HasKey(instanceKey) {
+			continue
+		}
+		instance, found, err := inst.ReadInstance(&instanceKey)
+		if err != nil {
+			return instances, err
+		}
+		if !found || instance.IsDowntimed || inst.RegexpMatchPatterns(instance.Key.Hostname, config.Config.ProblemIgnoreHostnameFilters) {
+			continue
+		}
+		if clusterName != "" && instance.ClusterName != clusterName {
+			continue
+		}
+		listed.AddKey(instance.Key)
+		instances = append(instances, instance)
+	}
+	for _, instance := range instances {
+		instance.ErrorLogProblems = errorLogProblems[instance.Key]
+	}
+	return instances, nil
+}
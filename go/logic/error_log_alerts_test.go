@@ -0,0 +1,40 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"testing"
+
+	"github.com/github/orchestrator/go/agent"
+	test "github.com/openark/golib/tests"
+)
+
+func TestForgetRemovedErrorLogTails(t *testing.T) {
+	errorLogTails = map[string][]string{
+		"db1": {"line 1"},
+		"db2": {"line 2"},
+	}
+	defer func() { errorLogTails = make(map[string][]string) }()
+
+	forgetRemovedErrorLogTails([]agent.Agent{{Hostname: "db1"}, {Hostname: "db3"}})
+	test.S(t).ExpectEquals(len(errorLogTails), 1)
+	_, found := errorLogTails["db1"]
+	test.S(t).ExpectTrue(found)
+
+	forgetRemovedErrorLogTails(nil)
+	test.S(t).ExpectEquals(len(errorLogTails), 0)
+}
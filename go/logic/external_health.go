@@ -0,0 +1,242 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+	"github.com/patrickmn/go-cache"
+)
+
+// maxExternalHealthResponseLength limits the part of an external health source's response which is recorded
+const maxExternalHealthResponseLength = 1024
+
+// ExternalHealthCheck is the opinion of an external health source on a master suspected by analysis to have failed
+type ExternalHealthCheck struct {
+	Key               inst.InstanceKey
+	Analysis          inst.AnalysisCode
+	Source            string
+	CheckTimestamp    string
+	IsReachable       bool
+	IsHealthy         bool
+	AgreesWithFailure bool
+	Response          string
+}
+
+// isExternalHealthCheckedAnalysis checks whether an analysis is a master failure on which external health sources are consulted
+func isExternalHealthCheckedAnalysis(analysisCode inst.AnalysisCode) bool {
+	switch analysisCode {
+	case inst.DeadMaster, inst.DeadMasterAndSomeSlaves, inst.DeadCoMaster, inst.DeadCoMasterAndSomeSlaves:
+		return true
+	}
+	return false
+}
+
+// getExternalHealthCheckURL returns the URL by which an external health source is queried for given instance
+func getExternalHealthCheckURL(urlTemplate string, instanceKey *inst.InstanceKey) string {
+	url := strings.Replace(urlTemplate, "{host}", instanceKey.Hostname, -1)
+	url = strings.Replace(url, "{port}", fmt.Sprintf("%d", instanceKey.Port), -1)
+	return url
+}
+
+// queryExternalHealthSource queries an external health source for given instance. A source which does
+// not respond is unreachable and has no opinion.
+func queryExternalHealthSource(urlTemplate string, analysisEntry *inst.ReplicationAnalysis) *ExternalHealthCheck {
+	check := &ExternalHealthCheck{
+		Key:            analysisEntry.AnalyzedInstanceKey,
+		Analysis:       analysisEntry.Analysis,
+		Source:         urlTemplate,
+		CheckTimestamp: time.Now().Format("2006-01-02 15:04:05"),
+	}
+	client := &http.Client{Timeout: time.Duration(config.Config.ExternalHealthCheckTimeoutSeconds) * time.Second}
+	response, err := client.Get(getExternalHealthCheckURL(urlTemplate, &analysisEntry.AnalyzedInstanceKey))
+	if err != nil {
+		check.Response = err.Error()
+		return check
+	}
+	defer response.Body.Close()
+	body, _ := ioutil.ReadAll(io.LimitReader(response.Body, maxExternalHealthResponseLength))
+
+	check.IsReachable = true
+	check.IsHealthy = response.StatusCode >= 200 && response.StatusCode < 300
+	check.AgreesWithFailure = !check.IsHealthy
+	check.Response = strings.TrimSpace(fmt.Sprintf("%s %s", response.Status, string(body)))
+	return check
+}
+
+// writeExternalHealthCheck records an external health source's opinion
+func writeExternalHealthCheck(check *ExternalHealthCheck) error {
+	writeFunc := func() error {
+		_, err := db.ExecOrchestrator(`
+			insert into external_health_check (
+				hostname, port, analysis, source, check_timestamp, is_reachable, is_healthy, response
+			) values (
+				?, ?, ?, ?, NOW(), ?, ?, ?
+			)
+			`, check.Key.Hostname, check.Key.Port, string(check.Analysis), check.Source, check.IsReachable, check.IsHealthy, check.Response,
+		)
+		return log.Errore(err)
+	}
+	return inst.ExecDBWriteFunc(writeFunc)
+}
+
+// summarizeExternalHealthChecks describes the opinion of each source, by which a change of opinions is noticed
+func summarizeExternalHealthChecks(checks [](*ExternalHealthCheck)) string {
+	opinions := []string{}
+	for _, check := range checks {
+		opinion := "unreachable"
+		if check.IsReachable && check.IsHealthy {
+			opinion = "healthy"
+		} else if check.IsReachable {
+			opinion = "unhealthy"
+		}
+		opinions = append(opinions, fmt.Sprintf("%s: %s", check.Source, opinion))
+	}
+	return strings.Join(opinions, ", ")
+}
+
+// ConsultExternalHealthSources queries the configured external health sources on a master suspected by analysis to
+// have failed, and records whether each agrees or disagrees with the analysis. Recent opinions are reused, and
+// opinions are only recorded when they change.
+func ConsultExternalHealthSources(analysisEntry *inst.ReplicationAnalysis) (checks [](*ExternalHealthCheck)) {
+	if len(config.Config.ExternalHealthCheckURLs) == 0 || !isExternalHealthCheckedAnalysis(analysisEntry.Analysis) {
+		return checks
+	}
+	cacheKey := fmt.Sprintf("%s/%s", analysisEntry.AnalyzedInstanceKey.StringCode(), string(analysisEntry.Analysis))
+	if cachedChecks, found := externalHealthChecksMap.Get(cacheKey); found {
+		return cachedChecks.([](*ExternalHealthCheck))
+	}
+
+	checks = make([](*ExternalHealthCheck), len(config.Config.ExternalHealthCheckURLs))
+	var wg sync.WaitGroup
+	for i, urlTemplate := range config.Config.ExternalHealthCheckURLs {
+		wg.Add(1)
+		go func(i int, urlTemplate string) {
+			defer wg.Done()
+			checks[i] = queryExternalHealthSource(urlTemplate, analysisEntry)
+		}(i, urlTemplate)
+	}
+	wg.Wait()
+
+	externalHealthChecksMap.Set(cacheKey, checks, cache.DefaultExpiration)
+
+	opinions := summarizeExternalHealthChecks(checks)
+	previousOpinions, found := externalHealthOpinionsMap.Get(cacheKey)
+	externalHealthOpinionsMap.Set(cacheKey, opinions, cache.DefaultExpiration)
+	if found && previousOpinions.(string) == opinions {
+		return checks
+	}
+	countAgree, countDisagree := 0, 0
+	for _, check := range checks {
+		writeExternalHealthCheck(check)
+		if !check.IsReachable {
+			continue
+		}
+		if check.AgreesWithFailure {
+			countAgree++
+		} else {
+			countDisagree++
+		}
+	}
+	inst.AuditOperation("external-health-check", &analysisEntry.AnalyzedInstanceKey, fmt.Sprintf("%+v: %d sources agree, %d disagree, %d unreachable", analysisEntry.Analysis, countAgree, countDisagree, len(checks)-countAgree-countDisagree))
+	return checks
+}
+
+// isExternallyConfirmed checks whether external health sources confirm a failure: at least one
+// source reports the master as unhealthy, and no source reports it as healthy
+func isExternallyConfirmed(checks [](*ExternalHealthCheck)) bool {
+	confirmed := false
+	for _, check := range checks {
+		if !check.IsReachable {
+			continue
+		}
+		if !check.AgreesWithFailure {
+			return false
+		}
+		confirmed = true
+	}
+	return confirmed
+}
+
+// isExternalConfirmationMissing returns true when an automated recovery must not proceed, because
+// external health sources are required to, and do not, confirm the failure
+func isExternalConfirmationMissing(analysisEntry *inst.ReplicationAnalysis) bool {
+	if !config.Config.RequireExternalHealthConfirmation || !isExternalHealthCheckedAnalysis(analysisEntry.Analysis) {
+		return false
+	}
+	return !isExternallyConfirmed(ConsultExternalHealthSources(analysisEntry))
+}
+
+// ReadExternalHealthChecks returns recorded opinions of external health sources, most recent first,
+// optionally only those on given instance
+func ReadExternalHealthChecks(instanceKey *inst.InstanceKey, limit int) (checks []ExternalHealthCheck, err error) {
+	whereCondition := ``
+	args := sqlutils.Args()
+	if instanceKey != nil {
+		whereCondition = `where hostname=? and port=?`
+		args = append(args, instanceKey.Hostname, instanceKey.Port)
+	}
+	args = append(args, limit)
+	query := fmt.Sprintf(`
+		select
+				hostname,
+				port,
+				analysis,
+				source,
+				check_timestamp,
+				is_reachable,
+				is_healthy,
+				response
+			from
+				external_health_check
+			%s
+			order by
+				external_health_check_id desc
+			limit ?
+		`, whereCondition)
+	err = db.QueryOrchestrator(query, args, func(m sqlutils.RowMap) error {
+		check := ExternalHealthCheck{}
+		check.Key.Hostname = m.GetString("hostname")
+		check.Key.Port = m.GetInt("port")
+		check.Analysis = inst.AnalysisCode(m.GetString("analysis"))
+		check.Source = m.GetString("source")
+		check.CheckTimestamp = m.GetString("check_timestamp")
+		check.IsReachable = m.GetBool("is_reachable")
+		check.IsHealthy = m.GetBool("is_healthy")
+		check.AgreesWithFailure = check.IsReachable && !check.IsHealthy
+		check.Response = m.GetString("response")
+		checks = append(checks, check)
+		return nil
+	})
+	return checks, log.Errore(err)
+}
+
+// ExpireExternalHealthChecks removes old rows from the external_health_check table
+func ExpireExternalHealthChecks() error {
+	return inst.ExpireTableData("external_health_check", "check_timestamp")
+}
@@ -0,0 +1,140 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+	"github.com/patrickmn/go-cache"
+)
+
+// withExternalHealthSource serves an external health source, responding with the returned status, for the
+// duration of given test. Recent opinions are not carried over from other tests.
+func withExternalHealthSource(t *testing.T) (*httptest.Server, *int64) {
+	status := int64(http.StatusOK)
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(int(atomic.LoadInt64(&status)))
+	}))
+	t.Cleanup(server.Close)
+
+	urls, timeoutSeconds, requireConfirmation := config.Config.ExternalHealthCheckURLs, config.Config.ExternalHealthCheckTimeoutSeconds, config.Config.RequireExternalHealthConfirmation
+	t.Cleanup(func() {
+		config.Config.ExternalHealthCheckURLs, config.Config.ExternalHealthCheckTimeoutSeconds, config.Config.RequireExternalHealthConfirmation = urls, timeoutSeconds, requireConfirmation
+	})
+	config.Config.ExternalHealthCheckURLs = []string{server.URL + "/health/{host}/{port}"}
+	config.Config.ExternalHealthCheckTimeoutSeconds = 1
+	externalHealthChecksMap = cache.New(time.Second*10, time.Second)
+	externalHealthOpinionsMap = cache.New(time.Hour, time.Minute)
+	return server, &status
+}
+
+func TestGetExternalHealthCheckURL(t *testing.T) {
+	instanceKey := &inst.InstanceKey{Hostname: "db-1", Port: 3306}
+	test.S(t).ExpectEquals(getExternalHealthCheckURL("http://monitoring/health/{host}?port={port}", instanceKey), "http://monitoring/health/db-1?port=3306")
+	test.S(t).ExpectEquals(getExternalHealthCheckURL("http://monitoring/health", instanceKey), "http://monitoring/health")
+}
+
+func TestIsExternallyConfirmed(t *testing.T) {
+	unreachable := &ExternalHealthCheck{}
+	healthy := &ExternalHealthCheck{IsReachable: true, IsHealthy: true}
+	unhealthy := &ExternalHealthCheck{IsReachable: true, AgreesWithFailure: true}
+
+	test.S(t).ExpectFalse(isExternallyConfirmed([](*ExternalHealthCheck){}))
+	test.S(t).ExpectFalse(isExternallyConfirmed([](*ExternalHealthCheck){unreachable}))
+	test.S(t).ExpectTrue(isExternallyConfirmed([](*ExternalHealthCheck){unhealthy}))
+	test.S(t).ExpectTrue(isExternallyConfirmed([](*ExternalHealthCheck){unhealthy, unreachable}))
+	test.S(t).ExpectFalse(isExternallyConfirmed([](*ExternalHealthCheck){unhealthy, healthy}))
+	test.S(t).ExpectFalse(isExternallyConfirmed([](*ExternalHealthCheck){healthy}))
+}
+
+func TestQueryExternalHealthSource(t *testing.T) {
+	server, status := withExternalHealthSource(t)
+	analysisEntry := &inst.ReplicationAnalysis{AnalyzedInstanceKey: inst.InstanceKey{Hostname: "db-1", Port: 3306}, Analysis: inst.DeadMaster}
+	urlTemplate := config.Config.ExternalHealthCheckURLs[0]
+	{
+		check := queryExternalHealthSource(urlTemplate, analysisEntry)
+		test.S(t).ExpectTrue(check.IsReachable)
+		test.S(t).ExpectTrue(check.IsHealthy)
+		test.S(t).ExpectFalse(check.AgreesWithFailure)
+	}
+	{
+		atomic.StoreInt64(status, http.StatusServiceUnavailable)
+		check := queryExternalHealthSource(urlTemplate, analysisEntry)
+		test.S(t).ExpectTrue(check.IsReachable)
+		test.S(t).ExpectFalse(check.IsHealthy)
+		test.S(t).ExpectTrue(check.AgreesWithFailure)
+	}
+	{
+		// A source which does not respond in time has no opinion
+		slowServer := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			time.Sleep(1500 * time.Millisecond)
+		}))
+		defer slowServer.Close()
+		check := queryExternalHealthSource(slowServer.URL, analysisEntry)
+		test.S(t).ExpectFalse(check.IsReachable)
+		test.S(t).ExpectFalse(check.AgreesWithFailure)
+	}
+	{
+		server.Close()
+		check := queryExternalHealthSource(urlTemplate, analysisEntry)
+		test.S(t).ExpectFalse(check.IsReachable)
+	}
+}
+
+func TestConsultExternalHealthSources(t *testing.T) {
+	withSQLiteBackend(t)
+	_, status := withExternalHealthSource(t)
+	instanceKey := inst.InstanceKey{Hostname: "db-1", Port: 3306}
+	analysisEntry := &inst.ReplicationAnalysis{AnalyzedInstanceKey: instanceKey, Analysis: inst.DeadMaster}
+
+	countRecorded := func() int {
+		checks, err := ReadExternalHealthChecks(&instanceKey, 100)
+		test.S(t).ExpectNil(err)
+		return len(checks)
+	}
+
+	// Only master failures are checked
+	test.S(t).ExpectEquals(len(ConsultExternalHealthSources(&inst.ReplicationAnalysis{AnalyzedInstanceKey: instanceKey, Analysis: inst.DeadIntermediateMaster})), 0)
+
+	config.Config.RequireExternalHealthConfirmation = true
+	test.S(t).ExpectTrue(isExternalConfirmationMissing(analysisEntry))
+	test.S(t).ExpectEquals(countRecorded(), 1)
+
+	// An unchanged opinion is not recorded again, even once no longer cached
+	externalHealthChecksMap.Flush()
+	test.S(t).ExpectTrue(isExternalConfirmationMissing(analysisEntry))
+	test.S(t).ExpectEquals(countRecorded(), 1)
+
+	// A changed opinion is recorded
+	atomic.StoreInt64(status, http.StatusServiceUnavailable)
+	externalHealthChecksMap.Flush()
+	test.S(t).ExpectFalse(isExternalConfirmationMissing(analysisEntry))
+	test.S(t).ExpectEquals(countRecorded(), 2)
+
+	config.Config.RequireExternalHealthConfirmation = false
+	atomic.StoreInt64(status, http.StatusOK)
+	externalHealthChecksMap.Flush()
+	test.S(t).ExpectFalse(isExternalConfirmationMissing(analysisEntry))
+	test.S(t).ExpectEquals(countRecorded(), 2)
+}
@@ -0,0 +1,99 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+// failoverImpactEstimateRecoveries is the number of recent recoveries on which promotion time is estimated
+const failoverImpactEstimateRecoveries = 10
+
+// masterFailoverAnalysisCodes are the analyses which lead to master failovers
+var masterFailoverAnalysisCodes = []inst.AnalysisCode{
+	inst.DeadMaster,
+	inst.DeadMasterAndSomeSlaves,
+	inst.DeadCoMaster,
+	inst.DeadCoMasterAndSomeSlaves,
+}
+
+// isMasterFailoverAnalysis returns true for analyses which lead to a master failover
+func isMasterFailoverAnalysis(analysisCode inst.AnalysisCode) bool {
+	for _, code := range masterFailoverAnalysisCodes {
+		if analysisCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// readRecentMasterFailoverSeconds returns the durations of the most recent successful master failovers
+func readRecentMasterFailoverSeconds(limit int) (durations []float64, err error) {
+	query := `
+		select
+			unix_timestamp(end_recovery) - unix_timestamp(start_active_period) as recovery_seconds
+		from
+			topology_recovery
+		where
+			analysis in (?, ?, ?, ?)
+			and is_successful = 1
+			and end_recovery is not null
+		order by
+			recovery_id desc
+		limit ?
+		`
+	args := sqlutils.Args()
+	for _, code := range masterFailoverAnalysisCodes {
+		args = append(args, string(code))
+	}
+	args = append(args, limit)
+	err = db.QueryOrchestrator(query, args, func(m sqlutils.RowMap) error {
+		durations = append(durations, float64(m.GetInt64("recovery_seconds")))
+		return nil
+	})
+	return durations, log.Errore(err)
+}
+
+// EstimateFailoverImpact sets the failover impact estimate of given analysis entry, if it is one which
+// leads to a master failover. The promotion time is estimated as the average duration of recent
+// successful master failovers.
+func EstimateFailoverImpact(analysisEntry *inst.ReplicationAnalysis) error {
+	if !isMasterFailoverAnalysis(analysisEntry.Analysis) {
+		return nil
+	}
+	estimate, err := inst.EstimateFailoverImpact(&analysisEntry.AnalyzedInstanceKey)
+	if err != nil {
+		return err
+	}
+	durations, err := readRecentMasterFailoverSeconds(failoverImpactEstimateRecoveries)
+	if err != nil {
+		return err
+	}
+	if len(durations) > 0 {
+		var total float64
+		for _, duration := range durations {
+			total += duration
+		}
+		estimate.EstimatedPromotionSeconds = total / float64(len(durations))
+		estimate.CountRecoveriesInEstimate = len(durations)
+	}
+	analysisEntry.FailoverImpact = estimate
+	return nil
+}
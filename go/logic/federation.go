@@ -0,0 +1,359 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/github/orchestrator/go/process"
+	"github.com/openark/golib/log"
+)
+
+// FederationDeploymentField is the field by which entries of a federated view are tagged with their deployment
+const FederationDeploymentField = "FederationDeployment"
+
+// federationProxyRoutes are the read-only API routes which may be proxied to a federation peer. A proxied path
+// must match a route in full.
+var federationProxyRoutes = []string{
+	"cluster/:clusterHint",
+	"cluster/alias/:clusterAlias",
+	"cluster/instance/:host/:port",
+	"cluster-info/:clusterHint",
+	"cluster-info/alias/:clusterAlias",
+	"cluster-osc-slaves/:clusterHint",
+	"instance/:host/:port",
+	"instance-replicas/:host/:port",
+	"problems",
+	"problems/:clusterName",
+	"replication-analysis",
+	"replication-analysis/:clusterName",
+	"replication-analysis/instance/:host/:port",
+	"audit-recovery",
+	"audit-recovery/:page",
+	"audit-recovery/alias/:clusterAlias",
+	"audit-recovery/cluster/:clusterName",
+	"audit-recovery/cluster/:clusterName/:page",
+	"audit-recovery/id/:id",
+	"audit-recovery/uid/:uid",
+	"audit-failure-detection",
+	"audit-failure-detection/:page",
+	"audit-failure-detection/alias/:clusterAlias",
+	"audit-failure-detection/id/:id",
+	"downtimed",
+	"downtimed/:clusterHint",
+	"recovery-stats/:clusterHint",
+	"recovery-approvals",
+	"recovery-approvals/:clusterHint",
+	"blocked-recoveries",
+	"blocked-recoveries/cluster/:clusterName",
+	"master/:clusterHint",
+	"cluster-pool-instances/:clusterName",
+	"cluster-pool-instances/:clusterName/:pool",
+	"active-cluster-recovery/:clusterName",
+}
+
+// federationProxySegmentRegexp is what a segment of a proxied path may consist of: no percent-encoding, no
+// separators or special characters
+var federationProxySegmentRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.:@=~+-]+$`)
+
+// FederationProxyRoute is an API call which may be proxied to a federation peer, having matched one of
+// federationProxyRoutes
+type FederationProxyRoute struct {
+	Route  string
+	Path   string
+	Query  string
+	Params map[string]string
+}
+
+// String returns the API call, as requested of the peer
+func (this *FederationProxyRoute) String() string {
+	if this.Query == "" {
+		return this.Path
+	}
+	return fmt.Sprintf("%s?%s", this.Path, this.Query)
+}
+
+// ClusterHint returns the cluster the API call is scoped to, or an empty string when it is not scoped to a cluster
+func (this *FederationProxyRoute) ClusterHint() string {
+	for _, param := range []string{"clusterHint", "clusterName", "clusterAlias"} {
+		if clusterHint := this.Params[param]; clusterHint != "" {
+			return clusterHint
+		}
+	}
+	return ""
+}
+
+// matchFederationProxyRoute matches path segments against a route, returning the route's params
+func matchFederationProxyRoute(route string, segments []string) (params map[string]string, matched bool) {
+	routeSegments := strings.Split(route, "/")
+	if len(routeSegments) != len(segments) {
+		return nil, false
+	}
+	params = map[string]string{}
+	for i, routeSegment := range routeSegments {
+		if strings.HasPrefix(routeSegment, ":") {
+			params[strings.TrimPrefix(routeSegment, ":")] = segments[i]
+		} else if routeSegment != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// ParseFederationProxyPath validates an API call to be proxied to a federation peer. The path must be in canonical
+// form, must not contain percent-encoded or dot segments, and must match a read-only route in full.
+func ParseFederationProxyPath(apiPath string) (*FederationProxyRoute, error) {
+	requestPath, query := apiPath, ""
+	if i := strings.Index(apiPath, "?"); i >= 0 {
+		requestPath, query = apiPath[:i], apiPath[i+1:]
+	}
+	requestPath = strings.TrimPrefix(requestPath, "/")
+	if requestPath == "" || path.Clean(requestPath) != requestPath {
+		return nil, fmt.Errorf("API call cannot be proxied to federation peers: %s is not a canonical path", requestPath)
+	}
+	segments := strings.Split(requestPath, "/")
+	for _, segment := range segments {
+		if segment == "." || segment == ".." || !federationProxySegmentRegexp.MatchString(segment) {
+			return nil, fmt.Errorf("API call cannot be proxied to federation peers: invalid path segment %q", segment)
+		}
+	}
+	for _, route := range federationProxyRoutes {
+		if params, matched := matchFederationProxyRoute(route, segments); matched {
+			return &FederationProxyRoute{Route: route, Path: requestPath, Query: query, Params: params}, nil
+		}
+	}
+	return nil, fmt.Errorf("API call cannot be proxied to federation peers: %s", requestPath)
+}
+
+// FederationDeploymentStatus is the outcome of reading a federated view from a single deployment
+type FederationDeploymentStatus struct {
+	Deployment    string
+	URL           string
+	IsLocal       bool
+	CountEntries  int
+	LatencyMillis int64
+	Error         string
+}
+
+// FederatedView is a read-only view of an API resource merged across federated deployments. Each entry is tagged
+// with its deployment, under FederationDeploymentField.
+type FederatedView struct {
+	Entries     []map[string]interface{}
+	Deployments []FederationDeploymentStatus
+}
+
+// IsFederationEnabled returns true when peer deployments are configured
+func IsFederationEnabled() bool {
+	return len(config.Config.FederationPeers) > 0
+}
+
+// GetFederationDeploymentName returns the name of this deployment in the federation view
+func GetFederationDeploymentName() string {
+	if config.Config.FederationDeploymentName != "" {
+		return config.Config.FederationDeploymentName
+	}
+	return process.ThisHostname
+}
+
+// tagFederatedEntries converts given entries, as marshalled to JSON, into generic entries tagged by deployment
+func tagFederatedEntries(deployment string, entriesJSON []byte) (entries []map[string]interface{}, err error) {
+	entries = []map[string]interface{}{}
+	if err := json.Unmarshal(entriesJSON, &entries); err != nil {
+		return entries, err
+	}
+	for _, entry := range entries {
+		entry[FederationDeploymentField] = deployment
+	}
+	return entries, nil
+}
+
+// getFederationPeer issues a GET request to an API call of a federation peer, returning the response body
+func getFederationPeer(deployment string, apiPath string) (statusCode int, contentType string, body []byte, err error) {
+	peerURL, ok := config.Config.FederationPeers[deployment]
+	if !ok {
+		return 0, "", nil, fmt.Errorf("Unknown federation deployment: %s", deployment)
+	}
+	request, err := http.NewRequest("GET", fmt.Sprintf("%s/api/%s", strings.TrimRight(peerURL, "/"), strings.TrimPrefix(apiPath, "/")), nil)
+	if err != nil {
+		return 0, "", nil, err
+	}
+	if config.Config.FederationAPIToken != "" {
+		request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", config.Config.FederationAPIToken))
+	} else if config.Config.HTTPAuthUser != "" {
+		request.SetBasicAuth(config.Config.HTTPAuthUser, config.Config.HTTPAuthPassword)
+	}
+	client := &http.Client{Timeout: time.Duration(config.Config.FederationRequestTimeoutSeconds) * time.Second}
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, "", nil, err
+	}
+	defer response.Body.Close()
+	body, err = ioutil.ReadAll(response.Body)
+	return response.StatusCode, response.Header.Get("Content-Type"), body, err
+}
+
+// readFederationPeerEntries reads an API call listing entries from a federation peer
+func readFederationPeerEntries(deployment string, apiPath string) (entries []map[string]interface{}, err error) {
+	statusCode, _, body, err := getFederationPeer(deployment, apiPath)
+	if err != nil {
+		return entries, err
+	}
+	if statusCode != http.StatusOK {
+		return entries, fmt.Errorf("%s responded with %d status", deployment, statusCode)
+	}
+	return tagFederatedEntries(deployment, body)
+}
+
+// ReadFederatedView merges the entries of a listing API call across this deployment and its federation peers.
+// localEntries are this deployment's entries. Peers are queried concurrently; a peer which fails to respond is
+// reported in the view's deployments, and does not fail the view.
+func ReadFederatedView(apiPath string, localEntries interface{}) (*FederatedView, error) {
+	localJSON, err := json.Marshal(localEntries)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := tagFederatedEntries(GetFederationDeploymentName(), localJSON)
+	if err != nil {
+		return nil, err
+	}
+	view := &FederatedView{
+		Entries: entries,
+		Deployments: []FederationDeploymentStatus{
+			{Deployment: GetFederationDeploymentName(), IsLocal: true, CountEntries: len(entries)},
+		},
+	}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for deployment, peerURL := range config.Config.FederationPeers {
+		wg.Add(1)
+		go func(deployment string, peerURL string) {
+			defer wg.Done()
+			startTime := time.Now()
+			peerEntries, err := readFederationPeerEntries(deployment, apiPath)
+			status := FederationDeploymentStatus{
+				Deployment:    deployment,
+				URL:           peerURL,
+				CountEntries:  len(peerEntries),
+				LatencyMillis: time.Since(startTime).Nanoseconds() / int64(time.Millisecond),
+			}
+			if err != nil {
+				log.Warningf("ReadFederatedView: %s from %s: %+v", apiPath, deployment, err)
+				status.Error = err.Error()
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			view.Entries = append(view.Entries, peerEntries...)
+			view.Deployments = append(view.Deployments, status)
+		}(deployment, peerURL)
+	}
+	wg.Wait()
+	sort.SliceStable(view.Deployments[1:], func(i, j int) bool {
+		return view.Deployments[1+i].Deployment < view.Deployments[1+j].Deployment
+	})
+	return view, nil
+}
+
+// FindFederatedClusterDeployment finds the peer deployment owning given cluster, by cluster name or alias, in a
+// federated view of clusters info
+func FindFederatedClusterDeployment(clustersView *FederatedView, clusterHint string) (deployment string, found bool) {
+	for _, entry := range clustersView.Entries {
+		if entry["ClusterName"] == clusterHint || entry["ClusterAlias"] == clusterHint {
+			deployment, _ = entry[FederationDeploymentField].(string)
+			return deployment, true
+		}
+	}
+	return "", false
+}
+
+// ReadFederationPeerClustersInfo reads the clusters of a federation peer
+func ReadFederationPeerClustersInfo(deployment string) (clustersInfo []inst.ClusterInfo, err error) {
+	statusCode, _, body, err := getFederationPeer(deployment, "clusters-info")
+	if err != nil {
+		return clustersInfo, err
+	}
+	if statusCode != http.StatusOK {
+		return clustersInfo, fmt.Errorf("%s responded with %d status", deployment, statusCode)
+	}
+	err = json.Unmarshal(body, &clustersInfo)
+	return clustersInfo, err
+}
+
+// ReadFederationRouteCluster resolves the cluster, on given federation peer, which a proxied API call operates on.
+// A nil result means the call is not scoped to a cluster.
+func ReadFederationRouteCluster(deployment string, route *FederationProxyRoute) (*inst.ClusterInfo, error) {
+	if clusterHint := route.ClusterHint(); clusterHint != "" {
+		clustersInfo, err := ReadFederationPeerClustersInfo(deployment)
+		if err != nil {
+			return nil, err
+		}
+		for _, clusterInfo := range clustersInfo {
+			if clusterInfo.ClusterName == clusterHint || clusterInfo.ClusterAlias == clusterHint {
+				return &inst.ClusterInfo{ClusterName: clusterInfo.ClusterName, ClusterAlias: clusterInfo.ClusterAlias}, nil
+			}
+		}
+		return nil, fmt.Errorf("Cluster not found in %s: %s", deployment, clusterHint)
+	}
+	if route.Params["host"] != "" && route.Params["port"] != "" {
+		statusCode, _, body, err := getFederationPeer(deployment, fmt.Sprintf("instance/%s/%s", route.Params["host"], route.Params["port"]))
+		if err != nil {
+			return nil, err
+		}
+		if statusCode != http.StatusOK {
+			return nil, fmt.Errorf("%s responded with %d status", deployment, statusCode)
+		}
+		instance := struct {
+			ClusterName           string
+			SuggestedClusterAlias string
+		}{}
+		if err := json.Unmarshal(body, &instance); err != nil {
+			return nil, err
+		}
+		return &inst.ClusterInfo{ClusterName: instance.ClusterName, ClusterAlias: instance.SuggestedClusterAlias}, nil
+	}
+	return nil, nil
+}
+
+// FederatedEntryClusterInfo returns the cluster of a federated view entry, as identified by the entry's cluster name
+// and alias
+func FederatedEntryClusterInfo(entry map[string]interface{}) inst.ClusterInfo {
+	clusterInfo := inst.ClusterInfo{}
+	clusterInfo.ClusterName, _ = entry["ClusterName"].(string)
+	clusterInfo.ClusterAlias, _ = entry["ClusterAlias"].(string)
+	if clusterInfo.ClusterAlias == "" {
+		clusterInfo.ClusterAlias, _ = entry["SuggestedClusterAlias"].(string)
+	}
+	return clusterInfo
+}
+
+// ProxyFederationRequest proxies a read-only API call, as validated by ParseFederationProxyPath, to the federation
+// peer owning the data
+func ProxyFederationRequest(deployment string, route *FederationProxyRoute) (statusCode int, contentType string, body []byte, err error) {
+	return getFederationPeer(deployment, route.String())
+}
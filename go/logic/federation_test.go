@@ -0,0 +1,134 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/github/orchestrator/go/config"
+	test "github.com/openark/golib/tests"
+)
+
+func TestParseFederationProxyPath(t *testing.T) {
+	{
+		route, err := ParseFederationProxyPath("instance/db-7.eu-west/3306")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(route.Route, "instance/:host/:port")
+		test.S(t).ExpectEquals(route.Params["host"], "db-7.eu-west")
+		test.S(t).ExpectEquals(route.Params["port"], "3306")
+		test.S(t).ExpectEquals(route.ClusterHint(), "")
+		test.S(t).ExpectEquals(route.String(), "instance/db-7.eu-west/3306")
+	}
+	{
+		route, err := ParseFederationProxyPath("/audit-recovery/cluster/db-1:3306/2?reverse=true")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(route.Route, "audit-recovery/cluster/:clusterName/:page")
+		test.S(t).ExpectEquals(route.ClusterHint(), "db-1:3306")
+		test.S(t).ExpectEquals(route.String(), "audit-recovery/cluster/db-1:3306/2?reverse=true")
+	}
+	{
+		route, err := ParseFederationProxyPath("cluster/alias/shop")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(route.ClusterHint(), "shop")
+	}
+	for _, apiPath := range []string{
+		"",
+		"instance",
+		"instance/db-7/3306/extra",
+		"instance/db-7/../../relocate/db-7/3306/db-8/3306",
+		"instance/../relocate/db-7/3306",
+		"instance/%2e%2e/3306",
+		"instance/db-7%2F/3306",
+		"instance//3306",
+		"instance/./3306",
+		"cluster/instance/db-7/3306/",
+		"relocate/db-7/3306/db-8/3306",
+		"disable-global-recoveries",
+		"problems/a b",
+	} {
+		_, err := ParseFederationProxyPath(apiPath)
+		test.S(t).ExpectNotNil(err)
+	}
+}
+
+func TestFederatedEntryClusterInfo(t *testing.T) {
+	clusterInfo := FederatedEntryClusterInfo(map[string]interface{}{"ClusterName": "db-1:3306", "ClusterAlias": "shop"})
+	test.S(t).ExpectEquals(clusterInfo.ClusterName, "db-1:3306")
+	test.S(t).ExpectEquals(clusterInfo.ClusterAlias, "shop")
+
+	clusterInfo = FederatedEntryClusterInfo(map[string]interface{}{"ClusterName": "db-1:3306", "SuggestedClusterAlias": "shop"})
+	test.S(t).ExpectEquals(clusterInfo.ClusterAlias, "shop")
+}
+
+func TestReadFederationRouteCluster(t *testing.T) {
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/api/clusters-info":
+			fmt.Fprint(w, `[{"ClusterName": "db-1:3306", "ClusterAlias": "shop"}]`)
+		case "/api/instance/db-2/3306":
+			fmt.Fprint(w, `{"ClusterName": "db-1:3306", "SuggestedClusterAlias": "shop"}`)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer peer.Close()
+
+	federationPeers := config.Config.FederationPeers
+	defer func() { config.Config.FederationPeers = federationPeers }()
+	config.Config.FederationPeers = map[string]string{"eu-west": peer.URL}
+
+	readRouteCluster := func(apiPath string) (string, error) {
+		route, err := ParseFederationProxyPath(apiPath)
+		test.S(t).ExpectNil(err)
+		clusterInfo, err := ReadFederationRouteCluster("eu-west", route)
+		if clusterInfo == nil {
+			return "", err
+		}
+		return clusterInfo.ClusterAlias, err
+	}
+	{
+		alias, err := readRouteCluster("cluster/alias/shop")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(alias, "shop")
+	}
+	{
+		alias, err := readRouteCluster("problems/db-1:3306")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(alias, "shop")
+	}
+	{
+		alias, err := readRouteCluster("instance-replicas/db-2/3306")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(alias, "shop")
+	}
+	{
+		_, err := readRouteCluster("cluster/alias/books")
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		_, err := readRouteCluster("instance/db-3/3306")
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		alias, err := readRouteCluster("problems")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(alias, "")
+	}
+}
@@ -0,0 +1,224 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/github/orchestrator/go/kv"
+	"github.com/github/orchestrator/go/os"
+	"github.com/miekg/dns"
+)
+
+// defaultHookActionTimeout applies to hook actions whose hook configuration has no timeout
+const defaultHookActionTimeout = 30 * time.Second
+
+// maxHookActionResponseLength limits the part of an http action's response which is kept as its output
+const maxHookActionResponseLength = 1024
+
+// defaultDNSHookActionTTL applies to records of dns actions with no RecordTTL
+const defaultDNSHookActionTTL = 60
+
+// dnsTSIGFudgeSeconds is the time skew allowed between orchestrator and the DNS server on signed updates
+const dnsTSIGFudgeSeconds = 300
+
+// hookActionName returns the name of the built-in action a hooks list entry refers to, if any
+func hookActionName(hook string) (actionName string, isAction bool) {
+	if !strings.HasPrefix(hook, config.HookActionPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(hook, config.HookActionPrefix), true
+}
+
+// executeHookAction runs a built-in hook action, with placeholders replaced by given function.
+// The returned result describes the outcome as a command's output would.
+func executeHookAction(actionName string, timeout time.Duration, placeholders func(text string) string) (*os.CommandResult, error) {
+	hookAction, ok := config.Config.HookActions[actionName]
+	if !ok {
+		return nil, fmt.Errorf("Unknown hook action: %s", actionName)
+	}
+	if timeout == 0 {
+		timeout = defaultHookActionTimeout
+	}
+	var output string
+	var err error
+	switch hookAction.Type {
+	case "http":
+		output, err = executeHTTPHookAction(&hookAction, placeholders, timeout)
+	case "consul":
+		key, value := placeholders(hookAction.Key), placeholders(hookAction.Value)
+		if err = kv.PutConsulKeyValue(key, value); err == nil {
+			output = fmt.Sprintf("consul: %s=%s", key, value)
+		}
+	case "dns":
+		output, err = executeDNSHookAction(&hookAction, placeholders, timeout)
+	case "mysql":
+		output, err = executeMySQLHookAction(&hookAction, placeholders)
+	default:
+		err = fmt.Errorf("Unknown hook action type: %s", hookAction.Type)
+	}
+	cmdResult := &os.CommandResult{Stdout: output}
+	if err != nil {
+		cmdResult.Stderr = err.Error()
+		cmdResult.ExitCode = 1
+	}
+	return cmdResult, err
+}
+
+// executeHTTPHookAction makes an HTTP request, expecting a 2xx response
+func executeHTTPHookAction(hookAction *config.HookAction, placeholders func(string) string, timeout time.Duration) (output string, err error) {
+	method := hookAction.Method
+	if method == "" {
+		method = "POST"
+	}
+	request, err := http.NewRequest(method, placeholders(hookAction.URL), strings.NewReader(placeholders(hookAction.Body)))
+	if err != nil {
+		return output, err
+	}
+	for name, value := range hookAction.Headers {
+		request.Header.Set(name, placeholders(value))
+	}
+	client := &http.Client{Timeout: timeout}
+	response, err := client.Do(request)
+	if err != nil {
+		return output, err
+	}
+	defer response.Body.Close()
+	responseBody, _ := ioutil.ReadAll(io.LimitReader(response.Body, maxHookActionResponseLength))
+	output = fmt.Sprintf("%s %s: %s %s", method, request.URL.String(), response.Status, strings.TrimSpace(string(responseBody)))
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return output, fmt.Errorf("%s %s responded with %s", method, request.URL.String(), response.Status)
+	}
+	return output, nil
+}
+
+// executeMySQLHookAction runs a statement on a MySQL server, using the topology credentials
+func executeMySQLHookAction(hookAction *config.HookAction, placeholders func(string) string) (output string, err error) {
+	port, err := strconv.Atoi(placeholders(hookAction.Port))
+	if err != nil {
+		return output, fmt.Errorf("mysql action: invalid port: %s", placeholders(hookAction.Port))
+	}
+	instanceKey := inst.InstanceKey{Hostname: placeholders(hookAction.Host), Port: port}
+	query := placeholders(hookAction.Query)
+	sqlResult, err := inst.ExecInstance(&instanceKey, query)
+	if err != nil {
+		return output, err
+	}
+	rowsAffected, _ := sqlResult.RowsAffected()
+	return fmt.Sprintf("%+v: %s; rows affected: %d", instanceKey, query, rowsAffected), nil
+}
+
+// dnsHookActionRecord returns the record a dns action publishes, with placeholders replaced by given function.
+// A host name given for an A record is resolved to its IPv4 address.
+func dnsHookActionRecord(hookAction *config.HookAction, placeholders func(string) string) (dns.RR, error) {
+	header := dns.RR_Header{
+		Name:   dns.Fqdn(placeholders(hookAction.RecordName)),
+		Class:  dns.ClassINET,
+		Ttl:    uint32(hookAction.RecordTTL),
+		Rrtype: dns.TypeA,
+	}
+	if header.Ttl == 0 {
+		header.Ttl = defaultDNSHookActionTTL
+	}
+	value := strings.TrimSuffix(placeholders(hookAction.RecordValue), ".")
+	if hookAction.RecordType == "CNAME" {
+		header.Rrtype = dns.TypeCNAME
+		return &dns.CNAME{Hdr: header, Target: dns.Fqdn(value)}, nil
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		ips, err := net.LookupIP(value)
+		if err != nil {
+			return nil, err
+		}
+		for _, resolvedIP := range ips {
+			if resolvedIP.To4() != nil {
+				ip = resolvedIP
+				break
+			}
+		}
+	}
+	if ip == nil || ip.To4() == nil {
+		return nil, fmt.Errorf("dns action: no IPv4 address for %s", value)
+	}
+	return &dns.A{Hdr: header, A: ip.To4()}, nil
+}
+
+// newDNSHookActionClient returns a client for a dns action's server, signing messages with the action's TSIG key,
+// if any
+func newDNSHookActionClient(hookAction *config.HookAction, timeout time.Duration) (client *dns.Client, server string) {
+	client = &dns.Client{Net: hookAction.DNSNet, Timeout: timeout}
+	if hookAction.TSIGKeyName != "" {
+		client.TsigSecret = map[string]string{dnsTSIGKeyName(hookAction): hookAction.TSIGSecret}
+	}
+	server = hookAction.DNSServer
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	return client, server
+}
+
+// dnsTSIGKeyName returns the canonical name of a dns action's TSIG key
+func dnsTSIGKeyName(hookAction *config.HookAction) string {
+	return strings.ToLower(dns.Fqdn(hookAction.TSIGKeyName))
+}
+
+// signDNSHookActionMessage signs given message with the action's TSIG key, if any
+func signDNSHookActionMessage(message *dns.Msg, hookAction *config.HookAction) {
+	if hookAction.TSIGKeyName == "" {
+		return
+	}
+	algorithm := hookAction.TSIGAlgorithm
+	if algorithm == "" {
+		algorithm = "hmac-sha256"
+	}
+	message.SetTsig(dnsTSIGKeyName(hookAction), dns.Fqdn(algorithm), dnsTSIGFudgeSeconds, time.Now().Unix())
+}
+
+// executeDNSHookAction replaces a DNS record via an RFC 2136 dynamic update, over UDP or TCP, optionally
+// signed with a TSIG key
+func executeDNSHookAction(hookAction *config.HookAction, placeholders func(string) string, timeout time.Duration) (output string, err error) {
+	record, err := dnsHookActionRecord(hookAction, placeholders)
+	if err != nil {
+		return output, err
+	}
+	message := new(dns.Msg)
+	message.SetUpdate(dns.Fqdn(placeholders(hookAction.Zone)))
+	message.RemoveRRset([]dns.RR{record})
+	message.Insert([]dns.RR{record})
+	signDNSHookActionMessage(message, hookAction)
+
+	client, server := newDNSHookActionClient(hookAction, timeout)
+	output = fmt.Sprintf("dns: %s via %s", record.String(), server)
+	response, _, err := client.Exchange(message, server)
+	if err != nil {
+		return output, err
+	}
+	if response.Rcode != dns.RcodeSuccess {
+		return output, fmt.Errorf("dns action: %s responded with %s", server, dns.RcodeToString[response.Rcode])
+	}
+	return output, nil
+}
@@ -0,0 +1,280 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/miekg/dns"
+	test "github.com/openark/golib/tests"
+)
+
+// testDNSTSIGSecret is the base64 encoded TSIG secret of test DNS servers
+const testDNSTSIGSecret = "c2VjcmV0LXNlY3JldC1zZWNyZXQtc2VjcmV0LXNlY3JldA=="
+
+// testDNSServer is an authoritative DNS server accepting dynamic updates signed with the "orchestrator." key, and
+// answering queries off the updated records
+type testDNSServer struct {
+	sync.Mutex
+	address string
+	updates []*dns.Msg
+	records map[string]dns.RR
+}
+
+// newTestDNSServer starts a DNS server on given network ("udp" or "tcp") for the duration of given test
+func newTestDNSServer(t *testing.T, network string) *testDNSServer {
+	testServer := &testDNSServer{records: map[string]dns.RR{}}
+	server := &dns.Server{
+		Handler:    dns.HandlerFunc(testServer.serveDNS),
+		TsigSecret: map[string]string{"orchestrator.": testDNSTSIGSecret},
+	}
+	if network == "tcp" {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		test.S(t).ExpectNil(err)
+		server.Listener = listener
+		testServer.address = listener.Addr().String()
+	} else {
+		packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		test.S(t).ExpectNil(err)
+		server.PacketConn = packetConn
+		testServer.address = packetConn.LocalAddr().String()
+	}
+	started := make(chan struct{})
+	server.NotifyStartedFunc = func() { close(started) }
+	go server.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { server.Shutdown() })
+	return testServer
+}
+
+func (this *testDNSServer) serveDNS(w dns.ResponseWriter, request *dns.Msg) {
+	this.Lock()
+	defer this.Unlock()
+
+	response := new(dns.Msg)
+	response.SetReply(request)
+	if request.Opcode == dns.OpcodeUpdate {
+		if request.IsTsig() == nil || w.TsigStatus() != nil {
+			response.Rcode = dns.RcodeRefused
+		} else {
+			this.updates = append(this.updates, request)
+			for _, record := range request.Ns {
+				if record.Header().Class == dns.ClassINET {
+					this.records[record.Header().Name] = record
+				}
+			}
+		}
+	} else if record, ok := this.records[request.Question[0].Name]; ok {
+		response.Answer = append(response.Answer, record)
+	}
+	if tsig := request.IsTsig(); tsig != nil {
+		response.SetTsig(tsig.Hdr.Name, tsig.Algorithm, 300, time.Now().Unix())
+	}
+	w.WriteMsg(response)
+}
+
+// setRecord publishes given record, or removes the record of given name, given nil
+func (this *testDNSServer) setRecord(name string, record dns.RR) {
+	this.Lock()
+	defer this.Unlock()
+	if record == nil {
+		delete(this.records, name)
+		return
+	}
+	this.records[name] = record
+}
+
+// update returns the i-th update the server accepted
+func (this *testDNSServer) update(i int) *dns.Msg {
+	this.Lock()
+	defer this.Unlock()
+	return this.updates[i]
+}
+
+func (this *testDNSServer) countUpdates() int {
+	this.Lock()
+	defer this.Unlock()
+	return len(this.updates)
+}
+
+// withHookActions sets up given hook actions for the duration of given test
+func withHookActions(t *testing.T, hookActions map[string]config.HookAction) {
+	previousHookActions := config.Config.HookActions
+	config.Config.HookActions = hookActions
+	t.Cleanup(func() { config.Config.HookActions = previousHookActions })
+}
+
+func TestHookActionName(t *testing.T) {
+	actionName, isAction := hookActionName("action:notify")
+	test.S(t).ExpectTrue(isAction)
+	test.S(t).ExpectEquals(actionName, "notify")
+
+	_, isAction = hookActionName("echo action:notify")
+	test.S(t).ExpectFalse(isAction)
+}
+
+func TestExecuteHTTPHookAction(t *testing.T) {
+	var method, path, contentType, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestBody, _ := ioutil.ReadAll(r.Body)
+		method, path, contentType, body = r.Method, r.URL.Path, r.Header.Get("Content-Type"), string(requestBody)
+		if strings.HasSuffix(r.URL.Path, "/fail") {
+			http.Error(w, "rejected", http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(strings.Repeat("x", 2*maxHookActionResponseLength)))
+	}))
+	defer server.Close()
+	withHookActions(t, map[string]config.HookAction{
+		"notify": {
+			Type:    "http",
+			URL:     server.URL + "/{failureClusterAlias}",
+			Headers: map[string]string{"Content-Type": "application/json"},
+			Body:    `{"master": "{successorHost}"}`,
+		},
+		"fail": {Type: "http", Method: "PUT", URL: server.URL + "/fail"},
+	})
+	placeholders := func(text string) string {
+		return strings.NewReplacer("{failureClusterAlias}", "orders", "{successorHost}", "db-2").Replace(text)
+	}
+
+	cmdResult, err := executeHookAction("notify", 0, placeholders)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(cmdResult.ExitCode, 0)
+	test.S(t).ExpectEquals(method, "POST")
+	test.S(t).ExpectEquals(path, "/orders")
+	test.S(t).ExpectEquals(contentType, "application/json")
+	test.S(t).ExpectEquals(body, `{"master": "db-2"}`)
+	// the response is kept up to a limit
+	test.S(t).ExpectTrue(strings.Contains(cmdResult.Stdout, "200 OK"))
+	test.S(t).ExpectTrue(len(cmdResult.Stdout) < 2*maxHookActionResponseLength)
+
+	cmdResult, err = executeHookAction("fail", time.Second, placeholders)
+	test.S(t).ExpectNotNil(err)
+	test.S(t).ExpectEquals(method, "PUT")
+	test.S(t).ExpectEquals(cmdResult.ExitCode, 1)
+	test.S(t).ExpectTrue(strings.Contains(cmdResult.Stdout, "rejected"))
+	test.S(t).ExpectTrue(strings.Contains(cmdResult.Stderr, "502"))
+}
+
+func TestExecuteHTTPHookActionTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Second)
+	}))
+	defer server.Close()
+	withHookActions(t, map[string]config.HookAction{
+		"notify": {Type: "http", URL: server.URL},
+	})
+
+	_, err := executeHookAction("notify", 100*time.Millisecond, func(text string) string { return text })
+	test.S(t).ExpectNotNil(err)
+}
+
+func TestExecuteDNSHookAction(t *testing.T) {
+	for _, network := range []string{"udp", "tcp"} {
+		server := newTestDNSServer(t, network)
+		dnsAction := config.HookAction{
+			Type:        "dns",
+			DNSServer:   server.address,
+			DNSNet:      network,
+			Zone:        "db.example.com",
+			RecordName:  "{failureClusterAlias}-master.db.example.com",
+			RecordValue: "{successorHost}",
+			TSIGKeyName: "orchestrator",
+			TSIGSecret:  testDNSTSIGSecret,
+		}
+		cnameAction := dnsAction
+		cnameAction.RecordType, cnameAction.RecordTTL = "CNAME", 300
+		unsignedAction := dnsAction
+		unsignedAction.RecordValue, unsignedAction.TSIGKeyName, unsignedAction.TSIGSecret = "10.0.0.3", "", ""
+		withHookActions(t, map[string]config.HookAction{"update-dns": dnsAction, "update-cname": cnameAction, "unsigned": unsignedAction})
+
+		placeholders := func(text string) string {
+			return strings.NewReplacer("{failureClusterAlias}", "orders", "{successorHost}", "10.0.0.2").Replace(text)
+		}
+		cmdResult, err := executeHookAction("update-dns", time.Second, placeholders)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(cmdResult.ExitCode, 0)
+		test.S(t).ExpectTrue(strings.Contains(cmdResult.Stdout, "orders-master.db.example.com."))
+		test.S(t).ExpectEquals(server.countUpdates(), 1)
+		// the update replaces the name's A records with the successor's
+		update := server.update(0)
+		test.S(t).ExpectEquals(update.Question[0].Name, "db.example.com.")
+		test.S(t).ExpectEquals(len(update.Ns), 2)
+		test.S(t).ExpectEquals(update.Ns[0].Header().Class, uint16(dns.ClassANY))
+		test.S(t).ExpectEquals(update.Ns[0].Header().Rrtype, dns.TypeA)
+		test.S(t).ExpectEquals(update.Ns[1].(*dns.A).A.String(), "10.0.0.2")
+		test.S(t).ExpectEquals(update.Ns[1].Header().Ttl, uint32(defaultDNSHookActionTTL))
+
+		placeholders = func(text string) string {
+			return strings.NewReplacer("{failureClusterAlias}", "orders", "{successorHost}", "db-2.example.com").Replace(text)
+		}
+		_, err = executeHookAction("update-cname", time.Second, placeholders)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(server.countUpdates(), 2)
+		test.S(t).ExpectEquals(server.update(1).Ns[1].(*dns.CNAME).Target, "db-2.example.com.")
+		test.S(t).ExpectEquals(server.update(1).Ns[1].Header().Ttl, uint32(300))
+
+		// the server refuses unsigned updates
+		cmdResult, err = executeHookAction("unsigned", time.Second, strings.NewReplacer("{failureClusterAlias}", "orders").Replace)
+		test.S(t).ExpectNotNil(err)
+		test.S(t).ExpectEquals(cmdResult.ExitCode, 1)
+		test.S(t).ExpectTrue(strings.Contains(err.Error(), "REFUSED"))
+		test.S(t).ExpectEquals(server.countUpdates(), 2)
+	}
+}
+
+func TestExecuteDNSHookActionWrongTSIGSecret(t *testing.T) {
+	server := newTestDNSServer(t, "tcp")
+	withHookActions(t, map[string]config.HookAction{
+		"update-dns": {
+			Type:        "dns",
+			DNSServer:   server.address,
+			DNSNet:      "tcp",
+			Zone:        "db.example.com",
+			RecordName:  "orders-master.db.example.com",
+			RecordValue: "10.0.0.2",
+			TSIGKeyName: "orchestrator",
+			TSIGSecret:  "d3Jvbmctc2VjcmV0",
+		},
+	})
+
+	_, err := executeHookAction("update-dns", time.Second, func(text string) string { return text })
+	test.S(t).ExpectNotNil(err)
+	test.S(t).ExpectEquals(server.countUpdates(), 0)
+}
+
+func TestExecuteUnknownHookAction(t *testing.T) {
+	withHookActions(t, map[string]config.HookAction{
+		"send-sms": {Type: "sms"},
+	})
+	placeholders := func(text string) string { return text }
+
+	_, err := executeHookAction("notify", 0, placeholders)
+	test.S(t).ExpectNotNil(err)
+	cmdResult, err := executeHookAction("send-sms", 0, placeholders)
+	test.S(t).ExpectNotNil(err)
+	test.S(t).ExpectEquals(cmdResult.ExitCode, 1)
+}
@@ -0,0 +1,299 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"time"
+
+	"github.com/github/orchestrator/go/inst"
+	"github.com/github/orchestrator/go/process"
+)
+
+// HookPayloadVersion is the version of the JSON payload passed to hooks configured with JSONPayload. Fields may be
+// added within a version; the version changes whenever a field is removed or changes meaning. Version 1 is the
+// environment variables and placeholders payload.
+const HookPayloadVersion = 2
+
+// HookPayloadNote is a note attached to an instance or a cluster
+type HookPayloadNote struct {
+	Note       string `json:"note"`
+	RunbookURL string `json:"runbookURL"`
+}
+
+// HookPayloadFailoverImpact is the estimated impact of failing over a master, see inst.FailoverImpactEstimate
+type HookPayloadFailoverImpact struct {
+	CandidateHost                     string            `json:"candidateHost"`
+	CandidatePort                     int               `json:"candidatePort"`
+	CountReplicasToRepoint            uint              `json:"countReplicasToRepoint"`
+	CountReplicasUnlikelyReattachable uint              `json:"countReplicasUnlikelyReattachable"`
+	UnlikelyReattachableReplicas      map[string]string `json:"unlikelyReattachableReplicas"`
+	EstimatedPromotionSeconds         float64           `json:"estimatedPromotionSeconds"`
+	CountRecoveriesInEstimate         int               `json:"countRecoveriesInEstimate"`
+}
+
+// HookPayloadBinlogCoordinates are binary log coordinates
+type HookPayloadBinlogCoordinates struct {
+	LogFile string `json:"logFile"`
+	LogPos  int64  `json:"logPos"`
+}
+
+// HookPayloadDataLossSpan is the data of a single server which is not on the promoted server, see inst.DataLossSpan
+type HookPayloadDataLossSpan struct {
+	Host                  string                       `json:"host"`
+	Port                  int                          `json:"port"`
+	Role                  string                       `json:"role"`
+	LostGtidSet           string                       `json:"lostGtidSet"`
+	CountLostTransactions int64                        `json:"countLostTransactions"`
+	FromCoordinates       HookPayloadBinlogCoordinates `json:"fromCoordinates"`
+	ToCoordinates         HookPayloadBinlogCoordinates `json:"toCoordinates"`
+	SpanBytes             int64                        `json:"spanBytes"`
+	CountBinaryLogs       int                          `json:"countBinaryLogs"`
+	AffectedSchemas       []string                     `json:"affectedSchemas"`
+	AffectedTables        []string                     `json:"affectedTables"`
+	IsSampled             bool                         `json:"isSampled"`
+	SampleError           string                       `json:"sampleError"`
+}
+
+// HookPayloadDataLossReport is the estimated data loss of a master failover, see inst.DataLossReport
+type HookPayloadDataLossReport struct {
+	FailedMasterHost    string                    `json:"failedMasterHost"`
+	FailedMasterPort    int                       `json:"failedMasterPort"`
+	PromotedHost        string                    `json:"promotedHost"`
+	PromotedPort        int                       `json:"promotedPort"`
+	IsDataLossEstimated bool                      `json:"isDataLossEstimated"`
+	Spans               []HookPayloadDataLossSpan `json:"spans"`
+	Notes               []string                  `json:"notes"`
+}
+
+// HookPayloadAnalysis details the replication analysis of the failed instance, see inst.ReplicationAnalysis
+type HookPayloadAnalysis struct {
+	MasterHost                            string   `json:"masterHost"`
+	MasterPort                            int      `json:"masterPort"`
+	DataCenter                            string   `json:"dataCenter"`
+	PhysicalEnvironment                   string   `json:"physicalEnvironment"`
+	IsMaster                              bool     `json:"isMaster"`
+	IsCoMaster                            bool     `json:"isCoMaster"`
+	LastCheckValid                        bool     `json:"lastCheckValid"`
+	LastCheckPartialSuccess               bool     `json:"lastCheckPartialSuccess"`
+	LastSeenTimestamp                     string   `json:"lastSeenTimestamp"`
+	CountValidReplicas                    uint     `json:"countValidReplicas"`
+	CountValidReplicatingReplicas         uint     `json:"countValidReplicatingReplicas"`
+	CountReplicasFailingToConnectToMaster uint     `json:"countReplicasFailingToConnectToMaster"`
+	CountDowntimedReplicas                uint     `json:"countDowntimedReplicas"`
+	CountLaggingReplicas                  uint     `json:"countLaggingReplicas"`
+	CountDelayedReplicas                  uint     `json:"countDelayedReplicas"`
+	ReplicationDepth                      uint     `json:"replicationDepth"`
+	IsFailingToConnectToMaster            bool     `json:"isFailingToConnectToMaster"`
+	StructureAnalysis                     []string `json:"structureAnalysis"`
+	IsReadOnly                            bool     `json:"isReadOnly"`
+	CountWritableClusterMembers           uint     `json:"countWritableClusterMembers"`
+	IsActionableRecovery                  bool     `json:"isActionableRecovery"`
+	GTIDMode                              string   `json:"gtidMode"`
+	ProcessingNodeHostname                string   `json:"processingNodeHostname"`
+}
+
+// HookPayloadFailure describes the failure a hook runs on
+type HookPayloadFailure struct {
+	Type                           string                     `json:"type"`
+	Description                    string                     `json:"description"`
+	Command                        string                     `json:"command"`
+	Host                           string                     `json:"host"`
+	Port                           int                        `json:"port"`
+	ClusterName                    string                     `json:"clusterName"`
+	ClusterAlias                   string                     `json:"clusterAlias"`
+	ClusterDomain                  string                     `json:"clusterDomain"`
+	CountReplicas                  uint                       `json:"countReplicas"`
+	ReplicaHosts                   []string                   `json:"replicaHosts"`
+	IsDowntimed                    bool                       `json:"isDowntimed"`
+	AutoMasterRecovery             bool                       `json:"autoMasterRecovery"`
+	AutoIntermediateMasterRecovery bool                       `json:"autoIntermediateMasterRecovery"`
+	FailoverImpact                 *HookPayloadFailoverImpact `json:"failoverImpact"`
+	InstanceNote                   *HookPayloadNote           `json:"instanceNote"`
+	ClusterNote                    *HookPayloadNote           `json:"clusterNote"`
+}
+
+// HookPayloadRecovery describes the recovery a hook runs within, as of the time the hook runs
+type HookPayloadRecovery struct {
+	UID            string                     `json:"uid"`
+	Type           string                     `json:"type"`
+	StartTimestamp string                     `json:"startTimestamp"`
+	IsSuccessful   bool                       `json:"isSuccessful"`
+	SuccessorHost  string                     `json:"successorHost"`
+	SuccessorPort  int                        `json:"successorPort"`
+	SuccessorAlias string                     `json:"successorAlias"`
+	LostReplicas   []string                   `json:"lostReplicas"`
+	Errors         []string                   `json:"errors"`
+	DataLossReport *HookPayloadDataLossReport `json:"dataLossReport"`
+}
+
+// HookPayload is the JSON document passed to hooks configured with JSONPayload. Its fields are all explicitly named,
+// such that it only changes along with HookPayloadVersion.
+type HookPayload struct {
+	PayloadVersion   int                 `json:"payloadVersion"`
+	Hook             string              `json:"hook"`
+	OrchestratorHost string              `json:"orchestratorHost"`
+	Timestamp        time.Time           `json:"timestamp"`
+	Failure          HookPayloadFailure  `json:"failure"`
+	Recovery         HookPayloadRecovery `json:"recovery"`
+	Analysis         HookPayloadAnalysis `json:"analysis"`
+}
+
+func instanceKeysToStrings(instanceKeys []inst.InstanceKey) []string {
+	result := []string{}
+	for _, instanceKey := range instanceKeys {
+		result = append(result, instanceKey.StringCode())
+	}
+	return result
+}
+
+func newHookPayloadFailoverImpact(impact *inst.FailoverImpactEstimate) *HookPayloadFailoverImpact {
+	if impact == nil {
+		return nil
+	}
+	payloadImpact := &HookPayloadFailoverImpact{
+		CandidateHost:                     impact.CandidateKey.Hostname,
+		CandidatePort:                     impact.CandidateKey.Port,
+		CountReplicasToRepoint:            impact.CountReplicasToRepoint,
+		CountReplicasUnlikelyReattachable: impact.CountReplicasUnlikelyReattachable,
+		UnlikelyReattachableReplicas:      map[string]string{},
+		EstimatedPromotionSeconds:         impact.EstimatedPromotionSeconds,
+		CountRecoveriesInEstimate:         impact.CountRecoveriesInEstimate,
+	}
+	for replica, reason := range impact.UnlikelyReattachableReplicas {
+		payloadImpact.UnlikelyReattachableReplicas[replica] = reason
+	}
+	return payloadImpact
+}
+
+func newHookPayloadBinlogCoordinates(coordinates inst.BinlogCoordinates) HookPayloadBinlogCoordinates {
+	return HookPayloadBinlogCoordinates{LogFile: coordinates.LogFile, LogPos: coordinates.LogPos}
+}
+
+func newHookPayloadDataLossReport(report *inst.DataLossReport) *HookPayloadDataLossReport {
+	if report == nil {
+		return nil
+	}
+	payloadReport := &HookPayloadDataLossReport{
+		FailedMasterHost:    report.FailedMasterKey.Hostname,
+		FailedMasterPort:    report.FailedMasterKey.Port,
+		PromotedHost:        report.PromotedKey.Hostname,
+		PromotedPort:        report.PromotedKey.Port,
+		IsDataLossEstimated: report.IsDataLossEstimated,
+		Spans:               []HookPayloadDataLossSpan{},
+		Notes:               append([]string{}, report.Notes...),
+	}
+	for _, span := range report.Spans {
+		payloadReport.Spans = append(payloadReport.Spans, HookPayloadDataLossSpan{
+			Host:                  span.Key.Hostname,
+			Port:                  span.Key.Port,
+			Role:                  string(span.Role),
+			LostGtidSet:           span.LostGtidSet,
+			CountLostTransactions: span.CountLostTransactions,
+			FromCoordinates:       newHookPayloadBinlogCoordinates(span.FromCoordinates),
+			ToCoordinates:         newHookPayloadBinlogCoordinates(span.ToCoordinates),
+			SpanBytes:             span.SpanBytes,
+			CountBinaryLogs:       span.CountBinaryLogs,
+			AffectedSchemas:       append([]string{}, span.AffectedSchemas...),
+			AffectedTables:        append([]string{}, span.AffectedTables...),
+			IsSampled:             span.IsSampled,
+			SampleError:           span.SampleError,
+		})
+	}
+	return payloadReport
+}
+
+func newHookPayloadAnalysis(analysisEntry *inst.ReplicationAnalysis) HookPayloadAnalysis {
+	payloadAnalysis := HookPayloadAnalysis{
+		MasterHost:                            analysisEntry.AnalyzedInstanceMasterKey.Hostname,
+		MasterPort:                            analysisEntry.AnalyzedInstanceMasterKey.Port,
+		DataCenter:                            analysisEntry.AnalyzedInstanceDataCenter,
+		PhysicalEnvironment:                   analysisEntry.AnalyzedInstancePhysicalEnvironment,
+		IsMaster:                              analysisEntry.IsMaster,
+		IsCoMaster:                            analysisEntry.IsCoMaster,
+		LastCheckValid:                        analysisEntry.LastCheckValid,
+		LastCheckPartialSuccess:               analysisEntry.LastCheckPartialSuccess,
+		LastSeenTimestamp:                     analysisEntry.LastSeenTimestamp,
+		CountValidReplicas:                    analysisEntry.CountValidReplicas,
+		CountValidReplicatingReplicas:         analysisEntry.CountValidReplicatingReplicas,
+		CountReplicasFailingToConnectToMaster: analysisEntry.CountReplicasFailingToConnectToMaster,
+		CountDowntimedReplicas:                analysisEntry.CountDowntimedReplicas,
+		CountLaggingReplicas:                  analysisEntry.CountLaggingReplicas,
+		CountDelayedReplicas:                  analysisEntry.CountDelayedReplicas,
+		ReplicationDepth:                      analysisEntry.ReplicationDepth,
+		IsFailingToConnectToMaster:            analysisEntry.IsFailingToConnectToMaster,
+		StructureAnalysis:                     []string{},
+		IsReadOnly:                            analysisEntry.IsReadOnly,
+		CountWritableClusterMembers:           analysisEntry.CountWritableClusterMembers,
+		IsActionableRecovery:                  analysisEntry.IsActionableRecovery,
+		GTIDMode:                              analysisEntry.GTIDMode,
+		ProcessingNodeHostname:                analysisEntry.ProcessingNodeHostname,
+	}
+	for _, structureAnalysis := range analysisEntry.StructureAnalysis {
+		payloadAnalysis.StructureAnalysis = append(payloadAnalysis.StructureAnalysis, string(structureAnalysis))
+	}
+	return payloadAnalysis
+}
+
+// NewHookPayload returns the payload of a hook of given hooks list, running within given recovery
+func NewHookPayload(hooksListName string, topologyRecovery *TopologyRecovery) *HookPayload {
+	analysisEntry := &topologyRecovery.AnalysisEntry
+	payload := &HookPayload{
+		PayloadVersion:   HookPayloadVersion,
+		Hook:             hooksListName,
+		OrchestratorHost: process.ThisHostname,
+		Timestamp:        time.Now(),
+		Failure: HookPayloadFailure{
+			Type:                           string(analysisEntry.Analysis),
+			Description:                    analysisEntry.Description,
+			Command:                        analysisEntry.CommandHint,
+			Host:                           analysisEntry.AnalyzedInstanceKey.Hostname,
+			Port:                           analysisEntry.AnalyzedInstanceKey.Port,
+			ClusterName:                    analysisEntry.ClusterDetails.ClusterName,
+			ClusterAlias:                   analysisEntry.ClusterDetails.ClusterAlias,
+			ClusterDomain:                  analysisEntry.ClusterDetails.ClusterDomain,
+			CountReplicas:                  analysisEntry.CountReplicas,
+			ReplicaHosts:                   instanceKeysToStrings(analysisEntry.SlaveHosts.GetInstanceKeys()),
+			IsDowntimed:                    analysisEntry.IsDowntimed,
+			AutoMasterRecovery:             analysisEntry.ClusterDetails.HasAutomatedMasterRecovery,
+			AutoIntermediateMasterRecovery: analysisEntry.ClusterDetails.HasAutomatedIntermediateMasterRecovery,
+			FailoverImpact:                 newHookPayloadFailoverImpact(analysisEntry.FailoverImpact),
+		},
+		Recovery: HookPayloadRecovery{
+			UID:            topologyRecovery.UID,
+			Type:           string(topologyRecovery.RecoveryType),
+			StartTimestamp: topologyRecovery.RecoveryStartTimestamp,
+			IsSuccessful:   topologyRecovery.IsSuccessful,
+			LostReplicas:   instanceKeysToStrings(topologyRecovery.LostReplicas.GetInstanceKeys()),
+			Errors:         append([]string{}, topologyRecovery.AllErrors...),
+			DataLossReport: newHookPayloadDataLossReport(topologyRecovery.DataLossReport),
+		},
+		Analysis: newHookPayloadAnalysis(analysisEntry),
+	}
+	if topologyRecovery.SuccessorKey != nil {
+		payload.Recovery.SuccessorHost = topologyRecovery.SuccessorKey.Hostname
+		payload.Recovery.SuccessorPort = topologyRecovery.SuccessorKey.Port
+		payload.Recovery.SuccessorAlias = topologyRecovery.SuccessorAlias
+	}
+	instanceNote, clusterNote := readAnalysisNotes(analysisEntry)
+	if instanceNote != nil {
+		payload.Failure.InstanceNote = &HookPayloadNote{Note: instanceNote.Note, RunbookURL: instanceNote.RunbookURL}
+	}
+	if clusterNote != nil {
+		payload.Failure.ClusterNote = &HookPayloadNote{Note: clusterNote.Note, RunbookURL: clusterNote.RunbookURL}
+	}
+	return payload
+}
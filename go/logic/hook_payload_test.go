@@ -0,0 +1,137 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"encoding/json"
+	"testing"
+	"unicode"
+
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+// expectCamelCaseKeys expects all keys of given JSON document, at any depth, to be camelCase. Maps whose keys are
+// data, rather than field names, are skipped.
+func expectCamelCaseKeys(t *testing.T, path string, document interface{}) {
+	switch value := document.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			if !unicode.IsLower(rune(key[0])) {
+				t.Errorf("%s.%s is not camelCase", path, key)
+			}
+			if key == "unlikelyReattachableReplicas" {
+				continue
+			}
+			expectCamelCaseKeys(t, path+"."+key, child)
+		}
+	case []interface{}:
+		for _, child := range value {
+			expectCamelCaseKeys(t, path+"[]", child)
+		}
+	}
+}
+
+func TestNewHookPayload(t *testing.T) {
+	withSQLiteBackend(t)
+
+	failedMasterKey := inst.InstanceKey{Hostname: "payload-master", Port: 3306}
+	promotedKey := inst.InstanceKey{Hostname: "payload-replica", Port: 3306}
+	analysisEntry := inst.ReplicationAnalysis{
+		AnalyzedInstanceKey: failedMasterKey,
+		ClusterDetails:      inst.ClusterInfo{ClusterName: "payload-master:3306", ClusterAlias: "payload"},
+		IsMaster:            true,
+		Analysis:            inst.DeadMaster,
+		CountReplicas:       2,
+		StructureAnalysis:   []inst.StructureAnalysisCode{inst.StatementAndMixedLoggingSlavesStructureWarning},
+		FailoverImpact: &inst.FailoverImpactEstimate{
+			CandidateKey:                 promotedKey,
+			CountReplicasToRepoint:       1,
+			UnlikelyReattachableReplicas: map[string]string{"payload-other:3306": "errant GTID"},
+		},
+	}
+	analysisEntry.SlaveHosts = *inst.NewInstanceKeyMap()
+	analysisEntry.SlaveHosts.AddKey(promotedKey)
+	_, err := SetClusterNote("payload", "requires manual DNS change", "https://wiki.example.com/payload", "test")
+	test.S(t).ExpectNil(err)
+
+	topologyRecovery := NewTopologyRecovery(analysisEntry)
+	topologyRecovery.RecoveryType = MasterRecoveryGTID
+	topologyRecovery.AllErrors = []string{"some error"}
+
+	{
+		// Before the promotion
+		payload := NewHookPayload("PreFailoverProcesses", topologyRecovery)
+		test.S(t).ExpectEquals(payload.PayloadVersion, HookPayloadVersion)
+		test.S(t).ExpectEquals(payload.Hook, "PreFailoverProcesses")
+		test.S(t).ExpectEquals(payload.Failure.Type, string(inst.DeadMaster))
+		test.S(t).ExpectEquals(payload.Failure.Host, "payload-master")
+		test.S(t).ExpectEquals(payload.Failure.ClusterAlias, "payload")
+		test.S(t).ExpectEquals(len(payload.Failure.ReplicaHosts), 1)
+		test.S(t).ExpectEquals(payload.Failure.ReplicaHosts[0], "payload-replica:3306")
+		test.S(t).ExpectEquals(payload.Failure.FailoverImpact.CandidateHost, "payload-replica")
+		test.S(t).ExpectEquals(payload.Failure.FailoverImpact.UnlikelyReattachableReplicas["payload-other:3306"], "errant GTID")
+		test.S(t).ExpectTrue(payload.Failure.InstanceNote == nil)
+		test.S(t).ExpectEquals(payload.Failure.ClusterNote.Note, "requires manual DNS change")
+		test.S(t).ExpectEquals(payload.Recovery.UID, topologyRecovery.UID)
+		test.S(t).ExpectEquals(payload.Recovery.Type, string(MasterRecoveryGTID))
+		test.S(t).ExpectFalse(payload.Recovery.IsSuccessful)
+		test.S(t).ExpectEquals(payload.Recovery.SuccessorHost, "")
+		test.S(t).ExpectTrue(payload.Recovery.DataLossReport == nil)
+		test.S(t).ExpectEquals(len(payload.Recovery.Errors), 1)
+		test.S(t).ExpectTrue(payload.Analysis.IsMaster)
+		test.S(t).ExpectEquals(payload.Analysis.StructureAnalysis[0], string(inst.StatementAndMixedLoggingSlavesStructureWarning))
+	}
+
+	// A successor is set ahead of the recovery's success
+	topologyRecovery.SuccessorKey = &promotedKey
+	{
+		payload := NewHookPayload("PostUnsuccessfulFailoverProcesses", topologyRecovery)
+		test.S(t).ExpectFalse(payload.Recovery.IsSuccessful)
+		test.S(t).ExpectEquals(payload.Recovery.SuccessorHost, "payload-replica")
+	}
+
+	topologyRecovery.IsSuccessful = true
+	topologyRecovery.DataLossReport = &inst.DataLossReport{
+		FailedMasterKey:     failedMasterKey,
+		PromotedKey:         promotedKey,
+		IsDataLossEstimated: true,
+		Spans: []inst.DataLossSpan{{
+			Key:             failedMasterKey,
+			Role:            inst.DataLossFailedMaster,
+			FromCoordinates: inst.BinlogCoordinates{LogFile: "mysql-bin.000001", LogPos: 4},
+			ToCoordinates:   inst.BinlogCoordinates{LogFile: "mysql-bin.000003", LogPos: 120},
+			CountBinaryLogs: 3,
+		}},
+	}
+	payload := NewHookPayload("PostFailoverProcesses", topologyRecovery)
+	test.S(t).ExpectTrue(payload.Recovery.IsSuccessful)
+	test.S(t).ExpectEquals(payload.Recovery.DataLossReport.PromotedHost, "payload-replica")
+	test.S(t).ExpectEquals(payload.Recovery.DataLossReport.Spans[0].Role, string(inst.DataLossFailedMaster))
+	test.S(t).ExpectEquals(payload.Recovery.DataLossReport.Spans[0].ToCoordinates.LogFile, "mysql-bin.000003")
+
+	// The payload's fields are all explicitly named
+	b, err := json.Marshal(payload)
+	test.S(t).ExpectNil(err)
+	document := map[string]interface{}{}
+	test.S(t).ExpectNil(json.Unmarshal(b, &document))
+	expectCamelCaseKeys(t, "payload", document)
+	failoverImpact := document["failure"].(map[string]interface{})["failoverImpact"].(map[string]interface{})
+	test.S(t).ExpectEquals(failoverImpact["candidateHost"], "payload-replica")
+	span := document["recovery"].(map[string]interface{})["dataLossReport"].(map[string]interface{})["spans"].([]interface{})[0].(map[string]interface{})
+	test.S(t).ExpectEquals(span["fromCoordinates"].(map[string]interface{})["logFile"], "mysql-bin.000001")
+}
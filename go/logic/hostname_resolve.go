@@ -0,0 +1,53 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"github.com/github/orchestrator/go/inst"
+	orcraft "github.com/github/orchestrator/go/raft"
+)
+
+// SeedHostnameResolve sets the resolve of a hostname, taking precedence over resolving it, on all orchestrator nodes
+func SeedHostnameResolve(seed *inst.HostnameResolveSeed) error {
+	if orcraft.IsRaftEnabled() {
+		_, err := orcraft.PublishCommand("seed-hostname-resolve", seed)
+		return err
+	}
+	return inst.SeedHostnameResolve(seed)
+}
+
+// UnseedHostnameResolve removes the seeded resolve of a hostname, on all orchestrator nodes
+func UnseedHostnameResolve(hostname string) error {
+	if orcraft.IsRaftEnabled() {
+		_, err := orcraft.PublishCommand("unseed-hostname-resolve", hostname)
+		return err
+	}
+	return inst.UnseedHostnameResolve(hostname)
+}
+
+// InvalidateHostnameResolves removes cached resolves matching given regular expression, on all orchestrator nodes.
+// The invalidated hostnames are as found on this node.
+func InvalidateHostnameResolves(pattern string) (invalidated []string, err error) {
+	invalidated, err = inst.InvalidateHostnameResolves(pattern)
+	if err != nil {
+		return invalidated, err
+	}
+	if orcraft.IsRaftEnabled() {
+		_, err = orcraft.PublishCommand("invalidate-hostname-resolves", pattern)
+	}
+	return invalidated, err
+}
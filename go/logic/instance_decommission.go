@@ -0,0 +1,368 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/github/orchestrator/go/kv"
+	orcraft "github.com/github/orchestrator/go/raft"
+	"github.com/openark/golib/log"
+)
+
+// InstanceDecommissionStatus is the state of an instance decommission
+type InstanceDecommissionStatus string
+
+const (
+	InstanceDecommissionPending   InstanceDecommissionStatus = "pending"
+	InstanceDecommissionForgotten InstanceDecommissionStatus = "forgotten"
+	InstanceDecommissionCanceled  InstanceDecommissionStatus = "canceled"
+)
+
+// decommissionDowntimeGraceMinutes keeps a decommissioned instance downtimed for a while past its forget time,
+// such that it is not analyzed should forgetting it be delayed
+const decommissionDowntimeGraceMinutes = 60
+
+var decommissionsEntrance int64
+
+// InstanceDecommission is an instance taken out of service: it has no replicas, is out of all pools, read-only and
+// downtimed. Once ForgetAtString is due, the instance is forgotten by whichever node is the leader by then. Until
+// then, the decommission may be canceled.
+type InstanceDecommission struct {
+	Key                    inst.InstanceKey
+	ClusterName            string
+	Owner                  string
+	Reason                 string
+	Status                 InstanceDecommissionStatus
+	DecommissionedAtString string
+	ForgetAtString         string
+	CountAttempts          uint
+	LastError              string
+	CompletedAtString      string
+}
+
+// String returns a string representation of the decommission
+func (this *InstanceDecommission) String() string {
+	return fmt.Sprintf("%s: forget at %s (%s), decommissioned by %s: %s", this.Key.DisplayString(), this.ForgetAtString, this.Status, this.Owner, this.Reason)
+}
+
+// persistInstanceDecommission writes down given decommission, either directly or via raft
+func persistInstanceDecommission(decommission *InstanceDecommission) error {
+	if orcraft.IsRaftEnabled() {
+		_, err := orcraft.PublishCommand("write-instance-decommission", decommission)
+		return log.Errore(err)
+	}
+	return writeInstanceDecommission(decommission)
+}
+
+// getDecommissionReplicas returns the replicas of given instance which must be relocated before it is
+// decommissioned. A co-master is not one of these.
+func getDecommissionReplicas(instance *inst.Instance) ([](*inst.Instance), error) {
+	replicas, err := inst.ReadReplicaInstances(&instance.Key)
+	if err != nil {
+		return nil, err
+	}
+	result := [](*inst.Instance){}
+	for _, replica := range replicas {
+		if instance.MasterKey.Equals(&replica.Key) {
+			continue
+		}
+		result = append(result, replica)
+	}
+	return result, nil
+}
+
+// relocateDecommissionReplicas relocates the replicas of given instance below its own master. The replicas of a
+// master are not relocated: the master must first be taken over.
+func relocateDecommissionReplicas(instance *inst.Instance) error {
+	replicas, err := getDecommissionReplicas(instance)
+	if err != nil {
+		return err
+	}
+	if len(replicas) == 0 {
+		return nil
+	}
+	if !instance.IsReplica() || instance.IsCoMaster {
+		return fmt.Errorf("%+v is a master with %d replicas. Run a graceful-master-takeover before decommissioning it", instance.Key, len(replicas))
+	}
+	_, _, err, errs := inst.RelocateReplicas(&instance.Key, &instance.MasterKey, "")
+	if err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("Failed relocating %d replicas of %+v below %+v; first error: %+v", len(errs), instance.Key, instance.MasterKey, errs[0])
+	}
+	return nil
+}
+
+// leaveDecommissionPools removes given instance from all pools of its cluster, notifying the pools' new membership
+func leaveDecommissionPools(instance *inst.Instance) error {
+	clusterPoolInstances, err := inst.ReadClusterPoolInstances(instance.ClusterName, "")
+	if err != nil {
+		return err
+	}
+	changes := map[string]*inst.PoolMembershipChange{}
+	for _, clusterPoolInstance := range clusterPoolInstances {
+		change, found := changes[clusterPoolInstance.Pool]
+		if !found {
+			change = &inst.PoolMembershipChange{
+				ClusterName:  instance.ClusterName,
+				ClusterAlias: clusterPoolInstance.ClusterAlias,
+				Pool:         clusterPoolInstance.Pool,
+				Members:      []inst.InstanceKey{},
+				Added:        []inst.InstanceKey{},
+				Removed:      []inst.InstanceKey{},
+			}
+			changes[clusterPoolInstance.Pool] = change
+		}
+		memberKey := inst.InstanceKey{Hostname: clusterPoolInstance.Hostname, Port: clusterPoolInstance.Port}
+		if memberKey.Equals(&instance.Key) {
+			change.Removed = append(change.Removed, memberKey)
+		} else {
+			change.Members = append(change.Members, memberKey)
+		}
+	}
+	for _, change := range changes {
+		if !change.HasChanges() {
+			continue
+		}
+		if orcraft.IsRaftEnabled() {
+			_, err = orcraft.PublishCommand("apply-pool-membership-change", change)
+		} else {
+			err = inst.ApplyPoolMembershipChange(change)
+		}
+		if err != nil {
+			return err
+		}
+		notifyPoolMembershipChange(change)
+	}
+	return nil
+}
+
+// publishInstanceDecommission writes the state of a decommission onto KV stores
+func publishInstanceDecommission(decommission *InstanceDecommission) {
+	if config.Config.KVDecommissionPrefix == "" {
+		return
+	}
+	value, err := json.Marshal(decommission)
+	if err != nil {
+		log.Errore(err)
+		return
+	}
+	kvPair := kv.NewKVPair(fmt.Sprintf("%s%s", config.Config.KVDecommissionPrefix, decommission.Key.StringCode()), string(value))
+	if orcraft.IsRaftEnabled() {
+		_, err := orcraft.PublishCommand("put-key-value", kvPair)
+		log.Errore(err)
+	} else {
+		log.Errore(kv.PutKVPair(kvPair))
+	}
+}
+
+// executePostDecommissionProcesses runs the PostDecommissionProcesses hooks of a new decommission
+func executePostDecommissionProcesses(decommission *InstanceDecommission) {
+	clusterAlias, _ := inst.ReadAliasByClusterName(decommission.ClusterName)
+	executeEventProcesses(config.Config.PostDecommissionProcesses, "PostDecommissionProcesses", []hookVariable{
+		{"host", "ORC_HOST", decommission.Key.Hostname},
+		{"port", "ORC_PORT", fmt.Sprintf("%d", decommission.Key.Port)},
+		{"clusterName", "ORC_CLUSTER_NAME", decommission.ClusterName},
+		{"clusterAlias", "ORC_CLUSTER_ALIAS", clusterAlias},
+		{"owner", "ORC_OWNER", decommission.Owner},
+		{"reason", "ORC_REASON", decommission.Reason},
+		{"forgetAt", "ORC_FORGET_AT", decommission.ForgetAtString},
+	})
+}
+
+// checkDecommissionable returns an error unless given instance may be decommissioned: a replica which is not a
+// co-master may; a master, or co-master, only when forced.
+func checkDecommissionable(instance *inst.Instance, force bool) error {
+	if instance.IsReplica() && !instance.IsCoMaster {
+		return nil
+	}
+	if !force {
+		return fmt.Errorf("%+v is a master or a co-master. Decommissioning it requires force", instance.Key)
+	}
+	return nil
+}
+
+// DecommissionInstance takes an instance out of service: its replicas are relocated below its master, it is removed
+// from its cluster's pools, set read-only and downtimed. The decommission is then published onto KV stores, hooks and
+// state events, and the instance is forgotten once DecommissionForgetAfterMinutes pass. Only a replica, which is not
+// a co-master, is decommissioned unless forced; a master with replicas is never decommissioned, and must first be
+// taken over. The steps are not rolled back should any of them fail; the operation may then be retried.
+func DecommissionInstance(instanceKey *inst.InstanceKey, owner string, reason string, force bool) (*InstanceDecommission, error) {
+	if existing, err := readInstanceDecommission(instanceKey); err != nil {
+		return nil, err
+	} else if existing != nil && existing.Status == InstanceDecommissionPending {
+		return existing, fmt.Errorf("%+v is already being decommissioned; it will be forgotten at %s", *instanceKey, existing.ForgetAtString)
+	}
+	instance, found, err := inst.ReadInstance(instanceKey)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("Instance not found: %+v", *instanceKey)
+	}
+	if err := checkDecommissionable(instance, force); err != nil {
+		return nil, err
+	}
+	if err := relocateDecommissionReplicas(instance); err != nil {
+		return nil, err
+	}
+	if err := leaveDecommissionPools(instance); err != nil {
+		return nil, err
+	}
+	if instance.IsLastCheckValid {
+		if _, err := inst.SetReadOnly(instanceKey, true); err != nil {
+			return nil, err
+		}
+	} else {
+		log.Warningf("DecommissionInstance: %+v cannot be reached; not setting it read-only", *instanceKey)
+	}
+	now, err := db.ReadTimeNow()
+	if err != nil {
+		return nil, log.Errore(err)
+	}
+	forgetAfterMinutes := config.Config.DecommissionForgetAfterMinutes
+	decommission := &InstanceDecommission{
+		Key:                    *instanceKey,
+		ClusterName:            instance.ClusterName,
+		Owner:                  owner,
+		Reason:                 reason,
+		Status:                 InstanceDecommissionPending,
+		DecommissionedAtString: now,
+		ForgetAtString:         inst.AddSecondsToTimeString(now, forgetAfterMinutes*60),
+	}
+	downtimeOperation := &BatchOperation{
+		Command:         "begin-downtime",
+		Key:             *instanceKey,
+		Owner:           owner,
+		Reason:          fmt.Sprintf("decommission: %s", reason),
+		DurationSeconds: int(forgetAfterMinutes+decommissionDowntimeGraceMinutes) * 60,
+	}
+	if _, err := batchOperationFunctions[downtimeOperation.Command](downtimeOperation); err != nil {
+		return nil, err
+	}
+	if err := persistInstanceDecommission(decommission); err != nil {
+		return nil, err
+	}
+	inst.AuditOperation("decommission-instance", instanceKey, fmt.Sprintf("decommissioned by %s, to be forgotten at %s: %s", owner, decommission.ForgetAtString, reason))
+	inst.RecordStateEvent(inst.InstanceDecommissionedEvent, decommission.ClusterName, instanceKey, map[string]interface{}{
+		"owner":    owner,
+		"reason":   reason,
+		"forgetAt": decommission.ForgetAtString,
+	})
+	publishInstanceDecommission(decommission)
+	executePostDecommissionProcesses(decommission)
+	return decommission, nil
+}
+
+// CancelDecommission cancels a pending decommission, such that the instance is not forgotten, and ends its downtime.
+// The instance remains read-only and out of its pools.
+func CancelDecommission(instanceKey *inst.InstanceKey, owner string) (*InstanceDecommission, error) {
+	decommission, err := readInstanceDecommission(instanceKey)
+	if err != nil {
+		return nil, err
+	}
+	if decommission == nil || decommission.Status != InstanceDecommissionPending {
+		return nil, fmt.Errorf("No pending decommission found for %+v", *instanceKey)
+	}
+	if decommission.CompletedAtString, err = db.ReadTimeNow(); err != nil {
+		return nil, log.Errore(err)
+	}
+	decommission.Status = InstanceDecommissionCanceled
+	if err := persistInstanceDecommission(decommission); err != nil {
+		return nil, err
+	}
+	if _, err := batchOperationFunctions["end-downtime"](&BatchOperation{Command: "end-downtime", Key: *instanceKey}); err != nil {
+		log.Errore(err)
+	}
+	inst.AuditOperation("cancel-decommission", instanceKey, fmt.Sprintf("decommission canceled by %s", owner))
+	publishInstanceDecommission(decommission)
+	return decommission, nil
+}
+
+// forgetDecommissionedInstance forgets the instance of a due decommission, having confirmed it still has no replicas.
+// A failed attempt is recorded, and the decommission remains pending.
+func forgetDecommissionedInstance(decommission *InstanceDecommission) (err error) {
+	decommission.CountAttempts++
+	err = func() error {
+		instance, found, err := inst.ReadInstance(&decommission.Key)
+		if err != nil {
+			return err
+		}
+		if found {
+			replicas, err := getDecommissionReplicas(instance)
+			if err != nil {
+				return err
+			}
+			if len(replicas) > 0 {
+				return fmt.Errorf("%+v has %d replicas", decommission.Key, len(replicas))
+			}
+		}
+		if orcraft.IsRaftEnabled() {
+			_, err := orcraft.PublishCommand("forget", decommission.Key)
+			return err
+		}
+		return inst.ForgetInstance(&decommission.Key)
+	}()
+	if err != nil {
+		decommission.LastError = err.Error()
+	} else {
+		decommission.Status = InstanceDecommissionForgotten
+		decommission.LastError = ""
+		decommission.CompletedAtString, _ = db.ReadTimeNow()
+	}
+	if persistErr := persistInstanceDecommission(decommission); persistErr != nil {
+		return persistErr
+	}
+	if err != nil {
+		return err
+	}
+	inst.AuditOperation("forget-decommissioned-instance", &decommission.Key, fmt.Sprintf("decommissioned by %s: %s", decommission.Owner, decommission.Reason))
+	publishInstanceDecommission(decommission)
+	return nil
+}
+
+// RunDueDecommissions forgets, on the leader, the decommissioned instances whose confirmation period is over.
+// Decommissions are persisted in the backend, hence a decommission begun under a former leader is completed by
+// the current one. An instance found to have replicas is not forgotten, and is retried on the next run.
+func RunDueDecommissions() {
+	if !IsLeader() {
+		return
+	}
+	// This function is non re-entrant (it can only be running once at any point in time)
+	if !atomic.CompareAndSwapInt64(&decommissionsEntrance, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt64(&decommissionsEntrance, 0)
+
+	decommissions, err := readDueInstanceDecommissions()
+	if err != nil {
+		return
+	}
+	for _, decommission := range decommissions {
+		decommission := decommission
+		if err := forgetDecommissionedInstance(&decommission); err != nil {
+			log.Errorf("RunDueDecommissions: cannot forget %+v (attempt %d): %+v", decommission.Key, decommission.CountAttempts, err)
+		}
+	}
+}
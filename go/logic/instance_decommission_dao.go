@@ -0,0 +1,125 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+// writeInstanceDecommission writes an instance decommission, along with its outcome, if any
+func writeInstanceDecommission(decommission *InstanceDecommission) error {
+	_, err := db.ExecOrchestrator(`
+			replace into instance_decommission (
+					hostname, port, cluster_name, owner, reason, decommission_status,
+					decommissioned_at, forget_at, count_attempts, last_error, completed_at
+				) values (
+					?, ?, ?, ?, ?, ?,
+					?, ?, ?, ?, ?
+				)
+			`, decommission.Key.Hostname, decommission.Key.Port, decommission.ClusterName, decommission.Owner, decommission.Reason, string(decommission.Status),
+		decommission.DecommissionedAtString, decommission.ForgetAtString, decommission.CountAttempts, decommission.LastError, decommission.CompletedAtString,
+	)
+	return log.Errore(err)
+}
+
+// readInstanceDecommissions reads decommissions matching given condition, soonest forget first
+func readInstanceDecommissions(whereCondition string, args []interface{}) ([]InstanceDecommission, error) {
+	decommissions := []InstanceDecommission{}
+	query := `
+		select
+			hostname,
+			port,
+			cluster_name,
+			owner,
+			reason,
+			decommission_status,
+			decommissioned_at,
+			forget_at,
+			count_attempts,
+			last_error,
+			completed_at
+		from
+			instance_decommission
+		` + whereCondition + `
+		order by
+			forget_at asc
+		`
+	err := db.QueryOrchestrator(query, args, func(m sqlutils.RowMap) error {
+		decommission := InstanceDecommission{
+			ClusterName:            m.GetString("cluster_name"),
+			Owner:                  m.GetString("owner"),
+			Reason:                 m.GetString("reason"),
+			Status:                 InstanceDecommissionStatus(m.GetString("decommission_status")),
+			DecommissionedAtString: m.GetString("decommissioned_at"),
+			ForgetAtString:         m.GetString("forget_at"),
+			CountAttempts:          m.GetUint("count_attempts"),
+			LastError:              m.GetString("last_error"),
+			CompletedAtString:      m.GetString("completed_at"),
+		}
+		decommission.Key.Hostname = m.GetString("hostname")
+		decommission.Key.Port = m.GetInt("port")
+		decommissions = append(decommissions, decommission)
+		return nil
+	})
+	return decommissions, log.Errore(err)
+}
+
+// ReadInstanceDecommissions reads the pending decommissions, as well as those completed within the past day
+func ReadInstanceDecommissions() ([]InstanceDecommission, error) {
+	whereCondition := `
+		where
+			decommission_status = ?
+			or completed_at > now() - interval 1 day
+		`
+	return readInstanceDecommissions(whereCondition, sqlutils.Args(string(InstanceDecommissionPending)))
+}
+
+// readInstanceDecommission reads the decommission of given instance, or nil when the instance was never decommissioned
+func readInstanceDecommission(instanceKey *inst.InstanceKey) (*InstanceDecommission, error) {
+	decommissions, err := readInstanceDecommissions(`where hostname = ? and port = ?`, sqlutils.Args(instanceKey.Hostname, instanceKey.Port))
+	if err != nil || len(decommissions) == 0 {
+		return nil, err
+	}
+	return &decommissions[0], nil
+}
+
+// readDueInstanceDecommissions reads the pending decommissions whose confirmation period is over
+func readDueInstanceDecommissions() ([]InstanceDecommission, error) {
+	whereCondition := `
+		where
+			decommission_status = ?
+			and forget_at <= now()
+		`
+	return readInstanceDecommissions(whereCondition, sqlutils.Args(string(InstanceDecommissionPending)))
+}
+
+// ExpireInstanceDecommissionHistory removes old forgotten or canceled decommissions. Pending decommissions are never expired.
+func ExpireInstanceDecommissionHistory() error {
+	_, err := db.ExecOrchestrator(`
+			delete
+				from instance_decommission
+			where
+				decommission_status != ?
+				and completed_at < now() - interval ? day
+			`, string(InstanceDecommissionPending), config.AuditPurgeDays,
+	)
+	return log.Errore(err)
+}
@@ -0,0 +1,92 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+var decommissionMasterKey = inst.InstanceKey{Hostname: "decommission-master", Port: 3306}
+var decommissionReplicaKey = inst.InstanceKey{Hostname: "decommission-replica", Port: 3306}
+
+func TestCheckDecommissionable(t *testing.T) {
+	replica := inst.NewInstance()
+	replica.Key = decommissionReplicaKey
+	replica.MasterKey = decommissionMasterKey
+	replica.ReadBinlogCoordinates.LogFile = "mysql-bin.000001"
+	test.S(t).ExpectNil(checkDecommissionable(replica, false))
+
+	master := inst.NewInstance()
+	master.Key = decommissionMasterKey
+	test.S(t).ExpectNotNil(checkDecommissionable(master, false))
+	test.S(t).ExpectNil(checkDecommissionable(master, true))
+
+	coMaster := inst.NewInstance()
+	coMaster.Key = decommissionMasterKey
+	coMaster.MasterKey = decommissionReplicaKey
+	coMaster.ReadBinlogCoordinates.LogFile = "mysql-bin.000001"
+	coMaster.IsCoMaster = true
+	test.S(t).ExpectNotNil(checkDecommissionable(coMaster, false))
+	test.S(t).ExpectNil(checkDecommissionable(coMaster, true))
+}
+
+func TestDecommissionInstanceRefusesMaster(t *testing.T) {
+	withSQLiteBackend(t)
+	writeTestInstance(t, decommissionMasterKey, inst.InstanceKey{}, "decommission-master:3306")
+
+	_, err := DecommissionInstance(&decommissionMasterKey, "ops", "retire", false)
+	test.S(t).ExpectNotNil(err)
+	test.S(t).ExpectTrue(strings.Contains(err.Error(), "requires force"))
+
+	decommission, err := readInstanceDecommission(&decommissionMasterKey)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(decommission == nil)
+
+	unknownKey := inst.InstanceKey{Hostname: "unknown", Port: 3306}
+	_, err = DecommissionInstance(&unknownKey, "ops", "retire", true)
+	test.S(t).ExpectNotNil(err)
+}
+
+func TestDecommissionInstance(t *testing.T) {
+	withSQLiteBackend(t)
+	writeTestInstance(t, decommissionReplicaKey, decommissionMasterKey, "decommission-master:3306")
+	// An unreachable instance is not set read-only
+	_, err := db.ExecOrchestrator(`update database_instance set last_seen = now() - interval 1 hour`)
+	test.S(t).ExpectNil(err)
+
+	decommission, err := DecommissionInstance(&decommissionReplicaKey, "ops", "retire", false)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(decommission.Status, InstanceDecommissionPending)
+	test.S(t).ExpectEquals(decommission.ClusterName, "decommission-master:3306")
+
+	persisted, err := readInstanceDecommission(&decommissionReplicaKey)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(persisted.Status, InstanceDecommissionPending)
+	test.S(t).ExpectEquals(persisted.Owner, "ops")
+
+	_, err = DecommissionInstance(&decommissionReplicaKey, "ops", "retire", false)
+	test.S(t).ExpectNotNil(err)
+
+	canceled, err := CancelDecommission(&decommissionReplicaKey, "ops")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(canceled.Status, InstanceDecommissionCanceled)
+}
@@ -0,0 +1,45 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"github.com/github/orchestrator/go/inst"
+	orcraft "github.com/github/orchestrator/go/raft"
+)
+
+// SetInstanceFlag sets a persisted flag on an instance. Flags survive restarts, and are replicated via raft.
+func SetInstanceFlag(instanceKey *inst.InstanceKey, flag inst.InstanceFlag, owner string, reason string) (*inst.InstanceFlagEntry, error) {
+	if _, err := inst.ParseInstanceFlag(string(flag)); err != nil {
+		return nil, err
+	}
+	entry := inst.NewInstanceFlagEntry(instanceKey, flag, owner, reason)
+	if orcraft.IsRaftEnabled() {
+		_, err := orcraft.PublishCommand("set-instance-flag", entry)
+		return entry, err
+	}
+	return entry, inst.WriteInstanceFlag(entry)
+}
+
+// ClearInstanceFlag clears a persisted flag of an instance
+func ClearInstanceFlag(instanceKey *inst.InstanceKey, flag inst.InstanceFlag) error {
+	entry := inst.NewInstanceFlagEntry(instanceKey, flag, "", "")
+	if orcraft.IsRaftEnabled() {
+		_, err := orcraft.PublishCommand("clear-instance-flag", entry)
+		return err
+	}
+	return inst.DeleteInstanceFlag(entry)
+}
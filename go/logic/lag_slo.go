@@ -0,0 +1,86 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/openark/golib/log"
+)
+
+// lagSLOBurnRateThresholdsCrossed maps a cluster onto the highest burn rate threshold its burn rate has crossed
+var lagSLOBurnRateThresholdsCrossed = make(map[string]float64)
+var lagSLOBurnRateThresholdsCrossedMutex sync.Mutex
+
+// highestCrossedThreshold returns the highest of given thresholds which given burn rate reaches, or 0 if none
+func highestCrossedThreshold(burnRate float64, thresholds []float64) (crossed float64) {
+	for _, threshold := range thresholds {
+		if burnRate >= threshold && threshold > crossed {
+			crossed = threshold
+		}
+	}
+	return crossed
+}
+
+// CheckLagSLOs samples the clusters' replication lag, and computes their compliance with their lag SLOs.
+// When the error budget burn rate of a cluster crosses a higher threshold than it previously has, the crossing
+// is audited, and the leader runs LagSLOBurnProcesses. A threshold may be crossed again once the burn rate
+// drops below it.
+func CheckLagSLOs() {
+	if len(config.Config.LagSLOs) == 0 {
+		return
+	}
+	if err := inst.RecordClusterLagSamples(); err != nil {
+		return
+	}
+	statuses, err := inst.ReadLagSLOStatuses()
+	if err != nil {
+		log.Errore(err)
+		return
+	}
+	for _, status := range statuses {
+		lagSLO, _ := config.Config.GetLagSLO(status.ClusterName, status.ClusterAlias)
+		crossed := highestCrossedThreshold(status.BurnRate, lagSLO.BurnRateThresholds)
+
+		lagSLOBurnRateThresholdsCrossedMutex.Lock()
+		previouslyCrossed := lagSLOBurnRateThresholdsCrossed[status.ClusterName]
+		lagSLOBurnRateThresholdsCrossed[status.ClusterName] = crossed
+		lagSLOBurnRateThresholdsCrossedMutex.Unlock()
+
+		if crossed <= previouslyCrossed {
+			continue
+		}
+		inst.AuditOperation("lag-slo-burn", nil, fmt.Sprintf("cluster: %s; burn rate: %.2f crossed threshold %.2f; compliance: %.4f, target: %.4f", status.ClusterName, status.BurnRate, crossed, status.Compliance, status.TargetRatio))
+		if IsLeader() {
+			go executeLagSLOBurnProcesses(status, crossed)
+		}
+	}
+}
+
+func executeLagSLOBurnProcesses(status inst.LagSLOStatus, burnRateThreshold float64) {
+	executeEventProcesses(config.Config.LagSLOBurnProcesses, "LagSLOBurnProcesses", []hookVariable{
+		{"clusterName", "ORC_CLUSTER_NAME", status.ClusterName},
+		{"clusterAlias", "ORC_CLUSTER_ALIAS", status.ClusterAlias},
+		{"burnRate", "ORC_BURN_RATE", fmt.Sprintf("%.2f", status.BurnRate)},
+		{"burnRateThreshold", "ORC_BURN_RATE_THRESHOLD", fmt.Sprintf("%.2f", burnRateThreshold)},
+		{"compliance", "ORC_COMPLIANCE", fmt.Sprintf("%.4f", status.Compliance)},
+		{"targetRatio", "ORC_TARGET_RATIO", fmt.Sprintf("%.4f", status.TargetRatio)},
+	})
+}
@@ -0,0 +1,58 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+func TestHighestCrossedThreshold(t *testing.T) {
+	thresholds := []float64{14.4, 1, 6}
+	test.S(t).ExpectEquals(highestCrossedThreshold(0.5, thresholds), 0.0)
+	test.S(t).ExpectEquals(highestCrossedThreshold(1, thresholds), 1.0)
+	test.S(t).ExpectEquals(highestCrossedThreshold(7, thresholds), 6.0)
+	test.S(t).ExpectEquals(highestCrossedThreshold(20, thresholds), 14.4)
+	test.S(t).ExpectEquals(highestCrossedThreshold(20, nil), 0.0)
+}
+
+func TestExecuteLagSLOBurnProcesses(t *testing.T) {
+	lagSLOBurnProcesses := config.Config.LagSLOBurnProcesses
+	defer func() { config.Config.LagSLOBurnProcesses = lagSLOBurnProcesses }()
+	outputFile := filepath.Join(t.TempDir(), "hooks.out")
+	config.Config.LagSLOBurnProcesses = []string{
+		fmt.Sprintf("echo {clusterAlias} {burnRate} {burnRateThreshold} {compliance} {targetRatio} $ORC_CLUSTER_NAME >> %s", outputFile),
+	}
+
+	executeLagSLOBurnProcesses(inst.LagSLOStatus{
+		ClusterName:  "db-1:3306",
+		ClusterAlias: "shop",
+		BurnRate:     7.5,
+		Compliance:   0.95,
+		TargetRatio:  0.99,
+	}, 6)
+	output, err := ioutil.ReadFile(outputFile)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(strings.TrimSpace(string(output)), "shop 7.50 6.00 0.9500 0.9900 db-1:3306")
+}
@@ -0,0 +1,71 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/openark/golib/log"
+	test "github.com/openark/golib/tests"
+)
+
+func init() {
+	config.Config.HostnameResolveMethod = "none"
+	config.MarkConfigurationLoaded()
+	log.SetLevel(log.ERROR)
+}
+
+// withSQLiteBackend points the orchestrator backend at a fresh sqlite database for the duration of given test
+func withSQLiteBackend(t *testing.T) {
+	backendDB, dataFile := config.Config.BackendDB, config.Config.SQLite3DataFile
+	config.Config.BackendDB = "sqlite"
+	config.Config.SQLite3DataFile = filepath.Join(t.TempDir(), "orchestrator.sqlite3")
+	t.Cleanup(func() {
+		config.Config.BackendDB, config.Config.SQLite3DataFile = backendDB, dataFile
+	})
+}
+
+// testServerId gives each test instance a distinct server_id
+var testServerId int64
+
+// writeTestInstance writes a minimal, freshly checked, instance onto the backend. A non-empty master key makes it a replica.
+func writeTestInstance(t *testing.T, instanceKey inst.InstanceKey, masterKey inst.InstanceKey, clusterName string) {
+	masterLogFile := ""
+	if masterKey.Hostname != "" {
+		masterLogFile = "mysql-bin.000001"
+	}
+	_, err := db.ExecOrchestrator(`
+			insert into database_instance (
+				hostname, port, last_checked, last_seen, last_check_partial_success, server_id, version, binlog_format,
+				log_bin, log_slave_updates, binary_log_file, binary_log_pos, master_host, master_port,
+				slave_sql_running, slave_io_running, master_log_file, read_master_log_pos, relay_master_log_file,
+				exec_master_log_pos, num_slave_hosts, slave_hosts, cluster_name
+			) values (
+				?, ?, now(), now(), 1, ?, '5.7.26', 'ROW',
+				1, 1, 'mysql-bin.000001', 4, ?, ?,
+				1, 1, ?, 4, ?,
+				4, 0, '[]', ?
+			)
+		`, instanceKey.Hostname, instanceKey.Port, atomic.AddInt64(&testServerId, 1), masterKey.Hostname, masterKey.Port, masterLogFile, masterLogFile, clusterName,
+	)
+	test.S(t).ExpectNil(err)
+}
@@ -0,0 +1,230 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/openark/golib/log"
+)
+
+// MasterFanOut is the evaluation of a cluster master's fan-out, along with the relocations which reduce it:
+// per data center, one direct replica of the master is elected as intermediate master, and its siblings in
+// that data center are relocated below it.
+type MasterFanOut struct {
+	ClusterName         string
+	MasterKey           inst.InstanceKey
+	CountDirectReplicas int
+	MaxReplicas         uint
+	ExceedsFanOut       bool
+	IntermediateMasters []inst.InstanceKey
+	Relocations         []TopologyDrift
+	EvaluatedAt         time.Time
+}
+
+// isFanOutIntermediateMasterCandidate checks whether a direct replica of the master may serve as intermediate master
+func isFanOutIntermediateMasterCandidate(replica *inst.Instance) bool {
+	if !replica.IsLastCheckValid || !replica.ReplicaRunning() || !replica.SlaveLagSeconds.Valid {
+		return false
+	}
+	if !replica.LogBinEnabled || !replica.LogSlaveUpdatesEnabled {
+		return false
+	}
+	if replica.SQLDelay > 0 {
+		return false
+	}
+	return !inst.IsBannedFromBeingCandidateReplica(replica)
+}
+
+// isFanOutRelocatable checks whether a direct replica of the master may be relocated below an intermediate master.
+// A semi-sync replica acknowledges the master's commits, and so stays directly below the master.
+func isFanOutRelocatable(replica *inst.Instance) bool {
+	return !replica.SemiSyncReplicaEnabled
+}
+
+// computeFanOutReduction elects an intermediate master in each data center with more than a single direct replica of
+// the master, and lists the relocations of its siblings below it. The least lagging candidate is elected. Semi-sync
+// replicas are not relocated.
+func computeFanOutReduction(master *inst.Instance, directReplicas [](*inst.Instance)) (intermediateMasters []inst.InstanceKey, relocations []TopologyDrift) {
+	intermediateMasters = []inst.InstanceKey{}
+	relocations = []TopologyDrift{}
+
+	sort.Slice(directReplicas, func(i, j int) bool {
+		return directReplicas[i].Key.StringCode() < directReplicas[j].Key.StringCode()
+	})
+	dataCenters := []string{}
+	replicasByDC := make(map[string][](*inst.Instance))
+	for _, replica := range directReplicas {
+		if _, found := replicasByDC[replica.DataCenter]; !found {
+			dataCenters = append(dataCenters, replica.DataCenter)
+		}
+		replicasByDC[replica.DataCenter] = append(replicasByDC[replica.DataCenter], replica)
+	}
+	for _, dataCenter := range dataCenters {
+		dcReplicas := replicasByDC[dataCenter]
+		if len(dcReplicas) < 2 {
+			continue
+		}
+		var intermediateMaster *inst.Instance
+		for _, replica := range dcReplicas {
+			if !isFanOutIntermediateMasterCandidate(replica) {
+				continue
+			}
+			if intermediateMaster == nil || replica.SlaveLagSeconds.Int64 < intermediateMaster.SlaveLagSeconds.Int64 {
+				intermediateMaster = replica
+			}
+		}
+		if intermediateMaster == nil {
+			log.Debugf("computeFanOutReduction: no intermediate master candidate below %+v in data center %s", master.Key, dataCenter)
+			continue
+		}
+		dcRelocations := []TopologyDrift{}
+		for _, replica := range dcReplicas {
+			if replica.Key.Equals(&intermediateMaster.Key) || !isFanOutRelocatable(replica) {
+				continue
+			}
+			dcRelocations = append(dcRelocations, TopologyDrift{Key: replica.Key, CurrentMasterKey: master.Key, ExpectedMasterKey: intermediateMaster.Key})
+		}
+		if len(dcRelocations) == 0 {
+			continue
+		}
+		intermediateMasters = append(intermediateMasters, intermediateMaster.Key)
+		relocations = append(relocations, dcRelocations...)
+	}
+	return intermediateMasters, relocations
+}
+
+// EvaluateMasterFanOut checks whether a cluster's master exceeds MasterFanOutMaxReplicas direct replicas, and if so,
+// computes the relocations which reduce its fan-out. A co-master does not count towards the fan-out.
+func EvaluateMasterFanOut(clusterName string) (*MasterFanOut, error) {
+	masters, err := inst.ReadClusterMaster(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	if len(masters) != 1 {
+		return nil, fmt.Errorf("EvaluateMasterFanOut: expected a single master for %s; found %d", clusterName, len(masters))
+	}
+	master := masters[0]
+	replicas, err := inst.ReadReplicaInstances(&master.Key)
+	if err != nil {
+		return nil, err
+	}
+	directReplicas := [](*inst.Instance){}
+	for _, replica := range replicas {
+		if master.MasterKey.Equals(&replica.Key) {
+			// co-master
+			continue
+		}
+		directReplicas = append(directReplicas, replica)
+	}
+	fanOut := &MasterFanOut{
+		ClusterName:         clusterName,
+		MasterKey:           master.Key,
+		CountDirectReplicas: len(directReplicas),
+		MaxReplicas:         config.Config.MasterFanOutMaxReplicas,
+		IntermediateMasters: []inst.InstanceKey{},
+		Relocations:         []TopologyDrift{},
+		EvaluatedAt:         time.Now(),
+	}
+	fanOut.ExceedsFanOut = fanOut.MaxReplicas > 0 && fanOut.CountDirectReplicas > int(fanOut.MaxReplicas)
+	if fanOut.ExceedsFanOut {
+		fanOut.IntermediateMasters, fanOut.Relocations = computeFanOutReduction(master, directReplicas)
+	}
+	return fanOut, nil
+}
+
+// ReduceMasterFanOut relocates direct replicas of a cluster's master below their data center's elected intermediate
+// master, given the master exceeds its fan-out. Replicas which are downtimed, not healthy, or semi-sync are skipped.
+func ReduceMasterFanOut(clusterName string) (relocated [](*inst.Instance), fanOut *MasterFanOut, err error) {
+	relocated = [](*inst.Instance){}
+	fanOut, err = EvaluateMasterFanOut(clusterName)
+	if err != nil {
+		return relocated, fanOut, err
+	}
+	if !fanOut.ExceedsFanOut {
+		return relocated, fanOut, nil
+	}
+	errs := []error{}
+	for _, relocation := range fanOut.Relocations {
+		instance, found, err := inst.ReadInstance(&relocation.Key)
+		if err != nil || !found {
+			continue
+		}
+		if instance.IsDowntimed || !instance.IsLastCheckValid || !isFanOutRelocatable(instance) {
+			log.Debugf("ReduceMasterFanOut: skipping %+v", instance.Key)
+			continue
+		}
+		instance, err = inst.RelocateBelow(&relocation.Key, &relocation.ExpectedMasterKey)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		relocated = append(relocated, instance)
+	}
+	inst.AuditOperation("reduce-master-fan-out", &fanOut.MasterKey, fmt.Sprintf("cluster %s: %d direct replicas exceed %d; intermediate masters: %+v; relocated %d out of %d replicas", clusterName, fanOut.CountDirectReplicas, fanOut.MaxReplicas, fanOut.IntermediateMasters, len(relocated), len(fanOut.Relocations)))
+	if len(errs) > 0 {
+		return relocated, fanOut, fmt.Errorf("ReduceMasterFanOut: %d relocations failed; first error: %+v", len(errs), errs[0])
+	}
+	return relocated, fanOut, nil
+}
+
+// CheckMastersFanOut evaluates the masters of all clusters against MasterFanOutMaxReplicas, and reports those exceeding it.
+// On the leader, clusters matching MasterFanOutAutoReduceClusterFilters have their master fan-out reduced. Clusters
+// which have a desired topology are left to converge onto it. Clusters which are locked, under recovery, or with an in-progress
+// schema migration suppressing topology relocations are left as they are.
+func CheckMastersFanOut() {
+	if config.Config.MasterFanOutMaxReplicas == 0 {
+		return
+	}
+	clustersInfo, err := inst.ReadClustersInfo("")
+	if err != nil {
+		log.Errore(err)
+		return
+	}
+	for _, clusterInfo := range clustersInfo {
+		if desiredTopology, err := GetClusterDesiredTopology(clusterInfo.ClusterName); err != nil || desiredTopology != NoDesiredTopology {
+			continue
+		}
+		fanOut, err := EvaluateMasterFanOut(clusterInfo.ClusterName)
+		if err != nil {
+			log.Errore(err)
+			continue
+		}
+		if !fanOut.ExceedsFanOut {
+			continue
+		}
+		log.Warningf("Master %+v of cluster %s has %d direct replicas, exceeding MasterFanOutMaxReplicas (%d)", fanOut.MasterKey, fanOut.ClusterName, fanOut.CountDirectReplicas, fanOut.MaxReplicas)
+		if !clusterInfo.HasAutomatedFanOutReduction || !IsLeader() || len(fanOut.Relocations) == 0 {
+			continue
+		}
+		if isSuppressedBySchemaMigration(clusterInfo.ClusterAlias, inst.SuppressTopologyRelocations) {
+			continue
+		}
+		if clusterLock, err := inst.ReadClusterLock(clusterInfo.ClusterAlias); err != nil || clusterLock != nil {
+			log.Debugf("CheckMastersFanOut: cluster %s is locked; not reducing fan-out", clusterInfo.ClusterName)
+			continue
+		}
+		if recoveries, err := ReadInActivePeriodClusterRecovery(clusterInfo.ClusterName); err != nil || len(recoveries) > 0 {
+			continue
+		}
+		ReduceMasterFanOut(clusterInfo.ClusterName)
+	}
+}
@@ -0,0 +1,103 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"testing"
+
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+var fanOutMasterKey = inst.InstanceKey{Hostname: "master", Port: 3306}
+
+// newFanOutReplica returns a healthy direct replica of the master, with given lag
+func newFanOutReplica(hostname string, dataCenter string, lagSeconds int64) *inst.Instance {
+	replica := inst.NewInstance()
+	replica.Key = inst.InstanceKey{Hostname: hostname, Port: 3306}
+	replica.MasterKey = fanOutMasterKey
+	replica.DataCenter = dataCenter
+	replica.ReadBinlogCoordinates = inst.BinlogCoordinates{LogFile: "mysql-bin.000001", LogPos: 4}
+	replica.Slave_SQL_Running = true
+	replica.Slave_IO_Running = true
+	replica.IsLastCheckValid = true
+	replica.LogBinEnabled = true
+	replica.LogSlaveUpdatesEnabled = true
+	replica.SlaveLagSeconds.Int64, replica.SlaveLagSeconds.Valid = lagSeconds, true
+	return replica
+}
+
+func TestComputeFanOutReduction(t *testing.T) {
+	master := inst.NewInstance()
+	master.Key = fanOutMasterKey
+
+	unknownLag := newFanOutReplica("dc1-d", "dc1", 0)
+	unknownLag.SlaveLagSeconds.Valid = false
+	noLogSlaveUpdates := newFanOutReplica("dc1-e", "dc1", 0)
+	noLogSlaveUpdates.LogSlaveUpdatesEnabled = false
+	semiSync := newFanOutReplica("dc2-b", "dc2", 5)
+	semiSync.SemiSyncReplicaEnabled = true
+	stopped := newFanOutReplica("dc3-a", "dc3", 0)
+	stopped.Slave_SQL_Running = false
+
+	directReplicas := [](*inst.Instance){
+		newFanOutReplica("dc1-a", "dc1", 5),
+		newFanOutReplica("dc1-b", "dc1", 2),
+		newFanOutReplica("dc1-c", "dc1", 9),
+		unknownLag,
+		noLogSlaveUpdates,
+		newFanOutReplica("dc2-a", "dc2", 3),
+		semiSync,
+		stopped,
+		newFanOutReplica("dc3-b", "dc3", 4),
+		newFanOutReplica("dc4-a", "dc4", 0),
+	}
+	intermediateMasters, relocations := computeFanOutReduction(master, directReplicas)
+
+	// dc1: the least lagging candidate with known lag is elected; the other candidates are relocated below it.
+	// dc2: the only sibling is semi-sync and stays put, so there is nothing to reduce.
+	// dc3: the stopped replica is not a candidate, yet is relocated.
+	// dc4: a single replica
+	test.S(t).ExpectEquals(len(intermediateMasters), 2)
+	test.S(t).ExpectEquals(intermediateMasters[0].Hostname, "dc1-b")
+	test.S(t).ExpectEquals(intermediateMasters[1].Hostname, "dc3-b")
+
+	relocated := map[string]string{}
+	for _, relocation := range relocations {
+		test.S(t).ExpectTrue(relocation.CurrentMasterKey.Equals(&fanOutMasterKey))
+		relocated[relocation.Key.Hostname] = relocation.ExpectedMasterKey.Hostname
+	}
+	test.S(t).ExpectEquals(len(relocated), 5)
+	for _, hostname := range []string{"dc1-a", "dc1-c", "dc1-d", "dc1-e"} {
+		test.S(t).ExpectEquals(relocated[hostname], "dc1-b")
+	}
+	test.S(t).ExpectEquals(relocated["dc3-a"], "dc3-b")
+}
+
+func TestComputeFanOutReductionNoCandidate(t *testing.T) {
+	master := inst.NewInstance()
+	master.Key = fanOutMasterKey
+
+	delayed := newFanOutReplica("dc1-a", "dc1", 0)
+	delayed.SQLDelay = 3600
+	unknownLag := newFanOutReplica("dc1-b", "dc1", 0)
+	unknownLag.SlaveLagSeconds.Valid = false
+
+	intermediateMasters, relocations := computeFanOutReduction(master, [](*inst.Instance){delayed, unknownLag})
+	test.S(t).ExpectEquals(len(intermediateMasters), 0)
+	test.S(t).ExpectEquals(len(relocations), 0)
+}
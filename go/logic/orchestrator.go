@@ -29,6 +29,7 @@ import (
 	"github.com/github/orchestrator/go/agent"
 	"github.com/github/orchestrator/go/collection"
 	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
 	"github.com/github/orchestrator/go/discovery"
 	"github.com/github/orchestrator/go/inst"
 	"github.com/github/orchestrator/go/kv"
@@ -115,14 +116,14 @@ func IsLeader() bool {
 	if orcraft.IsRaftEnabled() {
 		return orcraft.IsLeader()
 	}
-	return atomic.LoadInt64(&isElectedNode) == 1
+	return atomic.LoadInt64(&isElectedNode) == 1 && process.IsLeaderLeaseValid()
 }
 
 func IsLeaderOrActive() bool {
 	if orcraft.IsRaftEnabled() {
 		return orcraft.IsPartOfQuorum()
 	}
-	return atomic.LoadInt64(&isElectedNode) == 1
+	return atomic.LoadInt64(&isElectedNode) == 1 && process.IsLeaderLeaseValid()
 }
 
 // used in several places
@@ -147,24 +148,58 @@ func acceptSignals() {
 			case syscall.SIGTERM:
 				log.Infof("Received SIGTERM. Shutting down orchestrator")
 				discoveryMetrics.StopAutoExpiration()
-				// probably should poke other go routines to stop cleanly here ...
 				inst.AuditOperation("shutdown", nil, "Triggered via SIGTERM")
+				drainAndResign()
 				os.Exit(0)
 			}
 		}
 	}()
 }
 
+// drainAndResign is called upon shutdown. It waits for in-flight recoveries and API operations to complete,
+// meanwhile rejecting new ones, then flushes buffered backend writes and resigns leadership.
+func drainAndResign() {
+	drainTimeout := time.Duration(config.Config.ShutdownDrainTimeoutSeconds) * time.Second
+	log.Infof("Draining in-flight operations; timeout: %+v", drainTimeout)
+	if !process.DrainInFlightOperations(drainTimeout, getCountPendingRecoveries) {
+		inst.AuditOperation("shutdown", nil, "Drain timeout reached with operations still in flight")
+	}
+	log.Infof("Flushing instance write buffer")
+	inst.FlushInstanceWriteBuffer()
+	PersistDiscoveryMetrics()
+	if !inst.HostnameResolveMethodIsNone() {
+		log.Infof("Flushing hostname resolve cache")
+		inst.FlushNontrivialResolveCacheToDatabase()
+	}
+
+	if !IsLeader() {
+		return
+	}
+	log.Infof("Resigning leadership")
+	if orcraft.IsRaftEnabled() {
+		log.Errore(orcraft.Yield())
+	} else {
+		process.Reelect()
+	}
+}
+
 // handleDiscoveryRequests iterates the discoveryQueue channel and calls upon
 // instance discovery per entry.
 func handleDiscoveryRequests() {
 	discoveryQueue = discovery.CreateOrReturnQueue("DEFAULT")
 
-	// create a pool of discovery workers
+	// create a pool of discovery workers. With DiscoveryAutoTune, only some of them may be active
+	atomic.StoreInt64(&discoveryWorkers, int64(config.Config.DiscoveryMaxConcurrency))
+	atomic.StoreInt64(&effectiveDiscoveryConcurrency, int64(config.Config.DiscoveryMaxConcurrency))
 	for i := uint(0); i < config.Config.DiscoveryMaxConcurrency; i++ {
+		workerIndex := int64(i)
 		go func() {
 			for {
-				instanceKey := discoveryQueue.Consume()
+				if !isDiscoveryWorkerActive(workerIndex) {
+					time.Sleep(time.Second)
+					continue
+				}
+				instanceKey, queueWaitTime := discoveryQueue.ConsumeWithWaitTime()
 				// Possibly this used to be the elected node, but has
 				// been demoted, while still the queue is full.
 				if !IsLeaderOrActive() {
@@ -174,7 +209,7 @@ func handleDiscoveryRequests() {
 					continue
 				}
 
-				DiscoverInstance(instanceKey)
+				discoverInstance(instanceKey, queueWaitTime)
 				discoveryQueue.Release(instanceKey)
 			}
 		}()
@@ -185,6 +220,11 @@ func handleDiscoveryRequests() {
 // it is already up to date) and will also ensure that its master and
 // replicas (if any) are also checked.
 func DiscoverInstance(instanceKey inst.InstanceKey) {
+	discoverInstance(instanceKey, 0)
+}
+
+// discoverInstance discovers an instance, given the time the request spent waiting on the discovery queue
+func discoverInstance(instanceKey inst.InstanceKey, queueWaitTime time.Duration) {
 	if inst.InstanceIsForgotten(&instanceKey) {
 		log.Debugf("discoverInstance: skipping discovery of %+v because it is set to be forgotten", instanceKey)
 		return
@@ -192,7 +232,8 @@ func DiscoverInstance(instanceKey inst.InstanceKey) {
 	// create stopwatch entries
 	latency := stopwatch.NewNamedStopwatch()
 	latency.AddMany([]string{
-		"backend",
+		"backend_read",
+		"backend_write",
 		"instance",
 		"total"})
 	latency.Start("total") // start the total stopwatch (not changed anywhere else)
@@ -219,33 +260,57 @@ func DiscoverInstance(instanceKey inst.InstanceKey) {
 		return
 	}
 
-	latency.Start("backend")
+	latency.Start("backend_read")
 	instance, found, err := inst.ReadInstance(&instanceKey)
-	latency.Stop("backend")
+	latency.Stop("backend_read")
 	if found && instance.IsUpToDate && instance.IsLastCheckValid {
 		// we've already discovered this one. Skip!
 		return
 	}
+	if found && instance.IsDiscoveryPaused {
+		// Discovery of this instance's cluster is paused. Skip!
+		return
+	}
+	if found && instance.IsDiscoveryShed && !inst.IsDiscoveryShedPollDue(instance) {
+		// Shed due to discovery backpressure, and probed recently enough. Skip!
+		return
+	}
+	if found && inst.IsPollingRelaxed(instance) {
+		// Flagged as not to be polled aggressively, and polled recently enough. Skip!
+		return
+	}
 
 	discoveriesCounter.Inc(1)
+	previousInstance := instance
 
 	// First we've ever heard of this instance. Continue investigation:
-	instance, err = inst.ReadTopologyInstanceBufferable(&instanceKey, config.Config.BufferInstanceWrites, latency)
+	var rowsWritten int
+	if found && inst.IsLightweightProbeEligible(instance) {
+		instance, rowsWritten, err = inst.ReadTopologyInstanceLightweight(previousInstance, config.Config.BufferInstanceWrites, latency)
+	} else {
+		instance, rowsWritten, err = inst.ReadTopologyInstanceBufferable(&instanceKey, config.Config.BufferInstanceWrites, latency)
+	}
 	// panic can occur (IO stuff). Therefore it may happen
 	// that instance is nil. Check it, but first get the timing metrics.
 	totalLatency := latency.Elapsed("total")
-	backendLatency := latency.Elapsed("backend")
+	backendReadLatency := latency.Elapsed("backend_read")
+	backendWriteLatency := latency.Elapsed("backend_write")
+	backendLatency := backendReadLatency + backendWriteLatency
 	instanceLatency := latency.Elapsed("instance")
 
 	if instance == nil {
 		failedDiscoveriesCounter.Inc(1)
+		recordProbeOutcome(instanceKey, false)
 		discoveryMetrics.Append(&discovery.Metric{
-			Timestamp:       time.Now(),
-			InstanceKey:     instanceKey,
-			TotalLatency:    totalLatency,
-			BackendLatency:  backendLatency,
-			InstanceLatency: instanceLatency,
-			Err:             err,
+			Timestamp:           time.Now(),
+			InstanceKey:         instanceKey,
+			QueueWaitLatency:    queueWaitTime,
+			TotalLatency:        totalLatency,
+			BackendLatency:      backendLatency,
+			BackendReadLatency:  backendReadLatency,
+			BackendWriteLatency: backendWriteLatency,
+			InstanceLatency:     instanceLatency,
+			Err:                 err,
 		})
 		if util.ClearToLog("discoverInstance", instanceKey.StringCode()) {
 			log.Warningf(" DiscoverInstance(%+v) instance is nil in %.3fs (Backend: %.3fs, Instance: %.3fs), error=%+v",
@@ -257,15 +322,24 @@ func DiscoverInstance(instanceKey inst.InstanceKey) {
 		}
 		return
 	}
+	recordProbeOutcome(instanceKey, true)
 
 	discoveryMetrics.Append(&discovery.Metric{
-		Timestamp:       time.Now(),
-		InstanceKey:     instanceKey,
-		TotalLatency:    totalLatency,
-		BackendLatency:  backendLatency,
-		InstanceLatency: instanceLatency,
-		Err:             nil,
+		Timestamp:           time.Now(),
+		InstanceKey:         instanceKey,
+		QueueWaitLatency:    queueWaitTime,
+		TotalLatency:        totalLatency,
+		BackendLatency:      backendLatency,
+		BackendReadLatency:  backendReadLatency,
+		BackendWriteLatency: backendWriteLatency,
+		InstanceLatency:     instanceLatency,
+		ReplicaRowsWritten:  rowsWritten,
+		Err:                 nil,
 	})
+	recordDiscoveryStateEvents(previousInstance, found, instance)
+	auditSemiSyncAsyncFallback(previousInstance, instance)
+	inst.RecordInstanceLag(instance)
+	captureDeadMasterPostmortem(instance)
 
 	if !IsLeaderOrActive() {
 		// Maybe this node was elected before, but isn't elected anymore.
@@ -310,6 +384,13 @@ func onHealthTick() {
 			orcraft.FatalRaftError(fmt.Errorf("Node is unable to register health. Please check database connnectivity."))
 		}
 	}
+	if !db.IsBackendAvailable() {
+		// Degraded mode: with no writable backend, this node can neither hold the election nor record its findings
+		if !orcraft.IsRaftEnabled() {
+			atomic.StoreInt64(&isElectedNode, 0)
+		}
+		return
+	}
 	if !orcraft.IsRaftEnabled() {
 		myIsElectedNode, err := process.AttemptElection()
 		if err != nil {
@@ -357,7 +438,7 @@ func onHealthTick() {
 	if len(instanceKeys) > 0 {
 		for _, instanceKey := range instanceKeys {
 			if instanceKey.IsValid() {
-				discoveryQueue.Push(instanceKey)
+				pushOutdatedInstanceKey(instanceKey)
 			}
 		}
 	}
@@ -415,6 +496,7 @@ func ContinuousDiscovery() {
 	recentDiscoveryOperationKeys = cache.New(instancePollSecondsDuration(), time.Second)
 
 	inst.LoadHostnameResolveCache()
+	ValidatePromotionStrategies()
 	go handleDiscoveryRequests()
 
 	healthTick := time.Tick(config.HealthPollSeconds * time.Second)
@@ -428,16 +510,25 @@ func ContinuousDiscovery() {
 	if config.Config.SnapshotTopologiesIntervalHours > 0 {
 		snapshotTopologiesTick = time.Tick(time.Duration(config.Config.SnapshotTopologiesIntervalHours) * time.Hour)
 	}
+	var binlogCheckpointTick <-chan time.Time
+	if config.Config.BinlogCheckpointIntervalSeconds > 0 {
+		binlogCheckpointTick = time.Tick(time.Duration(config.Config.BinlogCheckpointIntervalSeconds) * time.Second)
+	}
 
 	go ometrics.InitMetrics()
 	go ometrics.InitGraphiteMetrics()
 	go acceptSignals()
 	go kv.InitKVStores()
+	go db.ContinuousBackendHealthCheck()
+	go ContinuousStateEventsPublishing()
+	go ContinuousErrorLogChecks()
+	go ContinuousDiscoveryMetricsPersistence()
 	if config.Config.RaftEnabled {
 		if err := orcraft.Setup(NewCommandApplier(), NewSnapshotDataCreatorApplier(), process.ThisHostname); err != nil {
 			log.Fatale(err)
 		}
 		go orcraft.Monitor()
+		go ContinuousProbeOutcomesReporting()
 	}
 
 	if *config.RuntimeCLIFlags.GrabElection {
@@ -459,6 +550,8 @@ func ContinuousDiscovery() {
 				if IsLeaderOrActive() {
 					go inst.UpdateClusterAliases()
 					go inst.ExpireDowntime()
+					go CheckDiscoveryBackpressure()
+					go AutoTuneDiscovery()
 				}
 			}()
 		case <-autoPseudoGTIDTick:
@@ -482,6 +575,10 @@ func ContinuousDiscovery() {
 					go inst.ResolveUnknownMasterHostnameResolves()
 					go inst.ExpireMaintenance()
 					go inst.ExpireCandidateInstances()
+					go inst.ExpireCandidatePromotionRuleOverrides()
+					go inst.ExpireClusterLocks()
+					go inst.ExpireClusterDiscoveryPauses()
+					go inst.ExpireClusterSchemaMigrations()
 					go inst.ExpireHostnameUnresolve()
 					go inst.ExpireClusterDomainName()
 					go inst.ExpireAudit()
@@ -489,12 +586,39 @@ func ContinuousDiscovery() {
 					go inst.ExpirePoolInstances()
 					go inst.FlushNontrivialResolveCacheToDatabase()
 					go inst.ExpireInjectedPseudoGTID()
+					go inst.ExpireBinlogCheckpoints()
+					go inst.ExpireErrorLogEvents()
 					go process.ExpireNodesHistory()
 					go process.ExpireAccessTokens()
 					go process.ExpireAvailableNodes()
 					go ExpireFailureDetectionHistory()
 					go ExpireTopologyRecoveryHistory()
 					go ExpireTopologyRecoveryStepsHistory()
+					go ExpireTopologyRecoveryBundleHistory()
+					go ExpireDeadMasterPostmortemWatches()
+					go ExpireRecoveryApprovalHistory()
+					go ExpireRecoveryAbortRequests()
+					go ExpireScheduledRevertHistory()
+					go ExpireInstanceDecommissionHistory()
+					go ExpireRecoveryTimings()
+					go ExpireExternalHealthChecks()
+					go CheckSlowDiscoveryOutliers()
+					go CheckTopologyPrivileges()
+					go CheckTopologiesConformance()
+					go CheckMastersFanOut()
+					go DiscoverSelfCluster()
+					go CheckReadOnlyEnforcement()
+					go CheckUnreconciledReplicas()
+					go ReconcileMasterServiceRecords(false)
+					go CheckLagSLOs()
+					go inst.ExpireClusterLagSamples()
+					go inst.ExpireStateEvents()
+					go inst.ExpireAnalysisHistory()
+					go ResumeExpiredSQLDelaySuspensions()
+					go RunDueScheduledReverts()
+					go RunDueDecommissions()
+					go ManagePools()
+					go CheckEmailDigest()
 				} else {
 					// Take this opportunity to refresh yourself
 					go inst.LoadHostnameResolveCache()
@@ -512,6 +636,7 @@ func ContinuousDiscovery() {
 					go ExpireBlockedRecoveries()
 					go AcknowledgeCrashedRecoveries()
 					go inst.ExpireInstanceAnalysisChangelog()
+					go PreElectPromotionCandidates()
 
 					go func() {
 						// This function is non re-entrant (it can only be running once at any point in time)
@@ -534,6 +659,12 @@ func ContinuousDiscovery() {
 					go inst.SnapshotTopologies()
 				}
 			}()
+		case <-binlogCheckpointTick:
+			go func() {
+				if IsLeaderOrActive() {
+					go inst.WriteBinlogCheckpoints()
+				}
+			}()
 		}
 	}
 }
@@ -563,6 +694,7 @@ func ContinuousAgentsPoll() {
 	go discoverSeededAgents()
 
 	tick := time.Tick(config.HealthPollSeconds * time.Second)
+	backupsTick := time.Tick(time.Minute)
 	caretakingTick := time.Tick(time.Hour)
 	for range tick {
 		agentsHosts, _ := agent.ReadOutdatedAgentsHosts()
@@ -570,10 +702,18 @@ func ContinuousAgentsPoll() {
 		for _, hostname := range agentsHosts {
 			go pollAgent(hostname)
 		}
+		select {
+		case <-backupsTick:
+			if IsLeaderOrActive() {
+				go ScheduleBackups()
+			}
+		default:
+		}
 		// See if we should also forget agents (lower frequency)
 		select {
 		case <-caretakingTick:
 			agent.ForgetLongUnseenAgents()
+			agent.ExpireAgentEnrollment()
 			agent.FailStaleSeeds()
 		default:
 		}
@@ -0,0 +1,56 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	orcraft "github.com/github/orchestrator/go/raft"
+)
+
+// PinClusterMaster pins an instance as the only master allowed for its cluster
+func PinClusterMaster(pinnedMaster *inst.ClusterPinnedMaster) error {
+	if orcraft.IsRaftEnabled() {
+		_, err := orcraft.PublishCommand("pin-master", pinnedMaster)
+		return err
+	}
+	return inst.WriteClusterPinnedMaster(pinnedMaster)
+}
+
+// UnpinClusterMaster lets automated recoveries promote any eligible instance of a cluster, given its alias
+func UnpinClusterMaster(clusterAlias string) error {
+	if orcraft.IsRaftEnabled() {
+		_, err := orcraft.PublishCommand("unpin-master", clusterAlias)
+		return err
+	}
+	return inst.DeleteClusterPinnedMaster(clusterAlias)
+}
+
+// withholdUnpinnedMasterPromotion is called when an automated master recovery ends up with a promoted replica other
+// than the cluster's pinned master. The replicas remain regrouped below the promoted replica, which serves as an
+// intermediate master: it is neither made writable nor advertised as master. PinnedMasterRecoveryProcesses alert
+// for human action.
+func withholdUnpinnedMasterPromotion(topologyRecovery *TopologyRecovery, pinnedMaster *inst.ClusterPinnedMaster, promotedReplica *inst.Instance, skipProcesses bool) {
+	message := fmt.Sprintf("RecoverDeadMaster: %+v is not the pinned master %+v; withholding promotion. Replicas are regrouped below %+v as intermediate master. Human action required", promotedReplica.Key, pinnedMaster.Key, promotedReplica.Key)
+	AuditTopologyRecovery(topologyRecovery, message)
+	inst.AuditOperation("recover-dead-master", &topologyRecovery.AnalysisEntry.AnalyzedInstanceKey, message)
+	if !skipProcesses {
+		executeProcesses(config.Config.PinnedMasterRecoveryProcesses, "PinnedMasterRecoveryProcesses", topologyRecovery, false)
+	}
+}
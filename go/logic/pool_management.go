@@ -0,0 +1,212 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/github/orchestrator/go/kv"
+	"github.com/github/orchestrator/go/raft"
+	"github.com/openark/golib/log"
+)
+
+// SetPoolSpec declares a managed pool
+func SetPoolSpec(spec *inst.PoolSpec) error {
+	if orcraft.IsRaftEnabled() {
+		_, err := orcraft.PublishCommand("write-pool-spec", spec)
+		return err
+	}
+	return inst.WritePoolSpec(spec)
+}
+
+// ClearPoolSpec removes a managed pool declaration
+func ClearPoolSpec(clusterName string, pool string) error {
+	if orcraft.IsRaftEnabled() {
+		_, err := orcraft.PublishCommand("delete-pool-spec", inst.PoolSpec{ClusterName: clusterName, Pool: pool})
+		return err
+	}
+	return inst.DeletePoolSpec(clusterName, pool)
+}
+
+// isHealthyPoolMember checks whether an instance may serve as a member of given pool
+func isHealthyPoolMember(spec *inst.PoolSpec, instance *inst.Instance) bool {
+	if !instance.IsLastCheckValid || instance.IsDowntimed {
+		return false
+	}
+	if !instance.IsReplica() || !instance.ReplicaRunning() {
+		return false
+	}
+	if spec.MaxLagSeconds > 0 {
+		if !instance.SlaveLagSeconds.Valid || instance.SlaveLagSeconds.Int64 > int64(spec.MaxLagSeconds) {
+			return false
+		}
+	}
+	return true
+}
+
+// computePoolMembershipChange evicts unhealthy or lagging members off a pool, and, if so specified, backfills the pool
+// with healthy read-only replicas, least lagging first, up to the pool's desired size.
+func computePoolMembershipChange(spec *inst.PoolSpec, memberKeys [](*inst.InstanceKey), clusterInstances [](*inst.Instance)) *inst.PoolMembershipChange {
+	change := &inst.PoolMembershipChange{
+		ClusterName: spec.ClusterName,
+		Pool:        spec.Pool,
+		Members:     []inst.InstanceKey{},
+		Added:       []inst.InstanceKey{},
+		Removed:     []inst.InstanceKey{},
+	}
+	instancesMap := make(map[inst.InstanceKey]*inst.Instance)
+	for _, instance := range clusterInstances {
+		instancesMap[instance.Key] = instance
+	}
+	isMember := make(map[inst.InstanceKey]bool)
+	for _, memberKey := range memberKeys {
+		isMember[*memberKey] = true
+		if instance, found := instancesMap[*memberKey]; found && isHealthyPoolMember(spec, instance) {
+			change.Members = append(change.Members, *memberKey)
+		} else {
+			change.Removed = append(change.Removed, *memberKey)
+		}
+	}
+	if !spec.AutoBackfill || uint(len(change.Members)) >= spec.DesiredSize {
+		return change
+	}
+	candidates := [](*inst.Instance){}
+	for _, instance := range clusterInstances {
+		if isMember[instance.Key] || !instance.ReadOnly || !isHealthyPoolMember(spec, instance) {
+			continue
+		}
+		candidates = append(candidates, instance)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].SlaveLagSeconds.Int64 != candidates[j].SlaveLagSeconds.Int64 {
+			return candidates[i].SlaveLagSeconds.Int64 < candidates[j].SlaveLagSeconds.Int64
+		}
+		return candidates[i].Key.StringCode() < candidates[j].Key.StringCode()
+	})
+	for _, candidate := range candidates {
+		if uint(len(change.Members)) >= spec.DesiredSize {
+			break
+		}
+		change.Members = append(change.Members, candidate.Key)
+		change.Added = append(change.Added, candidate.Key)
+	}
+	return change
+}
+
+// GetPoolMembershipChange evaluates a managed pool and returns the membership orchestrator would apply
+func GetPoolMembershipChange(spec *inst.PoolSpec) (*inst.PoolMembershipChange, error) {
+	clusterPoolInstances, err := inst.ReadClusterPoolInstances(spec.ClusterName, spec.Pool)
+	if err != nil {
+		return nil, err
+	}
+	memberKeys := [](*inst.InstanceKey){}
+	for _, clusterPoolInstance := range clusterPoolInstances {
+		if clusterPoolInstance.Pool == spec.Pool {
+			memberKeys = append(memberKeys, &inst.InstanceKey{Hostname: clusterPoolInstance.Hostname, Port: clusterPoolInstance.Port})
+		}
+	}
+	clusterInstances, err := inst.ReadClusterInstances(spec.ClusterName)
+	if err != nil {
+		return nil, err
+	}
+	change := computePoolMembershipChange(spec, memberKeys, clusterInstances)
+	change.ClusterAlias, _ = inst.ReadAliasByClusterName(spec.ClusterName)
+	return change, nil
+}
+
+func instanceKeysToCommaDelimitedList(instanceKeys []inst.InstanceKey) string {
+	tokens := []string{}
+	for _, instanceKey := range instanceKeys {
+		tokens = append(tokens, instanceKey.StringCode())
+	}
+	return strings.Join(tokens, ",")
+}
+
+// getPoolKVPair returns the KV entry of a pool's membership
+func getPoolKVPair(change *inst.PoolMembershipChange) *kv.KVPair {
+	clusterAlias := change.ClusterAlias
+	if clusterAlias == "" {
+		clusterAlias = change.ClusterName
+	}
+	key := fmt.Sprintf("%s%s/%s", config.Config.KVPoolPrefix, clusterAlias, change.Pool)
+	return kv.NewKVPair(key, instanceKeysToCommaDelimitedList(change.Members))
+}
+
+// notifyPoolMembershipChange publishes a pool's new membership onto KV stores and runs the configured hooks
+func notifyPoolMembershipChange(change *inst.PoolMembershipChange) {
+	if config.Config.KVPoolPrefix != "" {
+		kvPair := getPoolKVPair(change)
+		if orcraft.IsRaftEnabled() {
+			_, err := orcraft.PublishCommand("put-key-value", kvPair)
+			log.Errore(err)
+		} else {
+			log.Errore(kv.PutKVPair(kvPair))
+		}
+	}
+	executeEventProcesses(config.Config.PostPoolMembershipChangeProcesses, "PostPoolMembershipChangeProcesses", []hookVariable{
+		{"clusterName", "ORC_CLUSTER_NAME", change.ClusterName},
+		{"clusterAlias", "ORC_CLUSTER_ALIAS", change.ClusterAlias},
+		{"pool", "ORC_POOL", change.Pool},
+		{"poolInstances", "ORC_POOL_INSTANCES", instanceKeysToCommaDelimitedList(change.Members)},
+		{"addedInstances", "ORC_ADDED_INSTANCES", instanceKeysToCommaDelimitedList(change.Added)},
+		{"removedInstances", "ORC_REMOVED_INSTANCES", instanceKeysToCommaDelimitedList(change.Removed)},
+	})
+}
+
+// ManagePool evaluates a managed pool and applies its new membership. Members of the pool get their
+// registration refreshed, such that they do not expire.
+func ManagePool(spec *inst.PoolSpec) (*inst.PoolMembershipChange, error) {
+	change, err := GetPoolMembershipChange(spec)
+	if err != nil {
+		return change, err
+	}
+	if orcraft.IsRaftEnabled() {
+		_, err = orcraft.PublishCommand("apply-pool-membership-change", change)
+	} else {
+		err = inst.ApplyPoolMembershipChange(change)
+	}
+	if err != nil {
+		return change, err
+	}
+	if change.HasChanges() {
+		inst.AuditOperation("manage-pool", nil, fmt.Sprintf("cluster %s pool %s: added %s; removed %s", change.ClusterName, change.Pool, instanceKeysToCommaDelimitedList(change.Added), instanceKeysToCommaDelimitedList(change.Removed)))
+		notifyPoolMembershipChange(change)
+	}
+	if uint(len(change.Members)) < spec.DesiredSize {
+		log.Warningf("ManagePool: cluster %s pool %s has %d members; desired size is %d", spec.ClusterName, spec.Pool, len(change.Members), spec.DesiredSize)
+	}
+	return change, nil
+}
+
+// ManagePools evaluates and applies membership of all managed pools
+func ManagePools() {
+	specs, err := inst.ReadPoolSpecs("")
+	if err != nil {
+		log.Errore(err)
+		return
+	}
+	for _, spec := range specs {
+		spec := spec
+		if _, err := ManagePool(&spec); err != nil {
+			log.Errore(err)
+		}
+	}
+}
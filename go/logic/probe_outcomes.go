@@ -0,0 +1,172 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"sync"
+	"time"
+
+	"github.com/github/orchestrator/go/inst"
+	"github.com/github/orchestrator/go/process"
+	orcraft "github.com/github/orchestrator/go/raft"
+	"github.com/openark/golib/log"
+)
+
+const (
+	// probeOutcomesRefreshInterval is the interval at which a node reports all of its probe outcomes, changed or not
+	probeOutcomesRefreshInterval = 10 * time.Minute
+	// probeOutcomesExpiry is the time after which an unreported probe outcome is removed
+	probeOutcomesExpiry = 3 * probeOutcomesRefreshInterval
+	// probeOutcomesBatchSize is the max number of probe outcomes replicated by a single raft command
+	probeOutcomesBatchSize = 500
+)
+
+// probeOutcome is the outcome of this node's latest probe of an instance
+type probeOutcome struct {
+	isReachable bool
+	since       time.Time
+	probedAt    time.Time
+	isReported  bool
+}
+
+var probeOutcomes = make(map[inst.InstanceKey]*probeOutcome)
+var probeOutcomesMutex sync.Mutex
+var probeOutcomesLastRefresh time.Time
+
+// recordProbeOutcome tracks the outcome of this node's probe of an instance. Only changed outcomes are reported
+// right away; others are reported every probeOutcomesRefreshInterval.
+func recordProbeOutcome(instanceKey inst.InstanceKey, isReachable bool) {
+	if !orcraft.IsRaftEnabled() {
+		return
+	}
+	probeOutcomesMutex.Lock()
+	defer probeOutcomesMutex.Unlock()
+
+	now := time.Now()
+	outcome, found := probeOutcomes[instanceKey]
+	if !found || outcome.isReachable != isReachable {
+		outcome = &probeOutcome{isReachable: isReachable, since: now}
+		probeOutcomes[instanceKey] = outcome
+	}
+	outcome.probedAt = now
+}
+
+// collectProbeOutcomes lists the probe outcomes due for reporting, and forgets those of instances no longer probed.
+// Upon refresh, all outcomes are due. Outcomes remain due until marked reported.
+func collectProbeOutcomes(refresh bool) (outcomes []inst.InstanceProbeOutcome) {
+	probeOutcomesMutex.Lock()
+	defer probeOutcomesMutex.Unlock()
+
+	now := time.Now()
+	for instanceKey, outcome := range probeOutcomes {
+		if now.Sub(outcome.probedAt) > probeOutcomesExpiry {
+			delete(probeOutcomes, instanceKey)
+			continue
+		}
+		if refresh {
+			outcome.isReported = false
+		}
+		if outcome.isReported {
+			continue
+		}
+		outcomes = append(outcomes, inst.InstanceProbeOutcome{
+			Key:              instanceKey,
+			OrchestratorNode: process.ThisHostname,
+			IsReachable:      outcome.isReachable,
+			Since:            outcome.since,
+			ReportedAt:       now,
+		})
+	}
+	return outcomes
+}
+
+// markProbeOutcomesReported notes given outcomes as reported, unless they have since changed
+func markProbeOutcomesReported(outcomes []inst.InstanceProbeOutcome) {
+	probeOutcomesMutex.Lock()
+	defer probeOutcomesMutex.Unlock()
+
+	for _, reported := range outcomes {
+		if outcome, found := probeOutcomes[reported.Key]; found && outcome.isReachable == reported.IsReachable && outcome.since.Equal(reported.Since) {
+			outcome.isReported = true
+		}
+	}
+}
+
+// sendProbeOutcomes sends given outcomes in batches, marking each batch reported once sent. It stops at the first
+// failing batch: the outcomes not sent remain due, and are sent on the next attempt.
+func sendProbeOutcomes(outcomes []inst.InstanceProbeOutcome, send func(batch []inst.InstanceProbeOutcome) error) error {
+	for len(outcomes) > 0 {
+		batch := outcomes
+		if len(batch) > probeOutcomesBatchSize {
+			batch = outcomes[:probeOutcomesBatchSize]
+		}
+		outcomes = outcomes[len(batch):]
+		if err := send(batch); err != nil {
+			return err
+		}
+		markProbeOutcomesReported(batch)
+	}
+	return nil
+}
+
+// PublishProbeOutcomes replicates given probe outcomes to all raft nodes. It is only applicable on the leader,
+// which publishes its own outcomes as well as those reported to it by followers.
+func PublishProbeOutcomes(outcomes []inst.InstanceProbeOutcome) error {
+	_, err := orcraft.PublishCommand("write-instance-probe-outcomes", outcomes)
+	return err
+}
+
+// ReportProbeOutcomes replicates this node's changed probe outcomes to all raft nodes, via the leader. Every
+// probeOutcomesRefreshInterval, all outcomes are reported, and outcomes which were not reported for
+// probeOutcomesExpiry are removed. Outcomes which fail to be sent, e.g. while the leader cannot be reached, are
+// retried on the next run.
+func ReportProbeOutcomes() {
+	if !orcraft.IsRaftEnabled() {
+		return
+	}
+	if !orcraft.IsLeader() && !orcraft.IsHealthRequested() {
+		// Not yet known to the leader
+		return
+	}
+	refresh := time.Since(probeOutcomesLastRefresh) >= probeOutcomesRefreshInterval
+	if refresh {
+		probeOutcomesLastRefresh = time.Now()
+		if err := inst.ExpireInstanceProbeOutcomes(int64(probeOutcomesExpiry.Seconds())); err != nil {
+			return
+		}
+	}
+	send := func(batch []inst.InstanceProbeOutcome) error {
+		if orcraft.IsLeader() {
+			return PublishProbeOutcomes(batch)
+		}
+		return orcraft.PostToRaftLeader("raft-probe-outcomes", batch)
+	}
+	if err := sendProbeOutcomes(collectProbeOutcomes(refresh), send); err != nil {
+		log.Errorf("ReportProbeOutcomes: %+v", err)
+	}
+}
+
+// ContinuousProbeOutcomesReporting reports this node's probe outcomes every second
+func ContinuousProbeOutcomesReporting() {
+	if !orcraft.IsRaftEnabled() {
+		return
+	}
+	reportTick := time.Tick(time.Second)
+	for range reportTick {
+		ReportProbeOutcomes()
+	}
+}
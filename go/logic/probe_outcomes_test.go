@@ -0,0 +1,85 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+// withProbeOutcomes sets this node's probe outcomes of given number of instances, all reachable
+func withProbeOutcomes(t *testing.T, count int) {
+	probeOutcomesMutex.Lock()
+	defer probeOutcomesMutex.Unlock()
+
+	probeOutcomes = make(map[inst.InstanceKey]*probeOutcome)
+	now := time.Now()
+	for i := 0; i < count; i++ {
+		instanceKey := inst.InstanceKey{Hostname: fmt.Sprintf("probed-%d", i), Port: 3306}
+		probeOutcomes[instanceKey] = &probeOutcome{isReachable: true, since: now, probedAt: now}
+	}
+	t.Cleanup(func() {
+		probeOutcomesMutex.Lock()
+		defer probeOutcomesMutex.Unlock()
+		probeOutcomes = make(map[inst.InstanceKey]*probeOutcome)
+	})
+}
+
+func TestSendProbeOutcomes(t *testing.T) {
+	withProbeOutcomes(t, probeOutcomesBatchSize+10)
+	sentBatches := 0
+	failSecondBatch := func(batch []inst.InstanceProbeOutcome) error {
+		sentBatches++
+		if sentBatches == 2 {
+			return fmt.Errorf("leader unreachable")
+		}
+		return nil
+	}
+	outcomes := collectProbeOutcomes(false)
+	test.S(t).ExpectEquals(len(outcomes), probeOutcomesBatchSize+10)
+	test.S(t).ExpectNotNil(sendProbeOutcomes(outcomes, failSecondBatch))
+
+	// Only the sent batch is reported; the rest remain due
+	outcomes = collectProbeOutcomes(false)
+	test.S(t).ExpectEquals(len(outcomes), 10)
+	test.S(t).ExpectNil(sendProbeOutcomes(outcomes, func(batch []inst.InstanceProbeOutcome) error { return nil }))
+	test.S(t).ExpectEquals(len(collectProbeOutcomes(false)), 0)
+
+	// A refresh reports all outcomes
+	test.S(t).ExpectEquals(len(collectProbeOutcomes(true)), probeOutcomesBatchSize+10)
+}
+
+func TestMarkProbeOutcomesReported(t *testing.T) {
+	withProbeOutcomes(t, 2)
+	outcomes := collectProbeOutcomes(false)
+	test.S(t).ExpectEquals(len(outcomes), 2)
+
+	// An outcome which changes while being sent remains due
+	probeOutcomesMutex.Lock()
+	probeOutcomes[outcomes[0].Key] = &probeOutcome{isReachable: false, since: time.Now(), probedAt: time.Now()}
+	probeOutcomesMutex.Unlock()
+	markProbeOutcomesReported(outcomes)
+
+	dueOutcomes := collectProbeOutcomes(false)
+	test.S(t).ExpectEquals(len(dueOutcomes), 1)
+	test.S(t).ExpectEquals(dueOutcomes[0].Key, outcomes[0].Key)
+	test.S(t).ExpectFalse(dueOutcomes[0].IsReachable)
+}
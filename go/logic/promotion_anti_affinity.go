@@ -0,0 +1,71 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+)
+
+// antiAffinityViolations lists the PromotionAntiAffinityDimensions in which given instance shares its value with
+// the dead instance. An unknown dead instance violates nothing.
+func antiAffinityViolations(instance *inst.Instance, deadInstance *inst.Instance) []string {
+	if deadInstance == nil {
+		return nil
+	}
+	return instance.SharedDimensions(deadInstance, config.Config.PromotionAntiAffinityDimensions)
+}
+
+// isAntiAffine checks whether given instance differs from the dead instance in all PromotionAntiAffinityDimensions
+func isAntiAffine(instance *inst.Instance, deadInstance *inst.Instance) bool {
+	return len(antiAffinityViolations(instance, deadInstance)) == 0
+}
+
+// suggestAntiAffinityReplacement looks for a replica of the promoted replica which differs from the dead master in all
+// PromotionAntiAffinityDimensions, where the promoted replica does not. Replicas in the dead master's data center are
+// preferred.
+func suggestAntiAffinityReplacement(topologyRecovery *TopologyRecovery, deadInstance *inst.Instance, promotedReplica *inst.Instance) *inst.InstanceKey {
+	violations := antiAffinityViolations(promotedReplica, deadInstance)
+	if len(violations) == 0 {
+		return nil
+	}
+	AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("+ searching for a replacement to promoted replica, which shares %+v with failed instance", violations))
+	replicas, err := inst.ReadReplicaInstances(&promotedReplica.Key)
+	if err != nil {
+		return nil
+	}
+	var replacement *inst.Instance
+	for _, replica := range replicas {
+		if !canTakeOverPromotedServerAsMaster(replica, promotedReplica) || inst.IsBannedFromBeingCandidateReplica(replica) {
+			continue
+		}
+		if replica.PromotionRule == inst.PreferNotPromoteRule || !isAntiAffine(replica, deadInstance) {
+			continue
+		}
+		if replacement == nil || (replica.DataCenter == deadInstance.DataCenter && replacement.DataCenter != deadInstance.DataCenter) {
+			replacement = replica
+		}
+	}
+	if replacement == nil {
+		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("+ found no replacement differing from failed instance in %+v", violations))
+		return nil
+	}
+	AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("no candidate was offered for %+v but orchestrator picks %+v as candidate replacement, based on anti-affinity in %+v", promotedReplica.Key, replacement.Key, violations))
+	return &replacement.Key
+}
@@ -0,0 +1,78 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"testing"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+// writeAntiAffinityTestInstance writes a replica of given master, in given data center and rack
+func writeAntiAffinityTestInstance(t *testing.T, hostname string, masterHostname string, dataCenter string, rack string) *inst.Instance {
+	instanceKey := inst.InstanceKey{Hostname: hostname, Port: 3306}
+	writeTestInstance(t, instanceKey, inst.InstanceKey{Hostname: masterHostname, Port: 3306}, "anti-affinity-master:3306")
+	_, err := db.ExecOrchestrator(`
+			update database_instance set data_center = ?, grouping_dimensions = ? where hostname = ? and port = ?
+		`, dataCenter, `{"rack":"`+rack+`"}`, instanceKey.Hostname, instanceKey.Port,
+	)
+	test.S(t).ExpectNil(err)
+	instance, found, err := inst.ReadInstance(&instanceKey)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(found)
+	return instance
+}
+
+func TestSuggestAntiAffinityReplacement(t *testing.T) {
+	withSQLiteBackend(t)
+	antiAffinityDimensions := config.Config.PromotionAntiAffinityDimensions
+	defer func() { config.Config.PromotionAntiAffinityDimensions = antiAffinityDimensions }()
+	config.Config.PromotionAntiAffinityDimensions = []string{"rack"}
+
+	deadMaster := inst.NewInstance()
+	deadMaster.Key = inst.InstanceKey{Hostname: "anti-affinity-master", Port: 3306}
+	deadMaster.DataCenter = "dc1"
+	deadMaster.Dimensions = map[string]string{"rack": "r1"}
+
+	promoted := writeAntiAffinityTestInstance(t, "promoted", "anti-affinity-master", "dc1", "r1")
+	test.S(t).ExpectEquals(promoted.Dimensions["rack"], "r1")
+	test.S(t).ExpectEquals(len(antiAffinityViolations(promoted, deadMaster)), 1)
+	test.S(t).ExpectEquals(len(antiAffinityViolations(promoted, nil)), 0)
+
+	// Replicas of the promoted replica in the dead master's rack do not qualify
+	writeAntiAffinityTestInstance(t, "same-rack", "promoted", "dc1", "r1")
+	test.S(t).ExpectTrue(suggestAntiAffinityReplacement(nil, deadMaster, promoted) == nil)
+
+	writeAntiAffinityTestInstance(t, "other-dc", "promoted", "dc2", "r2")
+	replacementKey := suggestAntiAffinityReplacement(nil, deadMaster, promoted)
+	test.S(t).ExpectNotNil(replacementKey)
+	test.S(t).ExpectEquals(replacementKey.Hostname, "other-dc")
+
+	// Replicas in the dead master's data center are preferred
+	writeAntiAffinityTestInstance(t, "same-dc", "promoted", "dc1", "r3")
+	replacementKey = suggestAntiAffinityReplacement(nil, deadMaster, promoted)
+	test.S(t).ExpectNotNil(replacementKey)
+	test.S(t).ExpectEquals(replacementKey.Hostname, "same-dc")
+
+	// A promoted replica which violates no anti-affinity is not replaced
+	antiAffine := writeAntiAffinityTestInstance(t, "anti-affine", "anti-affinity-master", "dc1", "r4")
+	writeAntiAffinityTestInstance(t, "anti-affine-replica", "anti-affine", "dc1", "r5")
+	test.S(t).ExpectTrue(suggestAntiAffinityReplacement(nil, deadMaster, antiAffine) == nil)
+}
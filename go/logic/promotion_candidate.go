@@ -0,0 +1,193 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/openark/golib/log"
+)
+
+// preElectedCandidateValidity is the time for which a pre-election is trusted by a failover
+const preElectedCandidateValidity = time.Minute
+
+// PromotionCandidate is the replica which would be promoted, should a cluster's master fail, as pre-elected
+// based on the last known state of the cluster
+type PromotionCandidate struct {
+	ClusterName    string
+	ClusterAlias   string
+	MasterKey      inst.InstanceKey
+	CandidateKey   *inst.InstanceKey // nil when no replica may be promoted
+	PromotionRule  inst.CandidatePromotionRule
+	PoolPreference inst.PromotionPoolPreference
+	DataCenter     string
+	IsViable       bool   // the candidate may be promoted, and all other replicas may replicate from it
+	Reason         string // why the candidate is not viable
+	EvaluatedAt    time.Time
+}
+
+var promotionCandidates = make(map[string]*PromotionCandidate)
+var promotionCandidatesMutex sync.Mutex
+var preElectionEntrance int64
+
+// preElectPromotionCandidate chooses the replica to be promoted should given master fail. It does not access
+// the replicas themselves.
+func preElectPromotionCandidate(master *inst.Instance, clusterAlias string) *PromotionCandidate {
+	promotionCandidate := &PromotionCandidate{
+		ClusterName:  master.ClusterName,
+		ClusterAlias: clusterAlias,
+		MasterKey:    master.Key,
+		EvaluatedAt:  time.Now(),
+	}
+	candidate, _, _, _, cannotReplicateReplicas, err := inst.GetCandidateReplica(&master.Key, false)
+	if candidate == nil {
+		promotionCandidate.Reason = "no replica may be promoted"
+		if err != nil {
+			promotionCandidate.Reason = err.Error()
+		}
+		return promotionCandidate
+	}
+	promotionCandidate.CandidateKey = &candidate.Key
+	promotionCandidate.PromotionRule = candidate.PromotionRule
+	promotionCandidate.PoolPreference = inst.NeutralPoolPreference
+	if poolPreferences, err := inst.ReadPromotionPoolPreferences(master.ClusterName); err == nil {
+		promotionCandidate.PoolPreference = poolPreferences.Get(&candidate.Key)
+	}
+	promotionCandidate.DataCenter = candidate.DataCenter
+	switch {
+	case err != nil:
+		promotionCandidate.Reason = err.Error()
+	case !candidate.IsLastCheckValid:
+		promotionCandidate.Reason = "candidate is unreachable"
+	case !candidate.ReplicaRunning():
+		promotionCandidate.Reason = "candidate is not replicating"
+	case len(cannotReplicateReplicas) > 0:
+		promotionCandidate.Reason = fmt.Sprintf("%d replicas cannot replicate from candidate", len(cannotReplicateReplicas))
+	default:
+		promotionCandidate.IsViable = true
+	}
+	return promotionCandidate
+}
+
+// PreElectPromotionCandidates re-evaluates the promotion candidate of each cluster. When a cluster is newly found
+// to have no viable candidate, this is audited, and the leader runs NoPromotionCandidateProcesses.
+func PreElectPromotionCandidates() {
+	if !config.Config.PreElectPromotionCandidates {
+		return
+	}
+	if !atomic.CompareAndSwapInt64(&preElectionEntrance, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt64(&preElectionEntrance, 0)
+
+	masters, err := inst.ReadWriteableClustersMasters()
+	if err != nil {
+		log.Errore(err)
+		return
+	}
+	clustersInfo, err := inst.ReadClustersInfo("")
+	if err != nil {
+		log.Errore(err)
+		return
+	}
+	clusterAliases := make(map[string]string)
+	for _, clusterInfo := range clustersInfo {
+		clusterAliases[clusterInfo.ClusterName] = clusterInfo.ClusterAlias
+	}
+	candidates := make(map[string]*PromotionCandidate)
+	for _, master := range masters {
+		if len(master.SlaveHosts) == 0 {
+			continue
+		}
+		candidates[master.ClusterName] = preElectPromotionCandidate(master, clusterAliases[master.ClusterName])
+	}
+
+	promotionCandidatesMutex.Lock()
+	previousCandidates := promotionCandidates
+	promotionCandidates = candidates
+	promotionCandidatesMutex.Unlock()
+
+	for clusterName, promotionCandidate := range candidates {
+		if promotionCandidate.IsViable {
+			continue
+		}
+		if previous, found := previousCandidates[clusterName]; found && !previous.IsViable {
+			continue
+		}
+		inst.AuditOperation("no-promotion-candidate", &promotionCandidate.MasterKey, promotionCandidate.Reason)
+		if IsLeader() {
+			go executeNoPromotionCandidateProcesses(*promotionCandidate)
+		}
+	}
+}
+
+func executeNoPromotionCandidateProcesses(promotionCandidate PromotionCandidate) {
+	executeEventProcesses(config.Config.NoPromotionCandidateProcesses, "NoPromotionCandidateProcesses", []hookVariable{
+		{"clusterName", "ORC_CLUSTER_NAME", promotionCandidate.ClusterName},
+		{"clusterAlias", "ORC_CLUSTER_ALIAS", promotionCandidate.ClusterAlias},
+		{"masterHost", "ORC_MASTER_HOST", promotionCandidate.MasterKey.Hostname},
+		{"masterPort", "ORC_MASTER_PORT", fmt.Sprintf("%d", promotionCandidate.MasterKey.Port)},
+		{"reason", "ORC_REASON", promotionCandidate.Reason},
+	})
+}
+
+// ReadPromotionCandidate returns the pre-elected promotion candidate of given cluster, if any
+func ReadPromotionCandidate(clusterName string) (promotionCandidate *PromotionCandidate, found bool) {
+	promotionCandidatesMutex.Lock()
+	defer promotionCandidatesMutex.Unlock()
+
+	promotionCandidate, found = promotionCandidates[clusterName]
+	return promotionCandidate, found
+}
+
+// ReadPromotionCandidates returns the pre-elected promotion candidates of all clusters, sorted by cluster name
+func ReadPromotionCandidates() []PromotionCandidate {
+	promotionCandidatesMutex.Lock()
+	defer promotionCandidatesMutex.Unlock()
+
+	candidates := []PromotionCandidate{}
+	for _, promotionCandidate := range promotionCandidates {
+		candidates = append(candidates, *promotionCandidate)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].ClusterName < candidates[j].ClusterName
+	})
+	return candidates
+}
+
+// isPreElectedPromotionCandidate checks whether given replica is the recently pre-elected, viable
+// promotion candidate of given failed master. A prefer_not candidate does not qualify, since a failover
+// should look for a better replacement for it.
+func isPreElectedPromotionCandidate(failedMasterKey *inst.InstanceKey, clusterName string, replica *inst.Instance) bool {
+	promotionCandidate, found := ReadPromotionCandidate(clusterName)
+	if !found || !promotionCandidate.IsViable || !promotionCandidate.MasterKey.Equals(failedMasterKey) {
+		return false
+	}
+	if promotionCandidate.PromotionRule == inst.PreferNotPromoteRule {
+		return false
+	}
+	if time.Since(promotionCandidate.EvaluatedAt) > preElectedCandidateValidity {
+		return false
+	}
+	return replica.Key.Equals(promotionCandidate.CandidateKey)
+}
@@ -0,0 +1,131 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+// withPromotionCandidates sets the pre-elected promotion candidates for the duration of given test
+func withPromotionCandidates(t *testing.T, candidates ...*PromotionCandidate) {
+	promotionCandidatesMutex.Lock()
+	previousCandidates := promotionCandidates
+	promotionCandidates = make(map[string]*PromotionCandidate)
+	for _, candidate := range candidates {
+		promotionCandidates[candidate.ClusterName] = candidate
+	}
+	promotionCandidatesMutex.Unlock()
+	t.Cleanup(func() {
+		promotionCandidatesMutex.Lock()
+		defer promotionCandidatesMutex.Unlock()
+		promotionCandidates = previousCandidates
+	})
+}
+
+func TestPreElectPromotionCandidate(t *testing.T) {
+	withSQLiteBackend(t)
+	masterKey := inst.InstanceKey{Hostname: "db-1", Port: 3306}
+	writeTestInstance(t, masterKey, inst.InstanceKey{}, "db-1:3306")
+	writeTestInstance(t, inst.InstanceKey{Hostname: "db-2", Port: 3306}, masterKey, "db-1:3306")
+	writeTestInstance(t, inst.InstanceKey{Hostname: "db-3", Port: 3306}, masterKey, "db-1:3306")
+
+	master := &inst.Instance{Key: masterKey, ClusterName: "db-1:3306"}
+	promotionCandidate := preElectPromotionCandidate(master, "shop")
+	test.S(t).ExpectEquals(promotionCandidate.ClusterAlias, "shop")
+	test.S(t).ExpectTrue(promotionCandidate.MasterKey.Equals(&masterKey))
+	test.S(t).ExpectNotNil(promotionCandidate.CandidateKey)
+	test.S(t).ExpectTrue(promotionCandidate.IsViable)
+	test.S(t).ExpectEquals(promotionCandidate.Reason, "")
+
+	// A master with no replicas has no candidate
+	loneMasterKey := inst.InstanceKey{Hostname: "db-7", Port: 3306}
+	writeTestInstance(t, loneMasterKey, inst.InstanceKey{}, "db-7:3306")
+	promotionCandidate = preElectPromotionCandidate(&inst.Instance{Key: loneMasterKey, ClusterName: "db-7:3306"}, "books")
+	test.S(t).ExpectTrue(promotionCandidate.CandidateKey == nil)
+	test.S(t).ExpectFalse(promotionCandidate.IsViable)
+	test.S(t).ExpectNotEquals(promotionCandidate.Reason, "")
+}
+
+func TestIsPreElectedPromotionCandidate(t *testing.T) {
+	masterKey := inst.InstanceKey{Hostname: "db-1", Port: 3306}
+	candidateKey := inst.InstanceKey{Hostname: "db-2", Port: 3306}
+	candidate := &inst.Instance{Key: candidateKey}
+	other := &inst.Instance{Key: inst.InstanceKey{Hostname: "db-3", Port: 3306}}
+
+	withPromotionCandidates(t, &PromotionCandidate{
+		ClusterName:   "db-1:3306",
+		MasterKey:     masterKey,
+		CandidateKey:  &candidateKey,
+		PromotionRule: inst.NeutralPromoteRule,
+		IsViable:      true,
+		EvaluatedAt:   time.Now(),
+	})
+	test.S(t).ExpectTrue(isPreElectedPromotionCandidate(&masterKey, "db-1:3306", candidate))
+	test.S(t).ExpectFalse(isPreElectedPromotionCandidate(&masterKey, "db-1:3306", other))
+	test.S(t).ExpectFalse(isPreElectedPromotionCandidate(&masterKey, "db-7:3306", candidate))
+	test.S(t).ExpectFalse(isPreElectedPromotionCandidate(&candidateKey, "db-1:3306", candidate))
+
+	withPromotionCandidates(t, &PromotionCandidate{
+		ClusterName:   "db-1:3306",
+		MasterKey:     masterKey,
+		CandidateKey:  &candidateKey,
+		PromotionRule: inst.NeutralPromoteRule,
+		IsViable:      true,
+		EvaluatedAt:   time.Now().Add(-2 * preElectedCandidateValidity),
+	})
+	test.S(t).ExpectFalse(isPreElectedPromotionCandidate(&masterKey, "db-1:3306", candidate))
+
+	withPromotionCandidates(t, &PromotionCandidate{
+		ClusterName:   "db-1:3306",
+		MasterKey:     masterKey,
+		CandidateKey:  &candidateKey,
+		PromotionRule: inst.PreferNotPromoteRule,
+		IsViable:      true,
+		EvaluatedAt:   time.Now(),
+	})
+	test.S(t).ExpectFalse(isPreElectedPromotionCandidate(&masterKey, "db-1:3306", candidate))
+
+	withPromotionCandidates(t, &PromotionCandidate{
+		ClusterName:   "db-1:3306",
+		MasterKey:     masterKey,
+		CandidateKey:  &candidateKey,
+		PromotionRule: inst.NeutralPromoteRule,
+		IsViable:      false,
+		EvaluatedAt:   time.Now(),
+	})
+	test.S(t).ExpectFalse(isPreElectedPromotionCandidate(&masterKey, "db-1:3306", candidate))
+}
+
+func TestReadPromotionCandidates(t *testing.T) {
+	withPromotionCandidates(t,
+		&PromotionCandidate{ClusterName: "db-7:3306"},
+		&PromotionCandidate{ClusterName: "db-1:3306"},
+	)
+	candidates := ReadPromotionCandidates()
+	test.S(t).ExpectEquals(len(candidates), 2)
+	test.S(t).ExpectEquals(candidates[0].ClusterName, "db-1:3306")
+	test.S(t).ExpectEquals(candidates[1].ClusterName, "db-7:3306")
+
+	_, found := ReadPromotionCandidate("db-7:3306")
+	test.S(t).ExpectTrue(found)
+	_, found = ReadPromotionCandidate("db-9:3306")
+	test.S(t).ExpectFalse(found)
+}
@@ -0,0 +1,72 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+
+	"github.com/github/orchestrator/go/inst"
+)
+
+// suggestPoolAwareReplacement looks for a replica of the promoted replica which is preferable to it by pool
+// membership, per PromotionPools configuration: a member of the failover pool, or, where the promoted replica is a
+// member of an avoided pool, a replica which is not. Replicas in the dead master's data center are preferred.
+func suggestPoolAwareReplacement(topologyRecovery *TopologyRecovery, deadInstance *inst.Instance, promotedReplica *inst.Instance) *inst.InstanceKey {
+	poolPreferences, err := inst.ReadPromotionPoolPreferences(promotedReplica.ClusterName)
+	if err != nil || len(poolPreferences) == 0 {
+		return nil
+	}
+	promotedPreference := poolPreferences.Get(&promotedReplica.Key)
+	if promotedPreference == inst.FailoverPoolPreference {
+		return nil
+	}
+	AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("+ searching for a replacement preferable by pool membership to promoted replica, whose pool preference is %s", promotedPreference))
+	replicas, err := inst.ReadReplicaInstances(&promotedReplica.Key)
+	if err != nil {
+		return nil
+	}
+	isInDeadInstanceDataCenter := func(instance *inst.Instance) bool {
+		return deadInstance != nil && instance.DataCenter == deadInstance.DataCenter
+	}
+	var replacement *inst.Instance
+	for _, replica := range replicas {
+		if !canTakeOverPromotedServerAsMaster(replica, promotedReplica) || inst.IsBannedFromBeingCandidateReplica(replica) {
+			continue
+		}
+		if replica.PromotionRule == inst.PreferNotPromoteRule {
+			continue
+		}
+		preference := poolPreferences.Get(&replica.Key)
+		if !preference.BetterThan(promotedPreference) {
+			continue
+		}
+		if replacement == nil {
+			replacement = replica
+			continue
+		}
+		replacementPreference := poolPreferences.Get(&replacement.Key)
+		if preference.BetterThan(replacementPreference) ||
+			(preference == replacementPreference && isInDeadInstanceDataCenter(replica) && !isInDeadInstanceDataCenter(replacement)) {
+			replacement = replica
+		}
+	}
+	if replacement == nil {
+		return nil
+	}
+	AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("no candidate was offered for %+v but orchestrator picks %+v as candidate replacement, based on pool preference %s", promotedReplica.Key, replacement.Key, poolPreferences.Get(&replacement.Key)))
+	return &replacement.Key
+}
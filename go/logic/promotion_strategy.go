@@ -0,0 +1,179 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/openark/golib/log"
+)
+
+// DefaultPromotionStrategyName is the promotion strategy of clusters which have none configured
+const DefaultPromotionStrategyName = "classic"
+
+// PromotionStrategy decides how a dead master is replaced: the way its replicas are regrouped, and optionally,
+// which replica to promote. orchestrator takes care of everything else in the recovery: hooks, relocating
+// lost replicas, replacing the promoted replica with a better candidate, KV and audit.
+//
+// Organizations may add their own promotion logic by implementing this interface and registering it via
+// RegisterPromotionStrategy, e.g. from a package's init() function, then assign it to clusters via
+// PromotionStrategies configuration.
+type PromotionStrategy interface {
+	// Name identifies the strategy in configuration
+	Name() string
+	// MasterRecoveryType returns the method by which replicas of the dead master are regrouped. An error
+	// aborts the recovery without promoting any replica.
+	MasterRecoveryType(analysisEntry *inst.ReplicationAnalysis) (MasterRecoveryType, error)
+	// SuggestCandidate returns the replica which should be promoted, given no candidate was explicitly requested.
+	// nil lets orchestrator pick the best candidate.
+	SuggestCandidate(topologyRecovery *TopologyRecovery) (*inst.InstanceKey, error)
+}
+
+var promotionStrategies = make(map[string]PromotionStrategy)
+var promotionStrategiesMutex sync.RWMutex
+
+func init() {
+	RegisterPromotionStrategy(&classicPromotionStrategy{})
+	RegisterPromotionStrategy(&gtidFirstPromotionStrategy{})
+	RegisterPromotionStrategy(&binlogServerAwarePromotionStrategy{})
+}
+
+// RegisterPromotionStrategy makes a promotion strategy available to clusters, by its name
+func RegisterPromotionStrategy(strategy PromotionStrategy) error {
+	promotionStrategiesMutex.Lock()
+	defer promotionStrategiesMutex.Unlock()
+
+	if strategy.Name() == "" {
+		return fmt.Errorf("RegisterPromotionStrategy: empty strategy name")
+	}
+	if _, found := promotionStrategies[strategy.Name()]; found {
+		return fmt.Errorf("RegisterPromotionStrategy: strategy %s is already registered", strategy.Name())
+	}
+	promotionStrategies[strategy.Name()] = strategy
+	return nil
+}
+
+// RegisteredPromotionStrategies lists the names of registered promotion strategies
+func RegisteredPromotionStrategies() (names []string) {
+	promotionStrategiesMutex.RLock()
+	defer promotionStrategiesMutex.RUnlock()
+
+	for name := range promotionStrategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetPromotionStrategy returns the registered promotion strategy by given name
+func GetPromotionStrategy(name string) (strategy PromotionStrategy, found bool) {
+	promotionStrategiesMutex.RLock()
+	defer promotionStrategiesMutex.RUnlock()
+
+	strategy, found = promotionStrategies[name]
+	return strategy, found
+}
+
+// GetClusterPromotionStrategy returns the promotion strategy configured for given cluster. A cluster configured with
+// an unknown strategy falls back to the default strategy: a misconfiguration must not prevent a failover.
+func GetClusterPromotionStrategy(clusterName string, clusterAlias string) PromotionStrategy {
+	name := config.Config.GetPromotionStrategy(clusterName, clusterAlias)
+	if name == "" {
+		name = DefaultPromotionStrategyName
+	}
+	if strategy, found := GetPromotionStrategy(name); found {
+		return strategy
+	}
+	log.Errorf("Unknown promotion strategy %s configured for cluster %s; using %s", name, clusterName, DefaultPromotionStrategyName)
+	strategy, _ := GetPromotionStrategy(DefaultPromotionStrategyName)
+	return strategy
+}
+
+// ValidatePromotionStrategies reports configured promotion strategies which are not registered
+func ValidatePromotionStrategies() (err error) {
+	for clusterKey, name := range config.Config.PromotionStrategies {
+		if _, found := GetPromotionStrategy(name); !found {
+			err = log.Errorf("PromotionStrategies[%s]: unknown promotion strategy %s; known strategies: %+v", clusterKey, name, RegisteredPromotionStrategies())
+		}
+	}
+	return err
+}
+
+// classicPromotionStrategy regroups via GTID where the topology uses GTID, else via binlog servers where the master
+// has binlog server replicas, else via Pseudo-GTID
+type classicPromotionStrategy struct{}
+
+func (strategy *classicPromotionStrategy) Name() string {
+	return "classic"
+}
+
+func (strategy *classicPromotionStrategy) MasterRecoveryType(analysisEntry *inst.ReplicationAnalysis) (MasterRecoveryType, error) {
+	if analysisEntry.OracleGTIDImmediateTopology || analysisEntry.MariaDBGTIDImmediateTopology {
+		return MasterRecoveryGTID, nil
+	}
+	if analysisEntry.BinlogServerImmediateTopology {
+		return MasterRecoveryBinlogServer, nil
+	}
+	return MasterRecoveryPseudoGTID, nil
+}
+
+func (strategy *classicPromotionStrategy) SuggestCandidate(topologyRecovery *TopologyRecovery) (*inst.InstanceKey, error) {
+	return nil, nil
+}
+
+// gtidFirstPromotionStrategy regroups via GTID, falling back to Pseudo-GTID only where Pseudo-GTID is configured.
+// It never recovers via binlog servers, and refuses to recover a topology with neither GTID nor Pseudo-GTID.
+type gtidFirstPromotionStrategy struct{}
+
+func (strategy *gtidFirstPromotionStrategy) Name() string {
+	return "gtid-first"
+}
+
+func (strategy *gtidFirstPromotionStrategy) MasterRecoveryType(analysisEntry *inst.ReplicationAnalysis) (MasterRecoveryType, error) {
+	if analysisEntry.OracleGTIDImmediateTopology || analysisEntry.MariaDBGTIDImmediateTopology {
+		return MasterRecoveryGTID, nil
+	}
+	if config.Config.PseudoGTIDPattern != "" || config.Config.AutoPseudoGTID {
+		return MasterRecoveryPseudoGTID, nil
+	}
+	return NotMasterRecovery, fmt.Errorf("gtid-first: replicas of %+v use neither GTID nor Pseudo-GTID", analysisEntry.AnalyzedInstanceKey)
+}
+
+func (strategy *gtidFirstPromotionStrategy) SuggestCandidate(topologyRecovery *TopologyRecovery) (*inst.InstanceKey, error) {
+	return nil, nil
+}
+
+// binlogServerAwarePromotionStrategy recovers via binlog servers whenever the master has binlog server replicas,
+// even where the topology uses GTID, and otherwise acts as the classic strategy
+type binlogServerAwarePromotionStrategy struct {
+	classicPromotionStrategy
+}
+
+func (strategy *binlogServerAwarePromotionStrategy) Name() string {
+	return "binlog-server-aware"
+}
+
+func (strategy *binlogServerAwarePromotionStrategy) MasterRecoveryType(analysisEntry *inst.ReplicationAnalysis) (MasterRecoveryType, error) {
+	if analysisEntry.BinlogServerImmediateTopology {
+		return MasterRecoveryBinlogServer, nil
+	}
+	return strategy.classicPromotionStrategy.MasterRecoveryType(analysisEntry)
+}
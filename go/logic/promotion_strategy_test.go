@@ -0,0 +1,126 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+// testPromotionStrategy is a custom strategy, which always promotes the same replica
+type testPromotionStrategy struct {
+	classicPromotionStrategy
+}
+
+func (strategy *testPromotionStrategy) Name() string {
+	return "test-custom"
+}
+
+func (strategy *testPromotionStrategy) SuggestCandidate(topologyRecovery *TopologyRecovery) (*inst.InstanceKey, error) {
+	return &inst.InstanceKey{Hostname: "custom-candidate", Port: 3306}, nil
+}
+
+func TestRegisterPromotionStrategy(t *testing.T) {
+	test.S(t).ExpectEquals(strings.Join(RegisteredPromotionStrategies(), ","), "binlog-server-aware,classic,gtid-first")
+
+	test.S(t).ExpectNil(RegisterPromotionStrategy(&testPromotionStrategy{}))
+	defer func() {
+		promotionStrategiesMutex.Lock()
+		defer promotionStrategiesMutex.Unlock()
+		delete(promotionStrategies, "test-custom")
+	}()
+	test.S(t).ExpectEquals(strings.Join(RegisteredPromotionStrategies(), ","), "binlog-server-aware,classic,gtid-first,test-custom")
+
+	// Names are unique
+	test.S(t).ExpectNotNil(RegisterPromotionStrategy(&testPromotionStrategy{}))
+	test.S(t).ExpectNotNil(RegisterPromotionStrategy(&classicPromotionStrategy{}))
+
+	strategy, found := GetPromotionStrategy("test-custom")
+	test.S(t).ExpectTrue(found)
+	candidateKey, err := strategy.SuggestCandidate(nil)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(candidateKey.Hostname, "custom-candidate")
+
+	_, found = GetPromotionStrategy("no-such-strategy")
+	test.S(t).ExpectFalse(found)
+}
+
+func TestGetClusterPromotionStrategy(t *testing.T) {
+	promotionStrategies := config.Config.PromotionStrategies
+	defer func() { config.Config.PromotionStrategies = promotionStrategies }()
+
+	config.Config.PromotionStrategies = map[string]string{}
+	test.S(t).ExpectEquals(GetClusterPromotionStrategy("db-1:3306", "one").Name(), DefaultPromotionStrategyName)
+	test.S(t).ExpectNil(ValidatePromotionStrategies())
+
+	config.Config.PromotionStrategies = map[string]string{
+		"db-1:3306": "gtid-first",
+		"two":       "binlog-server-aware",
+		"*":         "gtid-first",
+	}
+	test.S(t).ExpectEquals(GetClusterPromotionStrategy("db-1:3306", "one").Name(), "gtid-first")
+	test.S(t).ExpectEquals(GetClusterPromotionStrategy("db-2:3306", "two").Name(), "binlog-server-aware")
+	test.S(t).ExpectEquals(GetClusterPromotionStrategy("db-3:3306", "three").Name(), "gtid-first")
+	test.S(t).ExpectNil(ValidatePromotionStrategies())
+
+	// A misconfigured strategy falls back onto the default one, rather than preventing a failover
+	config.Config.PromotionStrategies = map[string]string{"four": "no-such-strategy"}
+	test.S(t).ExpectEquals(GetClusterPromotionStrategy("db-4:3306", "four").Name(), DefaultPromotionStrategyName)
+	test.S(t).ExpectNotNil(ValidatePromotionStrategies())
+}
+
+func TestPromotionStrategyMasterRecoveryType(t *testing.T) {
+	pseudoGTIDPattern, autoPseudoGTID := config.Config.PseudoGTIDPattern, config.Config.AutoPseudoGTID
+	defer func() {
+		config.Config.PseudoGTIDPattern, config.Config.AutoPseudoGTID = pseudoGTIDPattern, autoPseudoGTID
+	}()
+	config.Config.PseudoGTIDPattern = ""
+	config.Config.AutoPseudoGTID = false
+
+	gtidEntry := &inst.ReplicationAnalysis{OracleGTIDImmediateTopology: true, BinlogServerImmediateTopology: true}
+	binlogServerEntry := &inst.ReplicationAnalysis{BinlogServerImmediateTopology: true}
+	plainEntry := &inst.ReplicationAnalysis{}
+
+	expectRecoveryType := func(strategyName string, analysisEntry *inst.ReplicationAnalysis, expected MasterRecoveryType) {
+		strategy, found := GetPromotionStrategy(strategyName)
+		test.S(t).ExpectTrue(found)
+		recoveryType, err := strategy.MasterRecoveryType(analysisEntry)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(recoveryType, expected)
+	}
+	expectRecoveryType("classic", gtidEntry, MasterRecoveryGTID)
+	expectRecoveryType("classic", binlogServerEntry, MasterRecoveryBinlogServer)
+	expectRecoveryType("classic", plainEntry, MasterRecoveryPseudoGTID)
+
+	expectRecoveryType("binlog-server-aware", gtidEntry, MasterRecoveryBinlogServer)
+	expectRecoveryType("binlog-server-aware", binlogServerEntry, MasterRecoveryBinlogServer)
+	expectRecoveryType("binlog-server-aware", plainEntry, MasterRecoveryPseudoGTID)
+
+	expectRecoveryType("gtid-first", gtidEntry, MasterRecoveryGTID)
+	{
+		// Neither GTID nor Pseudo-GTID
+		strategy, _ := GetPromotionStrategy("gtid-first")
+		_, err := strategy.MasterRecoveryType(binlogServerEntry)
+		test.S(t).ExpectNotNil(err)
+	}
+	config.Config.AutoPseudoGTID = true
+	expectRecoveryType("gtid-first", binlogServerEntry, MasterRecoveryPseudoGTID)
+}
@@ -0,0 +1,206 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/openark/golib/log"
+)
+
+// ReadOnlyDriftType is a way in which a cluster member's read_only setting deviates from its role
+type ReadOnlyDriftType string
+
+const (
+	WritableReplicaDrift  ReadOnlyDriftType = "writable-replica"
+	SuperReadOnlyOffDrift ReadOnlyDriftType = "super-read-only-off"
+	ReadOnlyMasterDrift   ReadOnlyDriftType = "read-only-master"
+)
+
+// ReadOnlyDrift is a cluster member whose read_only setting deviates from its role, and the outcome of fixing it
+type ReadOnlyDrift struct {
+	Key         inst.InstanceKey
+	ClusterName string
+	DriftType   ReadOnlyDriftType
+	IsFixed     bool
+	Error       string
+}
+
+// readOnlyDriftsReported maps a cluster onto the drifts last reported on it, so that a drift is reported once
+var readOnlyDriftsReported = make(map[string]map[string]bool)
+var readOnlyDriftsReportedMutex sync.Mutex
+
+func (this *ReadOnlyDrift) String() string {
+	return fmt.Sprintf("%+v: %s", this.Key, this.DriftType)
+}
+
+// EvaluateReadOnlyDrift lists the members of a cluster whose read_only setting deviates from their role: the master
+// is expected to be writable, and all replicas read_only (and super_read_only, with UseSuperReadOnly). Members which
+// are downtimed or not reachable are not evaluated. Clusters with co-masters are not evaluated.
+func EvaluateReadOnlyDrift(clusterName string) (drifts []ReadOnlyDrift, err error) {
+	drifts = []ReadOnlyDrift{}
+	masters, err := inst.ReadClusterMaster(clusterName)
+	if err != nil {
+		return drifts, err
+	}
+	if len(masters) != 1 {
+		return drifts, fmt.Errorf("EvaluateReadOnlyDrift: expected a single master for %s; found %d", clusterName, len(masters))
+	}
+	master := masters[0]
+	instances, err := inst.ReadClusterInstances(clusterName)
+	if err != nil {
+		return drifts, err
+	}
+	for _, instance := range instances {
+		if !instance.IsLastCheckValid || instance.IsDowntimed || instance.IsBinlogServer() {
+			continue
+		}
+		drift := ReadOnlyDrift{Key: instance.Key, ClusterName: clusterName}
+		if instance.Key.Equals(&master.Key) {
+			if instance.ReadOnly {
+				drift.DriftType = ReadOnlyMasterDrift
+				drifts = append(drifts, drift)
+			}
+			continue
+		}
+		if !instance.ReadOnly {
+			drift.DriftType = WritableReplicaDrift
+			drifts = append(drifts, drift)
+			continue
+		}
+		if config.Config.UseSuperReadOnly {
+			if superReadOnly, err := inst.ReadSuperReadOnly(&instance.Key); err == nil && !superReadOnly {
+				drift.DriftType = SuperReadOnlyOffDrift
+				drifts = append(drifts, drift)
+			}
+		}
+	}
+	return drifts, nil
+}
+
+// IsFixable returns true when the drift may be fixed automatically. Fixing only ever sets a server read_only: a
+// read-only master is reported, but never made writable, as it may be read-only on purpose, e.g. by a takeover or
+// a fencing operator, and making it writable risks two writable servers.
+func (this *ReadOnlyDrift) IsFixable() bool {
+	return this.DriftType != ReadOnlyMasterDrift
+}
+
+// fixReadOnlyDrifts fixes given drifts which are fixable: replicas are made read_only
+func fixReadOnlyDrifts(clusterName string, drifts []ReadOnlyDrift) error {
+	countFailed := 0
+	for i := range drifts {
+		drift := &drifts[i]
+		if !drift.IsFixable() {
+			continue
+		}
+		if _, err := inst.SetReadOnly(&drift.Key, true); err != nil {
+			drift.Error = err.Error()
+			countFailed++
+			continue
+		}
+		drift.IsFixed = true
+		inst.AuditOperation("enforce-read-only", &drift.Key, fmt.Sprintf("cluster %s: fixed %s; read_only set as true", clusterName, drift.DriftType))
+	}
+	if countFailed > 0 {
+		return fmt.Errorf("fixReadOnlyDrifts: failed fixing %d out of %d drifts on %s", countFailed, len(drifts), clusterName)
+	}
+	return nil
+}
+
+// EnforceReadOnly fixes the read_only drift of a cluster: replicas are made read_only. A read-only master is
+// returned as unfixed drift; it is for the user to make it writable.
+func EnforceReadOnly(clusterName string) (drifts []ReadOnlyDrift, err error) {
+	drifts, err = EvaluateReadOnlyDrift(clusterName)
+	if err != nil {
+		return drifts, err
+	}
+	err = fixReadOnlyDrifts(clusterName, drifts)
+	return drifts, err
+}
+
+// CheckReadOnlyEnforcement evaluates the read_only drift of clusters subject to ReadOnlyEnforcement. The leader fixes
+// the fixable drift of clusters in "enforce" mode. Newly found drift is audited, and has OnReadOnlyDriftProcesses run.
+// Clusters with a recovery in active period, or which are locked, are left as they are: their members' read_only
+// settings may be changing on purpose.
+func CheckReadOnlyEnforcement() {
+	if len(config.Config.ReadOnlyEnforcement) == 0 || !IsLeader() {
+		return
+	}
+	clustersInfo, err := inst.ReadClustersInfo("")
+	if err != nil {
+		log.Errore(err)
+		return
+	}
+	for _, clusterInfo := range clustersInfo {
+		if clusterInfo.ReadOnlyEnforcement == "" {
+			continue
+		}
+		if recoveries, err := ReadInActivePeriodClusterRecovery(clusterInfo.ClusterName); err != nil || len(recoveries) > 0 {
+			continue
+		}
+		if clusterLock, err := inst.ReadClusterLock(clusterInfo.ClusterAlias); err != nil || clusterLock != nil {
+			continue
+		}
+		drifts, err := EvaluateReadOnlyDrift(clusterInfo.ClusterName)
+		if err != nil {
+			log.Errore(err)
+			continue
+		}
+		if clusterInfo.ReadOnlyEnforcement == config.ReadOnlyEnforcementEnforce {
+			if err := fixReadOnlyDrifts(clusterInfo.ClusterName, drifts); err != nil {
+				log.Errore(err)
+			}
+		}
+		reportReadOnlyDrifts(clusterInfo, drifts)
+	}
+}
+
+// reportReadOnlyDrifts audits and runs OnReadOnlyDriftProcesses for drifts not reported on the previous check
+func reportReadOnlyDrifts(clusterInfo inst.ClusterInfo, drifts []ReadOnlyDrift) {
+	reported := make(map[string]bool)
+	for _, drift := range drifts {
+		reported[drift.String()] = true
+	}
+	readOnlyDriftsReportedMutex.Lock()
+	previouslyReported := readOnlyDriftsReported[clusterInfo.ClusterName]
+	readOnlyDriftsReported[clusterInfo.ClusterName] = reported
+	readOnlyDriftsReportedMutex.Unlock()
+
+	for _, drift := range drifts {
+		if previouslyReported[drift.String()] {
+			continue
+		}
+		log.Warningf("read_only drift on cluster %s: %s; enforcement: %s; fixed: %t", clusterInfo.ClusterName, drift.String(), clusterInfo.ReadOnlyEnforcement, drift.IsFixed)
+		inst.AuditOperation("read-only-drift", &drift.Key, fmt.Sprintf("cluster %s: %s; enforcement: %s; fixed: %t", clusterInfo.ClusterName, drift.DriftType, clusterInfo.ReadOnlyEnforcement, drift.IsFixed))
+		go executeOnReadOnlyDriftProcesses(clusterInfo, drift)
+	}
+}
+
+func executeOnReadOnlyDriftProcesses(clusterInfo inst.ClusterInfo, drift ReadOnlyDrift) {
+	executeEventProcesses(config.Config.OnReadOnlyDriftProcesses, "OnReadOnlyDriftProcesses", []hookVariable{
+		{"clusterName", "ORC_CLUSTER_NAME", clusterInfo.ClusterName},
+		{"clusterAlias", "ORC_CLUSTER_ALIAS", clusterInfo.ClusterAlias},
+		{"driftHost", "ORC_DRIFT_HOST", drift.Key.Hostname},
+		{"driftPort", "ORC_DRIFT_PORT", fmt.Sprintf("%d", drift.Key.Port)},
+		{"driftType", "ORC_DRIFT_TYPE", string(drift.DriftType)},
+		{"driftFixed", "ORC_DRIFT_FIXED", fmt.Sprintf("%t", drift.IsFixed)},
+		{"enforcementMode", "ORC_ENFORCEMENT_MODE", clusterInfo.ReadOnlyEnforcement},
+	})
+}
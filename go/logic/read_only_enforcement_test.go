@@ -0,0 +1,40 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"testing"
+
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+func TestReadOnlyDriftIsFixable(t *testing.T) {
+	test.S(t).ExpectTrue((&ReadOnlyDrift{DriftType: WritableReplicaDrift}).IsFixable())
+	test.S(t).ExpectTrue((&ReadOnlyDrift{DriftType: SuperReadOnlyOffDrift}).IsFixable())
+	test.S(t).ExpectFalse((&ReadOnlyDrift{DriftType: ReadOnlyMasterDrift}).IsFixable())
+}
+
+func TestFixReadOnlyDriftsLeavesReadOnlyMaster(t *testing.T) {
+	drifts := []ReadOnlyDrift{
+		{Key: inst.InstanceKey{Hostname: "master", Port: 3306}, ClusterName: "master:3306", DriftType: ReadOnlyMasterDrift},
+	}
+	err := fixReadOnlyDrifts("master:3306", drifts)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectFalse(drifts[0].IsFixed)
+	test.S(t).ExpectEquals(drifts[0].Error, "")
+}
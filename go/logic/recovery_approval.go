@@ -0,0 +1,165 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/inst"
+	orcraft "github.com/github/orchestrator/go/raft"
+	"github.com/github/orchestrator/go/util"
+	"github.com/openark/golib/log"
+)
+
+// RecoveryApprovalStatus is the state of a request to approve a recovery
+type RecoveryApprovalStatus string
+
+const (
+	RecoveryApprovalPending  RecoveryApprovalStatus = "pending"
+	RecoveryApprovalApproved RecoveryApprovalStatus = "approved"
+	RecoveryApprovalRejected RecoveryApprovalStatus = "rejected"
+	RecoveryApprovalExpired  RecoveryApprovalStatus = "expired"
+	RecoveryApprovalConsumed RecoveryApprovalStatus = "consumed"
+)
+
+// RecoveryApproval is a request to approve the recovery of a failure, raised when the cluster's automation level
+// for the failure class is "approve". The recovery runs once the request is approved, given the failure persists.
+// A request must be approved within RecoveryApprovalTimeoutSeconds, and an approval is valid for
+// RecoveryApprovalTimeoutSeconds from the time it is made. An approval is consumed by the one recovery it allows.
+type RecoveryApproval struct {
+	UID               string
+	Key               inst.InstanceKey
+	Analysis          inst.AnalysisCode
+	ClusterName       string
+	ClusterAlias      string
+	FailureClass      string
+	Status            RecoveryApprovalStatus
+	RequestedAtString string
+	ExpiresAtString   string
+	DecidedBy         string
+	DecidedAtString   string
+	IsExpired         bool
+
+	isRecentlyDecided bool // decided within RecoveryPeriodBlockSeconds
+}
+
+// persistRecoveryApproval writes down given approval request, either directly or via raft
+func persistRecoveryApproval(approval *RecoveryApproval) error {
+	if orcraft.IsRaftEnabled() {
+		_, err := orcraft.PublishCommand("write-recovery-approval", approval)
+		return log.Errore(err)
+	}
+	return writeRecoveryApproval(approval)
+}
+
+// requestRecoveryApproval raises a pending approval request for recovering given analysis
+func requestRecoveryApproval(analysisEntry *inst.ReplicationAnalysis, failureClass string) error {
+	now, err := db.ReadTimeNow()
+	if err != nil {
+		return log.Errore(err)
+	}
+	approval := &RecoveryApproval{
+		UID:               util.PrettyUniqueToken(),
+		Key:               analysisEntry.AnalyzedInstanceKey,
+		Analysis:          analysisEntry.Analysis,
+		ClusterName:       analysisEntry.ClusterDetails.ClusterName,
+		ClusterAlias:      analysisEntry.ClusterDetails.ClusterAlias,
+		FailureClass:      failureClass,
+		Status:            RecoveryApprovalPending,
+		RequestedAtString: now,
+		ExpiresAtString:   inst.AddSecondsToTimeString(now, config.Config.RecoveryApprovalTimeoutSeconds),
+	}
+	if err := persistRecoveryApproval(approval); err != nil {
+		return err
+	}
+	message := fmt.Sprintf("%s on %+v requires approval; approval %s expires at %s", analysisEntry.Analysis, analysisEntry.AnalyzedInstanceKey, approval.UID, approval.ExpiresAtString)
+	log.Warningf("Recovery approval: %s", message)
+	inst.AuditOperation("request-recovery-approval", &approval.Key, message)
+	inst.RecordStateEvent(inst.RecoveryApprovalRequestedEvent, approval.ClusterName, &approval.Key, map[string]interface{}{
+		"approvalUID":  approval.UID,
+		"analysis":     approval.Analysis,
+		"failureClass": failureClass,
+		"expiresAt":    approval.ExpiresAtString,
+	})
+	return nil
+}
+
+// readRecoveryApprovalUID checks whether the recovery of given analysis may proceed under given automation level,
+// and returns the UID of the approval allowing it, or an empty string if none does.
+// Under the "approve" level, a recovery proceeds once its approval request is approved. The approval is consumed
+// upon registering the recovery (see attemptApprovedRecoveryRegistration). With no request pending, a new one is
+// raised. A rejected request is not re-raised within RecoveryPeriodBlockSeconds of its rejection; an expired
+// request, an expired approval, or a consumed approval, is re-raised right away.
+func readRecoveryApprovalUID(analysisEntry *inst.ReplicationAnalysis, automationLevel string, failureClass string) string {
+	if automationLevel != config.RecoveryAutomationApprove {
+		return ""
+	}
+	approval, err := readLatestRecoveryApproval(&analysisEntry.AnalyzedInstanceKey, analysisEntry.Analysis)
+	if err != nil {
+		return ""
+	}
+	if approval != nil {
+		if approval.Status == RecoveryApprovalApproved && !approval.IsExpired {
+			return approval.UID
+		}
+		if approval.Status == RecoveryApprovalPending {
+			return ""
+		}
+		if approval.Status == RecoveryApprovalRejected && approval.isRecentlyDecided {
+			return ""
+		}
+	}
+	requestRecoveryApproval(analysisEntry, failureClass)
+	return ""
+}
+
+// decideRecoveryApproval approves or rejects the pending approval request for recovering given instance
+func decideRecoveryApproval(instanceKey *inst.InstanceKey, status RecoveryApprovalStatus, owner string) (*RecoveryApproval, error) {
+	approval, err := readPendingInstanceRecoveryApproval(instanceKey)
+	if err != nil {
+		return nil, err
+	}
+	if approval == nil {
+		return nil, fmt.Errorf("No pending recovery approval request found for %+v", *instanceKey)
+	}
+	if approval.DecidedAtString, err = db.ReadTimeNow(); err != nil {
+		return nil, log.Errore(err)
+	}
+	approval.Status = status
+	approval.DecidedBy = owner
+	if status == RecoveryApprovalApproved {
+		// The approval is valid for a full timeout from when it is made, not from when it was requested
+		approval.ExpiresAtString = inst.AddSecondsToTimeString(approval.DecidedAtString, config.Config.RecoveryApprovalTimeoutSeconds)
+	}
+	if err := persistRecoveryApproval(approval); err != nil {
+		return nil, err
+	}
+	inst.AuditOperation(fmt.Sprintf("recovery-approval-%s", status), instanceKey, fmt.Sprintf("%s: %s by %s", approval.UID, approval.Analysis, owner))
+	return approval, nil
+}
+
+// ApproveRecovery approves the pending recovery of given instance. The recovery runs on the next failure detection.
+func ApproveRecovery(instanceKey *inst.InstanceKey, owner string) (*RecoveryApproval, error) {
+	return decideRecoveryApproval(instanceKey, RecoveryApprovalApproved, owner)
+}
+
+// RejectRecovery rejects the pending recovery of given instance
+func RejectRecovery(instanceKey *inst.InstanceKey, owner string) (*RecoveryApproval, error) {
+	return decideRecoveryApproval(instanceKey, RecoveryApprovalRejected, owner)
+}
@@ -0,0 +1,148 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+// writeRecoveryApproval writes a recovery approval request, along with its decision, if any
+func writeRecoveryApproval(approval *RecoveryApproval) error {
+	_, err := db.ExecOrchestrator(`
+			replace into topology_recovery_approval (
+					approval_uid, hostname, port, analysis, cluster_name, cluster_alias, failure_class,
+					approval_status, request_timestamp, expires_at, decided_by, decision_timestamp
+				) values (
+					?, ?, ?, ?, ?, ?, ?,
+					?, ?, ?, ?, ?
+				)
+			`, approval.UID, approval.Key.Hostname, approval.Key.Port, string(approval.Analysis), approval.ClusterName, approval.ClusterAlias, approval.FailureClass,
+		string(approval.Status), approval.RequestedAtString, approval.ExpiresAtString, approval.DecidedBy, approval.DecidedAtString,
+	)
+	return log.Errore(err)
+}
+
+// readRecoveryApprovals reads recovery approval requests, most recent first. A pending request past its expiry is read
+// as expired, and an approval consumed by a recovery is read as consumed.
+func readRecoveryApprovals(whereCondition string, args []interface{}, limit string) ([]RecoveryApproval, error) {
+	approvals := []RecoveryApproval{}
+	query := `
+		select
+			approval_uid,
+			hostname,
+			port,
+			analysis,
+			cluster_name,
+			cluster_alias,
+			failure_class,
+			approval_status,
+			request_timestamp,
+			expires_at,
+			decided_by,
+			decision_timestamp,
+			expires_at < NOW() as is_expired,
+			decision_timestamp > NOW() - INTERVAL ? SECOND as is_recently_decided,
+			exists (
+				select 1 from topology_recovery
+				where topology_recovery.approval_uid = topology_recovery_approval.approval_uid
+			) as is_consumed
+		from
+			topology_recovery_approval
+		` + whereCondition + `
+		order by
+			request_timestamp desc
+		` + limit
+	args = append(sqlutils.Args(config.Config.RecoveryPeriodBlockSeconds), args...)
+	err := db.QueryOrchestrator(query, args, func(m sqlutils.RowMap) error {
+		approval := RecoveryApproval{
+			UID:               m.GetString("approval_uid"),
+			Analysis:          inst.AnalysisCode(m.GetString("analysis")),
+			ClusterName:       m.GetString("cluster_name"),
+			ClusterAlias:      m.GetString("cluster_alias"),
+			FailureClass:      m.GetString("failure_class"),
+			Status:            RecoveryApprovalStatus(m.GetString("approval_status")),
+			RequestedAtString: m.GetString("request_timestamp"),
+			ExpiresAtString:   m.GetString("expires_at"),
+			DecidedBy:         m.GetString("decided_by"),
+			DecidedAtString:   m.GetString("decision_timestamp"),
+			IsExpired:         m.GetBool("is_expired"),
+			isRecentlyDecided: m.GetBool("is_recently_decided"),
+		}
+		approval.Key.Hostname = m.GetString("hostname")
+		approval.Key.Port = m.GetInt("port")
+		if approval.Status == RecoveryApprovalPending && approval.IsExpired {
+			approval.Status = RecoveryApprovalExpired
+		}
+		if approval.Status == RecoveryApprovalApproved && m.GetBool("is_consumed") {
+			approval.Status = RecoveryApprovalConsumed
+		}
+		approvals = append(approvals, approval)
+		return nil
+	})
+	return approvals, log.Errore(err)
+}
+
+// ReadRecoveryApprovals reads the recovery approval requests of the past day, of given cluster, or of all clusters
+// given an empty cluster name. Most recent requests are listed first.
+func ReadRecoveryApprovals(clusterName string) ([]RecoveryApproval, error) {
+	whereCondition := `
+		where
+			request_timestamp > NOW() - INTERVAL 1 DAY
+			and (cluster_name = ? or ? = '')
+		`
+	return readRecoveryApprovals(whereCondition, sqlutils.Args(clusterName, clusterName), "")
+}
+
+// readLatestRecoveryApproval reads the most recent approval request for recovering given failure of given instance
+func readLatestRecoveryApproval(instanceKey *inst.InstanceKey, analysis inst.AnalysisCode) (*RecoveryApproval, error) {
+	whereCondition := `
+		where
+			hostname = ?
+			and port = ?
+			and analysis = ?
+		`
+	approvals, err := readRecoveryApprovals(whereCondition, sqlutils.Args(instanceKey.Hostname, instanceKey.Port, string(analysis)), "limit 1")
+	if err != nil || len(approvals) == 0 {
+		return nil, err
+	}
+	return &approvals[0], nil
+}
+
+// readPendingInstanceRecoveryApproval reads the pending approval request for recovering given instance, if any
+func readPendingInstanceRecoveryApproval(instanceKey *inst.InstanceKey) (*RecoveryApproval, error) {
+	whereCondition := `
+		where
+			hostname = ?
+			and port = ?
+			and approval_status = ?
+			and expires_at > NOW()
+		`
+	approvals, err := readRecoveryApprovals(whereCondition, sqlutils.Args(instanceKey.Hostname, instanceKey.Port, string(RecoveryApprovalPending)), "limit 1")
+	if err != nil || len(approvals) == 0 {
+		return nil, err
+	}
+	return &approvals[0], nil
+}
+
+// ExpireRecoveryApprovalHistory removes old rows from the topology_recovery_approval table
+func ExpireRecoveryApprovalHistory() error {
+	return inst.ExpireTableData("topology_recovery_approval", "request_timestamp")
+}
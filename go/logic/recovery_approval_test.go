@@ -0,0 +1,207 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"testing"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+var approvalInstanceKey = inst.InstanceKey{Hostname: "approval-master", Port: 3306}
+
+func newApprovalAnalysisEntry() *inst.ReplicationAnalysis {
+	analysisEntry := &inst.ReplicationAnalysis{
+		AnalyzedInstanceKey: approvalInstanceKey,
+		Analysis:            inst.DeadMaster,
+	}
+	analysisEntry.ClusterDetails.ClusterName = "approval-master:3306"
+	analysisEntry.ClusterDetails.ClusterAlias = "approval"
+	return analysisEntry
+}
+
+func TestRecoveryApprovalRequestApproveRecover(t *testing.T) {
+	withSQLiteBackend(t)
+	analysisEntry := newApprovalAnalysisEntry()
+
+	test.S(t).ExpectEquals(readRecoveryApprovalUID(analysisEntry, config.RecoveryAutomationApprove, "master"), "")
+	approval, err := readLatestRecoveryApproval(&approvalInstanceKey, inst.DeadMaster)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectNotNil(approval)
+	test.S(t).ExpectEquals(approval.Status, RecoveryApprovalPending)
+	test.S(t).ExpectEquals(approval.ClusterAlias, "approval")
+	requestUID := approval.UID
+
+	// A pending request is not raised again
+	test.S(t).ExpectEquals(readRecoveryApprovalUID(analysisEntry, config.RecoveryAutomationApprove, "master"), "")
+	approvals, err := ReadRecoveryApprovals("")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(approvals), 1)
+
+	approval, err = ApproveRecovery(&approvalInstanceKey, "ops")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(approval.UID, requestUID)
+	test.S(t).ExpectEquals(approval.DecidedBy, "ops")
+	test.S(t).ExpectEquals(approval.ExpiresAtString, inst.AddSecondsToTimeString(approval.DecidedAtString, config.Config.RecoveryApprovalTimeoutSeconds))
+
+	test.S(t).ExpectNotEquals(readRecoveryApprovalUID(analysisEntry, config.RecoveryAutomationApprove, "master"), "")
+
+	// Nothing left to decide
+	_, err = RejectRecovery(&approvalInstanceKey, "ops")
+	test.S(t).ExpectNotNil(err)
+}
+
+func TestRecoveryApprovalNotAppliedToOtherAutomationLevels(t *testing.T) {
+	withSQLiteBackend(t)
+	analysisEntry := newApprovalAnalysisEntry()
+
+	test.S(t).ExpectEquals(readRecoveryApprovalUID(analysisEntry, config.RecoveryAutomationAuto, "master"), "")
+	approval, err := readLatestRecoveryApproval(&approvalInstanceKey, inst.DeadMaster)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(approval == nil)
+}
+
+func TestRecoveryApprovalExpiredRequestIsRaisedAgain(t *testing.T) {
+	withSQLiteBackend(t)
+	analysisEntry := newApprovalAnalysisEntry()
+
+	err := writeRecoveryApproval(&RecoveryApproval{
+		UID:               "expired-request",
+		Key:               approvalInstanceKey,
+		Analysis:          inst.DeadMaster,
+		ClusterName:       "approval-master:3306",
+		ClusterAlias:      "approval",
+		FailureClass:      "master",
+		Status:            RecoveryApprovalPending,
+		RequestedAtString: "2020-01-01 00:00:00",
+		ExpiresAtString:   "2020-01-01 00:05:00",
+		DecidedAtString:   "1971-01-01 00:00:00",
+	})
+	test.S(t).ExpectNil(err)
+	approval, err := readLatestRecoveryApproval(&approvalInstanceKey, inst.DeadMaster)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(approval.Status, RecoveryApprovalExpired)
+
+	_, err = ApproveRecovery(&approvalInstanceKey, "ops")
+	test.S(t).ExpectNotNil(err)
+
+	test.S(t).ExpectEquals(readRecoveryApprovalUID(analysisEntry, config.RecoveryAutomationApprove, "master"), "")
+	approval, err = readLatestRecoveryApproval(&approvalInstanceKey, inst.DeadMaster)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(approval.Status, RecoveryApprovalPending)
+	test.S(t).ExpectNotEquals(approval.UID, "expired-request")
+
+	_, err = ApproveRecovery(&approvalInstanceKey, "ops")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectNotEquals(readRecoveryApprovalUID(analysisEntry, config.RecoveryAutomationApprove, "master"), "")
+}
+
+func TestRecoveryApprovalRejectedRequestIsNotRaisedAgain(t *testing.T) {
+	withSQLiteBackend(t)
+	analysisEntry := newApprovalAnalysisEntry()
+
+	test.S(t).ExpectEquals(readRecoveryApprovalUID(analysisEntry, config.RecoveryAutomationApprove, "master"), "")
+	approval, err := RejectRecovery(&approvalInstanceKey, "ops")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(approval.Status, RecoveryApprovalRejected)
+
+	test.S(t).ExpectEquals(readRecoveryApprovalUID(analysisEntry, config.RecoveryAutomationApprove, "master"), "")
+	approvals, err := ReadRecoveryApprovals("")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(approvals), 1)
+	test.S(t).ExpectEquals(approvals[0].Status, RecoveryApprovalRejected)
+}
+
+func TestReadLatestRecoveryApproval(t *testing.T) {
+	withSQLiteBackend(t)
+
+	for _, approval := range []RecoveryApproval{
+		{UID: "older", RequestedAtString: "2020-01-01 00:00:00"},
+		{UID: "latest", RequestedAtString: "2020-01-03 00:00:00"},
+		{UID: "middle", RequestedAtString: "2020-01-02 00:00:00"},
+	} {
+		approval.Key = approvalInstanceKey
+		approval.Analysis = inst.DeadMaster
+		approval.Status = RecoveryApprovalRejected
+		approval.ExpiresAtString = approval.RequestedAtString
+		approval.DecidedAtString = approval.RequestedAtString
+		test.S(t).ExpectNil(writeRecoveryApproval(&approval))
+	}
+	approval, err := readLatestRecoveryApproval(&approvalInstanceKey, inst.DeadMaster)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(approval.UID, "latest")
+
+	approval, err = readLatestRecoveryApproval(&approvalInstanceKey, inst.DeadMasterAndSomeSlaves)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(approval == nil)
+}
+
+func TestRecoveryApprovalConsumedByRecovery(t *testing.T) {
+	withSQLiteBackend(t)
+	analysisEntry := newApprovalAnalysisEntry()
+
+	test.S(t).ExpectEquals(readRecoveryApprovalUID(analysisEntry, config.RecoveryAutomationApprove, "master"), "")
+	pendingApproval, err := readLatestRecoveryApproval(&approvalInstanceKey, inst.DeadMaster)
+	test.S(t).ExpectNil(err)
+	{
+		// A pending request does not allow a recovery
+		topologyRecovery, err := attemptApprovedRecoveryRegistration(analysisEntry, pendingApproval.UID, true, true)
+		test.S(t).ExpectNotNil(err)
+		test.S(t).ExpectTrue(topologyRecovery == nil)
+	}
+	_, err = ApproveRecovery(&approvalInstanceKey, "ops")
+	test.S(t).ExpectNil(err)
+	approvalUID := readRecoveryApprovalUID(analysisEntry, config.RecoveryAutomationApprove, "master")
+	test.S(t).ExpectEquals(approvalUID, pendingApproval.UID)
+
+	topologyRecovery, err := attemptApprovedRecoveryRegistration(analysisEntry, approvalUID, true, true)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectNotNil(topologyRecovery)
+	recoveries, err := ReadRecentRecoveries(analysisEntry.ClusterDetails.ClusterName, false, 0)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(recoveries), 1)
+	test.S(t).ExpectEquals(recoveries[0].RecoveryApprovalUID, approvalUID)
+
+	approval, err := readLatestRecoveryApproval(&approvalInstanceKey, inst.DeadMaster)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(approval.Status, RecoveryApprovalConsumed)
+	{
+		// No other recovery may consume the same approval, fenced or not
+		otherEntry := *analysisEntry
+		otherEntry.AnalyzedInstanceKey = inst.InstanceKey{Hostname: "approval-other", Port: 3306}
+		otherRecovery := NewTopologyRecovery(otherEntry)
+		otherRecovery.RecoveryApprovalUID = approvalUID
+		otherRecovery, err := insertTopologyRecovery(otherRecovery, false, false, false)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectTrue(otherRecovery == nil)
+	}
+
+	// The next failure requires a new approval
+	test.S(t).ExpectEquals(readRecoveryApprovalUID(analysisEntry, config.RecoveryAutomationApprove, "master"), "")
+	approvals, err := ReadRecoveryApprovals("")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(approvals), 2)
+	for _, approval := range approvals {
+		if approval.UID == approvalUID {
+			test.S(t).ExpectEquals(approval.Status, RecoveryApprovalConsumed)
+		} else {
+			test.S(t).ExpectEquals(approval.Status, RecoveryApprovalPending)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	orcraft "github.com/github/orchestrator/go/raft"
+)
+
+// RecoveryBlock is a recent recovery of a cluster, which blocks further recoveries on that cluster until
+// RecoveryPeriodBlockSeconds pass, or until the block is cleared. A block may be extended beyond that period.
+type RecoveryBlock struct {
+	ClusterName            string
+	ClusterAlias           string
+	BlockingRecoveryId     int64
+	BlockingRecoveryUID    string
+	FailedInstanceKey      inst.InstanceKey
+	Analysis               inst.AnalysisCode
+	RecoveryStartTimestamp string
+	BlockedUntil           time.Time
+	RemainingSeconds       int64
+	IsExtended             bool
+	BlockedRecoveries      []BlockedTopologyRecovery // failures detected since, whose recoveries are blocked
+}
+
+// RecoveryBlockChange is a manual change to a cluster's recovery block: clearing it, or, given positive
+// ExtendSeconds, extending it to that many seconds from now
+type RecoveryBlockChange struct {
+	ClusterName   string
+	ClusterAlias  string
+	ExtendSeconds int64
+}
+
+// getClusterAlias returns the alias of a cluster, or an empty string when unknown. Records of a cluster are also
+// found by its alias: e.g. the recovery of a master was registered under the cluster's name prior to the failover
+func getClusterAlias(clusterName string) string {
+	if clusterName == "" {
+		return ""
+	}
+	clusterInfo, err := inst.ReadClusterInfo(clusterName)
+	if err != nil || clusterInfo == nil {
+		return ""
+	}
+	return clusterInfo.ClusterAlias
+}
+
+// newRecoveryBlock computes the expiry of a block, given the start time of the blocking recovery and the
+// time until which the block was extended, if at all (as unix timestamps)
+func newRecoveryBlock(startActivePeriodUnixtime int64, blockUntilUnixtime int64, now time.Time) *RecoveryBlock {
+	recoveryBlock := &RecoveryBlock{BlockedRecoveries: []BlockedTopologyRecovery{}}
+	blockedUntilUnixtime := startActivePeriodUnixtime + int64(config.Config.RecoveryPeriodBlockSeconds)
+	if blockUntilUnixtime > blockedUntilUnixtime {
+		blockedUntilUnixtime = blockUntilUnixtime
+		recoveryBlock.IsExtended = true
+	}
+	recoveryBlock.BlockedUntil = time.Unix(blockedUntilUnixtime, 0)
+	if remaining := blockedUntilUnixtime - now.Unix(); remaining > 0 {
+		recoveryBlock.RemainingSeconds = remaining
+	}
+	return recoveryBlock
+}
+
+// ReadClusterRecoveryBlocks reads the recovery blocks of a cluster, along with the recoveries each is blocking.
+// A cluster's recovery blocks are matched by the cluster's name or alias, or by the alias of the recoveries' successor.
+func ReadClusterRecoveryBlocks(clusterName string) ([]*RecoveryBlock, error) {
+	recoveryBlocks, err := readRecoveryBlocks(clusterName, getClusterAlias(clusterName))
+	if err != nil || len(recoveryBlocks) == 0 {
+		return recoveryBlocks, err
+	}
+	// Blocked recoveries are matched by their blocking recovery, as they may be of a cluster whose name changed since
+	blockedRecoveries, err := ReadBlockedRecoveries("")
+	if err != nil {
+		return recoveryBlocks, err
+	}
+	for _, recoveryBlock := range recoveryBlocks {
+		for _, blockedRecovery := range blockedRecoveries {
+			if blockedRecovery.BlockingRecoveryId == recoveryBlock.BlockingRecoveryId {
+				recoveryBlock.BlockedRecoveries = append(recoveryBlock.BlockedRecoveries, blockedRecovery)
+			}
+		}
+	}
+	return recoveryBlocks, nil
+}
+
+// ReadRecoveryBlocks reads the recovery blocks of all clusters
+func ReadRecoveryBlocks() ([]*RecoveryBlock, error) {
+	return ReadClusterRecoveryBlocks("")
+}
+
+// applyRecoveryBlockChange clears or extends the recovery blocks of a cluster in the backend
+func applyRecoveryBlockChange(change *RecoveryBlockChange) error {
+	if change.ExtendSeconds > 0 {
+		return extendClusterRecoveryBlocks(change.ClusterName, change.ClusterAlias, change.ExtendSeconds)
+	}
+	return clearClusterRecoveryBlocks(change.ClusterName, change.ClusterAlias)
+}
+
+// changeRecoveryBlock applies a change to the recovery blocks of a cluster, and audits it on each of the
+// blocking recoveries' failed instances
+func changeRecoveryBlock(change *RecoveryBlockChange, auditType string, message string) (recoveryBlocks []*RecoveryBlock, err error) {
+	recoveryBlocks, err = ReadClusterRecoveryBlocks(change.ClusterName)
+	if err != nil {
+		return recoveryBlocks, err
+	}
+	if len(recoveryBlocks) == 0 {
+		return recoveryBlocks, fmt.Errorf("Cluster %s has no recovery block", change.ClusterName)
+	}
+	if orcraft.IsRaftEnabled() {
+		_, err = orcraft.PublishCommand("change-recovery-block", change)
+	} else {
+		err = applyRecoveryBlockChange(change)
+	}
+	if err != nil {
+		return recoveryBlocks, err
+	}
+	for _, recoveryBlock := range recoveryBlocks {
+		inst.AuditOperation(auditType, &recoveryBlock.FailedInstanceKey, fmt.Sprintf("cluster %s: recovery %s: %s", change.ClusterName, recoveryBlock.BlockingRecoveryUID, message))
+	}
+	return recoveryBlocks, nil
+}
+
+// ClearRecoveryBlock lifts the recovery block of a cluster, allowing further recoveries on it. Unlike acknowledging
+// the blocking recoveries, this does not mark them as acknowledged.
+func ClearRecoveryBlock(clusterName string, owner string, reason string) ([]*RecoveryBlock, error) {
+	change := &RecoveryBlockChange{ClusterName: clusterName, ClusterAlias: getClusterAlias(clusterName)}
+	return changeRecoveryBlock(change, "clear-recovery-block", fmt.Sprintf("cleared by %s: %s", owner, reason))
+}
+
+// ExtendRecoveryBlock keeps blocking recoveries on a cluster for given number of seconds from now, even beyond
+// RecoveryPeriodBlockSeconds
+func ExtendRecoveryBlock(clusterName string, extendSeconds int64, owner string, reason string) ([]*RecoveryBlock, error) {
+	if extendSeconds <= 0 {
+		return nil, fmt.Errorf("ExtendRecoveryBlock: expected positive number of seconds; got %d", extendSeconds)
+	}
+	change := &RecoveryBlockChange{ClusterName: clusterName, ClusterAlias: getClusterAlias(clusterName), ExtendSeconds: extendSeconds}
+	return changeRecoveryBlock(change, "extend-recovery-block", fmt.Sprintf("extended by %s for %ds: %s", owner, extendSeconds, reason))
+}
+
+// AddBlockedRecoveryProblems flags the failed instances among given problem instances whose recovery is blocked by
+// a recent recovery, and adds those which are not already listed: human intervention is likely required. Downtimed and
+// ignored instances are not added.
+func AddBlockedRecoveryProblems(instances [](*inst.Instance), clusterName string) ([](*inst.Instance), error) {
+	blockedRecoveries, err := ReadBlockedRecoveries(clusterName)
+	if err != nil || len(blockedRecoveries) == 0 {
+		return instances, err
+	}
+	listed := inst.NewInstanceKeyMap()
+	for _, instance := range instances {
+		listed.AddKey(instance.Key)
+	}
+	blockedKeys := inst.NewInstanceKeyMap()
+	for _, blockedRecovery := range blockedRecoveries {
+		blockedKeys.AddKey(blockedRecovery.FailedInstanceKey)
+		if listed.HasKey(blockedRecovery.FailedInstanceKey) {
+			continue
+		}
+		instance, found, err := inst.ReadInstance(&blockedRecovery.FailedInstanceKey)
+		if err != nil {
+			return instances, err
+		}
+		if !found || instance.IsDowntimed || inst.RegexpMatchPatterns(instance.Key.Hostname, config.Config.ProblemIgnoreHostnameFilters) {
+			continue
+		}
+		listed.AddKey(instance.Key)
+		instances = append(instances, instance)
+	}
+	for _, instance := range instances {
+		instance.IsRecoveryBlocked = blockedKeys.HasKey(instance.Key)
+	}
+	return instances, nil
+}
@@ -0,0 +1,107 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+// recoveryBlockClusterCondition matches the recoveries of a cluster, given its name and alias. A master recovery changes
+// the cluster's name, and so the recoveries of a cluster are also those whose cluster or successor have its alias.
+const recoveryBlockClusterCondition = `(
+		cluster_name = ?
+		or (? != '' and (cluster_alias = ? or successor_alias = ?))
+	)`
+
+// readRecoveryBlocks reads the recoveries in active period, potentially filtered by cluster name and alias (empty to unfilter)
+func readRecoveryBlocks(clusterName string, clusterAlias string) ([]*RecoveryBlock, error) {
+	res := []*RecoveryBlock{}
+	query := `
+		select
+				recovery_id,
+				uid,
+				hostname,
+				port,
+				cluster_name,
+				cluster_alias,
+				analysis,
+				start_active_period,
+				unix_timestamp(start_active_period) as start_active_period_unixtime,
+				block_until_unixtime
+			from
+				topology_recovery
+			where
+				in_active_period = 1
+				and (? = '' or ` + recoveryBlockClusterCondition + `)
+			order by
+				recovery_id desc
+		`
+	now := time.Now()
+	args := sqlutils.Args(clusterName, clusterName, clusterAlias, clusterAlias, clusterAlias)
+	err := db.QueryOrchestrator(query, args, func(m sqlutils.RowMap) error {
+		recoveryBlock := newRecoveryBlock(m.GetInt64("start_active_period_unixtime"), m.GetInt64("block_until_unixtime"), now)
+		recoveryBlock.BlockingRecoveryId = m.GetInt64("recovery_id")
+		recoveryBlock.BlockingRecoveryUID = m.GetString("uid")
+		recoveryBlock.FailedInstanceKey.Hostname = m.GetString("hostname")
+		recoveryBlock.FailedInstanceKey.Port = m.GetInt("port")
+		recoveryBlock.ClusterName = m.GetString("cluster_name")
+		recoveryBlock.ClusterAlias = m.GetString("cluster_alias")
+		recoveryBlock.Analysis = inst.AnalysisCode(m.GetString("analysis"))
+		recoveryBlock.RecoveryStartTimestamp = m.GetString("start_active_period")
+
+		res = append(res, recoveryBlock)
+		return nil
+	})
+	return res, log.Errore(err)
+}
+
+// clearClusterRecoveryBlocks clears the "in_active_period" flag of a cluster's recoveries, without acknowledging them
+func clearClusterRecoveryBlocks(clusterName string, clusterAlias string) error {
+	_, err := db.ExecOrchestrator(`
+			update topology_recovery set
+				in_active_period = 0,
+				end_active_period_unixtime = UNIX_TIMESTAMP(),
+				block_until_unixtime = 0
+			where
+				in_active_period = 1
+				and `+recoveryBlockClusterCondition+`
+			`, clusterName, clusterAlias, clusterAlias, clusterAlias,
+	)
+	return log.Errore(err)
+}
+
+// extendClusterRecoveryBlocks keeps a cluster's recoveries in active period for given number of seconds from now
+func extendClusterRecoveryBlocks(clusterName string, clusterAlias string, extendSeconds int64) error {
+	if extendSeconds <= 0 {
+		return fmt.Errorf("extendClusterRecoveryBlocks: expected positive number of seconds; got %d", extendSeconds)
+	}
+	_, err := db.ExecOrchestrator(`
+			update topology_recovery set
+				block_until_unixtime = UNIX_TIMESTAMP() + ?
+			where
+				in_active_period = 1
+				and `+recoveryBlockClusterCondition+`
+			`, extendSeconds, clusterName, clusterAlias, clusterAlias, clusterAlias,
+	)
+	return log.Errore(err)
+}
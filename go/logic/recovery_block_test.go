@@ -0,0 +1,109 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+func TestNewRecoveryBlock(t *testing.T) {
+	recoveryPeriodBlockSeconds := config.Config.RecoveryPeriodBlockSeconds
+	defer func() { config.Config.RecoveryPeriodBlockSeconds = recoveryPeriodBlockSeconds }()
+	config.Config.RecoveryPeriodBlockSeconds = 3600
+
+	now := time.Now()
+	recoveryBlock := newRecoveryBlock(now.Unix()-600, 0, now)
+	test.S(t).ExpectFalse(recoveryBlock.IsExtended)
+	test.S(t).ExpectEquals(recoveryBlock.RemainingSeconds, int64(3000))
+
+	recoveryBlock = newRecoveryBlock(now.Unix()-600, now.Unix()+7200, now)
+	test.S(t).ExpectTrue(recoveryBlock.IsExtended)
+	test.S(t).ExpectEquals(recoveryBlock.RemainingSeconds, int64(7200))
+
+	recoveryBlock = newRecoveryBlock(now.Unix()-7200, 0, now)
+	test.S(t).ExpectEquals(recoveryBlock.RemainingSeconds, int64(0))
+}
+
+// writeTestMasterRecovery writes a successful recovery of a dead master, having promoted given successor
+func writeTestMasterRecovery(t *testing.T, failedKey inst.InstanceKey, successorKey inst.InstanceKey, clusterAlias string) *TopologyRecovery {
+	analysisEntry := inst.ReplicationAnalysis{AnalyzedInstanceKey: failedKey, Analysis: inst.DeadMaster}
+	analysisEntry.ClusterDetails.ClusterName = failedKey.StringCode()
+	analysisEntry.ClusterDetails.ClusterAlias = clusterAlias
+	topologyRecovery, err := writeTopologyRecovery(NewTopologyRecovery(analysisEntry))
+	test.S(t).ExpectNil(err)
+	topologyRecovery.IsSuccessful = true
+	topologyRecovery.SuccessorKey = &successorKey
+	topologyRecovery.SuccessorAlias = clusterAlias
+	test.S(t).ExpectNil(writeResolveRecovery(topologyRecovery))
+	return topologyRecovery
+}
+
+func TestRecoveryBlocksFollowClusterAlias(t *testing.T) {
+	withSQLiteBackend(t)
+
+	// The master of "shop" failed over from db-1 onto db-2, which now names the cluster
+	writeTestMasterRecovery(t, inst.InstanceKey{Hostname: "db-1", Port: 3306}, inst.InstanceKey{Hostname: "db-2", Port: 3306}, "shop")
+	writeTestInstance(t, inst.InstanceKey{Hostname: "db-2", Port: 3306}, inst.InstanceKey{}, "db-2:3306")
+	test.S(t).ExpectNil(inst.SetClusterAlias("db-2:3306", "shop"))
+	// An unrelated cluster
+	writeTestMasterRecovery(t, inst.InstanceKey{Hostname: "db-7", Port: 3306}, inst.InstanceKey{Hostname: "db-8", Port: 3306}, "books")
+
+	recoveryBlocks, err := ReadClusterRecoveryBlocks("db-2:3306")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(recoveryBlocks), 1)
+	test.S(t).ExpectEquals(recoveryBlocks[0].ClusterName, "db-1:3306")
+	test.S(t).ExpectEquals(recoveryBlocks[0].ClusterAlias, "shop")
+
+	// A failure in the renamed cluster is blocked by the recovery
+	analysisEntry := inst.ReplicationAnalysis{AnalyzedInstanceKey: inst.InstanceKey{Hostname: "db-2", Port: 3306}, Analysis: inst.DeadMaster}
+	analysisEntry.ClusterDetails.ClusterName = "db-2:3306"
+	blockingRecoveries := []TopologyRecovery{{Id: recoveryBlocks[0].BlockingRecoveryId}}
+	test.S(t).ExpectNil(RegisterBlockedRecoveries(&analysisEntry, blockingRecoveries))
+	recoveryBlocks, err = ReadClusterRecoveryBlocks("db-2:3306")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(recoveryBlocks[0].BlockedRecoveries), 1)
+
+	allRecoveryBlocks, err := ReadRecoveryBlocks()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(allRecoveryBlocks), 2)
+
+	recoveryBlocks, err = ExtendRecoveryBlock("db-2:3306", 7200, "test", "investigating")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(recoveryBlocks), 1)
+	recoveryBlocks, err = ReadClusterRecoveryBlocks("db-2:3306")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(recoveryBlocks[0].IsExtended)
+
+	_, err = ClearRecoveryBlock("db-2:3306", "test", "resolved")
+	test.S(t).ExpectNil(err)
+	recoveryBlocks, err = ReadClusterRecoveryBlocks("db-2:3306")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(recoveryBlocks), 0)
+	_, err = ClearRecoveryBlock("db-2:3306", "test", "resolved")
+	test.S(t).ExpectNotNil(err)
+
+	// The unrelated cluster remains blocked
+	allRecoveryBlocks, err = ReadRecoveryBlocks()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(allRecoveryBlocks), 1)
+	test.S(t).ExpectEquals(allRecoveryBlocks[0].ClusterAlias, "books")
+}
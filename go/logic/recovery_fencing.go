@@ -0,0 +1,224 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	orcraft "github.com/github/orchestrator/go/raft"
+	"github.com/openark/golib/log"
+	"github.com/patrickmn/go-cache"
+)
+
+// activeRecoveryPollInterval is how often a joined or aborted recovery is checked for completion
+const activeRecoveryPollInterval = time.Second
+
+// activeRecoveryOverrides holds, per cluster alias, the grant a manual recovery command got via --active-recovery
+// override, to register its recovery alongside one in flight. The grant is consumed by that registration.
+var activeRecoveryOverrides = cache.New(time.Hour, time.Minute)
+
+// ActiveRecoveryPolicy is how a manual recovery command treats recoveries already in flight on its cluster
+type ActiveRecoveryPolicy string
+
+const (
+	RefuseActiveRecovery   ActiveRecoveryPolicy = ""
+	JoinActiveRecovery     ActiveRecoveryPolicy = "join"
+	AbortActiveRecovery    ActiveRecoveryPolicy = "abort"
+	OverrideActiveRecovery ActiveRecoveryPolicy = "override"
+)
+
+// ParseActiveRecoveryPolicy parses a policy as given on the command line or via API
+func ParseActiveRecoveryPolicy(policy string) (ActiveRecoveryPolicy, error) {
+	switch activeRecoveryPolicy := ActiveRecoveryPolicy(policy); activeRecoveryPolicy {
+	case RefuseActiveRecovery, JoinActiveRecovery, AbortActiveRecovery, OverrideActiveRecovery:
+		return activeRecoveryPolicy, nil
+	}
+	return RefuseActiveRecovery, fmt.Errorf("Unknown active recovery policy: %s. Expected one of: join, abort, override", policy)
+}
+
+// RecoveryAbortRequest is a request to abort an in-flight recovery before it promotes a server
+type RecoveryAbortRequest struct {
+	RecoveryUID        string
+	RequestedBy        string
+	Reason             string
+	RequestedTimestamp string
+}
+
+// describeActiveRecovery is a human readable description of an in-flight recovery
+func describeActiveRecovery(topologyRecovery *TopologyRecovery) string {
+	return fmt.Sprintf("%s of %+v (uid %s), started %s on %s", topologyRecovery.AnalysisEntry.Analysis, topologyRecovery.AnalysisEntry.AnalyzedInstanceKey,
+		topologyRecovery.UID, topologyRecovery.RecoveryStartTimestamp, topologyRecovery.ProcessingNodeHostname)
+}
+
+// persistRecoveryAbortRequest writes an abort request, via raft where applicable, so that it reaches the node running the recovery
+func persistRecoveryAbortRequest(abortRequest *RecoveryAbortRequest) error {
+	if orcraft.IsRaftEnabled() {
+		_, err := orcraft.PublishCommand("request-recovery-abort", abortRequest)
+		return log.Errore(err)
+	}
+	return writeRecoveryAbortRequest(abortRequest)
+}
+
+// checkRecoveryAbortRequested is consulted by a recovery before it promotes a server. It returns an error, failing
+// the recovery, when an abort was requested.
+func checkRecoveryAbortRequested(topologyRecovery *TopologyRecovery) error {
+	abortRequest, err := readRecoveryAbortRequest(topologyRecovery.UID)
+	if err != nil || abortRequest == nil {
+		return nil
+	}
+	AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("aborting: abort requested by %s: %s", abortRequest.RequestedBy, abortRequest.Reason))
+	return fmt.Errorf("recovery %s aborted as requested by %s", topologyRecovery.UID, abortRequest.RequestedBy)
+}
+
+// waitForRecoveryEnd waits, up to ActiveRecoveryWaitTimeoutSeconds, for given recovery to complete, and returns it as completed
+func waitForRecoveryEnd(recoveryUID string) (*TopologyRecovery, error) {
+	timeout := time.Duration(config.Config.ActiveRecoveryWaitTimeoutSeconds) * time.Second
+	deadline := time.Now().Add(timeout)
+	for {
+		recoveries, err := ReadRecoveryByUID(recoveryUID)
+		if err != nil {
+			return nil, err
+		}
+		if len(recoveries) == 0 {
+			return nil, fmt.Errorf("recovery %s not found", recoveryUID)
+		}
+		if recoveries[0].RecoveryEndTimestamp != "" {
+			return &recoveries[0], nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("recovery %s did not complete within %+v", recoveryUID, timeout)
+		}
+		time.Sleep(activeRecoveryPollInterval)
+	}
+}
+
+// grantActiveRecoveryOverride lets the next manual recovery registration on given cluster proceed alongside a
+// recovery in flight. The grant outlasts a graceful takeover waiting for its replica to catch up.
+func grantActiveRecoveryOverride(clusterAlias string, owner string) {
+	expiry := time.Minute + time.Duration(config.Config.GracefulTakeoverCatchUpTimeoutSeconds)*time.Second
+	activeRecoveryOverrides.Set(clusterAlias, owner, expiry)
+}
+
+// consumeActiveRecoveryOverride returns true when a manual recovery command was granted an override on given
+// cluster, and consumes the grant
+func consumeActiveRecoveryOverride(clusterAlias string) bool {
+	if _, found := activeRecoveryOverrides.Get(clusterAlias); !found {
+		return false
+	}
+	activeRecoveryOverrides.Delete(clusterAlias)
+	return true
+}
+
+// isJoinableRecovery returns true when given in-flight recovery is what the command would itself run: the same
+// analysis on the same failed instance. Any other recovery, e.g. of an intermediate master, does not answer the command.
+func isJoinableRecovery(activeRecovery *TopologyRecovery, failedInstanceKey *inst.InstanceKey, analysis inst.AnalysisCode) bool {
+	if failedInstanceKey == nil || analysis == inst.NoProblem {
+		return false
+	}
+	return activeRecovery.AnalysisEntry.AnalyzedInstanceKey.Equals(failedInstanceKey) && activeRecovery.AnalysisEntry.Analysis == analysis
+}
+
+// FenceActiveMasterRecovery fences a manual recovery command which fails over the master of given cluster.
+// See FenceActiveRecovery.
+func FenceActiveMasterRecovery(clusterName string, policy ActiveRecoveryPolicy, owner string) (joinedRecovery *TopologyRecovery, err error) {
+	var masterKey *inst.InstanceKey
+	if clusterMasters, err := inst.ReadClusterWriteableMaster(clusterName); err == nil && len(clusterMasters) == 1 {
+		masterKey = &clusterMasters[0].Key
+	}
+	return FenceActiveRecovery(clusterName, masterKey, inst.DeadMaster, policy, owner)
+}
+
+// FenceActiveInstanceRecovery fences a manual recovery command on given instance, which recovers whatever the
+// instance's analysis is. See FenceActiveRecovery.
+func FenceActiveInstanceRecovery(instanceKey *inst.InstanceKey, policy ActiveRecoveryPolicy, owner string) (joinedRecovery *TopologyRecovery, err error) {
+	clusterName, err := inst.GetClusterName(instanceKey)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot fence recovery of %+v: cannot read its cluster: %+v", *instanceKey, err)
+	}
+	analysis := inst.NoProblem
+	if policy == JoinActiveRecovery {
+		replicationAnalysis, err := inst.GetReplicationAnalysis(clusterName, &inst.ReplicationAnalysisHints{IncludeDowntimed: true})
+		if err != nil {
+			return nil, err
+		}
+		for _, analysisEntry := range replicationAnalysis {
+			if analysisEntry.AnalyzedInstanceKey.Equals(instanceKey) {
+				analysis = analysisEntry.Analysis
+			}
+		}
+	}
+	return FenceActiveRecovery(clusterName, instanceKey, analysis, policy, owner)
+}
+
+// FenceActiveRecovery is consulted by manual recovery commands before they touch a cluster, so that they do not
+// conflict with recoveries already in flight on that cluster, whether automated or manual. The command is to recover
+// given analysis on given failed instance. Per policy, the command:
+//   - is refused (the default),
+//   - joins the in-flight recovery, provided it is of the same analysis on the same failed instance: waits for it to
+//     complete and takes its outcome as its own; joinedRecovery is then returned, and the command is not to run,
+//   - aborts the in-flight recovery: requests the abort, and waits for the recovery to complete. The command may run if
+//     the recovery aborted before promoting a server,
+//   - overrides the in-flight recovery, and runs alongside it.
+//
+// This is a courtesy check, which lets a command join or abort. Recovery registration fences atomically, and refuses
+// a recovery on a cluster with a recovery in flight, unless overridden.
+func FenceActiveRecovery(clusterName string, failedInstanceKey *inst.InstanceKey, analysis inst.AnalysisCode, policy ActiveRecoveryPolicy, owner string) (joinedRecovery *TopologyRecovery, err error) {
+	activeRecoveries, err := ReadActiveClusterRecovery(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	if len(activeRecoveries) == 0 {
+		return nil, nil
+	}
+	activeRecovery := &activeRecoveries[0]
+	description := describeActiveRecovery(activeRecovery)
+	switch policy {
+	case OverrideActiveRecovery:
+		grantActiveRecoveryOverride(activeRecovery.AnalysisEntry.ClusterDetails.ClusterAlias, owner)
+		inst.AuditOperation("active-recovery-override", &activeRecovery.AnalysisEntry.AnalyzedInstanceKey, fmt.Sprintf("%s overrides in-flight recovery %s", owner, description))
+		return nil, nil
+	case JoinActiveRecovery:
+		if !isJoinableRecovery(activeRecovery, failedInstanceKey, analysis) {
+			return nil, fmt.Errorf("Cannot join in-flight recovery %s: it does not recover %s on the same instance. Use abort or override", description, analysis)
+		}
+		log.Infof("FenceActiveRecovery: joining in-flight recovery %s", description)
+		joinedRecovery, err := waitForRecoveryEnd(activeRecovery.UID)
+		if err != nil {
+			return nil, err
+		}
+		inst.AuditOperation("active-recovery-join", &activeRecovery.AnalysisEntry.AnalyzedInstanceKey, fmt.Sprintf("%s joined recovery %s; successful: %+v", owner, activeRecovery.UID, joinedRecovery.IsSuccessful))
+		return joinedRecovery, nil
+	case AbortActiveRecovery:
+		abortRequest := &RecoveryAbortRequest{RecoveryUID: activeRecovery.UID, RequestedBy: owner, Reason: "aborted by a manual recovery command"}
+		if err := persistRecoveryAbortRequest(abortRequest); err != nil {
+			return nil, err
+		}
+		inst.AuditOperation("active-recovery-abort", &activeRecovery.AnalysisEntry.AnalyzedInstanceKey, fmt.Sprintf("%s requested abort of in-flight recovery %s", owner, description))
+		abortedRecovery, err := waitForRecoveryEnd(activeRecovery.UID)
+		if err != nil {
+			return nil, err
+		}
+		if abortedRecovery.IsSuccessful {
+			return nil, fmt.Errorf("In-flight recovery %s completed, promoting %+v, before it could be aborted. Not proceeding", activeRecovery.UID, *abortedRecovery.SuccessorKey)
+		}
+		return nil, nil
+	}
+	return nil, fmt.Errorf("Cluster %s has an in-flight recovery: %s. Use --active-recovery join|abort|override (command line) or ?active-recovery=join|abort|override (API) to proceed", clusterName, description)
+}
@@ -0,0 +1,67 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+// writeRecoveryAbortRequest writes a request to abort an in-flight recovery
+func writeRecoveryAbortRequest(abortRequest *RecoveryAbortRequest) error {
+	_, err := db.ExecOrchestrator(`
+			replace into topology_recovery_abort (
+					recovery_uid, requested_by, reason, requested_timestamp
+				) values (
+					?, ?, ?, NOW()
+				)
+			`, abortRequest.RecoveryUID, abortRequest.RequestedBy, abortRequest.Reason,
+	)
+	return log.Errore(err)
+}
+
+// readRecoveryAbortRequest reads the request to abort given recovery, if any
+func readRecoveryAbortRequest(recoveryUID string) (abortRequest *RecoveryAbortRequest, err error) {
+	query := `
+		select
+			recovery_uid,
+			requested_by,
+			reason,
+			requested_timestamp
+		from
+			topology_recovery_abort
+		where
+			recovery_uid = ?
+		`
+	err = db.QueryOrchestrator(query, sqlutils.Args(recoveryUID), func(m sqlutils.RowMap) error {
+		abortRequest = &RecoveryAbortRequest{
+			RecoveryUID:        m.GetString("recovery_uid"),
+			RequestedBy:        m.GetString("requested_by"),
+			Reason:             m.GetString("reason"),
+			RequestedTimestamp: m.GetString("requested_timestamp"),
+		}
+		return nil
+	})
+	return abortRequest, log.Errore(err)
+}
+
+// ExpireRecoveryAbortRequests removes old rows from the topology_recovery_abort table
+func ExpireRecoveryAbortRequests() error {
+	return inst.ExpireTableData("topology_recovery_abort", "requested_timestamp")
+}
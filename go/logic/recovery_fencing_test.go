@@ -0,0 +1,214 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/github/orchestrator/go/process"
+	test "github.com/openark/golib/tests"
+)
+
+// writeTestActiveRecovery writes an in-flight recovery of given analysis on given failed instance
+func writeTestActiveRecovery(t *testing.T, failedKey inst.InstanceKey, analysis inst.AnalysisCode, clusterAlias string) *TopologyRecovery {
+	analysisEntry := inst.ReplicationAnalysis{AnalyzedInstanceKey: failedKey, Analysis: analysis}
+	analysisEntry.ClusterDetails.ClusterName = "fenced-master:3306"
+	analysisEntry.ClusterDetails.ClusterAlias = clusterAlias
+	topologyRecovery, err := writeTopologyRecovery(NewTopologyRecovery(analysisEntry))
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectNotNil(topologyRecovery)
+	return topologyRecovery
+}
+
+// resolveTestRecoveryLater resolves given recovery, in the background, once given condition holds
+func resolveTestRecoveryLater(topologyRecovery *TopologyRecovery, successorKey *inst.InstanceKey, condition func() bool) {
+	go func() {
+		for !condition() {
+			time.Sleep(10 * time.Millisecond)
+		}
+		topologyRecovery.IsSuccessful = (successorKey != nil)
+		topologyRecovery.SuccessorKey = successorKey
+		writeResolveRecovery(topologyRecovery)
+	}()
+}
+
+func TestParseActiveRecoveryPolicy(t *testing.T) {
+	for _, policy := range []string{"", "join", "abort", "override"} {
+		activeRecoveryPolicy, err := ParseActiveRecoveryPolicy(policy)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(string(activeRecoveryPolicy), policy)
+	}
+	activeRecoveryPolicy, err := ParseActiveRecoveryPolicy("wait")
+	test.S(t).ExpectNotNil(err)
+	test.S(t).ExpectEquals(activeRecoveryPolicy, RefuseActiveRecovery)
+}
+
+func TestFenceActiveRecovery(t *testing.T) {
+	withSQLiteBackend(t)
+
+	masterKey := inst.InstanceKey{Hostname: "fenced-master", Port: 3306}
+	intermediateMasterKey := inst.InstanceKey{Hostname: "fenced-intermediate", Port: 3306}
+	successorKey := inst.InstanceKey{Hostname: "fenced-replica", Port: 3306}
+	{
+		joinedRecovery, err := FenceActiveRecovery("fenced-master:3306", &masterKey, inst.DeadMaster, RefuseActiveRecovery, "test")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectTrue(joinedRecovery == nil)
+	}
+	activeRecovery := writeTestActiveRecovery(t, intermediateMasterKey, inst.DeadIntermediateMaster, "fenced")
+	{
+		_, err := FenceActiveRecovery("fenced-master:3306", &masterKey, inst.DeadMaster, RefuseActiveRecovery, "test")
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		// A takeover of the master does not join a recovery of an intermediate master
+		_, err := FenceActiveRecovery("fenced-master:3306", &masterKey, inst.DeadMaster, JoinActiveRecovery, "test")
+		test.S(t).ExpectNotNil(err)
+		_, err = FenceActiveRecovery("fenced-master:3306", &intermediateMasterKey, inst.DeadMaster, JoinActiveRecovery, "test")
+		test.S(t).ExpectNotNil(err)
+		_, err = FenceActiveRecovery("fenced-master:3306", nil, inst.DeadIntermediateMaster, JoinActiveRecovery, "test")
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		joinedRecovery, err := FenceActiveRecovery("fenced-master:3306", &masterKey, inst.DeadMaster, OverrideActiveRecovery, "test")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectTrue(joinedRecovery == nil)
+		test.S(t).ExpectTrue(consumeActiveRecoveryOverride("fenced"))
+		test.S(t).ExpectFalse(consumeActiveRecoveryOverride("fenced"))
+	}
+	{
+		resolveTestRecoveryLater(activeRecovery, &successorKey, func() bool { return true })
+		joinedRecovery, err := FenceActiveRecovery("fenced-master:3306", &intermediateMasterKey, inst.DeadIntermediateMaster, JoinActiveRecovery, "test")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectNotNil(joinedRecovery)
+		test.S(t).ExpectEquals(joinedRecovery.UID, activeRecovery.UID)
+		test.S(t).ExpectTrue(joinedRecovery.IsSuccessful)
+		test.S(t).ExpectTrue(joinedRecovery.SuccessorKey.Equals(&successorKey))
+	}
+}
+
+func TestAbortActiveRecovery(t *testing.T) {
+	withSQLiteBackend(t)
+
+	masterKey := inst.InstanceKey{Hostname: "fenced-master", Port: 3306}
+	successorKey := inst.InstanceKey{Hostname: "fenced-replica", Port: 3306}
+	{
+		// The recovery notices the abort request before promoting, and fails
+		activeRecovery := writeTestActiveRecovery(t, masterKey, inst.DeadMaster, "fenced")
+		test.S(t).ExpectNil(checkRecoveryAbortRequested(activeRecovery))
+		resolveTestRecoveryLater(activeRecovery, nil, func() bool { return checkRecoveryAbortRequested(activeRecovery) != nil })
+		joinedRecovery, err := FenceActiveRecovery("fenced-master:3306", &masterKey, inst.DeadMaster, AbortActiveRecovery, "test")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectTrue(joinedRecovery == nil)
+
+		abortRequest, err := readRecoveryAbortRequest(activeRecovery.UID)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(abortRequest.RequestedBy, "test")
+	}
+	{
+		// The recovery promotes a server before noticing the abort request: the command may not run
+		otherMasterKey := inst.InstanceKey{Hostname: "fenced-master", Port: 3307}
+		activeRecovery := writeTestActiveRecovery(t, otherMasterKey, inst.DeadMaster, "fenced")
+		resolveTestRecoveryLater(activeRecovery, &successorKey, func() bool { return true })
+		_, err := FenceActiveRecovery("fenced-master:3306", &otherMasterKey, inst.DeadMaster, AbortActiveRecovery, "test")
+		test.S(t).ExpectNotNil(err)
+	}
+}
+
+func TestAttemptRecoveryRegistrationFencesActiveRecovery(t *testing.T) {
+	withSQLiteBackend(t)
+
+	masterKey := inst.InstanceKey{Hostname: "fenced-master", Port: 3306}
+	intermediateMasterKey := inst.InstanceKey{Hostname: "fenced-intermediate", Port: 3306}
+	writeTestActiveRecovery(t, intermediateMasterKey, inst.DeadIntermediateMaster, "fenced")
+
+	analysisEntry := inst.ReplicationAnalysis{AnalyzedInstanceKey: masterKey, Analysis: inst.DeadMaster}
+	analysisEntry.ClusterDetails.ClusterName = "fenced-master:3306"
+	analysisEntry.ClusterDetails.ClusterAlias = "fenced"
+	{
+		topologyRecovery, err := insertTopologyRecovery(NewTopologyRecovery(analysisEntry), true, false, false)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectTrue(topologyRecovery == nil)
+	}
+	{
+		// A manual recovery is refused, however it got past any earlier check
+		topologyRecovery, err := AttemptRecoveryRegistration(&analysisEntry, false, false)
+		test.S(t).ExpectNotNil(err)
+		test.S(t).ExpectTrue(topologyRecovery == nil)
+	}
+	{
+		// An override grant does not apply to automated recoveries
+		grantActiveRecoveryOverride("fenced", "test")
+		topologyRecovery, err := AttemptRecoveryRegistration(&analysisEntry, true, true)
+		test.S(t).ExpectNotNil(err)
+		test.S(t).ExpectTrue(topologyRecovery == nil)
+	}
+	{
+		topologyRecovery, err := AttemptRecoveryRegistration(&analysisEntry, false, false)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectNotNil(topologyRecovery)
+		test.S(t).ExpectFalse(consumeActiveRecoveryOverride("fenced"))
+	}
+	{
+		// Other clusters are unaffected
+		otherEntry := inst.ReplicationAnalysis{AnalyzedInstanceKey: inst.InstanceKey{Hostname: "other-master", Port: 3306}, Analysis: inst.DeadMaster}
+		otherEntry.ClusterDetails.ClusterName = "other-master:3306"
+		otherEntry.ClusterDetails.ClusterAlias = "other"
+		topologyRecovery, err := AttemptRecoveryRegistration(&otherEntry, false, false)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectNotNil(topologyRecovery)
+	}
+}
+
+func TestAttemptRecoveryRegistrationFencesSupersededLeader(t *testing.T) {
+	withSQLiteBackend(t)
+	leaderLeaseElection := config.Config.LeaderLeaseElection
+	config.Config.LeaderLeaseElection = true
+	defer func() { config.Config.LeaderLeaseElection = leaderLeaseElection }()
+
+	elected, err := process.AttemptElection()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(elected)
+
+	analysisEntry := inst.ReplicationAnalysis{AnalyzedInstanceKey: inst.InstanceKey{Hostname: "leased-master", Port: 3306}, Analysis: inst.DeadMaster}
+	analysisEntry.ClusterDetails.ClusterName = "leased-master:3306"
+	analysisEntry.ClusterDetails.ClusterAlias = "leased"
+	{
+		topologyRecovery, err := AttemptRecoveryRegistration(&analysisEntry, true, true)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectNotNil(topologyRecovery)
+	}
+	// Another node takes over while this node still considers itself leader
+	_, err = db.ExecOrchestrator(`update leader_lease set hostname = 'other-node', fencing_token = fencing_token + 1 where anchor = 1`)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(process.IsLeaderLeaseValid())
+	{
+		otherEntry := analysisEntry
+		otherEntry.AnalyzedInstanceKey = inst.InstanceKey{Hostname: "leased-other", Port: 3306}
+		otherEntry.ClusterDetails.ClusterName = "leased-other:3306"
+		otherEntry.ClusterDetails.ClusterAlias = "leased-other"
+		topologyRecovery, err := AttemptRecoveryRegistration(&otherEntry, false, false)
+		test.S(t).ExpectNotNil(err)
+		test.S(t).ExpectTrue(topologyRecovery == nil)
+	}
+	recoveries, err := ReadRecentRecoveries("", false, 0)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(recoveries), 1)
+}
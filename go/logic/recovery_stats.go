@@ -0,0 +1,158 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/github/orchestrator/go/inst"
+)
+
+// recoveryStatsTrendWeeks is the number of weekly periods in a cluster's recovery trend
+const recoveryStatsTrendWeeks = 13
+
+// RecoveryTiming is the timeline of a single recovery. The onset of the failure is approximated by the last time the
+// failed instance was seen; a recovery is considered to have promoted once it is resolved. Latencies are in seconds,
+// and are -1 when unknown, e.g. for recoveries of failures detected before timings were recorded.
+type RecoveryTiming struct {
+	RecoveryUID             string
+	Key                     inst.InstanceKey
+	Analysis                inst.AnalysisCode
+	ClusterName             string
+	ClusterAlias            string
+	IsSuccessful            bool
+	FailureOnset            string
+	DetectedAt              string
+	RecoveryStartedAt       string
+	PromotedAt              string
+	DetectionLatencySeconds int64 // failure onset to detection
+	DecisionLatencySeconds  int64 // detection to start of recovery
+	PromotionLatencySeconds int64 // start of recovery to promotion
+	TotalRTOSeconds         int64 // failure onset to promotion
+
+	recoveryStartedUnixTime int64
+}
+
+// LatencySummary summarizes the known values of a latency across recoveries
+type LatencySummary struct {
+	Count       int
+	MeanSeconds float64
+	P50Seconds  int64
+	P95Seconds  int64
+	MaxSeconds  int64
+}
+
+// RecoveryPeriodStats summarizes the recoveries of a cluster started within a period
+type RecoveryPeriodStats struct {
+	PeriodStart               time.Time
+	PeriodEnd                 time.Time
+	CountRecoveries           int
+	CountSuccessfulRecoveries int
+	DetectionLatency          LatencySummary
+	DecisionLatency           LatencySummary
+	PromotionLatency          LatencySummary
+	TotalRTO                  LatencySummary
+}
+
+// ClusterRecoveryStats are a cluster's recovery statistics over the last 30 and 90 days, along with a weekly trend
+type ClusterRecoveryStats struct {
+	ClusterName string
+	Last30Days  RecoveryPeriodStats
+	Last90Days  RecoveryPeriodStats
+	WeeklyTrend []RecoveryPeriodStats
+	Recoveries  []RecoveryTiming
+}
+
+// summarizeLatencies computes the summary of given latencies, ignoring unknown (negative) values. Percentiles
+// use the nearest-rank method.
+func summarizeLatencies(latencies []int64) (summary LatencySummary) {
+	known := []int64{}
+	var sum int64
+	for _, latency := range latencies {
+		if latency < 0 {
+			continue
+		}
+		known = append(known, latency)
+		sum += latency
+	}
+	if len(known) == 0 {
+		return summary
+	}
+	sort.Slice(known, func(i, j int) bool { return known[i] < known[j] })
+	percentile := func(p float64) int64 {
+		return known[int(math.Ceil(p*float64(len(known))))-1]
+	}
+	return LatencySummary{
+		Count:       len(known),
+		MeanSeconds: float64(sum) / float64(len(known)),
+		P50Seconds:  percentile(0.5),
+		P95Seconds:  percentile(0.95),
+		MaxSeconds:  known[len(known)-1],
+	}
+}
+
+// computeRecoveryPeriodStats summarizes the recoveries started within given period
+func computeRecoveryPeriodStats(timings []RecoveryTiming, periodStart time.Time, periodEnd time.Time) RecoveryPeriodStats {
+	stats := RecoveryPeriodStats{PeriodStart: periodStart, PeriodEnd: periodEnd}
+	var detectionLatencies, decisionLatencies, promotionLatencies, totalRTOs []int64
+	for _, timing := range timings {
+		if timing.recoveryStartedUnixTime < periodStart.Unix() || timing.recoveryStartedUnixTime >= periodEnd.Unix() {
+			continue
+		}
+		stats.CountRecoveries++
+		detectionLatencies = append(detectionLatencies, timing.DetectionLatencySeconds)
+		decisionLatencies = append(decisionLatencies, timing.DecisionLatencySeconds)
+		if !timing.IsSuccessful {
+			// A failed recovery promoted nothing
+			continue
+		}
+		stats.CountSuccessfulRecoveries++
+		promotionLatencies = append(promotionLatencies, timing.PromotionLatencySeconds)
+		totalRTOs = append(totalRTOs, timing.TotalRTOSeconds)
+	}
+	stats.DetectionLatency = summarizeLatencies(detectionLatencies)
+	stats.DecisionLatency = summarizeLatencies(decisionLatencies)
+	stats.PromotionLatency = summarizeLatencies(promotionLatencies)
+	stats.TotalRTO = summarizeLatencies(totalRTOs)
+	return stats
+}
+
+// ReadClusterRecoveryStats computes a cluster's recovery statistics, including recoveries of the cluster under
+// previous names. Statistics only cover recoveries within RecoveryStatsRetentionDays.
+func ReadClusterRecoveryStats(clusterName string) (*ClusterRecoveryStats, error) {
+	timings, err := readRecoveryTimings(clusterName, getClusterAlias(clusterName), recoveryStatsTrendWeeks*7)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	daysAgo := func(days int) time.Time {
+		return now.Add(-time.Duration(days) * 24 * time.Hour)
+	}
+	stats := &ClusterRecoveryStats{
+		ClusterName: clusterName,
+		Last30Days:  computeRecoveryPeriodStats(timings, daysAgo(30), now),
+		Last90Days:  computeRecoveryPeriodStats(timings, daysAgo(90), now),
+		WeeklyTrend: []RecoveryPeriodStats{},
+		Recoveries:  timings,
+	}
+	for week := recoveryStatsTrendWeeks; week > 0; week-- {
+		stats.WeeklyTrend = append(stats.WeeklyTrend, computeRecoveryPeriodStats(timings, daysAgo(week*7), daysAgo((week-1)*7)))
+	}
+	return stats, nil
+}
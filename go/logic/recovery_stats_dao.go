@@ -0,0 +1,135 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+// writeRecoveryTiming records the timeline of a resolved recovery: the onset of the failure, as approximated by the last
+// time the failed instance was seen, its detection, the start of the recovery and its resolution.
+func writeRecoveryTiming(recoveryUID string) error {
+	_, err := db.ExecOrchestrator(`
+			replace
+				into topology_recovery_timing (
+					recovery_uid,
+					hostname,
+					port,
+					analysis,
+					cluster_name,
+					cluster_alias,
+					is_successful,
+					failure_onset,
+					detected_at,
+					recovery_started_at,
+					promoted_at
+				)
+			select
+				topology_recovery.uid,
+				topology_recovery.hostname,
+				topology_recovery.port,
+				topology_recovery.analysis,
+				topology_recovery.cluster_name,
+				topology_recovery.cluster_alias,
+				topology_recovery.is_successful,
+				topology_failure_detection.analyzed_instance_last_seen,
+				topology_failure_detection.start_active_period,
+				topology_recovery.start_active_period,
+				topology_recovery.end_recovery
+			from
+				topology_recovery
+				left join topology_failure_detection on (topology_recovery.last_detection_id = topology_failure_detection.detection_id)
+			where
+				topology_recovery.uid = ?
+			`, recoveryUID,
+	)
+	return log.Errore(err)
+}
+
+// readRecoveryTimings reads the timings of a cluster's recoveries started within given number of days, oldest first.
+// Recoveries are matched by cluster alias as well as by cluster name, since each master recovery changes the
+// cluster's name. Latencies which cannot be computed are -1.
+func readRecoveryTimings(clusterName string, clusterAlias string, days uint) (timings []RecoveryTiming, err error) {
+	timings = []RecoveryTiming{}
+	query := `
+		select
+			recovery_uid,
+			hostname,
+			port,
+			analysis,
+			cluster_name,
+			cluster_alias,
+			is_successful,
+			ifnull(failure_onset, '') as failure_onset,
+			ifnull(detected_at, '') as detected_at,
+			recovery_started_at,
+			ifnull(promoted_at, '') as promoted_at,
+			unix_timestamp(recovery_started_at) as recovery_started_unixtime,
+			ifnull(unix_timestamp(detected_at) - unix_timestamp(failure_onset), -1) as detection_latency_seconds,
+			ifnull(unix_timestamp(recovery_started_at) - unix_timestamp(detected_at), -1) as decision_latency_seconds,
+			ifnull(unix_timestamp(promoted_at) - unix_timestamp(recovery_started_at), -1) as promotion_latency_seconds,
+			ifnull(unix_timestamp(promoted_at) - unix_timestamp(failure_onset), -1) as total_rto_seconds
+		from
+			topology_recovery_timing
+		where
+			(cluster_name = ? or (? != '' and cluster_alias = ?))
+			and recovery_started_at >= now() - interval ? day
+		order by
+			recovery_started_at asc
+		`
+	err = db.QueryOrchestrator(query, sqlutils.Args(clusterName, clusterAlias, clusterAlias, days), func(m sqlutils.RowMap) error {
+		timing := RecoveryTiming{
+			RecoveryUID:             m.GetString("recovery_uid"),
+			Key:                     inst.InstanceKey{Hostname: m.GetString("hostname"), Port: m.GetInt("port")},
+			Analysis:                inst.AnalysisCode(m.GetString("analysis")),
+			ClusterName:             m.GetString("cluster_name"),
+			ClusterAlias:            m.GetString("cluster_alias"),
+			IsSuccessful:            m.GetBool("is_successful"),
+			FailureOnset:            m.GetString("failure_onset"),
+			DetectedAt:              m.GetString("detected_at"),
+			RecoveryStartedAt:       m.GetString("recovery_started_at"),
+			PromotedAt:              m.GetString("promoted_at"),
+			DetectionLatencySeconds: m.GetInt64("detection_latency_seconds"),
+			DecisionLatencySeconds:  m.GetInt64("decision_latency_seconds"),
+			PromotionLatencySeconds: m.GetInt64("promotion_latency_seconds"),
+			TotalRTOSeconds:         m.GetInt64("total_rto_seconds"),
+		}
+		timing.recoveryStartedUnixTime = m.GetInt64("recovery_started_unixtime")
+		timings = append(timings, timing)
+		return nil
+	})
+	return timings, log.Errore(err)
+}
+
+// ExpireRecoveryTimings removes recovery timings older than RecoveryStatsRetentionDays
+func ExpireRecoveryTimings() error {
+	writeFunc := func() error {
+		_, err := db.ExecOrchestrator(`
+				delete
+					from topology_recovery_timing
+				where
+					recovery_started_at < now() - interval ? day
+				`, config.Config.RecoveryStatsRetentionDays,
+		)
+		return log.Errore(err)
+	}
+	return inst.ExecDBWriteFunc(writeFunc)
+}
@@ -0,0 +1,64 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"testing"
+
+	"github.com/github/orchestrator/go/db"
+	test "github.com/openark/golib/tests"
+)
+
+// writeTestRecoveryTiming writes the timing of a successful recovery, started now
+func writeTestRecoveryTiming(t *testing.T, recoveryUID string, clusterName string, clusterAlias string) {
+	_, err := db.ExecOrchestrator(`
+			insert into topology_recovery_timing (
+				recovery_uid, hostname, port, analysis, cluster_name, cluster_alias, is_successful,
+				failure_onset, detected_at, recovery_started_at, promoted_at
+			) values (
+				?, 'timing-host', 3306, 'DeadMaster', ?, ?, 1,
+				now() - interval 30 second, now() - interval 20 second, now() - interval 15 second, now()
+			)
+		`, recoveryUID, clusterName, clusterAlias,
+	)
+	test.S(t).ExpectNil(err)
+}
+
+func TestReadRecoveryTimings(t *testing.T) {
+	withSQLiteBackend(t)
+	// Each master recovery renames the cluster, which retains its alias
+	writeTestRecoveryTiming(t, "timing-1", "timing-master-1:3306", "timing-alias")
+	writeTestRecoveryTiming(t, "timing-2", "timing-master-2:3306", "timing-alias")
+	writeTestRecoveryTiming(t, "timing-3", "timing-master-3:3306", "other-alias")
+	writeTestRecoveryTiming(t, "timing-4", "timing-unaliased:3306", "")
+
+	timings, err := readRecoveryTimings("timing-master-3:3306", "timing-alias", 7)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(timings), 3)
+
+	timings, err = readRecoveryTimings("timing-master-2:3306", "", 7)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(timings), 1)
+	test.S(t).ExpectEquals(timings[0].RecoveryUID, "timing-2")
+	test.S(t).ExpectEquals(timings[0].DetectionLatencySeconds, int64(10))
+	test.S(t).ExpectEquals(timings[0].TotalRTOSeconds, int64(30))
+
+	// An unaliased cluster does not match all unaliased recoveries
+	timings, err = readRecoveryTimings("timing-master-4:3306", "", 7)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(timings), 0)
+}
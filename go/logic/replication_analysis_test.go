@@ -0,0 +1,119 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+// readTestAnalysis returns the analysis of given instance
+func readTestAnalysis(t *testing.T, clusterName string, instanceKey inst.InstanceKey) string {
+	analysisEntries, err := inst.GetReplicationAnalysis(clusterName, &inst.ReplicationAnalysisHints{IncludeNoProblem: true})
+	test.S(t).ExpectNil(err)
+	for _, analysisEntry := range analysisEntries {
+		if analysisEntry.AnalyzedInstanceKey.Equals(&instanceKey) {
+			return string(analysisEntry.Analysis)
+		}
+	}
+	return string(inst.NoProblem)
+}
+
+func TestDualWritableMastersAnalysis(t *testing.T) {
+	withSQLiteBackend(t)
+	masterKey := inst.InstanceKey{Hostname: "dual-master", Port: 3306}
+	replicaKey := inst.InstanceKey{Hostname: "dual-replica", Port: 3306}
+	writeTestInstance(t, masterKey, inst.InstanceKey{}, "dual-master:3306")
+	writeTestInstance(t, replicaKey, masterKey, "dual-master:3306")
+	test.S(t).ExpectEquals(readTestAnalysis(t, "dual-master:3306", replicaKey), inst.DualWritableMasters)
+
+	_, err := db.ExecOrchestrator(`update database_instance set read_only=1 where hostname=?`, replicaKey.Hostname)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(readTestAnalysis(t, "dual-master:3306", replicaKey), string(inst.NoProblem))
+}
+
+func TestDualWritableMastersAnalysisPrecedence(t *testing.T) {
+	withSQLiteBackend(t)
+	masterKey := inst.InstanceKey{Hostname: "im-master", Port: 3306}
+	intermediateMasterKey := inst.InstanceKey{Hostname: "im-intermediate", Port: 3306}
+	replicaKey := inst.InstanceKey{Hostname: "im-replica", Port: 3306}
+	writeTestInstance(t, masterKey, inst.InstanceKey{}, "im-master:3306")
+	writeTestInstance(t, intermediateMasterKey, masterKey, "im-master:3306")
+	writeTestInstance(t, replicaKey, intermediateMasterKey, "im-master:3306")
+
+	// A writable intermediate master whose replicas do not replicate is reported as such
+	_, err := db.ExecOrchestrator(`update database_instance set slave_sql_running=0, slave_io_running=0 where hostname=?`, replicaKey.Hostname)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(readTestAnalysis(t, "im-master:3306", intermediateMasterKey), inst.AllIntermediateMasterSlavesNotReplicating)
+}
+
+func TestDualWritableMastersAnalysisCoMasters(t *testing.T) {
+	withSQLiteBackend(t)
+	coMasterKey := inst.InstanceKey{Hostname: "co-master-a", Port: 3306}
+	otherCoMasterKey := inst.InstanceKey{Hostname: "co-master-b", Port: 3306}
+	writeTestInstance(t, coMasterKey, otherCoMasterKey, "co-master-a:3306")
+	writeTestInstance(t, otherCoMasterKey, coMasterKey, "co-master-a:3306")
+	_, err := db.ExecOrchestrator(`update database_instance set is_co_master=1`)
+	test.S(t).ExpectNil(err)
+
+	test.S(t).ExpectEquals(readTestAnalysis(t, "co-master-a:3306", coMasterKey), string(inst.NoProblem))
+	test.S(t).ExpectEquals(readTestAnalysis(t, "co-master-a:3306", otherCoMasterKey), string(inst.NoProblem))
+}
+
+func TestMasterNotWritableAnalysis(t *testing.T) {
+	withSQLiteBackend(t)
+	masterKey := inst.InstanceKey{Hostname: "probe-master", Port: 3306}
+	replicaKey := inst.InstanceKey{Hostname: "probe-replica", Port: 3306}
+	writeTestInstance(t, masterKey, inst.InstanceKey{}, "probe-master:3306")
+	writeTestInstance(t, replicaKey, masterKey, "probe-master:3306")
+	_, err := db.ExecOrchestrator(`update database_instance set read_only=1 where hostname=?`, replicaKey.Hostname)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(readTestAnalysis(t, "probe-master:3306", masterKey), string(inst.NoProblem))
+
+	_, err = db.ExecOrchestrator(`update database_instance set write_probe_failing=1 where hostname=?`, masterKey.Hostname)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(readTestAnalysis(t, "probe-master:3306", masterKey), inst.MasterNotWritable)
+}
+
+func TestMasterWritesNotReplicatingAnalysis(t *testing.T) {
+	withSQLiteBackend(t)
+	masterKey := inst.InstanceKey{Hostname: "probe-master", Port: 3306}
+	replicaKey := inst.InstanceKey{Hostname: "probe-replica", Port: 3306}
+	writeTestInstance(t, masterKey, inst.InstanceKey{}, "probe-master:3306")
+	writeTestInstance(t, replicaKey, masterKey, "probe-master:3306")
+	_, err := db.ExecOrchestrator(`update database_instance set read_only=1, slave_lag_seconds=0 where hostname=?`, replicaKey.Hostname)
+	test.S(t).ExpectNil(err)
+
+	probeValue := time.Now().UnixNano()
+	_, err = db.ExecOrchestrator(`update database_instance set write_probe_value=? where hostname=?`, probeValue, masterKey.Hostname)
+	test.S(t).ExpectNil(err)
+
+	// The replica's copy of the master's probe is stale, way beyond replication threshold
+	staleProbeValue := probeValue - int64(time.Hour)
+	_, err = db.ExecOrchestrator(`update database_instance set replicated_write_probe_value=? where hostname=?`, staleProbeValue, replicaKey.Hostname)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(readTestAnalysis(t, "probe-master:3306", masterKey), inst.MasterWritesNotReplicating)
+
+	// The probe has replicated
+	_, err = db.ExecOrchestrator(`update database_instance set replicated_write_probe_value=? where hostname=?`, probeValue, replicaKey.Hostname)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(readTestAnalysis(t, "probe-master:3306", masterKey), string(inst.NoProblem))
+}
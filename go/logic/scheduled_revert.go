@@ -0,0 +1,279 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/inst"
+	orcraft "github.com/github/orchestrator/go/raft"
+	"github.com/github/orchestrator/go/util"
+	"github.com/openark/golib/log"
+)
+
+// ScheduledRevertStatus is the state of a scheduled revert
+type ScheduledRevertStatus string
+
+const (
+	ScheduledRevertPending  ScheduledRevertStatus = "pending"
+	ScheduledRevertReverted ScheduledRevertStatus = "reverted"
+	ScheduledRevertCanceled ScheduledRevertStatus = "canceled"
+	ScheduledRevertFailed   ScheduledRevertStatus = "failed"
+)
+
+// maxScheduledRevertAttempts is the number of attempts at a revert, one per minute, after which it is given up
+const maxScheduledRevertAttempts = 10
+
+// revertActions maps an action which may be time-boxed onto the action reverting it. set-read-only may not be
+// time-boxed: a server is never made writeable other than by an explicit request.
+var revertActions = map[string]string{
+	"set-writeable": "set-read-only",
+	"stop-slave":    "start-slave",
+	"start-slave":   "stop-slave",
+	"stop-replica":  "start-replica",
+	"start-replica": "stop-replica",
+}
+
+var scheduledRevertsEntrance int64
+
+// ScheduledRevert is an action taken on an instance, along with the action reverting it once RevertAtString
+// is due. Scheduled reverts are persisted in the backend, and are executed by whichever node is the leader
+// by then. A revert which fails is retried until it succeeds, until it is canceled, or up to maxScheduledRevertAttempts.
+// The instance's role and master are recorded when scheduling: a revert is canceled rather than executed once
+// either has changed, or once a recovery ran on the cluster, as the revert may no longer be what the topology needs.
+type ScheduledRevert struct {
+	UID               string
+	Key               inst.InstanceKey
+	Action            string
+	RevertAction      string
+	Owner             string
+	Reason            string
+	Status            ScheduledRevertStatus
+	ScheduledAtString string
+	RevertAtString    string
+	CountAttempts     uint
+	LastError         string
+	CompletedAtString string
+	ClusterAlias      string
+	IsMaster          bool
+	MasterKey         inst.InstanceKey
+}
+
+// String returns a string representation of the scheduled revert
+func (this *ScheduledRevert) String() string {
+	return fmt.Sprintf("%s %s: %s, reverting with %s at %s (%s), scheduled by %s: %s", this.UID, this.Key.DisplayString(), this.Action, this.RevertAction, this.RevertAtString, this.Status, this.Owner, this.Reason)
+}
+
+// GetRevertAction returns the action reverting given action, or an error when given action cannot be time-boxed
+func GetRevertAction(action string) (string, error) {
+	revertAction, ok := revertActions[action]
+	if !ok {
+		return "", fmt.Errorf("Action %s cannot be reverted automatically. Supported actions: set-writeable, stop-slave, start-slave, stop-replica, start-replica", action)
+	}
+	return revertAction, nil
+}
+
+// persistScheduledRevert writes down given scheduled revert, either directly or via raft
+func persistScheduledRevert(revert *ScheduledRevert) error {
+	if orcraft.IsRaftEnabled() {
+		_, err := orcraft.PublishCommand("write-scheduled-revert", revert)
+		return log.Errore(err)
+	}
+	return writeScheduledRevert(revert)
+}
+
+// ExecuteWithRevert executes given action on given instance, and schedules the action reverting it in
+// revertAfterSeconds. The revert is persisted before the action executes, such that it is guaranteed to take
+// place even if this node fails or loses leadership right after the action. Should the action fail, the
+// revert is canceled.
+func ExecuteWithRevert(instanceKey *inst.InstanceKey, action string, revertAfterSeconds uint, owner string, reason string) (details interface{}, revert *ScheduledRevert, err error) {
+	revertAction, err := GetRevertAction(action)
+	if err != nil {
+		return nil, nil, err
+	}
+	if revertAfterSeconds == 0 {
+		return nil, nil, fmt.Errorf("ExecuteWithRevert: revert delay must be positive")
+	}
+	instance, found, err := inst.ReadInstance(instanceKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !found {
+		return nil, nil, fmt.Errorf("ExecuteWithRevert: instance not found: %+v", *instanceKey)
+	}
+	clusterAlias, err := inst.ReadAliasByClusterName(instance.ClusterName)
+	if err != nil {
+		return nil, nil, err
+	}
+	now, err := db.ReadTimeNow()
+	if err != nil {
+		return nil, nil, log.Errore(err)
+	}
+	revert = &ScheduledRevert{
+		UID:               util.PrettyUniqueToken(),
+		Key:               *instanceKey,
+		Action:            action,
+		RevertAction:      revertAction,
+		Owner:             owner,
+		Reason:            reason,
+		Status:            ScheduledRevertPending,
+		ScheduledAtString: now,
+		RevertAtString:    inst.AddSecondsToTimeString(now, revertAfterSeconds),
+		ClusterAlias:      clusterAlias,
+		IsMaster:          instance.IsMaster(),
+		MasterKey:         instance.MasterKey,
+	}
+	if err := persistScheduledRevert(revert); err != nil {
+		return nil, nil, err
+	}
+	details, err = batchOperationFunctions[action](&BatchOperation{Command: action, Key: *instanceKey, Owner: owner, Reason: reason})
+	if err != nil {
+		revert.Status = ScheduledRevertCanceled
+		revert.LastError = fmt.Sprintf("%s failed: %+v", action, err)
+		revert.CompletedAtString, _ = db.ReadTimeNow()
+		persistScheduledRevert(revert)
+		return details, revert, err
+	}
+	inst.AuditOperation("schedule-revert", instanceKey, fmt.Sprintf("%s: %s by %s, reverting with %s at %s: %s", revert.UID, action, owner, revertAction, revert.RevertAtString, reason))
+	return details, revert, nil
+}
+
+// CancelScheduledRevert cancels a pending scheduled revert, such that the action it reverts stays in effect
+func CancelScheduledRevert(uid string, owner string) (*ScheduledRevert, error) {
+	revert, err := readScheduledRevert(uid)
+	if err != nil {
+		return nil, err
+	}
+	if revert == nil {
+		return nil, fmt.Errorf("No scheduled revert found for %s", uid)
+	}
+	if revert.Status != ScheduledRevertPending {
+		return nil, fmt.Errorf("Scheduled revert %s is %s; only a pending revert may be canceled", uid, revert.Status)
+	}
+	if revert.CompletedAtString, err = db.ReadTimeNow(); err != nil {
+		return nil, log.Errore(err)
+	}
+	revert.Status = ScheduledRevertCanceled
+	if err := persistScheduledRevert(revert); err != nil {
+		return nil, err
+	}
+	inst.AuditOperation("cancel-scheduled-revert", &revert.Key, fmt.Sprintf("%s: %s will not be reverted; canceled by %s", revert.UID, revert.Action, owner))
+	return revert, nil
+}
+
+// scheduledRevertObsoleteReason returns the reason for which given revert no longer applies, given the current
+// state of its instance and the recoveries which ran on its cluster since it was scheduled; or an empty string
+// when the revert still applies.
+func scheduledRevertObsoleteReason(revert *ScheduledRevert, instance *inst.Instance, recoveries []TopologyRecovery) string {
+	if revertAction, ok := revertActions[revert.Action]; !ok || revertAction != revert.RevertAction {
+		// e.g. a set-writeable revert, scheduled by a former version
+		return fmt.Sprintf("%s is not reverted automatically with %s", revert.Action, revert.RevertAction)
+	}
+	if len(recoveries) > 0 {
+		return fmt.Sprintf("recovery %s ran on cluster %s since the revert was scheduled", recoveries[0].UID, revert.ClusterAlias)
+	}
+	if isMaster := instance.IsMaster(); isMaster != revert.IsMaster {
+		return fmt.Sprintf("role of %+v changed since the revert was scheduled; is master: %t", revert.Key, isMaster)
+	}
+	if !revert.IsMaster && !instance.MasterKey.Equals(&revert.MasterKey) {
+		return fmt.Sprintf("master of %+v changed from %+v to %+v since the revert was scheduled", revert.Key, revert.MasterKey, instance.MasterKey)
+	}
+	return ""
+}
+
+// checkScheduledRevertApplies returns the reason for which given revert no longer applies, if any; see scheduledRevertObsoleteReason
+func checkScheduledRevertApplies(revert *ScheduledRevert) (obsoleteReason string, err error) {
+	instance, found, err := inst.ReadInstance(&revert.Key)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", fmt.Errorf("instance not found: %+v", revert.Key)
+	}
+	recoveries, err := readClusterRecoveriesSince(revert.ClusterAlias, revert.ScheduledAtString)
+	if err != nil {
+		return "", err
+	}
+	return scheduledRevertObsoleteReason(revert, instance, recoveries), nil
+}
+
+// executeScheduledRevert executes the revert action of given scheduled revert, unless the revert no longer applies,
+// in which case it is canceled. A failed attempt is recorded, and the revert remains pending, up to maxScheduledRevertAttempts.
+func executeScheduledRevert(revert *ScheduledRevert) (err error) {
+	obsoleteReason, err := checkScheduledRevertApplies(revert)
+	if err == nil && obsoleteReason != "" {
+		revert.Status = ScheduledRevertCanceled
+		revert.LastError = obsoleteReason
+		revert.CompletedAtString, _ = db.ReadTimeNow()
+		if err := persistScheduledRevert(revert); err != nil {
+			return err
+		}
+		inst.AuditOperation("cancel-scheduled-revert", &revert.Key, fmt.Sprintf("%s: %s will not be reverted: %s", revert.UID, revert.Action, obsoleteReason))
+		return nil
+	}
+	revert.CountAttempts++
+	if err == nil {
+		_, err = batchOperationFunctions[revert.RevertAction](&BatchOperation{Command: revert.RevertAction, Key: revert.Key, Owner: revert.Owner, Reason: revert.Reason})
+	}
+	if err != nil {
+		revert.LastError = err.Error()
+		if revert.CountAttempts >= maxScheduledRevertAttempts {
+			revert.Status = ScheduledRevertFailed
+			revert.CompletedAtString, _ = db.ReadTimeNow()
+			inst.AuditOperation("scheduled-revert-failed", &revert.Key, fmt.Sprintf("%s: giving up reverting %s with %s after %d attempts: %s", revert.UID, revert.Action, revert.RevertAction, revert.CountAttempts, revert.LastError))
+		}
+	} else {
+		revert.Status = ScheduledRevertReverted
+		revert.LastError = ""
+		revert.CompletedAtString, _ = db.ReadTimeNow()
+	}
+	if persistErr := persistScheduledRevert(revert); persistErr != nil {
+		return persistErr
+	}
+	if err != nil {
+		return err
+	}
+	inst.AuditOperation("scheduled-revert", &revert.Key, fmt.Sprintf("%s: reverted %s with %s, scheduled by %s: %s", revert.UID, revert.Action, revert.RevertAction, revert.Owner, revert.Reason))
+	return nil
+}
+
+// RunDueScheduledReverts executes, on the leader, the scheduled reverts which are due. Reverts are persisted in the
+// backend, hence a revert scheduled by a former leader is executed by the current one. A revert which fails, e.g.
+// since its instance cannot be reached, is retried on the next run, up to maxScheduledRevertAttempts.
+func RunDueScheduledReverts() {
+	if !IsLeader() {
+		return
+	}
+	// This function is non re-entrant (it can only be running once at any point in time)
+	if !atomic.CompareAndSwapInt64(&scheduledRevertsEntrance, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt64(&scheduledRevertsEntrance, 0)
+
+	reverts, err := readDueScheduledReverts()
+	if err != nil {
+		return
+	}
+	for _, revert := range reverts {
+		revert := revert
+		if err := executeScheduledRevert(&revert); err != nil {
+			log.Errorf("RunDueScheduledReverts: cannot revert %s on %+v with %s (attempt %d): %+v", revert.Action, revert.Key, revert.RevertAction, revert.CountAttempts, err)
+		}
+	}
+}
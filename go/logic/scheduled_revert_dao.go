@@ -0,0 +1,148 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+// writeScheduledRevert writes a scheduled revert, along with its outcome, if any
+func writeScheduledRevert(revert *ScheduledRevert) error {
+	_, err := db.ExecOrchestrator(`
+			replace into scheduled_revert (
+					revert_uid, hostname, port, action, revert_action, owner, reason,
+					revert_status, scheduled_at, revert_at, count_attempts, last_error, completed_at,
+					cluster_alias, is_master, master_host, master_port
+				) values (
+					?, ?, ?, ?, ?, ?, ?,
+					?, ?, ?, ?, ?, ?,
+					?, ?, ?, ?
+				)
+			`, revert.UID, revert.Key.Hostname, revert.Key.Port, revert.Action, revert.RevertAction, revert.Owner, revert.Reason,
+		string(revert.Status), revert.ScheduledAtString, revert.RevertAtString, revert.CountAttempts, revert.LastError, revert.CompletedAtString,
+		revert.ClusterAlias, revert.IsMaster, revert.MasterKey.Hostname, revert.MasterKey.Port,
+	)
+	return log.Errore(err)
+}
+
+// readScheduledReverts reads scheduled reverts matching given condition, soonest revert first
+func readScheduledReverts(whereCondition string, args []interface{}) ([]ScheduledRevert, error) {
+	reverts := []ScheduledRevert{}
+	query := `
+		select
+			revert_uid,
+			hostname,
+			port,
+			action,
+			revert_action,
+			owner,
+			reason,
+			revert_status,
+			scheduled_at,
+			revert_at,
+			count_attempts,
+			last_error,
+			completed_at,
+			cluster_alias,
+			is_master,
+			master_host,
+			master_port
+		from
+			scheduled_revert
+		` + whereCondition + `
+		order by
+			revert_at asc
+		`
+	err := db.QueryOrchestrator(query, args, func(m sqlutils.RowMap) error {
+		revert := ScheduledRevert{
+			UID:               m.GetString("revert_uid"),
+			Action:            m.GetString("action"),
+			RevertAction:      m.GetString("revert_action"),
+			Owner:             m.GetString("owner"),
+			Reason:            m.GetString("reason"),
+			Status:            ScheduledRevertStatus(m.GetString("revert_status")),
+			ScheduledAtString: m.GetString("scheduled_at"),
+			RevertAtString:    m.GetString("revert_at"),
+			CountAttempts:     m.GetUint("count_attempts"),
+			LastError:         m.GetString("last_error"),
+			CompletedAtString: m.GetString("completed_at"),
+			ClusterAlias:      m.GetString("cluster_alias"),
+			IsMaster:          m.GetBool("is_master"),
+		}
+		revert.Key.Hostname = m.GetString("hostname")
+		revert.Key.Port = m.GetInt("port")
+		revert.MasterKey.Hostname = m.GetString("master_host")
+		revert.MasterKey.Port = m.GetInt("master_port")
+		reverts = append(reverts, revert)
+		return nil
+	})
+	return reverts, log.Errore(err)
+}
+
+// ReadScheduledReverts reads the pending scheduled reverts, as well as those completed within the past day
+func ReadScheduledReverts() ([]ScheduledRevert, error) {
+	whereCondition := `
+		where
+			revert_status = ?
+			or completed_at > now() - interval 1 day
+		`
+	return readScheduledReverts(whereCondition, sqlutils.Args(string(ScheduledRevertPending)))
+}
+
+// readScheduledRevert reads a single scheduled revert by its UID, or nil when no such revert exists
+func readScheduledRevert(uid string) (*ScheduledRevert, error) {
+	reverts, err := readScheduledReverts(`where revert_uid = ?`, sqlutils.Args(uid))
+	if err != nil || len(reverts) == 0 {
+		return nil, err
+	}
+	return &reverts[0], nil
+}
+
+// readDueScheduledReverts reads the pending scheduled reverts whose time has come
+func readDueScheduledReverts() ([]ScheduledRevert, error) {
+	whereCondition := `
+		where
+			revert_status = ?
+			and revert_at <= now()
+		`
+	return readScheduledReverts(whereCondition, sqlutils.Args(string(ScheduledRevertPending)))
+}
+
+// readClusterRecoveriesSince reads the recoveries of given cluster which started at or after given time
+func readClusterRecoveriesSince(clusterAlias string, since string) ([]TopologyRecovery, error) {
+	whereClause := `
+		where
+			cluster_alias = ?
+			and start_active_period >= ?`
+	return readRecoveries(whereClause, ``, sqlutils.Args(clusterAlias, since))
+}
+
+// ExpireScheduledRevertHistory removes old completed or canceled reverts. Pending reverts are never expired.
+func ExpireScheduledRevertHistory() error {
+	_, err := db.ExecOrchestrator(`
+			delete
+				from scheduled_revert
+			where
+				revert_status != ?
+				and completed_at < now() - interval ? day
+			`, string(ScheduledRevertPending), config.AuditPurgeDays,
+	)
+	return log.Errore(err)
+}
@@ -0,0 +1,162 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+var revertMasterKey = inst.InstanceKey{Hostname: "revert-master", Port: 3306}
+var revertReplicaKey = inst.InstanceKey{Hostname: "revert-replica", Port: 3306}
+
+func newRevertReplica(masterKey inst.InstanceKey) *inst.Instance {
+	instance := inst.NewInstance()
+	instance.Key = revertReplicaKey
+	instance.MasterKey = masterKey
+	instance.ClusterName = "revert-master:3306"
+	if masterKey.Hostname != "" {
+		instance.ReadBinlogCoordinates.LogFile = "mysql-bin.000001"
+	}
+	return instance
+}
+
+func newPendingRevert() *ScheduledRevert {
+	return &ScheduledRevert{
+		UID:               "revert-uid",
+		Key:               revertReplicaKey,
+		Action:            "stop-slave",
+		RevertAction:      "start-slave",
+		Status:            ScheduledRevertPending,
+		ScheduledAtString: "2999-01-01 00:00:00",
+		RevertAtString:    "2999-01-01 00:00:00",
+		ClusterAlias:      "revert-master:3306",
+		MasterKey:         revertMasterKey,
+	}
+}
+
+func TestGetRevertAction(t *testing.T) {
+	revertAction, err := GetRevertAction("set-writeable")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(revertAction, "set-read-only")
+
+	revertAction, err = GetRevertAction("stop-slave")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(revertAction, "start-slave")
+
+	// A server is never made writeable on its own
+	_, err = GetRevertAction("set-read-only")
+	test.S(t).ExpectNotNil(err)
+	for _, revertAction := range revertActions {
+		test.S(t).ExpectNotEquals(revertAction, "set-writeable")
+	}
+}
+
+func TestScheduledRevertObsoleteReason(t *testing.T) {
+	revert := newPendingRevert()
+	test.S(t).ExpectEquals(scheduledRevertObsoleteReason(revert, newRevertReplica(revertMasterKey), nil), "")
+
+	otherMasterKey := inst.InstanceKey{Hostname: "other-master", Port: 3306}
+	reason := scheduledRevertObsoleteReason(revert, newRevertReplica(otherMasterKey), nil)
+	test.S(t).ExpectTrue(strings.Contains(reason, "master of"))
+
+	reason = scheduledRevertObsoleteReason(revert, newRevertReplica(inst.InstanceKey{}), nil)
+	test.S(t).ExpectTrue(strings.Contains(reason, "role of"))
+
+	reason = scheduledRevertObsoleteReason(revert, newRevertReplica(revertMasterKey), []TopologyRecovery{{UID: "recovery-uid"}})
+	test.S(t).ExpectTrue(strings.Contains(reason, "recovery-uid"))
+
+	masterRevert := newPendingRevert()
+	masterRevert.IsMaster = true
+	masterRevert.MasterKey = inst.InstanceKey{}
+	test.S(t).ExpectEquals(scheduledRevertObsoleteReason(masterRevert, newRevertReplica(inst.InstanceKey{}), nil), "")
+	reason = scheduledRevertObsoleteReason(masterRevert, newRevertReplica(revertMasterKey), nil)
+	test.S(t).ExpectTrue(strings.Contains(reason, "role of"))
+}
+
+func TestExecuteScheduledRevertCanceledOnMasterChange(t *testing.T) {
+	withSQLiteBackend(t)
+	writeTestInstance(t, revertReplicaKey, inst.InstanceKey{Hostname: "other-master", Port: 3306}, "revert-master:3306")
+
+	revert := newPendingRevert()
+	test.S(t).ExpectNil(executeScheduledRevert(revert))
+	test.S(t).ExpectEquals(revert.Status, ScheduledRevertCanceled)
+	test.S(t).ExpectEquals(revert.CountAttempts, uint(0))
+	test.S(t).ExpectTrue(strings.Contains(revert.LastError, "master of"))
+
+	persisted, err := readScheduledRevert(revert.UID)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(persisted.Status, ScheduledRevertCanceled)
+	test.S(t).ExpectEquals(persisted.MasterKey, revertMasterKey)
+	test.S(t).ExpectEquals(persisted.ClusterAlias, "revert-master:3306")
+}
+
+func TestExecuteScheduledRevertCanceledOnRecovery(t *testing.T) {
+	withSQLiteBackend(t)
+	writeTestInstance(t, revertReplicaKey, revertMasterKey, "revert-master:3306")
+
+	analysisEntry := inst.ReplicationAnalysis{AnalyzedInstanceKey: revertMasterKey, Analysis: inst.DeadMaster}
+	analysisEntry.ClusterDetails.ClusterName = "revert-master:3306"
+	analysisEntry.ClusterDetails.ClusterAlias = "revert-master:3306"
+	_, err := writeTopologyRecovery(NewTopologyRecovery(analysisEntry))
+	test.S(t).ExpectNil(err)
+
+	revert := newPendingRevert()
+	revert.ScheduledAtString = "2020-01-01 00:00:00"
+	test.S(t).ExpectNil(executeScheduledRevert(revert))
+	test.S(t).ExpectEquals(revert.Status, ScheduledRevertCanceled)
+	test.S(t).ExpectTrue(strings.Contains(revert.LastError, "recovery"))
+}
+
+func TestExecuteScheduledRevertGivesUp(t *testing.T) {
+	withSQLiteBackend(t)
+
+	// The instance is unknown, hence every attempt fails
+	revert := newPendingRevert()
+	for i := 1; i < maxScheduledRevertAttempts; i++ {
+		test.S(t).ExpectNotNil(executeScheduledRevert(revert))
+		test.S(t).ExpectEquals(revert.Status, ScheduledRevertPending)
+	}
+	test.S(t).ExpectNotNil(executeScheduledRevert(revert))
+	test.S(t).ExpectEquals(revert.Status, ScheduledRevertFailed)
+	test.S(t).ExpectEquals(revert.CountAttempts, uint(maxScheduledRevertAttempts))
+
+	persisted, err := readScheduledRevert(revert.UID)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(persisted.Status, ScheduledRevertFailed)
+}
+
+func TestExecuteScheduledRevertCanceledOnSetWriteable(t *testing.T) {
+	withSQLiteBackend(t)
+	writeTestInstance(t, revertReplicaKey, revertMasterKey, "revert-master:3306")
+
+	// A revert scheduled by a former version, which would make the server writeable
+	revert := newPendingRevert()
+	revert.Action = "set-read-only"
+	revert.RevertAction = "set-writeable"
+	test.S(t).ExpectNil(executeScheduledRevert(revert))
+	test.S(t).ExpectEquals(revert.Status, ScheduledRevertCanceled)
+	test.S(t).ExpectEquals(revert.CountAttempts, uint(0))
+	test.S(t).ExpectTrue(strings.Contains(revert.LastError, "not reverted automatically"))
+
+	persisted, err := readScheduledRevert(revert.UID)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(persisted.Status, ScheduledRevertCanceled)
+}
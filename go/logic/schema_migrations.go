@@ -0,0 +1,81 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"github.com/github/orchestrator/go/inst"
+	orcraft "github.com/github/orchestrator/go/raft"
+	"github.com/github/orchestrator/go/util"
+	"github.com/openark/golib/log"
+)
+
+// RegisterSchemaMigration registers, or extends the registration of, an in-progress schema migration
+func RegisterSchemaMigration(migration *inst.ClusterSchemaMigration) error {
+	if orcraft.IsRaftEnabled() {
+		_, err := orcraft.PublishCommand("register-schema-migration", migration)
+		return err
+	}
+	return inst.WriteClusterSchemaMigration(migration)
+}
+
+// UnregisterSchemaMigration unregisters a schema migration of a cluster, given its alias, once complete
+func UnregisterSchemaMigration(clusterAlias string, migrationId string) error {
+	if orcraft.IsRaftEnabled() {
+		_, err := orcraft.PublishCommand("unregister-schema-migration", inst.ClusterSchemaMigration{ClusterAlias: clusterAlias, MigrationId: migrationId})
+		return err
+	}
+	return inst.DeleteClusterSchemaMigration(clusterAlias, migrationId)
+}
+
+// recoverySuppressedAction maps an analysis onto the action which recovers from it, as schema migrations may suppress it
+func recoverySuppressedAction(analysisCode inst.AnalysisCode) (action inst.SchemaMigrationSuppressedAction, ok bool) {
+	switch analysisCode {
+	case inst.DeadMaster, inst.DeadMasterAndSomeSlaves:
+		return inst.SuppressMasterRecovery, true
+	case inst.DeadIntermediateMaster, inst.DeadIntermediateMasterAndSomeSlaves, inst.DeadIntermediateMasterWithSingleSlaveFailingToConnect, inst.AllIntermediateMasterSlavesFailingToConnectOrDead:
+		return inst.SuppressIntermediateMasterRecovery, true
+	case inst.DeadCoMaster, inst.DeadCoMasterAndSomeSlaves:
+		return inst.SuppressCoMasterRecovery, true
+	}
+	return action, false
+}
+
+// isSuppressedBySchemaMigration checks whether an in-progress schema migration on a cluster, given its alias, suppresses
+// given action
+func isSuppressedBySchemaMigration(clusterAlias string, action inst.SchemaMigrationSuppressedAction) bool {
+	migration, err := inst.ReadSuppressingSchemaMigration(clusterAlias, action)
+	if err != nil {
+		// Unexpected; we prefer not to block the action on a backend error
+		return false
+	}
+	if migration == nil {
+		return false
+	}
+	if util.ClearToLog("isSuppressedBySchemaMigration", clusterAlias+"/"+string(action)) {
+		log.Infof("%s on cluster %s suppressed by %s", action, clusterAlias, migration.String())
+	}
+	return true
+}
+
+// isRecoverySuppressedBySchemaMigration checks whether an in-progress schema migration suppresses the recovery of an analysis
+func isRecoverySuppressedBySchemaMigration(analysisEntry *inst.ReplicationAnalysis) bool {
+	action, ok := recoverySuppressedAction(analysisEntry.Analysis)
+	if !ok {
+		return false
+	}
+	return isSuppressedBySchemaMigration(analysisEntry.ClusterDetails.ClusterAlias, action)
+}
@@ -0,0 +1,399 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+// SelfCluster describes orchestrator's own backend cluster, monitored when BackendSelfMonitoring is set
+type SelfCluster struct {
+	ClusterName   string // empty until the backend is discovered
+	BackendStatus db.BackendStatus
+	AutoRecovery  bool
+}
+
+// BackendRecovery is the outcome of recovering a failed backend master: the backend replica promoted in its place,
+// and the other backend replicas, relocated below the promoted replica or lost
+type BackendRecovery struct {
+	FailedBackend     db.BackendAddress
+	PromotedBackend   db.BackendAddress
+	RelocatedReplicas []inst.InstanceKey
+	LostReplicas      []inst.InstanceKey
+}
+
+// backendReplica is a configured backend server replicating from the failed backend master. Backend replicas are
+// probed directly, as the backend is not available to read them from.
+type backendReplica struct {
+	Address                db.BackendAddress
+	Key                    inst.InstanceKey
+	MasterKey              inst.InstanceKey
+	ReadCoordinates        inst.BinlogCoordinates
+	ExecCoordinates        inst.BinlogCoordinates
+	IOThreadRunning        bool
+	SQLThreadRunning       bool
+	LastSQLError           string
+	LogBinEnabled          bool
+	LogSlaveUpdatesEnabled bool
+}
+
+// backendExecFunc executes a statement on a backend server
+type backendExecFunc func(instanceKey *inst.InstanceKey, query string, args ...interface{}) error
+
+// backendProbeFunc reads the replication status of a backend server
+type backendProbeFunc func(address db.BackendAddress) (*backendReplica, error)
+
+// execBackend executes a statement on a backend server, directly, as the backend is not available
+func execBackend(instanceKey *inst.InstanceKey, query string, args ...interface{}) error {
+	_, err := inst.ExecInstance(instanceKey, query, args...)
+	return err
+}
+
+func backendAddressKey(address db.BackendAddress) inst.InstanceKey {
+	return inst.InstanceKey{Hostname: address.Hostname, Port: address.Port}
+}
+
+// resolveBackendKey resolves the key of a backend server as discovered, so that it may be read from the backend
+func resolveBackendKey(key inst.InstanceKey) inst.InstanceKey {
+	if resolvedKey, err := inst.NewInstanceKeyFromStrings(key.Hostname, strconv.Itoa(key.Port)); err == nil {
+		return *resolvedKey
+	}
+	return key
+}
+
+// SelfClusterName returns the name of the cluster of the current MySQL backend, or empty when the backend is
+// not monitored, or not yet discovered
+func SelfClusterName() string {
+	if !config.Config.BackendSelfMonitoring {
+		return ""
+	}
+	backendKey := resolveBackendKey(backendAddressKey(db.CurrentBackendAddress()))
+	instance, found, err := inst.ReadInstance(&backendKey)
+	if err != nil || !found {
+		return ""
+	}
+	return instance.ClusterName
+}
+
+// ReadSelfCluster returns the self cluster along with the state of the backend
+func ReadSelfCluster() (*SelfCluster, error) {
+	if !config.Config.BackendSelfMonitoring {
+		return nil, fmt.Errorf("Backend self monitoring is disabled. See BackendSelfMonitoring")
+	}
+	return &SelfCluster{
+		ClusterName:   SelfClusterName(),
+		BackendStatus: db.ReadBackendStatus(),
+		AutoRecovery:  config.Config.BackendSelfAutoRecovery,
+	}, nil
+}
+
+// DiscoverSelfCluster submits the current MySQL backend for discovery, unless already known. The rest of the self
+// cluster is then discovered as any topology.
+func DiscoverSelfCluster() {
+	if !config.Config.BackendSelfMonitoring || db.IsSQLite() {
+		return
+	}
+	backendKey := resolveBackendKey(backendAddressKey(db.CurrentBackendAddress()))
+	if _, found, err := inst.ReadInstance(&backendKey); err != nil || found {
+		return
+	}
+	log.Infof("DiscoverSelfCluster: discovering backend %+v", backendKey)
+	discoveryQueue.Push(backendKey)
+}
+
+// isSelfRecoverySuppressed checks whether given analysis is on the self cluster, which, unless BackendSelfAutoRecovery
+// is set, is not recovered automatically
+func isSelfRecoverySuppressed(analysisEntry *inst.ReplicationAnalysis) bool {
+	if !config.Config.BackendSelfMonitoring || config.Config.BackendSelfAutoRecovery {
+		return false
+	}
+	selfClusterName := SelfClusterName()
+	return selfClusterName != "" && analysisEntry.ClusterDetails.ClusterName == selfClusterName
+}
+
+// probeBackendReplica reads the replication status of a backend server directly off the server
+func probeBackendReplica(address db.BackendAddress) (replica *backendReplica, err error) {
+	sqlDB, err := db.OpenTopology(address.Hostname, address.Port)
+	if err != nil {
+		return nil, err
+	}
+	err = sqlutils.QueryRowsMap(sqlDB, "show slave status", func(m sqlutils.RowMap) error {
+		replica = &backendReplica{
+			Address:          address,
+			Key:              backendAddressKey(address),
+			MasterKey:        inst.InstanceKey{Hostname: m.GetString("Master_Host"), Port: m.GetInt("Master_Port")},
+			ReadCoordinates:  inst.BinlogCoordinates{LogFile: m.GetString("Master_Log_File"), LogPos: m.GetInt64("Read_Master_Log_Pos")},
+			ExecCoordinates:  inst.BinlogCoordinates{LogFile: m.GetString("Relay_Master_Log_File"), LogPos: m.GetInt64("Exec_Master_Log_Pos")},
+			IOThreadRunning:  m.GetString("Slave_IO_Running") == "Yes",
+			SQLThreadRunning: m.GetString("Slave_SQL_Running") == "Yes",
+			LastSQLError:     m.GetString("Last_SQL_Error"),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if replica == nil {
+		return nil, fmt.Errorf("backend %s is not a replica", address)
+	}
+	err = sqlutils.QueryRowsMap(sqlDB, "select @@global.log_bin as log_bin, @@global.log_slave_updates as log_slave_updates", func(m sqlutils.RowMap) error {
+		replica.LogBinEnabled = m.GetBool("log_bin")
+		replica.LogSlaveUpdatesEnabled = m.GetBool("log_slave_updates")
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return replica, nil
+}
+
+// readBackendReadOnly reads the read_only setting of a backend server directly off the server
+func readBackendReadOnly(instanceKey *inst.InstanceKey) (readOnly bool, err error) {
+	sqlDB, err := db.OpenTopology(instanceKey.Hostname, instanceKey.Port)
+	if err != nil {
+		return false, err
+	}
+	err = sqlutils.QueryRowsMap(sqlDB, "select @@global.read_only as read_only", func(m sqlutils.RowMap) error {
+		readOnly = m.GetBool("read_only")
+		return nil
+	})
+	return readOnly, err
+}
+
+// checkBackendMasterFenced verifies the failed backend master cannot take writes alongside a promoted backend:
+// either it was reached and confirmed read-only, or it is unreachable from a quorum of observers, being this node and
+// the backend replicas, whose IO threads report it unreachable. A master unreachable from this node alone may well
+// be partitioned away rather than dead, and other orchestrator nodes would keep writing to it.
+func checkBackendMasterFenced(failedAddress db.BackendAddress, isReachable bool, isReadOnly bool, replicas [](*backendReplica)) error {
+	if isReachable {
+		if isReadOnly {
+			return nil
+		}
+		return fmt.Errorf("failed backend master %s is reachable and could not be confirmed read-only", failedAddress)
+	}
+	observers := 1 + len(replicas)
+	unreachableFrom := 1
+	for _, replica := range replicas {
+		if !replica.IOThreadRunning {
+			unreachableFrom++
+		}
+	}
+	if unreachableFrom*2 > observers {
+		return nil
+	}
+	return fmt.Errorf("failed backend master %s is unreachable from only %d of %d observers (this node and its backend replicas). It may be partitioned rather than dead", failedAddress, unreachableFrom, observers)
+}
+
+// checkBackendPromotable verifies a backend replica may serve as master to the other backend replicas
+func checkBackendPromotable(replica *backendReplica) error {
+	if !replica.LogBinEnabled {
+		return fmt.Errorf("backend %s has log_bin disabled", replica.Address)
+	}
+	if !replica.LogSlaveUpdatesEnabled {
+		return fmt.Errorf("backend %s has log_slave_updates disabled", replica.Address)
+	}
+	return nil
+}
+
+// chooseBackendPromotionCandidate returns the given candidate, which must be one of the backend replicas, or else
+// the backend replica which read furthest into the failed master's binary logs. Only replicas with log_bin and
+// log_slave_updates may be promoted.
+func chooseBackendPromotionCandidate(replicas [](*backendReplica), candidateKey *inst.InstanceKey) (*backendReplica, error) {
+	if candidateKey != nil {
+		for _, replica := range replicas {
+			resolvedKey := resolveBackendKey(replica.Key)
+			if resolvedKey.Equals(candidateKey) || replica.Key.Equals(candidateKey) {
+				if err := checkBackendPromotable(replica); err != nil {
+					return nil, fmt.Errorf("Cannot promote %+v: %+v", *candidateKey, err)
+				}
+				return replica, nil
+			}
+		}
+		return nil, fmt.Errorf("%+v is not a configured backend replicating from the failed backend master", *candidateKey)
+	}
+	var candidate *backendReplica
+	for _, replica := range replicas {
+		if err := checkBackendPromotable(replica); err != nil {
+			log.Warningf("RecoverBackend: not promoting %s: %+v", replica.Address, err)
+			continue
+		}
+		if candidate == nil || candidate.ReadCoordinates.SmallerThan(&replica.ReadCoordinates) {
+			candidate = replica
+		}
+	}
+	if candidate == nil {
+		return nil, fmt.Errorf("No configured backend with log_bin and log_slave_updates replicates from the failed backend master. See MySQLOrchestratorHosts")
+	}
+	return candidate, nil
+}
+
+// waitForBackendRelayLogs waits for the SQL thread of a backend replica, its IO thread stopped, to apply its relay logs
+func waitForBackendRelayLogs(replica *backendReplica, probe backendProbeFunc) (*backendReplica, error) {
+	timeout := time.After(time.Duration(config.Config.BackendRecoveryRelayLogTimeoutSeconds) * time.Second)
+	for {
+		probed, err := probe(replica.Address)
+		if err != nil {
+			return nil, err
+		}
+		if probed.ExecCoordinates.Equals(&probed.ReadCoordinates) {
+			return probed, nil
+		}
+		if !probed.SQLThreadRunning {
+			return probed, fmt.Errorf("SQL thread of backend %s is not running: %s", probed.Address, probed.LastSQLError)
+		}
+		select {
+		case <-timeout:
+			return probed, fmt.Errorf("Timeout waiting for backend %s to apply relay logs: executed %+v; read %+v", probed.Address, probed.ExecCoordinates, probed.ReadCoordinates)
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// promoteBackendReplica stops the IO thread of the backend replica to promote, waits for it to apply its relay logs,
+// detaches it and sets it writable. Until detached, a failure restarts the replica's replication, so that it is not
+// left behind with its IO thread stopped.
+func promoteBackendReplica(promoted *backendReplica, exec backendExecFunc, probe backendProbeFunc) (*backendReplica, error) {
+	restartReplication := func(cause error) (*backendReplica, error) {
+		if err := exec(&promoted.Key, "start slave"); err != nil {
+			log.Errorf("RecoverBackend: cannot restart replication on backend %s: %+v", promoted.Address, err)
+		}
+		return promoted, cause
+	}
+	if err := exec(&promoted.Key, "stop slave io_thread"); err != nil {
+		return promoted, err
+	}
+	applied, err := waitForBackendRelayLogs(promoted, probe)
+	if err != nil {
+		return restartReplication(err)
+	}
+	promoted = applied
+	for _, query := range []string{`stop slave`, `reset slave /*!50603 all */`} {
+		if err := exec(&promoted.Key, query); err != nil {
+			return restartReplication(err)
+		}
+	}
+	if err := exec(&promoted.Key, "set global read_only = ?", false); err != nil {
+		return promoted, err
+	}
+	return promoted, nil
+}
+
+// RecoverBackend recovers a failed backend master of the self cluster. As the backend is unavailable, this cannot
+// take the route of a topology recovery, and is carefully sequenced instead:
+//   - the failed backend master is set read-only, in case it is reachable. Unless forced, the recovery aborts
+//     unless the failed master is confirmed read-only, or is unreachable from a quorum of observers
+//   - configured backend servers replicating from the failed master are probed directly; given candidate, or else
+//     the replica having read furthest into the failed master's binary logs, is promoted: it applies its relay logs,
+//     is detached, and is set writable
+//   - orchestrator switches over to the promoted backend, and so leaves degraded mode
+//   - with the backend available, the other backend replicas are relocated below the promoted one, and the
+//     recovery is audited
+//
+// Other orchestrator nodes follow over to the promoted backend by their backend health checks, provided it is
+// listed in MySQLOrchestratorHosts.
+func RecoverBackend(candidateKey *inst.InstanceKey, force bool) (*BackendRecovery, error) {
+	if !config.Config.IsMySQL() {
+		return nil, fmt.Errorf("RecoverBackend only applies to a MySQL backend")
+	}
+	db.CheckBackendHealth()
+	status := db.ReadBackendStatus()
+	if status.Available {
+		return nil, fmt.Errorf("RecoverBackend: backend %s is writable; there is no failed backend master to recover", status.Address)
+	}
+	backendRecovery := &BackendRecovery{
+		FailedBackend:     status.Address,
+		RelocatedReplicas: []inst.InstanceKey{},
+		LostReplicas:      []inst.InstanceKey{},
+	}
+	failedKey := backendAddressKey(status.Address)
+	resolvedFailedKey := resolveBackendKey(failedKey)
+
+	replicas := [](*backendReplica){}
+	for _, address := range status.Addresses {
+		if address == status.Address {
+			continue
+		}
+		replica, err := probeBackendReplica(address)
+		if err != nil {
+			log.Warningf("RecoverBackend: skipping backend %s: %+v", address, err)
+			continue
+		}
+		if masterKey := resolveBackendKey(replica.MasterKey); !masterKey.Equals(&resolvedFailedKey) {
+			log.Warningf("RecoverBackend: skipping backend %s, which replicates from %+v", address, replica.MasterKey)
+			continue
+		}
+		replicas = append(replicas, replica)
+	}
+	promoted, err := chooseBackendPromotionCandidate(replicas, candidateKey)
+	if err != nil {
+		return backendRecovery, err
+	}
+	log.Infof("RecoverBackend: promoting backend %s in place of failed backend master %s", promoted.Address, status.Address)
+	if *config.RuntimeCLIFlags.Noop {
+		return backendRecovery, fmt.Errorf("noop: aborting recover-backend operation on %s; signalling error but nothing went wrong.", promoted.Address)
+	}
+
+	isReachable, isReadOnly := false, false
+	if err := execBackend(&failedKey, "set global read_only = ?", true); err != nil {
+		log.Warningf("RecoverBackend: cannot set failed backend master %s read-only: %+v", status.Address, err)
+	} else {
+		isReachable = true
+		isReadOnly, err = readBackendReadOnly(&failedKey)
+		log.Errore(err)
+	}
+	if err := checkBackendMasterFenced(status.Address, isReachable, isReadOnly, replicas); err != nil {
+		if !force {
+			return backendRecovery, log.Errorf("RecoverBackend: %+v. Aborting; use force to promote anyway", err)
+		}
+		log.Warningf("RecoverBackend: %+v. Proceeding as forced", err)
+	}
+	if promoted, err = promoteBackendReplica(promoted, execBackend, probeBackendReplica); err != nil {
+		return backendRecovery, log.Errore(err)
+	}
+	if err := db.PromoteBackend(promoted.Address); err != nil {
+		return backendRecovery, log.Errore(err)
+	}
+	backendRecovery.PromotedBackend = promoted.Address
+
+	// The backend is available from here on
+	promotedKey := resolveBackendKey(promoted.Key)
+	if _, err := inst.ReadTopologyInstance(&promotedKey); err != nil {
+		log.Errore(err)
+	}
+	for _, replica := range replicas {
+		if replica.Address == promoted.Address {
+			continue
+		}
+		replicaKey := resolveBackendKey(replica.Key)
+		if _, err := inst.RelocateBelow(&replicaKey, &promotedKey); err != nil {
+			log.Errorf("RecoverBackend: cannot relocate backend %+v below %+v: %+v", replicaKey, promotedKey, err)
+			backendRecovery.LostReplicas = append(backendRecovery.LostReplicas, replicaKey)
+			continue
+		}
+		backendRecovery.RelocatedReplicas = append(backendRecovery.RelocatedReplicas, replicaKey)
+	}
+	inst.AuditOperation("recover-backend", &promotedKey, fmt.Sprintf("promoted backend %s in place of failed backend master %s; relocated replicas: %+v; lost replicas: %+v", promoted.Address, status.Address, backendRecovery.RelocatedReplicas, backendRecovery.LostReplicas))
+	return backendRecovery, nil
+}
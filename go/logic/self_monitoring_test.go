@@ -0,0 +1,172 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+func newTestBackendReplica(hostname string, readPos int64, execPos int64) *backendReplica {
+	address := db.BackendAddress{Hostname: hostname, Port: 3306}
+	return &backendReplica{
+		Address:                address,
+		Key:                    backendAddressKey(address),
+		MasterKey:              inst.InstanceKey{Hostname: "backend-master", Port: 3306},
+		ReadCoordinates:        inst.BinlogCoordinates{LogFile: "mysql-bin.000007", LogPos: readPos},
+		ExecCoordinates:        inst.BinlogCoordinates{LogFile: "mysql-bin.000007", LogPos: execPos},
+		SQLThreadRunning:       true,
+		LogBinEnabled:          true,
+		LogSlaveUpdatesEnabled: true,
+	}
+}
+
+// backendExecRecorder records the statements executed on backend servers, failing those it is told to fail
+type backendExecRecorder struct {
+	queries []string
+	failing map[string]bool
+}
+
+func (this *backendExecRecorder) exec(instanceKey *inst.InstanceKey, query string, args ...interface{}) error {
+	this.queries = append(this.queries, query)
+	if this.failing[query] {
+		return fmt.Errorf("failed: %s", query)
+	}
+	return nil
+}
+
+func TestChooseBackendPromotionCandidate(t *testing.T) {
+	behind := newTestBackendReplica("backend-behind", 100, 100)
+	ahead := newTestBackendReplica("backend-ahead", 200, 200)
+	noLogSlaveUpdates := newTestBackendReplica("backend-no-log-slave-updates", 300, 300)
+	noLogSlaveUpdates.LogSlaveUpdatesEnabled = false
+	noLogBin := newTestBackendReplica("backend-no-log-bin", 400, 400)
+	noLogBin.LogBinEnabled = false
+	replicas := [](*backendReplica){behind, noLogSlaveUpdates, ahead, noLogBin}
+	{
+		candidate, err := chooseBackendPromotionCandidate(replicas, nil)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(candidate.Address, ahead.Address)
+	}
+	{
+		candidate, err := chooseBackendPromotionCandidate(replicas, &behind.Key)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(candidate.Address, behind.Address)
+	}
+	{
+		_, err := chooseBackendPromotionCandidate(replicas, &noLogSlaveUpdates.Key)
+		test.S(t).ExpectNotNil(err)
+		_, err = chooseBackendPromotionCandidate(replicas, &noLogBin.Key)
+		test.S(t).ExpectNotNil(err)
+		_, err = chooseBackendPromotionCandidate(replicas, &inst.InstanceKey{Hostname: "backend-unknown", Port: 3306})
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		_, err := chooseBackendPromotionCandidate([](*backendReplica){noLogSlaveUpdates, noLogBin}, nil)
+		test.S(t).ExpectNotNil(err)
+		_, err = chooseBackendPromotionCandidate([](*backendReplica){}, nil)
+		test.S(t).ExpectNotNil(err)
+	}
+}
+
+func TestCheckBackendMasterFenced(t *testing.T) {
+	failedAddress := db.BackendAddress{Hostname: "backend-master", Port: 3306}
+	disconnected := newTestBackendReplica("backend-disconnected", 100, 100)
+	otherDisconnected := newTestBackendReplica("backend-other-disconnected", 100, 100)
+	connected := newTestBackendReplica("backend-connected", 100, 100)
+	connected.IOThreadRunning = true
+	otherConnected := newTestBackendReplica("backend-other-connected", 100, 100)
+	otherConnected.IOThreadRunning = true
+
+	test.S(t).ExpectNil(checkBackendMasterFenced(failedAddress, true, true, [](*backendReplica){connected}))
+	test.S(t).ExpectNotNil(checkBackendMasterFenced(failedAddress, true, false, [](*backendReplica){disconnected}))
+
+	// Unreachable from this node
+	test.S(t).ExpectNil(checkBackendMasterFenced(failedAddress, false, false, [](*backendReplica){disconnected, otherDisconnected}))
+	test.S(t).ExpectNil(checkBackendMasterFenced(failedAddress, false, false, [](*backendReplica){disconnected, connected}))
+	test.S(t).ExpectNotNil(checkBackendMasterFenced(failedAddress, false, false, [](*backendReplica){connected}))
+	test.S(t).ExpectNotNil(checkBackendMasterFenced(failedAddress, false, false, [](*backendReplica){disconnected, connected, otherConnected}))
+}
+
+func TestPromoteBackendReplica(t *testing.T) {
+	timeoutSeconds := config.Config.BackendRecoveryRelayLogTimeoutSeconds
+	config.Config.BackendRecoveryRelayLogTimeoutSeconds = 1
+	defer func() { config.Config.BackendRecoveryRelayLogTimeoutSeconds = timeoutSeconds }()
+
+	probeAs := func(replica *backendReplica) backendProbeFunc {
+		return func(address db.BackendAddress) (*backendReplica, error) { return replica, nil }
+	}
+	{
+		caughtUp := newTestBackendReplica("backend-replica", 200, 200)
+		recorder := &backendExecRecorder{}
+		promoted, err := promoteBackendReplica(newTestBackendReplica("backend-replica", 200, 100), recorder.exec, probeAs(caughtUp))
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(promoted.ExecCoordinates.LogPos, int64(200))
+		test.S(t).ExpectEquals(len(recorder.queries), 4)
+		test.S(t).ExpectEquals(recorder.queries[0], "stop slave io_thread")
+		test.S(t).ExpectEquals(recorder.queries[1], "stop slave")
+		test.S(t).ExpectEquals(recorder.queries[2], "reset slave /*!50603 all */")
+		test.S(t).ExpectEquals(recorder.queries[3], "set global read_only = ?")
+	}
+	{
+		// Relay logs not applied in time: replication is restarted, and the replica is not made writable
+		lagging := newTestBackendReplica("backend-replica", 200, 100)
+		recorder := &backendExecRecorder{}
+		_, err := promoteBackendReplica(lagging, recorder.exec, probeAs(lagging))
+		test.S(t).ExpectNotNil(err)
+		test.S(t).ExpectEquals(len(recorder.queries), 2)
+		test.S(t).ExpectEquals(recorder.queries[1], "start slave")
+	}
+	{
+		// SQL thread broken while applying relay logs
+		broken := newTestBackendReplica("backend-replica", 200, 100)
+		broken.SQLThreadRunning = false
+		recorder := &backendExecRecorder{}
+		_, err := promoteBackendReplica(newTestBackendReplica("backend-replica", 200, 100), recorder.exec, probeAs(broken))
+		test.S(t).ExpectNotNil(err)
+		test.S(t).ExpectEquals(recorder.queries[len(recorder.queries)-1], "start slave")
+	}
+	{
+		// Probe error
+		recorder := &backendExecRecorder{}
+		_, err := promoteBackendReplica(newTestBackendReplica("backend-replica", 200, 100), recorder.exec, func(address db.BackendAddress) (*backendReplica, error) {
+			return nil, fmt.Errorf("unreachable")
+		})
+		test.S(t).ExpectNotNil(err)
+		test.S(t).ExpectEquals(recorder.queries[len(recorder.queries)-1], "start slave")
+	}
+	{
+		caughtUp := newTestBackendReplica("backend-replica", 200, 200)
+		recorder := &backendExecRecorder{failing: map[string]bool{"reset slave /*!50603 all */": true}}
+		_, err := promoteBackendReplica(caughtUp, recorder.exec, probeAs(caughtUp))
+		test.S(t).ExpectNotNil(err)
+		test.S(t).ExpectEquals(recorder.queries[len(recorder.queries)-1], "start slave")
+	}
+	{
+		// Nothing was stopped, so nothing is restarted
+		caughtUp := newTestBackendReplica("backend-replica", 200, 200)
+		recorder := &backendExecRecorder{failing: map[string]bool{"stop slave io_thread": true}}
+		_, err := promoteBackendReplica(caughtUp, recorder.exec, probeAs(caughtUp))
+		test.S(t).ExpectNotNil(err)
+		test.S(t).ExpectEquals(len(recorder.queries), 1)
+	}
+}
@@ -0,0 +1,49 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+
+	"github.com/github/orchestrator/go/inst"
+	"github.com/openark/golib/log"
+)
+
+// auditSemiSyncAsyncFallback audits a master falling back to asynchronous replication, or recovering from such
+// fallback, between two consecutive reads, and records the respective state event. With asynchronous replication,
+// commits are not guaranteed to have reached any replica, and may be lost upon failover.
+func auditSemiSyncAsyncFallback(previousInstance *inst.Instance, instance *inst.Instance) {
+	changed, fallenBack := inst.IsSemiSyncAsyncFallbackChanged(previousInstance, instance)
+	if !changed {
+		return
+	}
+	state := fmt.Sprintf("rpl_semi_sync_master_timeout=%dms, wait point=%s, semi-sync clients=%d, fallbacks=%d, unacknowledged commits=%d",
+		instance.SemiSyncMasterTimeout, instance.SemiSyncMasterWaitPoint, instance.SemiSyncMasterClients, instance.SemiSyncMasterNoTimes, instance.SemiSyncMasterNoTx)
+	if fallenBack {
+		log.Warningf("Master %+v fell back from semi-sync to asynchronous replication: %s", instance.Key, state)
+		inst.AuditOperation("semi-sync-async-fallback", &instance.Key, fmt.Sprintf("fell back to asynchronous replication: %s", state))
+	} else {
+		inst.AuditOperation("semi-sync-restored", &instance.Key, fmt.Sprintf("semi-sync replication restored: %s", state))
+	}
+	inst.RecordStateEvent(inst.SemiSyncAsyncFallbackEvent, instance.ClusterName, &instance.Key, map[string]interface{}{
+		"fallenBack":    fallenBack,
+		"timeoutMillis": instance.SemiSyncMasterTimeout,
+		"waitPoint":     instance.SemiSyncMasterWaitPoint,
+		"clients":       instance.SemiSyncMasterClients,
+		"noTimes":       instance.SemiSyncMasterNoTimes,
+	})
+}
@@ -0,0 +1,389 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/github/orchestrator/go/kv"
+	"github.com/github/orchestrator/go/raft"
+	"github.com/miekg/dns"
+	"github.com/openark/golib/log"
+	"github.com/rcrowley/go-metrics"
+)
+
+// serviceRecordsDNSTimeout limits DNS queries and updates made while reconciling service records
+const serviceRecordsDNSTimeout = 10 * time.Second
+
+var serviceRecordsReconciliationEntrance int64
+var serviceRecordMismatchesGauge = metrics.NewGauge()
+
+// latestServiceRecordChecks are the outcome of the latest reconciliation
+var latestServiceRecordChecks = []ServiceRecordCheck{}
+var latestServiceRecordChecksMutex sync.Mutex
+
+func init() {
+	metrics.Register("service_records.mismatches", serviceRecordMismatchesGauge)
+}
+
+// ServiceRecordCheck is the comparison of a cluster's master, as published in a single store, with the
+// cluster's actual master
+type ServiceRecordCheck struct {
+	ClusterName  string
+	ClusterAlias string
+	MasterKey    inst.InstanceKey
+	Store        string // "internal", "consul", "zk" or "dns"
+	Record       string // KV key or DNS name
+	Expected     string
+	Published    string
+	Error        string
+	IsMismatch   bool
+	IsHealed     bool
+	CheckedAt    time.Time
+}
+
+// checkMasterKVRecords compares a cluster's master entry in each configured KV store with the cluster's master. With
+// KVClusterMasterTemplates, each of the cluster's templated entries is compared.
+func checkMasterKVRecords(clusterInfo *inst.ClusterInfo, master *inst.Instance) (checks []ServiceRecordCheck) {
+	expectedPairs := [](*kv.KVPair){kv.NewKVPair(inst.GetClusterMasterKVKey(clusterInfo.ClusterAlias), master.Key.StringCode())}
+	if _, found := config.Config.GetKVClusterMasterTemplates(clusterInfo.ClusterAlias); found {
+		kvPairs, err := inst.GetClusterMasterEntriesKVPairs(clusterInfo, master)
+		if err != nil {
+			checks = append(checks, ServiceRecordCheck{Store: "kv", Error: err.Error()})
+		}
+		expectedPairs = kvPairs
+	}
+	for _, expectedPair := range expectedPairs {
+		for _, storeValue := range kv.GetStoresValues(expectedPair.Key) {
+			checks = append(checks, ServiceRecordCheck{
+				Store:      storeValue.Store,
+				Record:     expectedPair.Key,
+				Expected:   expectedPair.Value,
+				Published:  storeValue.Value,
+				Error:      storeValue.Error,
+				IsMismatch: storeValue.Error == "" && storeValue.Value != expectedPair.Value,
+			})
+		}
+	}
+	return checks
+}
+
+// masterDNSPlaceholders replaces placeholders of the master DNS hook action as they were replaced upon
+// promoting the cluster's current master
+func masterDNSPlaceholders(clusterInfo *inst.ClusterInfo, masterKey *inst.InstanceKey) func(string) string {
+	topologyRecovery := &TopologyRecovery{
+		AnalysisEntry: inst.ReplicationAnalysis{ClusterDetails: *clusterInfo, AnalyzedInstanceKey: *masterKey},
+		SuccessorKey:  masterKey,
+	}
+	return func(text string) string {
+		return replaceCommandPlaceholders(text, topologyRecovery)
+	}
+}
+
+// lookupIPv4s returns the IPv4 addresses of a host name, or the address itself, given an IPv4 address
+func lookupIPv4s(host string) (ips []string, err error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []string{ip.String()}, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), serviceRecordsDNSTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return ips, err
+	}
+	for _, addr := range addrs {
+		if addr.IP.To4() != nil {
+			ips = append(ips, addr.IP.String())
+		}
+	}
+	return ips, nil
+}
+
+// queryDNSHookActionRecords queries the records of given name and type on the DNS server of given dns hook action,
+// which is authoritative, over the action's network and signed with the action's TSIG key, if any
+func queryDNSHookActionRecords(hookAction *config.HookAction, name string, recordType uint16) ([]dns.RR, error) {
+	message := new(dns.Msg)
+	message.SetQuestion(dns.Fqdn(name), recordType)
+	signDNSHookActionMessage(message, hookAction)
+	client, server := newDNSHookActionClient(hookAction, serviceRecordsDNSTimeout)
+	response, _, err := client.Exchange(message, server)
+	if err != nil {
+		return nil, err
+	}
+	if response.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("%s responded with %s", server, dns.RcodeToString[response.Rcode])
+	}
+	return response.Answer, nil
+}
+
+// checkMasterDNSRecord compares the record of the master DNS hook action with the cluster's master. The record is
+// queried on the hook action's DNS server. A CNAME record must point at the expected host name; an A record must
+// share an address with it.
+func checkMasterDNSRecord(hookAction *config.HookAction, clusterInfo *inst.ClusterInfo, masterKey *inst.InstanceKey) ServiceRecordCheck {
+	placeholders := masterDNSPlaceholders(clusterInfo, masterKey)
+	name := strings.TrimSuffix(placeholders(hookAction.RecordName), ".")
+	expected := strings.TrimSuffix(placeholders(hookAction.RecordValue), ".")
+	check := ServiceRecordCheck{Store: "dns", Record: name, Expected: expected}
+
+	if hookAction.RecordType == "CNAME" {
+		answers, err := queryDNSHookActionRecords(hookAction, name, dns.TypeCNAME)
+		if err != nil {
+			check.Error = err.Error()
+			return check
+		}
+		for _, answer := range answers {
+			if cname, ok := answer.(*dns.CNAME); ok {
+				check.Published = strings.TrimSuffix(cname.Target, ".")
+			}
+		}
+		check.IsMismatch = !strings.EqualFold(check.Published, expected)
+		return check
+	}
+	answers, err := queryDNSHookActionRecords(hookAction, name, dns.TypeA)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	publishedIPs := []string{}
+	for _, answer := range answers {
+		if a, ok := answer.(*dns.A); ok {
+			publishedIPs = append(publishedIPs, a.A.String())
+		}
+	}
+	expectedIPs, err := lookupIPv4s(expected)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	check.Published = strings.Join(publishedIPs, ",")
+	check.IsMismatch = true
+	for _, publishedIP := range publishedIPs {
+		for _, expectedIP := range expectedIPs {
+			if publishedIP == expectedIP {
+				check.IsMismatch = false
+			}
+		}
+	}
+	return check
+}
+
+// readMasterDNSHookAction returns the configured master DNS hook action, if any
+func readMasterDNSHookAction() *config.HookAction {
+	hookAction, ok := config.Config.HookActions[config.Config.ReconcileMasterDNSHookAction]
+	if !ok || hookAction.Type != "dns" {
+		return nil
+	}
+	return &hookAction
+}
+
+// isConfirmedServiceRecordMismatch checks whether the previous reconciliation found the same mismatch, with the same
+// published and expected values, and did not heal it. A mismatch found only once may be a record just written by a
+// recovery, ahead of the backend's view of the cluster's master.
+func isConfirmedServiceRecordMismatch(check *ServiceRecordCheck, previousChecks []ServiceRecordCheck) bool {
+	for _, previousCheck := range previousChecks {
+		if previousCheck.ClusterAlias == check.ClusterAlias && previousCheck.Store == check.Store && previousCheck.Record == check.Record &&
+			previousCheck.Published == check.Published && previousCheck.Expected == check.Expected &&
+			previousCheck.IsMismatch && !previousCheck.IsHealed {
+			return true
+		}
+	}
+	return false
+}
+
+// canHealServiceRecord re-validates a mismatch right before it is healed. The cluster's master must be freshly checked,
+// writeable and not replicating; the cluster must be neither locked nor under recovery; the published value must not
+// have changed since checked, and must not point to another writeable instance. Returns the reason not to heal, if any.
+func canHealServiceRecord(clusterInfo *inst.ClusterInfo, masterKey *inst.InstanceKey, check *ServiceRecordCheck) error {
+	master, found, err := inst.ReadInstance(masterKey)
+	if err != nil || !found {
+		return fmt.Errorf("cannot read master %+v: %+v", *masterKey, err)
+	}
+	if !master.IsLastCheckValid || !master.IsUpToDate || master.ReadOnly || master.IsReplica() {
+		return fmt.Errorf("master %+v is not a freshly checked, writeable, non-replicating master", *masterKey)
+	}
+	if clusterLock, err := inst.ReadClusterLock(clusterInfo.ClusterAlias); err != nil || clusterLock != nil {
+		return fmt.Errorf("cluster %s is locked", clusterInfo.ClusterName)
+	}
+	if recoveries, err := ReadInActivePeriodClusterRecovery(clusterInfo.ClusterName); err != nil || len(recoveries) > 0 {
+		return fmt.Errorf("cluster %s has a recent recovery", clusterInfo.ClusterName)
+	}
+	if check.Store == "dns" {
+		hookAction := readMasterDNSHookAction()
+		if hookAction == nil {
+			return fmt.Errorf("no master DNS hook action")
+		}
+		if recheck := checkMasterDNSRecord(hookAction, clusterInfo, masterKey); recheck.Error != "" || recheck.Published != check.Published {
+			return fmt.Errorf("%s %s changed since checked", check.Store, check.Record)
+		}
+	}
+	for _, storeValue := range kv.GetStoresValues(check.Record) {
+		if storeValue.Store == check.Store && (storeValue.Error != "" || storeValue.Value != check.Published) {
+			return fmt.Errorf("%s %s changed since checked", check.Store, check.Record)
+		}
+	}
+	if publishedKey, err := inst.ParseRawInstanceKeyLoose(check.Published); err == nil && !publishedKey.Equals(masterKey) {
+		if published, found, err := inst.ReadInstance(publishedKey); err == nil && found && !published.ReadOnly {
+			return fmt.Errorf("published instance %+v is writeable", *publishedKey)
+		}
+	}
+	return nil
+}
+
+// healServiceRecord rewrites a mismatched master entry onto the KV stores, or executes the master DNS hook action
+func healServiceRecord(clusterInfo *inst.ClusterInfo, masterKey *inst.InstanceKey, check *ServiceRecordCheck) (err error) {
+	if check.Store == "dns" {
+		hookAction := readMasterDNSHookAction()
+		if hookAction == nil {
+			return fmt.Errorf("no master DNS hook action")
+		}
+		_, err = executeDNSHookAction(hookAction, masterDNSPlaceholders(clusterInfo, masterKey), serviceRecordsDNSTimeout)
+		return err
+	}
+	kvPair := kv.NewKVPair(check.Record, check.Expected)
+	if orcraft.IsRaftEnabled() {
+		_, err = orcraft.PublishCommand("put-key-value", kvPair)
+	} else {
+		err = kv.PutKVPair(kvPair)
+	}
+	return err
+}
+
+// reconcileClusterServiceRecords checks, and optionally heals, the service records of a single cluster. Only mismatches
+// also found by the previous reconciliation are healed, and only once re-validated.
+func reconcileClusterServiceRecords(clusterInfo *inst.ClusterInfo, master *inst.Instance, previousChecks []ServiceRecordCheck) (checks []ServiceRecordCheck) {
+	masterKey := &master.Key
+	checks = checkMasterKVRecords(clusterInfo, master)
+	if hookAction := readMasterDNSHookAction(); hookAction != nil {
+		checks = append(checks, checkMasterDNSRecord(hookAction, clusterInfo, masterKey))
+	}
+
+	for i := range checks {
+		check := &checks[i]
+		check.ClusterName = clusterInfo.ClusterName
+		check.ClusterAlias = clusterInfo.ClusterAlias
+		check.MasterKey = *masterKey
+		check.CheckedAt = time.Now()
+		if !check.IsMismatch {
+			continue
+		}
+		log.Warningf("Service record mismatch: cluster %s: %s %s is %s; expected %s", clusterInfo.ClusterName, check.Store, check.Record, check.Published, check.Expected)
+		inst.AuditOperation("service-record-mismatch", masterKey, fmt.Sprintf("cluster %s: %s %s is %s; expected %s", clusterInfo.ClusterName, check.Store, check.Record, check.Published, check.Expected))
+		inst.RecordStateEvent(inst.ServiceRecordMismatchEvent, clusterInfo.ClusterName, masterKey, map[string]interface{}{
+			"store":     check.Store,
+			"record":    check.Record,
+			"published": check.Published,
+			"expected":  check.Expected,
+		})
+		if !config.Config.ReconcileMasterServiceRecordsSelfHeal || !isConfirmedServiceRecordMismatch(check, previousChecks) {
+			continue
+		}
+		if err := canHealServiceRecord(clusterInfo, masterKey, check); err != nil {
+			log.Warningf("reconcileClusterServiceRecords: not healing %s %s: %+v", check.Store, check.Record, err)
+			continue
+		}
+		if err := healServiceRecord(clusterInfo, masterKey, check); err != nil {
+			check.Error = err.Error()
+			log.Errorf("reconcileClusterServiceRecords: failed healing %s %s: %+v", check.Store, check.Record, err)
+			continue
+		}
+		check.IsHealed = true
+		inst.AuditOperation("heal-service-record", masterKey, fmt.Sprintf("cluster %s: %s %s set to %s", clusterInfo.ClusterName, check.Store, check.Record, check.Expected))
+	}
+	return checks
+}
+
+// ReconcileMasterServiceRecords compares the master entries published in KV stores and DNS with the actual master of each
+// cluster, alerting on mismatches and optionally healing them. Clusters with no alias, with other than a single writeable
+// master, locked, or in the midst of a recovery are skipped. Reconciliation runs when ReconcileMasterServiceRecords is enabled, or
+// when forced.
+func ReconcileMasterServiceRecords(force bool) {
+	if !config.Config.ReconcileMasterServiceRecords && !force {
+		return
+	}
+	if !IsLeader() {
+		return
+	}
+	// This function is non re-entrant (it can only be running once at any point in time)
+	if !atomic.CompareAndSwapInt64(&serviceRecordsReconciliationEntrance, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt64(&serviceRecordsReconciliationEntrance, 0)
+
+	clustersInfo, err := inst.ReadClustersInfo("")
+	if err != nil {
+		log.Errore(err)
+		return
+	}
+	masters, err := inst.ReadWriteableClustersMasters()
+	if err != nil {
+		log.Errore(err)
+		return
+	}
+	clusterMasters := make(map[string][](*inst.Instance))
+	for _, master := range masters {
+		clusterMasters[master.ClusterName] = append(clusterMasters[master.ClusterName], master)
+	}
+	previousChecks := ReadServiceRecordChecks(true)
+	checks := []ServiceRecordCheck{}
+	countMismatches := 0
+	for i := range clustersInfo {
+		clusterInfo := &clustersInfo[i]
+		if clusterInfo.ClusterAlias == "" || len(clusterMasters[clusterInfo.ClusterName]) != 1 {
+			continue
+		}
+		if recoveries, err := ReadInActivePeriodClusterRecovery(clusterInfo.ClusterName); err != nil || len(recoveries) > 0 {
+			continue
+		}
+		if clusterLock, err := inst.ReadClusterLock(clusterInfo.ClusterAlias); err != nil || clusterLock != nil {
+			continue
+		}
+		for _, check := range reconcileClusterServiceRecords(clusterInfo, clusterMasters[clusterInfo.ClusterName][0], previousChecks) {
+			if check.IsMismatch && !check.IsHealed {
+				countMismatches++
+			}
+			checks = append(checks, check)
+		}
+	}
+	serviceRecordMismatchesGauge.Update(int64(countMismatches))
+
+	latestServiceRecordChecksMutex.Lock()
+	defer latestServiceRecordChecksMutex.Unlock()
+	latestServiceRecordChecks = checks
+}
+
+// ReadServiceRecordChecks returns the outcome of the latest reconciliation of service records, optionally only mismatches
+func ReadServiceRecordChecks(mismatchesOnly bool) (checks []ServiceRecordCheck) {
+	latestServiceRecordChecksMutex.Lock()
+	defer latestServiceRecordChecksMutex.Unlock()
+
+	checks = []ServiceRecordCheck{}
+	for _, check := range latestServiceRecordChecks {
+		if mismatchesOnly && !check.IsMismatch {
+			continue
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
@@ -0,0 +1,231 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"net"
+	"testing"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/github/orchestrator/go/kv"
+	"github.com/miekg/dns"
+	test "github.com/openark/golib/tests"
+)
+
+// withServiceRecordsCluster writes a cluster aliased "shop", with master db-1:3306 and a read-only replica db-2:3306,
+// and enables self-healing of service records, for the duration of given test
+func withServiceRecordsCluster(t *testing.T) {
+	withSQLiteBackend(t)
+	selfHeal := config.Config.ReconcileMasterServiceRecordsSelfHeal
+	config.Config.ReconcileMasterServiceRecordsSelfHeal = true
+	t.Cleanup(func() { config.Config.ReconcileMasterServiceRecordsSelfHeal = selfHeal })
+	kv.InitKVStores()
+
+	masterKey := inst.InstanceKey{Hostname: "db-1", Port: 3306}
+	writeTestInstance(t, masterKey, inst.InstanceKey{}, "db-1:3306")
+	writeTestInstance(t, inst.InstanceKey{Hostname: "db-2", Port: 3306}, masterKey, "db-1:3306")
+	setTestReadOnly(t, "db-2", true)
+	test.S(t).ExpectNil(inst.SetClusterAlias("db-1:3306", "shop"))
+}
+
+func setTestReadOnly(t *testing.T, hostname string, readOnly bool) {
+	_, err := db.ExecOrchestrator(`update database_instance set read_only = ? where hostname = ?`, readOnly, hostname)
+	test.S(t).ExpectNil(err)
+}
+
+func setTestPublishedMaster(t *testing.T, value string) {
+	test.S(t).ExpectNil(kv.NewInternalKVStore().PutKeyValue(inst.GetClusterMasterKVKey("shop"), value))
+}
+
+func readTestPublishedMaster(t *testing.T) string {
+	value, err := kv.NewInternalKVStore().GetKeyValue(inst.GetClusterMasterKVKey("shop"))
+	test.S(t).ExpectNil(err)
+	return value
+}
+
+// reconcileTestServiceRecords reconciles the service records of the "shop" cluster, given the previous checks
+func reconcileTestServiceRecords(t *testing.T, previousChecks []ServiceRecordCheck) []ServiceRecordCheck {
+	clusterInfo, err := inst.ReadClusterInfo("db-1:3306")
+	test.S(t).ExpectNil(err)
+	master, found, err := inst.ReadInstance(&inst.InstanceKey{Hostname: "db-1", Port: 3306})
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(found)
+	checks := reconcileClusterServiceRecords(clusterInfo, master, previousChecks)
+	if config.Config.ReconcileMasterDNSHookAction == "" {
+		test.S(t).ExpectEquals(len(checks), 1)
+	} else {
+		test.S(t).ExpectEquals(len(checks), 2)
+	}
+	return checks
+}
+
+// withMasterDNSHookAction configures a "dns" hook action on a test DNS server as the master DNS hook action, for
+// the duration of given test
+func withMasterDNSHookAction(t *testing.T, hookAction config.HookAction) *testDNSServer {
+	server := newTestDNSServer(t, "tcp")
+	hookAction.Type, hookAction.DNSServer, hookAction.DNSNet, hookAction.Zone = "dns", server.address, "tcp", "db.example.com"
+	hookAction.TSIGKeyName, hookAction.TSIGSecret = "orchestrator", testDNSTSIGSecret
+	withHookActions(t, map[string]config.HookAction{"master-dns": hookAction})
+	dnsHookAction := config.Config.ReconcileMasterDNSHookAction
+	config.Config.ReconcileMasterDNSHookAction = "master-dns"
+	t.Cleanup(func() { config.Config.ReconcileMasterDNSHookAction = dnsHookAction })
+	return server
+}
+
+func TestReconcileServiceRecordsHealsConfirmedMismatch(t *testing.T) {
+	withServiceRecordsCluster(t)
+	setTestPublishedMaster(t, "db-gone:3306")
+
+	// A mismatch found once is not healed
+	checks := reconcileTestServiceRecords(t, nil)
+	test.S(t).ExpectTrue(checks[0].IsMismatch)
+	test.S(t).ExpectFalse(checks[0].IsHealed)
+	test.S(t).ExpectEquals(checks[0].Published, "db-gone:3306")
+	test.S(t).ExpectEquals(readTestPublishedMaster(t), "db-gone:3306")
+
+	checks = reconcileTestServiceRecords(t, checks)
+	test.S(t).ExpectTrue(checks[0].IsHealed)
+	test.S(t).ExpectEquals(readTestPublishedMaster(t), "db-1:3306")
+
+	checks = reconcileTestServiceRecords(t, checks)
+	test.S(t).ExpectFalse(checks[0].IsMismatch)
+}
+
+func TestReconcileServiceRecordsKeepsChangedRecord(t *testing.T) {
+	withServiceRecordsCluster(t)
+	setTestPublishedMaster(t, "db-gone:3306")
+	checks := reconcileTestServiceRecords(t, nil)
+
+	// A recovery publishes a new master ahead of the backend's view of the cluster
+	setTestPublishedMaster(t, "db-new:3306")
+	checks = reconcileTestServiceRecords(t, checks)
+	test.S(t).ExpectTrue(checks[0].IsMismatch)
+	test.S(t).ExpectFalse(checks[0].IsHealed)
+	test.S(t).ExpectEquals(readTestPublishedMaster(t), "db-new:3306")
+}
+
+func TestReconcileServiceRecordsKeepsWriteablePublishedInstance(t *testing.T) {
+	withServiceRecordsCluster(t)
+	setTestPublishedMaster(t, "db-2:3306")
+	setTestReadOnly(t, "db-2", false)
+
+	checks := reconcileTestServiceRecords(t, nil)
+	checks = reconcileTestServiceRecords(t, checks)
+	test.S(t).ExpectFalse(checks[0].IsHealed)
+	test.S(t).ExpectEquals(readTestPublishedMaster(t), "db-2:3306")
+
+	setTestReadOnly(t, "db-2", true)
+	checks = reconcileTestServiceRecords(t, checks)
+	test.S(t).ExpectTrue(checks[0].IsHealed)
+	test.S(t).ExpectEquals(readTestPublishedMaster(t), "db-1:3306")
+}
+
+func TestReconcileServiceRecordsKeepsLockedCluster(t *testing.T) {
+	withServiceRecordsCluster(t)
+	setTestPublishedMaster(t, "db-gone:3306")
+	test.S(t).ExpectNil(inst.WriteClusterLock(inst.NewClusterLock("db-1:3306", "shop", "test", "maintenance", 60)))
+
+	checks := reconcileTestServiceRecords(t, nil)
+	checks = reconcileTestServiceRecords(t, checks)
+	test.S(t).ExpectFalse(checks[0].IsHealed)
+	test.S(t).ExpectEquals(readTestPublishedMaster(t), "db-gone:3306")
+}
+
+func TestReconcileServiceRecordsKeepsReadOnlyMaster(t *testing.T) {
+	withServiceRecordsCluster(t)
+	setTestPublishedMaster(t, "db-gone:3306")
+
+	checks := reconcileTestServiceRecords(t, nil)
+	setTestReadOnly(t, "db-1", true)
+	checks = reconcileTestServiceRecords(t, checks)
+	test.S(t).ExpectFalse(checks[0].IsHealed)
+	test.S(t).ExpectEquals(readTestPublishedMaster(t), "db-gone:3306")
+}
+
+func TestReconcileServiceRecordsHealsMasterDNSRecord(t *testing.T) {
+	withServiceRecordsCluster(t)
+	setTestPublishedMaster(t, "db-1:3306")
+	server := withMasterDNSHookAction(t, config.HookAction{
+		RecordName:  "{failureClusterAlias}-master.db.example.com",
+		RecordType:  "CNAME",
+		RecordValue: "{successorHost}.db.example.com",
+	})
+	server.setRecord("shop-master.db.example.com.", &dns.CNAME{
+		Hdr:    dns.RR_Header{Name: "shop-master.db.example.com.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 60},
+		Target: "db-gone.db.example.com.",
+	})
+
+	checks := reconcileTestServiceRecords(t, nil)
+	test.S(t).ExpectFalse(checks[0].IsMismatch)
+	dnsCheck := checks[1]
+	test.S(t).ExpectEquals(dnsCheck.Store, "dns")
+	test.S(t).ExpectEquals(dnsCheck.Record, "shop-master.db.example.com")
+	test.S(t).ExpectEquals(dnsCheck.Published, "db-gone.db.example.com")
+	test.S(t).ExpectEquals(dnsCheck.Expected, "db-1.db.example.com")
+	test.S(t).ExpectTrue(dnsCheck.IsMismatch)
+	test.S(t).ExpectFalse(dnsCheck.IsHealed)
+	test.S(t).ExpectEquals(server.countUpdates(), 0)
+
+	// a confirmed mismatch is healed by executing the DNS hook action
+	checks = reconcileTestServiceRecords(t, checks)
+	test.S(t).ExpectTrue(checks[1].IsHealed)
+	test.S(t).ExpectEquals(server.countUpdates(), 1)
+
+	checks = reconcileTestServiceRecords(t, checks)
+	test.S(t).ExpectFalse(checks[1].IsMismatch)
+	test.S(t).ExpectEquals(checks[1].Published, "db-1.db.example.com")
+}
+
+// setTestMasterARecord publishes the A record of the "shop" cluster's master on given test DNS server
+func setTestMasterARecord(server *testDNSServer, ip string) {
+	server.setRecord("shop-master.db.example.com.", &dns.A{
+		Hdr: dns.RR_Header{Name: "shop-master.db.example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+		A:   net.ParseIP(ip).To4(),
+	})
+}
+
+func TestReconcileServiceRecordsComparesMasterDNSAddresses(t *testing.T) {
+	withServiceRecordsCluster(t)
+	setTestPublishedMaster(t, "db-1:3306")
+	server := withMasterDNSHookAction(t, config.HookAction{
+		RecordName:  "{failureClusterAlias}-master.db.example.com",
+		RecordValue: "10.0.0.1",
+	})
+	setTestMasterARecord(server, "10.0.0.1")
+
+	checks := reconcileTestServiceRecords(t, nil)
+	test.S(t).ExpectEquals(checks[1].Published, "10.0.0.1")
+	test.S(t).ExpectFalse(checks[1].IsMismatch)
+
+	// the record changes between checks: it is not healed
+	setTestMasterARecord(server, "10.0.0.9")
+	checks = reconcileTestServiceRecords(t, checks)
+	test.S(t).ExpectTrue(checks[1].IsMismatch)
+	setTestMasterARecord(server, "10.0.0.8")
+	checks = reconcileTestServiceRecords(t, checks)
+	test.S(t).ExpectTrue(checks[1].IsMismatch)
+	test.S(t).ExpectFalse(checks[1].IsHealed)
+	test.S(t).ExpectEquals(server.countUpdates(), 0)
+
+	// a missing record is a mismatch
+	server.setRecord("shop-master.db.example.com.", nil)
+	checks = reconcileTestServiceRecords(t, nil)
+	test.S(t).ExpectTrue(checks[1].IsMismatch)
+	test.S(t).ExpectEquals(checks[1].Published, "")
+}
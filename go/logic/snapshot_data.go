@@ -46,10 +46,31 @@ type SnapshotData struct {
 	HostnameUnresolves,
 	DowntimedInstances,
 	Candidates,
+	CandidateOverrides,
 	Detections,
 	KVStore,
 	Recovery,
-	RecoverySteps sqlutils.NamedResultData
+	RecoverySteps,
+	RecoveryBundles,
+	DeadMasterPostmortemWatches,
+	RecoveryApprovals,
+	RecoveryAbortRequests,
+	RecoveryTimings,
+	DesiredTopologies,
+	PoolSpecs,
+	ClusterAdvisoryLocks,
+	DiscoveryPausedClusters,
+	ClusterMasterPins,
+	OnlineSchemaMigrations,
+	APITokens,
+	DelayedReplicas,
+	InstanceFlags,
+	ScheduledReverts,
+	InstanceDecommissions,
+	InstanceNotes,
+	ClusterNotes,
+	StateEventSubscriptions,
+	HostnameResolveSeeds sqlutils.NamedResultData
 
 	LeaderURI string
 }
@@ -95,10 +116,31 @@ func CreateSnapshotData() *SnapshotData {
 	readTableData("hostname_unresolve", &snapshotData.HostnameUnresolves)
 	readTableData("database_instance_downtime", &snapshotData.DowntimedInstances)
 	readTableData("candidate_database_instance", &snapshotData.Candidates)
+	readTableData("candidate_database_instance_override", &snapshotData.CandidateOverrides)
 	readTableData("topology_failure_detection", &snapshotData.Detections)
 	readTableData("kv_store", &snapshotData.KVStore)
 	readTableData("topology_recovery", &snapshotData.Recovery)
 	readTableData("topology_recovery_steps", &snapshotData.RecoverySteps)
+	readTableData("topology_recovery_bundle", &snapshotData.RecoveryBundles)
+	readTableData("dead_master_postmortem_watch", &snapshotData.DeadMasterPostmortemWatches)
+	readTableData("topology_recovery_approval", &snapshotData.RecoveryApprovals)
+	readTableData("topology_recovery_abort", &snapshotData.RecoveryAbortRequests)
+	readTableData("topology_recovery_timing", &snapshotData.RecoveryTimings)
+	readTableData("desired_cluster_topology", &snapshotData.DesiredTopologies)
+	readTableData("database_instance_pool_spec", &snapshotData.PoolSpecs)
+	readTableData("cluster_advisory_lock", &snapshotData.ClusterAdvisoryLocks)
+	readTableData("discovery_paused_cluster", &snapshotData.DiscoveryPausedClusters)
+	readTableData("cluster_master_pin", &snapshotData.ClusterMasterPins)
+	readTableData("online_schema_migration", &snapshotData.OnlineSchemaMigrations)
+	readTableData("api_token", &snapshotData.APITokens)
+	readTableData("delayed_replica", &snapshotData.DelayedReplicas)
+	readTableData("database_instance_flag", &snapshotData.InstanceFlags)
+	readTableData("scheduled_revert", &snapshotData.ScheduledReverts)
+	readTableData("instance_decommission", &snapshotData.InstanceDecommissions)
+	readTableData("database_instance_note", &snapshotData.InstanceNotes)
+	readTableData("cluster_note", &snapshotData.ClusterNotes)
+	readTableData("state_event_subscription", &snapshotData.StateEventSubscriptions)
+	readTableData("hostname_resolve_seed", &snapshotData.HostnameResolveSeeds)
 	readTableData("cluster_injected_pseudo_gtid", &snapshotData.InjectedPseudoGTIDClusters)
 
 	log.Debugf("raft snapshot data created")
@@ -200,10 +242,31 @@ func (this *SnapshotDataCreatorApplier) Restore(rc io.ReadCloser) error {
 	writeTableData("hostname_unresolve", &snapshotData.HostnameUnresolves)
 	writeTableData("database_instance_downtime", &snapshotData.DowntimedInstances)
 	writeTableData("candidate_database_instance", &snapshotData.Candidates)
+	writeTableData("candidate_database_instance_override", &snapshotData.CandidateOverrides)
 	writeTableData("kv_store", &snapshotData.KVStore)
 	writeTableData("topology_recovery", &snapshotData.Recovery)
 	writeTableData("topology_failure_detection", &snapshotData.Detections)
 	writeTableData("topology_recovery_steps", &snapshotData.RecoverySteps)
+	writeTableData("topology_recovery_bundle", &snapshotData.RecoveryBundles)
+	writeTableData("dead_master_postmortem_watch", &snapshotData.DeadMasterPostmortemWatches)
+	writeTableData("topology_recovery_approval", &snapshotData.RecoveryApprovals)
+	writeTableData("topology_recovery_abort", &snapshotData.RecoveryAbortRequests)
+	writeTableData("topology_recovery_timing", &snapshotData.RecoveryTimings)
+	writeTableData("desired_cluster_topology", &snapshotData.DesiredTopologies)
+	writeTableData("database_instance_pool_spec", &snapshotData.PoolSpecs)
+	writeTableData("cluster_advisory_lock", &snapshotData.ClusterAdvisoryLocks)
+	writeTableData("discovery_paused_cluster", &snapshotData.DiscoveryPausedClusters)
+	writeTableData("cluster_master_pin", &snapshotData.ClusterMasterPins)
+	writeTableData("online_schema_migration", &snapshotData.OnlineSchemaMigrations)
+	writeTableData("api_token", &snapshotData.APITokens)
+	writeTableData("delayed_replica", &snapshotData.DelayedReplicas)
+	writeTableData("database_instance_flag", &snapshotData.InstanceFlags)
+	writeTableData("scheduled_revert", &snapshotData.ScheduledReverts)
+	writeTableData("instance_decommission", &snapshotData.InstanceDecommissions)
+	writeTableData("database_instance_note", &snapshotData.InstanceNotes)
+	writeTableData("cluster_note", &snapshotData.ClusterNotes)
+	writeTableData("state_event_subscription", &snapshotData.StateEventSubscriptions)
+	writeTableData("hostname_resolve_seed", &snapshotData.HostnameResolveSeeds)
 	writeTableData("cluster_injected_pseudo_gtid", &snapshotData.InjectedPseudoGTIDClusters)
 
 	// recovery disable
@@ -0,0 +1,279 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/github/orchestrator/go/process"
+	orcraft "github.com/github/orchestrator/go/raft"
+	"github.com/openark/golib/log"
+	"github.com/patrickmn/go-cache"
+)
+
+// stateEventsPublishBatchSize is the max number of state events read from the backend and published at once
+const stateEventsPublishBatchSize = 100
+
+// maxKafkaResponseLength limits the part of a failed Kafka REST Proxy response which is logged
+const maxKafkaResponseLength = 1024
+
+var stateEventsPublishEntrance int64
+
+// stateEventTopicParkDuration is how long a subscription topic which failed to publish is skipped
+const stateEventTopicParkDuration = time.Minute
+
+// parkedStateEventTopics holds the subscription topics which recently failed to publish
+var parkedStateEventTopics = cache.New(stateEventTopicParkDuration, time.Minute)
+
+// kafkaRecord is a record as produced via the Kafka REST Proxy v2 API
+type kafkaRecord struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+type kafkaProduceRequest struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+type kafkaProduceResponse struct {
+	Offsets []struct {
+		Partition int    `json:"partition"`
+		Offset    int64  `json:"offset"`
+		ErrorCode *int   `json:"error_code"`
+		Error     string `json:"error"`
+	} `json:"offsets"`
+}
+
+// stateEventValue is the value of a state event's Kafka record
+type stateEventValue struct {
+	inst.StateEvent
+	OrchestratorHost string
+}
+
+// recordDiscoveryStateEvents records the state events implied by a fresh read of an instance: a newly
+// discovered instance, or a replica whose lag crossed ReasonableReplicationLagSeconds
+func recordDiscoveryStateEvents(previousInstance *inst.Instance, previouslyFound bool, instance *inst.Instance) {
+	if !inst.StateEventsEnabled() || instance == nil || !instance.IsLastCheckValid {
+		return
+	}
+	if !previouslyFound {
+		inst.RecordStateEvent(inst.InstanceDiscoveredEvent, instance.ClusterName, &instance.Key, map[string]interface{}{
+			"masterKey": instance.MasterKey,
+			"version":   instance.Version,
+		})
+		return
+	}
+	if crossed, aboveThreshold := inst.IsLagThresholdCrossed(previousInstance, instance); crossed {
+		inst.RecordStateEvent(inst.LagThresholdCrossedEvent, instance.ClusterName, &instance.Key, map[string]interface{}{
+			"lagSeconds":       instance.SlaveLagSeconds.Int64,
+			"thresholdSeconds": config.Config.ReasonableReplicationLagSeconds,
+			"aboveThreshold":   aboveThreshold,
+		})
+	}
+}
+
+// recordRecoveryStateEvent records a state event in the lifecycle of given recovery
+func recordRecoveryStateEvent(eventType inst.StateEventType, topologyRecovery *TopologyRecovery) {
+	analysisEntry := &topologyRecovery.AnalysisEntry
+	data := map[string]interface{}{
+		"recoveryUID": topologyRecovery.UID,
+		"analysis":    analysisEntry.Analysis,
+	}
+	if eventType == inst.RecoveryResolvedEvent {
+		data["isSuccessful"] = topologyRecovery.IsSuccessful
+		data["successorKey"] = topologyRecovery.SuccessorKey
+		data["lostReplicas"] = topologyRecovery.LostReplicas.GetInstanceKeys()
+	}
+	inst.RecordStateEvent(eventType, analysisEntry.ClusterDetails.ClusterName, &analysisEntry.AnalyzedInstanceKey, data)
+}
+
+// publishToKafka produces given records onto given topic via the Kafka REST Proxy. It only succeeds when
+// all records are acknowledged.
+func publishToKafka(topic string, records []kafkaRecord) error {
+	body, err := json.Marshal(kafkaProduceRequest{Records: records})
+	if err != nil {
+		return err
+	}
+	produceURL := fmt.Sprintf("%s/topics/%s", strings.TrimRight(config.Config.KafkaRESTProxyURL, "/"), url.PathEscape(topic))
+	request, err := http.NewRequest("POST", produceURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	request.Header.Set("Accept", "application/vnd.kafka.v2+json")
+
+	client := &http.Client{Timeout: time.Duration(config.Config.KafkaRequestTimeoutSeconds) * time.Second}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		responseBody, _ := ioutil.ReadAll(io.LimitReader(response.Body, maxKafkaResponseLength))
+		return fmt.Errorf("Kafka REST Proxy responded with %s: %s", response.Status, strings.TrimSpace(string(responseBody)))
+	}
+	produceResponse := kafkaProduceResponse{}
+	if err := json.NewDecoder(response.Body).Decode(&produceResponse); err != nil {
+		return err
+	}
+	for _, offset := range produceResponse.Offsets {
+		if offset.ErrorCode != nil {
+			return fmt.Errorf("Kafka REST Proxy failed producing onto %s: error code %d: %s", topic, *offset.ErrorCode, offset.Error)
+		}
+	}
+	return nil
+}
+
+// SubscribeStateEvents creates or replaces a state event subscription. Subscriptions are replicated via raft.
+func SubscribeStateEvents(subscription *inst.StateEventSubscription) error {
+	if orcraft.IsRaftEnabled() {
+		_, err := orcraft.PublishCommand("write-state-event-subscription", subscription)
+		return err
+	}
+	return inst.WriteStateEventSubscription(subscription)
+}
+
+// UnsubscribeStateEvents removes the state event subscription of given name
+func UnsubscribeStateEvents(name string) error {
+	if orcraft.IsRaftEnabled() {
+		_, err := orcraft.PublishCommand("delete-state-event-subscription", name)
+		return err
+	}
+	return inst.DeleteStateEventSubscription(name)
+}
+
+// stateEventTopics returns the KafkaTopics topic onto which given event is published, and the distinct topics of
+// the subscriptions it matches, other than that topic
+func stateEventTopics(event *inst.StateEvent, subscriptions [](*inst.StateEventSubscription)) (topic string, subscriptionTopics []string) {
+	topic = config.Config.GetKafkaTopic(string(event.EventType))
+	for _, subscription := range subscriptions {
+		if !subscription.Matches(event) || subscription.Topic == "" || subscription.Topic == topic {
+			continue
+		}
+		found := false
+		for _, subscriptionTopic := range subscriptionTopics {
+			found = found || (subscriptionTopic == subscription.Topic)
+		}
+		if !found {
+			subscriptionTopics = append(subscriptionTopics, subscription.Topic)
+		}
+	}
+	return topic, subscriptionTopics
+}
+
+// publishPendingStateEvents publishes pending state events, batch by batch, until none are left or a batch fails to
+// publish onto its KafkaTopics topics. A subscription topic failing to publish is parked, and does not hold back
+// the batch.
+func publishPendingStateEvents(subscriptions [](*inst.StateEventSubscription)) error {
+	for {
+		events, err := inst.ReadPendingStateEvents(stateEventsPublishBatchSize)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+		// Events are published in order; events sharing a topic are published together
+		topics, subscriptionTopics := []string{}, []string{}
+		recordsByTopic := make(map[string][]kafkaRecord)
+		recordsBySubscriptionTopic := make(map[string][]kafkaRecord)
+		for _, event := range events {
+			record := kafkaRecord{
+				Key:   event.ClusterName,
+				Value: stateEventValue{StateEvent: event, OrchestratorHost: process.ThisHostname},
+			}
+			topic, eventSubscriptionTopics := stateEventTopics(&event, subscriptions)
+			if topic != "" {
+				if _, found := recordsByTopic[topic]; !found {
+					topics = append(topics, topic)
+				}
+				recordsByTopic[topic] = append(recordsByTopic[topic], record)
+			}
+			for _, subscriptionTopic := range eventSubscriptionTopics {
+				if _, parked := parkedStateEventTopics.Get(subscriptionTopic); parked {
+					continue
+				}
+				if _, found := recordsBySubscriptionTopic[subscriptionTopic]; !found {
+					subscriptionTopics = append(subscriptionTopics, subscriptionTopic)
+				}
+				recordsBySubscriptionTopic[subscriptionTopic] = append(recordsBySubscriptionTopic[subscriptionTopic], record)
+			}
+		}
+		for _, topic := range topics {
+			if err := publishToKafka(topic, recordsByTopic[topic]); err != nil {
+				return err
+			}
+		}
+		for _, subscriptionTopic := range subscriptionTopics {
+			if err := publishToKafka(subscriptionTopic, recordsBySubscriptionTopic[subscriptionTopic]); err != nil {
+				parkedStateEventTopics.Set(subscriptionTopic, true, cache.DefaultExpiration)
+				log.Warningf("PublishStateEvents: parking subscription topic %s for %+v: %+v", subscriptionTopic, stateEventTopicParkDuration, err)
+			}
+		}
+		eventIds := []int64{}
+		for _, event := range events {
+			eventIds = append(eventIds, event.EventId)
+		}
+		if err := inst.DeletePublishedStateEvents(eventIds); err != nil {
+			return err
+		}
+	}
+}
+
+// PublishStateEvents publishes recorded state events to Kafka, in order, keyed by cluster name. Events are
+// removed from the backend only once Kafka acknowledges them on their KafkaTopics topic; an event failing to publish
+// is retried on the next run, along with all events following it. Delivery is therefore at-least-once: consumers may
+// see an event more than once, e.g. when a new leader publishes events it also recorded. Subscription topics are
+// best effort: a subscription topic failing to publish is skipped for stateEventTopicParkDuration, and misses the
+// events published meanwhile.
+func PublishStateEvents() {
+	if !inst.StateEventsEnabled() || !IsLeader() {
+		return
+	}
+	// This function is non re-entrant (it can only be running once at any point in time)
+	if !atomic.CompareAndSwapInt64(&stateEventsPublishEntrance, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt64(&stateEventsPublishEntrance, 0)
+
+	subscriptions, err := inst.ReadStateEventSubscriptions()
+	if err != nil {
+		return
+	}
+	if err := publishPendingStateEvents(subscriptions); err != nil {
+		log.Errorf("PublishStateEvents: %+v", err)
+	}
+}
+
+// ContinuousStateEventsPublishing publishes recorded state events every second
+func ContinuousStateEventsPublishing() {
+	if !inst.StateEventsEnabled() {
+		return
+	}
+	publishTick := time.Tick(time.Second)
+	for range publishTick {
+		PublishStateEvents()
+	}
+}
@@ -0,0 +1,217 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+// withKafkaRESTProxy points KafkaRESTProxyURL at given handler for the duration of given test
+func withKafkaRESTProxy(t *testing.T, handler http.HandlerFunc) {
+	server := httptest.NewServer(handler)
+	proxyURL := config.Config.KafkaRESTProxyURL
+	config.Config.KafkaRESTProxyURL = server.URL + "/"
+	t.Cleanup(func() {
+		server.Close()
+		config.Config.KafkaRESTProxyURL = proxyURL
+	})
+}
+
+func TestPublishToKafka(t *testing.T) {
+	records := []kafkaRecord{{Key: "mycluster", Value: "discovered"}, {Key: "mycluster", Value: "forgotten"}}
+	{
+		var path, contentType string
+		produceRequest := kafkaProduceRequest{}
+		withKafkaRESTProxy(t, func(w http.ResponseWriter, r *http.Request) {
+			path, contentType = r.URL.EscapedPath(), r.Header.Get("Content-Type")
+			json.NewDecoder(r.Body).Decode(&produceRequest)
+			w.Write([]byte(`{"offsets": [{"partition": 0, "offset": 7}, {"partition": 0, "offset": 8}]}`))
+		})
+		err := publishToKafka("orchestrator events", records)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(path, "/topics/orchestrator%20events")
+		test.S(t).ExpectEquals(contentType, "application/vnd.kafka.json.v2+json")
+		test.S(t).ExpectEquals(len(produceRequest.Records), 2)
+		test.S(t).ExpectEquals(produceRequest.Records[1].Key, "mycluster")
+		test.S(t).ExpectEquals(produceRequest.Records[1].Value, "forgotten")
+	}
+	{
+		withKafkaRESTProxy(t, func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"error_code": 40401, "message": "Topic not found."}`, http.StatusNotFound)
+		})
+		err := publishToKafka("no-such-topic", records)
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		// A record not acknowledged fails the whole publish
+		withKafkaRESTProxy(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"offsets": [{"partition": 0, "offset": 7}, {"partition": null, "offset": null, "error_code": 50002, "error": "Kafka error"}]}`))
+		})
+		err := publishToKafka("orchestrator-events", records)
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		withKafkaRESTProxy(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`not json`))
+		})
+		err := publishToKafka("orchestrator-events", records)
+		test.S(t).ExpectNotNil(err)
+	}
+}
+
+func TestDeletePublishedStateEvents(t *testing.T) {
+	withSQLiteBackend(t)
+	withKafkaRESTProxy(t, func(w http.ResponseWriter, r *http.Request) {})
+
+	instanceKey := inst.InstanceKey{Hostname: "events-host", Port: 3306}
+	for _, eventType := range []inst.StateEventType{inst.InstanceDiscoveredEvent, inst.InstanceForgottenEvent, inst.AnalysisRaisedEvent} {
+		test.S(t).ExpectNil(inst.RecordStateEvent(eventType, "mycluster", &instanceKey, nil))
+	}
+	events, err := inst.ReadPendingStateEvents(10)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(events), 3)
+
+	// An event with a lower id than the published ones, e.g. committed late, is kept
+	err = inst.DeletePublishedStateEvents([]int64{events[0].EventId, events[2].EventId})
+	test.S(t).ExpectNil(err)
+	pendingEvents, err := inst.ReadPendingStateEvents(10)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(pendingEvents), 1)
+	test.S(t).ExpectEquals(pendingEvents[0].EventId, events[1].EventId)
+
+	test.S(t).ExpectNil(inst.DeletePublishedStateEvents([]int64{}))
+}
+
+// withStateEventSubscriptions creates subscriptions of given names to topics of the same names
+func withStateEventSubscriptions(t *testing.T, clusterPattern string, names ...string) (subscriptions [](*inst.StateEventSubscription)) {
+	for _, name := range names {
+		subscription, err := inst.NewStateEventSubscription(name, name, clusterPattern, "", "", "test")
+		test.S(t).ExpectNil(err)
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions
+}
+
+func TestStateEventTopics(t *testing.T) {
+	kafkaTopics := config.Config.KafkaTopics
+	config.Config.KafkaTopics = map[string]string{"*": "orchestrator-events", string(inst.AnalysisRaisedEvent): "orchestrator-analysis"}
+	defer func() { config.Config.KafkaTopics = kafkaTopics }()
+
+	subscriptions := withStateEventSubscriptions(t, "^payments-", "payments-alerts", "orchestrator-events", "payments-alerts")
+	{
+		event := &inst.StateEvent{EventType: inst.InstanceDiscoveredEvent, ClusterName: "payments-main"}
+		topic, subscriptionTopics := stateEventTopics(event, subscriptions)
+		test.S(t).ExpectEquals(topic, "orchestrator-events")
+		test.S(t).ExpectEquals(len(subscriptionTopics), 1)
+		test.S(t).ExpectEquals(subscriptionTopics[0], "payments-alerts")
+	}
+	{
+		event := &inst.StateEvent{EventType: inst.AnalysisRaisedEvent, ClusterName: "payments-main"}
+		topic, subscriptionTopics := stateEventTopics(event, subscriptions)
+		test.S(t).ExpectEquals(topic, "orchestrator-analysis")
+		test.S(t).ExpectEquals(len(subscriptionTopics), 2)
+	}
+	{
+		event := &inst.StateEvent{EventType: inst.InstanceDiscoveredEvent, ClusterName: "billing-main"}
+		topic, subscriptionTopics := stateEventTopics(event, subscriptions)
+		test.S(t).ExpectEquals(topic, "orchestrator-events")
+		test.S(t).ExpectEquals(len(subscriptionTopics), 0)
+	}
+}
+
+func TestPublishPendingStateEvents(t *testing.T) {
+	withSQLiteBackend(t)
+	kafkaTopics := config.Config.KafkaTopics
+	config.Config.KafkaTopics = map[string]string{"*": "orchestrator-events"}
+	defer func() { config.Config.KafkaTopics = kafkaTopics }()
+	defer parkedStateEventTopics.Flush()
+
+	var mutex sync.Mutex
+	failingTopics := map[string]bool{"broken-topic": true}
+	recordsByTopic := map[string]int{}
+	attemptsByTopic := map[string]int{}
+	withKafkaRESTProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		topic := strings.TrimPrefix(r.URL.Path, "/topics/")
+		attemptsByTopic[topic]++
+		if failingTopics[topic] {
+			http.Error(w, `{"error_code": 40401, "message": "Topic not found."}`, http.StatusNotFound)
+			return
+		}
+		produceRequest := kafkaProduceRequest{}
+		json.NewDecoder(r.Body).Decode(&produceRequest)
+		recordsByTopic[topic] += len(produceRequest.Records)
+		w.Write([]byte(`{"offsets": []}`))
+	})
+	recordEvents := func(count int) {
+		instanceKey := inst.InstanceKey{Hostname: "events-host", Port: 3306}
+		for i := 0; i < count; i++ {
+			test.S(t).ExpectNil(inst.RecordStateEvent(inst.InstanceDiscoveredEvent, "payments-main", &instanceKey, nil))
+		}
+	}
+	pendingEventsCount := func() int {
+		events, err := inst.ReadPendingStateEvents(stateEventsPublishBatchSize)
+		test.S(t).ExpectNil(err)
+		return len(events)
+	}
+	subscriptions := withStateEventSubscriptions(t, "", "payments-alerts", "broken-topic")
+
+	// A failing subscription topic neither fails nor repeats the publishing
+	recordEvents(3)
+	test.S(t).ExpectNil(publishPendingStateEvents(subscriptions))
+	test.S(t).ExpectEquals(pendingEventsCount(), 0)
+	test.S(t).ExpectEquals(recordsByTopic["orchestrator-events"], 3)
+	test.S(t).ExpectEquals(recordsByTopic["payments-alerts"], 3)
+	test.S(t).ExpectEquals(attemptsByTopic["broken-topic"], 1)
+	_, parked := parkedStateEventTopics.Get("broken-topic")
+	test.S(t).ExpectTrue(parked)
+
+	// A parked topic is skipped
+	recordEvents(2)
+	test.S(t).ExpectNil(publishPendingStateEvents(subscriptions))
+	test.S(t).ExpectEquals(pendingEventsCount(), 0)
+	test.S(t).ExpectEquals(recordsByTopic["orchestrator-events"], 5)
+	test.S(t).ExpectEquals(recordsByTopic["payments-alerts"], 5)
+	test.S(t).ExpectEquals(attemptsByTopic["broken-topic"], 1)
+
+	// A failing KafkaTopics topic keeps the events for the next run
+	mutex.Lock()
+	failingTopics["orchestrator-events"] = true
+	mutex.Unlock()
+	recordEvents(2)
+	test.S(t).ExpectNotNil(publishPendingStateEvents(subscriptions))
+	test.S(t).ExpectEquals(pendingEventsCount(), 2)
+	test.S(t).ExpectEquals(recordsByTopic["payments-alerts"], 5)
+
+	mutex.Lock()
+	delete(failingTopics, "orchestrator-events")
+	mutex.Unlock()
+	test.S(t).ExpectNil(publishPendingStateEvents(subscriptions))
+	test.S(t).ExpectEquals(pendingEventsCount(), 0)
+	test.S(t).ExpectEquals(recordsByTopic["orchestrator-events"], 7)
+	test.S(t).ExpectEquals(recordsByTopic["payments-alerts"], 7)
+}
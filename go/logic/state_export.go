@@ -0,0 +1,142 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/github/orchestrator/go/inst"
+	"github.com/github/orchestrator/go/raft"
+
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+// ExportedState is a portable dump of orchestrator's operational metadata: known instances and the
+// data operators attach to clusters and instances. It is independent of the backend database and
+// of whether orchestrator runs standalone or in raft setup, and is used to migrate between deployments.
+// Instances are exported in minimal form; imported instances are rediscovered and get populated by polling.
+type ExportedState struct {
+	ExportedAt       string
+	MinimalInstances []inst.MinimalInstance
+	RecoveryDisabled bool
+
+	ClusterAlias,
+	ClusterAliasOverride,
+	ClusterDomainName,
+	HostAttributes,
+	PoolInstances,
+	PoolSpecs,
+	DowntimedInstances,
+	Candidates,
+	CandidateOverrides,
+	DesiredTopologies,
+	KVStore sqlutils.NamedResultData
+}
+
+// ExportState reads orchestrator's operational metadata into a portable dump
+func ExportState() (state *ExportedState, err error) {
+	state = &ExportedState{ExportedAt: time.Now().Format(time.RFC3339)}
+	if state.MinimalInstances, err = inst.ReadAllMinimalInstances(); err != nil {
+		return state, err
+	}
+	if state.RecoveryDisabled, err = IsRecoveryDisabled(); err != nil {
+		return state, err
+	}
+	tables := map[string]*sqlutils.NamedResultData{
+		"cluster_alias":                        &state.ClusterAlias,
+		"cluster_alias_override":               &state.ClusterAliasOverride,
+		"cluster_domain_name":                  &state.ClusterDomainName,
+		"host_attributes":                      &state.HostAttributes,
+		"database_instance_pool":               &state.PoolInstances,
+		"database_instance_pool_spec":          &state.PoolSpecs,
+		"database_instance_downtime":           &state.DowntimedInstances,
+		"candidate_database_instance":          &state.Candidates,
+		"candidate_database_instance_override": &state.CandidateOverrides,
+		"desired_cluster_topology":             &state.DesiredTopologies,
+		"kv_store":                             &state.KVStore,
+	}
+	for tableName, data := range tables {
+		if err := readTableData(tableName, data); err != nil {
+			return state, fmt.Errorf("ExportState: cannot read %s: %+v", tableName, err)
+		}
+	}
+	return state, nil
+}
+
+// applyImportedState writes an exported state onto the backend database. Existing entries are
+// overwritten by imported entries of same identity; other existing entries are retained.
+func applyImportedState(state *ExportedState) error {
+	existingKeys, err := inst.ReadAllInstanceKeys()
+	if err != nil {
+		return err
+	}
+	existingKeysMap := inst.NewInstanceKeyMap()
+	existingKeysMap.AddKeys(existingKeys)
+
+	importedInstances := 0
+	for _, minimalInstance := range state.MinimalInstances {
+		if existingKeysMap.HasKey(minimalInstance.Key) {
+			continue
+		}
+		if err := inst.WriteInstance(minimalInstance.ToInstance(), false, nil); err != nil {
+			return err
+		}
+		importedInstances++
+	}
+	tables := []struct {
+		tableName string
+		data      *sqlutils.NamedResultData
+	}{
+		{"cluster_alias", &state.ClusterAlias},
+		{"cluster_alias_override", &state.ClusterAliasOverride},
+		{"cluster_domain_name", &state.ClusterDomainName},
+		{"host_attributes", &state.HostAttributes},
+		{"database_instance_pool", &state.PoolInstances},
+		{"database_instance_pool_spec", &state.PoolSpecs},
+		{"database_instance_downtime", &state.DowntimedInstances},
+		{"candidate_database_instance", &state.Candidates},
+		{"candidate_database_instance_override", &state.CandidateOverrides},
+		{"desired_cluster_topology", &state.DesiredTopologies},
+		{"kv_store", &state.KVStore},
+	}
+	for _, table := range tables {
+		if len(table.data.Data) == 0 {
+			continue
+		}
+		if err := writeTableData(table.tableName, table.data); err != nil {
+			return fmt.Errorf("ImportState: cannot write %s: %+v", table.tableName, err)
+		}
+	}
+	if err := SetRecoveryDisabled(state.RecoveryDisabled); err != nil {
+		return err
+	}
+	inst.AuditOperation("import-state", nil, fmt.Sprintf("imported state exported at %s: %d new instances out of %d", state.ExportedAt, importedInstances, len(state.MinimalInstances)))
+	log.Infof("ImportState: imported %d new instances out of %d", importedInstances, len(state.MinimalInstances))
+	return nil
+}
+
+// ImportState applies an exported state onto this deployment. In raft setup the state is
+// applied on all raft members.
+func ImportState(state *ExportedState) error {
+	if orcraft.IsRaftEnabled() {
+		_, err := orcraft.PublishCommand("import-state", state)
+		return err
+	}
+	return applyImportedState(state)
+}
@@ -0,0 +1,125 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/openark/golib/log"
+)
+
+const (
+	minCatchUpPollInterval = time.Second
+	maxCatchUpPollInterval = 10 * time.Second
+)
+
+// waitForTakeoverCatchUp waits, up to GracefulTakeoverCatchUpTimeoutSeconds, for a lagging designated replica to
+// catch up to within ReasonableMaintenanceReplicationLagSeconds. The replica is polled at its predicted catch-up
+// time, within bounds. The wait is aborted early once the replica's lag history predicts it will not catch up in time,
+// or once the replica no longer replicates from given master.
+func waitForTakeoverCatchUp(designatedInstance *inst.Instance, masterKey *inst.InstanceKey) (*inst.Instance, error) {
+	timeout := time.Duration(config.Config.GracefulTakeoverCatchUpTimeoutSeconds) * time.Second
+	deadline := time.Now().Add(timeout)
+	targetLagSeconds := int64(config.Config.ReasonableMaintenanceReplicationLagSeconds)
+	inst.AuditOperation("graceful-master-takeover-catch-up", &designatedInstance.Key, fmt.Sprintf("waiting up to %+v for lag to be within %ds", timeout, targetLagSeconds))
+
+	instance := designatedInstance
+	for {
+		prediction := inst.PredictLagConvergence(&instance.Key, inst.ReadInstanceLagHistory(&instance.Key), targetLagSeconds, time.Now())
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			inst.AuditOperation("graceful-master-takeover-catch-up", &instance.Key, fmt.Sprintf("timed out: %s", prediction))
+			return instance, fmt.Errorf("GracefulMasterTakeover: designated instance did not catch up within %+v: %s", timeout, prediction)
+		}
+		if prediction.IsConfident && (!prediction.IsConverging || prediction.SecondsToCatchUp > remaining.Seconds()) {
+			inst.AuditOperation("graceful-master-takeover-catch-up", &instance.Key, fmt.Sprintf("aborted: %s", prediction))
+			return instance, fmt.Errorf("GracefulMasterTakeover: designated instance is not predicted to catch up within the remaining %.0fs: %s", remaining.Seconds(), prediction)
+		}
+		pollInterval := maxCatchUpPollInterval
+		if prediction.IsConverging && prediction.SecondsToCatchUp < pollInterval.Seconds() {
+			pollInterval = time.Duration(prediction.SecondsToCatchUp * float64(time.Second))
+		}
+		if pollInterval < minCatchUpPollInterval {
+			pollInterval = minCatchUpPollInterval
+		}
+		if pollInterval > remaining {
+			pollInterval = remaining
+		}
+		log.Infof("GracefulMasterTakeover: waiting for designated instance to catch up: %s", prediction)
+		time.Sleep(pollInterval)
+
+		refreshedInstance, err := inst.ReadTopologyInstance(&instance.Key)
+		if err != nil {
+			return instance, fmt.Errorf("GracefulMasterTakeover: cannot read designated instance %+v while waiting for it to catch up: %+v", instance.Key, err)
+		}
+		instance = refreshedInstance
+		if !instance.MasterKey.Equals(masterKey) {
+			inst.AuditOperation("graceful-master-takeover-catch-up", &instance.Key, fmt.Sprintf("aborted: now replicating from %+v", instance.MasterKey))
+			return instance, fmt.Errorf("GracefulMasterTakeover: designated instance %+v no longer replicates from %+v while waiting for it to catch up", instance.Key, *masterKey)
+		}
+		inst.RecordInstanceLag(instance)
+		if instance.HasReasonableMaintenanceReplicationLag() {
+			inst.AuditOperation("graceful-master-takeover-catch-up", &instance.Key, fmt.Sprintf("caught up: lag is %ds", instance.SecondsBehindMaster.Int64))
+			return instance, nil
+		}
+	}
+}
+
+// verifyTakeoverTopology verifies the cluster's master is still given master, and that the designated instance
+// still directly replicates from it. The topology may well have changed while waiting for the designated instance
+// to catch up.
+func verifyTakeoverTopology(clusterMaster *inst.Instance, clusterMasters [](*inst.Instance), directReplicas [](*inst.Instance), designatedInstance *inst.Instance) error {
+	if len(clusterMasters) != 1 {
+		return fmt.Errorf("GracefulMasterTakeover: found %d potential masters after waiting for %+v to catch up. Aborting", len(clusterMasters), designatedInstance.Key)
+	}
+	if !clusterMasters[0].Key.Equals(&clusterMaster.Key) {
+		return fmt.Errorf("GracefulMasterTakeover: cluster master changed from %+v to %+v while waiting for %+v to catch up. Aborting", clusterMaster.Key, clusterMasters[0].Key, designatedInstance.Key)
+	}
+	if !designatedInstance.MasterKey.Equals(&clusterMaster.Key) {
+		return fmt.Errorf("GracefulMasterTakeover: designated instance %+v no longer replicates from master %+v. Aborting", designatedInstance.Key, clusterMaster.Key)
+	}
+	for _, directReplica := range directReplicas {
+		if directReplica.Key.Equals(&designatedInstance.Key) {
+			return nil
+		}
+	}
+	return fmt.Errorf("GracefulMasterTakeover: designated instance %+v is no longer a direct replica of master %+v. Aborting", designatedInstance.Key, clusterMaster.Key)
+}
+
+// rereadTakeoverTopology re-reads the cluster's master and its direct replicas after waiting for the designated
+// instance to catch up, and verifies the takeover still applies to them.
+func rereadTakeoverTopology(clusterName string, clusterMaster *inst.Instance, designatedInstance *inst.Instance) (*inst.Instance, [](*inst.Instance), error) {
+	refreshedMaster, err := inst.ReadTopologyInstance(&clusterMaster.Key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("GracefulMasterTakeover: cannot read master %+v after waiting for %+v to catch up: %+v", clusterMaster.Key, designatedInstance.Key, err)
+	}
+	clusterMasters, err := inst.ReadClusterMaster(clusterName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Cannot deduce cluster master for %+v; error: %+v", clusterName, err)
+	}
+	directReplicas, err := inst.ReadReplicaInstances(&refreshedMaster.Key)
+	if err != nil {
+		return nil, nil, log.Errore(err)
+	}
+	if err := verifyTakeoverTopology(refreshedMaster, clusterMasters, directReplicas, designatedInstance); err != nil {
+		return nil, nil, err
+	}
+	return refreshedMaster, directReplicas, nil
+}
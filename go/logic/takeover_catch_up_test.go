@@ -0,0 +1,68 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"testing"
+
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+func TestVerifyTakeoverTopology(t *testing.T) {
+	newInstance := func(key inst.InstanceKey, masterKey inst.InstanceKey) *inst.Instance {
+		instance := inst.NewInstance()
+		instance.Key = key
+		instance.MasterKey = masterKey
+		return instance
+	}
+	masterKey := inst.InstanceKey{Hostname: "master", Port: 3306}
+	otherMasterKey := inst.InstanceKey{Hostname: "other-master", Port: 3306}
+	designatedKey := inst.InstanceKey{Hostname: "designated", Port: 3306}
+	siblingKey := inst.InstanceKey{Hostname: "sibling", Port: 3306}
+
+	master := newInstance(masterKey, inst.InstanceKey{})
+	designated := newInstance(designatedKey, masterKey)
+	sibling := newInstance(siblingKey, masterKey)
+	{
+		err := verifyTakeoverTopology(master, [](*inst.Instance){master}, [](*inst.Instance){designated, sibling}, designated)
+		test.S(t).ExpectNil(err)
+	}
+	{
+		// Master was replaced while waiting
+		otherMaster := newInstance(otherMasterKey, inst.InstanceKey{})
+		err := verifyTakeoverTopology(master, [](*inst.Instance){otherMaster}, [](*inst.Instance){designated, sibling}, designated)
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		// Co-masters, or a split cluster
+		otherMaster := newInstance(otherMasterKey, inst.InstanceKey{})
+		err := verifyTakeoverTopology(master, [](*inst.Instance){master, otherMaster}, [](*inst.Instance){designated, sibling}, designated)
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		// Designated instance was moved below its sibling
+		moved := newInstance(designatedKey, siblingKey)
+		err := verifyTakeoverTopology(master, [](*inst.Instance){master}, [](*inst.Instance){sibling}, moved)
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		// Backend does not list the designated instance as a direct replica
+		err := verifyTakeoverTopology(master, [](*inst.Instance){master}, [](*inst.Instance){sibling}, designated)
+		test.S(t).ExpectNotNil(err)
+	}
+}
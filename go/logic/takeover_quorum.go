@@ -0,0 +1,110 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+)
+
+// UnhealthyQuorumReplica is a replica which does not count towards a graceful takeover's replica quorum
+type UnhealthyQuorumReplica struct {
+	Key    inst.InstanceKey
+	Reason string
+}
+
+// ReplicaQuorumCheck is the verification of a cluster's replica quorum prior to a graceful takeover: the replicas
+// which are to remain usable once the designated instance is promoted.
+type ReplicaQuorumCheck struct {
+	ClusterName        string
+	DesignatedKey      inst.InstanceKey
+	MinHealthyReplicas uint
+	MaxLagSeconds      uint
+	HealthyReplicas    []inst.InstanceKey
+	UnhealthyReplicas  []UnhealthyQuorumReplica
+	HasQuorum          bool
+}
+
+// Report describes the outcome of the check, listing the replicas not counting towards the quorum
+func (this *ReplicaQuorumCheck) Report() string {
+	unhealthy := []string{}
+	for _, replica := range this.UnhealthyReplicas {
+		unhealthy = append(unhealthy, fmt.Sprintf("%s: %s", replica.Key.DisplayString(), replica.Reason))
+	}
+	return fmt.Sprintf("cluster %s: %d healthy replicas (lag up to %ds) would remain after promoting %s; required: %d. Unhealthy replicas: [%s]",
+		this.ClusterName, len(this.HealthyReplicas), this.MaxLagSeconds, this.DesignatedKey.DisplayString(), this.MinHealthyReplicas, strings.Join(unhealthy, "; "))
+}
+
+// quorumReplicaUnhealthyReason returns the reason a replica does not count towards the quorum, or an empty string
+// if it is healthy
+func quorumReplicaUnhealthyReason(replica *inst.Instance, maxLagSeconds uint) string {
+	if !replica.IsLastCheckValid {
+		return "last check invalid"
+	}
+	if replica.IsDowntimed {
+		return "downtimed"
+	}
+	if !replica.ReplicaRunning() {
+		return "replication not running"
+	}
+	if !replica.SlaveLagSeconds.Valid {
+		return "unknown lag"
+	}
+	if replica.SlaveLagSeconds.Int64 > int64(maxLagSeconds) {
+		return fmt.Sprintf("lagging %ds", replica.SlaveLagSeconds.Int64)
+	}
+	return ""
+}
+
+// CheckGracefulTakeoverReplicaQuorum verifies that, once the designated instance is promoted in place of the master,
+// the cluster has GracefulTakeoverReplicaQuorums healthy replicas. Neither the master nor the designated instance count
+// towards the quorum. A cluster with no configured quorum always has quorum.
+func CheckGracefulTakeoverReplicaQuorum(clusterName string, clusterMaster *inst.Instance, designatedInstance *inst.Instance) (*ReplicaQuorumCheck, error) {
+	clusterAlias, _ := inst.ReadAliasByClusterName(clusterName)
+	replicaQuorum := config.Config.GetGracefulTakeoverReplicaQuorum(clusterName, clusterAlias)
+	quorumCheck := &ReplicaQuorumCheck{
+		ClusterName:        clusterName,
+		DesignatedKey:      designatedInstance.Key,
+		MinHealthyReplicas: replicaQuorum.MinHealthyReplicas,
+		MaxLagSeconds:      replicaQuorum.MaxLagSeconds,
+		HealthyReplicas:    []inst.InstanceKey{},
+		UnhealthyReplicas:  []UnhealthyQuorumReplica{},
+		HasQuorum:          true,
+	}
+	if replicaQuorum.MinHealthyReplicas == 0 {
+		return quorumCheck, nil
+	}
+	instances, err := inst.ReadClusterInstances(clusterName)
+	if err != nil {
+		return quorumCheck, err
+	}
+	for _, instance := range instances {
+		if instance.Key.Equals(&clusterMaster.Key) || instance.Key.Equals(&designatedInstance.Key) {
+			continue
+		}
+		if reason := quorumReplicaUnhealthyReason(instance, replicaQuorum.MaxLagSeconds); reason != "" {
+			quorumCheck.UnhealthyReplicas = append(quorumCheck.UnhealthyReplicas, UnhealthyQuorumReplica{Key: instance.Key, Reason: reason})
+			continue
+		}
+		quorumCheck.HealthyReplicas = append(quorumCheck.HealthyReplicas, instance.Key)
+	}
+	quorumCheck.HasQuorum = len(quorumCheck.HealthyReplicas) >= int(replicaQuorum.MinHealthyReplicas)
+	return quorumCheck, nil
+}
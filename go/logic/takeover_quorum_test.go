@@ -0,0 +1,63 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+func TestQuorumReplicaUnhealthyReason(t *testing.T) {
+	newReplica := func(lagSeconds int64) *inst.Instance {
+		replica := inst.NewInstance()
+		replica.Key = inst.InstanceKey{Hostname: "db-2", Port: 3306}
+		replica.MasterKey = inst.InstanceKey{Hostname: "db-1", Port: 3306}
+		replica.ReadBinlogCoordinates = inst.BinlogCoordinates{LogFile: "mysql-bin.000001", LogPos: 4}
+		replica.Slave_SQL_Running = true
+		replica.Slave_IO_Running = true
+		replica.SlaveLagSeconds = sql.NullInt64{Int64: lagSeconds, Valid: true}
+		replica.IsLastCheckValid = true
+		return replica
+	}
+	test.S(t).ExpectEquals(quorumReplicaUnhealthyReason(newReplica(0), 10), "")
+	test.S(t).ExpectEquals(quorumReplicaUnhealthyReason(newReplica(10), 10), "")
+	test.S(t).ExpectEquals(quorumReplicaUnhealthyReason(newReplica(11), 10), "lagging 11s")
+
+	invalid := newReplica(0)
+	invalid.IsLastCheckValid = false
+	invalid.IsDowntimed = true
+	test.S(t).ExpectEquals(quorumReplicaUnhealthyReason(invalid, 10), "last check invalid")
+
+	downtimed := newReplica(0)
+	downtimed.IsDowntimed = true
+	test.S(t).ExpectEquals(quorumReplicaUnhealthyReason(downtimed, 10), "downtimed")
+
+	stopped := newReplica(0)
+	stopped.Slave_IO_Running = false
+	test.S(t).ExpectEquals(quorumReplicaUnhealthyReason(stopped, 10), "replication not running")
+
+	master := newReplica(0)
+	master.MasterKey = inst.InstanceKey{}
+	test.S(t).ExpectEquals(quorumReplicaUnhealthyReason(master, 10), "replication not running")
+
+	unknownLag := newReplica(0)
+	unknownLag.SlaveLagSeconds = sql.NullInt64{}
+	test.S(t).ExpectEquals(quorumReplicaUnhealthyReason(unknownLag, 10), "unknown lag")
+}
@@ -0,0 +1,295 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/github/orchestrator/go/raft"
+	"github.com/openark/golib/log"
+)
+
+type DesiredTopology string
+
+const (
+	NoDesiredTopology                      DesiredTopology = ""
+	FlatDesiredTopology                    DesiredTopology = "flat"
+	IntermediateMasterPerDCDesiredTopology DesiredTopology = "intermediate-master-per-dc"
+)
+
+// ParseDesiredTopology validates a desired topology shape name
+func ParseDesiredTopology(desiredTopologyName string) (DesiredTopology, error) {
+	switch desiredTopology := DesiredTopology(desiredTopologyName); desiredTopology {
+	case NoDesiredTopology, FlatDesiredTopology, IntermediateMasterPerDCDesiredTopology:
+		return desiredTopology, nil
+	}
+	return NoDesiredTopology, fmt.Errorf("Unknown desired topology: %s", desiredTopologyName)
+}
+
+// ClusterDesiredTopology is a declaration of a cluster's desired topology, kept by cluster alias
+type ClusterDesiredTopology struct {
+	ClusterAlias    string
+	DesiredTopology DesiredTopology
+}
+
+// TopologyDrift describes a single instance which is not positioned in the topology as desired
+type TopologyDrift struct {
+	Key               inst.InstanceKey
+	CurrentMasterKey  inst.InstanceKey
+	ExpectedMasterKey inst.InstanceKey
+}
+
+// TopologyConformance is the result of evaluating a cluster against its desired topology
+type TopologyConformance struct {
+	ClusterName     string
+	DesiredTopology DesiredTopology
+	Conforms        bool
+	Drift           []TopologyDrift
+	EvaluatedAt     time.Time
+}
+
+// convergingClusters are the aliases of clusters whose topology is being converged, such that a cluster is only
+// converged once at any point in time
+var convergingClusters sync.Map
+
+// SetClusterDesiredTopology declares (or, given empty desired topology, clears) a cluster's desired topology, overriding
+// configuration. The declaration is kept by cluster alias, so that it survives failovers.
+func SetClusterDesiredTopology(clusterAlias string, desiredTopology DesiredTopology) error {
+	if orcraft.IsRaftEnabled() {
+		_, err := orcraft.PublishCommand("set-desired-topology", ClusterDesiredTopology{ClusterAlias: clusterAlias, DesiredTopology: desiredTopology})
+		return err
+	}
+	return inst.WriteClusterDesiredTopology(clusterAlias, string(desiredTopology))
+}
+
+// GetClusterDesiredTopology returns the desired topology of a cluster: as declared via API, or else as configured
+func GetClusterDesiredTopology(clusterName string) (DesiredTopology, error) {
+	clusterAlias, err := inst.ReadAliasByClusterName(clusterName)
+	if err != nil {
+		return NoDesiredTopology, err
+	}
+	desiredTopologyName, err := inst.ReadClusterDesiredTopology(clusterAlias)
+	if err != nil {
+		return NoDesiredTopology, err
+	}
+	if desiredTopologyName == "" {
+		desiredTopologyName = config.Config.GetDesiredTopology(clusterName, clusterAlias)
+	}
+	return ParseDesiredTopology(desiredTopologyName)
+}
+
+// computeTopologyDrift lists instances which are not replicating from their expected master per the desired topology.
+// Drift of intermediate masters is listed before drift of their replicas, such that drift can be fixed in order.
+func computeTopologyDrift(desiredTopology DesiredTopology, master *inst.Instance, instances [](*inst.Instance)) (drift []TopologyDrift) {
+	drift = []TopologyDrift{}
+	replicas := [](*inst.Instance){}
+	for _, instance := range instances {
+		if instance.Key.Equals(&master.Key) || master.MasterKey.Equals(&instance.Key) {
+			// the master itself, or a co-master
+			continue
+		}
+		replicas = append(replicas, instance)
+	}
+	sort.Slice(replicas, func(i, j int) bool {
+		return replicas[i].Key.StringCode() < replicas[j].Key.StringCode()
+	})
+	expectMaster := func(instance *inst.Instance, expectedMasterKey inst.InstanceKey) {
+		if !instance.MasterKey.Equals(&expectedMasterKey) {
+			drift = append(drift, TopologyDrift{Key: instance.Key, CurrentMasterKey: instance.MasterKey, ExpectedMasterKey: expectedMasterKey})
+		}
+	}
+	switch desiredTopology {
+	case FlatDesiredTopology:
+		for _, replica := range replicas {
+			expectMaster(replica, master.Key)
+		}
+	case IntermediateMasterPerDCDesiredTopology:
+		dataCenters := []string{}
+		replicasByDC := make(map[string][](*inst.Instance))
+		for _, replica := range replicas {
+			if _, found := replicasByDC[replica.DataCenter]; !found {
+				dataCenters = append(dataCenters, replica.DataCenter)
+			}
+			replicasByDC[replica.DataCenter] = append(replicasByDC[replica.DataCenter], replica)
+		}
+		for _, dataCenter := range dataCenters {
+			dcReplicas := replicasByDC[dataCenter]
+			if dataCenter == master.DataCenter {
+				for _, replica := range dcReplicas {
+					expectMaster(replica, master.Key)
+				}
+				continue
+			}
+			// Existing direct replica of the master is preferred as the DC's intermediate master
+			var intermediateMaster *inst.Instance
+			for _, replica := range dcReplicas {
+				if replica.MasterKey.Equals(&master.Key) {
+					intermediateMaster = replica
+					break
+				}
+			}
+			if intermediateMaster == nil {
+				for _, replica := range dcReplicas {
+					if !inst.IsBannedFromBeingCandidateReplica(replica) {
+						intermediateMaster = replica
+						break
+					}
+				}
+			}
+			if intermediateMaster == nil {
+				intermediateMaster = dcReplicas[0]
+			}
+			expectMaster(intermediateMaster, master.Key)
+			for _, replica := range dcReplicas {
+				if !replica.Key.Equals(&intermediateMaster.Key) {
+					expectMaster(replica, intermediateMaster.Key)
+				}
+			}
+		}
+	}
+	return drift
+}
+
+// EvaluateTopologyConformance evaluates a cluster against its desired topology
+func EvaluateTopologyConformance(clusterName string) (*TopologyConformance, error) {
+	desiredTopology, err := GetClusterDesiredTopology(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	conformance := &TopologyConformance{
+		ClusterName:     clusterName,
+		DesiredTopology: desiredTopology,
+		Conforms:        true,
+		Drift:           []TopologyDrift{},
+		EvaluatedAt:     time.Now(),
+	}
+	if desiredTopology == NoDesiredTopology {
+		return conformance, nil
+	}
+	masters, err := inst.ReadClusterMaster(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	if len(masters) != 1 {
+		return nil, fmt.Errorf("EvaluateTopologyConformance: expected a single master for %s; found %d", clusterName, len(masters))
+	}
+	instances, err := inst.ReadClusterInstances(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	conformance.Drift = computeTopologyDrift(desiredTopology, masters[0], instances)
+	conformance.Conforms = (len(conformance.Drift) == 0)
+	return conformance, nil
+}
+
+// ConvergeTopology relocates drifting instances of a cluster onto their expected masters. Instances which are downtimed
+// or not healthy are skipped. A cluster already being converged is not converged again concurrently.
+func ConvergeTopology(clusterName string) (relocated [](*inst.Instance), conformance *TopologyConformance, err error) {
+	relocated = [](*inst.Instance){}
+	clusterAlias, err := inst.ReadAliasByClusterName(clusterName)
+	if err != nil {
+		return relocated, conformance, err
+	}
+	if _, converging := convergingClusters.LoadOrStore(clusterAlias, true); converging {
+		return relocated, conformance, fmt.Errorf("ConvergeTopology: cluster %s is already being converged", clusterAlias)
+	}
+	defer convergingClusters.Delete(clusterAlias)
+
+	conformance, err = EvaluateTopologyConformance(clusterName)
+	if err != nil {
+		return relocated, conformance, err
+	}
+	errs := []error{}
+	for _, drift := range conformance.Drift {
+		instance, found, err := inst.ReadInstance(&drift.Key)
+		if err != nil || !found {
+			continue
+		}
+		if instance.IsDowntimed || !instance.IsLastCheckValid {
+			log.Debugf("ConvergeTopology: skipping %+v", instance.Key)
+			continue
+		}
+		instance, err = inst.RelocateBelow(&drift.Key, &drift.ExpectedMasterKey)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		relocated = append(relocated, instance)
+	}
+	inst.AuditOperation("converge-topology", nil, fmt.Sprintf("cluster %s: desired topology %s; relocated %d out of %d drifting instances", clusterName, conformance.DesiredTopology, len(relocated), len(conformance.Drift)))
+	if len(errs) > 0 {
+		return relocated, conformance, fmt.Errorf("ConvergeTopology: %d relocations failed; first error: %+v", len(errs), errs[0])
+	}
+	return relocated, conformance, nil
+}
+
+// checkTopologyAutoConvergence returns an error when a cluster is not to be converged automatically: it is locked,
+// under recovery (or within the recovery's block period), or has an in-progress schema migration suppressing topology
+// relocations. A failure to read any of these also prevents convergence.
+func checkTopologyAutoConvergence(clusterName string, clusterAlias string) error {
+	if isSuppressedBySchemaMigration(clusterAlias, inst.SuppressTopologyRelocations) {
+		return fmt.Errorf("topology relocations are suppressed by a schema migration")
+	}
+	if err := inst.CheckClusterLock(clusterAlias, ""); err != nil {
+		return err
+	}
+	recoveries, err := ReadInActivePeriodClusterRecovery(clusterName)
+	if err != nil {
+		return err
+	}
+	if len(recoveries) > 0 {
+		return fmt.Errorf("cluster is under recovery: %s", recoveries[0].UID)
+	}
+	return nil
+}
+
+// CheckTopologiesConformance evaluates all clusters which have a desired topology, reports drift, and, if configured, converges them
+// on the leader. Clusters which are locked, under recovery, or with an in-progress schema migration suppressing topology
+// relocations are not converged.
+func CheckTopologiesConformance() {
+	clustersInfo, err := inst.ReadClustersInfo("")
+	if err != nil {
+		log.Errore(err)
+		return
+	}
+	for _, clusterInfo := range clustersInfo {
+		conformance, err := EvaluateTopologyConformance(clusterInfo.ClusterName)
+		if err != nil {
+			log.Errore(err)
+			continue
+		}
+		if conformance.Conforms {
+			continue
+		}
+		log.Warningf("Cluster %s drifts from its desired topology %s: %d instances not replicating from their expected master", conformance.ClusterName, conformance.DesiredTopology, len(conformance.Drift))
+		if !config.Config.DesiredTopologyAutoConverge || !IsLeader() {
+			continue
+		}
+		if err := checkTopologyAutoConvergence(clusterInfo.ClusterName, clusterInfo.ClusterAlias); err != nil {
+			log.Debugf("CheckTopologiesConformance: not converging cluster %s: %+v", clusterInfo.ClusterName, err)
+			continue
+		}
+		if _, _, err := ConvergeTopology(clusterInfo.ClusterName); err != nil {
+			log.Errore(err)
+		}
+	}
+}
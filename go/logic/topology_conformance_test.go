@@ -0,0 +1,152 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+func newConformanceInstance(hostname string, masterHostname string, dataCenter string) *inst.Instance {
+	instance := inst.NewInstance()
+	instance.Key = inst.InstanceKey{Hostname: hostname, Port: 3306}
+	if masterHostname != "" {
+		instance.MasterKey = inst.InstanceKey{Hostname: masterHostname, Port: 3306}
+	}
+	instance.DataCenter = dataCenter
+	return instance
+}
+
+// describeTopologyDrift lists drift as comma delimited "instance>expected master" hostnames
+func describeTopologyDrift(drift []TopologyDrift) string {
+	descriptions := []string{}
+	for _, instanceDrift := range drift {
+		descriptions = append(descriptions, instanceDrift.Key.Hostname+">"+instanceDrift.ExpectedMasterKey.Hostname)
+	}
+	return strings.Join(descriptions, ",")
+}
+
+func TestComputeTopologyDriftFlat(t *testing.T) {
+	master := newConformanceInstance("db-1", "db-0", "east")
+	instances := [](*inst.Instance){
+		master,
+		newConformanceInstance("db-0", "db-1", "east"),
+		newConformanceInstance("db-3", "db-2", "west"),
+		newConformanceInstance("db-2", "db-1", "east"),
+		newConformanceInstance("db-4", "db-3", "west"),
+	}
+	// The co-master is not expected to replicate from the master
+	test.S(t).ExpectEquals(describeTopologyDrift(computeTopologyDrift(FlatDesiredTopology, master, instances)), "db-3>db-1,db-4>db-1")
+	test.S(t).ExpectEquals(len(computeTopologyDrift(NoDesiredTopology, master, instances)), 0)
+	test.S(t).ExpectEquals(len(computeTopologyDrift(FlatDesiredTopology, master, instances[:2])), 0)
+}
+
+func TestComputeTopologyDriftIntermediateMasterPerDC(t *testing.T) {
+	master := newConformanceInstance("db-1", "", "east")
+	bannedReplica := newConformanceInstance("db-north-1", "db-east-1", "north")
+	bannedReplica.PromotionRule = inst.MustNotPromoteRule
+	instances := [](*inst.Instance){
+		master,
+		// replicas in the master's data center replicate from the master
+		newConformanceInstance("db-east-1", "db-1", "east"),
+		newConformanceInstance("db-east-2", "db-east-1", "east"),
+		// an existing direct replica of the master is preferred as intermediate master
+		newConformanceInstance("db-west-1", "db-1", "west"),
+		newConformanceInstance("db-west-2", "db-west-3", "west"),
+		newConformanceInstance("db-west-3", "db-1", "west"),
+		// lacking one, the first replica which is not banned from promotion is elected
+		bannedReplica,
+		newConformanceInstance("db-north-2", "db-east-1", "north"),
+		newConformanceInstance("db-north-3", "db-east-1", "north"),
+	}
+	drift := computeTopologyDrift(IntermediateMasterPerDCDesiredTopology, master, instances)
+	test.S(t).ExpectEquals(describeTopologyDrift(drift), "db-east-2>db-1,db-north-2>db-1,db-north-1>db-north-2,db-north-3>db-north-2,db-west-2>db-west-1,db-west-3>db-west-1")
+	test.S(t).ExpectTrue(drift[1].CurrentMasterKey.Equals(&inst.InstanceKey{Hostname: "db-east-1", Port: 3306}))
+}
+
+func TestClusterDesiredTopologyByAlias(t *testing.T) {
+	withSQLiteBackend(t)
+
+	test.S(t).ExpectNil(inst.SetClusterAlias("db-1:3306", "orders"))
+	test.S(t).ExpectNil(SetClusterDesiredTopology("orders", FlatDesiredTopology))
+	desiredTopology, err := GetClusterDesiredTopology("db-1:3306")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(desiredTopology, FlatDesiredTopology)
+
+	// A failover renames the cluster after its new master; the desired topology is kept
+	test.S(t).ExpectNil(inst.SetClusterAlias("db-2:3306", "orders"))
+	desiredTopology, err = GetClusterDesiredTopology("db-2:3306")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(desiredTopology, FlatDesiredTopology)
+
+	test.S(t).ExpectNil(SetClusterDesiredTopology("orders", NoDesiredTopology))
+	desiredTopology, err = GetClusterDesiredTopology("db-2:3306")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(desiredTopology, NoDesiredTopology)
+}
+
+func TestConvergeTopology(t *testing.T) {
+	withSQLiteBackend(t)
+
+	masterKey := inst.InstanceKey{Hostname: "db-1", Port: 3306}
+	replicaKey := inst.InstanceKey{Hostname: "db-2", Port: 3306}
+	nestedReplicaKey := inst.InstanceKey{Hostname: "db-3", Port: 3306}
+	writeTestInstance(t, masterKey, inst.InstanceKey{}, "db-1:3306")
+	writeTestInstance(t, replicaKey, masterKey, "db-1:3306")
+	writeTestInstance(t, nestedReplicaKey, replicaKey, "db-1:3306")
+	test.S(t).ExpectNil(inst.SetClusterAlias("db-1:3306", "orders"))
+	test.S(t).ExpectNil(SetClusterDesiredTopology("orders", FlatDesiredTopology))
+
+	_, err := db.ExecOrchestrator(`update database_instance set replication_depth = 1 where hostname = ?`, replicaKey.Hostname)
+	test.S(t).ExpectNil(err)
+	// The drifting replica is not healthy, and so is not relocated
+	_, err = db.ExecOrchestrator(`update database_instance set replication_depth = 2, last_seen = now() - interval 1 hour where hostname = ?`, nestedReplicaKey.Hostname)
+	test.S(t).ExpectNil(err)
+	relocated, conformance, err := ConvergeTopology("db-1:3306")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(relocated), 0)
+	test.S(t).ExpectFalse(conformance.Conforms)
+	test.S(t).ExpectEquals(describeTopologyDrift(conformance.Drift), "db-3>db-1")
+
+	// A cluster is only converged once at a time
+	convergingClusters.Store("orders", true)
+	_, _, err = ConvergeTopology("db-1:3306")
+	test.S(t).ExpectNotNil(err)
+	convergingClusters.Delete("orders")
+	_, _, err = ConvergeTopology("db-1:3306")
+	test.S(t).ExpectNil(err)
+}
+
+func TestCheckTopologyAutoConvergence(t *testing.T) {
+	withSQLiteBackend(t)
+
+	test.S(t).ExpectNil(checkTopologyAutoConvergence("db-1:3306", "orders"))
+
+	test.S(t).ExpectNil(inst.WriteClusterLock(inst.NewClusterLock("db-1:3306", "orders", "ops", "maintenance", 600)))
+	test.S(t).ExpectNotNil(checkTopologyAutoConvergence("db-1:3306", "orders"))
+	// The lock outlives a failover, which renames the cluster
+	test.S(t).ExpectNotNil(checkTopologyAutoConvergence("db-2:3306", "orders"))
+	test.S(t).ExpectNil(inst.DeleteClusterLock("orders"))
+	test.S(t).ExpectNil(checkTopologyAutoConvergence("db-1:3306", "orders"))
+
+	writeTestActiveRecovery(t, inst.InstanceKey{Hostname: "fenced-master", Port: 3306}, inst.DeadMaster, "fenced")
+	test.S(t).ExpectNotNil(checkTopologyAutoConvergence("fenced-master:3306", "fenced"))
+}
@@ -0,0 +1,110 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+
+	"github.com/github/orchestrator/go/inst"
+	orcraft "github.com/github/orchestrator/go/raft"
+)
+
+// SetInstanceNote attaches a note, and optionally a runbook URL, to an instance. Notes are replicated via raft.
+func SetInstanceNote(instanceKey *inst.InstanceKey, note string, runbookURL string, owner string) (*inst.InstanceNote, error) {
+	if err := inst.ValidateRunbookURL(runbookURL); err != nil {
+		return nil, err
+	}
+	instanceNote := inst.NewInstanceNote(instanceKey, note, runbookURL, owner)
+	if orcraft.IsRaftEnabled() {
+		_, err := orcraft.PublishCommand("set-instance-note", instanceNote)
+		return instanceNote, err
+	}
+	return instanceNote, inst.WriteInstanceNote(instanceNote)
+}
+
+// ClearInstanceNote removes the note of an instance
+func ClearInstanceNote(instanceKey *inst.InstanceKey) error {
+	if orcraft.IsRaftEnabled() {
+		_, err := orcraft.PublishCommand("clear-instance-note", instanceKey)
+		return err
+	}
+	return inst.DeleteInstanceNote(instanceKey)
+}
+
+// SetClusterNote attaches a note, and optionally a runbook URL, to cluster of given alias
+func SetClusterNote(clusterAlias string, note string, runbookURL string, owner string) (*inst.ClusterNote, error) {
+	if err := inst.ValidateRunbookURL(runbookURL); err != nil {
+		return nil, err
+	}
+	clusterNote := inst.NewClusterNote(clusterAlias, note, runbookURL, owner)
+	if orcraft.IsRaftEnabled() {
+		_, err := orcraft.PublishCommand("set-cluster-note", clusterNote)
+		return clusterNote, err
+	}
+	return clusterNote, inst.WriteClusterNote(clusterNote)
+}
+
+// ClearClusterNote removes the note of cluster of given alias
+func ClearClusterNote(clusterAlias string) error {
+	if orcraft.IsRaftEnabled() {
+		_, err := orcraft.PublishCommand("clear-cluster-note", clusterAlias)
+		return err
+	}
+	return inst.DeleteClusterNote(clusterAlias)
+}
+
+// notesEnvironmentVariables exposes the notes of an analyzed instance and of its cluster to hooks, such that
+// on-call sees instructions such as "requires manual DNS change; see runbook" along with the failure
+func notesEnvironmentVariables(analysisEntry *inst.ReplicationAnalysis) (env []string) {
+	instanceNote, clusterNote := readAnalysisNotes(analysisEntry)
+	if instanceNote != nil {
+		env = append(env, fmt.Sprintf("ORC_FAILED_INSTANCE_NOTE=%s", instanceNote.Note))
+		env = append(env, fmt.Sprintf("ORC_FAILED_INSTANCE_RUNBOOK_URL=%s", instanceNote.RunbookURL))
+	}
+	if clusterNote != nil {
+		env = append(env, fmt.Sprintf("ORC_CLUSTER_NOTE=%s", clusterNote.Note))
+		env = append(env, fmt.Sprintf("ORC_CLUSTER_RUNBOOK_URL=%s", clusterNote.RunbookURL))
+	}
+	return env
+}
+
+// readAnalysisNotes reads the notes of an analyzed instance and of its cluster; either is nil when there is none
+func readAnalysisNotes(analysisEntry *inst.ReplicationAnalysis) (instanceNote *inst.InstanceNote, clusterNote *inst.ClusterNote) {
+	if note, err := inst.ReadInstanceNote(&analysisEntry.AnalyzedInstanceKey); err == nil {
+		instanceNote = note
+	}
+	clusterAlias := analysisEntry.ClusterDetails.ClusterAlias
+	if clusterAlias == "" {
+		clusterAlias = analysisEntry.ClusterDetails.ClusterName
+	}
+	if note, err := inst.ReadClusterNote(clusterAlias); err == nil {
+		clusterNote = note
+	}
+	return instanceNote, clusterNote
+}
+
+// GetClusterNoteAlias returns the alias by which notes of given cluster are kept: its alias, or lacking one, its name
+func GetClusterNoteAlias(clusterName string) (string, error) {
+	clusterInfo, err := inst.ReadClusterInfo(clusterName)
+	if err != nil {
+		return "", err
+	}
+	if clusterInfo.ClusterAlias == "" {
+		return clusterName, nil
+	}
+	return clusterInfo.ClusterAlias, nil
+}
@@ -0,0 +1,132 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/openark/golib/log"
+)
+
+var topologyPrivilegesDeficiencies = make(map[inst.InstanceKey]*inst.TopologyPrivilegesCheck)
+var topologyPrivilegesDeficienciesMutex sync.Mutex
+var topologyPrivilegesCheckEntrance int64
+var lastTopologyPrivilegesCheckTime time.Time
+
+// CheckTopologyPrivileges checks the topology user's privileges on all valid instances, once every
+// TopologyPrivilegesCheckIntervalMinutes; the first check runs upon startup. Instances newly found to be
+// missing privileges are audited.
+func CheckTopologyPrivileges() {
+	if config.Config.TopologyPrivilegesCheckIntervalMinutes == 0 {
+		return
+	}
+	// This function is non re-entrant (it can only be running once at any point in time)
+	if !atomic.CompareAndSwapInt64(&topologyPrivilegesCheckEntrance, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt64(&topologyPrivilegesCheckEntrance, 0)
+
+	if time.Since(lastTopologyPrivilegesCheckTime) < time.Duration(config.Config.TopologyPrivilegesCheckIntervalMinutes)*time.Minute {
+		return
+	}
+	lastTopologyPrivilegesCheckTime = time.Now()
+
+	instanceKeys, err := inst.ReadAllInstanceKeys()
+	if err != nil {
+		log.Errore(err)
+		return
+	}
+	deficiencies := make(map[inst.InstanceKey]*inst.TopologyPrivilegesCheck)
+	for _, instanceKey := range instanceKeys {
+		instance, found, err := inst.ReadInstance(&instanceKey)
+		if err != nil || !found || !instance.IsLastCheckValid {
+			continue
+		}
+		check, err := inst.CheckTopologyPrivileges(instance)
+		if err != nil {
+			continue
+		}
+		if check.IsDeficient() {
+			deficiencies[instanceKey] = check
+		}
+	}
+
+	topologyPrivilegesDeficienciesMutex.Lock()
+	previousDeficiencies := topologyPrivilegesDeficiencies
+	topologyPrivilegesDeficiencies = deficiencies
+	topologyPrivilegesDeficienciesMutex.Unlock()
+
+	for instanceKey, check := range deficiencies {
+		if _, found := previousDeficiencies[instanceKey]; found {
+			continue
+		}
+		inst.AuditOperation("missing-topology-privileges", &check.InstanceKey, strings.Join(check.GrantStatements, " "))
+	}
+}
+
+// ReadTopologyPrivilegesDeficiencies returns the instances found by the latest check to be missing privileges
+func ReadTopologyPrivilegesDeficiencies() []*inst.TopologyPrivilegesCheck {
+	topologyPrivilegesDeficienciesMutex.Lock()
+	defer topologyPrivilegesDeficienciesMutex.Unlock()
+
+	deficiencies := []*inst.TopologyPrivilegesCheck{}
+	for _, check := range topologyPrivilegesDeficiencies {
+		deficiencies = append(deficiencies, check)
+	}
+	return deficiencies
+}
+
+// AddTopologyPrivilegesProblems lists the GRANT statements required on given problem instances, and adds those
+// instances missing privileges which are not already listed. Downtimed and ignored instances are not added.
+func AddTopologyPrivilegesProblems(instances [](*inst.Instance), clusterName string) ([](*inst.Instance), error) {
+	deficiencies := ReadTopologyPrivilegesDeficiencies()
+	if len(deficiencies) == 0 {
+		return instances, nil
+	}
+	listed := inst.NewInstanceKeyMap()
+	for _, instance := range instances {
+		listed.AddKey(instance.Key)
+	}
+	requiredGrants := make(map[inst.InstanceKey][]string)
+	for _, check := range deficiencies {
+		requiredGrants[check.InstanceKey] = check.GrantStatements
+		if listed.HasKey(check.InstanceKey) {
+			continue
+		}
+		instance, found, err := inst.ReadInstance(&check.InstanceKey)
+		if err != nil {
+			return instances, err
+		}
+		if !found || instance.IsDowntimed || inst.RegexpMatchPatterns(instance.Key.Hostname, config.Config.ProblemIgnoreHostnameFilters) {
+			continue
+		}
+		if clusterName != "" && instance.ClusterName != clusterName {
+			continue
+		}
+		listed.AddKey(instance.Key)
+		instances = append(instances, instance)
+	}
+	for _, instance := range instances {
+		instance.RequiredGrants = requiredGrants[instance.Key]
+	}
+	return instances, nil
+}
@@ -29,7 +29,6 @@ import (
 	"github.com/github/orchestrator/go/attributes"
 	"github.com/github/orchestrator/go/config"
 	"github.com/github/orchestrator/go/inst"
-	"github.com/github/orchestrator/go/kv"
 	ometrics "github.com/github/orchestrator/go/metrics"
 	"github.com/github/orchestrator/go/os"
 	"github.com/github/orchestrator/go/process"
@@ -104,6 +103,10 @@ type TopologyRecovery struct {
 	LastDetectionId           int64
 	RelatedRecoveryId         int64
 	RecoveryType              MasterRecoveryType
+	DataLossReport            *inst.DataLossReport
+	RecoveryApprovalUID       string // the approval consumed by this recovery, if any
+
+	bundle *TopologyRecoveryBundle
 }
 
 func NewTopologyRecovery(replicationAnalysis inst.ReplicationAnalysis) *TopologyRecovery {
@@ -115,6 +118,7 @@ func NewTopologyRecovery(replicationAnalysis inst.ReplicationAnalysis) *Topology
 	topologyRecovery.ParticipatingInstanceKeys = *inst.NewInstanceKeyMap()
 	topologyRecovery.AllErrors = []string{}
 	topologyRecovery.RecoveryType = NotMasterRecovery
+	topologyRecovery.bundle = NewTopologyRecoveryBundle(topologyRecovery.UID, replicationAnalysis)
 	return topologyRecovery
 }
 
@@ -157,6 +161,15 @@ const (
 var emergencyReadTopologyInstanceMap *cache.Cache
 var emergencyRestartReplicaTopologyInstanceMap *cache.Cache
 var emergencyOperationGracefulPeriodMap *cache.Cache
+var analysisFirstSeenMap *cache.Cache
+
+// externalHealthChecksMap holds the recent opinions of external health sources per suspect master,
+// such that sources are not queried on each analysis iteration
+var externalHealthChecksMap *cache.Cache
+
+// externalHealthOpinionsMap holds the last recorded opinions of external health sources per suspect master,
+// such that opinions are only recorded and audited as they change
+var externalHealthOpinionsMap *cache.Cache
 
 // InstancesByCountReplicas sorts instances by umber of replicas, descending
 type InstancesByCountReplicas [](*inst.Instance)
@@ -211,6 +224,9 @@ func initializeTopologyRecoveryPostConfiguration() {
 	emergencyReadTopologyInstanceMap = cache.New(time.Second, time.Millisecond*250)
 	emergencyRestartReplicaTopologyInstanceMap = cache.New(time.Second*30, time.Second)
 	emergencyOperationGracefulPeriodMap = cache.New(time.Second*5, time.Millisecond*500)
+	analysisFirstSeenMap = cache.New(time.Second*10, time.Second)
+	externalHealthChecksMap = cache.New(time.Second*10, time.Second)
+	externalHealthOpinionsMap = cache.New(time.Hour, time.Minute)
 }
 
 // AuditTopologyRecovery audits a single step in a topology recovery process.
@@ -235,6 +251,8 @@ func resolveRecovery(topologyRecovery *TopologyRecovery, successorInstance *inst
 		topologyRecovery.SuccessorAlias = successorInstance.InstanceAlias
 		topologyRecovery.IsSuccessful = true
 	}
+	recordRecoveryStateEvent(inst.RecoveryResolvedEvent, topologyRecovery)
+	emailRecoveryNotification(topologyRecovery, true)
 	if orcraft.IsRaftEnabled() {
 		_, err := orcraft.PublishCommand("resolve-recovery", topologyRecovery)
 		return err
@@ -261,6 +279,9 @@ func replaceCommandPlaceholders(command string, topologyRecovery *TopologyRecove
 	command = strings.Replace(command, "{autoIntermediateMasterRecovery}", fmt.Sprint(analysisEntry.ClusterDetails.HasAutomatedIntermediateMasterRecovery), -1)
 	command = strings.Replace(command, "{orchestratorHost}", process.ThisHostname, -1)
 	command = strings.Replace(command, "{recoveryUID}", topologyRecovery.UID, -1)
+	if topologyRecovery.DataLossReport != nil {
+		command = strings.Replace(command, "{isDataLossEstimated}", fmt.Sprint(topologyRecovery.DataLossReport.IsDataLossEstimated), -1)
+	}
 
 	command = strings.Replace(command, "{isSuccessful}", fmt.Sprint(topologyRecovery.SuccessorKey != nil), -1)
 	if topologyRecovery.SuccessorKey != nil {
@@ -276,6 +297,12 @@ func replaceCommandPlaceholders(command string, topologyRecovery *TopologyRecove
 	command = strings.Replace(command, "{slaveHosts}", analysisEntry.SlaveHosts.ToCommaDelimitedList(), -1)
 	command = strings.Replace(command, "{replicaHosts}", analysisEntry.SlaveHosts.ToCommaDelimitedList(), -1)
 
+	if analysisEntry.FailoverImpact != nil {
+		command = strings.Replace(command, "{countReplicasToRepoint}", fmt.Sprintf("%d", analysisEntry.FailoverImpact.CountReplicasToRepoint), -1)
+		command = strings.Replace(command, "{countUnlikelyReattachableReplicas}", fmt.Sprintf("%d", analysisEntry.FailoverImpact.CountReplicasUnlikelyReattachable), -1)
+		command = strings.Replace(command, "{estimatedPromotionSeconds}", fmt.Sprintf("%.0f", analysisEntry.FailoverImpact.EstimatedPromotionSeconds), -1)
+	}
+
 	return command
 }
 
@@ -300,6 +327,12 @@ func applyEnvironmentVariables(topologyRecovery *TopologyRecovery) []string {
 	env = append(env, fmt.Sprintf("ORC_LOST_REPLICAS=%s", topologyRecovery.LostReplicas.ToCommaDelimitedList()))
 	env = append(env, fmt.Sprintf("ORC_REPLICA_HOSTS=%s", analysisEntry.SlaveHosts.ToCommaDelimitedList()))
 	env = append(env, fmt.Sprintf("ORC_RECOVERY_UID=%s", topologyRecovery.UID))
+	if topologyRecovery.DataLossReport != nil {
+		env = append(env, fmt.Sprintf("ORC_IS_DATA_LOSS_ESTIMATED=%v", topologyRecovery.DataLossReport.IsDataLossEstimated))
+		if b, err := json.Marshal(topologyRecovery.DataLossReport); err == nil {
+			env = append(env, fmt.Sprintf("ORC_DATA_LOSS_REPORT=%s", string(b)))
+		}
+	}
 
 	if topologyRecovery.SuccessorKey != nil {
 		env = append(env, fmt.Sprintf("ORC_SUCCESSOR_HOST=%s", topologyRecovery.SuccessorKey.Hostname))
@@ -308,10 +341,124 @@ func applyEnvironmentVariables(topologyRecovery *TopologyRecovery) []string {
 		// If SucessorAlias is "", it's fine. We'll replace {successorAlias} with "".
 		env = append(env, fmt.Sprintf("ORC_SUCCESSOR_ALIAS=%s", topologyRecovery.SuccessorAlias))
 	}
+	if analysisEntry.FailoverImpact != nil {
+		env = append(env, fmt.Sprintf("ORC_COUNT_REPLICAS_TO_REPOINT=%d", analysisEntry.FailoverImpact.CountReplicasToRepoint))
+		env = append(env, fmt.Sprintf("ORC_COUNT_UNLIKELY_REATTACHABLE_REPLICAS=%d", analysisEntry.FailoverImpact.CountReplicasUnlikelyReattachable))
+		env = append(env, fmt.Sprintf("ORC_ESTIMATED_PROMOTION_SECONDS=%.0f", analysisEntry.FailoverImpact.EstimatedPromotionSeconds))
+	}
+	env = append(env, notesEnvironmentVariables(analysisEntry)...)
 
 	return env
 }
 
+// registerHookExecution notes down a hook invocation attempt onto the recovery's bundle
+func registerHookExecution(topologyRecovery *TopologyRecovery, description string, attempt int, command string, start time.Time, cmdResult *os.CommandResult, cmdErr error) {
+	if topologyRecovery == nil || topologyRecovery.bundle == nil {
+		return
+	}
+	hookExecution := RecoveryHookExecution{
+		Description: description,
+		Attempt:     attempt,
+		Command:     command,
+		StartTime:   start,
+		EndTime:     time.Now(),
+		ExitCode:    -1,
+	}
+	if cmdResult != nil {
+		hookExecution.ExitCode = cmdResult.ExitCode
+		hookExecution.Stdout = cmdResult.Stdout
+		hookExecution.Stderr = cmdResult.Stderr
+	}
+	if cmdErr != nil {
+		hookExecution.Error = cmdErr.Error()
+	}
+	topologyRecovery.bundle.AddHookExecution(hookExecution)
+}
+
+// auditHookOutput audits the stdout/stderr of a single hook invocation attempt
+func auditHookOutput(topologyRecovery *TopologyRecovery, attemptDescription string, cmdResult *os.CommandResult) {
+	if cmdResult == nil {
+		return
+	}
+	if stdout := strings.TrimSpace(cmdResult.Stdout); stdout != "" {
+		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("%s stdout: %s", attemptDescription, stdout))
+	}
+	if stderr := strings.TrimSpace(cmdResult.Stderr); stderr != "" {
+		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("%s stderr: %s", attemptDescription, stderr))
+	}
+}
+
+// executeProcess executes a single process, or built-in hook action, applying its configured execution
+// settings, and retrying as configured. A non-empty payload is passed to the process on its stdin, and in
+// a file named by ORC_HOOK_PAYLOAD_FILE. A built-in hook action has its placeholders replaced by given function.
+// The recovery, if any, is audited with the execution.
+func executeProcess(command string, env []string, payload []byte, hookConfig config.HookConfiguration, fullDescription string, topologyRecovery *TopologyRecovery, placeholders func(text string) string) (err error) {
+	options := &os.CommandOptions{
+		Timeout:          time.Duration(hookConfig.TimeoutSeconds) * time.Second,
+		WorkingDirectory: hookConfig.WorkingDirectory,
+		RunAsUser:        hookConfig.RunAsUser,
+	}
+	if len(payload) > 0 {
+		options.Stdin = payload
+		options.StdinFileEnv = "ORC_HOOK_PAYLOAD_FILE"
+		env = append(env, fmt.Sprintf("ORC_HOOK_PAYLOAD_VERSION=%d", HookPayloadVersion))
+	}
+	for name, value := range hookConfig.Environment {
+		env = append(env, fmt.Sprintf("%s=%s", name, value))
+	}
+	countAttempts := hookConfig.Retries + 1
+	backoff := time.Duration(hookConfig.RetryBackoffSeconds) * time.Second
+	for attempt := 1; attempt <= countAttempts; attempt++ {
+		attemptDescription := fullDescription
+		if countAttempts > 1 {
+			attemptDescription = fmt.Sprintf("%s (attempt %d of %d)", fullDescription, attempt, countAttempts)
+		}
+		if attempt > 1 && backoff > 0 {
+			AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("Waiting %v before %s", backoff, attemptDescription))
+			time.Sleep(backoff)
+			backoff = backoff * 2
+		}
+		// Log the command to be run and record how long it takes as this may be useful
+		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("Running %s: %s", attemptDescription, command))
+		start := time.Now()
+		var cmdResult *os.CommandResult
+		var cmdErr error
+		if actionName, isAction := hookActionName(command); isAction {
+			cmdResult, cmdErr = executeHookAction(actionName, options.Timeout, placeholders)
+		} else {
+			cmdResult, cmdErr = os.CommandRunWithOptions(command, env, options)
+		}
+		registerHookExecution(topologyRecovery, fullDescription, attempt, command, start, cmdResult, cmdErr)
+		auditHookOutput(topologyRecovery, attemptDescription, cmdResult)
+		if cmdErr == nil {
+			AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("Completed %s in %v", attemptDescription, time.Since(start)))
+			return nil
+		}
+		info := fmt.Sprintf("Execution of %s failed in %v with error: %v", attemptDescription, time.Since(start), cmdErr)
+		AuditTopologyRecovery(topologyRecovery, info)
+		log.Errorf(info)
+		err = cmdErr
+	}
+	return err
+}
+
+// notificationHooks are hooks lists which only notify, and are subject to NotificationDeduplicationSeconds
+var notificationHooks = map[string]bool{
+	"OnFailureDetectionProcesses":    true,
+	"OnDualWritableMastersProcesses": true,
+}
+
+// notificationKey identifies a notification hook for NotificationDeduplicationSeconds: the same expanded command,
+// for the same analysis of the same failed instance in the same cluster. Hooks get the failure through environment
+// variables and payloads as well as through placeholders, and so identical commands of different failures are not
+// identical notifications.
+func notificationKey(description string, command string, topologyRecovery *TopologyRecovery) string {
+	analysisEntry := &topologyRecovery.AnalysisEntry
+	return fmt.Sprintf("%s/%s/%s/%s/%s",
+		description, analysisEntry.ClusterDetails.ClusterName, analysisEntry.AnalyzedInstanceKey.StringCode(), analysisEntry.Analysis, command,
+	)
+}
+
 // executeProcesses executes a list of processes
 func executeProcesses(processes []string, description string, topologyRecovery *TopologyRecovery, failOnError bool) error {
 	if len(processes) == 0 {
@@ -325,22 +472,22 @@ func executeProcesses(processes []string, description string, topologyRecovery *
 		fullDescription := fmt.Sprintf("%s hook %d of %d", description, i+1, len(processes))
 
 		command := replaceCommandPlaceholders(command, topologyRecovery)
+		if notificationHooks[description] && inst.IsDuplicateNotification(notificationKey(description, command, topologyRecovery)) {
+			AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("Skipping %s: identical notification sent within %d seconds", fullDescription, config.Config.NotificationDeduplicationSeconds))
+			continue
+		}
 		env := applyEnvironmentVariables(topologyRecovery)
+		hookConfig := config.Config.GetHookConfiguration(description, i+1)
+		var payload []byte
+		if hookConfig.JSONPayload {
+			var marshalErr error
+			if payload, marshalErr = json.Marshal(NewHookPayload(description, topologyRecovery)); marshalErr != nil {
+				AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("Cannot generate JSON payload of %s: %+v", fullDescription, marshalErr))
+			}
+		}
 
-		// Log the command to be run and record how long it takes as this may be useful
-		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("Running %s: %s", fullDescription, command))
-		start := time.Now()
-		if cmdErr := os.CommandRun(command, env); cmdErr == nil {
-			info := fmt.Sprintf("Completed %s in %v",
-				fullDescription, time.Since(start))
-			AuditTopologyRecovery(topologyRecovery, info)
-		} else {
-			info := fmt.Sprintf("Execution of %s failed in %v with error: %v",
-				fullDescription, time.Since(start), cmdErr)
-			AuditTopologyRecovery(topologyRecovery, info)
-			log.Errorf(info)
-			// FIXME: It would be good to additionally include command execution output to the auditing
-
+		placeholders := func(text string) string { return replaceCommandPlaceholders(text, topologyRecovery) }
+		if cmdErr := executeProcess(command, env, payload, hookConfig, fullDescription, topologyRecovery, placeholders); cmdErr != nil {
 			if err == nil {
 				// Note first error
 				err = cmdErr
@@ -359,6 +506,40 @@ func executeProcesses(processes []string, description string, topologyRecovery *
 	return err
 }
 
+// hookVariable is a variable of an event other than a recovery, made available to the hooks run on the event:
+// as a {placeholder} in commands and in hook action settings, and as an environment variable
+type hookVariable struct {
+	placeholder string
+	envName     string
+	value       string
+}
+
+// executeEventProcesses executes a list of processes run on an event other than a recovery, such as a change of
+// pool membership. Processes get given variables, as well as {orchestratorHost}, and run with the same hook
+// configuration, retries and built-in hook actions as recovery processes do. All processes run; the first error is returned.
+func executeEventProcesses(processes []string, description string, variables []hookVariable) error {
+	variables = append(variables, hookVariable{"orchestratorHost", "ORC_ORCHESTRATOR_HOST", process.ThisHostname})
+	placeholders := func(text string) string {
+		for _, variable := range variables {
+			text = strings.Replace(text, fmt.Sprintf("{%s}", variable.placeholder), variable.value, -1)
+		}
+		return text
+	}
+	env := goos.Environ()
+	for _, variable := range variables {
+		env = append(env, fmt.Sprintf("%s=%s", variable.envName, variable.value))
+	}
+	var err error
+	for i, command := range processes {
+		fullDescription := fmt.Sprintf("%s hook %d of %d", description, i+1, len(processes))
+		hookConfig := config.Config.GetHookConfiguration(description, i+1)
+		if cmdErr := executeProcess(placeholders(command), env, nil, hookConfig, fullDescription, nil, placeholders); cmdErr != nil && err == nil {
+			err = cmdErr
+		}
+	}
+	return err
+}
+
 func recoverDeadMasterInBinlogServerTopology(topologyRecovery *TopologyRecovery) (promotedReplica *inst.Instance, err error) {
 	failedMasterKey := &topologyRecovery.AnalysisEntry.AnalyzedInstanceKey
 
@@ -454,6 +635,31 @@ func recoverDeadMasterInBinlogServerTopology(topologyRecovery *TopologyRecovery)
 	return promotedReplica, err
 }
 
+// regroupReplicasOfDeadMaster regroups the replicas of a dead master by given recovery type, promoting one of them
+func regroupReplicasOfDeadMaster(topologyRecovery *TopologyRecovery, masterRecoveryType MasterRecoveryType, promotedReplicaIsIdeal func(*inst.Instance) bool) (promotedReplica *inst.Instance, lostReplicas [](*inst.Instance), cannotReplicateReplicas [](*inst.Instance), err error) {
+	failedInstanceKey := &topologyRecovery.AnalysisEntry.AnalyzedInstanceKey
+	switch masterRecoveryType {
+	case MasterRecoveryGTID:
+		{
+			AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("RecoverDeadMaster: regrouping replicas via GTID"))
+			lostReplicas, _, cannotReplicateReplicas, promotedReplica, err = inst.RegroupReplicasGTID(failedInstanceKey, true, nil, &topologyRecovery.PostponedFunctionsContainer, promotedReplicaIsIdeal)
+		}
+	case MasterRecoveryPseudoGTID:
+		{
+			AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("RecoverDeadMaster: regrouping replicas via Pseudo-GTID"))
+			lostReplicas, _, _, cannotReplicateReplicas, promotedReplica, err = inst.RegroupReplicasPseudoGTIDIncludingSubReplicasOfBinlogServers(failedInstanceKey, true, nil, &topologyRecovery.PostponedFunctionsContainer, promotedReplicaIsIdeal)
+		}
+	case MasterRecoveryBinlogServer:
+		{
+			AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("RecoverDeadMaster: recovering via binlog servers"))
+			promotedReplica, err = recoverDeadMasterInBinlogServerTopology(topologyRecovery)
+		}
+	default:
+		err = fmt.Errorf("RecoverDeadMaster: unsupported master recovery type: %+v", masterRecoveryType)
+	}
+	return promotedReplica, lostReplicas, cannotReplicateReplicas, err
+}
+
 // recoverDeadMaster recovers a dead master, complete logic inside
 func recoverDeadMaster(topologyRecovery *TopologyRecovery, candidateInstanceKey *inst.InstanceKey, skipProcesses bool) (promotedReplica *inst.Instance, lostReplicas [](*inst.Instance), err error) {
 	analysisEntry := &topologyRecovery.AnalysisEntry
@@ -470,14 +676,23 @@ func recoverDeadMaster(topologyRecovery *TopologyRecovery, candidateInstanceKey
 
 	AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("RecoverDeadMaster: will recover %+v", *failedInstanceKey))
 
-	var masterRecoveryType MasterRecoveryType = MasterRecoveryPseudoGTID
-	if analysisEntry.OracleGTIDImmediateTopology || analysisEntry.MariaDBGTIDImmediateTopology {
-		masterRecoveryType = MasterRecoveryGTID
-	} else if analysisEntry.BinlogServerImmediateTopology {
-		masterRecoveryType = MasterRecoveryBinlogServer
+	promotionStrategy := GetClusterPromotionStrategy(analysisEntry.ClusterDetails.ClusterName, analysisEntry.ClusterDetails.ClusterAlias)
+	masterRecoveryType, err := promotionStrategy.MasterRecoveryType(analysisEntry)
+	if err != nil {
+		return nil, lostReplicas, topologyRecovery.AddError(err)
 	}
 	topologyRecovery.RecoveryType = masterRecoveryType
-	AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("RecoverDeadMaster: masterRecoveryType=%+v", masterRecoveryType))
+	AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("RecoverDeadMaster: promotionStrategy=%s, masterRecoveryType=%+v", promotionStrategy.Name(), masterRecoveryType))
+	if candidateInstanceKey == nil {
+		suggestedCandidateKey, err := promotionStrategy.SuggestCandidate(topologyRecovery)
+		if err != nil {
+			return nil, lostReplicas, topologyRecovery.AddError(err)
+		}
+		if suggestedCandidateKey != nil {
+			AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("RecoverDeadMaster: promotion strategy %s suggests %+v as candidate", promotionStrategy.Name(), *suggestedCandidateKey))
+			candidateInstanceKey = suggestedCandidateKey
+		}
+	}
 
 	promotedReplicaIsIdeal := func(promoted *inst.Instance) bool {
 		if promoted == nil {
@@ -487,6 +702,11 @@ func recoverDeadMaster(topologyRecovery *TopologyRecovery, candidateInstanceKey
 		if promoted.Key.Equals(candidateInstanceKey) {
 			return true
 		}
+		if candidateInstanceKey == nil && isPreElectedPromotionCandidate(failedInstanceKey, analysisEntry.ClusterDetails.ClusterName, promoted) {
+			AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("RecoverDeadMaster: found %+v to be the pre-elected promotion candidate; will optimize recovery", promoted.Key))
+			postponedAll = true
+			return true
+		}
 		if candidateInstanceKey == nil {
 			if promoted.PromotionRule == inst.MustPromoteRule || promoted.PromotionRule == inst.PreferPromoteRule {
 				if promoted.DataCenter == topologyRecovery.AnalysisEntry.AnalyzedInstanceDataCenter &&
@@ -499,23 +719,10 @@ func recoverDeadMaster(topologyRecovery *TopologyRecovery, candidateInstanceKey
 		}
 		return false
 	}
-	switch masterRecoveryType {
-	case MasterRecoveryGTID:
-		{
-			AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("RecoverDeadMaster: regrouping replicas via GTID"))
-			lostReplicas, _, cannotReplicateReplicas, promotedReplica, err = inst.RegroupReplicasGTID(failedInstanceKey, true, nil, &topologyRecovery.PostponedFunctionsContainer, promotedReplicaIsIdeal)
-		}
-	case MasterRecoveryPseudoGTID:
-		{
-			AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("RecoverDeadMaster: regrouping replicas via Pseudo-GTID"))
-			lostReplicas, _, _, cannotReplicateReplicas, promotedReplica, err = inst.RegroupReplicasPseudoGTIDIncludingSubReplicasOfBinlogServers(failedInstanceKey, true, nil, &topologyRecovery.PostponedFunctionsContainer, promotedReplicaIsIdeal)
-		}
-	case MasterRecoveryBinlogServer:
-		{
-			AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("RecoverDeadMaster: recovering via binlog servers"))
-			promotedReplica, err = recoverDeadMasterInBinlogServerTopology(topologyRecovery)
-		}
+	if err := checkRecoveryAbortRequested(topologyRecovery); err != nil {
+		return nil, lostReplicas, topologyRecovery.AddError(err)
 	}
+	promotedReplica, lostReplicas, cannotReplicateReplicas, err = regroupReplicasOfDeadMaster(topologyRecovery, masterRecoveryType, promotedReplicaIsIdeal)
 	topologyRecovery.AddError(err)
 	lostReplicas = append(lostReplicas, cannotReplicateReplicas...)
 	for _, replica := range lostReplicas {
@@ -566,6 +773,7 @@ func recoverDeadMaster(topologyRecovery *TopologyRecovery, candidateInstanceKey
 // SuggestReplacementForPromotedReplica returns a server to take over the already
 // promoted replica, if such server is found and makes an improvement over the promoted replica.
 func SuggestReplacementForPromotedReplica(topologyRecovery *TopologyRecovery, deadInstanceKey *inst.InstanceKey, promotedReplica *inst.Instance, candidateInstanceKey *inst.InstanceKey) (replacement *inst.Instance, actionRequired bool, err error) {
+	isCandidateRequested := candidateInstanceKey != nil
 	candidateReplicas, _ := inst.ReadClusterCandidateInstances(promotedReplica.ClusterName)
 	candidateReplicas = inst.RemoveInstance(candidateReplicas, deadInstanceKey)
 	deadInstance, _, err := inst.ReadInstance(deadInstanceKey)
@@ -586,7 +794,8 @@ func SuggestReplacementForPromotedReplica(topologyRecovery *TopologyRecovery, de
 			for _, candidateReplica := range candidateReplicas {
 				if promotedReplica.Key.Equals(&candidateReplica.Key) &&
 					promotedReplica.DataCenter == deadInstance.DataCenter &&
-					promotedReplica.PhysicalEnvironment == deadInstance.PhysicalEnvironment {
+					promotedReplica.PhysicalEnvironment == deadInstance.PhysicalEnvironment &&
+					isAntiAffine(promotedReplica, deadInstance) {
 					// Seems like we promoted a candidate in the same DC & ENV as dead IM! Ideal! We're happy!
 					AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("promoted replica %+v is the ideal candidate", promotedReplica.Key))
 					return promotedReplica, false, nil
@@ -602,7 +811,8 @@ func SuggestReplacementForPromotedReplica(topologyRecovery *TopologyRecovery, de
 			for _, candidateReplica := range candidateReplicas {
 				if canTakeOverPromotedServerAsMaster(candidateReplica, promotedReplica) &&
 					candidateReplica.DataCenter == deadInstance.DataCenter &&
-					candidateReplica.PhysicalEnvironment == deadInstance.PhysicalEnvironment {
+					candidateReplica.PhysicalEnvironment == deadInstance.PhysicalEnvironment &&
+					isAntiAffine(candidateReplica, deadInstance) {
 					// This would make a great candidate
 					candidateInstanceKey = &candidateReplica.Key
 					AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("no candidate was offered for %+v but orchestrator picks %+v as candidate replacement, based on being in same DC & env as failed instance", *deadInstanceKey, candidateReplica.Key))
@@ -614,7 +824,7 @@ func SuggestReplacementForPromotedReplica(topologyRecovery *TopologyRecovery, de
 		// We cannot find a candidate in same DC and ENV as dead master
 		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("+ checking if promoted replica is an OK candidate"))
 		for _, candidateReplica := range candidateReplicas {
-			if promotedReplica.Key.Equals(&candidateReplica.Key) {
+			if promotedReplica.Key.Equals(&candidateReplica.Key) && isAntiAffine(promotedReplica, deadInstance) {
 				// Seems like we promoted a candidate replica (though not in same DC and ENV as dead master). Good enough.
 				// No further action required.
 				AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("promoted replica %+v is a good candidate", promotedReplica.Key))
@@ -689,6 +899,15 @@ func SuggestReplacementForPromotedReplica(topologyRecovery *TopologyRecovery, de
 		}
 	}
 
+	if candidateInstanceKey == nil {
+		// Still nothing? Prefer a failover pool member over the promoted replica, or avoid keeping a member of an avoided pool
+		candidateInstanceKey = suggestPoolAwareReplacement(topologyRecovery, deadInstance, promotedReplica)
+	}
+	if candidateInstanceKey == nil {
+		// Still nothing? Avoid keeping a promoted replica which shares anti-affinity dimensions with the dead master
+		candidateInstanceKey = suggestAntiAffinityReplacement(topologyRecovery, deadInstance, promotedReplica)
+	}
+
 	// So do we have a candidate?
 	if candidateInstanceKey == nil {
 		// Found nothing. Stick with promoted replica
@@ -701,6 +920,14 @@ func SuggestReplacementForPromotedReplica(topologyRecovery *TopologyRecovery, de
 		return promotedReplica, false, nil
 	}
 	replacement, _, err = inst.ReadInstance(candidateInstanceKey)
+	if err == nil && replacement != nil && !isCandidateRequested && inst.IsVetoedFromPromotion(replacement) {
+		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("+ promotion of %+v is vetoed by PromotionVetoQuery; sticking with promoted replica", replacement.Key))
+		return promotedReplica, false, nil
+	}
+	if err == nil && replacement != nil && !isCandidateRequested && !isAntiAffine(replacement, deadInstance) && isAntiAffine(promotedReplica, deadInstance) {
+		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("+ %+v shares %+v with failed instance, where promoted replica does not; sticking with promoted replica", replacement.Key, antiAffinityViolations(replacement, deadInstance)))
+		return promotedReplica, false, nil
+	}
 	return replacement, true, err
 }
 
@@ -736,13 +963,43 @@ func replacePromotedReplicaWithCandidate(topologyRecovery *TopologyRecovery, dea
 	return promotedReplica, nil
 }
 
+// writeClusterMasterEntries writes the KV entries of a cluster whose master failed over to given promoted master:
+// the master entries, along with the cluster's next cutover token, as a single write. With raft, the write is
+// a single command, applied by all nodes in the same order. The leader computes the token, such that applying
+// the command is idempotent.
+func writeClusterMasterEntries(topologyRecovery *TopologyRecovery, promotedMaster *inst.Instance) {
+	analysisEntry := &topologyRecovery.AnalysisEntry
+	kvPairs, err := inst.GetClusterMasterEntriesKVPairs(&analysisEntry.ClusterDetails, promotedMaster)
+	if err != nil {
+		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("- RecoverDeadMaster: failed rendering KV master entries: %+v", err))
+	}
+	entries := inst.NewClusterMasterEntries(analysisEntry.ClusterDetails.ClusterAlias, kvPairs, &promotedMaster.Key, &analysisEntry.AnalyzedInstanceKey)
+	AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("Writing KV %+v and cutover token of %s", kvPairs, entries.ClusterAlias))
+	if orcraft.IsRaftEnabled() {
+		if err := entries.AssignCutoverToken(); err != nil {
+			AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("- RecoverDeadMaster: failed computing cutover token of %s: %+v", entries.ClusterAlias, err))
+		}
+		_, err := orcraft.PublishCommand("write-cluster-master-entries", entries)
+		log.Errore(err)
+		// since we'll be affecting 3rd party tools here, we _prefer_ to mitigate re-applying
+		// of the write-cluster-master-entries event upon startup. We _recommend_ a snapshot in the near future.
+		go orcraft.PublishCommand("async-snapshot", "")
+	} else {
+		_, err := inst.WriteClusterMasterEntries(entries)
+		log.Errore(err)
+	}
+}
+
 // checkAndRecoverDeadMaster checks a given analysis, decides whether to take action, and possibly takes action
 // Returns true when action was taken.
 func checkAndRecoverDeadMaster(analysisEntry inst.ReplicationAnalysis, candidateInstanceKey *inst.InstanceKey, forceInstanceRecovery bool, skipProcesses bool) (bool, *TopologyRecovery, error) {
+	approvalUID := ""
 	if !(forceInstanceRecovery || analysisEntry.ClusterDetails.HasAutomatedMasterRecovery) {
-		return false, nil, nil
+		if approvalUID = readRecoveryApprovalUID(&analysisEntry, analysisEntry.ClusterDetails.MasterRecoveryAutomation, config.MasterFailureClass); approvalUID == "" {
+			return false, nil, nil
+		}
 	}
-	topologyRecovery, err := AttemptRecoveryRegistration(&analysisEntry, !forceInstanceRecovery, !forceInstanceRecovery)
+	topologyRecovery, err := attemptApprovedRecoveryRegistration(&analysisEntry, approvalUID, !forceInstanceRecovery, !forceInstanceRecovery)
 	if topologyRecovery == nil {
 		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("found an active or recent recovery on %+v. Will not issue another RecoverDeadMaster.", analysisEntry.AnalyzedInstanceKey))
 		return false, nil, err
@@ -751,8 +1008,25 @@ func checkAndRecoverDeadMaster(analysisEntry inst.ReplicationAnalysis, candidate
 	// That's it! We must do recovery!
 	AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("will handle DeadMaster event on %+v", analysisEntry.ClusterDetails.ClusterName))
 	recoverDeadMasterCounter.Inc(1)
+	var pinnedMaster *inst.ClusterPinnedMaster
+	if !forceInstanceRecovery {
+		// A pinned master only constrains automated recoveries; an operator's explicit request overrides it
+		if pinnedMaster, err = inst.ReadClusterPinnedMaster(analysisEntry.ClusterDetails.ClusterAlias); err != nil {
+			topologyRecovery.AddError(err)
+		}
+	}
+	if pinnedMaster != nil {
+		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("RecoverDeadMaster: %s; only it may be promoted", pinnedMaster.String()))
+		if candidateInstanceKey == nil && !pinnedMaster.Key.Equals(&analysisEntry.AnalyzedInstanceKey) {
+			candidateInstanceKey = &pinnedMaster.Key
+		}
+	}
 	promotedReplica, lostReplicas, err := recoverDeadMaster(topologyRecovery, candidateInstanceKey, skipProcesses)
 	topologyRecovery.LostReplicas.AddInstances(lostReplicas)
+	if promotedReplica != nil && pinnedMaster != nil && !promotedReplica.Key.Equals(&pinnedMaster.Key) {
+		withholdUnpinnedMasterPromotion(topologyRecovery, pinnedMaster, promotedReplica, skipProcesses)
+		promotedReplica = nil
+	}
 
 	// And this is the end; whether successful or not, we're done.
 	resolveRecovery(topologyRecovery, promotedReplica)
@@ -776,22 +1050,7 @@ func checkAndRecoverDeadMaster(analysisEntry inst.ReplicationAnalysis, candidate
 			go inst.SetReadOnly(&analysisEntry.AnalyzedInstanceKey, true)
 		}
 
-		kvPairs := inst.GetClusterMasterKVPairs(analysisEntry.ClusterDetails.ClusterAlias, &promotedReplica.Key)
-		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("Writing KV %+v", kvPairs))
-		if orcraft.IsRaftEnabled() {
-			for _, kvPair := range kvPairs {
-				_, err := orcraft.PublishCommand("put-key-value", kvPair)
-				log.Errore(err)
-			}
-			// since we'll be affecting 3rd party tools here, we _prefer_ to mitigate re-applying
-			// of the put-key-value event upon startup. We _recommend_ a snapshot in the near future.
-			go orcraft.PublishCommand("async-snapshot", "")
-		} else {
-			for _, kvPair := range kvPairs {
-				err := kv.PutKVPair(kvPair)
-				log.Errore(err)
-			}
-		}
+		writeClusterMasterEntries(topologyRecovery, promotedReplica)
 
 		if !skipProcesses {
 			// Execute post master-failover processes
@@ -1068,10 +1327,13 @@ func RecoverDeadIntermediateMaster(topologyRecovery *TopologyRecovery, skipProce
 // checkAndRecoverDeadIntermediateMaster checks a given analysis, decides whether to take action, and possibly takes action
 // Returns true when action was taken.
 func checkAndRecoverDeadIntermediateMaster(analysisEntry inst.ReplicationAnalysis, candidateInstanceKey *inst.InstanceKey, forceInstanceRecovery bool, skipProcesses bool) (bool, *TopologyRecovery, error) {
+	approvalUID := ""
 	if !(forceInstanceRecovery || analysisEntry.ClusterDetails.HasAutomatedIntermediateMasterRecovery) {
-		return false, nil, nil
+		if approvalUID = readRecoveryApprovalUID(&analysisEntry, analysisEntry.ClusterDetails.IntermediateMasterRecoveryAutomation, config.IntermediateMasterFailureClass); approvalUID == "" {
+			return false, nil, nil
+		}
 	}
-	topologyRecovery, err := AttemptRecoveryRegistration(&analysisEntry, !forceInstanceRecovery, !forceInstanceRecovery)
+	topologyRecovery, err := attemptApprovedRecoveryRegistration(&analysisEntry, approvalUID, !forceInstanceRecovery, !forceInstanceRecovery)
 	if topologyRecovery == nil {
 		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("- RecoverDeadIntermediateMaster: found an active or recent recovery on %+v. Will not issue another RecoverDeadIntermediateMaster.", analysisEntry.AnalyzedInstanceKey))
 		return false, nil, err
@@ -1114,6 +1376,18 @@ func RecoverDeadCoMaster(topologyRecovery *TopologyRecovery, skipProcesses bool)
 
 	AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("RecoverDeadCoMaster: will recover %+v", *failedInstanceKey))
 
+	if isDeadPassiveCoMaster(failedInstanceKey, otherCoMaster) {
+		// The failed co-master was passive. Writes go to the active co-master, which retains its role.
+		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("RecoverDeadCoMaster: %+v was a passive co-master; active co-master %+v retains its role", *failedInstanceKey, otherCoMaster.Key))
+		promotedReplica, lostReplicas, err = recoverDeadPassiveCoMaster(topologyRecovery, otherCoMaster)
+		inst.BeginDowntime(inst.NewDowntime(failedInstanceKey, inst.GetMaintenanceOwner(), inst.DowntimeLostInRecoveryMessage, time.Duration(config.LostInRecoveryDowntimeSeconds)*time.Second))
+		acknowledgeInstanceFailureDetection(&analysisEntry.AnalyzedInstanceKey)
+		return promotedReplica, lostReplicas, err
+	}
+
+	if err := checkRecoveryAbortRequested(topologyRecovery); err != nil {
+		return nil, lostReplicas, topologyRecovery.AddError(err)
+	}
 	var coMasterRecoveryType MasterRecoveryType = MasterRecoveryPseudoGTID
 	if analysisEntry.OracleGTIDImmediateTopology || analysisEntry.MariaDBGTIDImmediateTopology {
 		coMasterRecoveryType = MasterRecoveryGTID
@@ -1213,18 +1487,58 @@ func RecoverDeadCoMaster(topologyRecovery *TopologyRecovery, skipProcesses bool)
 	return promotedReplica, lostReplicas, err
 }
 
+// isDeadPassiveCoMaster returns true when given failed co-master was read-only while given other co-master, its
+// circular replication partner, was writeable: the other co-master is the active master of the cluster.
+func isDeadPassiveCoMaster(failedInstanceKey *inst.InstanceKey, otherCoMaster *inst.Instance) bool {
+	failedInstance, found, _ := inst.ReadInstance(failedInstanceKey)
+	return found && failedInstance.ReadOnly && !otherCoMaster.ReadOnly
+}
+
+// recoverDeadPassiveCoMaster recovers a dead read-only co-master, whose circular replication partner is the active
+// co-master: replicas of the dead co-master are relocated below the active co-master. In a co-master pair, the active
+// co-master stops replicating from the dead one; in a larger ring, the circle closes over the dead member.
+func recoverDeadPassiveCoMaster(topologyRecovery *TopologyRecovery, activeCoMaster *inst.Instance) (promotedReplica *inst.Instance, lostReplicas [](*inst.Instance), err error) {
+	failedInstanceKey := &topologyRecovery.AnalysisEntry.AnalyzedInstanceKey
+
+	relocatedReplicas, _, err, errs := inst.RelocateReplicas(failedInstanceKey, &activeCoMaster.Key, "")
+	topologyRecovery.AddError(err)
+	topologyRecovery.AddErrors(errs)
+	AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("RecoverDeadCoMaster: relocated %d replicas of %+v below %+v", len(relocatedReplicas), *failedInstanceKey, activeCoMaster.Key))
+	if replicas, rerr := inst.ReadReplicaInstances(failedInstanceKey); rerr == nil {
+		lostReplicas = inst.RemoveInstance(replicas, &activeCoMaster.Key)
+	}
+	if err != nil {
+		return nil, lostReplicas, err
+	}
+	if activeCoMaster.MasterKey.Equals(failedInstanceKey) {
+		if _, err := inst.DetachReplicaMasterHost(&activeCoMaster.Key); err != nil {
+			topologyRecovery.AddError(log.Errore(err))
+		}
+	}
+	topologyRecovery.ParticipatingInstanceKeys.AddKey(activeCoMaster.Key)
+	return activeCoMaster, lostReplicas, nil
+}
+
 // checkAndRecoverDeadCoMaster checks a given analysis, decides whether to take action, and possibly takes action
 // Returns true when action was taken.
 func checkAndRecoverDeadCoMaster(analysisEntry inst.ReplicationAnalysis, candidateInstanceKey *inst.InstanceKey, forceInstanceRecovery bool, skipProcesses bool) (bool, *TopologyRecovery, error) {
 	failedInstanceKey := &analysisEntry.AnalyzedInstanceKey
+	approvalUID := ""
 	if !(forceInstanceRecovery || analysisEntry.ClusterDetails.HasAutomatedMasterRecovery) {
-		return false, nil, nil
+		if approvalUID = readRecoveryApprovalUID(&analysisEntry, analysisEntry.ClusterDetails.MasterRecoveryAutomation, config.MasterFailureClass); approvalUID == "" {
+			return false, nil, nil
+		}
 	}
-	topologyRecovery, err := AttemptRecoveryRegistration(&analysisEntry, !forceInstanceRecovery, !forceInstanceRecovery)
+	topologyRecovery, err := attemptApprovedRecoveryRegistration(&analysisEntry, approvalUID, !forceInstanceRecovery, !forceInstanceRecovery)
 	if topologyRecovery == nil {
 		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("found an active or recent recovery on %+v. Will not issue another RecoverDeadCoMaster.", analysisEntry.AnalyzedInstanceKey))
 		return false, nil, err
 	}
+	activeCoMasterKey := &analysisEntry.AnalyzedInstanceMasterKey
+	activeCoMasterRetainsRole := false
+	if activeCoMaster, found, _ := inst.ReadInstance(activeCoMasterKey); found {
+		activeCoMasterRetainsRole = isDeadPassiveCoMaster(failedInstanceKey, activeCoMaster)
+	}
 
 	// That's it! We must do recovery!
 	recoverDeadCoMasterCounter.Inc(1)
@@ -1248,6 +1562,12 @@ func checkAndRecoverDeadCoMaster(analysisEntry inst.ReplicationAnalysis, candida
 			AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("- RecoverDeadMaster: will apply MySQL changes to promoted master"))
 			inst.SetReadOnly(&promotedReplica.Key, false)
 		}
+		if activeCoMasterRetainsRole && promotedReplica.Key.Equals(activeCoMasterKey) {
+			// The cluster's master did not change: its entries and cutover token stand as they are
+			AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("- RecoverDeadCoMaster: %+v was already the active master; not writing KV master entries", promotedReplica.Key))
+		} else {
+			writeClusterMasterEntries(topologyRecovery, promotedReplica)
+		}
 		if !skipProcesses {
 			// Execute post intermediate-master-failover processes
 			topologyRecovery.SuccessorKey = &promotedReplica.Key
@@ -1347,7 +1667,13 @@ func checkAndExecuteFailureDetectionProcesses(analysisEntry inst.ReplicationAnal
 	if skipProcesses {
 		return true, false, nil
 	}
+	emailFailureDetectionNotification(&analysisEntry)
 	err = executeProcesses(config.Config.OnFailureDetectionProcesses, "OnFailureDetectionProcesses", NewTopologyRecovery(analysisEntry), true)
+	if analysisEntry.Analysis == inst.DualWritableMasters {
+		if dualWritableErr := executeProcesses(config.Config.OnDualWritableMastersProcesses, "OnDualWritableMastersProcesses", NewTopologyRecovery(analysisEntry), false); err == nil {
+			err = dualWritableErr
+		}
+	}
 	return true, true, err
 }
 
@@ -1390,6 +1716,12 @@ func getCheckAndRecoverFunction(analysisCode inst.AnalysisCode, analyzedInstance
 		return checkAndRecoverGenericProblem, false
 	case inst.AllMasterSlavesNotReplicatingOrDead:
 		return checkAndRecoverGenericProblem, false
+	case inst.MasterNotWritable:
+		return checkAndRecoverGenericProblem, false
+	case inst.MasterWritesNotReplicating:
+		return checkAndRecoverGenericProblem, false
+	case inst.DualWritableMasters:
+		return checkAndRecoverGenericProblem, false
 	}
 	// Right now this is mostly causing noise with no clear action.
 	// Will revisit this in the future.
@@ -1412,17 +1744,47 @@ func runEmergentOperations(analysisEntry *inst.ReplicationAnalysis) {
 		go emergentlyReadTopologyInstance(&analysisEntry.AnalyzedInstanceKey, analysisEntry.Analysis)
 	case inst.AllMasterSlavesNotReplicatingOrDead:
 		go emergentlyReadTopologyInstance(&analysisEntry.AnalyzedInstanceKey, analysisEntry.Analysis)
+	case inst.MasterNotWritable:
+		go emergentlyReadTopologyInstance(&analysisEntry.AnalyzedInstanceKey, analysisEntry.Analysis)
+	case inst.MasterWritesNotReplicating:
+		go emergentlyReadTopologyInstanceReplicas(&analysisEntry.AnalyzedInstanceKey, analysisEntry.Analysis)
+	case inst.DualWritableMasters:
+		go emergentlyReadTopologyInstance(&analysisEntry.AnalyzedInstanceKey, analysisEntry.Analysis)
 	case inst.FirstTierSlaveFailingToConnectToMaster:
 		go emergentlyReadTopologyInstance(&analysisEntry.AnalyzedInstanceMasterKey, analysisEntry.Analysis)
 	}
 }
 
+// isAnalysisDebounced returns true when a failure analysis has not yet persisted for as long as its cluster's
+// detection profile requires, in which case it is not yet acted upon
+func isAnalysisDebounced(analysisEntry *inst.ReplicationAnalysis) bool {
+	thresholds := inst.NewDetectionThresholds(analysisEntry.ClusterDetails.ClusterName, analysisEntry.ClusterDetails.ClusterAlias)
+	if thresholds.AnalysisDebounceSeconds == 0 {
+		return false
+	}
+	key := fmt.Sprintf("%s/%s", analysisEntry.AnalyzedInstanceKey.StringCode(), string(analysisEntry.Analysis))
+	firstSeen := time.Now()
+	if value, found := analysisFirstSeenMap.Get(key); found {
+		firstSeen = value.(time.Time)
+	}
+	// An analysis which is no longer reported expires off the map, and restarts its debounce period when reported again
+	analysisFirstSeenMap.Set(key, firstSeen, cache.DefaultExpiration)
+	return time.Since(firstSeen) < time.Duration(thresholds.AnalysisDebounceSeconds)*time.Second
+}
+
 // executeCheckAndRecoverFunction will choose the correct check & recovery function based on analysis.
 // It executes the function synchronuously
 func executeCheckAndRecoverFunction(analysisEntry inst.ReplicationAnalysis, candidateInstanceKey *inst.InstanceKey, forceInstanceRecovery bool, skipProcesses bool) (recoveryAttempted bool, topologyRecovery *TopologyRecovery, err error) {
 	atomic.AddInt64(&countPendingRecoveries, 1)
 	defer atomic.AddInt64(&countPendingRecoveries, -1)
 
+	if process.IsShuttingDown() {
+		// In-flight recoveries are allowed to complete, but no new ones may begin
+		if util.ClearToLog("executeCheckAndRecoverFunction: shutdown", analysisEntry.AnalyzedInstanceKey.StringCode()) {
+			log.Infof("executeCheckAndRecoverFunction: NOT handling %+v on %+v: shutting down", analysisEntry.Analysis, analysisEntry.AnalyzedInstanceKey)
+		}
+		return false, nil, nil
+	}
 	checkAndRecoverFunction, isActionableRecovery := getCheckAndRecoverFunction(analysisEntry.Analysis, &analysisEntry.AnalyzedInstanceKey)
 	analysisEntry.IsActionableRecovery = isActionableRecovery
 	runEmergentOperations(&analysisEntry)
@@ -1444,6 +1806,12 @@ func executeCheckAndRecoverFunction(analysisEntry inst.ReplicationAnalysis, cand
 	}
 
 	// At this point we have validated there's a failure scenario for which we have a recovery path.
+	if !forceInstanceRecovery && isAnalysisDebounced(&analysisEntry) {
+		if util.ClearToLog("executeCheckAndRecoverFunction: debounce", analysisEntry.AnalyzedInstanceKey.StringCode()) {
+			log.Infof("executeCheckAndRecoverFunction: %+v on %+v has not yet persisted through its detection profile's debounce period", analysisEntry.Analysis, analysisEntry.AnalyzedInstanceKey)
+		}
+		return false, nil, nil
+	}
 
 	if orcraft.IsRaftEnabled() {
 		// with raft, all nodes can (and should) run analysis,
@@ -1456,6 +1824,9 @@ func executeCheckAndRecoverFunction(analysisEntry inst.ReplicationAnalysis, cand
 		}
 	}
 
+	if err := EstimateFailoverImpact(&analysisEntry); err != nil {
+		log.Warningf("executeCheckAndRecoverFunction: unable to estimate failover impact on %+v: %+v", analysisEntry.AnalyzedInstanceKey, err)
+	}
 	// Initiate detection:
 	registrationSuccess, _, err := checkAndExecuteFailureDetectionProcesses(analysisEntry, skipProcesses)
 	if registrationSuccess {
@@ -1470,6 +1841,7 @@ func executeCheckAndRecoverFunction(analysisEntry inst.ReplicationAnalysis, cand
 	}
 	// We don't mind whether detection really executed the processes or not
 	// (it may have been silenced due to previous detection). We only care there's no error.
+	ConsultExternalHealthSources(&analysisEntry)
 
 	// We're about to embark on recovery shortly...
 
@@ -1483,6 +1855,34 @@ func executeCheckAndRecoverFunction(analysisEntry inst.ReplicationAnalysis, cand
 			analysisEntry.Analysis, analysisEntry.AnalyzedInstanceKey, candidateInstanceKey, skipProcesses)
 		return false, nil, err
 	}
+	// Check for automated recoveries being throttled due to too many recent recoveries
+	if isActionableRecovery && !forceInstanceRecovery && isRecoveryThrottled(&analysisEntry) {
+		log.Infof("CheckAndRecover: Analysis: %+v, InstanceKey: %+v, candidateInstanceKey: %+v, "+
+			"skipProcesses: %v: NOT Recovering host (throttled)",
+			analysisEntry.Analysis, analysisEntry.AnalyzedInstanceKey, candidateInstanceKey, skipProcesses)
+		return false, nil, nil
+	}
+	// Check for external health sources required to, and not, confirming the failure
+	if isActionableRecovery && !forceInstanceRecovery && isExternalConfirmationMissing(&analysisEntry) {
+		log.Infof("CheckAndRecover: Analysis: %+v, InstanceKey: %+v, candidateInstanceKey: %+v, "+
+			"skipProcesses: %v: NOT Recovering host (not confirmed by external health sources)",
+			analysisEntry.Analysis, analysisEntry.AnalyzedInstanceKey, candidateInstanceKey, skipProcesses)
+		return false, nil, nil
+	}
+	// Check for an in-progress schema migration on the cluster, which the recovery would break
+	if isActionableRecovery && !forceInstanceRecovery && isRecoverySuppressedBySchemaMigration(&analysisEntry) {
+		log.Infof("CheckAndRecover: Analysis: %+v, InstanceKey: %+v, candidateInstanceKey: %+v, "+
+			"skipProcesses: %v: NOT Recovering host (suppressed by schema migration)",
+			analysisEntry.Analysis, analysisEntry.AnalyzedInstanceKey, candidateInstanceKey, skipProcesses)
+		return false, nil, nil
+	}
+	// Check for the analysis being on orchestrator's own backend cluster, which is recovered manually
+	if isActionableRecovery && !forceInstanceRecovery && isSelfRecoverySuppressed(&analysisEntry) {
+		log.Infof("CheckAndRecover: Analysis: %+v, InstanceKey: %+v, candidateInstanceKey: %+v, "+
+			"skipProcesses: %v: NOT Recovering host (orchestrator's own backend cluster)",
+			analysisEntry.Analysis, analysisEntry.AnalyzedInstanceKey, candidateInstanceKey, skipProcesses)
+		return false, nil, nil
+	}
 
 	// Actually attempt recovery:
 	if isActionableRecovery || util.ClearToLog("executeCheckAndRecoverFunction: recovery", analysisEntry.AnalyzedInstanceKey.StringCode()) {
@@ -1495,6 +1895,7 @@ func executeCheckAndRecoverFunction(analysisEntry inst.ReplicationAnalysis, cand
 	if topologyRecovery == nil {
 		return recoveryAttempted, topologyRecovery, err
 	}
+	topologyRecovery.DataLossReport = estimateRecoveryDataLoss(topologyRecovery, topologyRecovery.getTopologyBefore())
 	if b, err := json.Marshal(topologyRecovery); err == nil {
 		log.Infof("Topology recovery: %+v", string(b))
 	} else {
@@ -1516,6 +1917,9 @@ func executeCheckAndRecoverFunction(analysisEntry inst.ReplicationAnalysis, cand
 	if topologyRecovery.PostponedFunctionsContainer.Len() > 0 {
 		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("Executed postponed functions: %+v", strings.Join(topologyRecovery.PostponedFunctionsContainer.Descriptions(), ", ")))
 	}
+	sampleRecoveryDataLoss(topologyRecovery)
+	captureTopologyRecoveryBundle(topologyRecovery)
+	watchDeadMasterForPostmortem(topologyRecovery)
 	return recoveryAttempted, topologyRecovery, err
 }
 
@@ -1526,10 +1930,17 @@ func CheckAndRecover(specificInstance *inst.InstanceKey, candidateInstanceKey *i
 	if err != nil {
 		return false, nil, log.Errore(err)
 	}
+	if specificInstance == nil {
+		go inst.ArchiveReplicationAnalysis(replicationAnalysis)
+	}
 	if *config.RuntimeCLIFlags.Noop {
 		log.Infof("--noop provided; will not execute processes")
 		skipProcesses = true
 	}
+	discoveryPausedClusterAliases, err := inst.ReadDiscoveryPausedClusterAliases()
+	if err != nil {
+		return false, nil, log.Errore(err)
+	}
 	// intentionally iterating entries in random order
 	for i := range rand.Perm(len(replicationAnalysis)) {
 		analysisEntry := replicationAnalysis[i]
@@ -1543,6 +1954,10 @@ func CheckAndRecover(specificInstance *inst.InstanceKey, candidateInstanceKey *i
 			// Only recover a downtimed server if explicitly requested
 			continue
 		}
+		if discoveryPausedClusterAliases[analysisEntry.ClusterDetails.ClusterAlias] && specificInstance == nil {
+			// The cluster's data is stale while its discovery is paused; only recover if explicitly requested
+			continue
+		}
 
 		if specificInstance != nil {
 			// force mode. Keep it synchronuous
@@ -1661,13 +2076,59 @@ func ForceMasterTakeover(clusterName string, destination *inst.Instance) (topolo
 	return topologyRecovery, nil
 }
 
+// checkGracefulTakeoverBlockingTransactions looks for long running transactions and metadata locks on a master
+// about to be demoted, and reports, kills or aborts as configured per cluster in GracefulTakeoverTransactionsChecks.
+func checkGracefulTakeoverBlockingTransactions(clusterName string, clusterMaster *inst.Instance) error {
+	clusterAlias, _ := inst.ReadAliasByClusterName(clusterName)
+	transactionsCheck := config.Config.GetGracefulTakeoverTransactionsCheck(clusterName, clusterAlias)
+	if transactionsCheck.LongTransactionSeconds == 0 && !transactionsCheck.CheckMetadataLocks {
+		return nil
+	}
+	blockingProcesses, waitingProcesses, err := inst.ReadBlockingProcesses(&clusterMaster.Key, transactionsCheck.LongTransactionSeconds, transactionsCheck.CheckMetadataLocks)
+	if err != nil {
+		return fmt.Errorf("GracefulMasterTakeover: unable to check for blocking transactions on %+v: %+v", clusterMaster.Key, err)
+	}
+	if len(blockingProcesses) == 0 && len(waitingProcesses) == 0 {
+		return nil
+	}
+	processesReport := func(processes []inst.Process) string {
+		reports := []string{}
+		for _, process := range processes {
+			reports = append(reports, fmt.Sprintf("id=%d user=%s host=%s db=%s command=%s time=%d started_at=%s state=%s info=%s",
+				process.Id, process.User, process.Host, process.Db, process.Command, process.Time, process.StartedAt, process.State, process.Info))
+		}
+		return strings.Join(reports, "; ")
+	}
+	report := fmt.Sprintf("%d blocking processes found on %+v: [%s]; %d processes waiting on metadata locks: [%s]",
+		len(blockingProcesses), clusterMaster.Key, processesReport(blockingProcesses), len(waitingProcesses), processesReport(waitingProcesses))
+	inst.AuditOperation("graceful-master-takeover-blocking-transactions", &clusterMaster.Key, report)
+
+	switch transactionsCheck.Action {
+	case "abort":
+		return fmt.Errorf("GracefulMasterTakeover: aborting. %s", report)
+	case "kill":
+		// Only blocking processes are killed. Waiting processes are released once the blocking processes are gone.
+		for _, process := range blockingProcesses {
+			if err := inst.KillProcess(&clusterMaster.Key, process.Id); err != nil {
+				return fmt.Errorf("GracefulMasterTakeover: unable to kill blocking process %d on %+v: %+v", process.Id, clusterMaster.Key, err)
+			}
+		}
+	default:
+		log.Warningf("GracefulMasterTakeover: %s. Proceeding", report)
+	}
+	return nil
+}
+
 // GracefulMasterTakeover will demote master of existing topology and promote its
 // direct replica instead.
 // It expects that replica to have no siblings.
 // This function is graceful in that it will first lock down the master, then wait
 // for the designated replica to catch up with last position.
 // It will point old master at the newly promoted master at the correct coordinates, but will not start replication.
-func GracefulMasterTakeover(clusterName string, designatedKey *inst.InstanceKey) (topologyRecovery *TopologyRecovery, promotedMasterCoordinates *inst.BinlogCoordinates, err error) {
+// The takeover aborts when the cluster would be left without its GracefulTakeoverReplicaQuorums, unless forced.
+// A designated replica lagging too much fails the takeover, unless whenCaughtUp, in which case the takeover waits
+// for the replica to catch up, as predicted by its lag history.
+func GracefulMasterTakeover(clusterName string, designatedKey *inst.InstanceKey, force bool, whenCaughtUp bool) (topologyRecovery *TopologyRecovery, promotedMasterCoordinates *inst.BinlogCoordinates, err error) {
 	clusterMasters, err := inst.ReadClusterMaster(clusterName)
 	if err != nil {
 		return nil, nil, fmt.Errorf("Cannot deduce cluster master for %+v; error: %+v", clusterName, err)
@@ -1723,7 +2184,27 @@ func GracefulMasterTakeover(clusterName string, designatedKey *inst.InstanceKey)
 		return nil, nil, fmt.Errorf("Sanity check failure. It seems like the designated instance %+v does not replicate from the master %+v (designated instance's master key is %+v). This error is strange. Panicking", designatedInstance.Key, clusterMaster.Key, designatedInstance.MasterKey)
 	}
 	if !designatedInstance.HasReasonableMaintenanceReplicationLag() {
-		return nil, nil, fmt.Errorf("Desginated instance %+v seems to be lagging to much for thie operation. Aborting.", designatedInstance.Key)
+		if !whenCaughtUp {
+			return nil, nil, fmt.Errorf("Desginated instance %+v seems to be lagging to much for thie operation. Aborting.", designatedInstance.Key)
+		}
+		if designatedInstance, err = waitForTakeoverCatchUp(designatedInstance, &clusterMaster.Key); err != nil {
+			return nil, nil, err
+		}
+		if clusterMaster, clusterMasterDirectReplicas, err = rereadTakeoverTopology(clusterName, clusterMaster, designatedInstance); err != nil {
+			return nil, nil, err
+		}
+	}
+	quorumCheck, err := CheckGracefulTakeoverReplicaQuorum(clusterName, clusterMaster, designatedInstance)
+	if err != nil {
+		return nil, nil, fmt.Errorf("GracefulMasterTakeover: unable to check replica quorum: %+v", err)
+	}
+	if !quorumCheck.HasQuorum {
+		if !force {
+			inst.AuditOperation("graceful-master-takeover-quorum", &clusterMaster.Key, fmt.Sprintf("aborted: %s", quorumCheck.Report()))
+			return nil, nil, fmt.Errorf("GracefulMasterTakeover: replica quorum not met, aborting; use force to override. %s", quorumCheck.Report())
+		}
+		inst.AuditOperation("graceful-master-takeover-quorum", &clusterMaster.Key, fmt.Sprintf("forced: %s", quorumCheck.Report()))
+		log.Warningf("GracefulMasterTakeover: replica quorum not met; proceeding as forced. %s", quorumCheck.Report())
 	}
 
 	if len(clusterMasterDirectReplicas) > 1 {
@@ -1752,6 +2233,9 @@ func GracefulMasterTakeover(clusterName string, designatedKey *inst.InstanceKey)
 			}
 		}
 	}
+	if err := checkGracefulTakeoverBlockingTransactions(clusterName, clusterMaster); err != nil {
+		return nil, nil, err
+	}
 	log.Infof("GracefulMasterTakeover: Will demote %+v and promote %+v instead", clusterMaster.Key, designatedInstance.Key)
 
 	replicationUser, replicationPassword, replicationCredentialsError := inst.ReadReplicationCredentials(&designatedInstance.Key)
@@ -1816,6 +2300,8 @@ func GracefulMasterTakeover(clusterName string, designatedKey *inst.InstanceKey)
 		}
 	}
 	executeProcesses(config.Config.PostGracefulTakeoverProcesses, "PostGracefulTakeoverProcesses", topologyRecovery, false)
+	// Post takeover hooks ran after the recovery's bundle was captured
+	persistTopologyRecoveryBundle(topologyRecovery)
 
 	return topologyRecovery, promotedMasterCoordinates, err
 }
@@ -0,0 +1,318 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/github/orchestrator/go/inst"
+	"github.com/github/orchestrator/go/raft"
+	"github.com/openark/golib/log"
+)
+
+// RecoveryHookExecution describes a single hook invocation made throughout a recovery
+type RecoveryHookExecution struct {
+	Description string
+	Attempt     int
+	Command     string
+	StartTime   time.Time
+	EndTime     time.Time
+	ExitCode    int
+	Stdout      string
+	Stderr      string
+	Error       string
+}
+
+// RecoveryCandidate describes a replica of the failed instance and how it qualified for promotion
+type RecoveryCandidate struct {
+	Key                    inst.InstanceKey
+	PromotionRule          inst.CandidatePromotionRule
+	Pools                  []string
+	PoolPreference         inst.PromotionPoolPreference
+	DataCenter             string
+	PhysicalEnvironment    string
+	ExecBinlogCoordinates  inst.BinlogCoordinates
+	IsBannedFromPromotion  bool
+	IsValidAsWouldBeMaster bool
+	IsPromoted             bool
+	IsLost                 bool
+}
+
+// RecoveryTimings summarizes the time spent on a recovery
+type RecoveryTimings struct {
+	RecoveryStartTime       time.Time
+	RecoveryEndTime         time.Time
+	RecoveryDurationSeconds float64
+	HooksDurationSeconds    float64
+}
+
+// TopologyRecoveryBundle is the collection of artifacts of a single recovery, kept for postmortem analysis
+type TopologyRecoveryBundle struct {
+	RecoveryUID    string
+	Analysis       inst.ReplicationAnalysis
+	TopologyBefore [](*inst.Instance)
+	TopologyAfter  [](*inst.Instance)
+	Hooks          []RecoveryHookExecution
+	Candidates     []RecoveryCandidate
+	Timings        RecoveryTimings
+	DataLoss       *inst.DataLossReport
+
+	// Captured after the recovery, when the failed master becomes reachable
+	DeadMasterPostmortem *DeadMasterPostmortem
+
+	mutex sync.Mutex
+}
+
+func NewTopologyRecoveryBundle(recoveryUID string, analysisEntry inst.ReplicationAnalysis) *TopologyRecoveryBundle {
+	return &TopologyRecoveryBundle{
+		RecoveryUID:    recoveryUID,
+		Analysis:       analysisEntry,
+		TopologyBefore: [](*inst.Instance){},
+		TopologyAfter:  [](*inst.Instance){},
+		Hooks:          []RecoveryHookExecution{},
+		Candidates:     []RecoveryCandidate{},
+	}
+}
+
+// AddHookExecution registers a hook invocation onto this bundle
+func (this *TopologyRecoveryBundle) AddHookExecution(hookExecution RecoveryHookExecution) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.Hooks = append(this.Hooks, hookExecution)
+	this.Timings.HooksDurationSeconds += hookExecution.EndTime.Sub(hookExecution.StartTime).Seconds()
+}
+
+// WriteArchive writes the bundle as a gzipped tar archive, one JSON file per artifact
+func (this *TopologyRecoveryBundle) WriteArchive(w io.Writer) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	artifacts := []struct {
+		name    string
+		content interface{}
+	}{
+		{"analysis.json", this.Analysis},
+		{"topology-before.json", this.TopologyBefore},
+		{"topology-after.json", this.TopologyAfter},
+		{"hooks.json", this.Hooks},
+		{"candidates.json", this.Candidates},
+		{"timings.json", this.Timings},
+		{"data-loss.json", this.DataLoss},
+		{"dead-master-postmortem.json", this.DeadMasterPostmortem},
+	}
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+	for _, artifact := range artifacts {
+		b, err := json.MarshalIndent(artifact.content, "", "  ")
+		if err != nil {
+			return log.Errore(err)
+		}
+		header := &tar.Header{
+			Name:    fmt.Sprintf("recovery-%s/%s", this.RecoveryUID, artifact.name),
+			Mode:    0644,
+			Size:    int64(len(b)),
+			ModTime: this.Timings.RecoveryEndTime,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return log.Errore(err)
+		}
+		if _, err := tw.Write(b); err != nil {
+			return log.Errore(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return log.Errore(err)
+	}
+	return log.Errore(zw.Close())
+}
+
+// readBundleTopologyAfter re-reads the instances that participated in the topology before the recovery
+func readBundleTopologyAfter(topologyBefore [](*inst.Instance)) (topologyAfter [](*inst.Instance)) {
+	topologyAfter = [](*inst.Instance){}
+	for _, instance := range topologyBefore {
+		if instance, found, err := inst.ReadInstance(&instance.Key); err == nil && found {
+			topologyAfter = append(topologyAfter, instance)
+		}
+	}
+	return topologyAfter
+}
+
+// getBundleRecoveryCandidates lists the direct replicas of the failed instance, and how they qualified for promotion
+func getBundleRecoveryCandidates(topologyRecovery *TopologyRecovery, topologyBefore [](*inst.Instance)) (candidates []RecoveryCandidate) {
+	candidates = []RecoveryCandidate{}
+	failedInstanceKey := &topologyRecovery.AnalysisEntry.AnalyzedInstanceKey
+	clusterName := topologyRecovery.AnalysisEntry.ClusterDetails.ClusterName
+	instancesPools, _, _ := inst.ReadInstancesPools(clusterName)
+	poolPreferences, _ := inst.ReadPromotionPoolPreferences(clusterName)
+	for _, instance := range topologyBefore {
+		if !instance.MasterKey.Equals(failedInstanceKey) {
+			continue
+		}
+		candidate := RecoveryCandidate{
+			Key:                    instance.Key,
+			PromotionRule:          instance.PromotionRule,
+			Pools:                  instancesPools[instance.Key],
+			PoolPreference:         poolPreferences.Get(&instance.Key),
+			DataCenter:             instance.DataCenter,
+			PhysicalEnvironment:    instance.PhysicalEnvironment,
+			ExecBinlogCoordinates:  instance.ExecBinlogCoordinates,
+			IsBannedFromPromotion:  inst.IsBannedFromBeingCandidateReplica(instance),
+			IsValidAsWouldBeMaster: isGenerallyValidAsWouldBeMaster(instance, false),
+			IsPromoted:             instance.Key.Equals(topologyRecovery.SuccessorKey),
+			IsLost:                 topologyRecovery.LostReplicas.HasKey(instance.Key),
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates
+}
+
+// estimateRecoveryDataLoss estimates the data lost in a master recovery: transactions of the failed master, and of
+// replicas lost in the recovery, which are not on the promoted server. It only reads the backend; the failed master's
+// binary logs are sampled later, by sampleRecoveryDataLoss.
+func estimateRecoveryDataLoss(topologyRecovery *TopologyRecovery, topologyBefore [](*inst.Instance)) *inst.DataLossReport {
+	analysisEntry := &topologyRecovery.AnalysisEntry
+	if !analysisEntry.IsMaster && !analysisEntry.IsCoMaster {
+		return nil
+	}
+	var failedMaster, promotedBefore, promotedAfter *inst.Instance
+	lostReplicas := [](*inst.Instance){}
+	for _, instance := range topologyBefore {
+		if instance.Key.Equals(&analysisEntry.AnalyzedInstanceKey) {
+			failedMaster = instance
+		}
+		if topologyRecovery.SuccessorKey != nil && instance.Key.Equals(topologyRecovery.SuccessorKey) {
+			promotedBefore = instance
+		}
+		if topologyRecovery.LostReplicas.HasKey(instance.Key) {
+			lostReplicas = append(lostReplicas, instance)
+		}
+	}
+	if failedMaster == nil {
+		return nil
+	}
+	if topologyRecovery.SuccessorKey != nil {
+		if instance, found, err := inst.ReadInstance(topologyRecovery.SuccessorKey); err == nil && found {
+			promotedAfter = instance
+		}
+	}
+	report := inst.EstimateDataLoss(failedMaster, promotedBefore, promotedAfter, lostReplicas)
+	for _, span := range report.Spans {
+		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("estimated data loss on %+v (%s): %d transactions %s; binlog span %+v..%+v (%d bytes, %d binary logs)",
+			span.Key, span.Role, span.CountLostTransactions, span.LostGtidSet, span.FromCoordinates, span.ToCoordinates, span.SpanBytes, span.CountBinaryLogs))
+	}
+	return report
+}
+
+// sampleRecoveryDataLoss samples the binary logs of the failed master, where reachable, for the schemas and tables
+// affected by the estimated data loss. Connecting to the failed master may take as long as connect timeouts, and so
+// this runs once the recovery and its hooks are done.
+func sampleRecoveryDataLoss(topologyRecovery *TopologyRecovery) {
+	report := topologyRecovery.DataLossReport
+	if report == nil {
+		return
+	}
+	for i := range report.Spans {
+		span := &report.Spans[i]
+		if span.Role != inst.DataLossFailedMaster {
+			continue
+		}
+		if err := inst.SampleDataLossSpan(&span.Key, span); err != nil {
+			AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("cannot sample binary logs of %+v for data loss: %+v", span.Key, err))
+			continue
+		}
+		if span.IsSampled {
+			AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("data loss on %+v affects tables: %s", span.Key, strings.Join(span.AffectedTables, ",")))
+		}
+	}
+}
+
+// captureTopologyBefore keeps a copy of the topology as it is prior to a recovery, for the recovery's bundle. It runs
+// upon the recovery's registration, such that analyses which do not lead to a recovery read no topology.
+func captureTopologyBefore(topologyRecovery *TopologyRecovery) {
+	bundle := topologyRecovery.bundle
+	if bundle == nil {
+		return
+	}
+	topologyBefore, err := inst.ReadClusterInstances(topologyRecovery.AnalysisEntry.ClusterDetails.ClusterName)
+	log.Errore(err)
+
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+	if topologyBefore != nil {
+		bundle.TopologyBefore = topologyBefore
+	}
+	bundle.Timings.RecoveryStartTime = time.Now()
+}
+
+// getTopologyBefore returns the topology as captured upon the recovery's registration
+func (this *TopologyRecovery) getTopologyBefore() [](*inst.Instance) {
+	bundle := this.bundle
+	if bundle == nil {
+		return [](*inst.Instance){}
+	}
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+	return bundle.TopologyBefore
+}
+
+// captureTopologyRecoveryBundle completes the bundle of a recovery that has just run its course, and persists it.
+func captureTopologyRecoveryBundle(topologyRecovery *TopologyRecovery) error {
+	bundle := topologyRecovery.bundle
+	if bundle == nil {
+		return nil
+	}
+	topologyBefore := topologyRecovery.getTopologyBefore()
+	topologyAfter := readBundleTopologyAfter(topologyBefore)
+	candidates := getBundleRecoveryCandidates(topologyRecovery, topologyBefore)
+
+	bundle.mutex.Lock()
+	bundle.Analysis = topologyRecovery.AnalysisEntry
+	bundle.TopologyAfter = topologyAfter
+	bundle.Candidates = candidates
+	bundle.DataLoss = topologyRecovery.DataLossReport
+	bundle.Timings.RecoveryEndTime = time.Now()
+	bundle.Timings.RecoveryDurationSeconds = bundle.Timings.RecoveryEndTime.Sub(bundle.Timings.RecoveryStartTime).Seconds()
+	bundle.mutex.Unlock()
+
+	return persistTopologyRecoveryBundle(topologyRecovery)
+}
+
+// persistTopologyRecoveryBundle writes down the bundle of given recovery, either directly or via raft
+func persistTopologyRecoveryBundle(topologyRecovery *TopologyRecovery) error {
+	bundle := topologyRecovery.bundle
+	if bundle == nil {
+		return nil
+	}
+	return writeTopologyRecoveryBundleOrPublish(bundle)
+}
+
+// writeTopologyRecoveryBundleOrPublish writes down given bundle, either directly or via raft
+func writeTopologyRecoveryBundleOrPublish(bundle *TopologyRecoveryBundle) error {
+	if orcraft.IsRaftEnabled() {
+		_, err := orcraft.PublishCommand("write-recovery-bundle", bundle)
+		return log.Errore(err)
+	}
+	return writeTopologyRecoveryBundle(bundle)
+}
@@ -0,0 +1,99 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"testing"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+func TestEstimateRecoveryDataLoss(t *testing.T) {
+	withSQLiteBackend(t)
+	sampleMaxEvents := config.Config.DataLossSampleMaxEvents
+	config.Config.DataLossSampleMaxEvents = 10000
+	defer func() { config.Config.DataLossSampleMaxEvents = sampleMaxEvents }()
+
+	failedMasterKey := inst.InstanceKey{Hostname: "data-loss-master", Port: 3306}
+	promotedKey := inst.InstanceKey{Hostname: "data-loss-replica", Port: 3306}
+	failedMaster := inst.NewInstance()
+	failedMaster.Key = failedMasterKey
+	failedMaster.SelfBinlogCoordinates = inst.BinlogCoordinates{LogFile: "mysql-bin.000003", LogPos: 120}
+	promotedBefore := inst.NewInstance()
+	promotedBefore.Key = promotedKey
+	promotedBefore.MasterKey = failedMasterKey
+	promotedBefore.ReadBinlogCoordinates = inst.BinlogCoordinates{LogFile: "mysql-bin.000001", LogPos: 4}
+	writeTestInstance(t, promotedKey, inst.InstanceKey{}, "data-loss-replica:3306")
+
+	topologyRecovery := NewTopologyRecovery(inst.ReplicationAnalysis{AnalyzedInstanceKey: failedMasterKey, IsMaster: true})
+	{
+		// No promotion: nothing to compare with
+		report := estimateRecoveryDataLoss(topologyRecovery, [](*inst.Instance){failedMaster, promotedBefore})
+		test.S(t).ExpectFalse(report.IsDataLossEstimated)
+	}
+	topologyRecovery.SuccessorKey = &promotedKey
+	{
+		// The failed master is unreachable. Estimating does not attempt reading its binary logs, which would
+		// delay the recovery's hooks
+		report := estimateRecoveryDataLoss(topologyRecovery, [](*inst.Instance){failedMaster, promotedBefore})
+		test.S(t).ExpectTrue(report.IsDataLossEstimated)
+		test.S(t).ExpectEquals(len(report.Spans), 1)
+		span := report.Spans[0]
+		test.S(t).ExpectEquals(span.Role, inst.DataLossFailedMaster)
+		test.S(t).ExpectEquals(span.CountBinaryLogs, 3)
+		test.S(t).ExpectFalse(span.IsSampled)
+		test.S(t).ExpectEquals(span.SampleError, "")
+	}
+	{
+		analysisEntry := inst.ReplicationAnalysis{AnalyzedInstanceKey: promotedKey}
+		report := estimateRecoveryDataLoss(NewTopologyRecovery(analysisEntry), [](*inst.Instance){failedMaster, promotedBefore})
+		test.S(t).ExpectTrue(report == nil)
+	}
+}
+
+func TestCaptureTopologyBefore(t *testing.T) {
+	withSQLiteBackend(t)
+
+	masterKey := inst.InstanceKey{Hostname: "bundle-master", Port: 3306}
+	replicaKey := inst.InstanceKey{Hostname: "bundle-replica", Port: 3306}
+	writeTestInstance(t, masterKey, inst.InstanceKey{}, "bundle-master:3306")
+	writeTestInstance(t, replicaKey, masterKey, "bundle-master:3306")
+	writeTestInstance(t, inst.InstanceKey{Hostname: "other-master", Port: 3306}, inst.InstanceKey{}, "other-master:3306")
+
+	analysisEntry := inst.ReplicationAnalysis{AnalyzedInstanceKey: masterKey, Analysis: inst.DeadMaster}
+	analysisEntry.ClusterDetails.ClusterName = "bundle-master:3306"
+	analysisEntry.ClusterDetails.ClusterAlias = "bundle"
+	{
+		// Not yet registered
+		topologyRecovery := NewTopologyRecovery(analysisEntry)
+		test.S(t).ExpectEquals(len(topologyRecovery.getTopologyBefore()), 0)
+	}
+	{
+		topologyRecovery, err := AttemptRecoveryRegistration(&analysisEntry, false, false)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectNotNil(topologyRecovery)
+
+		topologyBefore := topologyRecovery.getTopologyBefore()
+		test.S(t).ExpectEquals(len(topologyBefore), 2)
+		for _, instance := range topologyBefore {
+			test.S(t).ExpectEquals(instance.ClusterName, "bundle-master:3306")
+		}
+		test.S(t).ExpectFalse(topologyRecovery.bundle.Timings.RecoveryStartTime.IsZero())
+	}
+}
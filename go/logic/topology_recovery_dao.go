@@ -17,6 +17,7 @@
 package logic
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 
@@ -44,6 +45,11 @@ func AttemptFailureDetectionRegistration(analysisEntry *inst.ReplicationAnalysis
 		analysisEntry.SlaveHosts.ToCommaDelimitedList(),
 		analysisEntry.IsActionableRecovery,
 	)
+	var lastSeen interface{}
+	if analysisEntry.LastSeenTimestamp != "" {
+		lastSeen = analysisEntry.LastSeenTimestamp
+	}
+	args = append(args, lastSeen)
 	startActivePeriodHint := "now()"
 	if analysisEntry.StartActivePeriod != "" {
 		startActivePeriodHint = "?"
@@ -65,6 +71,7 @@ func AttemptFailureDetectionRegistration(analysisEntry *inst.ReplicationAnalysis
 					count_affected_slaves,
 					slave_hosts,
 					is_actionable,
+					analyzed_instance_last_seen,
 					start_active_period
 				) values (
 					?,
@@ -79,6 +86,7 @@ func AttemptFailureDetectionRegistration(analysisEntry *inst.ReplicationAnalysis
 					?,
 					?,
 					?,
+					?,
 					%s
 				)
 			`, startActivePeriodHint)
@@ -138,8 +146,91 @@ func acknowledgeInstanceFailureDetection(instanceKey *inst.InstanceKey) error {
 }
 
 func writeTopologyRecovery(topologyRecovery *TopologyRecovery) (*TopologyRecovery, error) {
+	return insertTopologyRecovery(topologyRecovery, false, false, false)
+}
+
+// insertTopologyRecovery writes down a new recovery. With fenceActiveClusterRecovery, the recovery is only written
+// if its cluster has no recovery in flight. With throttle, the recovery is only written if the number of recent
+// recoveries, globally and in its data center, is within RecoveryThrottleMaxRecoveries[PerDC].
+// A recovery consumes its approval, if any: an approval is consumed by at most one recovery, as enforced by a unique
+// key. With register, the recovery is registered by this node, rather than applied as registered by another: it is
+// only written if its approval, if any, is approved and unexpired, and if this node's leader lease, if any, is
+// current (see process.LeaderLeaseFenceCondition).
+// The checks and the write are a single statement, so that two recoveries registering at the same time cannot
+// both pass the checks. A nil recovery is returned when not written.
+func insertTopologyRecovery(topologyRecovery *TopologyRecovery, fenceActiveClusterRecovery bool, throttle bool, register bool) (*TopologyRecovery, error) {
 	analysisEntry := topologyRecovery.AnalysisEntry
-	sqlResult, err := db.ExecOrchestrator(`
+	var approvalUID interface{}
+	if topologyRecovery.RecoveryApprovalUID != "" {
+		approvalUID = topologyRecovery.RecoveryApprovalUID
+	}
+	args := sqlutils.Args(
+		sqlutils.NilIfZero(topologyRecovery.Id),
+		topologyRecovery.UID,
+		analysisEntry.AnalyzedInstanceKey.Hostname, analysisEntry.AnalyzedInstanceKey.Port,
+		process.ThisHostname, util.ProcessToken.Hash,
+		string(analysisEntry.Analysis),
+		analysisEntry.ClusterDetails.ClusterName,
+		analysisEntry.ClusterDetails.ClusterAlias,
+		analysisEntry.CountReplicas, analysisEntry.SlaveHosts.ToCommaDelimitedList(),
+		analysisEntry.AnalyzedInstanceDataCenter,
+		analysisEntry.AnalyzedInstanceKey.Hostname, analysisEntry.AnalyzedInstanceKey.Port,
+		approvalUID,
+	)
+	fenceConditions := []string{}
+	if fenceActiveClusterRecovery {
+		fenceConditions = append(fenceConditions, `
+					not exists (
+						select 1 from topology_recovery
+						where
+							in_active_period = 1
+							and end_recovery is null
+							and (cluster_name = ? or (? != '' and cluster_alias = ?))
+					)`)
+		args = append(args, analysisEntry.ClusterDetails.ClusterName, analysisEntry.ClusterDetails.ClusterAlias, analysisEntry.ClusterDetails.ClusterAlias)
+	}
+	if throttle && config.Config.RecoveryThrottleMaxRecoveries > 0 {
+		fenceConditions = append(fenceConditions, `
+					(
+						select count(*) from topology_recovery
+						where start_active_period >= NOW() - interval ? second
+					) < ?`)
+		args = append(args, config.Config.RecoveryThrottlePeriodSeconds, config.Config.RecoveryThrottleMaxRecoveries)
+	}
+	if throttle && config.Config.RecoveryThrottleMaxRecoveriesPerDC > 0 && analysisEntry.AnalyzedInstanceDataCenter != "" {
+		fenceConditions = append(fenceConditions, `
+					(
+						select count(*) from topology_recovery
+						where start_active_period >= NOW() - interval ? second and data_center = ?
+					) < ?`)
+		args = append(args, config.Config.RecoveryThrottlePeriodSeconds, analysisEntry.AnalyzedInstanceDataCenter, config.Config.RecoveryThrottleMaxRecoveriesPerDC)
+	}
+	if approvalUID != nil && register {
+		fenceConditions = append(fenceConditions, `
+					exists (
+						select 1 from topology_recovery_approval
+						where
+							approval_uid = ?
+							and approval_status = ?
+							and expires_at > NOW()
+					)`)
+		args = append(args, approvalUID, string(RecoveryApprovalApproved))
+	}
+	if register {
+		leaderLeaseCondition, leaderLeaseArgs, err := process.LeaderLeaseFenceCondition()
+		if err != nil {
+			return nil, err
+		}
+		if leaderLeaseCondition != "" {
+			fenceConditions = append(fenceConditions, leaderLeaseCondition)
+			args = append(args, leaderLeaseArgs...)
+		}
+	}
+	fenceCondition := ""
+	if len(fenceConditions) > 0 {
+		fenceCondition = fmt.Sprintf("where %s", strings.Join(fenceConditions, " and "))
+	}
+	query := fmt.Sprintf(`
 			insert ignore
 				into topology_recovery (
 					recovery_id,
@@ -156,8 +247,10 @@ func writeTopologyRecovery(topologyRecovery *TopologyRecovery) (*TopologyRecover
 					cluster_alias,
 					count_affected_slaves,
 					slave_hosts,
-					last_detection_id
-				) values (
+					data_center,
+					last_detection_id,
+					approval_uid
+				) select
 					?,
 					?,
 					?,
@@ -172,19 +265,13 @@ func writeTopologyRecovery(topologyRecovery *TopologyRecovery) (*TopologyRecover
 					?,
 					?,
 					?,
-					(select ifnull(max(detection_id), 0) from topology_failure_detection where hostname=? and port=?)
-				)
-			`,
-		sqlutils.NilIfZero(topologyRecovery.Id),
-		topologyRecovery.UID,
-		analysisEntry.AnalyzedInstanceKey.Hostname, analysisEntry.AnalyzedInstanceKey.Port,
-		process.ThisHostname, util.ProcessToken.Hash,
-		string(analysisEntry.Analysis),
-		analysisEntry.ClusterDetails.ClusterName,
-		analysisEntry.ClusterDetails.ClusterAlias,
-		analysisEntry.CountReplicas, analysisEntry.SlaveHosts.ToCommaDelimitedList(),
-		analysisEntry.AnalyzedInstanceKey.Hostname, analysisEntry.AnalyzedInstanceKey.Port,
-	)
+					?,
+					(select ifnull(max(detection_id), 0) from topology_failure_detection where hostname=? and port=?),
+					?
+				from (select 1) as registration
+				%s
+			`, fenceCondition)
+	sqlResult, err := db.ExecOrchestrator(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -205,6 +292,12 @@ func writeTopologyRecovery(topologyRecovery *TopologyRecovery) (*TopologyRecover
 
 // AttemptRecoveryRegistration tries to add a recovery entry; if this fails that means recovery is already in place.
 func AttemptRecoveryRegistration(analysisEntry *inst.ReplicationAnalysis, failIfFailedInstanceInActiveRecovery bool, failIfClusterInActiveRecovery bool) (*TopologyRecovery, error) {
+	return attemptApprovedRecoveryRegistration(analysisEntry, "", failIfFailedInstanceInActiveRecovery, failIfClusterInActiveRecovery)
+}
+
+// attemptApprovedRecoveryRegistration tries to add a recovery entry, consuming given recovery approval, if any.
+// The approval is consumed atomically with the registration, such that it is used by at most one recovery.
+func attemptApprovedRecoveryRegistration(analysisEntry *inst.ReplicationAnalysis, approvalUID string, failIfFailedInstanceInActiveRecovery bool, failIfClusterInActiveRecovery bool) (*TopologyRecovery, error) {
 	if failIfFailedInstanceInActiveRecovery {
 		// Let's check if this instance has just been promoted recently and is still in active period.
 		// If so, we reject recovery registration to avoid flapping.
@@ -226,7 +319,7 @@ func AttemptRecoveryRegistration(analysisEntry *inst.ReplicationAnalysis, failIf
 		}
 		if len(recoveries) > 0 {
 			RegisterBlockedRecoveries(analysisEntry, recoveries)
-			return nil, log.Errorf("AttemptRecoveryRegistration: cluster %+v has recently experienced a failover (of %+v) and is in active period. It will not be failed over again. You may acknowledge the failure on this cluster (-c ack-cluster-recoveries) or on %+v (-c ack-instance-recoveries) to remove this blockage", analysisEntry.ClusterDetails.ClusterName, recoveries[0].AnalysisEntry.AnalyzedInstanceKey, recoveries[0].AnalysisEntry.AnalyzedInstanceKey)
+			return nil, log.Errorf("AttemptRecoveryRegistration: cluster %+v has recently experienced a failover (of %+v) and is in active period. It will not be failed over again. You may acknowledge the failure on this cluster (-c ack-cluster-recoveries) or on %+v (-c ack-instance-recoveries), or clear the cluster's recovery block (-c clear-recovery-block), to remove this blockage", analysisEntry.ClusterDetails.ClusterName, recoveries[0].AnalysisEntry.AnalyzedInstanceKey, recoveries[0].AnalysisEntry.AnalyzedInstanceKey)
 		}
 	}
 	if !failIfFailedInstanceInActiveRecovery {
@@ -237,16 +330,48 @@ func AttemptRecoveryRegistration(analysisEntry *inst.ReplicationAnalysis, failIf
 	}
 
 	topologyRecovery := NewTopologyRecovery(*analysisEntry)
-
-	topologyRecovery, err := writeTopologyRecovery(topologyRecovery)
+	topologyRecovery.RecoveryApprovalUID = approvalUID
+
+	// A recovery in flight on the cluster fences this one off, atomically with its registration. Only a manual
+	// recovery command may override the fence, as requested via --active-recovery override.
+	// Likewise, automated recoveries are throttled atomically with their registration.
+	fenceActiveClusterRecovery := failIfClusterInActiveRecovery || !consumeActiveRecoveryOverride(analysisEntry.ClusterDetails.ClusterAlias)
+	throttle := failIfClusterInActiveRecovery
+	topologyRecovery, err := insertTopologyRecovery(topologyRecovery, fenceActiveClusterRecovery, throttle, true)
 	if err != nil {
 		return nil, log.Errore(err)
 	}
+	if topologyRecovery == nil {
+		// The leader lease is verified atomically with the registration; this merely explains a refusal
+		if err := process.VerifyLeaderLease(); err != nil {
+			return nil, log.Errore(err)
+		}
+	}
+	if topologyRecovery == nil && throttle && isRecoveryThrottled(analysisEntry) {
+		return nil, log.Errorf("AttemptRecoveryRegistration: recovery of %+v on cluster %+v is throttled. A manual recovery is required", analysisEntry.AnalyzedInstanceKey, analysisEntry.ClusterDetails.ClusterName)
+	}
+	if topologyRecovery == nil && fenceActiveClusterRecovery {
+		activeRecoveries, err := ReadActiveClusterRecovery(analysisEntry.ClusterDetails.ClusterName)
+		if err != nil {
+			return nil, log.Errore(err)
+		}
+		if len(activeRecoveries) > 0 {
+			return nil, log.Errorf("AttemptRecoveryRegistration: cluster %+v has an in-flight recovery: %s. It will not be recovered concurrently", analysisEntry.ClusterDetails.ClusterName, describeActiveRecovery(&activeRecoveries[0]))
+		}
+	}
+	if topologyRecovery == nil && approvalUID != "" {
+		return nil, log.Errorf("AttemptRecoveryRegistration: approval %s to recover %+v was already consumed, or is no longer valid. It will not be recovered", approvalUID, analysisEntry.AnalyzedInstanceKey)
+	}
 	if orcraft.IsRaftEnabled() {
 		if _, err := orcraft.PublishCommand("write-recovery", topologyRecovery); err != nil {
 			return nil, log.Errore(err)
 		}
 	}
+	if topologyRecovery != nil {
+		captureTopologyBefore(topologyRecovery)
+		recordRecoveryStateEvent(inst.RecoveryStartedEvent, topologyRecovery)
+		emailRecoveryNotification(topologyRecovery, false)
+	}
 	return topologyRecovery, nil
 }
 
@@ -260,6 +385,7 @@ func ClearActiveRecoveries() error {
 			where
 				in_active_period = 1
 				AND start_active_period < NOW() - INTERVAL ? SECOND
+				AND block_until_unixtime < UNIX_TIMESTAMP()
 			`,
 		config.Config.RecoveryPeriodBlockSeconds,
 	)
@@ -498,7 +624,10 @@ func writeResolveRecovery(topologyRecovery *TopologyRecovery) error {
 		strings.Join(topologyRecovery.AllErrors, "\n"),
 		topologyRecovery.UID,
 	)
-	return log.Errore(err)
+	if err != nil {
+		return log.Errore(err)
+	}
+	return writeRecoveryTiming(topologyRecovery.UID)
 }
 
 // readRecoveries reads recovery entry/audit entries from topology_recovery
@@ -525,6 +654,7 @@ func readRecoveries(whereCondition string, limit string, args []interface{}) ([]
       cluster_alias,
       count_affected_slaves,
       slave_hosts,
+      data_center,
       participating_instances,
       lost_slaves,
       all_errors,
@@ -532,7 +662,8 @@ func readRecoveries(whereCondition string, limit string, args []interface{}) ([]
       acknowledged_at,
       acknowledged_by,
       acknowledge_comment,
-      last_detection_id
+      last_detection_id,
+      ifnull(approval_uid, '') as approval_uid
 		from
 			topology_recovery
 		%s
@@ -559,6 +690,7 @@ func readRecoveries(whereCondition string, limit string, args []interface{}) ([]
 		topologyRecovery.AnalysisEntry.ClusterDetails.ClusterAlias = m.GetString("cluster_alias")
 		topologyRecovery.AnalysisEntry.CountReplicas = m.GetUint("count_affected_slaves")
 		topologyRecovery.AnalysisEntry.ReadReplicaHostsFromString(m.GetString("slave_hosts"))
+		topologyRecovery.AnalysisEntry.AnalyzedInstanceDataCenter = m.GetString("data_center")
 
 		topologyRecovery.SuccessorKey = &inst.InstanceKey{}
 		topologyRecovery.SuccessorKey.Hostname = m.GetString("successor_hostname")
@@ -577,6 +709,7 @@ func readRecoveries(whereCondition string, limit string, args []interface{}) ([]
 		topologyRecovery.AcknowledgedComment = m.GetString("acknowledge_comment")
 
 		topologyRecovery.LastDetectionId = m.GetInt64("last_detection_id")
+		topologyRecovery.RecoveryApprovalUID = m.GetString("approval_uid")
 
 		res = append(res, topologyRecovery)
 		return nil
@@ -585,6 +718,16 @@ func readRecoveries(whereCondition string, limit string, args []interface{}) ([]
 	return res, log.Errore(err)
 }
 
+// ReadRecoveriesWithinPeriod reads recoveries which started within given number of seconds, optionally
+// filtered by data center of failed instance (empty to unfilter)
+func ReadRecoveriesWithinPeriod(dataCenter string, periodSeconds int) ([]TopologyRecovery, error) {
+	whereClause := `
+		where
+			start_active_period >= NOW() - interval ? second
+			and ? IN ('', data_center)`
+	return readRecoveries(whereClause, ``, sqlutils.Args(periodSeconds, dataCenter))
+}
+
 // ReadActiveRecoveries reads active recovery entry/audit entries from topology_recovery
 func ReadActiveClusterRecovery(clusterName string) ([]TopologyRecovery, error) {
 	whereClause := `
@@ -850,6 +993,49 @@ func ReadTopologyRecoverySteps(recoveryUID string) ([]TopologyRecoveryStep, erro
 	return res, log.Errore(err)
 }
 
+// writeTopologyRecoveryBundle writes down the artifacts bundle of a recovery
+func writeTopologyRecoveryBundle(bundle *TopologyRecoveryBundle) error {
+	b, err := json.Marshal(bundle)
+	if err != nil {
+		return log.Errore(err)
+	}
+	_, err = db.ExecOrchestrator(`
+			insert
+				into topology_recovery_bundle (
+					recovery_uid, bundle, last_updated
+				) values (?, ?, now())
+				on duplicate key update
+					bundle=values(bundle),
+					last_updated=values(last_updated)
+			`, bundle.RecoveryUID, string(b),
+	)
+	return log.Errore(err)
+}
+
+// ReadTopologyRecoveryBundle reads the artifacts bundle of a given recovery
+func ReadTopologyRecoveryBundle(recoveryUID string) (*TopologyRecoveryBundle, error) {
+	var bundle *TopologyRecoveryBundle
+	query := `
+		select
+			bundle
+		from
+			topology_recovery_bundle
+		where
+			recovery_uid=?
+		`
+	err := db.QueryOrchestrator(query, sqlutils.Args(recoveryUID), func(m sqlutils.RowMap) error {
+		bundle = NewTopologyRecoveryBundle(recoveryUID, inst.ReplicationAnalysis{})
+		return json.Unmarshal([]byte(m.GetString("bundle")), bundle)
+	})
+	if err != nil {
+		return nil, log.Errore(err)
+	}
+	if bundle == nil {
+		return nil, fmt.Errorf("No bundle found for recovery %s", recoveryUID)
+	}
+	return bundle, nil
+}
+
 // ExpireFailureDetectionHistory removes old rows from the topology_failure_detection table
 func ExpireFailureDetectionHistory() error {
 	return inst.ExpireTableData("topology_failure_detection", "start_active_period")
@@ -864,3 +1050,8 @@ func ExpireTopologyRecoveryHistory() error {
 func ExpireTopologyRecoveryStepsHistory() error {
 	return inst.ExpireTableData("topology_recovery_steps", "audit_at")
 }
+
+// ExpireTopologyRecoveryBundleHistory removes old rows from the topology_recovery_bundle table
+func ExpireTopologyRecoveryBundleHistory() error {
+	return inst.ExpireTableData("topology_recovery_bundle", "last_updated")
+}
@@ -0,0 +1,57 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"testing"
+
+	"github.com/github/orchestrator/go/inst"
+	"github.com/github/orchestrator/go/process"
+	test "github.com/openark/golib/tests"
+)
+
+func TestWriteTopologyRecovery(t *testing.T) {
+	withSQLiteBackend(t)
+
+	analysisEntry := inst.ReplicationAnalysis{
+		AnalyzedInstanceKey:        inst.InstanceKey{Hostname: "recovered-master", Port: 3306},
+		Analysis:                   inst.DeadMaster,
+		AnalyzedInstanceDataCenter: "dc1",
+		CountReplicas:              2,
+	}
+	analysisEntry.ClusterDetails.ClusterName = "recovered-master:3306"
+	analysisEntry.ClusterDetails.ClusterAlias = "recovered"
+	topologyRecovery, err := writeTopologyRecovery(NewTopologyRecovery(analysisEntry))
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectNotNil(topologyRecovery)
+
+	recoveries, err := ReadRecoveriesForClusterAlias("recovered")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(recoveries), 1)
+	recovery := &recoveries[0]
+	test.S(t).ExpectEquals(recovery.UID, topologyRecovery.UID)
+	test.S(t).ExpectTrue(recovery.IsActive)
+	test.S(t).ExpectEquals(recovery.ProcessingNodeHostname, process.ThisHostname)
+	test.S(t).ExpectEquals(string(recovery.AnalysisEntry.Analysis), string(inst.DeadMaster))
+	test.S(t).ExpectEquals(recovery.AnalysisEntry.ClusterDetails.ClusterName, "recovered-master:3306")
+	test.S(t).ExpectEquals(recovery.AnalysisEntry.CountReplicas, uint(2))
+	test.S(t).ExpectEquals(recovery.AnalysisEntry.AnalyzedInstanceDataCenter, "dc1")
+
+	inActivePeriod, err := ReadInActivePeriodClusterRecovery("recovered-master:3306")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(inActivePeriod), 1)
+}
@@ -0,0 +1,101 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+func TestExecuteEventProcesses(t *testing.T) {
+	outputFile := filepath.Join(t.TempDir(), "hooks.out")
+	processes := []string{
+		fmt.Sprintf("echo {clusterAlias} $ORC_CLUSTER_ALIAS {pool} >> %s", outputFile),
+		"false",
+		fmt.Sprintf("echo {orchestratorHost} {unknown} >> %s", outputFile),
+	}
+	err := executeEventProcesses(processes, "TestEventProcesses", []hookVariable{
+		{"clusterAlias", "ORC_CLUSTER_ALIAS", "mycluster"},
+		{"pool", "ORC_POOL", "reporting"},
+	})
+	// A failing hook is reported, but does not stop further hooks
+	test.S(t).ExpectNotNil(err)
+
+	output, err := ioutil.ReadFile(outputFile)
+	test.S(t).ExpectNil(err)
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	test.S(t).ExpectEquals(len(lines), 2)
+	test.S(t).ExpectEquals(lines[0], "mycluster mycluster reporting")
+	test.S(t).ExpectTrue(strings.HasSuffix(lines[1], " {unknown}"))
+}
+
+func TestNotificationDeduplication(t *testing.T) {
+	withSQLiteBackend(t)
+	deduplicationSeconds := config.Config.NotificationDeduplicationSeconds
+	defer func() { config.Config.NotificationDeduplicationSeconds = deduplicationSeconds }()
+	config.Config.NotificationDeduplicationSeconds = 60
+
+	outputFile := filepath.Join(t.TempDir(), "hooks.out")
+	processes := []string{fmt.Sprintf("echo $ORC_FAILED_HOST $ORC_FAILURE_TYPE >> %s", outputFile)}
+	notify := func(clusterName string, failedHost string, analysis inst.AnalysisCode) {
+		analysisEntry := inst.ReplicationAnalysis{AnalyzedInstanceKey: inst.InstanceKey{Hostname: failedHost, Port: 3306}, Analysis: analysis}
+		analysisEntry.ClusterDetails.ClusterName = clusterName
+		executeProcesses(processes, "OnFailureDetectionProcesses", NewTopologyRecovery(analysisEntry), false)
+	}
+	notify("db-1:3306", "db-1", inst.DeadMaster)
+	notify("db-1:3306", "db-1", inst.DeadMaster)
+	notify("db-1:3306", "db-1", inst.UnreachableMaster)
+	notify("db-1:3306", "db-2", inst.DeadMaster)
+	notify("db-7:3306", "db-1", inst.DeadMaster)
+
+	// The command does not change across failures; only the repeated notification of the same failure is skipped
+	output, err := ioutil.ReadFile(outputFile)
+	test.S(t).ExpectNil(err)
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	test.S(t).ExpectEquals(len(lines), 4)
+	test.S(t).ExpectEquals(lines[0], "db-1 DeadMaster")
+	test.S(t).ExpectEquals(lines[1], "db-1 UnreachableMaster")
+	test.S(t).ExpectEquals(lines[2], "db-2 DeadMaster")
+}
+
+func TestIsDeadPassiveCoMaster(t *testing.T) {
+	withSQLiteBackend(t)
+	activeKey := inst.InstanceKey{Hostname: "active-co-master", Port: 3306}
+	passiveKey := inst.InstanceKey{Hostname: "passive-co-master", Port: 3306}
+	writeTestInstance(t, activeKey, passiveKey, "active-co-master:3306")
+	writeTestInstance(t, passiveKey, activeKey, "active-co-master:3306")
+	activeCoMaster, _, err := inst.ReadInstance(&activeKey)
+	test.S(t).ExpectNil(err)
+
+	// both writeable: there is no telling which co-master is the active master
+	test.S(t).ExpectFalse(isDeadPassiveCoMaster(&passiveKey, activeCoMaster))
+
+	setTestReadOnly(t, passiveKey.Hostname, true)
+	test.S(t).ExpectTrue(isDeadPassiveCoMaster(&passiveKey, activeCoMaster))
+
+	// the dead co-master was the active master
+	passiveCoMaster, _, err := inst.ReadInstance(&passiveKey)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectFalse(isDeadPassiveCoMaster(&activeKey, passiveCoMaster))
+}
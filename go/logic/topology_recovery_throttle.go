@@ -0,0 +1,93 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/openark/golib/log"
+	"github.com/patrickmn/go-cache"
+)
+
+// throttledRecoveryReasons maps a throttled analysis onto the reason it was last throttled for, such that the throttle
+// is audited as it changes, and not on every recovery check
+var throttledRecoveryReasons = cache.New(time.Hour, time.Minute)
+
+// getRecoveryThrottleBlockingRecoveries checks whether an automated recovery should be throttled, given the
+// number of recent recoveries, globally and in the data center of the failed instance.
+// It returns the recent recoveries which exceed the allowed rate, or an empty list if the recovery may proceed.
+func getRecoveryThrottleBlockingRecoveries(analysisEntry *inst.ReplicationAnalysis) (blockingRecoveries []TopologyRecovery, reason string, err error) {
+	if config.Config.RecoveryThrottleMaxRecoveries > 0 {
+		recoveries, err := ReadRecoveriesWithinPeriod("", config.Config.RecoveryThrottlePeriodSeconds)
+		if err != nil {
+			return blockingRecoveries, reason, err
+		}
+		if len(recoveries) >= config.Config.RecoveryThrottleMaxRecoveries {
+			reason = fmt.Sprintf("%d recoveries within last %d seconds; RecoveryThrottleMaxRecoveries is %d", len(recoveries), config.Config.RecoveryThrottlePeriodSeconds, config.Config.RecoveryThrottleMaxRecoveries)
+			return recoveries, reason, nil
+		}
+	}
+	if config.Config.RecoveryThrottleMaxRecoveriesPerDC > 0 && analysisEntry.AnalyzedInstanceDataCenter != "" {
+		recoveries, err := ReadRecoveriesWithinPeriod(analysisEntry.AnalyzedInstanceDataCenter, config.Config.RecoveryThrottlePeriodSeconds)
+		if err != nil {
+			return blockingRecoveries, reason, err
+		}
+		if len(recoveries) >= config.Config.RecoveryThrottleMaxRecoveriesPerDC {
+			reason = fmt.Sprintf("%d recoveries in data center %s within last %d seconds; RecoveryThrottleMaxRecoveriesPerDC is %d", len(recoveries), analysisEntry.AnalyzedInstanceDataCenter, config.Config.RecoveryThrottlePeriodSeconds, config.Config.RecoveryThrottleMaxRecoveriesPerDC)
+			return recoveries, reason, nil
+		}
+	}
+	return blockingRecoveries, reason, nil
+}
+
+func recoveryThrottleKey(analysisEntry *inst.ReplicationAnalysis) string {
+	return fmt.Sprintf("%s/%s", analysisEntry.AnalyzedInstanceKey.StringCode(), analysisEntry.Analysis)
+}
+
+// auditRecoveryThrottle audits a throttled recovery, unless already audited for the same reason
+func auditRecoveryThrottle(analysisEntry *inst.ReplicationAnalysis, reason string) {
+	throttleKey := recoveryThrottleKey(analysisEntry)
+	if previousReason, found := throttledRecoveryReasons.Get(throttleKey); !found || previousReason.(string) != reason {
+		log.Warningf("Recovery of %+v (%+v) is throttled: %s. A manual recovery is required", analysisEntry.AnalyzedInstanceKey, analysisEntry.Analysis, reason)
+		inst.AuditOperation("recovery-throttled", &analysisEntry.AnalyzedInstanceKey, fmt.Sprintf("%+v: %s", analysisEntry.Analysis, reason))
+	}
+	throttledRecoveryReasons.Set(throttleKey, reason, cache.DefaultExpiration)
+}
+
+// isRecoveryThrottled returns true when an automated recovery must not proceed, due to too many recent recoveries.
+// Such a recovery is registered as blocked, and awaits a manual recovery.
+// This is checked early, so as to not run pre-recovery work in vain. The throttle is applied again by the recovery's
+// registration, atomically, so that concurrent recoveries cannot all pass it. A failure to read recent recoveries
+// throttles the recovery: a manual recovery is preferable to risking a recovery storm.
+func isRecoveryThrottled(analysisEntry *inst.ReplicationAnalysis) bool {
+	blockingRecoveries, reason, err := getRecoveryThrottleBlockingRecoveries(analysisEntry)
+	if err != nil {
+		log.Errore(err)
+		auditRecoveryThrottle(analysisEntry, fmt.Sprintf("unable to read recent recoveries: %+v", err))
+		return true
+	}
+	if len(blockingRecoveries) == 0 {
+		throttledRecoveryReasons.Delete(recoveryThrottleKey(analysisEntry))
+		return false
+	}
+	auditRecoveryThrottle(analysisEntry, reason)
+	RegisterBlockedRecoveries(analysisEntry, blockingRecoveries)
+	return true
+}
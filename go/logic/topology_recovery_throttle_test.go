@@ -0,0 +1,126 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/openark/golib/sqlutils"
+	test "github.com/openark/golib/tests"
+)
+
+// countThrottleAudits returns the number of audited recovery throttles
+func countThrottleAudits(t *testing.T) (count int) {
+	err := db.QueryOrchestrator(`select count(*) as count_audits from audit where audit_type = 'recovery-throttled'`, sqlutils.Args(), func(m sqlutils.RowMap) error {
+		count = m.GetInt("count_audits")
+		return nil
+	})
+	test.S(t).ExpectNil(err)
+	return count
+}
+
+func TestIsRecoveryThrottled(t *testing.T) {
+	withSQLiteBackend(t)
+	maxRecoveries, auditToBackendDB := config.Config.RecoveryThrottleMaxRecoveries, config.Config.AuditToBackendDB
+	defer func() {
+		config.Config.RecoveryThrottleMaxRecoveries, config.Config.AuditToBackendDB = maxRecoveries, auditToBackendDB
+	}()
+	config.Config.RecoveryThrottleMaxRecoveries = 2
+	config.Config.AuditToBackendDB = true
+
+	analysisEntry := inst.ReplicationAnalysis{AnalyzedInstanceKey: inst.InstanceKey{Hostname: "throttled-master", Port: 3306}, Analysis: inst.DeadMaster}
+	analysisEntry.ClusterDetails.ClusterName = "throttled-master:3306"
+
+	writeTestActiveRecovery(t, inst.InstanceKey{Hostname: "fenced-master", Port: 3306}, inst.DeadMaster, "fenced")
+	test.S(t).ExpectFalse(isRecoveryThrottled(&analysisEntry))
+	test.S(t).ExpectEquals(countThrottleAudits(t), 0)
+
+	writeTestActiveRecovery(t, inst.InstanceKey{Hostname: "fenced-master", Port: 3307}, inst.DeadMaster, "fenced")
+	for i := 0; i < 3; i++ {
+		test.S(t).ExpectTrue(isRecoveryThrottled(&analysisEntry))
+	}
+	// Audited once, however many times the recovery is checked
+	test.S(t).ExpectEquals(countThrottleAudits(t), 1)
+
+	// ... and once again as the reason changes
+	writeTestActiveRecovery(t, inst.InstanceKey{Hostname: "fenced-master", Port: 3308}, inst.DeadMaster, "fenced")
+	test.S(t).ExpectTrue(isRecoveryThrottled(&analysisEntry))
+	test.S(t).ExpectTrue(isRecoveryThrottled(&analysisEntry))
+	test.S(t).ExpectEquals(countThrottleAudits(t), 2)
+
+	// ... and once again as the throttle lifts and kicks in again
+	config.Config.RecoveryThrottleMaxRecoveries = 4
+	test.S(t).ExpectFalse(isRecoveryThrottled(&analysisEntry))
+	config.Config.RecoveryThrottleMaxRecoveries = 2
+	test.S(t).ExpectTrue(isRecoveryThrottled(&analysisEntry))
+	test.S(t).ExpectEquals(countThrottleAudits(t), 3)
+}
+
+func TestAttemptRecoveryRegistrationThrottlesConcurrentRecoveries(t *testing.T) {
+	withSQLiteBackend(t)
+	maxRecoveries := config.Config.RecoveryThrottleMaxRecoveries
+	defer func() { config.Config.RecoveryThrottleMaxRecoveries = maxRecoveries }()
+	config.Config.RecoveryThrottleMaxRecoveries = 2
+
+	// All recoveries pass the early check before any registers; only the allowed number may register
+	var countRegistered int64
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		analysisEntry := inst.ReplicationAnalysis{AnalyzedInstanceKey: inst.InstanceKey{Hostname: fmt.Sprintf("throttled-master-%d", i), Port: 3306}, Analysis: inst.DeadMaster}
+		analysisEntry.ClusterDetails.ClusterName = fmt.Sprintf("throttled-master-%d:3306", i)
+		analysisEntry.ClusterDetails.ClusterAlias = fmt.Sprintf("throttled-%d", i)
+		test.S(t).ExpectFalse(isRecoveryThrottled(&analysisEntry))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if topologyRecovery, _ := AttemptRecoveryRegistration(&analysisEntry, true, true); topologyRecovery != nil {
+				atomic.AddInt64(&countRegistered, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	test.S(t).ExpectEquals(countRegistered, int64(2))
+
+	// A manual recovery is not throttled
+	analysisEntry := inst.ReplicationAnalysis{AnalyzedInstanceKey: inst.InstanceKey{Hostname: "manual-master", Port: 3306}, Analysis: inst.DeadMaster}
+	analysisEntry.ClusterDetails.ClusterName = "manual-master:3306"
+	topologyRecovery, err := AttemptRecoveryRegistration(&analysisEntry, false, false)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectNotNil(topologyRecovery)
+}
+
+func TestIsRecoveryThrottledOnReadError(t *testing.T) {
+	withSQLiteBackend(t)
+	maxRecoveries, auditToBackendDB := config.Config.RecoveryThrottleMaxRecoveries, config.Config.AuditToBackendDB
+	defer func() {
+		config.Config.RecoveryThrottleMaxRecoveries, config.Config.AuditToBackendDB = maxRecoveries, auditToBackendDB
+	}()
+	config.Config.RecoveryThrottleMaxRecoveries = 2
+	config.Config.AuditToBackendDB = true
+
+	_, err := db.ExecOrchestrator(`drop table topology_recovery`)
+	test.S(t).ExpectNil(err)
+	analysisEntry := inst.ReplicationAnalysis{AnalyzedInstanceKey: inst.InstanceKey{Hostname: "throttled-master", Port: 3306}, Analysis: inst.DeadMaster}
+	test.S(t).ExpectTrue(isRecoveryThrottled(&analysisEntry))
+	test.S(t).ExpectEquals(countThrottleAudits(t), 1)
+}
@@ -0,0 +1,140 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"sync"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/openark/golib/log"
+)
+
+// unreconciledReplicasReported lists the unreconciled replicas found by the previous check
+var unreconciledReplicasReported = make(map[string]bool)
+var unreconciledReplicasReportedMutex sync.Mutex
+
+// unreconciledReplicasPersisting lists the unreconciled replicas found by the two most recent checks
+var unreconciledReplicasPersisting = []inst.UnreconciledReplica{}
+
+// DiscoverUnreconciledReplicas re-discovers the unreconciled replicas of given cluster, along with the masters listing
+// them, and returns those which remain unreconciled
+func DiscoverUnreconciledReplicas(clusterName string) (remaining []inst.UnreconciledReplica, err error) {
+	unreconciled, err := inst.ReadUnreconciledReplicas(clusterName)
+	if err != nil {
+		return remaining, err
+	}
+	if len(unreconciled) == 0 {
+		return unreconciled, nil
+	}
+	rediscoverUnreconciledReplicas(unreconciled)
+	return inst.ReadUnreconciledReplicas(clusterName)
+}
+
+// rediscoverUnreconciledReplicas discovers given replicas and the masters listing them: an unregistered replica is
+// thus registered, given it can be reached, and stale information on either side is refreshed
+func rediscoverUnreconciledReplicas(unreconciled []inst.UnreconciledReplica) {
+	masterKeys := inst.NewInstanceKeyMap()
+	for _, entry := range unreconciled {
+		DiscoverInstance(entry.Key)
+		masterKeys.AddKey(entry.MasterKey)
+	}
+	for _, masterKey := range masterKeys.GetInstanceKeys() {
+		DiscoverInstance(masterKey)
+	}
+}
+
+// CheckUnreconciledReplicas reconciles, on the leader, the replicas masters list as connected with the replicas known
+// to orchestrator. Since discovery of a newly connected replica may be under way, a replica is only reported once
+// found unreconciled by two consecutive checks. With UnreconciledReplicasAutoDiscover, reported replicas are then
+// re-discovered.
+func CheckUnreconciledReplicas() {
+	if !IsLeader() {
+		return
+	}
+	unreconciled, err := inst.ReadAllUnreconciledReplicas()
+	if err != nil {
+		log.Errore(err)
+		return
+	}
+	found := make(map[string]bool)
+	for _, entry := range unreconciled {
+		found[entry.String()] = true
+	}
+	unreconciledReplicasReportedMutex.Lock()
+	previouslyFound := unreconciledReplicasReported
+	unreconciledReplicasReported = found
+	persisting := []inst.UnreconciledReplica{}
+	for _, entry := range unreconciled {
+		if previouslyFound[entry.String()] {
+			persisting = append(persisting, entry)
+		}
+	}
+	unreconciledReplicasPersisting = persisting
+	unreconciledReplicasReportedMutex.Unlock()
+
+	for _, entry := range persisting {
+		log.Warningf("Unreconciled replica on cluster %s: %s", entry.ClusterName, entry.String())
+	}
+	if config.Config.UnreconciledReplicasAutoDiscover && len(persisting) > 0 {
+		rediscoverUnreconciledReplicas(persisting)
+	}
+}
+
+// ReadPersistingUnreconciledReplicas returns the unreconciled replicas reported by the latest check
+func ReadPersistingUnreconciledReplicas() []inst.UnreconciledReplica {
+	unreconciledReplicasReportedMutex.Lock()
+	defer unreconciledReplicasReportedMutex.Unlock()
+
+	return append([]inst.UnreconciledReplica{}, unreconciledReplicasPersisting...)
+}
+
+// AddUnreconciledReplicaProblems lists the unreconciled replicas of given problem instances, and adds those masters
+// listing unreconciled replicas which are not already listed. Downtimed and ignored instances are not added.
+func AddUnreconciledReplicaProblems(instances [](*inst.Instance), clusterName string) ([](*inst.Instance), error) {
+	unreconciled := ReadPersistingUnreconciledReplicas()
+	if len(unreconciled) == 0 {
+		return instances, nil
+	}
+	listed := inst.NewInstanceKeyMap()
+	for _, instance := range instances {
+		listed.AddKey(instance.Key)
+	}
+	unreconciledReplicas := make(map[inst.InstanceKey][]string)
+	for _, entry := range unreconciled {
+		unreconciledReplicas[entry.MasterKey] = append(unreconciledReplicas[entry.MasterKey], entry.String())
+		if listed.HasKey(entry.MasterKey) {
+			continue
+		}
+		instance, found, err := inst.ReadInstance(&entry.MasterKey)
+		if err != nil {
+			return instances, err
+		}
+		if !found || instance.IsDowntimed || inst.RegexpMatchPatterns(instance.Key.Hostname, config.Config.ProblemIgnoreHostnameFilters) {
+			continue
+		}
+		if clusterName != "" && instance.ClusterName != clusterName {
+			continue
+		}
+		listed.AddKey(instance.Key)
+		instances = append(instances, instance)
+	}
+	for _, instance := range instances {
+		instance.UnreconciledReplicas = unreconciledReplicas[instance.Key]
+	}
+	return instances, nil
+}
@@ -0,0 +1,80 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+func TestAddUnreconciledReplicaProblems(t *testing.T) {
+	withSQLiteBackend(t)
+	atomic.StoreInt64(&isElectedNode, 1)
+	defer atomic.StoreInt64(&isElectedNode, 0)
+	defer func() {
+		unreconciledReplicasReported = make(map[string]bool)
+		unreconciledReplicasPersisting = []inst.UnreconciledReplica{}
+	}()
+
+	// Each master lists a replica unknown to orchestrator
+	shopMasterKey := inst.InstanceKey{Hostname: "db-1", Port: 3306}
+	booksMasterKey := inst.InstanceKey{Hostname: "db-7", Port: 3306}
+	writeTestInstance(t, shopMasterKey, inst.InstanceKey{}, "db-1:3306")
+	writeTestInstance(t, booksMasterKey, inst.InstanceKey{}, "db-7:3306")
+	_, err := db.ExecOrchestrator(`update database_instance set num_slave_hosts=1, slave_hosts=? where hostname in (?, ?)`,
+		`[{"Hostname":"ghost","Port":3306}]`, shopMasterKey.Hostname, booksMasterKey.Hostname,
+	)
+	test.S(t).ExpectNil(err)
+
+	// A single check does not report the replicas: their discovery may be under way
+	CheckUnreconciledReplicas()
+	test.S(t).ExpectEquals(len(ReadPersistingUnreconciledReplicas()), 0)
+	instances, err := AddUnreconciledReplicaProblems([](*inst.Instance){}, "")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(instances), 0)
+
+	CheckUnreconciledReplicas()
+	test.S(t).ExpectEquals(len(ReadPersistingUnreconciledReplicas()), 2)
+
+	instances, err = AddUnreconciledReplicaProblems([](*inst.Instance){}, "")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(instances), 2)
+	for _, instance := range instances {
+		test.S(t).ExpectEquals(len(instance.UnreconciledReplicas), 1)
+	}
+
+	// An already listed master is not listed twice
+	shopMaster, _, err := inst.ReadInstance(&shopMasterKey)
+	test.S(t).ExpectNil(err)
+	instances, err = AddUnreconciledReplicaProblems([](*inst.Instance){shopMaster}, "db-1:3306")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(instances), 1)
+	test.S(t).ExpectEquals(instances[0].Key, shopMasterKey)
+	test.S(t).ExpectEquals(instances[0].UnreconciledReplicas[0], "ghost:3306: connected to db-1:3306, unregistered")
+
+	// Once the replica is gone, the next check clears the problem
+	_, err = db.ExecOrchestrator(`update database_instance set num_slave_hosts=0, slave_hosts='[]'`)
+	test.S(t).ExpectNil(err)
+	CheckUnreconciledReplicas()
+	instances, err = AddUnreconciledReplicaProblems([](*inst.Instance){}, "")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(instances), 0)
+}
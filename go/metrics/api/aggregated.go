@@ -0,0 +1,90 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package api
+
+import (
+	"sort"
+	"time"
+
+	"github.com/montanaflynn/stats"
+
+	"github.com/github/orchestrator/go/collection"
+)
+
+// AggregatedRouteMetrics are the aggregated metrics of a single API route
+type AggregatedRouteMetrics struct {
+	Route                string
+	Count                int
+	ErrorCount           int
+	ErrorRate            float64
+	MeanLatencySeconds   float64
+	MedianLatencySeconds float64
+	P95LatencySeconds    float64
+	P99LatencySeconds    float64
+	MaxLatencySeconds    float64
+}
+
+// aggregateRoute aggregates the metrics of a single route
+func aggregateRoute(route string, metrics []*Metric) AggregatedRouteMetrics {
+	a := AggregatedRouteMetrics{Route: route, Count: len(metrics)}
+	latencies := stats.Float64Data{}
+	for _, m := range metrics {
+		if m.IsError() {
+			a.ErrorCount++
+		}
+		latencies = append(latencies, m.Latency.Seconds())
+	}
+	if a.Count > 0 {
+		a.ErrorRate = float64(a.ErrorCount) / float64(a.Count)
+	}
+	if s, err := stats.Mean(latencies); err == nil {
+		a.MeanLatencySeconds = s
+	}
+	if s, err := stats.Median(latencies); err == nil {
+		a.MedianLatencySeconds = s
+	}
+	if s, err := stats.Percentile(latencies, 95); err == nil {
+		a.P95LatencySeconds = s
+	}
+	if s, err := stats.Percentile(latencies, 99); err == nil {
+		a.P99LatencySeconds = s
+	}
+	if s, err := stats.Max(latencies); err == nil {
+		a.MaxLatencySeconds = s
+	}
+	return a
+}
+
+// AggregatedSince returns the aggregated API metrics per route, for requests received since given time,
+// sorted by route
+func AggregatedSince(c *collection.Collection, t time.Time) ([]AggregatedRouteMetrics, error) {
+	values, err := c.Since(t)
+	if err != nil {
+		return nil, err
+	}
+	metricsByRoute := make(map[string][]*Metric)
+	for _, v := range values {
+		m := v.(*Metric)
+		metricsByRoute[m.Route] = append(metricsByRoute[m.Route], m)
+	}
+	aggregated := []AggregatedRouteMetrics{}
+	for route, metrics := range metricsByRoute {
+		aggregated = append(aggregated, aggregateRoute(route, metrics))
+	}
+	sort.Slice(aggregated, func(i, j int) bool { return aggregated[i].Route < aggregated[j].Route })
+	return aggregated, nil
+}
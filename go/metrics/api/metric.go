@@ -0,0 +1,44 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package api
+
+/*
+  api holds metrics of HTTP API requests: the route requested, the time
+  taken serving the request, and the response status.
+*/
+import (
+	"time"
+)
+
+// Metric records a single HTTP API request
+type Metric struct {
+	Timestamp  time.Time     // time the request was received
+	Route      string        // the registered API path, e.g. "instance/:host/:port"
+	Method     string        // HTTP method
+	StatusCode int           // HTTP status of the response
+	Latency    time.Duration // time taken serving the request
+}
+
+// When records the timestamp of the start of the request
+func (m Metric) When() time.Time {
+	return m.Timestamp
+}
+
+// IsError returns true when the request failed
+func (m Metric) IsError() bool {
+	return m.StatusCode >= 400
+}
@@ -18,11 +18,16 @@ package os
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"os/user"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/github/orchestrator/go/config"
 	"github.com/openark/golib/log"
@@ -30,44 +35,155 @@ import (
 
 var EmptyEnv = []string{}
 
+// CommandResult holds the outcome of a single command execution: its output streams and exit code
+type CommandResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+	TimedOut bool
+}
+
+// CommandOptions are optional execution settings for a command
+type CommandOptions struct {
+	Timeout          time.Duration // Kill the command when running for longer than this. Zero for no timeout
+	WorkingDirectory string        // Directory in which to run the command
+	RunAsUser        string        // OS user to run the command as; only applicable when running as root
+	Stdin            []byte        // Input passed to the command on its stdin
+	StdinFileEnv     string        // When non-empty, Stdin is also written onto a temporary file, named by this environment variable
+}
+
 // CommandRun executes some text as a command. This is assumed to be
 // text that will be run by a shell so we need to write out the
 // command to a temporary file and then ask the shell to execute
 // it, after which the temporary file is removed.
 func CommandRun(commandText string, env []string, arguments ...string) error {
+	_, err := CommandRunWithResult(commandText, env, arguments...)
+	return err
+}
+
+// CommandRunWithResult is similar to CommandRun, and additionally returns the
+// command's output and exit code. The result is non-nil whenever the command
+// was actually executed, even if it failed.
+func CommandRunWithResult(commandText string, env []string, arguments ...string) (*CommandResult, error) {
+	return CommandRunWithOptions(commandText, env, &CommandOptions{}, arguments...)
+}
+
+// CommandRunWithOptions is similar to CommandRunWithResult, and further applies given execution options
+func CommandRunWithOptions(commandText string, env []string, options *CommandOptions, arguments ...string) (*CommandResult, error) {
 	// show the actual command we have been asked to run
 	log.Infof("CommandRun(%v,%+v)", commandText, arguments)
+	if options == nil {
+		options = &CommandOptions{}
+	}
 
 	cmd, shellScript, err := generateShellScript(commandText, env, arguments...)
 	defer os.Remove(shellScript)
 	if err != nil {
-		return log.Errore(err)
+		return nil, log.Errore(err)
+	}
+	ownedFiles := []string{shellScript}
+	if options.StdinFileEnv != "" {
+		stdinFile, err := generateStdinFile(options.Stdin)
+		defer os.Remove(stdinFile)
+		if err != nil {
+			return nil, log.Errore(err)
+		}
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", options.StdinFileEnv, stdinFile))
+		ownedFiles = append(ownedFiles, stdinFile)
+	}
+	if err := applyCommandOptions(cmd, ownedFiles, options); err != nil {
+		return nil, log.Errore(err)
 	}
 
 	cmdOutput := &bytes.Buffer{}
 	cmdError := &bytes.Buffer{}
 	cmd.Stdout = cmdOutput
 	cmd.Stderr = cmdError
+	if len(options.Stdin) > 0 {
+		cmd.Stdin = bytes.NewReader(options.Stdin)
+	}
 	var waitStatus syscall.WaitStatus
 
 	log.Infof("CommandRun/running: %s", strings.Join(cmd.Args, " "))
-	err = cmd.Run()
+	result := &CommandResult{ExitCode: -1}
+	var timedOut int64
+	err = cmd.Start()
+	if err == nil {
+		if options.Timeout > 0 {
+			timer := time.AfterFunc(options.Timeout, func() {
+				atomic.StoreInt64(&timedOut, 1)
+				// Kill the entire process group: the shell's children would otherwise hold on to its output,
+				// and the command would not return until they complete
+				syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+			})
+			defer timer.Stop()
+		}
+		err = cmd.Wait()
+	}
+	result.TimedOut = (atomic.LoadInt64(&timedOut) == 1)
 	logOutput("stdout", cmdOutput.Bytes())
 	logOutput("stderr", cmdError.Bytes())
+	result.Stdout = cmdOutput.String()
+	result.Stderr = cmdError.String()
 	if err != nil {
 		// Did the command fail because of an unsuccessful exit code
 		if exitError, ok := err.(*exec.ExitError); ok {
 			waitStatus = exitError.Sys().(syscall.WaitStatus)
+			result.ExitCode = waitStatus.ExitStatus()
 			log.Errorf("CommandRun: failed. exit status %d", waitStatus.ExitStatus())
 		}
+		if result.TimedOut {
+			return result, log.Errorf("CommandRun: timed out after %+v", options.Timeout)
+		}
 
-		return log.Errore(err)
+		return result, log.Errore(err)
 	}
 
 	// Command was successful
 	waitStatus = cmd.ProcessState.Sys().(syscall.WaitStatus)
+	result.ExitCode = waitStatus.ExitStatus()
 	log.Infof("CommandRun successful. exit status %d", waitStatus.ExitStatus())
 
+	return result, nil
+}
+
+// applyCommandOptions sets up working directory and credentials of a command. Files created for the command
+// are handed over to the user it runs as.
+func applyCommandOptions(cmd *exec.Cmd, ownedFiles []string, options *CommandOptions) error {
+	cmd.Dir = options.WorkingDirectory
+	if options.Timeout > 0 {
+		// The command runs in its own process group, such that a timeout kills any processes it spawned
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	}
+	if options.RunAsUser == "" {
+		return nil
+	}
+	if os.Geteuid() != 0 {
+		log.Warningf("CommandRun: not running as root; ignoring request to run as %s", options.RunAsUser)
+		return nil
+	}
+	runAsUser, err := user.Lookup(options.RunAsUser)
+	if err != nil {
+		return err
+	}
+	uid, err := strconv.ParseUint(runAsUser.Uid, 10, 32)
+	if err != nil {
+		return err
+	}
+	gid, err := strconv.ParseUint(runAsUser.Gid, 10, 32)
+	if err != nil {
+		return err
+	}
+	// The shell script, and stdin file, are created by, and only readable by, orchestrator's own user
+	for _, ownedFile := range ownedFiles {
+		if err := os.Chown(ownedFile, int(uid), int(gid)); err != nil {
+			return err
+		}
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
 	return nil
 }
 
@@ -94,6 +210,19 @@ func generateShellScript(commandText string, env []string, arguments ...string)
 	return cmd, tmpFile.Name(), nil
 }
 
+// generateStdinFile writes the input of a command onto a temporary file, readable by orchestrator's own user only
+func generateStdinFile(stdin []byte) (string, error) {
+	tmpFile, err := ioutil.TempFile("", "orchestrator-process-stdin-")
+	if err != nil {
+		return "", log.Errorf("generateStdinFile() failed to create TempFile: %v", err.Error())
+	}
+	defer tmpFile.Close()
+	if _, err := tmpFile.Write(stdin); err != nil {
+		return tmpFile.Name(), err
+	}
+	return tmpFile.Name(), nil
+}
+
 // log the output from the command. Provide an indication of what's being logged (e.g. stdout, stderr) as a name
 func logOutput(name string, output []byte) {
 	if len(output) == 0 {
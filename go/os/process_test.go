@@ -0,0 +1,54 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package os
+
+import (
+	"testing"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	test "github.com/openark/golib/tests"
+)
+
+func init() {
+	config.Config.ProcessesShellCommand = "sh"
+}
+
+func TestCommandRunWithStdin(t *testing.T) {
+	options := &CommandOptions{
+		Stdin:        []byte(`{"payloadVersion":2}`),
+		StdinFileEnv: "ORC_TEST_STDIN_FILE",
+	}
+	result, err := CommandRunWithOptions(`cat; echo; cat "$ORC_TEST_STDIN_FILE"`, EmptyEnv, options)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(result.Stdout, "{\"payloadVersion\":2}\n{\"payloadVersion\":2}")
+}
+
+func TestCommandRunWithoutStdin(t *testing.T) {
+	result, err := CommandRunWithOptions(`cat`, EmptyEnv, &CommandOptions{})
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(result.Stdout, "")
+}
+
+func TestCommandRunWithTimeout(t *testing.T) {
+	// The backgrounded sleep holds on to the shell's output, and must be killed along with the shell
+	startTime := time.Now()
+	result, err := CommandRunWithOptions(`sleep 30 & sleep 30`, EmptyEnv, &CommandOptions{Timeout: 500 * time.Millisecond})
+	test.S(t).ExpectNotNil(err)
+	test.S(t).ExpectTrue(result.TimedOut)
+	test.S(t).ExpectTrue(time.Since(startTime) < 10*time.Second)
+}
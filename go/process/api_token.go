@@ -0,0 +1,125 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package process
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/github/orchestrator/go/util"
+)
+
+// Operation classes an API token may be granted. Any token may read within the clusters it is restricted to.
+const (
+	APITokenOperationRead    = "read"
+	APITokenOperationWrite   = "write"
+	APITokenOperationRecover = "recover"
+)
+
+// APITokenAllClusters is a cluster filter matching all clusters
+const APITokenAllClusters = "*"
+
+const apiTokenIdLength = 16
+
+// APIToken is a bearer token for the HTTP API, limited to given clusters and operation classes.
+// Only a hash of the token's secret is ever stored.
+type APIToken struct {
+	TokenId          string
+	TokenHash        string
+	Owner            string
+	Description      string
+	ClusterFilters   []string
+	OperationClasses []string
+	CreatedTimestamp string
+}
+
+func hashAPITokenSecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+// NewAPIToken generates a new token. The returned bearer is presented by clients in an
+// "Authorization: Bearer" header, and cannot be recovered later on.
+func NewAPIToken(owner string, description string, clusterFilters []string, operationClasses []string) (token *APIToken, bearer string, err error) {
+	if len(clusterFilters) == 0 {
+		return nil, "", fmt.Errorf("NewAPIToken: at least one cluster filter is required; use %s for all clusters", APITokenAllClusters)
+	}
+	for _, class := range operationClasses {
+		switch class {
+		case APITokenOperationRead, APITokenOperationWrite, APITokenOperationRecover:
+		default:
+			return nil, "", fmt.Errorf("NewAPIToken: unknown operation class: %s. Expected one of %s, %s, %s", class, APITokenOperationRead, APITokenOperationWrite, APITokenOperationRecover)
+		}
+	}
+	secret := util.RandomHash()
+	token = &APIToken{
+		TokenId:          util.RandomHash()[0:apiTokenIdLength],
+		TokenHash:        hashAPITokenSecret(secret),
+		Owner:            owner,
+		Description:      description,
+		ClusterFilters:   clusterFilters,
+		OperationClasses: operationClasses,
+	}
+	return token, fmt.Sprintf("%s.%s", token.TokenId, secret), nil
+}
+
+// parseAPITokenBearer splits a bearer into token id and secret
+func parseAPITokenBearer(bearer string) (tokenId string, secret string, err error) {
+	tokens := strings.SplitN(bearer, ".", 2)
+	if len(tokens) != 2 || tokens[0] == "" || tokens[1] == "" {
+		return "", "", fmt.Errorf("Malformed API token")
+	}
+	return tokens[0], tokens[1], nil
+}
+
+// secretMatches checks given secret against the token's hash
+func (this *APIToken) secretMatches(secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(hashAPITokenSecret(secret)), []byte(this.TokenHash)) == 1
+}
+
+// AllowsOperationClass returns true when this token is granted given operation class
+func (this *APIToken) AllowsOperationClass(class string) bool {
+	if class == APITokenOperationRead {
+		return true
+	}
+	for _, operationClass := range this.OperationClasses {
+		if operationClass == class {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsAllClusters returns true when this token is not limited to specific clusters
+func (this *APIToken) AllowsAllClusters() bool {
+	for _, filter := range this.ClusterFilters {
+		if filter == APITokenAllClusters {
+			return true
+		}
+	}
+	return false
+}
+
+// Redacted returns a copy of this token which does not expose its hash
+func (this *APIToken) Redacted() APIToken {
+	redacted := *this
+	redacted.TokenHash = ""
+	return redacted
+}
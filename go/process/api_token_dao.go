@@ -0,0 +1,108 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/github/orchestrator/go/db"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+// WriteAPIToken persists given token
+func WriteAPIToken(token *APIToken) error {
+	clusterFilters, err := json.Marshal(token.ClusterFilters)
+	if err != nil {
+		return log.Errore(err)
+	}
+	_, err = db.ExecOrchestrator(`
+			replace into api_token (
+					token_id, token_hash, token_owner, description, cluster_filters, operation_classes, created_timestamp
+				) values (
+					?, ?, ?, ?, ?, ?, now()
+				)
+			`,
+		token.TokenId, token.TokenHash, token.Owner, token.Description, string(clusterFilters), strings.Join(token.OperationClasses, ","),
+	)
+	return log.Errore(err)
+}
+
+// DeleteAPIToken revokes a token
+func DeleteAPIToken(tokenId string) error {
+	_, err := db.ExecOrchestrator(`
+			delete from api_token where token_id = ?
+			`,
+		tokenId,
+	)
+	return log.Errore(err)
+}
+
+func readAPITokens(whereCondition string, args []interface{}) (tokens []APIToken, err error) {
+	query := fmt.Sprintf(`
+		select
+				token_id, token_hash, token_owner, description, cluster_filters, operation_classes, created_timestamp
+			from
+				api_token
+			%s
+			order by
+				created_timestamp, token_id
+		`, whereCondition)
+	err = db.QueryOrchestrator(query, args, func(m sqlutils.RowMap) error {
+		token := APIToken{
+			TokenId:          m.GetString("token_id"),
+			TokenHash:        m.GetString("token_hash"),
+			Owner:            m.GetString("token_owner"),
+			Description:      m.GetString("description"),
+			OperationClasses: []string{},
+			CreatedTimestamp: m.GetString("created_timestamp"),
+		}
+		if err := json.Unmarshal([]byte(m.GetString("cluster_filters")), &token.ClusterFilters); err != nil {
+			return log.Errore(err)
+		}
+		if operationClasses := m.GetString("operation_classes"); operationClasses != "" {
+			token.OperationClasses = strings.Split(operationClasses, ",")
+		}
+		tokens = append(tokens, token)
+		return nil
+	})
+	return tokens, log.Errore(err)
+}
+
+// ReadAPITokens returns all tokens
+func ReadAPITokens() (tokens []APIToken, err error) {
+	return readAPITokens("", sqlutils.Args())
+}
+
+// AuthenticateAPIToken validates a bearer, as presented in an "Authorization: Bearer" header, and
+// returns the token it belongs to
+func AuthenticateAPIToken(bearer string) (*APIToken, error) {
+	tokenId, secret, err := parseAPITokenBearer(bearer)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := readAPITokens("where token_id = ?", sqlutils.Args(tokenId))
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 || !tokens[0].secretMatches(secret) {
+		return nil, fmt.Errorf("Invalid API token")
+	}
+	return &tokens[0], nil
+}
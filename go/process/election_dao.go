@@ -27,6 +27,9 @@ import (
 
 // AttemptElection tries to grab leadership (become active node)
 func AttemptElection() (bool, error) {
+	if config.Config.LeaderLeaseElection {
+		return attemptLeaseElection()
+	}
 	{
 		sqlResult, err := db.ExecOrchestrator(`
 		insert ignore into active_node (
@@ -107,6 +110,9 @@ func GrabElection() error {
 	if orcraft.IsRaftEnabled() {
 		return log.Errorf("Cannot GrabElection on raft setup")
 	}
+	if config.Config.LeaderLeaseElection {
+		return grabLeaderLease()
+	}
 	_, err := db.ExecOrchestrator(`
 			replace into active_node (
 					anchor, hostname, token, first_seen_active, last_seen_active
@@ -124,13 +130,20 @@ func Reelect() error {
 	if orcraft.IsRaftEnabled() {
 		orcraft.StepDown()
 	}
+	if config.Config.LeaderLeaseElection {
+		return revokeLeaderLease()
+	}
 	_, err := db.ExecOrchestrator(`delete from active_node where anchor = 1`)
 	return log.Errore(err)
 }
 
 // ElectedNode returns the details of the elected node, as well as answering the question "is this process the elected one"?
 func ElectedNode() (node NodeHealth, isElected bool, err error) {
-	query := `
+	if config.Config.LeaderLeaseElection {
+		err = readLeaderLeaseNode(&node)
+		isElected = (node.Hostname == ThisHostname && node.Token == util.ProcessToken.Hash && IsLeaderLeaseValid())
+	} else {
+		query := `
 		select
 			hostname,
 			token,
@@ -141,15 +154,16 @@ func ElectedNode() (node NodeHealth, isElected bool, err error) {
 		where
 			anchor = 1
 		`
-	err = db.QueryOrchestratorRowsMap(query, func(m sqlutils.RowMap) error {
-		node.Hostname = m.GetString("hostname")
-		node.Token = m.GetString("token")
-		node.FirstSeenActive = m.GetString("first_seen_active")
-		node.LastSeenActive = m.GetString("last_seen_active")
+		err = db.QueryOrchestratorRowsMap(query, func(m sqlutils.RowMap) error {
+			node.Hostname = m.GetString("hostname")
+			node.Token = m.GetString("token")
+			node.FirstSeenActive = m.GetString("first_seen_active")
+			node.LastSeenActive = m.GetString("last_seen_active")
 
-		return nil
-	})
+			return nil
+		})
 
-	isElected = (node.Hostname == ThisHostname && node.Token == util.ProcessToken.Hash)
+		isElected = (node.Hostname == ThisHostname && node.Token == util.ProcessToken.Hash)
+	}
 	return node, isElected, log.Errore(err)
 }
@@ -17,11 +17,13 @@
 package process
 
 import (
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
 	"github.com/github/orchestrator/go/util"
 
 	"github.com/github/orchestrator/go/raft"
@@ -35,6 +37,10 @@ var LastContinousCheckHealthy int64
 
 var lastHealthCheckCache = cache.New(config.HealthPollSeconds*time.Second, time.Second)
 
+// healthProblems are problems this node reports about itself, by name
+var healthProblems = make(map[string]string)
+var healthProblemsMutex sync.Mutex
+
 type NodeHealth struct {
 	Hostname        string
 	Token           string
@@ -83,6 +89,9 @@ type HealthStatus struct {
 	RaftLeaderURI      string
 	RaftAdvertise      string
 	RaftHealthyMembers []string
+	LeaderLease        *LeaderLease // With LeaderLeaseElection
+	Backend            db.BackendStatus
+	Problems           []string
 }
 
 type OrchestratorExecutionMode string
@@ -113,6 +122,8 @@ func HealthTest() (health *HealthStatus, err error) {
 
 	health = &HealthStatus{Healthy: false, Hostname: ThisHostname, Token: util.ProcessToken.Hash}
 	defer lastHealthCheckCache.Set(cacheKey, health, cache.DefaultExpiration)
+	health.Backend = db.ReadBackendStatus()
+	health.Problems = ReadHealthProblems()
 
 	if healthy, err := RegisterNode(ThisNodeHealth); err != nil {
 		health.Error = err
@@ -134,12 +145,42 @@ func HealthTest() (health *HealthStatus, err error) {
 			health.Error = err
 			return health, log.Errore(err)
 		}
+		if config.Config.LeaderLeaseElection {
+			health.LeaderLease, _, _ = ReadLeaderLease()
+		}
 	}
 	health.AvailableNodes, err = ReadAvailableNodes(true)
 
 	return health, nil
 }
 
+// SetHealthProblem reports a problem of this node under given name. The problem is listed by the health check
+// until cleared.
+func SetHealthProblem(name string, description string) {
+	healthProblemsMutex.Lock()
+	defer healthProblemsMutex.Unlock()
+	healthProblems[name] = description
+}
+
+// ClearHealthProblem clears the problem reported under given name, if any
+func ClearHealthProblem(name string) {
+	healthProblemsMutex.Lock()
+	defer healthProblemsMutex.Unlock()
+	delete(healthProblems, name)
+}
+
+// ReadHealthProblems returns the problems this node currently reports about itself
+func ReadHealthProblems() []string {
+	healthProblemsMutex.Lock()
+	defer healthProblemsMutex.Unlock()
+	problems := []string{}
+	for _, description := range healthProblems {
+		problems = append(problems, description)
+	}
+	sort.Strings(problems)
+	return problems
+}
+
 func SinceLastHealthCheck() time.Duration {
 	timeNano := atomic.LoadInt64(&lastHealthCheckUnixNano)
 	if timeNano == 0 {
@@ -0,0 +1,82 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package process
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+)
+
+// LeaderLease is the lease held by the active node, with LeaderLeaseElection. The fencing token grows with each
+// change of leadership; operations of a node holding an outdated fencing token are rejected.
+type LeaderLease struct {
+	Hostname     string
+	Token        string
+	FencingToken int64
+	AcquiredAt   string
+	RenewedAt    string
+	ExpiresAt    string
+	IsExpired    bool
+}
+
+// heldLeaderLeaseFencingToken is the fencing token of the lease this node holds, or 0 when it holds none
+var heldLeaderLeaseFencingToken int64
+
+// heldLeaderLeaseValidUntil is the time, by this node's clock, until which the lease this node holds is valid
+var heldLeaderLeaseValidUntil int64
+
+// isLeaderLeaseCandidate is set once this node runs for the leader lease, as opposed to e.g. CLI invocations
+var isLeaderLeaseCandidate int64
+
+// leaderLeaseLocalValidity is the duration, counted from just before the lease is acquired or renewed, for which
+// this node considers its lease valid. It falls short of the lease duration, so that this node stops acting as
+// leader before any other node may take over.
+func leaderLeaseLocalValidity() time.Duration {
+	return time.Duration(config.Config.LeaderLeaseSeconds-config.HealthPollSeconds) * time.Second
+}
+
+func setHeldLeaderLease(fencingToken int64, validUntil time.Time) {
+	atomic.StoreInt64(&heldLeaderLeaseFencingToken, fencingToken)
+	atomic.StoreInt64(&heldLeaderLeaseValidUntil, validUntil.UnixNano())
+}
+
+func clearHeldLeaderLease() {
+	atomic.StoreInt64(&heldLeaderLeaseFencingToken, 0)
+	atomic.StoreInt64(&heldLeaderLeaseValidUntil, 0)
+}
+
+// HeldLeaderLeaseFencingToken returns the fencing token of the lease this node holds, or 0 when it holds none
+func HeldLeaderLeaseFencingToken() int64 {
+	return atomic.LoadInt64(&heldLeaderLeaseFencingToken)
+}
+
+// isLeaderLeaseFenced checks whether this node's operations are subject to its leader lease: with
+// LeaderLeaseElection, and once the node runs for the lease
+func isLeaderLeaseFenced() bool {
+	return config.Config.LeaderLeaseElection && atomic.LoadInt64(&isLeaderLeaseCandidate) == 1
+}
+
+// IsLeaderLeaseValid checks whether, with LeaderLeaseElection, this node holds a lease which has not expired by its
+// own clock. It is always true without LeaderLeaseElection.
+func IsLeaderLeaseValid() bool {
+	if !config.Config.LeaderLeaseElection {
+		return true
+	}
+	return HeldLeaderLeaseFencingToken() > 0 && time.Now().UnixNano() < atomic.LoadInt64(&heldLeaderLeaseValidUntil)
+}
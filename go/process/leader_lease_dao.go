@@ -0,0 +1,262 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package process
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/util"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+// execLeaderLeaseStatement executes a statement on the leader lease, and checks whether it affected a row
+func execLeaderLeaseStatement(query string, args ...interface{}) (bool, error) {
+	sqlResult, err := db.ExecOrchestrator(query, args...)
+	if err != nil {
+		return false, log.Errore(err)
+	}
+	rows, err := sqlResult.RowsAffected()
+	if err != nil {
+		return false, log.Errore(err)
+	}
+	return rows > 0, nil
+}
+
+// acquireHeldLeaderLease reads back the fencing token of the lease this node just acquired
+func acquireHeldLeaderLease(attemptedAt time.Time) (bool, error) {
+	lease, found, err := ReadLeaderLease()
+	if err != nil || !found || lease.Hostname != ThisHostname || lease.Token != util.ProcessToken.Hash {
+		clearHeldLeaderLease()
+		return false, err
+	}
+	if lease.FencingToken != HeldLeaderLeaseFencingToken() {
+		log.Infof("Acquired leader lease; fencing token: %d", lease.FencingToken)
+	}
+	setHeldLeaderLease(lease.FencingToken, attemptedAt.Add(leaderLeaseLocalValidity()))
+	return true, nil
+}
+
+// attemptLeaseElection renews the lease this node holds, or else acquires the lease if it is vacant or expired.
+// Acquiring the lease grows its fencing token.
+func attemptLeaseElection() (bool, error) {
+	atomic.StoreInt64(&isLeaderLeaseCandidate, 1)
+	attemptedAt := time.Now()
+	if fencingToken := HeldLeaderLeaseFencingToken(); fencingToken > 0 {
+		renewed, err := execLeaderLeaseStatement(`
+			update leader_lease set
+				renewed_at = now(),
+				expires_at = now() + interval ? second
+			where
+				anchor = 1
+				and hostname = ?
+				and token = ?
+				and fencing_token = ?
+				and expires_at >= now()
+			`, config.Config.LeaderLeaseSeconds, ThisHostname, util.ProcessToken.Hash, fencingToken,
+		)
+		if err != nil {
+			clearHeldLeaderLease()
+			return false, err
+		}
+		if renewed {
+			setHeldLeaderLease(fencingToken, attemptedAt.Add(leaderLeaseLocalValidity()))
+			return true, nil
+		}
+		log.Warningf("Lost leader lease; fencing token: %d", fencingToken)
+		clearHeldLeaderLease()
+	}
+	inserted, err := execLeaderLeaseStatement(`
+			insert ignore into leader_lease (
+				anchor, hostname, token, fencing_token, acquired_at, renewed_at, expires_at
+			) values (
+				1, ?, ?, 1, now(), now(), now() + interval ? second
+			)
+		`, ThisHostname, util.ProcessToken.Hash, config.Config.LeaderLeaseSeconds,
+	)
+	if err != nil {
+		return false, err
+	}
+	if inserted {
+		return acquireHeldLeaderLease(attemptedAt)
+	}
+	tookOver, err := execLeaderLeaseStatement(`
+			update leader_lease set
+				hostname = ?,
+				token = ?,
+				fencing_token = fencing_token + 1,
+				acquired_at = now(),
+				renewed_at = now(),
+				expires_at = now() + interval ? second
+			where
+				anchor = 1
+				and expires_at < now()
+		`, ThisHostname, util.ProcessToken.Hash, config.Config.LeaderLeaseSeconds,
+	)
+	if err != nil || !tookOver {
+		return false, err
+	}
+	return acquireHeldLeaderLease(attemptedAt)
+}
+
+// grabLeaderLease forcibly acquires the lease, whether or not another node holds it
+func grabLeaderLease() error {
+	attemptedAt := time.Now()
+	inserted, err := execLeaderLeaseStatement(`
+			insert ignore into leader_lease (
+				anchor, hostname, token, fencing_token, acquired_at, renewed_at, expires_at
+			) values (
+				1, ?, ?, 1, now(), now(), now() + interval ? second
+			)
+		`, ThisHostname, util.ProcessToken.Hash, config.Config.LeaderLeaseSeconds,
+	)
+	if err != nil {
+		return err
+	}
+	if !inserted {
+		if _, err := execLeaderLeaseStatement(`
+			update leader_lease set
+				hostname = ?,
+				token = ?,
+				fencing_token = fencing_token + 1,
+				acquired_at = now(),
+				renewed_at = now(),
+				expires_at = now() + interval ? second
+			where
+				anchor = 1
+			`, ThisHostname, util.ProcessToken.Hash, config.Config.LeaderLeaseSeconds,
+		); err != nil {
+			return err
+		}
+	}
+	_, err = acquireHeldLeaderLease(attemptedAt)
+	return err
+}
+
+// revokeLeaderLease clears the way for re-election. The fencing token grows, so that the holder fails renewing the
+// lease, and its operations are rejected right away. The lease is otherwise left to expire, upon which any node may
+// take over: the holder may still consider itself leader until then, by its own clock.
+func revokeLeaderLease() error {
+	clearHeldLeaderLease()
+	_, err := execLeaderLeaseStatement(`
+			update leader_lease set
+				fencing_token = fencing_token + 1
+			where
+				anchor = 1
+		`,
+	)
+	return err
+}
+
+// ReadLeaderLease reads the leader lease, as held by the active node
+func ReadLeaderLease() (lease *LeaderLease, found bool, err error) {
+	query := `
+		select
+			hostname,
+			token,
+			fencing_token,
+			acquired_at,
+			renewed_at,
+			expires_at,
+			expires_at < now() as is_expired
+		from
+			leader_lease
+		where
+			anchor = 1
+		`
+	err = db.QueryOrchestratorRowsMap(query, func(m sqlutils.RowMap) error {
+		lease = &LeaderLease{
+			Hostname:     m.GetString("hostname"),
+			Token:        m.GetString("token"),
+			FencingToken: m.GetInt64("fencing_token"),
+			AcquiredAt:   m.GetString("acquired_at"),
+			RenewedAt:    m.GetString("renewed_at"),
+			ExpiresAt:    m.GetString("expires_at"),
+			IsExpired:    m.GetBool("is_expired"),
+		}
+		found = true
+		return nil
+	})
+	return lease, found, log.Errore(err)
+}
+
+// readLeaderLeaseNode describes the holder of an unexpired leader lease as the active node
+func readLeaderLeaseNode(node *NodeHealth) error {
+	lease, found, err := ReadLeaderLease()
+	if err != nil || !found || lease.IsExpired {
+		return err
+	}
+	node.Hostname = lease.Hostname
+	node.Token = lease.Token
+	node.FirstSeenActive = lease.AcquiredAt
+	node.LastSeenActive = lease.RenewedAt
+	return nil
+}
+
+// VerifyLeaderLease rejects operations of a node holding an outdated lease: one whose fencing token was superseded,
+// or which expired, as well as of a node running for the lease yet holding none. Nodes which do not run for the
+// lease (e.g. CLI invocations) are not affected. This check is not atomic with any write; guarded writes use
+// LeaderLeaseFenceCondition.
+func VerifyLeaderLease() error {
+	if !isLeaderLeaseFenced() {
+		return nil
+	}
+	fencingToken := HeldLeaderLeaseFencingToken()
+	if fencingToken == 0 {
+		return fmt.Errorf("VerifyLeaderLease: this node holds no leader lease")
+	}
+	lease, found, err := ReadLeaderLease()
+	if err != nil {
+		return err
+	}
+	if !found || lease.FencingToken != fencingToken || lease.IsExpired || !IsLeaderLeaseValid() {
+		clearHeldLeaderLease()
+		return fmt.Errorf("VerifyLeaderLease: this node's leader lease (fencing token %d) is no longer valid", fencingToken)
+	}
+	return nil
+}
+
+// LeaderLeaseFenceCondition returns a condition, along with its arguments, which fences off writes of a node holding
+// an outdated lease: the condition only holds while this node's fencing token is current and its lease unexpired.
+// A guarded write includes the condition in its own statement, such that it cannot interleave with a change of
+// leadership. Nodes which do not run for the lease (e.g. CLI invocations) get an empty condition. A node holding
+// no lease, or whose lease expired by its own clock, gets an error.
+func LeaderLeaseFenceCondition() (condition string, args []interface{}, err error) {
+	if !isLeaderLeaseFenced() {
+		return "", args, nil
+	}
+	fencingToken := HeldLeaderLeaseFencingToken()
+	if fencingToken == 0 {
+		return "", args, fmt.Errorf("LeaderLeaseFenceCondition: this node holds no leader lease")
+	}
+	if !IsLeaderLeaseValid() {
+		return "", args, fmt.Errorf("LeaderLeaseFenceCondition: this node's leader lease (fencing token %d) has expired", fencingToken)
+	}
+	condition = `
+					exists (
+						select 1 from leader_lease
+						where
+							anchor = 1
+							and fencing_token = ?
+							and expires_at >= now()
+					)`
+	return condition, sqlutils.Args(fencingToken), nil
+}
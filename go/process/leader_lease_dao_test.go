@@ -0,0 +1,198 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package process
+
+import (
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/openark/golib/sqlutils"
+	test "github.com/openark/golib/tests"
+)
+
+// withSQLiteBackend points the orchestrator backend at a fresh sqlite database for the duration of given test
+func withSQLiteBackend(t *testing.T) {
+	backendDB, dataFile := config.Config.BackendDB, config.Config.SQLite3DataFile
+	config.Config.BackendDB = "sqlite"
+	config.Config.SQLite3DataFile = filepath.Join(t.TempDir(), "orchestrator.sqlite3")
+	t.Cleanup(func() {
+		config.Config.BackendDB, config.Config.SQLite3DataFile = backendDB, dataFile
+	})
+}
+
+// withLeaderLeaseElection enables LeaderLeaseElection for the duration of given test, with this node holding no lease
+func withLeaderLeaseElection(t *testing.T) {
+	withSQLiteBackend(t)
+	leaderLeaseElection, leaderLeaseSeconds := config.Config.LeaderLeaseElection, config.Config.LeaderLeaseSeconds
+	config.Config.LeaderLeaseElection = true
+	config.Config.LeaderLeaseSeconds = 10
+	t.Cleanup(func() {
+		config.Config.LeaderLeaseElection, config.Config.LeaderLeaseSeconds = leaderLeaseElection, leaderLeaseSeconds
+		atomic.StoreInt64(&isLeaderLeaseCandidate, 0)
+		clearHeldLeaderLease()
+	})
+}
+
+// setTestLeaderLease has another node acquire the lease, growing its fencing token, or else expires the lease
+func setTestLeaderLease(t *testing.T, hostname string, expired bool) {
+	query := `
+			update leader_lease set
+				hostname = ?,
+				token = ?,
+				fencing_token = fencing_token + 1,
+				acquired_at = now(),
+				renewed_at = now(),
+				expires_at = now() + interval 10 second
+			where
+				anchor = 1
+		`
+	args := sqlutils.Args(hostname, hostname)
+	if expired {
+		query = `update leader_lease set expires_at = now() - interval 1 second where anchor = 1`
+		args = nil
+	}
+	_, err := db.ExecOrchestrator(query, args...)
+	test.S(t).ExpectNil(err)
+}
+
+// isGuardedWriteAllowed checks whether a write guarded by this node's leader lease would apply
+func isGuardedWriteAllowed(t *testing.T) bool {
+	condition, args, err := LeaderLeaseFenceCondition()
+	if err != nil {
+		return false
+	}
+	if condition == "" {
+		return true
+	}
+	count := 0
+	err = db.QueryOrchestrator(`select count(*) as guarded from (select 1) as guarded_write where `+condition, args, func(m sqlutils.RowMap) error {
+		count = m.GetInt("guarded")
+		return nil
+	})
+	test.S(t).ExpectNil(err)
+	return count == 1
+}
+
+func TestAcquireLeaderLease(t *testing.T) {
+	withLeaderLeaseElection(t)
+
+	// Before running for the lease, this node's operations are not fenced
+	test.S(t).ExpectNil(VerifyLeaderLease())
+	test.S(t).ExpectTrue(isGuardedWriteAllowed(t))
+
+	acquired, err := attemptLeaseElection()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(acquired)
+	lease, found, err := ReadLeaderLease()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(found)
+	test.S(t).ExpectEquals(lease.Hostname, ThisHostname)
+	test.S(t).ExpectEquals(lease.FencingToken, int64(1))
+	test.S(t).ExpectFalse(lease.IsExpired)
+	test.S(t).ExpectEquals(HeldLeaderLeaseFencingToken(), int64(1))
+	test.S(t).ExpectTrue(IsLeaderLeaseValid())
+	test.S(t).ExpectNil(VerifyLeaderLease())
+	test.S(t).ExpectTrue(isGuardedWriteAllowed(t))
+}
+
+func TestRenewLeaderLease(t *testing.T) {
+	withLeaderLeaseElection(t)
+
+	acquired, err := attemptLeaseElection()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(acquired)
+
+	renewed, err := attemptLeaseElection()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(renewed)
+	lease, _, err := ReadLeaderLease()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(lease.FencingToken, int64(1))
+	test.S(t).ExpectEquals(HeldLeaderLeaseFencingToken(), int64(1))
+	test.S(t).ExpectTrue(isGuardedWriteAllowed(t))
+}
+
+func TestSupersededLeaderLease(t *testing.T) {
+	withLeaderLeaseElection(t)
+
+	acquired, err := attemptLeaseElection()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(acquired)
+
+	// Another node takes over, e.g. via grab-election, while this node still considers itself leader
+	setTestLeaderLease(t, "other-node", false)
+	test.S(t).ExpectTrue(IsLeaderLeaseValid())
+	test.S(t).ExpectFalse(isGuardedWriteAllowed(t))
+	test.S(t).ExpectNotNil(VerifyLeaderLease())
+	test.S(t).ExpectEquals(HeldLeaderLeaseFencingToken(), int64(0))
+	test.S(t).ExpectFalse(isGuardedWriteAllowed(t))
+
+	// This node fails renewing the lease, and may not acquire it while the other node holds it
+	acquired, err = attemptLeaseElection()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectFalse(acquired)
+	lease, _, err := ReadLeaderLease()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(lease.Hostname, "other-node")
+	test.S(t).ExpectEquals(lease.FencingToken, int64(2))
+
+	// Once the other node's lease expires, this node takes over with a grown fencing token
+	setTestLeaderLease(t, "", true)
+	acquired, err = attemptLeaseElection()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(acquired)
+	test.S(t).ExpectEquals(HeldLeaderLeaseFencingToken(), int64(3))
+	test.S(t).ExpectTrue(isGuardedWriteAllowed(t))
+}
+
+func TestRejectExpiredLeaderLease(t *testing.T) {
+	withLeaderLeaseElection(t)
+
+	acquired, err := attemptLeaseElection()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(acquired)
+
+	// The lease expires unrenewed, e.g. as the backend was unreachable: this node's writes are rejected, even
+	// though its fencing token is current
+	setTestLeaderLease(t, "", true)
+	test.S(t).ExpectFalse(isGuardedWriteAllowed(t))
+	test.S(t).ExpectNotNil(VerifyLeaderLease())
+
+	// The lease expires by this node's own clock
+	acquired, err = attemptLeaseElection()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(acquired)
+	test.S(t).ExpectEquals(HeldLeaderLeaseFencingToken(), int64(2))
+	setHeldLeaderLease(2, time.Now().Add(-time.Second))
+	test.S(t).ExpectFalse(IsLeaderLeaseValid())
+	_, _, err = LeaderLeaseFenceCondition()
+	test.S(t).ExpectNotNil(err)
+
+	// A revoked lease is no longer renewed
+	acquired, err = attemptLeaseElection()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(acquired)
+	test.S(t).ExpectNil(revokeLeaderLease())
+	test.S(t).ExpectFalse(isGuardedWriteAllowed(t))
+	acquired, err = attemptLeaseElection()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectFalse(acquired)
+}
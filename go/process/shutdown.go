@@ -0,0 +1,132 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package process
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/openark/golib/log"
+)
+
+var shutdownStartedUnixNano int64
+
+var inFlightOperations = make(map[int64]InFlightOperation)
+var inFlightOperationsMutex sync.Mutex
+var lastInFlightOperationId int64
+
+// InFlightOperation is an operation which a shutdown waits on to complete
+type InFlightOperation struct {
+	Id          int64
+	Description string
+	StartedAt   time.Time
+}
+
+// ShutdownStatus describes the progress of draining in-flight operations on shutdown
+type ShutdownStatus struct {
+	IsShuttingDown     bool
+	ShutdownStartedAt  time.Time
+	InFlightOperations []InFlightOperation
+}
+
+// IsShuttingDown returns true when this process has begun shutting down, at which time it
+// does not take on new operations
+func IsShuttingDown() bool {
+	return atomic.LoadInt64(&shutdownStartedUnixNano) != 0
+}
+
+// BeginInFlightOperation registers an operation which a shutdown should wait on.
+// The returned id is to be passed to EndInFlightOperation once the operation completes.
+func BeginInFlightOperation(description string) (id int64) {
+	inFlightOperationsMutex.Lock()
+	defer inFlightOperationsMutex.Unlock()
+
+	lastInFlightOperationId++
+	id = lastInFlightOperationId
+	inFlightOperations[id] = InFlightOperation{Id: id, Description: description, StartedAt: time.Now()}
+	return id
+}
+
+// EndInFlightOperation deregisters a completed operation
+func EndInFlightOperation(id int64) {
+	inFlightOperationsMutex.Lock()
+	defer inFlightOperationsMutex.Unlock()
+
+	delete(inFlightOperations, id)
+}
+
+// ReadInFlightOperations returns the currently in-flight operations, oldest first
+func ReadInFlightOperations() (operations []InFlightOperation) {
+	inFlightOperationsMutex.Lock()
+	defer inFlightOperationsMutex.Unlock()
+
+	for _, operation := range inFlightOperations {
+		operations = append(operations, operation)
+	}
+	sort.Slice(operations, func(i, j int) bool {
+		return operations[i].Id < operations[j].Id
+	})
+	return operations
+}
+
+// ReadShutdownStatus returns the current shutdown status
+func ReadShutdownStatus() *ShutdownStatus {
+	status := &ShutdownStatus{IsShuttingDown: IsShuttingDown()}
+	if status.IsShuttingDown {
+		status.ShutdownStartedAt = time.Unix(0, atomic.LoadInt64(&shutdownStartedUnixNano))
+		status.InFlightOperations = ReadInFlightOperations()
+	}
+	return status
+}
+
+// DrainInFlightOperations marks this process as shutting down, then waits for in-flight operations to complete,
+// for up to given timeout. countPendingFunc, when given, reports on additional pending operations which are not
+// registered as in-flight. Returns true when all operations have completed.
+func DrainInFlightOperations(timeout time.Duration, countPendingFunc func() int64) (drained bool) {
+	atomic.CompareAndSwapInt64(&shutdownStartedUnixNano, 0, time.Now().UnixNano())
+
+	countPending := func() int64 {
+		count := int64(len(ReadInFlightOperations()))
+		if countPendingFunc != nil {
+			count += countPendingFunc()
+		}
+		return count
+	}
+	deadline := time.Now().Add(timeout)
+	lastReported := time.Time{}
+	for {
+		pending := countPending()
+		if pending == 0 {
+			log.Infof("DrainInFlightOperations: all operations completed")
+			return true
+		}
+		if time.Now().After(deadline) {
+			log.Warningf("DrainInFlightOperations: timeout reached with %d operations still pending", pending)
+			for _, operation := range ReadInFlightOperations() {
+				log.Warningf("DrainInFlightOperations: abandoning %s, running for %+v", operation.Description, time.Since(operation.StartedAt))
+			}
+			return false
+		}
+		if time.Since(lastReported) >= 5*time.Second {
+			log.Infof("DrainInFlightOperations: waiting on %d pending operations; %+v left to drain timeout", pending, time.Until(deadline).Round(time.Second))
+			lastReported = time.Now()
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,58 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package process
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	test "github.com/openark/golib/tests"
+)
+
+func TestDrainInFlightOperations(t *testing.T) {
+	defer atomic.StoreInt64(&shutdownStartedUnixNano, 0)
+
+	test.S(t).ExpectFalse(IsShuttingDown())
+	test.S(t).ExpectFalse(ReadShutdownStatus().IsShuttingDown)
+
+	relocationId := BeginInFlightOperation("relocation")
+	recoveryId := BeginInFlightOperation("recovery")
+	operations := ReadInFlightOperations()
+	test.S(t).ExpectEquals(len(operations), 2)
+	test.S(t).ExpectEquals(operations[0].Description, "relocation")
+	test.S(t).ExpectEquals(operations[1].Description, "recovery")
+
+	// Drain times out while operations are in flight, yet the process is shutting down
+	test.S(t).ExpectFalse(DrainInFlightOperations(200*time.Millisecond, nil))
+	test.S(t).ExpectTrue(IsShuttingDown())
+	status := ReadShutdownStatus()
+	test.S(t).ExpectTrue(status.IsShuttingDown)
+	test.S(t).ExpectEquals(len(status.InFlightOperations), 2)
+
+	// Drain completes once in-flight operations, and pending ones, complete
+	var pending int64 = 1
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		EndInFlightOperation(relocationId)
+		EndInFlightOperation(recoveryId)
+		time.Sleep(100 * time.Millisecond)
+		atomic.StoreInt64(&pending, 0)
+	}()
+	test.S(t).ExpectTrue(DrainInFlightOperations(5*time.Second, func() int64 { return atomic.LoadInt64(&pending) }))
+	test.S(t).ExpectEquals(len(ReadInFlightOperations()), 0)
+}
@@ -20,6 +20,7 @@ import (
 	"encoding/json"
 	"io"
 	"strings"
+	"time"
 
 	"github.com/openark/golib/log"
 
@@ -48,6 +49,7 @@ func (f *fsm) Apply(l *raft.Log) interface{} {
 		return f.yieldByHint(hint)
 	}
 	log.Debugf("orchestrator/raft: applying command %+v: %s", l.Index, c.Op)
+	defer fsmApplyLatencyTimer.UpdateSince(time.Now())
 	return store.applier.ApplyCommand(c.Op, c.Value)
 }
 
@@ -17,8 +17,10 @@
 package orcraft
 
 import (
+	"bytes"
 	"crypto/tls"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -48,6 +50,15 @@ func setupHttpClient() error {
 }
 
 func HttpGetLeader(path string) (response []byte, err error) {
+	return httpLeader("GET", path, nil)
+}
+
+// HttpPostLeader posts given JSON body onto the leader's API at given path
+func HttpPostLeader(path string, body []byte) (response []byte, err error) {
+	return httpLeader("POST", path, body)
+}
+
+func httpLeader(method string, path string, requestBody []byte) (response []byte, err error) {
 	leaderURI := LeaderURI.Get()
 	if leaderURI == "" {
 		return nil, fmt.Errorf("Raft leader URI unknown")
@@ -60,7 +71,17 @@ func HttpGetLeader(path string) (response []byte, err error) {
 
 	url := fmt.Sprintf("%s/%s", leaderAPI, path)
 
-	req, err := http.NewRequest("GET", url, nil)
+	var bodyReader io.Reader
+	if requestBody != nil {
+		bodyReader = bytes.NewReader(requestBody)
+	}
+	req, err := http.NewRequest(method, url, bodyReader)
+	if err != nil {
+		return nil, err
+	}
+	if requestBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
 	switch strings.ToLower(config.Config.AuthenticationMethod) {
 	case "basic", "multi":
 		req.SetBasicAuth(config.Config.HTTPAuthUser, config.Config.HTTPAuthPassword)
@@ -78,7 +99,7 @@ func HttpGetLeader(path string) (response []byte, err error) {
 	}
 
 	if res.StatusCode != http.StatusOK {
-		return body, log.Errorf("HttpGetLeader: got %d status on %s", res.StatusCode, url)
+		return body, log.Errorf("HttpLeader: got %d status on %s %s", res.StatusCode, method, url)
 	}
 
 	return body, nil
@@ -0,0 +1,205 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package orcraft
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/openark/golib/log"
+	"github.com/rcrowley/go-metrics"
+)
+
+var commitLatencyTimer = metrics.NewTimer()
+var fsmApplyLatencyTimer = metrics.NewTimer()
+var maxFollowerAppliedIndexLagGauge = metrics.NewGauge()
+
+// laggingFollowers are the followers found lagging by the latest check
+var laggingFollowers = make(map[string]bool)
+var laggingFollowersMutex sync.Mutex
+
+func init() {
+	metrics.Register("raft.commit_latency", commitLatencyTimer)
+	metrics.Register("raft.fsm_apply_latency", fsmApplyLatencyTimer)
+	metrics.Register("raft.max_follower_applied_index_lag", maxFollowerAppliedIndexLagGauge)
+}
+
+// followerHealthReport is the latest health report of a follower, as seen by the leader
+type followerHealthReport struct {
+	AppliedIndex       int64 // -1 when the follower does not report its applied index
+	LeaderAppliedIndex uint64
+	ReportTimestamp    time.Time
+}
+
+// LatencyMetrics summarizes the latency of an operation, in milliseconds
+type LatencyMetrics struct {
+	Count      int64
+	MeanMillis float64
+	P50Millis  float64
+	P95Millis  float64
+	P99Millis  float64
+	MaxMillis  float64
+}
+
+func newLatencyMetrics(timer metrics.Timer) LatencyMetrics {
+	millis := func(nanos float64) float64 {
+		return nanos / float64(time.Millisecond)
+	}
+	percentiles := timer.Percentiles([]float64{0.5, 0.95, 0.99})
+	return LatencyMetrics{
+		Count:      timer.Count(),
+		MeanMillis: millis(timer.Mean()),
+		P50Millis:  millis(percentiles[0]),
+		P95Millis:  millis(percentiles[1]),
+		P99Millis:  millis(percentiles[2]),
+		MaxMillis:  millis(float64(timer.Max())),
+	}
+}
+
+// RaftFollowerMetrics describes how far behind the leader a follower is, as of its latest health report
+type RaftFollowerMetrics struct {
+	RaftAdvertise   string
+	AppliedIndex    int64
+	AppliedIndexLag uint64
+	ReportTimestamp time.Time
+	IsLagging       bool
+}
+
+// RaftMetrics describes the internals of this node's raft log and FSM
+type RaftMetrics struct {
+	State                  string
+	Leader                 string
+	LastLogIndex           uint64
+	CommitIndex            uint64
+	AppliedIndex           uint64
+	LastSnapshotIndex      uint64
+	LastSnapshotTimestamp  *time.Time
+	LastSnapshotAgeSeconds float64
+	LastSnapshotSizeBytes  int64
+	CommitLatency          LatencyMetrics
+	FSMApplyLatency        LatencyMetrics
+	Followers              []RaftFollowerMetrics // Only listed on the leader
+	Problems               []string
+}
+
+// snapshotTimestamp extracts the creation time of a snapshot from its ID, formatted as term-index-millis
+func snapshotTimestamp(snapshotId string) (timestamp time.Time, ok bool) {
+	tokens := strings.Split(snapshotId, "-")
+	millis, err := strconv.ParseInt(tokens[len(tokens)-1], 10, 64)
+	if len(tokens) != 3 || err != nil {
+		return timestamp, false
+	}
+	return time.Unix(0, millis*int64(time.Millisecond)), true
+}
+
+// readFollowersMetrics lists the followers which reported their health to this (leader) node
+func readFollowersMetrics() (followers []RaftFollowerMetrics) {
+	for raftAdvertise, item := range healthReportsCache.Items() {
+		report, ok := item.Object.(followerHealthReport)
+		if !ok {
+			continue
+		}
+		follower := RaftFollowerMetrics{
+			RaftAdvertise:   raftAdvertise,
+			AppliedIndex:    report.AppliedIndex,
+			ReportTimestamp: report.ReportTimestamp,
+		}
+		if report.AppliedIndex >= 0 && report.LeaderAppliedIndex > uint64(report.AppliedIndex) {
+			follower.AppliedIndexLag = report.LeaderAppliedIndex - uint64(report.AppliedIndex)
+		}
+		maxLag := config.Config.RaftFollowerMaxAppliedIndexLag
+		follower.IsLagging = maxLag > 0 && follower.AppliedIndexLag > maxLag
+		followers = append(followers, follower)
+	}
+	sort.Slice(followers, func(i, j int) bool { return followers[i].RaftAdvertise < followers[j].RaftAdvertise })
+	return followers
+}
+
+// ReadRaftMetrics returns the state of this node's raft log, snapshots and FSM, and, on the leader, the
+// applied index lag of the followers
+func ReadRaftMetrics() (*RaftMetrics, error) {
+	if !IsRaftEnabled() {
+		return nil, RaftNotRunning
+	}
+	stats := getRaft().Stats()
+	parseIndex := func(name string) uint64 {
+		index, _ := strconv.ParseUint(stats[name], 10, 64)
+		return index
+	}
+	raftMetrics := &RaftMetrics{
+		State:             GetState().String(),
+		Leader:            GetLeader(),
+		LastLogIndex:      parseIndex("last_log_index"),
+		CommitIndex:       parseIndex("commit_index"),
+		AppliedIndex:      getRaft().AppliedIndex(),
+		LastSnapshotIndex: parseIndex("last_snapshot_index"),
+		CommitLatency:     newLatencyMetrics(commitLatencyTimer),
+		FSMApplyLatency:   newLatencyMetrics(fsmApplyLatencyTimer),
+		Followers:         []RaftFollowerMetrics{},
+		Problems:          []string{},
+	}
+	if snapshots, err := store.snapshotStore.List(); err == nil && len(snapshots) > 0 {
+		raftMetrics.LastSnapshotSizeBytes = snapshots[0].Size
+		if timestamp, ok := snapshotTimestamp(snapshots[0].ID); ok {
+			raftMetrics.LastSnapshotTimestamp = &timestamp
+			raftMetrics.LastSnapshotAgeSeconds = time.Since(timestamp).Seconds()
+		}
+	}
+	if IsLeader() {
+		raftMetrics.Followers = readFollowersMetrics()
+		for _, follower := range raftMetrics.Followers {
+			if follower.IsLagging {
+				raftMetrics.Problems = append(raftMetrics.Problems, fmt.Sprintf("follower %s is %d log entries behind the leader", follower.RaftAdvertise, follower.AppliedIndexLag))
+			}
+		}
+	}
+	return raftMetrics, nil
+}
+
+// checkFollowersLag updates follower lag metrics on the leader, and logs followers as they start or stop lagging
+func checkFollowersLag() {
+	var maxLag uint64
+	lagging := make(map[string]bool)
+	for _, follower := range readFollowersMetrics() {
+		if follower.AppliedIndexLag > maxLag {
+			maxLag = follower.AppliedIndexLag
+		}
+		if follower.IsLagging {
+			lagging[follower.RaftAdvertise] = true
+		}
+	}
+	maxFollowerAppliedIndexLagGauge.Update(int64(maxLag))
+
+	laggingFollowersMutex.Lock()
+	defer laggingFollowersMutex.Unlock()
+	for raftAdvertise := range lagging {
+		if !laggingFollowers[raftAdvertise] {
+			log.Warningf("raft: follower %s is lagging by more than %d log entries", raftAdvertise, config.Config.RaftFollowerMaxAppliedIndexLag)
+		}
+	}
+	for raftAdvertise := range laggingFollowers {
+		if !lagging[raftAdvertise] {
+			log.Infof("raft: follower %s is no longer lagging", raftAdvertise)
+		}
+	}
+	laggingFollowers = lagging
+}
@@ -0,0 +1,103 @@
+/*
+   Copyright 2017 Shlomi Noach, GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package orcraft
+
+import (
+	"testing"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	test "github.com/openark/golib/tests"
+	"github.com/patrickmn/go-cache"
+)
+
+// withFollowerHealthReports starts given test with given health reports, keyed by follower
+func withFollowerHealthReports(t *testing.T, reports map[string]followerHealthReport) {
+	healthReportsCache.Flush()
+	for raftAdvertise, report := range reports {
+		healthReportsCache.Set(raftAdvertise, report, cache.DefaultExpiration)
+	}
+	maxLag := config.Config.RaftFollowerMaxAppliedIndexLag
+	t.Cleanup(func() {
+		healthReportsCache.Flush()
+		config.Config.RaftFollowerMaxAppliedIndexLag = maxLag
+	})
+}
+
+func TestSnapshotTimestamp(t *testing.T) {
+	{
+		timestamp, ok := snapshotTimestamp("3-1204-1571820000123")
+		test.S(t).ExpectTrue(ok)
+		test.S(t).ExpectTrue(timestamp.Equal(time.Unix(1571820000, 123*int64(time.Millisecond))))
+	}
+	for _, snapshotId := range []string{"", "1571820000123", "1204-1571820000123", "3-1204-now", "2-3-1204-1571820000123"} {
+		_, ok := snapshotTimestamp(snapshotId)
+		test.S(t).ExpectFalse(ok)
+	}
+}
+
+func TestReadFollowersMetrics(t *testing.T) {
+	withFollowerHealthReports(t, map[string]followerHealthReport{
+		"node-c:10008": {AppliedIndex: 900, LeaderAppliedIndex: 1000},
+		"node-a:10008": {AppliedIndex: 1000, LeaderAppliedIndex: 1000},
+		"node-b:10008": {AppliedIndex: -1, LeaderAppliedIndex: 1000},
+		// Reported while ahead of the leader's index as of the report
+		"node-d:10008": {AppliedIndex: 1001, LeaderAppliedIndex: 1000},
+	})
+	config.Config.RaftFollowerMaxAppliedIndexLag = 50
+
+	followers := readFollowersMetrics()
+	test.S(t).ExpectEquals(len(followers), 4)
+	test.S(t).ExpectEquals(followers[0].RaftAdvertise, "node-a:10008")
+	test.S(t).ExpectEquals(followers[0].AppliedIndexLag, uint64(0))
+	test.S(t).ExpectFalse(followers[0].IsLagging)
+	test.S(t).ExpectEquals(followers[1].RaftAdvertise, "node-b:10008")
+	test.S(t).ExpectEquals(followers[1].AppliedIndex, int64(-1))
+	test.S(t).ExpectEquals(followers[1].AppliedIndexLag, uint64(0))
+	test.S(t).ExpectFalse(followers[1].IsLagging)
+	test.S(t).ExpectEquals(followers[2].RaftAdvertise, "node-c:10008")
+	test.S(t).ExpectEquals(followers[2].AppliedIndexLag, uint64(100))
+	test.S(t).ExpectTrue(followers[2].IsLagging)
+	test.S(t).ExpectEquals(followers[3].AppliedIndexLag, uint64(0))
+	test.S(t).ExpectFalse(followers[3].IsLagging)
+
+	// Lag is reported, but never flagged, with no limit configured
+	config.Config.RaftFollowerMaxAppliedIndexLag = 0
+	followers = readFollowersMetrics()
+	test.S(t).ExpectEquals(followers[2].AppliedIndexLag, uint64(100))
+	test.S(t).ExpectFalse(followers[2].IsLagging)
+}
+
+func TestCheckFollowersLag(t *testing.T) {
+	withFollowerHealthReports(t, map[string]followerHealthReport{
+		"node-a:10008": {AppliedIndex: 1000, LeaderAppliedIndex: 1000},
+		"node-b:10008": {AppliedIndex: 700, LeaderAppliedIndex: 1000},
+		"node-c:10008": {AppliedIndex: 990, LeaderAppliedIndex: 1000},
+	})
+	config.Config.RaftFollowerMaxAppliedIndexLag = 50
+
+	checkFollowersLag()
+	test.S(t).ExpectEquals(maxFollowerAppliedIndexLagGauge.Value(), int64(300))
+	test.S(t).ExpectEquals(len(laggingFollowers), 1)
+	test.S(t).ExpectTrue(laggingFollowers["node-b:10008"])
+
+	// The follower catches up
+	healthReportsCache.Set("node-b:10008", followerHealthReport{AppliedIndex: 1000, LeaderAppliedIndex: 1010}, cache.DefaultExpiration)
+	checkFollowersLag()
+	test.S(t).ExpectEquals(maxFollowerAppliedIndexLagGauge.Value(), int64(10))
+	test.S(t).ExpectEquals(len(laggingFollowers), 0)
+}
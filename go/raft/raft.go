@@ -54,6 +54,9 @@ var healthRequestAuthenticationTokenCache = cache.New(config.RaftHealthPollSecon
 var healthReportsCache = cache.New(config.RaftHealthPollSeconds*2*time.Second, time.Second)
 var healthRequestReportCache = cache.New(time.Second, time.Second)
 
+// latestHealthRequestAuthenticationToken is the token of the latest health report requested of this node
+var latestHealthRequestAuthenticationToken atomic.Value
+
 var fatalRaftErrorChan = make(chan error)
 
 type leaderURI struct {
@@ -312,21 +315,58 @@ func PublishYieldHostnameHint(hostnameHint string) (response interface{}, err er
 
 // ReportToRaftLeader tells the leader this raft node is raft-healthy
 func ReportToRaftLeader(authenticationToken string) (err error) {
+	latestHealthRequestAuthenticationToken.Store(authenticationToken)
 	if err := healthRequestReportCache.Add(config.Config.RaftBind, true, cache.DefaultExpiration); err != nil {
 		// Recently reported
 		return nil
 	}
-	path := fmt.Sprintf("raft-follower-health-report/%s/%s/%s", authenticationToken, config.Config.RaftBind, config.Config.RaftAdvertise)
+	path := fmt.Sprintf("raft-follower-health-report/%s/%s/%s?appliedIndex=%d", authenticationToken, config.Config.RaftBind, config.Config.RaftAdvertise, getRaft().AppliedIndex())
 	_, err = HttpGetLeader(path)
 	return err
 }
 
-// OnHealthReport acts on a raft-member reporting its health
-func OnHealthReport(authenticationToken, raftBind, raftAdvertise string) (err error) {
+// OnHealthReport acts on a raft-member reporting its health. appliedIndex is the member's applied index,
+// or -1 if unreported.
+func OnHealthReport(authenticationToken, raftBind, raftAdvertise string, appliedIndex int64) (err error) {
 	if _, found := healthRequestAuthenticationTokenCache.Get(authenticationToken); !found {
 		return log.Errorf("Raft health report: unknown token %s", authenticationToken)
 	}
-	healthReportsCache.Set(raftAdvertise, true, cache.DefaultExpiration)
+	report := followerHealthReport{
+		AppliedIndex:       appliedIndex,
+		LeaderAppliedIndex: getRaft().AppliedIndex(),
+		ReportTimestamp:    time.Now(),
+	}
+	healthReportsCache.Set(raftAdvertise, report, cache.DefaultExpiration)
+	return nil
+}
+
+// IsHealthRequested checks whether the leader requested a health report of this node, and so whether
+// this node may post to the leader
+func IsHealthRequested() bool {
+	authenticationToken, _ := latestHealthRequestAuthenticationToken.Load().(string)
+	return authenticationToken != ""
+}
+
+// PostToRaftLeader posts given value, as JSON, onto the leader's API at given path. The path is suffixed by
+// the latest health request token, which the leader authenticates as proof of raft membership.
+func PostToRaftLeader(path string, value interface{}) (err error) {
+	authenticationToken, _ := latestHealthRequestAuthenticationToken.Load().(string)
+	if authenticationToken == "" {
+		return fmt.Errorf("PostToRaftLeader: no health report requested of this node as yet")
+	}
+	body, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = HttpPostLeader(fmt.Sprintf("%s/%s", path, authenticationToken), body)
+	return err
+}
+
+// AuthenticateRaftMember checks that given token was issued by this (leader) node in a recent health request
+func AuthenticateRaftMember(authenticationToken string) (err error) {
+	if _, found := healthRequestAuthenticationTokenCache.Get(authenticationToken); !found {
+		return fmt.Errorf("Raft member authentication: unknown token %s", authenticationToken)
+	}
 	return nil
 }
 
@@ -363,6 +403,7 @@ func Monitor() {
 				athenticationToken := util.NewToken().Short()
 				healthRequestAuthenticationTokenCache.Set(athenticationToken, true, cache.DefaultExpiration)
 				go PublishCommand("request-health-report", athenticationToken)
+				go checkFollowersLag()
 			}
 		case err := <-fatalRaftErrorChan:
 			log.Fatale(err)
@@ -18,8 +18,9 @@ type Store struct {
 	raftBind      string
 	raftAdvertise string
 
-	raft      *raft.Raft // The consensus mechanism
-	peerStore raft.PeerStore
+	raft          *raft.Raft // The consensus mechanism
+	peerStore     raft.PeerStore
+	snapshotStore *FileSnapshotStore
 
 	applier                CommandApplier
 	snapshotCreatorApplier SnapshotCreatorApplier
@@ -111,6 +112,7 @@ func (store *Store) Open(peerNodes []string) error {
 		return fmt.Errorf("error creating new raft: %s", err)
 	}
 	store.peerStore = peerStore
+	store.snapshotStore = snapshots
 	log.Infof("new raft created")
 
 	return nil
@@ -141,10 +143,12 @@ func (store *Store) genericCommand(op string, bytes []byte) (response interface{
 		return nil, err
 	}
 
+	applyStartTime := time.Now()
 	f := store.raft.Apply(b, raftTimeout)
 	if err = f.Error(); err != nil {
 		return nil, err
 	}
+	commitLatencyTimer.UpdateSince(applyStartTime)
 	r := f.Response()
 	if err, ok := r.(error); ok && err != nil {
 		// This code checks whether the response itself was an error object. If so, it should
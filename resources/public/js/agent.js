@@ -8,7 +8,7 @@ $(document).ready(function() {
     agent.AvailableLocalSnapshots || (agent.AvailableLocalSnapshots = [])
     agent.AvailableSnapshots || (agent.AvailableSnapshots = [])
     displayAgent(agent);
-  }, "json");
+  }, "json").fail(apiErrorHandler);
 
   $.get(appUrl("/api/agent-active-seeds/" + currentAgentHost()), function(activeSeeds) {
     showLoader();
@@ -28,9 +28,9 @@ $(document).ready(function() {
         seedStates.forEach(function(seedState) {
           appendSeedState(seedState);
         });
-      }, "json");
+      }, "json").fail(apiErrorHandler);
     }
-  }, "json");
+  }, "json").fail(apiErrorHandler);
   $.get(appUrl("/api/agent-recent-seeds/" + currentAgentHost()), function(recentSeeds) {
     showLoader();
     recentSeeds.forEach(function(recentSeed) {
@@ -39,7 +39,7 @@ $(document).ready(function() {
     if (recentSeeds.length == 0) {
       $("div.recent_seeds").parent().hide();
     }
-  }, "json");
+  }, "json").fail(apiErrorHandler);
 
   function displayAgent(agent) {
     if (!agent.Hostname) {
@@ -177,7 +177,7 @@ $(document).ready(function() {
       } else {
         location.reload();
       }
-    }, "json");
+    }, "json").fail(apiErrorHandler);
   });
   $("body").on("click", "button[data-command=mountlv]", function(event) {
     var lv = $(event.target).attr("data-lv")
@@ -189,7 +189,7 @@ $(document).ready(function() {
       } else {
         location.reload();
       }
-    }, "json");
+    }, "json").fail(apiErrorHandler);
   });
   $("body").on("click", "button[data-command=removelv]", function(event) {
     var lv = $(event.target).attr("data-lv")
@@ -204,7 +204,7 @@ $(document).ready(function() {
           } else {
             location.reload();
           }
-        }, "json");
+        }, "json").fail(apiErrorHandler);
       }
     });
   });
@@ -221,7 +221,7 @@ $(document).ready(function() {
           } else {
             location.reload();
           }
-        }, "json");
+        }, "json").fail(apiErrorHandler);
       }
     });
   });
@@ -238,7 +238,7 @@ $(document).ready(function() {
           } else {
             location.reload();
           }
-        }, "json");
+        }, "json").fail(apiErrorHandler);
       }
     });
   });
@@ -251,7 +251,7 @@ $(document).ready(function() {
       } else {
         location.reload();
       }
-    }, "json");
+    }, "json").fail(apiErrorHandler);
   });
   $("body").on("click", "button[data-command=seed]", function(event) {
     if (hasActiveSeeds) {
@@ -284,7 +284,7 @@ $(document).ready(function() {
           } else {
             location.reload();
           }
-        }, "json");
+        }, "json").fail(apiErrorHandler);
       }
     });
   });
@@ -8,6 +8,8 @@ var interestingAnalysis = {
 	"UnreachableMaster" : true,
 	"AllMasterSlavesNotReplicating" : true,
 	"AllMasterSlavesNotReplicatingOrDead" : true,
+	"MasterNotWritable" : true,
+	"MasterWritesNotReplicating" : true,
 	"AllMasterSlavesStale" : true,
 	"DeadCoMaster" : true,
 	"DeadCoMasterAndSomeSlaves" : true,
@@ -20,4 +22,6 @@ var interestingAnalysis = {
 	"AllIntermediateMasterSlavesNotReplicating" : true,
 	"UnreachableIntermediateMaster" : true,
 	"BinlogServerFailingToConnectToMaster" : true,
+	"ReplicaRelayLogCorruption" : true,
+	"ReplicaMasterBinlogCorruption" : true,
 };
@@ -101,6 +101,21 @@ function Cluster() {
     return true
   }
 
+  // isInstanceInDimensionFilter checks an instance against the "dimension=name:value" URL parameter, if given
+  function isInstanceInDimensionFilter(node) {
+    var dimensionFilter = getParameterByName("dimension");
+    if (!dimensionFilter || node.isAggregate) {
+      return true
+    }
+    var separatorIndex = dimensionFilter.indexOf(":");
+    if (separatorIndex < 0) {
+      return true
+    }
+    var dimension = dimensionFilter.substring(0, separatorIndex);
+    var value = dimensionFilter.substring(separatorIndex + 1);
+    return ((node.Dimensions || {})[dimension] || "") == value;
+  }
+
   function getInstanceDiv(instanceId) {
     var popoverDiv = $("#cluster_container > .instance[data-nodeid='" + instanceId + "']");
     return popoverDiv
@@ -260,6 +275,10 @@ function Cluster() {
       }
     }
 
+    if (!isInstanceInDimensionFilter(node)) {
+      $(instanceEl).addClass("dimension-filtered");
+    }
+
     activateInstanceDraggable(instanceEl);
     prepareInstanceDroppable(normalSectionEl);
     prepareInstanceMasterSectionDroppable(masterSectionEl);
@@ -1438,6 +1457,21 @@ function Cluster() {
       addSidebarInfoPopoverContent(content, "cluster-domain", true);
     }
 
+    getData("/api/cluster-note/" + currentClusterName(), function(note) {
+      if (note) {
+        var content = '<span class="glyphicon glyphicon-book text-warning" title="Cluster note"></span> ' + noteHtml(note);
+        addSidebarInfoPopoverContent(content, "cluster-note", true);
+      }
+    });
+
+    getData("/api/schema-migrations/" + currentClusterName(), function(migrations) {
+      migrations = migrations || []
+      migrations.forEach(function(migration) {
+        var content = '<span class="glyphicon glyphicon-wrench text-warning" title="Suppressing: ' + migration.SuppressedActions.join(', ') + '"></span> Schema migration ' + migration.MigrationId + ' by ' + migration.Owner + ' until ' + migration.ExpiresAtString;
+        addSidebarInfoPopoverContent(content, "schema-migration", true);
+      });
+    });
+
     var maxItems = 5
     getData("/api/audit-recovery/alias/" + clusterInfo.ClusterAlias, function(recoveries) {
       recoveries = recoveries || []
@@ -1889,7 +1923,7 @@ function Cluster() {
   });
 
   function getData(url, cb) {
-    $.get(appUrl(url), cb, "json");
+    $.get(appUrl(url), cb, "json").fail(apiErrorHandler);
   }
 
 
@@ -28,6 +28,6 @@ function discover(hostname, port) {
             		+instance.Key.Hostname+":"+instance.Key.Port+'</a>'
             	);
         }   
-    }, "json"); 
+    }, "json").fail(apiErrorHandler); 
 	
 }
\ No newline at end of file
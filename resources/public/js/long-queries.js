@@ -7,7 +7,7 @@ $(document).ready(function () {
             	// Read-only users don't get auto-refresh. Sorry!
             	activateRefreshTimer();
             }
-    	}, "json");
+    	}, "json").fail(apiErrorHandler);
     function displayProcesses(processes) {
         hideLoader();
         processes.forEach(function (process) {
@@ -54,7 +54,7 @@ $(document).ready(function () {
 					} else {
 						location.reload();
 					}	
-		        }, "json");
+		        }, "json").fail(apiErrorHandler);
 			}
         });
     });
@@ -142,7 +142,7 @@ function toHumanFormat(bytes) {
 }
 
 function getInstanceId(host, port) {
-  return "instance__" + host.replace(/[.]/g, "_") + "__" + port
+  return "instance__" + host.replace(/[.:\[\]]/g, "_") + "__" + port
 }
 
 
@@ -157,6 +157,10 @@ function getInstanceTitle(host, port) {
   if (host == "") {
     return "";
   }
+  if (host.indexOf(":") >= 0) {
+    // IPv6 literal
+    return canonizeInstanceTitle("[" + host + "]:" + port);
+  }
   return canonizeInstanceTitle(host + ":" + port);
 }
 
@@ -180,17 +184,24 @@ function addInfo(alertText) {
   return addAlert(alertText, "info");
 }
 
+// apiErrorHandler alerts on a failed API request. API errors are responded with a non-2xx HTTP status, and so
+// are handled here rather than by the request's success callback.
+function apiErrorHandler(jqXHR) {
+  hideLoader();
+  if (jqXHR.responseJSON && jqXHR.responseJSON.Code == "ERROR") {
+    addAlert(jqXHR.responseJSON.Message);
+  } else {
+    addAlert("Request failed: " + (jqXHR.statusText || "unknown error"));
+  }
+  return false;
+}
+
 function apiCommand(uri, hint) {
   showLoader();
   $.get(appUrl(uri), function(operationResult) {
     hideLoader();
     reloadWithOperationResult(operationResult, hint);
-  }, "json").fail(function(operationResult) {
-    hideLoader();
-    if (operationResult.responseJSON.Code == "ERROR") {
-      addAlert(operationResult.responseJSON.Message)
-    }
-  });
+  }, "json").fail(apiErrorHandler);
   return false;
 }
 
@@ -234,6 +245,15 @@ function addNodeModalDataAttribute(name, value) {
   return $('#modalDataAttributesTable tr:last td:last');
 }
 
+// noteHtml renders an instance or cluster note, escaped, along with a link to its runbook, if any
+function noteHtml(note) {
+  var html = $('<div/>').text(note.Note).html();
+  if (note.RunbookURL) {
+    html += ' ' + $('<a target="_blank">Runbook</a>').attr('href', note.RunbookURL)[0].outerHTML;
+  }
+  return html;
+}
+
 function addModalAlert(alertText) {
   $("#node_modal .modal-body").append(
     '<div class="alert alert-danger alert-dismissable">' + '<button type="button" class="close" data-dismiss="alert" aria-hidden="true">&times;</button>' + alertText + '</div>');
@@ -267,6 +287,11 @@ function openNodeModal(node) {
     addNodeModalDataAttribute("Instance Alias", node.InstanceAlias);
   }
   addNodeModalDataAttribute("Last seen", node.LastSeenTimestamp + " (" + node.SecondsSinceLastSeen.Int64 + "s ago)");
+  $.get(appUrl("/api/instance-note/" + node.Key.Hostname + "/" + node.Key.Port), function(note) {
+    if (note) {
+      addNodeModalDataAttribute("Note", noteHtml(note));
+    }
+  }, "json");
   if (node.UnresolvedHostname) {
     addNodeModalDataAttribute("Unresolved hostname", node.UnresolvedHostname);
   }
@@ -297,6 +322,16 @@ function openNodeModal(node) {
     addNodeModalDataAttribute("Seconds behind master", node.SecondsBehindMaster.Valid ? node.SecondsBehindMaster.Int64 : "null");
     addNodeModalDataAttribute("Replication lag", node.SlaveLagSeconds.Valid ? node.SlaveLagSeconds.Int64 : "null");
     addNodeModalDataAttribute("SQL delay", node.SQLDelay);
+    if (node.IsDelayedReplica) {
+      var intendedDelay = node.IntendedSQLDelay + " seconds";
+      if (node.IsSQLDelaySuspended) {
+        intendedDelay += " (suspended until " + node.SQLDelaySuspendedUntil + ")";
+      }
+      addNodeModalDataAttribute("Intended SQL delay", intendedDelay);
+    }
+    if (node.EffectiveDataAgeSeconds.Valid) {
+      addNodeModalDataAttribute("Effective data age", node.EffectiveDataAgeSeconds.Int64 + " seconds");
+    }
 
     var masterCoordinatesEl = addNodeModalDataAttribute("Master coordinates", node.ExecBinlogCoordinates.LogFile + ":" + node.ExecBinlogCoordinates.LogPos);
     $('#node_modal [data-btn-group=move-equivalent] ul').empty();
@@ -370,8 +405,19 @@ function openNodeModal(node) {
     }
   }
   addNodeModalDataAttribute("Semi-sync enforced", booleanString(node.SemiSyncEnforced));
+  if (node.SemiSyncMasterConfigured) {
+    addNodeModalDataAttribute("Semi-sync master",
+      (node.SemiSyncAsyncFallback ? "fell back to async" : "active") + ", timeout: " + node.SemiSyncMasterTimeout + "ms, wait point: " + node.SemiSyncMasterWaitPoint +
+      ", clients: " + node.SemiSyncMasterClients + ", fallbacks: " + node.SemiSyncMasterNoTimes);
+  }
 
   addNodeModalDataAttribute("Uptime", node.Uptime);
+  if (node.Dimensions && !$.isEmptyObject(node.Dimensions)) {
+    var dimensions = Object.keys(node.Dimensions).sort().map(function(dimension) {
+      return dimension + ": " + node.Dimensions[dimension];
+    });
+    addNodeModalDataAttribute("Dimensions", $('<div/>').text(dimensions.join(", ")).html());
+  }
   addNodeModalDataAttribute("Allow TLS", node.AllowTLS);
   addNodeModalDataAttribute("Cluster",
     '<a href="' + appUrl('/web/cluster/' + node.ClusterName) + '">' + node.ClusterName + '</a>');
@@ -840,6 +886,9 @@ function renderInstanceElement(popoverElement, instance, renderType) {
     if (instance.SemiSyncMasterEnabled) {
       popoverElement.find("h3 div.pull-right").prepend('<span class="glyphicon glyphicon-check" title="Semi sync enabled (master side)"></span> ');
     }
+    if (instance.SemiSyncAsyncFallback) {
+      popoverElement.find("h3 div.pull-right").prepend('<span class="glyphicon glyphicon-warning-sign text-danger" title="Semi sync configured, yet fell back to asynchronous replication"></span> ');
+    }
     if (instance.SemiSyncReplicaEnabled) {
       popoverElement.find("h3 div.pull-right").prepend('<span class="glyphicon glyphicon-saved" title="Semi sync enabled (replica side)"></span> ');
     }
@@ -865,8 +914,21 @@ function renderInstanceElement(popoverElement, instance, renderType) {
       var downtimeMessage = 'Downtimed by ' + instance.DowntimeOwner + ': ' + instance.DowntimeReason + '.\nEnds: ' + instance.DowntimeEndTimestamp;
       popoverElement.find("h3 div.pull-right").prepend('<span class="glyphicon glyphicon-volume-off" title="' + downtimeMessage + '"></span> ');
     }
+    if (instance.IsDiscoveryPaused) {
+      popoverElement.find("h3 div.pull-right").prepend('<span class="glyphicon glyphicon-pause" title="Discovery paused; data is stale"></span> ');
+    }
+    if (instance.IsDelayedReplica) {
+      var delayMessage = 'Delayed replica: ' + instance.IntendedSQLDelay + 's intended delay';
+      if (instance.IsSQLDelaySuspended) {
+        delayMessage += ', suspended until ' + instance.SQLDelaySuspendedUntil;
+      }
+      popoverElement.find("h3 div.pull-right").prepend('<span class="glyphicon glyphicon-time" title="' + delayMessage + '"></span> ');
+    }
 
-    if (instance.lastCheckInvalidProblem()) {
+    if (instance.IsDiscoveryPaused) {
+      instance.renderHint = "stale";
+      indicateLastSeenInStatus = true;
+    } else if (instance.lastCheckInvalidProblem()) {
       instance.renderHint = "fatal";
       indicateLastSeenInStatus = true;
     } else if (instance.notRecentlyCheckedProblem()) {
@@ -883,6 +945,9 @@ function renderInstanceElement(popoverElement, instance, renderType) {
       popoverElement.find("h3").addClass("label-" + instance.renderHint);
     }
     var statusMessage = instance.SlaveLagSeconds.Int64 + 's lag';
+    if (instance.EffectiveDataAgeSeconds.Valid) {
+      statusMessage = instance.EffectiveDataAgeSeconds.Int64 + 's data age';
+    }
     if (indicateLastSeenInStatus) {
       statusMessage = 'seen ' + instance.SecondsSinceLastSeen.Int64 + ' seconds ago';
     }
@@ -50,7 +50,7 @@ $("body").on("click", "button[data-command=abort-seed]", function(event) {
 				} else {
 					location.reload();
 				}	
-	        }, "json");
+	        }, "json").fail(apiErrorHandler);
 		}
 	});
 });